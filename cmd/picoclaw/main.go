@@ -10,6 +10,7 @@ import (
 	"bufio"
 	"context"
 	"embed"
+	"encoding/json"
 	"fmt"
 	"io"
 	"io/fs"
@@ -18,25 +19,36 @@ import (
 	"os/signal"
 	"path/filepath"
 	"runtime"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/chzyer/readline"
 	"github.com/sipeed/picoclaw/pkg/agent"
+	"github.com/sipeed/picoclaw/pkg/audit"
 	"github.com/sipeed/picoclaw/pkg/auth"
 	"github.com/sipeed/picoclaw/pkg/bus"
 	"github.com/sipeed/picoclaw/pkg/channels"
 	"github.com/sipeed/picoclaw/pkg/config"
 	"github.com/sipeed/picoclaw/pkg/cron"
 	"github.com/sipeed/picoclaw/pkg/devices"
+	"github.com/sipeed/picoclaw/pkg/eval"
+	"github.com/sipeed/picoclaw/pkg/feedback"
 	"github.com/sipeed/picoclaw/pkg/health"
 	"github.com/sipeed/picoclaw/pkg/heartbeat"
 	"github.com/sipeed/picoclaw/pkg/logger"
 	"github.com/sipeed/picoclaw/pkg/migrate"
+	"github.com/sipeed/picoclaw/pkg/ocr"
+	"github.com/sipeed/picoclaw/pkg/pairing"
 	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/scaffold"
+	"github.com/sipeed/picoclaw/pkg/scheduler"
+	"github.com/sipeed/picoclaw/pkg/shadow"
 	"github.com/sipeed/picoclaw/pkg/skills"
 	"github.com/sipeed/picoclaw/pkg/state"
 	"github.com/sipeed/picoclaw/pkg/tools"
+	"github.com/sipeed/picoclaw/pkg/tools/mcp"
+	"github.com/sipeed/picoclaw/pkg/utils"
 	"github.com/sipeed/picoclaw/pkg/voice"
 )
 
@@ -142,6 +154,24 @@ func main() {
 		authCmd()
 	case "cron":
 		cronCmd()
+	case "config":
+		configCmd()
+	case "gen":
+		genCmd()
+	case "audit":
+		auditCmd()
+	case "mcp":
+		mcpCmd()
+	case "pairing":
+		pairingCmd()
+	case "replay":
+		replayCmd()
+	case "shadow":
+		shadowCmd()
+	case "feedback":
+		feedbackCmd()
+	case "eval":
+		evalCmd()
 	case "skills":
 		if len(os.Args) < 3 {
 			skillsHelp()
@@ -208,10 +238,19 @@ func printHelp() {
 	fmt.Println("  onboard     Initialize picoclaw configuration and workspace")
 	fmt.Println("  agent       Interact with the agent directly")
 	fmt.Println("  auth        Manage authentication (login, logout, status)")
+	fmt.Println("  audit       Show the tool call audit log")
 	fmt.Println("  gateway     Start picoclaw gateway")
 	fmt.Println("  status      Show picoclaw status")
 	fmt.Println("  cron        Manage scheduled tasks")
+	fmt.Println("  eval        Run a golden Q&A suite and report regressions")
+	fmt.Println("  feedback    Summarize or export users' ratings of answers")
+	fmt.Println("  config      Validate config or export its JSON schema")
+	fmt.Println("  gen         Generate code skeletons (gen tool <name>)")
+	fmt.Println("  mcp         Serve picoclaw tools to MCP hosts (mcp serve)")
 	fmt.Println("  migrate     Migrate from OpenClaw to PicoClaw")
+	fmt.Println("  pairing     List, approve or revoke channel access requests")
+	fmt.Println("  replay      Show or re-run a past turn from the audit log")
+	fmt.Println("  shadow      Compare shadow models and tools with the live ones")
 	fmt.Println("  skills      Manage skills (install, list, remove)")
 	fmt.Println("  version     Show version information")
 }
@@ -373,6 +412,7 @@ func migrateHelp() {
 func agentCmd() {
 	message := ""
 	sessionKey := "cli:default"
+	replayPath := ""
 
 	args := os.Args[2:]
 	for i := 0; i < len(args); i++ {
@@ -390,6 +430,11 @@ func agentCmd() {
 				sessionKey = args[i+1]
 				i++
 			}
+		case "--replay":
+			if i+1 < len(args) {
+				replayPath = args[i+1]
+				i++
+			}
 		}
 	}
 
@@ -399,7 +444,7 @@ func agentCmd() {
 		os.Exit(1)
 	}
 
-	provider, err := providers.CreateProvider(cfg)
+	provider, err := createProvider(cfg, replayPath)
 	if err != nil {
 		fmt.Printf("Error creating provider: %v\n", err)
 		os.Exit(1)
@@ -407,6 +452,7 @@ func agentCmd() {
 
 	msgBus := bus.NewMessageBus()
 	agentLoop := agent.NewAgentLoop(cfg, msgBus, provider)
+	go agentLoop.DownloadTokenizers(context.Background())
 
 	// Print agent startup info (only for interactive mode)
 	startupInfo := agentLoop.GetStartupInfo()
@@ -417,6 +463,10 @@ func agentCmd() {
 			"skills_available": startupInfo["skills"].(map[string]interface{})["available"],
 		})
 
+	if approvals := agentLoop.Approvals(); approvals != nil {
+		approvals.SetPrompter(promptApproval)
+	}
+
 	if message != "" {
 		ctx := context.Background()
 		response, err := agentLoop.ProcessDirect(ctx, message, sessionKey)
@@ -431,6 +481,28 @@ func agentCmd() {
 	}
 }
 
+// createProvider creates the configured provider, or one that serves the
+// provider calls captured to replayPath when it is set.
+func createProvider(cfg *config.Config, replayPath string) (providers.LLMProvider, error) {
+	if replayPath != "" {
+		return providers.NewReplayProvider(replayPath)
+	}
+	return providers.CreateProvider(cfg)
+}
+
+// promptApproval asks on the terminal whether a gated tool call may run.
+func promptApproval(ctx context.Context, req tools.ApprovalRequest) (bool, error) {
+	argsJSON, _ := json.Marshal(req.Args)
+	fmt.Printf("\n⚠️  Approval required: %s %s\nAllow? [y/N]: ", req.Tool, string(argsJSON))
+
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return false, err
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes", nil
+}
+
 func interactiveMode(agentLoop *agent.AgentLoop, sessionKey string) {
 	prompt := fmt.Sprintf("%s You: ", logo)
 
@@ -542,6 +614,7 @@ func gatewayCmd() {
 
 	msgBus := bus.NewMessageBus()
 	agentLoop := agent.NewAgentLoop(cfg, msgBus, provider)
+	go agentLoop.DownloadTokenizers(context.Background())
 
 	// Print agent startup info
 	fmt.Println("\n📦 Agent Status:")
@@ -565,6 +638,12 @@ func gatewayCmd() {
 	execTimeout := time.Duration(cfg.Tools.Cron.ExecTimeoutMinutes) * time.Minute
 	cronService := setupCronTool(agentLoop, msgBus, cfg.WorkspacePath(), cfg.Agents.Defaults.RestrictToWorkspace, execTimeout, cfg)
 
+	// Proactive messages: scheduled tasks run as agent turns
+	var taskScheduler *scheduler.Scheduler
+	if cfg.Scheduler.Enabled {
+		taskScheduler = setupScheduler(agentLoop, msgBus, cfg)
+	}
+
 	heartbeatService := heartbeat.NewHeartbeatService(
 		cfg.WorkspacePath(),
 		cfg.Heartbeat.Interval,
@@ -629,6 +708,33 @@ func gatewayCmd() {
 				logger.InfoC("voice", "Groq transcription attached to OneBot channel")
 			}
 		}
+		if whatsappChannel, ok := channelManager.GetChannel("whatsapp"); ok {
+			if wc, ok := whatsappChannel.(*channels.WhatsAppCloudChannel); ok {
+				wc.SetTranscriber(transcriber)
+				logger.InfoC("voice", "Groq transcription attached to WhatsApp channel")
+			}
+		}
+	}
+
+	if cfg.Tools.OCR.Enabled {
+		recognizer, err := ocr.New(cfg.Tools.OCR)
+		if err != nil {
+			logger.WarnCF("ocr", "Image text recognition disabled", map[string]interface{}{"error": err.Error()})
+		} else {
+			for _, name := range []string{"telegram", "discord", "slack", "onebot", "whatsapp"} {
+				ch, ok := channelManager.GetChannel(name)
+				if !ok {
+					continue
+				}
+				if oc, ok := ch.(interface{ SetOCR(ocr.Recognizer) }); ok {
+					oc.SetOCR(recognizer)
+					logger.InfoCF("ocr", "Image text recognition attached to channel", map[string]interface{}{
+						"channel": name,
+						"backend": cfg.Tools.OCR.Backend,
+					})
+				}
+			}
+		}
 	}
 
 	enabledChannels := channelManager.GetEnabledChannels()
@@ -649,6 +755,14 @@ func gatewayCmd() {
 	}
 	fmt.Println("✓ Cron service started")
 
+	if taskScheduler != nil {
+		if err := taskScheduler.Start(); err != nil {
+			fmt.Printf("Error starting scheduler: %v\n", err)
+		} else {
+			fmt.Println("✓ Scheduler started")
+		}
+	}
+
 	if err := heartbeatService.Start(); err != nil {
 		fmt.Printf("Error starting heartbeat service: %v\n", err)
 	}
@@ -671,12 +785,34 @@ func gatewayCmd() {
 	}
 
 	healthServer := health.NewServer(cfg.Gateway.Host, cfg.Gateway.Port)
+	if len(cfg.Gateway.APITokens) > 0 {
+		healthServer.Handle("/api/tools", agentLoop.ToolCatalogHandler())
+		healthServer.Handle("/api/audit", agentLoop.AuditHandler())
+		healthServer.Handle("/api/sessions/fork", agentLoop.ForkHandler())
+		healthServer.Handle("/api/usage", agentLoop.UsageHandler())
+		healthServer.Handle("/api/providers/health", agentLoop.ProviderHealthHandler())
+		healthServer.Handle("/api/answer-cache", agentLoop.AnswerCacheHandler())
+		healthServer.Handle("/api/feedback", agentLoop.FeedbackHandler())
+		if cfg.Gateway.OpenAIAPI {
+			healthServer.Handle("/v1/chat/completions", agentLoop.ChatCompletionsHandler())
+			healthServer.Handle("/v1/models", agentLoop.ModelsHandler())
+		}
+	}
+	if agentLoop.Usage() != nil {
+		healthServer.Handle("/metrics", agentLoop.MetricsHandler())
+	}
 	go func() {
 		if err := healthServer.Start(); err != nil && err != http.ErrServerClosed {
 			logger.ErrorCF("health", "Health server error", map[string]interface{}{"error": err.Error()})
 		}
 	}()
 	fmt.Printf("✓ Health endpoints available at http://%s:%d/health and /ready\n", cfg.Gateway.Host, cfg.Gateway.Port)
+	if len(cfg.Gateway.APITokens) > 0 {
+		fmt.Printf("✓ Tool catalog available at http://%s:%d/api/tools\n", cfg.Gateway.Host, cfg.Gateway.Port)
+		if cfg.Gateway.OpenAIAPI {
+			fmt.Printf("✓ OpenAI-compatible API available at http://%s:%d/v1\n", cfg.Gateway.Host, cfg.Gateway.Port)
+		}
+	}
 
 	go agentLoop.Run(ctx)
 
@@ -690,6 +826,9 @@ func gatewayCmd() {
 	deviceService.Stop()
 	heartbeatService.Stop()
 	cronService.Stop()
+	if taskScheduler != nil {
+		taskScheduler.Stop()
+	}
 	agentLoop.Stop()
 	channelManager.StopAll(ctx)
 	fmt.Println("✓ Gateway stopped")
@@ -991,9 +1130,18 @@ func authStatusCmd() {
 	}
 }
 
+// getConfigPath returns the first existing config file in ~/.picoclaw
+// (config.json, config.yaml, config.yml, config.toml), defaulting to config.json.
 func getConfigPath() string {
 	home, _ := os.UserHomeDir()
-	return filepath.Join(home, ".picoclaw", "config.json")
+	dir := filepath.Join(home, ".picoclaw")
+	for _, name := range config.ConfigFileNames {
+		path := filepath.Join(dir, name)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return filepath.Join(dir, config.ConfigFileNames[0])
 }
 
 func setupCronTool(agentLoop *agent.AgentLoop, msgBus *bus.MessageBus, workspace string, restrict bool, execTimeout time.Duration, config *config.Config) *cron.CronService {
@@ -1005,6 +1153,9 @@ func setupCronTool(agentLoop *agent.AgentLoop, msgBus *bus.MessageBus, workspace
 	// Create and register CronTool
 	cronTool := tools.NewCronTool(cronService, agentLoop, msgBus, workspace, restrict, execTimeout, config)
 	agentLoop.RegisterTool(cronTool)
+	if config.Tools.Medications.Enabled {
+		agentLoop.RegisterMedicationTools(cronService, config.Tools.Medications.Timezone)
+	}
 
 	// Set the onJob handler
 	cronService.SetOnJob(func(job *cron.CronJob) (string, error) {
@@ -1012,13 +1163,821 @@ func setupCronTool(agentLoop *agent.AgentLoop, msgBus *bus.MessageBus, workspace
 		return result, nil
 	})
 
+	// Track reminder acknowledgments and escalate repeated misses
+	cronService.SetAckWindow(time.Duration(config.Tools.Cron.AckWindowMinutes) * time.Minute)
+	cronService.SetOnMiss(func(job *cron.CronJob) {
+		cronTool.HandleMissedAck(job)
+	})
+	msgBus.AddInboundFilter(func(msg bus.InboundMessage) bool {
+		reply, handled := cronTool.HandleAckCommand(msg.Channel, msg.ChatID, msg.Content)
+		if handled {
+			msgBus.PublishOutbound(bus.OutboundMessage{
+				Channel: msg.Channel,
+				ChatID:  msg.ChatID,
+				Content: reply,
+			})
+		}
+		return handled
+	})
+
 	return cronService
 }
 
+// setupScheduler registers schedule_task and loads the tasks from config.
+func setupScheduler(agentLoop *agent.AgentLoop, msgBus *bus.MessageBus, cfg *config.Config) *scheduler.Scheduler {
+	storePath := filepath.Join(cfg.WorkspacePath(), "scheduler", "tasks.json")
+	timeout := time.Duration(cfg.Scheduler.TimeoutMinutes) * time.Minute
+	taskScheduler := scheduler.New(storePath, agentLoop, msgBus, timeout)
+	if err := taskScheduler.Sync(cfg.Scheduler.Tasks); err != nil {
+		fmt.Printf("Error loading scheduled tasks: %v\n", err)
+	}
+	agentLoop.RegisterTool(tools.NewScheduleTaskTool(taskScheduler))
+	return taskScheduler
+}
+
 func loadConfig() (*config.Config, error) {
 	return config.LoadConfig(getConfigPath())
 }
 
+func configCmd() {
+	if len(os.Args) < 3 {
+		configHelp()
+		return
+	}
+
+	switch os.Args[2] {
+	case "validate":
+		path := getConfigPath()
+		if len(os.Args) > 3 {
+			path = os.Args[3]
+		}
+		if _, err := os.Stat(path); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		if _, err := config.LoadConfig(path); err != nil {
+			fmt.Printf("✗ %s\n%v\n", path, err)
+			os.Exit(1)
+		}
+		fmt.Printf("✓ %s is valid\n", path)
+	case "schema":
+		data, err := config.MarshalJSONSchema()
+		if err != nil {
+			fmt.Printf("Error generating schema: %v\n", err)
+			os.Exit(1)
+		}
+		if len(os.Args) > 4 && (os.Args[3] == "-o" || os.Args[3] == "--output") {
+			if err := os.WriteFile(os.Args[4], data, 0644); err != nil {
+				fmt.Printf("Error writing schema: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Printf("✓ Schema written to %s\n", os.Args[4])
+			return
+		}
+		fmt.Println(string(data))
+	default:
+		fmt.Printf("Unknown config command: %s\n", os.Args[2])
+		configHelp()
+	}
+}
+
+func configHelp() {
+	fmt.Println("\nConfig commands:")
+	fmt.Println("  validate [path]        Check a config file (JSON, YAML, or TOML) for errors")
+	fmt.Println("  schema [-o file]       Print or write the JSON schema for editor autocomplete")
+	fmt.Println()
+	fmt.Println("Config is read from ~/.picoclaw/config.json, config.yaml, config.yml, or config.toml (first found).")
+}
+
+func auditCmd() {
+	filter := audit.Filter{Limit: 50}
+	asJSON := false
+	args := os.Args[2:]
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "-s", "--session":
+			if i+1 < len(args) {
+				filter.SessionKey = args[i+1]
+				i++
+			}
+		case "-u", "--user":
+			if i+1 < len(args) {
+				filter.UserID = args[i+1]
+				i++
+			}
+		case "-t", "--tool":
+			if i+1 < len(args) {
+				filter.Tool = args[i+1]
+				i++
+			}
+		case "--turn":
+			if i+1 < len(args) {
+				filter.TurnID = args[i+1]
+				i++
+			}
+		case "-n", "--limit":
+			if i+1 < len(args) {
+				fmt.Sscanf(args[i+1], "%d", &filter.Limit)
+				i++
+			}
+		case "--json":
+			asJSON = true
+		case "-h", "--help", "help":
+			auditHelp()
+			return
+		default:
+			fmt.Printf("Unknown option: %s\n", args[i])
+			auditHelp()
+			os.Exit(1)
+		}
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Printf("Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+
+	path := cfg.AuditPath()
+	entries, err := audit.Query(path, filter)
+	if err != nil {
+		fmt.Printf("Error reading audit log: %v\n", err)
+		os.Exit(1)
+	}
+
+	if asJSON {
+		for _, e := range entries {
+			data, _ := json.Marshal(e)
+			fmt.Println(string(data))
+		}
+		return
+	}
+
+	if len(entries) == 0 {
+		fmt.Printf("No audit entries in %s\n", path)
+		if !cfg.Tools.Audit.Enabled {
+			fmt.Println("Auditing is disabled; set tools.audit.enabled to true to record tool calls.")
+		}
+		return
+	}
+
+	for _, e := range entries {
+		status := "✓"
+		if !e.Success {
+			status = "✗"
+		}
+		args, _ := json.Marshal(e.Args)
+		fmt.Printf("%s %s %-28s %6dms  session=%s user=%s", e.Time.Local().Format("2006-01-02 15:04:05"), status, e.Tool, e.DurationMs, e.SessionKey, e.UserID)
+		if e.TurnID != "" {
+			fmt.Printf(" turn=%s", e.TurnID)
+		}
+		fmt.Println()
+		fmt.Printf("    args: %s\n", args)
+		if e.Error != "" {
+			fmt.Printf("    error: %s\n", e.Error)
+		}
+	}
+}
+
+func auditHelp() {
+	fmt.Println("\nAudit options:")
+	fmt.Println("  -s, --session <key>   Only calls from this session")
+	fmt.Println("  -u, --user <id>       Only calls made for this user")
+	fmt.Println("  -t, --tool <name>     Only calls to this tool")
+	fmt.Println("  --turn <id>           Only calls from this turn")
+	fmt.Println("  -n, --limit <n>       Show the most recent n calls (default 50, 0 for all)")
+	fmt.Println("  --json                Print raw JSON lines")
+}
+
+func pairingCmd() {
+	if len(os.Args) < 3 {
+		pairingHelp()
+		return
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Printf("Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+	store := pairing.NewStore(cfg.PairingPath())
+
+	switch os.Args[2] {
+	case "list":
+		pending, approved, err := store.List()
+		if err != nil {
+			fmt.Printf("Error reading pairings: %v\n", err)
+			os.Exit(1)
+		}
+		if len(pending) == 0 && len(approved) == 0 {
+			fmt.Println("No pairing requests.")
+			return
+		}
+		if len(pending) > 0 {
+			fmt.Println("Pending:")
+			for _, r := range pending {
+				fmt.Printf("  %-10s %-24s %s  (requested %s)\n", r.Channel, r.SenderID, r.Code, r.CreatedAt.Local().Format("2006-01-02 15:04"))
+			}
+		}
+		if len(approved) > 0 {
+			fmt.Println("Approved:")
+			for _, a := range approved {
+				fmt.Printf("  %-10s %-24s (approved %s)\n", a.Channel, a.SenderID, a.ApprovedAt.Local().Format("2006-01-02 15:04"))
+			}
+		}
+	case "approve":
+		if len(os.Args) < 5 {
+			fmt.Println("Usage: picoclaw pairing approve <channel> <code>")
+			return
+		}
+		approval, err := store.Approve(os.Args[3], os.Args[4])
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("✓ %s may now use %s\n", approval.SenderID, approval.Channel)
+	case "revoke":
+		if len(os.Args) < 5 {
+			fmt.Println("Usage: picoclaw pairing revoke <channel> <sender_id>")
+			return
+		}
+		if err := store.Revoke(os.Args[3], os.Args[4]); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("✓ %s may no longer use %s\n", os.Args[4], os.Args[3])
+	default:
+		fmt.Printf("Unknown pairing command: %s\n", os.Args[2])
+		pairingHelp()
+	}
+}
+
+func pairingHelp() {
+	fmt.Println("\nPairing commands:")
+	fmt.Println("  list                          Show pending requests and approved senders")
+	fmt.Println("  approve <channel> <code>      Allow the sender who was given code")
+	fmt.Println("  revoke <channel> <sender_id>  Remove a sender's access")
+	fmt.Println()
+	fmt.Println("Pairing is turned on per channel with channels.access.<channel>.pairing.")
+}
+
+func replayCmd() {
+	turnID := ""
+	run := false
+	asJSON := false
+	for _, arg := range os.Args[2:] {
+		switch arg {
+		case "--run":
+			run = true
+		case "--json":
+			asJSON = true
+		case "-h", "--help", "help":
+			replayHelp()
+			return
+		default:
+			if strings.HasPrefix(arg, "-") || turnID != "" {
+				fmt.Printf("Unknown option: %s\n", arg)
+				replayHelp()
+				os.Exit(1)
+			}
+			turnID = arg
+		}
+	}
+	if turnID == "" {
+		replayHelp()
+		os.Exit(1)
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Printf("Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+	turn, err := audit.LoadTurn(cfg.AuditPath(), turnID)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if !run {
+		if asJSON {
+			data, _ := json.MarshalIndent(turn, "", "  ")
+			fmt.Println(string(data))
+			return
+		}
+		printTurn(turn)
+		return
+	}
+
+	// Recorded results stand in for every upstream, so external tool
+	// servers are not started, and the replay itself is not audited.
+	cfg.Tools.MCP.Servers = nil
+	cfg.Tools.Plugins = nil
+	cfg.Tools.Audit.Enabled = false
+	cfg.Tools.Shadow.Enabled = false
+
+	provider, err := providers.CreateProvider(cfg)
+	if err != nil {
+		fmt.Printf("Error creating provider: %v\n", err)
+		os.Exit(1)
+	}
+	agentLoop := agent.NewAgentLoop(cfg, bus.NewMessageBus(), provider)
+	defer agentLoop.Stop()
+
+	result, err := agentLoop.Replay(context.Background(), turn)
+	if err != nil {
+		fmt.Printf("Error replaying turn: %v\n", err)
+		os.Exit(1)
+	}
+	if asJSON {
+		data, _ := json.MarshalIndent(result, "", "  ")
+		fmt.Println(string(data))
+		return
+	}
+
+	printTurn(turn)
+	fmt.Println("\n=== Replay ===")
+	for _, call := range result.Calls {
+		status := "✓"
+		if call.IsError {
+			status = "✗"
+		}
+		source := "recorded"
+		if !call.Recorded {
+			source = "no recording"
+		}
+		args, _ := json.Marshal(call.Args)
+		fmt.Printf("%s %s (%s)\n    args: %s\n    result: %s\n", status, call.Tool, source, args, utils.Truncate(call.Result, 500))
+	}
+	fmt.Printf("\nResponse:\n%s\n", result.Response)
+}
+
+func printTurn(turn *audit.Turn) {
+	if e := turn.Entry; e != nil {
+		fmt.Printf("Turn %s at %s (%dms)\n", e.TurnID, e.Time.Local().Format("2006-01-02 15:04:05"), e.DurationMs)
+		fmt.Printf("agent=%s model=%s session=%s user=%s channel=%s:%s\n", e.AgentID, e.Model, e.SessionKey, e.UserID, e.Channel, e.ChatID)
+		fmt.Printf("\nPrompt:\n%s\n", e.Prompt)
+	} else {
+		fmt.Println("Only tool calls were recorded for this turn; set tools.audit.record_turns to true to record prompts and replies.")
+	}
+
+	fmt.Printf("\nTool calls (%d):\n", len(turn.Calls))
+	for _, c := range turn.Calls {
+		status := "✓"
+		if !c.Success {
+			status = "✗"
+		}
+		args, _ := json.Marshal(c.Args)
+		fmt.Printf("%s %s %s %dms\n    args: %s\n", c.Time.Local().Format("15:04:05"), status, c.Tool, c.DurationMs, args)
+		if c.Error != "" {
+			fmt.Printf("    error: %s\n", c.Error)
+		} else if c.Result != "" {
+			fmt.Printf("    result: %s\n", utils.Truncate(c.Result, 500))
+		}
+	}
+
+	if e := turn.Entry; e != nil {
+		if e.Error != "" {
+			fmt.Printf("\nError: %s\n", e.Error)
+		} else {
+			fmt.Printf("\nResponse:\n%s\n", e.Response)
+		}
+	}
+}
+
+func replayHelp() {
+	fmt.Println("\nUsage: picoclaw replay <turn-id> [options]")
+	fmt.Println()
+	fmt.Println("Shows a past turn from the audit log: prompt, tool calls, results and reply.")
+	fmt.Println("Turn IDs appear in the agent log and in `picoclaw audit` output.")
+	fmt.Println()
+	fmt.Println("Options:")
+	fmt.Println("  --run    Re-run the prompt with the current code and model, answering")
+	fmt.Println("           tool calls from the recorded results")
+	fmt.Println("  --json   Print JSON")
+}
+
+func shadowCmd() {
+	asJSON := false
+	for _, arg := range os.Args[2:] {
+		switch arg {
+		case "--json":
+			asJSON = true
+		case "-h", "--help", "help":
+			shadowHelp()
+			return
+		default:
+			fmt.Printf("Unknown option: %s\n", arg)
+			shadowHelp()
+			os.Exit(1)
+		}
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Printf("Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+	path := cfg.ShadowPath()
+	summaries, err := shadow.Summarize(path)
+	if err != nil {
+		fmt.Printf("Error reading shadow log: %v\n", err)
+		os.Exit(1)
+	}
+
+	if asJSON {
+		data, _ := json.MarshalIndent(summaries, "", "  ")
+		fmt.Println(string(data))
+		return
+	}
+	if len(summaries) == 0 {
+		fmt.Printf("No shadow comparisons in %s\n", path)
+		if !cfg.Tools.Shadow.Enabled {
+			fmt.Println("Shadow mode is disabled; set tools.shadow.enabled to true to compare a model or tools.")
+		}
+		return
+	}
+
+	for _, s := range summaries {
+		fmt.Printf("%-5s %s → %s\n", s.Kind, s.Primary, s.Shadow)
+		fmt.Printf("      samples=%d  match=%d (%.0f%%)  similarity=%.2f\n",
+			s.Samples, s.Matches, 100*float64(s.Matches)/float64(s.Samples), s.MeanSimilarity)
+		fmt.Printf("      errors live=%d shadow=%d  latency live=%dms shadow=%dms\n",
+			s.PrimaryErrors, s.ShadowErrors, s.MeanPrimaryMs, s.MeanShadowMs)
+	}
+}
+
+func shadowHelp() {
+	fmt.Println("\nUsage: picoclaw shadow [--json]")
+	fmt.Println()
+	fmt.Println("Summarizes the shadow log: for each live model or tool and its shadow,")
+	fmt.Println("how often results matched, their similarity, errors and latency.")
+}
+
+func evalCmd() {
+	suitePath, baselinePath, outPath, replayPath := "", "", "", ""
+	asJSON := false
+	args := os.Args[2:]
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--replay":
+			if i+1 < len(args) {
+				replayPath = args[i+1]
+				i++
+			}
+		case "--baseline":
+			if i+1 < len(args) {
+				baselinePath = args[i+1]
+				i++
+			}
+		case "--out", "-o":
+			if i+1 < len(args) {
+				outPath = args[i+1]
+				i++
+			}
+		case "--json":
+			asJSON = true
+		case "-h", "--help", "help":
+			evalHelp()
+			return
+		default:
+			if strings.HasPrefix(args[i], "-") || suitePath != "" {
+				fmt.Printf("Unknown option: %s\n", args[i])
+				evalHelp()
+				os.Exit(1)
+			}
+			suitePath = args[i]
+		}
+	}
+	if suitePath == "" {
+		evalHelp()
+		os.Exit(1)
+	}
+
+	suite, err := eval.LoadSuite(suitePath)
+	if err != nil {
+		fmt.Printf("Error loading suite: %v\n", err)
+		os.Exit(1)
+	}
+	var baseline *eval.Report
+	if baselinePath != "" {
+		if baseline, err = eval.LoadReport(baselinePath); err != nil {
+			fmt.Printf("Error loading baseline: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Printf("Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+	provider, err := createProvider(cfg, replayPath)
+	if err != nil {
+		fmt.Printf("Error creating provider: %v\n", err)
+		os.Exit(1)
+	}
+	agentLoop := agent.NewAgentLoop(cfg, bus.NewMessageBus(), provider)
+	defer agentLoop.Stop()
+
+	graderModel := suite.GraderModel
+	if graderModel == "" {
+		graderModel = cfg.Agents.Defaults.Model
+	}
+	report, err := eval.Run(context.Background(), suite, agentLoop.EvalRunner(), &eval.Grader{Provider: provider, Model: graderModel})
+	if err != nil {
+		fmt.Printf("Error running suite: %v\n", err)
+		os.Exit(1)
+	}
+	if baseline != nil {
+		report.Compare(baseline)
+	}
+
+	if outPath != "" {
+		f, err := os.Create(outPath)
+		if err == nil {
+			err = report.WriteJSON(f)
+			f.Close()
+		}
+		if err != nil {
+			fmt.Printf("Error writing report: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if asJSON {
+		report.WriteJSON(os.Stdout)
+	} else {
+		report.WriteText(os.Stdout)
+	}
+	if !report.OK() {
+		os.Exit(1)
+	}
+}
+
+func evalHelp() {
+	fmt.Println("\nUsage: picoclaw eval <suite.yaml> [options]")
+	fmt.Println()
+	fmt.Println("Answers each question of a golden Q&A suite through the agent, checks")
+	fmt.Println("required text and citations, and grades answers against their rubrics.")
+	fmt.Println("Exits with status 1 if a case fails or regresses from the baseline.")
+	fmt.Println()
+	fmt.Println("Options:")
+	fmt.Println("  --baseline <report.json>  Report of an earlier run to compare against")
+	fmt.Println("  --replay <calls.jsonl>    Answer with captured provider calls instead of the model")
+	fmt.Println("  --out <report.json>       Write the report as JSON, for use as a baseline")
+	fmt.Println("  --json                    Print the report as JSON")
+}
+
+func feedbackCmd() {
+	args := os.Args[2:]
+	export := len(args) > 0 && args[0] == "export"
+	if export {
+		args = args[1:]
+	}
+	query := feedback.Query{}
+	format := feedback.FormatEval
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--rating":
+			if i+1 < len(args) {
+				query.Rating = args[i+1]
+				i++
+			}
+		case "--days":
+			if i+1 < len(args) {
+				days, err := strconv.Atoi(args[i+1])
+				if err != nil || days < 1 {
+					fmt.Println("--days must be a positive integer")
+					os.Exit(1)
+				}
+				query.Since = time.Now().AddDate(0, 0, -days)
+				i++
+			}
+		case "--agent":
+			if i+1 < len(args) {
+				query.AgentID = args[i+1]
+				i++
+			}
+		case "--format":
+			if i+1 < len(args) {
+				format = args[i+1]
+				i++
+			}
+		case "-h", "--help", "help":
+			feedbackHelp()
+			return
+		default:
+			fmt.Printf("Unknown option: %s\n", args[i])
+			feedbackHelp()
+			os.Exit(1)
+		}
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Printf("Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+	path := cfg.FeedbackPath()
+	records, err := feedback.Load(path, query)
+	if err != nil {
+		fmt.Printf("Error reading feedback log: %v\n", err)
+		os.Exit(1)
+	}
+
+	if export {
+		if err := feedback.Export(os.Stdout, records, format); err != nil {
+			fmt.Fprintf(os.Stderr, "Error exporting feedback: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if len(records) == 0 {
+		fmt.Printf("No feedback in %s\n", path)
+		if !cfg.Feedback.Enabled {
+			fmt.Println("Feedback is disabled; set feedback.enabled to true to collect it.")
+		}
+		return
+	}
+	summary := feedback.Summarize(records)
+	fmt.Printf("👍 %d  👎 %d  comments %d\n", summary.Up, summary.Down, summary.Comments)
+	for _, r := range records {
+		if r.Rating != feedback.RatingDown && r.Comment == "" {
+			continue
+		}
+		fmt.Printf("\n%s  %s  %s\n", r.Time.Local().Format("2006-01-02 15:04"), r.Rating, r.TurnID)
+		fmt.Printf("  Q: %s\n", utils.Truncate(r.Question, 100))
+		fmt.Printf("  A: %s\n", utils.Truncate(r.Answer, 100))
+		if r.Comment != "" {
+			fmt.Printf("  Comment: %s\n", r.Comment)
+		}
+	}
+}
+
+func feedbackHelp() {
+	fmt.Println("\nUsage: picoclaw feedback [export] [options]")
+	fmt.Println()
+	fmt.Println("Without export, counts ratings and lists thumbs-down answers and comments.")
+	fmt.Println("export writes the feedback to stdout as JSON lines.")
+	fmt.Println()
+	fmt.Println("Options:")
+	fmt.Println("  --rating <up|down>   Only feedback with this rating")
+	fmt.Println("  --days <n>           Only feedback from the last n days")
+	fmt.Println("  --agent <id>         Only feedback on this agent's answers")
+	fmt.Println("  --format <eval|chat> eval (default): question, answer, evidence, rating and comment;")
+	fmt.Println("                       chat: well-rated turns as chat fine-tuning examples")
+}
+
+func mcpCmd() {
+	if len(os.Args) < 3 || os.Args[2] != "serve" {
+		mcpHelp()
+		return
+	}
+
+	sse := false
+	listen := ""
+	agentID := ""
+	args := os.Args[3:]
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--sse":
+			sse = true
+		case "--listen":
+			if i+1 < len(args) {
+				listen = args[i+1]
+				i++
+			}
+		case "--agent":
+			if i+1 < len(args) {
+				agentID = args[i+1]
+				i++
+			}
+		default:
+			fmt.Printf("Unknown option: %s\n", args[i])
+			mcpHelp()
+			os.Exit(1)
+		}
+	}
+
+	// Over stdio, stdout carries the protocol, so anything else that would
+	// print there goes to stderr instead.
+	protocolOut := os.Stdout
+	if !sse {
+		os.Stdout = os.Stderr
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+	provider, err := providers.CreateProvider(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating provider: %v\n", err)
+		os.Exit(1)
+	}
+
+	agentLoop := agent.NewAgentLoop(cfg, bus.NewMessageBus(), provider)
+	defer agentLoop.Stop()
+	registry, ok := agentLoop.Tools(agentID)
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Unknown agent: %s\n", agentID)
+		os.Exit(1)
+	}
+
+	export := cfg.Tools.MCP.Export
+	server := mcp.NewServer(registry, tools.ToolRolePolicy{Allow: export.Allow, Deny: export.Deny}, formatVersion())
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	if !sse {
+		if err := server.ServeStdio(ctx, os.Stdin, protocolOut); err != nil && err != context.Canceled {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if listen == "" {
+		listen = export.Listen
+	}
+	httpServer := &http.Server{Addr: listen, Handler: server.Handler(export.Token)}
+	go func() {
+		<-ctx.Done()
+		httpServer.Shutdown(context.Background())
+	}()
+	fmt.Printf("✓ Serving %d tools over MCP at http://%s/sse\n", len(server.Tools()), listen)
+	if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func mcpHelp() {
+	fmt.Println("\nUsage: picoclaw mcp serve [options]")
+	fmt.Println("\nServes the tools allowed by tools.mcp.export to MCP hosts, over stdio by default.")
+	fmt.Println("\nOptions:")
+	fmt.Println("  --sse              Serve HTTP+SSE instead of stdio")
+	fmt.Println("  --listen <addr>    Address for --sse (default tools.mcp.export.listen)")
+	fmt.Println("  --agent <id>       Serve this agent's tools (default: the default agent)")
+}
+
+func genCmd() {
+	if len(os.Args) < 4 || os.Args[2] != "tool" {
+		genHelp()
+		return
+	}
+
+	opts := scaffold.ToolOptions{Name: os.Args[3]}
+	args := os.Args[4:]
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--force":
+			opts.Force = true
+		case "--no-wire":
+			opts.NoWire = true
+		case "--root":
+			if i+1 < len(args) {
+				opts.Root = args[i+1]
+				i++
+			}
+		default:
+			fmt.Printf("Unknown option: %s\n", args[i])
+			genHelp()
+			os.Exit(1)
+		}
+	}
+
+	result, err := scaffold.GenerateTool(opts)
+	if result != nil {
+		for _, f := range result.Files {
+			fmt.Printf("✓ Created %s\n", f)
+		}
+		if result.Wired != "" {
+			fmt.Printf("✓ Registered in %s\n", result.Wired)
+		}
+	}
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Println("\nNext steps:")
+	fmt.Println("  1. Replace the example search operation with your API calls")
+	fmt.Println("  2. Add a config section and pass its values to the tool options")
+	fmt.Println("  3. Run: go test ./pkg/tools/")
+}
+
+func genHelp() {
+	fmt.Println("\nGen commands:")
+	fmt.Println("  tool <name>       Generate a tool skeleton in pkg/tools and register it")
+	fmt.Println()
+	fmt.Println("Tool options:")
+	fmt.Println("  --root <dir>      Repository root (default: current directory)")
+	fmt.Println("  --force           Overwrite existing files")
+	fmt.Println("  --no-wire         Do not register the tool in pkg/agent/loop.go")
+}
+
 func cronCmd() {
 	if len(os.Args) < 3 {
 		cronHelp()
@@ -0,0 +1,133 @@
+package agent
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/constants"
+)
+
+// answerStyle is a way of writing answers a user can pick with /style.
+// Its ID is the answer_type the knowledge tools take.
+type answerStyle struct {
+	ID          string
+	Label       string
+	Aliases     []string
+	Instruction string
+}
+
+var answerStyles = []answerStyle{
+	{
+		ID:      "CLINICAL",
+		Label:   "🩺 临床 Clinical",
+		Aliases: []string{"clinical", "clinician", "临床"},
+		Instruction: "Write for a clinician: precise medical terminology, guideline recommendations, " +
+			"doses and evidence levels, without lay explanations.",
+	},
+	{
+		ID:      "RESEARCH",
+		Label:   "🔬 科研 Research",
+		Aliases: []string{"research", "科研", "研究"},
+		Instruction: "Write for a researcher: study designs, trial results with their numbers, " +
+			"limitations and open questions, citing the studies.",
+	},
+	{
+		ID:      "POPULAR_SCIENCE",
+		Label:   "📖 科普 Popular science",
+		Aliases: []string{"popular_science", "popular", "patient", "科普"},
+		Instruction: "Write for a patient or family member: plain language, short sentences, " +
+			"and any medical term explained the first time it is used.",
+	},
+}
+
+// findAnswerStyle returns the style an ID or alias names.
+func findAnswerStyle(name string) (answerStyle, bool) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for _, s := range answerStyles {
+		if name == strings.ToLower(s.ID) {
+			return s, true
+		}
+		for _, alias := range s.Aliases {
+			if name == alias {
+				return s, true
+			}
+		}
+	}
+	return answerStyle{}, false
+}
+
+// answerStyleInstruction tells the model to keep to the chosen style, in
+// its own words and in the knowledge tools it calls.
+func answerStyleInstruction(id string) string {
+	s, ok := findAnswerStyle(id)
+	if !ok {
+		return ""
+	}
+	return fmt.Sprintf("The user asked for %s answers. %s When a tool takes an answer_type, pass %s.",
+		strings.ToLower(strings.ReplaceAll(s.ID, "_", " ")), s.Instruction, s.ID)
+}
+
+// handleStyleCommand handles /style [clinical|research|popular|auto],
+// which sets how the chat's answers are written. Without an argument it
+// shows the current style and the choices.
+func (al *AgentLoop) handleStyleCommand(msg bus.InboundMessage, args []string) string {
+	agent, sessionKey, _ := al.resolveSession(msg)
+	if fork, ok := al.activeForks.Load(sessionKey); ok {
+		sessionKey = fork.(string)
+	}
+
+	if len(args) == 0 {
+		current := "automatic"
+		if s, ok := findAnswerStyle(agent.Sessions.AnswerStyle(sessionKey)); ok {
+			current = s.Label
+		}
+		var sb strings.Builder
+		fmt.Fprintf(&sb, "Answer style: %s. Choose one:", current)
+		for _, s := range answerStyles {
+			fmt.Fprintf(&sb, "\n/style %s — %s", s.Aliases[0], s.Label)
+		}
+		sb.WriteString("\n/style auto — let the assistant choose")
+		return sb.String()
+	}
+
+	agent.Sessions.GetOrCreate(sessionKey)
+	switch name := strings.ToLower(args[0]); name {
+	case "auto", "off", "自动":
+		agent.Sessions.SetAnswerStyle(sessionKey, "")
+		agent.Sessions.Save(sessionKey)
+		return "Answer style: automatic."
+	default:
+		s, ok := findAnswerStyle(name)
+		if !ok {
+			return "Usage: /style [clinical|research|popular|auto]"
+		}
+		agent.Sessions.SetAnswerStyle(sessionKey, s.ID)
+		agent.Sessions.Save(sessionKey)
+		return fmt.Sprintf("Answer style: %s. Later answers will be written this way.", s.Label)
+	}
+}
+
+// replyButtons returns the buttons to show under the reply to msg: the
+// style choices under the /style menu, and rating buttons under answers
+// when feedback is on.
+func (al *AgentLoop) replyButtons(msg bus.InboundMessage) []bus.Button {
+	if constants.IsInternalChannel(msg.Channel) {
+		return nil
+	}
+	content := strings.TrimSpace(msg.Content)
+	if content == "/style" {
+		buttons := make([]bus.Button, 0, len(answerStyles)+1)
+		for _, s := range answerStyles {
+			buttons = append(buttons, bus.Button{Label: s.Label, Data: "/style " + s.Aliases[0]})
+		}
+		return append(buttons, bus.Button{Label: "🤖 Auto", Data: "/style auto"})
+	}
+	if _, isRating := ratingEmoji(content); isRating || strings.HasPrefix(content, "/") {
+		return nil
+	}
+	if al.feedback != nil && al.cfg.Feedback.RatingButtons {
+		return []bus.Button{{Label: "👍", Data: "👍"}, {Label: "👎", Data: "👎"}}
+	}
+	return nil
+}
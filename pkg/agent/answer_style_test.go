@@ -0,0 +1,105 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestStyleCommand(t *testing.T) {
+	provider := &messagesRecordingProvider{}
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				Model:             "qwen-plus",
+				MaxTokens:         4096,
+				MaxToolIterations: 5,
+			},
+		},
+	}
+	al := NewAgentLoop(cfg, bus.NewMessageBus(), provider)
+	defer al.Stop()
+	send := func(content string) string {
+		t.Helper()
+		reply, err := al.processMessage(context.Background(), bus.InboundMessage{
+			Channel: "telegram", SenderID: "u1", ChatID: "u1", Content: content,
+		})
+		if err != nil {
+			t.Fatalf("processMessage: %v", err)
+		}
+		return reply
+	}
+	systemPrompt := func() string {
+		var parts []string
+		for _, m := range provider.messages {
+			if m.Role == "system" {
+				parts = append(parts, m.Content)
+			}
+		}
+		return strings.Join(parts, "\n")
+	}
+
+	if reply := send("/style"); !strings.HasPrefix(reply, "Answer style: automatic.") || !strings.Contains(reply, "/style research") {
+		t.Fatalf("menu = %q", reply)
+	}
+	if reply := send("/style 科普"); !strings.Contains(reply, "Popular science") {
+		t.Fatalf("set = %q", reply)
+	}
+	send("What is a Whipple procedure?")
+	if prompt := systemPrompt(); !strings.Contains(prompt, "pass POPULAR_SCIENCE") {
+		t.Errorf("style instruction missing from the system prompt:\n%s", prompt)
+	}
+	if reply := send("/style"); !strings.HasPrefix(reply, "Answer style: 📖 科普 Popular science.") {
+		t.Errorf("menu after setting = %q", reply)
+	}
+
+	send("/style auto")
+	send("What is a Whipple procedure?")
+	if prompt := systemPrompt(); strings.Contains(prompt, "answer_type") {
+		t.Errorf("style instruction kept after /style auto")
+	}
+	if reply := send("/style astrology"); !strings.HasPrefix(reply, "Usage:") {
+		t.Errorf("unknown style = %q", reply)
+	}
+}
+
+func TestReplyButtons(t *testing.T) {
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				Model:             "qwen-plus",
+				MaxTokens:         4096,
+				MaxToolIterations: 5,
+			},
+		},
+		Feedback: config.FeedbackConfig{Enabled: true, RatingButtons: true},
+	}
+	al := NewAgentLoop(cfg, bus.NewMessageBus(), &messagesRecordingProvider{})
+	defer al.Stop()
+
+	tests := []struct {
+		channel string
+		content string
+		want    []string
+	}{
+		{"telegram", "What is CA19-9?", []string{"👍", "👎"}},
+		{"telegram", "/style", []string{"/style clinical", "/style research", "/style popular_science", "/style auto"}},
+		{"telegram", "/feedback up", nil},
+		{"telegram", "👍", nil},
+		{"cli", "What is CA19-9?", nil},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, b := range al.replyButtons(bus.InboundMessage{Channel: tt.channel, Content: tt.content}) {
+			got = append(got, b.Data)
+		}
+		if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+			t.Errorf("%s %q: buttons %v, want %v", tt.channel, tt.content, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+	"unicode/utf8"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/guardrails"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/rag"
+	"github.com/sipeed/picoclaw/pkg/semcache"
+)
+
+const answerCacheTimeout = 10 * time.Second
+
+// setupAnswerCache opens the semantic answer cache. A cache that cannot be
+// opened is disabled rather than blocking startup.
+func setupAnswerCache(cfg *config.Config) *semcache.Cache {
+	ac := cfg.Tools.AnswerCache
+	embedder := rag.NewEmbedder(cfg.KnowledgeBaseEmbedding(), cfg.EmbeddingCachePath())
+	cache, err := semcache.Open(cfg.AnswerCachePath(), embedder, semcache.Options{
+		Threshold:  ac.Threshold,
+		TTL:        time.Duration(ac.TTLHours) * time.Hour,
+		MaxEntries: ac.MaxEntries,
+	})
+	if err != nil {
+		logger.ErrorCF("agent", "Answer cache disabled",
+			map[string]interface{}{
+				"path":  cfg.AnswerCachePath(),
+				"error": err.Error(),
+			})
+		return nil
+	}
+	return cache
+}
+
+// answerCacheable reports whether the turn's answer may come from, or go
+// to, the answer cache: a question long enough to stand alone, from a user
+// without a profile, that guardrails do not flag and that does not depend
+// on intake details, a what-if premise or a /style the session chose.
+func (al *AgentLoop) answerCacheable(agent *AgentInstance, opts processOptions) bool {
+	if al.answers == nil || len(opts.Instructions) > 0 {
+		return false
+	}
+	if utf8.RuneCountInString(opts.UserMessage) < al.cfg.Tools.AnswerCache.MinChars {
+		return false
+	}
+	if agent.Sessions.Scenario(opts.SessionKey) != "" || agent.Sessions.AnswerStyle(opts.SessionKey) != "" {
+		return false
+	}
+	if len(profileFacts(agent, opts.UserID)) > 0 {
+		return false
+	}
+	if opts.Guardrails && al.guardrails != nil {
+		checks := al.guardrails.CheckInbound(guardrails.Input{Message: opts.UserMessage, Chinese: prefersChinese(opts)})
+		if len(checks.Findings) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// answerFromCache answers a near-duplicate of a cached question with its
+// cached answer, recording the exchange in the session like any other
+// turn. On a miss the question's embedding is kept in opts, so the answer
+// can be cached after the turn.
+func (al *AgentLoop) answerFromCache(ctx context.Context, agent *AgentInstance, opts *processOptions) (string, bool) {
+	if !al.answerCacheable(agent, *opts) {
+		return "", false
+	}
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(ctx, answerCacheTimeout)
+	defer cancel()
+	vector, err := al.answers.Embed(ctx, opts.UserMessage)
+	if err != nil {
+		logger.WarnCF("agent", "Answer cache lookup failed",
+			map[string]interface{}{
+				"session_key": opts.SessionKey,
+				"error":       err.Error(),
+			})
+		return "", false
+	}
+	persona := agent.ContextBuilder.PersonaName(opts.Channel)
+	hit, score, ok := al.answers.Lookup(agent.ID, persona, opts.UserMessage, vector)
+	if !ok {
+		opts.QuestionVector = vector
+		return "", false
+	}
+
+	if opts.TurnID == "" {
+		opts.TurnID = newTurnID()
+	}
+	agent.Sessions.AddMessage(opts.SessionKey, "user", opts.UserMessage)
+	agent.Sessions.SetOrigin(opts.SessionKey, opts.Channel, opts.UserID)
+	agent.Sessions.AddMessage(opts.SessionKey, "assistant", hit.Answer)
+	agent.Sessions.Save(opts.SessionKey)
+	al.lastTurns.Store(opts.SessionKey, opts.TurnID)
+	al.recordTurn(agent, *opts, start, hit.Answer, nil)
+	logger.InfoCF("agent", "Answered from answer cache",
+		map[string]interface{}{
+			"agent_id":    agent.ID,
+			"session_key": opts.SessionKey,
+			"turn_id":     opts.TurnID,
+			"cache_id":    hit.ID,
+			"similarity":  score,
+		})
+	return hit.Answer, true
+}
+
+// cacheAnswer caches the answer of a turn that missed the cache, when it
+// began the conversation and called no tools beyond the cacheable ones, so
+// it depends on nothing but the question.
+func (al *AgentLoop) cacheAnswer(agent *AgentInstance, opts processOptions, firstTurn bool, answer string) {
+	if opts.QuestionVector == nil || !firstTurn || answer == "" || answer == opts.DefaultResponse {
+		return
+	}
+	for _, name := range turnTools(agent.Sessions.GetHistory(opts.SessionKey)) {
+		if !matchesAny(name, al.cfg.Tools.AnswerCache.CacheableTools) {
+			return
+		}
+	}
+	persona := agent.ContextBuilder.PersonaName(opts.Channel)
+	if err := al.answers.Put(agent.ID, persona, opts.UserMessage, opts.QuestionVector, answer); err != nil {
+		logger.WarnCF("agent", "Failed to cache answer",
+			map[string]interface{}{
+				"session_key": opts.SessionKey,
+				"error":       err.Error(),
+			})
+	}
+}
+
+// turnTools returns the names of the tools called since the last user
+// message.
+func turnTools(history []providers.Message) []string {
+	var names []string
+	for i := len(history) - 1; i >= 0 && history[i].Role != "user"; i-- {
+		for _, tc := range history[i].ToolCalls {
+			name := tc.Name
+			if name == "" && tc.Function != nil {
+				name = tc.Function.Name
+			}
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// AnswerCacheHandler lists cached answers to admin tokens, and removes the
+// one named by the id query parameter on DELETE.
+func (al *AgentLoop) AnswerCacheHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodDelete {
+			writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+
+		role, ok := al.authenticate(r)
+		if !ok {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeJSONError(w, http.StatusUnauthorized, "invalid or missing bearer token")
+			return
+		}
+		if role != AdminRole {
+			writeJSONError(w, http.StatusForbidden, "admin role required")
+			return
+		}
+		if al.answers == nil {
+			writeJSONError(w, http.StatusNotFound, "answer cache is disabled")
+			return
+		}
+
+		if r.Method == http.MethodDelete {
+			id := r.URL.Query().Get("id")
+			if id == "" {
+				writeJSONError(w, http.StatusBadRequest, "id is required")
+				return
+			}
+			if !al.answers.Remove(id) {
+				writeJSONError(w, http.StatusNotFound, "no cached answer "+id)
+				return
+			}
+			logger.InfoCF("agent", "Removed cached answer", map[string]interface{}{"cache_id": id})
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"answers": al.answers.List(),
+		})
+	})
+}
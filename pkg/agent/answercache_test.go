@@ -0,0 +1,118 @@
+package agent
+
+import (
+	"context"
+	"hash/fnv"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/semcache"
+)
+
+// wordEmbedder embeds a text as its bag of lowercase words.
+type wordEmbedder struct{ calls int }
+
+func (e *wordEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	e.calls++
+	out := make([][]float32, len(texts))
+	for i, t := range texts {
+		v := make([]float32, 64)
+		for _, w := range strings.FieldsFunc(strings.ToLower(t), func(r rune) bool { return r == ' ' || r == '?' }) {
+			h := fnv.New32a()
+			h.Write([]byte(w))
+			v[h.Sum32()%64]++
+		}
+		out[i] = v
+	}
+	return out, nil
+}
+
+// countingProvider answers every call with "answer N".
+type countingProvider struct{ calls int }
+
+func (p *countingProvider) Chat(ctx context.Context, messages []providers.Message, defs []providers.ToolDefinition, model string, opts map[string]interface{}) (*providers.LLMResponse, error) {
+	p.calls++
+	return &providers.LLMResponse{Content: "answer " + string(rune('0'+p.calls))}, nil
+}
+
+func (p *countingProvider) GetDefaultModel() string {
+	return "test-model"
+}
+
+func TestAnswerCache(t *testing.T) {
+	provider := &countingProvider{}
+	workspace := t.TempDir()
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         workspace,
+				Model:             "test-model",
+				MaxTokens:         4096,
+				MaxToolIterations: 5,
+			},
+		},
+		Tools: config.ToolsConfig{
+			AnswerCache: config.AnswerCacheConfig{Enabled: true, MinChars: 8, CacheableTools: []string{"kb_search"}},
+		},
+	}
+	al := NewAgentLoop(cfg, bus.NewMessageBus(), provider)
+	embedder := &wordEmbedder{}
+	cache, err := semcache.Open(filepath.Join(workspace, "answers.json"), embedder, semcache.Options{Threshold: 0.8, TTL: time.Hour})
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	al.answers = cache
+	agent := al.registry.GetDefaultAgent()
+	send := func(session, content string) string {
+		t.Helper()
+		reply, err := al.processMessage(context.Background(), bus.InboundMessage{
+			Channel: "telegram", SenderID: session, ChatID: session, Content: content,
+			SessionKey: "agent:main:" + session,
+		})
+		if err != nil {
+			t.Fatalf("processMessage: %v", err)
+		}
+		return reply
+	}
+
+	if reply := send("a", "What is the survival rate of pancreatic cancer?"); reply != "answer 1" || cache.Len() != 1 {
+		t.Fatalf("first question: %q, %d cached", reply, cache.Len())
+	}
+
+	// A near duplicate from another chat is answered from the cache.
+	if reply := send("b", "what is the survival rate for pancreatic cancer"); reply != "answer 1" || provider.calls != 1 {
+		t.Fatalf("near duplicate: %q after %d calls", reply, provider.calls)
+	}
+	if history := agent.Sessions.GetHistory("agent:main:b"); len(history) != 2 || history[1].Content != "answer 1" {
+		t.Fatalf("cached exchange not in session: %+v", history)
+	}
+
+	// Later turns of a conversation may depend on it, so are not cached.
+	if reply := send("b", "Is that different for stage four patients?"); reply != "answer 2" || cache.Len() != 1 {
+		t.Fatalf("follow-up: %q, %d cached", reply, cache.Len())
+	}
+
+	// Nor are answers in a style the session chose with /style.
+	agent.Sessions.GetOrCreate("agent:main:d")
+	agent.Sessions.SetAnswerStyle("agent:main:d", "CLINICAL")
+	if reply := send("d", "what is the survival rate for pancreatic cancer"); reply != "answer 3" {
+		t.Fatalf("styled session answered from the cache: %q", reply)
+	}
+	agent.Sessions.GetOrCreate("agent:main:e")
+	agent.Sessions.SetAnswerStyle("agent:main:e", "CLINICAL")
+	if reply := send("e", "How is pancreatic cancer staged by doctors?"); reply != "answer 4" || cache.Len() != 1 {
+		t.Fatalf("styled answer cached: %q, %d cached", reply, cache.Len())
+	}
+
+	// Short messages are not looked up.
+	calls := embedder.calls
+	send("c", "thanks")
+	if embedder.calls != calls {
+		t.Fatal("short message was embedded")
+	}
+}
@@ -0,0 +1,105 @@
+package agent
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/tools"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+// saveAttachments moves the files a user sent into the conversation's
+// folder in the workspace, attachments/<session>/, where they outlive the
+// turn and the model's tools can open them, and tells the model where they
+// are. When sessions have file roots of their own the folder is the
+// attachments/ folder in the session's root instead, as the file tools
+// cannot reach outside it. Only the copies the channels keep of the files
+// they received are moved; any other path is left alone, as it may be
+// anywhere on the server. opts.Media is updated to the saved files.
+func saveAttachments(agent *AgentInstance, opts *processOptions) {
+	var kept []int
+	for i, src := range opts.Media {
+		if utils.IsKeptMedia(src) {
+			kept = append(kept, i)
+		}
+	}
+	if len(kept) == 0 {
+		return
+	}
+	// The session key can come from an API caller, so it is never used as
+	// a path as is
+	root := agent.PathPolicy.SessionRoot(agent.Workspace, opts.SessionKey)
+	rel := "attachments"
+	if root == "" {
+		root = agent.Workspace
+		rel = filepath.Join(rel, tools.SessionDirName(opts.SessionKey))
+	}
+	dir := filepath.Join(root, rel)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		logger.WarnCF("agent", "Failed to create attachments folder", map[string]interface{}{
+			"dir":   dir,
+			"error": err.Error(),
+		})
+		return
+	}
+
+	stamp := time.Now().Format("20060102-150405")
+	var lines []string
+	for _, i := range kept {
+		src := opts.Media[i]
+		name := stamp + "_" + originalName(src)
+		dst := filepath.Join(dir, name)
+		if err := moveFile(src, dst); err != nil {
+			logger.WarnCF("agent", "Failed to save attachment", map[string]interface{}{
+				"path":  src,
+				"error": err.Error(),
+			})
+			continue
+		}
+		opts.Media[i] = dst
+		lines = append(lines, fmt.Sprintf("%s (%s)", filepath.Join(rel, name), utils.DetectMediaType(dst)))
+	}
+	if len(lines) > 0 {
+		opts.UserMessage += "\n\n[attachments saved in the workspace: " + strings.Join(lines, ", ") + "]"
+	}
+}
+
+// originalName strips the prefix added to a kept or downloaded file's name.
+func originalName(path string) string {
+	name := strings.TrimPrefix(filepath.Base(path), "kept_")
+	if i := strings.Index(name, "_"); i == 8 {
+		name = name[i+1:]
+	}
+	return name
+}
+
+// moveFile renames src to dst, copying when they are on different devices.
+func moveFile(src, dst string) error {
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	in.Close()
+	return os.Remove(src)
+}
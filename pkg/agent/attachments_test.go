@@ -0,0 +1,106 @@
+package agent
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/tools"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+func TestSaveAttachments(t *testing.T) {
+	tests := []struct {
+		name       string
+		sessionKey string
+		policy     *tools.PathPolicy
+		wantDir    string // relative to the workspace
+		wantRel    string // the folder the model is told, relative to its file root
+	}{
+		{
+			name:       "workspace",
+			sessionKey: "agent:main:telegram:direct:1001",
+			wantDir:    filepath.Join("attachments", tools.SessionDirName("agent:main:telegram:direct:1001")),
+			wantRel:    filepath.Join("attachments", tools.SessionDirName("agent:main:telegram:direct:1001")),
+		},
+		{
+			name:       "traversal",
+			sessionKey: "agent:main:openai:/../../../../../tmp/evil",
+			wantDir:    filepath.Join("attachments", tools.SessionDirName("agent:main:openai:/../../../../../tmp/evil")),
+			wantRel:    filepath.Join("attachments", tools.SessionDirName("agent:main:openai:/../../../../../tmp/evil")),
+		},
+		{
+			name:       "session roots",
+			sessionKey: "agent:main:telegram:direct:1001",
+			policy:     &tools.PathPolicy{SessionRoots: true},
+			wantDir:    filepath.Join("files", tools.SessionDirName("agent:main:telegram:direct:1001"), "attachments"),
+			wantRel:    "attachments",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			workspace := t.TempDir()
+			received := filepath.Join(t.TempDir(), "report.pdf")
+			os.WriteFile(received, []byte("%PDF-1.7\n"), 0600)
+			media, _ := utils.KeepMedia([]string{received}, utils.MediaLimits{})
+			kept := media[0]
+
+			agent := &AgentInstance{Workspace: workspace, PathPolicy: tt.policy}
+			opts := processOptions{
+				SessionKey:  tt.sessionKey,
+				UserMessage: "Please read my pathology report",
+				Media:       media,
+			}
+			saveAttachments(agent, &opts)
+
+			saved := opts.Media[0]
+			if filepath.Dir(saved) != filepath.Join(workspace, tt.wantDir) || !strings.HasSuffix(saved, "_report.pdf") {
+				t.Fatalf("saved to %s", saved)
+			}
+			if _, err := os.Stat(saved); err != nil {
+				t.Errorf("saved file: %v", err)
+			}
+			if _, err := os.Stat(kept); !os.IsNotExist(err) {
+				t.Errorf("kept copy was not moved")
+			}
+			rel := filepath.Join(tt.wantRel, filepath.Base(saved))
+			if want := "[attachments saved in the workspace: " + rel + " (application/pdf)]"; !strings.HasSuffix(opts.UserMessage, want) {
+				t.Errorf("message = %q", opts.UserMessage)
+			}
+
+			// The model's file tools open the file by the path it was told
+			read := tools.NewReadFileTool(workspace, true)
+			read.SetPathPolicy(tt.policy)
+			ctx := tools.WithCallMetadata(context.Background(), tools.CallMetadata{SessionKey: tt.sessionKey})
+			if result := read.Execute(ctx, map[string]interface{}{"path": rel}); result.IsError {
+				t.Errorf("read_file %s: %s", rel, result.ForLLM)
+			}
+		})
+	}
+}
+
+func TestSaveAttachments_OnlyKeptCopies(t *testing.T) {
+	workspace := t.TempDir()
+	config := filepath.Join(t.TempDir(), "config.json")
+	os.WriteFile(config, []byte(`{"providers": {}}`), 0600)
+
+	agent := &AgentInstance{Workspace: workspace}
+	opts := processOptions{
+		SessionKey:  "agent:main:openai:direct:1001",
+		UserMessage: "Please read my pathology report",
+		Media:       []string{config, "https://example.com/report.pdf"},
+	}
+	saveAttachments(agent, &opts)
+
+	if _, err := os.Stat(config); err != nil {
+		t.Errorf("a file outside the media folder was moved: %v", err)
+	}
+	if opts.Media[0] != config || opts.UserMessage != "Please read my pathology report" {
+		t.Errorf("media = %q, message = %q", opts.Media, opts.UserMessage)
+	}
+	if entries, _ := os.ReadDir(workspace); len(entries) != 0 {
+		t.Errorf("workspace = %v, want nothing saved", entries)
+	}
+}
@@ -0,0 +1,63 @@
+package agent
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/sipeed/picoclaw/pkg/audit"
+)
+
+// AuditHandler serves audited tool calls as JSON to admin tokens.
+// Query parameters: session, user, tool, and limit (default 100).
+func (al *AgentLoop) AuditHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+
+		role, ok := al.authenticate(r)
+		if !ok {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeJSONError(w, http.StatusUnauthorized, "invalid or missing bearer token")
+			return
+		}
+		if role != AdminRole {
+			writeJSONError(w, http.StatusForbidden, "admin role required")
+			return
+		}
+		if al.audit == nil {
+			writeJSONError(w, http.StatusNotFound, "audit log is disabled")
+			return
+		}
+
+		q := r.URL.Query()
+		filter := audit.Filter{
+			SessionKey: q.Get("session"),
+			UserID:     q.Get("user"),
+			Tool:       q.Get("tool"),
+			Limit:      100,
+		}
+		if raw := q.Get("limit"); raw != "" {
+			limit, err := strconv.Atoi(raw)
+			if err != nil || limit < 0 {
+				writeJSONError(w, http.StatusBadRequest, "limit must be a non-negative integer")
+				return
+			}
+			filter.Limit = limit
+		}
+
+		entries, err := al.audit.Query(filter)
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if entries == nil {
+			entries = []audit.Entry{}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"entries": entries})
+	})
+}
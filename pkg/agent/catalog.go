@@ -0,0 +1,172 @@
+package agent
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+// AdminRole sees every tool and its availability across all roles.
+const AdminRole = "admin"
+
+type toolCatalogResponse struct {
+	AgentID string               `json:"agent_id"`
+	Role    string               `json:"role"`
+	Locale  string               `json:"locale,omitempty"`
+	Tools   []tools.CatalogEntry `json:"tools"`
+}
+
+// ToolCatalogHandler serves the tool catalog of an agent as JSON. Callers
+// authenticate with a bearer token from gateway.api_tokens; admins get the
+// full catalog, other roles only the tools their tools.roles policy allows.
+//
+// Query parameters: agent (defaults to the default agent) and locale
+// (defaults to the first Accept-Language tag).
+func (al *AgentLoop) ToolCatalogHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+
+		role, ok := al.authenticate(r)
+		if !ok {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeJSONError(w, http.StatusUnauthorized, "invalid or missing bearer token")
+			return
+		}
+
+		agent := al.registry.GetDefaultAgent()
+		if agentID := r.URL.Query().Get("agent"); agentID != "" {
+			var found bool
+			agent, found = al.registry.GetAgent(agentID)
+			if !found {
+				writeJSONError(w, http.StatusNotFound, "unknown agent")
+				return
+			}
+		}
+		if agent == nil {
+			writeJSONError(w, http.StatusNotFound, "no agent configured")
+			return
+		}
+
+		locale := r.URL.Query().Get("locale")
+		if locale == "" {
+			locale = acceptLanguage(r.Header.Get("Accept-Language"))
+		}
+
+		policies := al.rolePolicies()
+		entries := agent.Tools.Catalog(locale, policies)
+		if role != AdminRole {
+			policy := policies[role]
+			visible := entries[:0]
+			for _, entry := range entries {
+				if policy.Allows(entry.Name) {
+					entry.Roles = nil
+					visible = append(visible, entry)
+				}
+			}
+			entries = visible
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(toolCatalogResponse{
+			AgentID: agent.ID,
+			Role:    role,
+			Locale:  locale,
+			Tools:   entries,
+		})
+	})
+}
+
+// authenticate returns the role bound to the request's bearer token.
+func (al *AgentLoop) authenticate(r *http.Request) (string, bool) {
+	token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !found || token == "" {
+		return "", false
+	}
+	for _, t := range al.cfg.Gateway.APITokens {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(t.Token)) == 1 {
+			return t.Role, true
+		}
+	}
+	return "", false
+}
+
+func (al *AgentLoop) rolePolicies() map[string]tools.ToolRolePolicy {
+	policies := make(map[string]tools.ToolRolePolicy, len(al.cfg.Tools.Roles))
+	for role, rc := range al.cfg.Tools.Roles {
+		policies[role] = tools.ToolRolePolicy{Allow: rc.Allow, Deny: rc.Deny}
+	}
+	return policies
+}
+
+// userPermissions returns the roles assigned to userID in tools.roles, or
+// nil if it holds none.
+func (al *AgentLoop) userPermissions(userID string) map[string]tools.ToolRolePolicy {
+	if userID == "" {
+		return nil
+	}
+	id, _, _ := strings.Cut(userID, "|")
+	var permissions map[string]tools.ToolRolePolicy
+	for role, rc := range al.cfg.Tools.Roles {
+		for _, user := range rc.Users {
+			if user == userID || user == id {
+				if permissions == nil {
+					permissions = make(map[string]tools.ToolRolePolicy)
+				}
+				permissions[role] = tools.ToolRolePolicy{Allow: rc.Allow, Deny: rc.Deny}
+				break
+			}
+		}
+	}
+	return permissions
+}
+
+// userHasRole reports whether userID is listed under role in tools.roles.
+func userHasRole(cfg *config.Config, userID, role string) bool {
+	if userID == "" {
+		return false
+	}
+	id, _, _ := strings.Cut(userID, "|")
+	for _, user := range cfg.Tools.Roles[role].Users {
+		if user == userID || user == id {
+			return true
+		}
+	}
+	return false
+}
+
+// permittedToolDefs drops the tools the user's roles or the turn's scope
+// do not allow, so the model is not offered calls the registry would refuse.
+func permittedToolDefs(ctx context.Context, defs []providers.ToolDefinition) []providers.ToolDefinition {
+	meta := tools.CallMetadataFromContext(ctx)
+	if len(meta.Permissions) == 0 && meta.Scope == nil {
+		return defs
+	}
+	permitted := make([]providers.ToolDefinition, 0, len(defs))
+	for _, def := range defs {
+		if meta.Allows(def.Function.Name) && meta.InScope(def.Function.Name) {
+			permitted = append(permitted, def)
+		}
+	}
+	return permitted
+}
+
+func acceptLanguage(header string) string {
+	first, _, _ := strings.Cut(header, ",")
+	tag, _, _ := strings.Cut(first, ";")
+	return strings.TrimSpace(tag)
+}
+
+func writeJSONError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
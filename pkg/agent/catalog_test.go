@@ -0,0 +1,208 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+func newCatalogTestLoop(t *testing.T) *AgentLoop {
+	t.Helper()
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				Model:             "test-model",
+				MaxTokens:         4096,
+				MaxToolIterations: 10,
+			},
+		},
+		Gateway: config.GatewayConfig{
+			APITokens: []config.GatewayAPIToken{
+				{Token: "admin-token", Role: AdminRole},
+				{Token: "patient-token", Role: "patient"},
+			},
+		},
+		Tools: config.ToolsConfig{
+			Web:   config.WebToolsConfig{DuckDuckGo: config.DuckDuckGoConfig{Enabled: true, MaxResults: 5}},
+			Cache: config.ToolCacheConfig{Enabled: true},
+			Roles: map[string]config.ToolRoleConfig{
+				"patient": {Allow: []string{"web_*", "message"}, Deny: []string{"web_fetch"}},
+			},
+		},
+	}
+	return NewAgentLoop(cfg, bus.NewMessageBus(), &mockProvider{})
+}
+
+func getCatalog(t *testing.T, h http.Handler, token, query string) (*httptest.ResponseRecorder, toolCatalogResponse) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/api/tools"+query, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	var resp toolCatalogResponse
+	if rec.Code == http.StatusOK {
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode response: %v", err)
+		}
+	}
+	return rec, resp
+}
+
+func findCatalogEntry(entries []tools.CatalogEntry, name string) *tools.CatalogEntry {
+	for i := range entries {
+		if entries[i].Name == name {
+			return &entries[i]
+		}
+	}
+	return nil
+}
+
+func TestToolCatalogHandler_RequiresToken(t *testing.T) {
+	h := newCatalogTestLoop(t).ToolCatalogHandler()
+
+	for _, token := range []string{"", "wrong"} {
+		rec, _ := getCatalog(t, h, token, "")
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("token %q: status = %d, want 401", token, rec.Code)
+		}
+	}
+}
+
+func TestToolCatalogHandler_AdminSeesRoles(t *testing.T) {
+	h := newCatalogTestLoop(t).ToolCatalogHandler()
+
+	rec, resp := getCatalog(t, h, "admin-token", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body.String())
+	}
+	if resp.Role != AdminRole || resp.AgentID == "" {
+		t.Errorf("unexpected response header fields: %+v", resp)
+	}
+
+	search := findCatalogEntry(resp.Tools, "web_search")
+	fetch := findCatalogEntry(resp.Tools, "web_fetch")
+	if fetch == nil || len(fetch.Roles) != 0 {
+		t.Errorf("web_fetch should be listed with no roles: %+v", fetch)
+	}
+	if fetch != nil && fetch.CacheTTLSeconds == 0 {
+		t.Error("web_fetch should report its cache TTL")
+	}
+	if search == nil || len(search.Roles) != 1 || search.Roles[0] != "patient" {
+		t.Errorf("web_search roles = %v", search.Roles)
+	}
+	if findCatalogEntry(resp.Tools, "read_file") == nil {
+		t.Error("admin should see read_file")
+	}
+}
+
+func TestToolCatalogHandler_RoleFiltersTools(t *testing.T) {
+	h := newCatalogTestLoop(t).ToolCatalogHandler()
+
+	rec, resp := getCatalog(t, h, "patient-token", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body.String())
+	}
+	for _, entry := range resp.Tools {
+		if entry.Name != "message" && entry.Name != "web_search" {
+			t.Errorf("patient should not see %s", entry.Name)
+		}
+	}
+	if findCatalogEntry(resp.Tools, "message") == nil || findCatalogEntry(resp.Tools, "web_search") == nil {
+		t.Errorf("patient should see message and web_search, got %d tools", len(resp.Tools))
+	}
+}
+
+func TestToolCatalogHandler_UnknownAgent(t *testing.T) {
+	h := newCatalogTestLoop(t).ToolCatalogHandler()
+
+	rec, _ := getCatalog(t, h, "admin-token", "?agent=nope")
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want 404", rec.Code)
+	}
+}
+
+func TestAuditHandler_RequiresAdmin(t *testing.T) {
+	h := newCatalogTestLoop(t).AuditHandler()
+
+	tests := []struct {
+		token string
+		want  int
+	}{
+		{token: "", want: http.StatusUnauthorized},
+		{token: "patient-token", want: http.StatusForbidden},
+		{token: "admin-token", want: http.StatusNotFound}, // auditing disabled in this config
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/api/audit?session=s1", nil)
+		if tt.token != "" {
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("token %q: status = %d, want %d", tt.token, rec.Code, tt.want)
+		}
+	}
+}
+
+// defsRecordingProvider answers at once and keeps the tools it was offered.
+type defsRecordingProvider struct {
+	defs []string
+}
+
+func (p *defsRecordingProvider) Chat(ctx context.Context, messages []providers.Message, defs []providers.ToolDefinition, model string, opts map[string]interface{}) (*providers.LLMResponse, error) {
+	p.defs = p.defs[:0]
+	for _, def := range defs {
+		p.defs = append(p.defs, def.Function.Name)
+	}
+	return &providers.LLMResponse{Content: "ok"}, nil
+}
+
+func (p *defsRecordingProvider) GetDefaultModel() string {
+	return "test-model"
+}
+
+func TestAgentLoop_OffersOnlyPermittedTools(t *testing.T) {
+	al := newCatalogTestLoop(t)
+	al.cfg.Tools.Roles["patient"] = config.ToolRoleConfig{
+		Allow: []string{"web_*", "message"},
+		Deny:  []string{"web_fetch"},
+		Users: []string{"1001"},
+	}
+	provider := &defsRecordingProvider{}
+	al.registry.GetDefaultAgent().Provider = provider
+
+	_, err := al.processMessage(context.Background(), bus.InboundMessage{
+		Channel: "telegram", SenderID: "1001", ChatID: "1001", Content: "hello",
+	})
+	if err != nil {
+		t.Fatalf("processMessage: %v", err)
+	}
+	sort.Strings(provider.defs)
+	if want := []string{"message", "web_search"}; !reflect.DeepEqual(provider.defs, want) {
+		t.Errorf("patient was offered %v, want %v", provider.defs, want)
+	}
+
+	_, err = al.processMessage(context.Background(), bus.InboundMessage{
+		Channel: "telegram", SenderID: "2002", ChatID: "2002", Content: "hello",
+	})
+	if err != nil {
+		t.Fatalf("processMessage: %v", err)
+	}
+	if len(provider.defs) <= 2 {
+		t.Errorf("a user without roles should be offered every tool, got %v", provider.defs)
+	}
+}
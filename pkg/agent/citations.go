@@ -0,0 +1,206 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// reference is a cited evidence item, as described by the tool result that
+// returned it.
+type reference struct {
+	ID      string
+	Title   string
+	Journal string
+	Year    string
+	PMID    string
+	DOI     string
+	URL     string
+}
+
+var (
+	// citationMarker matches a bracketed citation such as "[E1]" or
+	// "[paper-1, PMID 3012]", but not the text of a Markdown link.
+	citationMarker = regexp.MustCompile(`\[[^\[\]\n]{1,120}\]\(?`)
+	citationSplit  = regexp.MustCompile(`\s*[,;，；、]\s*`)
+	pmidPrefix     = regexp.MustCompile(`(?i)^pmid[:\s]*`)
+)
+
+// markdownLinkChannels render [text](url) as a link.
+var markdownLinkChannels = map[string]bool{"telegram": true, "discord": true, "dingtalk": true}
+
+// renderCitations replaces the evidence IDs cited in answer with numbers,
+// in order of first citation, and appends the list of references. Only IDs
+// of evidence returned by this turn's evidence tools are numbered; other
+// bracketed text is left alone.
+func (al *AgentLoop) renderCitations(agent *AgentInstance, opts processOptions, answer string) string {
+	cc := al.cfg.Tools.Citations
+	if !cc.Enabled || answer == "" {
+		return answer
+	}
+	_, _, evidence := lastTurn(agent.Sessions.GetHistory(opts.SessionKey), cc.EvidenceTools)
+	refs := collectReferences(evidence)
+	if len(refs) == 0 {
+		return answer
+	}
+	return citeReferences(answer, refs, markdownLinkChannels[opts.Channel], prefersChinese(opts))
+}
+
+// citeReferences does the work of renderCitations for the references
+// found this turn, keyed by every ID they can be cited by.
+func citeReferences(answer string, refs map[string]*reference, markdown, chinese bool) string {
+	numbers := make(map[*reference]int)
+	var order []*reference
+	body := citationMarker.ReplaceAllStringFunc(answer, func(m string) string {
+		if strings.HasSuffix(m, "(") {
+			return m // a Markdown link
+		}
+		var cited []*reference
+		for _, id := range citationSplit.Split(strings.Trim(m, "[]"), -1) {
+			ref := lookupReference(refs, id)
+			if ref == nil {
+				return m
+			}
+			cited = append(cited, ref)
+		}
+		var nums []string
+		for _, ref := range cited {
+			n, ok := numbers[ref]
+			if !ok {
+				order = append(order, ref)
+				n = len(order)
+				numbers[ref] = n
+			}
+			nums = append(nums, strconv.Itoa(n))
+		}
+		return "[" + strings.Join(nums, ", ") + "]"
+	})
+	if len(order) == 0 {
+		return answer
+	}
+
+	heading := "References:"
+	if chinese {
+		heading = "参考文献："
+	}
+	lines := []string{strings.TrimRight(body, "\n"), "", heading}
+	for i, ref := range order {
+		lines = append(lines, fmt.Sprintf("[%d] %s", i+1, ref.format(markdown)))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func lookupReference(refs map[string]*reference, id string) *reference {
+	id = strings.TrimSpace(id)
+	if ref, ok := refs[id]; ok {
+		return ref
+	}
+	return refs[pmidPrefix.ReplaceAllString(id, "")]
+}
+
+// format renders the reference as "Title. Journal, Year. PMID n" with a
+// link: the title links to it in Markdown, or the URL follows in plain text.
+func (r *reference) format(markdown bool) string {
+	link := r.URL
+	if link == "" && r.PMID != "" {
+		link = "https://pubmed.ncbi.nlm.nih.gov/" + r.PMID + "/"
+	}
+	if link == "" && r.DOI != "" {
+		link = "https://doi.org/" + r.DOI
+	}
+	parts := []string{r.Title}
+	if markdown && link != "" {
+		parts[0] = "[" + strings.NewReplacer("[", "(", "]", ")").Replace(r.Title) + "](" + link + ")"
+	}
+	if source := strings.Trim(r.Journal+", "+r.Year, ", "); source != "" {
+		parts = append(parts, source)
+	}
+	if r.PMID != "" {
+		parts = append(parts, "PMID "+r.PMID)
+	} else if r.DOI != "" {
+		parts = append(parts, "doi:"+r.DOI)
+	}
+	if !markdown && link != "" {
+		parts = append(parts, link)
+	}
+	return strings.Join(parts, ". ")
+}
+
+// collectReferences finds the evidence items in tool results: JSON objects
+// with an ID and a title. Each is keyed by its ID, evidence ID, document
+// ID, PMID and DOI, whichever it has.
+func collectReferences(results []string) map[string]*reference {
+	refs := make(map[string]*reference)
+	var walk func(v interface{})
+	walk = func(v interface{}) {
+		switch x := v.(type) {
+		case map[string]interface{}:
+			if ref := referenceFrom(x); ref != nil {
+				for _, key := range []string{ref.ID, stringField(x, "evidence_id"), stringField(x, "doc_id"), ref.PMID, ref.DOI} {
+					if key != "" {
+						if _, taken := refs[key]; !taken {
+							refs[key] = ref
+						}
+					}
+				}
+			}
+			for _, item := range x {
+				walk(item)
+			}
+		case []interface{}:
+			for _, item := range x {
+				walk(item)
+			}
+		}
+	}
+	for _, result := range results {
+		var v interface{}
+		if json.Unmarshal([]byte(result), &v) == nil {
+			walk(v)
+		}
+	}
+	return refs
+}
+
+func referenceFrom(m map[string]interface{}) *reference {
+	ref := &reference{
+		ID:      firstField(m, "evidence_id", "id", "doc_id"),
+		Title:   firstField(m, "title", "title_cn", "title_en", "name"),
+		Journal: firstField(m, "journal", "publisher"),
+		PMID:    stringField(m, "pmid"),
+		DOI:     stringField(m, "doi"),
+		URL:     firstField(m, "url", "link"),
+	}
+	if ref.ID == "" {
+		ref.ID = firstField(m, "pmid", "doi")
+	}
+	if ref.ID == "" || ref.Title == "" {
+		return nil
+	}
+	if year := firstField(m, "year", "publish_year", "pub_year", "publish_date", "pub_date"); len(year) >= 4 {
+		ref.Year = year[:4]
+	}
+	return ref
+}
+
+func firstField(m map[string]interface{}, keys ...string) string {
+	for _, k := range keys {
+		if s := stringField(m, k); s != "" {
+			return s
+		}
+	}
+	return ""
+}
+
+// stringField returns a string or number field as a string.
+func stringField(m map[string]interface{}, key string) string {
+	switch v := m[key].(type) {
+	case string:
+		return strings.TrimSpace(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return ""
+}
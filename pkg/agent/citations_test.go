@@ -0,0 +1,81 @@
+package agent
+
+import (
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+const citationEvidence = `{"results":[
+	{"evidence_id":"E1","title":"FOLFIRINOX versus gemcitabine for metastatic pancreatic cancer","journal":"N Engl J Med","year":2011,"pmid":"21561347"},
+	{"evidence_id":"E2","title":"Nab-paclitaxel plus gemcitabine","journal":"N Engl J Med","publish_date":"2013-10-31","doi":"10.1056/NEJMoa1304369"},
+	{"id":"guide-3","title":"NCCN Guidelines: Pancreatic Adenocarcinoma","url":"https://www.nccn.org/guidelines"}
+]}`
+
+func TestCiteReferences(t *testing.T) {
+	refs := collectReferences([]string{citationEvidence, "not json"})
+	tests := []struct {
+		name     string
+		answer   string
+		markdown bool
+		chinese  bool
+		want     string
+	}{
+		{"plain text, numbered by first citation", "Both regimens help [E2][E1]. Guidelines agree [guide-3, E2].", false, false,
+			"Both regimens help [1][2]. Guidelines agree [3, 1].\n\nReferences:\n" +
+				"[1] Nab-paclitaxel plus gemcitabine. N Engl J Med, 2013. doi:10.1056/NEJMoa1304369. https://doi.org/10.1056/NEJMoa1304369\n" +
+				"[2] FOLFIRINOX versus gemcitabine for metastatic pancreatic cancer. N Engl J Med, 2011. PMID 21561347. https://pubmed.ncbi.nlm.nih.gov/21561347/\n" +
+				"[3] NCCN Guidelines: Pancreatic Adenocarcinoma. https://www.nccn.org/guidelines"},
+		{"markdown, cited by PMID", "FOLFIRINOX works [PMID: 21561347].", true, true,
+			"FOLFIRINOX works [1].\n\n参考文献：\n" +
+				"[1] [FOLFIRINOX versus gemcitabine for metastatic pancreatic cancer](https://pubmed.ncbi.nlm.nih.gov/21561347/). N Engl J Med, 2011. PMID 21561347"},
+		{"unknown IDs and links are left alone", "See [the guide](https://example.com) and [E1, E9] [note].", false, false,
+			"See [the guide](https://example.com) and [E1, E9] [note]."},
+	}
+	for _, tt := range tests {
+		if got := citeReferences(tt.answer, refs, tt.markdown, tt.chinese); got != tt.want {
+			t.Errorf("%s:\n got %q\nwant %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRenderCitations(t *testing.T) {
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				Model:             "test-model",
+				MaxTokens:         4096,
+				MaxToolIterations: 10,
+			},
+		},
+		Tools: config.ToolsConfig{Citations: config.CitationsConfig{Enabled: true, EvidenceTools: []string{"knows_*"}}},
+	}
+	al := NewAgentLoop(cfg, bus.NewMessageBus(), &mockProvider{})
+	msg := bus.InboundMessage{Channel: "telegram", SenderID: "patient", ChatID: "1", Content: "Which chemo works best?"}
+	agent, sessionKey, _ := al.resolveSession(msg)
+	opts := processOptions{SessionKey: sessionKey, Channel: "telegram", UserMessage: msg.Content}
+
+	agent.Sessions.AddMessage(sessionKey, "user", msg.Content)
+	agent.Sessions.AddFullMessage(sessionKey, providers.Message{Role: "assistant", ToolCalls: []providers.ToolCall{
+		{ID: "s1", Function: &providers.FunctionCall{Name: "knows_ai_search", Arguments: `{}`}},
+		{ID: "s2", Function: &providers.FunctionCall{Name: "read_file", Arguments: `{}`}},
+	}})
+	agent.Sessions.AddFullMessage(sessionKey, providers.Message{Role: "tool", ToolCallID: "s1", Content: citationEvidence})
+	agent.Sessions.AddFullMessage(sessionKey, providers.Message{Role: "tool", ToolCallID: "s2",
+		Content: `{"id":"E4","title":"A local file"}`})
+
+	got := al.renderCitations(agent, opts, "FOLFIRINOX [E1]; see also [E4].")
+	want := "FOLFIRINOX [1]; see also [E4].\n\nReferences:\n" +
+		"[1] [FOLFIRINOX versus gemcitabine for metastatic pancreatic cancer](https://pubmed.ncbi.nlm.nih.gov/21561347/). N Engl J Med, 2011. PMID 21561347"
+	if got != want {
+		t.Errorf("renderCitations() =\n%q\nwant\n%q", got, want)
+	}
+
+	cfg.Tools.Citations.Enabled = false
+	if got := al.renderCitations(agent, opts, "FOLFIRINOX [E1]."); got != "FOLFIRINOX [E1]." {
+		t.Errorf("disabled: %q", got)
+	}
+}
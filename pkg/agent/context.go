@@ -9,16 +9,23 @@ import (
 	"time"
 
 	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/persona"
+	"github.com/sipeed/picoclaw/pkg/profile"
 	"github.com/sipeed/picoclaw/pkg/providers"
 	"github.com/sipeed/picoclaw/pkg/skills"
 	"github.com/sipeed/picoclaw/pkg/tools"
 )
 
 type ContextBuilder struct {
-	workspace    string
-	skillsLoader *skills.SkillsLoader
-	memory       *MemoryStore
-	tools        *tools.ToolRegistry // Direct reference to tool registry
+	workspace       string
+	skillsLoader    *skills.SkillsLoader
+	memory          *MemoryStore
+	tools           *tools.ToolRegistry // Direct reference to tool registry
+	profiles        *profile.Store
+	scratchpads     tools.ScratchpadStore
+	personas        *persona.Store
+	persona         string            // persona of channels not in channelPersonas
+	channelPersonas map[string]string // channel -> persona
 }
 
 func getGlobalConfigDir() string {
@@ -48,8 +55,140 @@ func (cb *ContextBuilder) SetToolsRegistry(registry *tools.ToolRegistry) {
 	cb.tools = registry
 }
 
+// SetProfiles sets where user profiles are read from for AddUserProfile.
+func (cb *ContextBuilder) SetProfiles(store *profile.Store) {
+	cb.profiles = store
+}
+
+// SetScratchpads sets where session scratchpads are read from for
+// AddScratchpad.
+func (cb *ContextBuilder) SetScratchpads(store tools.ScratchpadStore) {
+	cb.scratchpads = store
+}
+
+// SetPersonas sets the persona templates for AddPersona, the persona of
+// each channel, and the one used on other channels; empty is none.
+func (cb *ContextBuilder) SetPersonas(store *persona.Store, defaultName string, channels map[string]string) {
+	cb.personas = store
+	cb.persona = defaultName
+	cb.channelPersonas = channels
+}
+
+// PersonaName returns the persona used on channel, or "" when there is
+// none.
+func (cb *ContextBuilder) PersonaName(channel string) string {
+	if cb.personas == nil {
+		return ""
+	}
+	if name, ok := cb.channelPersonas[channel]; ok {
+		return name
+	}
+	return cb.persona
+}
+
+// AddPersona appends the persona of the channel, filled in with the turn's
+// date, channel, chat and sender profile, to the turn context. Rendered, it
+// changes with the date and the sender, so it stays out of the cached
+// system prompt.
+func (cb *ContextBuilder) AddPersona(messages []providers.Message, channel, chatID, senderID string) []providers.Message {
+	if cb.personas == nil || len(messages) == 0 || messages[0].Role != "system" {
+		return messages
+	}
+	name := cb.PersonaName(channel)
+	if name == "" {
+		return messages
+	}
+	user := profile.UserKey(senderID)
+	var p *profile.Profile
+	if cb.profiles != nil && user != "" {
+		p, _ = cb.profiles.Get(user)
+	}
+	text, err := cb.personas.Render(name, persona.NewVars(time.Now(), channel, chatID, user, p))
+	if err != nil {
+		logger.WarnCF("agent", "Persona not applied", map[string]interface{}{"persona": name, "error": err.Error()})
+		return messages
+	}
+	if text != "" {
+		messages[turnContext(messages)].Content += "\n\n## Persona\n\n" + text
+	}
+	return messages
+}
+
+// AddScratchpad appends the notes in the session's scratchpad to the turn
+// context, so facts worked out earlier survive summarization.
+func (cb *ContextBuilder) AddScratchpad(messages []providers.Message, sessionKey string) []providers.Message {
+	if cb.scratchpads == nil || len(messages) == 0 || messages[0].Role != "system" {
+		return messages
+	}
+	lines := tools.ScratchpadLines(cb.scratchpads.Scratchpad(sessionKey))
+	if len(lines) == 0 {
+		return messages
+	}
+	section := "\n\n## Scratchpad\n\nNotes you kept with scratchpad_write earlier in this conversation. " +
+		"Rely on them, and update or remove them with scratchpad_write when they change.\n"
+	for _, line := range lines {
+		section += "\n- " + line
+	}
+	messages[turnContext(messages)].Content += section
+	return messages
+}
+
+// AddUserProfile appends the sender's profile to the system message, so
+// the agent knows their situation without asking again.
+func (cb *ContextBuilder) AddUserProfile(messages []providers.Message, senderID string) []providers.Message {
+	if cb.profiles == nil || len(messages) == 0 || messages[0].Role != "system" {
+		return messages
+	}
+	user := profile.UserKey(senderID)
+	if user == "" {
+		return messages
+	}
+	p, err := cb.profiles.Get(user)
+	if err != nil {
+		logger.WarnCF("agent", "Failed to read user profile", map[string]interface{}{"user": user, "error": err.Error()})
+		return messages
+	}
+	if p == nil || p.Empty() {
+		return messages
+	}
+	section := "\n\n## User Profile\n\nThe user confirmed these facts about themselves in earlier sessions. " +
+		"Use them instead of asking again; if the user says something has changed, offer to update it with profile_update.\n"
+	for _, line := range p.Lines() {
+		section += "\n- " + line
+	}
+	if p.Language != "" {
+		section += "\n\nReply in " + p.Language + " unless the user writes in another language."
+	}
+	messages[0].Content += section
+	return messages
+}
+
+// AddInstructions appends instructions for this turn only, such as those
+// from the safety guardrails, to the turn context.
+func (cb *ContextBuilder) AddInstructions(messages []providers.Message, instructions []string) []providers.Message {
+	if len(instructions) == 0 || len(messages) == 0 || messages[0].Role != "system" {
+		return messages
+	}
+	section := "\n\n## Instructions for This Message\n"
+	for _, instruction := range instructions {
+		section += "\n- " + instruction
+	}
+	messages[turnContext(messages)].Content += section
+	return messages
+}
+
+// turnContext returns the index of the system message that holds what
+// changes from turn to turn, which BuildMessages puts after the system
+// prompt. Keeping it apart leaves the system prompt and the user's profile
+// a stable prefix that providers can cache.
+func turnContext(messages []providers.Message) int {
+	if len(messages) > 1 && messages[1].Role == "system" {
+		return 1
+	}
+	return 0
+}
+
 func (cb *ContextBuilder) getIdentity() string {
-	now := time.Now().Format("2006-01-02 15:04 (Monday)")
 	workspacePath, _ := filepath.Abs(filepath.Join(cb.workspace))
 	runtime := fmt.Sprintf("%s %s, Go %s", runtime.GOOS, runtime.GOARCH, runtime.Version())
 
@@ -60,9 +199,6 @@ func (cb *ContextBuilder) getIdentity() string {
 
 You are picoclaw, a helpful AI assistant.
 
-## Current Time
-%s
-
 ## Runtime
 %s
 
@@ -81,7 +217,7 @@ Your workspace is at: %s
 2. **Be helpful and accurate** - When using tools, briefly explain what you're doing.
 
 3. **Memory** - When remembering something, write to %s/memory/MEMORY.md`,
-		now, runtime, workspacePath, workspacePath, workspacePath, workspacePath, toolsSection, workspacePath)
+		runtime, workspacePath, workspacePath, workspacePath, workspacePath, toolsSection, workspacePath)
 }
 
 func (cb *ContextBuilder) buildToolsSection() string {
@@ -157,14 +293,16 @@ func (cb *ContextBuilder) LoadBootstrapFiles() string {
 	return result
 }
 
-func (cb *ContextBuilder) BuildMessages(history []providers.Message, summary string, currentMessage string, media []string, channel, chatID string) []providers.Message {
+func (cb *ContextBuilder) BuildMessages(history []providers.Message, summary string, currentMessage string, images []providers.ImageContent, channel, chatID string) []providers.Message {
 	messages := []providers.Message{}
 
 	systemPrompt := cb.BuildSystemPrompt()
 
-	// Add Current Session info if provided
+	// What changes every turn goes in a system message of its own, so the
+	// system prompt before it can be cached
+	turn := "## Current Time\n" + time.Now().Format("2006-01-02 15:04 (Monday)")
 	if channel != "" && chatID != "" {
-		systemPrompt += fmt.Sprintf("\n\n## Current Session\nChannel: %s\nChat ID: %s", channel, chatID)
+		turn += fmt.Sprintf("\n\n## Current Session\nChannel: %s\nChat ID: %s", channel, chatID)
 	}
 
 	// Log system prompt summary for debugging (debug mode only)
@@ -186,7 +324,7 @@ func (cb *ContextBuilder) BuildMessages(history []providers.Message, summary str
 		})
 
 	if summary != "" {
-		systemPrompt += "\n\n## Summary of Previous Conversation\n\n" + summary
+		turn += "\n\n## Summary of Previous Conversation\n\n" + summary
 	}
 
 	//This fix prevents the session memory from LLM failure due to elimination of toolu_IDs required from LLM
@@ -203,6 +341,9 @@ func (cb *ContextBuilder) BuildMessages(history []providers.Message, summary str
 	messages = append(messages, providers.Message{
 		Role:    "system",
 		Content: systemPrompt,
+	}, providers.Message{
+		Role:    "system",
+		Content: turn,
 	})
 
 	messages = append(messages, history...)
@@ -210,6 +351,7 @@ func (cb *ContextBuilder) BuildMessages(history []providers.Message, summary str
 	messages = append(messages, providers.Message{
 		Role:    "user",
 		Content: currentMessage,
+		Images:  images,
 	})
 
 	return messages
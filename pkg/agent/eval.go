@@ -0,0 +1,82 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/sipeed/picoclaw/pkg/audit"
+	"github.com/sipeed/picoclaw/pkg/eval"
+	"github.com/sipeed/picoclaw/pkg/session"
+)
+
+// EvalRunner returns a runner that answers evaluation questions through the
+// full agent: specialist routing, the tool loop and every answer check, but
+// not intake or the answer cache. Each question runs in a throwaway
+// session, and nothing is written to the audit, shadow or usage logs. Like
+// Replay, it is meant for a loop that is not also serving messages.
+func (al *AgentLoop) EvalRunner() eval.Runner {
+	return eval.RunnerFunc(al.evalAnswer)
+}
+
+func (al *AgentLoop) evalAnswer(ctx context.Context, agentID, question string, fixtures []eval.Fixture) (eval.Answer, error) {
+	agent := al.registry.GetDefaultAgent()
+	if agentID != "" {
+		var ok bool
+		if agent, ok = al.registry.GetAgent(agentID); !ok {
+			return eval.Answer{}, fmt.Errorf("agent %q not found", agentID)
+		}
+	}
+	if agent == nil {
+		return eval.Answer{}, fmt.Errorf("no agent configured")
+	}
+
+	evalAgent := *agent
+	evalAgent.Sessions = session.NewSessionManager("")
+	if len(fixtures) > 0 {
+		evalAgent.Tools = replayRegistry(agent, &replayRecorder{calls: fixtureCalls(fixtures), reuse: true})
+	}
+
+	savedAudit, savedShadows, savedUsage, savedAnswers := al.audit, al.shadows, al.usage, al.answers
+	al.audit, al.shadows, al.usage, al.answers = nil, nil, nil, nil
+	defer func() {
+		al.audit, al.shadows, al.usage, al.answers = savedAudit, savedShadows, savedUsage, savedAnswers
+	}()
+
+	turnID := newTurnID()
+	opts := processOptions{
+		SessionKey:      "eval:" + turnID,
+		UserID:          "eval",
+		Channel:         "cli",
+		ChatID:          "eval",
+		UserMessage:     question,
+		DefaultResponse: "I've completed processing but have no response to give.",
+		Guardrails:      true,
+		TurnID:          "eval-" + turnID,
+	}
+	al.routeSpecialist(ctx, &evalAgent, &opts)
+	response, err := al.runAgentLoop(ctx, &evalAgent, opts)
+	if err != nil {
+		return eval.Answer{}, err
+	}
+
+	called := turnTools(evalAgent.Sessions.GetHistory(opts.SessionKey))
+	for i, j := 0, len(called)-1; i < j; i, j = i+1, j-1 {
+		called[i], called[j] = called[j], called[i]
+	}
+	return eval.Answer{Response: response, Tools: called}, nil
+}
+
+// fixtureCalls turns fixtures into recordings, with their arguments as
+// they would appear in the audit log.
+func fixtureCalls(fixtures []eval.Fixture) []audit.Entry {
+	calls := make([]audit.Entry, len(fixtures))
+	for i, f := range fixtures {
+		var args map[string]interface{}
+		if data, err := json.Marshal(f.Args); err == nil {
+			json.Unmarshal(data, &args)
+		}
+		calls[i] = audit.Entry{Tool: f.Tool, Args: args, Success: f.Error == "", Error: f.Error, Result: f.Result}
+	}
+	return calls
+}
@@ -0,0 +1,51 @@
+package agent
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/eval"
+)
+
+func TestEvalRunner(t *testing.T) {
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				Model:             "test-model",
+				MaxTokens:         4096,
+				MaxToolIterations: 5,
+			},
+		},
+	}
+	real := &lookupTool{result: "live result"}
+	al := NewAgentLoop(cfg, bus.NewMessageBus(), &lookupProvider{})
+	al.RegisterTool(real)
+	runner := al.EvalRunner()
+
+	// Fixtures answer every call, however often it is made.
+	fixtures := []eval.Fixture{{Tool: "lookup", Args: map[string]interface{}{"query": "other"}, Result: "fixture result"}}
+	for i := 0; i < 2; i++ {
+		answer, err := runner.Answer(context.Background(), "", "What was my CA19-9?", fixtures)
+		if err != nil {
+			t.Fatalf("Answer: %v", err)
+		}
+		if answer.Response != "Answer: fixture result" || len(answer.Tools) != 1 || answer.Tools[0] != "lookup" {
+			t.Fatalf("answer = %+v", answer)
+		}
+	}
+	if real.calls != 0 {
+		t.Fatalf("real tool called %d times despite fixtures", real.calls)
+	}
+
+	// Without fixtures the real tools run.
+	answer, err := runner.Answer(context.Background(), "", "What was my CA19-9?", nil)
+	if err != nil || answer.Response != "Answer: live result" || real.calls != 1 {
+		t.Fatalf("answer = %+v, %v; %d real calls", answer, err, real.calls)
+	}
+	if _, err := runner.Answer(context.Background(), "missing", "Hi", nil); err == nil {
+		t.Fatal("unknown agent accepted")
+	}
+}
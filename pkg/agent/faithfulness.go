@@ -0,0 +1,165 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+const (
+	faithfulnessTimeout = 60 * time.Second
+	// faithfulnessSourceChars and faithfulnessMaxInput bound the evidence
+	// sent to the checker, per result and in total.
+	faithfulnessSourceChars = 6000
+	faithfulnessMaxInput    = 60000
+)
+
+// unsupportedClaim is a statement in an answer that no evidence supports.
+type unsupportedClaim struct {
+	Claim  string `json:"claim"`
+	Reason string `json:"reason"`
+}
+
+// checkFaithfulness asks the checker model which claims in answer are not
+// supported by the evidence tool results of this turn, and flags or removes
+// them. Answers from turns that retrieved no evidence are not checked, and
+// the answer is left as it is if the check fails.
+func (al *AgentLoop) checkFaithfulness(ctx context.Context, agent *AgentInstance, opts processOptions, answer string) string {
+	fc := al.cfg.Tools.Faithfulness
+	if !fc.Enabled || strings.TrimSpace(answer) == "" {
+		return answer
+	}
+	_, _, evidence := lastTurn(agent.Sessions.GetHistory(opts.SessionKey), fc.EvidenceTools)
+	if len(evidence) == 0 {
+		return answer
+	}
+
+	model := fc.Model
+	if model == "" {
+		model = agent.Model
+	}
+	ctx, cancel := context.WithTimeout(ctx, faithfulnessTimeout)
+	defer cancel()
+	response, err := agent.Provider.Chat(ctx, []providers.Message{
+		{Role: "user", Content: faithfulnessPrompt(answer, evidence)},
+	}, nil, model, map[string]interface{}{
+		"max_tokens":  2048,
+		"temperature": 0.0,
+	})
+	if err != nil {
+		logger.WarnCF("agent", "Faithfulness check failed, sending answer unchecked",
+			map[string]interface{}{
+				"session_key": opts.SessionKey,
+				"error":       err.Error(),
+			})
+		return answer
+	}
+	claims, err := parseUnsupportedClaims(response.Content)
+	if err != nil {
+		logger.WarnCF("agent", "Faithfulness check returned invalid JSON, sending answer unchecked",
+			map[string]interface{}{
+				"session_key": opts.SessionKey,
+				"error":       err.Error(),
+			})
+		return answer
+	}
+	if len(claims) == 0 {
+		return answer
+	}
+
+	logger.InfoCF("agent", "Answer has claims without supporting evidence",
+		map[string]interface{}{
+			"session_key": opts.SessionKey,
+			"turn_id":     opts.TurnID,
+			"claims":      len(claims),
+			"mode":        fc.Mode,
+		})
+	return applyFaithfulness(answer, claims, fc.Mode == "block", prefersChinese(opts))
+}
+
+func faithfulnessPrompt(answer string, evidence []string) string {
+	var sb strings.Builder
+	sb.WriteString("Check the answer below against the evidence retrieved for it. ")
+	sb.WriteString("List every factual medical claim in the answer (about diagnoses, treatments, doses, outcomes, risks, statistics or study results) that no evidence item supports. ")
+	sb.WriteString("A claim is supported only if an evidence item states it or directly implies it; general plausibility is not enough. ")
+	sb.WriteString("Ignore empathy, questions, suggestions to consult the care team, and statements about what the user said.\n\n")
+	sb.WriteString(`Reply with JSON only: {"unsupported":[{"claim":"<the sentence from the answer, copied exactly>","reason":"<why no evidence supports it>"}]}. `)
+	sb.WriteString(`Reply {"unsupported":[]} if every claim is supported.` + "\n\nEvidence:\n")
+	total := 0
+	for i, e := range evidence {
+		e = utils.Truncate(e, faithfulnessSourceChars)
+		if total+len(e) > faithfulnessMaxInput {
+			break
+		}
+		total += len(e)
+		fmt.Fprintf(&sb, "[E%d]\n%s\n\n", i+1, e)
+	}
+	fmt.Fprintf(&sb, "Answer:\n%s\n", answer)
+	return sb.String()
+}
+
+func parseUnsupportedClaims(content string) ([]unsupportedClaim, error) {
+	start, end := strings.Index(content, "{"), strings.LastIndex(content, "}")
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("no JSON object in %q", utils.Truncate(content, 100))
+	}
+	var out struct {
+		Unsupported []unsupportedClaim `json:"unsupported"`
+	}
+	if err := json.Unmarshal([]byte(content[start:end+1]), &out); err != nil {
+		return nil, err
+	}
+	claims := out.Unsupported[:0]
+	for _, c := range out.Unsupported {
+		if c.Claim = strings.TrimSpace(c.Claim); c.Claim != "" {
+			claims = append(claims, c)
+		}
+	}
+	return claims, nil
+}
+
+// applyFaithfulness lists the unsupported claims after the answer, or with
+// block removes them from it. Claims that cannot be found word for word in
+// the answer are listed either way.
+func applyFaithfulness(answer string, claims []unsupportedClaim, block, chinese bool) string {
+	var flagged []string
+	removed := 0
+	for _, c := range claims {
+		if block && strings.Contains(answer, c.Claim) {
+			answer = strings.Replace(answer, c.Claim, "", 1)
+			removed++
+			continue
+		}
+		flagged = append(flagged, c.Claim)
+	}
+	answer = strings.TrimSpace(answer)
+
+	var notes []string
+	if removed > 0 {
+		if answer == "" {
+			if chinese {
+				return "抱歉，本次检索到的证据不足以支持回答这个问题。建议换个问法，或向您的医生团队咨询。"
+			}
+			return "Sorry, the evidence found for this question does not support an answer. Try asking differently, or check with your care team."
+		}
+		if chinese {
+			notes = append(notes, fmt.Sprintf("⚠️ 已删除 %d 处本次检索到的证据不支持的说法。", removed))
+		} else {
+			notes = append(notes, fmt.Sprintf("⚠️ %d statement(s) were removed because the evidence found for this answer does not support them.", removed))
+		}
+	}
+	if len(flagged) > 0 {
+		header := "⚠️ These statements are not supported by the evidence found for this answer; check them with your care team:"
+		if chinese {
+			header = "⚠️ 以下说法未能在本次检索到的证据中找到依据，请与医生核实："
+		}
+		notes = append(notes, header+"\n- "+strings.Join(flagged, "\n- "))
+	}
+	return answer + "\n\n" + strings.Join(notes, "\n\n")
+}
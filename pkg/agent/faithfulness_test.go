@@ -0,0 +1,86 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+func TestApplyFaithfulness(t *testing.T) {
+	answer := "FOLFIRINOX extends median survival to 11.1 months [E1]. It cures most patients."
+	claims := []unsupportedClaim{{Claim: "It cures most patients."}, {Claim: "Surgery is always possible"}}
+	tests := []struct {
+		name    string
+		block   bool
+		chinese bool
+		answer  string
+		claims  []unsupportedClaim
+		want    string
+	}{
+		{"flag", false, false, answer, claims[:1],
+			answer + "\n\n⚠️ These statements are not supported by the evidence found for this answer; check them with your care team:\n- It cures most patients."},
+		{"block, with a claim not in the answer", true, false, answer, claims,
+			"FOLFIRINOX extends median survival to 11.1 months [E1].\n\n⚠️ 1 statement(s) were removed because the evidence found for this answer does not support them." +
+				"\n\n⚠️ These statements are not supported by the evidence found for this answer; check them with your care team:\n- Surgery is always possible"},
+		{"block everything", true, true, "手术后可以治愈。", []unsupportedClaim{{Claim: "手术后可以治愈。"}},
+			"抱歉，本次检索到的证据不足以支持回答这个问题。建议换个问法，或向您的医生团队咨询。"},
+	}
+	for _, tt := range tests {
+		if got := applyFaithfulness(tt.answer, tt.claims, tt.block, tt.chinese); got != tt.want {
+			t.Errorf("%s:\n got %q\nwant %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCheckFaithfulness(t *testing.T) {
+	provider := &summaryProvider{response: "```json\n{\"unsupported\":[{\"claim\":\"It cures most patients.\",\"reason\":\"E1 reports survival only\"}]}\n```"}
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				Model:             "test-model",
+				MaxTokens:         4096,
+				MaxToolIterations: 10,
+			},
+		},
+		Tools: config.ToolsConfig{Faithfulness: config.FaithfulnessConfig{
+			Enabled:       true,
+			Mode:          "block",
+			Model:         "cheap-model",
+			EvidenceTools: []string{"knows_*"},
+		}},
+	}
+	al := NewAgentLoop(cfg, bus.NewMessageBus(), provider)
+	msg := bus.InboundMessage{Channel: "telegram", SenderID: "patient", ChatID: "1", Content: "How much does FOLFIRINOX help?"}
+	agent, sessionKey, _ := al.resolveSession(msg)
+	opts := processOptions{SessionKey: sessionKey, UserMessage: msg.Content}
+	answer := "FOLFIRINOX extends median survival to 11.1 months [E1]. It cures most patients."
+
+	// Without evidence this turn there is nothing to check against.
+	agent.Sessions.AddMessage(sessionKey, "user", msg.Content)
+	if got := al.checkFaithfulness(context.Background(), agent, opts, answer); got != answer || provider.calls != 0 {
+		t.Fatalf("checked without evidence: %q, %d calls", got, provider.calls)
+	}
+
+	agent.Sessions.AddFullMessage(sessionKey, providers.Message{Role: "assistant", ToolCalls: []providers.ToolCall{{
+		ID: "s1", Function: &providers.FunctionCall{Name: "knows_ai_search", Arguments: `{"question":"FOLFIRINOX"}`},
+	}}})
+	agent.Sessions.AddFullMessage(sessionKey, providers.Message{Role: "tool", ToolCallID: "s1",
+		Content: `{"evidence_id":"E1","text":"FOLFIRINOX improved median overall survival to 11.1 months."}`})
+
+	got := al.checkFaithfulness(context.Background(), agent, opts, answer)
+	want := "FOLFIRINOX extends median survival to 11.1 months [E1].\n\n⚠️ 1 statement(s) were removed because the evidence found for this answer does not support them."
+	if got != want || provider.model != "cheap-model" {
+		t.Errorf("checkFaithfulness() = %q with model %q", got, provider.model)
+	}
+
+	// A failed check leaves the answer alone.
+	provider.err = errors.New("unavailable")
+	if got := al.checkFaithfulness(context.Background(), agent, opts, answer); got != answer {
+		t.Errorf("failed check changed the answer: %q", got)
+	}
+}
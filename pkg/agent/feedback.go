@@ -0,0 +1,250 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/feedback"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// setupFeedback opens the feedback log. A log that cannot be opened
+// disables feedback rather than blocking startup.
+func setupFeedback(cfg *config.Config) *feedback.Store {
+	store, err := feedback.NewStore(cfg.FeedbackPath())
+	if err != nil {
+		logger.ErrorCF("agent", "Feedback disabled",
+			map[string]interface{}{
+				"path":  cfg.FeedbackPath(),
+				"error": err.Error(),
+			})
+		return nil
+	}
+	return store
+}
+
+// RecordFeedback stores a rating of, or a comment on, the latest answer in
+// a session, together with its question and the evidence it used.
+func (al *AgentLoop) RecordFeedback(agentID string, r feedback.Record) (feedback.Record, error) {
+	if al.feedback == nil {
+		return r, fmt.Errorf("feedback is disabled")
+	}
+	agent := al.registry.GetDefaultAgent()
+	if agentID != "" {
+		var ok bool
+		if agent, ok = al.registry.GetAgent(agentID); !ok {
+			return r, fmt.Errorf("agent %q not found", agentID)
+		}
+	}
+	if agent == nil {
+		return r, fmt.Errorf("no agent configured")
+	}
+
+	question, answer, evidence := lastTurn(agent.Sessions.GetHistory(r.SessionKey), al.cfg.Tools.Citations.EvidenceTools)
+	if answer == "" {
+		return r, fmt.Errorf("session %q has no answer to rate", r.SessionKey)
+	}
+	r.AgentID = agent.ID
+	r.Question, r.Answer, r.Evidence = question, answer, evidence
+	if turnID, ok := al.lastTurns.Load(r.SessionKey); ok {
+		r.TurnID = turnID.(string)
+	}
+	r, err := al.feedback.Add(r)
+	if err != nil {
+		return r, err
+	}
+	logger.InfoCF("agent", "Recorded feedback",
+		map[string]interface{}{
+			"session_key": r.SessionKey,
+			"turn_id":     r.TurnID,
+			"rating":      r.Rating,
+			"comment":     r.Comment != "",
+		})
+	return r, nil
+}
+
+// ratingEmoji returns the rating a message of a lone thumbs-up or
+// thumbs-down stands for, in any skin tone.
+func ratingEmoji(content string) (string, bool) {
+	trimmed := strings.Map(func(r rune) rune {
+		if r == '\uFE0F' || (r >= 0x1F3FB && r <= 0x1F3FF) {
+			return -1
+		}
+		return r
+	}, strings.TrimSpace(content))
+	switch trimmed {
+	case "👍":
+		return feedback.RatingUp, true
+	case "👎":
+		return feedback.RatingDown, true
+	}
+	return "", false
+}
+
+// handleFeedbackCommand handles /feedback [up|down] [comment].
+func (al *AgentLoop) handleFeedbackCommand(msg bus.InboundMessage, args []string) string {
+	if al.feedback == nil {
+		return "Feedback is not enabled."
+	}
+	if len(args) == 0 {
+		return "Usage: /feedback [up|down] [comment]"
+	}
+	rating := ""
+	if r, ok := ratingEmoji(args[0]); ok {
+		rating, args = r, args[1:]
+	} else {
+		switch strings.ToLower(args[0]) {
+		case "up", "good", "+1":
+			rating, args = feedback.RatingUp, args[1:]
+		case "down", "bad", "-1":
+			rating, args = feedback.RatingDown, args[1:]
+		}
+	}
+	return al.rateLastAnswer(msg, rating, strings.Join(args, " "))
+}
+
+// rateLastAnswer records feedback on the answer the chat got last and
+// returns the acknowledgement, in Chinese when the question was.
+func (al *AgentLoop) rateLastAnswer(msg bus.InboundMessage, rating, comment string) string {
+	agent, sessionKey, _ := al.resolveSession(msg)
+	if fork, ok := al.activeForks.Load(sessionKey); ok {
+		sessionKey = fork.(string)
+	}
+	r, err := al.RecordFeedback(agent.ID, feedback.Record{
+		SessionKey: sessionKey,
+		UserID:     msg.SenderID,
+		Channel:    msg.Channel,
+		ChatID:     msg.ChatID,
+		Rating:     rating,
+		Comment:    comment,
+	})
+	chinese := containsHan(r.Question) || containsHan(comment)
+	if err != nil {
+		if r.Answer == "" {
+			if chinese {
+				return "还没有可以评价的回答。"
+			}
+			return "There is no answer to rate yet."
+		}
+		logger.WarnCF("agent", "Failed to record feedback",
+			map[string]interface{}{
+				"session_key": sessionKey,
+				"error":       err.Error(),
+			})
+		return "Sorry, your feedback could not be recorded."
+	}
+	switch {
+	case r.Rating == feedback.RatingDown && r.Comment == "":
+		if chinese {
+			return "感谢您的反馈。如需说明问题所在，请发送 /feedback 加上您的意见。"
+		}
+		return "Thanks for the feedback. To tell us what was wrong, send /feedback followed by your comment."
+	case chinese:
+		return "感谢您的反馈！"
+	default:
+		return "Thanks for the feedback!"
+	}
+}
+
+type feedbackRequest struct {
+	AgentID    string `json:"agent_id,omitempty"`
+	SessionKey string `json:"session_key"`
+	UserID     string `json:"user_id,omitempty"`
+	Rating     string `json:"rating,omitempty"`
+	Comment    string `json:"comment,omitempty"`
+}
+
+// FeedbackHandler records feedback on a session's latest answer from
+// frontends on POST, for any API token, and exports it to admin tokens on
+// GET.
+//
+// GET query parameters: rating (up or down), agent, days (default 30) and
+// format: json (default) for a JSON list with a summary, eval for JSON
+// lines of rated turns, or chat for chat fine-tuning examples of the
+// well-rated ones.
+func (al *AgentLoop) FeedbackHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodPost {
+			writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+
+		role, ok := al.authenticate(r)
+		if !ok {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeJSONError(w, http.StatusUnauthorized, "invalid or missing bearer token")
+			return
+		}
+		if al.feedback == nil {
+			writeJSONError(w, http.StatusNotFound, "feedback is disabled")
+			return
+		}
+
+		if r.Method == http.MethodPost {
+			var req feedbackRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.SessionKey == "" {
+				writeJSONError(w, http.StatusBadRequest, "body must be JSON with session_key and a rating or comment")
+				return
+			}
+			rec, err := al.RecordFeedback(req.AgentID, feedback.Record{
+				SessionKey: req.SessionKey,
+				UserID:     req.UserID,
+				Channel:    "api",
+				Rating:     req.Rating,
+				Comment:    req.Comment,
+			})
+			if err != nil {
+				writeJSONError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(map[string]string{"id": rec.ID, "turn_id": rec.TurnID})
+			return
+		}
+
+		if role != AdminRole {
+			writeJSONError(w, http.StatusForbidden, "admin role required")
+			return
+		}
+		q := r.URL.Query()
+		days := 30
+		if raw := q.Get("days"); raw != "" {
+			n, err := strconv.Atoi(raw)
+			if err != nil || n < 1 {
+				writeJSONError(w, http.StatusBadRequest, "days must be a positive integer")
+				return
+			}
+			days = n
+		}
+		records, err := al.feedback.List(feedback.Query{
+			Since:   time.Now().AddDate(0, 0, -days),
+			Rating:  q.Get("rating"),
+			AgentID: q.Get("agent"),
+		})
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		switch format := q.Get("format"); format {
+		case "", "json":
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"summary":  feedback.Summarize(records),
+				"feedback": records,
+			})
+		case feedback.FormatEval, feedback.FormatChat:
+			w.Header().Set("Content-Type", "application/x-ndjson")
+			feedback.Export(w, records, format)
+		default:
+			writeJSONError(w, http.StatusBadRequest, "format must be json, eval or chat")
+		}
+	})
+}
@@ -0,0 +1,65 @@
+package agent
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/feedback"
+)
+
+func TestFeedback(t *testing.T) {
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				Model:             "test-model",
+				MaxTokens:         4096,
+				MaxToolIterations: 5,
+			},
+		},
+		Feedback: config.FeedbackConfig{Enabled: true},
+	}
+	provider := &countingProvider{}
+	al := NewAgentLoop(cfg, bus.NewMessageBus(), provider)
+	defer al.Stop()
+	agent := al.registry.GetDefaultAgent()
+	send := func(content string) string {
+		t.Helper()
+		reply, err := al.processMessage(context.Background(), bus.InboundMessage{
+			Channel: "telegram", SenderID: "u1", ChatID: "u1", Content: content,
+		})
+		if err != nil {
+			t.Fatalf("processMessage: %v", err)
+		}
+		return reply
+	}
+
+	if reply := send("👍"); reply != "There is no answer to rate yet." {
+		t.Fatalf("rating before any answer: %q", reply)
+	}
+	send("胰腺癌的化疗方案有哪些？")
+	if reply := send("👎🏻"); reply != "感谢您的反馈。如需说明问题所在，请发送 /feedback 加上您的意见。" {
+		t.Fatalf("thumbs down: %q", reply)
+	}
+	if reply := send("/feedback 没有提到最新的临床试验"); reply != "感谢您的反馈！" {
+		t.Fatalf("comment: %q", reply)
+	}
+	if provider.calls != 1 {
+		t.Fatalf("feedback reached the model: %d calls", provider.calls)
+	}
+	if history := agent.Sessions.GetHistory("agent:main:main"); len(history) != 2 {
+		t.Fatalf("feedback added to history: %+v", history)
+	}
+
+	records, err := al.feedback.List(feedback.Query{})
+	if err != nil || len(records) != 1 {
+		t.Fatalf("List = %+v, %v", records, err)
+	}
+	r := records[0]
+	if r.Rating != feedback.RatingDown || r.Comment != "没有提到最新的临床试验" || r.TurnID == "" ||
+		r.Question != "胰腺癌的化疗方案有哪些？" || r.Answer != "answer 1" || r.UserID != "u1" {
+		t.Fatalf("record = %+v", r)
+	}
+}
@@ -0,0 +1,181 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/constants"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+const (
+	followUpTimeout        = 30 * time.Second
+	followUpEvidenceChars  = 1500
+	followUpMaxEvidence    = 4
+	followUpMaxButtonRunes = 60
+)
+
+// sendFollowUps suggests follow-up questions for the turn that just
+// answered msg and sends them as quick replies. It is a no-op unless the
+// turn used an evidence tool, so small talk gets no suggestions.
+func (al *AgentLoop) sendFollowUps(ctx context.Context, msg bus.InboundMessage) {
+	fc := al.cfg.Tools.FollowUps
+	if !fc.Enabled || fc.Max <= 0 || constants.IsInternalChannel(msg.Channel) ||
+		strings.HasPrefix(strings.TrimSpace(msg.Content), "/") {
+		return
+	}
+
+	agent, sessionKey, _ := al.resolveSession(msg)
+	if fork, ok := al.activeForks.Load(sessionKey); ok {
+		sessionKey = fork.(string)
+	}
+	question, answer, evidence := lastTurn(agent.Sessions.GetHistory(sessionKey), fc.EvidenceTools)
+	if len(evidence) == 0 || answer == "" {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, followUpTimeout)
+	defer cancel()
+	response, err := agent.Provider.Chat(ctx, []providers.Message{
+		{Role: "user", Content: followUpPrompt(question, answer, evidence, fc.Max)},
+	}, nil, agent.Model, map[string]interface{}{
+		"max_tokens":  300,
+		"temperature": 0.3,
+	})
+	if err != nil {
+		logger.WarnCF("agent", "Follow-up suggestions failed",
+			map[string]interface{}{
+				"session_key": sessionKey,
+				"error":       err.Error(),
+			})
+		return
+	}
+
+	suggestions := parseFollowUps(response.Content, fc.Max)
+	if len(suggestions) == 0 {
+		return
+	}
+	header := "You might also ask:"
+	if containsHan(question) {
+		header = "您可能还想问："
+	}
+	al.bus.PublishOutbound(bus.OutboundMessage{
+		Channel:      msg.Channel,
+		ChatID:       msg.ChatID,
+		Content:      header,
+		QuickReplies: suggestions,
+	})
+}
+
+// lastTurn returns the latest user message in history, the final answer to
+// it, and the results of evidence tools called in between.
+func lastTurn(history []providers.Message, evidenceTools []string) (question, answer string, evidence []string) {
+	start := -1
+	for i := len(history) - 1; i >= 0; i-- {
+		if history[i].Role == "user" {
+			start = i
+			break
+		}
+	}
+	if start < 0 {
+		return "", "", nil
+	}
+	question = history[start].Content
+
+	toolNames := make(map[string]string)
+	for _, m := range history[start+1:] {
+		switch m.Role {
+		case "assistant":
+			for _, tc := range m.ToolCalls {
+				name := tc.Name
+				if name == "" && tc.Function != nil {
+					name = tc.Function.Name
+				}
+				toolNames[tc.ID] = name
+			}
+			if len(m.ToolCalls) == 0 {
+				answer = m.Content
+			}
+		case "tool":
+			if m.Content != "" && matchesAny(toolNames[m.ToolCallID], evidenceTools) {
+				evidence = append(evidence, m.Content)
+			}
+		}
+	}
+	return question, answer, evidence
+}
+
+func matchesAny(name string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func followUpPrompt(question, answer string, evidence []string, max int) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Suggest %d short follow-up questions the user is likely to ask next. ", max)
+	sb.WriteString("Each must be answerable from the evidence below, must not repeat the original question, ")
+	sb.WriteString("and must be written in the same language as the user's question, as the user would type it. ")
+	sb.WriteString("Reply with a JSON array of strings only.\n\n")
+	fmt.Fprintf(&sb, "User question:\n%s\n\nAnswer given:\n%s\n", question, utils.Truncate(answer, followUpEvidenceChars))
+
+	if len(evidence) > followUpMaxEvidence {
+		evidence = evidence[len(evidence)-followUpMaxEvidence:]
+	}
+	for i, e := range evidence {
+		fmt.Fprintf(&sb, "\nEvidence %d:\n%s\n", i+1, utils.Truncate(e, followUpEvidenceChars))
+	}
+	return sb.String()
+}
+
+// parseFollowUps reads the model's suggestions, accepting a JSON array or
+// one question per line, and returns at most max usable button labels.
+func parseFollowUps(content string, max int) []string {
+	var raw []string
+	start, end := strings.Index(content, "["), strings.LastIndex(content, "]")
+	if start < 0 || end <= start || json.Unmarshal([]byte(content[start:end+1]), &raw) != nil {
+		raw = nil
+		for _, line := range strings.Split(content, "\n") {
+			raw = append(raw, listMarker.ReplaceAllString(line, ""))
+		}
+	}
+
+	seen := make(map[string]bool)
+	var suggestions []string
+	for _, s := range raw {
+		s = strings.TrimSpace(strings.Trim(strings.TrimSpace(s), "\""))
+		if s == "" || seen[s] || utf8.RuneCountInString(s) > followUpMaxButtonRunes {
+			continue
+		}
+		seen[s] = true
+		suggestions = append(suggestions, s)
+		if len(suggestions) == max {
+			break
+		}
+	}
+	return suggestions
+}
+
+var listMarker = regexp.MustCompile(`^\s*(?:[-*•]|\d+[.)、])\s*`)
+
+func containsHan(s string) bool {
+	for _, r := range s {
+		if unicode.Is(unicode.Han, r) {
+			return true
+		}
+	}
+	return false
+}
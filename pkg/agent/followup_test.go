@@ -0,0 +1,129 @@
+package agent
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+func TestParseFollowUps(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		max     int
+		want    []string
+	}{
+		{
+			name:    "json array",
+			content: `["What does CA19-9 measure?", "Is fatigue expected?", "When is the next scan?"]`,
+			max:     3,
+			want:    []string{"What does CA19-9 measure?", "Is fatigue expected?", "When is the next scan?"},
+		},
+		{
+			name:    "json wrapped in prose and capped",
+			content: "Sure:\n```json\n[\"术后多久复查？\", \"术后多久复查？\", \"饮食要注意什么？\", \"能运动吗？\"]\n```",
+			max:     2,
+			want:    []string{"术后多久复查？", "饮食要注意什么？"},
+		},
+		{
+			name:    "numbered lines keep leading numbers in questions",
+			content: "1. Is 5-FU given weekly?\n2) What if I miss a dose?\n- \n",
+			max:     3,
+			want:    []string{"Is 5-FU given weekly?", "What if I miss a dose?"},
+		},
+		{
+			name:    "drops labels too long for a button",
+			content: `["Short?", "This question is far too long to fit comfortably on a quick reply button in a chat app?"]`,
+			max:     3,
+			want:    []string{"Short?"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseFollowUps(tt.content, tt.max); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseFollowUps() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLastTurn_CollectsEvidenceToolResults(t *testing.T) {
+	history := []providers.Message{
+		{Role: "user", Content: "old question"},
+		{Role: "assistant", Content: "old answer"},
+		{Role: "user", Content: "What is the survival benefit of FOLFIRINOX?"},
+		{Role: "assistant", ToolCalls: []providers.ToolCall{
+			{ID: "1", Name: "knows_ai_search"},
+			{ID: "2", Function: &providers.FunctionCall{Name: "message"}},
+		}},
+		{Role: "tool", ToolCallID: "1", Content: "PRODIGE 4 trial: median OS 11.1 vs 6.8 months"},
+		{Role: "tool", ToolCallID: "2", Content: "Message sent"},
+		{Role: "assistant", Content: "About four months in PRODIGE 4."},
+	}
+
+	question, answer, evidence := lastTurn(history, []string{"knows_*"})
+	if question != "What is the survival benefit of FOLFIRINOX?" || answer != "About four months in PRODIGE 4." {
+		t.Errorf("unexpected turn: %q / %q", question, answer)
+	}
+	if len(evidence) != 1 || evidence[0] != "PRODIGE 4 trial: median OS 11.1 vs 6.8 months" {
+		t.Errorf("unexpected evidence: %q", evidence)
+	}
+
+	if _, _, evidence := lastTurn(history[:2], []string{"knows_*"}); len(evidence) != 0 {
+		t.Errorf("expected no evidence for a turn without tools, got %q", evidence)
+	}
+}
+
+func TestSendFollowUps_PublishesQuickReplies(t *testing.T) {
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				Model:             "test-model",
+				MaxTokens:         4096,
+				MaxToolIterations: 10,
+			},
+		},
+		Tools: config.ToolsConfig{
+			FollowUps: config.FollowUpsConfig{Enabled: true, Max: 2, EvidenceTools: []string{"knows_*"}},
+		},
+	}
+	msgBus := bus.NewMessageBus()
+	al := NewAgentLoop(cfg, msgBus, &simpleMockProvider{response: `["化疗期间能吃什么？", "副作用多久消失？", "需要复查吗？"]`})
+
+	msg := bus.InboundMessage{Channel: "telegram", SenderID: "patient", ChatID: "42", Content: "吉西他滨有什么副作用？"}
+	agent, sessionKey, _ := al.resolveSession(msg)
+	agent.Sessions.AddMessage(sessionKey, "user", msg.Content)
+	agent.Sessions.AddFullMessage(sessionKey, providers.Message{Role: "assistant", ToolCalls: []providers.ToolCall{{ID: "c1", Name: "knows_ai_search"}}})
+	agent.Sessions.AddFullMessage(sessionKey, providers.Message{Role: "tool", ToolCallID: "c1", Content: "骨髓抑制、乏力、恶心"})
+	agent.Sessions.AddMessage(sessionKey, "assistant", "常见副作用包括骨髓抑制、乏力和恶心。")
+
+	al.sendFollowUps(context.Background(), msg)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	out, ok := msgBus.SubscribeOutbound(ctx)
+	if !ok {
+		t.Fatal("expected follow-up suggestions to be published")
+	}
+	if out.Content != "您可能还想问：" || !reflect.DeepEqual(out.QuickReplies, []string{"化疗期间能吃什么？", "副作用多久消失？"}) {
+		t.Errorf("unexpected follow-up message: %+v", out)
+	}
+
+	// Commands and turns without evidence get no suggestions
+	al.sendFollowUps(context.Background(), bus.InboundMessage{Channel: "telegram", SenderID: "patient", ChatID: "42", Content: "/fork"})
+	agent.Sessions.AddMessage(sessionKey, "user", "谢谢")
+	agent.Sessions.AddMessage(sessionKey, "assistant", "不客气")
+	al.sendFollowUps(context.Background(), msg)
+
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if out, ok := msgBus.SubscribeOutbound(ctx); ok {
+		t.Errorf("expected no further messages, got %+v", out)
+	}
+}
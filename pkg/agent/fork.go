@@ -0,0 +1,211 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/session"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+// ForkSession copies sessionKey's history through its first `turns` user
+// turns into a new session and returns the new key. The source session is
+// not modified, so exploring the fork never touches the original thread.
+// A scenario, such as "the patient is ECOG 2", is assumed in every turn of
+// the fork, as is the scenario of the session forked from.
+func (al *AgentLoop) ForkSession(agentID, sessionKey string, turns int, scenario string) (string, error) {
+	agent := al.registry.GetDefaultAgent()
+	if agentID != "" {
+		var ok bool
+		if agent, ok = al.registry.GetAgent(agentID); !ok {
+			return "", fmt.Errorf("agent %q not found", agentID)
+		}
+	}
+	if agent == nil {
+		return "", fmt.Errorf("no agent configured")
+	}
+
+	forkKey := ""
+	for n := 1; ; n++ {
+		forkKey = fmt.Sprintf("%s:fork:%d", sessionKey, n)
+		if !agent.Sessions.Exists(forkKey) {
+			break
+		}
+	}
+
+	if _, err := agent.Sessions.Fork(sessionKey, forkKey, turns); err != nil {
+		return "", err
+	}
+	if scenario = strings.TrimSpace(scenario); scenario != "" {
+		if inherited := agent.Sessions.Scenario(forkKey); inherited != "" {
+			scenario = inherited + "; and " + scenario
+		}
+		agent.Sessions.SetScenario(forkKey, scenario)
+	}
+	if err := agent.Sessions.Save(forkKey); err != nil {
+		logger.WarnCF("agent", "Failed to save forked session",
+			map[string]interface{}{
+				"session_key": forkKey,
+				"error":       err.Error(),
+			})
+	}
+
+	logger.InfoCF("agent", "Forked session",
+		map[string]interface{}{
+			"agent_id": agent.ID,
+			"source":   sessionKey,
+			"fork":     forkKey,
+			"turns":    turns,
+			"scenario": scenario != "",
+		})
+	return forkKey, nil
+}
+
+// scenarioInstruction tells turns in a what-if fork to assume its premise.
+func scenarioInstruction(scenario string) string {
+	return fmt.Sprintf("This conversation is a what-if branch. Assume that %s, even where earlier messages say otherwise. "+
+		"This is a hypothetical for exploration: do not save it to the user's profile, diary or records.", scenario)
+}
+
+// handleForkCommand implements /fork for chat users:
+//
+//	/fork                   list the turns of the current conversation
+//	/fork <n> [what-if...]  fork after turn n and continue in the fork,
+//	                        assuming the what-if premise if one is given
+//	/fork list              list the forks of the main conversation
+//	/fork resume <key>      switch this chat to an existing fork
+func (al *AgentLoop) handleForkCommand(msg bus.InboundMessage, args []string) string {
+	agent, baseKey, _ := al.resolveSession(msg)
+	if agent == nil {
+		return "No default agent configured"
+	}
+	current := baseKey
+	if fork, ok := al.activeForks.Load(baseKey); ok {
+		current = fork.(string)
+	}
+
+	if len(args) == 0 {
+		turns := agent.Sessions.UserTurns(current)
+		if len(turns) == 0 {
+			return "Nothing to fork yet: this conversation has no turns."
+		}
+		var sb strings.Builder
+		sb.WriteString("Turns in this conversation:\n")
+		start := 0
+		if len(turns) > 10 {
+			start = len(turns) - 10
+		}
+		for i := start; i < len(turns); i++ {
+			sb.WriteString(fmt.Sprintf("%d. %s\n", i+1, utils.Truncate(turns[i], 60)))
+		}
+		sb.WriteString("\nUse /fork <n> to continue from after turn n in a separate branch, " +
+			"or /fork <n> <what-if> to explore a scenario, e.g. /fork 2 the patient is ECOG 2.")
+		return sb.String()
+	}
+
+	if args[0] == "list" {
+		// Forks of forks are listed too
+		var forks []session.ForkInfo
+		for queue := []string{baseKey}; len(queue) > 0; queue = queue[1:] {
+			for _, f := range agent.Sessions.Forks(queue[0]) {
+				forks = append(forks, f)
+				queue = append(queue, f.Key)
+			}
+		}
+		if len(forks) == 0 {
+			return "This conversation has no forks."
+		}
+		var sb strings.Builder
+		sb.WriteString("Forks of this conversation:\n")
+		for _, f := range forks {
+			line := fmt.Sprintf("- %s: after turn %d, %d turns", f.Key, f.Turn, f.Turns)
+			if f.Scenario != "" {
+				line += ", what if " + utils.Truncate(f.Scenario, 60)
+			}
+			if f.Key == current {
+				line += " (current)"
+			}
+			sb.WriteString(line + "\n")
+		}
+		sb.WriteString("\nUse /fork resume <key> to switch to one.")
+		return sb.String()
+	}
+
+	if args[0] == "resume" {
+		if len(args) < 2 {
+			return "Usage: /fork resume <session-key>"
+		}
+		if !strings.HasPrefix(args[1], baseKey+":fork:") || !agent.Sessions.Exists(args[1]) {
+			return fmt.Sprintf("No fork %s of this conversation.", args[1])
+		}
+		al.activeForks.Store(baseKey, args[1])
+		return fmt.Sprintf("Resumed fork %s. Use /unfork to return to the main conversation.", args[1])
+	}
+
+	turns, err := strconv.Atoi(args[0])
+	if err != nil {
+		return "Usage: /fork [<turn> [what-if] | list | resume <session-key>]"
+	}
+	scenario := strings.Join(args[1:], " ")
+	forkKey, err := al.ForkSession(agent.ID, current, turns, scenario)
+	if err != nil {
+		return fmt.Sprintf("Fork failed: %v", err)
+	}
+	al.activeForks.Store(baseKey, forkKey)
+	reply := fmt.Sprintf("Forked after turn %d into %s. New messages go to the fork; the original conversation is unchanged. Use /unfork to return.", turns, forkKey)
+	if scenario != "" {
+		reply += fmt.Sprintf("\nIn this fork, assuming: %s", scenario)
+	}
+	return reply
+}
+
+type forkRequest struct {
+	AgentID    string `json:"agent_id"`
+	SessionKey string `json:"session_key"`
+	Turn       int    `json:"turn"`
+	Scenario   string `json:"scenario"`
+}
+
+// ForkHandler serves POST requests that fork a session for admin tokens.
+// The body is {"agent_id", "session_key", "turn", "scenario"}; the reply
+// carries the new session_key.
+func (al *AgentLoop) ForkHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+
+		role, ok := al.authenticate(r)
+		if !ok {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeJSONError(w, http.StatusUnauthorized, "invalid or missing bearer token")
+			return
+		}
+		if role != AdminRole {
+			writeJSONError(w, http.StatusForbidden, "admin role required")
+			return
+		}
+
+		var req forkRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.SessionKey == "" {
+			writeJSONError(w, http.StatusBadRequest, "body must be JSON with session_key and turn")
+			return
+		}
+
+		forkKey, err := al.ForkSession(req.AgentID, req.SessionKey, req.Turn, req.Scenario)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]string{"session_key": forkKey})
+	})
+}
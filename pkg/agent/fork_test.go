@@ -0,0 +1,128 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestForkCommand_BranchesWithoutTouchingMainThread(t *testing.T) {
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				Model:             "test-model",
+				MaxTokens:         4096,
+				MaxToolIterations: 10,
+			},
+		},
+	}
+	al := NewAgentLoop(cfg, bus.NewMessageBus(), &simpleMockProvider{response: "ok"})
+	helper := testHelper{al: al}
+	ctx := context.Background()
+
+	send := func(content string) string {
+		return helper.executeAndGetResponse(t, ctx, bus.InboundMessage{
+			Channel:  "telegram",
+			SenderID: "volunteer",
+			ChatID:   "42",
+			Content:  content,
+		})
+	}
+
+	send("first question")
+	send("second question")
+
+	agent, mainKey, _ := al.resolveSession(bus.InboundMessage{Channel: "telegram", SenderID: "volunteer", ChatID: "42"})
+
+	if reply := send("/fork"); !strings.Contains(reply, "2. second question") {
+		t.Fatalf("expected turn listing, got %q", reply)
+	}
+
+	reply := send("/fork 1")
+	if !strings.Contains(reply, mainKey+":fork:1") {
+		t.Fatalf("unexpected fork reply: %q", reply)
+	}
+
+	send("second question, rephrased")
+
+	if turns := agent.Sessions.UserTurns(mainKey); len(turns) != 2 || turns[1] != "second question" {
+		t.Errorf("main thread changed: %v", turns)
+	}
+	forkTurns := agent.Sessions.UserTurns(mainKey + ":fork:1")
+	if len(forkTurns) != 2 || forkTurns[1] != "second question, rephrased" {
+		t.Errorf("unexpected fork turns: %v", forkTurns)
+	}
+
+	if reply := send("/unfork"); !strings.Contains(reply, "Back on the main conversation") {
+		t.Errorf("unexpected unfork reply: %q", reply)
+	}
+	send("third question")
+	if turns := agent.Sessions.UserTurns(mainKey); len(turns) != 3 {
+		t.Errorf("expected message on main thread after /unfork, got %v", turns)
+	}
+
+	if reply := send("/fork resume " + mainKey + ":fork:1"); !strings.Contains(reply, "Resumed fork") {
+		t.Errorf("unexpected resume reply: %q", reply)
+	}
+	if reply := send("/fork 9"); !strings.Contains(reply, "Fork failed") {
+		t.Errorf("expected failure for out-of-range turn, got %q", reply)
+	}
+}
+
+func TestForkCommand_WhatIfScenario(t *testing.T) {
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				Model:             "test-model",
+				MaxTokens:         4096,
+				MaxToolIterations: 10,
+			},
+		},
+	}
+	provider := &systemRecordingProvider{response: "ok"}
+	al := NewAgentLoop(cfg, bus.NewMessageBus(), provider)
+	helper := testHelper{al: al}
+	ctx := context.Background()
+
+	send := func(content string) string {
+		return helper.executeAndGetResponse(t, ctx, bus.InboundMessage{
+			Channel:  "telegram",
+			SenderID: "oncologist",
+			ChatID:   "7",
+			Content:  content,
+		})
+	}
+
+	send("Patient is ECOG 0, metastatic PDAC. First-line options?")
+	if reply := send("/fork list"); reply != "This conversation has no forks." {
+		t.Errorf("list without forks: %q", reply)
+	}
+
+	_, mainKey, _ := al.resolveSession(bus.InboundMessage{Channel: "telegram", SenderID: "oncologist", ChatID: "7"})
+	reply := send("/fork 1 the patient is ECOG 2")
+	if !strings.Contains(reply, "assuming: the patient is ECOG 2") {
+		t.Fatalf("fork reply: %q", reply)
+	}
+	send("Would FOLFIRINOX still be reasonable?")
+	if !strings.Contains(provider.system, "Assume that the patient is ECOG 2") {
+		t.Errorf("scenario missing from system prompt:\n%s", provider.system)
+	}
+
+	// Forks of a what-if fork keep its premise.
+	send("/fork 1 CA19-9 is 2000")
+	if reply := send("/fork list"); !strings.Contains(reply, mainKey+":fork:1: after turn 1, 2 turns, what if the patient is ECOG 2\n") ||
+		!strings.Contains(reply, mainKey+":fork:1:fork:1: after turn 1, 1 turns, what if the patient is ECOG 2; and CA19-9 is 2000 (current)") {
+		t.Errorf("fork list: %q", reply)
+	}
+
+	send("/unfork")
+	send("And second-line?")
+	if strings.Contains(provider.system, "what-if") {
+		t.Error("scenario leaked into the main conversation")
+	}
+}
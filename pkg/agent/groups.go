@@ -0,0 +1,33 @@
+package agent
+
+import (
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+// maxQuoteLen is how much of a question is quoted above its answer.
+const maxQuoteLen = 100
+
+// isGroupMessage reports whether msg was sent in a group or channel
+// rather than to the bot directly.
+func isGroupMessage(msg bus.InboundMessage) bool {
+	kind := msg.Metadata["peer_kind"]
+	return kind == "group" || kind == "channel"
+}
+
+// groupReply makes out, the answer to msg, a reply to the question when
+// msg came from a group, so that in a busy group the asker and everyone
+// else can see which question it answers.
+func (al *AgentLoop) groupReply(msg bus.InboundMessage, out *bus.OutboundMessage) {
+	if !al.cfg.Channels.Groups.QuoteQuestion || !isGroupMessage(msg) {
+		return
+	}
+	// A button press is not a question; its message is the bot's own
+	if msg.Metadata["callback"] == "true" {
+		return
+	}
+	out.ReplyTo = msg.Metadata["message_id"]
+	out.Quote = utils.Truncate(strings.Join(strings.Fields(msg.Content), " "), maxQuoteLen)
+}
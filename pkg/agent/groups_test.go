@@ -0,0 +1,36 @@
+package agent
+
+import (
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestGroupReply(t *testing.T) {
+	question := "Is it normal to feel   tired\nafter the third cycle?"
+	tests := []struct {
+		name      string
+		quote     bool
+		metadata  map[string]string
+		wantReply string
+		wantQuote string
+	}{
+		{"group question", true, map[string]string{"peer_kind": "group", "message_id": "m9"}, "m9", "Is it normal to feel tired after the third cycle?"},
+		{"channel question", true, map[string]string{"peer_kind": "channel", "message_id": "m9"}, "m9", "Is it normal to feel tired after the third cycle?"},
+		{"direct message", true, map[string]string{"peer_kind": "direct", "message_id": "m9"}, "", ""},
+		{"button press", true, map[string]string{"peer_kind": "group", "message_id": "m9", "callback": "true"}, "", ""},
+		{"quoting off", false, map[string]string{"peer_kind": "group", "message_id": "m9"}, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			al := &AgentLoop{cfg: &config.Config{}}
+			al.cfg.Channels.Groups.QuoteQuestion = tt.quote
+			out := bus.OutboundMessage{Content: "Yes, fatigue often peaks a few days after each cycle."}
+			al.groupReply(bus.InboundMessage{Content: question, Metadata: tt.metadata}, &out)
+			if out.ReplyTo != tt.wantReply || out.Quote != tt.wantQuote {
+				t.Errorf("reply to %q, quote %q", out.ReplyTo, out.Quote)
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package agent
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/guardrails"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// checkInbound runs the inbound guardrails, such as red-flag symptoms and
+// crisis detection, on the user's message. The checks are rule-based and
+// run before the model, so their notices reach the user even if the model
+// plays the message down or fails.
+func (al *AgentLoop) checkInbound(opts processOptions) guardrails.Inbound {
+	if !opts.Guardrails || al.guardrails == nil {
+		return guardrails.Inbound{}
+	}
+	checks := al.guardrails.CheckInbound(guardrails.Input{Message: opts.UserMessage, Chinese: prefersChinese(opts)})
+	if len(checks.Findings) == 0 {
+		return checks
+	}
+	logger.WarnCF("agent", "Guardrails flagged user message",
+		map[string]interface{}{
+			"session_key": opts.SessionKey,
+			"turn_id":     opts.TurnID,
+			"findings":    guardrails.FindingIDs(checks.Findings),
+		})
+	if checks.Escalate {
+		al.alertStaff(opts, checks.Findings)
+	}
+	return checks
+}
+
+// checkOutbound runs the outbound guardrails, such as dose softening and
+// the disclaimer, on the answer.
+func (al *AgentLoop) checkOutbound(opts processOptions, answer string) string {
+	if !opts.Guardrails || al.guardrails == nil {
+		return answer
+	}
+	answer, findings := al.guardrails.CheckOutbound(guardrails.Input{Message: opts.UserMessage, Chinese: prefersChinese(opts)}, answer)
+	if len(findings) > 0 {
+		logger.InfoCF("agent", "Guardrails changed answer",
+			map[string]interface{}{
+				"session_key": opts.SessionKey,
+				"turn_id":     opts.TurnID,
+				"findings":    guardrails.FindingIDs(findings),
+			})
+	}
+	return answer
+}
+
+// alertStaff tells the configured staff chat that a user may be in crisis.
+// The alert names the session, not what the user wrote.
+func (al *AgentLoop) alertStaff(opts processOptions, findings []guardrails.Finding) {
+	crisis := al.cfg.Guardrails.Crisis
+	if crisis.NotifyChannel == "" || crisis.NotifyChatID == "" {
+		return
+	}
+	al.bus.PublishOutbound(bus.OutboundMessage{
+		Channel: crisis.NotifyChannel,
+		ChatID:  crisis.NotifyChatID,
+		Content: fmt.Sprintf("🚨 Safety alert (%s): a user on %s (chat %s, session %s) may be at risk. Please follow up.",
+			guardrails.FindingIDs(findings), opts.Channel, opts.ChatID, opts.SessionKey),
+	})
+}
+
+// prefersChinese reports whether to answer in Chinese: the channel says
+// so, or the message is written in Chinese.
+func prefersChinese(opts processOptions) bool {
+	if opts.Language != "" {
+		return strings.HasPrefix(strings.ToLower(opts.Language), "zh")
+	}
+	return guardrails.IsChinese(opts.UserMessage)
+}
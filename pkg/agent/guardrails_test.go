@@ -0,0 +1,143 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+func newTriageLoop(t *testing.T, provider providers.LLMProvider, enabled bool) *AgentLoop {
+	t.Helper()
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				Model:             "test-model",
+				MaxTokens:         4096,
+				MaxToolIterations: 5,
+			},
+		},
+		Tools: config.ToolsConfig{Triage: config.TriageConfig{Enabled: enabled}},
+	}
+	return NewAgentLoop(cfg, bus.NewMessageBus(), provider)
+}
+
+func TestRedFlagNotice_PrependedToAnswer(t *testing.T) {
+	al := newTriageLoop(t, &simpleMockProvider{response: "Black stools are often caused by iron tablets."}, true)
+
+	response, err := al.ProcessDirect(context.Background(), "My mum has black stools today", "cli:triage")
+	if err != nil {
+		t.Fatalf("ProcessDirect: %v", err)
+	}
+	if !strings.HasPrefix(response, "⚠️ Urgent") || !strings.HasSuffix(response, "Black stools are often caused by iron tablets.") {
+		t.Errorf("response = %q", response)
+	}
+
+	response, _ = al.ProcessDirect(context.Background(), "化疗后发烧38.6度", "cli:triage")
+	if !strings.HasPrefix(response, "⚠️ 紧急提醒") {
+		t.Errorf("Chinese response = %q", response)
+	}
+
+	response, _ = al.ProcessDirect(context.Background(), "What should I eat after chemo?", "cli:triage")
+	if strings.Contains(response, "⚠️") {
+		t.Errorf("notice without red flags: %q", response)
+	}
+}
+
+func TestRedFlagNotice_SurvivesModelFailure(t *testing.T) {
+	al := newTriageLoop(t, &failFirstMockProvider{failures: 10, failError: errors.New("provider down")}, true)
+
+	response, err := al.ProcessDirect(context.Background(), "He is vomiting blood", "cli:triage")
+	if err != nil || !strings.HasPrefix(response, "⚠️ Urgent") || !strings.Contains(response, "provider down") {
+		t.Errorf("response = %q, err = %v", response, err)
+	}
+}
+
+func TestRedFlagNotice_Disabled(t *testing.T) {
+	al := newTriageLoop(t, &simpleMockProvider{response: "ok"}, false)
+
+	response, _ := al.ProcessDirect(context.Background(), "He is vomiting blood", "cli:triage")
+	if response != "ok" {
+		t.Errorf("response = %q", response)
+	}
+}
+
+// systemRecordingProvider answers with response and keeps the last system
+// prompt it was sent.
+type systemRecordingProvider struct {
+	response string
+	system   string
+}
+
+func (p *systemRecordingProvider) Chat(ctx context.Context, messages []providers.Message, defs []providers.ToolDefinition, model string, opts map[string]interface{}) (*providers.LLMResponse, error) {
+	p.system = systemText(messages)
+	return &providers.LLMResponse{Content: p.response}, nil
+}
+
+// systemText joins the system messages at the start of messages: the
+// system prompt and the turn context.
+func systemText(messages []providers.Message) string {
+	var parts []string
+	for _, m := range messages {
+		if m.Role != "system" {
+			break
+		}
+		parts = append(parts, m.Content)
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+func (p *systemRecordingProvider) GetDefaultModel() string {
+	return "test-model"
+}
+
+func TestGuardrails_CrisisAndDisclaimer(t *testing.T) {
+	provider := &systemRecordingProvider{response: "I'm so sorry you're feeling this way. Are you safe right now?"}
+	msgBus := bus.NewMessageBus()
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				Model:             "test-model",
+				MaxTokens:         4096,
+				MaxToolIterations: 5,
+			},
+		},
+		Guardrails: config.GuardrailsConfig{
+			Disclaimer: config.DisclaimerGuardConfig{Enabled: true},
+			Crisis:     config.CrisisGuardConfig{Enabled: true, NotifyChannel: "telegram", NotifyChatID: "staff"},
+		},
+	}
+	al := NewAgentLoop(cfg, msgBus, provider)
+
+	response, err := al.ProcessDirect(context.Background(), "Since the diagnosis I just want to die", "cli:crisis")
+	if err != nil {
+		t.Fatalf("ProcessDirect: %v", err)
+	}
+	if !strings.HasPrefix(response, "💛") || !strings.Contains(response, "988") ||
+		!strings.Contains(response, provider.response) || !strings.HasSuffix(response, "does not replace advice from your medical team.") {
+		t.Errorf("response = %q", response)
+	}
+	if !strings.Contains(provider.system, "## Instructions for This Message") {
+		t.Error("crisis instruction missing from system prompt")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	alert, ok := msgBus.SubscribeOutbound(ctx)
+	if !ok || alert.ChatID != "staff" || !strings.Contains(alert.Content, "crisis:self_harm") || strings.Contains(alert.Content, "want to die") {
+		t.Errorf("staff alert = %+v", alert)
+	}
+
+	// The instruction applies to that turn only.
+	al.ProcessDirect(context.Background(), "Thank you", "cli:crisis")
+	if strings.Contains(provider.system, "## Instructions for This Message") {
+		t.Error("crisis instruction carried over to the next turn")
+	}
+}
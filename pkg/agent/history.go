@@ -0,0 +1,217 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/tokens"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+// History compaction: when a session's prompt nears the context window,
+// the oldest turns are folded into the session's rolling summary and only
+// the recent turns are kept verbatim.
+const (
+	// compactAtPercent of the context window triggers compaction.
+	compactAtPercent = 75
+	// keepPercent of the context window is kept as recent turns.
+	keepPercent = 40
+	// compactToolResultChars is how much of each tool result the
+	// summarizer sees.
+	compactToolResultChars = 1500
+)
+
+const compactionPrompt = `You maintain the running summary of a conversation between a patient-support assistant and a user. Update the summary with the conversation segment below.
+
+Keep, exactly as written:
+- diagnoses, stages, test results with their values and dates, and medications with doses;
+- decisions, plans and advice given, and what the user said they would do;
+- the IDs of evidence and documents cited (PMIDs, DOIs, trial numbers, KnowS evidence IDs, doc IDs), next to the claim each supports.
+
+Drop greetings, repetition and tool mechanics. Write short bullet points in the language of the conversation. Return only the updated summary.`
+
+var (
+	evidenceIDKeys = map[string]bool{"evidence_id": true, "pmid": true, "doi": true, "doc_id": true, "nct_id": true, "trial_id": true}
+	evidenceIDText = regexp.MustCompile(`\bPMID:?\s?\d{6,9}\b|\bNCT\d{8}\b|\b10\.\d{4,9}/[^\s"'<>,;)\]]+`)
+)
+
+// compactionCut returns how many of the oldest messages to fold into the
+// summary so that the rest fit in keepTokens, as counted by counter. Cuts
+// fall before a user message, so a tool call is never separated from its
+// results, and the latest user turn is always kept.
+func compactionCut(history []providers.Message, keepTokens int, counter *tokens.Counter) int {
+	if counter.Messages(history) <= keepTokens {
+		return 0
+	}
+	cut, kept := 0, 0
+	for i := len(history) - 1; i > 0; i-- {
+		kept += counter.Messages(history[i : i+1])
+		if history[i].Role != "user" {
+			continue
+		}
+		if kept > keepTokens && cut > 0 {
+			break
+		}
+		cut = i
+	}
+	return cut
+}
+
+// compactHistory folds the oldest messages of a session into its summary
+// so the recent ones fit in keepTokens. It reports whether the history was
+// compacted.
+func (al *AgentLoop) compactHistory(ctx context.Context, agent *AgentInstance, sessionKey string, keepTokens int) bool {
+	history := agent.Sessions.GetHistory(sessionKey)
+	cut := compactionCut(history, keepTokens, agent.Tokens)
+	if cut == 0 {
+		return false
+	}
+	older := history[:cut]
+	summary, err := al.foldSummary(ctx, agent, agent.Sessions.GetSummary(sessionKey), older)
+	if err != nil || strings.TrimSpace(summary) == "" {
+		logger.WarnCF("agent", "History compaction failed", map[string]interface{}{
+			"session_key": sessionKey,
+			"error":       fmt.Sprint(err),
+		})
+		return false
+	}
+
+	agent.Sessions.Compact(sessionKey, cut, summary)
+	agent.Sessions.Save(sessionKey)
+	logger.InfoCF("agent", "Compacted session history", map[string]interface{}{
+		"session_key":    sessionKey,
+		"folded_msgs":    cut,
+		"kept_msgs":      len(history) - cut,
+		"summary_tokens": agent.Tokens.Count(summary),
+	})
+	return true
+}
+
+// foldSummary updates summary with messages, in batches of at most half the
+// context window, and makes sure every evidence ID cited in them is kept.
+func (al *AgentLoop) foldSummary(ctx context.Context, agent *AgentInstance, summary string, messages []providers.Message) (string, error) {
+	batchTokens := agent.ContextWindow / 2
+	var batch []string
+	batchSize := 0
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		var prompt strings.Builder
+		prompt.WriteString(compactionPrompt)
+		if summary != "" {
+			prompt.WriteString("\n\nCURRENT SUMMARY:\n" + summary)
+		}
+		prompt.WriteString("\n\nCONVERSATION SEGMENT:\n" + strings.Join(batch, "\n"))
+		resp, err := agent.Provider.Chat(ctx, []providers.Message{{Role: "user", Content: prompt.String()}}, nil, agent.Model,
+			map[string]interface{}{"max_tokens": 1024, "temperature": 0.2})
+		if err != nil {
+			return err
+		}
+		summary = strings.TrimSpace(resp.Content)
+		batch, batchSize = nil, 0
+		return nil
+	}
+	for _, m := range messages {
+		line := compactionLine(m)
+		n := agent.Tokens.Count(line)
+		if batchSize+n > batchTokens {
+			if err := flush(); err != nil {
+				return "", err
+			}
+		}
+		batch = append(batch, line)
+		batchSize += n
+	}
+	if err := flush(); err != nil {
+		return "", err
+	}
+
+	var missing []string
+	for _, id := range evidenceIDs(messages) {
+		if !strings.Contains(summary, id) {
+			missing = append(missing, id)
+		}
+	}
+	if len(missing) > 0 {
+		summary += "\n\nEvidence cited earlier: " + strings.Join(missing, ", ")
+	}
+	return summary, nil
+}
+
+// compactionLine renders a message for the summarizer.
+func compactionLine(m providers.Message) string {
+	switch {
+	case m.Role == "tool":
+		return "tool result: " + utils.Truncate(m.Content, compactToolResultChars)
+	case len(m.ToolCalls) > 0:
+		calls := make([]string, 0, len(m.ToolCalls))
+		for _, tc := range m.ToolCalls {
+			name, args := tc.Name, ""
+			if tc.Function != nil {
+				name, args = tc.Function.Name, tc.Function.Arguments
+			}
+			calls = append(calls, fmt.Sprintf("%s(%s)", name, utils.Truncate(args, 300)))
+		}
+		line := "assistant called " + strings.Join(calls, ", ")
+		if m.Content != "" {
+			line = "assistant: " + m.Content + "\n" + line
+		}
+		return line
+	}
+	return m.Role + ": " + m.Content
+}
+
+// evidenceIDs returns the evidence and document IDs in messages: values of
+// ID fields in tool arguments and results, and PMIDs, trial numbers and
+// DOIs in text.
+func evidenceIDs(messages []providers.Message) []string {
+	seen := make(map[string]bool)
+	var walk func(v interface{})
+	walk = func(v interface{}) {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			for k, val := range v {
+				if evidenceIDKeys[strings.ToLower(k)] {
+					if s, ok := val.(string); ok && s != "" {
+						seen[s] = true
+					}
+				}
+				walk(val)
+			}
+		case []interface{}:
+			for _, item := range v {
+				walk(item)
+			}
+		}
+	}
+	scan := func(text string) {
+		var v interface{}
+		if json.Unmarshal([]byte(text), &v) == nil {
+			walk(v)
+		}
+		for _, id := range evidenceIDText.FindAllString(text, -1) {
+			seen[id] = true
+		}
+	}
+	for _, m := range messages {
+		scan(m.Content)
+		for _, tc := range m.ToolCalls {
+			if tc.Function != nil {
+				scan(tc.Function.Arguments)
+			}
+		}
+	}
+	ids := make([]string, 0, len(seen))
+	for id := range seen {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
@@ -0,0 +1,107 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/tokens"
+)
+
+func TestCompactionCut(t *testing.T) {
+	long := strings.Repeat("字", 100) // 104 tokens as a message
+	call := providers.Message{Role: "assistant", ToolCalls: []providers.ToolCall{{
+		ID: "c1", Function: &providers.FunctionCall{Name: "knows_search", Arguments: `{"query":"x"}`},
+	}}}
+	history := []providers.Message{
+		{Role: "user", Content: long},
+		call,
+		{Role: "tool", Content: long, ToolCallID: "c1"},
+		{Role: "assistant", Content: long},
+		{Role: "user", Content: long},
+		{Role: "assistant", Content: long},
+		{Role: "user", Content: long},
+		{Role: "assistant", Content: long},
+	}
+	counter := tokens.ForModel("llama3")
+	tests := []struct {
+		name string
+		keep int
+		want int
+	}{
+		{"everything fits", 10000, 0},
+		{"keeps two turns", 500, 4},
+		{"keeps the last turn", 300, 6},
+		{"last turn kept even if too long", 10, 6},
+	}
+	for _, tt := range tests {
+		if got := compactionCut(history, tt.keep, counter); got != tt.want {
+			t.Errorf("%s: cut = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+	if got := compactionCut(history[:3], 1, counter); got != 0 {
+		t.Errorf("single turn: cut = %d, want 0", got)
+	}
+}
+
+func TestEvidenceIDs(t *testing.T) {
+	messages := []providers.Message{
+		{Role: "assistant", ToolCalls: []providers.ToolCall{{
+			Function: &providers.FunctionCall{Name: "knows_evidence_highlight", Arguments: `{"evidence_id":"EV-77"}`},
+		}}},
+		{Role: "tool", Content: `{"results":[{"pmid":"31234567","doi":"10.1056/NEJMoa1809775"},{"doc_id":"kb-3"}]}`},
+		{Role: "assistant", Content: "NCT02923921 and PMID: 29846502 support adjuvant mFOLFIRINOX."},
+	}
+	want := []string{"10.1056/NEJMoa1809775", "31234567", "EV-77", "NCT02923921", "PMID: 29846502", "kb-3"}
+	if got := evidenceIDs(messages); !reflect.DeepEqual(got, want) {
+		t.Errorf("evidenceIDs = %q, want %q", got, want)
+	}
+}
+
+func TestCompactHistory(t *testing.T) {
+	provider := &summaryProvider{response: "- Diagnosis: PDAC stage III\n- Plan: mFOLFIRINOX (EV-77)"}
+	al := newSummaryTestLoop(t, provider)
+	agent := al.registry.GetDefaultAgent()
+	key := "telegram:42"
+
+	long := strings.Repeat("字", 100)
+	agent.Sessions.AddMessage(key, "user", "我确诊胰腺癌III期 "+long)
+	agent.Sessions.AddFullMessage(key, providers.Message{Role: "assistant", ToolCalls: []providers.ToolCall{{
+		ID: "c1", Function: &providers.FunctionCall{Name: "knows_search", Arguments: `{"query":"mFOLFIRINOX"}`},
+	}}})
+	agent.Sessions.AddFullMessage(key, providers.Message{Role: "tool", ToolCallID: "c1",
+		Content: `{"results":[{"evidence_id":"EV-77"},{"pmid":"30575490"}]}`})
+	agent.Sessions.AddMessage(key, "assistant", "建议mFOLFIRINOX "+long)
+	agent.Sessions.AddMessage(key, "user", "副作用呢？")
+	agent.Sessions.AddMessage(key, "assistant", "常见有腹泻。")
+
+	if !al.compactHistory(context.Background(), agent, key, 20) {
+		t.Fatal("history was not compacted")
+	}
+	history := agent.Sessions.GetHistory(key)
+	if len(history) != 2 || history[0].Content != "副作用呢？" {
+		t.Errorf("kept history = %+v", history)
+	}
+	summary := agent.Sessions.GetSummary(key)
+	if !strings.HasPrefix(summary, provider.response) {
+		t.Errorf("summary = %q", summary)
+	}
+	// EV-77 is in the model's summary; the PMID it dropped is appended.
+	if !strings.HasSuffix(summary, "Evidence cited earlier: 30575490") {
+		t.Errorf("missing evidence IDs not appended: %q", summary)
+	}
+
+	// Nothing is lost when summarizing fails.
+	provider.err = errors.New("unavailable")
+	agent.Sessions.AddMessage(key, "user", long)
+	agent.Sessions.AddMessage(key, "assistant", long)
+	if al.compactHistory(context.Background(), agent, key, 20) {
+		t.Error("compacted although summarizing failed")
+	}
+	if got := len(agent.Sessions.GetHistory(key)); got != 4 {
+		t.Errorf("history has %d messages after failed compaction, want 4", got)
+	}
+}
@@ -0,0 +1,73 @@
+package agent
+
+import (
+	"context"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/hooks"
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+// Hooks returns the event hooks of the agent loop, for Go code to
+// subscribe to. Webhooks from config are already subscribed.
+func (al *AgentLoop) Hooks() *hooks.Manager {
+	return al.hooks
+}
+
+// toolCallHook passes every tool call to the ToolCall hooks.
+type toolCallHook struct {
+	hooks *hooks.Manager
+}
+
+func (h toolCallHook) RecordToolCall(record tools.ToolCallRecord) {
+	h.hooks.Emit(context.Background(), hooks.Event{
+		Type:       hooks.ToolCall,
+		Time:       record.Start,
+		Channel:    record.Channel,
+		ChatID:     record.ChatID,
+		SenderID:   record.Meta.UserID,
+		SessionKey: record.Meta.SessionKey,
+		Content:    record.Result,
+		Tool:       record.Tool,
+		Args:       record.Args,
+		IsError:    record.IsError,
+		DurationMS: record.Duration.Milliseconds(),
+		Error:      record.Error,
+	})
+}
+
+// receiveMessage passes msg to the MessageReceived hooks. It reports
+// whether a hook rejected the message, after sending the hook's reply.
+func (al *AgentLoop) receiveMessage(ctx context.Context, msg bus.InboundMessage) bool {
+	rejection := al.hooks.Emit(ctx, hooks.Event{
+		Type:       hooks.MessageReceived,
+		Channel:    msg.Channel,
+		ChatID:     msg.ChatID,
+		SenderID:   msg.SenderID,
+		SessionKey: msg.SessionKey,
+		Content:    msg.Content,
+		Metadata:   msg.Metadata,
+	})
+	if rejection == nil {
+		return false
+	}
+	if rejection.Reply != "" {
+		al.bus.PublishOutbound(bus.OutboundMessage{
+			Channel: msg.Channel,
+			ChatID:  msg.ChatID,
+			Content: rejection.Reply,
+		})
+	}
+	return true
+}
+
+func (al *AgentLoop) emitError(ctx context.Context, msg bus.InboundMessage, err error) {
+	al.hooks.Emit(ctx, hooks.Event{
+		Type:       hooks.Error,
+		Channel:    msg.Channel,
+		ChatID:     msg.ChatID,
+		SenderID:   msg.SenderID,
+		SessionKey: msg.SessionKey,
+		Error:      err.Error(),
+	})
+}
@@ -0,0 +1,58 @@
+package agent
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/hooks"
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+func TestHooks(t *testing.T) {
+	msgBus := bus.NewMessageBus()
+	al := newSummaryTestLoop(t, &summaryProvider{response: "ok"})
+	al.bus = msgBus
+
+	var events []hooks.Event
+	record := func(ctx context.Context, e hooks.Event) error {
+		events = append(events, e)
+		return nil
+	}
+	al.Hooks().OnToolCall(record)
+	al.Hooks().OnMessageReceived(record)
+	al.Hooks().OnMessageReceived(func(ctx context.Context, e hooks.Event) error {
+		if e.Content == "buy cheap pills" {
+			return hooks.Reject("This chat is for questions about care.")
+		}
+		return nil
+	})
+
+	agent := al.registry.GetDefaultAgent()
+	ctx := tools.WithCallMetadata(context.Background(), tools.CallMetadata{SessionKey: "s1", UserID: "u1"})
+	agent.Tools.ExecuteWithContext(ctx, "list_dir", map[string]interface{}{"path": "."}, "telegram", "42", nil)
+	if len(events) != 1 || events[0].Type != hooks.ToolCall || events[0].Tool != "list_dir" ||
+		events[0].ChatID != "42" || events[0].SessionKey != "s1" || events[0].SenderID != "u1" {
+		t.Fatalf("tool call events = %+v", events)
+	}
+
+	msg := bus.InboundMessage{Channel: "telegram", SenderID: "u1", ChatID: "42", Content: "hello"}
+	if al.receiveMessage(context.Background(), msg) {
+		t.Error("hello was rejected")
+	}
+	msg.Content = "buy cheap pills"
+	if !al.receiveMessage(context.Background(), msg) {
+		t.Fatal("spam was not rejected")
+	}
+	if len(events) != 3 || events[2].Type != hooks.MessageReceived || events[2].Content != "buy cheap pills" {
+		t.Errorf("events = %+v", events)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	reply, ok := msgBus.SubscribeOutbound(ctx)
+	if !ok || reply.Content != "This chat is for questions about care." || reply.ChatID != "42" {
+		t.Errorf("rejection reply = %+v, %v", reply, ok)
+	}
+}
@@ -0,0 +1,72 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+// loadTurnImages reads the images attached to the message into opts.Images
+// when the model that will answer can see them. Otherwise the message says
+// what was attached, so the model asks the user for what it cannot read
+// rather than answering as if there were no report.
+func (al *AgentLoop) loadTurnImages(ctx context.Context, agent *AgentInstance, opts *processOptions) {
+	if len(opts.Media) == 0 {
+		return
+	}
+
+	var images []providers.ImageContent
+	failed := 0
+	for _, source := range opts.Media {
+		img, err := providers.LoadImage(ctx, source)
+		if errors.Is(err, providers.ErrNotImage) || errors.Is(err, fs.ErrNotExist) {
+			// Voice notes and documents, or files their channel already removed
+			continue
+		}
+		if err != nil {
+			logger.WarnCF("agent", "Failed to load image", map[string]interface{}{
+				"agent_id": agent.ID,
+				"source":   source,
+				"error":    err.Error(),
+			})
+			failed++
+			continue
+		}
+		images = append(images, img)
+	}
+
+	model := opts.Model
+	if model == "" {
+		model = opts.Params.Model
+	}
+	if len(images) > 0 && !seesImages(agent, model) {
+		opts.UserMessage += fmt.Sprintf("\n\n[%s, which this model cannot see: ask the user to describe it or type out the values]",
+			imageCount(len(images)))
+		images = nil
+	}
+	if failed > 0 {
+		opts.UserMessage += fmt.Sprintf("\n\n[%s could not be read: ask the user to send it again or type out the values]",
+			imageCount(failed))
+	}
+	opts.Images = images
+}
+
+// seesImages reports whether the model answering a turn with images can see
+// them: the configured image model, or the turn's model if it has vision.
+func seesImages(agent *AgentInstance, model string) bool {
+	if model != "" {
+		return providers.SupportsVision(model)
+	}
+	return len(agent.ImageCandidates) > 0 || providers.SupportsVision(agent.Model)
+}
+
+func imageCount(n int) string {
+	if n == 1 {
+		return "1 image attached"
+	}
+	return fmt.Sprintf("%d images attached", n)
+}
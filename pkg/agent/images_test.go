@@ -0,0 +1,142 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+// imageRecordingProvider keeps the last user message it was sent.
+type imageRecordingProvider struct {
+	model string
+	last  providers.Message
+}
+
+func (p *imageRecordingProvider) Chat(ctx context.Context, messages []providers.Message, defs []providers.ToolDefinition, model string, opts map[string]interface{}) (*providers.LLMResponse, error) {
+	p.last = messages[len(messages)-1]
+	return &providers.LLMResponse{Content: "Your CA19-9 is 37 U/mL."}, nil
+}
+
+func (p *imageRecordingProvider) GetDefaultModel() string {
+	return p.model
+}
+
+func TestProcessMessage_Images(t *testing.T) {
+	tests := []struct {
+		model      string
+		wantImages int
+		wantNote   bool
+	}{
+		{"gpt-4o", 1, false},
+		{"deepseek-chat", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.model, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "report.png")
+			f, _ := os.Create(path)
+			png.Encode(f, image.NewGray(image.Rect(0, 0, 40, 20)))
+			f.Close()
+			// As the channels do: the copy outlives the channel's download
+			media, _ := utils.KeepMedia([]string{path}, utils.MediaLimits{})
+			if media[0] == path {
+				t.Fatal("KeepMedia did not copy the image")
+			}
+
+			provider := &imageRecordingProvider{model: tt.model}
+			cfg := &config.Config{
+				Agents: config.AgentsConfig{
+					Defaults: config.AgentDefaults{
+						Workspace:         t.TempDir(),
+						Model:             tt.model,
+						MaxTokens:         4096,
+						MaxToolIterations: 5,
+					},
+				},
+			}
+			al := NewAgentLoop(cfg, bus.NewMessageBus(), provider)
+			defer al.Stop()
+
+			_, err := al.processMessage(context.Background(), bus.InboundMessage{
+				Channel: "telegram", SenderID: "1001", ChatID: "1001",
+				Content: "What does this say? [image: photo]", Media: media,
+			})
+			if err != nil {
+				t.Fatalf("processMessage: %v", err)
+			}
+			if len(provider.last.Images) != tt.wantImages {
+				t.Errorf("sent %d images, want %d", len(provider.last.Images), tt.wantImages)
+			}
+			if got := strings.Contains(provider.last.Content, "cannot see"); got != tt.wantNote {
+				t.Errorf("message = %q", provider.last.Content)
+			}
+			if _, err := os.Stat(media[0]); !os.IsNotExist(err) {
+				t.Errorf("kept copy %s was not removed", media[0])
+			}
+		})
+	}
+}
+
+// overflowingProvider fails its first call with a context window error and
+// keeps the images of the messages it is sent after that.
+type overflowingProvider struct {
+	calls  int
+	images int
+}
+
+func (p *overflowingProvider) Chat(ctx context.Context, messages []providers.Message, defs []providers.ToolDefinition, model string, opts map[string]interface{}) (*providers.LLMResponse, error) {
+	p.calls++
+	if p.calls == 1 {
+		return nil, fmt.Errorf("maximum context length exceeded")
+	}
+	for _, m := range messages {
+		p.images += len(m.Images)
+	}
+	return &providers.LLMResponse{Content: "Your CA19-9 is 37 U/mL."}, nil
+}
+
+func (p *overflowingProvider) GetDefaultModel() string {
+	return "gpt-4o"
+}
+
+func TestProcessMessage_ImagesSurviveContextRetry(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "report.png")
+	f, _ := os.Create(path)
+	png.Encode(f, image.NewGray(image.Rect(0, 0, 40, 20)))
+	f.Close()
+	media, _ := utils.KeepMedia([]string{path}, utils.MediaLimits{})
+
+	provider := &overflowingProvider{}
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				Model:             "gpt-4o",
+				MaxTokens:         4096,
+				MaxToolIterations: 5,
+			},
+		},
+	}
+	al := NewAgentLoop(cfg, bus.NewMessageBus(), provider)
+	defer al.Stop()
+
+	_, err := al.processMessage(context.Background(), bus.InboundMessage{
+		Channel: "cli", SenderID: "1001", ChatID: "direct",
+		Content: "What does this say? [image: photo]", Media: media,
+	})
+	if err != nil {
+		t.Fatalf("processMessage: %v", err)
+	}
+	if provider.calls != 2 || provider.images != 1 {
+		t.Errorf("retry after %d calls sent %d images, want 1", provider.calls, provider.images)
+	}
+}
@@ -0,0 +1,129 @@
+package agent
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/rag"
+)
+
+// agentIngester keeps one agent's document index in step with the
+// configured sources.
+type agentIngester struct {
+	agentID  string
+	ingester *rag.Ingester
+}
+
+// setupIngestion creates an ingester for every agent with a document
+// index. Relative source directories are in the agent's workspace.
+// Sources that cannot be set up are logged and skipped.
+func setupIngestion(cfg *config.Config, registry *AgentRegistry) []agentIngester {
+	ragCfg := cfg.Tools.RAG
+	var ingesters []agentIngester
+	for _, agentID := range registry.ListAgentIDs() {
+		agent, ok := registry.GetAgent(agentID)
+		if !ok || agent.Documents == nil {
+			continue
+		}
+		var sources []rag.DocumentSource
+		for _, location := range ragCfg.Sources {
+			var src rag.DocumentSource
+			var err error
+			if strings.HasPrefix(location, "s3://") {
+				src, err = rag.NewS3Source(location, rag.S3Options{
+					Endpoint:        ragCfg.S3.Endpoint,
+					Region:          ragCfg.S3.Region,
+					AccessKeyID:     ragCfg.S3.AccessKeyID,
+					SecretAccessKey: ragCfg.S3.SecretAccessKey,
+				})
+			} else {
+				dir := expandHome(location)
+				if !filepath.IsAbs(dir) {
+					dir = filepath.Join(agent.Workspace, dir)
+				}
+				src, err = rag.NewDirSource(dir)
+			}
+			if err != nil {
+				logger.WarnCF("agent", "Document source skipped",
+					map[string]interface{}{
+						"agent_id": agentID,
+						"source":   location,
+						"error":    err.Error(),
+					})
+				continue
+			}
+			sources = append(sources, src)
+		}
+		if len(sources) == 0 {
+			continue
+		}
+		ingesters = append(ingesters, agentIngester{
+			agentID: agentID,
+			ingester: rag.NewIngester(agent.Documents, sources, rag.IngestOptions{
+				ChunkChars:   ragCfg.ChunkChars,
+				ChunkOverlap: ragCfg.ChunkOverlap,
+				MaxFileBytes: int64(ragCfg.MaxPDFMB) << 20,
+			}),
+		})
+	}
+	return ingesters
+}
+
+// startIngestion syncs the document sources in the background now, then
+// every tools.rag.sync_minutes until ctx is done.
+func (al *AgentLoop) startIngestion(ctx context.Context) {
+	interval := time.Duration(al.cfg.Tools.RAG.SyncMinutes) * time.Minute
+	for _, ing := range al.ingesters {
+		go func(ing agentIngester) {
+			ing.sync(ctx)
+			if interval <= 0 {
+				return
+			}
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+					ing.sync(ctx)
+				}
+			}
+		}(ing)
+	}
+}
+
+func (ing agentIngester) sync(ctx context.Context) {
+	stats, err := ing.ingester.Sync(ctx)
+	if err != nil && ctx.Err() != nil {
+		return
+	}
+	if err != nil {
+		logger.WarnCF("agent", "Document sources not fully synced",
+			map[string]interface{}{
+				"agent_id": ing.agentID,
+				"error":    err.Error(),
+			})
+	}
+	for location, reason := range stats.Failed {
+		logger.WarnCF("agent", "Document not indexed",
+			map[string]interface{}{
+				"agent_id": ing.agentID,
+				"source":   location,
+				"error":    reason,
+			})
+	}
+	if stats.Added > 0 || stats.Removed > 0 {
+		logger.InfoCF("agent", "Document sources synced",
+			map[string]interface{}{
+				"agent_id":  ing.agentID,
+				"added":     stats.Added,
+				"removed":   stats.Removed,
+				"unchanged": stats.Unchanged,
+			})
+	}
+}
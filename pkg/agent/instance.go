@@ -6,9 +6,13 @@ import (
 	"strings"
 
 	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/memory"
 	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/rag"
 	"github.com/sipeed/picoclaw/pkg/routing"
 	"github.com/sipeed/picoclaw/pkg/session"
+	"github.com/sipeed/picoclaw/pkg/tokens"
 	"github.com/sipeed/picoclaw/pkg/tools"
 )
 
@@ -29,6 +33,15 @@ type AgentInstance struct {
 	Subagents      *config.SubagentsConfig
 	SkillsFilter   []string
 	Candidates     []providers.FallbackCandidate
+	// ImageCandidates answer messages with images, when an image model is
+	// configured
+	ImageCandidates []providers.FallbackCandidate
+	// Tokens counts tokens as the agent's model does, for compaction
+	Tokens    *tokens.Counter
+	Documents *rag.Store // Document index, when tools.rag is enabled
+	// PathPolicy limits the tools that read files, from tools.files; nil
+	// when it sets no limits
+	PathPolicy *tools.PathPolicy
 }
 
 // NewAgentInstance creates an agent instance from config.
@@ -45,16 +58,32 @@ func NewAgentInstance(
 	fallbacks := resolveAgentFallbacks(agentCfg, defaults)
 
 	restrict := defaults.RestrictToWorkspace
+	var pathPolicy *tools.PathPolicy
+	if cfg != nil {
+		pathPolicy = tools.NewPathPolicy(cfg.Tools.Files)
+	}
+	readFile := tools.NewReadFileTool(workspace, restrict)
+	readFile.SetPathPolicy(pathPolicy)
+	writeFile := tools.NewWriteFileTool(workspace, restrict)
+	writeFile.SetPathPolicy(pathPolicy)
+	listDir := tools.NewListDirTool(workspace, restrict)
+	listDir.SetPathPolicy(pathPolicy)
+	editFile := tools.NewEditFileTool(workspace, restrict)
+	editFile.SetPathPolicy(pathPolicy)
+	appendFile := tools.NewAppendFileTool(workspace, restrict)
+	appendFile.SetPathPolicy(pathPolicy)
+	execTool := tools.NewExecToolWithConfig(workspace, restrict, cfg)
+	execTool.SetPathPolicy(pathPolicy)
+
 	toolsRegistry := tools.NewToolRegistry()
-	toolsRegistry.Register(tools.NewReadFileTool(workspace, restrict))
-	toolsRegistry.Register(tools.NewWriteFileTool(workspace, restrict))
-	toolsRegistry.Register(tools.NewListDirTool(workspace, restrict))
-	toolsRegistry.Register(tools.NewExecToolWithConfig(workspace, restrict, cfg))
-	toolsRegistry.Register(tools.NewEditFileTool(workspace, restrict))
-	toolsRegistry.Register(tools.NewAppendFileTool(workspace, restrict))
+	toolsRegistry.Register(readFile)
+	toolsRegistry.Register(writeFile)
+	toolsRegistry.Register(listDir)
+	toolsRegistry.Register(execTool)
+	toolsRegistry.Register(editFile)
+	toolsRegistry.Register(appendFile)
 
-	sessionsDir := filepath.Join(workspace, "sessions")
-	sessionsManager := session.NewSessionManager(sessionsDir)
+	sessionsManager := newSessionManager(cfg, filepath.Join(workspace, "sessions"))
 
 	contextBuilder := NewContextBuilder(workspace)
 	contextBuilder.SetToolsRegistry(toolsRegistry)
@@ -82,22 +111,40 @@ func NewAgentInstance(
 		Fallbacks: fallbacks,
 	}
 	candidates := providers.ResolveCandidates(modelCfg, defaults.Provider)
+	var imageCandidates []providers.FallbackCandidate
+	if defaults.ImageModel != "" {
+		imageCandidates = providers.ResolveCandidates(providers.ModelConfig{
+			Primary:   defaults.ImageModel,
+			Fallbacks: defaults.ImageModelFallbacks,
+		}, defaults.Provider)
+	}
+
+	contextWindow := defaults.ContextWindow
+	if contextWindow <= 0 {
+		contextWindow = providers.ContextWindow(model)
+	}
+	if contextWindow <= 0 {
+		contextWindow = defaults.MaxTokens
+	}
 
 	return &AgentInstance{
-		ID:             agentID,
-		Name:           agentName,
-		Model:          model,
-		Fallbacks:      fallbacks,
-		Workspace:      workspace,
-		MaxIterations:  maxIter,
-		ContextWindow:  defaults.MaxTokens,
-		Provider:       provider,
-		Sessions:       sessionsManager,
-		ContextBuilder: contextBuilder,
-		Tools:          toolsRegistry,
-		Subagents:      subagents,
-		SkillsFilter:   skillsFilter,
-		Candidates:     candidates,
+		ID:              agentID,
+		Name:            agentName,
+		Model:           model,
+		Fallbacks:       fallbacks,
+		Workspace:       workspace,
+		MaxIterations:   maxIter,
+		ContextWindow:   contextWindow,
+		Provider:        provider,
+		Sessions:        sessionsManager,
+		ContextBuilder:  contextBuilder,
+		Tools:           toolsRegistry,
+		Subagents:       subagents,
+		SkillsFilter:    skillsFilter,
+		Candidates:      candidates,
+		ImageCandidates: imageCandidates,
+		Tokens:          tokens.ForModel(model),
+		PathPolicy:      pathPolicy,
 	}
 }
 
@@ -143,3 +190,35 @@ func expandHome(path string) string {
 	}
 	return path
 }
+
+// newSessionManager restores the agent's sessions from the configured
+// store. The SQLite store takes over the JSON session files the first time
+// it is used; if it cannot be opened, sessions stay in JSON files.
+func newSessionManager(cfg *config.Config, dir string) *session.SessionManager {
+	if cfg == nil || cfg.Session.Store != "sqlite" {
+		return session.NewSessionManager(dir)
+	}
+	path := filepath.Join(dir, "sessions.db")
+	store, err := memory.OpenSQLite(path)
+	if err == nil {
+		var imported int
+		if imported, err = store.Import(session.NewFileStore(dir)); err == nil || os.IsNotExist(err) {
+			if imported > 0 {
+				logger.InfoCF("agent", "Imported JSON sessions into SQLite", map[string]interface{}{
+					"sessions": imported,
+					"path":     path,
+				})
+			}
+			var sm *session.SessionManager
+			if sm, err = session.NewSessionManagerWithStore(store); err == nil {
+				return sm
+			}
+		}
+		store.Close()
+	}
+	logger.WarnCF("agent", "SQLite session store unavailable, using JSON files", map[string]interface{}{
+		"path":  path,
+		"error": err.Error(),
+	})
+	return session.NewSessionManager(dir)
+}
@@ -0,0 +1,348 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/guardrails"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/profile"
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/session"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+const (
+	intakeTimeout   = 20 * time.Second
+	intakeMaxRounds = 2
+	// intakeExpiry ends intakes the user never came back to.
+	intakeExpiry = 24 * time.Hour
+	// unknownField is recorded for details the user does not know or
+	// would rather not give, so they are not asked again.
+	unknownField = "unknown"
+)
+
+// defaultIntakeFlows are used when intake is enabled without a list of flows.
+var defaultIntakeFlows = []config.IntakeFlowConfig{
+	{
+		ID:          "treatment",
+		Description: "Asks which treatment, therapy, drug or next step the patient should have, or whether a treatment fits them",
+		Triggers: []string{"treat", "therapy", "chemo", "surgery", "radiation", "what should", "options", "next step",
+			"治疗", "方案", "化疗", "手术", "放疗", "怎么治", "用什么药", "下一步"},
+		Fields: []config.IntakeFieldConfig{
+			{
+				Name:        "diagnosis",
+				Description: "The cancer type and where it is, e.g. pancreatic ductal adenocarcinoma of the head",
+				Question:    "What is the diagnosis, as written in the pathology or discharge report?",
+				QuestionZH:  "确诊的是什么病？请按病理报告或出院小结上的写法告诉我。",
+			},
+			{
+				Name:        "stage",
+				Description: "The stage, or whether it is resectable, borderline, locally advanced or metastatic",
+				Question:    "What stage is it, or did the doctors say whether it can be operated on?",
+				QuestionZH:  "目前是什么分期？或者医生是否说过能不能手术？",
+			},
+			{
+				Name:        "prior_treatment",
+				Description: "Treatment so far: surgery, chemotherapy regimens and cycles, radiotherapy, or none",
+				Question:    "What treatment has there been so far, such as surgery or chemotherapy (which regimen and how many cycles)?",
+				QuestionZH:  "到目前为止做过哪些治疗？比如手术、化疗（什么方案、几个周期）。",
+			},
+		},
+	},
+}
+
+// intakeFlows returns the configured intake flows, or the built-in ones.
+func (al *AgentLoop) intakeFlows() []config.IntakeFlowConfig {
+	if len(al.cfg.Agents.Intake.Flows) > 0 {
+		return al.cfg.Agents.Intake.Flows
+	}
+	return defaultIntakeFlows
+}
+
+// runIntake collects the details a question needs before it is answered.
+// It returns the reply to send and true while it is asking for them; the
+// user's message and the reply are then already in the session. When the
+// details are complete it returns false and adds them to opts, so the turn
+// answers the original question. Messages with safety findings skip intake.
+func (al *AgentLoop) runIntake(ctx context.Context, agent *AgentInstance, opts *processOptions) (string, bool) {
+	if !al.cfg.Agents.Intake.Enabled {
+		return "", false
+	}
+	if al.guardrails != nil && len(al.guardrails.CheckInbound(guardrails.Input{Message: opts.UserMessage}).Findings) > 0 {
+		agent.Sessions.SetIntake(opts.SessionKey, nil)
+		return "", false
+	}
+
+	state := agent.Sessions.Intake(opts.SessionKey)
+	if state != nil && time.Since(state.Started) > intakeExpiry {
+		state = nil
+	}
+	var flow config.IntakeFlowConfig
+	if state != nil {
+		var ok bool
+		if flow, ok = findIntakeFlow(al.intakeFlows(), state.Flow); !ok {
+			state = nil
+		}
+	}
+
+	if state == nil {
+		candidates := triggeredFlows(al.intakeFlows(), opts.UserMessage)
+		if len(candidates) == 0 {
+			return "", false
+		}
+		reply, err := al.callIntakeModel(ctx, agent, opts, detectPrompt(candidates, agent.Sessions.GetHistory(opts.SessionKey),
+			profileFacts(agent, opts.UserID), opts.UserMessage))
+		if err != nil {
+			return "", false
+		}
+		var ok bool
+		if flow, ok = findIntakeFlow(candidates, reply.Flow); !ok {
+			return "", false
+		}
+		state = &session.IntakeState{Flow: flow.ID, Question: opts.UserMessage, Fields: map[string]string{}, Started: time.Now()}
+		mergeIntakeFields(state, flow, reply.Fields)
+	} else {
+		reply, err := al.callIntakeModel(ctx, agent, opts, answerPrompt(flow, state, opts.UserMessage))
+		if err != nil {
+			// Answer with what has been collected rather than asking again
+			state.Rounds = al.intakeRounds()
+		} else if reply.OffTopic {
+			logger.InfoCF("agent", "Intake abandoned, user moved on",
+				map[string]interface{}{"session_key": opts.SessionKey, "flow": flow.ID})
+			agent.Sessions.SetIntake(opts.SessionKey, nil)
+			return "", false
+		} else {
+			mergeIntakeFields(state, flow, reply.Fields)
+		}
+	}
+
+	missing := missingFields(flow, state)
+	if len(missing) == 0 || state.Rounds >= al.intakeRounds() {
+		if state.Rounds > 0 {
+			opts.Instructions = append(opts.Instructions, intakeInstruction(flow, state))
+			logger.InfoCF("agent", "Intake complete",
+				map[string]interface{}{"session_key": opts.SessionKey, "flow": flow.ID, "rounds": state.Rounds})
+		}
+		agent.Sessions.SetIntake(opts.SessionKey, nil)
+		return "", false
+	}
+
+	state.Rounds++
+	chinese := prefersChinese(processOptions{Language: opts.Language, UserMessage: state.Question})
+	question := intakeQuestion(missing, chinese)
+	agent.Sessions.AddMessage(opts.SessionKey, "user", opts.UserMessage)
+	agent.Sessions.AddMessage(opts.SessionKey, "assistant", question)
+	agent.Sessions.SetOrigin(opts.SessionKey, opts.Channel, opts.UserID)
+	agent.Sessions.SetIntake(opts.SessionKey, state)
+	agent.Sessions.Save(opts.SessionKey)
+	logger.InfoCF("agent", "Intake asking for details",
+		map[string]interface{}{
+			"session_key": opts.SessionKey,
+			"flow":        flow.ID,
+			"round":       state.Rounds,
+			"missing":     len(missing),
+		})
+	return question, true
+}
+
+// intakeRounds returns how many times the user may be asked for details.
+func (al *AgentLoop) intakeRounds() int {
+	if al.cfg.Agents.Intake.MaxRounds > 0 {
+		return al.cfg.Agents.Intake.MaxRounds
+	}
+	return intakeMaxRounds
+}
+
+type intakeReply struct {
+	Flow     string            `json:"flow"`
+	Fields   map[string]string `json:"fields"`
+	OffTopic bool              `json:"off_topic"`
+}
+
+func (al *AgentLoop) callIntakeModel(ctx context.Context, agent *AgentInstance, opts *processOptions, prompt string) (intakeReply, error) {
+	model := al.cfg.Agents.Intake.Model
+	if model == "" {
+		model = agent.Model
+	}
+	ctx, cancel := context.WithTimeout(ctx, intakeTimeout)
+	defer cancel()
+	response, err := agent.Provider.Chat(ctx, []providers.Message{
+		{Role: "user", Content: prompt},
+	}, nil, model, map[string]interface{}{
+		"max_tokens":  400,
+		"temperature": 0.0,
+	})
+	var reply intakeReply
+	if err == nil {
+		content := response.Content
+		start, end := strings.Index(content, "{"), strings.LastIndex(content, "}")
+		if start < 0 || end < start {
+			err = fmt.Errorf("no JSON object in %q", utils.Truncate(content, 100))
+		} else {
+			err = json.Unmarshal([]byte(content[start:end+1]), &reply)
+		}
+	}
+	if err != nil {
+		logger.WarnCF("agent", "Intake model call failed, answering without intake",
+			map[string]interface{}{
+				"session_key": opts.SessionKey,
+				"error":       err.Error(),
+			})
+	}
+	return reply, err
+}
+
+// profileFacts returns the confirmed facts of the user's profile.
+func profileFacts(agent *AgentInstance, userID string) []string {
+	store := agent.ContextBuilder.profiles
+	user := profile.UserKey(userID)
+	if store == nil || user == "" {
+		return nil
+	}
+	p, err := store.Get(user)
+	if err != nil || p == nil {
+		return nil
+	}
+	return p.Lines()
+}
+
+// triggeredFlows returns the flows a message may belong to: those with a
+// trigger in the message, and those without triggers.
+func triggeredFlows(flows []config.IntakeFlowConfig, message string) []config.IntakeFlowConfig {
+	lower := strings.ToLower(message)
+	var out []config.IntakeFlowConfig
+	for _, f := range flows {
+		if len(f.Triggers) == 0 {
+			out = append(out, f)
+			continue
+		}
+		for _, t := range f.Triggers {
+			if strings.Contains(lower, strings.ToLower(t)) {
+				out = append(out, f)
+				break
+			}
+		}
+	}
+	return out
+}
+
+func findIntakeFlow(flows []config.IntakeFlowConfig, id string) (config.IntakeFlowConfig, bool) {
+	id = strings.TrimSpace(id)
+	for _, f := range flows {
+		if strings.EqualFold(f.ID, id) {
+			return f, true
+		}
+	}
+	return config.IntakeFlowConfig{}, false
+}
+
+// mergeIntakeFields keeps the non-empty values of the flow's fields.
+func mergeIntakeFields(state *session.IntakeState, flow config.IntakeFlowConfig, fields map[string]string) {
+	for _, f := range flow.Fields {
+		if v := strings.TrimSpace(fields[f.Name]); v != "" {
+			state.Fields[f.Name] = v
+		}
+	}
+}
+
+func missingFields(flow config.IntakeFlowConfig, state *session.IntakeState) []config.IntakeFieldConfig {
+	var missing []config.IntakeFieldConfig
+	for _, f := range flow.Fields {
+		if state.Fields[f.Name] == "" {
+			missing = append(missing, f)
+		}
+	}
+	return missing
+}
+
+func describeFields(sb *strings.Builder, fields []config.IntakeFieldConfig) {
+	for _, f := range fields {
+		if f.Description != "" {
+			fmt.Fprintf(sb, "- %s: %s\n", f.Name, f.Description)
+		} else {
+			fmt.Fprintf(sb, "- %s: %s\n", f.Name, f.Question)
+		}
+	}
+}
+
+func detectPrompt(flows []config.IntakeFlowConfig, history []providers.Message, facts []string, message string) string {
+	var sb strings.Builder
+	sb.WriteString("Decide whether the user's latest message is one of these kinds of question, and which details it depends on are already known.\n\nKinds:\n")
+	for _, f := range flows {
+		fmt.Fprintf(&sb, "\n%s: %s\nDetails:\n", f.ID, f.Description)
+		describeFields(&sb, f.Fields)
+	}
+	if len(facts) > 0 {
+		sb.WriteString("\nConfirmed facts about the user:\n- " + strings.Join(facts, "\n- ") + "\n")
+	}
+	var recent []string
+	for i := len(history) - 1; i >= 0 && len(recent) < routerContextMessages; i-- {
+		m := history[i]
+		if (m.Role == "user" || m.Role == "assistant") && len(m.ToolCalls) == 0 && m.Content != "" {
+			recent = append([]string{m.Role + ": " + utils.Truncate(m.Content, 300)}, recent...)
+		}
+	}
+	if len(recent) > 0 {
+		sb.WriteString("\nRecent conversation:\n" + strings.Join(recent, "\n") + "\n")
+	}
+	fmt.Fprintf(&sb, "\nLatest message:\n%s\n\n", message)
+	sb.WriteString(`Reply with JSON only: {"flow":"<kind id, or none>","fields":{"<detail name>":"<value the user has given, or empty>"}}. `)
+	sb.WriteString("Only fill details the user has stated or the facts above give; never guess.")
+	return sb.String()
+}
+
+func answerPrompt(flow config.IntakeFlowConfig, state *session.IntakeState, message string) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "The user asked: %s\n\nTo answer, we asked them for these details:\n", state.Question)
+	describeFields(&sb, missingFields(flow, state))
+	fmt.Fprintf(&sb, "\nTheir reply:\n%s\n\n", message)
+	sb.WriteString(`Reply with JSON only: {"fields":{"<detail name>":"<value from the reply, or empty>"},"off_topic":false}. `)
+	sb.WriteString(`Use "` + unknownField + `" for a detail the user says they do not know or would rather not give. `)
+	sb.WriteString(`Set "off_topic" to true only if the reply does not answer and asks about something else.`)
+	return sb.String()
+}
+
+func intakeQuestion(missing []config.IntakeFieldConfig, chinese bool) string {
+	header := "To give you an answer that fits your situation, I need a few details:"
+	if chinese {
+		header = "为了给出更贴合您情况的回答，我需要先了解几点："
+	}
+	questions := make([]string, len(missing))
+	for i, f := range missing {
+		q := f.Question
+		if chinese && f.QuestionZH != "" {
+			q = f.QuestionZH
+		}
+		questions[i] = q
+	}
+	if len(questions) == 1 {
+		return header + "\n" + questions[0]
+	}
+	var sb strings.Builder
+	sb.WriteString(header)
+	for i, q := range questions {
+		fmt.Fprintf(&sb, "\n%d. %s", i+1, q)
+	}
+	return sb.String()
+}
+
+// intakeInstruction tells the turn to answer the question that started
+// the intake with the details collected.
+func intakeInstruction(flow config.IntakeFlowConfig, state *session.IntakeState) string {
+	details := make([]string, 0, len(flow.Fields))
+	for _, f := range flow.Fields {
+		v := state.Fields[f.Name]
+		if v == "" {
+			v = unknownField
+		}
+		details = append(details, f.Name+": "+v)
+	}
+	return fmt.Sprintf("The user's question was: %q. You asked for details first and now have them (%s). "+
+		"Answer that question now, using these details in your searches and your answer, and say which details were unknown.",
+		state.Question, strings.Join(details, "; "))
+}
@@ -0,0 +1,104 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+// intakeProvider answers intake prompts with detect and answer, and other
+// calls with "ok", keeping the system prompt of the last answer call.
+type intakeProvider struct {
+	detect  string
+	answer  string
+	detects int
+	system  string
+}
+
+func (p *intakeProvider) Chat(ctx context.Context, messages []providers.Message, defs []providers.ToolDefinition, model string, opts map[string]interface{}) (*providers.LLMResponse, error) {
+	switch {
+	case strings.HasPrefix(messages[0].Content, "Decide whether"):
+		p.detects++
+		return &providers.LLMResponse{Content: p.detect}, nil
+	case strings.HasPrefix(messages[0].Content, "The user asked:"):
+		return &providers.LLMResponse{Content: p.answer}, nil
+	}
+	p.system = systemText(messages)
+	return &providers.LLMResponse{Content: "ok"}, nil
+}
+
+func (p *intakeProvider) GetDefaultModel() string {
+	return "test-model"
+}
+
+func TestIntake(t *testing.T) {
+	provider := &intakeProvider{}
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				Model:             "test-model",
+				MaxTokens:         4096,
+				MaxToolIterations: 5,
+			},
+			Intake: config.IntakeConfig{Enabled: true},
+		},
+	}
+	al := NewAgentLoop(cfg, bus.NewMessageBus(), provider)
+	agent := al.registry.GetDefaultAgent()
+	send := func(chatID, content string) string {
+		t.Helper()
+		reply, err := al.processMessage(context.Background(), bus.InboundMessage{
+			Channel: "telegram", SenderID: chatID, ChatID: chatID, Content: content,
+		})
+		if err != nil {
+			t.Fatalf("processMessage: %v", err)
+		}
+		return reply
+	}
+
+	// Small talk does not reach the intake model.
+	if reply := send("1", "Thanks, that helped"); reply != "ok" || provider.detects != 0 {
+		t.Fatalf("small talk: reply %q, %d detect calls", reply, provider.detects)
+	}
+
+	provider.detect = `{"flow":"treatment","fields":{"diagnosis":"pancreatic cancer","stage":""}}`
+	provider.system = ""
+	reply := send("1", "What treatment should my father get next?")
+	if !strings.Contains(reply, "1. What stage is it") || !strings.Contains(reply, "2. What treatment has there been") ||
+		strings.Contains(reply, "diagnosis") || provider.system != "" {
+		t.Fatalf("first reply = %q", reply)
+	}
+
+	provider.answer = `{"fields":{"stage":"locally advanced","prior_treatment":"unknown"},"off_topic":false}`
+	if reply := send("1", "Locally advanced, I'm not sure what he's had"); reply != "ok" {
+		t.Fatalf("answer after intake = %q", reply)
+	}
+	if !strings.Contains(provider.system, `The user's question was: "What treatment should my father get next?"`) ||
+		!strings.Contains(provider.system, "diagnosis: pancreatic cancer; stage: locally advanced; prior_treatment: unknown") {
+		t.Errorf("system prompt lacks the intake:\n%s", provider.system)
+	}
+	_, sessionKey, _ := al.resolveSession(bus.InboundMessage{Channel: "telegram", SenderID: "1", ChatID: "1"})
+	history := agent.Sessions.GetHistory(sessionKey)
+	if len(history) != 6 || history[3].Content != reply || agent.Sessions.Intake(sessionKey) != nil {
+		t.Errorf("history = %+v", history)
+	}
+
+	// Replies about something else end the intake.
+	provider.system = ""
+	send("2", "What treatment options are there?")
+	provider.answer = `{"fields":{},"off_topic":true}`
+	if reply := send("2", "When is the hospital open on Sunday?"); reply != "ok" || strings.Contains(provider.system, "question was") {
+		t.Errorf("off-topic reply %q, system:\n%s", reply, provider.system)
+	}
+
+	// Questions are asked in the user's language.
+	provider.detect = `{"flow":"treatment","fields":{"diagnosis":"胰腺癌","stage":"IV期"}}`
+	if reply := send("3", "胰腺癌IV期，下一步该怎么治？"); reply != "为了给出更贴合您情况的回答，我需要先了解几点：\n到目前为止做过哪些治疗？比如手术、化疗（什么方案、几个周期）。" {
+		t.Errorf("Chinese reply = %q", reply)
+	}
+}
@@ -0,0 +1,126 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// errTurnStopped is returned for a turn cancelled by /stop or by a newer
+// message; such turns send nothing.
+var errTurnStopped = errors.New("turn stopped")
+
+// stoppedNote replaces the unfinished answer in the session, so the model
+// knows the question went unanswered.
+const stoppedNote = "(Stopped by the user before an answer was given.)"
+
+// inflightTurn is the turn being answered, so /stop and newer messages
+// from the same chat can cancel it.
+type inflightTurn struct {
+	sessionKey string
+	senderID   string
+	cancel     context.CancelFunc
+	stopped    bool
+}
+
+// isStopCommand reports whether content is /stop, including Telegram's
+// /stop@botname form.
+func isStopCommand(content string) bool {
+	fields := strings.Fields(content)
+	if len(fields) != 1 {
+		return false
+	}
+	cmd, _, _ := strings.Cut(strings.ToLower(fields[0]), "@")
+	return cmd == "/stop"
+}
+
+// turnKey returns the main session key of the chat msg belongs to, or ""
+// for system messages, which are never interrupted.
+func (al *AgentLoop) turnKey(msg bus.InboundMessage) string {
+	if msg.Channel == "system" {
+		return ""
+	}
+	_, key, _ := al.resolveSession(msg)
+	return key
+}
+
+// beginTurn makes msg the in-flight turn and returns its context, and a
+// function that ends the turn and reports whether it was stopped.
+func (al *AgentLoop) beginTurn(ctx context.Context, msg bus.InboundMessage) (context.Context, func() bool) {
+	turnCtx, cancel := context.WithCancel(ctx)
+	turn := &inflightTurn{sessionKey: al.turnKey(msg), senderID: msg.SenderID, cancel: cancel}
+	al.turnMu.Lock()
+	al.inflight = turn
+	al.turnMu.Unlock()
+	return turnCtx, func() bool {
+		al.turnMu.Lock()
+		defer al.turnMu.Unlock()
+		if al.inflight == turn {
+			al.inflight = nil
+		}
+		cancel()
+		return turn.stopped
+	}
+}
+
+// stopTurn cancels the in-flight turn of the chat with sessionKey, if it
+// was started by senderID or senderID is empty, and reports whether it did.
+func (al *AgentLoop) stopTurn(sessionKey, senderID string) bool {
+	if sessionKey == "" {
+		return false
+	}
+	al.turnMu.Lock()
+	defer al.turnMu.Unlock()
+	turn := al.inflight
+	if turn == nil || turn.stopped || turn.sessionKey != sessionKey || (senderID != "" && turn.senderID != senderID) {
+		return false
+	}
+	turn.stopped = true
+	turn.cancel()
+	return true
+}
+
+// interrupt handles /stop, and stops the sender's in-flight turn when a
+// newer message of theirs arrives. It reports whether msg was consumed.
+func (al *AgentLoop) interrupt(msg bus.InboundMessage) bool {
+	if isStopCommand(msg.Content) {
+		reply := "Nothing to stop."
+		if al.stopTurn(al.turnKey(msg), "") {
+			reply = "Stopped."
+		}
+		al.bus.PublishOutbound(bus.OutboundMessage{Channel: msg.Channel, ChatID: msg.ChatID, Content: reply})
+		return true
+	}
+	if al.cfg.Agents.Defaults.InterruptOnMessage && al.stopTurn(al.turnKey(msg), msg.SenderID) {
+		logger.InfoCF("agent", "New message interrupted the unfinished answer",
+			map[string]interface{}{
+				"channel":   msg.Channel,
+				"chat_id":   msg.ChatID,
+				"sender_id": msg.SenderID,
+			})
+	}
+	return false
+}
+
+// stopped ends a cancelled turn: the partial tool calls and results after
+// the user's message are dropped and a note takes the answer's place.
+func (al *AgentLoop) stopped(agent *AgentInstance, opts processOptions, start time.Time, keep int) error {
+	history := agent.Sessions.GetHistory(opts.SessionKey)
+	if len(history) > keep {
+		agent.Sessions.SetHistory(opts.SessionKey, history[:keep])
+	}
+	agent.Sessions.AddMessage(opts.SessionKey, "assistant", stoppedNote)
+	agent.Sessions.Save(opts.SessionKey)
+	al.recordTurn(agent, opts, start, "", errTurnStopped)
+	logger.InfoCF("agent", "Turn stopped",
+		map[string]interface{}{
+			"agent_id":    agent.ID,
+			"session_key": opts.SessionKey,
+			"turn_id":     opts.TurnID,
+		})
+	return errTurnStopped
+}
@@ -0,0 +1,124 @@
+package agent
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+// slowProvider blocks on the slow questions until their context is
+// cancelled, and answers others at once.
+type slowProvider struct {
+	started chan string
+}
+
+func (p *slowProvider) Chat(ctx context.Context, messages []providers.Message, defs []providers.ToolDefinition, model string, opts map[string]interface{}) (*providers.LLMResponse, error) {
+	question := messages[len(messages)-1].Content
+	if question == "slow question" || question == "another slow one" {
+		p.started <- question
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	return &providers.LLMResponse{Content: "answer to " + question}, nil
+}
+
+func (p *slowProvider) GetDefaultModel() string {
+	return "test-model"
+}
+
+func TestInterrupt(t *testing.T) {
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:          t.TempDir(),
+				Model:              "test-model",
+				MaxTokens:          4096,
+				MaxToolIterations:  5,
+				InterruptOnMessage: true,
+			},
+		},
+	}
+	provider := &slowProvider{started: make(chan string, 1)}
+	msgBus := bus.NewMessageBus()
+	al := NewAgentLoop(cfg, msgBus, provider)
+	agent := al.registry.GetDefaultAgent()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go al.Run(ctx)
+
+	send := func(sender, content string) {
+		msgBus.PublishInbound(bus.InboundMessage{Channel: "telegram", SenderID: sender, ChatID: "chat", Content: content})
+	}
+	next := func() string {
+		t.Helper()
+		waitCtx, done := context.WithTimeout(ctx, 5*time.Second)
+		defer done()
+		out, ok := msgBus.SubscribeOutbound(waitCtx)
+		if !ok {
+			t.Fatal("no outbound message")
+		}
+		return out.Content
+	}
+	waitStarted := func(want string) {
+		t.Helper()
+		select {
+		case got := <-provider.started:
+			if got != want {
+				t.Fatalf("started %q, want %q", got, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%q never reached the provider", want)
+		}
+	}
+
+	send("u1", "/stop")
+	if got := next(); got != "Nothing to stop." {
+		t.Fatalf("idle /stop: %q", got)
+	}
+
+	send("u1", "slow question")
+	waitStarted("slow question")
+	send("u1", "/stop@picoclaw_bot")
+	if got := next(); got != "Stopped." {
+		t.Fatalf("/stop: %q", got)
+	}
+
+	// A newer message from the same sender replaces the unfinished answer.
+	send("u1", "another slow one")
+	waitStarted("another slow one")
+	send("u1", "quick one")
+	if got := next(); got != "answer to quick one" {
+		t.Fatalf("after interruption: %q", got)
+	}
+
+	history := agent.Sessions.GetHistory("agent:main:main")
+	want := []string{"slow question", stoppedNote, "another slow one", stoppedNote, "quick one", "answer to quick one"}
+	if len(history) != len(want) {
+		t.Fatalf("history = %+v", history)
+	}
+	for i, m := range history {
+		if m.Content != want[i] {
+			t.Fatalf("history[%d] = %q, want %q", i, m.Content, want[i])
+		}
+	}
+}
+
+func TestInterrupt_OtherSenderDoesNotInterrupt(t *testing.T) {
+	al := &AgentLoop{cfg: &config.Config{Agents: config.AgentsConfig{Defaults: config.AgentDefaults{InterruptOnMessage: true}}}}
+	cancelled := false
+	al.inflight = &inflightTurn{sessionKey: "chat", senderID: "u1", cancel: func() { cancelled = true }}
+
+	if al.stopTurn("chat", "u2") || cancelled {
+		t.Fatal("another member's message stopped the answer")
+	}
+	if al.stopTurn("other", "") || cancelled {
+		t.Fatal("another chat's /stop stopped the answer")
+	}
+	if !al.stopTurn("chat", "") || !cancelled || al.stopTurn("chat", "") {
+		t.Fatal("/stop did not stop the answer exactly once")
+	}
+}
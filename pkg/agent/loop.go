@@ -8,24 +8,45 @@ package agent
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
-	"unicode/utf8"
 
+	"github.com/sipeed/picoclaw/pkg/audit"
 	"github.com/sipeed/picoclaw/pkg/bus"
 	"github.com/sipeed/picoclaw/pkg/channels"
 	"github.com/sipeed/picoclaw/pkg/config"
 	"github.com/sipeed/picoclaw/pkg/constants"
+	"github.com/sipeed/picoclaw/pkg/cron"
+	"github.com/sipeed/picoclaw/pkg/feedback"
+	"github.com/sipeed/picoclaw/pkg/guardrails"
+	"github.com/sipeed/picoclaw/pkg/hooks"
 	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/ocr"
+	"github.com/sipeed/picoclaw/pkg/persona"
+	"github.com/sipeed/picoclaw/pkg/profile"
 	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/rag"
 	"github.com/sipeed/picoclaw/pkg/routing"
+	"github.com/sipeed/picoclaw/pkg/scheduler"
+	"github.com/sipeed/picoclaw/pkg/semcache"
+	"github.com/sipeed/picoclaw/pkg/shadow"
 	"github.com/sipeed/picoclaw/pkg/state"
+	"github.com/sipeed/picoclaw/pkg/tokens"
 	"github.com/sipeed/picoclaw/pkg/tools"
+	"github.com/sipeed/picoclaw/pkg/tools/mcp"
+	"github.com/sipeed/picoclaw/pkg/tools/plugin"
+	"github.com/sipeed/picoclaw/pkg/usage"
 	"github.com/sipeed/picoclaw/pkg/utils"
+	"github.com/sipeed/picoclaw/pkg/voice"
 )
 
 type AgentLoop struct {
@@ -37,18 +58,47 @@ type AgentLoop struct {
 	summarizing    sync.Map
 	fallback       *providers.FallbackChain
 	channelManager *channels.Manager
+	approvals      *tools.ApprovalManager
+	audit          *audit.Store
+	mcp            *mcp.Manager
+	plugins        *plugin.Manager
+	shadows        *shadow.Runner
+	guardrails     *guardrails.Pipeline
+	hooks          *hooks.Manager
+	usage          *usage.Tracker
+	answers        *semcache.Cache
+	feedback       *feedback.Store
+	ingesters      []agentIngester
+	lastTurns      sync.Map // session key -> turn ID of its latest answer, for feedback
+	turnMu         sync.Mutex
+	inflight       *inflightTurn
+	activeForks    sync.Map // main session key -> fork session key the chat is using
+	fallbackLLMs   sync.Map // "provider/model" -> LLMProvider of a fallback candidate
 }
 
 // processOptions configures how a message is processed
 type processOptions struct {
-	SessionKey      string // Session identifier for history/context
-	Channel         string // Target channel for tool execution
-	ChatID          string // Target chat ID for tool execution
-	UserMessage     string // User message content (may include prefix)
-	DefaultResponse string // Response when LLM returns empty
-	EnableSummary   bool   // Whether to trigger summarization
-	SendResponse    bool   // Whether to send response via bus
-	NoHistory       bool   // If true, don't load session history (for heartbeat)
+	SessionKey      string                   // Session identifier for history/context
+	UserID          string                   // Sender of the message, recorded in the audit log
+	Language        string                   // User's language tag, when the channel reports one
+	Channel         string                   // Target channel for tool execution
+	ChatID          string                   // Target chat ID for tool execution
+	UserMessage     string                   // User message content (may include prefix)
+	DefaultResponse string                   // Response when LLM returns empty
+	EnableSummary   bool                     // Whether to trigger summarization
+	SendResponse    bool                     // Whether to send response via bus
+	NoHistory       bool                     // If true, don't load session history (for heartbeat)
+	TurnID          string                   // Audit ID for this turn; generated when empty
+	SendProgress    bool                     // Whether to send tool progress updates to the chat
+	Guardrails      bool                     // Whether to apply the safety guardrails to the message and answer
+	Instructions    []string                 // Added to the system prompt for this turn
+	Specialist      string                   // Specialist the orchestrator routed the message to, if any
+	ToolScope       *tools.ToolRolePolicy    // Tools the turn may use; nil allows every tool
+	Model           string                   // Used instead of the agent's models once the user's budget is spent
+	Params          config.ModelParams       // Model and sampling parameters of the channel and persona
+	QuestionVector  []float32                // Embedding of a question the answer cache missed; its answer may be cached
+	Media           []string                 // Attachments of the message: local paths or URLs
+	Images          []providers.ImageContent // Images sent to the model with the message
 }
 
 func NewAgentLoop(cfg *config.Config, msgBus *bus.MessageBus, provider providers.LLMProvider) *AgentLoop {
@@ -57,6 +107,130 @@ func NewAgentLoop(cfg *config.Config, msgBus *bus.MessageBus, provider providers
 	// Register shared tools to all agents
 	registerSharedTools(cfg, msgBus, registry, provider)
 
+	// Import tools from external MCP servers
+	var mcpManager *mcp.Manager
+	if len(cfg.Tools.MCP.Servers) > 0 {
+		mcpManager = setupMCP(cfg, registry)
+	}
+
+	// Wrap external plugin executables as tools
+	var pluginManager *plugin.Manager
+	if len(cfg.Tools.Plugins) > 0 {
+		pluginManager = setupPlugins(cfg, registry)
+	}
+
+	// Combine existing tools into configured pipelines
+	if len(cfg.Tools.Pipelines) > 0 {
+		setupPipelines(cfg, registry)
+	}
+
+	// Reuse results of read-only tools across calls
+	if cfg.Tools.Cache.Enabled {
+		cache := tools.NewCacheMiddleware(tools.CacheOptions{
+			MaxEntries: cfg.Tools.Cache.MaxEntries,
+			TTLs:       cfg.Tools.Cache.TTLs(),
+		})
+		for _, agentID := range registry.ListAgentIDs() {
+			if agent, ok := registry.GetAgent(agentID); ok {
+				agent.Tools.SetCacheMiddleware(cache)
+			}
+		}
+	}
+
+	// Share concurrency limits across every agent and session
+	if limits := cfg.Tools.Concurrency; limits.MaxConcurrent > 0 || len(limits.PerTool) > 0 {
+		limiter := tools.NewConcurrencyLimiter(tools.LimiterOptions{
+			MaxConcurrent: limits.MaxConcurrent,
+			PerTool:       limits.PerTool,
+			QueueTimeout:  time.Duration(limits.QueueTimeoutSeconds) * time.Second,
+		})
+		for _, agentID := range registry.ListAgentIDs() {
+			if agent, ok := registry.GetAgent(agentID); ok {
+				agent.Tools.SetConcurrencyLimiter(limiter)
+			}
+		}
+	}
+
+	// Bound how often each session and user may call costly tools
+	if quotas := cfg.Tools.Quotas; len(quotas.PerSession) > 0 || len(quotas.PerUserDaily) > 0 {
+		quotaManager := tools.NewQuotaManager(tools.QuotaOptions{
+			PerSession:   quotas.PerSession,
+			PerUserDaily: quotas.PerUserDaily,
+			ExemptUsers:  quotas.ExemptUsers,
+			Path:         cfg.QuotaPath(),
+		})
+		for _, agentID := range registry.ListAgentIDs() {
+			if agent, ok := registry.GetAgent(agentID); ok {
+				agent.Tools.SetQuotaManager(quotaManager)
+			}
+		}
+	}
+
+	// Run long batch calls as background jobs the model can poll
+	if cfg.Tools.Jobs.Enabled {
+		jobs := tools.NewJobManager(tools.JobOptions{
+			Timeout:   time.Duration(cfg.Tools.Jobs.TimeoutMinutes) * time.Minute,
+			Retention: time.Duration(cfg.Tools.Jobs.RetentionMinutes) * time.Minute,
+		})
+		for _, agentID := range registry.ListAgentIDs() {
+			if agent, ok := registry.GetAgent(agentID); ok && agent.Tools.HasBackgroundTools() {
+				agent.Tools.SetJobManager(jobs)
+				agent.Tools.Register(tools.NewJobStatusTool(jobs))
+				agent.Tools.Register(tools.NewJobResultTool(jobs))
+			}
+		}
+	}
+
+	// Record every tool call to the audit log when configured
+	var auditStore *audit.Store
+	if cfg.Tools.Audit.Enabled {
+		auditStore = setupAudit(cfg, registry)
+	}
+
+	// Gate sensitive tools behind human approval when configured
+	var approvals *tools.ApprovalManager
+	if cfg.Tools.Approval.Enabled {
+		approvals = setupApprovals(cfg, msgBus, registry)
+	}
+
+	// Compare a candidate model or tools against the live ones
+	var shadowRunner *shadow.Runner
+	if cfg.Tools.Shadow.Enabled {
+		shadowRunner = setupShadow(cfg, registry)
+	}
+
+	// Let extensions and webhooks observe tool calls
+	eventHooks := hooks.FromConfig(cfg.Hooks)
+	for _, agentID := range registry.ListAgentIDs() {
+		if agent, ok := registry.GetAgent(agentID); ok {
+			agent.Tools.AddCallRecorder(toolCallHook{eventHooks})
+		}
+	}
+
+	// Track tokens and cost of every LLM call when configured
+	var usageTracker *usage.Tracker
+	if cfg.Usage.Enabled {
+		usageTracker = setupUsage(cfg)
+	}
+
+	// Reuse answers to near-duplicate questions when configured
+	var answerCache *semcache.Cache
+	if cfg.Tools.AnswerCache.Enabled {
+		answerCache = setupAnswerCache(cfg)
+	}
+
+	// Collect ratings of answers when configured
+	var feedbackStore *feedback.Store
+	if cfg.Feedback.Enabled {
+		feedbackStore = setupFeedback(cfg)
+	}
+
+	// Keep curated document folders indexed when configured
+	var ingesters []agentIngester
+	if cfg.Tools.RAG.Enabled && len(cfg.Tools.RAG.Sources) > 0 {
+		ingesters = setupIngestion(cfg, registry)
+	}
+
 	// Set up shared fallback chain
 	cooldown := providers.NewCooldownTracker()
 	fallbackChain := providers.NewFallbackChain(cooldown)
@@ -75,11 +249,196 @@ func NewAgentLoop(cfg *config.Config, msgBus *bus.MessageBus, provider providers
 		state:       stateManager,
 		summarizing: sync.Map{},
 		fallback:    fallbackChain,
+		approvals:   approvals,
+		audit:       auditStore,
+		mcp:         mcpManager,
+		plugins:     pluginManager,
+		shadows:     shadowRunner,
+		guardrails:  guardrails.FromConfig(cfg.Guardrails, cfg.Tools.Triage.Enabled),
+		hooks:       eventHooks,
+		usage:       usageTracker,
+		answers:     answerCache,
+		feedback:    feedbackStore,
+		ingesters:   ingesters,
+	}
+}
+
+// setupMCP connects to the configured MCP servers and registers their tools
+// for every agent. Unreachable servers are logged and skipped.
+func setupMCP(cfg *config.Config, registry *AgentRegistry) *mcp.Manager {
+	names := make([]string, 0, len(cfg.Tools.MCP.Servers))
+	for name := range cfg.Tools.MCP.Servers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	servers := make([]mcp.ServerConfig, 0, len(names))
+	for _, name := range names {
+		server := cfg.Tools.MCP.Servers[name]
+		if server.Disabled {
+			continue
+		}
+		servers = append(servers, mcp.ServerConfig{
+			Name:    name,
+			Command: server.Command,
+			Args:    server.Args,
+			Env:     server.Env,
+			URL:     server.URL,
+			Headers: server.Headers,
+			Timeout: time.Duration(server.TimeoutSeconds) * time.Second,
+		})
 	}
+
+	manager := mcp.NewManager()
+	mcpTools := manager.Connect(context.Background(), servers)
+	for _, agentID := range registry.ListAgentIDs() {
+		if agent, ok := registry.GetAgent(agentID); ok {
+			for _, tool := range mcpTools {
+				agent.Tools.Register(tool)
+			}
+		}
+	}
+	return manager
+}
+
+// setupPlugins starts the configured tool plugins and registers their tools
+// for every agent. Plugins that fail to start are logged and skipped, and a
+// plugin tool never replaces a built-in tool of the same name.
+func setupPlugins(cfg *config.Config, registry *AgentRegistry) *plugin.Manager {
+	names := make([]string, 0, len(cfg.Tools.Plugins))
+	for name := range cfg.Tools.Plugins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	configs := make([]plugin.Config, 0, len(names))
+	for _, name := range names {
+		p := cfg.Tools.Plugins[name]
+		if p.Disabled {
+			continue
+		}
+		configs = append(configs, plugin.Config{
+			Name:    name,
+			Command: p.Command,
+			Args:    p.Args,
+			Env:     p.Env,
+			Dir:     p.Dir,
+			Timeout: time.Duration(p.TimeoutSeconds) * time.Second,
+		})
+	}
+
+	manager := plugin.NewManager()
+	pluginTools := manager.Load(context.Background(), configs)
+	for _, agentID := range registry.ListAgentIDs() {
+		agent, ok := registry.GetAgent(agentID)
+		if !ok {
+			continue
+		}
+		for _, tool := range pluginTools {
+			if _, exists := agent.Tools.Get(tool.Name()); exists {
+				logger.WarnCF("plugin", "Plugin tool shadows an existing tool, skipping",
+					map[string]interface{}{
+						"agent_id": agentID,
+						"tool":     tool.Name(),
+					})
+				continue
+			}
+			agent.Tools.Register(tool)
+		}
+	}
+	return manager
+}
+
+// setupAudit opens the audit log and attaches it to every agent. A log that
+// cannot be opened disables auditing with an error rather than blocking startup.
+func setupAudit(cfg *config.Config, registry *AgentRegistry) *audit.Store {
+	store, err := audit.NewStore(cfg.AuditPath(), audit.Options{
+		RedactKeys:  cfg.Tools.Audit.RedactKeys,
+		MaxArgChars: cfg.Tools.Audit.MaxArgChars,
+		RecordTurns: cfg.Tools.Audit.RecordTurns,
+	})
+	if err != nil {
+		logger.ErrorCF("agent", "Tool audit log disabled",
+			map[string]interface{}{
+				"path":  cfg.AuditPath(),
+				"error": err.Error(),
+			})
+		return nil
+	}
+
+	for _, agentID := range registry.ListAgentIDs() {
+		if agent, ok := registry.GetAgent(agentID); ok {
+			agent.Tools.SetCallRecorder(store)
+		}
+	}
+	return store
+}
+
+// setupApprovals creates the approval manager and attaches it to every agent.
+// Prompts go to the chat that triggered the tool call; /approve and /deny
+// replies are intercepted on the bus, because the agent loop is blocked
+// waiting for the answer and would never consume them itself.
+func setupApprovals(cfg *config.Config, msgBus *bus.MessageBus, registry *AgentRegistry) *tools.ApprovalManager {
+	approvals := tools.NewApprovalManager(
+		time.Duration(cfg.Tools.Approval.TimeoutMinutes)*time.Minute,
+		cfg.Tools.Approval.RequiredTools(),
+	)
+	approvals.SetNotifier(func(req tools.ApprovalRequest) error {
+		if req.Channel == "" || req.ChatID == "" || constants.IsInternalChannel(req.Channel) {
+			return fmt.Errorf("no approver reachable on channel %q", req.Channel)
+		}
+		msgBus.PublishOutbound(bus.OutboundMessage{
+			Channel: req.Channel,
+			ChatID:  req.ChatID,
+			Content: tools.FormatApprovalPrompt(req),
+			Buttons: []bus.Button{
+				{Label: "✅ Approve", Data: "/approve " + req.ID},
+				{Label: "❌ Deny", Data: "/deny " + req.ID},
+			},
+		})
+		return nil
+	})
+	// Admins in tools.roles may answer requests made for anyone
+	approvals.SetOperator(func(senderID string) bool {
+		return userHasRole(cfg, senderID, AdminRole)
+	})
+	msgBus.AddInboundFilter(func(msg bus.InboundMessage) bool {
+		reply, handled := approvals.HandleCommand(msg.Channel, msg.ChatID, msg.SenderID, msg.Content)
+		if handled {
+			msgBus.PublishOutbound(bus.OutboundMessage{
+				Channel: msg.Channel,
+				ChatID:  msg.ChatID,
+				Content: reply,
+			})
+		}
+		return handled
+	})
+
+	for _, agentID := range registry.ListAgentIDs() {
+		if agent, ok := registry.GetAgent(agentID); ok {
+			agent.Tools.SetApprovalManager(approvals)
+		}
+	}
+	return approvals
 }
 
 // registerSharedTools registers tools that are shared across all agents (web, message, spawn).
 func registerSharedTools(cfg *config.Config, msgBus *bus.MessageBus, registry *AgentRegistry, provider providers.LLMProvider) {
+	var recognizer ocr.Recognizer
+	if cfg.Tools.OCR.Enabled {
+		var err error
+		if recognizer, err = ocr.New(cfg.Tools.OCR); err != nil {
+			logger.WarnCF("agent", "OCR tool disabled", map[string]interface{}{"error": err.Error()})
+		}
+	}
+	var synthesizer voice.Synthesizer
+	if cfg.Tools.TTS.Enabled {
+		var err error
+		if synthesizer, err = voice.NewSynthesizer(cfg.Tools.TTS); err != nil {
+			logger.WarnCF("agent", "Text-to-speech tool disabled", map[string]interface{}{"error": err.Error()})
+		}
+	}
+
 	for _, agentID := range registry.ListAgentIDs() {
 		agent, ok := registry.GetAgent(agentID)
 		if !ok {
@@ -88,9 +447,17 @@ func registerSharedTools(cfg *config.Config, msgBus *bus.MessageBus, registry *A
 
 		// Web tools
 		if searchTool := tools.NewWebSearchTool(tools.WebSearchToolOptions{
+			Backend:              cfg.Tools.Web.Backend,
 			BraveAPIKey:          cfg.Tools.Web.Brave.APIKey,
 			BraveMaxResults:      cfg.Tools.Web.Brave.MaxResults,
 			BraveEnabled:         cfg.Tools.Web.Brave.Enabled,
+			BingAPIKey:           cfg.Tools.Web.Bing.APIKey,
+			BingMarket:           cfg.Tools.Web.Bing.Market,
+			BingMaxResults:       cfg.Tools.Web.Bing.MaxResults,
+			BingEnabled:          cfg.Tools.Web.Bing.Enabled,
+			SearXNGBaseURL:       cfg.Tools.Web.SearXNG.BaseURL,
+			SearXNGMaxResults:    cfg.Tools.Web.SearXNG.MaxResults,
+			SearXNGEnabled:       cfg.Tools.Web.SearXNG.Enabled,
 			DuckDuckGoMaxResults: cfg.Tools.Web.DuckDuckGo.MaxResults,
 			DuckDuckGoEnabled:    cfg.Tools.Web.DuckDuckGo.Enabled,
 			PerplexityAPIKey:     cfg.Tools.Web.Perplexity.APIKey,
@@ -106,18 +473,19 @@ func registerSharedTools(cfg *config.Config, msgBus *bus.MessageBus, registry *A
 		agent.Tools.Register(tools.NewSPITool())
 
 		// KnowS tools
+		knowsOpts := tools.KnowsToolOptions{
+			APIKey:           cfg.Tools.Knows.APIKey,
+			APIBaseURL:       cfg.Tools.Knows.APIBaseURL,
+			DefaultDataScope: cfg.Tools.Knows.DefaultDataScope,
+			RequestTimeout:   time.Duration(cfg.Tools.Knows.RequestTimeoutSeconds) * time.Second,
+			MaxRetries:       cfg.Tools.Knows.MaxRetries,
+			RetryBackoff:     time.Duration(cfg.Tools.Knows.RetryBackoffMilliseconds) * time.Millisecond,
+			BatchConcurrency: cfg.Tools.Knows.BatchConcurrency,
+			CacheTTL:         time.Duration(cfg.Tools.Knows.CacheTTLMinutes) * time.Minute,
+			VerifiedQuotes:   cfg.Tools.Knows.VerifiedQuotes,
+		}
 		if cfg.Tools.Knows.Enabled {
-			knowsTools, err := tools.NewKnowsTools(tools.KnowsToolOptions{
-				APIKey:           cfg.Tools.Knows.APIKey,
-				APIBaseURL:       cfg.Tools.Knows.APIBaseURL,
-				DefaultDataScope: cfg.Tools.Knows.DefaultDataScope,
-				RequestTimeout:   time.Duration(cfg.Tools.Knows.RequestTimeoutSeconds) * time.Second,
-				MaxRetries:       cfg.Tools.Knows.MaxRetries,
-				RetryBackoff:     time.Duration(cfg.Tools.Knows.RetryBackoffMilliseconds) * time.Millisecond,
-				BatchConcurrency: cfg.Tools.Knows.BatchConcurrency,
-				CacheTTL:         time.Duration(cfg.Tools.Knows.CacheTTLMinutes) * time.Minute,
-				CacheMaxEntries:  cfg.Tools.Knows.CacheMaxEntries,
-			})
+			knowsTools, err := tools.NewKnowsTools(knowsOpts)
 			if err != nil {
 				logger.WarnCF("agent", "KnowS tools disabled due to invalid config",
 					map[string]interface{}{
@@ -131,6 +499,300 @@ func registerSharedTools(cfg *config.Config, msgBus *bus.MessageBus, registry *A
 			}
 		}
 
+		// Adverse event reporting
+		if cfg.Tools.AdverseEvents.Enabled {
+			agent.Tools.Register(tools.NewAdverseEventTool(agent.Workspace))
+		}
+
+		// Clinic visit prep summaries
+		if cfg.Tools.VisitPrep.Enabled {
+			agent.Tools.Register(tools.NewVisitPrepTool(agent.Workspace, agent.Sessions.UserTurns))
+		}
+
+		// Drug interaction checks
+		if cfg.Tools.DrugInteractions.Enabled {
+			agent.Tools.Register(tools.NewDrugInteractionTool(tools.DrugInteractionOptions{
+				RxNormBaseURL:  cfg.Tools.DrugInteractions.RxNormBaseURL,
+				OpenFDABaseURL: cfg.Tools.DrugInteractions.OpenFDABaseURL,
+				OpenFDAAPIKey:  cfg.Tools.DrugInteractions.OpenFDAAPIKey,
+				Timeout:        time.Duration(cfg.Tools.DrugInteractions.TimeoutSeconds) * time.Second,
+			}))
+		}
+
+		// Lab report parsing
+		if cfg.Tools.LabReports.Enabled {
+			agent.Tools.Register(tools.NewLabReportTool())
+		}
+		if cfg.Tools.Spreadsheets.Enabled {
+			spreadsheet := tools.NewSpreadsheetTool(agent.Workspace, cfg.Agents.Defaults.RestrictToWorkspace)
+			spreadsheet.SetPathPolicy(agent.PathPolicy)
+			agent.Tools.Register(spreadsheet)
+		}
+		if cfg.Tools.Charts.Enabled {
+			chart := tools.NewMakeChartTool(agent.Workspace, cfg.Agents.Defaults.RestrictToWorkspace)
+			chart.SetPathPolicy(agent.PathPolicy)
+			agent.Tools.Register(chart)
+		}
+		if cfg.Tools.Triage.Enabled {
+			agent.Tools.Register(tools.NewTriageTool())
+		}
+
+		// Genetic variant annotation
+		if cfg.Tools.Variants.Enabled {
+			agent.Tools.Register(tools.NewVariantLookupTool(tools.VariantLookupOptions{
+				ClinVarBaseURL: cfg.Tools.Variants.ClinVarBaseURL,
+				NCBIAPIKey:     cfg.Tools.Variants.NCBIAPIKey,
+				OncoKBBaseURL:  cfg.Tools.Variants.OncoKBBaseURL,
+				OncoKBToken:    cfg.Tools.Variants.OncoKBToken,
+				Timeout:        time.Duration(cfg.Tools.Variants.TimeoutSeconds) * time.Second,
+			}))
+		}
+
+		// Drug reimbursement (NRDL) lookups
+		if cfg.Tools.Reimbursement.Enabled {
+			agent.Tools.Register(tools.NewReimbursementTool(tools.ReimbursementOptions{
+				DatasetPath: cfg.ReimbursementDatasetPath(),
+				APIURL:      cfg.Tools.Reimbursement.APIURL,
+				APIKey:      cfg.Tools.Reimbursement.APIKey,
+				Timeout:     time.Duration(cfg.Tools.Reimbursement.TimeoutSeconds) * time.Second,
+			}))
+		}
+
+		// Hospital record (FHIR) tools
+		if cfg.Tools.FHIR.Enabled {
+			fhirTools, err := tools.NewFHIRTools(tools.FHIROptions{
+				BaseURL: cfg.Tools.FHIR.BaseURL,
+				Auth: tools.FHIRAuthOptions{
+					Type:           cfg.Tools.FHIR.Auth.Type,
+					Token:          cfg.Tools.FHIR.Auth.Token,
+					TokenURL:       cfg.Tools.FHIR.Auth.TokenURL,
+					ClientID:       cfg.Tools.FHIR.Auth.ClientID,
+					ClientSecret:   cfg.Tools.FHIR.Auth.ClientSecret,
+					Scope:          cfg.Tools.FHIR.Auth.Scope,
+					PrivateKeyPath: cfg.Tools.FHIR.Auth.PrivateKeyPath,
+					KeyID:          cfg.Tools.FHIR.Auth.KeyID,
+				},
+				Patients:   cfg.Tools.FHIR.Patients,
+				Clinicians: cfg.Tools.FHIR.Clinicians,
+				Timeout:    time.Duration(cfg.Tools.FHIR.TimeoutSeconds) * time.Second,
+			})
+			if err != nil {
+				logger.WarnCF("agent", "FHIR tools disabled due to invalid config",
+					map[string]interface{}{
+						"agent_id": agentID,
+						"error":    err.Error(),
+					})
+			} else {
+				for _, fhirTool := range fhirTools {
+					agent.Tools.Register(fhirTool)
+				}
+			}
+		}
+
+		// Image text recognition
+		if recognizer != nil {
+			ocrTool := tools.NewOCRImageTool(recognizer, agent.Workspace, cfg.Agents.Defaults.RestrictToWorkspace)
+			ocrTool.SetPathPolicy(agent.PathPolicy)
+			agent.Tools.Register(ocrTool)
+		}
+
+		// Answers read aloud as voice messages
+		if synthesizer != nil {
+			agent.Tools.Register(tools.NewTextToSpeechTool(synthesizer, agent.Workspace, cfg.Tools.TTS.MaxChars))
+		}
+
+		// PDF document index, shared with the guidelines evidence provider
+		var documentStore *rag.Store
+		if cfg.Tools.RAG.Enabled {
+			store, err := rag.Open(filepath.Join(agent.Workspace, "rag"))
+			if err == nil {
+				documentStore = store
+				agent.Documents = store
+			}
+			documentTools, err := tools.NewDocumentTools(tools.DocumentToolOptions{
+				Store:        store,
+				Dir:          filepath.Join(agent.Workspace, "rag"),
+				Workspace:    agent.Workspace,
+				Restrict:     cfg.Agents.Defaults.RestrictToWorkspace,
+				PathPolicy:   agent.PathPolicy,
+				ChunkChars:   cfg.Tools.RAG.ChunkChars,
+				ChunkOverlap: cfg.Tools.RAG.ChunkOverlap,
+				MaxPDFBytes:  int64(cfg.Tools.RAG.MaxPDFMB) << 20,
+			})
+			if err != nil {
+				logger.WarnCF("agent", "Document tools disabled",
+					map[string]interface{}{
+						"agent_id": agentID,
+						"error":    err.Error(),
+					})
+			} else {
+				for _, documentTool := range documentTools {
+					agent.Tools.Register(documentTool)
+				}
+			}
+		}
+
+		// Semantic knowledge base of curated documents
+		if cfg.Tools.KnowledgeBase.Enabled {
+			kbCfg := cfg.Tools.KnowledgeBase
+			kbCfg.Embedding = cfg.KnowledgeBaseEmbedding()
+			if kb, err := rag.OpenKnowledgeBase(kbCfg, filepath.Join(agent.Workspace, "kb"), cfg.EmbeddingCachePath()); err != nil {
+				logger.WarnCF("agent", "Knowledge base tools disabled",
+					map[string]interface{}{
+						"agent_id": agentID,
+						"error":    err.Error(),
+					})
+			} else {
+				for _, kbTool := range tools.NewKnowledgeBaseTools(kb, tools.KnowledgeBaseToolOptions{
+					Workspace:    agent.Workspace,
+					Restrict:     cfg.Agents.Defaults.RestrictToWorkspace,
+					PathPolicy:   agent.PathPolicy,
+					ChunkChars:   kbCfg.ChunkChars,
+					ChunkOverlap: kbCfg.ChunkOverlap,
+					MaxFileBytes: int64(kbCfg.MaxFileMB) << 20,
+				}) {
+					agent.Tools.Register(kbTool)
+				}
+			}
+		}
+
+		// Evidence providers searched together by the evidence_* tools
+		pubmed := tools.NewPubMedProvider(tools.PubMedOptions{
+			BaseURL: cfg.Tools.Evidence.PubMed.BaseURL,
+			APIKey:  cfg.Tools.Evidence.PubMed.APIKey,
+			Timeout: time.Duration(cfg.Tools.Evidence.PubMed.TimeoutSeconds) * time.Second,
+		})
+		if cfg.Tools.Evidence.Enabled {
+			registry := tools.NewEvidenceRegistry()
+			for _, name := range cfg.Tools.Evidence.Providers {
+				switch name {
+				case "knows":
+					if !cfg.Tools.Knows.Enabled {
+						continue
+					}
+					provider, err := tools.NewKnowsEvidenceProvider(knowsOpts)
+					if err != nil {
+						logger.WarnCF("agent", "KnowS evidence provider disabled",
+							map[string]interface{}{
+								"agent_id": agentID,
+								"error":    err.Error(),
+							})
+						continue
+					}
+					registry.Register(provider)
+				case "pubmed":
+					registry.Register(pubmed)
+				case "guidelines":
+					if documentStore != nil {
+						registry.Register(tools.NewGuidelineEvidenceProvider(documentStore))
+					}
+				}
+			}
+			if len(registry.Names()) > 0 {
+				for _, evidenceTool := range tools.NewEvidenceTools(registry) {
+					agent.Tools.Register(evidenceTool)
+				}
+			}
+		}
+
+		// Systematic reviews and meta-analyses
+		if cfg.Tools.SystematicReviews.Enabled {
+			agent.Tools.Register(tools.NewSystematicReviewTool(pubmed))
+		}
+
+		// Symptom and pain diary
+		if cfg.Tools.Diary.Enabled {
+			for _, diaryTool := range tools.NewDiaryTools(agent.Workspace) {
+				agent.Tools.Register(diaryTool)
+			}
+		}
+
+		// Traditional and complementary therapy safety data
+		if cfg.Tools.Complementary.Enabled {
+			complementaryTool, err := tools.NewComplementaryTherapyTool(cfg.ComplementaryDatasetPath())
+			if err != nil {
+				logger.WarnCF("agent", "Complementary therapy tool disabled",
+					map[string]interface{}{
+						"agent_id": agentID,
+						"error":    err.Error(),
+					})
+			} else {
+				agent.Tools.Register(complementaryTool)
+			}
+		}
+
+		// Vaccination schedules around chemotherapy
+		if cfg.Tools.Vaccines.Enabled {
+			vaccineTool, err := tools.NewVaccineScheduleTool(cfg.VaccineSchedulePath())
+			if err != nil {
+				logger.WarnCF("agent", "Vaccine schedule tool disabled",
+					map[string]interface{}{
+						"agent_id": agentID,
+						"error":    err.Error(),
+					})
+			} else {
+				agent.Tools.Register(vaccineTool)
+			}
+		}
+
+		// Long-term user profiles, shown in the system prompt; changes need
+		// the user's approval
+		if cfg.Tools.Profile.Enabled {
+			profiles := profile.NewStore(filepath.Join(agent.Workspace, "profiles"))
+			agent.ContextBuilder.SetProfiles(profiles)
+			if cfg.Tools.Approval.Enabled {
+				agent.Tools.Register(tools.NewProfileUpdateTool(profiles))
+			}
+		}
+
+		// Persona templates that set the tone of answers on each channel
+		if pc := cfg.Agents.Personas; pc.Enabled {
+			dir := filepath.Join(agent.Workspace, "personas")
+			if pc.Dir != "" {
+				dir = expandHome(pc.Dir)
+			}
+			agent.ContextBuilder.SetPersonas(persona.NewStore(dir), pc.Default, pc.Channels)
+		}
+
+		// Working memory of each conversation, shown in the system prompt
+		if cfg.Tools.Scratchpad.Enabled {
+			agent.ContextBuilder.SetScratchpads(agent.Sessions)
+			for _, scratchpadTool := range tools.NewScratchpadTools(agent.Sessions, tools.ScratchpadOptions{
+				MaxEntries:    cfg.Tools.Scratchpad.MaxEntries,
+				MaxValueChars: cfg.Tools.Scratchpad.MaxValueChars,
+			}) {
+				agent.Tools.Register(scratchpadTool)
+			}
+		}
+
+		// Referral and appointment requests to partner clinics
+		if cfg.Tools.Referrals.Enabled && cfg.Tools.Approval.Enabled {
+			referralTool, err := tools.NewReferralTool(cfg.Tools.Referrals.Destinations)
+			if err != nil {
+				logger.WarnCF("agent", "Referral tool disabled",
+					map[string]interface{}{
+						"agent_id": agentID,
+						"error":    err.Error(),
+					})
+			} else {
+				agent.Tools.Register(referralTool)
+			}
+		}
+
+		// Medical translation with the glossary
+		if cfg.Tools.Translation.Enabled {
+			model := cfg.Tools.Translation.Model
+			if model == "" {
+				model = agent.Model
+			}
+			agent.Tools.Register(tools.NewTranslateTool(agent.Provider, tools.TranslateOptions{
+				Model:        model,
+				GlossaryPath: cfg.TranslationGlossaryPath(),
+			}))
+		}
+
+		// picoclaw gen tool: registrations are inserted above this line
+
 		// Message tool
 		messageTool := tools.NewMessageTool()
 		messageTool.SetSendCallback(func(channel, chatID, content string) error {
@@ -157,8 +819,31 @@ func registerSharedTools(cfg *config.Config, msgBus *bus.MessageBus, registry *A
 	}
 }
 
+// inboundQueueSize is how many messages may wait while a turn runs.
+const inboundQueueSize = 64
+
+// Run consumes inbound messages until ctx is done or Stop is called.
+// Messages are answered one at a time by a worker, while this loop keeps
+// reading, so /stop and newer messages can interrupt the turn in flight.
 func (al *AgentLoop) Run(ctx context.Context) error {
 	al.running.Store(true)
+	al.startIngestion(ctx)
+
+	queue := make(chan bus.InboundMessage, inboundQueueSize)
+	quit := make(chan struct{})
+	defer close(quit)
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-quit:
+				return
+			case msg := <-queue:
+				al.answerMessage(ctx, msg)
+			}
+		}
+	}()
 
 	for al.running.Load() {
 		select {
@@ -170,32 +855,14 @@ func (al *AgentLoop) Run(ctx context.Context) error {
 				continue
 			}
 
-			response, err := al.processMessage(ctx, msg)
-			if err != nil {
-				response = fmt.Sprintf("Error processing message: %v", err)
+			if al.receiveMessage(ctx, msg) || al.interrupt(msg) {
+				continue
 			}
 
-			if response != "" {
-				// Check if the message tool already sent a response during this round.
-				// If so, skip publishing to avoid duplicate messages to the user.
-				// Use default agent's tools to check (message tool is shared).
-				alreadySent := false
-				defaultAgent := al.registry.GetDefaultAgent()
-				if defaultAgent != nil {
-					if tool, ok := defaultAgent.Tools.Get("message"); ok {
-						if mt, ok := tool.(*tools.MessageTool); ok {
-							alreadySent = mt.HasSentInRound()
-						}
-					}
-				}
-
-				if !alreadySent {
-					al.bus.PublishOutbound(bus.OutboundMessage{
-						Channel: msg.Channel,
-						ChatID:  msg.ChatID,
-						Content: response,
-					})
-				}
+			select {
+			case queue <- msg:
+			case <-ctx.Done():
+				return nil
 			}
 		}
 	}
@@ -203,8 +870,60 @@ func (al *AgentLoop) Run(ctx context.Context) error {
 	return nil
 }
 
+// answerMessage processes msg and publishes the response, unless the turn
+// was stopped.
+func (al *AgentLoop) answerMessage(ctx context.Context, msg bus.InboundMessage) {
+	turnCtx, endTurn := al.beginTurn(ctx, msg)
+	turnCtx = tools.WithMessageRound(turnCtx)
+	response, err := al.processMessage(turnCtx, msg)
+	if endTurn() || errors.Is(err, errTurnStopped) {
+		return
+	}
+	if err != nil {
+		al.emitError(ctx, msg, err)
+		response = fmt.Sprintf("Error processing message: %v", err)
+	}
+
+	if response != "" {
+		// If the message tool already sent a response during this round,
+		// skip publishing to avoid duplicate messages to the user.
+		if !tools.MessageSentInRound(turnCtx) {
+			out := bus.OutboundMessage{
+				Channel: msg.Channel,
+				ChatID:  msg.ChatID,
+				Content: response,
+			}
+			if err == nil {
+				out.Buttons = al.replyButtons(msg)
+			}
+			al.groupReply(msg, &out)
+			al.bus.PublishOutbound(out)
+		}
+
+		// Suggestions follow the answer and must not delay the next message
+		if err == nil {
+			go al.sendFollowUps(ctx, msg)
+		}
+	}
+}
+
 func (al *AgentLoop) Stop() {
 	al.running.Store(false)
+	if al.mcp != nil {
+		al.mcp.Close()
+	}
+	if al.plugins != nil {
+		al.plugins.Close()
+	}
+	if al.shadows != nil {
+		al.shadows.Close()
+	}
+	if al.usage != nil {
+		al.usage.Close()
+	}
+	if al.feedback != nil {
+		al.feedback.Close()
+	}
 }
 
 func (al *AgentLoop) RegisterTool(tool tools.Tool) {
@@ -215,8 +934,48 @@ func (al *AgentLoop) RegisterTool(tool tools.Tool) {
 	}
 }
 
+// RegisterMedicationTools registers the medication reminder tools on every
+// agent. Reminders are kept in the agent's sessions and delivered by
+// scheduler.
+func (al *AgentLoop) RegisterMedicationTools(scheduler *cron.CronService, timezone string) {
+	for _, agentID := range al.registry.ListAgentIDs() {
+		if agent, ok := al.registry.GetAgent(agentID); ok {
+			for _, tool := range tools.NewMedicationReminderTools(scheduler, agent.Sessions, timezone) {
+				agent.Tools.Register(tool)
+			}
+		}
+	}
+}
+
+// Audit returns the tool call audit store, or nil when auditing is disabled.
+func (al *AgentLoop) Audit() *audit.Store {
+	return al.audit
+}
+
+// Tools returns the tool registry of an agent, or of the default agent when
+// agentID is empty.
+func (al *AgentLoop) Tools(agentID string) (*tools.ToolRegistry, bool) {
+	agent := al.registry.GetDefaultAgent()
+	if agentID != "" {
+		var ok bool
+		if agent, ok = al.registry.GetAgent(agentID); !ok {
+			return nil, false
+		}
+	}
+	if agent == nil {
+		return nil, false
+	}
+	return agent.Tools, true
+}
+
+// Approvals returns the approval manager, or nil when approvals are disabled.
+func (al *AgentLoop) Approvals() *tools.ApprovalManager {
+	return al.approvals
+}
+
 func (al *AgentLoop) SetChannelManager(cm *channels.Manager) {
 	al.channelManager = cm
+	cm.SetHooks(al.hooks)
 }
 
 // RecordLastChannel records the last active channel for this workspace.
@@ -269,6 +1028,37 @@ func (al *AgentLoop) ProcessHeartbeat(ctx context.Context, content, channel, cha
 	})
 }
 
+// ProcessScheduled runs a scheduled task as a turn in the session of the
+// chat it is for, so the agent sees the conversation so far, and returns
+// the answer without sending it. A turn that answers
+// scheduler.NothingToSend is dropped from the session.
+func (al *AgentLoop) ProcessScheduled(ctx context.Context, prompt, channel, chatID string) (string, error) {
+	agent, sessionKey, _ := al.resolveSession(bus.InboundMessage{
+		Channel:  channel,
+		SenderID: chatID,
+		ChatID:   chatID,
+		Metadata: map[string]string{"peer_kind": "direct", "peer_id": chatID},
+	})
+	if fork, ok := al.activeForks.Load(sessionKey); ok {
+		sessionKey = fork.(string)
+	}
+	before := agent.Sessions.GetHistory(sessionKey)
+
+	answer, err := al.runAgentLoop(ctx, agent, processOptions{
+		SessionKey:    sessionKey,
+		Channel:       channel,
+		ChatID:        chatID,
+		UserMessage:   prompt,
+		EnableSummary: true,
+		Guardrails:    true,
+	})
+	if err == nil && strings.HasPrefix(strings.TrimSpace(answer), scheduler.NothingToSend) {
+		agent.Sessions.SetHistory(sessionKey, before)
+		agent.Sessions.Save(sessionKey)
+	}
+	return answer, err
+}
+
 func (al *AgentLoop) processMessage(ctx context.Context, msg bus.InboundMessage) (string, error) {
 	// Add message preview to log (show full content for error messages)
 	var logContent string
@@ -290,12 +1080,65 @@ func (al *AgentLoop) processMessage(ctx context.Context, msg bus.InboundMessage)
 		return al.processSystemMessage(ctx, msg)
 	}
 
+	// Images kept for the agent are not needed once the message is handled
+	defer utils.RemoveKeptMedia(msg.Media)
+
 	// Check for commands
 	if response, handled := al.handleCommand(ctx, msg); handled {
 		return response, nil
 	}
+	// A lone thumbs-up or thumbs-down rates the last answer
+	if rating, ok := ratingEmoji(msg.Content); ok && al.feedback != nil {
+		return al.rateLastAnswer(msg, rating, ""), nil
+	}
+
+	agent, baseKey, route := al.resolveSession(msg)
+
+	// A chat switched to a fork with /fork keeps talking to the fork
+	sessionKey := baseKey
+	if fork, ok := al.activeForks.Load(baseKey); ok {
+		sessionKey = fork.(string)
+	}
+
+	logger.InfoCF("agent", "Routed message",
+		map[string]interface{}{
+			"agent_id":    agent.ID,
+			"session_key": sessionKey,
+			"matched_by":  route.MatchedBy,
+		})
 
-	// Route to determine agent and session key
+	opts := processOptions{
+		SessionKey:      sessionKey,
+		UserID:          msg.SenderID,
+		Language:        msg.Metadata["language_code"],
+		Channel:         msg.Channel,
+		ChatID:          msg.ChatID,
+		UserMessage:     msg.Content,
+		DefaultResponse: "I've completed processing but have no response to give.",
+		EnableSummary:   true,
+		SendResponse:    false,
+		SendProgress:    true,
+		Guardrails:      true,
+		Media:           append([]string(nil), msg.Media...),
+	}
+	saveAttachments(agent, &opts)
+	// Questions that depend on the user's situation collect it first
+	if reply, asking := al.runIntake(ctx, agent, &opts); asking {
+		return reply, nil
+	}
+	// Near-duplicates of answered questions get the same answer, unless
+	// the question comes with an image the cached answer never saw
+	if len(opts.Media) == 0 {
+		if reply, ok := al.answerFromCache(ctx, agent, &opts); ok {
+			return reply, nil
+		}
+	}
+	al.routeSpecialist(ctx, agent, &opts)
+	return al.runAgentLoop(ctx, agent, opts)
+}
+
+// resolveSession routes msg to an agent and its main session key.
+func (al *AgentLoop) resolveSession(msg bus.InboundMessage) (*AgentInstance, string, routing.ResolvedRoute) {
 	route := al.registry.ResolveRoute(routing.RouteInput{
 		Channel:    msg.Channel,
 		AccountID:  msg.Metadata["account_id"],
@@ -303,6 +1146,7 @@ func (al *AgentLoop) processMessage(ctx context.Context, msg bus.InboundMessage)
 		ParentPeer: extractParentPeer(msg),
 		GuildID:    msg.Metadata["guild_id"],
 		TeamID:     msg.Metadata["team_id"],
+		SenderID:   msg.SenderID,
 	})
 
 	agent, ok := al.registry.GetAgent(route.AgentID)
@@ -315,23 +1159,7 @@ func (al *AgentLoop) processMessage(ctx context.Context, msg bus.InboundMessage)
 	if msg.SessionKey != "" && strings.HasPrefix(msg.SessionKey, "agent:") {
 		sessionKey = msg.SessionKey
 	}
-
-	logger.InfoCF("agent", "Routed message",
-		map[string]interface{}{
-			"agent_id":    agent.ID,
-			"session_key": sessionKey,
-			"matched_by":  route.MatchedBy,
-		})
-
-	return al.runAgentLoop(ctx, agent, processOptions{
-		SessionKey:      sessionKey,
-		Channel:         msg.Channel,
-		ChatID:          msg.ChatID,
-		UserMessage:     msg.Content,
-		DefaultResponse: "I've completed processing but have no response to give.",
-		EnableSummary:   true,
-		SendResponse:    false,
-	})
+	return agent, sessionKey, route
 }
 
 func (al *AgentLoop) processSystemMessage(ctx context.Context, msg bus.InboundMessage) (string, error) {
@@ -392,6 +1220,17 @@ func (al *AgentLoop) processSystemMessage(ctx context.Context, msg bus.InboundMe
 
 // runAgentLoop is the core message processing logic.
 func (al *AgentLoop) runAgentLoop(ctx context.Context, agent *AgentInstance, opts processOptions) (string, error) {
+	if opts.TurnID == "" {
+		opts.TurnID = newTurnID()
+	}
+	start := time.Now()
+	// Users over their daily budget are answered by the cheaper model
+	if opts.Model == "" {
+		opts.Model = al.budgetModel(opts.UserID)
+	}
+	opts.Params = al.modelParams(agent, opts.Channel)
+	al.loadTurnImages(ctx, agent, &opts)
+
 	// 0. Record last channel for heartbeat notifications (skip internal channels)
 	if opts.Channel != "" && opts.ChatID != "" {
 		// Don't record internal channels (cli, system, subagent)
@@ -406,6 +1245,20 @@ func (al *AgentLoop) runAgentLoop(ctx context.Context, agent *AgentInstance, opt
 	// 1. Update tool contexts
 	al.updateToolContexts(agent, opts.Channel, opts.ChatID)
 
+	// What-if forks assume their premise in every turn
+	if scenario := agent.Sessions.Scenario(opts.SessionKey); scenario != "" {
+		opts.Instructions = append(opts.Instructions, scenarioInstruction(scenario))
+	}
+	if style := agent.Sessions.AnswerStyle(opts.SessionKey); style != "" {
+		opts.Instructions = append(opts.Instructions, answerStyleInstruction(style))
+	}
+
+	// Safety checks run before the model, so their notices reach the user
+	// whatever it answers
+	checks := al.checkInbound(opts)
+	opts.Instructions = append(opts.Instructions, checks.Instructions...)
+	notice := strings.Join(checks.Notices, "\n\n")
+
 	// 2. Build messages (skip history for heartbeat)
 	var history []providers.Message
 	var summary string
@@ -417,17 +1270,67 @@ func (al *AgentLoop) runAgentLoop(ctx context.Context, agent *AgentInstance, opt
 		history,
 		summary,
 		opts.UserMessage,
-		nil,
+		opts.Images,
 		opts.Channel,
 		opts.ChatID,
 	)
+	messages = agent.ContextBuilder.AddPersona(messages, opts.Channel, opts.ChatID, opts.UserID)
+	messages = agent.ContextBuilder.AddUserProfile(messages, opts.UserID)
+	messages = agent.ContextBuilder.AddScratchpad(messages, opts.SessionKey)
+	messages = agent.ContextBuilder.AddInstructions(messages, opts.Instructions)
+
+	// Compact now if this prompt would already crowd the context window
+	if !opts.NoHistory && agent.Tokens.Messages(messages) > agent.ContextWindow*compactAtPercent/100 {
+		summarizeKey := agent.ID + ":" + opts.SessionKey
+		if _, busy := al.summarizing.LoadOrStore(summarizeKey, true); !busy {
+			compacted := al.compactHistory(ctx, agent, opts.SessionKey, agent.ContextWindow*keepPercent/100)
+			al.summarizing.Delete(summarizeKey)
+			if compacted {
+				messages = agent.ContextBuilder.BuildMessages(
+					agent.Sessions.GetHistory(opts.SessionKey),
+					agent.Sessions.GetSummary(opts.SessionKey),
+					opts.UserMessage,
+					opts.Images,
+					opts.Channel,
+					opts.ChatID,
+				)
+				messages = agent.ContextBuilder.AddPersona(messages, opts.Channel, opts.ChatID, opts.UserID)
+				messages = agent.ContextBuilder.AddUserProfile(messages, opts.UserID)
+				messages = agent.ContextBuilder.AddScratchpad(messages, opts.SessionKey)
+				messages = agent.ContextBuilder.AddInstructions(messages, opts.Instructions)
+			}
+		}
+	}
 
 	// 3. Save user message to session
 	agent.Sessions.AddMessage(opts.SessionKey, "user", opts.UserMessage)
+	agent.Sessions.SetOrigin(opts.SessionKey, opts.Channel, opts.UserID)
+	turnStart := len(agent.Sessions.GetHistory(opts.SessionKey))
 
 	// 4. Run LLM iteration loop
 	finalContent, iteration, err := al.runLLMIteration(ctx, agent, messages, opts)
+	if err != nil && ctx.Err() != nil {
+		return "", al.stopped(agent, opts, start, turnStart)
+	}
+	// A turn out of steps ends with an apology rather than an error
+	var limit *stepLimitError
+	if errors.As(err, &limit) {
+		finalContent, err = limit.message(prefersChinese(opts)), nil
+	}
 	if err != nil {
+		al.recordTurn(agent, opts, start, "", err)
+		// Providers still rate limited after their retries and fallbacks
+		// get an apology rather than the raw API error
+		if providers.IsBusyError(err) {
+			reply := busyMessage(prefersChinese(opts))
+			if notice != "" {
+				reply = notice + "\n\n" + reply
+			}
+			return reply, nil
+		}
+		if notice != "" {
+			return notice + "\n\n" + fmt.Sprintf("Error processing message: %v", err), nil
+		}
 		return "", err
 	}
 
@@ -439,9 +1342,32 @@ func (al *AgentLoop) runAgentLoop(ctx context.Context, agent *AgentInstance, opt
 		finalContent = opts.DefaultResponse
 	}
 
+	// Only evidence text may be quoted verbatim
+	if al.cfg.Tools.Knows.VerifiedQuotes {
+		finalContent = al.enforceQuoteFidelity(ctx, agent, opts.SessionKey, finalContent)
+	}
+	// Claims must be backed by the evidence retrieved this turn
+	if limit == nil {
+		finalContent = al.checkFaithfulness(ctx, agent, opts, finalContent)
+	}
+	finalContent = al.checkOutbound(opts, finalContent)
+	// Last, so the reference list ends the message and delivery can keep it whole
+	finalContent = al.renderCitations(agent, opts, finalContent)
+	if notice != "" {
+		finalContent = notice + "\n\n" + finalContent
+	}
+	// An answer finished after /stop is discarded like an unfinished one
+	if ctx.Err() != nil {
+		return "", al.stopped(agent, opts, start, turnStart)
+	}
+
 	// 6. Save final assistant message to session
 	agent.Sessions.AddMessage(opts.SessionKey, "assistant", finalContent)
 	agent.Sessions.Save(opts.SessionKey)
+	al.lastTurns.Store(opts.SessionKey, opts.TurnID)
+	if notice == "" && limit == nil {
+		al.cacheAnswer(agent, opts, len(history) == 0 && summary == "", finalContent)
+	}
 
 	// 7. Optional: summarization
 	if opts.EnableSummary {
@@ -458,11 +1384,13 @@ func (al *AgentLoop) runAgentLoop(ctx context.Context, agent *AgentInstance, opt
 	}
 
 	// 9. Log response
+	al.recordTurn(agent, opts, start, finalContent, nil)
 	responsePreview := utils.Truncate(finalContent, 120)
 	logger.InfoCF("agent", fmt.Sprintf("Response: %s", responsePreview),
 		map[string]interface{}{
 			"agent_id":     agent.ID,
 			"session_key":  opts.SessionKey,
+			"turn_id":      opts.TurnID,
 			"iterations":   iteration,
 			"final_length": len(finalContent),
 		})
@@ -470,11 +1398,81 @@ func (al *AgentLoop) runAgentLoop(ctx context.Context, agent *AgentInstance, opt
 	return finalContent, nil
 }
 
+// toAttachments converts file and image blocks for delivery after a
+// message's text.
+func toAttachments(blocks []tools.ContentBlock) []bus.Attachment {
+	if len(blocks) == 0 {
+		return nil
+	}
+	attachments := make([]bus.Attachment, len(blocks))
+	for i, b := range blocks {
+		name := b.Name
+		if name == "" {
+			name = b.Caption
+		}
+		attachments[i] = bus.Attachment{Name: name, URL: b.URL, Path: b.Path, MimeType: b.MimeType}
+	}
+	return attachments
+}
+
+// recordTurn writes the turn to the audit log, if there is one.
+func (al *AgentLoop) recordTurn(agent *AgentInstance, opts processOptions, start time.Time, response string, err error) {
+	if al.audit == nil {
+		return
+	}
+	record := audit.TurnRecord{
+		TurnID:     opts.TurnID,
+		AgentID:    agent.ID,
+		SessionKey: opts.SessionKey,
+		UserID:     opts.UserID,
+		Channel:    opts.Channel,
+		ChatID:     opts.ChatID,
+		Model:      agent.Model,
+		Prompt:     opts.UserMessage,
+		Response:   response,
+		Start:      start,
+		Duration:   time.Since(start),
+	}
+	if err != nil {
+		record.Error = err.Error()
+	}
+	al.audit.RecordTurn(record)
+}
+
+// newTurnID returns a short random ID for a turn.
+func newTurnID() string {
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("turn-%d", time.Now().UnixNano())
+	}
+	return "turn-" + hex.EncodeToString(b)
+}
+
 // runLLMIteration executes the LLM call loop with tool handling.
 func (al *AgentLoop) runLLMIteration(ctx context.Context, agent *AgentInstance, messages []providers.Message, opts processOptions) (string, int, error) {
 	iteration := 0
 	var finalContent string
 
+	ctx = tools.WithCallMetadata(ctx, tools.CallMetadata{
+		AgentID:     agent.ID,
+		SessionKey:  opts.SessionKey,
+		UserID:      opts.UserID,
+		TurnID:      opts.TurnID,
+		Language:    opts.Language,
+		Permissions: al.userPermissions(opts.UserID),
+		Scope:       opts.ToolScope,
+	})
+	var progress *progressReporter
+	if opts.SendProgress && opts.ChatID != "" && !constants.IsInternalChannel(opts.Channel) {
+		progress = newProgressReporter(al.bus, opts.Channel, opts.ChatID)
+		defer progress.close()
+		ctx = tools.WithProgress(ctx, progress.report)
+		ctx = tools.WithStream(ctx, progress.stream)
+	}
+
+	defaults := al.cfg.Agents.Defaults
+	guard := newStepGuard(defaults.MaxToolCalls, defaults.MaxRepeatedCalls)
+	answered := false
 	for iteration < agent.MaxIterations {
 		iteration++
 
@@ -486,7 +1484,9 @@ func (al *AgentLoop) runLLMIteration(ctx context.Context, agent *AgentInstance,
 			})
 
 		// Build tool definitions
-		providerToolDefs := agent.Tools.ToProviderDefs()
+		providerToolDefs := permittedToolDefs(ctx, agent.Tools.ToProviderDefs())
+
+		callOptions := llmOptions(agent, opts.Params)
 
 		// Log LLM request details
 		logger.DebugCF("agent", "LLM request",
@@ -496,8 +1496,8 @@ func (al *AgentLoop) runLLMIteration(ctx context.Context, agent *AgentInstance,
 				"model":             agent.Model,
 				"messages_count":    len(messages),
 				"tools_count":       len(providerToolDefs),
-				"max_tokens":        8192,
-				"temperature":       0.7,
+				"max_tokens":        callOptions["max_tokens"],
+				"temperature":       callOptions["temperature"],
 				"system_prompt_len": len(messages[0].Content),
 			})
 
@@ -512,15 +1512,53 @@ func (al *AgentLoop) runLLMIteration(ctx context.Context, agent *AgentInstance,
 		// Call LLM with fallback chain if candidates are configured.
 		var response *providers.LLMResponse
 		var err error
-
+		// Provider and model that answered, for usage tracking
+		var usedProvider, usedModel string
+
+		// Replies are streamed, so the chat can show the answer while the
+		// model writes it
+		onChunk := func() providers.StreamFunc {
+			if progress == nil {
+				return nil
+			}
+			return progress.drafter()
+		}
 		callLLM := func() (*providers.LLMResponse, error) {
+			if opts.Model != "" {
+				usedProvider, usedModel = "", opts.Model
+				return providers.ChatStream(ctx, agent.Provider, messages, providerToolDefs, opts.Model, callOptions, onChunk())
+			}
+			// Images go to the image model when one is configured
+			if len(opts.Images) > 0 && len(agent.ImageCandidates) > 0 && al.fallback != nil {
+				fbResult, fbErr := al.fallback.ExecuteImage(ctx, agent.ImageCandidates,
+					func(ctx context.Context, provider, model string) (*providers.LLMResponse, error) {
+						llm := agent.Provider
+						if len(agent.Candidates) == 0 || provider != agent.Candidates[0].Provider || model != agent.Candidates[0].Model {
+							llm = al.fallbackProvider(agent, provider, model)
+						}
+						return providers.ChatStream(ctx, llm, messages, providerToolDefs, model, callOptions, onChunk())
+					},
+				)
+				if fbErr != nil {
+					return nil, fbErr
+				}
+				usedProvider, usedModel = fbResult.Provider, fbResult.Model
+				return fbResult.Response, nil
+			}
+			// A model set for the channel or persona replaces the agent's
+			if opts.Params.Model != "" {
+				provider, model, llm := al.paramsModel(agent, opts.Params)
+				usedProvider, usedModel = provider, model
+				return providers.ChatStream(ctx, llm, messages, providerToolDefs, model, callOptions, onChunk())
+			}
 			if len(agent.Candidates) > 1 && al.fallback != nil {
 				fbResult, fbErr := al.fallback.Execute(ctx, agent.Candidates,
 					func(ctx context.Context, provider, model string) (*providers.LLMResponse, error) {
-						return agent.Provider.Chat(ctx, messages, providerToolDefs, model, map[string]interface{}{
-							"max_tokens":  8192,
-							"temperature": 0.7,
-						})
+						llm := agent.Provider
+						if primary := agent.Candidates[0]; provider != primary.Provider || model != primary.Model {
+							llm = al.fallbackProvider(agent, provider, model)
+						}
+						return providers.ChatStream(ctx, llm, messages, providerToolDefs, model, callOptions, onChunk())
 					},
 				)
 				if fbErr != nil {
@@ -531,19 +1569,19 @@ func (al *AgentLoop) runLLMIteration(ctx context.Context, agent *AgentInstance,
 						fbResult.Provider, fbResult.Model, len(fbResult.Attempts)+1),
 						map[string]interface{}{"agent_id": agent.ID, "iteration": iteration})
 				}
+				usedProvider, usedModel = fbResult.Provider, fbResult.Model
 				return fbResult.Response, nil
 			}
-			return agent.Provider.Chat(ctx, messages, providerToolDefs, agent.Model, map[string]interface{}{
-				"max_tokens":  8192,
-				"temperature": 0.7,
-			})
+			usedProvider, usedModel = "", agent.Model
+			return providers.ChatStream(ctx, agent.Provider, messages, providerToolDefs, agent.Model, callOptions, onChunk())
 		}
 
 		// Retry loop for context/token errors
 		maxRetries := 2
+		llmStart := time.Now()
 		for retry := 0; retry <= maxRetries; retry++ {
 			response, err = callLLM()
-			if err == nil {
+			if err == nil || ctx.Err() != nil {
 				break
 			}
 
@@ -567,13 +1605,21 @@ func (al *AgentLoop) runLLMIteration(ctx context.Context, agent *AgentInstance,
 					})
 				}
 
-				al.forceCompression(agent, opts.SessionKey)
+				// Summarize older turns; drop them only if that fails
+				if !al.compactHistory(ctx, agent, opts.SessionKey, agent.ContextWindow*keepPercent/200) {
+					al.forceCompression(agent, opts.SessionKey)
+				}
 				newHistory := agent.Sessions.GetHistory(opts.SessionKey)
 				newSummary := agent.Sessions.GetSummary(opts.SessionKey)
 				messages = agent.ContextBuilder.BuildMessages(
 					newHistory, newSummary, "",
 					nil, opts.Channel, opts.ChatID,
 				)
+				attachTurnImages(messages, opts.Images)
+				messages = agent.ContextBuilder.AddPersona(messages, opts.Channel, opts.ChatID, opts.UserID)
+				messages = agent.ContextBuilder.AddUserProfile(messages, opts.UserID)
+				messages = agent.ContextBuilder.AddScratchpad(messages, opts.SessionKey)
+				messages = agent.ContextBuilder.AddInstructions(messages, opts.Instructions)
 				continue
 			}
 			break
@@ -588,10 +1634,13 @@ func (al *AgentLoop) runLLMIteration(ctx context.Context, agent *AgentInstance,
 				})
 			return "", iteration, fmt.Errorf("LLM call failed after retries: %w", err)
 		}
+		al.shadowLLMCall(ctx, agent, messages, providerToolDefs, response, time.Since(llmStart))
+		al.recordUsage(agent, opts, iteration, usedProvider, usedModel, messages, response)
 
 		// Check if no tool calls - we're done
 		if len(response.ToolCalls) == 0 {
 			finalContent = response.Content
+			answered = true
 			logger.InfoCF("agent", "LLM response without tool calls (direct answer)",
 				map[string]interface{}{
 					"agent_id":      agent.ID,
@@ -616,8 +1665,9 @@ func (al *AgentLoop) runLLMIteration(ctx context.Context, agent *AgentInstance,
 
 		// Build assistant message with tool calls
 		assistantMsg := providers.Message{
-			Role:    "assistant",
-			Content: response.Content,
+			Role:     "assistant",
+			Content:  response.Content,
+			Thinking: response.Thinking,
 		}
 		for _, tc := range response.ToolCalls {
 			argumentsJSON, _ := json.Marshal(tc.Arguments)
@@ -636,58 +1686,25 @@ func (al *AgentLoop) runLLMIteration(ctx context.Context, agent *AgentInstance,
 		// Save assistant message with tool calls to session
 		agent.Sessions.AddFullMessage(opts.SessionKey, assistantMsg)
 
-		// Execute tool calls
-		for _, tc := range response.ToolCalls {
-			argsJSON, _ := json.Marshal(tc.Arguments)
-			argsPreview := utils.Truncate(string(argsJSON), 200)
-			logger.InfoCF("agent", fmt.Sprintf("Tool call: %s(%s)", tc.Name, argsPreview),
-				map[string]interface{}{
-					"agent_id":  agent.ID,
-					"tool":      tc.Name,
-					"iteration": iteration,
-				})
-
-			// Create async callback for tools that implement AsyncTool
-			// NOTE: Following openclaw's design, async tools do NOT send results directly to users.
-			// Instead, they notify the agent via PublishInbound, and the agent decides
-			// whether to forward the result to the user (in processSystemMessage).
-			asyncCallback := func(callbackCtx context.Context, result *tools.ToolResult) {
-				// Log the async completion but don't send directly to user
-				// The agent will handle user notification via processSystemMessage
-				if !result.Silent && result.ForUser != "" {
-					logger.InfoCF("agent", "Async tool completed, agent will handle notification",
-						map[string]interface{}{
-							"tool":        tc.Name,
-							"content_len": len(result.ForUser),
-						})
-				}
-			}
-
-			toolResult := agent.Tools.ExecuteWithContext(ctx, tc.Name, tc.Arguments, opts.Channel, opts.ChatID, asyncCallback)
-
-			// Send ForUser content to user immediately if not Silent
-			if !toolResult.Silent && toolResult.ForUser != "" && opts.SendResponse {
-				al.bus.PublishOutbound(bus.OutboundMessage{
-					Channel: opts.Channel,
-					ChatID:  opts.ChatID,
-					Content: toolResult.ForUser,
-				})
-				logger.DebugCF("agent", "Sent tool result to user",
-					map[string]interface{}{
-						"tool":        tc.Name,
-						"content_len": len(toolResult.ForUser),
-					})
-			}
-
-			// Determine content for LLM based on tool result
-			contentForLLM := toolResult.ForLLM
-			if contentForLLM == "" && toolResult.Err != nil {
-				contentForLLM = toolResult.Err.Error()
+		// Check the limits before running anything, so the calls run are
+		// the ones a one-at-a-time loop would have run
+		calls := response.ToolCalls
+		var limit *stepLimitError
+		for i, tc := range calls {
+			if limit = guard.check(tc); limit != nil {
+				calls = calls[:i]
+				break
 			}
+			guard.start()
+		}
 
+		// Execute tool calls
+		results := al.runToolCalls(ctx, agent, calls, opts, iteration)
+		for i, tc := range calls {
+			guard.record(tc, results[i])
 			toolResultMsg := providers.Message{
 				Role:       "tool",
-				Content:    contentForLLM,
+				Content:    results[i],
 				ToolCallID: tc.ID,
 			}
 			messages = append(messages, toolResultMsg)
@@ -695,19 +1712,60 @@ func (al *AgentLoop) runLLMIteration(ctx context.Context, agent *AgentInstance,
 			// Save tool result message to session
 			agent.Sessions.AddFullMessage(opts.SessionKey, toolResultMsg)
 		}
+
+		if limit != nil {
+			// Every call needs a result for the history to stay valid
+			for _, skipped := range response.ToolCalls[len(calls):] {
+				skippedMsg := providers.Message{
+					Role:       "tool",
+					Content:    "[System: Not run: " + limit.reason + "]",
+					ToolCallID: skipped.ID,
+				}
+				messages = append(messages, skippedMsg)
+				agent.Sessions.AddFullMessage(opts.SessionKey, skippedMsg)
+			}
+			logger.WarnCF("agent", "Turn stopped at the step limit",
+				map[string]interface{}{
+					"agent_id":  agent.ID,
+					"turn_id":   opts.TurnID,
+					"reason":    limit.reason,
+					"iteration": iteration,
+				})
+			return "", iteration, limit
+		}
 	}
 
+	if !answered && iteration > 0 {
+		limit := &stepLimitError{reason: fmt.Sprintf("the turn used all %d iterations", iteration)}
+		logger.WarnCF("agent", "Turn stopped at the step limit",
+			map[string]interface{}{
+				"agent_id":  agent.ID,
+				"turn_id":   opts.TurnID,
+				"reason":    limit.reason,
+				"iteration": iteration,
+			})
+		return "", iteration, limit
+	}
 	return finalContent, iteration, nil
 }
 
+// attachTurnImages puts the turn's images back on its user message after
+// messages were rebuilt from the session, which keeps only the text.
+func attachTurnImages(messages []providers.Message, images []providers.ImageContent) {
+	if len(images) == 0 {
+		return
+	}
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == "user" && messages[i].Content != "" {
+			messages[i].Images = images
+			return
+		}
+	}
+}
+
 // updateToolContexts updates the context for tools that need channel/chatID info.
 func (al *AgentLoop) updateToolContexts(agent *AgentInstance, channel, chatID string) {
 	// Use ContextualTool interface instead of type assertions
-	if tool, ok := agent.Tools.Get("message"); ok {
-		if mt, ok := tool.(tools.ContextualTool); ok {
-			mt.SetContext(channel, chatID)
-		}
-	}
 	if tool, ok := agent.Tools.Get("spawn"); ok {
 		if st, ok := tool.(tools.ContextualTool); ok {
 			st.SetContext(channel, chatID)
@@ -720,13 +1778,14 @@ func (al *AgentLoop) updateToolContexts(agent *AgentInstance, channel, chatID st
 	}
 }
 
-// maybeSummarize triggers summarization if the session history exceeds thresholds.
+// maybeSummarize folds older turns into the session summary in the
+// background once the history nears the context window.
 func (al *AgentLoop) maybeSummarize(agent *AgentInstance, sessionKey, channel, chatID string) {
 	newHistory := agent.Sessions.GetHistory(sessionKey)
-	tokenEstimate := al.estimateTokens(newHistory)
-	threshold := agent.ContextWindow * 75 / 100
+	tokenEstimate := agent.Tokens.Messages(newHistory)
+	threshold := agent.ContextWindow * compactAtPercent / 100
 
-	if len(newHistory) > 20 || tokenEstimate > threshold {
+	if tokenEstimate > threshold {
 		summarizeKey := agent.ID + ":" + sessionKey
 		if _, loading := al.summarizing.LoadOrStore(summarizeKey, true); !loading {
 			go func() {
@@ -738,7 +1797,9 @@ func (al *AgentLoop) maybeSummarize(agent *AgentInstance, sessionKey, channel, c
 						Content: "Memory threshold reached. Optimizing conversation history...",
 					})
 				}
-				al.summarizeSession(agent, sessionKey)
+				ctx, cancel := context.WithTimeout(context.Background(), 120*time.Second)
+				defer cancel()
+				al.compactHistory(ctx, agent, sessionKey, agent.ContextWindow*keepPercent/100)
 			}()
 		}
 	}
@@ -804,6 +1865,24 @@ func (al *AgentLoop) forceCompression(agent *AgentInstance, sessionKey string) {
 	})
 }
 
+// DownloadTokenizers fetches the tokenizer encodings of the agents' models
+// that are not cached yet, so their tokens are counted exactly rather than
+// approximately. It blocks until done and is meant to run in the background.
+func (al *AgentLoop) DownloadTokenizers(ctx context.Context) {
+	var models []string
+	for _, id := range al.registry.ListAgentIDs() {
+		agent, ok := al.registry.GetAgent(id)
+		if !ok {
+			continue
+		}
+		models = append(models, agent.Model)
+		for _, c := range agent.Candidates {
+			models = append(models, c.Model)
+		}
+	}
+	tokens.Download(ctx, models...)
+}
+
 // GetStartupInfo returns information about loaded tools and skills for logging.
 func (al *AgentLoop) GetStartupInfo() map[string]interface{} {
 	info := make(map[string]interface{})
@@ -883,110 +1962,6 @@ func formatToolsForLog(tools []providers.ToolDefinition) string {
 	return result
 }
 
-// summarizeSession summarizes the conversation history for a session.
-func (al *AgentLoop) summarizeSession(agent *AgentInstance, sessionKey string) {
-	ctx, cancel := context.WithTimeout(context.Background(), 120*time.Second)
-	defer cancel()
-
-	history := agent.Sessions.GetHistory(sessionKey)
-	summary := agent.Sessions.GetSummary(sessionKey)
-
-	// Keep last 4 messages for continuity
-	if len(history) <= 4 {
-		return
-	}
-
-	toSummarize := history[:len(history)-4]
-
-	// Oversized Message Guard
-	maxMessageTokens := agent.ContextWindow / 2
-	validMessages := make([]providers.Message, 0)
-	omitted := false
-
-	for _, m := range toSummarize {
-		if m.Role != "user" && m.Role != "assistant" {
-			continue
-		}
-		msgTokens := len(m.Content) / 2
-		if msgTokens > maxMessageTokens {
-			omitted = true
-			continue
-		}
-		validMessages = append(validMessages, m)
-	}
-
-	if len(validMessages) == 0 {
-		return
-	}
-
-	// Multi-Part Summarization
-	var finalSummary string
-	if len(validMessages) > 10 {
-		mid := len(validMessages) / 2
-		part1 := validMessages[:mid]
-		part2 := validMessages[mid:]
-
-		s1, _ := al.summarizeBatch(ctx, agent, part1, "")
-		s2, _ := al.summarizeBatch(ctx, agent, part2, "")
-
-		mergePrompt := fmt.Sprintf("Merge these two conversation summaries into one cohesive summary:\n\n1: %s\n\n2: %s", s1, s2)
-		resp, err := agent.Provider.Chat(ctx, []providers.Message{{Role: "user", Content: mergePrompt}}, nil, agent.Model, map[string]interface{}{
-			"max_tokens":  1024,
-			"temperature": 0.3,
-		})
-		if err == nil {
-			finalSummary = resp.Content
-		} else {
-			finalSummary = s1 + " " + s2
-		}
-	} else {
-		finalSummary, _ = al.summarizeBatch(ctx, agent, validMessages, summary)
-	}
-
-	if omitted && finalSummary != "" {
-		finalSummary += "\n[Note: Some oversized messages were omitted from this summary for efficiency.]"
-	}
-
-	if finalSummary != "" {
-		agent.Sessions.SetSummary(sessionKey, finalSummary)
-		agent.Sessions.TruncateHistory(sessionKey, 4)
-		agent.Sessions.Save(sessionKey)
-	}
-}
-
-// summarizeBatch summarizes a batch of messages.
-func (al *AgentLoop) summarizeBatch(ctx context.Context, agent *AgentInstance, batch []providers.Message, existingSummary string) (string, error) {
-	prompt := "Provide a concise summary of this conversation segment, preserving core context and key points.\n"
-	if existingSummary != "" {
-		prompt += "Existing context: " + existingSummary + "\n"
-	}
-	prompt += "\nCONVERSATION:\n"
-	for _, m := range batch {
-		prompt += fmt.Sprintf("%s: %s\n", m.Role, m.Content)
-	}
-
-	response, err := agent.Provider.Chat(ctx, []providers.Message{{Role: "user", Content: prompt}}, nil, agent.Model, map[string]interface{}{
-		"max_tokens":  1024,
-		"temperature": 0.3,
-	})
-	if err != nil {
-		return "", err
-	}
-	return response.Content, nil
-}
-
-// estimateTokens estimates the number of tokens in a message list.
-// Uses a safe heuristic of 2.5 characters per token to account for CJK and other
-// overheads better than the previous 3 chars/token.
-func (al *AgentLoop) estimateTokens(messages []providers.Message) int {
-	totalChars := 0
-	for _, m := range messages {
-		totalChars += utf8.RuneCountInString(m.Content)
-	}
-	// 2.5 chars per token = totalChars * 2 / 5
-	return totalChars * 2 / 5
-}
-
 func (al *AgentLoop) handleCommand(ctx context.Context, msg bus.InboundMessage) (string, bool) {
 	content := strings.TrimSpace(msg.Content)
 	if !strings.HasPrefix(content, "/") {
@@ -1002,6 +1977,29 @@ func (al *AgentLoop) handleCommand(ctx context.Context, msg bus.InboundMessage)
 	args := parts[1:]
 
 	switch cmd {
+	case "/fork":
+		return al.handleForkCommand(msg, args), true
+
+	case "/stop":
+		// Turns run one at a time, so none of this chat's is in flight
+		return "Nothing to stop.", true
+
+	case "/feedback":
+		return al.handleFeedbackCommand(msg, args), true
+
+	case "/style":
+		return al.handleStyleCommand(msg, args), true
+
+	case "/scratchpad":
+		return al.handleScratchpadCommand(msg, args), true
+
+	case "/unfork":
+		_, baseKey, _ := al.resolveSession(msg)
+		if _, ok := al.activeForks.LoadAndDelete(baseKey); !ok {
+			return "This chat is not using a fork.", true
+		}
+		return "Back on the main conversation. The fork is kept and can be resumed with /fork resume <key>.", true
+
 	case "/show":
 		if len(args) < 1 {
 			return "Usage: /show [model|channel|agents]", true
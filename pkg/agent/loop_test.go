@@ -5,12 +5,15 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/sipeed/picoclaw/pkg/bus"
 	"github.com/sipeed/picoclaw/pkg/config"
 	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/scheduler"
 	"github.com/sipeed/picoclaw/pkg/tools"
 )
 
@@ -628,3 +631,85 @@ func TestAgentLoop_ContextExhaustionRetry(t *testing.T) {
 		t.Errorf("Expected history to be compressed (len < 8), got %d", len(finalHistory))
 	}
 }
+
+func TestProcessScheduled(t *testing.T) {
+	provider := &summaryProvider{response: "Hi, how was your week?"}
+	al := newSummaryTestLoop(t, provider)
+	msg := bus.InboundMessage{Channel: "telegram", SenderID: "42", ChatID: "42", Content: "hello",
+		Metadata: map[string]string{"peer_kind": "direct", "peer_id": "42"}}
+	agent, sessionKey, _ := al.resolveSession(msg)
+	agent.Sessions.AddMessage(sessionKey, "user", "hello")
+
+	answer, err := al.ProcessScheduled(context.Background(), "[Scheduled task] Check in", "telegram", "42")
+	if err != nil || answer != provider.response {
+		t.Fatalf("ProcessScheduled() = %q, %v", answer, err)
+	}
+	if got := len(agent.Sessions.GetHistory(sessionKey)); got != 3 {
+		t.Errorf("turn ran outside the chat's session: it has %d messages, want 3", got)
+	}
+
+	// A turn with nothing to send leaves no trace in the session.
+	provider.response = scheduler.NothingToSend
+	if _, err := al.ProcessScheduled(context.Background(), "[Scheduled task] Digest", "telegram", "42"); err != nil {
+		t.Fatalf("ProcessScheduled: %v", err)
+	}
+	if got := len(agent.Sessions.GetHistory(sessionKey)); got != 3 {
+		t.Errorf("session has %d messages after a skipped task, want 3", got)
+	}
+}
+
+// messageSendingProvider has the model send its answer with the message
+// tool when the user asks for it, and answer directly otherwise.
+type messageSendingProvider struct{}
+
+func (p *messageSendingProvider) Chat(ctx context.Context, messages []providers.Message, defs []providers.ToolDefinition, model string, opts map[string]interface{}) (*providers.LLMResponse, error) {
+	last := messages[len(messages)-1]
+	if last.Role == "user" && strings.Contains(last.Content, "message tool") {
+		return &providers.LLMResponse{ToolCalls: []providers.ToolCall{{
+			ID:        "m1",
+			Name:      "message",
+			Arguments: map[string]interface{}{"content": "Your CT report is ready."},
+		}}}, nil
+	}
+	return &providers.LLMResponse{Content: "Done."}, nil
+}
+
+func (p *messageSendingProvider) GetDefaultModel() string {
+	return "test-model"
+}
+
+func TestAnswerMessage_MessageToolSendsPerTurn(t *testing.T) {
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				Model:             "test-model",
+				MaxTokens:         4096,
+				MaxToolIterations: 5,
+			},
+		},
+	}
+	msgBus := bus.NewMessageBus()
+	al := NewAgentLoop(cfg, msgBus, &messageSendingProvider{})
+	defer al.Stop()
+
+	al.answerMessage(context.Background(), bus.InboundMessage{Channel: "telegram", SenderID: "1", ChatID: "1", Content: "Use the message tool"})
+	al.answerMessage(context.Background(), bus.InboundMessage{Channel: "telegram", SenderID: "2", ChatID: "2", Content: "Hello"})
+
+	var got []string
+	for i := 0; i < 2; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		out, ok := msgBus.SubscribeOutbound(ctx)
+		cancel()
+		if !ok {
+			break
+		}
+		got = append(got, out.ChatID+": "+out.Content)
+	}
+	// The first turn's answer was sent by the tool, so only it goes to chat
+	// 1; the second turn did not use the tool, so its answer is published
+	want := []string{"1: Your CT report is ready.", "2: Done."}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("sent %q, want %q", got, want)
+	}
+}
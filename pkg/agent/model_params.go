@@ -0,0 +1,92 @@
+package agent
+
+import (
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+// Sampling parameters of turns whose channel and persona set none.
+const (
+	defaultTemperature = 0.7
+	defaultMaxTokens   = 8192
+)
+
+// modelParams returns the model parameters of a turn on channel: the
+// persona's, overridden field by field by the channel's.
+func (al *AgentLoop) modelParams(agent *AgentInstance, channel string) config.ModelParams {
+	var params config.ModelParams
+	if al.cfg == nil {
+		return params
+	}
+	if name := agent.ContextBuilder.PersonaName(channel); name != "" {
+		params = mergeModelParams(params, al.cfg.Agents.Personas.Params[name])
+	}
+	return mergeModelParams(params, al.cfg.Agents.ChannelParams[channel])
+}
+
+func mergeModelParams(base, over config.ModelParams) config.ModelParams {
+	if over.Model != "" {
+		base.Model = over.Model
+	}
+	if over.Temperature != nil {
+		base.Temperature = over.Temperature
+	}
+	if over.TopP != nil {
+		base.TopP = over.TopP
+	}
+	if over.MaxTokens > 0 {
+		base.MaxTokens = over.MaxTokens
+	}
+	if over.ReasoningEffort != "" {
+		base.ReasoningEffort = over.ReasoningEffort
+	}
+	if over.ThinkingBudget > 0 {
+		base.ThinkingBudget = over.ThinkingBudget
+	}
+	return base
+}
+
+// llmOptions returns the options of the agent's LLM calls with params.
+func llmOptions(agent *AgentInstance, params config.ModelParams) map[string]interface{} {
+	options := map[string]interface{}{
+		"max_tokens":  defaultMaxTokens,
+		"temperature": defaultTemperature,
+		// Calls of one agent share the system prompt and tools that start
+		// them, so they share a prompt cache
+		"prompt_cache_key": "picoclaw-" + agent.ID,
+	}
+	if params.MaxTokens > 0 {
+		options["max_tokens"] = params.MaxTokens
+	}
+	if params.Temperature != nil {
+		options["temperature"] = *params.Temperature
+	}
+	if params.TopP != nil {
+		options["top_p"] = *params.TopP
+	}
+	// Each provider turns these into its own reasoning controls
+	if params.ReasoningEffort != "" {
+		options["reasoning_effort"] = params.ReasoningEffort
+	}
+	if params.ThinkingBudget > 0 {
+		options["thinking_budget"] = params.ThinkingBudget
+	}
+	return options
+}
+
+// paramsModel returns the provider and model params set for the turn, and
+// the provider that serves them.
+func (al *AgentLoop) paramsModel(agent *AgentInstance, params config.ModelParams) (string, string, providers.LLMProvider) {
+	defaultProvider := ""
+	if al.cfg != nil {
+		defaultProvider = al.cfg.Agents.Defaults.Provider
+	}
+	ref := providers.ParseModelRef(params.Model, defaultProvider)
+	if ref == nil {
+		return "", agent.Model, agent.Provider
+	}
+	if len(agent.Candidates) > 0 && agent.Candidates[0].Provider == ref.Provider && agent.Candidates[0].Model == ref.Model {
+		return ref.Provider, ref.Model, agent.Provider
+	}
+	return ref.Provider, ref.Model, al.fallbackProvider(agent, ref.Provider, ref.Model)
+}
@@ -0,0 +1,92 @@
+package agent
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+// paramsRecordingProvider keeps the model and options of the last call.
+type paramsRecordingProvider struct {
+	model   string
+	options map[string]interface{}
+}
+
+func (p *paramsRecordingProvider) Chat(ctx context.Context, messages []providers.Message, defs []providers.ToolDefinition, model string, opts map[string]interface{}) (*providers.LLMResponse, error) {
+	p.model, p.options = model, opts
+	return &providers.LLMResponse{Content: "CA19-9 is a tumour marker."}, nil
+}
+
+func (p *paramsRecordingProvider) GetDefaultModel() string {
+	return "qwen-plus"
+}
+
+func TestProcessMessage_ModelParams(t *testing.T) {
+	low, topP := 0.2, 0.9
+	provider := &paramsRecordingProvider{}
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				Model:             "qwen-plus",
+				MaxTokens:         4096,
+				MaxToolIterations: 5,
+			},
+			Personas: config.PersonasConfig{
+				Enabled:  true,
+				Default:  "patient",
+				Channels: map[string]string{"slack": "clinician"},
+				Params: map[string]config.ModelParams{
+					"clinician": {Temperature: &low, MaxTokens: 16000},
+				},
+			},
+			ChannelParams: map[string]config.ModelParams{
+				"web":   {Model: "qwen-max", TopP: &topP, ReasoningEffort: "high"},
+				"slack": {MaxTokens: 12000},
+			},
+		},
+	}
+	al := NewAgentLoop(cfg, bus.NewMessageBus(), provider)
+	defer al.Stop()
+
+	tests := []struct {
+		channel         string
+		wantModel       string
+		wantTemperature float64
+		wantMaxTokens   int
+		wantTopP        interface{}
+		wantEffort      interface{}
+	}{
+		{"slack", "qwen-plus", 0.2, 12000, nil, nil},
+		{"web", "qwen-max", 0.7, 8192, 0.9, "high"},
+		{"telegram", "qwen-plus", 0.7, 8192, nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.channel, func(t *testing.T) {
+			_, err := al.processMessage(context.Background(), bus.InboundMessage{
+				Channel: tt.channel, SenderID: "1001", ChatID: "1001", Content: "What is CA19-9?",
+			})
+			if err != nil {
+				t.Fatalf("processMessage: %v", err)
+			}
+			if provider.model != tt.wantModel {
+				t.Errorf("model = %q, want %q", provider.model, tt.wantModel)
+			}
+			if got := provider.options["temperature"]; got != tt.wantTemperature {
+				t.Errorf("temperature = %v, want %v", got, tt.wantTemperature)
+			}
+			if got := provider.options["max_tokens"]; got != tt.wantMaxTokens {
+				t.Errorf("max_tokens = %v, want %v", got, tt.wantMaxTokens)
+			}
+			if got := provider.options["top_p"]; got != tt.wantTopP {
+				t.Errorf("top_p = %v, want %v", got, tt.wantTopP)
+			}
+			if got := provider.options["reasoning_effort"]; got != tt.wantEffort {
+				t.Errorf("reasoning_effort = %v, want %v", got, tt.wantEffort)
+			}
+		})
+	}
+}
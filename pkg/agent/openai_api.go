@@ -0,0 +1,379 @@
+package agent
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+// OpenAIChannel is the channel of turns asked through the OpenAI-compatible
+// API. It is internal: answers go back in the HTTP response, not the bus.
+const OpenAIChannel = "openai"
+
+// openAIModel is the model the OpenAI-compatible API lists and answers as.
+const openAIModel = "picoclaw"
+
+// openAIKeepAlive is how often a streamed completion sends a comment while
+// the agent works, so proxies do not close the connection.
+var openAIKeepAlive = 15 * time.Second
+
+type openAIChatRequest struct {
+	Model    string              `json:"model"`
+	Messages []openAIChatMessage `json:"messages"`
+	Stream   bool                `json:"stream"`
+	User     string              `json:"user"`
+}
+
+type openAIChatMessage struct {
+	Role    string          `json:"role"`
+	Content json.RawMessage `json:"content"`
+}
+
+// openAIContentPart is a part of a message with images.
+type openAIContentPart struct {
+	Type     string `json:"type"`
+	Text     string `json:"text"`
+	ImageURL struct {
+		URL string `json:"url"`
+	} `json:"image_url"`
+}
+
+// content returns the text of the message and the URLs of its images.
+func (m openAIChatMessage) content() (string, []string) {
+	var text string
+	if json.Unmarshal(m.Content, &text) == nil {
+		return text, nil
+	}
+	var parts []openAIContentPart
+	if json.Unmarshal(m.Content, &parts) != nil {
+		return "", nil
+	}
+	var texts, images []string
+	for _, p := range parts {
+		switch p.Type {
+		case "text":
+			texts = append(texts, p.Text)
+		case "image_url":
+			if p.ImageURL.URL != "" {
+				images = append(images, p.ImageURL.URL)
+			}
+		}
+	}
+	return strings.Join(texts, "\n"), images
+}
+
+// ChatCompletionsHandler serves POST /v1/chat/completions for gateway API
+// tokens, so that OpenAI clients talk to the agent with its tools,
+// knowledge base and guardrails. The client's conversation replaces the
+// session's history, so edited and regenerated messages are answered as
+// the client shows them; system messages from the client are ignored in
+// favour of the agent's own prompt. The session is the X-Session-ID
+// header, or else the "user" field and the first message. Senders and
+// sessions are namespaced by a hash of the token, so clients holding
+// different tokens cannot reach each other's profiles or conversations.
+func (al *AgentLoop) ChatCompletionsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeOpenAIError(w, http.StatusMethodNotAllowed, "invalid_request_error", "method not allowed")
+			return
+		}
+		token, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if _, ok := al.authenticate(r); !ok {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeOpenAIError(w, http.StatusUnauthorized, "invalid_api_key", "invalid or missing bearer token")
+			return
+		}
+
+		var req openAIChatRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 8<<20)).Decode(&req); err != nil {
+			writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", "invalid JSON: "+err.Error())
+			return
+		}
+		var dialogue []openAIChatMessage
+		for _, m := range req.Messages {
+			if m.Role == "user" || m.Role == "assistant" {
+				dialogue = append(dialogue, m)
+			}
+		}
+		if len(dialogue) == 0 || dialogue[len(dialogue)-1].Role != "user" {
+			writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", "the last message must be from the user")
+			return
+		}
+		question, images := dialogue[len(dialogue)-1].content()
+		media, cleanup, err := openAIMedia(images)
+		defer cleanup()
+		if err != nil {
+			writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", err.Error())
+			return
+		}
+		if strings.TrimSpace(question) == "" && len(media) == 0 {
+			writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", "the last message is empty")
+			return
+		}
+
+		// A turn runs far longer than the server's write timeout
+		http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+		tokenSum := sha256.Sum256([]byte(token))
+		tokenHash := hex.EncodeToString(tokenSum[:8])
+		userID := "api:" + tokenHash
+		if req.User != "" {
+			userID += ":" + req.User
+		}
+		conversation := r.Header.Get("X-Session-ID")
+		if conversation == "" {
+			first, _ := dialogue[0].content()
+			sum := sha256.Sum256([]byte(req.User + "\x00" + first))
+			conversation = hex.EncodeToString(sum[:8])
+		}
+		chatID := tokenHash + ":" + conversation
+		msg := bus.InboundMessage{
+			Channel:  OpenAIChannel,
+			SenderID: userID,
+			ChatID:   chatID,
+			Content:  question,
+			Media:    media,
+			Metadata: map[string]string{"peer_kind": "direct", "peer_id": chatID},
+		}
+		agent, _, _ := al.resolveSession(msg)
+		msg.SessionKey = fmt.Sprintf("agent:%s:%s:%s", agent.ID, OpenAIChannel, chatID)
+
+		history := make([]providers.Message, 0, len(dialogue)-1)
+		for _, m := range dialogue[:len(dialogue)-1] {
+			text, _ := m.content()
+			history = append(history, providers.Message{Role: m.Role, Content: text})
+		}
+		agent.Sessions.GetOrCreate(msg.SessionKey)
+		agent.Sessions.SetHistory(msg.SessionKey, history)
+
+		model := req.Model
+		if model == "" {
+			model = openAIModel
+		}
+		completion := openAICompletion{
+			ID:      "chatcmpl-" + strings.ReplaceAll(uuid.New().String(), "-", ""),
+			Created: time.Now().Unix(),
+			Model:   model,
+		}
+		promptTokens := agent.Tokens.Messages(append(history, providers.Message{Role: "user", Content: question}))
+
+		if !req.Stream {
+			answer, err := al.processMessage(r.Context(), msg)
+			if err != nil {
+				al.logOpenAIError(msg, err)
+				writeOpenAIError(w, http.StatusInternalServerError, "server_error", err.Error())
+				return
+			}
+			completion.Object = "chat.completion"
+			completion.Choices = []openAIChoice{{
+				Message:      &openAIDelta{Role: "assistant", Content: answer},
+				FinishReason: "stop",
+			}}
+			completion.Usage = openAIUsageFor(promptTokens, agent.Tokens.Count(answer))
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(completion)
+			return
+		}
+
+		al.streamCompletion(w, r, msg, completion)
+	})
+}
+
+// streamCompletion answers as server-sent chunks. The agent's answer is
+// only known once its turn ends; until then the stream sends comments.
+func (al *AgentLoop) streamCompletion(w http.ResponseWriter, r *http.Request, msg bus.InboundMessage, completion openAICompletion) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeOpenAIError(w, http.StatusInternalServerError, "server_error", "streaming unsupported")
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	completion.Object = "chat.completion.chunk"
+	send := func(delta openAIDelta, finish string) {
+		chunk := completion
+		chunk.Choices = []openAIChoice{{Delta: &delta, FinishReason: finish}}
+		data, _ := json.Marshal(chunk)
+		fmt.Fprintf(w, "data: %s\n\n", data)
+		flusher.Flush()
+	}
+	send(openAIDelta{Role: "assistant"}, "")
+
+	type result struct {
+		answer string
+		err    error
+	}
+	done := make(chan result, 1)
+	go func() {
+		answer, err := al.processMessage(r.Context(), msg)
+		done <- result{answer, err}
+	}()
+
+	keepAlive := time.NewTicker(openAIKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+			flusher.Flush()
+			continue
+		case res := <-done:
+			if res.err != nil {
+				al.logOpenAIError(msg, res.err)
+				data, _ := json.Marshal(map[string]interface{}{
+					"error": map[string]string{"message": res.err.Error(), "type": "server_error"},
+				})
+				fmt.Fprintf(w, "data: %s\n\n", data)
+			} else {
+				for _, piece := range splitAnswer(res.answer, 512) {
+					send(openAIDelta{Content: piece}, "")
+				}
+				send(openAIDelta{}, "stop")
+			}
+			fmt.Fprint(w, "data: [DONE]\n\n")
+			flusher.Flush()
+			return
+		}
+	}
+}
+
+func (al *AgentLoop) logOpenAIError(msg bus.InboundMessage, err error) {
+	logger.WarnCF("agent", "OpenAI-compatible API turn failed", map[string]interface{}{
+		"session_key": msg.SessionKey,
+		"error":       err.Error(),
+	})
+}
+
+// splitAnswer cuts answer into pieces of at most size bytes, between
+// characters, for streaming.
+func splitAnswer(answer string, size int) []string {
+	var pieces []string
+	for len(answer) > size {
+		cut := size
+		for cut > 0 && !utf8.RuneStart(answer[cut]) {
+			cut--
+		}
+		pieces = append(pieces, answer[:cut])
+		answer = answer[cut:]
+	}
+	if answer != "" {
+		pieces = append(pieces, answer)
+	}
+	return pieces
+}
+
+// openAIMedia writes the message's images, which must be base64 data URLs,
+// to temporary files that cleanup removes, and returns the copies kept of
+// them as the channels do for the files they receive. Other URLs are
+// refused: the agent would read a path from the server's disk and fetch
+// any URL from inside its network.
+func openAIMedia(images []string) ([]string, func(), error) {
+	var files []string
+	cleanup := func() {
+		for _, f := range files {
+			os.Remove(f)
+		}
+	}
+	for _, img := range images {
+		header, encoded, ok := strings.Cut(img, ";base64,")
+		if !ok || !strings.HasPrefix(header, "data:") {
+			return nil, cleanup, fmt.Errorf("image_url must be a base64 data: URL")
+		}
+		data, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, cleanup, fmt.Errorf("image_url is not valid base64: %w", err)
+		}
+		f, err := os.CreateTemp("", "picoclaw-api-*.img")
+		if err != nil {
+			continue
+		}
+		_, err = f.Write(data)
+		f.Close()
+		if err != nil {
+			os.Remove(f.Name())
+			continue
+		}
+		files = append(files, f.Name())
+	}
+	media, _ := utils.KeepMedia(files, utils.MediaLimits{})
+	return media, cleanup, nil
+}
+
+type openAICompletion struct {
+	ID      string         `json:"id"`
+	Object  string         `json:"object"`
+	Created int64          `json:"created"`
+	Model   string         `json:"model"`
+	Choices []openAIChoice `json:"choices"`
+	Usage   *openAIUsage   `json:"usage,omitempty"`
+}
+
+type openAIChoice struct {
+	Index        int          `json:"index"`
+	Message      *openAIDelta `json:"message,omitempty"`
+	Delta        *openAIDelta `json:"delta,omitempty"`
+	FinishReason string       `json:"finish_reason,omitempty"`
+}
+
+type openAIDelta struct {
+	Role    string `json:"role,omitempty"`
+	Content string `json:"content,omitempty"`
+}
+
+// openAIUsage is counted with the agent's tokenizer from the conversation
+// and the answer; the tool calls of the turn are not included.
+type openAIUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+func openAIUsageFor(prompt, completion int) *openAIUsage {
+	return &openAIUsage{PromptTokens: prompt, CompletionTokens: completion, TotalTokens: prompt + completion}
+}
+
+// ModelsHandler serves GET /v1/models, which OpenAI clients call to list
+// the models they can pick: the agent, as "picoclaw".
+func (al *AgentLoop) ModelsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := al.authenticate(r); !ok {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeOpenAIError(w, http.StatusUnauthorized, "invalid_api_key", "invalid or missing bearer token")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"object": "list",
+			"data": []map[string]interface{}{
+				{"id": openAIModel, "object": "model", "created": 0, "owned_by": "picoclaw"},
+			},
+		})
+	})
+}
+
+// writeOpenAIError writes an error the way the OpenAI API does, which its
+// clients show to the user.
+func writeOpenAIError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": map[string]string{"message": message, "type": code},
+	})
+}
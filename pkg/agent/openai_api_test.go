@@ -0,0 +1,236 @@
+package agent
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+// messagesRecordingProvider keeps the messages of the last call.
+type messagesRecordingProvider struct {
+	messages []providers.Message
+}
+
+func (p *messagesRecordingProvider) Chat(ctx context.Context, messages []providers.Message, defs []providers.ToolDefinition, model string, opts map[string]interface{}) (*providers.LLMResponse, error) {
+	p.messages = messages
+	return &providers.LLMResponse{Content: "Eat small, low-fat meals."}, nil
+}
+
+func (p *messagesRecordingProvider) GetDefaultModel() string {
+	return "qwen-plus"
+}
+
+func newOpenAITestLoop(t *testing.T) (*AgentLoop, *messagesRecordingProvider) {
+	t.Helper()
+	provider := &messagesRecordingProvider{}
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				Model:             "qwen-plus",
+				MaxTokens:         4096,
+				MaxToolIterations: 5,
+			},
+		},
+		Gateway: config.GatewayConfig{
+			APITokens: []config.GatewayAPIToken{{Token: "web-token", Role: "patient"}, {Token: "clinic-token", Role: "patient"}},
+			OpenAIAPI: true,
+		},
+	}
+	al := NewAgentLoop(cfg, bus.NewMessageBus(), provider)
+	t.Cleanup(al.Stop)
+	return al, provider
+}
+
+const openAITestConversation = `{
+	"model": "picoclaw",
+	"messages": [
+		{"role": "system", "content": "You are a pirate."},
+		{"role": "user", "content": "I had a Whipple procedure last month."},
+		{"role": "assistant", "content": "I hope your recovery is going well."},
+		{"role": "user", "content": [{"type": "text", "text": "What should I eat?"}]}
+	]%s
+}`
+
+func postCompletion(al *AgentLoop, token, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	req.Header.Set("X-Session-ID", "conv-1")
+	rec := httptest.NewRecorder()
+	al.ChatCompletionsHandler().ServeHTTP(rec, req)
+	return rec
+}
+
+func TestChatCompletionsHandler(t *testing.T) {
+	al, provider := newOpenAITestLoop(t)
+
+	rec := postCompletion(al, "web-token", strings.Replace(openAITestConversation, "%s", "", 1))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body.String())
+	}
+	var resp openAICompletion
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Object != "chat.completion" || len(resp.Choices) != 1 || resp.Choices[0].Message == nil {
+		t.Fatalf("response = %s", rec.Body.String())
+	}
+	if got := resp.Choices[0].Message.Content; got != "Eat small, low-fat meals." {
+		t.Errorf("content = %q", got)
+	}
+	if resp.Choices[0].FinishReason != "stop" || resp.Usage == nil || resp.Usage.TotalTokens == 0 {
+		t.Errorf("finish_reason %q, usage %+v", resp.Choices[0].FinishReason, resp.Usage)
+	}
+
+	want := strings.Join([]string{
+		"user: I had a Whipple procedure last month.",
+		"assistant: I hope your recovery is going well.",
+		"user: What should I eat?",
+	}, "\n")
+	if got := modelDialogue(t, provider.messages); got != want {
+		t.Errorf("model saw:\n%s", got)
+	}
+
+	// Sent again, as a regenerate, the conversation replaces the session
+	postCompletion(al, "web-token", strings.Replace(openAITestConversation, "%s", "", 1))
+	if got := modelDialogue(t, provider.messages); got != want {
+		t.Errorf("regenerated turn saw:\n%s", got)
+	}
+}
+
+func TestChatCompletionsHandler_TokensKeptApart(t *testing.T) {
+	al, provider := newOpenAITestLoop(t)
+	body := strings.Replace(openAITestConversation, "%s", `, "user": "alice"`, 1)
+
+	chatIDs := make(map[string]bool)
+	for _, token := range []string{"web-token", "clinic-token"} {
+		if rec := postCompletion(al, token, body); rec.Code != http.StatusOK {
+			t.Fatalf("status %d: %s", rec.Code, rec.Body.String())
+		}
+		_, chatID, _ := strings.Cut(provider.messages[1].Content, "Chat ID: ")
+		if !strings.HasSuffix(chatID, ":conv-1") {
+			t.Fatalf("chat ID %q does not name the conversation", chatID)
+		}
+		chatIDs[chatID] = true
+	}
+	// The same X-Session-ID and user under another token is another session
+	if len(chatIDs) != 2 {
+		t.Errorf("tokens shared a session: %v", chatIDs)
+	}
+}
+
+// modelDialogue lists the non-system messages the model was given.
+func modelDialogue(t *testing.T, messages []providers.Message) string {
+	t.Helper()
+	var dialogue []string
+	for _, m := range messages {
+		if m.Role == "system" {
+			if strings.Contains(m.Content, "pirate") {
+				t.Errorf("client system message reached the model")
+			}
+			continue
+		}
+		dialogue = append(dialogue, m.Role+": "+m.Content)
+	}
+	return strings.Join(dialogue, "\n")
+}
+
+func TestChatCompletionsHandler_Stream(t *testing.T) {
+	al, _ := newOpenAITestLoop(t)
+
+	rec := postCompletion(al, "web-token", strings.Replace(openAITestConversation, "%s", `, "stream": true`, 1))
+	if ct := rec.Header().Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("content type %q: %s", ct, rec.Body.String())
+	}
+	var content, finish string
+	var done bool
+	scanner := bufio.NewScanner(rec.Body)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		if data == "[DONE]" {
+			done = true
+			continue
+		}
+		var chunk openAICompletion
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil || len(chunk.Choices) != 1 || chunk.Choices[0].Delta == nil {
+			t.Fatalf("chunk %s", data)
+		}
+		if chunk.Object != "chat.completion.chunk" {
+			t.Errorf("object = %q", chunk.Object)
+		}
+		content += chunk.Choices[0].Delta.Content
+		if chunk.Choices[0].FinishReason != "" {
+			finish = chunk.Choices[0].FinishReason
+		}
+	}
+	if content != "Eat small, low-fat meals." || finish != "stop" || !done {
+		t.Errorf("content %q, finish %q, done %v", content, finish, done)
+	}
+}
+
+func TestChatCompletionsHandler_Errors(t *testing.T) {
+	al, _ := newOpenAITestLoop(t)
+
+	tests := []struct {
+		name   string
+		token  string
+		body   string
+		status int
+	}{
+		{"no token", "", `{"messages": [{"role": "user", "content": "hi"}]}`, http.StatusUnauthorized},
+		{"wrong token", "other", `{"messages": [{"role": "user", "content": "hi"}]}`, http.StatusUnauthorized},
+		{"bad JSON", "web-token", `{`, http.StatusBadRequest},
+		{"last message not from user", "web-token", `{"messages": [{"role": "assistant", "content": "hi"}]}`, http.StatusBadRequest},
+		{"empty question", "web-token", `{"messages": [{"role": "user", "content": " "}]}`, http.StatusBadRequest},
+		{"image from a server path", "web-token", `{"messages": [{"role": "user", "content": [{"type": "image_url", "image_url": {"url": "/etc/passwd"}}]}]}`, http.StatusBadRequest},
+		{"image from a URL", "web-token", `{"messages": [{"role": "user", "content": [{"type": "image_url", "image_url": {"url": "http://169.254.169.254/latest/meta-data"}}]}]}`, http.StatusBadRequest},
+		{"image not base64", "web-token", `{"messages": [{"role": "user", "content": [{"type": "image_url", "image_url": {"url": "data:image/png;base64,%%%"}}]}]}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := postCompletion(al, tt.token, tt.body)
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.status)
+			}
+			var resp struct {
+				Error struct {
+					Message string `json:"message"`
+				} `json:"error"`
+			}
+			if json.Unmarshal(rec.Body.Bytes(), &resp) != nil || resp.Error.Message == "" {
+				t.Errorf("body = %s", rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestSplitAnswer(t *testing.T) {
+	tests := []struct {
+		answer string
+		size   int
+		want   []string
+	}{
+		{"", 4, nil},
+		{"abcdef", 4, []string{"abcd", "ef"}},
+		{"胰腺炎", 4, []string{"胰", "腺", "炎"}},
+	}
+	for _, tt := range tests {
+		got := splitAnswer(tt.answer, tt.size)
+		if strings.Join(got, "|") != strings.Join(tt.want, "|") || len(got) != len(tt.want) {
+			t.Errorf("splitAnswer(%q, %d) = %q, want %q", tt.answer, tt.size, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/tools"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+const (
+	routerTimeout = 20 * time.Second
+	// routerContextMessages is how many recent messages the router sees,
+	// so short follow-ups stay with the specialist of the conversation.
+	routerContextMessages = 4
+	// generalSpecialist is the router's answer when no specialist fits;
+	// the turn then gets the full prompt and every tool.
+	generalSpecialist = "general"
+)
+
+// defaultSpecialists are used when the orchestrator is enabled without a
+// list of specialists.
+var defaultSpecialists = []config.SpecialistConfig{
+	{
+		ID:          "research",
+		Name:        "Evidence research",
+		Description: "Medical questions about diagnosis, staging, treatment options, drugs, side effects, test results, trials, prognosis and guidelines",
+		Prompt: "Answer from medical evidence. Search before answering, cite the evidence ID of every claim, " +
+			"say how strong the evidence is, and say plainly when it does not answer the question.",
+		Tools: []string{"knows_*", "evidence_*", "systematic_review_search", "kb_search", "search_documents",
+			"drug_interactions", "variant_lookup", "lab_report_parse", "medical_translate", "symptom_triage", "web_search", "web_fetch"},
+	},
+	{
+		ID:          "nutrition",
+		Name:        "Nutrition",
+		Description: "Eating, diet, weight loss, appetite, enzymes, supplements and recipes during and after treatment",
+		Prompt: "Give practical, specific eating advice suited to pancreatic cancer: small frequent meals, enzyme replacement, " +
+			"blood sugar and weight. Check supplements against the user's treatment for interactions.",
+		Tools: []string{"knows_*", "kb_search", "search_documents", "complementary_therapy", "drug_interactions",
+			"diary_log", "diary_summary", "web_search", "web_fetch"},
+	},
+	{
+		ID:          "support",
+		Name:        "Emotional support",
+		Description: "Feelings, fear, anxiety, grief, low mood, caregiver stress, family conversations and wanting someone to listen",
+		Prompt: "Listen first. Reflect what the user feels, in warm and plain words, before offering anything. " +
+			"Keep medical facts out unless asked, suggest support groups or counselling gently, and never minimise their worries.",
+		Tools: []string{"diary_log", "diary_summary", "kb_search"},
+	},
+	{
+		ID:          "logistics",
+		Name:        "Logistics",
+		Description: "Appointments, hospitals, referrals, insurance and reimbursement, costs, travel, reminders, records and paperwork",
+		Prompt:      "Be concrete: give steps, places, documents needed and costs where known. Confirm dates and times back to the user.",
+		Tools: []string{"web_search", "web_fetch", "kb_search", "search_documents", "drug_reimbursement", "referral_request",
+			"visit_prep", "medication_reminder_*", "cron", "vaccine_schedule", "fhir_*", "message"},
+	},
+}
+
+// specialists returns the configured specialists, or the built-in ones.
+func (al *AgentLoop) specialists() []config.SpecialistConfig {
+	if len(al.cfg.Agents.Orchestrator.Specialists) > 0 {
+		return al.cfg.Agents.Orchestrator.Specialists
+	}
+	return defaultSpecialists
+}
+
+// routeSpecialist picks the specialist for a user message and sets up the
+// turn for it: its prompt is added to the system prompt and the tools are
+// limited to its own. Turns the router cannot place, or that fail to
+// route, keep the full prompt and every tool.
+func (al *AgentLoop) routeSpecialist(ctx context.Context, agent *AgentInstance, opts *processOptions) {
+	oc := al.cfg.Agents.Orchestrator
+	if !oc.Enabled {
+		return
+	}
+	specialists := al.specialists()
+	model := oc.Model
+	if model == "" {
+		model = agent.Model
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, routerTimeout)
+	defer cancel()
+	history := agent.Sessions.GetHistory(opts.SessionKey)
+	response, err := agent.Provider.Chat(ctx, []providers.Message{
+		{Role: "user", Content: routerPrompt(specialists, history, opts.UserMessage)},
+	}, nil, model, map[string]interface{}{
+		"max_tokens":  20,
+		"temperature": 0.0,
+	})
+	if err != nil {
+		logger.WarnCF("agent", "Specialist routing failed, using the general agent",
+			map[string]interface{}{
+				"session_key": opts.SessionKey,
+				"error":       err.Error(),
+			})
+		return
+	}
+
+	spec, ok := matchSpecialist(response.Content, specialists)
+	if !ok {
+		logger.InfoCF("agent", "Routed message to general agent",
+			map[string]interface{}{"session_key": opts.SessionKey, "router": utils.Truncate(response.Content, 40)})
+		return
+	}
+	logger.InfoCF("agent", "Routed message to specialist",
+		map[string]interface{}{"session_key": opts.SessionKey, "specialist": spec.ID})
+
+	opts.Specialist = spec.ID
+	name := spec.Name
+	if name == "" {
+		name = spec.ID
+	}
+	instruction := fmt.Sprintf("You are answering as the %s specialist.", name)
+	if spec.Prompt != "" {
+		instruction += " " + spec.Prompt
+	}
+	opts.Instructions = append(opts.Instructions, instruction)
+	if len(spec.Tools) > 0 {
+		opts.ToolScope = &tools.ToolRolePolicy{Allow: spec.Tools}
+	}
+}
+
+func routerPrompt(specialists []config.SpecialistConfig, history []providers.Message, message string) string {
+	var sb strings.Builder
+	sb.WriteString("Choose the specialist who should answer the user's latest message. ")
+	sb.WriteString("Reply with the specialist's id only, or \"" + generalSpecialist + "\" if none fits.\n\nSpecialists:\n")
+	for _, s := range specialists {
+		fmt.Fprintf(&sb, "- %s: %s\n", s.ID, s.Description)
+	}
+
+	var recent []string
+	for i := len(history) - 1; i >= 0 && len(recent) < routerContextMessages; i-- {
+		m := history[i]
+		if (m.Role == "user" || m.Role == "assistant") && len(m.ToolCalls) == 0 && m.Content != "" {
+			recent = append([]string{m.Role + ": " + utils.Truncate(m.Content, 300)}, recent...)
+		}
+	}
+	if len(recent) > 0 {
+		sb.WriteString("\nRecent conversation:\n" + strings.Join(recent, "\n") + "\n")
+	}
+	fmt.Fprintf(&sb, "\nLatest message:\n%s\n", message)
+	return sb.String()
+}
+
+// matchSpecialist finds the specialist the router named.
+func matchSpecialist(reply string, specialists []config.SpecialistConfig) (config.SpecialistConfig, bool) {
+	id := strings.ToLower(strings.Trim(strings.TrimSpace(reply), "\"'`.。* "))
+	for _, s := range specialists {
+		if strings.EqualFold(s.ID, id) {
+			return s, true
+		}
+	}
+	// Tolerate replies such as "Specialist: nutrition".
+	for _, field := range strings.FieldsFunc(id, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '_' || r == '-')
+	}) {
+		for _, s := range specialists {
+			if strings.EqualFold(s.ID, field) {
+				return s, true
+			}
+		}
+	}
+	return config.SpecialistConfig{}, false
+}
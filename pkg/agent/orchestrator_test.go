@@ -0,0 +1,117 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+func TestMatchSpecialist(t *testing.T) {
+	tests := []struct {
+		reply string
+		want  string
+	}{
+		{"nutrition", "nutrition"},
+		{" \"Support\".", "support"},
+		{"Specialist: logistics", "logistics"},
+		{"general", ""},
+		{"I'm not sure", ""},
+	}
+	for _, tt := range tests {
+		spec, ok := matchSpecialist(tt.reply, defaultSpecialists)
+		if ok != (tt.want != "") || spec.ID != tt.want {
+			t.Errorf("matchSpecialist(%q) = %q, %v; want %q", tt.reply, spec.ID, ok, tt.want)
+		}
+	}
+}
+
+// routingProvider answers router prompts with route, and other calls with
+// "ok", keeping the system prompt and tools of the last answer call.
+type routingProvider struct {
+	route  string
+	err    error
+	system string
+	defs   []string
+}
+
+func (p *routingProvider) Chat(ctx context.Context, messages []providers.Message, defs []providers.ToolDefinition, model string, opts map[string]interface{}) (*providers.LLMResponse, error) {
+	if strings.HasPrefix(messages[0].Content, "Choose the specialist") {
+		if p.err != nil {
+			return nil, p.err
+		}
+		return &providers.LLMResponse{Content: p.route}, nil
+	}
+	p.system = systemText(messages)
+	p.defs = p.defs[:0]
+	for _, def := range defs {
+		p.defs = append(p.defs, def.Function.Name)
+	}
+	sort.Strings(p.defs)
+	return &providers.LLMResponse{Content: "ok"}, nil
+}
+
+func (p *routingProvider) GetDefaultModel() string {
+	return "test-model"
+}
+
+func TestRouteSpecialist(t *testing.T) {
+	provider := &routingProvider{route: "diet"}
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				Model:             "test-model",
+				MaxTokens:         4096,
+				MaxToolIterations: 5,
+			},
+			Orchestrator: config.OrchestratorConfig{
+				Enabled: true,
+				Specialists: []config.SpecialistConfig{{
+					ID:          "diet",
+					Name:        "Nutrition",
+					Description: "Food and eating",
+					Prompt:      "Suggest small frequent meals.",
+					Tools:       []string{"list_*"},
+				}},
+			},
+		},
+	}
+	al := NewAgentLoop(cfg, bus.NewMessageBus(), provider)
+	msg := bus.InboundMessage{Channel: "telegram", SenderID: "7", ChatID: "7", Content: "What can I eat after surgery?"}
+
+	if _, err := al.processMessage(context.Background(), msg); err != nil {
+		t.Fatalf("processMessage: %v", err)
+	}
+	if !strings.Contains(provider.system, "as the Nutrition specialist. Suggest small frequent meals.") {
+		t.Error("specialist prompt missing from system prompt")
+	}
+	if len(provider.defs) != 1 || provider.defs[0] != "list_dir" {
+		t.Errorf("specialist was offered %v, want [list_dir]", provider.defs)
+	}
+
+	// Calls outside the specialist's tools are refused.
+	agent := al.registry.GetDefaultAgent()
+	ctx := tools.WithCallMetadata(context.Background(), tools.CallMetadata{Scope: &tools.ToolRolePolicy{Allow: []string{"list_*"}}})
+	result := agent.Tools.ExecuteWithContext(ctx, "read_file", map[string]interface{}{"path": "x"}, "", "", nil)
+	if !errors.Is(result.Err, tools.ErrPermissionDenied) {
+		t.Errorf("out-of-scope call: %+v", result)
+	}
+
+	// Without a route the turn keeps every tool, in the same session.
+	provider.err = errors.New("router down")
+	al.processMessage(context.Background(), msg)
+	if strings.Contains(provider.system, "Nutrition specialist") || len(provider.defs) < 5 {
+		t.Errorf("general turn: prompt scoped or tools %v", provider.defs)
+	}
+	_, sessionKey, _ := al.resolveSession(msg)
+	if got := len(agent.Sessions.GetHistory(sessionKey)); got != 4 {
+		t.Errorf("session has %d messages, want both turns (4)", got)
+	}
+}
@@ -0,0 +1,63 @@
+package agent
+
+import (
+	"sort"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+// setupPipelines registers the configured pipeline tools for every agent
+// that has all the tools they call. A pipeline never replaces an existing
+// tool of the same name.
+func setupPipelines(cfg *config.Config, registry *AgentRegistry) {
+	names := make([]string, 0, len(cfg.Tools.Pipelines))
+	for name := range cfg.Tools.Pipelines {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, agentID := range registry.ListAgentIDs() {
+		agent, ok := registry.GetAgent(agentID)
+		if !ok {
+			continue
+		}
+		for _, name := range names {
+			if _, exists := agent.Tools.Get(name); exists {
+				logger.WarnCF("agent", "Pipeline shadows an existing tool, skipping",
+					map[string]interface{}{
+						"agent_id": agentID,
+						"pipeline": name,
+					})
+				continue
+			}
+			pipeline, err := tools.NewPipelineTool(name, cfg.Tools.Pipelines[name], agent.Tools)
+			if err != nil {
+				logger.WarnCF("agent", "Invalid pipeline, skipping",
+					map[string]interface{}{
+						"pipeline": name,
+						"error":    err.Error(),
+					})
+				continue
+			}
+			missing := ""
+			for _, step := range pipeline.Tools() {
+				if _, ok := agent.Tools.Get(step); !ok {
+					missing = step
+					break
+				}
+			}
+			if missing != "" {
+				logger.WarnCF("agent", "Pipeline calls an unavailable tool, skipping",
+					map[string]interface{}{
+						"agent_id": agentID,
+						"pipeline": name,
+						"tool":     missing,
+					})
+				continue
+			}
+			agent.Tools.Register(pipeline)
+		}
+	}
+}
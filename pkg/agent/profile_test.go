@@ -0,0 +1,83 @@
+package agent
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/persona"
+	"github.com/sipeed/picoclaw/pkg/profile"
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+func TestAddUserProfile(t *testing.T) {
+	cb := NewContextBuilder(t.TempDir())
+	messages := []providers.Message{{Role: "system", Content: "base"}, {Role: "user", Content: "hi"}}
+	if got := cb.AddUserProfile(messages, "42"); got[0].Content != "base" {
+		t.Errorf("without profiles: %q", got[0].Content)
+	}
+
+	store := profile.NewStore(t.TempDir())
+	cb.SetProfiles(store)
+	store.Update("42", func(p *profile.Profile) {
+		p.Diagnosis = "胰腺导管腺癌"
+		p.Language = "简体中文"
+	})
+
+	got := cb.AddUserProfile(messages, "42|Li Wei")[0].Content
+	for _, want := range []string{"## User Profile", "- Diagnosis: 胰腺导管腺癌", "Reply in 简体中文"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("system prompt lacks %q:\n%s", want, got)
+		}
+	}
+
+	other := []providers.Message{{Role: "system", Content: "base"}}
+	if got := cb.AddUserProfile(other, "7")[0].Content; got != "base" {
+		t.Errorf("user without a profile: %q", got)
+	}
+}
+
+func TestAddPersona(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "caregiver.md"), []byte("Speak to the family of a {{.Profile.Diagnosis}} patient."), 0644)
+
+	cb := NewContextBuilder(t.TempDir())
+	profiles := profile.NewStore(t.TempDir())
+	profiles.Update("42", func(p *profile.Profile) { p.Diagnosis = "PDAC" })
+	cb.SetProfiles(profiles)
+	system := func() []providers.Message { return []providers.Message{{Role: "system", Content: "base"}} }
+	if got := cb.AddPersona(system(), "telegram", "1", "42")[0].Content; got != "base" {
+		t.Errorf("without personas: %q", got)
+	}
+
+	cb.SetPersonas(persona.NewStore(dir), "patient", map[string]string{"slack": "clinician", "wecom": "caregiver", "cli": ""})
+	tests := []struct {
+		channel string
+		want    string
+	}{
+		{"telegram", "patient educator"},
+		{"slack", "terse and clinical"},
+		{"wecom", "Speak to the family of a PDAC patient."},
+		{"cli", ""},
+	}
+	for _, tt := range tests {
+		got := cb.AddPersona(system(), tt.channel, "1", "42|Li Wei")[0].Content
+		if tt.want == "" {
+			if got != "base" {
+				t.Errorf("%s: persona added without one configured: %q", tt.channel, got)
+			}
+			continue
+		}
+		if !strings.Contains(got, "## Persona") || !strings.Contains(got, tt.want) {
+			t.Errorf("%s: system prompt = %q, want %q", tt.channel, got, tt.want)
+		}
+	}
+
+	// With a turn context after the system prompt, the persona goes there
+	split := []providers.Message{{Role: "system", Content: "base"}, {Role: "system", Content: "turn"}}
+	got := cb.AddPersona(split, "slack", "1", "42")
+	if got[0].Content != "base" || !strings.Contains(got[1].Content, "terse and clinical") {
+		t.Errorf("persona in %q / %q, want the turn context", got[0].Content, got[1].Content)
+	}
+}
@@ -0,0 +1,111 @@
+package agent
+
+import (
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+// progressInterval is the least time between progress messages in a turn.
+// The first is sent no sooner than this after the turn starts, so quick
+// turns send none.
+var progressInterval = 5 * time.Second
+
+// progressReporter forwards tool progress, streamed tool output and the
+// answer being drafted to the chat a turn is answering.
+// Updates arriving too soon after the last one are dropped, and nothing is
+// sent once the turn has ended, even by background jobs still running.
+type progressReporter struct {
+	bus     *bus.MessageBus
+	channel string
+	chatID  string
+
+	mu     sync.Mutex
+	last   time.Time
+	closed bool
+	output string // tail of the output streamed so far
+}
+
+// maxStreamChars bounds how much of a tool's latest output a stream update
+// shows.
+const maxStreamChars = 1500
+
+func newProgressReporter(msgBus *bus.MessageBus, channel, chatID string) *progressReporter {
+	return &progressReporter{bus: msgBus, channel: channel, chatID: chatID, last: time.Now()}
+}
+
+func (r *progressReporter) report(p tools.Progress) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.publish(p.String(), false)
+}
+
+// stream shows the tail of a streaming tool's output, subject to the same
+// throttling as progress updates.
+func (r *progressReporter) stream(chunk string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.output = streamTail(r.output + chunk)
+	if text := strings.TrimSpace(r.output); text != "" {
+		r.publish(text, true)
+	}
+}
+
+// drafter returns a StreamFunc that shows the text of one LLM reply as the
+// model writes it, as a stream update subject to the same throttling.
+// Each reply gets its own drafter, so a retried call starts afresh.
+func (r *progressReporter) drafter() providers.StreamFunc {
+	var reply string
+	return func(chunk providers.StreamChunk) {
+		if chunk.Delta == "" {
+			return
+		}
+		reply = streamTail(reply + chunk.Delta)
+		if text := strings.TrimSpace(reply); text != "" {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			r.publish(text, true)
+		}
+	}
+}
+
+func (r *progressReporter) publish(content string, stream bool) {
+	if r.closed || time.Since(r.last) < progressInterval {
+		return
+	}
+	r.last = time.Now()
+	r.bus.PublishOutbound(bus.OutboundMessage{
+		Channel:  r.channel,
+		ChatID:   r.chatID,
+		Content:  content,
+		Progress: true,
+		Stream:   stream,
+	})
+}
+
+// streamTail keeps the last maxStreamChars of s, starting at a line break
+// when there is one, and never in the middle of a character.
+func streamTail(s string) string {
+	if len(s) <= maxStreamChars {
+		return s
+	}
+	s = s[len(s)-maxStreamChars:]
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		return s[i+1:]
+	}
+	for len(s) > 0 && !utf8.RuneStart(s[0]) {
+		s = s[1:]
+	}
+	return s
+}
+
+func (r *progressReporter) close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.closed = true
+}
@@ -0,0 +1,104 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+func TestProgressReporter_ThrottlesAndStopsWhenClosed(t *testing.T) {
+	saved := progressInterval
+	progressInterval = 50 * time.Millisecond
+	defer func() { progressInterval = saved }()
+
+	msgBus := bus.NewMessageBus()
+	r := newProgressReporter(msgBus, "telegram", "42")
+	ctx := tools.WithProgress(context.Background(), r.report)
+
+	// Too early: the turn has only just started.
+	tools.ReportProgress(ctx, tools.Progress{Done: 1, Total: 8})
+	time.Sleep(60 * time.Millisecond)
+	tools.ReportProgress(ctx, tools.Progress{Done: 2, Total: 8, Message: "已检索 2/8 篇文献…"})
+	tools.ReportProgress(ctx, tools.Progress{Done: 3, Total: 8})
+
+	got := drainOutbound(msgBus)
+	if len(got) != 1 || got[0].Content != "已检索 2/8 篇文献…" || !got[0].Progress || got[0].ChatID != "42" {
+		t.Fatalf("unexpected progress messages: %+v", got)
+	}
+
+	r.close()
+	time.Sleep(60 * time.Millisecond)
+	tools.ReportProgress(ctx, tools.Progress{Done: 8, Total: 8})
+	if got := drainOutbound(msgBus); len(got) != 0 {
+		t.Errorf("progress sent after the turn ended: %+v", got)
+	}
+}
+
+func drainOutbound(msgBus *bus.MessageBus) []bus.OutboundMessage {
+	var out []bus.OutboundMessage
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		msg, ok := msgBus.SubscribeOutbound(ctx)
+		cancel()
+		if !ok {
+			return out
+		}
+		out = append(out, msg)
+	}
+}
+
+func TestProgressReporter_StreamsOutputTail(t *testing.T) {
+	saved := progressInterval
+	progressInterval = 0
+	defer func() { progressInterval = saved }()
+
+	msgBus := bus.NewMessageBus()
+	r := newProgressReporter(msgBus, "telegram", "42")
+	r.stream("building...\n")
+	r.stream(strings.Repeat("x", maxStreamChars) + "\nstep 2 done\n")
+
+	got := drainOutbound(msgBus)
+	if len(got) != 2 || !got[0].Stream || !got[0].Progress || got[0].Content != "building..." {
+		t.Fatalf("unexpected stream messages: %+v", got)
+	}
+	if got[1].Content != "step 2 done" {
+		t.Errorf("expected only the tail after the last full line, got %q", got[1].Content)
+	}
+}
+
+func TestProgressReporter_DraftsAnswer(t *testing.T) {
+	saved := progressInterval
+	progressInterval = 0
+	defer func() { progressInterval = saved }()
+
+	msgBus := bus.NewMessageBus()
+	r := newProgressReporter(msgBus, "telegram", "42")
+	draft := r.drafter()
+	draft(providers.StreamChunk{Delta: "FOLFIRINOX is "})
+	draft(providers.StreamChunk{ToolCallDelta: &providers.ToolCallDelta{Name: "kb_search"}})
+	draft(providers.StreamChunk{Delta: "given every two weeks."})
+	r.drafter()(providers.StreamChunk{Delta: "Retried."})
+
+	got := drainOutbound(msgBus)
+	if len(got) != 3 || !got[0].Stream || got[0].Content != "FOLFIRINOX is" ||
+		got[1].Content != "FOLFIRINOX is given every two weeks." || got[2].Content != "Retried." {
+		t.Fatalf("unexpected draft messages: %+v", got)
+	}
+}
+
+func TestStreamTail(t *testing.T) {
+	long := strings.Repeat("胰", maxStreamChars)
+	tail := streamTail(long)
+	if !utf8.ValidString(tail) || len(tail) > maxStreamChars {
+		t.Errorf("tail is %d bytes, valid=%v", len(tail), utf8.ValidString(tail))
+	}
+	if got := streamTail("short"); got != "short" {
+		t.Errorf("streamTail(short) = %q", got)
+	}
+}
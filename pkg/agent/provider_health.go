@@ -0,0 +1,72 @@
+package agent
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+// fallbackProvider returns the provider for a fallback candidate, created
+// from that provider's configuration on first use. A candidate that cannot
+// be created is sent to the agent's own provider, as before fallback chains
+// could span providers.
+func (al *AgentLoop) fallbackProvider(agent *AgentInstance, provider, model string) providers.LLMProvider {
+	key := providers.ModelKey(provider, model)
+	if llm, ok := al.fallbackLLMs.Load(key); ok {
+		return llm.(providers.LLMProvider)
+	}
+	if al.cfg == nil {
+		return agent.Provider
+	}
+	llm, err := providers.CreateProviderForModel(al.cfg, provider, model)
+	if err != nil {
+		logger.WarnCF("agent", "Fallback candidate has no provider of its own, using the agent's",
+			map[string]interface{}{"provider": provider, "model": model, "error": err.Error()})
+		llm = agent.Provider
+	}
+	actual, _ := al.fallbackLLMs.LoadOrStore(key, llm)
+	return actual.(providers.LLMProvider)
+}
+
+// ProviderHealthHandler serves the fallback chain's view of each provider
+// it has called (availability, cooldown and recent failures) as JSON to
+// admin tokens.
+func (al *AgentLoop) ProviderHealthHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+
+		role, ok := al.authenticate(r)
+		if !ok {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeJSONError(w, http.StatusUnauthorized, "invalid or missing bearer token")
+			return
+		}
+		if role != AdminRole {
+			writeJSONError(w, http.StatusForbidden, "admin role required")
+			return
+		}
+
+		health := []providers.ProviderHealth{}
+		if al.fallback != nil {
+			health = al.fallback.Health()
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"providers": health,
+		})
+	})
+}
+
+// busyMessage is what the user is told when every model is rate limited or
+// overloaded, in Chinese when they wrote in it.
+func busyMessage(chinese bool) string {
+	if chinese {
+		return "抱歉，AI 服务现在请求太多，暂时无法回答。请过一两分钟再发一次你的问题。"
+	}
+	return "Sorry, the AI service is too busy to answer right now. Please send your question again in a minute or two."
+}
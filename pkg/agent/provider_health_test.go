@@ -0,0 +1,116 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+// rateLimitedProvider fails every call as an exhausted rate limit would.
+type rateLimitedProvider struct {
+	calls int
+}
+
+func (p *rateLimitedProvider) Chat(ctx context.Context, messages []providers.Message, tools []providers.ToolDefinition, model string, opts map[string]interface{}) (*providers.LLMResponse, error) {
+	p.calls++
+	return nil, errors.New("API request failed: status 429: rate limit exceeded")
+}
+
+func (p *rateLimitedProvider) GetDefaultModel() string {
+	return "gpt-4o"
+}
+
+func TestFallbackToOtherProvider(t *testing.T) {
+	var fallbackModel string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Model string `json:"model"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		fallbackModel = req.Model
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("data: {\"choices\":[{\"delta\":{\"content\":\"from deepseek\"},\"finish_reason\":\"stop\"}]}\n\ndata: [DONE]\n\n"))
+	}))
+	defer server.Close()
+
+	primary := &rateLimitedProvider{}
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				Provider:          "openai",
+				Model:             "gpt-4o",
+				ModelFallbacks:    []string{"deepseek/deepseek-chat"},
+				MaxTokens:         4096,
+				MaxToolIterations: 10,
+			},
+		},
+		Gateway: config.GatewayConfig{
+			APITokens: []config.GatewayAPIToken{{Token: "admin-token", Role: AdminRole}},
+		},
+	}
+	cfg.Providers.DeepSeek.APIKey = "deepseek-key"
+	cfg.Providers.DeepSeek.APIBase = server.URL
+	al := NewAgentLoop(cfg, bus.NewMessageBus(), primary)
+	defer al.Stop()
+
+	reply, err := al.processMessage(context.Background(), bus.InboundMessage{
+		Channel: "telegram", SenderID: "1001", ChatID: "1001", Content: "hello",
+	})
+	if err != nil {
+		t.Fatalf("processMessage: %v", err)
+	}
+	if reply != "from deepseek" || fallbackModel != "deepseek-chat" || primary.calls != 1 {
+		t.Errorf("reply %q from model %q after %d primary calls", reply, fallbackModel, primary.calls)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/providers/health", nil)
+	req.Header.Set("Authorization", "Bearer admin-token")
+	rec := httptest.NewRecorder()
+	al.ProviderHealthHandler().ServeHTTP(rec, req)
+	var resp struct {
+		Providers []providers.ProviderHealth `json:"providers"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body.String())
+	}
+	if len(resp.Providers) != 2 {
+		t.Fatalf("providers = %+v", resp.Providers)
+	}
+	deepseek, openai := resp.Providers[0], resp.Providers[1]
+	if !deepseek.Available || deepseek.LastSuccess == nil {
+		t.Errorf("deepseek = %+v", deepseek)
+	}
+	if openai.Available || openai.LastReason != providers.FailoverRateLimit || openai.CooldownRemaining == "" {
+		t.Errorf("openai = %+v", openai)
+	}
+}
+
+func TestRateLimitedTurnGetsApology(t *testing.T) {
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				Model:             "gpt-4o",
+				MaxTokens:         4096,
+				MaxToolIterations: 10,
+			},
+		},
+	}
+	al := NewAgentLoop(cfg, bus.NewMessageBus(), &rateLimitedProvider{})
+	defer al.Stop()
+
+	reply, err := al.processMessage(context.Background(), bus.InboundMessage{
+		Channel: "telegram", SenderID: "1001", ChatID: "1001", Content: "What does a CA19-9 of 37 mean?",
+	})
+	if err != nil || reply != busyMessage(false) {
+		t.Errorf("reply = %q, err = %v", reply, err)
+	}
+}
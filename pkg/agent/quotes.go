@@ -0,0 +1,285 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+const (
+	highlightToolName = "knows_evidence_highlight"
+	// minQuoteRunes keeps quoted terms and short phrases ("CA19-9",
+	// "watch and wait") out of verification; only sentences are checked.
+	minQuoteRunes = 15
+)
+
+// quoteSource is the text of one knows_evidence_highlight result.
+type quoteSource struct {
+	EvidenceID string
+	Text       string
+}
+
+// quoteSpan is a quotation found in an answer; start and end cover the
+// quotation marks.
+type quoteSpan struct {
+	start, end int
+	text       string
+}
+
+var (
+	quotePattern = regexp.MustCompile(`“([^”]+)”|"([^"\n]+)"|「([^」]+)」|『([^』]+)』|(?m)^>[ \t]*(.+)$`)
+	htmlTag      = regexp.MustCompile(`<[^>]+>`)
+	ellipsis     = regexp.MustCompile(`\.{3}|…+`)
+)
+
+// enforceQuoteFidelity makes sure every sentence the answer quotes appears
+// verbatim in a knows_evidence_highlight result from this turn. Other quotes
+// are first rewritten by the model as paraphrases with a citation; anything
+// the rewrite still leaves unverified loses its quotation marks.
+func (al *AgentLoop) enforceQuoteFidelity(ctx context.Context, agent *AgentInstance, sessionKey, answer string) string {
+	sources := turnHighlights(agent.Sessions.GetHistory(sessionKey))
+	unverified := unverifiedQuotes(answer, sources)
+	if len(unverified) == 0 {
+		return answer
+	}
+
+	logger.InfoCF("agent", "Rewriting unverifiable quotes",
+		map[string]interface{}{
+			"session_key": sessionKey,
+			"quotes":      len(unverified),
+		})
+
+	response, err := agent.Provider.Chat(ctx, []providers.Message{
+		{Role: "user", Content: quoteRewritePrompt(answer, unverified, sources)},
+	}, nil, agent.Model, map[string]interface{}{
+		"max_tokens":  8192,
+		"temperature": 0.2,
+	})
+	if err == nil && strings.TrimSpace(response.Content) != "" {
+		answer = strings.TrimSpace(response.Content)
+	} else if err != nil {
+		logger.WarnCF("agent", "Quote rewrite failed, removing quotation marks instead",
+			map[string]interface{}{
+				"session_key": sessionKey,
+				"error":       err.Error(),
+			})
+	}
+	return dequoteUnverified(answer, sources)
+}
+
+// turnHighlights collects the knows_evidence_highlight results since the
+// latest user message, keyed by the evidence ID each call asked for.
+func turnHighlights(history []providers.Message) []quoteSource {
+	start := len(history)
+	for i := len(history) - 1; i >= 0; i-- {
+		if history[i].Role == "user" {
+			start = i
+			break
+		}
+	}
+
+	evidenceIDs := make(map[string]string)
+	var sources []quoteSource
+	for _, m := range history[start:] {
+		switch m.Role {
+		case "assistant":
+			for _, tc := range m.ToolCalls {
+				name, args := tc.Name, tc.Arguments
+				if tc.Function != nil {
+					if name == "" {
+						name = tc.Function.Name
+					}
+					if args == nil {
+						json.Unmarshal([]byte(tc.Function.Arguments), &args)
+					}
+				}
+				if name == highlightToolName {
+					id, _ := args["evidence_id"].(string)
+					evidenceIDs[tc.ID] = id
+				}
+			}
+		case "tool":
+			if id, ok := evidenceIDs[m.ToolCallID]; ok && m.Content != "" {
+				sources = append(sources, quoteSource{EvidenceID: id, Text: highlightText(m.Content)})
+			}
+		}
+	}
+	return sources
+}
+
+// highlightText flattens a highlight response to its strings, dropping the
+// markup used to highlight matches.
+func highlightText(content string) string {
+	var v interface{}
+	if err := json.Unmarshal([]byte(content), &v); err != nil {
+		return htmlTag.ReplaceAllString(content, "")
+	}
+	var parts []string
+	var walk func(interface{})
+	walk = func(v interface{}) {
+		switch x := v.(type) {
+		case string:
+			parts = append(parts, htmlTag.ReplaceAllString(x, ""))
+		case []interface{}:
+			for _, item := range x {
+				walk(item)
+			}
+		case map[string]interface{}:
+			keys := make([]string, 0, len(x))
+			for k := range x {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				walk(x[k])
+			}
+		}
+	}
+	walk(v)
+	return strings.Join(parts, "\n")
+}
+
+func findQuotes(answer string) []quoteSpan {
+	var spans []quoteSpan
+	for _, m := range quotePattern.FindAllStringSubmatchIndex(answer, -1) {
+		for g := 1; g < len(m)/2; g++ {
+			if m[2*g] >= 0 {
+				text := strings.TrimSpace(answer[m[2*g]:m[2*g+1]])
+				if utf8.RuneCountInString(text) >= minQuoteRunes {
+					spans = append(spans, quoteSpan{start: m[0], end: m[1], text: text})
+				}
+				break
+			}
+		}
+	}
+	return spans
+}
+
+func unverifiedQuotes(answer string, sources []quoteSource) []string {
+	var out []string
+	for _, q := range findQuotes(answer) {
+		if _, ok := verifyQuote(q.text, sources); !ok {
+			out = append(out, q.text)
+		}
+	}
+	return out
+}
+
+// verifyQuote reports the source containing quote. Case, whitespace and
+// trailing punctuation are ignored, and the fragments of an elided quote
+// ("a ... b") must appear in order in the same source.
+func verifyQuote(quote string, sources []quoteSource) (quoteSource, bool) {
+	var fragments []string
+	for _, f := range ellipsis.Split(quote, -1) {
+		if f = normalizeQuote(f); f != "" {
+			fragments = append(fragments, f)
+		}
+	}
+	if len(fragments) == 0 {
+		return quoteSource{}, false
+	}
+
+	for _, src := range sources {
+		text := normalizeQuote(src.Text)
+		pos, found := 0, true
+		for _, f := range fragments {
+			i := strings.Index(text[pos:], f)
+			if i < 0 {
+				found = false
+				break
+			}
+			pos += i + len(f)
+		}
+		if found {
+			return src, true
+		}
+	}
+	return quoteSource{}, false
+}
+
+func normalizeQuote(s string) string {
+	var sb strings.Builder
+	for _, r := range strings.ToLower(s) {
+		if !unicode.IsSpace(r) {
+			sb.WriteRune(r)
+		}
+	}
+	return strings.TrimRight(sb.String(), ".。,，;；:：!！?？")
+}
+
+// dequoteUnverified removes the quotation marks around quotes that are not
+// verbatim evidence and cites the closest source, so nothing unverified is
+// presented as a direct quote.
+func dequoteUnverified(answer string, sources []quoteSource) string {
+	spans := findQuotes(answer)
+	for i := len(spans) - 1; i >= 0; i-- {
+		q := spans[i]
+		if _, ok := verifyQuote(q.text, sources); ok {
+			continue
+		}
+		replacement := q.text
+		if src, ok := closestSource(q.text, sources); ok && src.EvidenceID != "" {
+			citation := "[" + src.EvidenceID + "]"
+			if !strings.HasPrefix(strings.TrimSpace(answer[q.end:]), citation) {
+				replacement += " " + citation
+			}
+		}
+		answer = answer[:q.start] + replacement + answer[q.end:]
+	}
+	return answer
+}
+
+// closestSource picks the source sharing the most character pairs with
+// text, which works for both English and Chinese.
+func closestSource(text string, sources []quoteSource) (quoteSource, bool) {
+	want := bigrams(normalizeQuote(text))
+	best, bestScore := quoteSource{}, 0
+	for _, src := range sources {
+		score := 0
+		for pair := range bigrams(normalizeQuote(src.Text)) {
+			if want[pair] {
+				score++
+			}
+		}
+		if score > bestScore {
+			best, bestScore = src, score
+		}
+	}
+	return best, bestScore > 0
+}
+
+func bigrams(s string) map[[2]rune]bool {
+	runes := []rune(s)
+	pairs := make(map[[2]rune]bool, len(runes))
+	for i := 1; i < len(runes); i++ {
+		pairs[[2]rune{runes[i-1], runes[i]}] = true
+	}
+	return pairs
+}
+
+func quoteRewritePrompt(answer string, unverified []string, sources []quoteSource) string {
+	var sb strings.Builder
+	sb.WriteString("The answer below quotes text that does not appear verbatim in the evidence. ")
+	sb.WriteString("Rewrite only those quotations as paraphrases without quotation marks, each followed by a citation of the evidence it comes from in the form [evidence_id]. ")
+	sb.WriteString("Keep everything else in the answer unchanged, including quotes that are not listed. Reply with the revised answer only.\n\n")
+	sb.WriteString("Quotations to rewrite:\n")
+	for _, q := range unverified {
+		fmt.Fprintf(&sb, "- %s\n", q)
+	}
+	if len(sources) > 0 {
+		sb.WriteString("\nEvidence:\n")
+		for _, src := range sources {
+			fmt.Fprintf(&sb, "[%s]\n%s\n\n", src.EvidenceID, src.Text)
+		}
+	}
+	fmt.Fprintf(&sb, "\nAnswer:\n%s\n", answer)
+	return sb.String()
+}
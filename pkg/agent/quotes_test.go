@@ -0,0 +1,102 @@
+package agent
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+var testHighlights = []quoteSource{
+	{EvidenceID: "E1", Text: "FOLFIRINOX improved median overall survival to 11.1 months compared with 6.8 months for gemcitabine."},
+	{EvidenceID: "E2", Text: "术后辅助化疗可显著延长胰腺癌患者的无病生存期。"},
+}
+
+func TestVerifyQuote(t *testing.T) {
+	tests := []struct {
+		name  string
+		quote string
+		want  string
+	}{
+		{"verbatim", "FOLFIRINOX improved median overall survival to 11.1 months", "E1"},
+		{"case, spacing and trailing period", "folfirinox improved  median overall survival to 11.1 months.", "E1"},
+		{"elided in order", "FOLFIRINOX improved ... 11.1 months compared with 6.8 months", "E1"},
+		{"chinese", "术后辅助化疗可显著延长胰腺癌患者的无病生存期", "E2"},
+		{"elided out of order", "6.8 months ... FOLFIRINOX improved", ""},
+		{"altered number", "FOLFIRINOX improved median overall survival to 12 months", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src, ok := verifyQuote(tt.quote, testHighlights)
+			if got := src.EvidenceID; ok != (tt.want != "") || got != tt.want {
+				t.Errorf("verifyQuote(%q) = %q, %v; want %q", tt.quote, got, ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindQuotes_SkipsShortTerms(t *testing.T) {
+	answer := "Your “CA19-9” level matters. The trial reported \"median overall survival to 11.1 months\".\n> 术后辅助化疗可显著延长胰腺癌患者的无病生存期。"
+	var got []string
+	for _, q := range findQuotes(answer) {
+		got = append(got, q.text)
+	}
+	want := []string{"median overall survival to 11.1 months", "术后辅助化疗可显著延长胰腺癌患者的无病生存期。"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("findQuotes() = %q, want %q", got, want)
+	}
+}
+
+func TestDequoteUnverified(t *testing.T) {
+	answer := "The study found “FOLFIRINOX doubled survival for every patient” and “improved median overall survival to 11.1 months”."
+	got := dequoteUnverified(answer, testHighlights)
+	want := "The study found FOLFIRINOX doubled survival for every patient [E1] and “improved median overall survival to 11.1 months”."
+	if got != want {
+		t.Errorf("dequoteUnverified() =\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestEnforceQuoteFidelity(t *testing.T) {
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				Model:             "test-model",
+				MaxTokens:         4096,
+				MaxToolIterations: 10,
+			},
+		},
+		Tools: config.ToolsConfig{Knows: config.KnowsToolsConfig{VerifiedQuotes: true}},
+	}
+	// The rewrite keeps one invented quote, which must still be caught.
+	rewrite := "FOLFIRINOX extended survival by about four months [E1]. As the authors put it, “this regimen cures most patients”."
+	al := NewAgentLoop(cfg, bus.NewMessageBus(), &simpleMockProvider{response: rewrite})
+
+	msg := bus.InboundMessage{Channel: "telegram", SenderID: "patient", ChatID: "1", Content: "How much does FOLFIRINOX help?"}
+	agent, sessionKey, _ := al.resolveSession(msg)
+	agent.Sessions.AddMessage(sessionKey, "user", msg.Content)
+	agent.Sessions.AddFullMessage(sessionKey, providers.Message{Role: "assistant", ToolCalls: []providers.ToolCall{{
+		ID:       "h1",
+		Function: &providers.FunctionCall{Name: highlightToolName, Arguments: `{"evidence_id":"E1"}`},
+	}}})
+	agent.Sessions.AddFullMessage(sessionKey, providers.Message{
+		Role:       "tool",
+		ToolCallID: "h1",
+		Content:    `{"highlights":[{"text":"FOLFIRINOX improved <em>median overall survival</em> to 11.1 months compared with 6.8 months for gemcitabine."}]}`,
+	})
+
+	verified := "The trial reported “FOLFIRINOX improved median overall survival to 11.1 months”."
+	if got := al.enforceQuoteFidelity(context.Background(), agent, sessionKey, verified); got != verified {
+		t.Errorf("verified answer changed: %q", got)
+	}
+
+	answer := "The trial said “FOLFIRINOX adds four months of life for everyone”."
+	got := al.enforceQuoteFidelity(context.Background(), agent, sessionKey, answer)
+	want := "FOLFIRINOX extended survival by about four months [E1]. As the authors put it, this regimen cures most patients [E1]."
+	if got != want {
+		t.Errorf("enforceQuoteFidelity() =\n%q\nwant\n%q", got, want)
+	}
+}
@@ -0,0 +1,184 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/sipeed/picoclaw/pkg/audit"
+	"github.com/sipeed/picoclaw/pkg/session"
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+// ReplayCall is a tool call made while replaying a turn.
+type ReplayCall struct {
+	Tool string                 `json:"tool"`
+	Args map[string]interface{} `json:"args,omitempty"`
+	// Recorded is false when no recorded call was left to answer it.
+	Recorded bool   `json:"recorded"`
+	Result   string `json:"result"`
+	IsError  bool   `json:"is_error,omitempty"`
+}
+
+// ReplayResult is the outcome of re-running a recorded turn.
+type ReplayResult struct {
+	TurnID   string       `json:"turn_id"`
+	Response string       `json:"response"`
+	Calls    []ReplayCall `json:"calls"`
+}
+
+// Replay runs a recorded turn's prompt again through the current code and
+// model, answering tool calls from the recorded results instead of the real
+// tools. The turn runs in a throwaway session without history, and nothing
+// is sent to any channel or written to the audit or shadow logs. Replay is
+// meant for a loop that is not also serving messages.
+func (al *AgentLoop) Replay(ctx context.Context, turn *audit.Turn) (*ReplayResult, error) {
+	if turn.Entry == nil {
+		return nil, fmt.Errorf("turn was not recorded; enable tools.audit.record_turns to replay turns")
+	}
+	agent := al.registry.GetDefaultAgent()
+	if turn.Entry.AgentID != "" {
+		if a, ok := al.registry.GetAgent(turn.Entry.AgentID); ok {
+			agent = a
+		}
+	}
+
+	recorder := &replayRecorder{calls: turn.Calls}
+	replayAgent := *agent
+	replayAgent.Tools = replayRegistry(agent, recorder)
+	replayAgent.Sessions = session.NewSessionManager("")
+
+	savedAudit, savedShadows := al.audit, al.shadows
+	al.audit, al.shadows = nil, nil
+	defer func() { al.audit, al.shadows = savedAudit, savedShadows }()
+
+	response, err := al.runAgentLoop(ctx, &replayAgent, processOptions{
+		SessionKey:      "replay:" + turn.Entry.TurnID,
+		UserID:          turn.Entry.UserID,
+		Channel:         "cli",
+		ChatID:          "replay",
+		UserMessage:     turn.Entry.Prompt,
+		DefaultResponse: "I've completed processing but have no response to give.",
+		NoHistory:       true,
+		TurnID:          "replay-" + turn.Entry.TurnID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &ReplayResult{TurnID: turn.Entry.TurnID, Response: response, Calls: recorder.made}, nil
+}
+
+// replayRegistry returns stand-ins for the agent's tools that answer from
+// recorder. Recorded tools the agent lacks, such as those of MCP servers or
+// plugins that are not running, still answer from the recording.
+func replayRegistry(agent *AgentInstance, recorder *replayRecorder) *tools.ToolRegistry {
+	registry := tools.NewToolRegistry()
+	for _, name := range agent.Tools.List() {
+		tool, _ := agent.Tools.Get(name)
+		registry.Register(&replayTool{name: name, description: tool.Description(), parameters: tool.Parameters(), recorder: recorder})
+	}
+	for _, call := range recorder.calls {
+		if _, ok := registry.Get(call.Tool); !ok {
+			registry.Register(&replayTool{
+				name:        call.Tool,
+				description: "Recorded tool " + call.Tool,
+				parameters:  map[string]interface{}{"type": "object", "properties": map[string]interface{}{}},
+				recorder:    recorder,
+			})
+		}
+	}
+	return registry
+}
+
+// replayRecorder hands out recorded tool results. A call gets the first
+// unused recording of the same tool with the same arguments, or failing
+// that the first unused recording of the same tool, since recorded
+// arguments may be redacted or truncated. With reuse, recordings are never
+// used up, so they answer any number of calls.
+type replayRecorder struct {
+	mu    sync.Mutex
+	calls []audit.Entry
+	reuse bool
+	used  map[int]bool
+	made  []ReplayCall
+}
+
+func (r *replayRecorder) answer(tool string, args map[string]interface{}) *tools.ToolResult {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.used == nil {
+		r.used = make(map[int]bool)
+	}
+
+	match := -1
+	for i, call := range r.calls {
+		if r.used[i] || call.Tool != tool {
+			continue
+		}
+		if sameArgs(call.Args, args) {
+			match = i
+			break
+		}
+		if match < 0 {
+			match = i
+		}
+	}
+
+	made := ReplayCall{Tool: tool, Args: args}
+	var result *tools.ToolResult
+	switch {
+	case match < 0:
+		result = tools.ErrorResult(fmt.Sprintf("replay: no recorded result left for %s", tool))
+	case !r.calls[match].Success:
+		r.used[match] = !r.reuse
+		made.Recorded = true
+		result = tools.ErrorResult(r.calls[match].Error)
+	default:
+		r.used[match] = !r.reuse
+		made.Recorded = true
+		result = tools.NewToolResult(r.calls[match].Result)
+	}
+	made.Result, made.IsError = result.ForLLM, result.IsError
+	r.made = append(r.made, made)
+	return result
+}
+
+// sameArgs compares arguments as they would appear in the log.
+func sameArgs(recorded, args map[string]interface{}) bool {
+	if len(recorded) == 0 && len(args) == 0 {
+		return true
+	}
+	data, err := json.Marshal(args)
+	if err != nil {
+		return false
+	}
+	var normalized map[string]interface{}
+	json.Unmarshal(data, &normalized)
+	return reflect.DeepEqual(recorded, normalized)
+}
+
+// replayTool stands in for a real tool during replay.
+type replayTool struct {
+	name        string
+	description string
+	parameters  map[string]interface{}
+	recorder    *replayRecorder
+}
+
+func (t *replayTool) Name() string {
+	return t.name
+}
+
+func (t *replayTool) Description() string {
+	return t.description
+}
+
+func (t *replayTool) Parameters() map[string]interface{} {
+	return t.parameters
+}
+
+func (t *replayTool) Execute(ctx context.Context, args map[string]interface{}) *tools.ToolResult {
+	return t.recorder.answer(t.name, args)
+}
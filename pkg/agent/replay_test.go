@@ -0,0 +1,133 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/audit"
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+// lookupProvider calls the lookup tool once, then answers with its result.
+type lookupProvider struct{}
+
+func (p *lookupProvider) Chat(ctx context.Context, messages []providers.Message, defs []providers.ToolDefinition, model string, opts map[string]interface{}) (*providers.LLMResponse, error) {
+	last := messages[len(messages)-1]
+	if last.Role == "tool" {
+		return &providers.LLMResponse{Content: "Answer: " + last.Content}, nil
+	}
+	return &providers.LLMResponse{ToolCalls: []providers.ToolCall{{
+		ID:        "call-1",
+		Name:      "lookup",
+		Arguments: map[string]interface{}{"query": "CA19-9"},
+	}}}, nil
+}
+
+func (p *lookupProvider) GetDefaultModel() string {
+	return "lookup-model"
+}
+
+type lookupTool struct {
+	result string
+	calls  int
+}
+
+func (t *lookupTool) Name() string        { return "lookup" }
+func (t *lookupTool) Description() string { return "Look something up" }
+func (t *lookupTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{"type": "object", "properties": map[string]interface{}{}}
+}
+
+func (t *lookupTool) Execute(ctx context.Context, args map[string]interface{}) *tools.ToolResult {
+	t.calls++
+	return tools.NewToolResult(t.result)
+}
+
+func TestReplay_UsesRecordedResults(t *testing.T) {
+	workspace := t.TempDir()
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         workspace,
+				Model:             "test-model",
+				MaxTokens:         4096,
+				MaxToolIterations: 5,
+			},
+		},
+		Tools: config.ToolsConfig{Audit: config.AuditConfig{Enabled: true, RecordTurns: true}},
+	}
+
+	original := &lookupTool{result: "CA19-9 was 35 U/mL"}
+	al := NewAgentLoop(cfg, bus.NewMessageBus(), &lookupProvider{})
+	al.RegisterTool(original)
+	response, err := al.ProcessDirect(context.Background(), "What was my CA19-9?", "cli:replay-test")
+	if err != nil {
+		t.Fatalf("ProcessDirect: %v", err)
+	}
+	al.Stop()
+	al.Audit().Close()
+
+	turns, err := audit.Query(cfg.AuditPath(), audit.Filter{Turns: true})
+	if err != nil || len(turns) != 2 || turns[1].Kind != audit.KindTurn {
+		t.Fatalf("expected a tool call and a turn entry, got %+v, %v", turns, err)
+	}
+	if turns[0].TurnID != turns[1].TurnID || turns[0].Result != "CA19-9 was 35 U/mL" {
+		t.Fatalf("tool call not tied to its turn: %+v", turns[0])
+	}
+
+	turn, err := audit.LoadTurn(cfg.AuditPath(), turns[1].TurnID)
+	if err != nil {
+		t.Fatalf("LoadTurn: %v", err)
+	}
+	if turn.Entry.Prompt != "What was my CA19-9?" || turn.Entry.Response != response || len(turn.Calls) != 1 {
+		t.Fatalf("unexpected turn: %+v", turn)
+	}
+
+	// The live tool now returns something else; replay must not call it.
+	cfg.Tools.Audit.Enabled = false
+	replayLoop := NewAgentLoop(cfg, bus.NewMessageBus(), &lookupProvider{})
+	live := &lookupTool{result: "live result"}
+	replayLoop.RegisterTool(live)
+
+	result, err := replayLoop.Replay(context.Background(), turn)
+	if err != nil {
+		t.Fatalf("Replay: %v", err)
+	}
+	if live.calls != 0 {
+		t.Errorf("replay called the live tool %d times", live.calls)
+	}
+	if result.Response != response {
+		t.Errorf("replayed response = %q, want %q", result.Response, response)
+	}
+	if len(result.Calls) != 1 || !result.Calls[0].Recorded || result.Calls[0].Tool != "lookup" {
+		t.Errorf("unexpected replay calls: %+v", result.Calls)
+	}
+}
+
+func TestReplayRecorder_MatchesArgsThenName(t *testing.T) {
+	r := &replayRecorder{calls: []audit.Entry{
+		{Tool: "web_search", Args: map[string]interface{}{"query": "FOLFIRINOX"}, Success: true, Result: "first"},
+		{Tool: "web_search", Args: map[string]interface{}{"query": "gemcitabine"}, Success: true, Result: "second"},
+		{Tool: "web_fetch", Success: false, Error: "timeout"},
+	}}
+
+	if got := r.answer("web_search", map[string]interface{}{"query": "gemcitabine"}); got.ForLLM != "second" {
+		t.Errorf("exact match = %q, want second", got.ForLLM)
+	}
+	if got := r.answer("web_search", map[string]interface{}{"query": "other"}); got.ForLLM != "first" {
+		t.Errorf("name match = %q, want first", got.ForLLM)
+	}
+	if got := r.answer("web_fetch", nil); !got.IsError || got.ForLLM != "timeout" {
+		t.Errorf("recorded failure = %+v", got)
+	}
+	if got := r.answer("web_search", nil); !got.IsError || !strings.Contains(got.ForLLM, "no recorded result") {
+		t.Errorf("exhausted recordings = %+v", got)
+	}
+	if n := len(r.made); n != 4 || r.made[3].Recorded {
+		t.Errorf("unexpected made calls: %+v", r.made)
+	}
+}
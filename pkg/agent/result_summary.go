@@ -0,0 +1,169 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+const (
+	resultSummaryTimeout = 60 * time.Second
+	// resultSummaryMaxInput bounds the text sent to the summarizer, so a
+	// result far over budget cannot overflow the summarizer's own context.
+	resultSummaryMaxInput = 150000
+	// resultSummaryMaxIDs bounds the identifiers listed after a summary.
+	resultSummaryMaxIDs = 200
+)
+
+// condenseToolResult returns content unchanged when it fits the result
+// budget, and otherwise a summary of it made by the summarizer model. The
+// summary keeps every identifier and URL in the result: any the summarizer
+// dropped are listed after it. If summarizing fails the result is cut to
+// the budget instead.
+func (al *AgentLoop) condenseToolResult(ctx context.Context, agent *AgentInstance, tool, content string) string {
+	sc := al.cfg.Tools.Summarize
+	// Quote verification needs the highlight text verbatim.
+	if !sc.Enabled || sc.MaxTokens <= 0 || tool == highlightToolName ||
+		(len(sc.Tools) > 0 && !matchesAny(tool, sc.Tools)) {
+		return content
+	}
+	tokens := agent.Tokens.Count(content)
+	if tokens <= sc.MaxTokens {
+		return content
+	}
+
+	model := sc.Model
+	if model == "" {
+		model = agent.Model
+	}
+	ctx, cancel := context.WithTimeout(ctx, resultSummaryTimeout)
+	defer cancel()
+	response, err := agent.Provider.Chat(ctx, []providers.Message{
+		{Role: "user", Content: resultSummaryPrompt(tool, content, sc.SummaryTokens)},
+	}, nil, model, map[string]interface{}{
+		"max_tokens":  sc.SummaryTokens,
+		"temperature": 0.2,
+	})
+	if err != nil || strings.TrimSpace(response.Content) == "" {
+		reason := "empty summary"
+		if err != nil {
+			reason = err.Error()
+		}
+		logger.WarnCF("agent", "Tool result summary failed, truncating instead",
+			map[string]interface{}{
+				"agent_id": agent.ID,
+				"tool":     tool,
+				"tokens":   tokens,
+				"error":    reason,
+			})
+		return agent.Tokens.Truncate(content, sc.MaxTokens) +
+			fmt.Sprintf("\n\n[System: This %s result was cut to fit the context. Ask for less, e.g. fewer items, if the missing part matters.]", tool)
+	}
+
+	summary := strings.TrimSpace(response.Content)
+	var missing []string
+	for _, id := range resultIdentifiers(content) {
+		if !strings.Contains(summary, id) {
+			missing = append(missing, id)
+		}
+	}
+	logger.InfoCF("agent", "Summarized large tool result",
+		map[string]interface{}{
+			"agent_id":       agent.ID,
+			"tool":           tool,
+			"tokens":         tokens,
+			"summary_tokens": agent.Tokens.Count(summary),
+			"missing_ids":    len(missing),
+		})
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "[System: The %s result (about %d tokens) was summarized to fit the context. Identifiers and citations are preserved; call the tool again with narrower arguments for full text.]\n\n", tool, tokens)
+	sb.WriteString(summary)
+	if len(missing) > 0 {
+		sb.WriteString("\n\nOther identifiers in the result: ")
+		sb.WriteString(strings.Join(missing, ", "))
+	}
+	return sb.String()
+}
+
+func resultSummaryPrompt(tool, content string, summaryTokens int) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "The tool %s returned the result below, which is too long to pass on in full. ", tool)
+	fmt.Fprintf(&sb, "Summarize it in at most %d tokens for an assistant answering a medical question. ", summaryTokens)
+	sb.WriteString("Keep every identifier exactly as written (IDs, evidence IDs, question IDs, PMIDs, DOIs, URLs), ")
+	sb.WriteString("keep citations attached to the statements they support, and keep numbers, doses, ")
+	sb.WriteString("recommendation grades and study results exactly. Drop boilerplate, repeated text and formatting. ")
+	sb.WriteString("Write in the language of the result. Reply with the summary only.\n\nRESULT:\n")
+	if utf8.RuneCountInString(content) > resultSummaryMaxInput {
+		content = utils.Truncate(content, resultSummaryMaxInput)
+	}
+	sb.WriteString(content)
+	return sb.String()
+}
+
+// resultIdentifiers returns the identifiers in a JSON result, in order:
+// the values of "id", "*_id", "doi", "pmid" and "url" fields. Results that
+// are not JSON have none.
+func resultIdentifiers(content string) []string {
+	var decoded interface{}
+	if err := json.Unmarshal([]byte(content), &decoded); err != nil {
+		return nil
+	}
+	seen := make(map[string]bool)
+	var ids []string
+	var walk func(v interface{})
+	walk = func(v interface{}) {
+		if len(ids) >= resultSummaryMaxIDs {
+			return
+		}
+		switch x := v.(type) {
+		case map[string]interface{}:
+			keys := make([]string, 0, len(x))
+			for key := range x {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				if isIdentifierKey(key) {
+					var id string
+					switch value := x[key].(type) {
+					case string:
+						id = value
+					case float64:
+						id = strconv.FormatFloat(value, 'f', -1, 64)
+					}
+					if id != "" && !seen[id] && len(ids) < resultSummaryMaxIDs {
+						seen[id] = true
+						ids = append(ids, id)
+					}
+					continue
+				}
+				walk(x[key])
+			}
+		case []interface{}:
+			for _, item := range x {
+				walk(item)
+			}
+		}
+	}
+	walk(decoded)
+	return ids
+}
+
+func isIdentifierKey(key string) bool {
+	key = strings.ToLower(key)
+	switch key {
+	case "id", "doi", "pmid", "url":
+		return true
+	}
+	return strings.HasSuffix(key, "_id")
+}
@@ -0,0 +1,145 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+// summaryProvider answers every call with response, or fails with err, and
+// remembers the model it was asked for.
+type summaryProvider struct {
+	response string
+	err      error
+	model    string
+	calls    int
+}
+
+func (p *summaryProvider) Chat(ctx context.Context, messages []providers.Message, tools []providers.ToolDefinition, model string, opts map[string]interface{}) (*providers.LLMResponse, error) {
+	p.calls++
+	p.model = model
+	if p.err != nil {
+		return nil, p.err
+	}
+	return &providers.LLMResponse{Content: p.response}, nil
+}
+
+func (p *summaryProvider) GetDefaultModel() string {
+	return "test-model"
+}
+
+func newSummaryTestLoop(t *testing.T, provider providers.LLMProvider) *AgentLoop {
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				Model:             "test-model",
+				MaxTokens:         4096,
+				MaxToolIterations: 10,
+			},
+		},
+		Tools: config.ToolsConfig{Summarize: config.ResultSummaryConfig{
+			Enabled:       true,
+			MaxTokens:     100,
+			SummaryTokens: 50,
+			Model:         "cheap-model",
+			Tools:         []string{"knows_*"},
+		}},
+	}
+	return NewAgentLoop(cfg, bus.NewMessageBus(), provider)
+}
+
+// largeGuide is a guide result of well over 100 estimated tokens.
+func largeGuide() string {
+	sections := make([]string, 20)
+	for i := range sections {
+		sections[i] = fmt.Sprintf(`{"section_id":"s%d","text":"Recommendation %d for resectable pancreatic cancer."}`, i, i)
+	}
+	return `{"guide_id":"G-2024","url":"https://example.org/g","sections":[` + strings.Join(sections, ",") + `]}`
+}
+
+func TestCondenseToolResult_Summarizes(t *testing.T) {
+	provider := &summaryProvider{response: "Guide G-2024 recommends resection (s0, s1)."}
+	al := newSummaryTestLoop(t, provider)
+	agent := al.registry.GetDefaultAgent()
+
+	got := al.condenseToolResult(context.Background(), agent, "knows_get_guide", largeGuide())
+	if provider.model != "cheap-model" {
+		t.Errorf("summarizer model = %q, want cheap-model", provider.model)
+	}
+	if !strings.Contains(got, "Guide G-2024 recommends resection (s0, s1).") {
+		t.Fatalf("summary missing from %q", got)
+	}
+	// Identifiers the summary dropped are listed after it; kept ones are not repeated.
+	tail := got[strings.Index(got, "Other identifiers"):]
+	for _, id := range []string{"https://example.org/g", "s2", "s19"} {
+		if !strings.Contains(tail, id) {
+			t.Errorf("missing identifier %s in %q", id, tail)
+		}
+	}
+	if strings.Contains(tail, "G-2024") {
+		t.Errorf("kept identifier listed again: %q", tail)
+	}
+}
+
+func TestCondenseToolResult_PassesThrough(t *testing.T) {
+	provider := &summaryProvider{response: "summary"}
+	al := newSummaryTestLoop(t, provider)
+	agent := al.registry.GetDefaultAgent()
+
+	tests := []struct {
+		name    string
+		tool    string
+		content string
+	}{
+		{"under budget", "knows_get_guide", `{"id":"small"}`},
+		{"tool not listed", "web_fetch", largeGuide()},
+		{"highlights stay verbatim", highlightToolName, largeGuide()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := al.condenseToolResult(context.Background(), agent, tt.tool, tt.content); got != tt.content {
+				t.Errorf("content changed: %q", got)
+			}
+		})
+	}
+	if provider.calls != 0 {
+		t.Errorf("summarizer called %d times", provider.calls)
+	}
+}
+
+func TestCondenseToolResult_TruncatesOnFailure(t *testing.T) {
+	al := newSummaryTestLoop(t, &summaryProvider{err: errors.New("model unavailable")})
+	agent := al.registry.GetDefaultAgent()
+
+	got := al.condenseToolResult(context.Background(), agent, "knows_get_guide", largeGuide())
+	if !strings.HasPrefix(got, `{"guide_id":"G-2024"`) || !strings.Contains(got, "was cut to fit the context") {
+		t.Fatalf("unexpected fallback: %q", got)
+	}
+	body := got[:strings.Index(got, "\n\n[System:")]
+	if n := agent.Tokens.Count(body); n > 100 || n < 95 {
+		t.Errorf("truncated to %d tokens, want just under 100", n)
+	}
+}
+
+func TestResultIdentifiers(t *testing.T) {
+	tests := []struct {
+		content string
+		want    string
+	}{
+		{`{"question_id":"q1","evidences":[{"id":"e1","type":"PAPER"},{"id":"e1"},{"pmid":12345678}]}`, "e1,12345678,q1"},
+		{`{"DOI":"10.1000/xyz","title":"t"}`, "10.1000/xyz"},
+		{`plain text with id: 5`, ""},
+	}
+	for _, tt := range tests {
+		if got := strings.Join(resultIdentifiers(tt.content), ","); got != tt.want {
+			t.Errorf("resultIdentifiers(%s) = %q, want %q", tt.content, got, tt.want)
+		}
+	}
+}
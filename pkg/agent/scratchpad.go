@@ -0,0 +1,47 @@
+package agent
+
+import (
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+// handleScratchpadCommand implements /scratchpad for chat users:
+//
+//	/scratchpad        show the notes the agent keeps for this conversation
+//	/scratchpad clear  remove them
+func (al *AgentLoop) handleScratchpadCommand(msg bus.InboundMessage, args []string) string {
+	if !al.cfg.Tools.Scratchpad.Enabled {
+		return "The scratchpad is not enabled."
+	}
+	agent, sessionKey, _ := al.resolveSession(msg)
+	if agent == nil {
+		return "No default agent configured"
+	}
+	if fork, ok := al.activeForks.Load(sessionKey); ok {
+		sessionKey = fork.(string)
+	}
+	entries := agent.Sessions.Scratchpad(sessionKey)
+
+	if len(args) > 0 {
+		if !strings.EqualFold(args[0], "clear") {
+			return "Usage: /scratchpad [clear]"
+		}
+		if len(entries) == 0 {
+			return "The scratchpad is already empty."
+		}
+		names := make([]string, 0, len(entries))
+		for name := range entries {
+			names = append(names, name)
+		}
+		agent.Sessions.UpdateScratchpad(sessionKey, nil, names)
+		agent.Sessions.Save(sessionKey)
+		return "Scratchpad cleared."
+	}
+
+	if len(entries) == 0 {
+		return "The scratchpad is empty."
+	}
+	return "Notes kept for this conversation:\n- " + strings.Join(tools.ScratchpadLines(entries), "\n- ")
+}
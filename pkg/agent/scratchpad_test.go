@@ -0,0 +1,59 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestScratchpad(t *testing.T) {
+	provider := &systemRecordingProvider{response: "ok"}
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				Model:             "test-model",
+				MaxTokens:         4096,
+				MaxToolIterations: 5,
+			},
+		},
+		Tools: config.ToolsConfig{
+			Scratchpad: config.ScratchpadConfig{Enabled: true, MaxEntries: 10, MaxValueChars: 100},
+		},
+	}
+	al := NewAgentLoop(cfg, bus.NewMessageBus(), provider)
+	agent := al.registry.GetDefaultAgent()
+	if _, ok := agent.Tools.Get("scratchpad_write"); !ok {
+		t.Fatal("scratchpad_write not registered")
+	}
+	msg := bus.InboundMessage{Channel: "telegram", SenderID: "42", ChatID: "42", Content: "/scratchpad"}
+	ctx := context.Background()
+
+	if got, _ := al.processMessage(ctx, msg); got != "The scratchpad is empty." {
+		t.Fatalf("/scratchpad = %q", got)
+	}
+	agent.Sessions.UpdateScratchpad("agent:main:main", map[string]string{"ecog": "1", "chosen_trial": "NCT04229004"}, nil)
+
+	msg.Content = "Which trial did we pick?"
+	if _, err := al.processMessage(ctx, msg); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(provider.system, "## Scratchpad") || !strings.Contains(provider.system, "- chosen_trial: NCT04229004\n- ecog: 1") {
+		t.Fatalf("system prompt lacks the scratchpad:\n%s", provider.system)
+	}
+
+	msg.Content = "/scratchpad"
+	if got, _ := al.processMessage(ctx, msg); !strings.Contains(got, "ecog: 1") {
+		t.Fatalf("/scratchpad = %q", got)
+	}
+	msg.Content = "/scratchpad clear"
+	if got, _ := al.processMessage(ctx, msg); got != "Scratchpad cleared." {
+		t.Fatalf("/scratchpad clear = %q", got)
+	}
+	if got := agent.Sessions.Scratchpad("agent:main:main"); got != nil {
+		t.Errorf("scratchpad after clear = %v", got)
+	}
+}
@@ -0,0 +1,134 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/shadow"
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+// setupShadow opens the shadow log, hides the configured shadow tools from
+// every agent, and sends sampled calls of their live counterparts to them.
+func setupShadow(cfg *config.Config, registry *AgentRegistry) *shadow.Runner {
+	runner, err := shadow.NewRunner(cfg.ShadowPath(), shadow.Options{
+		SampleRate: cfg.Tools.Shadow.SampleRate,
+		Timeout:    time.Duration(cfg.Tools.Shadow.TimeoutSeconds) * time.Second,
+		Model:      cfg.Tools.Shadow.Model,
+		Tools:      cfg.Tools.Shadow.Tools,
+	})
+	if err != nil {
+		logger.WarnCF("agent", "Shadow mode disabled",
+			map[string]interface{}{
+				"error": err.Error(),
+			})
+		return nil
+	}
+
+	for _, agentID := range registry.ListAgentIDs() {
+		agent, ok := registry.GetAgent(agentID)
+		if !ok {
+			continue
+		}
+		shadowTools := make(map[string]tools.Tool)
+		for live, name := range runner.Tools() {
+			tool, ok := agent.Tools.Unregister(name)
+			if !ok {
+				logger.WarnCF("agent", "Shadow tool not found",
+					map[string]interface{}{
+						"agent_id": agentID,
+						"tool":     live,
+						"shadow":   name,
+					})
+				continue
+			}
+			shadowTools[live] = tool
+		}
+		if len(shadowTools) > 0 {
+			agent.Tools.SetShadow(shadowToolCalls(runner, agentID, shadowTools))
+		}
+	}
+	return runner
+}
+
+// shadowToolCalls repeats sampled calls of the live tools on their shadows.
+func shadowToolCalls(runner *shadow.Runner, agentID string, shadowTools map[string]tools.Tool) tools.ShadowFunc {
+	return func(ctx context.Context, name string, args map[string]interface{}, result *tools.ToolResult, duration time.Duration) {
+		tool, ok := shadowTools[name]
+		if !ok || !runner.Sample() {
+			return
+		}
+		meta := tools.CallMetadataFromContext(ctx)
+		input, _ := json.Marshal(args)
+		rec := shadow.Record{
+			Kind:          shadow.KindTool,
+			Primary:       name,
+			Shadow:        tool.Name(),
+			AgentID:       agentID,
+			SessionKey:    meta.SessionKey,
+			TurnID:        meta.TurnID,
+			Input:         string(input),
+			PrimaryResult: result.ForLLM,
+			PrimaryMs:     duration.Milliseconds(),
+		}
+		if result.IsError {
+			rec.PrimaryError = result.ForLLM
+		}
+		runner.Compare(ctx, rec, func(ctx context.Context) (string, error) {
+			r := tool.Execute(ctx, args)
+			if r.IsError {
+				return r.ForLLM, errors.New(r.ForLLM)
+			}
+			return r.ForLLM, nil
+		})
+	}
+}
+
+// shadowLLMCall repeats a sampled LLM call on the shadow model.
+func (al *AgentLoop) shadowLLMCall(ctx context.Context, agent *AgentInstance, messages []providers.Message, defs []providers.ToolDefinition, response *providers.LLMResponse, duration time.Duration) {
+	runner := al.shadows
+	if runner == nil || runner.Model() == "" || !runner.Sample() {
+		return
+	}
+	meta := tools.CallMetadataFromContext(ctx)
+	messages = append([]providers.Message(nil), messages...)
+	rec := shadow.Record{
+		Kind:          shadow.KindModel,
+		Primary:       agent.Model,
+		Shadow:        runner.Model(),
+		AgentID:       agent.ID,
+		SessionKey:    meta.SessionKey,
+		TurnID:        meta.TurnID,
+		PrimaryResult: describeResponse(response),
+		PrimaryMs:     duration.Milliseconds(),
+	}
+	runner.Compare(ctx, rec, func(ctx context.Context) (string, error) {
+		resp, err := agent.Provider.Chat(ctx, messages, defs, runner.Model(), map[string]interface{}{
+			"max_tokens":  8192,
+			"temperature": 0.7,
+		})
+		if err != nil {
+			return "", err
+		}
+		return describeResponse(resp), nil
+	})
+}
+
+// describeResponse renders a response as text for comparison: its content
+// followed by one line per tool call.
+func describeResponse(resp *providers.LLMResponse) string {
+	var sb strings.Builder
+	sb.WriteString(resp.Content)
+	for _, tc := range resp.ToolCalls {
+		args, _ := json.Marshal(tc.Arguments)
+		fmt.Fprintf(&sb, "\n→ %s(%s)", tc.Name, args)
+	}
+	return sb.String()
+}
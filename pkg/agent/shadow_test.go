@@ -0,0 +1,77 @@
+package agent
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/shadow"
+)
+
+type candidateLookupTool struct {
+	lookupTool
+}
+
+func (t *candidateLookupTool) Name() string { return "lookup_v2" }
+
+func TestShadow_ToolsAndModel(t *testing.T) {
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				Model:             "test-model",
+				MaxTokens:         4096,
+				MaxToolIterations: 5,
+			},
+		},
+	}
+	al := NewAgentLoop(cfg, bus.NewMessageBus(), &lookupProvider{})
+	live := &lookupTool{result: "CA19-9 was 35 U/mL"}
+	candidate := &candidateLookupTool{lookupTool{result: "CA19-9 was 35 U/mL"}}
+	al.RegisterTool(live)
+	al.RegisterTool(candidate)
+
+	cfg.Tools.Shadow = config.ShadowConfig{
+		Enabled:    true,
+		SampleRate: 1,
+		Model:      "candidate-model",
+		Tools:      map[string]string{"lookup": "lookup_v2"},
+	}
+	al.shadows = setupShadow(cfg, al.registry)
+	if al.shadows == nil {
+		t.Fatal("setupShadow returned nil")
+	}
+	agent := al.registry.GetDefaultAgent()
+	if _, ok := agent.Tools.Get("lookup_v2"); ok {
+		t.Error("shadow tool should be hidden from the model")
+	}
+
+	response, err := al.ProcessDirect(context.Background(), "What was my CA19-9?", "cli:shadow")
+	if err != nil {
+		t.Fatalf("ProcessDirect: %v", err)
+	}
+	if response != "Answer: CA19-9 was 35 U/mL" {
+		t.Errorf("response = %q", response)
+	}
+	al.Stop()
+
+	if live.calls != 1 || candidate.calls != 1 {
+		t.Errorf("live calls = %d, shadow calls = %d", live.calls, candidate.calls)
+	}
+	summaries, err := shadow.Summarize(cfg.ShadowPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(summaries) != 2 {
+		t.Fatalf("got %d summaries, want 2: %+v", len(summaries), summaries)
+	}
+	model, tool := summaries[0], summaries[1]
+	// The candidate model is served by the same provider, so it behaves identically.
+	if model.Kind != shadow.KindModel || model.Shadow != "candidate-model" || model.Samples != 2 || model.Matches != 2 {
+		t.Errorf("unexpected model summary %+v", model)
+	}
+	if tool.Primary != "lookup" || tool.Shadow != "lookup_v2" || tool.Samples != 1 || tool.Matches != 1 {
+		t.Errorf("unexpected tool summary %+v", tool)
+	}
+}
@@ -0,0 +1,89 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+// stepLimitError ends a turn that ran out of steps or went in circles.
+// The user gets a short apology instead of an answer.
+type stepLimitError struct {
+	reason string
+	loop   bool
+}
+
+func (e *stepLimitError) Error() string {
+	return "step limit reached: " + e.reason
+}
+
+// message is what the user is told, in Chinese when they wrote in it.
+func (e *stepLimitError) message(chinese bool) string {
+	switch {
+	case chinese && e.loop:
+		return "抱歉，这个问题我没能完成：我在重复同样的查询，却没有得到新的结果。可以换个说法，或把问题问得更具体一些。"
+	case chinese:
+		return "抱歉，这个问题我没能完成：需要的步骤超出了单个问题的上限。可以把问题拆小或问得更具体一些，也可以让我继续。"
+	case e.loop:
+		return "Sorry, I couldn't complete this: I kept repeating the same lookup without getting anywhere new. Try rephrasing the question or making it more specific."
+	default:
+		return "Sorry, I couldn't complete this: it needed more steps than I can take for one question. Try splitting it into smaller questions or making it more specific, or ask me to continue."
+	}
+}
+
+// stepGuard bounds the tool calls of one turn and notices loops: the same
+// call made again and again with the same result. A call whose result
+// changes, such as polling a background job, is not a loop.
+type stepGuard struct {
+	maxCalls   int // 0 is no limit
+	maxRepeats int // 0 turns loop detection off
+	calls      int
+	seen       map[string]*seenCall
+}
+
+type seenCall struct {
+	result  string
+	repeats int
+}
+
+func newStepGuard(maxCalls, maxRepeats int) *stepGuard {
+	return &stepGuard{maxCalls: maxCalls, maxRepeats: maxRepeats, seen: make(map[string]*seenCall)}
+}
+
+func callKey(tc providers.ToolCall) string {
+	args, _ := json.Marshal(tc.Arguments)
+	return tc.Name + "\x00" + string(args)
+}
+
+// check returns why tc may not run, or nil if it may.
+func (g *stepGuard) check(tc providers.ToolCall) *stepLimitError {
+	if g.maxRepeats > 0 {
+		if s := g.seen[callKey(tc)]; s != nil && s.repeats >= g.maxRepeats {
+			return &stepLimitError{reason: fmt.Sprintf("%s was called %d times with the same arguments and result", tc.Name, s.repeats+1), loop: true}
+		}
+	}
+	if g.maxCalls > 0 && g.calls >= g.maxCalls {
+		return &stepLimitError{reason: fmt.Sprintf("the turn made %d tool calls", g.calls)}
+	}
+	return nil
+}
+
+// start counts a call that passed check and is about to run.
+func (g *stepGuard) start() {
+	g.calls++
+}
+
+// record notes the result a call gave.
+func (g *stepGuard) record(tc providers.ToolCall, result string) {
+	key := callKey(tc)
+	s := g.seen[key]
+	switch {
+	case s == nil:
+		g.seen[key] = &seenCall{result: result}
+	case s.result == result:
+		s.repeats++
+	default:
+		s.result, s.repeats = result, 0
+	}
+}
@@ -0,0 +1,123 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+// loopingProvider never answers: it asks for the lookup tool every time,
+// with query set by queryFor.
+type loopingProvider struct {
+	calls    int
+	queryFor func(call int) string
+}
+
+func (p *loopingProvider) Chat(ctx context.Context, messages []providers.Message, defs []providers.ToolDefinition, model string, opts map[string]interface{}) (*providers.LLMResponse, error) {
+	p.calls++
+	return &providers.LLMResponse{ToolCalls: []providers.ToolCall{{
+		ID:        fmt.Sprintf("call-%d", p.calls),
+		Name:      "lookup",
+		Arguments: map[string]interface{}{"query": p.queryFor(p.calls)},
+	}}}, nil
+}
+
+func (p *loopingProvider) GetDefaultModel() string {
+	return "test-model"
+}
+
+// pollingTool returns a new result on every call.
+type pollingTool struct{ lookupTool }
+
+func (t *pollingTool) Execute(ctx context.Context, args map[string]interface{}) *tools.ToolResult {
+	t.calls++
+	return tools.NewToolResult(fmt.Sprintf("progress %d%%", t.calls*10))
+}
+
+func TestStepLimits(t *testing.T) {
+	same := func(int) string { return "CA19-9" }
+	tests := []struct {
+		name       string
+		queryFor   func(int) string
+		tool       tools.Tool
+		maxCalls   int
+		maxRepeats int
+		wantCalls  int
+		wantReply  string
+	}{
+		{"identical calls are a loop", same, &lookupTool{result: "35 U/mL"}, 0, 2, 3, "kept repeating"},
+		{"changing results are not a loop", same, &pollingTool{}, 0, 2, 8, "more steps"},
+		{"tool call budget", func(n int) string { return fmt.Sprint(n) }, &lookupTool{result: "35 U/mL"}, 4, 2, 4, "more steps"},
+		{"iterations run out", func(n int) string { return fmt.Sprint(n) }, &lookupTool{result: "35 U/mL"}, 0, 0, 8, "more steps"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := &loopingProvider{queryFor: tt.queryFor}
+			cfg := &config.Config{
+				Agents: config.AgentsConfig{
+					Defaults: config.AgentDefaults{
+						Workspace:         t.TempDir(),
+						Model:             "test-model",
+						MaxTokens:         4096,
+						MaxToolIterations: 8,
+						MaxToolCalls:      tt.maxCalls,
+						MaxRepeatedCalls:  tt.maxRepeats,
+					},
+				},
+			}
+			al := NewAgentLoop(cfg, bus.NewMessageBus(), provider)
+			al.RegisterTool(tt.tool)
+
+			reply, err := al.ProcessDirect(context.Background(), "What was my CA19-9?", "agent:main:steps")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(reply, tt.wantReply) {
+				t.Errorf("reply = %q, want it to mention %q", reply, tt.wantReply)
+			}
+			var calls int
+			switch tool := tt.tool.(type) {
+			case *lookupTool:
+				calls = tool.calls
+			case *pollingTool:
+				calls = tool.calls
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("tool ran %d times, want %d", calls, tt.wantCalls)
+			}
+
+			// Every tool call in the history has its result, and the
+			// apology ends the turn.
+			history := al.registry.GetDefaultAgent().Sessions.GetHistory("agent:main:steps")
+			results := make(map[string]bool)
+			for _, m := range history {
+				if m.Role == "tool" {
+					results[m.ToolCallID] = true
+				}
+			}
+			for _, m := range history {
+				for _, tc := range m.ToolCalls {
+					if !results[tc.ID] {
+						t.Errorf("tool call %s has no result", tc.ID)
+					}
+				}
+			}
+			if last := history[len(history)-1]; last.Role != "assistant" || last.Content != reply {
+				t.Errorf("last message = %+v", last)
+			}
+		})
+	}
+}
+
+func TestStepLimitMessage_Chinese(t *testing.T) {
+	limit := &stepLimitError{loop: true}
+	if msg := limit.message(true); !strings.Contains(msg, "没能完成") {
+		t.Errorf("message = %q", msg)
+	}
+}
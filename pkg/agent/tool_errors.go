@@ -0,0 +1,153 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+// toolRetries is how many more times a call failing with a temporary error
+// is made before the failure is handed to the model.
+const toolRetries = 2
+
+// toolRetryDelay is the wait before the first repeat; it doubles after each.
+var toolRetryDelay = time.Second
+
+// executeTool runs a tool call, repeating it while it fails with
+// tools.ErrRetryable. When the tool rejects the arguments, the model is
+// shown the error and asked for corrected arguments, up to
+// agents.defaults.max_arg_repairs times, before the failure is handed to
+// the turn. It returns the last result, how many attempts that call took,
+// and the call as last made.
+func (al *AgentLoop) executeTool(ctx context.Context, agent *AgentInstance, tc providers.ToolCall, opts processOptions, asyncCallback tools.AsyncCallback) (*tools.ToolResult, int, providers.ToolCall) {
+	result, attempts := al.executeWithRetries(ctx, agent, tc, opts, asyncCallback)
+	for repair := 1; repair <= al.cfg.Agents.Defaults.MaxArgRepairs && errors.Is(result.Err, tools.ErrInvalidArgs); repair++ {
+		args, ok := al.repairToolArgs(ctx, agent, tc, opts, result)
+		if !ok {
+			break
+		}
+		logger.InfoCF("agent", "Retrying tool call with corrected arguments",
+			map[string]interface{}{
+				"agent_id": agent.ID,
+				"tool":     tc.Name,
+				"repair":   repair,
+				"error":    result.Err.Error(),
+			})
+		tc.Arguments = args
+		result, attempts = al.executeWithRetries(ctx, agent, tc, opts, asyncCallback)
+	}
+	return result, attempts, tc
+}
+
+func (al *AgentLoop) executeWithRetries(ctx context.Context, agent *AgentInstance, tc providers.ToolCall, opts processOptions, asyncCallback tools.AsyncCallback) (*tools.ToolResult, int) {
+	delay := toolRetryDelay
+	for attempt := 1; ; attempt++ {
+		result := agent.Tools.ExecuteWithContext(ctx, tc.Name, tc.Arguments, opts.Channel, opts.ChatID, asyncCallback)
+		if attempt > toolRetries || !errors.Is(result.Err, tools.ErrRetryable) {
+			return result, attempt
+		}
+		logger.WarnCF("agent", "Retrying tool call after temporary failure",
+			map[string]interface{}{
+				"agent_id": agent.ID,
+				"tool":     tc.Name,
+				"attempt":  attempt,
+				"error":    result.Err.Error(),
+			})
+		select {
+		case <-ctx.Done():
+			return result, attempt
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// repairToolArgs shows the model a call whose arguments were rejected and
+// asks it to make the call again. Only the failed tool is offered, and the
+// conversation is not included, so the model fixes the arguments rather
+// than changing its plan. It reports false when the model does not call
+// the tool again, or calls it with the same arguments.
+func (al *AgentLoop) repairToolArgs(ctx context.Context, agent *AgentInstance, tc providers.ToolCall, opts processOptions, result *tools.ToolResult) (map[string]interface{}, bool) {
+	var defs []providers.ToolDefinition
+	for _, def := range agent.Tools.ToProviderDefs() {
+		if def.Function.Name == tc.Name {
+			defs = append(defs, def)
+		}
+	}
+	if len(defs) == 0 {
+		return nil, false
+	}
+
+	args, _ := json.Marshal(tc.Arguments)
+	problem := result.ForLLM
+	if problem == "" {
+		problem = result.Err.Error()
+	}
+	var sb strings.Builder
+	if opts.UserMessage != "" {
+		fmt.Fprintf(&sb, "The user asked:\n%s\n\n", opts.UserMessage)
+	}
+	fmt.Fprintf(&sb, "You called %s with these arguments:\n%s\n\n", tc.Name, args)
+	fmt.Fprintf(&sb, "The tool rejected them:\n%s\n\n", problem)
+	fmt.Fprintf(&sb, "Call %s again with corrected arguments that match its parameters. ", tc.Name)
+	sb.WriteString("Keep every value that was not rejected, and change only what the error names.")
+
+	response, err := agent.Provider.Chat(ctx, []providers.Message{
+		{Role: "user", Content: sb.String()},
+	}, defs, agent.Model, map[string]interface{}{
+		"max_tokens":  4096,
+		"temperature": 0.2,
+	})
+	if err != nil {
+		logger.WarnCF("agent", "Argument repair failed",
+			map[string]interface{}{
+				"agent_id": agent.ID,
+				"tool":     tc.Name,
+				"error":    err.Error(),
+			})
+		return nil, false
+	}
+	for _, call := range response.ToolCalls {
+		if call.Name == tc.Name && call.Arguments != nil {
+			// The same arguments again would only fail the same way.
+			return call.Arguments, !reflect.DeepEqual(call.Arguments, tc.Arguments)
+		}
+	}
+	return nil, false
+}
+
+// toolErrorGuidance is appended to a failed tool result to tell the model
+// how to proceed, based on the category of the failure. It is empty for
+// results without a known category.
+func toolErrorGuidance(agent *AgentInstance, tc providers.ToolCall, result *tools.ToolResult, attempts int) string {
+	switch tools.ErrorKind(result.Err) {
+	case tools.ErrRetryable:
+		return fmt.Sprintf("\n\n[System: %s failed %d times with a temporary error. Do not call it again this turn; answer with what you have and say what could not be checked.]", tc.Name, attempts)
+	case tools.ErrInvalidArgs:
+		guidance := fmt.Sprintf("\n\n[System: The arguments to %s were rejected. Correct them and call %s again.]", tc.Name, tc.Name)
+		if tool, ok := agent.Tools.Get(tc.Name); ok {
+			if schema, err := json.Marshal(tool.Parameters()); err == nil {
+				guidance += "\nParameters: " + string(schema)
+			}
+		}
+		return guidance
+	case tools.ErrPermissionDenied:
+		return fmt.Sprintf("\n\n[System: %s is not permitted and the user has been told. Do not call it again; continue without it.]", tc.Name)
+	case tools.ErrNotFound:
+		return "\n\n[System: Nothing was found. Say so plainly instead of guessing, and do not repeat the call with the same arguments.]"
+	}
+	return ""
+}
+
+// permissionNotice is what the user is told when a tool call is refused.
+func permissionNotice(tool string) string {
+	return fmt.Sprintf("%s was not run: permission denied.", tool)
+}
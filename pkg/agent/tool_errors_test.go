@@ -0,0 +1,189 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+// scriptedLookupTool returns its results in order, repeating the last.
+type scriptedLookupTool struct {
+	lookupTool
+	results []*tools.ToolResult
+}
+
+func (t *scriptedLookupTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type":       "object",
+		"properties": map[string]interface{}{"query": map[string]interface{}{"type": "string"}},
+		"required":   []string{"query"},
+	}
+}
+
+func (t *scriptedLookupTool) Execute(ctx context.Context, args map[string]interface{}) *tools.ToolResult {
+	t.calls++
+	return t.results[min(t.calls, len(t.results))-1]
+}
+
+func newToolErrorLoop(t *testing.T, tool tools.Tool) (*AgentLoop, *bus.MessageBus) {
+	t.Helper()
+	saved := toolRetryDelay
+	toolRetryDelay = time.Millisecond
+	t.Cleanup(func() { toolRetryDelay = saved })
+
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				Model:             "test-model",
+				MaxTokens:         4096,
+				MaxToolIterations: 5,
+			},
+		},
+	}
+	msgBus := bus.NewMessageBus()
+	al := NewAgentLoop(cfg, msgBus, &lookupProvider{})
+	al.RegisterTool(tool)
+	return al, msgBus
+}
+
+func TestAgentLoop_RetriesTemporaryToolFailures(t *testing.T) {
+	tool := &scriptedLookupTool{results: []*tools.ToolResult{
+		tools.ErrorResult("rate limited").WithError(tools.ErrRetryable),
+		tools.NewToolResult("CA19-9 was 35 U/mL"),
+	}}
+	al, _ := newToolErrorLoop(t, tool)
+
+	response, err := al.ProcessDirect(context.Background(), "What was my CA19-9?", "cli:retry")
+	if err != nil {
+		t.Fatalf("ProcessDirect: %v", err)
+	}
+	if tool.calls != 2 || response != "Answer: CA19-9 was 35 U/mL" {
+		t.Errorf("calls = %d, response = %q", tool.calls, response)
+	}
+}
+
+func TestAgentLoop_GivesUpAfterRetries(t *testing.T) {
+	tool := &scriptedLookupTool{results: []*tools.ToolResult{
+		tools.ErrorResult("rate limited").WithError(tools.ErrRetryable),
+	}}
+	al, _ := newToolErrorLoop(t, tool)
+
+	response, err := al.ProcessDirect(context.Background(), "What was my CA19-9?", "cli:retry")
+	if err != nil {
+		t.Fatalf("ProcessDirect: %v", err)
+	}
+	if tool.calls != toolRetries+1 || !strings.Contains(response, "failed 3 times") {
+		t.Errorf("calls = %d, response = %q", tool.calls, response)
+	}
+}
+
+func TestAgentLoop_ToolErrorGuidance(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{"invalid args", tools.ErrInvalidArgs, `Parameters: {"properties":{"query"`},
+		{"permission denied", tools.ErrPermissionDenied, "user has been told"},
+		{"not found", tools.ErrNotFound, "Nothing was found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tool := &scriptedLookupTool{results: []*tools.ToolResult{
+				tools.ErrorResult("lookup failed").WithError(tt.err),
+			}}
+			al, _ := newToolErrorLoop(t, tool)
+
+			response, err := al.ProcessDirect(context.Background(), "What was my CA19-9?", "cli:guidance")
+			if err != nil {
+				t.Fatalf("ProcessDirect: %v", err)
+			}
+			if tool.calls != 1 || !strings.HasPrefix(response, "Answer: lookup failed") || !strings.Contains(response, tt.want) {
+				t.Errorf("calls = %d, response = %q", tool.calls, response)
+			}
+		})
+	}
+}
+
+// markerTool only accepts lower-case marker names.
+type markerTool struct {
+	scriptedLookupTool
+	seen []interface{}
+}
+
+func (t *markerTool) Execute(ctx context.Context, args map[string]interface{}) *tools.ToolResult {
+	t.calls++
+	t.seen = append(t.seen, args["query"])
+	if args["query"] != "ca19-9" {
+		return tools.ErrorResult("query must be one of ca19-9, cea").WithError(tools.ErrInvalidArgs)
+	}
+	return tools.NewToolResult("35 U/mL")
+}
+
+// repairingProvider behaves like lookupProvider, and answers argument
+// repair requests with the given arguments.
+type repairingProvider struct {
+	lookupProvider
+	args    map[string]interface{}
+	repairs int
+}
+
+func (p *repairingProvider) Chat(ctx context.Context, messages []providers.Message, defs []providers.ToolDefinition, model string, opts map[string]interface{}) (*providers.LLMResponse, error) {
+	if len(messages) == 1 && strings.Contains(messages[0].Content, "The tool rejected them") {
+		p.repairs++
+		if len(defs) != 1 || defs[0].Function.Name != "lookup" {
+			return nil, fmt.Errorf("repair offered %d tools", len(defs))
+		}
+		return &providers.LLMResponse{ToolCalls: []providers.ToolCall{{ID: "repair", Name: "lookup", Arguments: p.args}}}, nil
+	}
+	return p.lookupProvider.Chat(ctx, messages, defs, model, opts)
+}
+
+func TestAgentLoop_RepairsRejectedArguments(t *testing.T) {
+	tests := []struct {
+		name        string
+		args        map[string]interface{}
+		wantCalls   int
+		wantRepairs int
+		want        string
+	}{
+		{"corrected", map[string]interface{}{"query": "ca19-9"}, 2, 1, `made again with {"query":"ca19-9"}]` + "\n\n35 U/mL"},
+		{"still wrong", map[string]interface{}{"query": "CEA"}, 2, 2, "query must be one of ca19-9, cea"},
+		{"unchanged", map[string]interface{}{"query": "CA19-9"}, 1, 1, "query must be one of ca19-9, cea"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tool := &markerTool{}
+			provider := &repairingProvider{args: tt.args}
+			cfg := &config.Config{
+				Agents: config.AgentsConfig{
+					Defaults: config.AgentDefaults{
+						Workspace:         t.TempDir(),
+						Model:             "test-model",
+						MaxTokens:         4096,
+						MaxToolIterations: 5,
+						MaxArgRepairs:     2,
+					},
+				},
+			}
+			al := NewAgentLoop(cfg, bus.NewMessageBus(), provider)
+			al.RegisterTool(tool)
+
+			response, err := al.ProcessDirect(context.Background(), "What was my CA19-9?", "cli:repair")
+			if err != nil {
+				t.Fatalf("ProcessDirect: %v", err)
+			}
+			if tool.calls != tt.wantCalls || provider.repairs != tt.wantRepairs || !strings.Contains(response, tt.want) {
+				t.Errorf("calls = %d (%v), repairs = %d, response = %q", tool.calls, tool.seen, provider.repairs, response)
+			}
+		})
+	}
+}
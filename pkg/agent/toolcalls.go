@@ -0,0 +1,131 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/tools"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+// runToolCalls runs the tool calls of one model reply and returns the
+// content for the LLM of each, in the order of the calls. Consecutive
+// calls to concurrent tools, such as two searches, run at the same time,
+// at most agents.defaults.max_parallel_tools at once; any other call runs
+// on its own, after the calls before it.
+func (al *AgentLoop) runToolCalls(ctx context.Context, agent *AgentInstance, calls []providers.ToolCall, opts processOptions, iteration int) []string {
+	results := make([]string, len(calls))
+	limit := al.cfg.Agents.Defaults.MaxParallelTools
+	for i := 0; i < len(calls); {
+		end := i + 1
+		if limit > 1 && al.isConcurrentCall(agent, calls[i]) {
+			for end < len(calls) && al.isConcurrentCall(agent, calls[end]) {
+				end++
+			}
+		}
+		if end-i == 1 {
+			results[i] = al.runToolCall(ctx, agent, calls[i], opts, iteration)
+			i = end
+			continue
+		}
+
+		logger.InfoCF("agent", "Running tool calls in parallel",
+			map[string]interface{}{
+				"agent_id":  agent.ID,
+				"count":     end - i,
+				"iteration": iteration,
+			})
+		slots := make(chan struct{}, limit)
+		var wg sync.WaitGroup
+		for j := i; j < end; j++ {
+			wg.Add(1)
+			slots <- struct{}{}
+			go func(j int) {
+				defer wg.Done()
+				defer func() { <-slots }()
+				results[j] = al.runToolCall(ctx, agent, calls[j], opts, iteration)
+			}(j)
+		}
+		wg.Wait()
+		i = end
+	}
+	return results
+}
+
+func (al *AgentLoop) isConcurrentCall(agent *AgentInstance, tc providers.ToolCall) bool {
+	tool, ok := agent.Tools.Get(tc.Name)
+	return ok && tools.IsConcurrent(tool)
+}
+
+// runToolCall executes one tool call, sends the user any content the
+// result has for them, and returns the content for the LLM.
+func (al *AgentLoop) runToolCall(ctx context.Context, agent *AgentInstance, tc providers.ToolCall, opts processOptions, iteration int) string {
+	argsJSON, _ := json.Marshal(tc.Arguments)
+	argsPreview := utils.Truncate(string(argsJSON), 200)
+	logger.InfoCF("agent", fmt.Sprintf("Tool call: %s(%s)", tc.Name, argsPreview),
+		map[string]interface{}{
+			"agent_id":  agent.ID,
+			"tool":      tc.Name,
+			"iteration": iteration,
+		})
+
+	// Create async callback for tools that implement AsyncTool
+	// NOTE: Following openclaw's design, async tools do NOT send results directly to users.
+	// Instead, they notify the agent via PublishInbound, and the agent decides
+	// whether to forward the result to the user (in processSystemMessage).
+	asyncCallback := func(callbackCtx context.Context, result *tools.ToolResult) {
+		// Log the async completion but don't send directly to user
+		// The agent will handle user notification via processSystemMessage
+		if !result.Silent && result.ForUser != "" {
+			logger.InfoCF("agent", "Async tool completed, agent will handle notification",
+				map[string]interface{}{
+					"tool":        tc.Name,
+					"content_len": len(result.ForUser),
+				})
+		}
+	}
+
+	toolResult, attempts, made := al.executeTool(ctx, agent, tc, opts, asyncCallback)
+
+	// Send user-facing content immediately if not Silent
+	userContent, files := toolResult.UserMessage(opts.Channel)
+	if userContent == "" && errors.Is(toolResult.Err, tools.ErrPermissionDenied) {
+		userContent = permissionNotice(tc.Name)
+	}
+	if (userContent != "" || len(files) > 0) && opts.SendResponse {
+		al.bus.PublishOutbound(bus.OutboundMessage{
+			Channel:     opts.Channel,
+			ChatID:      opts.ChatID,
+			Content:     userContent,
+			Attachments: toAttachments(files),
+		})
+		logger.DebugCF("agent", "Sent tool result to user",
+			map[string]interface{}{
+				"tool":        tc.Name,
+				"content_len": len(userContent),
+				"attachments": len(files),
+			})
+	}
+
+	// Determine content for LLM based on tool result
+	contentForLLM := toolResult.ForLLM
+	if contentForLLM == "" && toolResult.Err != nil {
+		contentForLLM = toolResult.Err.Error()
+	}
+	if !toolResult.IsError {
+		contentForLLM = al.condenseToolResult(ctx, agent, tc.Name, contentForLLM)
+	}
+	if !reflect.DeepEqual(made.Arguments, tc.Arguments) {
+		correctedJSON, _ := json.Marshal(made.Arguments)
+		contentForLLM = fmt.Sprintf("[System: The arguments were rejected and the call was made again with %s]\n\n", correctedJSON) + contentForLLM
+	}
+	contentForLLM += toolErrorGuidance(agent, made, toolResult, attempts)
+	return contentForLLM
+}
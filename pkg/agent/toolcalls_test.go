@@ -0,0 +1,131 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+// parallelProvider asks for calls in its first reply and answers after.
+type parallelProvider struct {
+	calls []providers.ToolCall
+	turns int
+}
+
+func (p *parallelProvider) Chat(ctx context.Context, messages []providers.Message, defs []providers.ToolDefinition, model string, opts map[string]interface{}) (*providers.LLMResponse, error) {
+	p.turns++
+	if p.turns == 1 {
+		return &providers.LLMResponse{ToolCalls: p.calls}, nil
+	}
+	return &providers.LLMResponse{Content: "done"}, nil
+}
+
+func (p *parallelProvider) GetDefaultModel() string {
+	return "test-model"
+}
+
+// tracker records how many tool calls run at once.
+type tracker struct {
+	mu      sync.Mutex
+	running int
+	peak    int
+	alone   map[string]bool // tool -> no other call was running when it started
+}
+
+// trackedTool takes a little while, so overlapping calls overlap.
+type trackedTool struct {
+	name       string
+	concurrent bool
+	tracker    *tracker
+}
+
+func (t *trackedTool) Name() string        { return t.name }
+func (t *trackedTool) Description() string { return "Tracked tool" }
+func (t *trackedTool) Concurrent() bool    { return t.concurrent }
+func (t *trackedTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{"type": "object", "properties": map[string]interface{}{}}
+}
+
+func (t *trackedTool) Execute(ctx context.Context, args map[string]interface{}) *tools.ToolResult {
+	t.tracker.mu.Lock()
+	t.tracker.alone[t.name] = t.tracker.running == 0
+	t.tracker.running++
+	if t.tracker.running > t.tracker.peak {
+		t.tracker.peak = t.tracker.running
+	}
+	t.tracker.mu.Unlock()
+
+	time.Sleep(30 * time.Millisecond)
+
+	t.tracker.mu.Lock()
+	t.tracker.running--
+	t.tracker.mu.Unlock()
+	return tools.NewToolResult(fmt.Sprintf("%s result", t.name))
+}
+
+func TestRunToolCalls_Parallel(t *testing.T) {
+	names := []string{"search_a", "search_b", "search_c", "write_note", "search_d"}
+	tests := []struct {
+		name        string
+		maxParallel int
+		wantPeak    int
+	}{
+		{"parallel", 2, 2},
+		{"one at a time", 1, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls []providers.ToolCall
+			for i, name := range names {
+				calls = append(calls, providers.ToolCall{ID: fmt.Sprintf("call-%d", i), Name: name, Arguments: map[string]interface{}{}})
+			}
+			provider := &parallelProvider{calls: calls}
+			cfg := &config.Config{
+				Agents: config.AgentsConfig{
+					Defaults: config.AgentDefaults{
+						Workspace:         t.TempDir(),
+						Model:             "test-model",
+						MaxTokens:         4096,
+						MaxToolIterations: 5,
+						MaxParallelTools:  tt.maxParallel,
+					},
+				},
+			}
+			al := NewAgentLoop(cfg, bus.NewMessageBus(), provider)
+			tr := &tracker{alone: make(map[string]bool)}
+			for _, name := range names {
+				al.RegisterTool(&trackedTool{name: name, concurrent: name != "write_note", tracker: tr})
+			}
+
+			if _, err := al.ProcessDirect(context.Background(), "Search everything", "agent:main:parallel"); err != nil {
+				t.Fatal(err)
+			}
+			if tr.peak != tt.wantPeak {
+				t.Errorf("peak concurrent calls = %d, want %d", tr.peak, tt.wantPeak)
+			}
+			if !tr.alone["write_note"] || !tr.alone["search_d"] {
+				t.Errorf("calls around a non-concurrent tool overlapped: %v", tr.alone)
+			}
+
+			// Results are in the history in the order of the calls
+			var results []string
+			for _, m := range al.registry.GetDefaultAgent().Sessions.GetHistory("agent:main:parallel") {
+				if m.Role == "tool" {
+					results = append(results, m.ToolCallID+"="+m.Content)
+				}
+			}
+			for i, name := range names {
+				if want := fmt.Sprintf("call-%d=%s result", i, name); i >= len(results) || results[i] != want {
+					t.Fatalf("results = %v, want %s at %d", results, want, i)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,188 @@
+package agent
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/tokens"
+	"github.com/sipeed/picoclaw/pkg/usage"
+)
+
+// setupUsage opens the usage log. A log that cannot be opened disables
+// tracking, and with it budgets, rather than blocking startup.
+func setupUsage(cfg *config.Config) *usage.Tracker {
+	tracker, err := usage.NewTracker(cfg.UsagePath(), cfg.Usage.Pricing)
+	if err != nil {
+		logger.ErrorCF("agent", "Usage tracking disabled",
+			map[string]interface{}{
+				"path":  cfg.UsagePath(),
+				"error": err.Error(),
+			})
+		return nil
+	}
+	return tracker
+}
+
+// Usage returns the usage tracker, or nil when tracking is disabled.
+func (al *AgentLoop) Usage() *usage.Tracker {
+	return al.usage
+}
+
+// budgetModel returns the budget's fallback model when the user has spent
+// their daily token or cost budget, and "" otherwise.
+func (al *AgentLoop) budgetModel(userID string) string {
+	budget := al.cfg.Usage.Budget
+	if al.usage == nil || userID == "" || budget.FallbackModel == "" {
+		return ""
+	}
+	for _, exempt := range budget.ExemptUsers {
+		if exempt == userID {
+			return ""
+		}
+	}
+	today := al.usage.Today(userID)
+	over := (budget.DailyTokensPerUser > 0 && today.Tokens() >= budget.DailyTokensPerUser) ||
+		(budget.DailyCostPerUser > 0 && today.Cost >= budget.DailyCostPerUser)
+	if !over {
+		return ""
+	}
+	logger.InfoCF("agent", "Daily usage budget spent, using fallback model",
+		map[string]interface{}{
+			"user_id": userID,
+			"tokens":  today.Tokens(),
+			"cost":    today.Cost,
+			"model":   budget.FallbackModel,
+		})
+	return budget.FallbackModel
+}
+
+// recordUsage records an LLM call of the turn, if usage is tracked. When the
+// provider does not report usage, the tokens of messages and the response
+// are counted with the model's tokenizer.
+func (al *AgentLoop) recordUsage(agent *AgentInstance, opts processOptions, iteration int, provider, model string,
+	messages []providers.Message, response *providers.LLMResponse) {
+	if al.usage == nil || response == nil {
+		return
+	}
+	if provider == "" {
+		ref := providers.ParseModelRef(model, al.cfg.Agents.Defaults.Provider)
+		if ref != nil {
+			provider, model = ref.Provider, ref.Model
+		}
+	}
+	entry := usage.Entry{
+		TurnID:     opts.TurnID,
+		Iteration:  iteration,
+		AgentID:    agent.ID,
+		SessionKey: opts.SessionKey,
+		UserID:     opts.UserID,
+		Channel:    opts.Channel,
+		Provider:   provider,
+		Model:      model,
+		ToolCalls:  len(response.ToolCalls),
+		Degraded:   opts.Model != "",
+	}
+	if response.Usage != nil {
+		entry.PromptTokens = response.Usage.PromptTokens
+		entry.CompletionTokens = response.Usage.CompletionTokens
+		entry.CachedTokens = response.Usage.CachedTokens
+		entry.CacheWriteTokens = response.Usage.CacheWriteTokens
+	} else {
+		counter := tokens.ForModel(model)
+		entry.PromptTokens = counter.Messages(messages)
+		entry.CompletionTokens = counter.Messages([]providers.Message{{Content: response.Content, ToolCalls: response.ToolCalls}})
+		entry.Estimated = true
+	}
+	al.usage.Record(entry)
+}
+
+// UsageHandler serves usage totals as JSON to admin tokens.
+// Query parameters: user, days (default 7, counting today), and group_by,
+// a comma-separated list of day, user, provider and model (default day,user).
+func (al *AgentLoop) UsageHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+
+		role, ok := al.authenticate(r)
+		if !ok {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeJSONError(w, http.StatusUnauthorized, "invalid or missing bearer token")
+			return
+		}
+		if role != AdminRole {
+			writeJSONError(w, http.StatusForbidden, "admin role required")
+			return
+		}
+		if al.usage == nil {
+			writeJSONError(w, http.StatusNotFound, "usage tracking is disabled")
+			return
+		}
+
+		q := r.URL.Query()
+		days := 7
+		if raw := q.Get("days"); raw != "" {
+			n, err := strconv.Atoi(raw)
+			if err != nil || n < 1 {
+				writeJSONError(w, http.StatusBadRequest, "days must be a positive integer")
+				return
+			}
+			days = n
+		}
+		groupBy := []string{"day", "user"}
+		if raw := q.Get("group_by"); raw != "" {
+			groupBy = strings.Split(raw, ",")
+		}
+		now := time.Now()
+		from := now.AddDate(0, 0, 1-days).Format("2006-01-02")
+
+		rows, err := al.usage.Summary(usage.Query{
+			From:    from,
+			UserID:  q.Get("user"),
+			GroupBy: groupBy,
+		})
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		var total usage.Totals
+		for _, row := range rows {
+			total.Add(row.Totals)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"from":  from,
+			"to":    now.Format("2006-01-02"),
+			"rows":  rows,
+			"total": total,
+		})
+	})
+}
+
+// MetricsHandler serves usage totals and provider retry counters in the
+// Prometheus text format. It is unauthenticated, like the health
+// endpoints, and has no per-user labels. Usage totals are left out when
+// usage tracking is disabled.
+func (al *AgentLoop) MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		if al.usage != nil {
+			if err := al.usage.WriteMetrics(w); err != nil {
+				logger.WarnCF("agent", "Failed to write metrics", map[string]interface{}{"error": err.Error()})
+				return
+			}
+		}
+		if err := providers.WriteRetryMetrics(w); err != nil {
+			logger.WarnCF("agent", "Failed to write metrics", map[string]interface{}{"error": err.Error()})
+		}
+	})
+}
@@ -0,0 +1,162 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/usage"
+)
+
+// usageProvider answers every call with 600 prompt and 100 completion tokens.
+type usageProvider struct {
+	models []string
+}
+
+func (p *usageProvider) Chat(ctx context.Context, messages []providers.Message, tools []providers.ToolDefinition, model string, opts map[string]interface{}) (*providers.LLMResponse, error) {
+	p.models = append(p.models, model)
+	return &providers.LLMResponse{
+		Content: "ok",
+		Usage:   &providers.UsageInfo{PromptTokens: 600, CompletionTokens: 100, TotalTokens: 700},
+	}, nil
+}
+
+func (p *usageProvider) GetDefaultModel() string {
+	return "gpt-4o"
+}
+
+func TestUsageBudget(t *testing.T) {
+	provider := &usageProvider{}
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				Provider:          "openai",
+				Model:             "gpt-4o",
+				MaxTokens:         4096,
+				MaxToolIterations: 10,
+			},
+		},
+		Gateway: config.GatewayConfig{
+			APITokens: []config.GatewayAPIToken{
+				{Token: "admin-token", Role: AdminRole},
+				{Token: "patient-token", Role: "patient"},
+			},
+		},
+		Usage: config.UsageConfig{
+			Enabled: true,
+			Pricing: map[string]config.ModelPrice{"gpt-4o": {InputPerMillion: 2.5, OutputPerMillion: 10}},
+			Budget: config.UsageBudgetConfig{
+				DailyTokensPerUser: 1000,
+				FallbackModel:      "gpt-4o-mini",
+				ExemptUsers:        []string{"doctor"},
+			},
+		},
+	}
+	al := NewAgentLoop(cfg, bus.NewMessageBus(), provider)
+	defer al.Stop()
+
+	send := func(user string) {
+		t.Helper()
+		_, err := al.processMessage(context.Background(), bus.InboundMessage{
+			Channel: "telegram", SenderID: user, ChatID: user, Content: "hello",
+		})
+		if err != nil {
+			t.Fatalf("processMessage: %v", err)
+		}
+	}
+	// 700 tokens, then 1400: the third turn is over budget.
+	send("1001")
+	send("1001")
+	send("1001")
+	send("doctor")
+	send("doctor")
+	send("doctor")
+	want := []string{"gpt-4o", "gpt-4o", "gpt-4o-mini", "gpt-4o", "gpt-4o", "gpt-4o"}
+	if strings.Join(provider.models, ",") != strings.Join(want, ",") {
+		t.Errorf("models = %v, want %v", provider.models, want)
+	}
+
+	today := al.Usage().Today("1001")
+	if today.Turns != 3 || today.DegradedCalls != 1 || today.Tokens() != 2100 {
+		t.Errorf("usage of 1001 = %+v", today)
+	}
+
+	get := func(token, query string) (*httptest.ResponseRecorder, []usage.Row) {
+		req := httptest.NewRequest(http.MethodGet, "/api/usage"+query, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		al.UsageHandler().ServeHTTP(rec, req)
+		var resp struct {
+			Rows []usage.Row `json:"rows"`
+		}
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		return rec, resp.Rows
+	}
+	if rec, _ := get("patient-token", ""); rec.Code != http.StatusForbidden {
+		t.Errorf("patient token: status %d", rec.Code)
+	}
+	if rec, _ := get("admin-token", "?group_by=session"); rec.Code != http.StatusBadRequest {
+		t.Errorf("bad group_by: status %d", rec.Code)
+	}
+	rec, rows := get("admin-token", "?user=1001&group_by=provider,model")
+	if rec.Code != http.StatusOK || len(rows) != 2 {
+		t.Fatalf("status %d, rows %+v", rec.Code, rows)
+	}
+	if rows[0].Provider != "openai" || rows[0].Model != "gpt-4o" || rows[0].Cost != (1200*2.5+200*10)/1e6 ||
+		rows[1].Model != "gpt-4o-mini" || rows[1].Cost != 0 {
+		t.Errorf("rows = %+v", rows)
+	}
+
+	rec = httptest.NewRecorder()
+	al.MetricsHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if !strings.Contains(rec.Body.String(), `picoclaw_llm_degraded_calls_total{provider="openai",model="gpt-4o-mini"} 1`) {
+		t.Errorf("metrics:\n%s", rec.Body.String())
+	}
+}
+
+// noUsageProvider answers without reporting usage, as some local servers do.
+type noUsageProvider struct{}
+
+func (noUsageProvider) Chat(ctx context.Context, messages []providers.Message, tools []providers.ToolDefinition, model string, opts map[string]interface{}) (*providers.LLMResponse, error) {
+	return &providers.LLMResponse{Content: "胰腺癌术后需要定期复查"}, nil
+}
+
+func (noUsageProvider) GetDefaultModel() string {
+	return "qwen-max"
+}
+
+func TestUsageCountedWhenNotReported(t *testing.T) {
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				Provider:          "qwen",
+				Model:             "qwen-max",
+				MaxTokens:         4096,
+				MaxToolIterations: 10,
+			},
+		},
+		Usage: config.UsageConfig{Enabled: true},
+	}
+	al := NewAgentLoop(cfg, bus.NewMessageBus(), noUsageProvider{})
+	defer al.Stop()
+
+	_, err := al.processMessage(context.Background(), bus.InboundMessage{
+		Channel: "telegram", SenderID: "1001", ChatID: "1001", Content: "术后多久复查？",
+	})
+	if err != nil {
+		t.Fatalf("processMessage: %v", err)
+	}
+	// 11 Chinese characters at 0.65 tokens, plus the message overhead
+	today := al.Usage().Today("1001")
+	if today.CompletionTokens != 12 || today.PromptTokens == 0 {
+		t.Errorf("usage = %+v", today)
+	}
+}
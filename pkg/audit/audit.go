@@ -0,0 +1,364 @@
+// Package audit keeps an append-only record of tool calls, so deployments
+// can trace exactly what the agent looked up or changed for each user.
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+const (
+	redactedValue         = "[REDACTED]"
+	defaultMaxArgChars    = 1000
+	defaultMaxResultChars = 16000
+)
+
+// KindTurn marks an entry that records a whole turn rather than one tool
+// call.
+const KindTurn = "turn"
+
+// defaultRedactKeys are argument names whose values are never written.
+// Matching ignores case, treats "-" as "_", and is by substring, so
+// "X-Api-Key" matches "api_key".
+var defaultRedactKeys = []string{"api_key", "apikey", "token", "password", "secret", "authorization", "cookie"}
+
+// Entry is one audited tool call, or a turn when Kind is KindTurn. Turn
+// entries and tool results are only written when turn recording is on.
+type Entry struct {
+	Time       time.Time              `json:"time"`
+	Kind       string                 `json:"kind,omitempty"`
+	TurnID     string                 `json:"turn_id,omitempty"`
+	Tool       string                 `json:"tool,omitempty"`
+	Args       map[string]interface{} `json:"args,omitempty"`
+	DurationMs int64                  `json:"duration_ms"`
+	Success    bool                   `json:"success"`
+	Error      string                 `json:"error,omitempty"`
+	AgentID    string                 `json:"agent_id,omitempty"`
+	SessionKey string                 `json:"session_key,omitempty"`
+	UserID     string                 `json:"user_id,omitempty"`
+	Channel    string                 `json:"channel,omitempty"`
+	ChatID     string                 `json:"chat_id,omitempty"`
+	Result     string                 `json:"result,omitempty"`
+	Model      string                 `json:"model,omitempty"`
+	Prompt     string                 `json:"prompt,omitempty"`
+	Response   string                 `json:"response,omitempty"`
+}
+
+// TurnRecord describes one finished turn: the message the agent answered
+// and its reply.
+type TurnRecord struct {
+	TurnID     string
+	AgentID    string
+	SessionKey string
+	UserID     string
+	Channel    string
+	ChatID     string
+	Model      string
+	Prompt     string
+	Response   string
+	Start      time.Time
+	Duration   time.Duration
+	Error      string
+}
+
+type Options struct {
+	// RedactKeys are extra argument names to redact.
+	RedactKeys []string
+	// MaxArgChars truncates long string arguments; defaults to 1000.
+	MaxArgChars int
+	// RecordTurns also writes prompts, replies and tool results, so turns
+	// can be replayed. They may contain patient data.
+	RecordTurns bool
+}
+
+// Store appends entries as JSON lines to a file that is only ever appended to.
+type Store struct {
+	path        string
+	redactKeys  []string
+	maxArgChars int
+	recordTurns bool
+	mu          sync.Mutex
+	file        *os.File
+}
+
+// NewStore opens (creating if needed) the audit log at path.
+func NewStore(path string, opts Options) (*Store, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create audit directory: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+
+	maxArgChars := opts.MaxArgChars
+	if maxArgChars <= 0 {
+		maxArgChars = defaultMaxArgChars
+	}
+	redactKeys := append([]string(nil), defaultRedactKeys...)
+	for _, key := range opts.RedactKeys {
+		redactKeys = append(redactKeys, normalizeKey(key))
+	}
+
+	return &Store{
+		path:        path,
+		redactKeys:  redactKeys,
+		maxArgChars: maxArgChars,
+		recordTurns: opts.RecordTurns,
+		file:        f,
+	}, nil
+}
+
+// Path returns the audit log location.
+func (s *Store) Path() string {
+	return s.path
+}
+
+// Append writes one entry.
+func (s *Store) Append(entry Entry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return fmt.Errorf("audit log is closed")
+	}
+	_, err = s.file.Write(append(data, '\n'))
+	return err
+}
+
+// RecordToolCall implements tools.CallRecorder. Arguments are redacted
+// before they are written; write failures are logged, not returned, so
+// auditing never breaks a tool call.
+func (s *Store) RecordToolCall(record tools.ToolCallRecord) {
+	entry := Entry{
+		Time:       record.Start.UTC(),
+		Tool:       record.Tool,
+		Args:       s.redact(record.Args),
+		DurationMs: record.Duration.Milliseconds(),
+		Success:    !record.IsError,
+		Error:      truncate(record.Error, s.maxArgChars),
+		AgentID:    record.Meta.AgentID,
+		SessionKey: record.Meta.SessionKey,
+		UserID:     record.Meta.UserID,
+		Channel:    record.Channel,
+		ChatID:     record.ChatID,
+		TurnID:     record.Meta.TurnID,
+	}
+	if s.recordTurns {
+		entry.Result = truncate(record.Result, defaultMaxResultChars)
+	}
+	if err := s.Append(entry); err != nil {
+		logger.ErrorCF("audit", "Failed to write audit entry",
+			map[string]interface{}{
+				"tool":  record.Tool,
+				"error": err.Error(),
+			})
+	}
+}
+
+// RecordTurn writes a turn entry when turn recording is on. Like
+// RecordToolCall, it logs rather than returns write failures.
+func (s *Store) RecordTurn(record TurnRecord) {
+	if !s.recordTurns {
+		return
+	}
+	entry := Entry{
+		Time:       record.Start.UTC(),
+		Kind:       KindTurn,
+		TurnID:     record.TurnID,
+		DurationMs: record.Duration.Milliseconds(),
+		Success:    record.Error == "",
+		Error:      record.Error,
+		AgentID:    record.AgentID,
+		SessionKey: record.SessionKey,
+		UserID:     record.UserID,
+		Channel:    record.Channel,
+		ChatID:     record.ChatID,
+		Model:      record.Model,
+		Prompt:     record.Prompt,
+		Response:   record.Response,
+	}
+	if err := s.Append(entry); err != nil {
+		logger.ErrorCF("audit", "Failed to write audit entry",
+			map[string]interface{}{
+				"turn_id": record.TurnID,
+				"error":   err.Error(),
+			})
+	}
+}
+
+// Close closes the underlying file.
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
+
+func (s *Store) redact(args map[string]interface{}) map[string]interface{} {
+	if len(args) == 0 {
+		return nil
+	}
+	return s.redactValue(args).(map[string]interface{})
+}
+
+func (s *Store) redactValue(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(val))
+		for k, item := range val {
+			if s.isSensitive(k) {
+				out[k] = redactedValue
+				continue
+			}
+			out[k] = s.redactValue(item)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(val))
+		for i, item := range val {
+			out[i] = s.redactValue(item)
+		}
+		return out
+	case string:
+		return truncate(val, s.maxArgChars)
+	default:
+		return val
+	}
+}
+
+func normalizeKey(key string) string {
+	return strings.ReplaceAll(strings.ToLower(strings.TrimSpace(key)), "-", "_")
+}
+
+func (s *Store) isSensitive(key string) bool {
+	key = normalizeKey(key)
+	for _, k := range s.redactKeys {
+		if k != "" && strings.Contains(key, k) {
+			return true
+		}
+	}
+	return false
+}
+
+func truncate(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	return fmt.Sprintf("%s... (%d chars)", s[:max], len(s))
+}
+
+// Filter selects entries in Query. Empty fields match everything, except
+// that turn entries are only returned when Turns is set.
+type Filter struct {
+	SessionKey string
+	UserID     string
+	Tool       string
+	TurnID     string
+	Turns      bool
+	Since      time.Time
+	// Limit keeps only the most recent matches; 0 means no limit.
+	Limit int
+}
+
+func (f Filter) matches(e Entry) bool {
+	return (f.Turns || e.Kind != KindTurn) &&
+		(f.SessionKey == "" || e.SessionKey == f.SessionKey) &&
+		(f.UserID == "" || e.UserID == f.UserID) &&
+		(f.Tool == "" || e.Tool == f.Tool) &&
+		(f.TurnID == "" || e.TurnID == f.TurnID) &&
+		(f.Since.IsZero() || !e.Time.Before(f.Since))
+}
+
+// Query returns matching entries from the log at path, oldest first.
+// A missing log yields no entries.
+func Query(path string, filter Filter) ([]Entry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		if !filter.matches(e) {
+			continue
+		}
+		entries = append(entries, e)
+		if filter.Limit > 0 && len(entries) > filter.Limit {
+			entries = entries[1:]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// Query returns matching entries from this store's log, oldest first.
+func (s *Store) Query(filter Filter) ([]Entry, error) {
+	return Query(s.path, filter)
+}
+
+// Turn is a past turn reassembled from the log.
+type Turn struct {
+	// Entry is the turn entry; nil when the turn was not recorded, in which
+	// case only its tool calls are known.
+	Entry *Entry  `json:"turn,omitempty"`
+	Calls []Entry `json:"calls"`
+}
+
+// LoadTurn collects the turn entry and tool calls for turnID from the log
+// at path.
+func LoadTurn(path, turnID string) (*Turn, error) {
+	if turnID == "" {
+		return nil, fmt.Errorf("turn ID is required")
+	}
+	entries, err := Query(path, Filter{TurnID: turnID, Turns: true})
+	if err != nil {
+		return nil, err
+	}
+	turn := &Turn{}
+	for i := range entries {
+		if entries[i].Kind == KindTurn {
+			turn.Entry = &entries[i]
+			continue
+		}
+		turn.Calls = append(turn.Calls, entries[i])
+	}
+	if turn.Entry == nil && len(turn.Calls) == 0 {
+		return nil, fmt.Errorf("turn %s not found in %s", turnID, path)
+	}
+	return turn, nil
+}
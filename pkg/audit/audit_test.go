@@ -0,0 +1,182 @@
+package audit
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+type echoTool struct{}
+
+func (echoTool) Name() string        { return "echo" }
+func (echoTool) Description() string { return "echo" }
+func (echoTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{"type": "object"}
+}
+func (echoTool) Execute(ctx context.Context, args map[string]interface{}) *tools.ToolResult {
+	if args["fail"] == true {
+		return tools.ErrorResult("echo failed")
+	}
+	return tools.NewToolResult("ok")
+}
+
+func newTestStore(t *testing.T, opts Options) *Store {
+	t.Helper()
+	store, err := NewStore(filepath.Join(t.TempDir(), "audit", "tool_calls.jsonl"), opts)
+	if err != nil {
+		t.Fatalf("NewStore() error = %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func TestStore_RecordsRegistryCalls(t *testing.T) {
+	store := newTestStore(t, Options{})
+	r := tools.NewToolRegistry()
+	r.Register(echoTool{})
+	r.SetCallRecorder(store)
+
+	ctx := tools.WithCallMetadata(context.Background(), tools.CallMetadata{
+		AgentID:    "main",
+		SessionKey: "s1",
+		UserID:     "u1",
+	})
+	r.ExecuteWithContext(ctx, "echo", map[string]interface{}{"q": "hi"}, "telegram", "42", nil)
+	r.ExecuteWithContext(ctx, "echo", map[string]interface{}{"fail": true}, "telegram", "42", nil)
+	r.ExecuteWithContext(context.Background(), "missing", nil, "", "", nil)
+
+	all, err := store.Query(Filter{})
+	if err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+	if len(all) != 3 {
+		t.Fatalf("expected 3 entries, got %d", len(all))
+	}
+
+	first := all[0]
+	if first.Tool != "echo" || !first.Success || first.SessionKey != "s1" || first.UserID != "u1" ||
+		first.AgentID != "main" || first.Channel != "telegram" || first.ChatID != "42" || first.Args["q"] != "hi" {
+		t.Errorf("unexpected first entry: %+v", first)
+	}
+	if all[1].Success || all[1].Error != "echo failed" {
+		t.Errorf("expected failed entry, got %+v", all[1])
+	}
+	if all[2].Tool != "missing" || all[2].Success {
+		t.Errorf("unknown tools should be audited as failures: %+v", all[2])
+	}
+}
+
+func TestStore_RedactsArgs(t *testing.T) {
+	store := newTestStore(t, Options{RedactKeys: []string{"patient_name"}, MaxArgChars: 10})
+
+	store.RecordToolCall(tools.ToolCallRecord{
+		Tool:  "web_fetch",
+		Start: time.Now(),
+		Args: map[string]interface{}{
+			"url":          "https://example.com/very/long/path",
+			"X-Api-Key":    "secret-value",
+			"patient_name": "Alice",
+			"headers":      map[string]interface{}{"Authorization": "Bearer abc"},
+		},
+	})
+
+	entries, err := store.Query(Filter{})
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("Query() = %v, %v", entries, err)
+	}
+	args := entries[0].Args
+	if args["X-Api-Key"] != redactedValue || args["patient_name"] != redactedValue {
+		t.Errorf("sensitive args not redacted: %v", args)
+	}
+	if headers := args["headers"].(map[string]interface{}); headers["Authorization"] != redactedValue {
+		t.Errorf("nested args not redacted: %v", headers)
+	}
+	if url := args["url"].(string); !strings.HasPrefix(url, "https://ex... (") {
+		t.Errorf("long args not truncated: %q", url)
+	}
+}
+
+func TestQuery_Filters(t *testing.T) {
+	store := newTestStore(t, Options{})
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, session := range []string{"a", "b", "a", "a"} {
+		store.RecordToolCall(tools.ToolCallRecord{
+			Tool:  "knows_ai_search",
+			Start: base.Add(time.Duration(i) * time.Minute),
+			Meta:  tools.CallMetadata{SessionKey: session},
+			Args:  map[string]interface{}{"n": float64(i)},
+		})
+	}
+
+	tests := []struct {
+		name   string
+		filter Filter
+		want   []float64
+	}{
+		{name: "by session", filter: Filter{SessionKey: "a"}, want: []float64{0, 2, 3}},
+		{name: "limit keeps most recent", filter: Filter{SessionKey: "a", Limit: 2}, want: []float64{2, 3}},
+		{name: "since", filter: Filter{Since: base.Add(2 * time.Minute)}, want: []float64{2, 3}},
+		{name: "no match", filter: Filter{Tool: "exec"}, want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, err := store.Query(tt.filter)
+			if err != nil {
+				t.Fatalf("Query() error = %v", err)
+			}
+			if len(entries) != len(tt.want) {
+				t.Fatalf("got %d entries, want %d", len(entries), len(tt.want))
+			}
+			for i, e := range entries {
+				if e.Args["n"] != tt.want[i] {
+					t.Errorf("entry %d: n = %v, want %v", i, e.Args["n"], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestQuery_MissingLog(t *testing.T) {
+	entries, err := Query(filepath.Join(t.TempDir(), "none.jsonl"), Filter{})
+	if err != nil || entries != nil {
+		t.Fatalf("Query() = %v, %v; want nil, nil", entries, err)
+	}
+}
+
+func TestStore_RecordTurns(t *testing.T) {
+	meta := tools.CallMetadata{SessionKey: "s1", TurnID: "turn-1"}
+	call := tools.ToolCallRecord{Tool: "echo", Meta: meta, Start: time.Now(), Result: "ok"}
+	turn := TurnRecord{TurnID: "turn-1", SessionKey: "s1", Prompt: "hi", Response: "hello", Start: time.Now()}
+
+	off := newTestStore(t, Options{})
+	off.RecordToolCall(call)
+	off.RecordTurn(turn)
+	entries, _ := off.Query(Filter{Turns: true})
+	if len(entries) != 1 || entries[0].TurnID != "turn-1" || entries[0].Result != "" {
+		t.Errorf("without RecordTurns expected only the call, without its result: %+v", entries)
+	}
+
+	on := newTestStore(t, Options{RecordTurns: true})
+	on.RecordToolCall(call)
+	on.RecordTurn(turn)
+	if entries, _ := on.Query(Filter{}); len(entries) != 1 || entries[0].Kind == KindTurn {
+		t.Errorf("turn entries should be hidden by default: %+v", entries)
+	}
+
+	got, err := LoadTurn(on.Path(), "turn-1")
+	if err != nil {
+		t.Fatalf("LoadTurn: %v", err)
+	}
+	if got.Entry == nil || got.Entry.Prompt != "hi" || got.Entry.Response != "hello" ||
+		len(got.Calls) != 1 || got.Calls[0].Result != "ok" {
+		t.Errorf("unexpected turn: %+v", got)
+	}
+	if _, err := LoadTurn(on.Path(), "turn-2"); err == nil {
+		t.Error("expected an unknown turn to fail")
+	}
+}
@@ -9,10 +9,16 @@ type MessageBus struct {
 	inbound  chan InboundMessage
 	outbound chan OutboundMessage
 	handlers map[string]MessageHandler
+	filters  []InboundFilter
 	closed   bool
 	mu       sync.RWMutex
 }
 
+// InboundFilter inspects inbound messages before they are queued.
+// Returning true consumes the message so the agent loop never sees it;
+// this lets control commands (e.g. approvals) through while the loop is busy.
+type InboundFilter func(msg InboundMessage) bool
+
 func NewMessageBus() *MessageBus {
 	return &MessageBus{
 		inbound:  make(chan InboundMessage, 100),
@@ -22,6 +28,15 @@ func NewMessageBus() *MessageBus {
 }
 
 func (mb *MessageBus) PublishInbound(msg InboundMessage) {
+	mb.mu.RLock()
+	filters := mb.filters
+	mb.mu.RUnlock()
+	for _, filter := range filters {
+		if filter(msg) {
+			return
+		}
+	}
+
 	mb.mu.RLock()
 	defer mb.mu.RUnlock()
 	if mb.closed {
@@ -57,6 +72,22 @@ func (mb *MessageBus) SubscribeOutbound(ctx context.Context) (OutboundMessage, b
 	}
 }
 
+// SetInboundFilter installs a filter run on every published inbound message,
+// replacing any filters added before.
+func (mb *MessageBus) SetInboundFilter(filter InboundFilter) {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+	mb.filters = []InboundFilter{filter}
+}
+
+// AddInboundFilter adds a filter after the existing ones. Filters run in
+// order and the first one that consumes a message stops the rest.
+func (mb *MessageBus) AddInboundFilter(filter InboundFilter) {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+	mb.filters = append(mb.filters[:len(mb.filters):len(mb.filters)], filter)
+}
+
 func (mb *MessageBus) RegisterHandler(channel string, handler MessageHandler) {
 	mb.mu.Lock()
 	defer mb.mu.Unlock()
@@ -14,6 +14,43 @@ type OutboundMessage struct {
 	Channel string `json:"channel"`
 	ChatID  string `json:"chat_id"`
 	Content string `json:"content"`
+	// QuickReplies are suggested replies the user can send with one tap.
+	QuickReplies []string `json:"quick_replies,omitempty"`
+	// Buttons are actions shown under the message on channels that have
+	// inline buttons; pressing one sends its Data as the user's message.
+	// Other channels drop them, so Content must say how to do the same.
+	Buttons []Button `json:"buttons,omitempty"`
+	// ReplyTo is the ID of the message this one answers. Channels that
+	// can reply to a message do so; the others show Quote, the text being
+	// answered, above Content.
+	ReplyTo string `json:"reply_to,omitempty"`
+	Quote   string `json:"quote,omitempty"`
+	// Citations and Attachments are delivered after Content, in that order.
+	Citations   []string     `json:"citations,omitempty"`
+	Attachments []Attachment `json:"attachments,omitempty"`
+	// Progress marks a transient status update sent while a turn is still
+	// running. Channels that can edit messages show it in place of the
+	// previous update and replace it with the answer.
+	Progress bool `json:"progress,omitempty"`
+	// Stream marks a progress update showing a tool's latest output.
+	// Channels that cannot edit messages in place drop it rather than post
+	// every update.
+	Stream bool `json:"stream,omitempty"`
+}
+
+// Button is an inline action on a message, such as approving a tool call
+// or rating the answer. Data is what the agent receives when it is pressed.
+type Button struct {
+	Label string `json:"label"`
+	Data  string `json:"data"`
+}
+
+// Attachment is a file or image sent along with a message.
+type Attachment struct {
+	Name     string `json:"name,omitempty"`
+	URL      string `json:"url,omitempty"`
+	Path     string `json:"path,omitempty"`
+	MimeType string `json:"mime_type,omitempty"`
 }
 
 type MessageHandler func(InboundMessage) error
@@ -2,9 +2,17 @@ package channels
 
 import (
 	"context"
+	"fmt"
+	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/pairing"
+	"github.com/sipeed/picoclaw/pkg/utils"
 )
 
 type Channel interface {
@@ -16,12 +24,88 @@ type Channel interface {
 	IsAllowed(senderID string) bool
 }
 
+// QuickReplyChannel is implemented by channels that can show
+// OutboundMessage.QuickReplies as buttons. Other channels receive the
+// replies as a numbered list appended to the message text.
+type QuickReplyChannel interface {
+	SupportsQuickReplies() bool
+}
+
+// ProgressChannel is implemented by channels that can show progress
+// updates (OutboundMessage.Progress) in a single message edited in place,
+// which the answer then replaces. Other channels receive each update as a
+// normal message, except streamed tool output, which they drop.
+type ProgressChannel interface {
+	UpdateProgress(ctx context.Context, chatID, text string) error
+}
+
+// VoiceChannel is implemented by channels that can send audio
+// attachments with a local Path as voice messages. On other channels, and
+// when sending fails, audio is listed with the message's other attachments.
+type VoiceChannel interface {
+	SendVoice(ctx context.Context, chatID string, audio bus.Attachment) error
+}
+
+// ReplyChannel is implemented by channels that can send a message as a
+// reply to OutboundMessage.ReplyTo. Other channels show
+// OutboundMessage.Quote above the message text.
+type ReplyChannel interface {
+	SupportsReplies() bool
+}
+
+// MediaChannel is implemented by channels that can upload files through
+// their platform's media API. Attachments with a local Path, such as the
+// charts and documents tools produce, are sent after the message text;
+// on other channels, and when uploading fails, they are listed in it.
+type MediaChannel interface {
+	SendMedia(ctx context.Context, chatID string, file bus.Attachment) error
+}
+
+// mediaCaption is the caption of an uploaded file: its name, unless that
+// is just the file's own name.
+func mediaCaption(file bus.Attachment) string {
+	if file.Name == filepath.Base(file.Path) {
+		return ""
+	}
+	return file.Name
+}
+
+// isVoiceAttachment reports whether a is a local audio file.
+func isVoiceAttachment(a bus.Attachment) bool {
+	return a.Path != "" && strings.HasPrefix(a.MimeType, "audio/")
+}
+
+// quickRepliesAsText folds msg.QuickReplies into its content.
+func quickRepliesAsText(msg bus.OutboundMessage) bus.OutboundMessage {
+	var sb strings.Builder
+	sb.WriteString(msg.Content)
+	for i, reply := range msg.QuickReplies {
+		fmt.Fprintf(&sb, "\n%d. %s", i+1, reply)
+	}
+	msg.Content = sb.String()
+	msg.QuickReplies = nil
+	return msg
+}
+
+// quoteAsText puts msg.Quote above its content as a quotation.
+func quoteAsText(msg bus.OutboundMessage) bus.OutboundMessage {
+	msg.Content = "> " + msg.Quote + "\n\n" + msg.Content
+	msg.ReplyTo, msg.Quote = "", ""
+	return msg
+}
+
 type BaseChannel struct {
 	config    interface{}
 	bus       *bus.MessageBus
 	running   bool
 	name      string
 	allowList []string
+	groups    config.GroupsConfig
+	limits    utils.MediaLimits
+	access    config.AccessConfig
+	pairings  *pairing.Store
+	noticeMu  sync.Mutex
+	notified  map[string]time.Time // when refused senders were last answered
 }
 
 func NewBaseChannel(name string, config interface{}, bus *bus.MessageBus, allowList []string) *BaseChannel {
@@ -42,11 +126,46 @@ func (c *BaseChannel) IsRunning() bool {
 	return c.running
 }
 
+// IsAllowed reports whether senderID may use the channel: it is on the
+// allowlist or paired, and not on the denylist. Everyone not denied is
+// allowed when there is no allowlist and pairing is off.
 func (c *BaseChannel) IsAllowed(senderID string) bool {
-	if len(c.allowList) == 0 {
-		return true
+	return c.checkAccess(senderID, "") == accessAllowed
+}
+
+// accessDecision is the outcome of checking a sender against the
+// channel's access lists.
+type accessDecision int
+
+const (
+	accessAllowed accessDecision = iota
+	accessDenied
+	accessUnknown // not on the allowlist and not paired
+)
+
+// checkAccess checks senderID, writing in chatID, against the channel's
+// lists. A group or chat ID on a list covers everyone writing in it.
+func (c *BaseChannel) checkAccess(senderID, chatID string) accessDecision {
+	if matchesAccessList(c.access.DenyFrom, senderID) || (chatID != "" && matchesAccessList(c.access.DenyFrom, chatID)) {
+		return accessDenied
+	}
+	if len(c.allowList) == 0 && !c.access.Pairing {
+		return accessAllowed
+	}
+	if matchesAccessList(c.allowList, senderID) || (chatID != "" && matchesAccessList(c.allowList, chatID)) {
+		return accessAllowed
 	}
+	if c.pairings != nil && c.pairings.IsPaired(c.name, accessID(senderID)) {
+		return accessAllowed
+	}
+	return accessUnknown
+}
 
+// matchesAccessList reports whether id is on list. Entries and IDs may
+// be compound "id|username" values, usernames may start with "@", and
+// phone numbers match with or without "+" and a WhatsApp "@s.whatsapp.net"
+// suffix.
+func matchesAccessList(list []string, senderID string) bool {
 	// Extract parts from compound senderID like "123456|username"
 	idPart := senderID
 	userPart := ""
@@ -55,7 +174,7 @@ func (c *BaseChannel) IsAllowed(senderID string) bool {
 		userPart = senderID[idx+1:]
 	}
 
-	for _, allowed := range c.allowList {
+	for _, allowed := range list {
 		// Strip leading "@" from allowed value for username matching
 		trimmed := strings.TrimPrefix(allowed, "@")
 		allowedID := trimmed
@@ -73,7 +192,8 @@ func (c *BaseChannel) IsAllowed(senderID string) bool {
 			idPart == trimmed ||
 			idPart == allowedID ||
 			(allowedUser != "" && senderID == allowedUser) ||
-			(userPart != "" && (userPart == allowed || userPart == trimmed || userPart == allowedUser)) {
+			(userPart != "" && (userPart == allowed || userPart == trimmed || userPart == allowedUser)) ||
+			accessID(idPart) == accessID(allowedID) {
 			return true
 		}
 	}
@@ -81,17 +201,137 @@ func (c *BaseChannel) IsAllowed(senderID string) bool {
 	return false
 }
 
+// accessID is the form of a sender ID that pairings are kept under: the
+// ID without a username or phone number decorations.
+func accessID(senderID string) string {
+	if idx := strings.Index(senderID, "|"); idx > 0 {
+		senderID = senderID[:idx]
+	}
+	senderID = strings.TrimSuffix(senderID, "@s.whatsapp.net")
+	senderID = strings.TrimSuffix(senderID, "@c.us")
+	return strings.TrimPrefix(senderID, "+")
+}
+
+// Admit decides whether to handle a message from senderID in chatID, and
+// answers refused senders in direct chats: with a pairing code when
+// pairing is on and they are not denied, otherwise with the blocked
+// message if one is set. Channels call it before downloading attachments;
+// HandleMessage calls it for every message.
+func (c *BaseChannel) Admit(senderID, chatID string, direct bool) bool {
+	decision := c.checkAccess(senderID, chatID)
+	if decision == accessAllowed {
+		return true
+	}
+	logger.DebugCF(c.name, "Message rejected by access control", map[string]interface{}{
+		"sender_id": senderID,
+		"chat_id":   chatID,
+	})
+	if !direct || !c.shouldNotify(accessID(senderID)) {
+		return false
+	}
+
+	text := c.access.BlockedMessage
+	if decision == accessUnknown && c.access.Pairing && c.pairings != nil {
+		code, err := c.pairings.Request(c.name, accessID(senderID))
+		if err != nil {
+			logger.ErrorCF(c.name, "Failed to create pairing code", map[string]interface{}{
+				"error": err.Error(),
+			})
+		} else {
+			text = fmt.Sprintf("This assistant is private. To ask for access, send this pairing code to the person who runs it: %s\n(It expires in %d minutes.)", code, int(pairing.CodeTTL.Minutes()))
+			logger.InfoCF(c.name, "Pairing requested", map[string]interface{}{
+				"sender_id": accessID(senderID),
+				"code":      code,
+			})
+		}
+	}
+	if text != "" && c.bus != nil {
+		c.bus.PublishOutbound(bus.OutboundMessage{Channel: c.name, ChatID: chatID, Content: text})
+	}
+	return false
+}
+
+// blockedNoticeInterval is how often a refused sender is answered, so
+// that someone who keeps writing does not get a reply to every message.
+const blockedNoticeInterval = time.Hour
+
+func (c *BaseChannel) shouldNotify(senderID string) bool {
+	c.noticeMu.Lock()
+	defer c.noticeMu.Unlock()
+	if last, ok := c.notified[senderID]; ok && time.Since(last) < blockedNoticeInterval {
+		return false
+	}
+	if c.notified == nil {
+		c.notified = make(map[string]time.Time)
+	}
+	c.notified[senderID] = time.Now()
+	return true
+}
+
+// SetAccessPolicy sets the channel's denylist, pairing and blocked
+// message; pairings is where paired senders are kept.
+func (c *BaseChannel) SetAccessPolicy(access config.AccessConfig, pairings *pairing.Store) {
+	c.access = access
+	c.pairings = pairings
+}
+
+// SetGroupPolicy sets how the channel treats group chats.
+func (c *BaseChannel) SetGroupPolicy(groups config.GroupsConfig) {
+	c.groups = groups
+}
+
+// SetAttachmentPolicy sets which files users may send.
+func (c *BaseChannel) SetAttachmentPolicy(attachments config.AttachmentsConfig) {
+	c.limits = utils.MediaLimits{
+		MaxBytes:     int64(attachments.MaxSizeMB) << 20,
+		AllowedTypes: attachments.AllowedTypes,
+	}
+}
+
+// RespondsInGroup reports whether a group message is for the bot: one
+// that mentions the bot or replies to it always is, and any other is only
+// when the group policy does not require a mention. Channels check it
+// before downloading attachments or showing typing for a group message.
+func (c *BaseChannel) RespondsInGroup(mentioned bool) bool {
+	return mentioned || !c.groups.RequireMention
+}
+
+// HandleMessage publishes a message from a user. Channels mark group
+// messages with metadata peer_kind "group" or "channel", and with
+// mentioned "true" when they mention or reply to the bot; group messages
+// not for the bot are dropped.
 func (c *BaseChannel) HandleMessage(senderID, chatID, content string, media []string, metadata map[string]string) {
-	if !c.IsAllowed(senderID) {
+	kind := metadata["peer_kind"]
+	isGroup := kind == "group" || kind == "channel"
+	// Group IDs on the access lists name the group, not a thread in it
+	chat := chatID
+	if isGroup && metadata["peer_id"] != "" {
+		chat = metadata["peer_id"]
+	}
+	if !c.Admit(senderID, chat, !isGroup) {
 		return
 	}
+	if isGroup && !c.RespondsInGroup(metadata["mentioned"] == "true") {
+		logger.DebugCF(c.name, "Ignoring group message without mention", map[string]interface{}{
+			"chat_id": chatID,
+		})
+		return
+	}
+
+	// Attachments are checked and copied before the channel deletes its
+	// downloads; the agent is told about those that were turned away so it
+	// can tell the user
+	kept, rejected := utils.KeepMedia(media, c.limits)
+	for _, r := range rejected {
+		content += "\n[attachment not accepted: " + r + "]"
+	}
 
 	msg := bus.InboundMessage{
 		Channel:  c.name,
 		SenderID: senderID,
 		ChatID:   chatID,
 		Content:  content,
-		Media:    media,
+		Media:    kept,
 		Metadata: metadata,
 	}
 
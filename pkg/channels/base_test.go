@@ -1,11 +1,24 @@
 package channels
 
-import "testing"
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/pairing"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
 
 func TestBaseChannelIsAllowed(t *testing.T) {
 	tests := []struct {
 		name      string
 		allowList []string
+		denyList  []string
 		senderID  string
 		want      bool
 	}{
@@ -39,14 +52,174 @@ func TestBaseChannelIsAllowed(t *testing.T) {
 			senderID:  "654321|bob",
 			want:      false,
 		},
+		{
+			name:      "phone number matches with plus and WhatsApp suffix",
+			allowList: []string{"+6591234567"},
+			senderID:  "6591234567@s.whatsapp.net",
+			want:      true,
+		},
+		{
+			name:     "denylist blocks with no allowlist",
+			denyList: []string{"@mallory"},
+			senderID: "777|mallory",
+			want:     false,
+		},
+		{
+			name:      "denylist wins over allowlist",
+			allowList: []string{"123456"},
+			denyList:  []string{"123456"},
+			senderID:  "123456",
+			want:      false,
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			ch := NewBaseChannel("test", nil, nil, tt.allowList)
+			ch.SetAccessPolicy(config.AccessConfig{DenyFrom: tt.denyList}, nil)
 			if got := ch.IsAllowed(tt.senderID); got != tt.want {
 				t.Fatalf("IsAllowed(%q) = %v, want %v", tt.senderID, got, tt.want)
 			}
 		})
 	}
 }
+
+func TestQuickRepliesAsText(t *testing.T) {
+	msg := quickRepliesAsText(bus.OutboundMessage{
+		Channel:      "slack",
+		ChatID:       "C1",
+		Content:      "You might also ask:",
+		QuickReplies: []string{"What is CA19-9?", "Is fatigue expected?"},
+	})
+	want := "You might also ask:\n1. What is CA19-9?\n2. Is fatigue expected?"
+	if msg.Content != want || msg.QuickReplies != nil {
+		t.Errorf("quickRepliesAsText() = %q %v, want %q", msg.Content, msg.QuickReplies, want)
+	}
+}
+
+func TestBaseChannelGroupPolicy(t *testing.T) {
+	tests := []struct {
+		name           string
+		requireMention bool
+		metadata       map[string]string
+		want           bool
+	}{
+		{"direct message", true, map[string]string{"peer_kind": "direct"}, true},
+		{"group message without mention", true, map[string]string{"peer_kind": "group", "mentioned": "false"}, false},
+		{"group message with mention", true, map[string]string{"peer_kind": "group", "mentioned": "true"}, true},
+		{"channel message without mention", true, map[string]string{"peer_kind": "channel"}, false},
+		{"mention not required", false, map[string]string{"peer_kind": "group"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msgBus := bus.NewMessageBus()
+			ch := NewBaseChannel("test", nil, msgBus, nil)
+			ch.SetGroupPolicy(config.GroupsConfig{RequireMention: tt.requireMention})
+			ch.HandleMessage("u1", "g1", "How long does jaundice last after a stent?", nil, tt.metadata)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+			if _, got := msgBus.ConsumeInbound(ctx); got != tt.want {
+				t.Errorf("published = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBaseChannelAttachmentPolicy(t *testing.T) {
+	dir := t.TempDir()
+	report := filepath.Join(dir, "report.pdf")
+	os.WriteFile(report, []byte("%PDF-1.7\n"), 0600)
+	archive := filepath.Join(dir, "records.zip")
+	os.WriteFile(archive, []byte("PK\x03\x04"), 0600)
+
+	msgBus := bus.NewMessageBus()
+	ch := NewBaseChannel("test", nil, msgBus, nil)
+	ch.SetAttachmentPolicy(config.AttachmentsConfig{MaxSizeMB: 1, AllowedTypes: config.FlexibleStringSlice{"application/pdf"}})
+	ch.HandleMessage("u1", "u1", "My pathology report", []string{report, archive}, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	msg, ok := msgBus.ConsumeInbound(ctx)
+	if !ok {
+		t.Fatal("no inbound message")
+	}
+	defer utils.RemoveKeptMedia(msg.Media)
+	if len(msg.Media) != 1 || msg.Media[0] == report || !strings.HasSuffix(msg.Media[0], "_report.pdf") {
+		t.Errorf("media = %v", msg.Media)
+	}
+	if want := "My pathology report\n[attachment not accepted: records.zip (application/zip files are not accepted)]"; msg.Content != want {
+		t.Errorf("content = %q", msg.Content)
+	}
+}
+
+func TestBaseChannelAccess(t *testing.T) {
+	msgBus := bus.NewMessageBus()
+	path := filepath.Join(t.TempDir(), "pairing.json")
+	ch := NewBaseChannel("telegram", nil, msgBus, []string{"1001", "-100777"})
+	ch.SetAccessPolicy(config.AccessConfig{
+		DenyFrom:       config.FlexibleStringSlice{"666"},
+		Pairing:        true,
+		BlockedMessage: "This assistant is for the clinic's patients only.",
+	}, pairing.NewStore(path))
+
+	replies := func() []string {
+		var out []string
+		for {
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			msg, ok := msgBus.SubscribeOutbound(ctx)
+			cancel()
+			if !ok {
+				return out
+			}
+			out = append(out, msg.Content)
+		}
+	}
+
+	if !ch.Admit("1001", "1001", true) {
+		t.Error("allowlisted sender refused")
+	}
+	if !ch.Admit("2002", "-100777", false) {
+		t.Error("member of an allowlisted group refused")
+	}
+	if ch.Admit("666", "-100777", false) {
+		t.Error("denied sender admitted in an allowlisted group")
+	}
+	if got := replies(); len(got) != 0 {
+		t.Errorf("replies to allowed or group senders: %v", got)
+	}
+
+	if ch.Admit("666", "666", true) {
+		t.Error("denied sender admitted")
+	}
+	if got := replies(); len(got) != 1 || got[0] != "This assistant is for the clinic's patients only." {
+		t.Errorf("denied sender got %v", got)
+	}
+
+	if ch.Admit("3003|carol", "3003", true) {
+		t.Error("unknown sender admitted")
+	}
+	got := replies()
+	if len(got) != 1 || !strings.Contains(got[0], "pairing code") {
+		t.Fatalf("unknown sender got %v", got)
+	}
+
+	// Writing again within the hour gets no second reply
+	ch.Admit("3003|carol", "3003", true)
+	if got := replies(); len(got) != 0 {
+		t.Errorf("second reply: %v", got)
+	}
+
+	// Approving the code from another process lets the sender in
+	pending, _, _ := pairing.NewStore(path).List()
+	if len(pending) != 1 || pending[0].SenderID != "3003" || !strings.Contains(got[0], pending[0].Code) {
+		t.Fatalf("pending = %+v", pending)
+	}
+	if _, err := pairing.NewStore(path).Approve("telegram", pending[0].Code); err != nil {
+		t.Fatal(err)
+	}
+	if !ch.Admit("3003|carol", "3003", true) {
+		t.Error("paired sender refused")
+	}
+}
@@ -0,0 +1,214 @@
+package channels
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+// MessageLimitChannel is implemented by channels that cap the length of a
+// single message. Longer outbound messages are delivered as a numbered
+// series: the answer, then its citations, then its attachments.
+type MessageLimitChannel interface {
+	MaxMessageLength() int
+}
+
+var (
+	// citationHeading matches the heading of a references section the model
+	// wrote at the end of its answer.
+	citationHeading = regexp.MustCompile(`(?i)^\s*(?:#{1,6}\s*)?(?:\*\*)?(?:references|sources|citations|参考文献|参考资料|引用来源|证据来源)(?:\*\*)?\s*[:：]?\s*(?:\*\*)?\s*$`)
+	citationEntry   = regexp.MustCompile(`^\s*(?:[-*•]\s+|\[\d+\]|\d+[.)、]\s*)`)
+	bulletMarker    = regexp.MustCompile(`^\s*[-*•]\s+`)
+	numberedEntry   = regexp.MustCompile(`^\s*(?:\[\d+\]|\d+[.)、])`)
+)
+
+// partNumberReserve is the room kept in each part for its "(i/n)" prefix.
+const partNumberReserve = len("(99/99)\n")
+
+// PlanDelivery turns msg into the messages to send on a channel whose
+// messages hold at most maxLen bytes (0 for no limit). Citations and
+// attachments are rendered after the answer; a references section at the
+// end of the answer is treated as its citations. When everything fits, a
+// single message is returned. Otherwise each section starts a new message,
+// citation and attachment entries are never split, and every message is
+// numbered "(i/n)". Citation numbers are kept as written, so "[2]" in the
+// answer still matches entry [2] in a later message. Quick replies and
+// buttons go with the last message, and a reply to another message is
+// made by the first.
+func PlanDelivery(msg bus.OutboundMessage, maxLen int) []bus.OutboundMessage {
+	fits := maxLen <= 0 || len(msg.Content) <= maxLen
+	if fits && len(msg.Citations) == 0 && len(msg.Attachments) == 0 {
+		return []bus.OutboundMessage{msg}
+	}
+
+	body, citations := strings.TrimSpace(msg.Content), msg.Citations
+	if len(citations) == 0 {
+		body, citations = extractCitations(body)
+	}
+	han := containsHan(body)
+
+	sections := make([][]string, 0, 3)
+	if body != "" {
+		sections = append(sections, []string{body})
+	}
+	if len(citations) > 0 {
+		heading := "References:"
+		if han {
+			heading = "参考文献："
+		}
+		sections = append(sections, append([]string{heading}, numberCitations(citations)...))
+	}
+	if len(msg.Attachments) > 0 {
+		heading := "Attachments:"
+		if han {
+			heading = "附件："
+		}
+		lines := []string{heading}
+		for i, a := range msg.Attachments {
+			lines = append(lines, fmt.Sprintf("%d. %s", i+1, attachmentLine(a)))
+		}
+		sections = append(sections, lines)
+	}
+
+	out := msg
+	out.Citations, out.Attachments = nil, nil
+
+	joined := make([]string, len(sections))
+	for i, lines := range sections {
+		joined[i] = strings.Join(lines, "\n")
+	}
+	single := strings.Join(joined, "\n\n")
+	if maxLen <= 0 || len(single) <= maxLen {
+		out.Content = single
+		return []bus.OutboundMessage{out}
+	}
+
+	budget := maxLen - partNumberReserve
+	if budget <= 0 {
+		budget = maxLen
+	}
+	var parts []string
+	for i, lines := range sections {
+		if i == 0 && body != "" {
+			parts = append(parts, utils.SplitMessage(body, budget)...)
+			continue
+		}
+		parts = append(parts, packLines(lines, budget)...)
+	}
+
+	planned := make([]bus.OutboundMessage, len(parts))
+	for i, part := range parts {
+		m := out
+		m.Content = fmt.Sprintf("(%d/%d)\n%s", i+1, len(parts), part)
+		if i > 0 {
+			m.ReplyTo, m.Quote = "", ""
+		}
+		if i < len(parts)-1 {
+			m.QuickReplies, m.Buttons = nil, nil
+		}
+		planned[i] = m
+	}
+	return planned
+}
+
+// packLines fills messages with whole lines. The first line is a heading,
+// repeated at the top of each message it continues into. Lines too long
+// for a message on their own are split.
+func packLines(lines []string, maxLen int) []string {
+	heading, entries := lines[0], lines[1:]
+	var parts []string
+	current := heading
+	for _, entry := range entries {
+		if len(current)+1+len(entry) <= maxLen {
+			current += "\n" + entry
+			continue
+		}
+		if current != heading {
+			parts = append(parts, current)
+			current = heading
+		}
+		if len(heading)+1+len(entry) <= maxLen {
+			current += "\n" + entry
+			continue
+		}
+		parts = append(parts, utils.SplitMessage(entry, maxLen)...)
+	}
+	if current != heading {
+		parts = append(parts, current)
+	}
+	return parts
+}
+
+// extractCitations splits a trailing references section off content. The
+// section must start with a recognised heading and contain only list
+// entries, each possibly continued on indented lines.
+func extractCitations(content string) (string, []string) {
+	lines := strings.Split(content, "\n")
+	start := -1
+	for i := len(lines) - 1; i >= 0; i-- {
+		if citationHeading.MatchString(lines[i]) {
+			start = i
+			break
+		}
+	}
+	if start < 0 {
+		return content, nil
+	}
+
+	var entries []string
+	for _, line := range lines[start+1:] {
+		switch {
+		case strings.TrimSpace(line) == "":
+			continue
+		case citationEntry.MatchString(line):
+			entries = append(entries, strings.TrimSpace(line))
+		case len(entries) > 0 && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")):
+			entries[len(entries)-1] += " " + strings.TrimSpace(line)
+		default:
+			return content, nil
+		}
+	}
+	if len(entries) == 0 {
+		return content, nil
+	}
+	return strings.TrimSpace(strings.Join(lines[:start], "\n")), entries
+}
+
+// numberCitations keeps entries that already carry a number and numbers
+// bullet or bare entries by position.
+func numberCitations(citations []string) []string {
+	out := make([]string, len(citations))
+	for i, c := range citations {
+		c = strings.TrimSpace(c)
+		if numberedEntry.MatchString(c) {
+			out[i] = c
+			continue
+		}
+		out[i] = fmt.Sprintf("[%d] %s", i+1, bulletMarker.ReplaceAllString(c, ""))
+	}
+	return out
+}
+
+func attachmentLine(a bus.Attachment) string {
+	ref := a.URL
+	if ref == "" {
+		ref = a.Path
+	}
+	if a.Name == "" || a.Name == ref {
+		return ref
+	}
+	return a.Name + ": " + ref
+}
+
+func containsHan(s string) bool {
+	for _, r := range s {
+		if unicode.Is(unicode.Han, r) {
+			return true
+		}
+	}
+	return false
+}
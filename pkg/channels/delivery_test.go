@@ -0,0 +1,286 @@
+package channels
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+)
+
+func TestPlanDelivery_FitsUnchanged(t *testing.T) {
+	msg := bus.OutboundMessage{Channel: "telegram", ChatID: "1", Content: "Short answer.\n\nReferences:\n- Smith 2020"}
+	got := PlanDelivery(msg, 4000)
+	if len(got) != 1 || !reflect.DeepEqual(got[0], msg) {
+		t.Errorf("PlanDelivery() = %+v, want the message unchanged", got)
+	}
+}
+
+func TestPlanDelivery_RendersAttachments(t *testing.T) {
+	msg := bus.OutboundMessage{
+		Content:     "Your summary is ready.",
+		Attachments: []bus.Attachment{{Name: "visit.md", Path: "/w/visit.md"}, {URL: "https://example.org/chart.png"}},
+	}
+	got := PlanDelivery(msg, 0)
+	want := "Your summary is ready.\n\nAttachments:\n1. visit.md: /w/visit.md\n2. https://example.org/chart.png"
+	if len(got) != 1 || got[0].Content != want || got[0].Attachments != nil {
+		t.Errorf("PlanDelivery() = %+v, want %q", got, want)
+	}
+}
+
+func TestPlanDelivery_SplitsSections(t *testing.T) {
+	answer := strings.Repeat("FOLFIRINOX improved survival [1]. ", 8)
+	msg := bus.OutboundMessage{
+		Channel:      "discord",
+		ChatID:       "c1",
+		Content:      answer + "\n\n## References\n1. Conroy T, et al. NEJM 2011.\n2. Von Hoff DD, et al. NEJM 2013.\n   MPACT trial.",
+		Attachments:  []bus.Attachment{{Name: "evidence.pdf", URL: "https://example.org/e.pdf"}},
+		QuickReplies: []string{"What about side effects?"},
+		Buttons:      []bus.Button{{Label: "👍", Data: "👍"}},
+		ReplyTo:      "m1",
+	}
+
+	got := PlanDelivery(msg, 200)
+	if len(got) < 3 {
+		t.Fatalf("expected at least 3 parts, got %d: %+v", len(got), got)
+	}
+	n := len(got)
+	for i, part := range got {
+		if len(part.Content) > 200 {
+			t.Errorf("part %d is %d bytes, over the limit", i+1, len(part.Content))
+		}
+		if want := fmt.Sprintf("(%d/%d)\n", i+1, n); !strings.HasPrefix(part.Content, want) {
+			t.Errorf("part %d = %q, want prefix %q", i+1, part.Content, want)
+		}
+		if (len(part.QuickReplies) > 0) != (i == n-1) {
+			t.Errorf("quick replies on part %d: %v", i+1, part.QuickReplies)
+		}
+		if (len(part.Buttons) > 0) != (i == n-1) {
+			t.Errorf("buttons on part %d: %v", i+1, part.Buttons)
+		}
+		if (part.ReplyTo != "") != (i == 0) {
+			t.Errorf("reply to %q on part %d", part.ReplyTo, i+1)
+		}
+	}
+
+	citations := got[n-2].Content
+	if !strings.Contains(citations, "References:\n1. Conroy T, et al. NEJM 2011.\n2. Von Hoff DD, et al. NEJM 2013. MPACT trial.") {
+		t.Errorf("citation part = %q", citations)
+	}
+	if !strings.HasSuffix(got[n-1].Content, "Attachments:\n1. evidence.pdf: https://example.org/e.pdf") {
+		t.Errorf("attachment part = %q", got[n-1].Content)
+	}
+}
+
+func TestExtractCitations(t *testing.T) {
+	tests := []struct {
+		name      string
+		content   string
+		body      string
+		citations []string
+	}{
+		{"bullets", "Answer.\n\n**参考文献**\n- 指南 2023\n- Smith 2020", "Answer.", []string{"- 指南 2023", "- Smith 2020"}},
+		{"no heading", "Answer.\n- a point", "Answer.\n- a point", nil},
+		{"prose after heading", "Answer.\nSources:\nI looked at several trials.", "Answer.\nSources:\nI looked at several trials.", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, citations := extractCitations(tt.content)
+			if body != tt.body || !reflect.DeepEqual(citations, tt.citations) {
+				t.Errorf("extractCitations() = %q, %q; want %q, %q", body, citations, tt.body, tt.citations)
+			}
+		})
+	}
+
+	if got := numberCitations([]string{"- 指南 2023", "[7] Smith 2020", "Bare entry"}); !reflect.DeepEqual(got, []string{"[1] 指南 2023", "[7] Smith 2020", "[3] Bare entry"}) {
+		t.Errorf("numberCitations() = %q", got)
+	}
+}
+
+type recordingChannel struct {
+	BaseChannel
+	sent []bus.OutboundMessage
+}
+
+func (c *recordingChannel) Start(ctx context.Context) error { return nil }
+func (c *recordingChannel) Stop(ctx context.Context) error  { return nil }
+func (c *recordingChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
+	c.sent = append(c.sent, msg)
+	return nil
+}
+
+type progressChannel struct {
+	recordingChannel
+	progress []string
+}
+
+func (c *progressChannel) UpdateProgress(ctx context.Context, chatID, text string) error {
+	c.progress = append(c.progress, chatID+": "+text)
+	return nil
+}
+
+func TestDeliver_Progress(t *testing.T) {
+	update := bus.OutboundMessage{ChatID: "42", Content: "已检索 3/8 篇文献…", Progress: true}
+
+	editing := &progressChannel{}
+	if err := deliver(context.Background(), editing, update); err != nil {
+		t.Fatal(err)
+	}
+	if len(editing.sent) != 0 || !reflect.DeepEqual(editing.progress, []string{"42: 已检索 3/8 篇文献…"}) {
+		t.Errorf("progress channel got sent=%+v progress=%v", editing.sent, editing.progress)
+	}
+
+	plain := &recordingChannel{}
+	if err := deliver(context.Background(), plain, update); err != nil {
+		t.Fatal(err)
+	}
+	if len(plain.sent) != 1 || plain.sent[0].Content != update.Content {
+		t.Errorf("plain channel got %+v", plain.sent)
+	}
+}
+
+func TestDeliver_Stream(t *testing.T) {
+	update := bus.OutboundMessage{ChatID: "42", Content: "Step 3/10 done", Progress: true, Stream: true}
+
+	editing := &progressChannel{}
+	if err := deliver(context.Background(), editing, update); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(editing.progress, []string{"42: Step 3/10 done"}) {
+		t.Errorf("progress channel got %v", editing.progress)
+	}
+
+	plain := &recordingChannel{}
+	if err := deliver(context.Background(), plain, update); err != nil {
+		t.Fatal(err)
+	}
+	if len(plain.sent) != 0 {
+		t.Errorf("plain channel should drop streamed output, got %+v", plain.sent)
+	}
+}
+
+type voiceChannel struct {
+	recordingChannel
+	voices []string
+	fail   bool
+}
+
+func (c *voiceChannel) SendVoice(ctx context.Context, chatID string, audio bus.Attachment) error {
+	if c.fail {
+		return fmt.Errorf("upload failed")
+	}
+	c.voices = append(c.voices, chatID+": "+audio.Path)
+	return nil
+}
+
+func TestDeliver_Voice(t *testing.T) {
+	msg := bus.OutboundMessage{
+		ChatID:  "42",
+		Content: "这是语音版。",
+		Attachments: []bus.Attachment{
+			{Name: "speech.mp3", Path: "/w/audio/speech.mp3", MimeType: "audio/mpeg"},
+			{Name: "chart.png", Path: "/w/charts/chart.png", MimeType: "image/png"},
+		},
+	}
+
+	voice := &voiceChannel{}
+	if err := deliver(context.Background(), voice, msg); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(voice.voices, []string{"42: /w/audio/speech.mp3"}) {
+		t.Errorf("voices = %v", voice.voices)
+	}
+	if len(voice.sent) != 1 || strings.Contains(voice.sent[0].Content, "speech.mp3") || !strings.Contains(voice.sent[0].Content, "chart.png") {
+		t.Errorf("voice channel got %+v", voice.sent)
+	}
+
+	// Audio alone sends no text message.
+	only := &voiceChannel{}
+	deliver(context.Background(), only, bus.OutboundMessage{ChatID: "42", Attachments: msg.Attachments[:1]})
+	if len(only.sent) != 0 || len(only.voices) != 1 {
+		t.Errorf("audio only: sent=%+v voices=%v", only.sent, only.voices)
+	}
+
+	// A failed upload falls back to listing the file.
+	failing := &voiceChannel{fail: true}
+	if err := deliver(context.Background(), failing, bus.OutboundMessage{ChatID: "42", Attachments: msg.Attachments[:1]}); err != nil {
+		t.Fatal(err)
+	}
+	if len(failing.sent) != 1 || !strings.Contains(failing.sent[0].Content, "/w/audio/speech.mp3") {
+		t.Errorf("failed upload: %+v", failing.sent)
+	}
+
+	plain := &recordingChannel{}
+	deliver(context.Background(), plain, msg)
+	if len(plain.sent) != 1 || !strings.Contains(plain.sent[0].Content, "speech.mp3") {
+		t.Errorf("plain channel got %+v", plain.sent)
+	}
+}
+
+type replyChannel struct {
+	recordingChannel
+}
+
+func (c *replyChannel) SupportsReplies() bool { return true }
+
+func TestDeliver_Reply(t *testing.T) {
+	msg := bus.OutboundMessage{ChatID: "g1", Content: "Yes, with food.", ReplyTo: "m7", Quote: "Should I take Creon with snacks?"}
+
+	replying := &replyChannel{}
+	deliver(context.Background(), replying, msg)
+	if len(replying.sent) != 1 || replying.sent[0].ReplyTo != "m7" || replying.sent[0].Content != "Yes, with food." {
+		t.Errorf("reply channel got %+v", replying.sent)
+	}
+
+	plain := &recordingChannel{}
+	deliver(context.Background(), plain, msg)
+	want := "> Should I take Creon with snacks?\n\nYes, with food."
+	if len(plain.sent) != 1 || plain.sent[0].Content != want || plain.sent[0].ReplyTo != "" {
+		t.Errorf("plain channel got %+v", plain.sent)
+	}
+}
+
+type mediaChannel struct {
+	recordingChannel
+	uploads []string
+	fail    bool
+}
+
+func (c *mediaChannel) SendMedia(ctx context.Context, chatID string, file bus.Attachment) error {
+	if c.fail {
+		return fmt.Errorf("upload failed")
+	}
+	c.uploads = append(c.uploads, chatID+": "+file.Path)
+	return nil
+}
+
+func TestDeliver_Media(t *testing.T) {
+	msg := bus.OutboundMessage{
+		ChatID:  "42",
+		Content: "Here is your CA19-9 trend.",
+		Attachments: []bus.Attachment{
+			{Name: "CA19-9 trend", Path: "/w/charts/ca199.png", MimeType: "image/png"},
+			{Name: "Guideline", URL: "https://example.org/nccn.pdf"},
+		},
+	}
+
+	media := &mediaChannel{}
+	if err := deliver(context.Background(), media, msg); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(media.uploads, []string{"42: /w/charts/ca199.png"}) {
+		t.Errorf("uploads = %v", media.uploads)
+	}
+	if len(media.sent) != 1 || strings.Contains(media.sent[0].Content, "ca199.png") || !strings.Contains(media.sent[0].Content, "nccn.pdf") {
+		t.Errorf("media channel got %+v", media.sent)
+	}
+
+	// A failed upload is listed after the text instead
+	failing := &mediaChannel{fail: true}
+	deliver(context.Background(), failing, msg)
+	if len(failing.sent) != 2 || !strings.Contains(failing.sent[1].Content, "CA19-9 trend: /w/charts/ca199.png") {
+		t.Errorf("failed upload: sent=%+v", failing.sent)
+	}
+}
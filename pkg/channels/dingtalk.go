@@ -148,12 +148,19 @@ func (c *DingTalkChannel) onChatBotMessageReceived(ctx context.Context, data *ch
 	c.sessionWebhooks.Store(chatID, data.SessionWebhook)
 
 	metadata := map[string]string{
+		"message_id":        data.MsgId,
 		"sender_name":       senderNick,
 		"conversation_id":   data.ConversationId,
 		"conversation_type": data.ConversationType,
 		"platform":          "dingtalk",
 		"session_webhook":   data.SessionWebhook,
 	}
+	if data.ConversationType != "1" {
+		// DingTalk only delivers group messages that @-mention the bot
+		metadata["peer_kind"] = "group"
+		metadata["peer_id"] = data.ConversationId
+		metadata["mentioned"] = "true"
+	}
 
 	logger.DebugCF("dingtalk", "Received message", map[string]interface{}{
 		"sender_nick": senderNick,
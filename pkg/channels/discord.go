@@ -4,6 +4,8 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 
@@ -11,6 +13,7 @@ import (
 	"github.com/sipeed/picoclaw/pkg/bus"
 	"github.com/sipeed/picoclaw/pkg/config"
 	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/ocr"
 	"github.com/sipeed/picoclaw/pkg/utils"
 	"github.com/sipeed/picoclaw/pkg/voice"
 )
@@ -25,6 +28,7 @@ type DiscordChannel struct {
 	session     *discordgo.Session
 	config      config.DiscordConfig
 	transcriber *voice.GroqTranscriber
+	recognizer  ocr.Recognizer
 	ctx         context.Context
 	typingMu    sync.Mutex
 	typingStop  map[string]chan struct{} // chatID → stop signal
@@ -52,6 +56,10 @@ func (c *DiscordChannel) SetTranscriber(transcriber *voice.GroqTranscriber) {
 	c.transcriber = transcriber
 }
 
+func (c *DiscordChannel) SetOCR(recognizer ocr.Recognizer) {
+	c.recognizer = recognizer
+}
+
 func (c *DiscordChannel) getContext() context.Context {
 	if c.ctx == nil {
 		return context.Background()
@@ -114,30 +122,67 @@ func (c *DiscordChannel) Send(ctx context.Context, msg bus.OutboundMessage) erro
 		return fmt.Errorf("channel ID is empty")
 	}
 
-	runes := []rune(msg.Content)
-	if len(runes) == 0 {
+	if msg.Content == "" {
 		return nil
 	}
 
-	chunks := utils.SplitMessage(msg.Content, 2000) // Split messages into chunks, Discord length limit: 2000 chars
+	return c.sendChunk(ctx, channelID, msg.Content, msg.ReplyTo)
+}
 
-	for _, chunk := range chunks {
-		if err := c.sendChunk(ctx, channelID, chunk); err != nil {
-			return err
-		}
-	}
+// SupportsReplies reports that answers can reply to the question.
+func (c *DiscordChannel) SupportsReplies() bool {
+	return true
+}
+
+// SendVoice uploads an audio file, which Discord shows with a player.
+func (c *DiscordChannel) SendVoice(ctx context.Context, chatID string, audio bus.Attachment) error {
+	return c.SendMedia(ctx, chatID, audio)
+}
 
+// SendMedia uploads a file to the channel; Discord previews images.
+func (c *DiscordChannel) SendMedia(ctx context.Context, chatID string, file bus.Attachment) error {
+	c.stopTyping(chatID)
+	if !c.IsRunning() {
+		return fmt.Errorf("discord bot not running")
+	}
+	f, err := os.Open(file.Path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = c.session.ChannelMessageSendComplex(chatID, &discordgo.MessageSend{
+		Content: mediaCaption(file),
+		Files:   []*discordgo.File{{Name: filepath.Base(file.Path), ContentType: file.MimeType, Reader: f}},
+	}, discordgo.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("failed to upload discord file: %w", err)
+	}
 	return nil
 }
 
-func (c *DiscordChannel) sendChunk(ctx context.Context, channelID, content string) error {
+// MaxMessageLength is Discord's message length limit.
+func (c *DiscordChannel) MaxMessageLength() int {
+	return 2000
+}
+
+func (c *DiscordChannel) sendChunk(ctx context.Context, channelID, content, replyTo string) error {
 	// 使用传入的 ctx 进行超时控制
 	sendCtx, cancel := context.WithTimeout(ctx, sendTimeout)
 	defer cancel()
 
 	done := make(chan error, 1)
 	go func() {
-		_, err := c.session.ChannelMessageSend(channelID, content)
+		var err error
+		if replyTo != "" {
+			failIfNotExists := false
+			_, err = c.session.ChannelMessageSendReply(channelID, content, &discordgo.MessageReference{
+				MessageID:       replyTo,
+				ChannelID:       channelID,
+				FailIfNotExists: &failIfNotExists,
+			})
+		} else {
+			_, err = c.session.ChannelMessageSend(channelID, content)
+		}
 		done <- err
 	}()
 
@@ -169,11 +214,14 @@ func (c *DiscordChannel) handleMessage(s *discordgo.Session, m *discordgo.Messag
 		return
 	}
 
-	// 检查白名单，避免为被拒绝的用户下载附件和转录
-	if !c.IsAllowed(m.Author.ID) {
-		logger.DebugCF("discord", "Message rejected by allowlist", map[string]any{
-			"user_id": m.Author.ID,
-		})
+	// 检查访问控制，避免为被拒绝的用户下载附件和转录
+	if !c.Admit(m.Author.ID, m.ChannelID, m.GuildID == "") {
+		return
+	}
+
+	isGuild := m.GuildID != ""
+	mentioned := isGuild && isAddressedToDiscordBot(m.Message, s.State.User.ID)
+	if isGuild && !c.RespondsInGroup(mentioned) {
 		return
 	}
 
@@ -184,6 +232,9 @@ func (c *DiscordChannel) handleMessage(s *discordgo.Session, m *discordgo.Messag
 	}
 
 	content := m.Content
+	if isGuild {
+		content = stripDiscordMention(content, s.State.User.ID)
+	}
 	mediaPaths := make([]string, 0, len(m.Attachments))
 	localFiles := make([]string, 0, len(m.Attachments))
 
@@ -239,7 +290,14 @@ func (c *DiscordChannel) handleMessage(s *discordgo.Session, m *discordgo.Messag
 			}
 		} else {
 			mediaPaths = append(mediaPaths, attachment.URL)
-			content = appendContent(content, fmt.Sprintf("[attachment: %s]", attachment.URL))
+			marker := fmt.Sprintf("[attachment: %s]", attachment.URL)
+			if c.recognizer != nil && utils.IsImageFile(attachment.Filename, attachment.ContentType) {
+				if localPath := c.downloadAttachment(attachment.URL, attachment.Filename); localPath != "" {
+					localFiles = append(localFiles, localPath)
+					marker = imageText(c.getContext(), c.recognizer, "discord", localPath, marker)
+				}
+			}
+			content = appendContent(content, marker)
 		}
 	}
 
@@ -277,11 +335,31 @@ func (c *DiscordChannel) handleMessage(s *discordgo.Session, m *discordgo.Messag
 		"is_dm":        fmt.Sprintf("%t", m.GuildID == ""),
 		"peer_kind":    peerKind,
 		"peer_id":      peerID,
+		"mentioned":    fmt.Sprintf("%t", mentioned),
 	}
 
 	c.HandleMessage(senderID, m.ChannelID, content, mediaPaths, metadata)
 }
 
+// isAddressedToDiscordBot reports whether a server message is for the
+// bot: it @-mentions the bot or replies to one of the bot's messages.
+func isAddressedToDiscordBot(m *discordgo.Message, botID string) bool {
+	for _, user := range m.Mentions {
+		if user != nil && user.ID == botID {
+			return true
+		}
+	}
+	ref := m.ReferencedMessage
+	return ref != nil && ref.Author != nil && ref.Author.ID == botID
+}
+
+// stripDiscordMention removes @-mentions of the bot from content.
+func stripDiscordMention(content, botID string) string {
+	content = strings.ReplaceAll(content, "<@"+botID+">", "")
+	content = strings.ReplaceAll(content, "<@!"+botID+">", "")
+	return strings.TrimSpace(content)
+}
+
 // startTyping starts a continuous typing indicator loop for the given chatID.
 // It stops any existing typing loop for that chatID before starting a new one.
 func (c *DiscordChannel) startTyping(chatID string) {
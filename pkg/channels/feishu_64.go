@@ -6,6 +6,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strings"
 	"sync"
 	"time"
 
@@ -164,6 +165,20 @@ func (c *FeishuChannel) handleMessageReceive(_ context.Context, event *larkim.P2
 	if sender != nil && sender.TenantKey != nil {
 		metadata["tenant_key"] = *sender.TenantKey
 	}
+	if chatType := stringValue(message.ChatType); chatType == "group" || chatType == "topic_group" {
+		// Feishu only delivers group messages that @-mention the bot,
+		// unless the app may read all group messages; then any mention
+		// counts, as events do not say which member is the bot
+		mentioned := len(message.Mentions) > 0
+		for _, m := range message.Mentions {
+			if key := stringValue(m.Key); key != "" {
+				content = strings.TrimSpace(strings.ReplaceAll(content, key, ""))
+			}
+		}
+		metadata["peer_kind"] = "group"
+		metadata["peer_id"] = chatID
+		metadata["mentioned"] = fmt.Sprintf("%t", mentioned)
+	}
 
 	logger.InfoCF("feishu", "Feishu message received", map[string]interface{}{
 		"sender_id": senderID,
@@ -285,7 +285,8 @@ func (c *LINEChannel) processEvent(event lineEvent) {
 	}
 
 	// In group chats, only respond when the bot is mentioned
-	if isGroup && !c.isBotMentioned(msg) {
+	mentioned := isGroup && c.isBotMentioned(msg)
+	if isGroup && !c.RespondsInGroup(mentioned) {
 		logger.DebugCF("line", "Ignoring group message without mention", map[string]interface{}{
 			"chat_id": chatID,
 		})
@@ -300,9 +301,11 @@ func (c *LINEChannel) processEvent(event lineEvent) {
 		})
 	}
 
-	// Store quote token for quoting the original message in reply
+	// Store quote token for quoting the original message in reply, by
+	// chat for the next reply and by message for a reply to this one
 	if msg.QuoteToken != "" {
 		c.quoteTokens.Store(chatID, msg.QuoteToken)
+		c.quoteTokens.Store(msg.ID, msg.QuoteToken)
 	}
 
 	var content string
@@ -365,6 +368,11 @@ func (c *LINEChannel) processEvent(event lineEvent) {
 		"source_type": event.Source.Type,
 		"message_id":  msg.ID,
 	}
+	if isGroup {
+		metadata["peer_kind"] = "group"
+		metadata["peer_id"] = chatID
+		metadata["mentioned"] = fmt.Sprintf("%t", mentioned)
+	}
 
 	logger.DebugCF("line", "Received message", map[string]interface{}{
 		"sender_id":    senderID,
@@ -486,11 +494,17 @@ func (c *LINEChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
 		return fmt.Errorf("line channel not running")
 	}
 
-	// Load and consume quote token for this chat
+	// Load and consume quote token for the message answered, or else for
+	// this chat
 	var quoteToken string
 	if qt, ok := c.quoteTokens.LoadAndDelete(msg.ChatID); ok {
 		quoteToken = qt.(string)
 	}
+	if msg.ReplyTo != "" {
+		if qt, ok := c.quoteTokens.LoadAndDelete(msg.ReplyTo); ok {
+			quoteToken = qt.(string)
+		}
+	}
 
 	// Try reply token first (free, valid for ~25 seconds)
 	if entry, ok := c.replyTokens.LoadAndDelete(msg.ChatID); ok {
@@ -511,6 +525,16 @@ func (c *LINEChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
 	return c.sendPush(ctx, msg.ChatID, msg.Content, quoteToken)
 }
 
+// SupportsReplies reports that answers quote the question.
+func (c *LINEChannel) SupportsReplies() bool {
+	return true
+}
+
+// MaxMessageLength is LINE's text message length limit.
+func (c *LINEChannel) MaxMessageLength() int {
+	return 5000
+}
+
 // buildTextMessage creates a text message object, optionally with quoteToken.
 func buildTextMessage(content, quoteToken string) map[string]string {
 	msg := map[string]string{
@@ -14,7 +14,9 @@ import (
 	"github.com/sipeed/picoclaw/pkg/bus"
 	"github.com/sipeed/picoclaw/pkg/config"
 	"github.com/sipeed/picoclaw/pkg/constants"
+	"github.com/sipeed/picoclaw/pkg/hooks"
 	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/pairing"
 )
 
 type Manager struct {
@@ -22,6 +24,9 @@ type Manager struct {
 	bus          *bus.MessageBus
 	config       *config.Config
 	dispatchTask *asyncTask
+	hooks        *hooks.Manager
+	pairings     *pairing.Store
+	outbox       *outbox
 	mu           sync.RWMutex
 }
 
@@ -34,7 +39,11 @@ func NewManager(cfg *config.Config, messageBus *bus.MessageBus) (*Manager, error
 		channels: make(map[string]Channel),
 		bus:      messageBus,
 		config:   cfg,
+		pairings: pairing.NewStore(cfg.PairingPath()),
 	}
+	m.outbox = newOutbox(cfg.OutboxPath(), cfg.Channels.Outbound)
+	m.outbox.lookup = m.GetChannel
+	m.outbox.done = m.emitDelivered
 
 	if err := m.initChannels(); err != nil {
 		return nil, err
@@ -59,7 +68,18 @@ func (m *Manager) initChannels() error {
 		}
 	}
 
-	if m.config.Channels.WhatsApp.Enabled && m.config.Channels.WhatsApp.BridgeURL != "" {
+	if m.config.Channels.WhatsApp.Enabled && m.config.Channels.WhatsApp.PhoneNumberID != "" {
+		logger.DebugC("channels", "Attempting to initialize WhatsApp Cloud API channel")
+		whatsapp, err := NewWhatsAppCloudChannel(m.config.Channels.WhatsApp, m.bus)
+		if err != nil {
+			logger.ErrorCF("channels", "Failed to initialize WhatsApp channel", map[string]interface{}{
+				"error": err.Error(),
+			})
+		} else {
+			m.channels["whatsapp"] = whatsapp
+			logger.InfoC("channels", "WhatsApp channel enabled successfully")
+		}
+	} else if m.config.Channels.WhatsApp.Enabled && m.config.Channels.WhatsApp.BridgeURL != "" {
 		logger.DebugC("channels", "Attempting to initialize WhatsApp channel")
 		whatsapp, err := NewWhatsAppChannel(m.config.Channels.WhatsApp, m.bus)
 		if err != nil {
@@ -176,6 +196,23 @@ func (m *Manager) initChannels() error {
 		}
 	}
 
+	if m.config.Channels.Web.Enabled {
+		logger.DebugC("channels", "Attempting to initialize web channel")
+		web, err := NewWebChannel(m.config.Channels.Web, m.bus)
+		if err != nil {
+			logger.ErrorCF("channels", "Failed to initialize web channel", map[string]interface{}{
+				"error": err.Error(),
+			})
+		} else {
+			m.channels["web"] = web
+			logger.InfoC("channels", "Web channel enabled successfully")
+		}
+	}
+
+	for _, channel := range m.channels {
+		m.applyPolicies(channel)
+	}
+
 	logger.InfoCF("channels", "Channel initialization completed", map[string]interface{}{
 		"enabled_channels": len(m.channels),
 	})
@@ -197,6 +234,7 @@ func (m *Manager) StartAll(ctx context.Context) error {
 	dispatchCtx, cancel := context.WithCancel(ctx)
 	m.dispatchTask = &asyncTask{cancel: cancel}
 
+	m.outbox.start(dispatchCtx)
 	go m.dispatchOutbound(dispatchCtx)
 
 	for name, channel := range m.channels {
@@ -261,27 +299,40 @@ func (m *Manager) dispatchOutbound(ctx context.Context) {
 				continue
 			}
 
-			m.mu.RLock()
-			channel, exists := m.channels[msg.Channel]
-			m.mu.RUnlock()
-
-			if !exists {
+			if _, exists := m.GetChannel(msg.Channel); !exists {
 				logger.WarnCF("channels", "Unknown channel for outbound message", map[string]interface{}{
 					"channel": msg.Channel,
 				})
 				continue
 			}
 
-			if err := channel.Send(ctx, msg); err != nil {
-				logger.ErrorCF("channels", "Error sending message to channel", map[string]interface{}{
-					"channel": msg.Channel,
-					"error":   err.Error(),
-				})
-			}
+			m.outbox.enqueue(msg)
 		}
 	}
 }
 
+// emitDelivered emits the hook event for a message the outbox sent, or
+// gave up on after err.
+func (m *Manager) emitDelivered(ctx context.Context, msg bus.OutboundMessage, err error) {
+	event := hooks.Event{Type: hooks.ResponseSent, Channel: msg.Channel, ChatID: msg.ChatID, Content: msg.Content}
+	if err != nil {
+		event.Type = hooks.Error
+		event.Error = err.Error()
+	}
+	m.mu.RLock()
+	eventHooks := m.hooks
+	m.mu.RUnlock()
+	eventHooks.Emit(ctx, event)
+}
+
+// SetHooks emits a ResponseSent event for each message delivered, and an
+// Error event for each that could not be.
+func (m *Manager) SetHooks(h *hooks.Manager) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.hooks = h
+}
+
 func (m *Manager) GetChannel(name string) (Channel, bool) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
@@ -317,9 +368,28 @@ func (m *Manager) GetEnabledChannels() []string {
 func (m *Manager) RegisterChannel(name string, channel Channel) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	m.applyPolicies(channel)
 	m.channels[name] = channel
 }
 
+// applyPolicies gives channels built on BaseChannel the group chat,
+// attachment and access settings.
+func (m *Manager) applyPolicies(channel Channel) {
+	if g, ok := channel.(interface{ SetGroupPolicy(config.GroupsConfig) }); ok {
+		g.SetGroupPolicy(m.config.Channels.Groups)
+	}
+	if a, ok := channel.(interface {
+		SetAttachmentPolicy(config.AttachmentsConfig)
+	}); ok {
+		a.SetAttachmentPolicy(m.config.Channels.Attachments)
+	}
+	if a, ok := channel.(interface {
+		SetAccessPolicy(config.AccessConfig, *pairing.Store)
+	}); ok {
+		a.SetAccessPolicy(m.config.Channels.Access[channel.Name()], m.pairings)
+	}
+}
+
 func (m *Manager) UnregisterChannel(name string) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -341,5 +411,129 @@ func (m *Manager) SendToChannel(ctx context.Context, channelName, chatID, conten
 		Content: content,
 	}
 
-	return channel.Send(ctx, msg)
+	return deliver(ctx, channel, msg)
+}
+
+// deliver sends msg as planned for the channel's message limit, stopping at
+// the first part that fails. On a VoiceChannel, audio attachments follow
+// as voice messages, and on a MediaChannel, local files are uploaded.
+func deliver(ctx context.Context, channel Channel, msg bus.OutboundMessage) error {
+	return deliverRun(ctx, channel, msg, &deliveryRun{})
+}
+
+// deliveryRun counts the sends one delivery makes, so that a retry can
+// skip those an earlier attempt already made, and paces them with wait.
+type deliveryRun struct {
+	skip int // sends made by earlier attempts
+	made int
+	wait func(context.Context) error
+}
+
+// send makes one send with fn, unless an earlier attempt made it.
+func (r *deliveryRun) send(ctx context.Context, fn func() error) error {
+	if r.made < r.skip {
+		r.made++
+		return nil
+	}
+	if r.wait != nil {
+		if err := r.wait(ctx); err != nil {
+			return err
+		}
+	}
+	if err := fn(); err != nil {
+		return err
+	}
+	r.made++
+	return nil
+}
+
+func deliverRun(ctx context.Context, channel Channel, msg bus.OutboundMessage, run *deliveryRun) error {
+	if progress, ok := channel.(ProgressChannel); ok && msg.Progress {
+		return run.send(ctx, func() error {
+			return progress.UpdateProgress(ctx, msg.ChatID, msg.Content)
+		})
+	}
+	if msg.Stream {
+		return nil
+	}
+	var voices, files []bus.Attachment
+	_, isVoice := channel.(VoiceChannel)
+	_, isMedia := channel.(MediaChannel)
+	if (isVoice || isMedia) && len(msg.Attachments) > 0 {
+		others := make([]bus.Attachment, 0, len(msg.Attachments))
+		for _, a := range msg.Attachments {
+			switch {
+			case isVoice && isVoiceAttachment(a):
+				voices = append(voices, a)
+			case isMedia && a.Path != "":
+				files = append(files, a)
+			default:
+				others = append(others, a)
+			}
+		}
+		msg.Attachments = others
+	}
+	if msg.Content != "" || len(msg.Citations) > 0 || len(msg.Attachments) > 0 || len(voices)+len(files) == 0 {
+		if err := sendParts(ctx, channel, msg, run); err != nil {
+			return err
+		}
+	}
+
+	// Voice messages and files follow the text they belong to. One that
+	// fails is listed instead, and counts as sent.
+	var failed []bus.Attachment
+	for _, a := range voices {
+		run.send(ctx, func() error {
+			if err := channel.(VoiceChannel).SendVoice(ctx, msg.ChatID, a); err != nil {
+				logger.WarnCF("channels", "Failed to send voice message, sending it as an attachment", map[string]interface{}{
+					"chat_id": msg.ChatID,
+					"path":    a.Path,
+					"error":   err.Error(),
+				})
+				failed = append(failed, a)
+			}
+			return nil
+		})
+	}
+	for _, a := range files {
+		run.send(ctx, func() error {
+			if err := channel.(MediaChannel).SendMedia(ctx, msg.ChatID, a); err != nil {
+				logger.WarnCF("channels", "Failed to upload file, listing it instead", map[string]interface{}{
+					"chat_id": msg.ChatID,
+					"path":    a.Path,
+					"error":   err.Error(),
+				})
+				failed = append(failed, a)
+			}
+			return nil
+		})
+	}
+	if len(failed) > 0 {
+		return sendParts(ctx, channel, bus.OutboundMessage{Channel: msg.Channel, ChatID: msg.ChatID, Attachments: failed}, run)
+	}
+	return nil
+}
+
+// sendParts sends msg as planned for the channel's message limit.
+func sendParts(ctx context.Context, channel Channel, msg bus.OutboundMessage, run *deliveryRun) error {
+	maxLen := 0
+	if limited, ok := channel.(MessageLimitChannel); ok {
+		maxLen = limited.MaxMessageLength()
+	}
+	if msg.Quote != "" {
+		if rc, ok := channel.(ReplyChannel); !ok || !rc.SupportsReplies() {
+			msg = quoteAsText(msg)
+		}
+	}
+	for _, part := range PlanDelivery(msg, maxLen) {
+		if len(part.QuickReplies) > 0 {
+			if qr, ok := channel.(QuickReplyChannel); !ok || !qr.SupportsQuickReplies() {
+				part = quickRepliesAsText(part)
+			}
+		}
+		if err := run.send(ctx, func() error { return channel.Send(ctx, part) }); err != nil {
+			return err
+		}
+	}
+	return nil
 }
@@ -0,0 +1,39 @@
+package channels
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/ocr"
+)
+
+const ocrTimeout = 60 * time.Second
+
+// imageText returns what a message says in place of an image: the text
+// recognized in it, or fallback when there is no recognizer, recognition
+// fails or the image has no text. Downloaded images are deleted once the
+// message is handled, so this is the agent's only chance to read them.
+func imageText(ctx context.Context, recognizer ocr.Recognizer, channel, path, fallback string) string {
+	if recognizer == nil {
+		return fallback
+	}
+	ctx, cancel := context.WithTimeout(ctx, ocrTimeout)
+	defer cancel()
+	text, err := recognizer.Recognize(ctx, path)
+	if err != nil {
+		logger.WarnCF(channel, "Image text recognition failed", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return strings.TrimSuffix(fallback, "]") + " (text recognition failed)]"
+	}
+	if strings.TrimSpace(text) == "" {
+		return fallback
+	}
+	logger.DebugCF(channel, "Image text recognized", map[string]interface{}{
+		"chars": len(text),
+	})
+	return fmt.Sprintf("[image text (OCR):\n%s\n]", strings.TrimSpace(text))
+}
@@ -16,6 +16,7 @@ import (
 	"github.com/sipeed/picoclaw/pkg/bus"
 	"github.com/sipeed/picoclaw/pkg/config"
 	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/ocr"
 	"github.com/sipeed/picoclaw/pkg/utils"
 	"github.com/sipeed/picoclaw/pkg/voice"
 )
@@ -36,6 +37,7 @@ type OneBotChannel struct {
 	pending         map[string]chan json.RawMessage
 	pendingMu       sync.Mutex
 	transcriber     *voice.GroqTranscriber
+	recognizer      ocr.Recognizer
 	lastMessageID   sync.Map
 	pendingEmojiMsg sync.Map
 }
@@ -115,6 +117,10 @@ func (c *OneBotChannel) SetTranscriber(transcriber *voice.GroqTranscriber) {
 	c.transcriber = transcriber
 }
 
+func (c *OneBotChannel) SetOCR(recognizer ocr.Recognizer) {
+	c.recognizer = recognizer
+}
+
 func (c *OneBotChannel) setMsgEmojiLike(messageID string, emojiID int, set bool) {
 	go func() {
 		_, err := c.sendAPIRequest("set_msg_emoji_like", map[string]interface{}{
@@ -420,17 +426,27 @@ func (c *OneBotChannel) Send(ctx context.Context, msg bus.OutboundMessage) error
 	return nil
 }
 
-func (c *OneBotChannel) buildMessageSegments(chatID, content string) []oneBotMessageSegment {
+// SupportsReplies reports that answers can quote the question.
+func (c *OneBotChannel) SupportsReplies() bool {
+	return true
+}
+
+// buildMessageSegments quotes replyTo, or when it is empty the chat's
+// last message, above content.
+func (c *OneBotChannel) buildMessageSegments(chatID, replyTo, content string) []oneBotMessageSegment {
 	var segments []oneBotMessageSegment
 
-	if lastMsgID, ok := c.lastMessageID.Load(chatID); ok {
-		if msgID, ok := lastMsgID.(string); ok && msgID != "" {
-			segments = append(segments, oneBotMessageSegment{
-				Type: "reply",
-				Data: map[string]interface{}{"id": msgID},
-			})
+	if replyTo == "" {
+		if lastMsgID, ok := c.lastMessageID.Load(chatID); ok {
+			replyTo, _ = lastMsgID.(string)
 		}
 	}
+	if replyTo != "" {
+		segments = append(segments, oneBotMessageSegment{
+			Type: "reply",
+			Data: map[string]interface{}{"id": replyTo},
+		})
+	}
 
 	segments = append(segments, oneBotMessageSegment{
 		Type: "text",
@@ -442,7 +458,7 @@ func (c *OneBotChannel) buildMessageSegments(chatID, content string) []oneBotMes
 
 func (c *OneBotChannel) buildSendRequest(msg bus.OutboundMessage) (string, interface{}, error) {
 	chatID := msg.ChatID
-	segments := c.buildMessageSegments(chatID, msg.Content)
+	segments := c.buildMessageSegments(chatID, msg.ReplyTo, msg.Content)
 
 	var action, idKey string
 	var rawID string
@@ -643,7 +659,11 @@ func (c *OneBotChannel) parseMessageSegments(raw json.RawMessage, selfID int64)
 					if localPath != "" {
 						media = append(media, localPath)
 						localFiles = append(localFiles, localPath)
-						textParts = append(textParts, fmt.Sprintf("[%s]", segType))
+						if segType == "image" {
+							textParts = append(textParts, imageText(c.ctx, c.recognizer, "onebot", localPath, "[image]"))
+						} else {
+							textParts = append(textParts, fmt.Sprintf("[%s]", segType))
+						}
 					}
 				}
 			}
@@ -712,10 +732,13 @@ func (c *OneBotChannel) handleRawEvent(raw *oneBotRawEvent) {
 	switch raw.PostType {
 	case "message":
 		if userID, err := parseJSONInt64(raw.UserID); err == nil && userID > 0 {
-			if !c.IsAllowed(strconv.FormatInt(userID, 10)) {
-				logger.DebugCF("onebot", "Message rejected by allowlist", map[string]interface{}{
-					"user_id": userID,
-				})
+			sender := strconv.FormatInt(userID, 10)
+			chat, direct := "private:"+sender, raw.MessageType == "private"
+			if !direct {
+				groupID, _ := parseJSONInt64(raw.GroupID)
+				chat = strconv.FormatInt(groupID, 10)
+			}
+			if !c.Admit(sender, chat, direct) {
 				return
 			}
 		}
@@ -883,8 +906,12 @@ func (c *OneBotChannel) handleMessage(raw *oneBotRawEvent) {
 			metadata["sender_name"] = sender.Nickname
 		}
 
+		metadata["peer_kind"] = "group"
+		metadata["peer_id"] = groupIDStr
+
 		triggered, strippedContent := c.checkGroupTrigger(content, isBotMentioned)
-		if !triggered {
+		metadata["mentioned"] = fmt.Sprintf("%t", triggered)
+		if !c.RespondsInGroup(triggered) {
 			logger.DebugCF("onebot", "Group message ignored (no trigger)", map[string]interface{}{
 				"sender":       senderID,
 				"group":        groupIDStr,
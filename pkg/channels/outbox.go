@@ -0,0 +1,388 @@
+package channels
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/mymmrac/telego/telegoapi"
+	"github.com/slack-go/slack"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// maxRetryDelay caps the wait between attempts to send a message.
+const maxRetryDelay = 5 * time.Minute
+
+// queuedMessage is an outbound message waiting to be sent.
+type queuedMessage struct {
+	Message bus.OutboundMessage `json:"message"`
+	// Sent is how many of the message's sends (parts, voice messages,
+	// files) an earlier attempt made; a retry continues after them
+	Sent        int       `json:"sent,omitempty"`
+	Attempts    int       `json:"attempts,omitempty"`
+	NextAttempt time.Time `json:"next_attempt,omitempty"`
+}
+
+// transient reports whether the message is only worth sending now:
+// progress updates are superseded by the answer, so they are neither
+// retried nor kept across restarts.
+func (q *queuedMessage) transient() bool {
+	return q.Message.Progress || q.Message.Stream
+}
+
+// outbox sends outbound messages through a queue per channel. Each queue
+// paces its sends to the channel's rate limit and retries failed messages
+// with backoff, while later messages to other chats go ahead; a chat's
+// own messages are always sent in order. Messages waiting to be sent are
+// saved to path so they survive a restart.
+type outbox struct {
+	path       string
+	maxRetries int
+	retryDelay time.Duration
+	rates      map[string]float64
+
+	// lookup finds the channel to send through; done is called once a
+	// message was sent, or when it was given up on
+	lookup func(name string) (Channel, bool)
+	done   func(ctx context.Context, msg bus.OutboundMessage, err error)
+
+	mu     sync.Mutex
+	ctx    context.Context
+	queues map[string]*sendQueue
+}
+
+type sendQueue struct {
+	name    string
+	items   []*queuedMessage
+	wake    chan struct{}
+	limiter *rateLimiter
+}
+
+func newOutbox(path string, cfg config.OutboundConfig) *outbox {
+	return &outbox{
+		path:       path,
+		maxRetries: cfg.MaxRetries,
+		retryDelay: time.Duration(cfg.RetryDelaySeconds) * time.Second,
+		rates:      cfg.RateLimits,
+		queues:     make(map[string]*sendQueue),
+	}
+}
+
+// start starts sending, beginning with the messages saved by an earlier
+// run. Sending stops when ctx is done; messages not yet sent stay saved.
+func (o *outbox) start(ctx context.Context) {
+	var saved []*queuedMessage
+	if data, err := os.ReadFile(o.path); err == nil {
+		if err := json.Unmarshal(data, &saved); err != nil {
+			logger.WarnCF("channels", "Failed to read the outbox, unsent messages are lost", map[string]interface{}{
+				"path":  o.path,
+				"error": err.Error(),
+			})
+			saved = nil
+		}
+	}
+
+	o.mu.Lock()
+	for _, item := range saved {
+		q := o.queueLocked(item.Message.Channel)
+		q.items = append(q.items, item)
+	}
+	o.ctx = ctx
+	for _, q := range o.queues {
+		go o.run(ctx, q)
+	}
+	o.mu.Unlock()
+
+	if len(saved) > 0 {
+		logger.InfoCF("channels", "Resuming unsent messages", map[string]interface{}{
+			"count": len(saved),
+		})
+	}
+}
+
+// enqueue queues msg for sending through its channel.
+func (o *outbox) enqueue(msg bus.OutboundMessage) {
+	o.mu.Lock()
+	q := o.queueLocked(msg.Channel)
+	item := &queuedMessage{Message: msg}
+	q.items = append(q.items, item)
+	if !item.transient() {
+		o.saveLocked()
+	}
+	o.mu.Unlock()
+
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// queueLocked returns the channel's queue, creating it, and once sending
+// has started its worker, on first use.
+func (o *outbox) queueLocked(name string) *sendQueue {
+	if q, ok := o.queues[name]; ok {
+		return q
+	}
+	q := &sendQueue{
+		name:    name,
+		wake:    make(chan struct{}, 1),
+		limiter: newRateLimiter(o.rates[name]),
+	}
+	o.queues[name] = q
+	if o.ctx != nil {
+		go o.run(o.ctx, q)
+	}
+	return q
+}
+
+// run sends the queue's messages until ctx is done.
+func (o *outbox) run(ctx context.Context, q *sendQueue) {
+	for {
+		item, wait := o.next(q)
+		if item == nil {
+			timer := time.NewTimer(wait)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-q.wake:
+			case <-timer.C:
+			}
+			timer.Stop()
+			continue
+		}
+		o.attempt(ctx, q, item)
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// next returns the first message that is due and has no earlier message
+// to the same chat still waiting, or else how long to wait for one.
+func (o *outbox) next(q *sendQueue) (*queuedMessage, time.Duration) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	now := time.Now()
+	wait := time.Hour
+	blocked := make(map[string]bool)
+	for _, item := range q.items {
+		chat := item.Message.ChatID
+		if blocked[chat] {
+			continue
+		}
+		if !item.NextAttempt.After(now) {
+			return item, 0
+		}
+		blocked[chat] = true
+		if d := item.NextAttempt.Sub(now); d < wait {
+			wait = d
+		}
+	}
+	return nil, wait
+}
+
+// attempt tries to send item, and removes it from the queue once it was
+// sent or given up on; otherwise it is scheduled for a retry.
+func (o *outbox) attempt(ctx context.Context, q *sendQueue, item *queuedMessage) {
+	msg := item.Message
+	channel, ok := o.lookup(q.name)
+	if !ok {
+		logger.WarnCF("channels", "Unknown channel for outbound message", map[string]interface{}{
+			"channel": q.name,
+		})
+		o.remove(q, item)
+		return
+	}
+
+	run := &deliveryRun{skip: item.Sent, wait: q.limiter.wait}
+	err := deliverRun(ctx, channel, msg, run)
+	if err != nil && ctx.Err() != nil {
+		// Shutting down: the message stays saved and is sent after restart
+		o.mu.Lock()
+		item.Sent = run.made
+		o.saveLocked()
+		o.mu.Unlock()
+		return
+	}
+	if err == nil || item.transient() || item.Attempts >= o.maxRetries || !retryable(err) {
+		if err != nil {
+			logger.ErrorCF("channels", "Error sending message to channel", map[string]interface{}{
+				"channel":  msg.Channel,
+				"chat_id":  msg.ChatID,
+				"attempts": item.Attempts + 1,
+				"error":    err.Error(),
+			})
+		}
+		o.remove(q, item)
+		if o.done != nil {
+			o.done(ctx, msg, err)
+		}
+		return
+	}
+
+	o.mu.Lock()
+	item.Sent = run.made
+	item.Attempts++
+	delay := o.retryDelay << (item.Attempts - 1)
+	if delay > maxRetryDelay || delay < o.retryDelay {
+		delay = maxRetryDelay
+	}
+	item.NextAttempt = time.Now().Add(delay)
+	o.saveLocked()
+	o.mu.Unlock()
+
+	logger.WarnCF("channels", "Failed to send message, retrying", map[string]interface{}{
+		"channel": msg.Channel,
+		"chat_id": msg.ChatID,
+		"attempt": item.Attempts,
+		"retry":   delay.String(),
+		"error":   err.Error(),
+	})
+}
+
+// retryable reports whether a failed send may succeed when tried again.
+// Rate limits, server errors and network errors pass; other client errors,
+// such as a bot blocked by the user, a chat that does not exist or a bad
+// request, fail the same way every time. Errors without a status are
+// retried.
+func retryable(err error) bool {
+	status := sendStatus(err)
+	return status == 0 || status == 429 || status >= 500
+}
+
+// statusPattern finds the HTTP status in the errors of channels that call
+// their APIs directly, such as "LINE API error (status 403): ...".
+var statusPattern = regexp.MustCompile(`status[:\s]+(\d{3})`)
+
+// sendStatus returns the HTTP status of a failed send, or 0 if it is not
+// known.
+func sendStatus(err error) int {
+	var tgErr *telegoapi.Error
+	var restErr *discordgo.RESTError
+	var slackStatus slack.StatusCodeError
+	var slackLimited *slack.RateLimitedError
+	var discordLimited *discordgo.RateLimitError
+	switch {
+	case errors.As(err, &tgErr):
+		return tgErr.ErrorCode
+	case errors.As(err, &restErr) && restErr.Response != nil:
+		return restErr.Response.StatusCode
+	case errors.As(err, &slackStatus):
+		return slackStatus.Code
+	case errors.As(err, &slackLimited), errors.As(err, &discordLimited):
+		return 429
+	}
+	if m := statusPattern.FindStringSubmatch(err.Error()); m != nil {
+		status, _ := strconv.Atoi(m[1])
+		return status
+	}
+	return 0
+}
+
+func (o *outbox) remove(q *sendQueue, item *queuedMessage) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for i, it := range q.items {
+		if it == item {
+			q.items = append(q.items[:i], q.items[i+1:]...)
+			break
+		}
+	}
+	if !item.transient() {
+		o.saveLocked()
+	}
+}
+
+// saveLocked writes the messages waiting to be sent to the outbox file,
+// or removes it when there are none.
+func (o *outbox) saveLocked() {
+	if o.path == "" {
+		return
+	}
+	var pending []*queuedMessage
+	for _, q := range o.queues {
+		for _, item := range q.items {
+			if !item.transient() {
+				pending = append(pending, item)
+			}
+		}
+	}
+	if len(pending) == 0 {
+		os.Remove(o.path)
+		return
+	}
+	err := func() error {
+		data, err := json.Marshal(pending)
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Dir(o.path), 0700); err != nil {
+			return err
+		}
+		tmp := o.path + ".tmp"
+		if err := os.WriteFile(tmp, data, 0600); err != nil {
+			return err
+		}
+		return os.Rename(tmp, o.path)
+	}()
+	if err != nil {
+		logger.WarnCF("channels", "Failed to save the outbox", map[string]interface{}{
+			"path":  o.path,
+			"error": err.Error(),
+		})
+	}
+}
+
+// rateLimiter spaces sends evenly to at most a rate per second. A nil
+// limiter does not wait.
+type rateLimiter struct {
+	interval time.Duration
+	mu       sync.Mutex
+	next     time.Time
+}
+
+func newRateLimiter(perSecond float64) *rateLimiter {
+	if perSecond <= 0 {
+		return nil
+	}
+	return &rateLimiter{interval: time.Duration(float64(time.Second) / perSecond)}
+}
+
+// wait blocks until the next send may be made.
+func (l *rateLimiter) wait(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	now := time.Now()
+	at := l.next
+	if at.Before(now) {
+		at = now
+	}
+	l.next = at.Add(l.interval)
+	l.mu.Unlock()
+
+	d := time.Until(at)
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
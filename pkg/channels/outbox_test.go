@@ -0,0 +1,227 @@
+package channels
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/mymmrac/telego/telegoapi"
+	"github.com/slack-go/slack"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+// flakyChannel fails the sends listed in failures, by content prefix,
+// the given number of times each, with err or else a rate limit.
+type flakyChannel struct {
+	BaseChannel
+	mu       sync.Mutex
+	failures map[string]int
+	err      error
+	sent     []string
+}
+
+func (c *flakyChannel) Start(ctx context.Context) error { return nil }
+func (c *flakyChannel) Stop(ctx context.Context) error  { return nil }
+func (c *flakyChannel) MaxMessageLength() int           { return 40 }
+func (c *flakyChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for prefix, n := range c.failures {
+		if strings.HasPrefix(msg.Content, prefix) && n != 0 {
+			c.failures[prefix] = n - 1
+			if c.err != nil {
+				return c.err
+			}
+			return fmt.Errorf("429 too many requests")
+		}
+	}
+	c.sent = append(c.sent, msg.ChatID+": "+msg.Content)
+	return nil
+}
+
+func (c *flakyChannel) messages() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.sent...)
+}
+
+type outboxResult struct {
+	msg bus.OutboundMessage
+	err error
+}
+
+func newTestOutbox(t *testing.T, path string, ch Channel, maxRetries int, retryDelay time.Duration) (*outbox, chan outboxResult) {
+	t.Helper()
+	o := newOutbox(path, config.OutboundConfig{MaxRetries: maxRetries})
+	o.retryDelay = retryDelay
+	o.lookup = func(name string) (Channel, bool) { return ch, name == "telegram" }
+	results := make(chan outboxResult, 10)
+	o.done = func(ctx context.Context, msg bus.OutboundMessage, err error) {
+		results <- outboxResult{msg, err}
+	}
+	return o, results
+}
+
+func waitResult(t *testing.T, results chan outboxResult) outboxResult {
+	t.Helper()
+	select {
+	case r := <-results:
+		return r
+	case <-time.After(2 * time.Second):
+		t.Fatal("message was not sent")
+		return outboxResult{}
+	}
+}
+
+func TestOutbox_RetriesFromFailedPart(t *testing.T) {
+	ch := &flakyChannel{failures: map[string]int{"(2/3)": 2}}
+	o, results := newTestOutbox(t, "", ch, 3, time.Millisecond)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	o.start(ctx)
+
+	o.enqueue(bus.OutboundMessage{
+		Channel: "telegram",
+		ChatID:  "42",
+		Content: "Gemcitabine is given weekly.\n\nNab-paclitaxel is given with it.",
+	})
+	if r := waitResult(t, results); r.err != nil {
+		t.Fatalf("delivery failed: %v", r.err)
+	}
+	sent := ch.messages()
+	if len(sent) != 3 || !strings.HasPrefix(sent[0], "42: (1/3)") || !strings.HasPrefix(sent[1], "42: (2/3)") || !strings.HasPrefix(sent[2], "42: (3/3)") {
+		t.Errorf("sent = %q, want each part once", sent)
+	}
+}
+
+func TestOutbox_GivesUp(t *testing.T) {
+	ch := &flakyChannel{failures: map[string]int{"Your CT": -1}}
+	o, results := newTestOutbox(t, "", ch, 2, time.Millisecond)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	o.start(ctx)
+
+	o.enqueue(bus.OutboundMessage{Channel: "telegram", ChatID: "42", Content: "Your CT report is ready."})
+	if r := waitResult(t, results); r.err == nil {
+		t.Error("expected the message to be given up on")
+	}
+	if ch.failures["Your CT"] != -4 {
+		t.Errorf("attempts = %d, want 3", -ch.failures["Your CT"]-1)
+	}
+}
+
+func TestOutbox_GivesUpOnPermanentErrors(t *testing.T) {
+	blocked := &telegoapi.Error{ErrorCode: 403, Description: "Forbidden: bot was blocked by the user"}
+	ch := &flakyChannel{failures: map[string]int{"Your CT": -1}, err: fmt.Errorf("api: %w", blocked)}
+	o, results := newTestOutbox(t, "", ch, 3, time.Millisecond)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	o.start(ctx)
+
+	o.enqueue(bus.OutboundMessage{Channel: "telegram", ChatID: "42", Content: "Your CT report is ready."})
+	if r := waitResult(t, results); r.err == nil {
+		t.Error("expected the message to be given up on")
+	}
+	if ch.failures["Your CT"] != -2 {
+		t.Errorf("attempts = %d, want 1", -ch.failures["Your CT"]-1)
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"telegram rate limit", &telegoapi.Error{ErrorCode: 429, Description: "Too Many Requests: retry after 5"}, true},
+		{"telegram blocked", fmt.Errorf("api: %w", &telegoapi.Error{ErrorCode: 403, Description: "Forbidden: bot was blocked by the user"}), false},
+		{"telegram chat not found", &telegoapi.Error{ErrorCode: 400, Description: "Bad Request: chat not found"}, false},
+		{"telegram server error", &telegoapi.Error{ErrorCode: 502, Description: "Bad Gateway"}, true},
+		{"discord missing access", fmt.Errorf("failed to send discord message: %w", &discordgo.RESTError{Response: &http.Response{StatusCode: 403}}), false},
+		{"slack server error", fmt.Errorf("failed to send slack message: %w", slack.StatusCodeError{Code: 503}), true},
+		{"slack rate limit", &slack.RateLimitedError{RetryAfter: time.Second}, true},
+		{"line bad request", fmt.Errorf("LINE API error (status 400): invalid reply token"), false},
+		{"whatsapp rate limit", fmt.Errorf("WhatsApp API error (status 429): too many messages"), true},
+		{"network", &net.OpError{Op: "dial", Net: "tcp", Err: fmt.Errorf("connection refused")}, true},
+		{"unknown", fmt.Errorf("telegram bot not running"), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := retryable(tt.err); got != tt.want {
+				t.Errorf("retryable(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOutbox_OtherChatsGoAhead(t *testing.T) {
+	ch := &flakyChannel{failures: map[string]int{"Blocked": 1}}
+	o, results := newTestOutbox(t, "", ch, 3, time.Hour)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	o.start(ctx)
+
+	o.enqueue(bus.OutboundMessage{Channel: "telegram", ChatID: "1", Content: "Blocked until retried"})
+	o.enqueue(bus.OutboundMessage{Channel: "telegram", ChatID: "1", Content: "Second to chat 1"})
+	o.enqueue(bus.OutboundMessage{Channel: "telegram", ChatID: "2", Content: "To chat 2"})
+
+	if r := waitResult(t, results); r.msg.ChatID != "2" {
+		t.Errorf("first delivered = %+v, want chat 2's message", r.msg)
+	}
+	if sent := ch.messages(); len(sent) != 1 {
+		t.Errorf("chat 1's second message overtook its first: %q", sent)
+	}
+}
+
+func TestOutbox_ResumesAfterRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "outbox.json")
+	ch := &flakyChannel{}
+
+	// Queued before sending started, as if the gateway stopped first
+	stopped, _ := newTestOutbox(t, path, ch, 3, time.Millisecond)
+	stopped.enqueue(bus.OutboundMessage{Channel: "telegram", ChatID: "42", Content: "Reminder: blood test at 9:00"})
+	stopped.enqueue(bus.OutboundMessage{Channel: "telegram", ChatID: "42", Content: "Working…", Progress: true})
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("outbox not saved: %v", err)
+	}
+
+	o, results := newTestOutbox(t, path, ch, 3, time.Millisecond)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	o.start(ctx)
+	if r := waitResult(t, results); r.err != nil || r.msg.Content != "Reminder: blood test at 9:00" {
+		t.Fatalf("resumed %+v", r)
+	}
+	select {
+	case r := <-results:
+		t.Errorf("progress update was kept across the restart: %+v", r.msg)
+	case <-time.After(50 * time.Millisecond):
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("outbox file not removed once empty")
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	if err := (*rateLimiter)(nil).wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	l := newRateLimiter(20)
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		l.wait(context.Background())
+	}
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Errorf("4 sends at 20/s took %s", elapsed)
+	}
+}
@@ -204,9 +204,13 @@ func (c *QQChannel) handleGroupATMessage() event.GroupATMessageEventHandler {
 		})
 
 		// 转发到消息总线（使用 GroupID 作为 ChatID）
+		// QQ only delivers group messages that @-mention the bot
 		metadata := map[string]string{
 			"message_id": data.ID,
 			"group_id":   data.GroupID,
+			"peer_kind":  "group",
+			"peer_id":    data.GroupID,
+			"mentioned":  "true",
 		}
 
 		c.HandleMessage(senderID, data.GroupID, content, []string{}, metadata)
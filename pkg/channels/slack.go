@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
 	"sync"
 	"time"
@@ -15,6 +16,7 @@ import (
 	"github.com/sipeed/picoclaw/pkg/bus"
 	"github.com/sipeed/picoclaw/pkg/config"
 	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/ocr"
 	"github.com/sipeed/picoclaw/pkg/utils"
 	"github.com/sipeed/picoclaw/pkg/voice"
 )
@@ -27,9 +29,11 @@ type SlackChannel struct {
 	botUserID    string
 	teamID       string
 	transcriber  *voice.GroqTranscriber
+	recognizer   ocr.Recognizer
 	ctx          context.Context
 	cancel       context.CancelFunc
 	pendingAcks  sync.Map
+	botThreads   sync.Map // "channel/thread_ts" of threads the bot has replied in
 }
 
 type slackMessageRef struct {
@@ -63,6 +67,10 @@ func (c *SlackChannel) SetTranscriber(transcriber *voice.GroqTranscriber) {
 	c.transcriber = transcriber
 }
 
+func (c *SlackChannel) SetOCR(recognizer ocr.Recognizer) {
+	c.recognizer = recognizer
+}
+
 func (c *SlackChannel) Start(ctx context.Context) error {
 	logger.InfoC("slack", "Starting Slack channel (Socket Mode)")
 
@@ -123,6 +131,10 @@ func (c *SlackChannel) Send(ctx context.Context, msg bus.OutboundMessage) error
 		slack.MsgOptionText(msg.Content, false),
 	}
 
+	// A reply to a top-level message is made in its thread
+	if threadTS == "" {
+		threadTS = msg.ReplyTo
+	}
 	if threadTS != "" {
 		opts = append(opts, slack.MsgOptionTS(threadTS))
 	}
@@ -131,6 +143,9 @@ func (c *SlackChannel) Send(ctx context.Context, msg bus.OutboundMessage) error
 	if err != nil {
 		return fmt.Errorf("failed to send slack message: %w", err)
 	}
+	if threadTS != "" {
+		c.botThreads.Store(channelID+"/"+threadTS, struct{}{})
+	}
 
 	if ref, ok := c.pendingAcks.LoadAndDelete(msg.ChatID); ok {
 		msgRef := ref.(slackMessageRef)
@@ -148,6 +163,46 @@ func (c *SlackChannel) Send(ctx context.Context, msg bus.OutboundMessage) error
 	return nil
 }
 
+// SendMedia uploads a file to the chat, in its thread if it has one.
+func (c *SlackChannel) SendMedia(ctx context.Context, chatID string, file bus.Attachment) error {
+	if !c.IsRunning() {
+		return fmt.Errorf("slack channel not running")
+	}
+	channelID, threadTS := parseSlackChatID(chatID)
+	if channelID == "" {
+		return fmt.Errorf("invalid slack chat ID: %s", chatID)
+	}
+	info, err := os.Stat(file.Path)
+	if err != nil {
+		return err
+	}
+	name := filepath.Base(file.Path)
+	_, err = c.api.UploadFileV2Context(ctx, slack.UploadFileV2Parameters{
+		File:            file.Path,
+		FileSize:        int(info.Size()),
+		Filename:        name,
+		Title:           name,
+		InitialComment:  mediaCaption(file),
+		Channel:         channelID,
+		ThreadTimestamp: threadTS,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to upload slack file: %w", err)
+	}
+	return nil
+}
+
+// MaxMessageLength is where Slack truncates a message's text.
+func (c *SlackChannel) MaxMessageLength() int {
+	return 40000
+}
+
+// SupportsReplies reports that answers can reply to the question, in its
+// thread.
+func (c *SlackChannel) SupportsReplies() bool {
+	return true
+}
+
 func (c *SlackChannel) eventLoop() {
 	for {
 		select {
@@ -200,11 +255,8 @@ func (c *SlackChannel) handleMessageEvent(ev *slackevents.MessageEvent) {
 		return
 	}
 
-	// 检查白名单，避免为被拒绝的用户下载附件
-	if !c.IsAllowed(ev.User) {
-		logger.DebugCF("slack", "Message rejected by allowlist", map[string]interface{}{
-			"user_id": ev.User,
-		})
+	// 检查访问控制，避免为被拒绝的用户下载附件
+	if !c.Admit(ev.User, ev.Channel, ev.ChannelType == "im") {
 		return
 	}
 
@@ -218,6 +270,23 @@ func (c *SlackChannel) handleMessageEvent(ev *slackevents.MessageEvent) {
 		chatID = channelID + "/" + threadTS
 	}
 
+	// In channels, messages that mention the bot also arrive as
+	// app_mention events and are answered from there. Others are for the
+	// bot when they are in a thread it has replied in.
+	isChannel := !strings.HasPrefix(channelID, "D")
+	mentioned := false
+	if isChannel {
+		if c.botUserID != "" && strings.Contains(ev.Text, "<@"+c.botUserID+">") {
+			return
+		}
+		if threadTS != "" {
+			_, mentioned = c.botThreads.Load(chatID)
+		}
+		if !c.RespondsInGroup(mentioned) {
+			return
+		}
+	}
+
 	c.api.AddReaction("eyes", slack.ItemRef{
 		Channel:   channelID,
 		Timestamp: messageTS,
@@ -266,6 +335,8 @@ func (c *SlackChannel) handleMessageEvent(ev *slackevents.MessageEvent) {
 				} else {
 					content += fmt.Sprintf("\n[voice transcription: %s]", result.Text)
 				}
+			} else if utils.IsImageFile(file.Name, file.Mimetype) {
+				content += "\n" + imageText(c.ctx, c.recognizer, "slack", localPath, fmt.Sprintf("[file: %s]", file.Name))
 			} else {
 				content += fmt.Sprintf("\n[file: %s]", file.Name)
 			}
@@ -278,12 +349,13 @@ func (c *SlackChannel) handleMessageEvent(ev *slackevents.MessageEvent) {
 
 	peerKind := "channel"
 	peerID := channelID
-	if strings.HasPrefix(channelID, "D") {
+	if !isChannel {
 		peerKind = "direct"
 		peerID = senderID
 	}
 
 	metadata := map[string]string{
+		"message_id": messageTS,
 		"message_ts": messageTS,
 		"channel_id": channelID,
 		"thread_ts":  threadTS,
@@ -291,6 +363,7 @@ func (c *SlackChannel) handleMessageEvent(ev *slackevents.MessageEvent) {
 		"peer_kind":  peerKind,
 		"peer_id":    peerID,
 		"team_id":    c.teamID,
+		"mentioned":  fmt.Sprintf("%t", mentioned),
 	}
 
 	logger.DebugCF("slack", "Received message", map[string]interface{}{
@@ -308,10 +381,7 @@ func (c *SlackChannel) handleAppMention(ev *slackevents.AppMentionEvent) {
 		return
 	}
 
-	if !c.IsAllowed(ev.User) {
-		logger.DebugCF("slack", "Mention rejected by allowlist", map[string]interface{}{
-			"user_id": ev.User,
-		})
+	if !c.Admit(ev.User, ev.Channel, false) {
 		return
 	}
 
@@ -356,6 +426,7 @@ func (c *SlackChannel) handleAppMention(ev *slackevents.AppMentionEvent) {
 		"thread_ts":  threadTS,
 		"platform":   "slack",
 		"is_mention": "true",
+		"mentioned":  "true",
 		"peer_kind":  mentionPeerKind,
 		"peer_id":    mentionPeerID,
 		"team_id":    c.teamID,
@@ -374,10 +445,7 @@ func (c *SlackChannel) handleSlashCommand(event socketmode.Event) {
 		c.socketClient.Ack(*event.Request)
 	}
 
-	if !c.IsAllowed(cmd.UserID) {
-		logger.DebugCF("slack", "Slash command rejected by allowlist", map[string]interface{}{
-			"user_id": cmd.UserID,
-		})
+	if !c.Admit(cmd.UserID, cmd.ChannelID, false) {
 		return
 	}
 
@@ -394,6 +462,7 @@ func (c *SlackChannel) handleSlashCommand(event socketmode.Event) {
 		"channel_id": channelID,
 		"platform":   "slack",
 		"is_command": "true",
+		"mentioned":  "true",
 		"trigger_id": cmd.TriggerID,
 		"peer_kind":  "channel",
 		"peer_id":    channelID,
@@ -7,6 +7,7 @@ import (
 	"net/url"
 	"os"
 	"regexp"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -20,6 +21,7 @@ import (
 	"github.com/sipeed/picoclaw/pkg/bus"
 	"github.com/sipeed/picoclaw/pkg/config"
 	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/ocr"
 	"github.com/sipeed/picoclaw/pkg/utils"
 	"github.com/sipeed/picoclaw/pkg/voice"
 )
@@ -31,6 +33,7 @@ type TelegramChannel struct {
 	config       *config.Config
 	chatIDs      map[string]int64
 	transcriber  *voice.GroqTranscriber
+	recognizer   ocr.Recognizer
 	placeholders sync.Map // chatID -> messageID
 	stopThinking sync.Map // chatID -> thinkingCancel
 }
@@ -84,6 +87,10 @@ func (c *TelegramChannel) SetTranscriber(transcriber *voice.GroqTranscriber) {
 	c.transcriber = transcriber
 }
 
+func (c *TelegramChannel) SetOCR(recognizer ocr.Recognizer) {
+	c.recognizer = recognizer
+}
+
 func (c *TelegramChannel) Start(ctx context.Context) error {
 	logger.InfoC("telegram", "Starting Telegram bot (polling mode)...")
 
@@ -119,6 +126,10 @@ func (c *TelegramChannel) Start(ctx context.Context) error {
 		return c.handleMessage(ctx, &message)
 	}, th.AnyMessage())
 
+	bh.HandleCallbackQuery(func(ctx *th.Context, query telego.CallbackQuery) error {
+		return c.handleCallback(ctx, query)
+	}, th.AnyCallbackQueryWithMessage())
+
 	c.setRunning(true)
 	logger.InfoCF("telegram", "Telegram bot connected", map[string]interface{}{
 		"username": c.bot.Username(),
@@ -159,20 +170,46 @@ func (c *TelegramChannel) Send(ctx context.Context, msg bus.OutboundMessage) err
 
 	htmlContent := markdownToTelegramHTML(msg.Content)
 
-	// Try to edit placeholder
-	if pID, ok := c.placeholders.Load(msg.ChatID); ok {
-		c.placeholders.Delete(msg.ChatID)
-		editMsg := tu.EditMessageText(tu.ID(chatID), pID.(int), htmlContent)
-		editMsg.ParseMode = telego.ModeHTML
-
-		if _, err = c.bot.EditMessageText(ctx, editMsg); err == nil {
-			return nil
+	// A message has one keyboard: quick replies take it, and buttons are
+	// shown only on messages without them
+	var inline *telego.InlineKeyboardMarkup
+	if len(msg.Buttons) > 0 && len(msg.QuickReplies) == 0 {
+		inline = inlineKeyboard(msg.Buttons)
+	}
+
+	// Try to edit placeholder. Edited messages cannot carry a reply
+	// keyboard or become replies, so such messages are sent fresh and the
+	// placeholder is removed.
+	replyTo, _ := strconv.Atoi(msg.ReplyTo)
+	if pID, ok := c.placeholders.LoadAndDelete(msg.ChatID); ok {
+		if len(msg.QuickReplies) > 0 || replyTo != 0 {
+			c.bot.DeleteMessage(ctx, tu.Delete(tu.ID(chatID), pID.(int)))
+		} else {
+			editMsg := tu.EditMessageText(tu.ID(chatID), pID.(int), htmlContent)
+			editMsg.ParseMode = telego.ModeHTML
+			editMsg.ReplyMarkup = inline
+
+			if _, err = c.bot.EditMessageText(ctx, editMsg); err == nil {
+				return nil
+			}
+			// Fallback to new message if edit fails
 		}
-		// Fallback to new message if edit fails
 	}
 
 	tgMsg := tu.Message(tu.ID(chatID), htmlContent)
 	tgMsg.ParseMode = telego.ModeHTML
+	if len(msg.QuickReplies) > 0 {
+		rows := make([][]telego.KeyboardButton, 0, len(msg.QuickReplies))
+		for _, reply := range msg.QuickReplies {
+			rows = append(rows, tu.KeyboardRow(tu.KeyboardButton(reply)))
+		}
+		tgMsg.WithReplyMarkup(tu.Keyboard(rows...).WithResizeKeyboard().WithOneTimeKeyboard())
+	} else if inline != nil {
+		tgMsg.WithReplyMarkup(inline)
+	}
+	if replyTo != 0 {
+		tgMsg.WithReplyParameters(&telego.ReplyParameters{MessageID: replyTo, AllowSendingWithoutReply: true})
+	}
 
 	if _, err = c.bot.SendMessage(ctx, tgMsg); err != nil {
 		logger.ErrorCF("telegram", "HTML parse failed, falling back to plain text", map[string]interface{}{
@@ -186,6 +223,197 @@ func (c *TelegramChannel) Send(ctx context.Context, msg bus.OutboundMessage) err
 	return nil
 }
 
+// SendVoice sends an audio file as a voice message. Telegram plays OGG
+// Opus, MP3 and M4A as voice; other formats are sent as a file.
+func (c *TelegramChannel) SendVoice(ctx context.Context, chatID string, audio bus.Attachment) error {
+	if !c.IsRunning() {
+		return fmt.Errorf("telegram bot not running")
+	}
+	id, err := parseChatID(chatID)
+	if err != nil {
+		return fmt.Errorf("invalid chat ID: %w", err)
+	}
+	if stop, ok := c.stopThinking.LoadAndDelete(chatID); ok {
+		if cf, ok := stop.(*thinkingCancel); ok && cf != nil {
+			cf.Cancel()
+		}
+	}
+	if pID, ok := c.placeholders.LoadAndDelete(chatID); ok {
+		c.bot.DeleteMessage(ctx, tu.Delete(tu.ID(id), pID.(int)))
+	}
+
+	f, err := os.Open(audio.Path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	switch audio.MimeType {
+	case "audio/ogg", "audio/mpeg", "audio/mp4":
+		_, err = c.bot.SendVoice(ctx, tu.Voice(tu.ID(id), tu.File(f)))
+	default:
+		_, err = c.bot.SendDocument(ctx, tu.Document(tu.ID(id), tu.File(f)))
+	}
+	return err
+}
+
+// SendMedia uploads a file: images as photos and anything else as a
+// document.
+func (c *TelegramChannel) SendMedia(ctx context.Context, chatID string, file bus.Attachment) error {
+	if !c.IsRunning() {
+		return fmt.Errorf("telegram bot not running")
+	}
+	id, err := parseChatID(chatID)
+	if err != nil {
+		return fmt.Errorf("invalid chat ID: %w", err)
+	}
+
+	f, err := os.Open(file.Path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	caption := mediaCaption(file)
+	mimeType := file.MimeType
+	if mimeType == "" {
+		mimeType = utils.DetectMediaType(file.Path)
+	}
+	if strings.HasPrefix(mimeType, "image/") && mimeType != "image/svg+xml" {
+		_, err = c.bot.SendPhoto(ctx, tu.Photo(tu.ID(id), tu.File(f)).WithCaption(caption))
+	} else {
+		_, err = c.bot.SendDocument(ctx, tu.Document(tu.ID(id), tu.File(f)).WithCaption(caption))
+	}
+	return err
+}
+
+// UpdateProgress shows text in the "Thinking..." placeholder, or in a new
+// placeholder if there is none, so the answer later replaces it.
+func (c *TelegramChannel) UpdateProgress(ctx context.Context, chatID, text string) error {
+	if !c.IsRunning() {
+		return fmt.Errorf("telegram bot not running")
+	}
+	id, err := parseChatID(chatID)
+	if err != nil {
+		return fmt.Errorf("invalid chat ID: %w", err)
+	}
+
+	if pID, ok := c.placeholders.Load(chatID); ok {
+		if _, err = c.bot.EditMessageText(ctx, tu.EditMessageText(tu.ID(id), pID.(int), text)); err == nil {
+			return nil
+		}
+	}
+	pMsg, err := c.bot.SendMessage(ctx, tu.Message(tu.ID(id), text))
+	if err != nil {
+		return err
+	}
+	c.placeholders.Store(chatID, pMsg.MessageID)
+	return nil
+}
+
+// MaxMessageLength stays below Telegram's 4096 character limit to leave
+// room for the HTML markup added when rendering Markdown.
+func (c *TelegramChannel) MaxMessageLength() int {
+	return 3800
+}
+
+// SupportsQuickReplies reports that quick replies are shown as a one-time
+// reply keyboard.
+func (c *TelegramChannel) SupportsQuickReplies() bool {
+	return true
+}
+
+// SupportsReplies reports that answers can reply to the question.
+func (c *TelegramChannel) SupportsReplies() bool {
+	return true
+}
+
+// isAddressedToBot reports whether a group message is for the bot: it
+// mentions the bot's @username or replies to one of the bot's messages.
+func (c *TelegramChannel) isAddressedToBot(message *telego.Message) bool {
+	if reply := message.ReplyToMessage; reply != nil && reply.From != nil && reply.From.ID == c.bot.ID() {
+		return true
+	}
+	username := c.bot.Username()
+	if username == "" {
+		return false
+	}
+	text := strings.ToLower(message.Text + " " + message.Caption)
+	return strings.Contains(text, "@"+strings.ToLower(username))
+}
+
+// stripBotMention removes the bot's @username from a group message.
+func (c *TelegramChannel) stripBotMention(content string) string {
+	username := c.bot.Username()
+	if username == "" {
+		return content
+	}
+	re := regexp.MustCompile(`(?i)@` + regexp.QuoteMeta(username) + `\b`)
+	return strings.TrimSpace(re.ReplaceAllString(content, ""))
+}
+
+// inlineKeyboard lays out buttons in a row when there are two, like
+// approve and deny, and one per row otherwise.
+func inlineKeyboard(buttons []bus.Button) *telego.InlineKeyboardMarkup {
+	keys := make([]telego.InlineKeyboardButton, len(buttons))
+	for i, b := range buttons {
+		keys[i] = tu.InlineKeyboardButton(b.Label).WithCallbackData(b.Data)
+	}
+	if len(keys) <= 2 {
+		return tu.InlineKeyboard(keys)
+	}
+	rows := make([][]telego.InlineKeyboardButton, len(keys))
+	for i, key := range keys {
+		rows[i] = tu.InlineKeyboardRow(key)
+	}
+	return tu.InlineKeyboard(rows...)
+}
+
+// handleCallback turns a press of an inline button into a message from the
+// user carrying the button's data, such as "/approve <id>" or "👍", which
+// the agent handles like the typed command. The buttons are removed so
+// each choice is made once.
+func (c *TelegramChannel) handleCallback(ctx context.Context, query telego.CallbackQuery) error {
+	if err := c.bot.AnswerCallbackQuery(ctx, tu.CallbackQuery(query.ID)); err != nil {
+		logger.DebugCF("telegram", "Failed to answer callback query", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+	if query.Message == nil || query.Data == "" {
+		return nil
+	}
+
+	user := query.From
+	senderID := fmt.Sprintf("%d", user.ID)
+	if user.Username != "" {
+		senderID = fmt.Sprintf("%d|%s", user.ID, user.Username)
+	}
+	chat := query.Message.GetChat()
+	if !c.Admit(senderID, fmt.Sprintf("%d", chat.ID), chat.Type == "private") {
+		return nil
+	}
+	c.bot.EditMessageReplyMarkup(ctx, tu.EditMessageReplyMarkup(tu.ID(chat.ID), query.Message.GetMessageID(), nil))
+
+	peerKind := "direct"
+	peerID := fmt.Sprintf("%d", user.ID)
+	if chat.Type != "private" {
+		peerKind = "group"
+		peerID = fmt.Sprintf("%d", chat.ID)
+	}
+	metadata := map[string]string{
+		"message_id":    fmt.Sprintf("%d", query.Message.GetMessageID()),
+		"user_id":       fmt.Sprintf("%d", user.ID),
+		"username":      user.Username,
+		"first_name":    user.FirstName,
+		"language_code": user.LanguageCode,
+		"is_group":      fmt.Sprintf("%t", chat.Type != "private"),
+		"peer_kind":     peerKind,
+		"peer_id":       peerID,
+		"mentioned":     "true",
+		"callback":      "true",
+	}
+	c.HandleMessage(fmt.Sprintf("%d", user.ID), fmt.Sprintf("%d", chat.ID), query.Data, nil, metadata)
+	return nil
+}
+
 func (c *TelegramChannel) handleMessage(ctx context.Context, message *telego.Message) error {
 	if message == nil {
 		return fmt.Errorf("message is nil")
@@ -201,15 +429,18 @@ func (c *TelegramChannel) handleMessage(ctx context.Context, message *telego.Mes
 		senderID = fmt.Sprintf("%d|%s", user.ID, user.Username)
 	}
 
-	// 检查白名单，避免为被拒绝的用户下载附件
-	if !c.IsAllowed(senderID) {
-		logger.DebugCF("telegram", "Message rejected by allowlist", map[string]interface{}{
-			"user_id": senderID,
-		})
+	chatID := message.Chat.ID
+	isGroup := message.Chat.Type != "private"
+
+	// 检查访问控制，避免为被拒绝的用户下载附件
+	if !c.Admit(senderID, fmt.Sprintf("%d", chatID), !isGroup) {
 		return nil
 	}
 
-	chatID := message.Chat.ID
+	mentioned := isGroup && c.isAddressedToBot(message)
+	if isGroup && !c.RespondsInGroup(mentioned) {
+		return nil
+	}
 	c.chatIDs[senderID] = chatID
 
 	content := ""
@@ -239,6 +470,10 @@ func (c *TelegramChannel) handleMessage(ctx context.Context, message *telego.Mes
 		content += message.Caption
 	}
 
+	if isGroup {
+		content = c.stripBotMention(content)
+	}
+
 	if len(message.Photo) > 0 {
 		photo := message.Photo[len(message.Photo)-1]
 		photoPath := c.downloadPhoto(ctx, photo.FileID)
@@ -248,7 +483,7 @@ func (c *TelegramChannel) handleMessage(ctx context.Context, message *telego.Mes
 			if content != "" {
 				content += "\n"
 			}
-			content += "[image: photo]"
+			content += imageText(ctx, c.recognizer, "telegram", photoPath, "[image: photo]")
 		}
 	}
 
@@ -349,19 +584,21 @@ func (c *TelegramChannel) handleMessage(ctx context.Context, message *telego.Mes
 
 	peerKind := "direct"
 	peerID := fmt.Sprintf("%d", user.ID)
-	if message.Chat.Type != "private" {
+	if isGroup {
 		peerKind = "group"
 		peerID = fmt.Sprintf("%d", chatID)
 	}
 
 	metadata := map[string]string{
-		"message_id": fmt.Sprintf("%d", message.MessageID),
-		"user_id":    fmt.Sprintf("%d", user.ID),
-		"username":   user.Username,
-		"first_name": user.FirstName,
-		"is_group":   fmt.Sprintf("%t", message.Chat.Type != "private"),
-		"peer_kind":  peerKind,
-		"peer_id":    peerID,
+		"message_id":    fmt.Sprintf("%d", message.MessageID),
+		"user_id":       fmt.Sprintf("%d", user.ID),
+		"username":      user.Username,
+		"first_name":    user.FirstName,
+		"language_code": user.LanguageCode,
+		"is_group":      fmt.Sprintf("%t", isGroup),
+		"peer_kind":     peerKind,
+		"peer_id":       peerID,
+		"mentioned":     fmt.Sprintf("%t", mentioned),
 	}
 
 	c.HandleMessage(fmt.Sprintf("%d", user.ID), fmt.Sprintf("%d", chatID), content, mediaPaths, metadata)
@@ -0,0 +1,656 @@
+package channels
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+const (
+	webSessionCookie = "picoclaw_session"
+	// webHistoryLimit is how many messages of a conversation a session
+	// keeps to show on its page and replay to a stream that reconnects.
+	webHistoryLimit = 100
+	// webSubscriberBuffer is how many events a stream may fall behind
+	// before it is closed, to reconnect and catch up from the history.
+	webSubscriberBuffer = 32
+	webKeepAlive        = 20 * time.Second
+)
+
+// WebChannel serves a chat for websites: a page without JavaScript that a
+// clinic can embed in an iframe, and for pages of its own, an endpoint to
+// post messages and a server-sent event or WebSocket stream of the
+// answers. Each visitor's session, identified by a cookie, is a chat.
+type WebChannel struct {
+	*BaseChannel
+	config     config.WebConfig
+	path       string
+	httpServer *http.Server
+	upgrader   websocket.Upgrader
+	ctx        context.Context
+	cancel     context.CancelFunc
+
+	mu       sync.Mutex
+	sessions map[string]*webSession
+}
+
+type webSession struct {
+	id       string
+	lastSeen time.Time
+	events   []webEvent // the conversation, oldest first
+	nextID   int
+	progress string // the latest progress update, until the answer
+	pending  bool   // a message is waiting for its answer
+	subs     map[chan webEvent]struct{}
+}
+
+// webEvent is a message of a web chat, or a progress update, as streamed
+// and listed by the API. Progress updates have no ID and are not kept.
+type webEvent struct {
+	ID           int       `json:"id,omitempty"`
+	Type         string    `json:"type"` // "message", "progress" or "error"
+	Role         string    `json:"role,omitempty"`
+	Content      string    `json:"content"`
+	QuickReplies []string  `json:"quick_replies,omitempty"`
+	Time         time.Time `json:"time"`
+}
+
+// NewWebChannel creates the web chat channel.
+func NewWebChannel(cfg config.WebConfig, messageBus *bus.MessageBus) (*WebChannel, error) {
+	path := "/" + strings.Trim(cfg.Path, "/")
+	if path == "/" {
+		path = "/chat"
+	}
+	if cfg.SessionTTLHours <= 0 {
+		cfg.SessionTTLHours = 24
+	}
+	if cfg.MaxSessions <= 0 {
+		cfg.MaxSessions = 1000
+	}
+	if cfg.MaxMessageChars <= 0 {
+		cfg.MaxMessageChars = 4000
+	}
+	c := &WebChannel{
+		BaseChannel: NewBaseChannel("web", cfg, messageBus, nil),
+		config:      cfg,
+		path:        path,
+		sessions:    make(map[string]*webSession),
+	}
+	c.upgrader = websocket.Upgrader{CheckOrigin: c.websocketOriginAllowed}
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+	return c, nil
+}
+
+// Start serves the chat on the configured address.
+func (c *WebChannel) Start(ctx context.Context) error {
+	c.ctx, c.cancel = context.WithCancel(ctx)
+
+	addr := fmt.Sprintf("%s:%d", c.config.Host, c.config.Port)
+	c.httpServer = &http.Server{
+		Addr:              addr,
+		Handler:           c.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		logger.InfoCF("web", "Web chat listening", map[string]interface{}{
+			"addr": addr,
+			"path": c.path,
+		})
+		if err := c.httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logger.ErrorCF("web", "Web chat server error", map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+	}()
+
+	c.setRunning(true)
+	return nil
+}
+
+// Stop ends the open streams and shuts the server down.
+func (c *WebChannel) Stop(ctx context.Context) error {
+	c.setRunning(false)
+	c.cancel()
+	if c.httpServer == nil {
+		return nil
+	}
+	shutdownCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	return c.httpServer.Shutdown(shutdownCtx)
+}
+
+// Handler returns the chat's HTTP routes, all under the configured path.
+func (c *WebChannel) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(c.path, c.handlePage)
+	mux.HandleFunc(c.path+"/messages", c.withCORS(c.handleMessages))
+	mux.HandleFunc(c.path+"/events", c.withCORS(c.handleEvents))
+	mux.HandleFunc(c.path+"/ws", c.handleWebSocket)
+	return mux
+}
+
+// Send adds the answer to the visitor's chat and streams it.
+func (c *WebChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s, ok := c.sessions[msg.ChatID]
+	if !ok {
+		return fmt.Errorf("web session %s has expired", msg.ChatID)
+	}
+	s.pending = false
+	s.progress = ""
+	c.add(s, webEvent{Type: "message", Role: "assistant", Content: msg.Content, QuickReplies: msg.QuickReplies})
+	return nil
+}
+
+// UpdateProgress shows text below the visitor's message until the answer
+// arrives.
+func (c *WebChannel) UpdateProgress(ctx context.Context, chatID, text string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s, ok := c.sessions[chatID]
+	if !ok {
+		return fmt.Errorf("web session %s has expired", chatID)
+	}
+	s.progress = text
+	c.broadcast(s, webEvent{Type: "progress", Content: text, Time: time.Now()})
+	return nil
+}
+
+// SupportsQuickReplies reports that quick replies are shown as buttons.
+func (c *WebChannel) SupportsQuickReplies() bool {
+	return true
+}
+
+// post adds a visitor's message to their chat and passes it to the agent.
+func (c *WebChannel) post(s *webSession, content string) (webEvent, error) {
+	content = strings.TrimSpace(content)
+	if content == "" {
+		return webEvent{}, fmt.Errorf("message is empty")
+	}
+	if utf8.RuneCountInString(content) > c.config.MaxMessageChars {
+		return webEvent{}, fmt.Errorf("message is longer than %d characters", c.config.MaxMessageChars)
+	}
+
+	c.mu.Lock()
+	s.pending = true
+	s.progress = ""
+	event := c.add(s, webEvent{Type: "message", Role: "user", Content: content})
+	c.mu.Unlock()
+
+	c.HandleMessage(s.id, s.id, content, nil, map[string]string{
+		"platform":  "web",
+		"peer_kind": "direct",
+	})
+	return event, nil
+}
+
+// add appends a message to the chat and streams it. c.mu must be held.
+func (c *WebChannel) add(s *webSession, e webEvent) webEvent {
+	s.nextID++
+	e.ID = s.nextID
+	e.Time = time.Now()
+	s.events = append(s.events, e)
+	if len(s.events) > webHistoryLimit {
+		s.events = s.events[len(s.events)-webHistoryLimit:]
+	}
+	c.broadcast(s, e)
+	return e
+}
+
+// broadcast sends e to the session's streams. A stream too far behind is
+// closed; it reconnects and catches up from the history. c.mu must be
+// held.
+func (c *WebChannel) broadcast(s *webSession, e webEvent) {
+	for ch := range s.subs {
+		select {
+		case ch <- e:
+		default:
+			delete(s.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// subscribe returns a stream of the session's events, the messages after
+// the one with ID after, and the progress shown now.
+func (c *WebChannel) subscribe(s *webSession, after int) (chan webEvent, []webEvent, string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ch := make(chan webEvent, webSubscriberBuffer)
+	s.subs[ch] = struct{}{}
+	return ch, eventsAfter(s.events, after), s.progress
+}
+
+func (c *WebChannel) unsubscribe(s *webSession, ch chan webEvent) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := s.subs[ch]; ok {
+		delete(s.subs, ch)
+		close(ch)
+	}
+}
+
+func eventsAfter(events []webEvent, after int) []webEvent {
+	for i, e := range events {
+		if e.ID > after {
+			return append([]webEvent(nil), events[i:]...)
+		}
+	}
+	return nil
+}
+
+// session returns the visitor's session, starting one with a new cookie
+// if they have none or theirs has expired.
+func (c *WebChannel) session(w http.ResponseWriter, r *http.Request) *webSession {
+	ttl := time.Duration(c.config.SessionTTLHours) * time.Hour
+	now := time.Now()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cookie, err := r.Cookie(webSessionCookie); err == nil {
+		if s, ok := c.sessions[cookie.Value]; ok && now.Sub(s.lastSeen) < ttl {
+			s.lastSeen = now
+			return s
+		}
+	}
+
+	c.evict(now, ttl)
+	s := &webSession{id: newWebSessionID(), lastSeen: now, subs: make(map[chan webEvent]struct{})}
+	c.sessions[s.id] = s
+
+	cookie := &http.Cookie{
+		Name:     webSessionCookie,
+		Value:    s.id,
+		Path:     c.path,
+		MaxAge:   int(ttl.Seconds()),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+	if c.config.SecureCookie {
+		// A page embedded on another site only gets its cookie back with
+		// SameSite=None, which browsers allow on secure cookies only
+		cookie.Secure = true
+		cookie.SameSite = http.SameSiteNoneMode
+	}
+	http.SetCookie(w, cookie)
+	return s
+}
+
+// evict drops expired sessions, and the least recently used when there
+// are still too many. c.mu must be held.
+func (c *WebChannel) evict(now time.Time, ttl time.Duration) {
+	for id, s := range c.sessions {
+		if now.Sub(s.lastSeen) >= ttl && len(s.subs) == 0 {
+			delete(c.sessions, id)
+		}
+	}
+	for len(c.sessions) >= c.config.MaxSessions {
+		var oldest *webSession
+		for _, s := range c.sessions {
+			if oldest == nil || s.lastSeen.Before(oldest.lastSeen) {
+				oldest = s
+			}
+		}
+		for ch := range oldest.subs {
+			delete(oldest.subs, ch)
+			close(ch)
+		}
+		delete(c.sessions, oldest.id)
+	}
+}
+
+func newWebSessionID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// withCORS lets the configured sites call the API from their pages, with
+// the visitor's cookie.
+func (c *WebChannel) withCORS(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if origin := r.Header.Get("Origin"); origin != "" && c.originAllowed(origin) {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Set("Access-Control-Allow-Credentials", "true")
+			w.Header().Add("Vary", "Origin")
+			if r.Method == http.MethodOptions {
+				w.Header().Set("Access-Control-Allow-Methods", "GET, POST")
+				w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Last-Event-ID")
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+		}
+		next(w, r)
+	}
+}
+
+func (c *WebChannel) originAllowed(origin string) bool {
+	for _, allowed := range c.config.AllowOrigins {
+		if allowed == "*" || strings.EqualFold(strings.TrimRight(allowed, "/"), origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// websocketOriginAllowed accepts connections from the chat's own host and
+// from the configured sites.
+func (c *WebChannel) websocketOriginAllowed(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	return c.originAllowed(origin)
+}
+
+// handleMessages posts a message, as JSON {"content": "..."} or as the
+// page's form, or lists the chat's messages after the ID in ?after.
+func (c *WebChannel) handleMessages(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s := c.session(w, r)
+		after, _ := strconv.Atoi(r.URL.Query().Get("after"))
+		c.mu.Lock()
+		resp := map[string]interface{}{
+			"session_id": s.id,
+			"pending":    s.pending,
+			"progress":   s.progress,
+			"messages":   eventsAfter(s.events, after),
+		}
+		c.mu.Unlock()
+		writeWebJSON(w, http.StatusOK, resp)
+	case http.MethodPost:
+		r.Body = http.MaxBytesReader(w, r.Body, int64(c.config.MaxMessageChars)*4+4096)
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if mediaType == "application/json" {
+			c.postJSON(w, r)
+		} else {
+			c.postForm(w, r)
+		}
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (c *WebChannel) postJSON(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Content string `json:"content"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeWebJSON(w, http.StatusBadRequest, map[string]interface{}{"error": "invalid JSON: " + err.Error()})
+		return
+	}
+	s := c.session(w, r)
+	event, err := c.post(s, body.Content)
+	if err != nil {
+		writeWebJSON(w, http.StatusBadRequest, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	writeWebJSON(w, http.StatusAccepted, map[string]interface{}{"session_id": s.id, "id": event.ID})
+}
+
+// postForm takes a message from the page. The form carries the session
+// ID, which another site cannot know, so it cannot post in the visitor's
+// name.
+func (c *WebChannel) postForm(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s := c.session(w, r)
+	if r.PostForm.Get("session") != s.id {
+		http.Redirect(w, r, c.path, http.StatusSeeOther)
+		return
+	}
+	if _, err := c.post(s, r.PostForm.Get("content")); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	http.Redirect(w, r, c.path+"#end", http.StatusSeeOther)
+}
+
+// handleEvents streams the chat as server-sent events: "message" events
+// with an id, for the visitor's messages and the answers, and "progress"
+// events without. A reconnecting client gets the messages after its
+// Last-Event-ID.
+func (c *WebChannel) handleEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	s := c.session(w, r)
+	after, _ := strconv.Atoi(r.Header.Get("Last-Event-ID"))
+	if q := r.URL.Query().Get("after"); q != "" {
+		after, _ = strconv.Atoi(q)
+	}
+	ch, replay, progress := c.subscribe(s, after)
+	defer c.unsubscribe(s, ch)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	for _, e := range replay {
+		writeSSE(w, e)
+	}
+	if progress != "" {
+		writeSSE(w, webEvent{Type: "progress", Content: progress, Time: time.Now()})
+	}
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(webKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-c.ctx.Done():
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		case e, ok := <-ch:
+			if !ok {
+				return
+			}
+			writeSSE(w, e)
+		}
+		flusher.Flush()
+	}
+}
+
+func writeSSE(w http.ResponseWriter, e webEvent) {
+	data, _ := json.Marshal(e)
+	if e.ID > 0 {
+		fmt.Fprintf(w, "id: %d\n", e.ID)
+	}
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, data)
+}
+
+// handleWebSocket streams the chat's events as JSON over a WebSocket, from
+// the message after ?after, and takes the visitor's messages as
+// {"content": "..."}.
+func (c *WebChannel) handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	s := c.session(w, r)
+	conn, err := c.upgrader.Upgrade(w, r, w.Header())
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	conn.SetReadLimit(int64(c.config.MaxMessageChars)*4 + 4096)
+
+	after, _ := strconv.Atoi(r.URL.Query().Get("after"))
+	ch, replay, progress := c.subscribe(s, after)
+	defer c.unsubscribe(s, ch)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			var in struct {
+				Content string `json:"content"`
+			}
+			if err := conn.ReadJSON(&in); err != nil {
+				return
+			}
+			if _, err := c.post(s, in.Content); err != nil {
+				// The writer below owns the connection; errors go with the events
+				c.mu.Lock()
+				c.broadcast(s, webEvent{Type: "error", Content: err.Error(), Time: time.Now()})
+				c.mu.Unlock()
+			}
+		}
+	}()
+
+	for _, e := range replay {
+		if conn.WriteJSON(e) != nil {
+			return
+		}
+	}
+	if progress != "" {
+		conn.WriteJSON(webEvent{Type: "progress", Content: progress, Time: time.Now()})
+	}
+	for {
+		select {
+		case <-done:
+			return
+		case <-c.ctx.Done():
+			conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, ""))
+			return
+		case e, ok := <-ch:
+			if !ok || conn.WriteJSON(e) != nil {
+				return
+			}
+		}
+	}
+}
+
+func writeWebJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// handlePage shows the chat and a form to write in it. It works without
+// JavaScript: the form posts and comes back to the page, which reloads
+// itself every few seconds while an answer is pending.
+func (c *WebChannel) handlePage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	s := c.session(w, r)
+
+	c.mu.Lock()
+	data := webPageData{
+		Title:     c.config.Title,
+		Action:    c.path + "/messages",
+		Refresh:   c.path + "#end",
+		Session:   s.id,
+		Messages:  append([]webEvent(nil), s.events...),
+		Pending:   s.pending,
+		Progress:  s.progress,
+		MaxLength: c.config.MaxMessageChars,
+	}
+	c.mu.Unlock()
+	if data.Title == "" {
+		data.Title = "PicoClaw"
+	}
+	if n := len(data.Messages); n > 0 && !data.Pending && data.Messages[n-1].Role == "assistant" {
+		data.QuickReplies = data.Messages[n-1].QuickReplies
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; form-action 'self'; frame-ancestors "+c.frameAncestors())
+	if err := webPage.Execute(w, data); err != nil {
+		logger.WarnCF("web", "Failed to render chat page", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+}
+
+// frameAncestors lists who may embed the page: the chat's own host and the
+// configured sites.
+func (c *WebChannel) frameAncestors() string {
+	sources := []string{"'self'"}
+	for _, origin := range c.config.AllowOrigins {
+		if origin == "*" {
+			return "*"
+		}
+		sources = append(sources, strings.TrimRight(origin, "/"))
+	}
+	return strings.Join(sources, " ")
+}
+
+type webPageData struct {
+	Title        string
+	Action       string
+	Refresh      string
+	Session      string
+	Messages     []webEvent
+	Pending      bool
+	Progress     string
+	QuickReplies []string
+	MaxLength    int
+}
+
+var webPage = template.Must(template.New("web").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+{{if .Pending}}<meta http-equiv="refresh" content="3;url={{.Refresh}}">{{end}}
+<title>{{.Title}}</title>
+<style>
+body{margin:0;font:15px/1.5 -apple-system,"PingFang SC","Microsoft YaHei",sans-serif;background:#f5f6f8;color:#1f2328}
+main{max-width:720px;margin:0 auto;padding:12px}
+.msg{white-space:pre-wrap;word-wrap:break-word;padding:8px 12px;margin:8px 0;border-radius:10px;max-width:85%}
+.user{background:#d8ecff;margin-left:auto}
+.assistant{background:#fff;border:1px solid #e1e4e8}
+.progress{color:#656d76;font-style:italic}
+.replies form{display:inline}
+.replies button{margin:4px 4px 0 0;padding:4px 10px;border:1px solid #0969da;border-radius:14px;background:#fff;color:#0969da}
+#end{display:flex;gap:8px;margin-top:12px}
+#end textarea{flex:1;min-height:48px;padding:8px;font:inherit;border:1px solid #d0d7de;border-radius:8px}
+#end button{padding:0 16px;border:0;border-radius:8px;background:#0969da;color:#fff;font:inherit}
+</style>
+</head>
+<body>
+<main>
+{{range .Messages}}<div class="msg {{.Role}}">{{.Content}}</div>
+{{end}}{{if .Progress}}<div class="msg assistant progress">{{.Progress}}</div>
+{{else if .Pending}}<div class="msg assistant progress">…</div>
+{{end}}{{if .QuickReplies}}<div class="replies">{{range .QuickReplies}}<form method="post" action="{{$.Action}}"><input type="hidden" name="session" value="{{$.Session}}"><input type="hidden" name="content" value="{{.}}"><button>{{.}}</button></form>{{end}}</div>
+{{end}}<form id="end" method="post" action="{{.Action}}">
+<input type="hidden" name="session" value="{{.Session}}">
+<textarea name="content" maxlength="{{.MaxLength}}" required autofocus></textarea>
+<button>Send</button>
+</form>
+</main>
+</body>
+</html>
+`))
@@ -0,0 +1,266 @@
+package channels
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func newWebTestServer(t *testing.T) (*WebChannel, *bus.MessageBus, *httptest.Server, *http.Client) {
+	t.Helper()
+	msgBus := bus.NewMessageBus()
+	c, err := NewWebChannel(config.WebConfig{Path: "/chat", MaxMessageChars: 100}, msgBus)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(c.Handler())
+	t.Cleanup(server.Close)
+	jar, _ := cookiejar.New(nil)
+	return c, msgBus, server, &http.Client{Jar: jar}
+}
+
+func consumeInbound(t *testing.T, msgBus *bus.MessageBus) bus.InboundMessage {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	msg, ok := msgBus.ConsumeInbound(ctx)
+	if !ok {
+		t.Fatal("no inbound message")
+	}
+	return msg
+}
+
+func TestWebChannel_PostAndList(t *testing.T) {
+	c, msgBus, server, client := newWebTestServer(t)
+
+	resp, err := client.Post(server.URL+"/chat/messages", "application/json", strings.NewReader(`{"content":"What is CA19-9?"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("POST status = %d", resp.StatusCode)
+	}
+	in := consumeInbound(t, msgBus)
+	if in.Channel != "web" || in.Content != "What is CA19-9?" || in.ChatID == "" || in.ChatID != in.SenderID {
+		t.Fatalf("inbound = %+v", in)
+	}
+
+	c.UpdateProgress(context.Background(), in.ChatID, "Searching the knowledge base")
+	c.Send(context.Background(), bus.OutboundMessage{Channel: "web", ChatID: in.ChatID, Content: "CA19-9 is a tumour marker.", QuickReplies: []string{"Normal range?"}})
+
+	resp, err = client.Get(server.URL + "/chat/messages?after=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var list struct {
+		SessionID string     `json:"session_id"`
+		Pending   bool       `json:"pending"`
+		Messages  []webEvent `json:"messages"`
+	}
+	if err := decodeJSON(resp, &list); err != nil {
+		t.Fatal(err)
+	}
+	if list.SessionID != in.ChatID || list.Pending || len(list.Messages) != 1 || list.Messages[0].Role != "assistant" || list.Messages[0].QuickReplies[0] != "Normal range?" {
+		t.Errorf("list = %+v", list)
+	}
+
+	// Another visitor has a chat of their own
+	resp, _ = http.Get(server.URL + "/chat/messages")
+	if err := decodeJSON(resp, &list); err != nil || list.SessionID == in.ChatID || len(list.Messages) != 0 {
+		t.Errorf("new visitor's list = %+v, %v", list, err)
+	}
+
+	resp, _ = client.Post(server.URL+"/chat/messages", "application/json", strings.NewReader(`{"content":"`+strings.Repeat("x", 101)+`"}`))
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("long message status = %d", resp.StatusCode)
+	}
+}
+
+func TestWebChannel_Page(t *testing.T) {
+	c, msgBus, server, client := newWebTestServer(t)
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error { return http.ErrUseLastResponse }
+
+	resp, err := client.Get(server.URL + "/chat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	u, _ := url.Parse(server.URL + "/chat")
+	session := client.Jar.Cookies(u)[0].Value
+
+	// A form posted from another site does not know the session
+	resp, _ = client.PostForm(server.URL+"/chat/messages", url.Values{"content": {"hi"}, "session": {"guess"}})
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusSeeOther {
+		t.Errorf("forged post status = %d", resp.StatusCode)
+	}
+
+	resp, _ = client.PostForm(server.URL+"/chat/messages", url.Values{"content": {"<b>疼痛</b>怎么办"}, "session": {session}})
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusSeeOther || resp.Header.Get("Location") != "/chat#end" {
+		t.Errorf("post status = %d, location %q", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	in := consumeInbound(t, msgBus)
+	if in.Content != "<b>疼痛</b>怎么办" || in.ChatID != session {
+		t.Fatalf("inbound = %+v", in)
+	}
+
+	page := getBody(t, client, server.URL+"/chat")
+	if !strings.Contains(page, "&lt;b&gt;疼痛&lt;/b&gt;怎么办") || !strings.Contains(page, `http-equiv="refresh"`) {
+		t.Errorf("pending page:\n%s", page)
+	}
+
+	c.Send(context.Background(), bus.OutboundMessage{ChatID: session, Content: "请咨询您的医生。", QuickReplies: []string{"止痛药"}})
+	page = getBody(t, client, server.URL+"/chat")
+	if !strings.Contains(page, "请咨询您的医生。") || strings.Contains(page, `http-equiv="refresh"`) || !strings.Contains(page, `value="止痛药"`) {
+		t.Errorf("answered page:\n%s", page)
+	}
+}
+
+func TestWebChannel_EventStream(t *testing.T) {
+	c, msgBus, server, client := newWebTestServer(t)
+
+	client.Post(server.URL+"/chat/messages", "application/json", strings.NewReader(`{"content":"first"}`))
+	in := consumeInbound(t, msgBus)
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/chat/events", nil)
+	req.Header.Set("Last-Event-ID", "0")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Content-Type = %q", ct)
+	}
+	lines := make(chan string, 32)
+	go func() {
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+		close(lines)
+	}()
+
+	next := func(prefix string) string {
+		t.Helper()
+		for {
+			select {
+			case line, ok := <-lines:
+				if !ok {
+					t.Fatalf("stream ended waiting for %q", prefix)
+				}
+				if strings.HasPrefix(line, prefix) {
+					return line
+				}
+			case <-time.After(2 * time.Second):
+				t.Fatalf("timed out waiting for %q", prefix)
+			}
+		}
+	}
+
+	// The message posted before connecting is replayed
+	if line := next("data: "); !strings.Contains(line, `"content":"first"`) {
+		t.Errorf("replayed %s", line)
+	}
+	c.UpdateProgress(context.Background(), in.ChatID, "Searching")
+	if line := next("event: "); line != "event: progress" {
+		t.Errorf("got %s", line)
+	}
+	c.Send(context.Background(), bus.OutboundMessage{ChatID: in.ChatID, Content: "answer"})
+	if line := next("id: "); line != "id: 2" {
+		t.Errorf("got %s", line)
+	}
+	if line := next("data: "); !strings.Contains(line, `"role":"assistant","content":"answer"`) {
+		t.Errorf("got %s", line)
+	}
+}
+
+func TestWebChannel_WebSocket(t *testing.T) {
+	c, msgBus, server, _ := newWebTestServer(t)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/chat/ws", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+
+	if err := conn.WriteJSON(map[string]string{"content": "hello"}); err != nil {
+		t.Fatal(err)
+	}
+	in := consumeInbound(t, msgBus)
+	var e webEvent
+	if err := conn.ReadJSON(&e); err != nil || e.Role != "user" || e.Content != "hello" {
+		t.Fatalf("echo = %+v, %v", e, err)
+	}
+	c.Send(context.Background(), bus.OutboundMessage{ChatID: in.ChatID, Content: "hi there"})
+	if err := conn.ReadJSON(&e); err != nil || e.Role != "assistant" || e.Content != "hi there" {
+		t.Errorf("answer = %+v, %v", e, err)
+	}
+
+	conn.WriteJSON(map[string]string{"content": ""})
+	if err := conn.ReadJSON(&e); err != nil || e.Type != "error" {
+		t.Errorf("empty message = %+v, %v", e, err)
+	}
+}
+
+func TestWebChannel_CORS(t *testing.T) {
+	msgBus := bus.NewMessageBus()
+	c, _ := NewWebChannel(config.WebConfig{AllowOrigins: config.FlexibleStringSlice{"https://clinic.example.com/"}}, msgBus)
+	handler := c.Handler()
+
+	for _, tt := range []struct {
+		origin string
+		want   string
+	}{
+		{"https://clinic.example.com", "https://clinic.example.com"},
+		{"https://evil.example.com", ""},
+	} {
+		req := httptest.NewRequest(http.MethodOptions, "/chat/messages", nil)
+		req.Header.Set("Origin", tt.origin)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if got := rec.Header().Get("Access-Control-Allow-Origin"); got != tt.want {
+			t.Errorf("origin %s: Access-Control-Allow-Origin = %q, want %q", tt.origin, got, tt.want)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/chat", nil))
+	if csp := rec.Header().Get("Content-Security-Policy"); !strings.Contains(csp, "frame-ancestors 'self' https://clinic.example.com") {
+		t.Errorf("Content-Security-Policy = %q", csp)
+	}
+}
+
+func decodeJSON(resp *http.Response, v interface{}) error {
+	defer resp.Body.Close()
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func getBody(t *testing.T, client *http.Client, url string) string {
+	t.Helper()
+	resp, err := client.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var sb strings.Builder
+	io.Copy(&sb, resp.Body)
+	return sb.String()
+}
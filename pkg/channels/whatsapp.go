@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"strings"
 	"sync"
 	"time"
 
@@ -177,6 +178,14 @@ func (c *WhatsAppChannel) handleIncomingMessage(msg map[string]interface{}) {
 	if userName, ok := msg["from_name"].(string); ok {
 		metadata["user_name"] = userName
 	}
+	// Group chat IDs end in @g.us; the bridge sets "mentioned" on group
+	// messages that @-mention the bot or reply to it
+	if strings.HasSuffix(chatID, "@g.us") {
+		mentioned, _ := msg["mentioned"].(bool)
+		metadata["peer_kind"] = "group"
+		metadata["peer_id"] = chatID
+		metadata["mentioned"] = fmt.Sprintf("%t", mentioned)
+	}
 
 	log.Printf("WhatsApp message from %s: %s...", senderID, utils.Truncate(content, 50))
 
@@ -0,0 +1,718 @@
+package channels
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/ocr"
+	"github.com/sipeed/picoclaw/pkg/utils"
+	"github.com/sipeed/picoclaw/pkg/voice"
+)
+
+const (
+	whatsAppAPIBase = "https://graph.facebook.com/v21.0"
+	// whatsAppWindow is how long after a user's message WhatsApp accepts
+	// free-form messages to them.
+	whatsAppWindow = 24 * time.Hour
+	// Interactive messages hold at most three reply buttons, with titles of
+	// at most 20 characters, under a body of at most 1024.
+	whatsAppMaxButtons     = 3
+	whatsAppMaxButtonTitle = 20
+	whatsAppMaxButtonBody  = 1024
+	// whatsAppMaxTemplateParam is kept under the 1024 characters WhatsApp
+	// allows a template body, leaving room for the template's own text.
+	whatsAppMaxTemplateParam = 900
+)
+
+// whatsAppParamSpace matches what WhatsApp rejects in template parameters:
+// new lines, tabs, and more than four spaces in a row.
+var whatsAppParamSpace = regexp.MustCompile(`[\n\t]+| {5,}`)
+
+// WhatsAppCloudChannel talks to WhatsApp through the Business Cloud API:
+// Meta posts the users' messages to a webhook, and answers are sent with
+// the Graph API, as free-form messages within 24 hours of the user's last
+// message and as the configured template after that.
+type WhatsAppCloudChannel struct {
+	*BaseChannel
+	config      config.WhatsAppConfig
+	apiBase     string
+	client      *http.Client
+	httpServer  *http.Server
+	transcriber *voice.GroqTranscriber
+	recognizer  ocr.Recognizer
+	lastInbound sync.Map // chatID -> time.Time of the user's last message
+	ctx         context.Context
+	cancel      context.CancelFunc
+}
+
+// NewWhatsAppCloudChannel creates a WhatsApp channel on the Cloud API.
+func NewWhatsAppCloudChannel(cfg config.WhatsAppConfig, messageBus *bus.MessageBus) (*WhatsAppCloudChannel, error) {
+	if cfg.AccessToken == "" || cfg.PhoneNumberID == "" || cfg.AppSecret == "" || cfg.VerifyToken == "" {
+		return nil, fmt.Errorf("whatsapp access_token, phone_number_id, app_secret and verify_token are required")
+	}
+	apiBase := strings.TrimSuffix(cfg.APIBase, "/")
+	if apiBase == "" {
+		apiBase = whatsAppAPIBase
+	}
+	return &WhatsAppCloudChannel{
+		BaseChannel: NewBaseChannel("whatsapp", cfg, messageBus, cfg.AllowFrom),
+		config:      cfg,
+		apiBase:     apiBase,
+		client:      &http.Client{Timeout: 30 * time.Second},
+		ctx:         context.Background(),
+	}, nil
+}
+
+func (c *WhatsAppCloudChannel) SetTranscriber(transcriber *voice.GroqTranscriber) {
+	c.transcriber = transcriber
+}
+
+func (c *WhatsAppCloudChannel) SetOCR(recognizer ocr.Recognizer) {
+	c.recognizer = recognizer
+}
+
+// Start launches the webhook server.
+func (c *WhatsAppCloudChannel) Start(ctx context.Context) error {
+	c.ctx, c.cancel = context.WithCancel(ctx)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(c.webhookPath(), c.webhookHandler)
+	addr := fmt.Sprintf("%s:%d", c.config.WebhookHost, c.config.WebhookPort)
+	c.httpServer = &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		logger.InfoCF("whatsapp", "WhatsApp webhook server listening", map[string]interface{}{
+			"addr": addr,
+			"path": c.webhookPath(),
+		})
+		if err := c.httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logger.ErrorCF("whatsapp", "Webhook server error", map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+	}()
+
+	c.setRunning(true)
+	logger.InfoC("whatsapp", "WhatsApp channel started (Cloud API)")
+	return nil
+}
+
+// Stop shuts down the webhook server.
+func (c *WhatsAppCloudChannel) Stop(ctx context.Context) error {
+	if c.cancel != nil {
+		c.cancel()
+	}
+	if c.httpServer != nil {
+		shutdownCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+		if err := c.httpServer.Shutdown(shutdownCtx); err != nil {
+			logger.ErrorCF("whatsapp", "Webhook server shutdown error", map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+	}
+	c.setRunning(false)
+	logger.InfoC("whatsapp", "WhatsApp channel stopped")
+	return nil
+}
+
+func (c *WhatsAppCloudChannel) webhookPath() string {
+	if c.config.WebhookPath == "" {
+		return "/webhook/whatsapp"
+	}
+	return c.config.WebhookPath
+}
+
+// webhookHandler answers Meta's verification request and receives the
+// signed notifications of messages and delivery statuses.
+func (c *WhatsAppCloudChannel) webhookHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		q := r.URL.Query()
+		if q.Get("hub.mode") != "subscribe" ||
+			!hmac.Equal([]byte(q.Get("hub.verify_token")), []byte(c.config.VerifyToken)) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		io.WriteString(w, q.Get("hub.challenge"))
+		return
+	case http.MethodPost:
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, 4<<20))
+	if err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+	if !c.verifySignature(body, r.Header.Get("X-Hub-Signature-256")) {
+		logger.WarnC("whatsapp", "Invalid webhook signature")
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	var payload whatsAppWebhook
+	if err := json.Unmarshal(body, &payload); err != nil {
+		logger.ErrorCF("whatsapp", "Failed to parse webhook payload", map[string]interface{}{
+			"error": err.Error(),
+		})
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	// Meta retries notifications that are not acknowledged quickly
+	w.WriteHeader(http.StatusOK)
+
+	for _, entry := range payload.Entry {
+		for _, change := range entry.Changes {
+			value := change.Value
+			if change.Field != "messages" || value.Metadata.PhoneNumberID != c.config.PhoneNumberID {
+				continue
+			}
+			names := make(map[string]string, len(value.Contacts))
+			for _, contact := range value.Contacts {
+				names[contact.WaID] = contact.Profile.Name
+			}
+			for _, msg := range value.Messages {
+				go c.processMessage(msg, names[msg.From])
+			}
+			for _, status := range value.Statuses {
+				c.logStatus(status)
+			}
+		}
+	}
+}
+
+// verifySignature checks the X-Hub-Signature-256 header, an HMAC-SHA256
+// of the body keyed with the app secret.
+func (c *WhatsAppCloudChannel) verifySignature(body []byte, signature string) bool {
+	sig, ok := strings.CutPrefix(signature, "sha256=")
+	if !ok {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(c.config.AppSecret))
+	mac.Write(body)
+	expected := hex.EncodeToString(mac.Sum(nil))
+	return hmac.Equal([]byte(expected), []byte(strings.ToLower(sig)))
+}
+
+// WhatsApp webhook payload
+type whatsAppWebhook struct {
+	Entry []struct {
+		Changes []struct {
+			Field string `json:"field"`
+			Value struct {
+				Metadata struct {
+					PhoneNumberID string `json:"phone_number_id"`
+				} `json:"metadata"`
+				Contacts []struct {
+					WaID    string `json:"wa_id"`
+					Profile struct {
+						Name string `json:"name"`
+					} `json:"profile"`
+				} `json:"contacts"`
+				Messages []whatsAppMessage `json:"messages"`
+				Statuses []whatsAppStatus  `json:"statuses"`
+			} `json:"value"`
+		} `json:"changes"`
+	} `json:"entry"`
+}
+
+type whatsAppMessage struct {
+	From string `json:"from"`
+	ID   string `json:"id"`
+	Type string `json:"type"` // "text", "image", "audio", "video", "document", "sticker", "location", "interactive", "button", "reaction"
+	Text struct {
+		Body string `json:"body"`
+	} `json:"text"`
+	Image    *whatsAppMedia `json:"image"`
+	Audio    *whatsAppMedia `json:"audio"`
+	Video    *whatsAppMedia `json:"video"`
+	Document *whatsAppMedia `json:"document"`
+	Location *struct {
+		Latitude  float64 `json:"latitude"`
+		Longitude float64 `json:"longitude"`
+		Name      string  `json:"name"`
+		Address   string  `json:"address"`
+	} `json:"location"`
+	Interactive *struct {
+		Type        string `json:"type"`
+		ButtonReply struct {
+			Title string `json:"title"`
+		} `json:"button_reply"`
+		ListReply struct {
+			Title string `json:"title"`
+		} `json:"list_reply"`
+	} `json:"interactive"`
+	Button *struct {
+		Text string `json:"text"`
+	} `json:"button"`
+}
+
+type whatsAppMedia struct {
+	ID       string `json:"id"`
+	MimeType string `json:"mime_type"`
+	Caption  string `json:"caption"`
+	Filename string `json:"filename"`
+	Voice    bool   `json:"voice"`
+}
+
+type whatsAppStatus struct {
+	ID          string `json:"id"`
+	Status      string `json:"status"` // "sent", "delivered", "read", "failed"
+	RecipientID string `json:"recipient_id"`
+	Errors      []struct {
+		Code  int    `json:"code"`
+		Title string `json:"title"`
+	} `json:"errors"`
+}
+
+// logStatus logs messages WhatsApp failed to deliver, such as free-form
+// messages sent outside the 24-hour window; delivery itself is not logged.
+func (c *WhatsAppCloudChannel) logStatus(status whatsAppStatus) {
+	if status.Status != "failed" {
+		return
+	}
+	fields := map[string]interface{}{
+		"message_id": status.ID,
+		"chat_id":    status.RecipientID,
+	}
+	if len(status.Errors) > 0 {
+		fields["code"] = status.Errors[0].Code
+		fields["error"] = status.Errors[0].Title
+	}
+	logger.WarnCF("whatsapp", "Message delivery failed", fields)
+}
+
+func (c *WhatsAppCloudChannel) processMessage(msg whatsAppMessage, name string) {
+	if msg.Type == "reaction" || msg.From == "" {
+		return
+	}
+	c.lastInbound.Store(msg.From, time.Now())
+
+	var localFiles []string
+	defer func() {
+		for _, file := range localFiles {
+			if err := os.Remove(file); err != nil {
+				logger.DebugCF("whatsapp", "Failed to cleanup temp file", map[string]interface{}{
+					"file":  file,
+					"error": err.Error(),
+				})
+			}
+		}
+	}()
+
+	var parts, mediaPaths []string
+	addMedia := func(media *whatsAppMedia, filename string) string {
+		path := c.downloadMedia(media.ID, filename)
+		if path != "" {
+			localFiles = append(localFiles, path)
+			mediaPaths = append(mediaPaths, path)
+		}
+		if media.Caption != "" {
+			parts = append(parts, media.Caption)
+		}
+		return path
+	}
+
+	switch msg.Type {
+	case "text":
+		parts = append(parts, msg.Text.Body)
+	case "image":
+		if path := addMedia(msg.Image, "image"+mediaExtension(msg.Image.MimeType)); path != "" {
+			parts = append(parts, imageText(c.ctx, c.recognizer, "whatsapp", path, "[image]"))
+		} else {
+			parts = append(parts, "[image]")
+		}
+	case "audio":
+		path := addMedia(msg.Audio, "audio"+mediaExtension(msg.Audio.MimeType))
+		parts = append(parts, c.audioText(path, msg.Audio.Voice))
+	case "video":
+		addMedia(msg.Video, "video"+mediaExtension(msg.Video.MimeType))
+		parts = append(parts, "[video]")
+	case "document":
+		filename := msg.Document.Filename
+		if filename == "" {
+			filename = "document" + mediaExtension(msg.Document.MimeType)
+		}
+		addMedia(msg.Document, filename)
+		parts = append(parts, fmt.Sprintf("[file: %s]", filename))
+	case "location":
+		if l := msg.Location; l != nil {
+			place := strings.TrimSpace(l.Name + " " + l.Address)
+			parts = append(parts, strings.TrimSpace(fmt.Sprintf("[location: %s (%.6f, %.6f)]", place, l.Latitude, l.Longitude)))
+		}
+	case "interactive":
+		if i := msg.Interactive; i != nil {
+			if i.Type == "list_reply" {
+				parts = append(parts, i.ListReply.Title)
+			} else {
+				parts = append(parts, i.ButtonReply.Title)
+			}
+		}
+	case "button":
+		if msg.Button != nil {
+			parts = append(parts, msg.Button.Text)
+		}
+	default:
+		parts = append(parts, fmt.Sprintf("[%s]", msg.Type))
+	}
+
+	content := strings.TrimSpace(strings.Join(parts, "\n"))
+	if content == "" {
+		return
+	}
+
+	logger.DebugCF("whatsapp", "Received message", map[string]interface{}{
+		"sender_id":    msg.From,
+		"message_type": msg.Type,
+		"preview":      utils.Truncate(content, 50),
+	})
+
+	c.markRead(msg.ID)
+
+	metadata := map[string]string{
+		"platform":   "whatsapp",
+		"message_id": msg.ID,
+		"peer_kind":  "direct",
+		"peer_id":    msg.From,
+	}
+	if name != "" {
+		metadata["user_name"] = name
+	}
+	c.HandleMessage(msg.From, msg.From, content, mediaPaths, metadata)
+}
+
+// audioText transcribes a downloaded voice note or audio file.
+func (c *WhatsAppCloudChannel) audioText(path string, isVoice bool) string {
+	label := "[audio]"
+	if isVoice {
+		label = "[voice]"
+	}
+	if path == "" || c.transcriber == nil || !c.transcriber.IsAvailable() {
+		return label
+	}
+	ctx, cancel := context.WithTimeout(c.ctx, 30*time.Second)
+	defer cancel()
+	result, err := c.transcriber.Transcribe(ctx, path)
+	if err != nil {
+		logger.ErrorCF("whatsapp", "Voice transcription failed", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return strings.TrimSuffix(label, "]") + " (transcription failed)]"
+	}
+	return fmt.Sprintf("[voice transcription: %s]", result.Text)
+}
+
+// mediaExtension returns the file extension for a WhatsApp media type.
+func mediaExtension(mimeType string) string {
+	mimeType, _, _ = strings.Cut(mimeType, ";")
+	switch strings.TrimSpace(mimeType) {
+	case "image/jpeg":
+		return ".jpg"
+	case "image/png":
+		return ".png"
+	case "image/webp":
+		return ".webp"
+	case "audio/ogg":
+		return ".ogg"
+	case "audio/mpeg":
+		return ".mp3"
+	case "audio/mp4", "audio/aac":
+		return ".m4a"
+	case "video/mp4":
+		return ".mp4"
+	case "application/pdf":
+		return ".pdf"
+	}
+	return ""
+}
+
+// downloadMedia looks up the URL of a media ID and downloads it; both
+// requests need the access token. It returns "" when either fails.
+func (c *WhatsAppCloudChannel) downloadMedia(mediaID, filename string) string {
+	if mediaID == "" {
+		return ""
+	}
+	var media struct {
+		URL string `json:"url"`
+	}
+	if err := c.callAPI(c.ctx, http.MethodGet, "/"+mediaID, nil, &media); err != nil || media.URL == "" {
+		logger.WarnCF("whatsapp", "Failed to look up media", map[string]interface{}{
+			"media_id": mediaID,
+			"error":    fmt.Sprint(err),
+		})
+		return ""
+	}
+	return utils.DownloadFile(media.URL, filename, utils.DownloadOptions{
+		LoggerPrefix: "whatsapp",
+		ExtraHeaders: map[string]string{"Authorization": "Bearer " + c.config.AccessToken},
+	})
+}
+
+// markRead shows the user's message as read, which is also the only
+// sign WhatsApp gives that an answer is on its way.
+func (c *WhatsAppCloudChannel) markRead(messageID string) {
+	payload := map[string]interface{}{
+		"messaging_product": "whatsapp",
+		"status":            "read",
+		"message_id":        messageID,
+	}
+	if err := c.callAPI(c.ctx, http.MethodPost, "/"+c.config.PhoneNumberID+"/messages", payload, nil); err != nil {
+		logger.DebugCF("whatsapp", "Failed to mark message read", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+}
+
+// Send sends msg as a free-form message while the chat's 24-hour window
+// is open, with its quick replies as reply buttons when they fit. After
+// the window closes, or before the user has written since a restart, it
+// is sent as the configured template; without one it is sent free-form
+// and WhatsApp may refuse it.
+func (c *WhatsAppCloudChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
+	if !c.IsRunning() {
+		return fmt.Errorf("whatsapp channel not running")
+	}
+	if !c.windowOpen(msg.ChatID) && c.config.Template != "" {
+		if len(msg.QuickReplies) > 0 {
+			msg = quickRepliesAsText(msg)
+		}
+		return c.sendMessage(ctx, msg.ChatID, "template", c.templateMessage(msg.Content))
+	}
+
+	if n := len(msg.QuickReplies); n > 0 {
+		if n > whatsAppMaxButtons || len([]rune(msg.Content)) > whatsAppMaxButtonBody {
+			msg = quickRepliesAsText(msg)
+		} else {
+			return c.sendMessage(ctx, msg.ChatID, "interactive", buttonMessage(msg.Content, msg.QuickReplies))
+		}
+	}
+	return c.sendMessage(ctx, msg.ChatID, "text", map[string]interface{}{
+		"preview_url": false,
+		"body":        msg.Content,
+	})
+}
+
+// SendMedia uploads a file to WhatsApp and sends it as an image, audio,
+// video or document message. Media can only be sent within 24 hours of
+// the user's last message; after that the file is listed in the
+// template message instead.
+func (c *WhatsAppCloudChannel) SendMedia(ctx context.Context, chatID string, file bus.Attachment) error {
+	if !c.IsRunning() {
+		return fmt.Errorf("whatsapp channel not running")
+	}
+	if !c.windowOpen(chatID) {
+		return fmt.Errorf("outside the 24-hour window")
+	}
+	mimeType := file.MimeType
+	if mimeType == "" {
+		mimeType = utils.DetectMediaType(file.Path)
+	}
+	id, err := c.uploadMedia(ctx, file.Path, mimeType)
+	if err != nil {
+		return err
+	}
+
+	kind := whatsAppMediaKind(mimeType)
+	media := map[string]interface{}{"id": id}
+	if caption := mediaCaption(file); caption != "" && kind != "audio" {
+		media["caption"] = caption
+	}
+	if kind == "document" {
+		media["filename"] = filepath.Base(file.Path)
+	}
+	return c.sendMessage(ctx, chatID, kind, media)
+}
+
+// whatsAppMediaKind is the message type WhatsApp plays or shows a file
+// of mimeType as; other files are sent as documents.
+func whatsAppMediaKind(mimeType string) string {
+	switch mimeType {
+	case "image/jpeg", "image/png":
+		return "image"
+	case "audio/aac", "audio/amr", "audio/mpeg", "audio/mp4", "audio/ogg":
+		return "audio"
+	case "video/mp4", "video/3gpp":
+		return "video"
+	}
+	return "document"
+}
+
+// uploadMedia uploads a file to the phone number's media and returns its
+// media ID.
+func (c *WhatsAppCloudChannel) uploadMedia(ctx context.Context, path, mimeType string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	form.WriteField("messaging_product", "whatsapp")
+	form.WriteField("type", mimeType)
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="file"; filename="%s"`, filepath.Base(path)))
+	header.Set("Content-Type", mimeType)
+	part, err := form.CreatePart(header)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(part, f); err != nil {
+		return "", err
+	}
+	if err := form.Close(); err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.apiBase+"/"+c.config.PhoneNumberID+"/media", &body)
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	var uploaded struct {
+		ID string `json:"id"`
+	}
+	if err := c.do(req, &uploaded); err != nil {
+		return "", err
+	}
+	if uploaded.ID == "" {
+		return "", fmt.Errorf("WhatsApp returned no media ID")
+	}
+	return uploaded.ID, nil
+}
+
+// SupportsQuickReplies reports that quick replies are shown as reply
+// buttons, or listed in the message when there are too many for buttons.
+func (c *WhatsAppCloudChannel) SupportsQuickReplies() bool {
+	return true
+}
+
+// MaxMessageLength is WhatsApp's text message length limit.
+func (c *WhatsAppCloudChannel) MaxMessageLength() int {
+	return 4096
+}
+
+func (c *WhatsAppCloudChannel) windowOpen(chatID string) bool {
+	last, ok := c.lastInbound.Load(chatID)
+	return ok && time.Since(last.(time.Time)) < whatsAppWindow
+}
+
+// templateMessage fills the template's body parameter with content,
+// flattened to the single line WhatsApp accepts.
+func (c *WhatsAppCloudChannel) templateMessage(content string) map[string]interface{} {
+	param := strings.TrimSpace(whatsAppParamSpace.ReplaceAllString(content, " "))
+	if runes := []rune(param); len(runes) > whatsAppMaxTemplateParam {
+		param = string(runes[:whatsAppMaxTemplateParam-1]) + "…"
+	}
+	language := c.config.TemplateLanguage
+	if language == "" {
+		language = "en"
+	}
+	return map[string]interface{}{
+		"name":     c.config.Template,
+		"language": map[string]string{"code": language},
+		"components": []map[string]interface{}{{
+			"type":       "body",
+			"parameters": []map[string]string{{"type": "text", "text": param}},
+		}},
+	}
+}
+
+func buttonMessage(content string, replies []string) map[string]interface{} {
+	buttons := make([]map[string]interface{}, len(replies))
+	for i, reply := range replies {
+		title := []rune(reply)
+		if len(title) > whatsAppMaxButtonTitle {
+			title = append(title[:whatsAppMaxButtonTitle-1], '…')
+		}
+		buttons[i] = map[string]interface{}{
+			"type":  "reply",
+			"reply": map[string]string{"id": fmt.Sprintf("qr%d", i+1), "title": string(title)},
+		}
+	}
+	return map[string]interface{}{
+		"type":   "button",
+		"body":   map[string]string{"text": content},
+		"action": map[string]interface{}{"buttons": buttons},
+	}
+}
+
+func (c *WhatsAppCloudChannel) sendMessage(ctx context.Context, to, kind string, body interface{}) error {
+	payload := map[string]interface{}{
+		"messaging_product": "whatsapp",
+		"recipient_type":    "individual",
+		"to":                to,
+		"type":              kind,
+		kind:                body,
+	}
+	return c.callAPI(ctx, http.MethodPost, "/"+c.config.PhoneNumberID+"/messages", payload, nil)
+}
+
+// callAPI makes an authenticated request to the Graph API and decodes the
+// response into out, if given.
+func (c *WhatsAppCloudChannel) callAPI(ctx context.Context, method, path string, payload, out interface{}) error {
+	var reqBody io.Reader
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return fmt.Errorf("failed to marshal payload: %w", err)
+		}
+		reqBody = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.apiBase+path, reqBody)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return c.do(req, out)
+}
+
+// do sends an API request with the access token and decodes the
+// response into out, if given.
+func (c *WhatsAppCloudChannel) do(req *http.Request, out interface{}) error {
+	req.Header.Set("Authorization", "Bearer "+c.config.AccessToken)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("API request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("WhatsApp API error (status %d): %s", resp.StatusCode, string(respBody))
+	}
+	if out != nil {
+		return json.NewDecoder(resp.Body).Decode(out)
+	}
+	return nil
+}
@@ -0,0 +1,273 @@
+package channels
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+// fakeGraphAPI records the messages sent to it and serves one image.
+type fakeGraphAPI struct {
+	mu       sync.Mutex
+	sent     []map[string]interface{}
+	uploaded []string
+}
+
+func (f *fakeGraphAPI) messages() []map[string]interface{} {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]map[string]interface{}(nil), f.sent...)
+}
+
+func newWhatsAppCloudTest(t *testing.T, template string) (*WhatsAppCloudChannel, *fakeGraphAPI, *bus.MessageBus) {
+	t.Helper()
+	api := &fakeGraphAPI{}
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer wa-token" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/104857600/messages":
+			var payload map[string]interface{}
+			json.NewDecoder(r.Body).Decode(&payload)
+			api.mu.Lock()
+			api.sent = append(api.sent, payload)
+			api.mu.Unlock()
+			w.Write([]byte(`{"messages": [{"id": "wamid.out"}]}`))
+		case "/104857600/media":
+			file, header, err := r.FormFile("file")
+			if err != nil || r.FormValue("messaging_product") != "whatsapp" {
+				http.Error(w, "bad upload", http.StatusBadRequest)
+				return
+			}
+			file.Close()
+			api.mu.Lock()
+			api.uploaded = append(api.uploaded, header.Filename+" "+r.FormValue("type"))
+			api.mu.Unlock()
+			w.Write([]byte(`{"id": "media-up-1"}`))
+		case "/media-1":
+			json.NewEncoder(w).Encode(map[string]string{"url": server.URL + "/download/media-1", "mime_type": "image/jpeg"})
+		case "/download/media-1":
+			w.Write([]byte{0xff, 0xd8, 0xff, 0xe0})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	msgBus := bus.NewMessageBus()
+	ch, err := NewWhatsAppCloudChannel(config.WhatsAppConfig{
+		AccessToken:   "wa-token",
+		PhoneNumberID: "104857600",
+		AppSecret:     "app-secret",
+		VerifyToken:   "verify-me",
+		APIBase:       server.URL,
+		Template:      template,
+	}, msgBus)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch.setRunning(true)
+	return ch, api, msgBus
+}
+
+func postWhatsAppWebhook(ch *WhatsAppCloudChannel, body, secret string) *httptest.ResponseRecorder {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(body))
+	req := httptest.NewRequest(http.MethodPost, "/webhook/whatsapp", strings.NewReader(body))
+	req.Header.Set("X-Hub-Signature-256", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	rec := httptest.NewRecorder()
+	ch.webhookHandler(rec, req)
+	return rec
+}
+
+func whatsAppNotification(message string) string {
+	return `{"object": "whatsapp_business_account", "entry": [{"changes": [{"field": "messages", "value": {
+		"metadata": {"phone_number_id": "104857600"},
+		"contacts": [{"wa_id": "6591234567", "profile": {"name": "Siti"}}],
+		"messages": [` + message + `]}}]}]}`
+}
+
+func TestWhatsAppCloud_Verify(t *testing.T) {
+	ch, _, _ := newWhatsAppCloudTest(t, "")
+
+	tests := []struct {
+		query  string
+		status int
+		body   string
+	}{
+		{"hub.mode=subscribe&hub.verify_token=verify-me&hub.challenge=1158201444", http.StatusOK, "1158201444"},
+		{"hub.mode=subscribe&hub.verify_token=wrong&hub.challenge=1158201444", http.StatusForbidden, ""},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		ch.webhookHandler(rec, httptest.NewRequest(http.MethodGet, "/webhook/whatsapp?"+tt.query, nil))
+		if rec.Code != tt.status || (tt.body != "" && rec.Body.String() != tt.body) {
+			t.Errorf("%s: status %d, body %q", tt.query, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+func TestWhatsAppCloud_Receive(t *testing.T) {
+	ch, api, msgBus := newWhatsAppCloudTest(t, "")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	text := whatsAppNotification(`{"from": "6591234567", "id": "wamid.1", "type": "text", "text": {"body": "Can I eat durian after chemo?"}}`)
+	if rec := postWhatsAppWebhook(ch, text, "wrong-secret"); rec.Code != http.StatusForbidden {
+		t.Fatalf("unsigned notification: status %d", rec.Code)
+	}
+	if rec := postWhatsAppWebhook(ch, text, "app-secret"); rec.Code != http.StatusOK {
+		t.Fatalf("status %d", rec.Code)
+	}
+	msg, ok := msgBus.ConsumeInbound(ctx)
+	if !ok {
+		t.Fatal("no inbound message")
+	}
+	if msg.Channel != "whatsapp" || msg.ChatID != "6591234567" || msg.Content != "Can I eat durian after chemo?" {
+		t.Errorf("inbound = %+v", msg)
+	}
+	if msg.Metadata["user_name"] != "Siti" || msg.Metadata["message_id"] != "wamid.1" {
+		t.Errorf("metadata = %v", msg.Metadata)
+	}
+	if sent := api.messages(); len(sent) != 1 || sent[0]["status"] != "read" || sent[0]["message_id"] != "wamid.1" {
+		t.Errorf("read receipt = %v", sent)
+	}
+
+	image := whatsAppNotification(`{"from": "6591234567", "id": "wamid.2", "type": "image", "image": {"id": "media-1", "mime_type": "image/jpeg", "caption": "My CT report"}}`)
+	postWhatsAppWebhook(ch, image, "app-secret")
+	msg, ok = msgBus.ConsumeInbound(ctx)
+	if !ok {
+		t.Fatal("no inbound image message")
+	}
+	if msg.Content != "My CT report\n[image]" || len(msg.Media) != 1 {
+		t.Errorf("image message = %q with media %v", msg.Content, msg.Media)
+	}
+
+	button := whatsAppNotification(`{"from": "6591234567", "id": "wamid.3", "type": "interactive", "interactive": {"type": "button_reply", "button_reply": {"id": "qr1", "title": "Yes, taken"}}}`)
+	postWhatsAppWebhook(ch, button, "app-secret")
+	if msg, _ = msgBus.ConsumeInbound(ctx); msg.Content != "Yes, taken" {
+		t.Errorf("button reply = %q", msg.Content)
+	}
+}
+
+func TestWhatsAppCloud_Send(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		inWindow bool
+		msg      bus.OutboundMessage
+		wantType string
+		check    func(t *testing.T, body map[string]interface{})
+	}{
+		{
+			name: "session text", inWindow: true,
+			msg:      bus.OutboundMessage{Content: "Yes, in small amounts."},
+			wantType: "text",
+			check: func(t *testing.T, body map[string]interface{}) {
+				if body["body"] != "Yes, in small amounts." {
+					t.Errorf("text = %v", body)
+				}
+			},
+		},
+		{
+			name: "quick replies as buttons", inWindow: true,
+			msg:      bus.OutboundMessage{Content: "Did you take Creon with lunch?", QuickReplies: []string{"Yes", "Not yet, remind me later"}},
+			wantType: "interactive",
+			check: func(t *testing.T, body map[string]interface{}) {
+				buttons := body["action"].(map[string]interface{})["buttons"].([]interface{})
+				title := buttons[1].(map[string]interface{})["reply"].(map[string]interface{})["title"].(string)
+				if len(buttons) != 2 || len([]rune(title)) != whatsAppMaxButtonTitle {
+					t.Errorf("buttons = %v", buttons)
+				}
+			},
+		},
+		{
+			name: "too many quick replies", inWindow: true,
+			msg:      bus.OutboundMessage{Content: "How is your appetite?", QuickReplies: []string{"Good", "Fair", "Poor", "None"}},
+			wantType: "text",
+			check: func(t *testing.T, body map[string]interface{}) {
+				if !strings.Contains(body["body"].(string), "4. None") {
+					t.Errorf("text = %v", body)
+				}
+			},
+		},
+		{
+			name: "template after the window", template: "care_followup",
+			msg:      bus.OutboundMessage{Content: "Time for your Creon.\n\nTake it with food."},
+			wantType: "template",
+			check: func(t *testing.T, body map[string]interface{}) {
+				data, _ := json.Marshal(body)
+				if body["name"] != "care_followup" || !strings.Contains(string(data), `"text":"Time for your Creon. Take it with food."`) {
+					t.Errorf("template = %s", data)
+				}
+			},
+		},
+		{
+			name:     "no template after the window",
+			msg:      bus.OutboundMessage{Content: "Time for your Creon."},
+			wantType: "text",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ch, api, _ := newWhatsAppCloudTest(t, tt.template)
+			if tt.inWindow {
+				ch.lastInbound.Store("6591234567", time.Now())
+			}
+			tt.msg.ChatID = "6591234567"
+			if err := ch.Send(context.Background(), tt.msg); err != nil {
+				t.Fatalf("Send: %v", err)
+			}
+			sent := api.messages()
+			if len(sent) != 1 || sent[0]["type"] != tt.wantType || sent[0]["to"] != "6591234567" {
+				t.Fatalf("sent = %v", sent)
+			}
+			if tt.check != nil {
+				tt.check(t, sent[0][tt.wantType].(map[string]interface{}))
+			}
+		})
+	}
+}
+
+func TestWhatsAppCloud_SendMedia(t *testing.T) {
+	ch, api, _ := newWhatsAppCloudTest(t, "care_followup")
+	path := filepath.Join(t.TempDir(), "ca199.png")
+	os.WriteFile(path, []byte("\x89PNG\r\n\x1a\n"), 0600)
+	file := bus.Attachment{Name: "CA19-9 trend", Path: path}
+
+	if err := ch.SendMedia(context.Background(), "6591234567", file); err == nil {
+		t.Error("media sent outside the 24-hour window")
+	}
+
+	ch.lastInbound.Store("6591234567", time.Now())
+	if err := ch.SendMedia(context.Background(), "6591234567", file); err != nil {
+		t.Fatalf("SendMedia: %v", err)
+	}
+	if len(api.uploaded) != 1 || api.uploaded[0] != "ca199.png image/png" {
+		t.Errorf("uploaded = %v", api.uploaded)
+	}
+	sent := api.messages()
+	if len(sent) != 1 || sent[0]["type"] != "image" {
+		t.Fatalf("sent = %v", sent)
+	}
+	image := sent[0]["image"].(map[string]interface{})
+	if image["id"] != "media-up-1" || image["caption"] != "CA19-9 trend" {
+		t.Errorf("image = %v", image)
+	}
+}
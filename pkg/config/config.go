@@ -5,7 +5,10 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/caarlos0/env/v11"
 )
@@ -52,13 +55,110 @@ type Config struct {
 	Gateway   GatewayConfig   `json:"gateway"`
 	Tools     ToolsConfig     `json:"tools"`
 	Heartbeat HeartbeatConfig `json:"heartbeat"`
+	Scheduler SchedulerConfig `json:"scheduler"`
+	Hooks     HooksConfig     `json:"hooks"`
+	Usage     UsageConfig     `json:"usage"`
+	Feedback  FeedbackConfig  `json:"feedback"`
 	Devices   DevicesConfig   `json:"devices"`
-	mu        sync.RWMutex
+	// Guardrails are the safety policies applied to user messages and
+	// answers. The red-flag policy is controlled by tools.triage.
+	Guardrails GuardrailsConfig `json:"guardrails"`
+	mu         sync.RWMutex
 }
 
 type AgentsConfig struct {
-	Defaults AgentDefaults `json:"defaults"`
-	List     []AgentConfig `json:"list,omitempty"`
+	Defaults     AgentDefaults      `json:"defaults"`
+	List         []AgentConfig      `json:"list,omitempty"`
+	Orchestrator OrchestratorConfig `json:"orchestrator"`
+	Intake       IntakeConfig       `json:"intake"`
+	Personas     PersonasConfig     `json:"personas"`
+	// ChannelParams sets the model and sampling parameters of the turns
+	// on each channel, over those of the persona
+	ChannelParams map[string]ModelParams `json:"channel_params,omitempty"`
+}
+
+// ModelParams set the model and sampling parameters of a turn. Fields left
+// unset keep the value from below: the agent's model with a temperature of
+// 0.7 and 8192 max tokens, then the persona's parameters, then the
+// channel's. Model may name a provider, as in "anthropic/claude-opus-4".
+// ReasoningEffort ("off", "low", "medium" or "high") sets how long models
+// that can reason think before answering; ThinkingBudget caps the tokens
+// Claude and Qwen spend on it, else set by the effort.
+type ModelParams struct {
+	Model           string   `json:"model,omitempty"`
+	Temperature     *float64 `json:"temperature,omitempty"`
+	TopP            *float64 `json:"top_p,omitempty"`
+	MaxTokens       int      `json:"max_tokens,omitempty"`
+	ReasoningEffort string   `json:"reasoning_effort,omitempty"`
+	ThinkingBudget  int      `json:"thinking_budget,omitempty"`
+}
+
+// PersonasConfig sets the tone of answers with a persona: a prompt
+// template added to the system prompt. Channels picks the persona of each
+// channel and Default is used on the others. Templates are <name>.md files
+// in Dir (default workspace/personas), read again when they change; they
+// add to or replace the built-in "patient" and "clinician" personas.
+// Params sets the model parameters of each persona's turns.
+type PersonasConfig struct {
+	Enabled  bool                   `json:"enabled" env:"PICOCLAW_AGENTS_PERSONAS_ENABLED"`
+	Default  string                 `json:"default,omitempty" env:"PICOCLAW_AGENTS_PERSONAS_DEFAULT"`
+	Dir      string                 `json:"dir,omitempty" env:"PICOCLAW_AGENTS_PERSONAS_DIR"`
+	Channels map[string]string      `json:"channels,omitempty"`
+	Params   map[string]ModelParams `json:"params,omitempty"`
+}
+
+// OrchestratorConfig routes each user message to a specialist: a prompt
+// and tool subset used for that turn, in the same session as every other
+// turn. A router model, by default the agent's, picks the specialist; with
+// no specialists listed the built-in ones are used.
+type OrchestratorConfig struct {
+	Enabled     bool               `json:"enabled" env:"PICOCLAW_AGENTS_ORCHESTRATOR_ENABLED"`
+	Model       string             `json:"model,omitempty" env:"PICOCLAW_AGENTS_ORCHESTRATOR_MODEL"`
+	Specialists []SpecialistConfig `json:"specialists,omitempty"`
+}
+
+// SpecialistConfig describes a specialist. Description tells the router
+// what it handles, Prompt is added to the system prompt, and Tools are tool
+// names or glob patterns it may use; empty Tools allows every tool.
+type SpecialistConfig struct {
+	ID          string   `json:"id"`
+	Name        string   `json:"name,omitempty"`
+	Description string   `json:"description"`
+	Prompt      string   `json:"prompt,omitempty"`
+	Tools       []string `json:"tools,omitempty"`
+}
+
+// IntakeConfig collects the facts an answer depends on before answering.
+// When a message asks what a flow covers, the agent first asks for the
+// flow's fields the conversation has not given, for at most MaxRounds
+// replies (default 2), then answers the original question with them. A
+// model, by default the agent's, recognises flows and reads the fields;
+// with no flows listed the built-in treatment flow is used.
+type IntakeConfig struct {
+	Enabled   bool               `json:"enabled" env:"PICOCLAW_AGENTS_INTAKE_ENABLED"`
+	Model     string             `json:"model,omitempty" env:"PICOCLAW_AGENTS_INTAKE_MODEL"`
+	MaxRounds int                `json:"max_rounds,omitempty" env:"PICOCLAW_AGENTS_INTAKE_MAX_ROUNDS"`
+	Flows     []IntakeFlowConfig `json:"flows,omitempty"`
+}
+
+// IntakeFlowConfig describes a kind of question and the fields needed to
+// answer it. Triggers are words that must appear in a message before the
+// model is asked whether it fits the flow; a flow without triggers is
+// considered for every message.
+type IntakeFlowConfig struct {
+	ID          string              `json:"id"`
+	Description string              `json:"description"`
+	Triggers    []string            `json:"triggers,omitempty"`
+	Fields      []IntakeFieldConfig `json:"fields"`
+}
+
+// IntakeFieldConfig is a fact to collect. QuestionZH is asked instead of
+// Question when the user writes in Chinese.
+type IntakeFieldConfig struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Question    string `json:"question"`
+	QuestionZH  string `json:"question_zh,omitempty"`
 }
 
 // AgentModelConfig supports both string and structured model config.
@@ -136,6 +236,9 @@ type AgentBinding struct {
 type SessionConfig struct {
 	DMScope       string              `json:"dm_scope,omitempty"`
 	IdentityLinks map[string][]string `json:"identity_links,omitempty"`
+	// Store is where conversations are kept: "file" (one JSON file per
+	// session, the default) or "sqlite" (workspace/sessions/sessions.db).
+	Store string `json:"store,omitempty" env:"PICOCLAW_SESSION_STORE"`
 }
 
 type AgentDefaults struct {
@@ -147,27 +250,102 @@ type AgentDefaults struct {
 	ImageModel          string   `json:"image_model,omitempty" env:"PICOCLAW_AGENTS_DEFAULTS_IMAGE_MODEL"`
 	ImageModelFallbacks []string `json:"image_model_fallbacks,omitempty"`
 	MaxTokens           int      `json:"max_tokens" env:"PICOCLAW_AGENTS_DEFAULTS_MAX_TOKENS"`
+	ContextWindow       int      `json:"context_window,omitempty" env:"PICOCLAW_AGENTS_DEFAULTS_CONTEXT_WINDOW"` // model context size in tokens; max_tokens when unset
 	Temperature         float64  `json:"temperature" env:"PICOCLAW_AGENTS_DEFAULTS_TEMPERATURE"`
 	MaxToolIterations   int      `json:"max_tool_iterations" env:"PICOCLAW_AGENTS_DEFAULTS_MAX_TOOL_ITERATIONS"`
+	MaxArgRepairs       int      `json:"max_arg_repairs" env:"PICOCLAW_AGENTS_DEFAULTS_MAX_ARG_REPAIRS"`           // times a call with rejected arguments is corrected and retried
+	InterruptOnMessage  bool     `json:"interrupt_on_message" env:"PICOCLAW_AGENTS_DEFAULTS_INTERRUPT_ON_MESSAGE"` // a new message stops the sender's unfinished answer
+	MaxToolCalls        int      `json:"max_tool_calls" env:"PICOCLAW_AGENTS_DEFAULTS_MAX_TOOL_CALLS"`             // tool calls one turn may make; 0 is no limit
+	MaxRepeatedCalls    int      `json:"max_repeated_calls" env:"PICOCLAW_AGENTS_DEFAULTS_MAX_REPEATED_CALLS"`     // times an identical call may repeat with an identical result; 0 allows any
+	MaxParallelTools    int      `json:"max_parallel_tools" env:"PICOCLAW_AGENTS_DEFAULTS_MAX_PARALLEL_TOOLS"`     // read-only calls from one reply run at once; 0 or 1 runs one at a time
 }
 
 type ChannelsConfig struct {
-	WhatsApp WhatsAppConfig `json:"whatsapp"`
-	Telegram TelegramConfig `json:"telegram"`
-	Feishu   FeishuConfig   `json:"feishu"`
-	Discord  DiscordConfig  `json:"discord"`
-	MaixCam  MaixCamConfig  `json:"maixcam"`
-	QQ       QQConfig       `json:"qq"`
-	DingTalk DingTalkConfig `json:"dingtalk"`
-	Slack    SlackConfig    `json:"slack"`
-	LINE     LINEConfig     `json:"line"`
-	OneBot   OneBotConfig   `json:"onebot"`
+	WhatsApp    WhatsAppConfig    `json:"whatsapp"`
+	Telegram    TelegramConfig    `json:"telegram"`
+	Feishu      FeishuConfig      `json:"feishu"`
+	Discord     DiscordConfig     `json:"discord"`
+	MaixCam     MaixCamConfig     `json:"maixcam"`
+	QQ          QQConfig          `json:"qq"`
+	DingTalk    DingTalkConfig    `json:"dingtalk"`
+	Slack       SlackConfig       `json:"slack"`
+	LINE        LINEConfig        `json:"line"`
+	OneBot      OneBotConfig      `json:"onebot"`
+	Web         WebConfig         `json:"web"`
+	Groups      GroupsConfig      `json:"groups"`
+	Attachments AttachmentsConfig `json:"attachments"`
+	// Access narrows who may use a channel, keyed by channel name
+	Access   map[string]AccessConfig `json:"access,omitempty"`
+	Outbound OutboundConfig          `json:"outbound"`
+}
+
+// OutboundConfig sets how messages are sent to users. Each channel sends
+// at most RateLimits[channel] messages a second (no limit when absent or
+// 0), keeping each chat's messages in order. A failed send is retried up
+// to MaxRetries times, waiting RetryDelaySeconds and twice as long after
+// each further failure. Messages not yet sent are kept in the workspace,
+// in state/outbox.json, and sent after a restart.
+type OutboundConfig struct {
+	MaxRetries        int                `json:"max_retries" env:"PICOCLAW_CHANNELS_OUTBOUND_MAX_RETRIES"`
+	RetryDelaySeconds int                `json:"retry_delay_seconds" env:"PICOCLAW_CHANNELS_OUTBOUND_RETRY_DELAY_SECONDS"`
+	RateLimits        map[string]float64 `json:"rate_limits,omitempty"`
+}
+
+// AccessConfig controls who may use one channel. A channel's allow_from
+// and DenyFrom list user IDs, group or chat IDs, or phone numbers; deny
+// wins over allow. With Pairing on, people not on allow_from are answered
+// with a pairing code instead of being ignored, and are let in once the
+// code is approved with "picoclaw pairing approve". BlockedMessage, when
+// set, is sent to people who are refused in a direct chat.
+type AccessConfig struct {
+	DenyFrom       FlexibleStringSlice `json:"deny_from"`
+	Pairing        bool                `json:"pairing"`
+	BlockedMessage string              `json:"blocked_message"`
+}
+
+// AttachmentsConfig limits the files users can send on every channel.
+// Files over MaxSizeMB, or whose content is not one of AllowedTypes (MIME
+// types, or prefixes such as "image/*"), are not passed to the agent, and
+// the user is told why. Accepted files are kept in the workspace, under
+// attachments/, in a folder per conversation.
+type AttachmentsConfig struct {
+	MaxSizeMB    int                 `json:"max_size_mb" env:"PICOCLAW_CHANNELS_ATTACHMENTS_MAX_SIZE_MB"`
+	AllowedTypes FlexibleStringSlice `json:"allowed_types" env:"PICOCLAW_CHANNELS_ATTACHMENTS_ALLOWED_TYPES"`
+}
+
+// GroupsConfig sets how every channel behaves in group chats.
+// RequireMention answers only messages that @-mention the bot or reply to
+// one of its messages. PerUserSessions gives each member of a group their
+// own conversation instead of one shared by the whole group. QuoteQuestion
+// answers as a reply to the question, or quotes it on channels without
+// replies, so members can tell which question an answer is for.
+type GroupsConfig struct {
+	RequireMention  bool `json:"require_mention" env:"PICOCLAW_CHANNELS_GROUPS_REQUIRE_MENTION"`
+	PerUserSessions bool `json:"per_user_sessions" env:"PICOCLAW_CHANNELS_GROUPS_PER_USER_SESSIONS"`
+	QuoteQuestion   bool `json:"quote_question" env:"PICOCLAW_CHANNELS_GROUPS_QUOTE_QUESTION"`
 }
 
+// WhatsAppConfig connects through a bridge at BridgeURL, or, when
+// PhoneNumberID is set, through the WhatsApp Business Cloud API: messages
+// arrive at a webhook on WebhookHost:WebhookPort and WebhookPath, signed
+// with AppSecret, and Meta checks the webhook with VerifyToken. WhatsApp
+// only accepts free-form messages within 24 hours of the user's last
+// message; after that, Template, an approved template with one body
+// parameter, carries the message in TemplateLanguage.
 type WhatsAppConfig struct {
-	Enabled   bool                `json:"enabled" env:"PICOCLAW_CHANNELS_WHATSAPP_ENABLED"`
-	BridgeURL string              `json:"bridge_url" env:"PICOCLAW_CHANNELS_WHATSAPP_BRIDGE_URL"`
-	AllowFrom FlexibleStringSlice `json:"allow_from" env:"PICOCLAW_CHANNELS_WHATSAPP_ALLOW_FROM"`
+	Enabled          bool                `json:"enabled" env:"PICOCLAW_CHANNELS_WHATSAPP_ENABLED"`
+	BridgeURL        string              `json:"bridge_url" env:"PICOCLAW_CHANNELS_WHATSAPP_BRIDGE_URL"`
+	AccessToken      string              `json:"access_token" env:"PICOCLAW_CHANNELS_WHATSAPP_ACCESS_TOKEN"`
+	PhoneNumberID    string              `json:"phone_number_id" env:"PICOCLAW_CHANNELS_WHATSAPP_PHONE_NUMBER_ID"`
+	AppSecret        string              `json:"app_secret" env:"PICOCLAW_CHANNELS_WHATSAPP_APP_SECRET"`
+	VerifyToken      string              `json:"verify_token" env:"PICOCLAW_CHANNELS_WHATSAPP_VERIFY_TOKEN"`
+	WebhookHost      string              `json:"webhook_host" env:"PICOCLAW_CHANNELS_WHATSAPP_WEBHOOK_HOST"`
+	WebhookPort      int                 `json:"webhook_port" env:"PICOCLAW_CHANNELS_WHATSAPP_WEBHOOK_PORT"`
+	WebhookPath      string              `json:"webhook_path" env:"PICOCLAW_CHANNELS_WHATSAPP_WEBHOOK_PATH"`
+	APIBase          string              `json:"api_base,omitempty" env:"PICOCLAW_CHANNELS_WHATSAPP_API_BASE"`
+	Template         string              `json:"template" env:"PICOCLAW_CHANNELS_WHATSAPP_TEMPLATE"`
+	TemplateLanguage string              `json:"template_language" env:"PICOCLAW_CHANNELS_WHATSAPP_TEMPLATE_LANGUAGE"`
+	AllowFrom        FlexibleStringSlice `json:"allow_from" env:"PICOCLAW_CHANNELS_WHATSAPP_ALLOW_FROM"`
 }
 
 type TelegramConfig struct {
@@ -230,6 +408,25 @@ type LINEConfig struct {
 	AllowFrom          FlexibleStringSlice `json:"allow_from" env:"PICOCLAW_CHANNELS_LINE_ALLOW_FROM"`
 }
 
+// WebConfig serves a chat page that websites can embed in an iframe, and
+// an API to post messages and stream the answers, on Host:Port under Path.
+// Visitors are told apart by a session cookie, which expires after
+// SessionTTLHours without a message. AllowOrigins lists the sites that may
+// embed the page or call the API from their own pages; SecureCookie must
+// be set for embedding on another site, which needs HTTPS.
+type WebConfig struct {
+	Enabled         bool                `json:"enabled" env:"PICOCLAW_CHANNELS_WEB_ENABLED"`
+	Host            string              `json:"host" env:"PICOCLAW_CHANNELS_WEB_HOST"`
+	Port            int                 `json:"port" env:"PICOCLAW_CHANNELS_WEB_PORT"`
+	Path            string              `json:"path" env:"PICOCLAW_CHANNELS_WEB_PATH"`
+	Title           string              `json:"title,omitempty" env:"PICOCLAW_CHANNELS_WEB_TITLE"`
+	AllowOrigins    FlexibleStringSlice `json:"allow_origins" env:"PICOCLAW_CHANNELS_WEB_ALLOW_ORIGINS"`
+	SecureCookie    bool                `json:"secure_cookie" env:"PICOCLAW_CHANNELS_WEB_SECURE_COOKIE"`
+	SessionTTLHours int                 `json:"session_ttl_hours" env:"PICOCLAW_CHANNELS_WEB_SESSION_TTL_HOURS"`
+	MaxSessions     int                 `json:"max_sessions" env:"PICOCLAW_CHANNELS_WEB_MAX_SESSIONS"`
+	MaxMessageChars int                 `json:"max_message_chars" env:"PICOCLAW_CHANNELS_WEB_MAX_MESSAGE_CHARS"`
+}
+
 type OneBotConfig struct {
 	Enabled            bool                `json:"enabled" env:"PICOCLAW_CHANNELS_ONEBOT_ENABLED"`
 	WSUrl              string              `json:"ws_url" env:"PICOCLAW_CHANNELS_ONEBOT_WS_URL"`
@@ -244,26 +441,136 @@ type HeartbeatConfig struct {
 	Interval int  `json:"interval" env:"PICOCLAW_HEARTBEAT_INTERVAL"` // minutes, min 5
 }
 
+// SchedulerConfig controls proactive messages: tasks that run as agent
+// turns on a schedule, in the target chat's session, with the answer sent
+// to that chat. Tasks are listed here or added per chat with the
+// schedule_task tool.
+type SchedulerConfig struct {
+	Enabled        bool                  `json:"enabled" env:"PICOCLAW_SCHEDULER_ENABLED"`
+	TimeoutMinutes int                   `json:"timeout_minutes" env:"PICOCLAW_SCHEDULER_TIMEOUT_MINUTES"`
+	Tasks          []ScheduledTaskConfig `json:"tasks,omitempty"`
+}
+
+// ScheduledTaskConfig is a task run on a cron schedule for each target chat,
+// written as "channel:chat_id".
+type ScheduledTaskConfig struct {
+	ID       string   `json:"id"`
+	Name     string   `json:"name,omitempty"`
+	Cron     string   `json:"cron"`
+	Timezone string   `json:"timezone,omitempty"`
+	Prompt   string   `json:"prompt"`
+	Targets  []string `json:"targets"`
+	Disabled bool     `json:"disabled,omitempty"`
+}
+
+// HooksConfig lists the webhooks that receive agent events. Go code
+// subscribes to the same events through AgentLoop.Hooks.
+type HooksConfig struct {
+	Webhooks []WebhookConfig `json:"webhooks,omitempty"`
+}
+
+// WebhookConfig posts events to URL as JSON. Events limits which are sent
+// (message_received, tool_call, response_sent, error; all when empty). With
+// a Secret each post is signed with HMAC-SHA256. Message text, tool
+// arguments and results are only sent with IncludeContent.
+type WebhookConfig struct {
+	URL            string            `json:"url"`
+	Events         []string          `json:"events,omitempty"`
+	Secret         string            `json:"secret,omitempty"`
+	Headers        map[string]string `json:"headers,omitempty"`
+	IncludeContent bool              `json:"include_content,omitempty"`
+	TimeoutSeconds int               `json:"timeout_seconds,omitempty"`
+}
+
+// UsageConfig tracks the tokens, tool calls and cost of every LLM call.
+// Pricing is keyed by "provider/model", a bare model name, or "*" for
+// every other model.
+type UsageConfig struct {
+	Enabled bool                  `json:"enabled" env:"PICOCLAW_USAGE_ENABLED"`
+	Pricing map[string]ModelPrice `json:"pricing,omitempty"`
+	Budget  UsageBudgetConfig     `json:"budget"`
+}
+
+// ModelPrice is the price in USD per million tokens. Prompt tokens read
+// from the provider's cache cost CachedInputPerMillion when it is set, and
+// those written to it cost CacheWritePerMillion.
+type ModelPrice struct {
+	InputPerMillion       float64 `json:"input_per_million"`
+	OutputPerMillion      float64 `json:"output_per_million"`
+	CachedInputPerMillion float64 `json:"cached_input_per_million,omitempty"`
+	CacheWritePerMillion  float64 `json:"cache_write_per_million,omitempty"`
+}
+
+// UsageBudgetConfig caps each user's daily usage. A user over either cap
+// keeps being answered, but by FallbackModel. Zero caps are unlimited.
+type UsageBudgetConfig struct {
+	DailyTokensPerUser int      `json:"daily_tokens_per_user,omitempty" env:"PICOCLAW_USAGE_BUDGET_DAILY_TOKENS_PER_USER"`
+	DailyCostPerUser   float64  `json:"daily_cost_per_user,omitempty" env:"PICOCLAW_USAGE_BUDGET_DAILY_COST_PER_USER"`
+	FallbackModel      string   `json:"fallback_model,omitempty" env:"PICOCLAW_USAGE_BUDGET_FALLBACK_MODEL"`
+	ExemptUsers        []string `json:"exempt_users,omitempty"`
+}
+
+// FeedbackConfig collects users' ratings of answers. Each rating is kept
+// with the question, answer and evidence it rates, for evaluation sets.
+// RatingButtons puts 👍 and 👎 buttons under answers on channels that show
+// inline buttons.
+type FeedbackConfig struct {
+	Enabled       bool `json:"enabled" env:"PICOCLAW_FEEDBACK_ENABLED"`
+	RatingButtons bool `json:"rating_buttons" env:"PICOCLAW_FEEDBACK_RATING_BUTTONS"`
+}
+
 type DevicesConfig struct {
 	Enabled    bool `json:"enabled" env:"PICOCLAW_DEVICES_ENABLED"`
 	MonitorUSB bool `json:"monitor_usb" env:"PICOCLAW_DEVICES_MONITOR_USB"`
 }
 
 type ProvidersConfig struct {
-	Anthropic     ProviderConfig       `json:"anthropic"`
-	OpenAI        OpenAIProviderConfig `json:"openai"`
-	OpenRouter    ProviderConfig       `json:"openrouter"`
-	Groq          ProviderConfig       `json:"groq"`
-	Zhipu         ProviderConfig       `json:"zhipu"`
-	VLLM          ProviderConfig       `json:"vllm"`
-	Gemini        ProviderConfig       `json:"gemini"`
-	Nvidia        ProviderConfig       `json:"nvidia"`
-	Ollama        ProviderConfig       `json:"ollama"`
-	Moonshot      ProviderConfig       `json:"moonshot"`
-	ShengSuanYun  ProviderConfig       `json:"shengsuanyun"`
-	SiliconFlow   ProviderConfig       `json:"siliconflow"`
-	DeepSeek      ProviderConfig       `json:"deepseek"`
-	GitHubCopilot ProviderConfig       `json:"github_copilot"`
+	Anthropic     ProviderConfig        `json:"anthropic"`
+	OpenAI        OpenAIProviderConfig  `json:"openai"`
+	OpenRouter    ProviderConfig        `json:"openrouter"`
+	Groq          ProviderConfig        `json:"groq"`
+	Zhipu         ZhipuProviderConfig   `json:"zhipu"`
+	VLLM          ProviderConfig        `json:"vllm"`
+	Gemini        ProviderConfig        `json:"gemini"`
+	Nvidia        ProviderConfig        `json:"nvidia"`
+	Ollama        LocalProviderConfig   `json:"ollama"`
+	LlamaCpp      LocalProviderConfig   `json:"llamacpp"`
+	Moonshot      ProviderConfig        `json:"moonshot"`
+	Baichuan      ProviderConfig        `json:"baichuan"`
+	ShengSuanYun  ProviderConfig        `json:"shengsuanyun"`
+	SiliconFlow   ProviderConfig        `json:"siliconflow"`
+	DeepSeek      ProviderConfig        `json:"deepseek"`
+	DashScope     ProviderConfig        `json:"dashscope"`
+	Azure         AzureProviderConfig   `json:"azure"`
+	GitHubCopilot ProviderConfig        `json:"github_copilot"`
+	Retry         ProviderRetryConfig   `json:"retry"`
+	Capture       ProviderCaptureConfig `json:"capture"`
+}
+
+// ProviderCaptureConfig records every provider call, request and response,
+// as a JSON line in Path (default <workspace>/captures/provider_calls.jsonl),
+// for debugging and for replay with "picoclaw eval --replay". Phone
+// numbers, ID numbers, e-mail addresses and API keys in the text are
+// masked, as are tool arguments named like a secret or in RedactKeys, and
+// images are left out.
+type ProviderCaptureConfig struct {
+	Enabled    bool     `json:"enabled" env:"PICOCLAW_PROVIDERS_CAPTURE_ENABLED"`
+	Path       string   `json:"path,omitempty" env:"PICOCLAW_PROVIDERS_CAPTURE_PATH"`
+	RedactKeys []string `json:"redact_keys,omitempty"`
+}
+
+// ProviderRetryConfig controls how calls that hit a rate limit or a server
+// error are retried by the provider before the next fallback model is
+// tried. A wait the API asks for with Retry-After longer than
+// MaxWaitSeconds is not waited out. MaxConcurrent caps the calls in flight
+// per provider name, with "*" for providers not listed; a cap of 0 is no
+// limit. ToolCallRetries is how many times a model is asked again for tool
+// call arguments that are not valid JSON and cannot be repaired.
+type ProviderRetryConfig struct {
+	MaxRetries      int            `json:"max_retries" env:"PICOCLAW_PROVIDERS_RETRY_MAX_RETRIES"`
+	MaxWaitSeconds  int            `json:"max_wait_seconds" env:"PICOCLAW_PROVIDERS_RETRY_MAX_WAIT_SECONDS"`
+	MaxConcurrent   map[string]int `json:"max_concurrent,omitempty"`
+	ToolCallRetries int            `json:"tool_call_retries" env:"PICOCLAW_PROVIDERS_RETRY_TOOL_CALL_RETRIES"`
 }
 
 type ProviderConfig struct {
@@ -279,9 +586,47 @@ type OpenAIProviderConfig struct {
 	WebSearch bool `json:"web_search" env:"PICOCLAW_PROVIDERS_OPENAI_WEB_SEARCH"`
 }
 
+// ZhipuProviderConfig adds GLM's built-in web search, which the model runs
+// itself when a question needs current information.
+type ZhipuProviderConfig struct {
+	ProviderConfig
+	WebSearch bool `json:"web_search" env:"PICOCLAW_PROVIDERS_ZHIPU_WEB_SEARCH"`
+}
+
+// AzureProviderConfig configures Azure OpenAI. APIBase is the resource
+// endpoint, e.g. https://my-resource.openai.azure.com. AuthMethod is
+// "api_key" (the default), "client_secret" for an Entra ID app
+// registration, or "managed_identity". Deployments maps model names to
+// deployment names; other models are used as deployment names.
+type AzureProviderConfig struct {
+	ProviderConfig
+	APIVersion   string            `json:"api_version,omitempty" env:"PICOCLAW_PROVIDERS_AZURE_API_VERSION"`
+	Deployments  map[string]string `json:"deployments,omitempty"`
+	TenantID     string            `json:"tenant_id,omitempty" env:"PICOCLAW_PROVIDERS_AZURE_TENANT_ID"`
+	ClientID     string            `json:"client_id,omitempty" env:"PICOCLAW_PROVIDERS_AZURE_CLIENT_ID"`
+	ClientSecret string            `json:"client_secret,omitempty" env:"PICOCLAW_PROVIDERS_AZURE_CLIENT_SECRET"`
+}
+
+// LocalProviderConfig configures a model server on the local network, such as
+// Ollama or llama.cpp-server, which needs no API key. ToolMode "text" is for
+// models without native function calling: tools are described in the prompt
+// and the model calls them with a ReAct-style text protocol.
+type LocalProviderConfig struct {
+	ProviderConfig
+	ToolMode string `json:"tool_mode,omitempty" env:"PICOCLAW_PROVIDERS_{{.Name}}_TOOL_MODE"` // "native" (default) or "text"
+}
+
 type GatewayConfig struct {
-	Host string `json:"host" env:"PICOCLAW_GATEWAY_HOST"`
-	Port int    `json:"port" env:"PICOCLAW_GATEWAY_PORT"`
+	Host      string            `json:"host" env:"PICOCLAW_GATEWAY_HOST"`
+	Port      int               `json:"port" env:"PICOCLAW_GATEWAY_PORT"`
+	APITokens []GatewayAPIToken `json:"api_tokens,omitempty"`                         // bearer tokens for the HTTP API; the API is off when empty
+	OpenAIAPI bool              `json:"openai_api" env:"PICOCLAW_GATEWAY_OPENAI_API"` // serve /v1/chat/completions for OpenAI clients
+}
+
+// GatewayAPIToken grants a bearer token access to the gateway HTTP API as a role.
+type GatewayAPIToken struct {
+	Token string `json:"token"`
+	Role  string `json:"role"`
 }
 
 type BraveConfig struct {
@@ -301,19 +646,76 @@ type PerplexityConfig struct {
 	MaxResults int    `json:"max_results" env:"PICOCLAW_TOOLS_WEB_PERPLEXITY_MAX_RESULTS"`
 }
 
+type BingConfig struct {
+	Enabled    bool   `json:"enabled" env:"PICOCLAW_TOOLS_WEB_BING_ENABLED"`
+	APIKey     string `json:"api_key" env:"PICOCLAW_TOOLS_WEB_BING_API_KEY"`
+	Market     string `json:"market" env:"PICOCLAW_TOOLS_WEB_BING_MARKET"`
+	MaxResults int    `json:"max_results" env:"PICOCLAW_TOOLS_WEB_BING_MAX_RESULTS"`
+}
+
+type SearXNGConfig struct {
+	Enabled    bool   `json:"enabled" env:"PICOCLAW_TOOLS_WEB_SEARXNG_ENABLED"`
+	BaseURL    string `json:"base_url" env:"PICOCLAW_TOOLS_WEB_SEARXNG_BASE_URL"`
+	MaxResults int    `json:"max_results" env:"PICOCLAW_TOOLS_WEB_SEARXNG_MAX_RESULTS"`
+}
+
+// WebToolsConfig configures web_search and web_fetch. Backend picks the
+// search backend by name; when empty, the first enabled one is used.
 type WebToolsConfig struct {
+	Backend    string           `json:"backend,omitempty" env:"PICOCLAW_TOOLS_WEB_BACKEND"`
 	Brave      BraveConfig      `json:"brave"`
+	Bing       BingConfig       `json:"bing"`
+	SearXNG    SearXNGConfig    `json:"searxng"`
 	DuckDuckGo DuckDuckGoConfig `json:"duckduckgo"`
 	Perplexity PerplexityConfig `json:"perplexity"`
 }
 
 type CronToolsConfig struct {
-	ExecTimeoutMinutes int `json:"exec_timeout_minutes" env:"PICOCLAW_TOOLS_CRON_EXEC_TIMEOUT_MINUTES"` // 0 means no timeout
+	ExecTimeoutMinutes  int             `json:"exec_timeout_minutes" env:"PICOCLAW_TOOLS_CRON_EXEC_TIMEOUT_MINUTES"` // 0 means no timeout
+	AckWindowMinutes    int             `json:"ack_window_minutes" env:"PICOCLAW_TOOLS_CRON_ACK_WINDOW_MINUTES"`
+	EscalateAfterMisses int             `json:"escalate_after_misses" env:"PICOCLAW_TOOLS_CRON_ESCALATE_AFTER_MISSES"` // 0 disables escalation
+	Caregivers          []CaregiverLink `json:"caregivers,omitempty"`
+}
+
+// CaregiverLink connects a patient chat to a caregiver chat. Both are
+// written as "channel:chat_id", e.g. "telegram:123456".
+type CaregiverLink struct {
+	Name      string           `json:"name,omitempty"`
+	Patient   string           `json:"patient"`
+	Caregiver string           `json:"caregiver"`
+	Consent   CaregiverConsent `json:"consent"`
+}
+
+// CaregiverConsent records what the patient agreed to share with a caregiver.
+type CaregiverConsent struct {
+	MissedReminders bool `json:"missed_reminders"` // notify about repeatedly missed reminders
+	ShareDetails    bool `json:"share_details"`    // include the reminder text in notifications
 }
 
 type ExecConfig struct {
-	EnableDenyPatterns bool     `json:"enable_deny_patterns" env:"PICOCLAW_TOOLS_EXEC_ENABLE_DENY_PATTERNS"`
-	CustomDenyPatterns []string `json:"custom_deny_patterns" env:"PICOCLAW_TOOLS_EXEC_CUSTOM_DENY_PATTERNS"`
+	EnableDenyPatterns bool              `json:"enable_deny_patterns" env:"PICOCLAW_TOOLS_EXEC_ENABLE_DENY_PATTERNS"`
+	CustomDenyPatterns []string          `json:"custom_deny_patterns" env:"PICOCLAW_TOOLS_EXEC_CUSTOM_DENY_PATTERNS"`
+	Sandbox            ExecSandboxConfig `json:"sandbox"`
+}
+
+// FileToolsConfig limits the file tools (read_file, write_file, list_dir,
+// edit_file and append_file) beyond restrict_to_workspace.
+type FileToolsConfig struct {
+	SessionWorkspaces bool     `json:"session_workspaces" env:"PICOCLAW_TOOLS_FILES_SESSION_WORKSPACES"`
+	MaxFileKB         int      `json:"max_file_kb" env:"PICOCLAW_TOOLS_FILES_MAX_FILE_KB"`
+	AllowedExtensions []string `json:"allowed_extensions" env:"PICOCLAW_TOOLS_FILES_ALLOWED_EXTENSIONS"`
+}
+
+// ExecSandboxConfig confines the exec tool to the agent workspace with
+// resource limits and, by default, no network access.
+type ExecSandboxConfig struct {
+	Enabled         bool     `json:"enabled" env:"PICOCLAW_TOOLS_EXEC_SANDBOX_ENABLED"`
+	AllowedCommands []string `json:"allowed_commands" env:"PICOCLAW_TOOLS_EXEC_SANDBOX_ALLOWED_COMMANDS"`
+	DeniedCommands  []string `json:"denied_commands" env:"PICOCLAW_TOOLS_EXEC_SANDBOX_DENIED_COMMANDS"`
+	TimeoutSeconds  int      `json:"timeout_seconds" env:"PICOCLAW_TOOLS_EXEC_SANDBOX_TIMEOUT_SECONDS"`
+	CPUSeconds      int      `json:"cpu_seconds" env:"PICOCLAW_TOOLS_EXEC_SANDBOX_CPU_SECONDS"`
+	MemoryMB        int      `json:"memory_mb" env:"PICOCLAW_TOOLS_EXEC_SANDBOX_MEMORY_MB"`
+	AllowNetwork    bool     `json:"allow_network" env:"PICOCLAW_TOOLS_EXEC_SANDBOX_ALLOW_NETWORK"`
 }
 
 type KnowsToolsConfig struct {
@@ -326,14 +728,589 @@ type KnowsToolsConfig struct {
 	RetryBackoffMilliseconds int      `json:"retry_backoff_milliseconds" env:"PICOCLAW_TOOLS_KNOWS_RETRY_BACKOFF_MILLISECONDS"`
 	BatchConcurrency         int      `json:"batch_concurrency" env:"PICOCLAW_TOOLS_KNOWS_BATCH_CONCURRENCY"`
 	CacheTTLMinutes          int      `json:"cache_ttl_minutes" env:"PICOCLAW_TOOLS_KNOWS_CACHE_TTL_MINUTES"`
-	CacheMaxEntries          int      `json:"cache_max_entries" env:"PICOCLAW_TOOLS_KNOWS_CACHE_MAX_ENTRIES"`
+	VerifiedQuotes           bool     `json:"verified_quotes" env:"PICOCLAW_TOOLS_KNOWS_VERIFIED_QUOTES"`
+}
+
+type ApprovalConfig struct {
+	Enabled        bool     `json:"enabled" env:"PICOCLAW_TOOLS_APPROVAL_ENABLED"`
+	WriteFile      bool     `json:"write_file" env:"PICOCLAW_TOOLS_APPROVAL_WRITE_FILE"`
+	EditFile       bool     `json:"edit_file" env:"PICOCLAW_TOOLS_APPROVAL_EDIT_FILE"`
+	AppendFile     bool     `json:"append_file" env:"PICOCLAW_TOOLS_APPROVAL_APPEND_FILE"`
+	Exec           bool     `json:"exec" env:"PICOCLAW_TOOLS_APPROVAL_EXEC"`
+	Tools          []string `json:"tools,omitempty"` // additional tool names that always require approval
+	TimeoutMinutes int      `json:"timeout_minutes" env:"PICOCLAW_TOOLS_APPROVAL_TIMEOUT_MINUTES"`
+}
+
+// RequiredTools returns the tool names that always require approval.
+func (c ApprovalConfig) RequiredTools() []string {
+	var names []string
+	if c.WriteFile {
+		names = append(names, "write_file")
+	}
+	if c.EditFile {
+		names = append(names, "edit_file")
+	}
+	if c.AppendFile {
+		names = append(names, "append_file")
+	}
+	if c.Exec {
+		names = append(names, "exec")
+	}
+	return append(names, c.Tools...)
+}
+
+// ToolCacheConfig controls result caching for read-only tools.
+type ToolCacheConfig struct {
+	Enabled    bool           `json:"enabled" env:"PICOCLAW_TOOLS_CACHE_ENABLED"`
+	MaxEntries int            `json:"max_entries" env:"PICOCLAW_TOOLS_CACHE_MAX_ENTRIES"`
+	TTLMinutes map[string]int `json:"ttl_minutes,omitempty"` // per-tool override; 0 disables caching for that tool
+}
+
+// TTLs converts the per-tool overrides to durations.
+func (c ToolCacheConfig) TTLs() map[string]time.Duration {
+	ttls := make(map[string]time.Duration, len(c.TTLMinutes))
+	for name, minutes := range c.TTLMinutes {
+		ttls[name] = time.Duration(minutes) * time.Minute
+	}
+	return ttls
+}
+
+// AuditConfig controls the append-only tool call audit log.
+type AuditConfig struct {
+	Enabled     bool     `json:"enabled" env:"PICOCLAW_TOOLS_AUDIT_ENABLED"`
+	Path        string   `json:"path" env:"PICOCLAW_TOOLS_AUDIT_PATH"` // defaults to <workspace>/audit/tool_calls.jsonl
+	RedactKeys  []string `json:"redact_keys,omitempty"`                // extra argument names to redact
+	MaxArgChars int      `json:"max_arg_chars" env:"PICOCLAW_TOOLS_AUDIT_MAX_ARG_CHARS"`
+	RecordTurns bool     `json:"record_turns" env:"PICOCLAW_TOOLS_AUDIT_RECORD_TURNS"` // also log prompts, replies and tool results for `picoclaw replay`
+}
+
+// ShadowConfig runs a candidate model or replacement tools alongside the
+// live ones on a sample of traffic. Shadow results are only logged.
+type ShadowConfig struct {
+	Enabled        bool              `json:"enabled" env:"PICOCLAW_TOOLS_SHADOW_ENABLED"`
+	SampleRate     float64           `json:"sample_rate" env:"PICOCLAW_TOOLS_SHADOW_SAMPLE_RATE"` // fraction of calls shadowed, 0 to 1
+	Model          string            `json:"model,omitempty" env:"PICOCLAW_TOOLS_SHADOW_MODEL"`   // shadow model for LLM calls
+	Tools          map[string]string `json:"tools,omitempty"`                                     // live tool name -> shadow tool name
+	TimeoutSeconds int               `json:"timeout_seconds" env:"PICOCLAW_TOOLS_SHADOW_TIMEOUT_SECONDS"`
+	Path           string            `json:"path" env:"PICOCLAW_TOOLS_SHADOW_PATH"` // defaults to <workspace>/audit/shadow.jsonl
+}
+
+// ResultSummaryConfig condenses tool results larger than MaxTokens with a
+// cheaper model before the main model sees them.
+type ResultSummaryConfig struct {
+	Enabled       bool     `json:"enabled" env:"PICOCLAW_TOOLS_SUMMARIZE_ENABLED"`
+	MaxTokens     int      `json:"max_tokens" env:"PICOCLAW_TOOLS_SUMMARIZE_MAX_TOKENS"`         // estimated size above which results are summarized
+	SummaryTokens int      `json:"summary_tokens" env:"PICOCLAW_TOOLS_SUMMARIZE_SUMMARY_TOKENS"` // max_tokens for the summary
+	Model         string   `json:"model,omitempty" env:"PICOCLAW_TOOLS_SUMMARIZE_MODEL"`         // defaults to the agent's model
+	Tools         []string `json:"tools,omitempty"`                                              // tool names or glob patterns; empty means all tools
+}
+
+// ToolConcurrencyConfig caps how many tool calls run at once across all
+// sessions. Calls over a limit wait in a queue for up to QueueTimeoutSeconds.
+type ToolConcurrencyConfig struct {
+	MaxConcurrent       int            `json:"max_concurrent" env:"PICOCLAW_TOOLS_CONCURRENCY_MAX_CONCURRENT"` // 0 means unlimited
+	PerTool             map[string]int `json:"per_tool,omitempty"`                                             // tool name or glob pattern -> limit
+	QueueTimeoutSeconds int            `json:"queue_timeout_seconds" env:"PICOCLAW_TOOLS_CONCURRENCY_QUEUE_TIMEOUT_SECONDS"`
+}
+
+// ToolQuotaConfig caps how often tools may be called per session and per
+// user per day. Keys are tool names or glob patterns.
+type ToolQuotaConfig struct {
+	PerSession   map[string]int `json:"per_session,omitempty"`
+	PerUserDaily map[string]int `json:"per_user_daily,omitempty"`
+	ExemptUsers  []string       `json:"exempt_users,omitempty"`
+}
+
+// ToolJobsConfig controls background jobs for long-running tool calls.
+type ToolJobsConfig struct {
+	Enabled          bool `json:"enabled" env:"PICOCLAW_TOOLS_JOBS_ENABLED"`
+	TimeoutMinutes   int  `json:"timeout_minutes" env:"PICOCLAW_TOOLS_JOBS_TIMEOUT_MINUTES"`
+	RetentionMinutes int  `json:"retention_minutes" env:"PICOCLAW_TOOLS_JOBS_RETENTION_MINUTES"`
+}
+
+// FollowUpsConfig controls the follow-up questions suggested after answers
+// that used evidence tools.
+type FollowUpsConfig struct {
+	Enabled       bool     `json:"enabled" env:"PICOCLAW_TOOLS_FOLLOW_UPS_ENABLED"`
+	Max           int      `json:"max" env:"PICOCLAW_TOOLS_FOLLOW_UPS_MAX"`
+	EvidenceTools []string `json:"evidence_tools,omitempty"`
+}
+
+// FaithfulnessConfig controls the check of answers against the evidence
+// retrieved in the same turn. A model, by default the agent's, lists the
+// answer's claims that no evidence result supports. Mode "flag" (the
+// default) lists them after the answer; "block" removes them.
+type FaithfulnessConfig struct {
+	Enabled       bool     `json:"enabled" env:"PICOCLAW_TOOLS_FAITHFULNESS_ENABLED"`
+	Mode          string   `json:"mode,omitempty" env:"PICOCLAW_TOOLS_FAITHFULNESS_MODE"`
+	Model         string   `json:"model,omitempty" env:"PICOCLAW_TOOLS_FAITHFULNESS_MODEL"`
+	EvidenceTools []string `json:"evidence_tools,omitempty"`
+}
+
+// CitationsConfig controls how evidence IDs cited in answers are shown:
+// they are numbered in order of first citation and a reference list, built
+// from the results of this turn's evidence tools, is appended.
+type CitationsConfig struct {
+	Enabled       bool     `json:"enabled" env:"PICOCLAW_TOOLS_CITATIONS_ENABLED"`
+	EvidenceTools []string `json:"evidence_tools,omitempty"`
+}
+
+// AnswerCacheConfig reuses answers to near-duplicate questions. Questions
+// are embedded with the knowledge base's embedding settings; a cached
+// answer is sent when its question is at least Threshold similar (cosine).
+// Only answers that did not depend on the user are cached: the first turn
+// of a conversation, from a user without a profile, that called no tools
+// other than CacheableTools.
+type AnswerCacheConfig struct {
+	Enabled        bool     `json:"enabled" env:"PICOCLAW_TOOLS_ANSWER_CACHE_ENABLED"`
+	Threshold      float64  `json:"threshold" env:"PICOCLAW_TOOLS_ANSWER_CACHE_THRESHOLD"`
+	TTLHours       int      `json:"ttl_hours" env:"PICOCLAW_TOOLS_ANSWER_CACHE_TTL_HOURS"`
+	MaxEntries     int      `json:"max_entries" env:"PICOCLAW_TOOLS_ANSWER_CACHE_MAX_ENTRIES"`
+	MinChars       int      `json:"min_chars" env:"PICOCLAW_TOOLS_ANSWER_CACHE_MIN_CHARS"`
+	CacheableTools []string `json:"cacheable_tools,omitempty"`
+}
+
+// MCPServerConfig describes an external Model Context Protocol server.
+// Set Command to launch it over stdio, or URL to reach it over HTTP+SSE.
+type MCPServerConfig struct {
+	Command        string            `json:"command,omitempty"`
+	Args           []string          `json:"args,omitempty"`
+	Env            map[string]string `json:"env,omitempty"`
+	URL            string            `json:"url,omitempty"`
+	Headers        map[string]string `json:"headers,omitempty"`
+	TimeoutSeconds int               `json:"timeout_seconds,omitempty"` // 0 uses the default of 60
+	Disabled       bool              `json:"disabled,omitempty"`
+}
+
+// MCPExportConfig controls `picoclaw mcp serve`, which offers this
+// instance's tools to other MCP hosts. Allow and Deny are tool names or
+// globs; deny wins.
+type MCPExportConfig struct {
+	Allow  []string `json:"allow,omitempty"`
+	Deny   []string `json:"deny,omitempty"`
+	Listen string   `json:"listen" env:"PICOCLAW_TOOLS_MCP_EXPORT_LISTEN"`
+	Token  string   `json:"token,omitempty" env:"PICOCLAW_TOOLS_MCP_EXPORT_TOKEN"`
+}
+
+// MCPConfig lists MCP servers whose tools are registered for every agent,
+// and which tools picoclaw itself offers as an MCP server.
+type MCPConfig struct {
+	Servers map[string]MCPServerConfig `json:"servers,omitempty"`
+	Export  MCPExportConfig            `json:"export"`
+}
+
+// PluginConfig describes an external tool plugin: an executable that
+// speaks the describe/execute JSON-RPC protocol over stdio.
+type PluginConfig struct {
+	Command        string            `json:"command"`
+	Args           []string          `json:"args,omitempty"`
+	Env            map[string]string `json:"env,omitempty"`
+	Dir            string            `json:"dir,omitempty"`
+	TimeoutSeconds int               `json:"timeout_seconds,omitempty"` // 0 uses the default of 60
+	Disabled       bool              `json:"disabled,omitempty"`
+}
+
+// AdverseEventsConfig controls the adverse_event_report tool.
+type AdverseEventsConfig struct {
+	Enabled bool `json:"enabled" env:"PICOCLAW_TOOLS_ADVERSE_EVENTS_ENABLED"`
+}
+
+// ReimbursementConfig controls the drug_reimbursement tool. DatasetPath
+// is a JSON file of list entries, relative to the workspace unless
+// absolute; APIURL is queried with ?name= for drugs the dataset lacks.
+type ReimbursementConfig struct {
+	Enabled        bool   `json:"enabled" env:"PICOCLAW_TOOLS_REIMBURSEMENT_ENABLED"`
+	DatasetPath    string `json:"dataset_path" env:"PICOCLAW_TOOLS_REIMBURSEMENT_DATASET_PATH"`
+	APIURL         string `json:"api_url" env:"PICOCLAW_TOOLS_REIMBURSEMENT_API_URL"`
+	APIKey         string `json:"api_key" env:"PICOCLAW_TOOLS_REIMBURSEMENT_API_KEY"`
+	TimeoutSeconds int    `json:"timeout_seconds" env:"PICOCLAW_TOOLS_REIMBURSEMENT_TIMEOUT_SECONDS"`
+}
+
+// ComplementaryConfig controls the complementary_therapy tool. The tool
+// ships with a curated dataset; DatasetPath, relative to the workspace
+// unless absolute, adds entries and replaces built-in ones by name.
+type ComplementaryConfig struct {
+	Enabled     bool   `json:"enabled" env:"PICOCLAW_TOOLS_COMPLEMENTARY_ENABLED"`
+	DatasetPath string `json:"dataset_path" env:"PICOCLAW_TOOLS_COMPLEMENTARY_DATASET_PATH"`
+}
+
+// VaccinesConfig controls the vaccine_schedule tool. The tool ships with
+// built-in guidance; SchedulePath, relative to the workspace unless
+// absolute, names a file that replaces it.
+type VaccinesConfig struct {
+	Enabled      bool   `json:"enabled" env:"PICOCLAW_TOOLS_VACCINES_ENABLED"`
+	SchedulePath string `json:"schedule_path" env:"PICOCLAW_TOOLS_VACCINES_SCHEDULE_PATH"`
+}
+
+// ReferralsConfig controls the referral_request tool, which sends
+// structured referral and appointment requests to partner clinics. Every
+// request needs approval, so the tool requires tools.approval.enabled.
+type ReferralsConfig struct {
+	Enabled      bool                                 `json:"enabled" env:"PICOCLAW_TOOLS_REFERRALS_ENABLED"`
+	Destinations map[string]ReferralDestinationConfig `json:"destinations,omitempty"`
+}
+
+// ReferralDestinationConfig is a clinic endpoint that accepts requests.
+// Body is a Go template over .request, .user, .session and .now; when
+// empty, the request is sent as JSON.
+type ReferralDestinationConfig struct {
+	Description    string            `json:"description,omitempty"`
+	URL            string            `json:"url"`
+	Method         string            `json:"method,omitempty"`       // POST by default
+	ContentType    string            `json:"content_type,omitempty"` // application/json by default
+	Headers        map[string]string `json:"headers,omitempty"`
+	Body           string            `json:"body,omitempty"`
+	TimeoutSeconds int               `json:"timeout_seconds,omitempty"` // 0 uses the default of 20
+}
+
+// TranslationConfig controls the medical_translate tool. GlossaryPath is
+// a JSON file of term pairs, relative to the workspace unless absolute,
+// that extends the built-in glossary. Model defaults to the agent's model.
+type TranslationConfig struct {
+	Enabled      bool   `json:"enabled" env:"PICOCLAW_TOOLS_TRANSLATION_ENABLED"`
+	GlossaryPath string `json:"glossary_path" env:"PICOCLAW_TOOLS_TRANSLATION_GLOSSARY_PATH"`
+	Model        string `json:"model" env:"PICOCLAW_TOOLS_TRANSLATION_MODEL"`
+}
+
+// VariantsConfig controls the variant_lookup tool. OncoKB is queried only
+// when OncoKBToken is set.
+type VariantsConfig struct {
+	Enabled        bool   `json:"enabled" env:"PICOCLAW_TOOLS_VARIANTS_ENABLED"`
+	ClinVarBaseURL string `json:"clinvar_base_url" env:"PICOCLAW_TOOLS_VARIANTS_CLINVAR_BASE_URL"`
+	NCBIAPIKey     string `json:"ncbi_api_key" env:"PICOCLAW_TOOLS_VARIANTS_NCBI_API_KEY"`
+	OncoKBBaseURL  string `json:"oncokb_base_url" env:"PICOCLAW_TOOLS_VARIANTS_ONCOKB_BASE_URL"`
+	OncoKBToken    string `json:"oncokb_token" env:"PICOCLAW_TOOLS_VARIANTS_ONCOKB_TOKEN"`
+	TimeoutSeconds int    `json:"timeout_seconds" env:"PICOCLAW_TOOLS_VARIANTS_TIMEOUT_SECONDS"`
+}
+
+// ChartsConfig controls the make_chart tool.
+type ChartsConfig struct {
+	Enabled bool `json:"enabled" env:"PICOCLAW_TOOLS_CHARTS_ENABLED"`
+}
+
+// SpreadsheetsConfig controls the spreadsheet_analyze tool.
+type SpreadsheetsConfig struct {
+	Enabled bool `json:"enabled" env:"PICOCLAW_TOOLS_SPREADSHEETS_ENABLED"`
+}
+
+// LabReportsConfig controls the lab_report_parse tool.
+type LabReportsConfig struct {
+	Enabled bool `json:"enabled" env:"PICOCLAW_TOOLS_LAB_REPORTS_ENABLED"`
+}
+
+// TriageConfig controls red-flag symptom triage: the symptom_triage tool
+// and the urgent-care notice put before answers to messages that mention a
+// red-flag symptom.
+type TriageConfig struct {
+	Enabled bool `json:"enabled" env:"PICOCLAW_TOOLS_TRIAGE_ENABLED"`
+}
+
+// GuardrailsConfig selects the safety policies applied to every user
+// message and answer.
+type GuardrailsConfig struct {
+	Disclaimer DisclaimerGuardConfig `json:"disclaimer"`
+	Dosage     DosageGuardConfig     `json:"dosage"`
+	Crisis     CrisisGuardConfig     `json:"crisis"`
+}
+
+// DisclaimerGuardConfig adds a disclaimer to the end of every answer. Text
+// and TextZH replace the built-in English and Chinese wording.
+type DisclaimerGuardConfig struct {
+	Enabled bool   `json:"enabled" env:"PICOCLAW_GUARDRAILS_DISCLAIMER_ENABLED"`
+	Text    string `json:"text,omitempty" env:"PICOCLAW_GUARDRAILS_DISCLAIMER_TEXT"`
+	TextZH  string `json:"text_zh,omitempty" env:"PICOCLAW_GUARDRAILS_DISCLAIMER_TEXT_ZH"`
+}
+
+// DosageGuardConfig softens answers that tell the user what dose to take.
+// Mode "note" (the default) adds a note to confirm doses with the care
+// team; "redact" also replaces the amounts in those sentences.
+type DosageGuardConfig struct {
+	Enabled bool   `json:"enabled" env:"PICOCLAW_GUARDRAILS_DOSAGE_ENABLED"`
+	Mode    string `json:"mode,omitempty" env:"PICOCLAW_GUARDRAILS_DOSAGE_MODE"`
+}
+
+// CrisisGuardConfig answers messages about suicide or self-harm with crisis
+// hotlines first. Hotlines and HotlinesZH replace the built-in lists; when
+// NotifyChannel and NotifyChatID are set, staff there are alerted too.
+type CrisisGuardConfig struct {
+	Enabled       bool     `json:"enabled" env:"PICOCLAW_GUARDRAILS_CRISIS_ENABLED"`
+	Hotlines      []string `json:"hotlines,omitempty"`
+	HotlinesZH    []string `json:"hotlines_zh,omitempty"`
+	NotifyChannel string   `json:"notify_channel,omitempty" env:"PICOCLAW_GUARDRAILS_CRISIS_NOTIFY_CHANNEL"`
+	NotifyChatID  string   `json:"notify_chat_id,omitempty" env:"PICOCLAW_GUARDRAILS_CRISIS_NOTIFY_CHAT_ID"`
+}
+
+// DrugInteractionsConfig controls the drug_interactions tool.
+type DrugInteractionsConfig struct {
+	Enabled        bool   `json:"enabled" env:"PICOCLAW_TOOLS_DRUG_INTERACTIONS_ENABLED"`
+	RxNormBaseURL  string `json:"rxnorm_base_url" env:"PICOCLAW_TOOLS_DRUG_INTERACTIONS_RXNORM_BASE_URL"`
+	OpenFDABaseURL string `json:"openfda_base_url" env:"PICOCLAW_TOOLS_DRUG_INTERACTIONS_OPENFDA_BASE_URL"`
+	OpenFDAAPIKey  string `json:"openfda_api_key" env:"PICOCLAW_TOOLS_DRUG_INTERACTIONS_OPENFDA_API_KEY"`
+	TimeoutSeconds int    `json:"timeout_seconds" env:"PICOCLAW_TOOLS_DRUG_INTERACTIONS_TIMEOUT_SECONDS"`
+}
+
+// OCRConfig controls text recognition for photos. When enabled, channels
+// add the text of image attachments to the message, and the ocr_image tool
+// reads images in the workspace. Backend is "paddle", a PaddleOCR hub
+// serving endpoint at PaddleURL, or "baidu", Baidu cloud OCR.
+type OCRConfig struct {
+	Enabled        bool   `json:"enabled" env:"PICOCLAW_TOOLS_OCR_ENABLED"`
+	Backend        string `json:"backend" env:"PICOCLAW_TOOLS_OCR_BACKEND"`
+	PaddleURL      string `json:"paddle_url" env:"PICOCLAW_TOOLS_OCR_PADDLE_URL"`
+	BaiduBaseURL   string `json:"baidu_base_url" env:"PICOCLAW_TOOLS_OCR_BAIDU_BASE_URL"`
+	BaiduAPIKey    string `json:"baidu_api_key" env:"PICOCLAW_TOOLS_OCR_BAIDU_API_KEY"`
+	BaiduSecretKey string `json:"baidu_secret_key" env:"PICOCLAW_TOOLS_OCR_BAIDU_SECRET_KEY"`
+	TimeoutSeconds int    `json:"timeout_seconds" env:"PICOCLAW_TOOLS_OCR_TIMEOUT_SECONDS"`
+}
+
+// TTSConfig controls the text_to_speech tool. Backend is "edge", the
+// edge-tts command; "azure", Azure AI Speech; or "local", a command such as
+// piper that reads text on standard input. Rate is relative to normal
+// speed, such as "-10%", so older users can follow along.
+type TTSConfig struct {
+	Enabled        bool     `json:"enabled" env:"PICOCLAW_TOOLS_TTS_ENABLED"`
+	Backend        string   `json:"backend" env:"PICOCLAW_TOOLS_TTS_BACKEND"`
+	Voice          string   `json:"voice" env:"PICOCLAW_TOOLS_TTS_VOICE"`
+	Rate           string   `json:"rate" env:"PICOCLAW_TOOLS_TTS_RATE"`
+	EdgeCommand    string   `json:"edge_command" env:"PICOCLAW_TOOLS_TTS_EDGE_COMMAND"`
+	AzureRegion    string   `json:"azure_region" env:"PICOCLAW_TOOLS_TTS_AZURE_REGION"`
+	AzureEndpoint  string   `json:"azure_endpoint" env:"PICOCLAW_TOOLS_TTS_AZURE_ENDPOINT"`
+	AzureKey       string   `json:"azure_key" env:"PICOCLAW_TOOLS_TTS_AZURE_KEY"`
+	AzureFormat    string   `json:"azure_format" env:"PICOCLAW_TOOLS_TTS_AZURE_FORMAT"`
+	LocalCommand   []string `json:"local_command" env:"PICOCLAW_TOOLS_TTS_LOCAL_COMMAND"`
+	LocalFormat    string   `json:"local_format" env:"PICOCLAW_TOOLS_TTS_LOCAL_FORMAT"`
+	MaxChars       int      `json:"max_chars" env:"PICOCLAW_TOOLS_TTS_MAX_CHARS"`
+	TimeoutSeconds int      `json:"timeout_seconds" env:"PICOCLAW_TOOLS_TTS_TIMEOUT_SECONDS"`
+}
+
+// FHIRConfig controls the read-only FHIR R4 tools. Patients links chat
+// users, by sender ID, to their Patient resource ID, and a linked user can
+// only read their own record. Clinicians may read any patient.
+type FHIRConfig struct {
+	Enabled        bool              `json:"enabled" env:"PICOCLAW_TOOLS_FHIR_ENABLED"`
+	BaseURL        string            `json:"base_url" env:"PICOCLAW_TOOLS_FHIR_BASE_URL"`
+	Auth           FHIRAuthConfig    `json:"auth"`
+	Patients       map[string]string `json:"patients,omitempty"`
+	Clinicians     []string          `json:"clinicians,omitempty"`
+	TimeoutSeconds int               `json:"timeout_seconds" env:"PICOCLAW_TOOLS_FHIR_TIMEOUT_SECONDS"`
+}
+
+// FHIRAuthConfig is how the FHIR tools authenticate: "none", "bearer" with
+// a fixed Token, "client_credentials" with a client secret, or
+// "smart_backend" (SMART Backend Services) with a private key. TokenURL is
+// discovered from the server when empty.
+type FHIRAuthConfig struct {
+	Type           string `json:"type" env:"PICOCLAW_TOOLS_FHIR_AUTH_TYPE"`
+	Token          string `json:"token" env:"PICOCLAW_TOOLS_FHIR_AUTH_TOKEN"`
+	TokenURL       string `json:"token_url" env:"PICOCLAW_TOOLS_FHIR_AUTH_TOKEN_URL"`
+	ClientID       string `json:"client_id" env:"PICOCLAW_TOOLS_FHIR_AUTH_CLIENT_ID"`
+	ClientSecret   string `json:"client_secret" env:"PICOCLAW_TOOLS_FHIR_AUTH_CLIENT_SECRET"`
+	Scope          string `json:"scope" env:"PICOCLAW_TOOLS_FHIR_AUTH_SCOPE"`
+	PrivateKeyPath string `json:"private_key_path" env:"PICOCLAW_TOOLS_FHIR_AUTH_PRIVATE_KEY_PATH"`
+	KeyID          string `json:"key_id" env:"PICOCLAW_TOOLS_FHIR_AUTH_KEY_ID"`
+}
+
+// RAGConfig controls the local document index: ingest_pdf adds PDF files
+// to it, split into chunks of about ChunkChars characters, and
+// search_documents retrieves them. The Markdown, text and PDF files under
+// Sources, local directories or s3://bucket/prefix URLs, are indexed as
+// shared documents when the gateway starts and every SyncMinutes after.
+type RAGConfig struct {
+	Enabled      bool        `json:"enabled" env:"PICOCLAW_TOOLS_RAG_ENABLED"`
+	ChunkChars   int         `json:"chunk_chars" env:"PICOCLAW_TOOLS_RAG_CHUNK_CHARS"`
+	ChunkOverlap int         `json:"chunk_overlap" env:"PICOCLAW_TOOLS_RAG_CHUNK_OVERLAP"`
+	MaxPDFMB     int         `json:"max_pdf_mb" env:"PICOCLAW_TOOLS_RAG_MAX_PDF_MB"`
+	Sources      []string    `json:"sources,omitempty" env:"PICOCLAW_TOOLS_RAG_SOURCES"`
+	SyncMinutes  int         `json:"sync_minutes" env:"PICOCLAW_TOOLS_RAG_SYNC_MINUTES"`
+	S3           RAGS3Config `json:"s3"`
+}
+
+// RAGS3Config is the S3-compatible storage that s3:// sources are read
+// from. Without keys, requests are unsigned, for public buckets.
+type RAGS3Config struct {
+	Endpoint        string `json:"endpoint" env:"PICOCLAW_TOOLS_RAG_S3_ENDPOINT"`
+	Region          string `json:"region" env:"PICOCLAW_TOOLS_RAG_S3_REGION"`
+	AccessKeyID     string `json:"access_key_id" env:"PICOCLAW_TOOLS_RAG_S3_ACCESS_KEY_ID"`
+	SecretAccessKey string `json:"secret_access_key" env:"PICOCLAW_TOOLS_RAG_S3_SECRET_ACCESS_KEY"`
+}
+
+// ProfileConfig controls long-term user profiles: each user's confirmed
+// diagnosis, stage, regimen, allergies and language are added to the
+// system prompt. The profile_update tool is registered only when approvals
+// are enabled, since every change needs the user's confirmation.
+type ProfileConfig struct {
+	Enabled bool `json:"enabled" env:"PICOCLAW_TOOLS_PROFILE_ENABLED"`
+}
+
+// ScratchpadConfig controls each conversation's working memory: the
+// scratchpad_write and scratchpad_read tools keep up to MaxEntries short
+// notes with the session, which are shown to the agent every turn.
+type ScratchpadConfig struct {
+	Enabled       bool `json:"enabled" env:"PICOCLAW_TOOLS_SCRATCHPAD_ENABLED"`
+	MaxEntries    int  `json:"max_entries" env:"PICOCLAW_TOOLS_SCRATCHPAD_MAX_ENTRIES"`
+	MaxValueChars int  `json:"max_value_chars" env:"PICOCLAW_TOOLS_SCRATCHPAD_MAX_VALUE_CHARS"`
+}
+
+// KnowledgeBaseConfig controls the kb_ingest and kb_search tools, a
+// semantic index of curated documents. Chunks are embedded through an
+// OpenAI-compatible /embeddings endpoint and kept in Store: "sqlite", a
+// database in the agent's workspace; "qdrant"; or "pgvector".
+type KnowledgeBaseConfig struct {
+	Enabled      bool            `json:"enabled" env:"PICOCLAW_TOOLS_KNOWLEDGE_BASE_ENABLED"`
+	Store        string          `json:"store" env:"PICOCLAW_TOOLS_KNOWLEDGE_BASE_STORE"`
+	Embedding    EmbeddingConfig `json:"embedding"`
+	Qdrant       QdrantConfig    `json:"qdrant"`
+	PGVector     PGVectorConfig  `json:"pgvector"`
+	ChunkChars   int             `json:"chunk_chars" env:"PICOCLAW_TOOLS_KNOWLEDGE_BASE_CHUNK_CHARS"`
+	ChunkOverlap int             `json:"chunk_overlap" env:"PICOCLAW_TOOLS_KNOWLEDGE_BASE_CHUNK_OVERLAP"`
+	MaxFileMB    int             `json:"max_file_mb" env:"PICOCLAW_TOOLS_KNOWLEDGE_BASE_MAX_FILE_MB"`
+}
+
+// EmbeddingConfig is the /embeddings endpoint. Provider "zhipu" uses the
+// API key and base of providers.zhipu instead of APIKey and APIBase, and
+// Model if it names a Zhipu model, else embedding-3. Texts go in batches
+// of BatchSize, or as many as the provider takes when 0, with Concurrency
+// requests in flight. Up to CacheEntries embeddings are kept in the
+// workspace, so the same text is not embedded twice; 0 turns that off.
+type EmbeddingConfig struct {
+	Provider       string `json:"provider,omitempty" env:"PICOCLAW_TOOLS_KNOWLEDGE_BASE_EMBEDDING_PROVIDER"`
+	APIBase        string `json:"api_base" env:"PICOCLAW_TOOLS_KNOWLEDGE_BASE_EMBEDDING_API_BASE"`
+	APIKey         string `json:"api_key" env:"PICOCLAW_TOOLS_KNOWLEDGE_BASE_EMBEDDING_API_KEY"`
+	Model          string `json:"model" env:"PICOCLAW_TOOLS_KNOWLEDGE_BASE_EMBEDDING_MODEL"`
+	Dimensions     int    `json:"dimensions,omitempty" env:"PICOCLAW_TOOLS_KNOWLEDGE_BASE_EMBEDDING_DIMENSIONS"`
+	BatchSize      int    `json:"batch_size" env:"PICOCLAW_TOOLS_KNOWLEDGE_BASE_EMBEDDING_BATCH_SIZE"`
+	Concurrency    int    `json:"concurrency" env:"PICOCLAW_TOOLS_KNOWLEDGE_BASE_EMBEDDING_CONCURRENCY"`
+	CacheEntries   int    `json:"cache_entries" env:"PICOCLAW_TOOLS_KNOWLEDGE_BASE_EMBEDDING_CACHE_ENTRIES"`
+	TimeoutSeconds int    `json:"timeout_seconds" env:"PICOCLAW_TOOLS_KNOWLEDGE_BASE_EMBEDDING_TIMEOUT_SECONDS"`
+}
+
+type QdrantConfig struct {
+	URL            string `json:"url" env:"PICOCLAW_TOOLS_KNOWLEDGE_BASE_QDRANT_URL"`
+	APIKey         string `json:"api_key" env:"PICOCLAW_TOOLS_KNOWLEDGE_BASE_QDRANT_API_KEY"`
+	Collection     string `json:"collection" env:"PICOCLAW_TOOLS_KNOWLEDGE_BASE_QDRANT_COLLECTION"`
+	TimeoutSeconds int    `json:"timeout_seconds" env:"PICOCLAW_TOOLS_KNOWLEDGE_BASE_QDRANT_TIMEOUT_SECONDS"`
+}
+
+type PGVectorConfig struct {
+	DSN   string `json:"dsn" env:"PICOCLAW_TOOLS_KNOWLEDGE_BASE_PGVECTOR_DSN"`
+	Table string `json:"table" env:"PICOCLAW_TOOLS_KNOWLEDGE_BASE_PGVECTOR_TABLE"`
+}
+
+// EvidenceConfig controls the evidence_search, evidence_detail and
+// evidence_answer tools, which query several evidence providers at once.
+// Providers lists them in merge order: "knows" (used when tools.knows is
+// enabled), "pubmed" and "guidelines", the local document index.
+type EvidenceConfig struct {
+	Enabled   bool         `json:"enabled" env:"PICOCLAW_TOOLS_EVIDENCE_ENABLED"`
+	Providers []string     `json:"providers" env:"PICOCLAW_TOOLS_EVIDENCE_PROVIDERS"`
+	PubMed    PubMedConfig `json:"pubmed"`
+}
+
+// PubMedConfig configures the PubMed evidence provider. An NCBI API key
+// raises the rate limit from 3 to 10 requests a second.
+type PubMedConfig struct {
+	BaseURL        string `json:"base_url" env:"PICOCLAW_TOOLS_EVIDENCE_PUBMED_BASE_URL"`
+	APIKey         string `json:"api_key" env:"PICOCLAW_TOOLS_EVIDENCE_PUBMED_API_KEY"`
+	TimeoutSeconds int    `json:"timeout_seconds" env:"PICOCLAW_TOOLS_EVIDENCE_PUBMED_TIMEOUT_SECONDS"`
+}
+
+// SystematicReviewsConfig controls the systematic_review_search tool. It
+// queries PubMed with the connection settings in tools.evidence.pubmed.
+type SystematicReviewsConfig struct {
+	Enabled bool `json:"enabled" env:"PICOCLAW_TOOLS_SYSTEMATIC_REVIEWS_ENABLED"`
+}
+
+// MedicationsConfig controls the medication reminder tools. Timezone is
+// the IANA time zone reminders use when the user gives none; empty means
+// the server's local time.
+type MedicationsConfig struct {
+	Enabled  bool   `json:"enabled" env:"PICOCLAW_TOOLS_MEDICATIONS_ENABLED"`
+	Timezone string `json:"timezone" env:"PICOCLAW_TOOLS_MEDICATIONS_TIMEZONE"`
+}
+
+// DiaryConfig controls the diary_log and diary_summary tools. Each
+// user's diary is kept in <workspace>/diary/<sender>.jsonl.
+type DiaryConfig struct {
+	Enabled bool `json:"enabled" env:"PICOCLAW_TOOLS_DIARY_ENABLED"`
+}
+
+// VisitPrepConfig controls the visit_prep tool.
+type VisitPrepConfig struct {
+	Enabled bool `json:"enabled" env:"PICOCLAW_TOOLS_VISIT_PREP_ENABLED"`
+}
+
+// ToolRoleConfig limits which tools a role may use. Entries are tool names
+// or glob patterns such as "knows_*". Deny wins over allow; an empty allow
+// list allows every tool. Users lists the sender IDs holding the role.
+type ToolRoleConfig struct {
+	Allow []string `json:"allow,omitempty"`
+	Deny  []string `json:"deny,omitempty"`
+	Users []string `json:"users,omitempty"`
+}
+
+// PipelineConfig declares a tool that runs existing tools in order. Step
+// arguments and the output are Go templates over the pipeline's arguments
+// (.args) and earlier step results (.steps.<id>.text and .steps.<id>.json).
+type PipelineConfig struct {
+	Description string                 `json:"description"`
+	Parameters  map[string]interface{} `json:"parameters,omitempty"`
+	Steps       []PipelineStepConfig   `json:"steps"`
+	Output      string                 `json:"output,omitempty"`
+}
+
+// PipelineStepConfig is one tool call in a pipeline.
+type PipelineStepConfig struct {
+	ID   string                 `json:"id,omitempty"`
+	Tool string                 `json:"tool"`
+	Args map[string]interface{} `json:"args,omitempty"`
 }
 
 type ToolsConfig struct {
-	Web   WebToolsConfig   `json:"web"`
-	Cron  CronToolsConfig  `json:"cron"`
-	Exec  ExecConfig       `json:"exec"`
-	Knows KnowsToolsConfig `json:"knows"`
+	Web               WebToolsConfig            `json:"web"`
+	Cron              CronToolsConfig           `json:"cron"`
+	Exec              ExecConfig                `json:"exec"`
+	Files             FileToolsConfig           `json:"files"`
+	Approval          ApprovalConfig            `json:"approval"`
+	Cache             ToolCacheConfig           `json:"cache"`
+	Audit             AuditConfig               `json:"audit"`
+	Shadow            ShadowConfig              `json:"shadow"`
+	Summarize         ResultSummaryConfig       `json:"summarize"`
+	Concurrency       ToolConcurrencyConfig     `json:"concurrency"`
+	Quotas            ToolQuotaConfig           `json:"quotas"`
+	Jobs              ToolJobsConfig            `json:"jobs"`
+	FollowUps         FollowUpsConfig           `json:"follow_ups"`
+	Faithfulness      FaithfulnessConfig        `json:"faithfulness"`
+	Citations         CitationsConfig           `json:"citations"`
+	AnswerCache       AnswerCacheConfig         `json:"answer_cache"`
+	Knows             KnowsToolsConfig          `json:"knows"`
+	Evidence          EvidenceConfig            `json:"evidence"`
+	SystematicReviews SystematicReviewsConfig   `json:"systematic_reviews"`
+	Translation       TranslationConfig         `json:"translation"`
+	Complementary     ComplementaryConfig       `json:"complementary"`
+	Vaccines          VaccinesConfig            `json:"vaccines"`
+	Referrals         ReferralsConfig           `json:"referrals"`
+	AdverseEvents     AdverseEventsConfig       `json:"adverse_events"`
+	VisitPrep         VisitPrepConfig           `json:"visit_prep"`
+	DrugInteractions  DrugInteractionsConfig    `json:"drug_interactions"`
+	LabReports        LabReportsConfig          `json:"lab_reports"`
+	Spreadsheets      SpreadsheetsConfig        `json:"spreadsheets"`
+	Charts            ChartsConfig              `json:"charts"`
+	Triage            TriageConfig              `json:"triage"`
+	Variants          VariantsConfig            `json:"variants"`
+	Reimbursement     ReimbursementConfig       `json:"reimbursement"`
+	OCR               OCRConfig                 `json:"ocr"`
+	TTS               TTSConfig                 `json:"tts"`
+	FHIR              FHIRConfig                `json:"fhir"`
+	RAG               RAGConfig                 `json:"rag"`
+	KnowledgeBase     KnowledgeBaseConfig       `json:"knowledge_base"`
+	Profile           ProfileConfig             `json:"profile"`
+	Scratchpad        ScratchpadConfig          `json:"scratchpad"`
+	Medications       MedicationsConfig         `json:"medications"`
+	Diary             DiaryConfig               `json:"diary"`
+	MCP               MCPConfig                 `json:"mcp"`
+	Plugins           map[string]PluginConfig   `json:"plugins,omitempty"`
+	Roles             map[string]ToolRoleConfig `json:"roles,omitempty"`
+	Pipelines         map[string]PipelineConfig `json:"pipelines,omitempty"`
 }
 
 func DefaultConfig() *Config {
@@ -347,13 +1324,25 @@ func DefaultConfig() *Config {
 				MaxTokens:           8192,
 				Temperature:         0.7,
 				MaxToolIterations:   20,
+				MaxArgRepairs:       2,
+				MaxToolCalls:        40,
+				MaxRepeatedCalls:    2,
+				MaxParallelTools:    4,
+				InterruptOnMessage:  true,
+			},
+			Personas: PersonasConfig{
+				Default: "patient",
 			},
 		},
 		Channels: ChannelsConfig{
 			WhatsApp: WhatsAppConfig{
-				Enabled:   false,
-				BridgeURL: "ws://localhost:3001",
-				AllowFrom: FlexibleStringSlice{},
+				Enabled:          false,
+				BridgeURL:        "ws://localhost:3001",
+				WebhookHost:      "0.0.0.0",
+				WebhookPort:      18793,
+				WebhookPath:      "/webhook/whatsapp",
+				TemplateLanguage: "en",
+				AllowFrom:        FlexibleStringSlice{},
 			},
 			Telegram: TelegramConfig{
 				Enabled:   false,
@@ -414,19 +1403,55 @@ func DefaultConfig() *Config {
 				GroupTriggerPrefix: []string{},
 				AllowFrom:          FlexibleStringSlice{},
 			},
+			Web: WebConfig{
+				Enabled:         false,
+				Host:            "0.0.0.0",
+				Port:            18792,
+				Path:            "/chat",
+				AllowOrigins:    FlexibleStringSlice{},
+				SessionTTLHours: 24,
+				MaxSessions:     1000,
+				MaxMessageChars: 4000,
+			},
+			Groups: GroupsConfig{
+				RequireMention:  true,
+				PerUserSessions: true,
+				QuoteQuestion:   true,
+			},
+			Attachments: AttachmentsConfig{
+				MaxSizeMB:    20,
+				AllowedTypes: FlexibleStringSlice{"image/*", "application/pdf", "audio/*"},
+			},
+			Outbound: OutboundConfig{
+				MaxRetries:        5,
+				RetryDelaySeconds: 2,
+				// The platforms' published limits on messages a bot may send
+				RateLimits: map[string]float64{
+					"telegram": 30,
+					"discord":  50,
+					"slack":    1,
+					"whatsapp": 80,
+				},
+			},
 		},
 		Providers: ProvidersConfig{
 			Anthropic:    ProviderConfig{},
 			OpenAI:       OpenAIProviderConfig{WebSearch: true},
 			OpenRouter:   ProviderConfig{},
 			Groq:         ProviderConfig{},
-			Zhipu:        ProviderConfig{},
+			Zhipu:        ZhipuProviderConfig{},
 			VLLM:         ProviderConfig{},
 			Gemini:       ProviderConfig{},
 			Nvidia:       ProviderConfig{},
 			Moonshot:     ProviderConfig{},
+			Baichuan:     ProviderConfig{},
 			ShengSuanYun: ProviderConfig{},
 			SiliconFlow:  ProviderConfig{},
+			Retry: ProviderRetryConfig{
+				MaxRetries:      2,
+				MaxWaitSeconds:  20,
+				ToolCallRetries: 1,
+			},
 		},
 		Gateway: GatewayConfig{
 			Host: "0.0.0.0",
@@ -439,6 +1464,16 @@ func DefaultConfig() *Config {
 					APIKey:     "",
 					MaxResults: 5,
 				},
+				Bing: BingConfig{
+					Enabled:    false,
+					APIKey:     "",
+					MaxResults: 5,
+				},
+				SearXNG: SearXNGConfig{
+					Enabled:    false,
+					BaseURL:    "",
+					MaxResults: 5,
+				},
 				DuckDuckGo: DuckDuckGoConfig{
 					Enabled:    true,
 					MaxResults: 5,
@@ -450,10 +1485,80 @@ func DefaultConfig() *Config {
 				},
 			},
 			Cron: CronToolsConfig{
-				ExecTimeoutMinutes: 5, // default 5 minutes for LLM operations
+				ExecTimeoutMinutes:  5, // default 5 minutes for LLM operations
+				AckWindowMinutes:    60,
+				EscalateAfterMisses: 3,
 			},
 			Exec: ExecConfig{
 				EnableDenyPatterns: true,
+				Sandbox: ExecSandboxConfig{
+					TimeoutSeconds: 30,
+					CPUSeconds:     20,
+					MemoryMB:       512,
+				},
+			},
+			Approval: ApprovalConfig{
+				Enabled:        false,
+				WriteFile:      true,
+				EditFile:       true,
+				AppendFile:     true,
+				Exec:           true,
+				TimeoutMinutes: 5,
+			},
+			Cache: ToolCacheConfig{
+				Enabled:    true,
+				MaxEntries: 500,
+			},
+			Audit: AuditConfig{
+				Enabled:     false,
+				MaxArgChars: 1000,
+			},
+			Shadow: ShadowConfig{
+				Enabled:        false,
+				SampleRate:     0.1,
+				TimeoutSeconds: 60,
+			},
+			Summarize: ResultSummaryConfig{
+				Enabled:       false,
+				MaxTokens:     8000,
+				SummaryTokens: 1500,
+			},
+			Concurrency: ToolConcurrencyConfig{
+				MaxConcurrent:       0,
+				QueueTimeoutSeconds: 60,
+			},
+			Jobs: ToolJobsConfig{
+				Enabled:          true,
+				TimeoutMinutes:   30,
+				RetentionMinutes: 60,
+			},
+			MCP: MCPConfig{
+				Export: MCPExportConfig{
+					Allow:  []string{"knows_*", "web_search", "web_fetch", "job_status", "job_result"},
+					Listen: "127.0.0.1:18795",
+				},
+			},
+			FollowUps: FollowUpsConfig{
+				Enabled:       false,
+				Max:           3,
+				EvidenceTools: []string{"knows_*", "web_search", "web_fetch"},
+			},
+			Faithfulness: FaithfulnessConfig{
+				Enabled:       false,
+				Mode:          "flag",
+				EvidenceTools: []string{"knows_*", "evidence_*", "kb_search", "search_documents", "systematic_review_search"},
+			},
+			Citations: CitationsConfig{
+				Enabled:       true,
+				EvidenceTools: []string{"knows_*", "evidence_*", "kb_search", "search_documents", "systematic_review_search"},
+			},
+			AnswerCache: AnswerCacheConfig{
+				Enabled:        false,
+				Threshold:      0.92,
+				TTLHours:       168,
+				MaxEntries:     1000,
+				MinChars:       8,
+				CacheableTools: []string{"knows_*", "evidence_*", "kb_search", "search_documents", "systematic_review_search", "web_search"},
 			},
 			Knows: KnowsToolsConfig{
 				Enabled:                  false,
@@ -465,13 +1570,144 @@ func DefaultConfig() *Config {
 				RetryBackoffMilliseconds: 500,
 				BatchConcurrency:         5,
 				CacheTTLMinutes:          60,
-				CacheMaxEntries:          500,
+			},
+			Evidence: EvidenceConfig{
+				Enabled:   true,
+				Providers: []string{"knows", "pubmed", "guidelines"},
+				PubMed: PubMedConfig{
+					BaseURL:        "https://eutils.ncbi.nlm.nih.gov/entrez/eutils",
+					TimeoutSeconds: 20,
+				},
+			},
+			SystematicReviews: SystematicReviewsConfig{
+				Enabled: true,
+			},
+			Translation: TranslationConfig{
+				Enabled:      true,
+				GlossaryPath: "glossary.json",
+			},
+			Complementary: ComplementaryConfig{
+				Enabled: true,
+			},
+			Vaccines: VaccinesConfig{
+				Enabled: true,
+			},
+			LabReports: LabReportsConfig{
+				Enabled: true,
+			},
+			Spreadsheets: SpreadsheetsConfig{
+				Enabled: true,
+			},
+			Charts: ChartsConfig{
+				Enabled: true,
+			},
+			Triage: TriageConfig{
+				Enabled: true,
+			},
+			Variants: VariantsConfig{
+				Enabled:        false,
+				ClinVarBaseURL: "https://eutils.ncbi.nlm.nih.gov/entrez/eutils",
+				OncoKBBaseURL:  "https://www.oncokb.org/api/v1",
+				TimeoutSeconds: 20,
+			},
+			Reimbursement: ReimbursementConfig{
+				Enabled:        false,
+				DatasetPath:    "nrdl.json",
+				TimeoutSeconds: 15,
+			},
+			DrugInteractions: DrugInteractionsConfig{
+				Enabled:        false,
+				RxNormBaseURL:  "https://rxnav.nlm.nih.gov/REST",
+				OpenFDABaseURL: "https://api.fda.gov",
+				TimeoutSeconds: 20,
+			},
+			OCR: OCRConfig{
+				Enabled:        false,
+				Backend:        "paddle",
+				PaddleURL:      "http://127.0.0.1:8868/predict/ocr_system",
+				BaiduBaseURL:   "https://aip.baidubce.com",
+				TimeoutSeconds: 30,
+			},
+			TTS: TTSConfig{
+				Enabled:        false,
+				Backend:        "edge",
+				Voice:          "zh-CN-XiaoxiaoNeural",
+				Rate:           "-10%",
+				EdgeCommand:    "edge-tts",
+				AzureFormat:    "audio-24khz-48kbitrate-mono-mp3",
+				LocalFormat:    "wav",
+				MaxChars:       3000,
+				TimeoutSeconds: 60,
+			},
+			FHIR: FHIRConfig{
+				Enabled: false,
+				Auth: FHIRAuthConfig{
+					Type:  "none",
+					Scope: "system/Patient.read system/Observation.read system/MedicationRequest.read system/Medication.read",
+				},
+				TimeoutSeconds: 20,
+			},
+			RAG: RAGConfig{
+				Enabled:      true,
+				ChunkChars:   1200,
+				ChunkOverlap: 200,
+				MaxPDFMB:     30,
+				SyncMinutes:  10,
+			},
+			KnowledgeBase: KnowledgeBaseConfig{
+				Enabled: false,
+				Store:   "sqlite",
+				Embedding: EmbeddingConfig{
+					APIBase:        "https://api.siliconflow.cn/v1",
+					Model:          "BAAI/bge-m3",
+					BatchSize:      0,
+					Concurrency:    4,
+					CacheEntries:   50000,
+					TimeoutSeconds: 30,
+				},
+				Qdrant: QdrantConfig{
+					URL:            "http://127.0.0.1:6333",
+					Collection:     "picoclaw_kb",
+					TimeoutSeconds: 30,
+				},
+				PGVector: PGVectorConfig{
+					Table: "picoclaw_kb",
+				},
+				ChunkChars:   800,
+				ChunkOverlap: 120,
+				MaxFileMB:    20,
+			},
+			Profile: ProfileConfig{
+				Enabled: true,
+			},
+			Scratchpad: ScratchpadConfig{
+				Enabled:       true,
+				MaxEntries:    30,
+				MaxValueChars: 300,
+			},
+			Medications: MedicationsConfig{
+				Enabled: true,
+			},
+			Diary: DiaryConfig{
+				Enabled: true,
 			},
 		},
 		Heartbeat: HeartbeatConfig{
 			Enabled:  true,
 			Interval: 30, // default 30 minutes
 		},
+		Scheduler: SchedulerConfig{
+			Enabled:        false,
+			TimeoutMinutes: 5,
+		},
+		Guardrails: GuardrailsConfig{
+			Disclaimer: DisclaimerGuardConfig{Enabled: true},
+			Dosage:     DosageGuardConfig{Enabled: true, Mode: "note"},
+			Crisis:     CrisisGuardConfig{Enabled: true},
+		},
+		Feedback: FeedbackConfig{
+			RatingButtons: true,
+		},
 		Devices: DevicesConfig{
 			Enabled:    false,
 			MonitorUSB: true,
@@ -479,6 +1715,9 @@ func DefaultConfig() *Config {
 	}
 }
 
+// LoadConfig reads a JSON, YAML, or TOML config (chosen by file extension),
+// applies environment overrides, and validates the result. Unknown keys are
+// rejected so typos do not silently fall back to defaults.
 func LoadConfig(path string) (*Config, error) {
 	cfg := DefaultConfig()
 
@@ -490,17 +1729,35 @@ func LoadConfig(path string) (*Config, error) {
 		return nil, err
 	}
 
-	if err := json.Unmarshal(data, cfg); err != nil {
-		return nil, err
+	jsonData, err := toJSON(FormatForPath(path), data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	var doc interface{}
+	if err := json.Unmarshal(jsonData, &doc); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if errs := unknownKeys(doc, reflect.TypeOf(cfg).Elem(), ""); len(errs) > 0 {
+		return nil, ValidationErrors(errs)
+	}
+
+	if err := json.Unmarshal(jsonData, cfg); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, describeJSONError(jsonData, err))
 	}
 
 	if err := env.Parse(cfg); err != nil {
 		return nil, err
 	}
 
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
 	return cfg, nil
 }
 
+// SaveConfig writes cfg in the format implied by the file extension.
 func SaveConfig(path string, cfg *Config) error {
 	cfg.mu.RLock()
 	defer cfg.mu.RUnlock()
@@ -510,6 +1767,11 @@ func SaveConfig(path string, cfg *Config) error {
 		return err
 	}
 
+	data, err = fromJSON(FormatForPath(path), data)
+	if err != nil {
+		return err
+	}
+
 	dir := filepath.Dir(path)
 	if err := os.MkdirAll(dir, 0755); err != nil {
 		return err
@@ -524,6 +1786,155 @@ func (c *Config) WorkspacePath() string {
 	return expandHome(c.Agents.Defaults.Workspace)
 }
 
+// AuditPath returns the tool call audit log location.
+func (c *Config) AuditPath() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.Tools.Audit.Path != "" {
+		return expandHome(c.Tools.Audit.Path)
+	}
+	return filepath.Join(expandHome(c.Agents.Defaults.Workspace), "audit", "tool_calls.jsonl")
+}
+
+// QuotaPath returns where daily tool quota counts are kept.
+func (c *Config) QuotaPath() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return filepath.Join(expandHome(c.Agents.Defaults.Workspace), "state", "tool_quotas.json")
+}
+
+// UsagePath returns where token usage entries are logged.
+func (c *Config) UsagePath() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return filepath.Join(expandHome(c.Agents.Defaults.Workspace), "usage", "usage.jsonl")
+}
+
+// AnswerCachePath returns the semantic answer cache location.
+func (c *Config) AnswerCachePath() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return filepath.Join(expandHome(c.Agents.Defaults.Workspace), "answer_cache", "answers.json")
+}
+
+// OutboxPath returns the location of outbound messages not yet sent.
+func (c *Config) OutboxPath() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return filepath.Join(expandHome(c.Agents.Defaults.Workspace), "state", "outbox.json")
+}
+
+// PairingPath returns the location of pairing requests and approvals.
+func (c *Config) PairingPath() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return filepath.Join(expandHome(c.Agents.Defaults.Workspace), "state", "pairing.json")
+}
+
+// FeedbackPath returns the feedback log location.
+func (c *Config) FeedbackPath() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return filepath.Join(expandHome(c.Agents.Defaults.Workspace), "feedback", "feedback.jsonl")
+}
+
+// ShadowPath returns the shadow comparison log location.
+func (c *Config) ShadowPath() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.Tools.Shadow.Path != "" {
+		return expandHome(c.Tools.Shadow.Path)
+	}
+	return filepath.Join(expandHome(c.Agents.Defaults.Workspace), "audit", "shadow.jsonl")
+}
+
+// EmbeddingCachePath returns where embeddings are cached.
+func (c *Config) EmbeddingCachePath() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return filepath.Join(expandHome(c.Agents.Defaults.Workspace), "cache", "embeddings.jsonl")
+}
+
+// CapturePath returns where provider calls are captured.
+func (c *Config) CapturePath() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.Providers.Capture.Path != "" {
+		return expandHome(c.Providers.Capture.Path)
+	}
+	return filepath.Join(expandHome(c.Agents.Defaults.Workspace), "captures", "provider_calls.jsonl")
+}
+
+// ReimbursementDatasetPath returns the reimbursement dataset location, or
+// "" when none is configured.
+func (c *Config) ReimbursementDatasetPath() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	p := expandHome(c.Tools.Reimbursement.DatasetPath)
+	if p == "" || filepath.IsAbs(p) {
+		return p
+	}
+	return filepath.Join(expandHome(c.Agents.Defaults.Workspace), p)
+}
+
+// TranslationGlossaryPath returns the glossary file of medical_translate.
+func (c *Config) TranslationGlossaryPath() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	p := expandHome(c.Tools.Translation.GlossaryPath)
+	if p == "" || filepath.IsAbs(p) {
+		return p
+	}
+	return filepath.Join(expandHome(c.Agents.Defaults.Workspace), p)
+}
+
+// ComplementaryDatasetPath returns the complementary therapy dataset
+// location, or "" when none is configured.
+func (c *Config) ComplementaryDatasetPath() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	p := expandHome(c.Tools.Complementary.DatasetPath)
+	if p == "" || filepath.IsAbs(p) {
+		return p
+	}
+	return filepath.Join(expandHome(c.Agents.Defaults.Workspace), p)
+}
+
+// VaccineSchedulePath returns the vaccine guidance file location, or ""
+// when none is configured.
+func (c *Config) VaccineSchedulePath() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	p := expandHome(c.Tools.Vaccines.SchedulePath)
+	if p == "" || filepath.IsAbs(p) {
+		return p
+	}
+	return filepath.Join(expandHome(c.Agents.Defaults.Workspace), p)
+}
+
+// KnowledgeBaseEmbedding returns the embedding endpoint of the knowledge
+// base and answer cache, with the defaults of its provider filled in.
+func (c *Config) KnowledgeBaseEmbedding() EmbeddingConfig {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.embedding()
+}
+
+func (c *Config) embedding() EmbeddingConfig {
+	emb := c.Tools.KnowledgeBase.Embedding
+	if emb.Provider == "zhipu" {
+		emb.APIKey = c.Providers.Zhipu.APIKey
+		emb.APIBase = c.Providers.Zhipu.APIBase
+		if emb.APIBase == "" {
+			emb.APIBase = "https://open.bigmodel.cn/api/paas/v4"
+		}
+		if !strings.HasPrefix(emb.Model, "embedding-") {
+			emb.Model = "embedding-3"
+		}
+	}
+	return emb
+}
+
 func (c *Config) GetAPIKey() string {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
@@ -409,3 +409,25 @@ func TestLoadConfig_OpenAIWebSearchCanBeDisabled(t *testing.T) {
 		t.Fatal("OpenAI codex web search should be false when disabled in config file")
 	}
 }
+
+func TestKnowledgeBaseEmbedding_ZhipuDefaults(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Providers.Zhipu.APIKey = "zhipu-key"
+	cfg.Tools.KnowledgeBase.Enabled = true
+	cfg.Tools.KnowledgeBase.Embedding.Provider = "zhipu"
+	cfg.Tools.KnowledgeBase.Embedding.Dimensions = 1024
+
+	emb := cfg.KnowledgeBaseEmbedding()
+	if emb.APIKey != "zhipu-key" || emb.APIBase != "https://open.bigmodel.cn/api/paas/v4" || emb.Model != "embedding-3" || emb.Dimensions != 1024 {
+		t.Errorf("KnowledgeBaseEmbedding() = %+v", emb)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Validate() error: %v", err)
+	}
+
+	cfg.Providers.Zhipu.APIBase = "https://zhipu.internal/v4"
+	cfg.Tools.KnowledgeBase.Embedding.Model = "embedding-2"
+	if emb := cfg.KnowledgeBaseEmbedding(); emb.APIBase != "https://zhipu.internal/v4" || emb.Model != "embedding-2" {
+		t.Errorf("KnowledgeBaseEmbedding() = %+v, want the provider's base and the Zhipu model kept", emb)
+	}
+}
@@ -0,0 +1,194 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Format is a config file encoding.
+type Format string
+
+const (
+	FormatJSON Format = "json"
+	FormatYAML Format = "yaml"
+	FormatTOML Format = "toml"
+)
+
+// ConfigFileNames lists the config file names looked up in the picoclaw
+// home directory, in priority order.
+var ConfigFileNames = []string{"config.json", "config.yaml", "config.yml", "config.toml"}
+
+// FormatForPath picks the config format from the file extension.
+// Unknown extensions are treated as JSON.
+func FormatForPath(path string) Format {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return FormatYAML
+	case ".toml":
+		return FormatTOML
+	default:
+		return FormatJSON
+	}
+}
+
+// toJSON converts a config document in the given format into JSON, so all
+// formats share one decoding, validation, and unknown-key path.
+func toJSON(format Format, data []byte) ([]byte, error) {
+	switch format {
+	case FormatYAML:
+		var doc interface{}
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return nil, fmt.Errorf("invalid YAML: %w", err)
+		}
+		if doc == nil {
+			doc = map[string]interface{}{}
+		}
+		normalized, err := normalizeYAML(doc, "")
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(normalized)
+	case FormatTOML:
+		var doc map[string]interface{}
+		if _, err := toml.Decode(string(data), &doc); err != nil {
+			return nil, fmt.Errorf("invalid TOML: %w", err)
+		}
+		return json.Marshal(doc)
+	default:
+		if err := json.Unmarshal(data, new(interface{})); err != nil {
+			return nil, describeJSONError(data, err)
+		}
+		return data, nil
+	}
+}
+
+// fromJSON re-encodes JSON config output in the given format.
+func fromJSON(format Format, data []byte) ([]byte, error) {
+	if format == FormatJSON {
+		return data, nil
+	}
+
+	var doc map[string]interface{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+	doc = numbersToNative(doc).(map[string]interface{})
+
+	switch format {
+	case FormatYAML:
+		return yaml.Marshal(doc)
+	case FormatTOML:
+		var buf bytes.Buffer
+		if err := toml.NewEncoder(&buf).Encode(doc); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+	return nil, fmt.Errorf("unsupported config format %q", format)
+}
+
+// normalizeYAML rejects non-string mapping keys, which have no JSON equivalent.
+func normalizeYAML(v interface{}, path string) (interface{}, error) {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for k, item := range val {
+			normalized, err := normalizeYAML(item, joinPath(path, k))
+			if err != nil {
+				return nil, err
+			}
+			val[k] = normalized
+		}
+		return val, nil
+	case map[interface{}]interface{}:
+		out := make(map[string]interface{}, len(val))
+		for k, item := range val {
+			key, ok := k.(string)
+			if !ok {
+				return nil, &FieldError{Path: path, Message: fmt.Sprintf("mapping key %v must be a string", k)}
+			}
+			normalized, err := normalizeYAML(item, joinPath(path, key))
+			if err != nil {
+				return nil, err
+			}
+			out[key] = normalized
+		}
+		return out, nil
+	case []interface{}:
+		for i, item := range val {
+			normalized, err := normalizeYAML(item, fmt.Sprintf("%s[%d]", path, i))
+			if err != nil {
+				return nil, err
+			}
+			val[i] = normalized
+		}
+		return val, nil
+	default:
+		return val, nil
+	}
+}
+
+func numbersToNative(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for k, item := range val {
+			val[k] = numbersToNative(item)
+		}
+		return val
+	case []interface{}:
+		for i, item := range val {
+			val[i] = numbersToNative(item)
+		}
+		return val
+	case json.Number:
+		if n, err := val.Int64(); err == nil {
+			return n
+		}
+		f, _ := val.Float64()
+		return f
+	default:
+		return val
+	}
+}
+
+// describeJSONError adds a field path or line/column to JSON decode errors.
+func describeJSONError(data []byte, err error) error {
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		line, col := offsetToLineCol(data, syntaxErr.Offset)
+		return fmt.Errorf("invalid JSON at line %d, column %d: %v", line, col, syntaxErr)
+	}
+
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		return &FieldError{
+			Path:    typeErr.Field,
+			Message: fmt.Sprintf("expected %s, got %s", typeErr.Type, typeErr.Value),
+		}
+	}
+	return err
+}
+
+func offsetToLineCol(data []byte, offset int64) (int, int) {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	line, col := 1, 1
+	for _, b := range data[:offset] {
+		if b == '\n' {
+			line++
+			col = 1
+		} else {
+			col++
+		}
+	}
+	return line, col
+}
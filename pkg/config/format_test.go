@@ -0,0 +1,109 @@
+package config
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadConfig_YAML(t *testing.T) {
+	path := writeConfigFile(t, "config.yaml", `
+agents:
+  defaults:
+    model: gpt-4o
+tools:
+  knows:
+    enabled: true
+    api_key: k
+    api_base_url: https://example.com
+    default_data_scope: [GUIDE]
+channels:
+  telegram:
+    allow_from: [123, "@alice"]
+`)
+
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig() error: %v", err)
+	}
+	if cfg.Agents.Defaults.Model != "gpt-4o" {
+		t.Errorf("model = %q", cfg.Agents.Defaults.Model)
+	}
+	if !cfg.Tools.Knows.Enabled || cfg.Tools.Knows.DefaultDataScope[0] != "GUIDE" {
+		t.Errorf("knows config not loaded: %+v", cfg.Tools.Knows)
+	}
+	if len(cfg.Channels.Telegram.AllowFrom) != 2 || cfg.Channels.Telegram.AllowFrom[0] != "123" {
+		t.Errorf("allow_from = %v", cfg.Channels.Telegram.AllowFrom)
+	}
+	// Defaults survive for keys the file does not mention.
+	if cfg.Agents.Defaults.MaxTokens != 8192 {
+		t.Errorf("max_tokens default lost: %d", cfg.Agents.Defaults.MaxTokens)
+	}
+}
+
+func TestLoadConfig_TOMLUnknownKey(t *testing.T) {
+	path := writeConfigFile(t, "config.toml", `
+[gateway]
+port = 8080
+hots = "127.0.0.1"
+`)
+
+	_, err := LoadConfig(path)
+	if err == nil || !strings.Contains(err.Error(), `gateway.hots: unknown key (did you mean "host"?)`) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestSaveConfig_RoundTripsFormats(t *testing.T) {
+	for _, name := range []string{"config.json", "config.yaml", "config.toml"} {
+		t.Run(name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			cfg.Gateway.Port = 9999
+			cfg.Agents.Defaults.Temperature = 0.25
+
+			path := filepath.Join(t.TempDir(), name)
+			if err := SaveConfig(path, cfg); err != nil {
+				t.Fatalf("SaveConfig() error: %v", err)
+			}
+			loaded, err := LoadConfig(path)
+			if err != nil {
+				t.Fatalf("LoadConfig() error: %v", err)
+			}
+			if loaded.Gateway.Port != 9999 || loaded.Agents.Defaults.Temperature != 0.25 {
+				t.Errorf("round trip lost values: port=%d temperature=%g", loaded.Gateway.Port, loaded.Agents.Defaults.Temperature)
+			}
+		})
+	}
+}
+
+func TestJSONSchema(t *testing.T) {
+	data, err := MarshalJSONSchema()
+	if err != nil {
+		t.Fatalf("MarshalJSONSchema() error: %v", err)
+	}
+
+	var schema map[string]interface{}
+	if err := json.Unmarshal(data, &schema); err != nil {
+		t.Fatalf("schema is not valid JSON: %v", err)
+	}
+
+	props := schema["properties"].(map[string]interface{})
+	gateway := props["gateway"].(map[string]interface{})
+	port := gateway["properties"].(map[string]interface{})["port"].(map[string]interface{})
+	if port["type"] != "integer" || port["default"] != float64(18790) {
+		t.Errorf("unexpected gateway.port schema: %v", port)
+	}
+	if gateway["additionalProperties"] != false {
+		t.Error("expected additionalProperties=false on objects")
+	}
+
+	openai := props["providers"].(map[string]interface{})["properties"].(map[string]interface{})["openai"].(map[string]interface{})
+	openaiProps := openai["properties"].(map[string]interface{})
+	if _, ok := openaiProps["api_key"]; !ok {
+		t.Error("expected embedded provider fields to be flattened")
+	}
+	if _, ok := openaiProps["web_search"]; !ok {
+		t.Error("expected web_search property")
+	}
+}
@@ -0,0 +1,248 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+var (
+	flexibleStringSliceType = reflect.TypeOf(FlexibleStringSlice{})
+	agentModelConfigType    = reflect.TypeOf(AgentModelConfig{})
+)
+
+// schemaField is one JSON-visible field of a config struct.
+type schemaField struct {
+	name  string
+	index []int
+	typ   reflect.Type
+}
+
+// structFields lists the JSON-visible fields of t, flattening embedded
+// structs the same way encoding/json does.
+func structFields(t reflect.Type) []schemaField {
+	var fields []schemaField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			for _, inner := range structFields(f.Type) {
+				inner.index = append([]int{i}, inner.index...)
+				fields = append(fields, inner)
+			}
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields = append(fields, schemaField{name: name, index: []int{i}, typ: f.Type})
+	}
+	return fields
+}
+
+// JSONSchema returns a JSON Schema (draft 2020-12) describing config.json,
+// with defaults taken from DefaultConfig. Point an editor at the exported
+// file for autocomplete and inline validation.
+func JSONSchema() map[string]interface{} {
+	schema := typeSchema(reflect.TypeOf((*Config)(nil)).Elem(), reflect.ValueOf(DefaultConfig()).Elem())
+	schema["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	schema["title"] = "PicoClaw configuration"
+	return schema
+}
+
+func typeSchema(t reflect.Type, def reflect.Value) map[string]interface{} {
+	if t.Kind() == reflect.Ptr {
+		var inner reflect.Value
+		if def.IsValid() && !def.IsNil() {
+			inner = def.Elem()
+		}
+		return typeSchema(t.Elem(), inner)
+	}
+
+	switch t {
+	case flexibleStringSliceType:
+		return map[string]interface{}{
+			"type":  "array",
+			"items": map[string]interface{}{"type": []string{"string", "number"}},
+		}
+	case agentModelConfigType:
+		return map[string]interface{}{
+			"oneOf": []interface{}{
+				map[string]interface{}{"type": "string"},
+				map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"primary":   map[string]interface{}{"type": "string"},
+						"fallbacks": map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}},
+					},
+					"additionalProperties": false,
+				},
+			},
+		}
+	}
+
+	var s map[string]interface{}
+	switch t.Kind() {
+	case reflect.String:
+		s = map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		s = map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		s = map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		s = map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		s = map[string]interface{}{"type": "array", "items": typeSchema(t.Elem(), reflect.Value{})}
+	case reflect.Map:
+		s = map[string]interface{}{"type": "object", "additionalProperties": typeSchema(t.Elem(), reflect.Value{})}
+	case reflect.Struct:
+		props := make(map[string]interface{})
+		for _, f := range structFields(t) {
+			var fieldDef reflect.Value
+			if def.IsValid() {
+				fieldDef = def.FieldByIndex(f.index)
+			}
+			props[f.name] = typeSchema(f.typ, fieldDef)
+		}
+		s = map[string]interface{}{
+			"type":                 "object",
+			"properties":           props,
+			"additionalProperties": false,
+		}
+	default:
+		s = map[string]interface{}{}
+	}
+
+	if def.IsValid() && t.Kind() != reflect.Struct && !def.IsZero() {
+		s["default"] = def.Interface()
+	}
+	return s
+}
+
+// unknownKeys reports keys in a decoded JSON document that do not map to
+// any field of t. Typos are the most common config mistake and are
+// otherwise silently ignored by encoding/json.
+func unknownKeys(doc interface{}, t reflect.Type, path string) []*FieldError {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	var errs []*FieldError
+	switch t {
+	case flexibleStringSliceType:
+		return nil
+	case agentModelConfigType:
+		if obj, ok := doc.(map[string]interface{}); ok {
+			for key := range obj {
+				if key != "primary" && key != "fallbacks" {
+					errs = append(errs, unknownKeyError(path, key, []string{"primary", "fallbacks"}))
+				}
+			}
+		}
+		return errs
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		obj, ok := doc.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		fields := structFields(t)
+		byName := make(map[string]schemaField, len(fields))
+		names := make([]string, 0, len(fields))
+		for _, f := range fields {
+			byName[f.name] = f
+			names = append(names, f.name)
+		}
+
+		keys := make([]string, 0, len(obj))
+		for key := range obj {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			f, ok := byName[key]
+			if !ok {
+				errs = append(errs, unknownKeyError(path, key, names))
+				continue
+			}
+			errs = append(errs, unknownKeys(obj[key], f.typ, joinPath(path, key))...)
+		}
+	case reflect.Slice, reflect.Array:
+		if arr, ok := doc.([]interface{}); ok {
+			for i, item := range arr {
+				errs = append(errs, unknownKeys(item, t.Elem(), fmt.Sprintf("%s[%d]", path, i))...)
+			}
+		}
+	case reflect.Map:
+		if obj, ok := doc.(map[string]interface{}); ok {
+			for key, item := range obj {
+				errs = append(errs, unknownKeys(item, t.Elem(), joinPath(path, key))...)
+			}
+		}
+	}
+	return errs
+}
+
+func unknownKeyError(path, key string, candidates []string) *FieldError {
+	msg := "unknown key"
+	if suggestion := closestName(key, candidates); suggestion != "" {
+		msg += fmt.Sprintf(" (did you mean %q?)", suggestion)
+	}
+	return &FieldError{Path: joinPath(path, key), Message: msg}
+}
+
+// closestName returns the candidate within edit distance 2 of name, if any.
+func closestName(name string, candidates []string) string {
+	best, bestDist := "", 3
+	for _, c := range candidates {
+		if d := editDistance(strings.ToLower(name), c); d < bestDist {
+			best, bestDist = c, d
+		}
+	}
+	return best
+}
+
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// MarshalJSONSchema returns the indented JSON Schema document.
+func MarshalJSONSchema() ([]byte, error) {
+	return json.MarshalIndent(JSONSchema(), "", "  ")
+}
@@ -0,0 +1,727 @@
+package config
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/adhocore/gronx"
+)
+
+// FieldError describes a problem with one config field.
+type FieldError struct {
+	Path    string
+	Message string
+}
+
+func (e *FieldError) Error() string {
+	if e.Path == "" {
+		return e.Message
+	}
+	return e.Path + ": " + e.Message
+}
+
+// ValidationErrors collects every problem found in a config so they can be
+// fixed in one pass instead of one restart per mistake.
+type ValidationErrors []*FieldError
+
+func (e ValidationErrors) Error() string {
+	lines := make([]string, 0, len(e)+1)
+	lines = append(lines, fmt.Sprintf("invalid config (%d problem(s)):", len(e)))
+	for _, fe := range e {
+		lines = append(lines, "  - "+fe.Error())
+	}
+	return strings.Join(lines, "\n")
+}
+
+var validDMScopes = map[string]struct{}{
+	"":                         {},
+	"main":                     {},
+	"per-peer":                 {},
+	"per-channel-peer":         {},
+	"per-account-channel-peer": {},
+}
+
+var validKnowsDataScopes = map[string]struct{}{
+	"PAPER":    {},
+	"PAPER_CN": {},
+	"GUIDE":    {},
+	"MEETING":  {},
+}
+
+// validPersonaName matches the names persona template files may have.
+var validPersonaName = regexp.MustCompile(`^[A-Za-z0-9_-]+$`).MatchString
+
+type validator struct {
+	errs ValidationErrors
+}
+
+func (v *validator) add(path, format string, args ...interface{}) {
+	v.errs = append(v.errs, &FieldError{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) nonNegative(path string, value int) {
+	if value < 0 {
+		v.add(path, "must be >= 0, got %d", value)
+	}
+}
+
+func (v *validator) modelParams(path string, params map[string]ModelParams) {
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		p := params[name]
+		if t := p.Temperature; t != nil && (*t < 0 || *t > 2) {
+			v.add(path+"."+name+".temperature", "must be between 0 and 2, got %g", *t)
+		}
+		if t := p.TopP; t != nil && (*t <= 0 || *t > 1) {
+			v.add(path+"."+name+".top_p", "must be above 0 and at most 1, got %g", *t)
+		}
+		v.nonNegative(path+"."+name+".max_tokens", p.MaxTokens)
+		switch p.ReasoningEffort {
+		case "", "off", "low", "medium", "high":
+		default:
+			v.add(path+"."+name+".reasoning_effort", "must be off, low, medium or high; got %q", p.ReasoningEffort)
+		}
+		if b := p.ThinkingBudget; b != 0 && b < 1024 {
+			v.add(path+"."+name+".thinking_budget", "must be at least 1024, got %d", b)
+		}
+	}
+}
+
+func (v *validator) port(path string, value int) {
+	if value < 0 || value > 65535 {
+		v.add(path, "must be a port between 0 and 65535, got %d", value)
+	}
+}
+
+func (v *validator) required(enabled bool, path, value string) {
+	if enabled && strings.TrimSpace(value) == "" {
+		v.add(path, "is required when the section is enabled")
+	}
+}
+
+func (v *validator) toolMode(path, value string) {
+	switch value {
+	case "", "native", "text":
+	default:
+		v.add(path, "must be \"native\" or \"text\", got %q", value)
+	}
+}
+
+func (v *validator) embedding(emb EmbeddingConfig) {
+	switch emb.Provider {
+	case "", "zhipu":
+	default:
+		v.add("tools.knowledge_base.embedding.provider", "must be empty or zhipu, got %q", emb.Provider)
+	}
+	v.required(true, "tools.knowledge_base.embedding.api_base", emb.APIBase)
+	v.required(true, "tools.knowledge_base.embedding.model", emb.Model)
+	v.nonNegative("tools.knowledge_base.embedding.batch_size", emb.BatchSize)
+	v.nonNegative("tools.knowledge_base.embedding.concurrency", emb.Concurrency)
+	v.nonNegative("tools.knowledge_base.embedding.cache_entries", emb.CacheEntries)
+}
+
+func (v *validator) chatAddress(path, value string) {
+	channel, chatID, ok := strings.Cut(value, ":")
+	if !ok || channel == "" || chatID == "" {
+		v.add(path, "must be \"channel:chat_id\", got %q", value)
+	}
+}
+
+// Validate checks semantic constraints that JSON decoding cannot express.
+// It returns ValidationErrors listing every problem, or nil.
+func (c *Config) Validate() error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	v := &validator{}
+
+	d := c.Agents.Defaults
+	if d.MaxTokens <= 0 {
+		v.add("agents.defaults.max_tokens", "must be > 0, got %d", d.MaxTokens)
+	}
+	if d.Temperature < 0 || d.Temperature > 2 {
+		v.add("agents.defaults.temperature", "must be between 0 and 2, got %g", d.Temperature)
+	}
+	v.nonNegative("agents.defaults.max_tool_iterations", d.MaxToolIterations)
+	v.nonNegative("agents.defaults.max_arg_repairs", d.MaxArgRepairs)
+	v.nonNegative("agents.defaults.max_tool_calls", d.MaxToolCalls)
+	v.nonNegative("agents.defaults.max_repeated_calls", d.MaxRepeatedCalls)
+	v.nonNegative("agents.defaults.max_parallel_tools", d.MaxParallelTools)
+	v.modelParams("agents.channel_params", c.Agents.ChannelParams)
+	v.modelParams("agents.personas.params", c.Agents.Personas.Params)
+
+	v.nonNegative("providers.retry.max_retries", c.Providers.Retry.MaxRetries)
+	v.nonNegative("providers.retry.max_wait_seconds", c.Providers.Retry.MaxWaitSeconds)
+	v.nonNegative("providers.retry.tool_call_retries", c.Providers.Retry.ToolCallRetries)
+	capped := make([]string, 0, len(c.Providers.Retry.MaxConcurrent))
+	for name := range c.Providers.Retry.MaxConcurrent {
+		capped = append(capped, name)
+	}
+	sort.Strings(capped)
+	for _, name := range capped {
+		v.nonNegative("providers.retry.max_concurrent."+name, c.Providers.Retry.MaxConcurrent[name])
+	}
+	v.toolMode("providers.ollama.tool_mode", c.Providers.Ollama.ToolMode)
+	v.toolMode("providers.llamacpp.tool_mode", c.Providers.LlamaCpp.ToolMode)
+	if az := c.Providers.Azure; az.APIBase != "" {
+		switch az.AuthMethod {
+		case "", "api_key":
+			v.required(true, "providers.azure.api_key", az.APIKey)
+		case "client_secret":
+			v.required(true, "providers.azure.tenant_id", az.TenantID)
+			v.required(true, "providers.azure.client_id", az.ClientID)
+			v.required(true, "providers.azure.client_secret", az.ClientSecret)
+		case "managed_identity":
+		default:
+			v.add("providers.azure.auth_method", "must be api_key, client_secret or managed_identity; got %q", az.AuthMethod)
+		}
+	}
+
+	agentIDs := make(map[string]struct{}, len(c.Agents.List))
+	defaults := 0
+	for i, agent := range c.Agents.List {
+		path := fmt.Sprintf("agents.list[%d]", i)
+		id := strings.ToLower(strings.TrimSpace(agent.ID))
+		if id == "" {
+			v.add(path+".id", "must not be empty")
+			continue
+		}
+		if _, dup := agentIDs[id]; dup {
+			v.add(path+".id", "duplicate agent id %q", agent.ID)
+		}
+		agentIDs[id] = struct{}{}
+		if agent.Default {
+			defaults++
+		}
+	}
+	if defaults > 1 {
+		v.add("agents.list", "only one agent may be marked default, found %d", defaults)
+	}
+
+	for i, b := range c.Bindings {
+		path := fmt.Sprintf("bindings[%d]", i)
+		if strings.TrimSpace(b.Match.Channel) == "" {
+			v.add(path+".match.channel", "must not be empty")
+		}
+		if len(agentIDs) > 0 {
+			if _, ok := agentIDs[strings.ToLower(strings.TrimSpace(b.AgentID))]; !ok {
+				v.add(path+".agent_id", "references unknown agent %q", b.AgentID)
+			}
+		}
+	}
+
+	if _, ok := validDMScopes[c.Session.DMScope]; !ok {
+		v.add("session.dm_scope", "must be one of main, per-peer, per-channel-peer, per-account-channel-peer; got %q", c.Session.DMScope)
+	}
+	switch c.Session.Store {
+	case "", "file", "sqlite":
+	default:
+		v.add("session.store", "must be file or sqlite; got %q", c.Session.Store)
+	}
+
+	ch := c.Channels
+	cloud := ch.WhatsApp.Enabled && ch.WhatsApp.PhoneNumberID != ""
+	v.required(ch.WhatsApp.Enabled && !cloud, "channels.whatsapp.bridge_url", ch.WhatsApp.BridgeURL)
+	v.required(cloud, "channels.whatsapp.access_token", ch.WhatsApp.AccessToken)
+	v.required(cloud, "channels.whatsapp.app_secret", ch.WhatsApp.AppSecret)
+	v.required(cloud, "channels.whatsapp.verify_token", ch.WhatsApp.VerifyToken)
+	v.required(ch.Telegram.Enabled, "channels.telegram.token", ch.Telegram.Token)
+	v.required(ch.Feishu.Enabled, "channels.feishu.app_id", ch.Feishu.AppID)
+	v.required(ch.Feishu.Enabled, "channels.feishu.app_secret", ch.Feishu.AppSecret)
+	v.required(ch.Discord.Enabled, "channels.discord.token", ch.Discord.Token)
+	v.required(ch.QQ.Enabled, "channels.qq.app_id", ch.QQ.AppID)
+	v.required(ch.QQ.Enabled, "channels.qq.app_secret", ch.QQ.AppSecret)
+	v.required(ch.DingTalk.Enabled, "channels.dingtalk.client_id", ch.DingTalk.ClientID)
+	v.required(ch.DingTalk.Enabled, "channels.dingtalk.client_secret", ch.DingTalk.ClientSecret)
+	v.required(ch.Slack.Enabled, "channels.slack.bot_token", ch.Slack.BotToken)
+	v.required(ch.Slack.Enabled, "channels.slack.app_token", ch.Slack.AppToken)
+	v.required(ch.LINE.Enabled, "channels.line.channel_secret", ch.LINE.ChannelSecret)
+	v.required(ch.LINE.Enabled, "channels.line.channel_access_token", ch.LINE.ChannelAccessToken)
+	v.required(ch.OneBot.Enabled, "channels.onebot.ws_url", ch.OneBot.WSUrl)
+	v.port("channels.maixcam.port", ch.MaixCam.Port)
+	v.port("channels.line.webhook_port", ch.LINE.WebhookPort)
+	v.port("channels.whatsapp.webhook_port", ch.WhatsApp.WebhookPort)
+	v.nonNegative("channels.onebot.reconnect_interval", ch.OneBot.ReconnectInterval)
+	v.port("channels.web.port", ch.Web.Port)
+	if ch.Web.Path != "" && !strings.HasPrefix(ch.Web.Path, "/") {
+		v.add("channels.web.path", "must start with /, got %q", ch.Web.Path)
+	}
+	v.nonNegative("channels.web.session_ttl_hours", ch.Web.SessionTTLHours)
+	v.nonNegative("channels.web.max_sessions", ch.Web.MaxSessions)
+	v.nonNegative("channels.web.max_message_chars", ch.Web.MaxMessageChars)
+	v.nonNegative("channels.attachments.max_size_mb", ch.Attachments.MaxSizeMB)
+	v.nonNegative("channels.outbound.max_retries", ch.Outbound.MaxRetries)
+	v.nonNegative("channels.outbound.retry_delay_seconds", ch.Outbound.RetryDelaySeconds)
+	limited := make([]string, 0, len(ch.Outbound.RateLimits))
+	for name := range ch.Outbound.RateLimits {
+		limited = append(limited, name)
+	}
+	sort.Strings(limited)
+	for _, name := range limited {
+		if r := ch.Outbound.RateLimits[name]; r < 0 {
+			v.add("channels.outbound.rate_limits."+name, "must not be negative, got %g", r)
+		}
+	}
+	access := make([]string, 0, len(ch.Access))
+	for name := range ch.Access {
+		access = append(access, name)
+	}
+	sort.Strings(access)
+	for _, name := range access {
+		switch name {
+		case "whatsapp", "telegram", "feishu", "discord", "maixcam", "qq", "dingtalk", "slack", "line", "onebot", "web":
+		default:
+			v.add("channels.access."+name, "is not a channel")
+		}
+	}
+
+	v.port("gateway.port", c.Gateway.Port)
+	tokens := make(map[string]struct{}, len(c.Gateway.APITokens))
+	for i, tok := range c.Gateway.APITokens {
+		path := fmt.Sprintf("gateway.api_tokens[%d]", i)
+		if strings.TrimSpace(tok.Token) == "" {
+			v.add(path+".token", "must not be empty")
+		} else if _, dup := tokens[tok.Token]; dup {
+			v.add(path+".token", "duplicate token")
+		}
+		tokens[tok.Token] = struct{}{}
+		if strings.TrimSpace(tok.Role) == "" {
+			v.add(path+".role", "must not be empty")
+		}
+	}
+	v.nonNegative("agents.intake.max_rounds", c.Agents.Intake.MaxRounds)
+	flowIDs := make(map[string]struct{}, len(c.Agents.Intake.Flows))
+	for i, flow := range c.Agents.Intake.Flows {
+		prefix := fmt.Sprintf("agents.intake.flows[%d]", i)
+		if flow.ID == "" {
+			v.add(prefix+".id", "must not be empty")
+		} else if _, dup := flowIDs[flow.ID]; dup {
+			v.add(prefix+".id", "duplicate flow id %q", flow.ID)
+		}
+		flowIDs[flow.ID] = struct{}{}
+		if strings.TrimSpace(flow.Description) == "" {
+			v.add(prefix+".description", "must not be empty")
+		}
+		if len(flow.Fields) == 0 {
+			v.add(prefix+".fields", "must list at least one field")
+		}
+		for j, field := range flow.Fields {
+			fieldPrefix := fmt.Sprintf("%s.fields[%d]", prefix, j)
+			if field.Name == "" {
+				v.add(fieldPrefix+".name", "must not be empty")
+			}
+			if strings.TrimSpace(field.Question) == "" {
+				v.add(fieldPrefix+".question", "must not be empty")
+			}
+		}
+	}
+	if pc := c.Agents.Personas; pc.Enabled {
+		if pc.Default != "" && !validPersonaName(pc.Default) {
+			v.add("agents.personas.default", "invalid persona name %q", pc.Default)
+		}
+		for channel, name := range pc.Channels {
+			if !validPersonaName(name) {
+				v.add("agents.personas.channels."+channel, "invalid persona name %q", name)
+			}
+		}
+	}
+	v.nonNegative("heartbeat.interval", c.Heartbeat.Interval)
+	for i, wh := range c.Hooks.Webhooks {
+		prefix := fmt.Sprintf("hooks.webhooks[%d]", i)
+		if !strings.HasPrefix(wh.URL, "http://") && !strings.HasPrefix(wh.URL, "https://") {
+			v.add(prefix+".url", "must be an http(s) URL, got %q", wh.URL)
+		}
+		for j, event := range wh.Events {
+			switch event {
+			case "message_received", "tool_call", "response_sent", "error":
+			default:
+				v.add(fmt.Sprintf("%s.events[%d]", prefix, j), "must be message_received, tool_call, response_sent or error, got %q", event)
+			}
+		}
+		v.nonNegative(prefix+".timeout_seconds", wh.TimeoutSeconds)
+	}
+	for name, price := range c.Usage.Pricing {
+		if price.InputPerMillion < 0 || price.OutputPerMillion < 0 || price.CachedInputPerMillion < 0 {
+			v.add(fmt.Sprintf("usage.pricing[%q]", name), "prices must be >= 0")
+		}
+	}
+	v.nonNegative("usage.budget.daily_tokens_per_user", c.Usage.Budget.DailyTokensPerUser)
+	if c.Usage.Budget.DailyCostPerUser < 0 {
+		v.add("usage.budget.daily_cost_per_user", "must be >= 0, got %g", c.Usage.Budget.DailyCostPerUser)
+	}
+	if (c.Usage.Budget.DailyTokensPerUser > 0 || c.Usage.Budget.DailyCostPerUser > 0) &&
+		strings.TrimSpace(c.Usage.Budget.FallbackModel) == "" {
+		v.add("usage.budget.fallback_model", "is required when a budget is set")
+	}
+	v.nonNegative("scheduler.timeout_minutes", c.Scheduler.TimeoutMinutes)
+	taskIDs := make(map[string]struct{}, len(c.Scheduler.Tasks))
+	for i, task := range c.Scheduler.Tasks {
+		prefix := fmt.Sprintf("scheduler.tasks[%d]", i)
+		if task.ID == "" {
+			v.add(prefix+".id", "must not be empty")
+		} else if _, dup := taskIDs[task.ID]; dup {
+			v.add(prefix+".id", "duplicate task id %q", task.ID)
+		}
+		taskIDs[task.ID] = struct{}{}
+		if !gronx.IsValid(task.Cron) {
+			v.add(prefix+".cron", "invalid cron expression %q", task.Cron)
+		}
+		if task.Timezone != "" {
+			if _, err := time.LoadLocation(task.Timezone); err != nil {
+				v.add(prefix+".timezone", "unknown time zone %q", task.Timezone)
+			}
+		}
+		if strings.TrimSpace(task.Prompt) == "" {
+			v.add(prefix+".prompt", "must not be empty")
+		}
+		if len(task.Targets) == 0 {
+			v.add(prefix+".targets", "must list at least one chat")
+		}
+		for j, target := range task.Targets {
+			v.chatAddress(fmt.Sprintf("%s.targets[%d]", prefix, j), target)
+		}
+	}
+
+	t := c.Tools
+	v.required(t.Web.Brave.Enabled, "tools.web.brave.api_key", t.Web.Brave.APIKey)
+	v.required(t.Web.Perplexity.Enabled, "tools.web.perplexity.api_key", t.Web.Perplexity.APIKey)
+	v.nonNegative("tools.web.brave.max_results", t.Web.Brave.MaxResults)
+	v.nonNegative("tools.web.duckduckgo.max_results", t.Web.DuckDuckGo.MaxResults)
+	v.nonNegative("tools.web.perplexity.max_results", t.Web.Perplexity.MaxResults)
+	v.required(t.Web.Bing.Enabled, "tools.web.bing.api_key", t.Web.Bing.APIKey)
+	v.required(t.Web.SearXNG.Enabled, "tools.web.searxng.base_url", t.Web.SearXNG.BaseURL)
+	v.nonNegative("tools.web.bing.max_results", t.Web.Bing.MaxResults)
+	v.nonNegative("tools.web.searxng.max_results", t.Web.SearXNG.MaxResults)
+	if b := t.Web.Backend; b != "" {
+		enabled := map[string]bool{
+			"brave":      t.Web.Brave.Enabled,
+			"bing":       t.Web.Bing.Enabled,
+			"searxng":    t.Web.SearXNG.Enabled,
+			"duckduckgo": t.Web.DuckDuckGo.Enabled,
+			"perplexity": t.Web.Perplexity.Enabled,
+		}
+		if on, ok := enabled[b]; !ok {
+			v.add("tools.web.backend", "must be brave, bing, searxng, duckduckgo or perplexity, got %q", b)
+		} else if !on {
+			v.add("tools.web.backend", "%s is not enabled", b)
+		}
+	}
+	v.nonNegative("tools.cron.exec_timeout_minutes", t.Cron.ExecTimeoutMinutes)
+	v.nonNegative("tools.cron.ack_window_minutes", t.Cron.AckWindowMinutes)
+	v.nonNegative("tools.cron.escalate_after_misses", t.Cron.EscalateAfterMisses)
+	for i, link := range t.Cron.Caregivers {
+		prefix := fmt.Sprintf("tools.cron.caregivers[%d]", i)
+		v.chatAddress(prefix+".patient", link.Patient)
+		v.chatAddress(prefix+".caregiver", link.Caregiver)
+	}
+	for i, pattern := range t.Exec.CustomDenyPatterns {
+		if _, err := regexp.Compile(pattern); err != nil {
+			v.add(fmt.Sprintf("tools.exec.custom_deny_patterns[%d]", i), "invalid regular expression: %v", err)
+		}
+	}
+	v.nonNegative("tools.files.max_file_kb", t.Files.MaxFileKB)
+	v.nonNegative("tools.exec.sandbox.timeout_seconds", t.Exec.Sandbox.TimeoutSeconds)
+	v.nonNegative("tools.exec.sandbox.cpu_seconds", t.Exec.Sandbox.CPUSeconds)
+	v.nonNegative("tools.exec.sandbox.memory_mb", t.Exec.Sandbox.MemoryMB)
+	v.nonNegative("tools.approval.timeout_minutes", t.Approval.TimeoutMinutes)
+	v.nonNegative("tools.cache.max_entries", t.Cache.MaxEntries)
+	v.nonNegative("tools.audit.max_arg_chars", t.Audit.MaxArgChars)
+	if t.Shadow.SampleRate < 0 || t.Shadow.SampleRate > 1 {
+		v.add("tools.shadow.sample_rate", "must be between 0 and 1, got %v", t.Shadow.SampleRate)
+	}
+	v.nonNegative("tools.shadow.timeout_seconds", t.Shadow.TimeoutSeconds)
+	if t.Shadow.Enabled && t.Shadow.Model == "" && len(t.Shadow.Tools) == 0 {
+		v.add("tools.shadow", "set model or tools to shadow")
+	}
+	for live, shadow := range t.Shadow.Tools {
+		if shadow == "" || shadow == live {
+			v.add("tools.shadow.tools."+live, "must name a different tool")
+		}
+	}
+	for name, minutes := range t.Cache.TTLMinutes {
+		v.nonNegative("tools.cache.ttl_minutes."+name, minutes)
+	}
+
+	v.nonNegative("tools.summarize.max_tokens", t.Summarize.MaxTokens)
+	v.nonNegative("tools.summarize.summary_tokens", t.Summarize.SummaryTokens)
+	if t.Summarize.Enabled && t.Summarize.SummaryTokens >= t.Summarize.MaxTokens {
+		v.add("tools.summarize.summary_tokens", "must be less than max_tokens (%d), got %d", t.Summarize.MaxTokens, t.Summarize.SummaryTokens)
+	}
+	for i, pattern := range t.Summarize.Tools {
+		if _, err := path.Match(pattern, ""); err != nil {
+			v.add(fmt.Sprintf("tools.summarize.tools[%d]", i), "invalid pattern %q", pattern)
+		}
+	}
+	for i, name := range t.Evidence.Providers {
+		switch name {
+		case "knows", "pubmed", "guidelines":
+		default:
+			v.add(fmt.Sprintf("tools.evidence.providers[%d]", i), "must be knows, pubmed or guidelines, got %q", name)
+		}
+	}
+	v.nonNegative("tools.evidence.pubmed.timeout_seconds", t.Evidence.PubMed.TimeoutSeconds)
+	v.nonNegative("tools.drug_interactions.timeout_seconds", t.DrugInteractions.TimeoutSeconds)
+	v.nonNegative("tools.variants.timeout_seconds", t.Variants.TimeoutSeconds)
+	v.nonNegative("tools.reimbursement.timeout_seconds", t.Reimbursement.TimeoutSeconds)
+	if t.Reimbursement.Enabled && t.Reimbursement.DatasetPath == "" && t.Reimbursement.APIURL == "" {
+		v.add("tools.reimbursement", "needs dataset_path or api_url when enabled")
+	}
+	if t.Referrals.Enabled {
+		if !t.Approval.Enabled {
+			v.add("tools.referrals.enabled", "requires tools.approval.enabled, as every referral must be approved")
+		}
+		if len(t.Referrals.Destinations) == 0 {
+			v.add("tools.referrals.destinations", "needs at least one destination when enabled")
+		}
+	}
+	for name, d := range t.Referrals.Destinations {
+		prefix := "tools.referrals.destinations." + name
+		if !strings.HasPrefix(d.URL, "http://") && !strings.HasPrefix(d.URL, "https://") {
+			v.add(prefix+".url", "must be an http or https URL, got %q", d.URL)
+		}
+		switch strings.ToUpper(d.Method) {
+		case "", "POST", "PUT":
+		default:
+			v.add(prefix+".method", "must be POST or PUT, got %q", d.Method)
+		}
+		v.nonNegative(prefix+".timeout_seconds", d.TimeoutSeconds)
+	}
+	v.nonNegative("tools.ocr.timeout_seconds", t.OCR.TimeoutSeconds)
+	v.nonNegative("tools.fhir.timeout_seconds", t.FHIR.TimeoutSeconds)
+	if t.FHIR.Enabled {
+		v.required(true, "tools.fhir.base_url", t.FHIR.BaseURL)
+		switch t.FHIR.Auth.Type {
+		case "", "none":
+		case "bearer":
+			v.required(true, "tools.fhir.auth.token", t.FHIR.Auth.Token)
+		case "client_credentials":
+			v.required(true, "tools.fhir.auth.client_id", t.FHIR.Auth.ClientID)
+			v.required(true, "tools.fhir.auth.client_secret", t.FHIR.Auth.ClientSecret)
+		case "smart_backend":
+			v.required(true, "tools.fhir.auth.client_id", t.FHIR.Auth.ClientID)
+			v.required(true, "tools.fhir.auth.private_key_path", t.FHIR.Auth.PrivateKeyPath)
+		default:
+			v.add("tools.fhir.auth.type", "must be none, bearer, client_credentials or smart_backend, got %q", t.FHIR.Auth.Type)
+		}
+	}
+	if t.Medications.Timezone != "" {
+		if _, err := time.LoadLocation(t.Medications.Timezone); err != nil {
+			v.add("tools.medications.timezone", "unknown time zone %q", t.Medications.Timezone)
+		}
+	}
+	if t.RAG.Enabled {
+		if t.RAG.ChunkChars < 200 {
+			v.add("tools.rag.chunk_chars", "must be at least 200, got %d", t.RAG.ChunkChars)
+		}
+		if t.RAG.ChunkOverlap < 0 || t.RAG.ChunkOverlap >= t.RAG.ChunkChars/2 {
+			v.add("tools.rag.chunk_overlap", "must be between 0 and half of chunk_chars, got %d", t.RAG.ChunkOverlap)
+		}
+		if t.RAG.MaxPDFMB <= 0 {
+			v.add("tools.rag.max_pdf_mb", "must be positive, got %d", t.RAG.MaxPDFMB)
+		}
+		v.nonNegative("tools.rag.sync_minutes", t.RAG.SyncMinutes)
+		for i, src := range t.RAG.Sources {
+			field := fmt.Sprintf("tools.rag.sources[%d]", i)
+			if strings.HasPrefix(src, "s3://") {
+				if bucket, _, _ := strings.Cut(strings.TrimPrefix(src, "s3://"), "/"); bucket == "" {
+					v.add(field, "must name a bucket, got %q", src)
+				}
+			} else if strings.TrimSpace(src) == "" {
+				v.add(field, "must not be empty")
+			}
+		}
+	}
+	if sp := t.Scratchpad; sp.Enabled {
+		if sp.MaxEntries <= 0 {
+			v.add("tools.scratchpad.max_entries", "must be positive, got %d", sp.MaxEntries)
+		}
+		if sp.MaxValueChars <= 0 {
+			v.add("tools.scratchpad.max_value_chars", "must be positive, got %d", sp.MaxValueChars)
+		}
+	}
+	if ac := t.AnswerCache; ac.Enabled {
+		if ac.Threshold <= 0 || ac.Threshold > 1 {
+			v.add("tools.answer_cache.threshold", "must be in (0, 1], got %g", ac.Threshold)
+		}
+		v.nonNegative("tools.answer_cache.ttl_hours", ac.TTLHours)
+		v.nonNegative("tools.answer_cache.max_entries", ac.MaxEntries)
+		v.nonNegative("tools.answer_cache.min_chars", ac.MinChars)
+		v.embedding(c.embedding())
+	}
+	if kb := t.KnowledgeBase; kb.Enabled {
+		switch kb.Store {
+		case "", "sqlite":
+		case "qdrant":
+			v.required(true, "tools.knowledge_base.qdrant.url", kb.Qdrant.URL)
+		case "pgvector":
+			v.required(true, "tools.knowledge_base.pgvector.dsn", kb.PGVector.DSN)
+		default:
+			v.add("tools.knowledge_base.store", "must be sqlite, qdrant or pgvector; got %q", kb.Store)
+		}
+		v.embedding(c.embedding())
+		if kb.ChunkChars < 200 {
+			v.add("tools.knowledge_base.chunk_chars", "must be at least 200, got %d", kb.ChunkChars)
+		}
+		if kb.ChunkOverlap < 0 || kb.ChunkOverlap >= kb.ChunkChars/2 {
+			v.add("tools.knowledge_base.chunk_overlap", "must be between 0 and half of chunk_chars, got %d", kb.ChunkOverlap)
+		}
+		if kb.MaxFileMB <= 0 {
+			v.add("tools.knowledge_base.max_file_mb", "must be positive, got %d", kb.MaxFileMB)
+		}
+	}
+	if t.OCR.Enabled {
+		switch t.OCR.Backend {
+		case "", "paddle":
+			v.required(true, "tools.ocr.paddle_url", t.OCR.PaddleURL)
+		case "baidu":
+			v.required(true, "tools.ocr.baidu_api_key", t.OCR.BaiduAPIKey)
+			v.required(true, "tools.ocr.baidu_secret_key", t.OCR.BaiduSecretKey)
+		default:
+			v.add("tools.ocr.backend", "must be \"paddle\" or \"baidu\", got %q", t.OCR.Backend)
+		}
+	}
+	v.nonNegative("tools.tts.max_chars", t.TTS.MaxChars)
+	v.nonNegative("tools.tts.timeout_seconds", t.TTS.TimeoutSeconds)
+	if t.TTS.Enabled {
+		switch t.TTS.Backend {
+		case "", "edge":
+		case "azure":
+			v.required(true, "tools.tts.azure_key", t.TTS.AzureKey)
+			if t.TTS.AzureEndpoint == "" {
+				v.required(true, "tools.tts.azure_region", t.TTS.AzureRegion)
+			}
+		case "local":
+			if len(t.TTS.LocalCommand) == 0 {
+				v.add("tools.tts.local_command", "is required when the section is enabled")
+			}
+		default:
+			v.add("tools.tts.backend", "must be \"edge\", \"azure\" or \"local\", got %q", t.TTS.Backend)
+		}
+	}
+	v.nonNegative("tools.jobs.timeout_minutes", t.Jobs.TimeoutMinutes)
+	v.nonNegative("tools.jobs.retention_minutes", t.Jobs.RetentionMinutes)
+	if t.FollowUps.Max < 0 || t.FollowUps.Max > 5 {
+		v.add("tools.follow_ups.max", "must be between 0 and 5, got %d", t.FollowUps.Max)
+	}
+	for i, pattern := range t.FollowUps.EvidenceTools {
+		if _, err := path.Match(pattern, ""); err != nil {
+			v.add(fmt.Sprintf("tools.follow_ups.evidence_tools[%d]", i), "invalid pattern %q", pattern)
+		}
+	}
+	for name, limits := range map[string]map[string]int{
+		"per_session":    t.Quotas.PerSession,
+		"per_user_daily": t.Quotas.PerUserDaily,
+	} {
+		for pattern, limit := range limits {
+			if _, err := path.Match(pattern, ""); err != nil {
+				v.add("tools.quotas."+name+"."+pattern, "invalid pattern %q", pattern)
+			}
+			if limit <= 0 {
+				v.add("tools.quotas."+name+"."+pattern, "must be positive, got %d", limit)
+			}
+		}
+	}
+	v.nonNegative("tools.concurrency.max_concurrent", t.Concurrency.MaxConcurrent)
+	v.nonNegative("tools.concurrency.queue_timeout_seconds", t.Concurrency.QueueTimeoutSeconds)
+	for pattern, limit := range t.Concurrency.PerTool {
+		if _, err := path.Match(pattern, ""); err != nil {
+			v.add("tools.concurrency.per_tool."+pattern, "invalid pattern %q", pattern)
+		}
+		if limit <= 0 {
+			v.add("tools.concurrency.per_tool."+pattern, "must be positive, got %d", limit)
+		}
+	}
+
+	for name, server := range t.MCP.Servers {
+		prefix := "tools.mcp.servers." + name
+		switch {
+		case server.Command == "" && server.URL == "":
+			v.add(prefix, "command or url is required")
+		case server.Command != "" && server.URL != "":
+			v.add(prefix, "set either command or url, not both")
+		}
+		v.nonNegative(prefix+".timeout_seconds", server.TimeoutSeconds)
+	}
+
+	for name, plugin := range t.Plugins {
+		prefix := "tools.plugins." + name
+		v.required(!plugin.Disabled, prefix+".command", plugin.Command)
+		v.nonNegative(prefix+".timeout_seconds", plugin.TimeoutSeconds)
+	}
+
+	for i, pattern := range t.MCP.Export.Allow {
+		if _, err := path.Match(pattern, ""); err != nil {
+			v.add(fmt.Sprintf("tools.mcp.export.allow[%d]", i), "invalid pattern %q", pattern)
+		}
+	}
+	for i, pattern := range t.MCP.Export.Deny {
+		if _, err := path.Match(pattern, ""); err != nil {
+			v.add(fmt.Sprintf("tools.mcp.export.deny[%d]", i), "invalid pattern %q", pattern)
+		}
+	}
+
+	for role, rc := range t.Roles {
+		for i, pattern := range rc.Allow {
+			if _, err := path.Match(pattern, ""); err != nil {
+				v.add(fmt.Sprintf("tools.roles.%s.allow[%d]", role, i), "invalid pattern %q", pattern)
+			}
+		}
+		for i, pattern := range rc.Deny {
+			if _, err := path.Match(pattern, ""); err != nil {
+				v.add(fmt.Sprintf("tools.roles.%s.deny[%d]", role, i), "invalid pattern %q", pattern)
+			}
+		}
+	}
+
+	for name, p := range t.Pipelines {
+		prefix := "tools.pipelines." + name
+		if strings.TrimSpace(p.Description) == "" {
+			v.add(prefix+".description", "is required")
+		}
+		if len(p.Steps) == 0 {
+			v.add(prefix+".steps", "must have at least one step")
+		}
+		ids := make(map[string]bool)
+		for i, step := range p.Steps {
+			stepPath := fmt.Sprintf("%s.steps[%d]", prefix, i)
+			if step.Tool == "" {
+				v.add(stepPath+".tool", "is required")
+			} else if _, ok := t.Pipelines[step.Tool]; ok {
+				v.add(stepPath+".tool", "pipelines cannot call pipelines (%s)", step.Tool)
+			}
+			if step.ID != "" {
+				if ids[step.ID] {
+					v.add(stepPath+".id", "duplicate step id %q", step.ID)
+				}
+				ids[step.ID] = true
+			}
+		}
+	}
+
+	k := t.Knows
+	v.required(k.Enabled, "tools.knows.api_key", k.APIKey)
+	v.required(k.Enabled, "tools.knows.api_base_url", k.APIBaseURL)
+	for i, scope := range k.DefaultDataScope {
+		if _, ok := validKnowsDataScopes[strings.ToUpper(strings.TrimSpace(scope))]; !ok {
+			v.add(fmt.Sprintf("tools.knows.default_data_scope[%d]", i), "must be one of PAPER, PAPER_CN, GUIDE, MEETING; got %q", scope)
+		}
+	}
+	v.nonNegative("tools.knows.request_timeout_seconds", k.RequestTimeoutSeconds)
+	v.nonNegative("tools.knows.max_retries", k.MaxRetries)
+	v.nonNegative("tools.knows.retry_backoff_milliseconds", k.RetryBackoffMilliseconds)
+	v.nonNegative("tools.knows.batch_concurrency", k.BatchConcurrency)
+	v.nonNegative("tools.knows.cache_ttl_minutes", k.CacheTTLMinutes)
+
+	if len(v.errs) == 0 {
+		return nil
+	}
+	return v.errs
+}
@@ -0,0 +1,205 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeConfigFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	return path
+}
+
+func TestDefaultConfig_Validates(t *testing.T) {
+	if err := DefaultConfig().Validate(); err != nil {
+		t.Fatalf("default config should be valid: %v", err)
+	}
+}
+
+func TestLoadConfig_UnknownKeySuggestsField(t *testing.T) {
+	path := writeConfigFile(t, "config.json", `{"tools": {"knows": {"api_kye": "x"}}, "gatway": {}}`)
+
+	_, err := LoadConfig(path)
+	var verrs ValidationErrors
+	if !errors.As(err, &verrs) {
+		t.Fatalf("expected ValidationErrors, got %v", err)
+	}
+	if len(verrs) != 2 {
+		t.Fatalf("expected 2 errors, got %d: %v", len(verrs), err)
+	}
+	if verrs[0].Path != "gatway" || !strings.Contains(verrs[0].Message, `"gateway"`) {
+		t.Errorf("unexpected first error: %v", verrs[0])
+	}
+	if verrs[1].Path != "tools.knows.api_kye" || !strings.Contains(verrs[1].Message, `"api_key"`) {
+		t.Errorf("unexpected second error: %v", verrs[1])
+	}
+}
+
+func TestLoadConfig_EmbeddedAndModelFieldsAreKnown(t *testing.T) {
+	path := writeConfigFile(t, "config.json", `{
+		"providers": {"openai": {"api_key": "k", "web_search": false}},
+		"agents": {"list": [{"id": "a", "model": {"primary": "m", "fallbacks": ["n"]}}]},
+		"session": {"identity_links": {"alice": ["telegram:1"]}}
+	}`)
+
+	if _, err := LoadConfig(path); err != nil {
+		t.Fatalf("LoadConfig() error: %v", err)
+	}
+}
+
+func TestLoadConfig_TypeErrorHasPath(t *testing.T) {
+	path := writeConfigFile(t, "config.json", `{"tools": {"knows": {"max_retries": "three"}}}`)
+
+	_, err := LoadConfig(path)
+	if err == nil || !strings.Contains(err.Error(), "tools.knows.max_retries") {
+		t.Fatalf("expected error mentioning field path, got %v", err)
+	}
+}
+
+func TestLoadConfig_SyntaxErrorHasLine(t *testing.T) {
+	path := writeConfigFile(t, "config.json", "{\n  \"gateway\": {\n    \"port\": ,\n  }\n}")
+
+	_, err := LoadConfig(path)
+	if err == nil || !strings.Contains(err.Error(), "line 3") {
+		t.Fatalf("expected error mentioning line 3, got %v", err)
+	}
+}
+
+func TestValidate_ReportsAllProblems(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Channels.Telegram.Enabled = true
+	cfg.Channels.WhatsApp.Enabled = true
+	cfg.Channels.WhatsApp.PhoneNumberID = "104857600"
+	cfg.Channels.WhatsApp.AccessToken = "EAAG-token"
+	cfg.Channels.Web.Path = "chat"
+	cfg.Channels.Access = map[string]AccessConfig{"telegram": {Pairing: true}, "wechat": {Pairing: true}}
+	cfg.Channels.Outbound.RateLimits["slack"] = -1
+	cfg.Gateway.Port = 70000
+	cfg.Session.DMScope = "per-user"
+	cfg.Session.Store = "postgres"
+	cfg.Tools.Exec.CustomDenyPatterns = []string{"("}
+	cfg.Tools.Web.Backend = "google"
+	cfg.Tools.Knows.DefaultDataScope = []string{"BLOG"}
+	cfg.Tools.Evidence.Providers = []string{"knows", "cochrane"}
+	cfg.Tools.Shadow.SampleRate = 1.5
+	cfg.Tools.Shadow.Tools = map[string]string{"knows_ai_search": "knows_ai_search"}
+	cfg.Tools.Pipelines = map[string]PipelineConfig{
+		"research": {Steps: []PipelineStepConfig{{Tool: "research"}}},
+	}
+	cfg.Tools.OCR.Enabled = true
+	cfg.Tools.OCR.Backend = "baidu"
+	cfg.Tools.TTS.Enabled = true
+	cfg.Tools.TTS.Backend = "local"
+	cfg.Tools.FHIR.Enabled = true
+	cfg.Tools.FHIR.Auth.Type = "bearer"
+	cfg.Tools.RAG.ChunkOverlap = 1000
+	cfg.Tools.KnowledgeBase.Enabled = true
+	cfg.Tools.KnowledgeBase.Store = "pgvector"
+	cfg.Tools.Medications.Timezone = "Beijing"
+	cfg.Tools.Reimbursement.Enabled = true
+	cfg.Tools.Reimbursement.DatasetPath = ""
+	cfg.Tools.Referrals.Enabled = true
+	cfg.Tools.Referrals.Destinations = map[string]ReferralDestinationConfig{"ruijin": {URL: "ruijin.example.com/referrals"}}
+	cfg.Hooks.Webhooks = []WebhookConfig{{URL: "crm.example.com/hook", Events: []string{"tool_call", "message_sent"}}}
+	cfg.Scheduler.Tasks = []ScheduledTaskConfig{
+		{ID: "checkin", Cron: "every sunday", Timezone: "Beijing", Prompt: "Check in", Targets: []string{"telegram"}},
+		{ID: "checkin", Cron: "0 19 * * 0"},
+	}
+	cfg.Agents.Intake.Flows = []IntakeFlowConfig{{ID: "treatment", Fields: []IntakeFieldConfig{{Name: "stage"}}}}
+	cfg.Tools.AnswerCache.Enabled = true
+	cfg.Tools.AnswerCache.Threshold = 1.5
+	cfg.Usage.Pricing = map[string]ModelPrice{"gpt-4o": {InputPerMillion: -2.5}}
+	cfg.Usage.Budget.DailyTokensPerUser = 200000
+	hot, topP := 2.5, 0.0
+	cfg.Agents.ChannelParams = map[string]ModelParams{"web": {Temperature: &hot}}
+	cfg.Agents.Personas.Params = map[string]ModelParams{"clinician": {TopP: &topP, MaxTokens: -1, ReasoningEffort: "max", ThinkingBudget: 500}}
+	cfg.Providers.Ollama.ToolMode = "react"
+	cfg.Providers.Azure.APIBase = "https://hospital.openai.azure.com"
+	cfg.Providers.Azure.AuthMethod = "client_secret"
+	cfg.Providers.Azure.TenantID = "tenant"
+
+	err := cfg.Validate()
+	var verrs ValidationErrors
+	if !errors.As(err, &verrs) {
+		t.Fatalf("expected ValidationErrors, got %v", err)
+	}
+
+	want := []string{
+		"channels.whatsapp.app_secret",
+		"channels.whatsapp.verify_token",
+		"channels.telegram.token",
+		"channels.web.path",
+		"channels.outbound.rate_limits.slack",
+		"channels.access.wechat",
+		"gateway.port",
+		"session.dm_scope",
+		"session.store",
+		"tools.exec.custom_deny_patterns[0]",
+		"tools.web.backend",
+		"tools.knows.default_data_scope[0]",
+		"tools.evidence.providers[1]",
+		"tools.shadow.sample_rate",
+		"tools.shadow.tools.knows_ai_search",
+		"tools.pipelines.research.description",
+		"tools.pipelines.research.steps[0].tool",
+		"tools.ocr.baidu_api_key",
+		"tools.ocr.baidu_secret_key",
+		"tools.tts.local_command",
+		"tools.fhir.base_url",
+		"tools.fhir.auth.token",
+		"tools.rag.chunk_overlap",
+		"tools.knowledge_base.pgvector.dsn",
+		"tools.medications.timezone",
+		"tools.reimbursement",
+		"tools.referrals.enabled",
+		"tools.referrals.destinations.ruijin.url",
+		"hooks.webhooks[0].url",
+		"hooks.webhooks[0].events[1]",
+		"scheduler.tasks[0].cron",
+		"scheduler.tasks[0].timezone",
+		"scheduler.tasks[0].targets[0]",
+		"scheduler.tasks[1].id",
+		"scheduler.tasks[1].prompt",
+		"scheduler.tasks[1].targets",
+		"agents.intake.flows[0].description",
+		"agents.intake.flows[0].fields[0].question",
+		"tools.answer_cache.threshold",
+		`usage.pricing["gpt-4o"]`,
+		"usage.budget.fallback_model",
+		"agents.channel_params.web.temperature",
+		"agents.personas.params.clinician.top_p",
+		"agents.personas.params.clinician.max_tokens",
+		"agents.personas.params.clinician.reasoning_effort",
+		"agents.personas.params.clinician.thinking_budget",
+		"providers.ollama.tool_mode",
+		"providers.azure.client_id",
+		"providers.azure.client_secret",
+	}
+	got := map[string]bool{}
+	for _, fe := range verrs {
+		got[fe.Path] = true
+	}
+	for _, path := range want {
+		if !got[path] {
+			t.Errorf("missing error for %s in:\n%v", path, err)
+		}
+	}
+}
+
+func TestValidate_BindingToUnknownAgent(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Agents.List = []AgentConfig{{ID: "main"}}
+	cfg.Bindings = []AgentBinding{{AgentID: "sales", Match: BindingMatch{Channel: "telegram"}}}
+
+	err := cfg.Validate()
+	if err == nil || !strings.Contains(err.Error(), `bindings[0].agent_id: references unknown agent "sales"`) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
@@ -7,6 +7,8 @@ var internalChannels = map[string]struct{}{
 	"cli":      {},
 	"system":   {},
 	"subagent": {},
+	"mcp":      {},
+	"openai":   {},
 }
 
 // IsInternalChannel returns true if the channel is an internal channel.
@@ -29,6 +29,8 @@ type CronPayload struct {
 	Deliver bool   `json:"deliver"`
 	Channel string `json:"channel,omitempty"`
 	To      string `json:"to,omitempty"`
+	// RequiresAck marks a reminder the user must acknowledge (e.g. "taken").
+	RequiresAck bool `json:"requiresAck,omitempty"`
 }
 
 type CronJobState struct {
@@ -36,6 +38,11 @@ type CronJobState struct {
 	LastRunAtMS *int64 `json:"lastRunAtMs,omitempty"`
 	LastStatus  string `json:"lastStatus,omitempty"`
 	LastError   string `json:"lastError,omitempty"`
+	// AckDueAtMS is set while a delivered reminder awaits acknowledgment.
+	AckDueAtMS  *int64 `json:"ackDueAtMs,omitempty"`
+	LastAckAtMS *int64 `json:"lastAckAtMs,omitempty"`
+	// MissedAcks counts consecutive reminders that were not acknowledged.
+	MissedAcks int `json:"missedAcks,omitempty"`
 }
 
 type CronJob struct {
@@ -57,10 +64,20 @@ type CronStore struct {
 
 type JobHandler func(job *CronJob) (string, error)
 
+// MissHandler is called when a reminder's acknowledgment window passes
+// without an acknowledgment. job.State.MissedAcks includes this miss.
+type MissHandler func(job *CronJob)
+
+// DefaultAckWindow is how long a reminder may go unacknowledged before it
+// counts as missed.
+const DefaultAckWindow = time.Hour
+
 type CronService struct {
 	storePath string
 	store     *CronStore
 	onJob     JobHandler
+	onMiss    MissHandler
+	ackWindow time.Duration
 	mu        sync.RWMutex
 	running   bool
 	stopChan  chan struct{}
@@ -71,6 +88,7 @@ func NewCronService(storePath string, onJob JobHandler) *CronService {
 	cs := &CronService{
 		storePath: storePath,
 		onJob:     onJob,
+		ackWindow: DefaultAckWindow,
 		gronx:     gronx.New(),
 	}
 	// Initialize and load store on creation
@@ -141,6 +159,7 @@ func (cs *CronService) checkJobs() {
 
 	now := time.Now().UnixMilli()
 	var dueJobIDs []string
+	missed := cs.expireAcksUnsafe(now)
 
 	// Collect jobs that are due (we need to copy them to execute outside lock)
 	for i := range cs.store.Jobs {
@@ -165,8 +184,15 @@ func (cs *CronService) checkJobs() {
 		log.Printf("[cron] failed to save store: %v", err)
 	}
 
+	onMiss := cs.onMiss
 	cs.mu.Unlock()
 
+	if onMiss != nil {
+		for i := range missed {
+			onMiss(&missed[i])
+		}
+	}
+
 	// Execute jobs outside lock.
 	for _, jobID := range dueJobIDs {
 		cs.executeJobByID(jobID)
@@ -197,7 +223,19 @@ func (cs *CronService) executeJobByID(jobID string) {
 		_, err = cs.onJob(callbackJob)
 	}
 
-	// Now acquire lock to update state
+	missed := cs.recordRun(jobID, startTime, err)
+
+	cs.mu.RLock()
+	onMiss := cs.onMiss
+	cs.mu.RUnlock()
+	if missed != nil && onMiss != nil {
+		onMiss(missed)
+	}
+}
+
+// recordRun updates a job's state after it ran. It returns a copy of the
+// job if the run found the previous reminder still unacknowledged.
+func (cs *CronService) recordRun(jobID string, startTime int64, err error) *CronJob {
 	cs.mu.Lock()
 	defer cs.mu.Unlock()
 
@@ -210,18 +248,30 @@ func (cs *CronService) executeJobByID(jobID string) {
 	}
 	if job == nil {
 		log.Printf("[cron] job %s disappeared before state update", jobID)
-		return
+		return nil
 	}
 
 	job.State.LastRunAtMS = &startTime
 	job.UpdatedAtMS = time.Now().UnixMilli()
 
+	var missed *CronJob
 	if err != nil {
 		job.State.LastStatus = "error"
 		job.State.LastError = err.Error()
 	} else {
 		job.State.LastStatus = "ok"
 		job.State.LastError = ""
+		if job.Payload.RequiresAck {
+			// A reminder that fires again while the previous one is still
+			// unacknowledged counts that one as missed.
+			if job.State.AckDueAtMS != nil {
+				job.State.MissedAcks++
+				missedCopy := *job
+				missed = &missedCopy
+			}
+			due := time.Now().Add(cs.ackWindow).UnixMilli()
+			job.State.AckDueAtMS = &due
+		}
 	}
 
 	// Compute next run time
@@ -240,6 +290,31 @@ func (cs *CronService) executeJobByID(jobID string) {
 	if err := cs.saveStoreUnsafe(); err != nil {
 		log.Printf("[cron] failed to save store: %v", err)
 	}
+	return missed
+}
+
+// expireAcksUnsafe counts reminders whose acknowledgment window has passed
+// as missed and returns copies of them. Finished one-time reminders are
+// removed once missed.
+func (cs *CronService) expireAcksUnsafe(nowMS int64) []CronJob {
+	var missed []CronJob
+	var finished []string
+	for i := range cs.store.Jobs {
+		job := &cs.store.Jobs[i]
+		if job.State.AckDueAtMS == nil || *job.State.AckDueAtMS > nowMS {
+			continue
+		}
+		job.State.AckDueAtMS = nil
+		job.State.MissedAcks++
+		missed = append(missed, *job)
+		if job.Schedule.Kind == "at" && !job.Enabled {
+			finished = append(finished, job.ID)
+		}
+	}
+	for _, id := range finished {
+		cs.removeJobUnsafe(id)
+	}
+	return missed
 }
 
 func (cs *CronService) computeNextRun(schedule *CronSchedule, nowMS int64) *int64 {
@@ -263,8 +338,17 @@ func (cs *CronService) computeNextRun(schedule *CronSchedule, nowMS int64) *int6
 			return nil
 		}
 
-		// Use gronx to calculate next run time
+		// Use gronx to calculate next run time, in the schedule's time
+		// zone so "0 8 * * *" means 8am where the user is.
 		now := time.UnixMilli(nowMS)
+		if schedule.TZ != "" {
+			loc, err := time.LoadLocation(schedule.TZ)
+			if err != nil {
+				log.Printf("[cron] unknown time zone '%s': %v", schedule.TZ, err)
+				return nil
+			}
+			now = now.In(loc)
+		}
 		nextTime, err := gronx.NextTickAfter(schedule.Expr, now, false)
 		if err != nil {
 			log.Printf("[cron] failed to compute next run for expr '%s': %v", schedule.Expr, err)
@@ -312,6 +396,82 @@ func (cs *CronService) SetOnJob(handler JobHandler) {
 	cs.onJob = handler
 }
 
+// SetOnMiss sets the handler for reminders that were not acknowledged.
+func (cs *CronService) SetOnMiss(handler MissHandler) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	cs.onMiss = handler
+}
+
+// SetAckWindow sets how long a reminder may go unacknowledged before it
+// counts as missed.
+func (cs *CronService) SetAckWindow(window time.Duration) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if window > 0 {
+		cs.ackWindow = window
+	}
+}
+
+// Acknowledge records that the user acted on a reminder delivered to
+// channel/to and resets its missed count. With an empty jobID the most
+// recently delivered pending reminder for that chat is acknowledged.
+func (cs *CronService) Acknowledge(channel, to, jobID string) (*CronJob, error) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	var target *CronJob
+	for i := range cs.store.Jobs {
+		job := &cs.store.Jobs[i]
+		if !job.Payload.RequiresAck || job.Payload.Channel != channel || job.Payload.To != to {
+			continue
+		}
+		if jobID != "" {
+			if job.ID == jobID {
+				target = job
+				break
+			}
+			continue
+		}
+		if job.State.AckDueAtMS == nil {
+			continue
+		}
+		if target == nil || lastRun(job) > lastRun(target) {
+			target = job
+		}
+	}
+	if target == nil {
+		if jobID != "" {
+			return nil, fmt.Errorf("reminder %s not found", jobID)
+		}
+		return nil, fmt.Errorf("no reminder is waiting for acknowledgment")
+	}
+
+	now := time.Now().UnixMilli()
+	target.State.AckDueAtMS = nil
+	target.State.LastAckAtMS = &now
+	target.State.MissedAcks = 0
+	target.UpdatedAtMS = now
+	// One-time reminders are kept until acknowledged; drop them now.
+	if target.Schedule.Kind == "at" && !target.Enabled {
+		ack := *target
+		cs.removeJobUnsafe(target.ID)
+		return &ack, nil
+	}
+	if err := cs.saveStoreUnsafe(); err != nil {
+		return nil, err
+	}
+	ack := *target
+	return &ack, nil
+}
+
+func lastRun(job *CronJob) int64 {
+	if job.State.LastRunAtMS == nil {
+		return 0
+	}
+	return *job.State.LastRunAtMS
+}
+
 func (cs *CronService) loadStore() error {
 	cs.store = &CronStore{
 		Version: 1,
@@ -380,6 +540,40 @@ func (cs *CronService) AddJob(name string, schedule CronSchedule, message string
 	return &job, nil
 }
 
+// PutJob adds job under its own ID, or replaces the job with that ID. A
+// replaced job keeps its run state; the next run is computed afresh.
+func (cs *CronService) PutJob(job CronJob) (*CronJob, error) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	now := time.Now().UnixMilli()
+	job.CreatedAtMS = now
+	job.UpdatedAtMS = now
+	index := -1
+	for i := range cs.store.Jobs {
+		if cs.store.Jobs[i].ID == job.ID {
+			index = i
+			job.CreatedAtMS = cs.store.Jobs[i].CreatedAtMS
+			job.State = cs.store.Jobs[i].State
+			break
+		}
+	}
+	job.State.NextRunAtMS = nil
+	if job.Enabled {
+		job.State.NextRunAtMS = cs.computeNextRun(&job.Schedule, now)
+	}
+
+	if index >= 0 {
+		cs.store.Jobs[index] = job
+	} else {
+		cs.store.Jobs = append(cs.store.Jobs, job)
+	}
+	if err := cs.saveStoreUnsafe(); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
 func (cs *CronService) UpdateJob(job *CronJob) error {
 	cs.mu.Lock()
 	defer cs.mu.Unlock()
@@ -5,6 +5,7 @@ import (
 	"path/filepath"
 	"runtime"
 	"testing"
+	"time"
 )
 
 func TestSaveStore_FilePermissions(t *testing.T) {
@@ -33,6 +34,116 @@ func TestSaveStore_FilePermissions(t *testing.T) {
 	}
 }
 
+func newAckJob(t *testing.T, cs *CronService, schedule CronSchedule) *CronJob {
+	t.Helper()
+	job, err := cs.AddJob("take meds", schedule, "Take your meds", true, "telegram", "42")
+	if err != nil {
+		t.Fatalf("AddJob failed: %v", err)
+	}
+	job.Payload.RequiresAck = true
+	job.DeleteAfterRun = false
+	if err := cs.UpdateJob(job); err != nil {
+		t.Fatalf("UpdateJob failed: %v", err)
+	}
+	return job
+}
+
+func TestAcknowledge_ResetsMissedCount(t *testing.T) {
+	cs := NewCronService(filepath.Join(t.TempDir(), "jobs.json"), nil)
+	var missed []int
+	cs.SetOnMiss(func(job *CronJob) { missed = append(missed, job.State.MissedAcks) })
+	job := newAckJob(t, cs, CronSchedule{Kind: "every", EveryMS: int64Ptr(60000)})
+
+	// Each run while the previous reminder is unacknowledged is a miss.
+	cs.executeJobByID(job.ID)
+	cs.executeJobByID(job.ID)
+	cs.executeJobByID(job.ID)
+	if len(missed) != 2 || missed[1] != 2 {
+		t.Fatalf("expected two consecutive misses, got %v", missed)
+	}
+
+	acked, err := cs.Acknowledge("telegram", "42", "")
+	if err != nil {
+		t.Fatalf("Acknowledge failed: %v", err)
+	}
+	if acked.State.MissedAcks != 0 || acked.State.AckDueAtMS != nil || acked.State.LastAckAtMS == nil {
+		t.Errorf("unexpected state after ack: %+v", acked.State)
+	}
+
+	if _, err := cs.Acknowledge("telegram", "42", ""); err == nil {
+		t.Error("expected error when nothing awaits acknowledgment")
+	}
+	if _, err := cs.Acknowledge("telegram", "other", job.ID); err == nil {
+		t.Error("expected error when acknowledging from another chat")
+	}
+}
+
+func TestExpireAcks_CountsMissAndDropsFinishedOneTimeReminder(t *testing.T) {
+	cs := NewCronService(filepath.Join(t.TempDir(), "jobs.json"), nil)
+	cs.SetAckWindow(time.Millisecond)
+	at := time.Now().UnixMilli()
+	job := newAckJob(t, cs, CronSchedule{Kind: "at", AtMS: &at})
+
+	cs.executeJobByID(job.ID)
+	if jobs := cs.ListJobs(true); len(jobs) != 1 || jobs[0].State.AckDueAtMS == nil {
+		t.Fatalf("expected one-time reminder kept while awaiting ack, got %+v", jobs)
+	}
+
+	cs.mu.Lock()
+	missed := cs.expireAcksUnsafe(time.Now().Add(time.Second).UnixMilli())
+	cs.mu.Unlock()
+	if len(missed) != 1 || missed[0].State.MissedAcks != 1 {
+		t.Fatalf("expected one missed reminder, got %+v", missed)
+	}
+	if jobs := cs.ListJobs(true); len(jobs) != 0 {
+		t.Errorf("expected missed one-time reminder to be removed, got %d jobs", len(jobs))
+	}
+}
+
 func int64Ptr(v int64) *int64 {
 	return &v
 }
+
+func TestComputeNextRun_UsesScheduleTimeZone(t *testing.T) {
+	cs := NewCronService(filepath.Join(t.TempDir(), "jobs.json"), nil)
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	next := cs.computeNextRun(&CronSchedule{Kind: "cron", Expr: "0 8 * * *", TZ: "Asia/Shanghai"}, now.UnixMilli())
+	if next == nil {
+		t.Fatal("no next run")
+	}
+	// 8am in Shanghai is midnight UTC.
+	if got, want := time.UnixMilli(*next).UTC(), time.Date(2024, 5, 2, 0, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("next run = %v, want %v", got, want)
+	}
+
+	if next := cs.computeNextRun(&CronSchedule{Kind: "cron", Expr: "0 8 * * *", TZ: "Mars/Olympus"}, now.UnixMilli()); next != nil {
+		t.Errorf("unknown time zone scheduled a run at %v", time.UnixMilli(*next))
+	}
+}
+
+func TestPutJob_ReplacesAndKeepsState(t *testing.T) {
+	cs := NewCronService(filepath.Join(t.TempDir(), "jobs.json"), nil)
+	job := CronJob{ID: "weekly", Name: "check-in", Enabled: true, Schedule: CronSchedule{Kind: "cron", Expr: "0 9 * * 1"}}
+	if _, err := cs.PutJob(job); err != nil {
+		t.Fatalf("PutJob failed: %v", err)
+	}
+	cs.executeJobByID("weekly")
+
+	job.Name = "weekly check-in"
+	job.Schedule.Expr = "0 10 * * 1"
+	put, err := cs.PutJob(job)
+	if err != nil {
+		t.Fatalf("PutJob failed: %v", err)
+	}
+	jobs := cs.ListJobs(true)
+	if len(jobs) != 1 || jobs[0].Name != "weekly check-in" {
+		t.Fatalf("jobs after replace = %+v", jobs)
+	}
+	if put.State.LastStatus != "ok" || put.State.NextRunAtMS == nil {
+		t.Errorf("replaced job state = %+v, want last run kept and next run set", put.State)
+	}
+	if next := time.UnixMilli(*put.State.NextRunAtMS); next.Hour() != 10 {
+		t.Errorf("next run at %v, want 10:00 from the new schedule", next)
+	}
+}
@@ -0,0 +1,151 @@
+package eval
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Answer is the agent's reply to a case and the tools it called.
+type Answer struct {
+	Response string
+	Tools    []string
+}
+
+// Runner answers a question through the agent, answering tool calls from
+// fixtures when there are any.
+type Runner interface {
+	Answer(ctx context.Context, agentID, question string, fixtures []Fixture) (Answer, error)
+}
+
+// RunnerFunc adapts a function to Runner.
+type RunnerFunc func(ctx context.Context, agentID, question string, fixtures []Fixture) (Answer, error)
+
+// Answer calls f.
+func (f RunnerFunc) Answer(ctx context.Context, agentID, question string, fixtures []Fixture) (Answer, error) {
+	return f(ctx, agentID, question, fixtures)
+}
+
+// Check is one deterministic check of an answer.
+type Check struct {
+	Name   string `json:"name"`
+	Passed bool   `json:"passed"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// CaseResult is the outcome of one case.
+type CaseResult struct {
+	ID         string      `json:"id"`
+	Question   string      `json:"question"`
+	Tags       []string    `json:"tags,omitempty"`
+	Answer     string      `json:"answer"`
+	Tools      []string    `json:"tools,omitempty"`
+	Citations  int         `json:"citations"`
+	Checks     []Check     `json:"checks,omitempty"`
+	Criteria   []Criterion `json:"criteria,omitempty"`
+	Score      float64     `json:"score"`
+	Passed     bool        `json:"passed"`
+	Error      string      `json:"error,omitempty"`
+	DurationMs int64       `json:"duration_ms"`
+}
+
+// Run answers and scores every case of the suite, in order. Case
+// failures, including agent and grader errors, are recorded in the report
+// rather than returned; only a cancelled context stops the run.
+func Run(ctx context.Context, suite *Suite, runner Runner, grader *Grader) (*Report, error) {
+	report := &Report{Suite: suite.Name, Started: time.Now()}
+	for _, c := range suite.Cases {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		report.Cases = append(report.Cases, runCase(ctx, suite, c, runner, grader))
+	}
+	report.Duration = time.Since(report.Started).Round(time.Millisecond).String()
+	report.tally()
+	return report, nil
+}
+
+func runCase(ctx context.Context, suite *Suite, c Case, runner Runner, grader *Grader) CaseResult {
+	start := time.Now()
+	result := CaseResult{ID: c.ID, Question: c.Question, Tags: c.Tags}
+	defer func() { result.DurationMs = time.Since(start).Milliseconds() }()
+
+	answer, err := runner.Answer(ctx, suite.Agent, c.Question, suite.fixtures(c))
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.Answer, result.Tools = answer.Response, answer.Tools
+	result.Citations = CountCitations(answer.Response)
+	result.Checks = checkAnswer(c, answer.Response, result.Citations)
+
+	result.Score = 1
+	if len(c.Rubric) > 0 {
+		criteria, err := grader.Grade(ctx, c.Question, c.Rubric, answer.Response)
+		if err != nil {
+			result.Error = fmt.Sprintf("grading failed: %v", err)
+			result.Score = 0
+			return result
+		}
+		result.Criteria = criteria
+		met := 0
+		for _, cr := range criteria {
+			if cr.Met {
+				met++
+			}
+		}
+		result.Score = float64(met) / float64(len(criteria))
+	}
+
+	result.Passed = result.Score >= suite.passScore(c)
+	for _, check := range result.Checks {
+		result.Passed = result.Passed && check.Passed
+	}
+	return result
+}
+
+func checkAnswer(c Case, answer string, citations int) []Check {
+	var checks []Check
+	lower := strings.ToLower(answer)
+	for _, s := range c.MustInclude {
+		checks = append(checks, Check{
+			Name:   "includes " + s,
+			Passed: strings.Contains(lower, strings.ToLower(s)),
+		})
+	}
+	for _, s := range c.MustNotInclude {
+		checks = append(checks, Check{
+			Name:   "excludes " + s,
+			Passed: !strings.Contains(lower, strings.ToLower(s)),
+		})
+	}
+	minCitations := c.MinCitations
+	if c.RequireCitations && minCitations < 1 {
+		minCitations = 1
+	}
+	if minCitations > 0 {
+		checks = append(checks, Check{
+			Name:   fmt.Sprintf("at least %d citations", minCitations),
+			Passed: citations >= minCitations,
+			Detail: fmt.Sprintf("found %d", citations),
+		})
+	}
+	return checks
+}
+
+// citationPattern matches a citation group: rendered numbers such as [1]
+// or [2, 3], or raw evidence IDs such as [E1] or [knows:paper-12].
+var citationPattern = regexp.MustCompile(`\[((?:\d+|E\d+|[a-z_]+:[^\]\s,]+)(?:,\s*(?:\d+|E\d+|[a-z_]+:[^\]\s,]+))*)\]`)
+
+// CountCitations returns the number of distinct sources cited in answer.
+func CountCitations(answer string) int {
+	seen := make(map[string]bool)
+	for _, m := range citationPattern.FindAllStringSubmatch(answer, -1) {
+		for _, id := range strings.Split(m[1], ",") {
+			seen[strings.TrimSpace(id)] = true
+		}
+	}
+	return len(seen)
+}
@@ -0,0 +1,126 @@
+package eval
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+// gradeProvider answers grading prompts with reply.
+type gradeProvider struct {
+	reply string
+	model string
+}
+
+func (p *gradeProvider) Chat(ctx context.Context, messages []providers.Message, defs []providers.ToolDefinition, model string, opts map[string]interface{}) (*providers.LLMResponse, error) {
+	p.model = model
+	return &providers.LLMResponse{Content: p.reply}, nil
+}
+
+func (p *gradeProvider) GetDefaultModel() string {
+	return "default"
+}
+
+func TestLoadSuite(t *testing.T) {
+	suite, err := LoadSuite(filepath.Join("testdata", "suite.yaml"))
+	if err != nil {
+		t.Fatalf("LoadSuite: %v", err)
+	}
+	if suite.Name != "basics" || len(suite.Cases) != 2 {
+		t.Fatalf("suite = %+v", suite)
+	}
+	fixtures := suite.fixtures(suite.Cases[0])
+	if len(fixtures) != 1 || !strings.Contains(fixtures[0].Result, "FOLFIRINOX versus gemcitabine") {
+		t.Fatalf("fixture result file not loaded: %+v", fixtures)
+	}
+	if suite.fixtures(suite.Cases[1]) != nil || suite.passScore(suite.Cases[1]) != defaultPassScore {
+		t.Fatal("case defaults")
+	}
+}
+
+func TestCountCitations(t *testing.T) {
+	tests := []struct {
+		answer string
+		want   int
+	}{
+		{"No sources.", 0},
+		{"FOLFIRINOX [1] or gem/nab-P [2, 3].\n\nReferences:\n[1] A\n[2] B\n[3] C", 3},
+		{"Raw IDs [E1] and [knows:paper-12], again [E1].", 2},
+		{"A list [see below] is not a citation.", 0},
+	}
+	for _, tt := range tests {
+		if got := CountCitations(tt.answer); got != tt.want {
+			t.Errorf("CountCitations(%q) = %d, want %d", tt.answer, got, tt.want)
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	suite, err := LoadSuite(filepath.Join("testdata", "suite.yaml"))
+	if err != nil {
+		t.Fatalf("LoadSuite: %v", err)
+	}
+	answers := map[string]string{
+		suite.Cases[0].Question: "FOLFIRINOX [1] is an option.\n\nReferences:\n[1] FOLFIRINOX versus gemcitabine",
+		suite.Cases[1].Question: "No. Nothing cures it on its own, and turmeric cures nothing.",
+	}
+	var gotFixtures []Fixture
+	runner := RunnerFunc(func(ctx context.Context, agentID, question string, fixtures []Fixture) (Answer, error) {
+		if fixtures != nil {
+			gotFixtures = fixtures
+		}
+		return Answer{Response: answers[question], Tools: []string{"knows_search"}}, nil
+	})
+	grader := &gradeProvider{reply: `Sure: {"criteria":[{"met":true,"reason":"named"},{"met":false,"reason":"missing"}]}`}
+
+	report, err := Run(context.Background(), suite, runner, &Grader{Provider: grader, Model: suite.GraderModel})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if len(gotFixtures) != 1 || grader.model != "grader" {
+		t.Fatalf("fixtures %+v, grader model %q", gotFixtures, grader.model)
+	}
+	first, second := report.Cases[0], report.Cases[1]
+	if first.Score != 0.5 || first.Passed || first.Citations != 1 || !first.Checks[0].Passed || !first.Checks[1].Passed {
+		t.Fatalf("first case = %+v", first)
+	}
+	if second.Score != 1 || second.Passed || second.Checks[0].Passed {
+		t.Fatalf("second case = %+v", second)
+	}
+	if report.Passed != 0 || report.Failed != 2 || report.MeanScore != 0.75 || report.OK() {
+		t.Fatalf("report = %+v", report)
+	}
+
+	// A baseline where both passed makes both regressions.
+	var buf bytes.Buffer
+	baseline := &Report{Cases: []CaseResult{{ID: "first-line", Score: 1, Passed: true}, {ID: "gone", Passed: true}}}
+	report.Compare(baseline)
+	if len(report.Regressions) != 1 || report.Regressions[0].ID != "first-line" {
+		t.Fatalf("regressions = %+v", report.Regressions)
+	}
+	report.WriteText(&buf)
+	for _, want := range []string{"0 passed, 2 failed", "unmet: Mentions gemcitabine with nab-paclitaxel (missing)", "failed check: excludes cures", "first-line: 1.00 → 0.50"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("text report lacks %q:\n%s", want, buf.String())
+		}
+	}
+
+	// Reports round-trip through JSON for use as baselines.
+	buf.Reset()
+	path := filepath.Join(t.TempDir(), "report.json")
+	if err := report.WriteJSON(&buf); err != nil {
+		t.Fatalf("WriteJSON: %v", err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadReport(path)
+	if err != nil || len(loaded.Cases) != 2 || loaded.Cases[0].Criteria[1].Met {
+		t.Fatalf("LoadReport = %+v, %v", loaded, err)
+	}
+}
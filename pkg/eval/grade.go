@@ -0,0 +1,82 @@
+package eval
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+// Criterion is the grade of one rubric criterion.
+type Criterion struct {
+	Text   string `json:"text"`
+	Met    bool   `json:"met"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// Grader grades answers against rubrics with an LLM.
+type Grader struct {
+	Provider providers.LLMProvider
+	Model    string
+}
+
+type gradeReply struct {
+	Criteria []struct {
+		Met    bool   `json:"met"`
+		Reason string `json:"reason"`
+	} `json:"criteria"`
+}
+
+// Grade asks the model whether answer meets each criterion of rubric.
+func (g *Grader) Grade(ctx context.Context, question string, rubric []string, answer string) ([]Criterion, error) {
+	if g == nil || g.Provider == nil {
+		return nil, fmt.Errorf("no grader configured")
+	}
+	model := g.Model
+	if model == "" {
+		model = g.Provider.GetDefaultModel()
+	}
+	response, err := g.Provider.Chat(ctx, []providers.Message{
+		{Role: "user", Content: gradePrompt(question, rubric, answer)},
+	}, nil, model, map[string]interface{}{
+		"max_tokens":  200 + 100*len(rubric),
+		"temperature": 0.0,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	content := response.Content
+	start, end := strings.Index(content, "{"), strings.LastIndex(content, "}")
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("grader reply is not JSON: %q", content)
+	}
+	var reply gradeReply
+	if err := json.Unmarshal([]byte(content[start:end+1]), &reply); err != nil {
+		return nil, fmt.Errorf("grader reply is not JSON: %w", err)
+	}
+	if len(reply.Criteria) != len(rubric) {
+		return nil, fmt.Errorf("grader graded %d criteria, want %d", len(reply.Criteria), len(rubric))
+	}
+	criteria := make([]Criterion, len(rubric))
+	for i, text := range rubric {
+		criteria[i] = Criterion{Text: text, Met: reply.Criteria[i].Met, Reason: reply.Criteria[i].Reason}
+	}
+	return criteria, nil
+}
+
+func gradePrompt(question string, rubric []string, answer string) string {
+	var sb strings.Builder
+	sb.WriteString("Grade an assistant's answer to a patient's question against each criterion below. ")
+	sb.WriteString("A criterion is met only if the answer clearly satisfies it; judge meaning, not wording, ")
+	sb.WriteString("and ignore the answer's language.\n\n")
+	fmt.Fprintf(&sb, "Question:\n%s\n\nAnswer:\n%s\n\nCriteria:\n", question, answer)
+	for i, c := range rubric {
+		fmt.Fprintf(&sb, "%d. %s\n", i+1, c)
+	}
+	sb.WriteString("\nReply with JSON only, one entry per criterion in order: ")
+	sb.WriteString(`{"criteria":[{"met":true,"reason":"one short sentence"}]}`)
+	return sb.String()
+}
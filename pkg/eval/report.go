@@ -0,0 +1,139 @@
+package eval
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+// regressionMargin is how far a case's score may drop from the baseline
+// before it counts as a regression.
+const regressionMargin = 0.1
+
+// Report is the outcome of a suite run.
+type Report struct {
+	Suite       string       `json:"suite"`
+	Started     time.Time    `json:"started"`
+	Duration    string       `json:"duration"`
+	Passed      int          `json:"passed"`
+	Failed      int          `json:"failed"`
+	MeanScore   float64      `json:"mean_score"`
+	Cases       []CaseResult `json:"cases"`
+	Regressions []Regression `json:"regressions,omitempty"`
+}
+
+// Regression is a case that did worse than in the baseline report.
+type Regression struct {
+	ID     string  `json:"id"`
+	Before float64 `json:"before"`
+	After  float64 `json:"after"`
+	Reason string  `json:"reason"`
+}
+
+func (r *Report) tally() {
+	r.Passed, r.Failed = 0, 0
+	total := 0.0
+	for _, c := range r.Cases {
+		if c.Passed {
+			r.Passed++
+		} else {
+			r.Failed++
+		}
+		total += c.Score
+	}
+	if len(r.Cases) > 0 {
+		r.MeanScore = total / float64(len(r.Cases))
+	}
+}
+
+// LoadReport reads a report written with WriteJSON.
+func LoadReport(path string) (*Report, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var r Report
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, fmt.Errorf("invalid report %s: %w", path, err)
+	}
+	return &r, nil
+}
+
+// Compare records the cases that regressed from baseline: cases that
+// passed and now fail, and cases whose score dropped by more than 0.1.
+// Cases not in the baseline are new and never regress.
+func (r *Report) Compare(baseline *Report) {
+	before := make(map[string]CaseResult, len(baseline.Cases))
+	for _, c := range baseline.Cases {
+		before[c.ID] = c
+	}
+	r.Regressions = nil
+	for _, c := range r.Cases {
+		b, ok := before[c.ID]
+		if !ok {
+			continue
+		}
+		switch {
+		case b.Passed && !c.Passed:
+			r.Regressions = append(r.Regressions, Regression{ID: c.ID, Before: b.Score, After: c.Score, Reason: "passed before, fails now"})
+		case b.Score-c.Score > regressionMargin:
+			r.Regressions = append(r.Regressions, Regression{ID: c.ID, Before: b.Score, After: c.Score, Reason: "score dropped"})
+		}
+	}
+}
+
+// OK reports whether every case passed and none regressed.
+func (r *Report) OK() bool {
+	return r.Failed == 0 && len(r.Regressions) == 0
+}
+
+// WriteJSON writes the report as indented JSON.
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	return enc.Encode(r)
+}
+
+// WriteText writes a readable summary: one line per case, the failures'
+// details, and the regressions.
+func (r *Report) WriteText(w io.Writer) {
+	fmt.Fprintf(w, "Suite %s: %d passed, %d failed, mean score %.2f (%s)\n\n", r.Suite, r.Passed, r.Failed, r.MeanScore, r.Duration)
+	for _, c := range r.Cases {
+		status := "✓"
+		if !c.Passed {
+			status = "✗"
+		}
+		fmt.Fprintf(w, "%s %-24s score=%.2f citations=%d tools=%s\n", status, c.ID, c.Score, c.Citations, strings.Join(c.Tools, ","))
+		if c.Passed {
+			continue
+		}
+		if c.Error != "" {
+			fmt.Fprintf(w, "    error: %s\n", c.Error)
+		}
+		for _, check := range c.Checks {
+			if !check.Passed {
+				fmt.Fprintf(w, "    failed check: %s %s\n", check.Name, check.Detail)
+			}
+		}
+		for _, cr := range c.Criteria {
+			if !cr.Met {
+				fmt.Fprintf(w, "    unmet: %s (%s)\n", cr.Text, cr.Reason)
+			}
+		}
+		if c.Answer != "" {
+			fmt.Fprintf(w, "    answer: %s\n", utils.Truncate(strings.ReplaceAll(c.Answer, "\n", " "), 200))
+		}
+	}
+	if len(r.Regressions) > 0 {
+		fmt.Fprintf(w, "\nRegressions (%d):\n", len(r.Regressions))
+		for _, reg := range r.Regressions {
+			fmt.Fprintf(w, "  %s: %.2f → %.2f, %s\n", reg.ID, reg.Before, reg.After, reg.Reason)
+		}
+	}
+}
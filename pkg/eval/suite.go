@@ -0,0 +1,146 @@
+// Package eval runs suites of golden questions through the agent and
+// scores the answers, so prompt and model changes can be checked for
+// regressions before they are deployed.
+package eval
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+const defaultPassScore = 0.75
+
+// Suite is a set of golden questions, loaded from YAML.
+type Suite struct {
+	Name string `yaml:"name" json:"name"`
+	// Agent answers the questions; the default agent when empty.
+	Agent string `yaml:"agent,omitempty" json:"agent,omitempty"`
+	// GraderModel grades answers against their rubrics; the agent's model
+	// when empty.
+	GraderModel string `yaml:"grader_model,omitempty" json:"grader_model,omitempty"`
+	// PassScore is the share of rubric criteria an answer must meet to
+	// pass; 0.75 when zero. Cases may set their own.
+	PassScore float64 `yaml:"pass_score,omitempty" json:"pass_score,omitempty"`
+	// Fixtures answer tool calls in every case, after the case's own.
+	Fixtures []Fixture `yaml:"fixtures,omitempty" json:"fixtures,omitempty"`
+	Cases    []Case    `yaml:"cases" json:"cases"`
+}
+
+// Case is one golden question and what its answer must do.
+type Case struct {
+	ID       string   `yaml:"id" json:"id"`
+	Question string   `yaml:"question" json:"question"`
+	Tags     []string `yaml:"tags,omitempty" json:"tags,omitempty"`
+	// Rubric lists criteria a good answer meets, graded by the LLM.
+	Rubric []string `yaml:"rubric,omitempty" json:"rubric,omitempty"`
+	// MustInclude and MustNotInclude are matched case-insensitively.
+	MustInclude    []string `yaml:"must_include,omitempty" json:"must_include,omitempty"`
+	MustNotInclude []string `yaml:"must_not_include,omitempty" json:"must_not_include,omitempty"`
+	// MinCitations is the number of distinct citations the answer must
+	// carry; RequireCitations alone means at least one.
+	RequireCitations bool    `yaml:"require_citations,omitempty" json:"require_citations,omitempty"`
+	MinCitations     int     `yaml:"min_citations,omitempty" json:"min_citations,omitempty"`
+	PassScore        float64 `yaml:"pass_score,omitempty" json:"pass_score,omitempty"`
+	// Fixtures answer the case's tool calls instead of the real tools.
+	Fixtures []Fixture `yaml:"fixtures,omitempty" json:"fixtures,omitempty"`
+}
+
+// Fixture is a canned tool result, such as a KnowS search response. A call
+// gets the fixture of the same tool with the same arguments, or failing
+// that the first fixture of the tool. When a case has fixtures, tools
+// without one return an error rather than run.
+type Fixture struct {
+	Tool string                 `yaml:"tool" json:"tool"`
+	Args map[string]interface{} `yaml:"args,omitempty" json:"args,omitempty"`
+	// Result is the tool's output; ResultFile, relative to the suite file,
+	// holds it instead.
+	Result     string `yaml:"result,omitempty" json:"result,omitempty"`
+	ResultFile string `yaml:"result_file,omitempty" json:"result_file,omitempty"`
+	// Error makes the tool fail with this message.
+	Error string `yaml:"error,omitempty" json:"error,omitempty"`
+}
+
+// LoadSuite reads and checks a suite, resolving fixture result files.
+func LoadSuite(path string) (*Suite, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var s Suite
+	if err := yaml.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("invalid suite %s: %w", path, err)
+	}
+	if s.Name == "" {
+		s.Name = filepath.Base(path)
+	}
+	if len(s.Cases) == 0 {
+		return nil, fmt.Errorf("suite %s has no cases", path)
+	}
+
+	dir := filepath.Dir(path)
+	if err := resolveFixtures(dir, s.Fixtures); err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool, len(s.Cases))
+	for i := range s.Cases {
+		c := &s.Cases[i]
+		if c.ID == "" {
+			c.ID = fmt.Sprintf("case-%d", i+1)
+		}
+		if seen[c.ID] {
+			return nil, fmt.Errorf("suite %s: duplicate case id %q", path, c.ID)
+		}
+		seen[c.ID] = true
+		if c.Question == "" {
+			return nil, fmt.Errorf("suite %s: case %q has no question", path, c.ID)
+		}
+		if err := resolveFixtures(dir, c.Fixtures); err != nil {
+			return nil, fmt.Errorf("case %q: %w", c.ID, err)
+		}
+	}
+	return &s, nil
+}
+
+func resolveFixtures(dir string, fixtures []Fixture) error {
+	for i := range fixtures {
+		f := &fixtures[i]
+		if f.Tool == "" {
+			return fmt.Errorf("fixture %d has no tool", i+1)
+		}
+		if f.ResultFile == "" {
+			continue
+		}
+		path := f.ResultFile
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("fixture for %s: %w", f.Tool, err)
+		}
+		f.Result = string(data)
+	}
+	return nil
+}
+
+// passScore returns the rubric score c must reach to pass.
+func (s *Suite) passScore(c Case) float64 {
+	switch {
+	case c.PassScore > 0:
+		return c.PassScore
+	case s.PassScore > 0:
+		return s.PassScore
+	}
+	return defaultPassScore
+}
+
+// fixtures returns the fixtures for c: its own, then the suite's.
+func (s *Suite) fixtures(c Case) []Fixture {
+	if len(c.Fixtures) == 0 && len(s.Fixtures) == 0 {
+		return nil
+	}
+	return append(append([]Fixture(nil), c.Fixtures...), s.Fixtures...)
+}
@@ -0,0 +1,260 @@
+// Package feedback keeps users' ratings of answers together with the turn
+// they rate, so good and bad answers can be turned into evaluation sets and
+// prompt or fine-tuning examples.
+package feedback
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Ratings a user can give an answer.
+const (
+	RatingUp   = "up"
+	RatingDown = "down"
+)
+
+// Record is one piece of feedback on a turn. A rating and a comment on the
+// same turn may arrive as separate records; List merges them.
+type Record struct {
+	ID         string    `json:"id"`
+	Time       time.Time `json:"time"`
+	TurnID     string    `json:"turn_id,omitempty"`
+	AgentID    string    `json:"agent_id,omitempty"`
+	SessionKey string    `json:"session_key,omitempty"`
+	UserID     string    `json:"user_id,omitempty"`
+	Channel    string    `json:"channel,omitempty"`
+	ChatID     string    `json:"chat_id,omitempty"`
+	Rating     string    `json:"rating,omitempty"`
+	Comment    string    `json:"comment,omitempty"`
+	Question   string    `json:"question"`
+	Answer     string    `json:"answer"`
+	Evidence   []string  `json:"evidence,omitempty"`
+}
+
+// Query selects records for List. Zero fields match everything.
+type Query struct {
+	Since   time.Time
+	Rating  string
+	AgentID string
+}
+
+// Store appends records as JSON lines.
+type Store struct {
+	path string
+	mu   sync.Mutex
+	file *os.File
+	now  func() time.Time
+}
+
+// NewStore opens (creating if needed) the feedback log at path.
+func NewStore(path string) (*Store, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create feedback directory: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open feedback log: %w", err)
+	}
+	return &Store{path: path, file: f, now: time.Now}, nil
+}
+
+// Path returns the feedback log location.
+func (s *Store) Path() string {
+	return s.path
+}
+
+// Add validates r, stamps it with an ID and time, and writes it.
+func (s *Store) Add(r Record) (Record, error) {
+	if r.Rating != "" && r.Rating != RatingUp && r.Rating != RatingDown {
+		return r, fmt.Errorf("rating must be %q or %q, got %q", RatingUp, RatingDown, r.Rating)
+	}
+	r.Comment = strings.TrimSpace(r.Comment)
+	if r.Rating == "" && r.Comment == "" {
+		return r, fmt.Errorf("feedback needs a rating or a comment")
+	}
+	r.ID = newID()
+	if r.Time.IsZero() {
+		r.Time = s.now().UTC()
+	}
+	data, err := json.Marshal(r)
+	if err != nil {
+		return r, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return r, fmt.Errorf("feedback log is closed")
+	}
+	_, err = s.file.Write(append(data, '\n'))
+	return r, err
+}
+
+// List returns the feedback matching q, oldest first.
+func (s *Store) List(q Query) ([]Record, error) {
+	return Load(s.path, q)
+}
+
+// Close closes the underlying file.
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
+
+// Load reads the feedback log at path and returns the records matching q,
+// oldest first. Records on the same turn are merged into one: the latest
+// rating wins and comments are joined.
+func Load(path string, q Query) ([]Record, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var merged []*Record
+	byTurn := make(map[string]*Record)
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 4<<20)
+	for scanner.Scan() {
+		var r Record
+		if json.Unmarshal(scanner.Bytes(), &r) != nil {
+			continue
+		}
+		key := r.TurnID
+		if key == "" {
+			key = r.SessionKey + "\x00" + r.Question + "\x00" + r.Answer
+		}
+		prev, ok := byTurn[key]
+		if !ok {
+			rec := r
+			byTurn[key] = &rec
+			merged = append(merged, &rec)
+			continue
+		}
+		prev.Time = r.Time
+		if r.Rating != "" {
+			prev.Rating = r.Rating
+		}
+		if r.Comment != "" {
+			if prev.Comment != "" {
+				prev.Comment += "\n"
+			}
+			prev.Comment += r.Comment
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	var out []Record
+	for _, r := range merged {
+		if (!q.Since.IsZero() && r.Time.Before(q.Since)) ||
+			(q.Rating != "" && r.Rating != q.Rating) ||
+			(q.AgentID != "" && r.AgentID != q.AgentID) {
+			continue
+		}
+		out = append(out, *r)
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Time.Before(out[j].Time) })
+	return out, nil
+}
+
+// Export formats.
+const (
+	// FormatEval writes each record as a JSON line: the question, answer,
+	// evidence, rating and comment, for evaluation sets.
+	FormatEval = "eval"
+	// FormatChat writes well-rated turns as chat fine-tuning examples,
+	// {"messages": [user, assistant]}, one per line.
+	FormatChat = "chat"
+)
+
+type chatExample struct {
+	Messages []chatMessage `json:"messages"`
+}
+
+type chatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// Export writes records to w in the given format.
+func Export(w io.Writer, records []Record, format string) error {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	switch format {
+	case "", FormatEval:
+		for _, r := range records {
+			if err := enc.Encode(r); err != nil {
+				return err
+			}
+		}
+	case FormatChat:
+		for _, r := range records {
+			if r.Rating != RatingUp || r.Question == "" || r.Answer == "" {
+				continue
+			}
+			if err := enc.Encode(chatExample{Messages: []chatMessage{
+				{Role: "user", Content: r.Question},
+				{Role: "assistant", Content: r.Answer},
+			}}); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("unknown format %q; use %s or %s", format, FormatEval, FormatChat)
+	}
+	return nil
+}
+
+// Summary counts ratings and comments.
+type Summary struct {
+	Up       int `json:"up"`
+	Down     int `json:"down"`
+	Comments int `json:"comments"`
+}
+
+// Summarize counts the ratings and comments of records.
+func Summarize(records []Record) Summary {
+	var s Summary
+	for _, r := range records {
+		switch r.Rating {
+		case RatingUp:
+			s.Up++
+		case RatingDown:
+			s.Down++
+		}
+		if r.Comment != "" {
+			s.Comments++
+		}
+	}
+	return s
+}
+
+func newID() string {
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("fb-%d", time.Now().UnixNano())
+	}
+	return "fb-" + hex.EncodeToString(b)
+}
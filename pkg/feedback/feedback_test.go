@@ -0,0 +1,88 @@
+package feedback
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "feedback", "feedback.jsonl")
+	s, err := NewStore(path)
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	now := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+	add := func(r Record) {
+		t.Helper()
+		if _, err := s.Add(r); err != nil {
+			t.Fatalf("Add(%+v): %v", r, err)
+		}
+		now = now.Add(time.Minute)
+	}
+
+	if _, err := s.Add(Record{TurnID: "t1", Rating: "meh"}); err == nil {
+		t.Fatal("invalid rating accepted")
+	}
+	if _, err := s.Add(Record{TurnID: "t1", Comment: "  "}); err == nil {
+		t.Fatal("empty feedback accepted")
+	}
+
+	add(Record{TurnID: "t1", AgentID: "main", Rating: RatingDown, Question: "Q1", Answer: "A1", Evidence: []string{"E1"}})
+	add(Record{TurnID: "t1", AgentID: "main", Comment: "cites an old trial", Question: "Q1", Answer: "A1"})
+	add(Record{TurnID: "t1", AgentID: "main", Comment: "and misses stage 4", Question: "Q1", Answer: "A1"})
+	add(Record{TurnID: "t2", AgentID: "main", Rating: RatingUp, Question: "Q2", Answer: "A2"})
+	add(Record{TurnID: "t3", AgentID: "other", Rating: RatingUp, Question: "Q3", Answer: "A3"})
+	s.Close()
+
+	all, err := Load(path, Query{})
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if len(all) != 3 {
+		t.Fatalf("got %d records, want 3 merged turns: %+v", len(all), all)
+	}
+	if all[0].Rating != RatingDown || all[0].Comment != "cites an old trial\nand misses stage 4" || len(all[0].Evidence) != 1 {
+		t.Fatalf("merged turn = %+v", all[0])
+	}
+	if got := Summarize(all); got != (Summary{Up: 2, Down: 1, Comments: 1}) {
+		t.Fatalf("Summarize = %+v", got)
+	}
+
+	tests := []struct {
+		name  string
+		query Query
+		want  int
+	}{
+		{"rating", Query{Rating: RatingUp}, 2},
+		{"agent", Query{AgentID: "main"}, 2},
+		{"since", Query{Since: time.Date(2026, 3, 1, 9, 3, 0, 0, time.UTC)}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Load(path, tt.query)
+			if err != nil || len(got) != tt.want {
+				t.Fatalf("Load = %d records, %v; want %d", len(got), err, tt.want)
+			}
+		})
+	}
+
+	var buf bytes.Buffer
+	if err := Export(&buf, all, FormatChat); err != nil {
+		t.Fatalf("Export chat: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 || lines[0] != `{"messages":[{"role":"user","content":"Q2"},{"role":"assistant","content":"A2"}]}` {
+		t.Fatalf("chat export = %q", buf.String())
+	}
+	buf.Reset()
+	if err := Export(&buf, all, FormatEval); err != nil || strings.Count(buf.String(), "\n") != 3 {
+		t.Fatalf("eval export = %q, %v", buf.String(), err)
+	}
+	if err := Export(&buf, all, "csv"); err == nil {
+		t.Fatal("unknown format accepted")
+	}
+}
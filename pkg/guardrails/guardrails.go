@@ -0,0 +1,132 @@
+// Package guardrails applies medical safety policies to the messages users
+// send and the answers the agent gives: escalating red-flag symptoms and
+// crises before the model answers, and softening dose advice and adding a
+// disclaimer after. Policies are rule-based, so they hold even when the
+// model ignores its instructions or fails.
+package guardrails
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+// Input is the turn the policies check.
+type Input struct {
+	// Message is the user's message.
+	Message string
+	// Chinese selects Chinese wording for notices and notes.
+	Chinese bool
+}
+
+// Finding is something a policy detected.
+type Finding struct {
+	Policy string `json:"policy"`
+	ID     string `json:"id"`
+}
+
+// Inbound is what the inbound policies decided about a user message.
+type Inbound struct {
+	// Notices are put before the answer, and before the error if the
+	// model fails.
+	Notices []string
+	// Instructions are added to the system prompt for this turn.
+	Instructions []string
+	Findings     []Finding
+	// Escalate is set when staff should be alerted.
+	Escalate bool
+}
+
+// InboundPolicy checks a user message before the model sees it.
+type InboundPolicy interface {
+	Name() string
+	CheckInbound(in Input, out *Inbound)
+}
+
+// OutboundPolicy checks, and may rewrite, the answer to a message.
+type OutboundPolicy interface {
+	Name() string
+	CheckOutbound(in Input, answer string) (string, []Finding)
+}
+
+// Pipeline runs policies in the order they were given.
+type Pipeline struct {
+	inbound  []InboundPolicy
+	outbound []OutboundPolicy
+}
+
+// New returns a pipeline of policies, each of which implements
+// InboundPolicy, OutboundPolicy or both.
+func New(policies ...interface{}) *Pipeline {
+	p := &Pipeline{}
+	for _, policy := range policies {
+		if in, ok := policy.(InboundPolicy); ok {
+			p.inbound = append(p.inbound, in)
+		}
+		if out, ok := policy.(OutboundPolicy); ok {
+			p.outbound = append(p.outbound, out)
+		}
+	}
+	return p
+}
+
+// FromConfig returns the pipeline for a deployment. redFlags turns on the
+// red-flag symptom policy, which is configured with the triage tool.
+func FromConfig(cfg config.GuardrailsConfig, redFlags bool) *Pipeline {
+	var policies []interface{}
+	if cfg.Crisis.Enabled {
+		policies = append(policies, &CrisisPolicy{Hotlines: cfg.Crisis.Hotlines, HotlinesZH: cfg.Crisis.HotlinesZH})
+	}
+	if redFlags {
+		policies = append(policies, &RedFlagPolicy{})
+	}
+	if cfg.Dosage.Enabled {
+		policies = append(policies, &DosagePolicy{Redact: cfg.Dosage.Mode == "redact"})
+	}
+	// The disclaimer goes last so it ends the answer.
+	if cfg.Disclaimer.Enabled {
+		policies = append(policies, &DisclaimerPolicy{Text: cfg.Disclaimer.Text, TextZH: cfg.Disclaimer.TextZH})
+	}
+	return New(policies...)
+}
+
+// CheckInbound runs the inbound policies on a user message.
+func (p *Pipeline) CheckInbound(in Input) Inbound {
+	var out Inbound
+	for _, policy := range p.inbound {
+		policy.CheckInbound(in, &out)
+	}
+	return out
+}
+
+// CheckOutbound runs the outbound policies on an answer and returns the
+// answer to send.
+func (p *Pipeline) CheckOutbound(in Input, answer string) (string, []Finding) {
+	var findings []Finding
+	for _, policy := range p.outbound {
+		var found []Finding
+		answer, found = policy.CheckOutbound(in, answer)
+		findings = append(findings, found...)
+	}
+	return answer, findings
+}
+
+// IsChinese reports whether text is written in Chinese.
+func IsChinese(text string) bool {
+	for _, r := range text {
+		if unicode.Is(unicode.Han, r) {
+			return true
+		}
+	}
+	return false
+}
+
+// FindingIDs joins the IDs of findings for logging.
+func FindingIDs(findings []Finding) string {
+	ids := make([]string, len(findings))
+	for i, f := range findings {
+		ids[i] = f.Policy + ":" + f.ID
+	}
+	return strings.Join(ids, ",")
+}
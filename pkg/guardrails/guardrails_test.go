@@ -0,0 +1,101 @@
+package guardrails
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestCrisisPolicy(t *testing.T) {
+	tests := []struct {
+		message string
+		want    bool
+	}{
+		{"I want to die, nothing helps anymore", true},
+		{"Sometimes I think about killing myself", true},
+		{"确诊以后我真的不想活了", true},
+		{"我有时候想自杀", true},
+		{"I don't want to die, what are my options?", false},
+		{"我不想死，还有什么治疗办法？", false},
+		{"What is the survival rate for stage III?", false},
+	}
+	p := &CrisisPolicy{}
+	for _, tt := range tests {
+		var out Inbound
+		p.CheckInbound(Input{Message: tt.message, Chinese: IsChinese(tt.message)}, &out)
+		if got := len(out.Findings) > 0; got != tt.want {
+			t.Errorf("%q: flagged = %v, want %v", tt.message, got, tt.want)
+			continue
+		}
+		if tt.want && (!out.Escalate || len(out.Notices) != 1 || len(out.Instructions) != 1) {
+			t.Errorf("%q: %+v", tt.message, out)
+		}
+	}
+
+	var out Inbound
+	(&CrisisPolicy{HotlinesZH: []string{"医院心理科：021-1234"}}).CheckInbound(Input{Message: "我想死", Chinese: true}, &out)
+	if !strings.Contains(out.Notices[0], "医院心理科：021-1234") || strings.Contains(out.Notices[0], "400-161-9995") {
+		t.Errorf("configured hotlines not used: %q", out.Notices[0])
+	}
+}
+
+func TestDosagePolicy(t *testing.T) {
+	tests := []struct {
+		name   string
+		answer string
+		redact bool
+		want   bool
+		text   string
+	}{
+		{"instruction", "You can take 500 mg of acetaminophen every 6 hours. Rest well.", false, true, "take 500 mg"},
+		{"chinese instruction", "建议您每次服用2片蒙脱石散。", false, true, "2片"},
+		{"decimal dose kept in one sentence", "You should take 1.5 mg at night. Sleep helps.", true, true, "take [dose: confirm with your care team] at night. Sleep helps."},
+		{"chinese redaction", "每次吃2片。多喝水。", true, true, "每次吃[剂量请遵医嘱]。多喝水。"},
+		{"study description", "In the trial, patients received gemcitabine 1000 mg/m² weekly.", false, false, ""},
+		{"no dose", "You can take a short walk after meals.", false, false, ""},
+	}
+	for _, tt := range tests {
+		p := &DosagePolicy{Redact: tt.redact}
+		got, findings := p.CheckOutbound(Input{Chinese: IsChinese(tt.answer)}, tt.answer)
+		if (len(findings) > 0) != tt.want {
+			t.Errorf("%s: findings = %v", tt.name, findings)
+			continue
+		}
+		if !tt.want {
+			if got != tt.answer {
+				t.Errorf("%s: unflagged answer changed to %q", tt.name, got)
+			}
+			continue
+		}
+		if !strings.Contains(got, tt.text) || !strings.Contains(got, "💊") {
+			t.Errorf("%s: got %q", tt.name, got)
+		}
+	}
+}
+
+func TestFromConfig(t *testing.T) {
+	p := FromConfig(config.GuardrailsConfig{
+		Disclaimer: config.DisclaimerGuardConfig{Enabled: true, Text: "Not medical advice."},
+		Dosage:     config.DosageGuardConfig{Enabled: true},
+		Crisis:     config.CrisisGuardConfig{Enabled: true},
+	}, true)
+
+	in := p.CheckInbound(Input{Message: "I want to end my life and I vomited blood"})
+	if len(in.Notices) != 2 || !strings.HasPrefix(in.Notices[0], "💛") || !strings.HasPrefix(in.Notices[1], "⚠️ Urgent") {
+		t.Errorf("inbound notices = %q", in.Notices)
+	}
+
+	// The disclaimer ends the answer, after the dose note, and is added once.
+	answer, _ := p.CheckOutbound(Input{}, "You can take 400 mg ibuprofen.")
+	if !strings.HasSuffix(answer, "\n\nNot medical advice.") || !strings.Contains(answer, "💊") {
+		t.Errorf("answer = %q", answer)
+	}
+	if again, _ := p.CheckOutbound(Input{}, answer); strings.Count(again, "Not medical advice.") != 1 {
+		t.Errorf("disclaimer repeated: %q", again)
+	}
+
+	if empty := FromConfig(config.GuardrailsConfig{}, false); len(empty.inbound)+len(empty.outbound) != 0 {
+		t.Errorf("disabled config has policies")
+	}
+}
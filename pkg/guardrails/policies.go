@@ -0,0 +1,256 @@
+package guardrails
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+// DisclaimerPolicy ends every answer with a disclaimer.
+type DisclaimerPolicy struct {
+	// Text and TextZH replace the built-in wording when set.
+	Text   string
+	TextZH string
+}
+
+const (
+	defaultDisclaimer   = "ℹ️ This information is for education only and does not replace advice from your medical team."
+	defaultDisclaimerZH = "ℹ️ 以上信息仅供科普参考，不能替代医生的诊疗意见。"
+)
+
+func (p *DisclaimerPolicy) Name() string {
+	return "disclaimer"
+}
+
+func (p *DisclaimerPolicy) CheckOutbound(in Input, answer string) (string, []Finding) {
+	text := firstNonEmpty(p.Text, defaultDisclaimer)
+	if in.Chinese {
+		text = firstNonEmpty(p.TextZH, defaultDisclaimerZH)
+	}
+	if strings.TrimSpace(answer) == "" || strings.Contains(answer, text) {
+		return answer, nil
+	}
+	return strings.TrimRight(answer, "\n") + "\n\n" + text, nil
+}
+
+// DosagePolicy finds sentences that tell the user what dose to take and
+// adds a note to confirm the dose with their care team. With Redact, the
+// amounts in those sentences are removed as well.
+type DosagePolicy struct {
+	Redact bool
+}
+
+const (
+	dosageNote       = "💊 Doses mentioned above are general information, not a prescription. Confirm any dose, or any change to one, with your oncologist or pharmacist before taking it."
+	dosageNoteZH     = "💊 以上提到的剂量仅供参考，不是处方。服用或调整任何剂量前，请先与您的主治医生或药师确认。"
+	dosageRedacted   = "[dose: confirm with your care team]"
+	dosageRedactedZH = "[剂量请遵医嘱]"
+)
+
+var (
+	doseAmount = regexp.MustCompile(`\d+(?:\.\d+)?\s*(?:mg/m²|(?:mg/m2|mg/kg|mcg|mg|µg|μg|ml|iu|units?|tablets?|pills?|capsules?|g)\b|毫克|微克|克|毫升|片|粒|袋|支|单位)`)
+	// sentenceEnd ends a sentence; a period only counts before a space, so
+	// "1.5 mg" stays in one sentence.
+	sentenceEnd = regexp.MustCompile(`[!?。！？\n]|\.(?:\s|$)`)
+	doseCues    = []string{"take ", "taking", "increase", "decrease", "reduce", "double", "lower the dose", "raise the dose",
+		"you can", "you could", "you should", "try ", "start with", "switch to",
+		"服用", "吃", "口服", "加量", "减量", "加到", "减到", "增加到", "减少到", "每次", "可以用", "建议您", "您可以", "你可以", "改成", "改为"}
+)
+
+func (p *DosagePolicy) Name() string {
+	return "dosage"
+}
+
+func (p *DosagePolicy) CheckOutbound(in Input, answer string) (string, []Finding) {
+	var b strings.Builder
+	found := false
+	start := 0
+	for start < len(answer) {
+		end := len(answer)
+		if loc := sentenceEnd.FindStringIndex(answer[start:]); loc != nil {
+			end = start + loc[1]
+		}
+		sentence := answer[start:end]
+		if doseAmount.MatchString(strings.ToLower(sentence)) && containsAny(strings.ToLower(sentence), doseCues) {
+			found = true
+			if p.Redact {
+				sentence = redactDoses(sentence, in.Chinese)
+			}
+		}
+		b.WriteString(sentence)
+		start = end
+	}
+	if !found {
+		return answer, nil
+	}
+	note := dosageNote
+	if in.Chinese {
+		note = dosageNoteZH
+	}
+	return strings.TrimRight(b.String(), "\n") + "\n\n" + note, []Finding{{Policy: p.Name(), ID: "dose_advice"}}
+}
+
+// redactDoses replaces the amounts in sentence, matching case-insensitively
+// as the check does.
+func redactDoses(sentence string, chinese bool) string {
+	repl := dosageRedacted
+	if chinese {
+		repl = dosageRedactedZH
+	}
+	lower := strings.ToLower(sentence)
+	if len(lower) != len(sentence) {
+		return doseAmount.ReplaceAllString(sentence, repl)
+	}
+	var b strings.Builder
+	last := 0
+	for _, loc := range doseAmount.FindAllStringIndex(lower, -1) {
+		b.WriteString(sentence[last:loc[0]])
+		b.WriteString(repl)
+		last = loc[1]
+	}
+	b.WriteString(sentence[last:])
+	return b.String()
+}
+
+// CrisisPolicy recognizes messages about suicide or self-harm. It puts
+// crisis hotlines before the answer, tells the model how to respond and
+// asks for staff to be alerted.
+type CrisisPolicy struct {
+	// Hotlines and HotlinesZH replace the built-in lists when set.
+	Hotlines   []string
+	HotlinesZH []string
+}
+
+var (
+	crisisTerms = []string{"kill myself", "killing myself", "suicide", "suicidal", "end my life", "ending my life", "end it all",
+		"want to die", "wanna die", "don't want to live", "do not want to live", "no reason to live", "better off dead",
+		"self-harm", "self harm", "hurt myself", "hurting myself", "cut myself", "cutting myself",
+		"自杀", "轻生", "想死", "不想活", "活不下去", "活着没意思", "结束生命", "结束自己", "了结自己", "寻死", "自残", "割腕", "跳楼"}
+	// crisisNegations before a term mean the opposite, as in "I don't
+	// want to die" or "不想死".
+	crisisNegations = []string{"don't ", "do not ", "never ", "not ", "不", "没", "别"}
+
+	defaultHotlines = []string{
+		"Your local emergency number, if you might act on these thoughts now",
+		"US: 988 Suicide & Crisis Lifeline, call or text 988",
+		"Elsewhere: findahelpline.com lists free, confidential lines in your country",
+	}
+	defaultHotlinesZH = []string{
+		"如有立即危险，请拨打 120 或 110",
+		"希望24热线：400-161-9995",
+		"北京心理危机研究与干预中心：010-82951332",
+	}
+)
+
+const crisisInstruction = "The user's message suggests they may be thinking about suicide or self-harm. " +
+	"Crisis hotlines are already shown above your answer. Respond with warmth and without judgement, take what they said seriously, " +
+	"ask whether they are safe right now, and encourage them to call a hotline or reach someone they trust. " +
+	"Do not give information about methods or doses, and do not change the subject to medical facts."
+
+func (p *CrisisPolicy) Name() string {
+	return "crisis"
+}
+
+func (p *CrisisPolicy) CheckInbound(in Input, out *Inbound) {
+	text := strings.ToLower(in.Message)
+	term := ""
+	for _, t := range crisisTerms {
+		if mentionsUnnegated(text, t) {
+			term = t
+			break
+		}
+	}
+	if term == "" {
+		return
+	}
+
+	var b strings.Builder
+	if in.Chinese {
+		b.WriteString("💛 您现在可能正经历非常艰难的时刻，您并不孤单。如果您有伤害自己的想法，请现在就联系：\n")
+		for _, h := range firstNonEmptyList(p.HotlinesZH, defaultHotlinesZH) {
+			b.WriteString("- " + h + "\n")
+		}
+		b.WriteString("也可以告诉身边信任的人或您的医生团队。")
+	} else {
+		b.WriteString("💛 It sounds like you may be going through something very hard, and you don't have to face it alone. If you are thinking about harming yourself, please reach out now:\n")
+		for _, h := range firstNonEmptyList(p.Hotlines, defaultHotlines) {
+			b.WriteString("- " + h + "\n")
+		}
+		b.WriteString("You can also tell someone you trust or your care team.")
+	}
+	out.Notices = append(out.Notices, b.String())
+	out.Instructions = append(out.Instructions, crisisInstruction)
+	out.Findings = append(out.Findings, Finding{Policy: p.Name(), ID: "self_harm"})
+	out.Escalate = true
+}
+
+// mentionsUnnegated reports whether text mentions term somewhere it is not
+// directly negated.
+func mentionsUnnegated(text, term string) bool {
+	from := 0
+	for {
+		i := strings.Index(text[from:], term)
+		if i < 0 {
+			return false
+		}
+		i += from
+		negated := false
+		for _, n := range crisisNegations {
+			if strings.HasSuffix(text[:i], n) {
+				negated = true
+				break
+			}
+		}
+		if !negated {
+			return true
+		}
+		from = i + len(term)
+	}
+}
+
+// RedFlagPolicy puts an urgent-care notice before the answer when the user
+// mentions a red-flag symptom, using the symptom_triage rules.
+type RedFlagPolicy struct{}
+
+func (p *RedFlagPolicy) Name() string {
+	return "red_flags"
+}
+
+func (p *RedFlagPolicy) CheckInbound(in Input, out *Inbound) {
+	flags := tools.CheckRedFlags(in.Message)
+	if len(flags) == 0 {
+		return
+	}
+	out.Notices = append(out.Notices, tools.RedFlagEscalation(flags, in.Chinese))
+	for _, f := range flags {
+		out.Findings = append(out.Findings, Finding{Policy: p.Name(), ID: f.ID})
+	}
+}
+
+func containsAny(text string, terms []string) bool {
+	for _, t := range terms {
+		if strings.Contains(text, t) {
+			return true
+		}
+	}
+	return false
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if strings.TrimSpace(v) != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func firstNonEmptyList(lists ...[]string) []string {
+	for _, l := range lists {
+		if len(l) > 0 {
+			return l
+		}
+	}
+	return nil
+}
@@ -206,8 +206,8 @@ func (hs *HeartbeatService) executeHeartbeat() {
 	}
 
 	// Send result to user
-	if result.ForUser != "" {
-		hs.sendResponse(result.ForUser)
+	if userContent := result.UserContent(channel); userContent != "" {
+		hs.sendResponse(userContent)
 	} else if result.ForLLM != "" {
 		hs.sendResponse(result.ForLLM)
 	}
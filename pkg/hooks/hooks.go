@@ -0,0 +1,149 @@
+// Package hooks lets extensions observe the agent without changing it:
+// Go code and webhooks subscribe to messages received, tool calls,
+// responses sent and errors, for analytics, CRM sync or moderation.
+package hooks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// EventType names the point in the agent an event comes from.
+type EventType string
+
+const (
+	// MessageReceived is emitted for each user message before the agent
+	// processes it. Its hooks can reject the message.
+	MessageReceived EventType = "message_received"
+	// ToolCall is emitted after each tool call, including failed ones.
+	ToolCall EventType = "tool_call"
+	// ResponseSent is emitted after a message was delivered to a chat.
+	ResponseSent EventType = "response_sent"
+	// Error is emitted when a message could not be processed or delivered.
+	Error EventType = "error"
+)
+
+// EventTypes lists every event type, in the order above.
+var EventTypes = []EventType{MessageReceived, ToolCall, ResponseSent, Error}
+
+// Event describes what happened. Content is the user's message, the
+// response sent, or the tool's result; Args is set for tool calls.
+type Event struct {
+	Type       EventType              `json:"type"`
+	Time       time.Time              `json:"time"`
+	Channel    string                 `json:"channel,omitempty"`
+	ChatID     string                 `json:"chat_id,omitempty"`
+	SenderID   string                 `json:"sender_id,omitempty"`
+	SessionKey string                 `json:"session_key,omitempty"`
+	Content    string                 `json:"content,omitempty"`
+	Tool       string                 `json:"tool,omitempty"`
+	Args       map[string]interface{} `json:"args,omitempty"`
+	IsError    bool                   `json:"is_error,omitempty"`
+	DurationMS int64                  `json:"duration_ms,omitempty"`
+	Error      string                 `json:"error,omitempty"`
+	Metadata   map[string]string      `json:"metadata,omitempty"`
+}
+
+// Hook receives events of the type it was registered for. Hooks run on
+// the path that emitted the event, one after another, so slow work belongs
+// in a goroutine. Errors are logged; only a MessageReceived hook returning
+// a Rejection changes what the agent does.
+type Hook func(ctx context.Context, e Event) error
+
+// Rejection stops a received message from being processed. Reply, if set,
+// is sent to the chat instead of an answer.
+type Rejection struct {
+	Reply string
+}
+
+func (r *Rejection) Error() string {
+	return "message rejected by hook"
+}
+
+// Reject returns the error with which a MessageReceived hook stops a
+// message, replying with reply.
+func Reject(reply string) error {
+	return &Rejection{Reply: reply}
+}
+
+// Manager holds the subscribed hooks. The zero value has none; a nil
+// Manager is valid and emits nothing.
+type Manager struct {
+	mu    sync.RWMutex
+	hooks map[EventType][]Hook
+}
+
+func NewManager() *Manager {
+	return &Manager{hooks: make(map[EventType][]Hook)}
+}
+
+// On subscribes hook to events of type t.
+func (m *Manager) On(t EventType, hook Hook) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.hooks == nil {
+		m.hooks = make(map[EventType][]Hook)
+	}
+	m.hooks[t] = append(m.hooks[t], hook)
+}
+
+func (m *Manager) OnMessageReceived(hook Hook) { m.On(MessageReceived, hook) }
+func (m *Manager) OnToolCall(hook Hook)        { m.On(ToolCall, hook) }
+func (m *Manager) OnResponseSent(hook Hook)    { m.On(ResponseSent, hook) }
+func (m *Manager) OnError(hook Hook)           { m.On(Error, hook) }
+
+// Emit passes e to the hooks of its type, setting its time if unset. It
+// returns the first Rejection from a MessageReceived hook, and stops there.
+// A hook that panics is logged and skipped.
+func (m *Manager) Emit(ctx context.Context, e Event) *Rejection {
+	if m == nil {
+		return nil
+	}
+	m.mu.RLock()
+	hooks := m.hooks[e.Type]
+	m.mu.RUnlock()
+	if len(hooks) == 0 {
+		return nil
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	for i, hook := range hooks {
+		err := call(ctx, hook, e)
+		if err == nil {
+			continue
+		}
+		var rejection *Rejection
+		if e.Type == MessageReceived && errors.As(err, &rejection) {
+			logger.InfoCF("hooks", "Message rejected by hook",
+				map[string]interface{}{
+					"hook":    i,
+					"channel": e.Channel,
+					"chat_id": e.ChatID,
+				})
+			return rejection
+		}
+		logger.WarnCF("hooks", "Hook failed",
+			map[string]interface{}{
+				"event": string(e.Type),
+				"hook":  i,
+				"error": err.Error(),
+			})
+	}
+	return nil
+}
+
+func call(ctx context.Context, hook Hook, e Event) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("hook panicked: %v", r)
+		}
+	}()
+	return hook(ctx, e)
+}
@@ -0,0 +1,129 @@
+package hooks
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestEmit(t *testing.T) {
+	m := NewManager()
+	var calls []string
+	m.OnMessageReceived(func(ctx context.Context, e Event) error {
+		calls = append(calls, "analytics:"+e.Content)
+		return errors.New("analytics down")
+	})
+	m.OnMessageReceived(func(ctx context.Context, e Event) error {
+		panic("bad hook")
+	})
+	m.OnMessageReceived(func(ctx context.Context, e Event) error {
+		calls = append(calls, "moderation")
+		if e.Content == "spam" {
+			return Reject("Sorry, I can't help with that.")
+		}
+		return nil
+	})
+	m.OnMessageReceived(func(ctx context.Context, e Event) error {
+		calls = append(calls, "last")
+		return nil
+	})
+	m.OnToolCall(func(ctx context.Context, e Event) error {
+		calls = append(calls, "tool:"+e.Tool)
+		return Reject("ignored")
+	})
+
+	// Failing and panicking hooks do not stop the others.
+	if r := m.Emit(context.Background(), Event{Type: MessageReceived, Content: "hello"}); r != nil {
+		t.Errorf("hello rejected: %+v", r)
+	}
+	r := m.Emit(context.Background(), Event{Type: MessageReceived, Content: "spam"})
+	if r == nil || r.Reply != "Sorry, I can't help with that." {
+		t.Errorf("spam: rejection = %+v", r)
+	}
+	// Only received messages can be rejected.
+	if r := m.Emit(context.Background(), Event{Type: ToolCall, Tool: "web_search"}); r != nil {
+		t.Errorf("tool call rejected: %+v", r)
+	}
+
+	want := []string{"analytics:hello", "moderation", "last", "analytics:spam", "moderation", "tool:web_search"}
+	if len(calls) != len(want) {
+		t.Fatalf("calls = %v, want %v", calls, want)
+	}
+	for i := range want {
+		if calls[i] != want[i] {
+			t.Fatalf("calls = %v, want %v", calls, want)
+		}
+	}
+
+	var none *Manager
+	if r := none.Emit(context.Background(), Event{Type: Error}); r != nil {
+		t.Error("nil manager rejected an event")
+	}
+}
+
+func TestWebhook(t *testing.T) {
+	type post struct {
+		event     Event
+		signature string
+		header    string
+	}
+	posts := make(chan post, 4)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var e Event
+		json.Unmarshal(body, &e)
+		mac := hmac.New(sha256.New, []byte("s3cret"))
+		mac.Write(body)
+		valid := r.Header.Get(SignatureHeader) == "sha256="+hex.EncodeToString(mac.Sum(nil))
+		posts <- post{e, map[bool]string{true: "valid", false: "invalid"}[valid], r.Header.Get("X-Crm-Key")}
+	}))
+	defer server.Close()
+
+	m := FromConfig(config.HooksConfig{Webhooks: []config.WebhookConfig{{
+		URL:     server.URL,
+		Events:  []string{"tool_call", "error"},
+		Secret:  "s3cret",
+		Headers: map[string]string{"X-Crm-Key": "k1"},
+	}}})
+	m.Emit(context.Background(), Event{Type: MessageReceived, Content: "not subscribed"})
+	m.Emit(context.Background(), Event{Type: ToolCall, ChatID: "42", Tool: "kb_search",
+		Args: map[string]interface{}{"query": "CA19-9 rising"}, Content: "3 documents"})
+
+	select {
+	case p := <-posts:
+		if p.event.Type != ToolCall || p.event.Tool != "kb_search" || p.event.ChatID != "42" {
+			t.Errorf("posted %+v", p.event)
+		}
+		if p.event.Content != "" || p.event.Args != nil {
+			t.Errorf("content was posted without include_content: %+v", p.event)
+		}
+		if p.signature != "valid" || p.header != "k1" {
+			t.Errorf("signature %s, header %q", p.signature, p.header)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook not called")
+	}
+	select {
+	case p := <-posts:
+		t.Errorf("unsubscribed event posted: %+v", p.event)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	w := NewWebhook(config.WebhookConfig{URL: server.URL, IncludeContent: true})
+	if err := w.post(Event{Type: ResponseSent, Content: "Take it with food."}); err != nil {
+		t.Fatalf("post: %v", err)
+	}
+	if p := <-posts; p.event.Content != "Take it with food." || p.signature != "invalid" {
+		t.Errorf("include_content post: %+v, signature %s", p.event, p.signature)
+	}
+}
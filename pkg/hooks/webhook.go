@@ -0,0 +1,127 @@
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+const defaultWebhookTimeout = 10 * time.Second
+
+// SignatureHeader carries "sha256=" and the hex HMAC-SHA256 of the request
+// body, keyed with the webhook's secret, when it has one.
+const SignatureHeader = "X-Picoclaw-Signature"
+
+// Webhook posts events to a URL as JSON, in the background so the agent
+// never waits for it. Failed posts are logged, not retried.
+type Webhook struct {
+	url            string
+	secret         string
+	headers        map[string]string
+	includeContent bool
+	events         []EventType
+	client         *http.Client
+}
+
+func NewWebhook(cfg config.WebhookConfig) *Webhook {
+	timeout := time.Duration(cfg.TimeoutSeconds) * time.Second
+	if timeout <= 0 {
+		timeout = defaultWebhookTimeout
+	}
+	events := EventTypes
+	if len(cfg.Events) > 0 {
+		events = make([]EventType, len(cfg.Events))
+		for i, name := range cfg.Events {
+			events[i] = EventType(name)
+		}
+	}
+	return &Webhook{
+		url:            cfg.URL,
+		secret:         cfg.Secret,
+		headers:        cfg.Headers,
+		includeContent: cfg.IncludeContent,
+		events:         events,
+		client:         &http.Client{Timeout: timeout},
+	}
+}
+
+// FromConfig returns a Manager with the configured webhooks subscribed.
+func FromConfig(cfg config.HooksConfig) *Manager {
+	m := NewManager()
+	for _, wc := range cfg.Webhooks {
+		NewWebhook(wc).Subscribe(m)
+	}
+	return m
+}
+
+// Subscribe registers the webhook for its events on m.
+func (w *Webhook) Subscribe(m *Manager) {
+	for _, t := range w.events {
+		m.On(t, func(ctx context.Context, e Event) error {
+			go w.post(e)
+			return nil
+		})
+	}
+}
+
+// post sends e. Unless the webhook includes content, the message text, tool
+// arguments and results are left out, as they may hold health information.
+func (w *Webhook) post(e Event) error {
+	if !w.includeContent {
+		e.Content = ""
+		e.Args = nil
+	}
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	err = w.send(body, e.Type)
+	if err != nil {
+		logger.WarnCF("hooks", "Webhook post failed",
+			map[string]interface{}{
+				"url":   w.url,
+				"event": string(e.Type),
+				"error": err.Error(),
+			})
+	}
+	return err
+}
+
+func (w *Webhook) send(body []byte, t EventType) error {
+	req, err := http.NewRequest(http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Picoclaw-Event", string(t))
+	for k, v := range w.headers {
+		req.Header.Set(k, v)
+	}
+	if w.secret != "" {
+		mac := hmac.New(sha256.New, []byte(w.secret))
+		mac.Write(body)
+		req.Header.Set(SignatureHeader, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+// Package memory stores conversations in SQLite, so that ongoing patient
+// conversations survive a restart and can be looked up by channel and user.
+// SQLiteStore implements session.Store: a session manager keeps working
+// from memory and writes each session through the store when it is saved.
+package memory
+
+import (
+	"errors"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/session"
+)
+
+// ErrUnsupported is returned by OpenSQLite on platforms the pure-Go SQLite
+// driver does not support.
+var ErrUnsupported = errors.New("memory: SQLite is not supported on this platform")
+
+// SessionInfo describes a stored session without its messages.
+type SessionInfo struct {
+	Key      string
+	Channel  string
+	UserID   string
+	Summary  string
+	Messages int
+	Created  time.Time
+	Updated  time.Time
+}
+
+// importer is a store that sessions can be copied into.
+type importer interface {
+	session.Store
+	Count() (int, error)
+}
+
+// importSessions copies every session in src into dst when dst is empty,
+// and returns how many were copied.
+func importSessions(dst importer, src session.Store) (int, error) {
+	if n, err := dst.Count(); err != nil || n > 0 {
+		return 0, err
+	}
+	sessions, err := src.Load()
+	if err != nil {
+		return 0, err
+	}
+	for i, s := range sessions {
+		if err := dst.Save(s); err != nil {
+			return i, err
+		}
+	}
+	return len(sessions), nil
+}
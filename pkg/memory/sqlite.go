@@ -0,0 +1,317 @@
+//go:build (linux && (386 || amd64 || arm || arm64 || loong64 || ppc64le || riscv64 || s390x)) || (darwin && (amd64 || arm64)) || (freebsd && (386 || amd64 || arm || arm64)) || (windows && (386 || amd64 || arm64)) || (netbsd && amd64) || (openbsd && (amd64 || arm64))
+
+package memory
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	_ "modernc.org/sqlite"
+
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/session"
+)
+
+const schemaVersion = 4
+
+const schema = `
+CREATE TABLE IF NOT EXISTS sessions (
+	key         TEXT PRIMARY KEY,
+	channel     TEXT NOT NULL DEFAULT '',
+	user_id     TEXT NOT NULL DEFAULT '',
+	summary     TEXT NOT NULL DEFAULT '',
+	forked_from TEXT NOT NULL DEFAULT '',
+	fork_turn   INTEGER NOT NULL DEFAULT 0,
+	scenario    TEXT NOT NULL DEFAULT '',
+	medications TEXT NOT NULL DEFAULT '',
+	intake      TEXT NOT NULL DEFAULT '',
+	scratchpad  TEXT NOT NULL DEFAULT '',
+	created     TEXT NOT NULL,
+	updated     TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS sessions_by_user ON sessions (channel, user_id);
+CREATE TABLE IF NOT EXISTS messages (
+	session_key  TEXT NOT NULL REFERENCES sessions (key) ON DELETE CASCADE,
+	seq          INTEGER NOT NULL,
+	role         TEXT NOT NULL,
+	content      TEXT NOT NULL,
+	tool_call_id TEXT NOT NULL DEFAULT '',
+	message      TEXT NOT NULL,
+	PRIMARY KEY (session_key, seq)
+);
+`
+
+// migrations[v] upgrades a database from schema version v to v+1.
+var migrations = map[int]string{
+	1: `ALTER TABLE sessions ADD COLUMN intake TEXT NOT NULL DEFAULT ''`,
+	2: `ALTER TABLE sessions ADD COLUMN scenario TEXT NOT NULL DEFAULT ''`,
+	3: `ALTER TABLE sessions ADD COLUMN scratchpad TEXT NOT NULL DEFAULT ''`,
+}
+
+// SQLiteStore keeps sessions and their messages, including tool calls and
+// tool results, in a SQLite database. Each message is stored whole as
+// JSON, next to columns for its role, content and tool call ID.
+type SQLiteStore struct {
+	db *sql.DB
+}
+
+// OpenSQLite opens or creates the database at path.
+func OpenSQLite(path string) (*SQLiteStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	dsn := "file:" + path + "?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_pragma=foreign_keys(1)"
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+	// One connection serializes writers and keeps the pragmas in effect.
+	db.SetMaxOpenConns(1)
+	var version int
+	if err := db.QueryRow(`PRAGMA user_version`).Scan(&version); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("memory: failed to create schema in %s: %w", path, err)
+	}
+	// New databases get the current schema; older ones are upgraded
+	for v := version; v > 0 && v < schemaVersion; v++ {
+		if _, err := db.Exec(migrations[v]); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("memory: failed to migrate %s to version %d: %w", path, v+1, err)
+		}
+	}
+	if _, err := db.Exec(fmt.Sprintf("PRAGMA user_version = %d", schemaVersion)); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &SQLiteStore{db: db}, nil
+}
+
+// Close closes the database.
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
+
+// Count returns the number of stored sessions.
+func (s *SQLiteStore) Count() (int, error) {
+	var n int
+	err := s.db.QueryRow(`SELECT COUNT(*) FROM sessions`).Scan(&n)
+	return n, err
+}
+
+// Import copies the sessions in src, such as the JSON session files of an
+// earlier install, when the database is still empty. It returns how many
+// sessions were copied.
+func (s *SQLiteStore) Import(src session.Store) (int, error) {
+	return importSessions(s, src)
+}
+
+// Load returns every stored session with its messages.
+func (s *SQLiteStore) Load() ([]*session.Session, error) {
+	rows, err := s.db.Query(`SELECT key, channel, user_id, summary, forked_from, fork_turn, scenario, medications, intake, scratchpad, created, updated
+		FROM sessions ORDER BY key`)
+	if err != nil {
+		return nil, err
+	}
+	var sessions []*session.Session
+	byKey := make(map[string]*session.Session)
+	for rows.Next() {
+		var (
+			sess                                       session.Session
+			meds, intake, scratchpad, created, updated string
+		)
+		if err := rows.Scan(&sess.Key, &sess.Channel, &sess.UserID, &sess.Summary, &sess.ForkedFrom, &sess.ForkTurn,
+			&sess.Scenario, &meds, &intake, &scratchpad, &created, &updated); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if meds != "" {
+			if err := json.Unmarshal([]byte(meds), &sess.Medications); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("memory: session %s: invalid medications: %w", sess.Key, err)
+			}
+		}
+		if intake != "" {
+			if err := json.Unmarshal([]byte(intake), &sess.Intake); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("memory: session %s: invalid intake: %w", sess.Key, err)
+			}
+		}
+		if scratchpad != "" {
+			if err := json.Unmarshal([]byte(scratchpad), &sess.Scratchpad); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("memory: session %s: invalid scratchpad: %w", sess.Key, err)
+			}
+		}
+		sess.Created, _ = time.Parse(time.RFC3339Nano, created)
+		sess.Updated, _ = time.Parse(time.RFC3339Nano, updated)
+		sess.Messages = []providers.Message{}
+		sessions = append(sessions, &sess)
+		byKey[sess.Key] = &sess
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = s.db.Query(`SELECT session_key, message FROM messages ORDER BY session_key, seq`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var key, data string
+		if err := rows.Scan(&key, &data); err != nil {
+			return nil, err
+		}
+		var msg providers.Message
+		if err := json.Unmarshal([]byte(data), &msg); err != nil {
+			return nil, fmt.Errorf("memory: session %s: invalid message: %w", key, err)
+		}
+		if sess := byKey[key]; sess != nil {
+			sess.Messages = append(sess.Messages, msg)
+		}
+	}
+	return sessions, rows.Err()
+}
+
+// Save writes sess in one transaction. Messages are usually only added to
+// the end of a session, so when the stored messages are still its first
+// ones only the new messages are inserted; after a history was truncated
+// or rewritten, all of them are replaced.
+func (s *SQLiteStore) Save(sess *session.Session) error {
+	if sess.Key == "" {
+		return os.ErrInvalid
+	}
+	meds := ""
+	if len(sess.Medications) > 0 {
+		data, err := json.Marshal(sess.Medications)
+		if err != nil {
+			return err
+		}
+		meds = string(data)
+	}
+	intake := ""
+	if sess.Intake != nil {
+		data, err := json.Marshal(sess.Intake)
+		if err != nil {
+			return err
+		}
+		intake = string(data)
+	}
+	scratchpad := ""
+	if len(sess.Scratchpad) > 0 {
+		data, err := json.Marshal(sess.Scratchpad)
+		if err != nil {
+			return err
+		}
+		scratchpad = string(data)
+	}
+	encoded := make([]string, len(sess.Messages))
+	for i, msg := range sess.Messages {
+		data, err := json.Marshal(msg)
+		if err != nil {
+			return err
+		}
+		encoded[i] = string(data)
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`INSERT INTO sessions (key, channel, user_id, summary, forked_from, fork_turn, scenario, medications, intake, scratchpad, created, updated)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (key) DO UPDATE SET channel = excluded.channel, user_id = excluded.user_id,
+			summary = excluded.summary, forked_from = excluded.forked_from, fork_turn = excluded.fork_turn,
+			scenario = excluded.scenario, medications = excluded.medications, intake = excluded.intake,
+			scratchpad = excluded.scratchpad, created = excluded.created, updated = excluded.updated`,
+		sess.Key, sess.Channel, sess.UserID, sess.Summary, sess.ForkedFrom, sess.ForkTurn, sess.Scenario, meds, intake, scratchpad,
+		sess.Created.Format(time.RFC3339Nano), sess.Updated.Format(time.RFC3339Nano)); err != nil {
+		return err
+	}
+
+	from, err := storedPrefix(tx, sess.Key, encoded)
+	if err != nil {
+		return err
+	}
+	if from == 0 {
+		if _, err := tx.Exec(`DELETE FROM messages WHERE session_key = ?`, sess.Key); err != nil {
+			return err
+		}
+	}
+	for i := from; i < len(sess.Messages); i++ {
+		msg := sess.Messages[i]
+		if _, err := tx.Exec(`INSERT INTO messages (session_key, seq, role, content, tool_call_id, message) VALUES (?, ?, ?, ?, ?, ?)`,
+			sess.Key, i, msg.Role, msg.Content, msg.ToolCallID, encoded[i]); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// storedPrefix returns how many of the stored messages of a session can be
+// kept: all of them when they are the first messages in encoded, judged by
+// the first and last, and otherwise none.
+func storedPrefix(tx *sql.Tx, key string, encoded []string) (int, error) {
+	var n int
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM messages WHERE session_key = ?`, key).Scan(&n); err != nil {
+		return 0, err
+	}
+	if n == 0 || n > len(encoded) {
+		return 0, nil
+	}
+	var first, last string
+	if err := tx.QueryRow(`SELECT message FROM messages WHERE session_key = ? AND seq = 0`, key).Scan(&first); err != nil {
+		return 0, ignoreNoRows(err)
+	}
+	if err := tx.QueryRow(`SELECT message FROM messages WHERE session_key = ? AND seq = ?`, key, n-1).Scan(&last); err != nil {
+		return 0, ignoreNoRows(err)
+	}
+	if first != encoded[0] || last != encoded[n-1] {
+		return 0, nil
+	}
+	return n, nil
+}
+
+func ignoreNoRows(err error) error {
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	return err
+}
+
+// Sessions returns the sessions of a user on a channel, most recently
+// updated first.
+func (s *SQLiteStore) Sessions(channel, userID string) ([]SessionInfo, error) {
+	rows, err := s.db.Query(`SELECT s.key, s.channel, s.user_id, s.summary, s.created, s.updated,
+			(SELECT COUNT(*) FROM messages m WHERE m.session_key = s.key)
+		FROM sessions s WHERE s.channel = ? AND s.user_id = ? ORDER BY s.updated DESC`, channel, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var infos []SessionInfo
+	for rows.Next() {
+		var (
+			info             SessionInfo
+			created, updated string
+		)
+		if err := rows.Scan(&info.Key, &info.Channel, &info.UserID, &info.Summary, &created, &updated, &info.Messages); err != nil {
+			return nil, err
+		}
+		info.Created, _ = time.Parse(time.RFC3339Nano, created)
+		info.Updated, _ = time.Parse(time.RFC3339Nano, updated)
+		infos = append(infos, info)
+	}
+	return infos, rows.Err()
+}
@@ -0,0 +1,188 @@
+//go:build (linux && (386 || amd64 || arm || arm64 || loong64 || ppc64le || riscv64 || s390x)) || (darwin && (amd64 || arm64)) || (freebsd && (386 || amd64 || arm || arm64)) || (windows && (386 || amd64 || arm64)) || (netbsd && amd64) || (openbsd && (amd64 || arm64))
+
+package memory
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/session"
+)
+
+func openTestStore(t *testing.T, path string) *SQLiteStore {
+	t.Helper()
+	store, err := OpenSQLite(path)
+	if err != nil {
+		t.Fatalf("OpenSQLite: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func messageCount(t *testing.T, store *SQLiteStore, key string) int {
+	t.Helper()
+	var n int
+	if err := store.db.QueryRow(`SELECT COUNT(*) FROM messages WHERE session_key = ?`, key).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestSQLiteStore_RestoreOnRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sessions", "sessions.db")
+	store := openTestStore(t, path)
+	sm, err := session.NewSessionManagerWithStore(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key := "agent:main:telegram:direct:42"
+	sm.AddMessage(key, "user", "CA19-9 是 820，正常吗？")
+	sm.SetOrigin(key, "telegram", "42")
+	sm.AddFullMessage(key, providers.Message{
+		Role: "assistant",
+		ToolCalls: []providers.ToolCall{{
+			ID:   "call_1",
+			Type: "function",
+			Function: &providers.FunctionCall{
+				Name:      "knows_ai_search",
+				Arguments: `{"query":"CA19-9 reference range"}`,
+			},
+		}},
+	})
+	sm.AddFullMessage(key, providers.Message{Role: "tool", Content: "ULN 37 U/mL", ToolCallID: "call_1"})
+	sm.SetSummary(key, "Patient asks about a raised CA19-9.")
+	sm.SetIntake(key, &session.IntakeState{Flow: "treatment", Question: "该用什么治疗？", Fields: map[string]string{"stage": "III"}, Rounds: 1})
+	if err := sm.Save(key); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	want := sm.GetHistory(key)
+	store.Close()
+
+	restored := openTestStore(t, path)
+	sm2, err := session.NewSessionManagerWithStore(restored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := sm2.GetHistory(key); !reflect.DeepEqual(got, want) {
+		t.Errorf("history = %+v, want %+v", got, want)
+	}
+	if got := sm2.GetSummary(key); got != "Patient asks about a raised CA19-9." {
+		t.Errorf("summary = %q", got)
+	}
+	if got := sm2.Intake(key); got == nil || got.Flow != "treatment" || got.Fields["stage"] != "III" || got.Rounds != 1 {
+		t.Errorf("intake = %+v", got)
+	}
+
+	infos, err := restored.Sessions("telegram", "42")
+	if err != nil || len(infos) != 1 {
+		t.Fatalf("Sessions = %+v, %v", infos, err)
+	}
+	if infos[0].Key != key || infos[0].Messages != 3 || infos[0].Updated.IsZero() {
+		t.Errorf("info = %+v", infos[0])
+	}
+	if infos, _ := restored.Sessions("discord", "42"); len(infos) != 0 {
+		t.Errorf("other channel: %+v", infos)
+	}
+}
+
+func TestSQLiteStore_MigratesVersion1(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sessions.db")
+	store := openTestStore(t, path)
+	for _, stmt := range []string{
+		`ALTER TABLE sessions DROP COLUMN intake`,
+		`ALTER TABLE sessions DROP COLUMN scenario`,
+		`ALTER TABLE sessions DROP COLUMN scratchpad`,
+		`PRAGMA user_version = 1`,
+		`INSERT INTO sessions (key, created, updated) VALUES ('s1', '2026-01-01T00:00:00Z', '2026-01-01T00:00:00Z')`,
+	} {
+		if _, err := store.db.Exec(stmt); err != nil {
+			t.Fatalf("%s: %v", stmt, err)
+		}
+	}
+	store.Close()
+
+	store = openTestStore(t, path)
+	sessions, err := store.Load()
+	if err != nil || len(sessions) != 1 || sessions[0].Intake != nil {
+		t.Fatalf("Load = %+v, %v", sessions, err)
+	}
+	sessions[0].Intake = &session.IntakeState{Flow: "treatment"}
+	sessions[0].Scenario = "the patient is ECOG 2"
+	sessions[0].Scratchpad = map[string]string{"ca19_9": "1200 U/mL"}
+	if err := store.Save(sessions[0]); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	sessions, _ = store.Load()
+	if sessions[0].Scenario != "the patient is ECOG 2" {
+		t.Errorf("scenario = %q", sessions[0].Scenario)
+	}
+	if sessions[0].Scratchpad["ca19_9"] != "1200 U/mL" {
+		t.Errorf("scratchpad = %v", sessions[0].Scratchpad)
+	}
+}
+
+func TestSQLiteStore_SaveAppendsAndRewrites(t *testing.T) {
+	store := openTestStore(t, filepath.Join(t.TempDir(), "sessions.db"))
+	now := time.Date(2026, 4, 10, 9, 0, 0, 0, time.UTC)
+	sess := &session.Session{Key: "s", Created: now, Updated: now}
+	for i, content := range []string{"a", "b", "c"} {
+		role := "user"
+		if i%2 == 1 {
+			role = "assistant"
+		}
+		sess.Messages = append(sess.Messages, providers.Message{Role: role, Content: content})
+		if err := store.Save(sess); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := messageCount(t, store, "s"); n != 3 {
+		t.Fatalf("appended: %d messages", n)
+	}
+
+	// Truncation, as after summarization, replaces the stored messages.
+	sess.Messages = []providers.Message{{Role: "user", Content: "c"}}
+	if err := store.Save(sess); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := store.Load()
+	if err != nil || len(loaded) != 1 {
+		t.Fatalf("Load = %v, %v", loaded, err)
+	}
+	if got := loaded[0].Messages; len(got) != 1 || got[0].Content != "c" {
+		t.Errorf("messages = %+v", got)
+	}
+	if !loaded[0].Created.Equal(now) {
+		t.Errorf("created = %v", loaded[0].Created)
+	}
+
+	if err := store.Save(&session.Session{}); err != os.ErrInvalid {
+		t.Errorf("empty key: %v", err)
+	}
+}
+
+func TestSQLiteStore_ImportFileSessions(t *testing.T) {
+	dir := t.TempDir()
+	files := session.NewSessionManager(dir)
+	files.AddMessage("telegram:1", "user", "hello")
+	files.Save("telegram:1")
+	files.AddMessage("discord:2", "user", "hi")
+	files.Save("discord:2")
+
+	store := openTestStore(t, filepath.Join(dir, "sessions.db"))
+	n, err := store.Import(session.NewFileStore(dir))
+	if err != nil || n != 2 {
+		t.Fatalf("Import = %d, %v", n, err)
+	}
+	// A database that already has sessions is not imported into again.
+	if n, err := store.Import(session.NewFileStore(dir)); err != nil || n != 0 {
+		t.Errorf("second Import = %d, %v", n, err)
+	}
+	if count, _ := store.Count(); count != 2 {
+		t.Errorf("Count = %d", count)
+	}
+}
@@ -0,0 +1,23 @@
+//go:build !((linux && (386 || amd64 || arm || arm64 || loong64 || ppc64le || riscv64 || s390x)) || (darwin && (amd64 || arm64)) || (freebsd && (386 || amd64 || arm || arm64)) || (windows && (386 || amd64 || arm64)) || (netbsd && amd64) || (openbsd && (amd64 || arm64)))
+
+package memory
+
+import "github.com/sipeed/picoclaw/pkg/session"
+
+// SQLiteStore is not available on this platform; see OpenSQLite.
+type SQLiteStore struct{}
+
+// OpenSQLite returns ErrUnsupported: the SQLite driver has no port for
+// this platform.
+func OpenSQLite(path string) (*SQLiteStore, error) {
+	return nil, ErrUnsupported
+}
+
+func (s *SQLiteStore) Close() error                          { return nil }
+func (s *SQLiteStore) Count() (int, error)                   { return 0, ErrUnsupported }
+func (s *SQLiteStore) Import(src session.Store) (int, error) { return 0, ErrUnsupported }
+func (s *SQLiteStore) Load() ([]*session.Session, error)     { return nil, ErrUnsupported }
+func (s *SQLiteStore) Save(sess *session.Session) error      { return ErrUnsupported }
+func (s *SQLiteStore) Sessions(channel, userID string) ([]SessionInfo, error) {
+	return nil, ErrUnsupported
+}
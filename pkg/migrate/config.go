@@ -118,7 +118,7 @@ func ConvertConfig(data map[string]interface{}) (*config.Config, []string, error
 			case "groq":
 				cfg.Providers.Groq = pc
 			case "zhipu":
-				cfg.Providers.Zhipu = pc
+				cfg.Providers.Zhipu = config.ZhipuProviderConfig{ProviderConfig: pc}
 			case "vllm":
 				cfg.Providers.VLLM = pc
 			case "gemini":
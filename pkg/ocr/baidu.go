@@ -0,0 +1,151 @@
+package ocr
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const baiduDefaultBaseURL = "https://aip.baidubce.com"
+
+// BaiduRecognizer calls Baidu cloud OCR (the "accurate" general text
+// endpoint), which reads printed Chinese reports and handwriting well.
+type BaiduRecognizer struct {
+	baseURL    string
+	apiKey     string
+	secretKey  string
+	httpClient *http.Client
+
+	mu          sync.Mutex
+	accessToken string
+	expiresAt   time.Time
+}
+
+func NewBaiduRecognizer(baseURL, apiKey, secretKey string, timeout time.Duration) *BaiduRecognizer {
+	if baseURL == "" {
+		baseURL = baiduDefaultBaseURL
+	}
+	return &BaiduRecognizer{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		apiKey:     apiKey,
+		secretKey:  secretKey,
+		httpClient: &http.Client{Timeout: timeout},
+	}
+}
+
+type baiduResponse struct {
+	ErrorCode   int    `json:"error_code"`
+	ErrorMsg    string `json:"error_msg"`
+	WordsResult []struct {
+		Words    string `json:"words"`
+		Location struct {
+			Top    float64 `json:"top"`
+			Left   float64 `json:"left"`
+			Width  float64 `json:"width"`
+			Height float64 `json:"height"`
+		} `json:"location"`
+	} `json:"words_result"`
+}
+
+func (r *BaiduRecognizer) Recognize(ctx context.Context, imagePath string) (string, error) {
+	image, err := os.ReadFile(imagePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read image: %w", err)
+	}
+	token, err := r.token(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{"image": {base64.StdEncoding.EncodeToString(image)}}
+	endpoint := r.baseURL + "/rest/2.0/ocr/v1/accurate?access_token=" + url.QueryEscape(token)
+	var decoded baiduResponse
+	if err := r.post(ctx, endpoint, form, &decoded); err != nil {
+		return "", err
+	}
+	if decoded.ErrorCode != 0 {
+		if decoded.ErrorCode == 110 || decoded.ErrorCode == 111 {
+			// The token was revoked or expired early; fetch a new one next time.
+			r.mu.Lock()
+			r.accessToken = ""
+			r.mu.Unlock()
+		}
+		return "", fmt.Errorf("baidu ocr error %d: %s", decoded.ErrorCode, decoded.ErrorMsg)
+	}
+
+	boxes := make([]textBox, 0, len(decoded.WordsResult))
+	for _, w := range decoded.WordsResult {
+		boxes = append(boxes, textBox{
+			text:   w.Words,
+			x:      w.Location.Left,
+			y:      w.Location.Top,
+			height: w.Location.Height,
+		})
+	}
+	return layoutLines(boxes), nil
+}
+
+// token returns the OAuth access token, fetching a new one when the cached
+// token is missing or about to expire.
+func (r *BaiduRecognizer) token(ctx context.Context) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.accessToken != "" && time.Now().Before(r.expiresAt) {
+		return r.accessToken, nil
+	}
+
+	form := url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {r.apiKey},
+		"client_secret": {r.secretKey},
+	}
+	var decoded struct {
+		AccessToken      string `json:"access_token"`
+		ExpiresIn        int    `json:"expires_in"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := r.post(ctx, r.baseURL+"/oauth/2.0/token", form, &decoded); err != nil {
+		return "", err
+	}
+	if decoded.AccessToken == "" {
+		return "", fmt.Errorf("baidu ocr token request failed: %s %s", decoded.Error, decoded.ErrorDescription)
+	}
+	r.accessToken = decoded.AccessToken
+	// Renew a minute early so a token never expires mid-request.
+	r.expiresAt = time.Now().Add(time.Duration(decoded.ExpiresIn)*time.Second - time.Minute)
+	return r.accessToken, nil
+}
+
+func (r *BaiduRecognizer) post(ctx context.Context, endpoint string, form url.Values, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := r.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("baidu ocr request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("baidu ocr returned status %d: %s", resp.StatusCode, data)
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("failed to parse baidu ocr response: %w", err)
+	}
+	return nil
+}
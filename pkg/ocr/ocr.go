@@ -0,0 +1,91 @@
+// Package ocr reads the text in photos, such as lab reports and
+// prescriptions, using a PaddleOCR service or a cloud OCR API.
+package ocr
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+// Recognizer reads the text in an image file. Lines come back top to
+// bottom, with the cells of a table row joined on one line, so a lab report
+// keeps one result per line.
+type Recognizer interface {
+	Recognize(ctx context.Context, imagePath string) (string, error)
+}
+
+// New returns the recognizer for cfg.Backend.
+func New(cfg config.OCRConfig) (Recognizer, error) {
+	timeout := time.Duration(cfg.TimeoutSeconds) * time.Second
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	switch strings.ToLower(cfg.Backend) {
+	case "", "paddle":
+		if cfg.PaddleURL == "" {
+			return nil, fmt.Errorf("ocr: paddle_url is not set")
+		}
+		return NewPaddleRecognizer(cfg.PaddleURL, timeout), nil
+	case "baidu":
+		if cfg.BaiduAPIKey == "" || cfg.BaiduSecretKey == "" {
+			return nil, fmt.Errorf("ocr: baidu_api_key and baidu_secret_key are required")
+		}
+		return NewBaiduRecognizer(cfg.BaiduBaseURL, cfg.BaiduAPIKey, cfg.BaiduSecretKey, timeout), nil
+	}
+	return nil, fmt.Errorf("ocr: unknown backend %q", cfg.Backend)
+}
+
+// textBox is one piece of recognized text and where it sits in the image.
+type textBox struct {
+	text   string
+	x, y   float64 // top-left corner
+	height float64
+}
+
+// layoutLines joins boxes into lines of text. Boxes whose vertical centres
+// are within half a line height of each other are on the same line, and
+// are joined left to right with two spaces, as columns in a report.
+func layoutLines(boxes []textBox) string {
+	var kept []textBox
+	for _, b := range boxes {
+		if b.text = strings.TrimSpace(b.text); b.text != "" {
+			kept = append(kept, b)
+		}
+	}
+	sort.SliceStable(kept, func(i, j int) bool {
+		return kept[i].y+kept[i].height/2 < kept[j].y+kept[j].height/2
+	})
+
+	var lines []string
+	var row []textBox
+	flush := func() {
+		sort.SliceStable(row, func(i, j int) bool { return row[i].x < row[j].x })
+		cells := make([]string, len(row))
+		for i, b := range row {
+			cells[i] = b.text
+		}
+		lines = append(lines, strings.Join(cells, "  "))
+		row = nil
+	}
+	var rowCentre, rowHeight float64
+	for _, b := range kept {
+		centre := b.y + b.height/2
+		if len(row) > 0 && math.Abs(centre-rowCentre) > math.Max(rowHeight, b.height)/2 {
+			flush()
+		}
+		if len(row) == 0 {
+			rowCentre, rowHeight = centre, b.height
+		}
+		row = append(row, b)
+	}
+	if len(row) > 0 {
+		flush()
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,160 @@
+package ocr
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func writeImage(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "report.jpg")
+	if err := os.WriteFile(path, []byte("fake jpeg"), 0600); err != nil {
+		t.Fatalf("write image: %v", err)
+	}
+	return path
+}
+
+func TestLayoutLines(t *testing.T) {
+	tests := []struct {
+		name  string
+		boxes []textBox
+		want  string
+	}{
+		{
+			name: "table rows",
+			boxes: []textBox{
+				{text: "U/mL", x: 300, y: 52, height: 20},
+				{text: "CA19-9", x: 10, y: 50, height: 20},
+				{text: "CEA", x: 10, y: 80, height: 20},
+				{text: "125.3", x: 150, y: 48, height: 20},
+				{text: "3.1", x: 150, y: 81, height: 20},
+			},
+			want: "CA19-9  125.3  U/mL\nCEA  3.1",
+		},
+		{
+			name: "blank boxes dropped",
+			boxes: []textBox{
+				{text: " ", x: 0, y: 0, height: 10},
+				{text: "姓名", x: 0, y: 20, height: 10},
+			},
+			want: "姓名",
+		},
+		{name: "empty", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := layoutLines(tt.boxes); got != tt.want {
+				t.Errorf("layoutLines() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPaddleRecognizer(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Images []string `json:"images"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || len(body.Images) != 1 {
+			t.Errorf("unexpected request body: %v %v", body, err)
+		}
+		w.Write([]byte(`{"status": "000", "msg": "", "results": [[
+			{"text": "125.3", "confidence": 0.98, "text_region": [[150, 48], [200, 48], [200, 68], [150, 68]]},
+			{"text": "CA19-9", "confidence": 0.99, "text_region": [[10, 50], [80, 50], [80, 70], [10, 70]]},
+			{"text": "检验报告单", "confidence": 0.99, "text_region": [[100, 5], [260, 5], [260, 30], [100, 30]]}
+		]]}`))
+	}))
+	defer server.Close()
+
+	text, err := NewPaddleRecognizer(server.URL, 5*time.Second).Recognize(context.Background(), writeImage(t))
+	if err != nil {
+		t.Fatalf("Recognize() error: %v", err)
+	}
+	if want := "检验报告单\nCA19-9  125.3"; text != want {
+		t.Errorf("Recognize() = %q, want %q", text, want)
+	}
+}
+
+func TestPaddleRecognizer_ServiceError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"status": "101", "msg": "image decode failed", "results": []}`))
+	}))
+	defer server.Close()
+
+	if _, err := NewPaddleRecognizer(server.URL, 5*time.Second).Recognize(context.Background(), writeImage(t)); err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+func TestBaiduRecognizer_CachesToken(t *testing.T) {
+	var tokenRequests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/oauth/2.0/token":
+			atomic.AddInt32(&tokenRequests, 1)
+			r.ParseForm()
+			if r.Form.Get("client_id") != "ak" || r.Form.Get("client_secret") != "sk" {
+				t.Errorf("unexpected credentials: %v", r.Form)
+			}
+			w.Write([]byte(`{"access_token": "tok", "expires_in": 2592000}`))
+		case "/rest/2.0/ocr/v1/accurate":
+			r.ParseForm()
+			if r.URL.Query().Get("access_token") != "tok" || r.Form.Get("image") == "" {
+				t.Errorf("unexpected request: %s %v", r.URL, r.Form)
+			}
+			w.Write([]byte(`{"words_result": [
+				{"words": "白细胞", "location": {"top": 40, "left": 10, "width": 60, "height": 18}},
+				{"words": "2.1", "location": {"top": 42, "left": 120, "width": 30, "height": 18}}
+			]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	recognizer := NewBaiduRecognizer(server.URL, "ak", "sk", 5*time.Second)
+	image := writeImage(t)
+	for i := 0; i < 2; i++ {
+		text, err := recognizer.Recognize(context.Background(), image)
+		if err != nil {
+			t.Fatalf("Recognize() error: %v", err)
+		}
+		if text != "白细胞  2.1" {
+			t.Errorf("Recognize() = %q", text)
+		}
+	}
+	if n := atomic.LoadInt32(&tokenRequests); n != 1 {
+		t.Errorf("token requested %d times, want 1", n)
+	}
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     config.OCRConfig
+		wantErr bool
+	}{
+		{name: "paddle", cfg: config.OCRConfig{Backend: "paddle", PaddleURL: "http://localhost:8868/predict/ocr_system"}},
+		{name: "paddle without url", cfg: config.OCRConfig{Backend: "paddle"}, wantErr: true},
+		{name: "baidu", cfg: config.OCRConfig{Backend: "baidu", BaiduAPIKey: "ak", BaiduSecretKey: "sk"}},
+		{name: "baidu without keys", cfg: config.OCRConfig{Backend: "baidu", BaiduAPIKey: "ak"}, wantErr: true},
+		{name: "unknown", cfg: config.OCRConfig{Backend: "tesseract"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(tt.cfg)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("New() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
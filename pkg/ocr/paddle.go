@@ -0,0 +1,100 @@
+package ocr
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"time"
+)
+
+// PaddleRecognizer calls a PaddleOCR hub serving endpoint, such as
+// http://127.0.0.1:8868/predict/ocr_system started with
+// `hub serving start -m ch_pp-ocrv3`.
+type PaddleRecognizer struct {
+	url        string
+	httpClient *http.Client
+}
+
+func NewPaddleRecognizer(url string, timeout time.Duration) *PaddleRecognizer {
+	return &PaddleRecognizer{
+		url:        url,
+		httpClient: &http.Client{Timeout: timeout},
+	}
+}
+
+type paddleResponse struct {
+	Status  string `json:"status"`
+	Msg     string `json:"msg"`
+	Results [][]struct {
+		Text       string      `json:"text"`
+		Confidence float64     `json:"confidence"`
+		TextRegion [][]float64 `json:"text_region"`
+	} `json:"results"`
+}
+
+func (r *PaddleRecognizer) Recognize(ctx context.Context, imagePath string) (string, error) {
+	image, err := os.ReadFile(imagePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read image: %w", err)
+	}
+	body, _ := json.Marshal(map[string]interface{}{
+		"images": []string{base64.StdEncoding.EncodeToString(image)},
+	})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.url, bytes.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := r.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("paddleocr request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("paddleocr returned status %d: %s", resp.StatusCode, data)
+	}
+
+	var decoded paddleResponse
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return "", fmt.Errorf("failed to parse paddleocr response: %w", err)
+	}
+	if decoded.Status != "" && decoded.Status != "000" {
+		return "", fmt.Errorf("paddleocr error %s: %s", decoded.Status, decoded.Msg)
+	}
+
+	var boxes []textBox
+	for _, image := range decoded.Results {
+		for _, item := range image {
+			box := textBox{text: item.Text}
+			// text_region is the four corners of the box.
+			minY, maxY := math.Inf(1), math.Inf(-1)
+			box.x = math.Inf(1)
+			for _, point := range item.TextRegion {
+				if len(point) < 2 {
+					continue
+				}
+				box.x = math.Min(box.x, point[0])
+				minY, maxY = math.Min(minY, point[1]), math.Max(maxY, point[1])
+			}
+			if !math.IsInf(box.x, 1) {
+				box.y, box.height = minY, maxY-minY
+			} else {
+				// Without a region, keep the service's order, one per line.
+				box.x, box.y = 0, float64(len(boxes))
+			}
+			boxes = append(boxes, box)
+		}
+	}
+	return layoutLines(boxes), nil
+}
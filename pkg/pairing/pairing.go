@@ -0,0 +1,230 @@
+// Package pairing lets people who are not on a channel's allowlist ask for
+// access. The bot answers them with a short code; whoever runs the bot
+// approves the code from the command line, and from then on the person is
+// allowed on that channel. Requests and approvals are kept in one JSON file
+// that the gateway and the CLI share.
+package pairing
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CodeTTL is how long a pairing code can be approved.
+const CodeTTL = time.Hour
+
+// codeAlphabet leaves out characters that are easy to misread when a code
+// is passed on by hand: 0/O, 1/I/L.
+const codeAlphabet = "ABCDEFGHJKMNPQRSTUVWXYZ23456789"
+
+const codeLen = 8
+
+// Request is a pending request for access.
+type Request struct {
+	Channel   string    `json:"channel"`
+	SenderID  string    `json:"sender_id"`
+	Code      string    `json:"code"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Approval is a person allowed on a channel through pairing.
+type Approval struct {
+	Channel    string    `json:"channel"`
+	SenderID   string    `json:"sender_id"`
+	ApprovedAt time.Time `json:"approved_at"`
+}
+
+type document struct {
+	Pending  []Request  `json:"pending"`
+	Approved []Approval `json:"approved"`
+}
+
+// Store reads and writes the pairing file. It reloads the file when
+// another process has changed it, so approvals made with the CLI take
+// effect in a running gateway.
+type Store struct {
+	path    string
+	mu      sync.Mutex
+	doc     document
+	modTime time.Time
+	size    int64
+	now     func() time.Time
+}
+
+// NewStore returns a store for the pairing file at path, which need not
+// exist yet.
+func NewStore(path string) *Store {
+	return &Store{path: path, now: time.Now}
+}
+
+// IsPaired reports whether senderID has been approved on channel.
+func (s *Store) IsPaired(channel, senderID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.reload(); err != nil {
+		return false
+	}
+	for _, a := range s.doc.Approved {
+		if a.Channel == channel && a.SenderID == senderID {
+			return true
+		}
+	}
+	return false
+}
+
+// Request returns the pairing code for senderID on channel, creating one
+// unless the sender already has a code that has not expired.
+func (s *Store) Request(channel, senderID string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.reload(); err != nil {
+		return "", err
+	}
+	s.expire()
+	for _, r := range s.doc.Pending {
+		if r.Channel == channel && r.SenderID == senderID {
+			return r.Code, nil
+		}
+	}
+	code, err := newCode()
+	if err != nil {
+		return "", err
+	}
+	s.doc.Pending = append(s.doc.Pending, Request{
+		Channel:   channel,
+		SenderID:  senderID,
+		Code:      code,
+		CreatedAt: s.now(),
+	})
+	return code, s.save()
+}
+
+// Approve allows the sender who was given code on channel.
+func (s *Store) Approve(channel, code string) (Approval, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.reload(); err != nil {
+		return Approval{}, err
+	}
+	s.expire()
+	code = strings.ToUpper(strings.TrimSpace(code))
+	for i, r := range s.doc.Pending {
+		if r.Channel != channel || r.Code != code {
+			continue
+		}
+		s.doc.Pending = append(s.doc.Pending[:i], s.doc.Pending[i+1:]...)
+		approval := Approval{Channel: channel, SenderID: r.SenderID, ApprovedAt: s.now()}
+		s.doc.Approved = append(s.doc.Approved, approval)
+		return approval, s.save()
+	}
+	return Approval{}, fmt.Errorf("no pending request on %s with code %s (codes expire after %s)", channel, code, CodeTTL)
+}
+
+// Revoke removes the approval of senderID on channel.
+func (s *Store) Revoke(channel, senderID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.reload(); err != nil {
+		return err
+	}
+	for i, a := range s.doc.Approved {
+		if a.Channel == channel && a.SenderID == senderID {
+			s.doc.Approved = append(s.doc.Approved[:i], s.doc.Approved[i+1:]...)
+			return s.save()
+		}
+	}
+	return fmt.Errorf("%s is not paired on %s", senderID, channel)
+}
+
+// List returns the pending requests that have not expired and the
+// approvals, oldest first.
+func (s *Store) List() ([]Request, []Approval, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.reload(); err != nil {
+		return nil, nil, err
+	}
+	s.expire()
+	pending := append([]Request(nil), s.doc.Pending...)
+	approved := append([]Approval(nil), s.doc.Approved...)
+	sort.Slice(pending, func(i, j int) bool { return pending[i].CreatedAt.Before(pending[j].CreatedAt) })
+	sort.Slice(approved, func(i, j int) bool { return approved[i].ApprovedAt.Before(approved[j].ApprovedAt) })
+	return pending, approved, nil
+}
+
+// reload reads the file if it changed since it was last read.
+func (s *Store) reload() error {
+	info, err := os.Stat(s.path)
+	if os.IsNotExist(err) {
+		s.doc, s.modTime, s.size = document{}, time.Time{}, 0
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.ModTime().Equal(s.modTime) && info.Size() == s.size {
+		return nil
+	}
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return err
+	}
+	var doc document
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", s.path, err)
+	}
+	s.doc, s.modTime, s.size = doc, info.ModTime(), info.Size()
+	return nil
+}
+
+// expire drops pending requests older than CodeTTL. They are removed from
+// the file the next time it is saved.
+func (s *Store) expire() {
+	kept := s.doc.Pending[:0]
+	for _, r := range s.doc.Pending {
+		if s.now().Sub(r.CreatedAt) < CodeTTL {
+			kept = append(kept, r)
+		}
+	}
+	s.doc.Pending = kept
+}
+
+func (s *Store) save() error {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(s.doc, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if info, err := os.Stat(s.path); err == nil {
+		s.modTime, s.size = info.ModTime(), info.Size()
+	}
+	return nil
+}
+
+func newCode() (string, error) {
+	buf := make([]byte, codeLen)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	for i, b := range buf {
+		buf[i] = codeAlphabet[int(b)%len(codeAlphabet)]
+	}
+	return string(buf), nil
+}
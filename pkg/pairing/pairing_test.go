@@ -0,0 +1,72 @@
+package pairing
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "pairing.json")
+	gateway := NewStore(path)
+	cli := NewStore(path)
+
+	code, err := gateway.Request("telegram", "1001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(code) != codeLen {
+		t.Errorf("code = %q", code)
+	}
+	if again, _ := gateway.Request("telegram", "1001"); again != code {
+		t.Errorf("second request got a new code %q, want %q", again, code)
+	}
+	if gateway.IsPaired("telegram", "1001") {
+		t.Error("paired before approval")
+	}
+
+	if _, err := cli.Approve("discord", code); err == nil {
+		t.Error("code approved on the wrong channel")
+	}
+	approval, err := cli.Approve("telegram", code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if approval.SenderID != "1001" {
+		t.Errorf("approved %q", approval.SenderID)
+	}
+	if _, err := cli.Approve("telegram", code); err == nil {
+		t.Error("code approved twice")
+	}
+
+	// The gateway's store sees the CLI's approval
+	if !gateway.IsPaired("telegram", "1001") || gateway.IsPaired("discord", "1001") {
+		t.Error("approval not seen by the gateway")
+	}
+
+	if err := cli.Revoke("telegram", "1001"); err != nil {
+		t.Fatal(err)
+	}
+	if gateway.IsPaired("telegram", "1001") {
+		t.Error("still paired after revoking")
+	}
+}
+
+func TestStoreExpiry(t *testing.T) {
+	now := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+	s := NewStore(filepath.Join(t.TempDir(), "pairing.json"))
+	s.now = func() time.Time { return now }
+
+	code, _ := s.Request("whatsapp", "6591234567")
+	now = now.Add(CodeTTL + time.Minute)
+
+	if pending, _, _ := s.List(); len(pending) != 0 {
+		t.Errorf("expired request listed: %+v", pending)
+	}
+	if _, err := s.Approve("whatsapp", code); err == nil {
+		t.Error("expired code approved")
+	}
+	if fresh, _ := s.Request("whatsapp", "6591234567"); fresh == code {
+		t.Error("expired code reissued")
+	}
+}
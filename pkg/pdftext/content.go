@@ -0,0 +1,284 @@
+package pdftext
+
+import (
+	"bytes"
+	"math"
+	"strings"
+)
+
+// matrix is a PDF transformation matrix [a b c d e f].
+type matrix [6]float64
+
+var identity = matrix{1, 0, 0, 1, 0, 0}
+
+// mul returns m × n: the transformation m followed by n.
+func (m matrix) mul(n matrix) matrix {
+	return matrix{
+		m[0]*n[0] + m[1]*n[2], m[0]*n[1] + m[1]*n[3],
+		m[2]*n[0] + m[3]*n[2], m[2]*n[1] + m[3]*n[3],
+		m[4]*n[0] + m[5]*n[2] + n[4], m[4]*n[1] + m[5]*n[3] + n[5],
+	}
+}
+
+func translate(x, y float64) matrix {
+	return matrix{1, 0, 0, 1, x, y}
+}
+
+// textRun is a piece of text drawn in one operation, in page coordinates.
+type textRun struct {
+	x, y float64 // start of the baseline
+	endX float64
+	size float64 // font height on the page
+	text string
+}
+
+type graphicsState struct {
+	ctm       matrix
+	font      *font
+	fontSize  float64
+	charSpace float64
+	wordSpace float64
+	hScale    float64
+	leading   float64
+	rise      float64
+}
+
+const (
+	maxFormDepth = 8
+	maxPageRuns  = 200000
+)
+
+// interpreter runs a page's content streams and records the text drawn.
+type interpreter struct {
+	doc   *document
+	state graphicsState
+	stack []graphicsState
+	tm    matrix
+	tlm   matrix
+	runs  []textRun
+}
+
+func newInterpreter(doc *document) *interpreter {
+	return &interpreter{
+		doc:   doc,
+		state: graphicsState{ctm: identity, hScale: 1},
+		tm:    identity,
+		tlm:   identity,
+	}
+}
+
+func (in *interpreter) run(content []byte, resources dict, depth int) {
+	p := &parser{data: content}
+	var operands []interface{}
+	for len(in.runs) < maxPageRuns {
+		obj, err := p.object()
+		if err != nil {
+			return
+		}
+		op, ok := obj.(keyword)
+		if !ok {
+			operands = append(operands, obj)
+			continue
+		}
+		in.apply(p, string(op), operands, resources, depth)
+		operands = operands[:0]
+	}
+}
+
+func (in *interpreter) apply(p *parser, op string, args []interface{}, resources dict, depth int) {
+	num := func(i int) float64 {
+		if i < len(args) {
+			f, _ := toFloat(args[i])
+			return f
+		}
+		return 0
+	}
+	mat := func() (matrix, bool) {
+		if len(args) < 6 {
+			return identity, false
+		}
+		var m matrix
+		for i := range m {
+			m[i] = num(len(args) - 6 + i)
+		}
+		return m, true
+	}
+	last := func() interface{} {
+		if len(args) == 0 {
+			return nil
+		}
+		return args[len(args)-1]
+	}
+
+	switch op {
+	case "q":
+		in.stack = append(in.stack, in.state)
+	case "Q":
+		if n := len(in.stack); n > 0 {
+			in.state = in.stack[n-1]
+			in.stack = in.stack[:n-1]
+		}
+	case "cm":
+		if m, ok := mat(); ok {
+			in.state.ctm = m.mul(in.state.ctm)
+		}
+	case "BT":
+		in.tm, in.tlm = identity, identity
+	case "Tf":
+		if len(args) >= 2 {
+			if fontName, ok := args[len(args)-2].(name); ok {
+				fonts := in.doc.dict(resources["Font"])
+				in.state.font = in.doc.font(fonts[fontName])
+			}
+			in.state.fontSize = num(len(args) - 1)
+		}
+	case "Tc":
+		in.state.charSpace = num(0)
+	case "Tw":
+		in.state.wordSpace = num(0)
+	case "Tz":
+		in.state.hScale = num(0) / 100
+	case "TL":
+		in.state.leading = num(0)
+	case "Ts":
+		in.state.rise = num(0)
+	case "Td":
+		in.moveLine(num(0), num(1))
+	case "TD":
+		in.state.leading = -num(1)
+		in.moveLine(num(0), num(1))
+	case "Tm":
+		if m, ok := mat(); ok {
+			in.tm, in.tlm = m, m
+		}
+	case "T*":
+		in.moveLine(0, -in.state.leading)
+	case "Tj":
+		if s, ok := last().([]byte); ok {
+			in.show(s)
+		}
+	case "'":
+		in.moveLine(0, -in.state.leading)
+		if s, ok := last().([]byte); ok {
+			in.show(s)
+		}
+	case "\"":
+		if len(args) >= 3 {
+			in.state.wordSpace = num(0)
+			in.state.charSpace = num(1)
+		}
+		in.moveLine(0, -in.state.leading)
+		if s, ok := last().([]byte); ok {
+			in.show(s)
+		}
+	case "TJ":
+		items, _ := last().(array)
+		for _, item := range items {
+			switch x := item.(type) {
+			case []byte:
+				in.show(x)
+			case int, float64:
+				adjust, _ := toFloat(x)
+				tx := -adjust / 1000 * in.state.fontSize * in.state.hScale
+				in.tm = translate(tx, 0).mul(in.tm)
+			}
+		}
+	case "Do":
+		if xname, ok := last().(name); ok && depth < maxFormDepth {
+			in.form(in.doc.dict(resources["XObject"])[xname], resources, depth)
+		}
+	case "BI":
+		skipInlineImage(p)
+	}
+}
+
+func (in *interpreter) moveLine(tx, ty float64) {
+	in.tlm = translate(tx, ty).mul(in.tlm)
+	in.tm = in.tlm
+}
+
+// form runs a form XObject, which can hold text of its own.
+func (in *interpreter) form(v interface{}, resources dict, depth int) {
+	s, ok := in.doc.resolve(v).(*stream)
+	if !ok || s.dict["Subtype"] != name("Form") {
+		return
+	}
+	data, err := in.doc.decode(s)
+	if err != nil {
+		return
+	}
+	if res := in.doc.dict(s.dict["Resources"]); res != nil {
+		resources = res
+	}
+	saved, savedStack, tm, tlm := in.state, len(in.stack), in.tm, in.tlm
+	if a := in.doc.array(s.dict["Matrix"]); len(a) == 6 {
+		var m matrix
+		for i := range m {
+			m[i], _ = in.doc.number(a[i])
+		}
+		in.state.ctm = m.mul(in.state.ctm)
+	}
+	in.run(data, resources, depth+1)
+	in.state, in.stack, in.tm, in.tlm = saved, in.stack[:savedStack], tm, tlm
+}
+
+// show draws a string, recording it as one run and advancing the text
+// position by the width of each glyph.
+func (in *interpreter) show(s []byte) {
+	st := &in.state
+	f := st.font
+	if f == nil {
+		f = in.doc.loadFont(nil)
+		st.font = f
+	}
+	textSpace := matrix{st.fontSize * st.hScale, 0, 0, st.fontSize, 0, st.rise}
+	start := textSpace.mul(in.tm).mul(st.ctm)
+
+	var text strings.Builder
+	for _, g := range f.decode(s) {
+		text.WriteString(g.text)
+		tx := g.width / 1000 * st.fontSize
+		tx += st.charSpace
+		if g.space {
+			tx += st.wordSpace
+		}
+		in.tm = translate(tx*st.hScale, 0).mul(in.tm)
+	}
+	end := textSpace.mul(in.tm).mul(st.ctm)
+
+	if strings.TrimSpace(text.String()) == "" {
+		return
+	}
+	in.runs = append(in.runs, textRun{
+		x:    start[4],
+		y:    start[5],
+		endX: end[4],
+		size: math.Hypot(start[2], start[3]),
+		text: text.String(),
+	})
+}
+
+// skipInlineImage moves past the data of an inline image, which follows
+// "ID" and ends at "EI".
+func skipInlineImage(p *parser) {
+	i := bytes.Index(p.data[p.pos:], []byte("ID"))
+	if i < 0 {
+		p.pos = len(p.data)
+		return
+	}
+	pos := p.pos + i + 2
+	for {
+		j := bytes.Index(p.data[pos:], []byte("EI"))
+		if j < 0 {
+			p.pos = len(p.data)
+			return
+		}
+		at := pos + j
+		after := at + 2
+		if at > 0 && isSpace(p.data[at-1]) && (after >= len(p.data) || isSpace(p.data[after])) {
+			p.pos = after
+			return
+		}
+		pos = after
+	}
+}
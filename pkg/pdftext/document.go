@@ -0,0 +1,372 @@
+package pdftext
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/ascii85"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+// maxDecodedStream bounds a decompressed stream, so a small file cannot
+// expand into gigabytes.
+const maxDecodedStream = 64 << 20
+
+var (
+	objHeader = regexp.MustCompile(`(?:^|[^0-9])([0-9]+)[\x00\t\n\f\r ]+([0-9]+)[\x00\t\n\f\r ]+obj\b`)
+	trailerKW = regexp.MustCompile(`trailer[\x00\t\n\f\r ]*<<`)
+)
+
+// document gives access to the objects of a PDF file. Objects are found by
+// scanning for "N G obj" rather than through the cross-reference table,
+// which also recovers files whose table is damaged.
+type document struct {
+	data    []byte
+	offsets map[int]int
+	cache   map[int]interface{}
+	// packed holds the objects stored in object streams.
+	packed  map[int]interface{}
+	trailer dict
+	fonts   map[interface{}]*font
+}
+
+func openDocument(data []byte) (*document, error) {
+	head := data
+	if len(head) > 1024 {
+		head = head[:1024]
+	}
+	if !bytes.Contains(head, []byte("%PDF-")) {
+		return nil, ErrNotPDF
+	}
+
+	d := &document{
+		data:    data,
+		offsets: make(map[int]int),
+		cache:   make(map[int]interface{}),
+		packed:  make(map[int]interface{}),
+		fonts:   make(map[interface{}]*font),
+	}
+	// Later definitions win, as in an incrementally updated file.
+	for _, m := range objHeader.FindAllSubmatchIndex(data, -1) {
+		num, _ := strconv.Atoi(string(data[m[2]:m[3]]))
+		d.offsets[num] = m[2]
+	}
+
+	nums := make([]int, 0, len(d.offsets))
+	for num := range d.offsets {
+		nums = append(nums, num)
+	}
+	sort.Ints(nums)
+	var xrefStreams []dict
+	for _, num := range nums {
+		s, ok := d.object(num).(*stream)
+		if !ok {
+			continue
+		}
+		switch s.dict["Type"] {
+		case name("ObjStm"):
+			d.unpackObjectStream(s)
+		case name("XRef"):
+			xrefStreams = append(xrefStreams, s.dict)
+		}
+	}
+
+	if locs := trailerKW.FindAllIndex(data, -1); len(locs) > 0 {
+		p := &parser{data: data, pos: locs[len(locs)-1][0] + len("trailer")}
+		if t, err := p.object(); err == nil {
+			d.trailer, _ = t.(dict)
+		}
+	}
+	if d.trailer == nil && len(xrefStreams) > 0 {
+		d.trailer = xrefStreams[len(xrefStreams)-1]
+	}
+	if d.trailer != nil && d.trailer["Encrypt"] != nil {
+		return nil, ErrEncrypted
+	}
+	return d, nil
+}
+
+// object returns indirect object num, or nil if it does not exist.
+func (d *document) object(num int) interface{} {
+	if v, ok := d.cache[num]; ok {
+		return v
+	}
+	d.cache[num] = nil // guards against reference loops
+	var v interface{}
+	if off, ok := d.offsets[num]; ok {
+		v = d.parseAt(off)
+	} else {
+		v = d.packed[num]
+	}
+	d.cache[num] = v
+	return v
+}
+
+// parseAt reads the indirect object whose header starts at off.
+func (d *document) parseAt(off int) interface{} {
+	p := &parser{data: d.data, pos: off}
+	for i := 0; i < 3; i++ { // num gen obj
+		if _, err := p.token(); err != nil {
+			return nil
+		}
+	}
+	v, err := p.object()
+	if err != nil {
+		return nil
+	}
+	dv, ok := v.(dict)
+	if !ok {
+		return v
+	}
+	save := p.pos
+	if tok, err := p.token(); err != nil || tok != keyword("stream") {
+		p.pos = save
+		return dv
+	}
+	length := -1
+	switch l := dv["Length"].(type) {
+	case int:
+		length = l
+	case ref:
+		if n, ok := d.resolve(l).(int); ok {
+			length = n
+		}
+	}
+	return &stream{dict: dv, raw: p.streamData(length)}
+}
+
+func (d *document) unpackObjectStream(s *stream) {
+	data, err := d.decode(s)
+	if err != nil {
+		return
+	}
+	n, _ := s.dict["N"].(int)
+	first, _ := s.dict["First"].(int)
+	if first <= 0 || first > len(data) {
+		return
+	}
+	header := &parser{data: data[:first]}
+	for i := 0; i < n; i++ {
+		num, err1 := header.token()
+		off, err2 := header.token()
+		if err1 != nil || err2 != nil {
+			return
+		}
+		objNum, ok1 := num.(int)
+		objOff, ok2 := off.(int)
+		if !ok1 || !ok2 || first+objOff >= len(data) {
+			continue
+		}
+		if _, direct := d.offsets[objNum]; direct {
+			continue
+		}
+		p := &parser{data: data, pos: first + objOff}
+		if v, err := p.object(); err == nil {
+			d.packed[objNum] = v
+		}
+	}
+}
+
+// resolve follows references until it reaches a direct object.
+func (d *document) resolve(v interface{}) interface{} {
+	for i := 0; i < 32; i++ {
+		r, ok := v.(ref)
+		if !ok {
+			return v
+		}
+		v = d.object(r.num)
+	}
+	return nil
+}
+
+func (d *document) dict(v interface{}) dict {
+	switch x := d.resolve(v).(type) {
+	case dict:
+		return x
+	case *stream:
+		return x.dict
+	}
+	return nil
+}
+
+func (d *document) array(v interface{}) array {
+	a, _ := d.resolve(v).(array)
+	return a
+}
+
+func (d *document) number(v interface{}) (float64, bool) {
+	return toFloat(d.resolve(v))
+}
+
+// decode returns the stream's data with its filters removed.
+func (d *document) decode(s *stream) ([]byte, error) {
+	var filters []interface{}
+	switch f := d.resolve(s.dict["Filter"]).(type) {
+	case name:
+		filters = []interface{}{f}
+	case array:
+		filters = f
+	}
+	data := s.raw
+	for _, f := range filters {
+		var err error
+		switch d.resolve(f) {
+		case name("FlateDecode"), name("Fl"):
+			data, err = inflate(data)
+		case name("ASCIIHexDecode"), name("AHx"):
+			data = (&parser{data: append(append([]byte{'<'}, data...), '>')}).hexString()
+		case name("ASCII85Decode"), name("A85"):
+			data, err = decodeASCII85(data)
+		default:
+			return nil, fmt.Errorf("unsupported filter %v", f)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+func inflate(data []byte) ([]byte, error) {
+	r, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	out, err := io.ReadAll(io.LimitReader(r, maxDecodedStream))
+	// Many writers leave streams slightly truncated; keep what was read.
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && len(out) == 0 {
+		return nil, err
+	}
+	return out, nil
+}
+
+func decodeASCII85(data []byte) ([]byte, error) {
+	data = bytes.TrimPrefix(bytes.TrimSpace(data), []byte("<~"))
+	if i := bytes.Index(data, []byte("~>")); i >= 0 {
+		data = data[:i]
+	}
+	out := make([]byte, len(data))
+	n, _, err := ascii85.Decode(out, data, true)
+	if err != nil {
+		return nil, err
+	}
+	return out[:n], nil
+}
+
+// pageInfo is a page with its inherited attributes resolved.
+type pageInfo struct {
+	dict      dict
+	resources dict
+	mediaBox  [4]float64
+}
+
+// pages returns the pages in order, walking the page tree from the
+// catalog, or every page object if there is no usable catalog.
+func (d *document) pages() []pageInfo {
+	var out []pageInfo
+	visited := make(map[interface{}]bool)
+	var walk func(node interface{}, resources dict, box [4]float64, depth int)
+	walk = func(node interface{}, resources dict, box [4]float64, depth int) {
+		if r, ok := node.(ref); ok {
+			if visited[r] {
+				return
+			}
+			visited[r] = true
+		}
+		n := d.dict(node)
+		if n == nil || depth > 64 {
+			return
+		}
+		if res := d.dict(n["Resources"]); res != nil {
+			resources = res
+		}
+		if b, ok := d.rect(n["MediaBox"]); ok {
+			box = b
+		}
+		if kids := d.array(n["Kids"]); kids != nil || n["Type"] == name("Pages") {
+			for _, kid := range kids {
+				walk(kid, resources, box, depth+1)
+			}
+			return
+		}
+		out = append(out, pageInfo{dict: n, resources: resources, mediaBox: box})
+	}
+
+	letter := [4]float64{0, 0, 612, 792}
+	if root := d.dict(d.trailer["Root"]); root != nil {
+		walk(root["Pages"], nil, letter, 0)
+	}
+	if len(out) > 0 {
+		return out
+	}
+	nums := make([]int, 0, len(d.offsets)+len(d.packed))
+	for num := range d.offsets {
+		nums = append(nums, num)
+	}
+	for num := range d.packed {
+		nums = append(nums, num)
+	}
+	sort.Ints(nums)
+	for _, num := range nums {
+		if n := d.dict(ref{num, 0}); n != nil && n["Type"] == name("Page") {
+			walk(ref{num, 0}, nil, letter, 0)
+		}
+	}
+	return out
+}
+
+func (d *document) rect(v interface{}) ([4]float64, bool) {
+	var r [4]float64
+	a := d.array(v)
+	if len(a) != 4 {
+		return r, false
+	}
+	for i := range r {
+		f, ok := d.number(a[i])
+		if !ok {
+			return r, false
+		}
+		r[i] = f
+	}
+	return r, true
+}
+
+// contents returns the page's content streams, decoded and joined.
+func (d *document) contents(page dict) []byte {
+	var parts []interface{}
+	switch c := d.resolve(page["Contents"]).(type) {
+	case *stream:
+		parts = []interface{}{c}
+	case array:
+		parts = c
+	}
+	var out []byte
+	for _, part := range parts {
+		s, ok := d.resolve(part).(*stream)
+		if !ok {
+			continue
+		}
+		data, err := d.decode(s)
+		if err != nil {
+			continue
+		}
+		out = append(out, data...)
+		out = append(out, '\n')
+	}
+	return out
+}
+
+// title returns the document title from the Info dictionary, if any.
+func (d *document) title() string {
+	info := d.dict(d.trailer["Info"])
+	if info == nil {
+		return ""
+	}
+	s, _ := d.resolve(info["Title"]).([]byte)
+	return textString(s)
+}
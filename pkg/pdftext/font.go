@@ -0,0 +1,376 @@
+package pdftext
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// font maps the character codes in a string to text and glyph widths.
+type font struct {
+	cmap *cmap // ToUnicode, when the font has one
+	// twoByte is true for composite (Type0) fonts, whose codes default to
+	// two bytes.
+	twoByte      bool
+	encoding     [256]rune // for simple fonts without ToUnicode; 0 if unknown
+	widths       map[int]float64
+	defaultWidth float64 // in thousandths of an em
+}
+
+// glyph is one decoded character code.
+type glyph struct {
+	text  string
+	width float64 // in thousandths of an em
+	space bool    // the single-byte code 32, which word spacing applies to
+}
+
+func (d *document) font(v interface{}) *font {
+	key := v
+	if _, ok := v.(ref); !ok {
+		key = nil
+	}
+	if key != nil {
+		if f, ok := d.fonts[key]; ok {
+			return f
+		}
+	}
+	f := d.loadFont(d.dict(v))
+	if key != nil {
+		d.fonts[key] = f
+	}
+	return f
+}
+
+func (d *document) loadFont(fd dict) *font {
+	f := &font{encoding: winAnsi, widths: make(map[int]float64), defaultWidth: 500}
+	if fd == nil {
+		return f
+	}
+	if s, ok := d.resolve(fd["ToUnicode"]).(*stream); ok {
+		if data, err := d.decode(s); err == nil {
+			f.cmap = parseCMap(data)
+		}
+	}
+
+	if fd["Subtype"] == name("Type0") {
+		f.twoByte = true
+		f.defaultWidth = 1000
+		if desc := d.array(fd["DescendantFonts"]); len(desc) > 0 {
+			cid := d.dict(desc[0])
+			if dw, ok := d.number(cid["DW"]); ok {
+				f.defaultWidth = dw
+			}
+			d.loadCIDWidths(f, d.array(cid["W"]))
+		}
+		return f
+	}
+
+	first, _ := d.number(fd["FirstChar"])
+	for i, w := range d.array(fd["Widths"]) {
+		if width, ok := d.number(w); ok {
+			f.widths[int(first)+i] = width
+		}
+	}
+	if desc := d.dict(fd["FontDescriptor"]); desc != nil {
+		if mw, ok := d.number(desc["MissingWidth"]); ok && mw > 0 {
+			f.defaultWidth = mw
+		}
+	}
+	// Named encodings are read as WinAnsi: StandardEncoding and
+	// MacRomanEncoding agree with it on ASCII, which is what matters for the
+	// text of medical documents.
+	if enc, ok := d.resolve(fd["Encoding"]).(dict); ok {
+		code := 0
+		for _, item := range d.array(enc["Differences"]) {
+			switch x := d.resolve(item).(type) {
+			case int:
+				code = x
+			case name:
+				if code >= 0 && code < 256 {
+					f.encoding[code] = glyphRune(string(x))
+				}
+				code++
+			}
+		}
+	}
+	return f
+}
+
+// loadCIDWidths reads a CIDFont W array: "c [w1 w2 ...]" gives widths for
+// consecutive codes from c, and "c1 c2 w" one width for a range.
+func (d *document) loadCIDWidths(f *font, w array) {
+	for i := 0; i < len(w); {
+		start, ok := d.number(w[i])
+		if !ok || i+1 >= len(w) {
+			return
+		}
+		if list := d.array(w[i+1]); list != nil {
+			for j, item := range list {
+				if width, ok := d.number(item); ok {
+					f.widths[int(start)+j] = width
+				}
+			}
+			i += 2
+			continue
+		}
+		if i+2 >= len(w) {
+			return
+		}
+		end, ok1 := d.number(w[i+1])
+		width, ok2 := d.number(w[i+2])
+		if ok1 && ok2 && end-start <= 65535 {
+			for c := int(start); c <= int(end); c++ {
+				f.widths[c] = width
+			}
+		}
+		i += 3
+	}
+}
+
+// decode splits s into character codes and maps each to its text.
+func (f *font) decode(s []byte) []glyph {
+	var out []glyph
+	for len(s) > 0 {
+		n := 1
+		if f.twoByte {
+			n = 2
+		}
+		if f.cmap != nil {
+			if m := f.cmap.codeLength(s); m > 0 {
+				n = m
+			}
+		}
+		if n > len(s) {
+			n = len(s)
+		}
+		code := 0
+		for _, b := range s[:n] {
+			code = code<<8 | int(b)
+		}
+		g := glyph{width: f.defaultWidth, space: n == 1 && code == 32}
+		if w, ok := f.widths[code]; ok {
+			g.width = w
+		}
+		if f.cmap != nil {
+			if text, ok := f.cmap.lookup(n, code); ok {
+				g.text = text
+			}
+		}
+		if g.text == "" && !f.twoByte && code < 256 {
+			if r := f.encoding[code]; r != 0 {
+				g.text = string(r)
+			}
+		}
+		out = append(out, g)
+		s = s[n:]
+	}
+	return out
+}
+
+// cmap is a parsed ToUnicode CMap.
+type cmap struct {
+	spaces []codeSpace
+	chars  map[cmapCode]string
+}
+
+// cmapCode is a character code and its length in bytes; <00 41> and <41>
+// are different codes.
+type cmapCode struct {
+	length, code int
+}
+
+type codeSpace struct {
+	lo, hi []byte
+}
+
+// maxCMapRange bounds the codes one bfrange entry may expand to.
+const maxCMapRange = 1 << 16
+
+func parseCMap(data []byte) *cmap {
+	c := &cmap{chars: make(map[cmapCode]string)}
+	p := &parser{data: data}
+	var operands []interface{}
+	for {
+		obj, err := p.object()
+		if err != nil {
+			break
+		}
+		kw, ok := obj.(keyword)
+		if !ok {
+			operands = append(operands, obj)
+			continue
+		}
+		switch kw {
+		case "endcodespacerange":
+			for i := 0; i+1 < len(operands); i += 2 {
+				lo, ok1 := operands[i].([]byte)
+				hi, ok2 := operands[i+1].([]byte)
+				if ok1 && ok2 && len(lo) == len(hi) && len(lo) > 0 {
+					c.spaces = append(c.spaces, codeSpace{lo, hi})
+				}
+			}
+		case "endbfchar":
+			for i := 0; i+1 < len(operands); i += 2 {
+				src, ok1 := operands[i].([]byte)
+				dst, ok2 := operands[i+1].([]byte)
+				if ok1 && ok2 && len(src) > 0 && len(src) <= 4 {
+					c.chars[cmapCode{len(src), bytesToInt(src)}] = utf16Text(dst)
+				}
+			}
+		case "endbfrange":
+			for i := 0; i+2 < len(operands); i += 3 {
+				lo, ok1 := operands[i].([]byte)
+				hi, ok2 := operands[i+1].([]byte)
+				if !ok1 || !ok2 || len(lo) != len(hi) || len(lo) == 0 || len(lo) > 4 {
+					continue
+				}
+				start, end := bytesToInt(lo), bytesToInt(hi)
+				if end < start || end-start >= maxCMapRange {
+					continue
+				}
+				switch dst := operands[i+2].(type) {
+				case []byte:
+					units := utf16Units(dst)
+					for code := start; code <= end; code++ {
+						if len(units) == 0 {
+							break
+						}
+						shifted := append([]uint16(nil), units...)
+						shifted[len(shifted)-1] += uint16(code - start)
+						c.chars[cmapCode{len(lo), code}] = string(utf16.Decode(shifted))
+					}
+				case array:
+					for j, item := range dst {
+						if b, ok := item.([]byte); ok && start+j <= end {
+							c.chars[cmapCode{len(lo), start + j}] = utf16Text(b)
+						}
+					}
+				}
+			}
+		}
+		if strings.HasPrefix(string(kw), "begin") || strings.HasPrefix(string(kw), "end") || kw == "def" {
+			operands = operands[:0]
+		}
+	}
+	return c
+}
+
+// codeLength returns the length of the code at the start of s, or 0 if no
+// code space range matches.
+func (c *cmap) codeLength(s []byte) int {
+	for _, space := range c.spaces {
+		n := len(space.lo)
+		if n > len(s) {
+			continue
+		}
+		match := true
+		for i := 0; i < n; i++ {
+			if s[i] < space.lo[i] || s[i] > space.hi[i] {
+				match = false
+				break
+			}
+		}
+		if match {
+			return n
+		}
+	}
+	return 0
+}
+
+func (c *cmap) lookup(length, code int) (string, bool) {
+	text, ok := c.chars[cmapCode{length, code}]
+	return text, ok
+}
+
+func bytesToInt(b []byte) int {
+	n := 0
+	for _, c := range b {
+		n = n<<8 | int(c)
+	}
+	return n
+}
+
+func utf16Units(b []byte) []uint16 {
+	units := make([]uint16, 0, len(b)/2)
+	for i := 0; i+1 < len(b); i += 2 {
+		units = append(units, uint16(b[i])<<8|uint16(b[i+1]))
+	}
+	return units
+}
+
+func utf16Text(b []byte) string {
+	return string(utf16.Decode(utf16Units(b)))
+}
+
+// textString decodes a PDF text string: UTF-16BE with a byte order mark,
+// or PDFDocEncoding, which matches Latin-1 for text.
+func textString(b []byte) string {
+	if len(b) >= 2 && b[0] == 0xFE && b[1] == 0xFF {
+		return utf16Text(b[2:])
+	}
+	if len(b) >= 3 && b[0] == 0xEF && b[1] == 0xBB && b[2] == 0xBF {
+		return string(b[3:])
+	}
+	runes := make([]rune, len(b))
+	for i, c := range b {
+		runes[i] = rune(c)
+	}
+	return string(runes)
+}
+
+// winAnsi is WinAnsiEncoding: Latin-1 with typographic punctuation in
+// 0x80-0x9F. It is also used for fonts with no or an unknown encoding.
+var winAnsi = func() [256]rune {
+	var e [256]rune
+	for i := 32; i < 256; i++ {
+		if i != 127 {
+			e[i] = rune(i)
+		}
+	}
+	for code, r := range map[int]rune{
+		0x80: '€', 0x82: '‚', 0x83: 'ƒ', 0x84: '„', 0x85: '…', 0x86: '†', 0x87: '‡', 0x88: 'ˆ',
+		0x89: '‰', 0x8A: 'Š', 0x8B: '‹', 0x8C: 'Œ', 0x8E: 'Ž', 0x91: '‘', 0x92: '’', 0x93: '“',
+		0x94: '”', 0x95: '•', 0x96: '–', 0x97: '—', 0x98: '˜', 0x99: '™', 0x9A: 'š', 0x9B: '›',
+		0x9C: 'œ', 0x9E: 'ž', 0x9F: 'Ÿ',
+	} {
+		e[code] = r
+	}
+	for _, code := range []int{0x81, 0x8D, 0x8F, 0x90, 0x9D} {
+		e[code] = 0
+	}
+	return e
+}()
+
+// glyphNames maps the common glyph names that are not single letters.
+var glyphNames = map[string]rune{
+	"space": ' ', "exclam": '!', "quotedbl": '"', "numbersign": '#', "dollar": '$', "percent": '%',
+	"ampersand": '&', "quotesingle": '\'', "quoteright": '’', "quoteleft": '‘', "parenleft": '(',
+	"parenright": ')', "asterisk": '*', "plus": '+', "comma": ',', "hyphen": '-', "minus": '−',
+	"period": '.', "slash": '/', "colon": ':', "semicolon": ';', "less": '<', "equal": '=',
+	"greater": '>', "question": '?', "at": '@', "bracketleft": '[', "backslash": '\\',
+	"bracketright": ']', "underscore": '_', "braceleft": '{', "bar": '|', "braceright": '}',
+	"zero": '0', "one": '1', "two": '2', "three": '3', "four": '4', "five": '5', "six": '6',
+	"seven": '7', "eight": '8', "nine": '9', "endash": '–', "emdash": '—', "bullet": '•',
+	"quotedblleft": '“', "quotedblright": '”', "degree": '°', "plusminus": '±', "mu": 'µ',
+	"multiply": '×', "divide": '÷', "lessequal": '≤', "greaterequal": '≥', "ellipsis": '…',
+	"registered": '®', "copyright": '©', "trademark": '™', "section": '§', "dagger": '†',
+	"daggerdbl": '‡', "fi": 'ﬁ', "fl": 'ﬂ', "ff": 'ﬀ', "ffi": 'ﬃ', "ffl": 'ﬄ', "alpha": 'α',
+	"beta": 'β', "gamma": 'γ', "delta": 'δ', "micro": 'µ', "nbspace": ' ',
+}
+
+func glyphRune(glyphName string) rune {
+	if len(glyphName) == 1 {
+		return rune(glyphName[0])
+	}
+	if r, ok := glyphNames[glyphName]; ok {
+		return r
+	}
+	for _, prefix := range []string{"uni", "u"} {
+		if hex := strings.TrimPrefix(glyphName, prefix); hex != glyphName && len(hex) >= 4 {
+			if v, err := strconv.ParseUint(hex[:4], 16, 32); err == nil {
+				return rune(v)
+			}
+		}
+	}
+	return 0
+}
@@ -0,0 +1,273 @@
+package pdftext
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// layoutPage orders a page's runs for reading and returns its lines, with
+// "" marking a paragraph break.
+func layoutPage(runs []textRun, box [4]float64) []string {
+	if len(runs) == 0 {
+		return nil
+	}
+	var out []string
+	for _, group := range splitColumns(runs, box) {
+		if len(group) == 0 {
+			continue
+		}
+		if len(out) > 0 {
+			out = append(out, "")
+		}
+		out = append(out, groupLines(group)...)
+	}
+	return out
+}
+
+// splitColumns looks for a vertical gutter near the middle of the page. If
+// there is one it returns, in reading order, the full-width runs above the
+// columns, the left column, the right column and the remaining full-width
+// runs; otherwise it returns all runs as one group.
+func splitColumns(runs []textRun, box [4]float64) [][]textRun {
+	const bin = 2.0
+	width := box[2] - box[0]
+	if width <= 0 {
+		return [][]textRun{runs}
+	}
+	bins := int(width/bin) + 1
+	coverage := make([]int, bins)
+	for _, r := range runs {
+		lo, hi := math.Min(r.x, r.endX), math.Max(r.x, r.endX)
+		for b := int((lo - box[0]) / bin); b <= int((hi-box[0])/bin); b++ {
+			if b >= 0 && b < bins {
+				coverage[b]++
+			}
+		}
+	}
+
+	// A few full-width lines (titles, footers) may cross the gutter.
+	limit := len(runs) / 10
+	if limit < 1 {
+		limit = 1
+	}
+	from, to := int(0.3*float64(bins)), int(0.7*float64(bins))
+	bestStart, bestLen := -1, 0
+	for b := from; b < to; {
+		if coverage[b] > limit {
+			b++
+			continue
+		}
+		start := b
+		for b < to && coverage[b] <= limit {
+			b++
+		}
+		if b-start > bestLen {
+			bestStart, bestLen = start, b-start
+		}
+	}
+	if bestStart < 0 || float64(bestLen)*bin < 6 {
+		return [][]textRun{runs}
+	}
+	gutterLo := box[0] + float64(bestStart)*bin
+	gutterHi := gutterLo + float64(bestLen)*bin
+
+	var left, right, spanning []textRun
+	for _, r := range runs {
+		lo, hi := math.Min(r.x, r.endX), math.Max(r.x, r.endX)
+		switch {
+		case hi <= gutterHi && lo < gutterLo:
+			left = append(left, r)
+		case lo >= gutterLo && hi > gutterHi:
+			right = append(right, r)
+		case hi <= gutterHi:
+			left = append(left, r)
+		default:
+			spanning = append(spanning, r)
+		}
+	}
+	if len(left)*4 < len(runs) || len(right)*4 < len(runs) {
+		return [][]textRun{runs}
+	}
+
+	top := math.Inf(-1)
+	for _, r := range append(left[:len(left):len(left)], right...) {
+		top = math.Max(top, r.y)
+	}
+	var above, below []textRun
+	for _, r := range spanning {
+		if r.y > top {
+			above = append(above, r)
+		} else {
+			below = append(below, r)
+		}
+	}
+	return [][]textRun{above, left, right, below}
+}
+
+type line struct {
+	y, size float64
+	runs    []textRun
+}
+
+// groupLines groups runs on the same baseline into lines, top to bottom,
+// and marks paragraph breaks where the gap between lines is unusually wide.
+func groupLines(runs []textRun) []string {
+	sorted := append([]textRun(nil), runs...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].y != sorted[j].y {
+			return sorted[i].y > sorted[j].y
+		}
+		return sorted[i].x < sorted[j].x
+	})
+
+	var lines []*line
+	for _, r := range sorted {
+		if n := len(lines); n > 0 {
+			l := lines[n-1]
+			if math.Abs(r.y-l.y) <= 0.5*math.Max(r.size, l.size) {
+				l.runs = append(l.runs, r)
+				l.size = math.Max(l.size, r.size)
+				continue
+			}
+		}
+		lines = append(lines, &line{y: r.y, size: r.size, runs: []textRun{r}})
+	}
+
+	var gaps []float64
+	for i := 1; i < len(lines); i++ {
+		gaps = append(gaps, lines[i-1].y-lines[i].y)
+	}
+	median := 0.0
+	if len(gaps) > 0 {
+		s := append([]float64(nil), gaps...)
+		sort.Float64s(s)
+		median = s[(len(s)-1)/2]
+	}
+
+	var out []string
+	for i, l := range lines {
+		if i > 0 && median > 0 && gaps[i-1] > 1.5*median {
+			out = append(out, "")
+		}
+		if text := l.text(); text != "" {
+			out = append(out, text)
+		}
+	}
+	return out
+}
+
+// text joins the runs of a line left to right, inserting spaces where the
+// gap between runs is wide enough to be one.
+func (l *line) text() string {
+	sort.SliceStable(l.runs, func(i, j int) bool { return l.runs[i].x < l.runs[j].x })
+	var b strings.Builder
+	var prev *textRun
+	for i := range l.runs {
+		r := &l.runs[i]
+		if prev != nil {
+			// Fake bold draws the same text twice, slightly offset.
+			if r.text == prev.text && math.Abs(r.x-prev.x) < 0.5*r.size {
+				continue
+			}
+			gap := r.x - prev.endX
+			size := math.Max(r.size, prev.size)
+			if !endsWithSpace(prev.text) && !startsWithSpace(r.text) {
+				switch {
+				case gap > 2*size:
+					b.WriteString("  ")
+				case gap > 0.2*size:
+					b.WriteByte(' ')
+				}
+			}
+		}
+		b.WriteString(r.text)
+		prev = r
+	}
+	return strings.TrimSpace(strings.Map(func(c rune) rune {
+		if c == ' ' || c == '\t' {
+			return ' '
+		}
+		if unicode.IsControl(c) {
+			return -1
+		}
+		return c
+	}, b.String()))
+}
+
+func endsWithSpace(s string) bool {
+	return s != "" && unicode.IsSpace(rune(s[len(s)-1]))
+}
+
+func startsWithSpace(s string) bool {
+	return s != "" && unicode.IsSpace(rune(s[0]))
+}
+
+// removeRunningLines drops headers and footers: lines among the first or
+// last two of a page that, with digits ignored, appear on most pages.
+func removeRunningLines(pages [][]string) {
+	if len(pages) < 3 {
+		return
+	}
+	edges := func(lines []string) []int {
+		var idx []int
+		for i := 0; i < len(lines) && len(idx) < 2; i++ {
+			if lines[i] != "" {
+				idx = append(idx, i)
+			}
+		}
+		var tail []int
+		for i := len(lines) - 1; i >= 0 && len(tail) < 2; i-- {
+			if lines[i] != "" {
+				tail = append(tail, i)
+			}
+		}
+		return append(idx, tail...)
+	}
+
+	counts := make(map[string]int)
+	for _, lines := range pages {
+		seen := make(map[string]bool)
+		for _, i := range edges(lines) {
+			key := runningKey(lines[i])
+			if !seen[key] {
+				seen[key] = true
+				counts[key]++
+			}
+		}
+	}
+	threshold := int(math.Ceil(0.6 * float64(len(pages))))
+	if threshold < 3 {
+		threshold = 3
+	}
+	for p, lines := range pages {
+		drop := make(map[int]bool)
+		for _, i := range edges(lines) {
+			if counts[runningKey(lines[i])] >= threshold {
+				drop[i] = true
+			}
+		}
+		if len(drop) == 0 {
+			continue
+		}
+		kept := lines[:0]
+		for i, l := range lines {
+			if !drop[i] {
+				kept = append(kept, l)
+			}
+		}
+		pages[p] = kept
+	}
+}
+
+// runningKey normalises a line for header and footer matching, so "Page 3
+// of 12" matches "Page 4 of 12".
+func runningKey(s string) string {
+	return strings.Map(func(c rune) rune {
+		if unicode.IsDigit(c) {
+			return '#'
+		}
+		return c
+	}, strings.Join(strings.Fields(s), " "))
+}
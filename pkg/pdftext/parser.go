@@ -0,0 +1,332 @@
+package pdftext
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strconv"
+)
+
+// PDF object types. Strings are []byte, integers int and reals float64.
+type (
+	name    string
+	keyword string
+	array   []interface{}
+	dict    map[name]interface{}
+	ref     struct{ num, gen int }
+	stream  struct {
+		dict dict
+		raw  []byte
+	}
+)
+
+var errSyntax = errors.New("pdf syntax error")
+
+// parser reads PDF objects and content stream operators from data.
+type parser struct {
+	data []byte
+	pos  int
+}
+
+func isSpace(c byte) bool {
+	return c == 0 || c == '\t' || c == '\n' || c == '\f' || c == '\r' || c == ' '
+}
+
+func isDelim(c byte) bool {
+	switch c {
+	case '(', ')', '<', '>', '[', ']', '{', '}', '/', '%':
+		return true
+	}
+	return false
+}
+
+func (p *parser) skipSpace() {
+	for p.pos < len(p.data) {
+		c := p.data[p.pos]
+		if isSpace(c) {
+			p.pos++
+			continue
+		}
+		if c == '%' {
+			for p.pos < len(p.data) && p.data[p.pos] != '\n' && p.data[p.pos] != '\r' {
+				p.pos++
+			}
+			continue
+		}
+		return
+	}
+}
+
+// token returns the next token: a keyword (including the delimiters "<<",
+// ">>", "[" and "]"), name, string, int or float64.
+func (p *parser) token() (interface{}, error) {
+	p.skipSpace()
+	if p.pos >= len(p.data) {
+		return nil, io.EOF
+	}
+	c := p.data[p.pos]
+	switch {
+	case c == '<' && p.pos+1 < len(p.data) && p.data[p.pos+1] == '<':
+		p.pos += 2
+		return keyword("<<"), nil
+	case c == '>' && p.pos+1 < len(p.data) && p.data[p.pos+1] == '>':
+		p.pos += 2
+		return keyword(">>"), nil
+	case c == '<':
+		return p.hexString(), nil
+	case c == '(':
+		return p.literalString(), nil
+	case c == '/':
+		return p.name(), nil
+	case c == '[' || c == ']' || c == '{' || c == '}' || c == '>' || c == ')':
+		p.pos++
+		return keyword(string(c)), nil
+	}
+
+	start := p.pos
+	for p.pos < len(p.data) && !isSpace(p.data[p.pos]) && !isDelim(p.data[p.pos]) {
+		p.pos++
+	}
+	word := string(p.data[start:p.pos])
+	if c == '+' || c == '-' || c == '.' || (c >= '0' && c <= '9') {
+		if n, err := strconv.Atoi(word); err == nil {
+			return n, nil
+		}
+		if f, err := strconv.ParseFloat(word, 64); err == nil {
+			return f, nil
+		}
+	}
+	return keyword(word), nil
+}
+
+func (p *parser) name() name {
+	p.pos++ // '/'
+	var b []byte
+	for p.pos < len(p.data) && !isSpace(p.data[p.pos]) && !isDelim(p.data[p.pos]) {
+		c := p.data[p.pos]
+		if c == '#' && p.pos+2 < len(p.data) {
+			if v, err := strconv.ParseUint(string(p.data[p.pos+1:p.pos+3]), 16, 8); err == nil {
+				b = append(b, byte(v))
+				p.pos += 3
+				continue
+			}
+		}
+		b = append(b, c)
+		p.pos++
+	}
+	return name(b)
+}
+
+func (p *parser) hexString() []byte {
+	p.pos++ // '<'
+	var out []byte
+	var hi byte
+	half := false
+	for p.pos < len(p.data) {
+		c := p.data[p.pos]
+		p.pos++
+		if c == '>' {
+			break
+		}
+		v, ok := hexValue(c)
+		if !ok {
+			continue
+		}
+		if half {
+			out = append(out, hi<<4|v)
+		} else {
+			hi = v
+		}
+		half = !half
+	}
+	if half {
+		out = append(out, hi<<4)
+	}
+	return out
+}
+
+func hexValue(c byte) (byte, bool) {
+	switch {
+	case c >= '0' && c <= '9':
+		return c - '0', true
+	case c >= 'a' && c <= 'f':
+		return c - 'a' + 10, true
+	case c >= 'A' && c <= 'F':
+		return c - 'A' + 10, true
+	}
+	return 0, false
+}
+
+func (p *parser) literalString() []byte {
+	p.pos++ // '('
+	var out []byte
+	depth := 1
+	for p.pos < len(p.data) {
+		c := p.data[p.pos]
+		p.pos++
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return out
+			}
+		case '\\':
+			if p.pos >= len(p.data) {
+				return out
+			}
+			e := p.data[p.pos]
+			p.pos++
+			switch e {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r':
+				if p.pos < len(p.data) && p.data[p.pos] == '\n' {
+					p.pos++
+				}
+				continue
+			case '\n':
+				continue
+			default:
+				if e >= '0' && e <= '7' {
+					v := int(e - '0')
+					for i := 0; i < 2 && p.pos < len(p.data) && p.data[p.pos] >= '0' && p.data[p.pos] <= '7'; i++ {
+						v = v*8 + int(p.data[p.pos]-'0')
+						p.pos++
+					}
+					c = byte(v)
+				} else {
+					c = e
+				}
+			}
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+// object reads one object. Keywords other than the composite delimiters,
+// true, false and null are returned as keywords, so content streams can be
+// read as operands followed by an operator.
+func (p *parser) object() (interface{}, error) {
+	tok, err := p.token()
+	if err != nil {
+		return nil, err
+	}
+	switch t := tok.(type) {
+	case keyword:
+		switch t {
+		case "<<":
+			return p.dict()
+		case "[":
+			return p.array()
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "null":
+			return nil, nil
+		}
+		return t, nil
+	case int:
+		// An integer may start a reference: "12 0 R".
+		save := p.pos
+		if gen, err := p.token(); err == nil {
+			if g, ok := gen.(int); ok {
+				if r, err := p.token(); err == nil && r == keyword("R") {
+					return ref{t, g}, nil
+				}
+			}
+		}
+		p.pos = save
+		return t, nil
+	}
+	return tok, nil
+}
+
+func (p *parser) dict() (dict, error) {
+	d := make(dict)
+	for {
+		tok, err := p.object()
+		if err != nil {
+			return d, err
+		}
+		if tok == keyword(">>") {
+			return d, nil
+		}
+		key, ok := tok.(name)
+		if !ok {
+			return d, errSyntax
+		}
+		value, err := p.object()
+		if err != nil {
+			return d, err
+		}
+		if kw, ok := value.(keyword); ok && kw == ">>" {
+			d[key] = nil
+			return d, nil
+		}
+		d[key] = value
+	}
+}
+
+func (p *parser) array() (array, error) {
+	var a array
+	for {
+		tok, err := p.object()
+		if err != nil {
+			return a, err
+		}
+		if tok == keyword("]") {
+			return a, nil
+		}
+		a = append(a, tok)
+	}
+}
+
+// streamData returns the raw bytes of the stream starting at p.pos, just
+// after the "stream" keyword. length is the /Length entry, or -1 if it is
+// not known.
+func (p *parser) streamData(length int) []byte {
+	if p.pos < len(p.data) && p.data[p.pos] == '\r' {
+		p.pos++
+	}
+	if p.pos < len(p.data) && p.data[p.pos] == '\n' {
+		p.pos++
+	}
+	start := p.pos
+	if length >= 0 && start+length <= len(p.data) {
+		rest := bytes.TrimLeft(p.data[start+length:], "\x00\t\n\f\r ")
+		if bytes.HasPrefix(rest, []byte("endstream")) {
+			p.pos = start + length
+			return p.data[start : start+length]
+		}
+	}
+	// The length is missing or wrong: read up to "endstream".
+	end := bytes.Index(p.data[start:], []byte("endstream"))
+	if end < 0 {
+		p.pos = len(p.data)
+		return p.data[start:]
+	}
+	p.pos = start + end
+	return bytes.TrimRight(p.data[start:start+end], "\r\n")
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
@@ -0,0 +1,92 @@
+// Package pdftext extracts the text of PDF files, page by page, in reading
+// order. It handles the fonts and encodings produced by common writers,
+// including CJK fonts with ToUnicode maps, reads two-column layouts column
+// by column, and drops running headers and footers. Scanned pages have no
+// text layer and come back empty.
+package pdftext
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	// ErrNotPDF is returned for data that does not start like a PDF file.
+	ErrNotPDF = errors.New("not a PDF file")
+	// ErrEncrypted is returned for password-protected files.
+	ErrEncrypted = errors.New("PDF is encrypted")
+)
+
+// Page is the text of one page. Paragraphs are separated by blank lines.
+type Page struct {
+	Number int
+	Text   string
+}
+
+// Document is the extracted text of a PDF file.
+type Document struct {
+	Title string
+	Pages []Page
+}
+
+// Text returns the text of all pages, separated by blank lines.
+func (d *Document) Text() string {
+	parts := make([]string, 0, len(d.Pages))
+	for _, p := range d.Pages {
+		if p.Text != "" {
+			parts = append(parts, p.Text)
+		}
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// Extract reads the text of every page of a PDF file.
+func Extract(data []byte) (doc *Document, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			doc, err = nil, fmt.Errorf("malformed PDF: %v", r)
+		}
+	}()
+
+	d, err := openDocument(data)
+	if err != nil {
+		return nil, err
+	}
+	pages := d.pages()
+	lines := make([][]string, len(pages))
+	for i, p := range pages {
+		in := newInterpreter(d)
+		in.run(d.contents(p.dict), p.resources, 0)
+		lines[i] = layoutPage(in.runs, p.mediaBox)
+	}
+	removeRunningLines(lines)
+
+	doc = &Document{Title: strings.TrimSpace(d.title())}
+	for i, l := range lines {
+		doc.Pages = append(doc.Pages, Page{Number: i + 1, Text: joinLines(l)})
+	}
+	return doc, nil
+}
+
+// joinLines joins a page's lines, with a blank line for each paragraph
+// break ("" entry) and none at the ends.
+func joinLines(lines []string) string {
+	var b strings.Builder
+	blank := false
+	for _, l := range lines {
+		if l == "" {
+			blank = b.Len() > 0
+			continue
+		}
+		if b.Len() > 0 {
+			b.WriteByte('\n')
+			if blank {
+				b.WriteByte('\n')
+			}
+		}
+		b.WriteString(l)
+		blank = false
+	}
+	return b.String()
+}
@@ -0,0 +1,206 @@
+package pdftext
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// testPDF assembles a small PDF file from object bodies.
+type testPDF struct {
+	objects []string
+}
+
+func (b *testPDF) add(body string) int {
+	b.objects = append(b.objects, body)
+	return len(b.objects)
+}
+
+func streamObject(dict string, data []byte) string {
+	return fmt.Sprintf("<< %s /Length %d >>\nstream\n%s\nendstream", dict, len(data), data)
+}
+
+func (b *testPDF) bytes(trailer string) []byte {
+	var out bytes.Buffer
+	out.WriteString("%PDF-1.7\n%\xe2\xe3\xcf\xd3\n")
+	offsets := make([]int, len(b.objects))
+	for i, body := range b.objects {
+		offsets[i] = out.Len()
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", i+1, body)
+	}
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(b.objects)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d %s >>\nstartxref\n%d\n%%%%EOF\n", len(b.objects)+1, trailer, xref)
+	return out.Bytes()
+}
+
+const toUnicodeCMap = `/CIDInit /ProcSet findresource begin
+12 dict begin
+begincmap
+1 begincodespacerange
+<0000> <FFFF>
+endcodespacerange
+2 beginbfchar
+<0001> <80F0>
+<0002> <817A>
+endbfchar
+1 beginbfrange
+<0003> <0004> <764C>
+endbfrange
+endcmap
+end end`
+
+// buildPDF returns a file whose pages have the given content streams. F1 is
+// a simple font 500 units wide per glyph and F2 a composite font mapping
+// codes 1-4 to 胰腺癌癍. Content is Flate-compressed when compress is set.
+func buildPDF(t *testing.T, contents []string, compress bool, info string) []byte {
+	t.Helper()
+	b := &testPDF{}
+	catalog := b.add("<< /Type /Catalog /Pages 2 0 R >>")
+	b.add("") // page tree, filled in below
+	f1 := b.add("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding << /Differences [1 /fi /uni00B0] >> >>")
+	cmap := b.add(streamObject("", []byte(toUnicodeCMap)))
+	cid := b.add("<< /Type /Font /Subtype /CIDFontType2 /BaseFont /NotoSansSC /DW 1000 >>")
+	f2 := b.add(fmt.Sprintf("<< /Type /Font /Subtype /Type0 /BaseFont /NotoSansSC /Encoding /Identity-H /DescendantFonts [%d 0 R] /ToUnicode %d 0 R >>", cid, cmap))
+
+	var kids []string
+	for _, c := range contents {
+		data := []byte(c)
+		dict := ""
+		if compress {
+			var buf bytes.Buffer
+			w := zlib.NewWriter(&buf)
+			w.Write(data)
+			w.Close()
+			data, dict = buf.Bytes(), "/Filter /FlateDecode"
+		}
+		content := b.add(streamObject(dict, data))
+		page := b.add(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /Contents %d 0 R >>", content))
+		kids = append(kids, fmt.Sprintf("%d 0 R", page))
+	}
+	b.objects[1] = fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d /MediaBox [0 0 612 792] /Resources << /Font << /F1 %d 0 R /F2 %d 0 R >> >> >>",
+		strings.Join(kids, " "), len(kids), f1, f2)
+
+	trailer := fmt.Sprintf("/Root %d 0 R", catalog)
+	if info != "" {
+		trailer += fmt.Sprintf(" /Info %d 0 R", b.add(info))
+	}
+	return b.bytes(trailer)
+}
+
+func TestExtract(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		compress bool
+		want     string
+	}{
+		{
+			name:    "simple text",
+			content: "BT /F1 12 Tf 72 720 Td (Hello) Tj ( world) Tj ET",
+			want:    "Hello world",
+		},
+		{
+			name:    "kerning and word gaps",
+			content: "BT /F1 12 Tf 72 720 Td [(Pan) -20 (creas)] TJ [(a) -1000 (b)] TJ ET",
+			want:    "Pancreasa b",
+		},
+		{
+			name:    "differences encoding",
+			content: "BT /F1 10 Tf 72 720 Td (\\001nal 37\\002C) Tj ET",
+			want:    "ﬁnal 37°C",
+		},
+		{
+			name:     "composite font with ToUnicode",
+			content:  "BT /F2 12 Tf 72 720 Td <000100020003> Tj ET",
+			compress: true,
+			want:     "胰腺癌",
+		},
+		{
+			name: "lines and paragraphs",
+			content: "BT /F1 10 Tf 14 TL 72 720 Td (First line) Tj T* (second line) Tj ET " +
+				"BT /F1 10 Tf 72 660 Td (New paragraph) Tj ET",
+			want: "First line\nsecond line\n\nNew paragraph",
+		},
+		{
+			name:    "text positioned by matrices",
+			content: "q 1 0 0 1 72 700 cm BT /F1 10 Tf 1 0 0 1 0 0 Tm (Dose) Tj 1 0 0 1 60 0 Tm (25 mg) Tj ET Q",
+			want:    "Dose  25 mg",
+		},
+		{
+			name: "two columns",
+			content: "BT /F1 10 Tf 72 740 Td (Guideline title spanning the whole page width at the top) Tj ET " +
+				"BT /F1 10 Tf 72 700 Td (Left one) Tj ET BT /F1 10 Tf 330 700 Td (Right one) Tj ET " +
+				"BT /F1 10 Tf 72 688 Td (Left two) Tj ET BT /F1 10 Tf 330 688 Td (Right two) Tj ET",
+			want: "Guideline title spanning the whole page width at the top\n\nLeft one\nLeft two\n\nRight one\nRight two",
+		},
+		{
+			name:    "inline image skipped",
+			content: "BT /F1 10 Tf 72 720 Td (Before) Tj ET BI /W 2 /H 1 /BPC 8 /CS /G ID \x00\xff EI BT /F1 10 Tf 72 706 Td (After) Tj ET",
+			want:    "Before\nAfter",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := Extract(buildPDF(t, []string{tt.content}, tt.compress, ""))
+			if err != nil {
+				t.Fatalf("Extract() error: %v", err)
+			}
+			if len(doc.Pages) != 1 {
+				t.Fatalf("got %d pages, want 1", len(doc.Pages))
+			}
+			if got := doc.Pages[0].Text; got != tt.want {
+				t.Errorf("text = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtract_RemovesHeadersAndFooters(t *testing.T) {
+	bodies := []string{"Diagnosis", "Staging", "Surgery", "Chemotherapy"}
+	var pages []string
+	for i, body := range bodies {
+		pages = append(pages, fmt.Sprintf("BT /F1 9 Tf 72 760 Td (Pancreatic Cancer Guideline 2024) Tj ET "+
+			"BT /F1 11 Tf 72 700 Td (%s) Tj ET "+
+			"BT /F1 9 Tf 280 40 Td (Page %d of 4) Tj ET", body, i+1))
+	}
+	doc, err := Extract(buildPDF(t, pages, false, "<< /Title <FEFF80F0817A764C63075357> >>"))
+	if err != nil {
+		t.Fatalf("Extract() error: %v", err)
+	}
+	if doc.Title != "胰腺癌指南" {
+		t.Errorf("Title = %q", doc.Title)
+	}
+	for i, p := range doc.Pages {
+		if want := bodies[i]; p.Text != want || p.Number != i+1 {
+			t.Errorf("page %d = %q, want %q", p.Number, p.Text, want)
+		}
+	}
+	if !strings.Contains(doc.Text(), "Diagnosis\n\nStaging") {
+		t.Errorf("Text() = %q", doc.Text())
+	}
+}
+
+func TestExtract_Errors(t *testing.T) {
+	if _, err := Extract([]byte("<html>not a pdf</html>")); !errors.Is(err, ErrNotPDF) {
+		t.Errorf("html: err = %v, want ErrNotPDF", err)
+	}
+	b := &testPDF{}
+	b.add("<< /Type /Catalog >>")
+	encrypted := b.bytes("/Root 1 0 R /Encrypt << /Filter /Standard /V 2 >>")
+	if _, err := Extract(encrypted); !errors.Is(err, ErrEncrypted) {
+		t.Errorf("encrypted: err = %v, want ErrEncrypted", err)
+	}
+	// Truncated files still yield what can be read.
+	data := buildPDF(t, []string{"BT /F1 12 Tf 72 720 Td (Still readable) Tj ET"}, false, "")
+	doc, err := Extract(data[:bytes.Index(data, []byte("xref"))])
+	if err != nil || len(doc.Pages) != 1 || doc.Pages[0].Text != "Still readable" {
+		t.Errorf("truncated: doc = %+v, err = %v", doc, err)
+	}
+}
@@ -0,0 +1,166 @@
+// Package persona keeps the prompt templates that set the tone of answers,
+// such as plain popular-science language for patients or terse clinical
+// language for clinicians.
+package persona
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/profile"
+)
+
+// Vars are the values a template can use: {{.Date}}, {{.Channel}},
+// {{.ChatID}}, {{.User}} and the user's profile, e.g. {{.Profile.Stage}}.
+type Vars struct {
+	Date    string
+	Channel string
+	ChatID  string
+	User    string
+	Profile profile.Profile
+}
+
+// NewVars returns the variables for a turn; p may be nil.
+func NewVars(now time.Time, channel, chatID, user string, p *profile.Profile) Vars {
+	v := Vars{
+		Date:    now.Format("2006-01-02 (Monday)"),
+		Channel: channel,
+		ChatID:  chatID,
+		User:    user,
+	}
+	if p != nil {
+		v.Profile = *p
+	}
+	return v
+}
+
+// builtin are the personas available without template files.
+var builtin = map[string]string{
+	"patient": `Answer as a patient educator for people affected by pancreatic cancer and their families. ` +
+		`Use plain, warm language a reader without medical training can follow: explain medical terms the first time they appear, ` +
+		`prefer short paragraphs and lists, and give the practical meaning of numbers and results. ` +
+		`Be honest about uncertainty and remind the reader that their care team makes treatment decisions. Today is {{.Date}}.`,
+	"clinician": `Answer for clinicians. Be terse and clinical: lead with the recommendation, use standard terminology and abbreviations without explaining them, ` +
+		`give doses, schedules and thresholds exactly, and name the guideline version, trial or evidence level behind each claim. ` +
+		`Skip reassurance and lay explanations. Today is {{.Date}}.`,
+}
+
+// Store renders personas from the built-in templates and from <name>.md
+// files in a directory. A file replaces the built-in template of the same
+// name, and is read again when it changes.
+type Store struct {
+	dir    string
+	mu     sync.Mutex
+	loaded map[string]loadedTemplate
+}
+
+type loadedTemplate struct {
+	modTime time.Time
+	tmpl    *template.Template
+}
+
+// NewStore returns a store reading template files from dir; dir may be
+// empty to use the built-in templates only.
+func NewStore(dir string) *Store {
+	return &Store{dir: dir, loaded: make(map[string]loadedTemplate)}
+}
+
+// ValidName reports whether name can name a persona and its file.
+func ValidName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// Names returns the names of the available personas, sorted.
+func (s *Store) Names() []string {
+	seen := make(map[string]struct{}, len(builtin))
+	for name := range builtin {
+		seen[name] = struct{}{}
+	}
+	if s.dir != "" {
+		files, _ := filepath.Glob(filepath.Join(s.dir, "*.md"))
+		for _, file := range files {
+			if name := strings.TrimSuffix(filepath.Base(file), ".md"); ValidName(name) {
+				seen[name] = struct{}{}
+			}
+		}
+	}
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Render returns the named persona filled in with vars.
+func (s *Store) Render(name string, vars Vars) (string, error) {
+	tmpl, err := s.template(name)
+	if err != nil {
+		return "", err
+	}
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, vars); err != nil {
+		return "", fmt.Errorf("persona %s: %w", name, err)
+	}
+	return strings.TrimSpace(out.String()), nil
+}
+
+// template returns the parsed template of the persona, parsing its file
+// again when it has changed since it was last read.
+func (s *Store) template(name string) (*template.Template, error) {
+	if !ValidName(name) {
+		return nil, fmt.Errorf("invalid persona name %q", name)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.dir != "" {
+		path := filepath.Join(s.dir, name+".md")
+		info, err := os.Stat(path)
+		if err == nil {
+			if cached, ok := s.loaded[name]; ok && cached.modTime.Equal(info.ModTime()) {
+				return cached.tmpl, nil
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return nil, err
+			}
+			tmpl, err := parse(name, string(data))
+			if err != nil {
+				return nil, fmt.Errorf("persona %s: invalid template %s: %w", name, path, err)
+			}
+			s.loaded[name] = loadedTemplate{modTime: info.ModTime(), tmpl: tmpl}
+			return tmpl, nil
+		}
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+		// A deleted file falls back to the built-in template, if any
+		delete(s.loaded, name)
+	}
+
+	text, ok := builtin[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown persona %q; available: %s", name, strings.Join(s.Names(), ", "))
+	}
+	return parse(name, text)
+}
+
+func parse(name, text string) (*template.Template, error) {
+	return template.New(name).Parse(text)
+}
@@ -0,0 +1,98 @@
+package persona
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/profile"
+)
+
+func TestRender(t *testing.T) {
+	dir := t.TempDir()
+	store := NewStore(dir)
+	now := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	vars := NewVars(now, "telegram", "42", "7", &profile.Profile{Stage: "III"})
+
+	tests := []struct {
+		name    string
+		file    string // content of <name>.md; empty for none
+		persona string
+		want    []string
+		wantErr bool
+	}{
+		{name: "built-in patient", persona: "patient", want: []string{"plain, warm language", "Today is 2026-03-02 (Monday)."}},
+		{name: "built-in clinician", persona: "clinician", want: []string{"terse and clinical"}},
+		{
+			name:    "file with variables",
+			file:    "Caregiver tone for {{.Channel}} chat {{.ChatID}}.{{if .Profile.Stage}} Stage {{.Profile.Stage}}.{{end}}",
+			persona: "caregiver",
+			want:    []string{"Caregiver tone for telegram chat 42. Stage III."},
+		},
+		{name: "file replaces built-in", file: "Short answers only.", persona: "clinician", want: []string{"Short answers only."}},
+		{name: "unknown", persona: "nurse", wantErr: true},
+		{name: "invalid name", persona: "../secrets", wantErr: true},
+		{name: "invalid template", file: "{{.Date", persona: "broken", wantErr: true},
+		{name: "unknown variable", file: "{{.Ward}}", persona: "ward", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.file != "" {
+				if err := os.WriteFile(filepath.Join(dir, tt.persona+".md"), []byte(tt.file), 0644); err != nil {
+					t.Fatal(err)
+				}
+				defer os.Remove(filepath.Join(dir, tt.persona+".md"))
+			}
+			got, err := store.Render(tt.persona, vars)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Render() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(got, want) {
+					t.Errorf("Render() = %q, want it to contain %q", got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestRender_ReloadsChangedFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "patient.md")
+	store := NewStore(dir)
+	write := func(content string, mtime time.Time) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	base := time.Now().Add(-time.Hour)
+	write("First version.", base)
+	if got, _ := store.Render("patient", Vars{}); got != "First version." {
+		t.Fatalf("first render = %q", got)
+	}
+	write("Second version.", base.Add(time.Minute))
+	if got, _ := store.Render("patient", Vars{}); got != "Second version." {
+		t.Fatalf("render after edit = %q", got)
+	}
+	os.Remove(path)
+	if got, _ := store.Render("patient", Vars{}); !strings.Contains(got, "patient educator") {
+		t.Fatalf("render after delete = %q, want the built-in persona", got)
+	}
+}
+
+func TestNames(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "caregiver.md"), []byte("x"), 0644)
+	os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("x"), 0644)
+	if got, want := NewStore(dir).Names(), []string{"caregiver", "clinician", "patient"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Names() = %v, want %v", got, want)
+	}
+}
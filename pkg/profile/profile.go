@@ -0,0 +1,133 @@
+// Package profile keeps a structured profile for each user, such as their
+// diagnosis and current treatment, so the agent knows their situation in
+// every session without asking again.
+package profile
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Profile is what a user has confirmed about their situation.
+type Profile struct {
+	Diagnosis string   `json:"diagnosis,omitempty"`
+	Stage     string   `json:"stage,omitempty"`
+	Regimen   string   `json:"regimen,omitempty"`
+	Allergies []string `json:"allergies,omitempty"`
+	// Language is the language the user prefers replies in.
+	Language string    `json:"language,omitempty"`
+	Updated  time.Time `json:"updated"`
+}
+
+// Empty reports whether no field is set.
+func (p *Profile) Empty() bool {
+	return p.Diagnosis == "" && p.Stage == "" && p.Regimen == "" && len(p.Allergies) == 0 && p.Language == ""
+}
+
+// Lines returns the set fields as "Label: value" lines.
+func (p *Profile) Lines() []string {
+	var lines []string
+	add := func(label, value string) {
+		if value != "" {
+			lines = append(lines, label+": "+value)
+		}
+	}
+	add("Diagnosis", p.Diagnosis)
+	add("Stage", p.Stage)
+	add("Current regimen", p.Regimen)
+	add("Allergies", strings.Join(p.Allergies, ", "))
+	add("Preferred language", p.Language)
+	return lines
+}
+
+// UserKey returns the key a sender's profile is stored under: the sender
+// ID without the display name some channels append after "|".
+func UserKey(senderID string) string {
+	id, _, _ := strings.Cut(senderID, "|")
+	return strings.TrimSpace(id)
+}
+
+// Store keeps one JSON file per user in a directory.
+type Store struct {
+	dir string
+	mu  sync.Mutex
+}
+
+func NewStore(dir string) *Store {
+	return &Store{dir: dir}
+}
+
+func (s *Store) path(user string) (string, error) {
+	if user == "" {
+		return "", fmt.Errorf("profile: no user")
+	}
+	name := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' {
+			return r
+		}
+		return '_'
+	}, user)
+	return filepath.Join(s.dir, name+".json"), nil
+}
+
+// Get returns the user's profile, or nil when they have none.
+func (s *Store) Get(user string) (*Profile, error) {
+	path, err := s.path(user)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var p Profile
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("profile: invalid %s: %w", path, err)
+	}
+	return &p, nil
+}
+
+// Update applies change to the user's profile, starting from an empty one,
+// and saves the result.
+func (s *Store) Update(user string, change func(p *Profile)) (*Profile, error) {
+	path, err := s.path(user)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, err := s.Get(user)
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		p = &Profile{}
+	}
+	change(p)
+	p.Updated = time.Now()
+
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return nil, err
+	}
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return nil, err
+	}
+	return p, nil
+}
@@ -0,0 +1,44 @@
+package profile
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestStore_Update(t *testing.T) {
+	s := NewStore(t.TempDir())
+	if p, err := s.Get("42"); p != nil || err != nil {
+		t.Fatalf("Get before any update = %v, %v", p, err)
+	}
+
+	s.Update("42", func(p *Profile) {
+		p.Diagnosis = "胰腺导管腺癌"
+		p.Allergies = []string{"青霉素"}
+	})
+	p, err := s.Update("42", func(p *Profile) { p.Stage = "III期" })
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"Diagnosis: 胰腺导管腺癌", "Stage: III期", "Allergies: 青霉素"}
+	if got := p.Lines(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Lines = %q, want %q", got, want)
+	}
+	if p.Updated.IsZero() {
+		t.Error("Updated not set")
+	}
+
+	// Sender IDs are turned into safe file names.
+	s.Update("../other", func(p *Profile) { p.Language = "English" })
+	if p, _ := s.Get("../other"); p == nil || p.Language != "English" {
+		t.Errorf("Get(../other) = %+v", p)
+	}
+	if _, err := s.Update("", func(p *Profile) {}); err == nil {
+		t.Error("Update without a user succeeded")
+	}
+}
+
+func TestUserKey(t *testing.T) {
+	if got := UserKey("123456|Wang Fang"); got != "123456" {
+		t.Errorf("UserKey = %q", got)
+	}
+}
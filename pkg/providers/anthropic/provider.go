@@ -5,6 +5,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"net/http"
+	"net/url"
 	"strings"
 
 	"github.com/anthropics/anthropic-sdk-go"
@@ -19,6 +21,10 @@ type UsageInfo = protocoltypes.UsageInfo
 type Message = protocoltypes.Message
 type ToolDefinition = protocoltypes.ToolDefinition
 type ToolFunctionDefinition = protocoltypes.ToolFunctionDefinition
+type StreamChunk = protocoltypes.StreamChunk
+type ToolCallDelta = protocoltypes.ToolCallDelta
+type ImageContent = protocoltypes.ImageContent
+type ThinkingBlock = protocoltypes.ThinkingBlock
 
 const defaultBaseURL = "https://api.anthropic.com"
 
@@ -37,6 +43,9 @@ func NewProviderWithBaseURL(token, apiBase string) *Provider {
 	client := anthropic.NewClient(
 		option.WithAuthToken(token),
 		option.WithBaseURL(baseURL),
+		// Retries are left to providers.RetryProvider, which shares
+		// rate limits across calls
+		option.WithMaxRetries(0),
 	)
 	return &Provider{
 		client:  &client,
@@ -44,6 +53,33 @@ func NewProviderWithBaseURL(token, apiBase string) *Provider {
 	}
 }
 
+// NewProviderWithAPIKey returns a provider for the Messages API that
+// authenticates with an API key (x-api-key), optionally through an HTTP
+// proxy.
+func NewProviderWithAPIKey(apiKey, apiBase, proxy string) *Provider {
+	baseURL := normalizeBaseURL(apiBase)
+	opts := []option.RequestOption{
+		option.WithAPIKey(apiKey),
+		option.WithBaseURL(baseURL),
+		option.WithMaxRetries(0),
+	}
+	if proxy != "" {
+		parsed, err := url.Parse(proxy)
+		if err == nil {
+			opts = append(opts, option.WithHTTPClient(&http.Client{
+				Transport: &http.Transport{Proxy: http.ProxyURL(parsed)},
+			}))
+		} else {
+			log.Printf("anthropic: invalid proxy URL %q: %v", proxy, err)
+		}
+	}
+	client := anthropic.NewClient(opts...)
+	return &Provider{
+		client:  &client,
+		baseURL: baseURL,
+	}
+}
+
 func NewProviderWithClient(client *anthropic.Client) *Provider {
 	return &Provider{
 		client:  client,
@@ -62,6 +98,12 @@ func NewProviderWithTokenSourceAndBaseURL(token string, tokenSource func() (stri
 }
 
 func (p *Provider) Chat(ctx context.Context, messages []Message, tools []ToolDefinition, model string, options map[string]interface{}) (*LLMResponse, error) {
+	return p.ChatStream(ctx, messages, tools, model, options, nil)
+}
+
+// ChatStream is Chat with text and tool input deltas passed to onChunk as
+// they arrive, followed by the finish reason and usage.
+func (p *Provider) ChatStream(ctx context.Context, messages []Message, tools []ToolDefinition, model string, options map[string]interface{}, onChunk func(StreamChunk)) (*LLMResponse, error) {
 	var opts []option.RequestOption
 	if p.tokenSource != nil {
 		tok, err := p.tokenSource()
@@ -76,12 +118,52 @@ func (p *Provider) Chat(ctx context.Context, messages []Message, tools []ToolDef
 		return nil, err
 	}
 
-	resp, err := p.client.Messages.New(ctx, params, opts...)
-	if err != nil {
+	// Stream the response, so long answers are not cut off by idle
+	// timeouts, and collect it into one message
+	stream := p.client.Messages.NewStreaming(ctx, params, opts...)
+	defer stream.Close()
+	var resp anthropic.Message
+	// Tool calls are numbered apart from the text blocks between them
+	toolIndex := map[int64]int{}
+	for stream.Next() {
+		event := stream.Current()
+		if err := resp.Accumulate(event); err != nil {
+			return nil, fmt.Errorf("claude API stream: %w", err)
+		}
+		if onChunk == nil {
+			continue
+		}
+		switch event.Type {
+		case "content_block_start":
+			if event.ContentBlock.Type == "tool_use" {
+				index := len(toolIndex)
+				toolIndex[event.Index] = index
+				onChunk(StreamChunk{ToolCallDelta: &ToolCallDelta{
+					Index: index,
+					ID:    event.ContentBlock.ID,
+					Name:  event.ContentBlock.Name,
+				}})
+			}
+		case "content_block_delta":
+			switch event.Delta.Type {
+			case "text_delta":
+				onChunk(StreamChunk{Delta: event.Delta.Text})
+			case "input_json_delta":
+				if index, ok := toolIndex[event.Index]; ok && event.Delta.PartialJSON != "" {
+					onChunk(StreamChunk{ToolCallDelta: &ToolCallDelta{Index: index, Arguments: event.Delta.PartialJSON}})
+				}
+			}
+		}
+	}
+	if err := stream.Err(); err != nil {
 		return nil, fmt.Errorf("claude API call: %w", err)
 	}
 
-	return parseResponse(resp), nil
+	result := parseResponse(&resp)
+	if onChunk != nil {
+		onChunk(StreamChunk{FinishReason: result.FinishReason, Usage: result.Usage})
+	}
+	return result, nil
 }
 
 func (p *Provider) GetDefaultModel() string {
@@ -93,26 +175,59 @@ func (p *Provider) BaseURL() string {
 }
 
 func buildParams(messages []Message, tools []ToolDefinition, model string, options map[string]interface{}) (anthropic.MessageNewParams, error) {
+	_, budget := protocoltypes.Reasoning(options)
+	if budget > 0 && !thinkingContinues(messages) {
+		// A tool loop begun without thinking, as by another model of the
+		// fallback chain, cannot go on with it
+		budget = 0
+	}
+
 	var system []anthropic.TextBlockParam
 	var anthropicMessages []anthropic.MessageParam
 
+	// addToolResult puts the results of parallel tool calls in one user
+	// message, as the API expects after an assistant turn with several
+	// tool_use blocks.
+	addToolResult := func(msg Message) {
+		block := anthropic.NewToolResultBlock(msg.ToolCallID, msg.Content, false)
+		if n := len(anthropicMessages); n > 0 && anthropicMessages[n-1].Role == anthropic.MessageParamRoleUser &&
+			anthropicMessages[n-1].Content[0].OfToolResult != nil {
+			anthropicMessages[n-1].Content = append(anthropicMessages[n-1].Content, block)
+			return
+		}
+		anthropicMessages = append(anthropicMessages, anthropic.NewUserMessage(block))
+	}
+
 	for _, msg := range messages {
 		switch msg.Role {
 		case "system":
 			system = append(system, anthropic.TextBlockParam{Text: msg.Content})
 		case "user":
 			if msg.ToolCallID != "" {
-				anthropicMessages = append(anthropicMessages,
-					anthropic.NewUserMessage(anthropic.NewToolResultBlock(msg.ToolCallID, msg.Content, false)),
-				)
+				addToolResult(msg)
 			} else {
-				anthropicMessages = append(anthropicMessages,
-					anthropic.NewUserMessage(anthropic.NewTextBlock(msg.Content)),
-				)
+				// Images go before the text that asks about them
+				blocks := make([]anthropic.ContentBlockParamUnion, 0, len(msg.Images)+1)
+				for _, img := range msg.Images {
+					blocks = append(blocks, anthropic.NewImageBlockBase64(img.MimeType, img.Data))
+				}
+				if msg.Content != "" || len(blocks) == 0 {
+					blocks = append(blocks, anthropic.NewTextBlock(msg.Content))
+				}
+				anthropicMessages = append(anthropicMessages, anthropic.NewUserMessage(blocks...))
 			}
 		case "assistant":
 			if len(msg.ToolCalls) > 0 {
 				var blocks []anthropic.ContentBlockParamUnion
+				if budget > 0 {
+					for _, t := range msg.Thinking {
+						if t.Data != "" {
+							blocks = append(blocks, anthropic.NewRedactedThinkingBlock(t.Data))
+						} else {
+							blocks = append(blocks, anthropic.NewThinkingBlock(t.Signature, t.Thinking))
+						}
+					}
+				}
 				if msg.Content != "" {
 					blocks = append(blocks, anthropic.NewTextBlock(msg.Content))
 				}
@@ -120,15 +235,13 @@ func buildParams(messages []Message, tools []ToolDefinition, model string, optio
 					blocks = append(blocks, anthropic.NewToolUseBlock(tc.ID, tc.Arguments, tc.Name))
 				}
 				anthropicMessages = append(anthropicMessages, anthropic.NewAssistantMessage(blocks...))
-			} else {
+			} else if msg.Content != "" {
 				anthropicMessages = append(anthropicMessages,
 					anthropic.NewAssistantMessage(anthropic.NewTextBlock(msg.Content)),
 				)
 			}
 		case "tool":
-			anthropicMessages = append(anthropicMessages,
-				anthropic.NewUserMessage(anthropic.NewToolResultBlock(msg.ToolCallID, msg.Content, false)),
-			)
+			addToolResult(msg)
 		}
 	}
 
@@ -138,7 +251,7 @@ func buildParams(messages []Message, tools []ToolDefinition, model string, optio
 	}
 
 	params := anthropic.MessageNewParams{
-		Model:     anthropic.Model(model),
+		Model:     anthropic.Model(strings.TrimPrefix(model, "anthropic/")),
 		Messages:  anthropicMessages,
 		MaxTokens: maxTokens,
 	}
@@ -147,7 +260,18 @@ func buildParams(messages []Message, tools []ToolDefinition, model string, optio
 		params.System = system
 	}
 
-	if temp, ok := options["temperature"].(float64); ok {
+	if budget > 0 {
+		// The budget is part of max_tokens, and thinking allows no
+		// temperature or top_p of our choosing
+		params.Thinking = anthropic.ThinkingConfigParamOfEnabled(int64(budget))
+		if params.MaxTokens <= int64(budget) {
+			params.MaxTokens = int64(budget) + maxTokens
+		}
+	} else if topP, ok := options["top_p"].(float64); ok {
+		// Recent Claude models take temperature or top_p but not both,
+		// so top_p, which is only sent when set on purpose, wins
+		params.TopP = anthropic.Float(topP)
+	} else if temp, ok := options["temperature"].(float64); ok {
 		params.Temperature = anthropic.Float(temp)
 	}
 
@@ -155,9 +279,36 @@ func buildParams(messages []Message, tools []ToolDefinition, model string, optio
 		params.Tools = translateTools(tools)
 	}
 
+	addCacheBreakpoints(&params)
 	return params, nil
 }
 
+// addCacheBreakpoints marks the prompt prefixes the API should cache: the
+// tool definitions, which rarely change, the first system message, which
+// holds the stable part of the system prompt while later ones hold what
+// changes from turn to turn, and, in a tool loop, the conversation so far,
+// which the next iteration repeats. Prefixes shorter than the model's
+// minimum are not cached and cost nothing extra.
+func addCacheBreakpoints(params *anthropic.MessageNewParams) {
+	if n := len(params.Tools); n > 0 {
+		if cc := params.Tools[n-1].GetCacheControl(); cc != nil {
+			*cc = anthropic.NewCacheControlEphemeralParam()
+		}
+	}
+	if len(params.System) > 0 {
+		params.System[0].CacheControl = anthropic.NewCacheControlEphemeralParam()
+	}
+	if len(params.Tools) == 0 || len(params.Messages) == 0 {
+		return
+	}
+	last := params.Messages[len(params.Messages)-1].Content
+	if len(last) > 0 {
+		if cc := last[len(last)-1].GetCacheControl(); cc != nil {
+			*cc = anthropic.NewCacheControlEphemeralParam()
+		}
+	}
+}
+
 func translateTools(tools []ToolDefinition) []anthropic.ToolUnionParam {
 	result := make([]anthropic.ToolUnionParam, 0, len(tools))
 	for _, t := range tools {
@@ -170,7 +321,10 @@ func translateTools(tools []ToolDefinition) []anthropic.ToolUnionParam {
 		if desc := t.Function.Description; desc != "" {
 			tool.Description = anthropic.String(desc)
 		}
-		if req, ok := t.Function.Parameters["required"].([]interface{}); ok {
+		switch req := t.Function.Parameters["required"].(type) {
+		case []string:
+			tool.InputSchema.Required = req
+		case []interface{}:
 			required := make([]string, 0, len(req))
 			for _, r := range req {
 				if s, ok := r.(string); ok {
@@ -179,31 +333,69 @@ func translateTools(tools []ToolDefinition) []anthropic.ToolUnionParam {
 			}
 			tool.InputSchema.Required = required
 		}
+		// Keep the rest of the schema, such as additionalProperties or
+		// anyOf, as the tool declared it
+		for key, value := range t.Function.Parameters {
+			switch key {
+			case "type", "properties", "required":
+			default:
+				if tool.InputSchema.ExtraFields == nil {
+					tool.InputSchema.ExtraFields = make(map[string]interface{})
+				}
+				tool.InputSchema.ExtraFields[key] = value
+			}
+		}
 		result = append(result, anthropic.ToolUnionParam{OfTool: &tool})
 	}
 	return result
 }
 
+// thinkingContinues reports whether a call with thinking may follow
+// messages: the API needs the thinking that came with the tool calls of a
+// tool loop under way.
+func thinkingContinues(messages []Message) bool {
+	for i := len(messages) - 1; i >= 0; i-- {
+		switch m := messages[i]; m.Role {
+		case "tool":
+			continue
+		case "assistant":
+			return len(m.ToolCalls) == 0 || len(m.Thinking) > 0
+		default:
+			return true
+		}
+	}
+	return true
+}
+
 func parseResponse(resp *anthropic.Message) *LLMResponse {
 	var content string
 	var toolCalls []ToolCall
+	var thinking []ThinkingBlock
 
+	// Read the block fields directly: a streamed message has them filled
+	// in from the deltas, but not its raw JSON.
 	for _, block := range resp.Content {
 		switch block.Type {
 		case "text":
-			tb := block.AsText()
-			content += tb.Text
+			content += block.Text
+		case "thinking":
+			thinking = append(thinking, ThinkingBlock{Thinking: block.Thinking, Signature: block.Signature})
+		case "redacted_thinking":
+			thinking = append(thinking, ThinkingBlock{Data: block.Data})
 		case "tool_use":
-			tu := block.AsToolUse()
-			var args map[string]interface{}
-			if err := json.Unmarshal(tu.Input, &args); err != nil {
-				log.Printf("anthropic: failed to decode tool call input for %q: %v", tu.Name, err)
-				args = map[string]interface{}{"raw": string(tu.Input)}
+			args, argsErr := map[string]interface{}{}, ""
+			if len(block.Input) > 0 {
+				if err := json.Unmarshal(block.Input, &args); err != nil {
+					log.Printf("anthropic: failed to decode tool call input for %q: %v", block.Name, err)
+					args = map[string]interface{}{"raw": string(block.Input)}
+					argsErr = err.Error()
+				}
 			}
 			toolCalls = append(toolCalls, ToolCall{
-				ID:        tu.ID,
-				Name:      tu.Name,
-				Arguments: args,
+				ID:             block.ID,
+				Name:           block.Name,
+				Arguments:      args,
+				ArgumentsError: argsErr,
 			})
 		}
 	}
@@ -218,14 +410,20 @@ func parseResponse(resp *anthropic.Message) *LLMResponse {
 		finishReason = "stop"
 	}
 
+	// Cached prompt tokens are counted apart from input_tokens
+	promptTokens := resp.Usage.InputTokens + resp.Usage.CacheCreationInputTokens + resp.Usage.CacheReadInputTokens
+
 	return &LLMResponse{
 		Content:      content,
 		ToolCalls:    toolCalls,
+		Thinking:     thinking,
 		FinishReason: finishReason,
 		Usage: &UsageInfo{
-			PromptTokens:     int(resp.Usage.InputTokens),
+			PromptTokens:     int(promptTokens),
 			CompletionTokens: int(resp.Usage.OutputTokens),
-			TotalTokens:      int(resp.Usage.InputTokens + resp.Usage.OutputTokens),
+			TotalTokens:      int(promptTokens + resp.Usage.OutputTokens),
+			CachedTokens:     int(resp.Usage.CacheReadInputTokens),
+			CacheWriteTokens: int(resp.Usage.CacheCreationInputTokens),
 		},
 	}
 }
@@ -2,6 +2,7 @@ package anthropicprovider
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"sync/atomic"
@@ -77,6 +78,30 @@ func TestBuildParams_ToolCallMessage(t *testing.T) {
 	}
 }
 
+func TestBuildParams_ImageMessage(t *testing.T) {
+	messages := []Message{{
+		Role:    "user",
+		Content: "Is my CA19-9 high?",
+		Images:  []ImageContent{{MimeType: "image/jpeg", Data: "/9j/4AAQ"}},
+	}}
+	params, err := buildParams(messages, nil, "claude-sonnet-4-5-20250929", map[string]interface{}{})
+	if err != nil {
+		t.Fatalf("buildParams() error: %v", err)
+	}
+	blocks := params.Messages[0].Content
+	if len(blocks) != 2 {
+		t.Fatalf("len(Content) = %d, want 2", len(blocks))
+	}
+	img := blocks[0].OfImage
+	if img == nil || img.Source.OfBase64 == nil || img.Source.OfBase64.Data != "/9j/4AAQ" ||
+		string(img.Source.OfBase64.MediaType) != "image/jpeg" {
+		t.Errorf("first block = %+v, want the image", blocks[0])
+	}
+	if blocks[1].OfText == nil || blocks[1].OfText.Text != "Is my CA19-9 high?" {
+		t.Errorf("second block = %+v, want the text", blocks[1])
+	}
+}
+
 func TestBuildParams_WithTools(t *testing.T) {
 	tools := []ToolDefinition{
 		{
@@ -103,6 +128,47 @@ func TestBuildParams_WithTools(t *testing.T) {
 	}
 }
 
+func TestBuildParams_Thinking(t *testing.T) {
+	question := Message{Role: "user", Content: "Is CA19-9 of 37 high?"}
+	call := ToolCall{ID: "call_1", Name: "knows_search", Arguments: map[string]interface{}{"query": "CA19-9"}}
+	result := Message{Role: "tool", Content: "Normal is below 37 U/mL", ToolCallID: "call_1"}
+	options := map[string]interface{}{"max_tokens": 4096, "temperature": 0.7, "reasoning_effort": "medium"}
+
+	params, err := buildParams([]Message{question}, nil, "claude-sonnet-4-5", options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if params.Thinking.OfEnabled == nil || params.Thinking.OfEnabled.BudgetTokens != 8192 {
+		t.Fatalf("Thinking = %+v, want a budget of 8192", params.Thinking)
+	}
+	if params.MaxTokens != 8192+4096 || params.Temperature.Valid() {
+		t.Errorf("MaxTokens = %d, temperature sent: %v", params.MaxTokens, params.Temperature.Valid())
+	}
+
+	// The thinking of the tool calls goes back with them
+	withThinking := Message{Role: "assistant", ToolCalls: []ToolCall{call},
+		Thinking: []ThinkingBlock{{Thinking: "Look up the reference range.", Signature: "sig"}, {Data: "opaque"}}}
+	params, _ = buildParams([]Message{question, withThinking, result}, nil, "claude-sonnet-4-5", options)
+	blocks := params.Messages[1].Content
+	if params.Thinking.OfEnabled == nil || len(blocks) != 3 || blocks[0].OfThinking == nil || blocks[0].OfThinking.Signature != "sig" ||
+		blocks[1].OfRedactedThinking == nil || blocks[2].OfToolUse == nil {
+		t.Errorf("assistant blocks = %+v", blocks)
+	}
+
+	// A tool loop begun without thinking goes on without it
+	withoutThinking := Message{Role: "assistant", ToolCalls: []ToolCall{call}}
+	params, _ = buildParams([]Message{question, withoutThinking, result}, nil, "claude-sonnet-4-5", options)
+	if params.Thinking.OfEnabled != nil || !params.Temperature.Valid() {
+		t.Errorf("Thinking = %+v after calls made without it", params.Thinking)
+	}
+
+	options["reasoning_effort"] = "off"
+	params, _ = buildParams([]Message{question}, nil, "claude-sonnet-4-5", options)
+	if params.Thinking.OfEnabled != nil {
+		t.Errorf("Thinking = %+v with effort off", params.Thinking)
+	}
+}
+
 func TestParseResponse_TextOnly(t *testing.T) {
 	resp := &anthropic.Message{
 		Content: []anthropic.ContentBlockUnion{},
@@ -123,6 +189,25 @@ func TestParseResponse_TextOnly(t *testing.T) {
 	}
 }
 
+func TestParseResponse_Thinking(t *testing.T) {
+	resp := &anthropic.Message{
+		Content: []anthropic.ContentBlockUnion{
+			{Type: "thinking", Thinking: "Check the reference range.", Signature: "sig"},
+			{Type: "redacted_thinking", Data: "opaque"},
+			{Type: "tool_use", ID: "call_1", Name: "knows_search", Input: json.RawMessage(`{"query":"CA19-9"}`)},
+		},
+		StopReason: anthropic.StopReasonToolUse,
+	}
+	result := parseResponse(resp)
+	want := []ThinkingBlock{{Thinking: "Check the reference range.", Signature: "sig"}, {Data: "opaque"}}
+	if len(result.Thinking) != 2 || result.Thinking[0] != want[0] || result.Thinking[1] != want[1] {
+		t.Errorf("Thinking = %+v, want %+v", result.Thinking, want)
+	}
+	if result.Content != "" || len(result.ToolCalls) != 1 {
+		t.Errorf("Content = %q, tool calls = %+v", result.Content, result.ToolCalls)
+	}
+}
+
 func TestParseResponse_StopReasons(t *testing.T) {
 	tests := []struct {
 		stopReason anthropic.StopReason
@@ -157,22 +242,7 @@ func TestProvider_ChatRoundTrip(t *testing.T) {
 		var reqBody map[string]interface{}
 		json.NewDecoder(r.Body).Decode(&reqBody)
 
-		resp := map[string]interface{}{
-			"id":          "msg_test",
-			"type":        "message",
-			"role":        "assistant",
-			"model":       reqBody["model"],
-			"stop_reason": "end_turn",
-			"content": []map[string]interface{}{
-				{"type": "text", "text": "Hello! How can I help you?"},
-			},
-			"usage": map[string]interface{}{
-				"input_tokens":  15,
-				"output_tokens": 8,
-			},
-		}
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(resp)
+		writeStreamedText(w, reqBody["model"], "Hello! How can I help you?", 15, 8)
 	}))
 	defer server.Close()
 
@@ -224,22 +294,7 @@ func TestProvider_ChatUsesTokenSource(t *testing.T) {
 		var reqBody map[string]interface{}
 		json.NewDecoder(r.Body).Decode(&reqBody)
 
-		resp := map[string]interface{}{
-			"id":          "msg_test",
-			"type":        "message",
-			"role":        "assistant",
-			"model":       reqBody["model"],
-			"stop_reason": "end_turn",
-			"content": []map[string]interface{}{
-				{"type": "text", "text": "ok"},
-			},
-			"usage": map[string]interface{}{
-				"input_tokens":  1,
-				"output_tokens": 1,
-			},
-		}
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(resp)
+		writeStreamedText(w, reqBody["model"], "ok", 1, 1)
 	}))
 	defer server.Close()
 
@@ -263,3 +318,177 @@ func createAnthropicTestClient(baseURL, token string) *anthropic.Client {
 	)
 	return &c
 }
+
+func TestBuildParams_ParallelToolResults(t *testing.T) {
+	messages := []Message{
+		{Role: "user", Content: "Search both"},
+		{Role: "assistant", ToolCalls: []ToolCall{
+			{ID: "call_1", Name: "knows_search", Arguments: map[string]interface{}{"query": "PERT"}},
+			{ID: "call_2", Name: "kb_search", Arguments: map[string]interface{}{"query": "PERT"}},
+		}},
+		{Role: "tool", Content: "a", ToolCallID: "call_1"},
+		{Role: "tool", Content: "b", ToolCallID: "call_2"},
+	}
+	params, err := buildParams(messages, nil, "claude-sonnet-4-5-20250929", map[string]interface{}{})
+	if err != nil {
+		t.Fatalf("buildParams() error: %v", err)
+	}
+	if len(params.Messages) != 3 {
+		t.Fatalf("len(Messages) = %d, want 3", len(params.Messages))
+	}
+	results := params.Messages[2].Content
+	if len(results) != 2 || results[0].OfToolResult.ToolUseID != "call_1" || results[1].OfToolResult.ToolUseID != "call_2" {
+		t.Errorf("tool results are not in one message: %+v", results)
+	}
+}
+
+func TestBuildParams_CacheBreakpointsAndSchema(t *testing.T) {
+	tools := []ToolDefinition{{
+		Type: "function",
+		Function: ToolFunctionDefinition{
+			Name: "knows_search",
+			Parameters: map[string]interface{}{
+				"type":                 "object",
+				"properties":           map[string]interface{}{"query": map[string]interface{}{"type": "string"}},
+				"required":             []string{"query"},
+				"additionalProperties": false,
+			},
+		},
+	}}
+	messages := []Message{
+		{Role: "system", Content: "You are helpful"},
+		{Role: "system", Content: "## Current Time\n2026-10-18 09:30 (Sunday)"},
+		{Role: "user", Content: "Hi"},
+	}
+	params, err := buildParams(messages, tools, "anthropic/claude-sonnet-4-5-20250929", map[string]interface{}{})
+	if err != nil {
+		t.Fatalf("buildParams() error: %v", err)
+	}
+	data, _ := json.Marshal(params)
+	var body struct {
+		Model  string `json:"model"`
+		System []struct {
+			CacheControl *struct{ Type string } `json:"cache_control"`
+		} `json:"system"`
+		Tools []struct {
+			InputSchema  map[string]interface{} `json:"input_schema"`
+			CacheControl *struct{ Type string } `json:"cache_control"`
+		} `json:"tools"`
+		Messages []struct {
+			Content []struct {
+				CacheControl *struct{ Type string } `json:"cache_control"`
+			} `json:"content"`
+		} `json:"messages"`
+	}
+	if err := json.Unmarshal(data, &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Model != "claude-sonnet-4-5-20250929" {
+		t.Errorf("model = %q", body.Model)
+	}
+	if body.System[0].CacheControl == nil || body.Tools[0].CacheControl == nil || body.Messages[0].Content[0].CacheControl == nil {
+		t.Errorf("missing cache breakpoints: %s", data)
+	}
+	// The turn context changes every turn, so caching it would only cost
+	if len(body.System) != 2 || body.System[1].CacheControl != nil {
+		t.Errorf("turn context marked for caching: %s", data)
+	}
+	schema := body.Tools[0].InputSchema
+	if req, _ := schema["required"].([]interface{}); len(req) != 1 || req[0] != "query" {
+		t.Errorf("required = %v", schema["required"])
+	}
+	if schema["additionalProperties"] != false {
+		t.Errorf("additionalProperties = %v", schema["additionalProperties"])
+	}
+}
+
+func TestProvider_ChatStreamsToolCalls(t *testing.T) {
+	var apiKey string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		apiKey = r.Header.Get("X-Api-Key")
+		var reqBody map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&reqBody)
+		if reqBody["stream"] != true {
+			http.Error(w, "expected a streaming request", http.StatusBadRequest)
+			return
+		}
+		writeSSE(w,
+			map[string]interface{}{"type": "message_start", "message": map[string]interface{}{
+				"id": "msg_test", "type": "message", "role": "assistant", "model": reqBody["model"], "content": []interface{}{},
+				"usage": map[string]interface{}{"input_tokens": 10, "cache_read_input_tokens": 90, "output_tokens": 1},
+			}},
+			map[string]interface{}{"type": "content_block_start", "index": 0, "content_block": map[string]interface{}{"type": "text", "text": ""}},
+			map[string]interface{}{"type": "content_block_delta", "index": 0, "delta": map[string]interface{}{"type": "text_delta", "text": "Searching "}},
+			map[string]interface{}{"type": "content_block_delta", "index": 0, "delta": map[string]interface{}{"type": "text_delta", "text": "both."}},
+			map[string]interface{}{"type": "content_block_stop", "index": 0},
+			map[string]interface{}{"type": "content_block_start", "index": 1, "content_block": map[string]interface{}{"type": "tool_use", "id": "toolu_1", "name": "knows_search", "input": map[string]interface{}{}}},
+			map[string]interface{}{"type": "content_block_delta", "index": 1, "delta": map[string]interface{}{"type": "input_json_delta", "partial_json": `{"query":`}},
+			map[string]interface{}{"type": "content_block_delta", "index": 1, "delta": map[string]interface{}{"type": "input_json_delta", "partial_json": ` "PERT"}`}},
+			map[string]interface{}{"type": "content_block_stop", "index": 1},
+			map[string]interface{}{"type": "content_block_start", "index": 2, "content_block": map[string]interface{}{"type": "tool_use", "id": "toolu_2", "name": "kb_search", "input": map[string]interface{}{}}},
+			map[string]interface{}{"type": "content_block_stop", "index": 2},
+			map[string]interface{}{"type": "message_delta", "delta": map[string]interface{}{"stop_reason": "tool_use"}, "usage": map[string]interface{}{"output_tokens": 30}},
+			map[string]interface{}{"type": "message_stop"},
+		)
+	}))
+	defer server.Close()
+
+	p := NewProviderWithAPIKey("sk-ant-test", server.URL, "")
+	var chunks []StreamChunk
+	resp, err := p.ChatStream(t.Context(), []Message{{Role: "user", Content: "PERT?"}}, nil, "claude-sonnet-4-5-20250929", map[string]interface{}{},
+		func(chunk StreamChunk) { chunks = append(chunks, chunk) })
+	if err != nil {
+		t.Fatalf("ChatStream() error: %v", err)
+	}
+	if len(chunks) != 7 || chunks[0].Delta != "Searching " || chunks[1].Delta != "both." {
+		t.Fatalf("chunks = %+v", chunks)
+	}
+	if d := chunks[2].ToolCallDelta; d == nil || d.Index != 0 || d.ID != "toolu_1" || d.Name != "knows_search" {
+		t.Errorf("tool call start = %+v", d)
+	}
+	if d := chunks[4].ToolCallDelta; d == nil || d.Index != 0 || d.Arguments != ` "PERT"}` {
+		t.Errorf("tool call arguments = %+v", d)
+	}
+	if d := chunks[5].ToolCallDelta; d == nil || d.Index != 1 || d.Name != "kb_search" {
+		t.Errorf("second tool call = %+v", d)
+	}
+	if last := chunks[6]; last.FinishReason != "tool_calls" || last.Usage == nil || last.Usage.CachedTokens != 90 {
+		t.Errorf("last chunk = %+v", last)
+	}
+	if apiKey != "sk-ant-test" {
+		t.Errorf("x-api-key = %q", apiKey)
+	}
+	if resp.Content != "Searching both." || resp.FinishReason != "tool_calls" {
+		t.Errorf("response = %+v", resp)
+	}
+	if len(resp.ToolCalls) != 2 || resp.ToolCalls[0].Arguments["query"] != "PERT" || resp.ToolCalls[1].Name != "kb_search" {
+		t.Fatalf("tool calls = %+v", resp.ToolCalls)
+	}
+	if resp.Usage.PromptTokens != 100 || resp.Usage.CompletionTokens != 30 {
+		t.Errorf("usage = %+v", resp.Usage)
+	}
+}
+
+// writeSSE writes events as a Messages API event stream.
+func writeSSE(w http.ResponseWriter, events ...map[string]interface{}) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	for _, event := range events {
+		data, _ := json.Marshal(event)
+		fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event["type"], data)
+	}
+}
+
+// writeStreamedText streams a text-only answer.
+func writeStreamedText(w http.ResponseWriter, model interface{}, text string, inputTokens, outputTokens int) {
+	writeSSE(w,
+		map[string]interface{}{"type": "message_start", "message": map[string]interface{}{
+			"id": "msg_test", "type": "message", "role": "assistant", "model": model, "content": []interface{}{},
+			"usage": map[string]interface{}{"input_tokens": inputTokens, "output_tokens": 1},
+		}},
+		map[string]interface{}{"type": "content_block_start", "index": 0, "content_block": map[string]interface{}{"type": "text", "text": ""}},
+		map[string]interface{}{"type": "content_block_delta", "index": 0, "delta": map[string]interface{}{"type": "text_delta", "text": text}},
+		map[string]interface{}{"type": "content_block_stop", "index": 0},
+		map[string]interface{}{"type": "message_delta", "delta": map[string]interface{}{"stop_reason": "end_turn"}, "usage": map[string]interface{}{"output_tokens": outputTokens}},
+		map[string]interface{}{"type": "message_stop"},
+	)
+}
@@ -0,0 +1,302 @@
+package providers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// Capture is one provider call as recorded by a CaptureProvider.
+type Capture struct {
+	Time     time.Time `json:"time"`
+	Provider string    `json:"provider"`
+	Model    string    `json:"model"`
+	// Key identifies the conversation the call continued, for replay; it
+	// leaves out the system messages, which hold the time of the turn.
+	Key        string                 `json:"key"`
+	Messages   []Message              `json:"messages"`
+	Tools      []string               `json:"tools,omitempty"`
+	Options    map[string]interface{} `json:"options,omitempty"`
+	Response   *LLMResponse           `json:"response,omitempty"`
+	Error      string                 `json:"error,omitempty"`
+	DurationMS int64                  `json:"duration_ms"`
+}
+
+// CaptureProvider records the calls of the provider it wraps, redacted, to
+// a JSON lines file that a ReplayProvider serves back.
+type CaptureProvider struct {
+	delegate LLMProvider
+	name     string
+	log      *captureLog
+	redactor *captureRedactor
+}
+
+// NewCaptureProvider wraps delegate, the provider called name, so that its
+// calls are appended to the file at path. Argument names in redactKeys are
+// redacted along with the built-in ones.
+func NewCaptureProvider(delegate LLMProvider, name, path string, redactKeys []string) *CaptureProvider {
+	return &CaptureProvider{
+		delegate: delegate,
+		name:     name,
+		log:      captureLogFor(path),
+		redactor: newCaptureRedactor(redactKeys),
+	}
+}
+
+// Unwrap returns the wrapped provider.
+func (p *CaptureProvider) Unwrap() LLMProvider {
+	return p.delegate
+}
+
+func (p *CaptureProvider) Chat(ctx context.Context, messages []Message, tools []ToolDefinition, model string, options map[string]interface{}) (*LLMResponse, error) {
+	start := time.Now()
+	resp, err := p.delegate.Chat(ctx, messages, tools, model, options)
+	p.record(start, messages, tools, model, options, resp, err)
+	return resp, err
+}
+
+func (p *CaptureProvider) ChatStream(ctx context.Context, messages []Message, tools []ToolDefinition, model string, options map[string]interface{}, onChunk StreamFunc) (*LLMResponse, error) {
+	start := time.Now()
+	resp, err := ChatStream(ctx, p.delegate, messages, tools, model, options, onChunk)
+	p.record(start, messages, tools, model, options, resp, err)
+	return resp, err
+}
+
+func (p *CaptureProvider) GetDefaultModel() string {
+	return p.delegate.GetDefaultModel()
+}
+
+func (p *CaptureProvider) record(start time.Time, messages []Message, tools []ToolDefinition, model string,
+	options map[string]interface{}, resp *LLMResponse, err error) {
+	c := Capture{
+		Time:       start.UTC(),
+		Provider:   p.name,
+		Model:      model,
+		Messages:   p.redactor.messages(messages),
+		Options:    options,
+		DurationMS: time.Since(start).Milliseconds(),
+	}
+	c.Key = captureKey(model, c.Messages)
+	for _, t := range tools {
+		c.Tools = append(c.Tools, t.Function.Name)
+	}
+	if resp != nil {
+		redacted := *resp
+		redacted.Content = p.redactor.text(resp.Content)
+		redacted.ToolCalls = p.redactor.toolCalls(resp.ToolCalls)
+		redacted.Thinking = p.redactor.thinking(resp.Thinking)
+		c.Response = &redacted
+	}
+	if err != nil {
+		c.Error = p.redactor.text(err.Error())
+	}
+	if werr := p.log.append(c); werr != nil {
+		logger.WarnCF("providers", "Failed to capture provider call", map[string]interface{}{
+			"path":  p.log.path,
+			"error": werr.Error(),
+		})
+	}
+}
+
+// captureKey hashes the model and the conversation of messages, system
+// messages left out. Messages must already be redacted.
+func captureKey(model string, messages []Message) string {
+	h := sha256.New()
+	h.Write([]byte(model))
+	for _, m := range messages {
+		if m.Role == "system" {
+			continue
+		}
+		h.Write([]byte{0})
+		h.Write([]byte(m.Role + "\x1f" + m.Content))
+		for _, tc := range m.ToolCalls {
+			h.Write([]byte("\x1f" + toolCallName(&tc)))
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// captureLog is a capture file, shared by the providers writing to it.
+type captureLog struct {
+	path string
+	mu   sync.Mutex
+}
+
+var (
+	captureLogsMu sync.Mutex
+	captureLogs   = map[string]*captureLog{}
+)
+
+func captureLogFor(path string) *captureLog {
+	captureLogsMu.Lock()
+	defer captureLogsMu.Unlock()
+	if l, ok := captureLogs[path]; ok {
+		return l
+	}
+	l := &captureLog{path: path}
+	captureLogs[path] = l
+	return l
+}
+
+func (l *captureLog) append(c Capture) error {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := os.MkdirAll(filepath.Dir(l.path), 0700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+const redactedValue = "[REDACTED]"
+
+// defaultCaptureRedactKeys are tool argument names whose values are never
+// captured, matched by substring as in the audit log.
+var defaultCaptureRedactKeys = []string{"api_key", "apikey", "token", "password", "secret", "authorization", "cookie"}
+
+// capturePatterns mask personal details and credentials in captured text.
+// ID numbers go before phone numbers, which would match inside them.
+var capturePatterns = []struct {
+	re   *regexp.Regexp
+	mask string
+}{
+	{regexp.MustCompile(`\b\d{17}[\dXx]\b`), "[ID]"},
+	{regexp.MustCompile(`(?:\+86[- ]?|\b)1[3-9]\d{9}\b`), "[PHONE]"},
+	{regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`), "[EMAIL]"},
+	{regexp.MustCompile(`\bsk-[A-Za-z0-9_-]{16,}`), redactedValue},
+	{regexp.MustCompile(`(?i)\bbearer\s+[A-Za-z0-9._~+/=-]{8,}`), "Bearer " + redactedValue},
+}
+
+type captureRedactor struct {
+	keys []string
+}
+
+func newCaptureRedactor(extra []string) *captureRedactor {
+	keys := append([]string(nil), defaultCaptureRedactKeys...)
+	for _, k := range extra {
+		keys = append(keys, normalizeRedactKey(k))
+	}
+	return &captureRedactor{keys: keys}
+}
+
+func normalizeRedactKey(key string) string {
+	return strings.ReplaceAll(strings.ToLower(strings.TrimSpace(key)), "-", "_")
+}
+
+func (r *captureRedactor) text(s string) string {
+	for _, p := range capturePatterns {
+		s = p.re.ReplaceAllString(s, p.mask)
+	}
+	return s
+}
+
+func (r *captureRedactor) messages(messages []Message) []Message {
+	out := make([]Message, len(messages))
+	for i, m := range messages {
+		m.Content = r.text(m.Content)
+		m.ToolCalls = r.toolCalls(m.ToolCalls)
+		m.Thinking = r.thinking(m.Thinking)
+		if len(m.Images) > 0 {
+			// Images are too large to keep and may show the patient
+			images := make([]ImageContent, len(m.Images))
+			for j, img := range m.Images {
+				images[j] = ImageContent{MimeType: img.MimeType}
+			}
+			m.Images = images
+		}
+		out[i] = m
+	}
+	return out
+}
+
+func (r *captureRedactor) thinking(blocks []ThinkingBlock) []ThinkingBlock {
+	if len(blocks) == 0 {
+		return nil
+	}
+	out := make([]ThinkingBlock, len(blocks))
+	for i, b := range blocks {
+		b.Thinking = r.text(b.Thinking)
+		out[i] = b
+	}
+	return out
+}
+
+func (r *captureRedactor) toolCalls(calls []ToolCall) []ToolCall {
+	if len(calls) == 0 {
+		return nil
+	}
+	out := make([]ToolCall, len(calls))
+	for i, tc := range calls {
+		if tc.Arguments != nil {
+			tc.Arguments = r.value(tc.Arguments).(map[string]interface{})
+		}
+		if tc.Function != nil {
+			fn := *tc.Function
+			var args map[string]interface{}
+			if json.Unmarshal([]byte(fn.Arguments), &args) == nil && args != nil {
+				data, _ := json.Marshal(r.value(args))
+				fn.Arguments = string(data)
+			} else {
+				fn.Arguments = r.text(fn.Arguments)
+			}
+			tc.Function = &fn
+		}
+		out[i] = tc
+	}
+	return out
+}
+
+func (r *captureRedactor) value(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(val))
+		for k, item := range val {
+			if r.sensitive(k) {
+				out[k] = redactedValue
+				continue
+			}
+			out[k] = r.value(item)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(val))
+		for i, item := range val {
+			out[i] = r.value(item)
+		}
+		return out
+	case string:
+		return r.text(val)
+	default:
+		return val
+	}
+}
+
+func (r *captureRedactor) sensitive(key string) bool {
+	key = normalizeRedactKey(key)
+	for _, k := range r.keys {
+		if k != "" && strings.Contains(key, k) {
+			return true
+		}
+	}
+	return false
+}
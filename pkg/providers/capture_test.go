@@ -0,0 +1,152 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// scriptedProvider answers each call with the next of its replies.
+type scriptedProvider struct {
+	replies []*LLMResponse
+	calls   int
+}
+
+func (p *scriptedProvider) Chat(ctx context.Context, messages []Message, tools []ToolDefinition, model string, options map[string]interface{}) (*LLMResponse, error) {
+	p.calls++
+	if p.calls > len(p.replies) {
+		return nil, errors.New("503 service unavailable")
+	}
+	return p.replies[p.calls-1], nil
+}
+
+func (p *scriptedProvider) GetDefaultModel() string {
+	return "qwen-plus"
+}
+
+func TestCaptureRedactor(t *testing.T) {
+	r := newCaptureRedactor([]string{"MRN"})
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"我的电话是13812345678，请回电", "我的电话是[PHONE]，请回电"},
+		{"call +86 13812345678", "call [PHONE]"},
+		{"身份证 11010519491231002X", "身份证 [ID]"},
+		{"mail li.wei@example.com", "mail [EMAIL]"},
+		{"key sk-abcdefghijklmnopqrstuv", "key [REDACTED]"},
+		{"Authorization: Bearer abc.def.ghi123", "Authorization: Bearer [REDACTED]"},
+		{"CA19-9 37 U/mL on 2024-05-01", "CA19-9 37 U/mL on 2024-05-01"},
+	}
+	for _, tt := range tests {
+		if got := r.text(tt.in); got != tt.want {
+			t.Errorf("text(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+
+	calls := r.toolCalls([]ToolCall{{
+		Name:      "send_referral",
+		Arguments: map[string]interface{}{"patient_mrn": "A123", "api_key": "k", "note": "phone 13812345678"},
+		Function:  &FunctionCall{Name: "send_referral", Arguments: `{"patient_mrn":"A123","note":"ok"}`},
+	}})
+	args := calls[0].Arguments
+	if args["patient_mrn"] != redactedValue || args["api_key"] != redactedValue || args["note"] != "phone [PHONE]" {
+		t.Errorf("arguments = %v", args)
+	}
+	if calls[0].Function.Arguments != `{"note":"ok","patient_mrn":"[REDACTED]"}` {
+		t.Errorf("function arguments = %s", calls[0].Function.Arguments)
+	}
+}
+
+func TestCaptureAndReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "calls.jsonl")
+	delegate := &scriptedProvider{replies: []*LLMResponse{
+		{ToolCalls: []ToolCall{{ID: "c1", Name: "knows_search", Arguments: map[string]interface{}{"query": "CA19-9"}}}},
+		{Content: "CA19-9 is a tumour marker.", FinishReason: "stop"},
+	}}
+	capture := NewCaptureProvider(delegate, "qwen", path, nil)
+
+	turn := func(p LLMProvider, time string) []*LLMResponse {
+		messages := []Message{
+			{Role: "system", Content: "You are a helpful assistant."},
+			{Role: "system", Content: "Current Time: " + time},
+			{Role: "user", Content: "What is CA19-9? Call me at 13812345678", Images: []ImageContent{{MimeType: "image/png", Data: "iVBORw0"}}},
+		}
+		var out []*LLMResponse
+		first, err := p.Chat(context.Background(), messages, nil, "qwen-plus", nil)
+		if err != nil {
+			t.Fatalf("first call: %v", err)
+		}
+		out = append(out, first)
+		messages = append(messages,
+			Message{Role: "assistant", ToolCalls: first.ToolCalls},
+			Message{Role: "tool", ToolCallID: "c1", Content: "CA19-9 is a tumour marker."})
+		second, err := p.Chat(context.Background(), messages, nil, "qwen-plus", nil)
+		if err != nil {
+			t.Fatalf("second call: %v", err)
+		}
+		return append(out, second)
+	}
+	turn(capture, "2026-10-18 09:00")
+	if _, err := capture.Chat(context.Background(), []Message{{Role: "user", Content: "again"}}, nil, "qwen-plus", nil); err == nil {
+		t.Fatal("third call succeeded")
+	}
+
+	data, _ := os.ReadFile(path)
+	if strings.Contains(string(data), "13812345678") || strings.Contains(string(data), "iVBORw0") {
+		t.Errorf("capture keeps the phone number or the image:\n%s", data)
+	}
+	captures, err := LoadCaptures(path)
+	if err != nil || len(captures) != 3 {
+		t.Fatalf("LoadCaptures = %d captures, %v", len(captures), err)
+	}
+	if captures[2].Error != "503 service unavailable" {
+		t.Errorf("error = %q", captures[2].Error)
+	}
+
+	// The turn runs again at another time, with the same conversation
+	replay, err := NewReplayProvider(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := turn(replay, "2026-10-19 17:30")
+	if len(got[0].ToolCalls) != 1 || got[0].ToolCalls[0].Name != "knows_search" || got[1].Content != "CA19-9 is a tumour marker." {
+		t.Errorf("replayed %+v, %+v", got[0], got[1])
+	}
+	if _, err := replay.Chat(context.Background(), []Message{{Role: "user", Content: "again"}}, nil, "qwen-plus", nil); err == nil || err.Error() != "503 service unavailable" {
+		t.Errorf("replayed error = %v", err)
+	}
+	if _, err := replay.Chat(context.Background(), nil, nil, "qwen-plus", nil); !errors.Is(err, ErrReplayExhausted) {
+		t.Errorf("exhausted replay = %v", err)
+	}
+}
+
+func TestReplayProvider_ServesDriftedCallsInOrder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "calls.jsonl")
+	delegate := &scriptedProvider{replies: []*LLMResponse{{Content: "one"}, {Content: "two"}}}
+	capture := NewCaptureProvider(delegate, "qwen", path, nil)
+	for _, q := range []string{"first question", "second question"} {
+		capture.Chat(context.Background(), []Message{{Role: "user", Content: q}}, nil, "qwen-plus", nil)
+	}
+
+	replay, err := NewReplayProvider(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The second question matches its capture; the reworded first takes
+	// the next one left
+	resp, _ := replay.Chat(context.Background(), []Message{{Role: "user", Content: "second question"}}, nil, "qwen-plus", nil)
+	if resp.Content != "two" {
+		t.Errorf("matched reply = %q", resp.Content)
+	}
+	resp, _ = replay.Chat(context.Background(), []Message{{Role: "user", Content: "the first question, reworded"}}, nil, "qwen-plus", nil)
+	if resp.Content != "one" {
+		t.Errorf("drifted reply = %q", resp.Content)
+	}
+	if replay.Remaining() != 0 {
+		t.Errorf("Remaining = %d", replay.Remaining())
+	}
+}
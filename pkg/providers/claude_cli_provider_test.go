@@ -424,9 +424,9 @@ func TestCreateProvider_ClaudeCli(t *testing.T) {
 		t.Fatalf("CreateProvider(claude-cli) error = %v", err)
 	}
 
-	cliProvider, ok := provider.(*ClaudeCliProvider)
+	cliProvider, ok := unwrapRetry(provider).(*ClaudeCliProvider)
 	if !ok {
-		t.Fatalf("CreateProvider(claude-cli) returned %T, want *ClaudeCliProvider", provider)
+		t.Fatalf("CreateProvider(claude-cli) returned %T, want *ClaudeCliProvider", unwrapRetry(provider))
 	}
 	if cliProvider.workspace != "/test/ws" {
 		t.Errorf("workspace = %q, want %q", cliProvider.workspace, "/test/ws")
@@ -441,8 +441,8 @@ func TestCreateProvider_ClaudeCode(t *testing.T) {
 	if err != nil {
 		t.Fatalf("CreateProvider(claude-code) error = %v", err)
 	}
-	if _, ok := provider.(*ClaudeCliProvider); !ok {
-		t.Fatalf("CreateProvider(claude-code) returned %T, want *ClaudeCliProvider", provider)
+	if _, ok := unwrapRetry(provider).(*ClaudeCliProvider); !ok {
+		t.Fatalf("CreateProvider(claude-code) returned %T, want *ClaudeCliProvider", unwrapRetry(provider))
 	}
 }
 
@@ -454,8 +454,8 @@ func TestCreateProvider_ClaudeCodec(t *testing.T) {
 	if err != nil {
 		t.Fatalf("CreateProvider(claudecode) error = %v", err)
 	}
-	if _, ok := provider.(*ClaudeCliProvider); !ok {
-		t.Fatalf("CreateProvider(claudecode) returned %T, want *ClaudeCliProvider", provider)
+	if _, ok := unwrapRetry(provider).(*ClaudeCliProvider); !ok {
+		t.Fatalf("CreateProvider(claudecode) returned %T, want *ClaudeCliProvider", unwrapRetry(provider))
 	}
 }
 
@@ -469,9 +469,9 @@ func TestCreateProvider_ClaudeCliDefaultWorkspace(t *testing.T) {
 		t.Fatalf("CreateProvider error = %v", err)
 	}
 
-	cliProvider, ok := provider.(*ClaudeCliProvider)
+	cliProvider, ok := unwrapRetry(provider).(*ClaudeCliProvider)
 	if !ok {
-		t.Fatalf("returned %T, want *ClaudeCliProvider", provider)
+		t.Fatalf("returned %T, want *ClaudeCliProvider", unwrapRetry(provider))
 	}
 	if cliProvider.workspace != "." {
 		t.Errorf("workspace = %q, want %q (default)", cliProvider.workspace, ".")
@@ -23,6 +23,14 @@ func NewClaudeProviderWithBaseURL(token, apiBase string) *ClaudeProvider {
 	}
 }
 
+// NewClaudeProviderWithAPIKey returns a provider for the Anthropic
+// Messages API with native tool use, authenticated with an API key.
+func NewClaudeProviderWithAPIKey(apiKey, apiBase, proxy string) *ClaudeProvider {
+	return &ClaudeProvider{
+		delegate: anthropicprovider.NewProviderWithAPIKey(apiKey, apiBase, proxy),
+	}
+}
+
 func NewClaudeProviderWithTokenSource(token string, tokenSource func() (string, error)) *ClaudeProvider {
 	return &ClaudeProvider{
 		delegate: anthropicprovider.NewProviderWithTokenSource(token, tokenSource),
@@ -47,6 +55,10 @@ func (p *ClaudeProvider) Chat(ctx context.Context, messages []Message, tools []T
 	return resp, nil
 }
 
+func (p *ClaudeProvider) ChatStream(ctx context.Context, messages []Message, tools []ToolDefinition, model string, options map[string]interface{}, onChunk StreamFunc) (*LLMResponse, error) {
+	return p.delegate.ChatStream(ctx, messages, tools, model, options, onChunk)
+}
+
 func (p *ClaudeProvider) GetDefaultModel() string {
 	return p.delegate.GetDefaultModel()
 }
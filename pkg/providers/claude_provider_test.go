@@ -2,6 +2,7 @@ package providers
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -25,22 +26,7 @@ func TestClaudeProvider_ChatRoundTrip(t *testing.T) {
 		var reqBody map[string]interface{}
 		json.NewDecoder(r.Body).Decode(&reqBody)
 
-		resp := map[string]interface{}{
-			"id":          "msg_test",
-			"type":        "message",
-			"role":        "assistant",
-			"model":       reqBody["model"],
-			"stop_reason": "end_turn",
-			"content": []map[string]interface{}{
-				{"type": "text", "text": "Hello! How can I help you?"},
-			},
-			"usage": map[string]interface{}{
-				"input_tokens":  15,
-				"output_tokens": 8,
-			},
-		}
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(resp)
+		writeStreamedText(w, reqBody["model"], "Hello! How can I help you?", 15, 8)
 	}))
 	defer server.Close()
 
@@ -77,3 +63,23 @@ func createAnthropicTestClient(baseURL, token string) *anthropic.Client {
 	)
 	return &c
 }
+
+// writeStreamedText streams a text-only answer as a Messages API event
+// stream.
+func writeStreamedText(w http.ResponseWriter, model interface{}, text string, inputTokens, outputTokens int) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	for _, event := range []map[string]interface{}{
+		{"type": "message_start", "message": map[string]interface{}{
+			"id": "msg_test", "type": "message", "role": "assistant", "model": model, "content": []interface{}{},
+			"usage": map[string]interface{}{"input_tokens": inputTokens, "output_tokens": 1},
+		}},
+		{"type": "content_block_start", "index": 0, "content_block": map[string]interface{}{"type": "text", "text": ""}},
+		{"type": "content_block_delta", "index": 0, "delta": map[string]interface{}{"type": "text_delta", "text": text}},
+		{"type": "content_block_stop", "index": 0},
+		{"type": "message_delta", "delta": map[string]interface{}{"stop_reason": "end_turn"}, "usage": map[string]interface{}{"output_tokens": outputTokens}},
+		{"type": "message_stop"},
+	} {
+		data, _ := json.Marshal(event)
+		fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event["type"], data)
+	}
+}
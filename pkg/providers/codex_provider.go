@@ -10,8 +10,10 @@ import (
 	"github.com/openai/openai-go/v3"
 	"github.com/openai/openai-go/v3/option"
 	"github.com/openai/openai-go/v3/responses"
+	"github.com/openai/openai-go/v3/shared"
 	"github.com/sipeed/picoclaw/pkg/auth"
 	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/providers/protocoltypes"
 )
 
 const codexDefaultModel = "gpt-5.2"
@@ -32,6 +34,7 @@ func NewCodexProvider(token, accountID string) *CodexProvider {
 		option.WithAPIKey(token),
 		option.WithHeader("originator", "codex_cli_rs"),
 		option.WithHeader("OpenAI-Beta", "responses=experimental"),
+		option.WithMaxRetries(0),
 	}
 	if accountID != "" {
 		opts = append(opts, option.WithHeader("Chatgpt-Account-Id", accountID))
@@ -51,6 +54,12 @@ func NewCodexProviderWithTokenSource(token, accountID string, tokenSource func()
 }
 
 func (p *CodexProvider) Chat(ctx context.Context, messages []Message, tools []ToolDefinition, model string, options map[string]interface{}) (*LLMResponse, error) {
+	return p.ChatStream(ctx, messages, tools, model, options, nil)
+}
+
+// ChatStream is Chat with output text and function call argument deltas
+// passed to onChunk as the Responses API streams them.
+func (p *CodexProvider) ChatStream(ctx context.Context, messages []Message, tools []ToolDefinition, model string, options map[string]interface{}, onChunk StreamFunc) (*LLMResponse, error) {
 	var opts []option.RequestOption
 	accountID := p.accountID
 	resolvedModel, fallbackReason := resolveCodexModel(model)
@@ -86,8 +95,26 @@ func (p *CodexProvider) Chat(ctx context.Context, messages []Message, tools []To
 	defer stream.Close()
 
 	var resp *responses.Response
+	// Function calls are numbered by their output item
+	toolIndex := map[int64]int{}
 	for stream.Next() {
 		evt := stream.Current()
+		if onChunk != nil {
+			switch evt.Type {
+			case "response.output_text.delta":
+				onChunk(StreamChunk{Delta: evt.Delta})
+			case "response.output_item.added":
+				if evt.Item.Type == "function_call" {
+					index := len(toolIndex)
+					toolIndex[evt.OutputIndex] = index
+					onChunk(StreamChunk{ToolCallDelta: &ToolCallDelta{Index: index, ID: evt.Item.CallID, Name: evt.Item.Name}})
+				}
+			case "response.function_call_arguments.delta":
+				if index, ok := toolIndex[evt.OutputIndex]; ok {
+					onChunk(StreamChunk{ToolCallDelta: &ToolCallDelta{Index: index, Arguments: evt.Delta}})
+				}
+			}
+		}
 		if evt.Type == "response.completed" || evt.Type == "response.failed" || evt.Type == "response.incomplete" {
 			evtResp := evt.Response
 			if evtResp.ID != "" {
@@ -135,7 +162,11 @@ func (p *CodexProvider) Chat(ctx context.Context, messages []Message, tools []To
 		return nil, fmt.Errorf("codex API call: stream ended without completed response")
 	}
 
-	return parseCodexResponse(resp), nil
+	result := parseCodexResponse(resp)
+	if onChunk != nil {
+		onChunk(StreamChunk{FinishReason: result.FinishReason, Usage: result.Usage})
+	}
+	return result, nil
 }
 
 func (p *CodexProvider) GetDefaultModel() string {
@@ -162,6 +193,7 @@ func resolveCodexModel(model string) (string, string) {
 		"google",
 		"moonshot",
 		"kimi",
+		"baichuan",
 		"qwen",
 		"deepseek",
 		"llama",
@@ -184,6 +216,25 @@ func resolveCodexModel(model string) (string, string) {
 	return codexDefaultModel, "unsupported model family"
 }
 
+// codexImageContent is a user message with images, as input items.
+func codexImageContent(msg Message) responses.EasyInputMessageContentUnionParam {
+	var list responses.ResponseInputMessageContentListParam
+	for _, img := range msg.Images {
+		list = append(list, responses.ResponseInputContentUnionParam{
+			OfInputImage: &responses.ResponseInputImageParam{
+				Detail:   responses.ResponseInputImageDetailAuto,
+				ImageURL: openai.String(img.DataURL()),
+			},
+		})
+	}
+	if msg.Content != "" {
+		list = append(list, responses.ResponseInputContentUnionParam{
+			OfInputText: &responses.ResponseInputTextParam{Text: msg.Content},
+		})
+	}
+	return responses.EasyInputMessageContentUnionParam{OfInputItemContentList: list}
+}
+
 func buildCodexParams(messages []Message, tools []ToolDefinition, model string, options map[string]interface{}, enableWebSearch bool) responses.ResponseNewParams {
 	var inputItems responses.ResponseInputParam
 	var instructions string
@@ -191,7 +242,10 @@ func buildCodexParams(messages []Message, tools []ToolDefinition, model string,
 	for _, msg := range messages {
 		switch msg.Role {
 		case "system":
-			instructions = msg.Content
+			if instructions != "" {
+				instructions += "\n\n"
+			}
+			instructions += msg.Content
 		case "user":
 			if msg.ToolCallID != "" {
 				inputItems = append(inputItems, responses.ResponseInputItemUnionParam{
@@ -201,10 +255,14 @@ func buildCodexParams(messages []Message, tools []ToolDefinition, model string,
 					},
 				})
 			} else {
+				content := responses.EasyInputMessageContentUnionParam{OfString: openai.Opt(msg.Content)}
+				if len(msg.Images) > 0 {
+					content = codexImageContent(msg)
+				}
 				inputItems = append(inputItems, responses.ResponseInputItemUnionParam{
 					OfMessage: &responses.EasyInputMessageParam{
 						Role:    responses.EasyInputMessageRoleUser,
-						Content: responses.EasyInputMessageContentUnionParam{OfString: openai.Opt(msg.Content)},
+						Content: content,
 					},
 				})
 			}
@@ -260,6 +318,16 @@ func buildCodexParams(messages []Message, tools []ToolDefinition, model string,
 		Instructions: openai.Opt(instructions),
 		Store:        openai.Opt(false),
 	}
+	if key, ok := options["prompt_cache_key"].(string); ok && key != "" {
+		params.PromptCacheKey = openai.Opt(key)
+	}
+	// Codex models always reason; "off" asks for the least
+	if effort, _ := protocoltypes.Reasoning(options); effort != "" {
+		if effort == "off" {
+			effort = "low"
+		}
+		params.Reasoning = shared.ReasoningParam{Effort: shared.ReasoningEffort(effort)}
+	}
 
 	if instructions != "" {
 		params.Instructions = openai.Opt(instructions)
@@ -342,13 +410,16 @@ func parseCodexResponse(resp *responses.Response) *LLMResponse {
 			}
 		case "function_call":
 			var args map[string]interface{}
+			argsErr := ""
 			if err := json.Unmarshal([]byte(item.Arguments), &args); err != nil {
 				args = map[string]interface{}{"raw": item.Arguments}
+				argsErr = err.Error()
 			}
 			toolCalls = append(toolCalls, ToolCall{
-				ID:        item.CallID,
-				Name:      item.Name,
-				Arguments: args,
+				ID:             item.CallID,
+				Name:           item.Name,
+				Arguments:      args,
+				ArgumentsError: argsErr,
 			})
 		}
 	}
@@ -367,6 +438,7 @@ func parseCodexResponse(resp *responses.Response) *LLMResponse {
 			PromptTokens:     int(resp.Usage.InputTokens),
 			CompletionTokens: int(resp.Usage.OutputTokens),
 			TotalTokens:      int(resp.Usage.TotalTokens),
+			CachedTokens:     int(resp.Usage.InputTokensDetails.CachedTokens),
 		}
 	}
 
@@ -142,6 +142,17 @@ func TestBuildCodexParams_StoreIsFalse(t *testing.T) {
 	}
 }
 
+func TestBuildCodexParams_ReasoningEffort(t *testing.T) {
+	params := buildCodexParams([]Message{{Role: "user", Content: "Hi"}}, nil, "gpt-5.2", map[string]interface{}{"reasoning_effort": "high"}, false)
+	if params.Reasoning.Effort != "high" {
+		t.Errorf("Reasoning.Effort = %q, want high", params.Reasoning.Effort)
+	}
+	params = buildCodexParams([]Message{{Role: "user", Content: "Hi"}}, nil, "gpt-5.2", map[string]interface{}{}, false)
+	if params.Reasoning.Effort != "" {
+		t.Errorf("Reasoning.Effort = %q without an effort asked for", params.Reasoning.Effort)
+	}
+}
+
 func TestBuildCodexParams_DefaultWebSearchEnabled(t *testing.T) {
 	params := buildCodexParams([]Message{{Role: "user", Content: "Hi"}}, nil, "gpt-4o", map[string]interface{}{}, true)
 	if len(params.Tools) != 1 {
@@ -0,0 +1,46 @@
+package providers
+
+import (
+	"strconv"
+	"strings"
+)
+
+// ContextWindow returns the context size in tokens of the long-context
+// Moonshot (Kimi) and Baichuan models, or 0 for other models. Their
+// windows run to hundreds of thousands of tokens, far above the max_tokens
+// the agent would otherwise compact history at.
+func ContextWindow(model string) int {
+	m := strings.ToLower(model)
+	if i := strings.LastIndex(m, "/"); i >= 0 {
+		m = m[i+1:]
+	}
+	switch {
+	case strings.HasPrefix(m, "moonshot-v1-auto"):
+		return 128 * 1024
+	case strings.HasPrefix(m, "moonshot-v1-"), strings.HasPrefix(m, "baichuan"):
+		if k := sizeSuffix(m); k > 0 {
+			return k * 1024
+		}
+		if strings.HasPrefix(m, "baichuan") {
+			return 32 * 1024
+		}
+	case strings.HasPrefix(m, "kimi-k2-0711"):
+		return 128 * 1024
+	case strings.HasPrefix(m, "kimi-k2"):
+		return 256 * 1024
+	case strings.HasPrefix(m, "kimi-"):
+		return 128 * 1024
+	}
+	return 0
+}
+
+// sizeSuffix reads the context size in thousands from a model name part
+// such as "-32k" or "-192k", or returns 0.
+func sizeSuffix(model string) int {
+	for _, part := range strings.Split(model, "-") {
+		if n, err := strconv.Atoi(strings.TrimSuffix(part, "k")); err == nil && strings.HasSuffix(part, "k") && n > 0 {
+			return n
+		}
+	}
+	return 0
+}
@@ -0,0 +1,27 @@
+package providers
+
+import "testing"
+
+func TestContextWindow(t *testing.T) {
+	tests := []struct {
+		model string
+		want  int
+	}{
+		{"moonshot-v1-8k", 8192},
+		{"moonshot/moonshot-v1-128k", 131072},
+		{"moonshot-v1-32k-vision-preview", 32768},
+		{"moonshot-v1-auto", 131072},
+		{"kimi-k2-0711-preview", 131072},
+		{"kimi-k2-turbo-preview", 262144},
+		{"kimi-latest", 131072},
+		{"Baichuan2-Turbo-192k", 196608},
+		{"baichuan/Baichuan4-Turbo", 32768},
+		{"qwen-plus", 0},
+		{"gpt-4o", 0},
+	}
+	for _, tt := range tests {
+		if got := ContextWindow(tt.model); got != tt.want {
+			t.Errorf("ContextWindow(%q) = %d, want %d", tt.model, got, tt.want)
+		}
+	}
+}
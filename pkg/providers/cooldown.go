@@ -2,6 +2,7 @@ package providers
 
 import (
 	"math"
+	"sort"
 	"sync"
 	"time"
 )
@@ -26,6 +27,9 @@ type cooldownEntry struct {
 	DisabledUntil  time.Time      // billing-specific disable expiry
 	DisabledReason FailoverReason // reason for disable (billing)
 	LastFailure    time.Time
+	LastReason     FailoverReason
+	LastSuccess    time.Time
+	Refusals       int // content filter refusals, which set no cooldown
 }
 
 // NewCooldownTracker creates a tracker with default 24h failure window.
@@ -55,6 +59,7 @@ func (ct *CooldownTracker) MarkFailure(provider string, reason FailoverReason) {
 	entry.ErrorCount++
 	entry.FailureCounts[reason]++
 	entry.LastFailure = now
+	entry.LastReason = reason
 
 	if reason == FailoverBilling {
 		billingCount := entry.FailureCounts[FailoverBilling]
@@ -70,11 +75,8 @@ func (ct *CooldownTracker) MarkSuccess(provider string) {
 	ct.mu.Lock()
 	defer ct.mu.Unlock()
 
-	entry := ct.entries[provider]
-	if entry == nil {
-		return
-	}
-
+	entry := ct.getOrCreate(provider)
+	entry.LastSuccess = ct.nowFunc()
 	entry.ErrorCount = 0
 	entry.FailureCounts = make(map[FailoverReason]int)
 	entry.CooldownEnd = time.Time{}
@@ -82,6 +84,65 @@ func (ct *CooldownTracker) MarkSuccess(provider string) {
 	entry.DisabledReason = ""
 }
 
+// MarkRefusal records that the provider's content filter refused a
+// request. The provider stays available.
+func (ct *CooldownTracker) MarkRefusal(provider string) {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	ct.getOrCreate(provider).Refusals++
+}
+
+// ProviderHealth is the state of a provider in the fallback chain.
+type ProviderHealth struct {
+	Provider          string         `json:"provider"`
+	Available         bool           `json:"available"`
+	CooldownRemaining string         `json:"cooldown_remaining,omitempty"`
+	ErrorCount        int            `json:"error_count"`
+	LastReason        FailoverReason `json:"last_reason,omitempty"`
+	LastFailure       *time.Time     `json:"last_failure,omitempty"`
+	LastSuccess       *time.Time     `json:"last_success,omitempty"`
+	Refusals          int            `json:"content_filter_refusals,omitempty"`
+}
+
+// Health returns the state of every provider that has been called,
+// sorted by name.
+func (ct *CooldownTracker) Health() []ProviderHealth {
+	ct.mu.RLock()
+	providers := make([]string, 0, len(ct.entries))
+	for provider := range ct.entries {
+		providers = append(providers, provider)
+	}
+	ct.mu.RUnlock()
+	sort.Strings(providers)
+
+	out := make([]ProviderHealth, 0, len(providers))
+	for _, provider := range providers {
+		h := ProviderHealth{
+			Provider:   provider,
+			Available:  ct.IsAvailable(provider),
+			ErrorCount: ct.ErrorCount(provider),
+		}
+		if remaining := ct.CooldownRemaining(provider); remaining > 0 {
+			h.CooldownRemaining = remaining.Round(time.Second).String()
+		}
+		ct.mu.RLock()
+		entry := ct.entries[provider]
+		h.LastReason = entry.LastReason
+		h.Refusals = entry.Refusals
+		if !entry.LastFailure.IsZero() {
+			t := entry.LastFailure
+			h.LastFailure = &t
+		}
+		if !entry.LastSuccess.IsZero() {
+			t := entry.LastSuccess
+			h.LastSuccess = &t
+		}
+		ct.mu.RUnlock()
+		out = append(out, h)
+	}
+	return out
+}
+
 // IsAvailable returns true if the provider is not in cooldown or disabled.
 func (ct *CooldownTracker) IsAvailable(provider string) bool {
 	ct.mu.RLock()
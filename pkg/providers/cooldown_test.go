@@ -267,3 +267,29 @@ func TestCooldown_MultipleProviders(t *testing.T) {
 		t.Error("groq should be available")
 	}
 }
+
+func TestCooldown_Health(t *testing.T) {
+	now := time.Now()
+	ct, current := newTestTracker(now)
+
+	ct.MarkSuccess("openai")
+	ct.MarkFailure("azure", FailoverTimeout)
+	ct.MarkRefusal("deepseek")
+	*current = now.Add(30 * time.Second)
+
+	health := ct.Health()
+	if len(health) != 3 {
+		t.Fatalf("got %d providers, want 3: %+v", len(health), health)
+	}
+	azure, deepseek, openai := health[0], health[1], health[2]
+	if azure.Provider != "azure" || azure.Available || azure.ErrorCount != 1 ||
+		azure.LastReason != FailoverTimeout || azure.CooldownRemaining != "30s" || azure.LastFailure == nil {
+		t.Errorf("azure = %+v", azure)
+	}
+	if deepseek.Provider != "deepseek" || !deepseek.Available || deepseek.Refusals != 1 || deepseek.ErrorCount != 0 {
+		t.Errorf("deepseek = %+v", deepseek)
+	}
+	if openai.Provider != "openai" || !openai.Available || openai.LastSuccess == nil || !openai.LastSuccess.Equal(now) {
+		t.Errorf("openai = %+v", openai)
+	}
+}
@@ -78,6 +78,18 @@ var (
 		substr("invalid request format"),
 	}
 
+	// Refusals by the provider's content filter, which some providers
+	// report as a 400 status
+	contentFilterPatterns = []errorPattern{
+		substr("content_filter"),
+		substr("content management policy"),
+		substr("data_inspection_failed"),
+		substr("inappropriate content"),
+		substr("content exists risk"),
+		substr("unsafe or sensitive content"),
+		substr("不安全或敏感内容"),
+	}
+
 	imageDimensionPatterns = []errorPattern{
 		rxp(`image dimensions exceed max`),
 	}
@@ -128,6 +140,17 @@ func ClassifyError(err error, provider, model string) *FailoverError {
 		}
 	}
 
+	// Content filter refusals come before the status, which is often 400.
+	if matchesAny(msg, contentFilterPatterns) {
+		return &FailoverError{
+			Reason:   FailoverContentFilter,
+			Provider: provider,
+			Model:    model,
+			Status:   extractHTTPStatus(msg),
+			Wrapped:  err,
+		}
+	}
+
 	// Try HTTP status code extraction first.
 	if status := extractHTTPStatus(msg); status > 0 {
 		if reason := classifyByStatus(status); reason != "" {
@@ -207,6 +207,29 @@ func TestClassifyError_FormatPatterns(t *testing.T) {
 	}
 }
 
+func TestClassifyError_ContentFilterPatterns(t *testing.T) {
+	patterns := []string{
+		`API request failed: status 400: {"error":{"code":"content_filter","message":"The response was filtered due to the prompt triggering Azure OpenAI's content management policy."}}`,
+		"status: 400 data_inspection_failed: Input data may contain inappropriate content.",
+		"API request failed: status 400: Content Exists Risk",
+		"系统检测到输入或生成内容可能包含不安全或敏感内容",
+	}
+
+	for _, msg := range patterns {
+		result := ClassifyError(errors.New(msg), "azure", "gpt-4o")
+		if result == nil {
+			t.Errorf("pattern %q: expected non-nil", msg)
+			continue
+		}
+		if result.Reason != FailoverContentFilter {
+			t.Errorf("pattern %q: reason = %q, want content_filter", msg, result.Reason)
+		}
+		if !result.IsRetriable() {
+			t.Errorf("pattern %q: should fall back", msg)
+		}
+	}
+}
+
 func TestClassifyError_ImageDimensionError(t *testing.T) {
 	err := errors.New("image dimensions exceed max allowed 2048x2048")
 	result := ClassifyError(err, "openai", "gpt-4o")
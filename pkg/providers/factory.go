@@ -2,10 +2,12 @@ package providers
 
 import (
 	"fmt"
+	"net/url"
 	"strings"
 
 	"github.com/sipeed/picoclaw/pkg/auth"
 	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/providers/openai_compat"
 )
 
 const defaultAnthropicAPIBase = "https://api.anthropic.com/v1"
@@ -17,14 +19,17 @@ type providerType int
 const (
 	providerTypeHTTPCompat providerType = iota
 	providerTypeClaudeAuth
+	providerTypeClaudeAPIKey
 	providerTypeCodexAuth
 	providerTypeCodexCLIToken
 	providerTypeClaudeCLI
 	providerTypeCodexCLI
 	providerTypeGitHubCopilot
+	providerTypeAzure
 )
 
 type providerSelection struct {
+	name            string // the provider asked for, which names its retry limiter
 	providerType    providerType
 	apiKey          string
 	apiBase         string
@@ -33,6 +38,29 @@ type providerSelection struct {
 	workspace       string
 	connectMode     string
 	enableWebSearch bool
+	local           bool // a local model server, which needs no API key
+	textTools       bool // wrap the provider in NewTextToolProvider
+}
+
+const (
+	defaultDashScopeAPIBase = "https://dashscope.aliyuncs.com/compatible-mode/v1"
+	defaultDeepSeekAPIBase  = "https://api.deepseek.com/v1"
+	defaultMoonshotAPIBase  = "https://api.moonshot.cn/v1"
+	defaultBaichuanAPIBase  = "https://api.baichuan-ai.com/v1"
+	defaultOllamaAPIBase    = "http://localhost:11434/v1"
+	defaultLlamaCppAPIBase  = "http://localhost:8080/v1"
+)
+
+// useLocal selects a local OpenAI-compatible model server.
+func (sel *providerSelection) useLocal(pc config.LocalProviderConfig, defaultAPIBase string) {
+	sel.apiKey = pc.APIKey
+	sel.apiBase = pc.APIBase
+	sel.proxy = pc.Proxy
+	if sel.apiBase == "" {
+		sel.apiBase = defaultAPIBase
+	}
+	sel.local = true
+	sel.textTools = pc.ToolMode == "text"
 }
 
 func createClaudeAuthProvider(apiBase string) (LLMProvider, error) {
@@ -49,6 +77,29 @@ func createClaudeAuthProvider(apiBase string) (LLMProvider, error) {
 	return NewClaudeProviderWithTokenSourceAndBaseURL(cred.AccessToken, createClaudeTokenSource(), apiBase), nil
 }
 
+func createAzureProvider(az config.AzureProviderConfig) (LLMProvider, error) {
+	opts := openai_compat.AzureOptions{
+		Endpoint:    az.APIBase,
+		APIVersion:  az.APIVersion,
+		APIKey:      az.APIKey,
+		Deployments: az.Deployments,
+		Proxy:       az.Proxy,
+	}
+	switch az.AuthMethod {
+	case "", "api_key":
+		if az.APIKey == "" {
+			return nil, fmt.Errorf("no API key configured for azure. Set providers.azure.api_key or auth_method")
+		}
+	case "client_secret":
+		opts.TokenSource = openai_compat.NewAzureClientSecretTokenSource(az.TenantID, az.ClientID, az.ClientSecret, az.Proxy)
+	case "managed_identity":
+		opts.TokenSource = openai_compat.NewAzureManagedIdentityTokenSource(az.ClientID)
+	default:
+		return nil, fmt.Errorf("unknown azure auth_method %q", az.AuthMethod)
+	}
+	return &HTTPProvider{delegate: openai_compat.NewAzureProvider(opts)}, nil
+}
+
 func createCodexAuthProvider(enableWebSearch bool) (LLMProvider, error) {
 	cred, err := getCredential("openai")
 	if err != nil {
@@ -63,11 +114,17 @@ func createCodexAuthProvider(enableWebSearch bool) (LLMProvider, error) {
 }
 
 func resolveProviderSelection(cfg *config.Config) (providerSelection, error) {
-	model := cfg.Agents.Defaults.Model
-	providerName := strings.ToLower(cfg.Agents.Defaults.Provider)
+	return resolveProviderSelectionFor(cfg, cfg.Agents.Defaults.Provider, cfg.Agents.Defaults.Model)
+}
+
+// resolveProviderSelectionFor picks the provider for a model, using the
+// named provider's configuration when one is given.
+func resolveProviderSelectionFor(cfg *config.Config, provider, model string) (providerSelection, error) {
+	providerName := strings.ToLower(provider)
 	lowerModel := strings.ToLower(model)
 
 	sel := providerSelection{
+		name:         NormalizeProvider(provider),
 		providerType: providerTypeHTTPCompat,
 		model:        model,
 	}
@@ -118,6 +175,8 @@ func resolveProviderSelection(cfg *config.Config) (providerSelection, error) {
 				if sel.apiBase == "" {
 					sel.apiBase = defaultAnthropicAPIBase
 				}
+				sel.providerType = providerTypeClaudeAPIKey
+				return sel, nil
 			}
 		case "openrouter":
 			if cfg.Providers.OpenRouter.APIKey != "" {
@@ -134,6 +193,7 @@ func resolveProviderSelection(cfg *config.Config) (providerSelection, error) {
 				sel.apiKey = cfg.Providers.Zhipu.APIKey
 				sel.apiBase = cfg.Providers.Zhipu.APIBase
 				sel.proxy = cfg.Providers.Zhipu.Proxy
+				sel.enableWebSearch = cfg.Providers.Zhipu.WebSearch
 				if sel.apiBase == "" {
 					sel.apiBase = "https://open.bigmodel.cn/api/paas/v4"
 				}
@@ -147,6 +207,24 @@ func resolveProviderSelection(cfg *config.Config) (providerSelection, error) {
 					sel.apiBase = "https://generativelanguage.googleapis.com/v1beta"
 				}
 			}
+		case "moonshot", "kimi":
+			if cfg.Providers.Moonshot.APIKey != "" {
+				sel.apiKey = cfg.Providers.Moonshot.APIKey
+				sel.apiBase = cfg.Providers.Moonshot.APIBase
+				sel.proxy = cfg.Providers.Moonshot.Proxy
+				if sel.apiBase == "" {
+					sel.apiBase = defaultMoonshotAPIBase
+				}
+			}
+		case "baichuan":
+			if cfg.Providers.Baichuan.APIKey != "" {
+				sel.apiKey = cfg.Providers.Baichuan.APIKey
+				sel.apiBase = cfg.Providers.Baichuan.APIBase
+				sel.proxy = cfg.Providers.Baichuan.Proxy
+				if sel.apiBase == "" {
+					sel.apiBase = defaultBaichuanAPIBase
+				}
+			}
 		case "vllm":
 			if cfg.Providers.VLLM.APIBase != "" {
 				sel.apiKey = cfg.Providers.VLLM.APIKey
@@ -202,12 +280,31 @@ func resolveProviderSelection(cfg *config.Config) (providerSelection, error) {
 				sel.apiBase = cfg.Providers.DeepSeek.APIBase
 				sel.proxy = cfg.Providers.DeepSeek.Proxy
 				if sel.apiBase == "" {
-					sel.apiBase = "https://api.deepseek.com/v1"
+					sel.apiBase = defaultDeepSeekAPIBase
 				}
 				if model != "deepseek-chat" && model != "deepseek-reasoner" {
 					sel.model = "deepseek-chat"
 				}
 			}
+		case "dashscope", "qwen", "aliyun":
+			if cfg.Providers.DashScope.APIKey != "" {
+				sel.apiKey = cfg.Providers.DashScope.APIKey
+				sel.apiBase = cfg.Providers.DashScope.APIBase
+				sel.proxy = cfg.Providers.DashScope.Proxy
+				if sel.apiBase == "" {
+					sel.apiBase = defaultDashScopeAPIBase
+				}
+			}
+		case "azure", "azure-openai", "azure_openai":
+			if cfg.Providers.Azure.APIBase != "" {
+				sel.providerType = providerTypeAzure
+				sel.apiBase = cfg.Providers.Azure.APIBase
+				return sel, nil
+			}
+		case "ollama":
+			sel.useLocal(cfg.Providers.Ollama, defaultOllamaAPIBase)
+		case "llamacpp", "llama.cpp", "llama-cpp":
+			sel.useLocal(cfg.Providers.LlamaCpp, defaultLlamaCppAPIBase)
 		case "github_copilot", "copilot":
 			sel.providerType = providerTypeGitHubCopilot
 			if cfg.Providers.GitHubCopilot.APIBase != "" {
@@ -228,7 +325,25 @@ func resolveProviderSelection(cfg *config.Config) (providerSelection, error) {
 			sel.apiBase = cfg.Providers.Moonshot.APIBase
 			sel.proxy = cfg.Providers.Moonshot.Proxy
 			if sel.apiBase == "" {
-				sel.apiBase = "https://api.moonshot.cn/v1"
+				sel.apiBase = defaultMoonshotAPIBase
+			}
+		case (strings.Contains(lowerModel, "baichuan") || strings.HasPrefix(model, "baichuan/")) && cfg.Providers.Baichuan.APIKey != "":
+			sel.apiKey = cfg.Providers.Baichuan.APIKey
+			sel.apiBase = cfg.Providers.Baichuan.APIBase
+			sel.proxy = cfg.Providers.Baichuan.Proxy
+			if sel.apiBase == "" {
+				sel.apiBase = defaultBaichuanAPIBase
+			}
+		case strings.HasPrefix(model, "azure/") && cfg.Providers.Azure.APIBase != "":
+			sel.providerType = providerTypeAzure
+			sel.apiBase = cfg.Providers.Azure.APIBase
+			return sel, nil
+		case (strings.HasPrefix(lowerModel, "deepseek-") || strings.HasPrefix(model, "deepseek/")) && cfg.Providers.DeepSeek.APIKey != "":
+			sel.apiKey = cfg.Providers.DeepSeek.APIKey
+			sel.apiBase = cfg.Providers.DeepSeek.APIBase
+			sel.proxy = cfg.Providers.DeepSeek.Proxy
+			if sel.apiBase == "" {
+				sel.apiBase = defaultDeepSeekAPIBase
 			}
 		case strings.HasPrefix(model, "openrouter/") ||
 			strings.HasPrefix(model, "anthropic/") ||
@@ -259,6 +374,8 @@ func resolveProviderSelection(cfg *config.Config) (providerSelection, error) {
 			if sel.apiBase == "" {
 				sel.apiBase = defaultAnthropicAPIBase
 			}
+			sel.providerType = providerTypeClaudeAPIKey
+			return sel, nil
 		case (strings.Contains(lowerModel, "gpt") || strings.HasPrefix(model, "openai/")) &&
 			(cfg.Providers.OpenAI.APIKey != "" || cfg.Providers.OpenAI.AuthMethod != ""):
 			sel.enableWebSearch = cfg.Providers.OpenAI.WebSearch
@@ -294,6 +411,7 @@ func resolveProviderSelection(cfg *config.Config) (providerSelection, error) {
 			sel.apiKey = cfg.Providers.Zhipu.APIKey
 			sel.apiBase = cfg.Providers.Zhipu.APIBase
 			sel.proxy = cfg.Providers.Zhipu.Proxy
+			sel.enableWebSearch = cfg.Providers.Zhipu.WebSearch
 			if sel.apiBase == "" {
 				sel.apiBase = "https://open.bigmodel.cn/api/paas/v4"
 			}
@@ -311,12 +429,17 @@ func resolveProviderSelection(cfg *config.Config) (providerSelection, error) {
 			if sel.apiBase == "" {
 				sel.apiBase = "https://integrate.api.nvidia.com/v1"
 			}
-		case (strings.Contains(lowerModel, "ollama") || strings.HasPrefix(model, "ollama/")) && cfg.Providers.Ollama.APIKey != "":
-			sel.apiKey = cfg.Providers.Ollama.APIKey
-			sel.apiBase = cfg.Providers.Ollama.APIBase
-			sel.proxy = cfg.Providers.Ollama.Proxy
+		case strings.HasPrefix(model, "ollama/") ||
+			(strings.Contains(lowerModel, "ollama") && (cfg.Providers.Ollama.APIKey != "" || cfg.Providers.Ollama.APIBase != "")):
+			sel.useLocal(cfg.Providers.Ollama, defaultOllamaAPIBase)
+		case strings.HasPrefix(model, "llamacpp/"):
+			sel.useLocal(cfg.Providers.LlamaCpp, defaultLlamaCppAPIBase)
+		case (strings.Contains(lowerModel, "qwen") || strings.HasPrefix(model, "dashscope/")) && cfg.Providers.DashScope.APIKey != "":
+			sel.apiKey = cfg.Providers.DashScope.APIKey
+			sel.apiBase = cfg.Providers.DashScope.APIBase
+			sel.proxy = cfg.Providers.DashScope.Proxy
 			if sel.apiBase == "" {
-				sel.apiBase = "http://localhost:11434/v1"
+				sel.apiBase = defaultDashScopeAPIBase
 			}
 		case cfg.Providers.VLLM.APIBase != "":
 			sel.apiKey = cfg.Providers.VLLM.APIKey
@@ -338,7 +461,7 @@ func resolveProviderSelection(cfg *config.Config) (providerSelection, error) {
 	}
 
 	if sel.providerType == providerTypeHTTPCompat {
-		if sel.apiKey == "" && !strings.HasPrefix(model, "bedrock/") {
+		if sel.apiKey == "" && !sel.local && !strings.HasPrefix(model, "bedrock/") {
 			return providerSelection{}, fmt.Errorf("no API key configured for provider (model: %s)", model)
 		}
 		if sel.apiBase == "" {
@@ -354,10 +477,56 @@ func CreateProvider(cfg *config.Config) (LLMProvider, error) {
 	if err != nil {
 		return nil, err
 	}
+	return createProvider(cfg, sel)
+}
+
+// CreateProviderForModel creates the provider that serves model, configured
+// from the named provider's settings rather than the agent defaults. The
+// agent loop uses it for the candidates of a fallback chain.
+func CreateProviderForModel(cfg *config.Config, provider, model string) (LLMProvider, error) {
+	sel, err := resolveProviderSelectionFor(cfg, provider, model)
+	if err != nil {
+		return nil, err
+	}
+	return createProvider(cfg, sel)
+}
 
+// createProvider creates the selected provider, wrapped so that its rate
+// limits and server errors are retried, and its calls captured when
+// capture is on.
+func createProvider(cfg *config.Config, sel providerSelection) (LLMProvider, error) {
+	provider, err := newProvider(cfg, sel)
+	if err != nil {
+		return nil, err
+	}
+	var wrapped LLMProvider = NewRetryProvider(provider, sel.limiterName(), cfg.Providers.Retry)
+	if capture := cfg.Providers.Capture; capture.Enabled {
+		wrapped = NewCaptureProvider(wrapped, sel.limiterName(), cfg.CapturePath(), capture.RedactKeys)
+	}
+	return wrapped, nil
+}
+
+// limiterName names the provider for its retry limiter: as configured,
+// or by its API host when it was inferred from the model.
+func (sel *providerSelection) limiterName() string {
+	if sel.name != "" {
+		return sel.name
+	}
+	if u, err := url.Parse(sel.apiBase); err == nil && u.Host != "" {
+		return u.Host
+	}
+	if sel.apiBase != "" {
+		return sel.apiBase
+	}
+	return "default"
+}
+
+func newProvider(cfg *config.Config, sel providerSelection) (LLMProvider, error) {
 	switch sel.providerType {
 	case providerTypeClaudeAuth:
 		return createClaudeAuthProvider(sel.apiBase)
+	case providerTypeClaudeAPIKey:
+		return NewClaudeProviderWithAPIKey(sel.apiKey, sel.apiBase, sel.proxy), nil
 	case providerTypeCodexAuth:
 		return createCodexAuthProvider(sel.enableWebSearch)
 	case providerTypeCodexCLIToken:
@@ -370,7 +539,14 @@ func CreateProvider(cfg *config.Config) (LLMProvider, error) {
 		return NewCodexCliProvider(sel.workspace), nil
 	case providerTypeGitHubCopilot:
 		return NewGitHubCopilotProvider(sel.apiBase, sel.connectMode, sel.model)
+	case providerTypeAzure:
+		return createAzureProvider(cfg.Providers.Azure)
 	default:
-		return NewHTTPProvider(sel.apiKey, sel.apiBase, sel.proxy), nil
+		provider := NewHTTPProvider(sel.apiKey, sel.apiBase, sel.proxy)
+		provider.delegate.SetWebSearch(sel.enableWebSearch)
+		if sel.textTools {
+			return NewTextToolProvider(provider), nil
+		}
+		return provider, nil
 	}
 }
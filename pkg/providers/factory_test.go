@@ -67,6 +67,27 @@ func TestResolveProviderSelection(t *testing.T) {
 			wantAPIBase: "https://integrate.api.nvidia.com/v1",
 			wantProxy:   "http://127.0.0.1:7890",
 		},
+		{
+			name: "explicit kimi provider uses moonshot defaults",
+			setup: func(cfg *config.Config) {
+				cfg.Agents.Defaults.Provider = "kimi"
+				cfg.Agents.Defaults.Model = "moonshot-v1-128k"
+				cfg.Providers.Moonshot.APIKey = "sk-moonshot"
+			},
+			wantType:    providerTypeHTTPCompat,
+			wantAPIBase: "https://api.moonshot.cn/v1",
+		},
+		{
+			name: "baichuan model uses baichuan defaults",
+			setup: func(cfg *config.Config) {
+				cfg.Agents.Defaults.Model = "Baichuan4-Turbo"
+				cfg.Providers.Baichuan.APIKey = "sk-baichuan"
+				cfg.Providers.Baichuan.Proxy = "http://127.0.0.1:7890"
+			},
+			wantType:    providerTypeHTTPCompat,
+			wantAPIBase: "https://api.baichuan-ai.com/v1",
+			wantProxy:   "http://127.0.0.1:7890",
+		},
 		{
 			name: "openrouter model uses openrouter defaults",
 			setup: func(cfg *config.Config) {
@@ -84,6 +105,17 @@ func TestResolveProviderSelection(t *testing.T) {
 			},
 			wantType: providerTypeClaudeAuth,
 		},
+		{
+			name: "anthropic api key routes to native claude provider",
+			setup: func(cfg *config.Config) {
+				cfg.Agents.Defaults.Model = "claude-sonnet-4-5-20250929"
+				cfg.Providers.Anthropic.APIKey = "sk-ant-test"
+				cfg.Providers.Anthropic.Proxy = "http://127.0.0.1:7890"
+			},
+			wantType:    providerTypeClaudeAPIKey,
+			wantAPIBase: "https://api.anthropic.com/v1",
+			wantProxy:   "http://127.0.0.1:7890",
+		},
 		{
 			name: "openai oauth routes to codex auth provider",
 			setup: func(cfg *config.Config) {
@@ -135,6 +167,75 @@ func TestResolveProviderSelection(t *testing.T) {
 			wantType:    providerTypeHTTPCompat,
 			wantAPIBase: "http://localhost:11434/v1",
 		},
+		{
+			name: "explicit dashscope provider uses compatible-mode base",
+			setup: func(cfg *config.Config) {
+				cfg.Agents.Defaults.Provider = "dashscope"
+				cfg.Agents.Defaults.Model = "qwen-plus"
+				cfg.Providers.DashScope.APIKey = "sk-dashscope"
+			},
+			wantType:    providerTypeHTTPCompat,
+			wantAPIBase: "https://dashscope.aliyuncs.com/compatible-mode/v1",
+		},
+		{
+			name: "qwen model uses dashscope when configured",
+			setup: func(cfg *config.Config) {
+				cfg.Agents.Defaults.Model = "qwen-max"
+				cfg.Providers.DashScope.APIKey = "sk-dashscope"
+				cfg.Providers.OpenRouter.APIKey = "sk-or"
+			},
+			wantType:    providerTypeHTTPCompat,
+			wantAPIBase: "https://dashscope.aliyuncs.com/compatible-mode/v1",
+		},
+		{
+			name: "deepseek model prefix prefers deepseek over openrouter",
+			setup: func(cfg *config.Config) {
+				cfg.Agents.Defaults.Model = "deepseek/deepseek-chat"
+				cfg.Providers.DeepSeek.APIKey = "deepseek-key"
+				cfg.Providers.OpenRouter.APIKey = "sk-or"
+			},
+			wantType:    providerTypeHTTPCompat,
+			wantAPIBase: "https://api.deepseek.com/v1",
+		},
+		{
+			name: "explicit azure provider uses its endpoint",
+			setup: func(cfg *config.Config) {
+				cfg.Agents.Defaults.Provider = "azure"
+				cfg.Agents.Defaults.Model = "gpt-4o"
+				cfg.Providers.Azure.APIBase = "https://hospital.openai.azure.com"
+				cfg.Providers.Azure.AuthMethod = "managed_identity"
+			},
+			wantType:    providerTypeAzure,
+			wantAPIBase: "https://hospital.openai.azure.com",
+		},
+		{
+			name: "azure model prefix routes to azure",
+			setup: func(cfg *config.Config) {
+				cfg.Agents.Defaults.Model = "azure/gpt-4o"
+				cfg.Providers.Azure.APIBase = "https://hospital.openai.azure.com"
+				cfg.Providers.Azure.APIKey = "azure-key"
+				cfg.Providers.OpenAI.APIKey = "sk-openai"
+			},
+			wantType:    providerTypeAzure,
+			wantAPIBase: "https://hospital.openai.azure.com",
+		},
+		{
+			name: "ollama model prefix needs no api key",
+			setup: func(cfg *config.Config) {
+				cfg.Agents.Defaults.Model = "ollama/qwen2.5:14b"
+			},
+			wantType:    providerTypeHTTPCompat,
+			wantAPIBase: "http://localhost:11434/v1",
+		},
+		{
+			name: "explicit llamacpp provider uses local default base",
+			setup: func(cfg *config.Config) {
+				cfg.Agents.Defaults.Provider = "llama.cpp"
+				cfg.Agents.Defaults.Model = "qwen2.5-7b-instruct"
+			},
+			wantType:    providerTypeHTTPCompat,
+			wantAPIBase: "http://localhost:8080/v1",
+		},
 		{
 			name: "moonshot model keeps proxy and default base",
 			setup: func(cfg *config.Config) {
@@ -214,6 +315,14 @@ func TestResolveProviderSelection(t *testing.T) {
 	}
 }
 
+// unwrapRetry returns the provider CreateProvider wrapped for retries.
+func unwrapRetry(p LLMProvider) LLMProvider {
+	if rp, ok := p.(*RetryProvider); ok {
+		return rp.Unwrap()
+	}
+	return p
+}
+
 func TestCreateProviderReturnsHTTPProviderForOpenRouter(t *testing.T) {
 	cfg := config.DefaultConfig()
 	cfg.Agents.Defaults.Model = "openrouter/auto"
@@ -224,8 +333,85 @@ func TestCreateProviderReturnsHTTPProviderForOpenRouter(t *testing.T) {
 		t.Fatalf("CreateProvider() error = %v", err)
 	}
 
-	if _, ok := provider.(*HTTPProvider); !ok {
-		t.Fatalf("provider type = %T, want *HTTPProvider", provider)
+	if _, ok := unwrapRetry(provider).(*HTTPProvider); !ok {
+		t.Fatalf("provider type = %T, want *HTTPProvider", unwrapRetry(provider))
+	}
+}
+
+func TestCreateProviderWrapsLocalModelInTextTools(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Agents.Defaults.Provider = "ollama"
+	cfg.Agents.Defaults.Model = "ollama/medllama2"
+	cfg.Providers.Ollama.ToolMode = "text"
+
+	provider, err := CreateProvider(cfg)
+	if err != nil {
+		t.Fatalf("CreateProvider() error = %v", err)
+	}
+	if _, ok := unwrapRetry(provider).(*TextToolProvider); !ok {
+		t.Fatalf("provider type = %T, want *TextToolProvider", unwrapRetry(provider))
+	}
+
+	cfg.Providers.Ollama.ToolMode = ""
+	if provider, _ = CreateProvider(cfg); provider == nil {
+		t.Fatal("CreateProvider() returned nil")
+	}
+	if _, ok := unwrapRetry(provider).(*HTTPProvider); !ok {
+		t.Fatalf("provider type = %T, want *HTTPProvider", unwrapRetry(provider))
+	}
+}
+
+func TestResolveProviderSelectionZhipuWebSearch(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Agents.Defaults.Provider = "zhipu"
+	cfg.Providers.Zhipu.APIKey = "zhipu-key"
+	cfg.Providers.Zhipu.WebSearch = true
+
+	sel, err := resolveProviderSelection(cfg)
+	if err != nil {
+		t.Fatalf("resolveProviderSelection() error = %v", err)
+	}
+	if !sel.enableWebSearch {
+		t.Error("enableWebSearch = false, want true")
+	}
+}
+
+func TestCreateProviderAzureNeedsCredentials(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Agents.Defaults.Provider = "azure"
+	cfg.Providers.Azure.APIBase = "https://hospital.openai.azure.com"
+
+	if _, err := CreateProvider(cfg); err == nil {
+		t.Fatal("CreateProvider() without an API key succeeded")
+	}
+	cfg.Providers.Azure.APIKey = "azure-key"
+	provider, err := CreateProvider(cfg)
+	if err != nil {
+		t.Fatalf("CreateProvider() error = %v", err)
+	}
+	if _, ok := unwrapRetry(provider).(*HTTPProvider); !ok {
+		t.Fatalf("provider type = %T, want *HTTPProvider", unwrapRetry(provider))
+	}
+}
+
+func TestCreateProviderForModelUsesCandidateProvider(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Agents.Defaults.Provider = "azure"
+	cfg.Agents.Defaults.Model = "gpt-4o"
+	cfg.Providers.DeepSeek.APIKey = "deepseek-key"
+
+	sel, err := resolveProviderSelectionFor(cfg, "deepseek", "deepseek-chat")
+	if err != nil {
+		t.Fatalf("resolveProviderSelectionFor() error = %v", err)
+	}
+	if sel.apiKey != "deepseek-key" || sel.apiBase != defaultDeepSeekAPIBase {
+		t.Errorf("selection = key %q base %q, want the deepseek settings", sel.apiKey, sel.apiBase)
+	}
+	if _, err := CreateProviderForModel(cfg, "deepseek", "deepseek-chat"); err != nil {
+		t.Fatalf("CreateProviderForModel() error = %v", err)
+	}
+	if _, err := CreateProviderForModel(cfg, "groq", "llama-3.3-70b"); err == nil {
+		t.Error("CreateProviderForModel() for an unconfigured provider succeeded")
 	}
 }
 
@@ -238,8 +424,8 @@ func TestCreateProviderReturnsCodexCliProviderForCodexCode(t *testing.T) {
 		t.Fatalf("CreateProvider() error = %v", err)
 	}
 
-	if _, ok := provider.(*CodexCliProvider); !ok {
-		t.Fatalf("provider type = %T, want *CodexCliProvider", provider)
+	if _, ok := unwrapRetry(provider).(*CodexCliProvider); !ok {
+		t.Fatalf("provider type = %T, want *CodexCliProvider", unwrapRetry(provider))
 	}
 }
 
@@ -253,8 +439,8 @@ func TestCreateProviderReturnsCodexProviderForCodexCliAuthMethod(t *testing.T) {
 		t.Fatalf("CreateProvider() error = %v", err)
 	}
 
-	if _, ok := provider.(*CodexProvider); !ok {
-		t.Fatalf("provider type = %T, want *CodexProvider", provider)
+	if _, ok := unwrapRetry(provider).(*CodexProvider); !ok {
+		t.Fatalf("provider type = %T, want *CodexProvider", unwrapRetry(provider))
 	}
 }
 
@@ -281,9 +467,9 @@ func TestCreateProviderReturnsClaudeProviderForAnthropicOAuth(t *testing.T) {
 		t.Fatalf("CreateProvider() error = %v", err)
 	}
 
-	claudeProvider, ok := provider.(*ClaudeProvider)
+	claudeProvider, ok := unwrapRetry(provider).(*ClaudeProvider)
 	if !ok {
-		t.Fatalf("provider type = %T, want *ClaudeProvider", provider)
+		t.Fatalf("provider type = %T, want *ClaudeProvider", unwrapRetry(provider))
 	}
 	if got := claudeProvider.delegate.BaseURL(); got != "https://proxy.example.com" {
 		t.Fatalf("anthropic baseURL = %q, want %q", got, "https://proxy.example.com")
@@ -313,7 +499,7 @@ func TestCreateProviderReturnsCodexProviderForOpenAIOAuth(t *testing.T) {
 		t.Fatalf("CreateProvider() error = %v", err)
 	}
 
-	if _, ok := provider.(*CodexProvider); !ok {
-		t.Fatalf("provider type = %T, want *CodexProvider", provider)
+	if _, ok := unwrapRetry(provider).(*CodexProvider); !ok {
+		t.Fatalf("provider type = %T, want *CodexProvider", unwrapRetry(provider))
 	}
 }
@@ -41,6 +41,11 @@ func NewFallbackChain(cooldown *CooldownTracker) *FallbackChain {
 	return &FallbackChain{cooldown: cooldown}
 }
 
+// Health returns the state of the providers the chain has called.
+func (fc *FallbackChain) Health() []ProviderHealth {
+	return fc.cooldown.Health()
+}
+
 // ResolveCandidates parses model config into a deduplicated candidate list.
 func ResolveCandidates(cfg ModelConfig, defaultProvider string) []FallbackCandidate {
 	seen := make(map[string]bool)
@@ -81,6 +86,9 @@ func ResolveCandidates(cfg ModelConfig, defaultProvider string) []FallbackCandid
 //   - context.Canceled aborts immediately (user abort, no fallback).
 //   - Non-retriable errors (format) abort immediately.
 //   - Retriable errors trigger fallback to next candidate.
+//   - Content filter refusals, as errors or as a "content_filter" finish
+//     reason, fall back without a cooldown; the last candidate's filtered
+//     reply is returned as it is.
 //   - Success marks provider as good (resets cooldown).
 //   - If all fail, returns aggregate error with all attempts.
 func (fc *FallbackChain) Execute(
@@ -120,6 +128,16 @@ func (fc *FallbackChain) Execute(
 		resp, err := run(ctx, candidate.Provider, candidate.Model)
 		elapsed := time.Since(start)
 
+		if err == nil && resp != nil && resp.FinishReason == "content_filter" &&
+			len(resp.ToolCalls) == 0 && i < len(candidates)-1 {
+			err = &FailoverError{
+				Reason:   FailoverContentFilter,
+				Provider: candidate.Provider,
+				Model:    candidate.Model,
+				Wrapped:  fmt.Errorf("reply stopped by the content filter"),
+			}
+		}
+
 		if err == nil {
 			// Success.
 			fc.cooldown.MarkSuccess(candidate.Provider)
@@ -168,7 +186,11 @@ func (fc *FallbackChain) Execute(
 		}
 
 		// Retriable error: mark failure and continue to next candidate.
-		fc.cooldown.MarkFailure(candidate.Provider, failErr.Reason)
+		if failErr.Reason == FailoverContentFilter {
+			fc.cooldown.MarkRefusal(candidate.Provider)
+		} else {
+			fc.cooldown.MarkFailure(candidate.Provider, failErr.Reason)
+		}
 		result.Attempts = append(result.Attempts, FallbackAttempt{
 			Provider: candidate.Provider,
 			Model:    candidate.Model,
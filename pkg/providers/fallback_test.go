@@ -300,6 +300,43 @@ func TestFallback_SuccessResetsCooldown(t *testing.T) {
 
 // --- Image Fallback Tests ---
 
+func TestFallback_ContentFilterNoCooldown(t *testing.T) {
+	ct := NewCooldownTracker()
+	fc := NewFallbackChain(ct)
+
+	candidates := []FallbackCandidate{
+		makeCandidate("azure", "gpt-4o"),
+		makeCandidate("deepseek", "deepseek-chat"),
+	}
+
+	run := func(ctx context.Context, provider, model string) (*LLMResponse, error) {
+		if provider == "azure" {
+			return &LLMResponse{FinishReason: "content_filter"}, nil
+		}
+		return &LLMResponse{Content: "answer", FinishReason: "stop"}, nil
+	}
+
+	result, err := fc.Execute(context.Background(), candidates, run)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Provider != "deepseek" || result.Response.Content != "answer" {
+		t.Errorf("result = %s %q, want the deepseek answer", result.Provider, result.Response.Content)
+	}
+	if len(result.Attempts) != 1 || result.Attempts[0].Reason != FailoverContentFilter {
+		t.Errorf("attempts = %+v, want one content_filter attempt", result.Attempts)
+	}
+	if !ct.IsAvailable("azure") {
+		t.Error("a content filter refusal should not cool the provider down")
+	}
+
+	// The last candidate's filtered reply is returned rather than an error
+	result, err = fc.Execute(context.Background(), candidates[:1], run)
+	if err != nil || result.Response.FinishReason != "content_filter" {
+		t.Errorf("single candidate: result %+v, err %v", result, err)
+	}
+}
+
 func TestImageFallback_Success(t *testing.T) {
 	ct := NewCooldownTracker()
 	fc := NewFallbackChain(ct)
@@ -0,0 +1,201 @@
+package providers
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// maxImageDimension is the longest side sent to a model. Larger images
+	// cost more tokens without being read better: Claude scales them down
+	// to this size and OpenAI models to about the same.
+	maxImageDimension = 1568
+	// maxImageBytes keeps the base64-encoded image under the 5 MB per
+	// image that Claude accepts.
+	maxImageBytes = 3_750_000
+	// maxImageDownload bounds the size of an image fetched from a URL.
+	maxImageDownload = 20 << 20
+)
+
+// ErrNotImage is returned by LoadImage for files that are not images, such
+// as the voice messages and documents channels also attach.
+var ErrNotImage = errors.New("not an image")
+
+var imageHTTPClient = &http.Client{Timeout: 30 * time.Second}
+
+// LoadImage reads an image from a local path or an http(s) URL and prepares
+// it for a vision model. Images larger than maxImageDimension or
+// maxImageBytes are scaled down and sent as JPEG; others are sent as they
+// are.
+func LoadImage(ctx context.Context, source string) (ImageContent, error) {
+	data, err := readImageSource(ctx, source)
+	if err != nil {
+		return ImageContent{}, err
+	}
+	mimeType := http.DetectContentType(data)
+	if !strings.HasPrefix(mimeType, "image/") {
+		return ImageContent{}, ErrNotImage
+	}
+
+	switch mimeType {
+	case "image/jpeg", "image/png", "image/gif", "image/webp":
+	default:
+		return ImageContent{}, fmt.Errorf("unsupported image format %s", mimeType)
+	}
+
+	// WebP cannot be decoded here, so it is only sent when small enough
+	img, _, decodeErr := image.Decode(bytes.NewReader(data))
+	if decodeErr != nil {
+		if mimeType == "image/webp" && len(data) <= maxImageBytes {
+			return encodeImage(mimeType, data), nil
+		}
+		return ImageContent{}, fmt.Errorf("decoding %s: %w", mimeType, decodeErr)
+	}
+
+	bounds := img.Bounds()
+	if max(bounds.Dx(), bounds.Dy()) <= maxImageDimension && len(data) <= maxImageBytes {
+		return encodeImage(mimeType, data), nil
+	}
+
+	// Photos of lab reports are often 12 MP or more; the text stays
+	// legible at the scaled size
+	var buf bytes.Buffer
+	scaled := downscaleImage(img, maxImageDimension)
+	for _, quality := range []int{85, 70, 50} {
+		buf.Reset()
+		if err := jpeg.Encode(&buf, scaled, &jpeg.Options{Quality: quality}); err != nil {
+			return ImageContent{}, fmt.Errorf("encoding image: %w", err)
+		}
+		if buf.Len() <= maxImageBytes {
+			break
+		}
+	}
+	return encodeImage("image/jpeg", buf.Bytes()), nil
+}
+
+func readImageSource(ctx context.Context, source string) ([]byte, error) {
+	if !strings.HasPrefix(source, "http://") && !strings.HasPrefix(source, "https://") {
+		// Skip files that are plainly not images without reading them
+		switch strings.ToLower(filepath.Ext(source)) {
+		case ".ogg", ".oga", ".mp3", ".m4a", ".wav", ".mp4", ".pdf", ".txt", ".doc", ".docx":
+			return nil, ErrNotImage
+		}
+		return os.ReadFile(source)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, source, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := imageHTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching image: status %d", resp.StatusCode)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "" && !strings.HasPrefix(ct, "image/") &&
+		!strings.HasPrefix(ct, "application/octet-stream") {
+		return nil, ErrNotImage
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxImageDownload+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxImageDownload {
+		return nil, fmt.Errorf("image larger than %d MB", maxImageDownload>>20)
+	}
+	return data, nil
+}
+
+func encodeImage(mimeType string, data []byte) ImageContent {
+	return ImageContent{MimeType: mimeType, Data: base64.StdEncoding.EncodeToString(data)}
+}
+
+// downscaleImage scales img so its longest side is at most maxDim,
+// averaging the source pixels behind each result pixel. Transparent areas
+// become white, since the result is sent as JPEG.
+func downscaleImage(img image.Image, maxDim int) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	nw, nh := w, h
+	if w >= h && w > maxDim {
+		nw, nh = maxDim, max(1, h*maxDim/w)
+	} else if h > w && h > maxDim {
+		nw, nh = max(1, w*maxDim/h), maxDim
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, nw, nh))
+	for y := 0; y < nh; y++ {
+		y0 := b.Min.Y + y*h/nh
+		y1 := max(y0+1, b.Min.Y+(y+1)*h/nh)
+		for x := 0; x < nw; x++ {
+			x0 := b.Min.X + x*w/nw
+			x1 := max(x0+1, b.Min.X+(x+1)*w/nw)
+			var r, g, bl, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := img.At(sx, sy).RGBA()
+					r, g, bl, a = r+uint64(cr), g+uint64(cg), bl+uint64(cb), a+uint64(ca)
+					n++
+				}
+			}
+			// Colours are premultiplied, so adding the missing alpha
+			// composites onto white
+			white := (0xffff*n - a)
+			dst.SetRGBA(x, y, color.RGBA{
+				R: uint8((r + white) / n >> 8),
+				G: uint8((g + white) / n >> 8),
+				B: uint8((bl + white) / n >> 8),
+				A: 0xff,
+			})
+		}
+	}
+	return dst
+}
+
+// visionModelPatterns are parts of the names of models that accept images.
+var visionModelPatterns = []string{
+	"gpt-4o", "gpt-4.1", "gpt-4-turbo", "gpt-5", "chatgpt-4o",
+	"claude-3", "claude-opus-4", "claude-sonnet-4", "claude-haiku-4", "claude-4",
+	"gemini", "gemma3", "gemma-3",
+	"-vl", "qvq", "qwen-omni", "qwen3-omni",
+	"glm-4v", "glm-4.1v", "glm-4.5v", "glm-4.6v",
+	"vision", "llava", "minicpm-v", "moondream", "pixtral", "llama-4", "llama4", "internvl",
+}
+
+// SupportsVision reports whether model, judged by its name, accepts images.
+// Models it does not know can be used for images by setting them as the
+// image model.
+func SupportsVision(model string) bool {
+	name := strings.ToLower(model)
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name = name[i+1:]
+	}
+	for _, prefix := range []string{"o1", "o3", "o4"} {
+		if strings.HasPrefix(name, prefix) && !strings.HasPrefix(name, "o1-mini") && !strings.HasPrefix(name, "o3-mini") {
+			return true
+		}
+	}
+	for _, pattern := range visionModelPatterns {
+		if strings.Contains(name, pattern) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,107 @@
+package providers
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writePNG(t *testing.T, w, h int) string {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 0x80, A: 0xff})
+		}
+	}
+	path := filepath.Join(t.TempDir(), "report.png")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := png.Encode(f, img); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadImage_KeepsSmallImage(t *testing.T) {
+	path := writePNG(t, 200, 100)
+	img, err := LoadImage(context.Background(), path)
+	if err != nil {
+		t.Fatalf("LoadImage: %v", err)
+	}
+	want, _ := os.ReadFile(path)
+	if img.MimeType != "image/png" || img.Data != base64.StdEncoding.EncodeToString(want) {
+		t.Errorf("image = %s, %d bytes of base64", img.MimeType, len(img.Data))
+	}
+	if url := img.DataURL(); url[:22] != "data:image/png;base64," {
+		t.Errorf("DataURL() = %.30s", url)
+	}
+}
+
+func TestLoadImage_DownscalesLargeImage(t *testing.T) {
+	path := writePNG(t, 3000, 2000)
+	img, err := LoadImage(context.Background(), path)
+	if err != nil {
+		t.Fatalf("LoadImage: %v", err)
+	}
+	if img.MimeType != "image/jpeg" {
+		t.Fatalf("MimeType = %q, want image/jpeg", img.MimeType)
+	}
+	data, _ := base64.StdEncoding.DecodeString(img.Data)
+	cfg, err := jpeg.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("decoding result: %v", err)
+	}
+	if cfg.Width != maxImageDimension || cfg.Height != 2000*maxImageDimension/3000 {
+		t.Errorf("size = %dx%d", cfg.Width, cfg.Height)
+	}
+}
+
+func TestLoadImage_NotImage(t *testing.T) {
+	dir := t.TempDir()
+	voice := filepath.Join(dir, "voice.ogg")
+	text := filepath.Join(dir, "notes.jpg")
+	os.WriteFile(voice, []byte("OggS"), 0600)
+	os.WriteFile(text, []byte("not really a photo"), 0600)
+
+	for _, path := range []string{voice, text} {
+		if _, err := LoadImage(context.Background(), path); !errors.Is(err, ErrNotImage) {
+			t.Errorf("LoadImage(%s) error = %v, want ErrNotImage", filepath.Base(path), err)
+		}
+	}
+}
+
+func TestSupportsVision(t *testing.T) {
+	tests := []struct {
+		model string
+		want  bool
+	}{
+		{"gpt-4o", true},
+		{"openai/gpt-4o-mini", true},
+		{"claude-sonnet-4-20250514", true},
+		{"gemini-2.5-flash", true},
+		{"qwen-vl-max", true},
+		{"glm-4v-plus", true},
+		{"o3", true},
+		{"o3-mini", false},
+		{"deepseek-chat", false},
+		{"glm-4.6", false},
+		{"qwen-max", false},
+	}
+	for _, tt := range tests {
+		if got := SupportsVision(tt.model); got != tt.want {
+			t.Errorf("SupportsVision(%q) = %v, want %v", tt.model, got, tt.want)
+		}
+	}
+}
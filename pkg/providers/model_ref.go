@@ -45,6 +45,8 @@ func NormalizeProvider(provider string) string {
 		return "qwen-portal"
 	case "kimi-code":
 		return "kimi-coding"
+	case "kimi":
+		return "moonshot"
 	case "gpt":
 		return "openai"
 	case "claude":
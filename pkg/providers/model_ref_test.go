@@ -68,6 +68,7 @@ func TestNormalizeProvider(t *testing.T) {
 		{"opencode-zen", "opencode"},
 		{"qwen", "qwen-portal"},
 		{"kimi-code", "kimi-coding"},
+		{"kimi", "moonshot"},
 		{"gpt", "openai"},
 		{"claude", "anthropic"},
 		{"glm", "zhipu"},
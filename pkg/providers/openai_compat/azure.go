@@ -0,0 +1,174 @@
+package openai_compat
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultAzureAPIVersion is the Azure OpenAI API version used when none is
+// configured.
+const DefaultAzureAPIVersion = "2024-10-21"
+
+// azureScope is the Microsoft Entra ID (AAD) scope of Azure OpenAI.
+const azureScope = "https://cognitiveservices.azure.com/.default"
+
+// AzureOptions configures an Azure OpenAI provider.
+type AzureOptions struct {
+	// Endpoint is the resource endpoint, e.g.
+	// https://my-resource.openai.azure.com.
+	Endpoint   string
+	APIVersion string
+	// APIKey is sent as the api-key header. It is not used when
+	// TokenSource is set.
+	APIKey string
+	// Deployments maps model names to deployment names; models not in it
+	// are used as deployment names.
+	Deployments map[string]string
+	// TokenSource returns an Entra ID access token for each request.
+	TokenSource func(ctx context.Context) (string, error)
+	Proxy       string
+}
+
+// NewAzureProvider returns a provider for Azure OpenAI, which serves the
+// Chat Completions API per deployment and authenticates with an API key or
+// an Entra ID token.
+func NewAzureProvider(opts AzureOptions) *Provider {
+	endpoint := strings.TrimSuffix(strings.TrimRight(opts.Endpoint, "/"), "/openai")
+	version := opts.APIVersion
+	if version == "" {
+		version = DefaultAzureAPIVersion
+	}
+	p := &Provider{
+		apiKey:     opts.APIKey,
+		apiBase:    endpoint,
+		httpClient: newHTTPClient(opts.Proxy),
+	}
+	p.chatURL = func(model string) string {
+		deployment := model
+		if d, ok := opts.Deployments[model]; ok && d != "" {
+			deployment = d
+		}
+		return fmt.Sprintf("%s/openai/deployments/%s/chat/completions?api-version=%s",
+			endpoint, url.PathEscape(deployment), url.QueryEscape(version))
+	}
+	p.authorize = func(req *http.Request) error {
+		if opts.TokenSource == nil {
+			req.Header.Set("api-key", opts.APIKey)
+			return nil
+		}
+		token, err := opts.TokenSource(req.Context())
+		if err != nil {
+			return fmt.Errorf("azure: getting access token: %w", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		return nil
+	}
+	return p
+}
+
+// NewAzureClientSecretTokenSource returns a token source for an Entra ID
+// app registration (client credentials). Tokens are reused until shortly
+// before they expire.
+func NewAzureClientSecretTokenSource(tenantID, clientID, clientSecret, proxy string) func(ctx context.Context) (string, error) {
+	tokenURL := "https://login.microsoftonline.com/" + url.PathEscape(tenantID) + "/oauth2/v2.0/token"
+	return newAzureTokenCache(newHTTPClient(proxy), func(ctx context.Context) (*http.Request, error) {
+		form := url.Values{
+			"grant_type":    {"client_credentials"},
+			"client_id":     {clientID},
+			"client_secret": {clientSecret},
+			"scope":         {azureScope},
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURL, strings.NewReader(form.Encode()))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return req, nil
+	})
+}
+
+// NewAzureManagedIdentityTokenSource returns a token source for the managed
+// identity of the Azure VM or container the agent runs in. clientID picks a
+// user-assigned identity; empty uses the system-assigned one.
+func NewAzureManagedIdentityTokenSource(clientID string) func(ctx context.Context) (string, error) {
+	// The instance metadata service must be reached directly, never
+	// through a proxy
+	client := &http.Client{Timeout: 10 * time.Second, Transport: &http.Transport{}}
+	return newAzureTokenCache(client, func(ctx context.Context) (*http.Request, error) {
+		q := url.Values{
+			"api-version": {"2018-02-01"},
+			"resource":    {strings.TrimSuffix(azureScope, "/.default")},
+		}
+		if clientID != "" {
+			q.Set("client_id", clientID)
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://169.254.169.254/metadata/identity/oauth2/token?"+q.Encode(), nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Metadata", "true")
+		return req, nil
+	})
+}
+
+// newAzureTokenCache returns a token source that fetches tokens with the
+// requests newRequest builds and keeps each until a minute before expiry.
+func newAzureTokenCache(client *http.Client, newRequest func(ctx context.Context) (*http.Request, error)) func(ctx context.Context) (string, error) {
+	var (
+		mu      sync.Mutex
+		token   string
+		expires time.Time
+	)
+	return func(ctx context.Context) (string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if token != "" && time.Now().Before(expires) {
+			return token, nil
+		}
+
+		req, err := newRequest(ctx)
+		if err != nil {
+			return "", err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+		if err != nil {
+			return "", err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return "", fmt.Errorf("token request failed with status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+		}
+
+		// expires_in is a number from Entra ID and a string from the
+		// instance metadata service
+		var parsed struct {
+			AccessToken string          `json:"access_token"`
+			ExpiresIn   json.RawMessage `json:"expires_in"`
+		}
+		if err := json.Unmarshal(body, &parsed); err != nil {
+			return "", fmt.Errorf("invalid token response: %w", err)
+		}
+		if parsed.AccessToken == "" {
+			return "", fmt.Errorf("token response has no access_token")
+		}
+		seconds, _ := strconv.Atoi(strings.Trim(string(parsed.ExpiresIn), `"`))
+		if seconds <= 0 {
+			seconds = 300
+		}
+		token = parsed.AccessToken
+		expires = time.Now().Add(time.Duration(seconds)*time.Second - time.Minute)
+		return token, nil
+	}
+}
@@ -0,0 +1,101 @@
+package openai_compat
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAzureProvider_RoutesToDeployment(t *testing.T) {
+	var gotPath, gotVersion, gotKey, gotAuth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath, gotVersion = r.URL.Path, r.URL.Query().Get("api-version")
+		gotKey, gotAuth = r.Header.Get("api-key"), r.Header.Get("Authorization")
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices":[{"message":{"content":"ok"},"finish_reason":"stop"}]}`))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name        string
+		opts        AzureOptions
+		model       string
+		wantPath    string
+		wantVersion string
+		wantKey     string
+		wantAuth    string
+	}{
+		{
+			name:        "mapped deployment with api key",
+			opts:        AzureOptions{Endpoint: server.URL + "/", APIKey: "azure-key", Deployments: map[string]string{"gpt-4o": "prod-gpt4o"}},
+			model:       "azure/gpt-4o",
+			wantPath:    "/openai/deployments/prod-gpt4o/chat/completions",
+			wantVersion: DefaultAzureAPIVersion,
+			wantKey:     "azure-key",
+		},
+		{
+			name: "model as deployment with entra id token",
+			opts: AzureOptions{Endpoint: server.URL + "/openai", APIVersion: "2025-01-01-preview",
+				TokenSource: func(ctx context.Context) (string, error) { return "aad-token", nil }},
+			model:       "gpt-4o-mini",
+			wantPath:    "/openai/deployments/gpt-4o-mini/chat/completions",
+			wantVersion: "2025-01-01-preview",
+			wantAuth:    "Bearer aad-token",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := NewAzureProvider(tt.opts).Chat(t.Context(), []Message{{Role: "user", Content: "hi"}}, nil, tt.model, nil)
+			if err != nil {
+				t.Fatalf("Chat() error = %v", err)
+			}
+			if out.Content != "ok" {
+				t.Errorf("Content = %q", out.Content)
+			}
+			if gotPath != tt.wantPath || gotVersion != tt.wantVersion {
+				t.Errorf("request = %s?api-version=%s, want %s?api-version=%s", gotPath, gotVersion, tt.wantPath, tt.wantVersion)
+			}
+			if gotKey != tt.wantKey || gotAuth != tt.wantAuth {
+				t.Errorf("api-key = %q, Authorization = %q; want %q, %q", gotKey, gotAuth, tt.wantKey, tt.wantAuth)
+			}
+		})
+	}
+}
+
+func TestAzureTokenCache(t *testing.T) {
+	fetches := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		if r.Header.Get("Metadata") != "true" {
+			http.Error(w, "missing header", http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`{"access_token":"tok","expires_in":"3600"}`))
+	}))
+	defer server.Close()
+
+	source := newAzureTokenCache(server.Client(), func(ctx context.Context) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+		if err == nil {
+			req.Header.Set("Metadata", "true")
+		}
+		return req, err
+	})
+	for i := 0; i < 3; i++ {
+		token, err := source(t.Context())
+		if err != nil || token != "tok" {
+			t.Fatalf("token = %q, %v", token, err)
+		}
+	}
+	if fetches != 1 {
+		t.Errorf("fetched %d tokens, want 1 reused", fetches)
+	}
+
+	failing := newAzureTokenCache(server.Client(), func(ctx context.Context) (*http.Request, error) {
+		return http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	})
+	if _, err := failing(t.Context()); err == nil {
+		t.Error("want an error for a rejected token request")
+	}
+}
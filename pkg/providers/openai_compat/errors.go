@@ -0,0 +1,62 @@
+package openai_compat
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// APIError is an unsuccessful response from the API.
+type APIError struct {
+	StatusCode int
+	Body       string
+	// RetryAfter is how long the API asked to wait before trying again,
+	// or zero when it did not say.
+	RetryAfter time.Duration
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("API request failed:\n  Status: %d\n  Body:   %s", e.StatusCode, e.Body)
+}
+
+// contextExceeded reports whether the API refused the call because the
+// prompt and max_tokens do not fit the model's context, as Moonshot says
+// with "exceeded model token limit".
+func (e *APIError) contextExceeded() bool {
+	return e.StatusCode == http.StatusBadRequest && strings.Contains(strings.ToLower(e.Body), "exceeded model token limit")
+}
+
+func newAPIError(resp *http.Response, body []byte) *APIError {
+	return &APIError{
+		StatusCode: resp.StatusCode,
+		Body:       string(body),
+		RetryAfter: RetryAfter(resp.Header),
+	}
+}
+
+// RetryAfter reads how long a rate limited or overloaded API asks clients
+// to wait: retry-after-ms, which OpenAI sends, or Retry-After in seconds or
+// as a date. It returns zero when the headers say nothing usable.
+func RetryAfter(h http.Header) time.Duration {
+	if ms, err := strconv.ParseFloat(strings.TrimSpace(h.Get("Retry-After-Ms")), 64); err == nil && ms > 0 {
+		return time.Duration(ms * float64(time.Millisecond))
+	}
+	value := strings.TrimSpace(h.Get("Retry-After"))
+	if value == "" {
+		return 0
+	}
+	if secs, err := strconv.ParseFloat(value, 64); err == nil {
+		if secs <= 0 {
+			return 0
+		}
+		return time.Duration(secs * float64(time.Second))
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		if d := time.Until(at); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
@@ -22,14 +22,30 @@ type UsageInfo = protocoltypes.UsageInfo
 type Message = protocoltypes.Message
 type ToolDefinition = protocoltypes.ToolDefinition
 type ToolFunctionDefinition = protocoltypes.ToolFunctionDefinition
+type StreamChunk = protocoltypes.StreamChunk
+type ToolCallDelta = protocoltypes.ToolCallDelta
+type ImageContent = protocoltypes.ImageContent
 
 type Provider struct {
 	apiKey     string
 	apiBase    string
 	httpClient *http.Client
+	webSearch  bool
+	// chatURL and authorize replace the standard endpoint and bearer
+	// token for APIs that differ only in these, such as Azure OpenAI.
+	chatURL   func(model string) string
+	authorize func(req *http.Request) error
 }
 
 func NewProvider(apiKey, apiBase, proxy string) *Provider {
+	return &Provider{
+		apiKey:     apiKey,
+		apiBase:    strings.TrimRight(apiBase, "/"),
+		httpClient: newHTTPClient(proxy),
+	}
+}
+
+func newHTTPClient(proxy string) *http.Client {
 	client := &http.Client{
 		Timeout: 120 * time.Second,
 	}
@@ -44,29 +60,119 @@ func NewProvider(apiKey, apiBase, proxy string) *Provider {
 			log.Printf("openai_compat: invalid proxy URL %q: %v", proxy, err)
 		}
 	}
+	return client
+}
 
-	return &Provider{
-		apiKey:     apiKey,
-		apiBase:    strings.TrimRight(apiBase, "/"),
-		httpClient: client,
-	}
+// SetWebSearch turns on the web search the API runs itself, for APIs that
+// have one (Zhipu GLM).
+func (p *Provider) SetWebSearch(enabled bool) {
+	p.webSearch = enabled
 }
 
 func (p *Provider) Chat(ctx context.Context, messages []Message, tools []ToolDefinition, model string, options map[string]interface{}) (*LLMResponse, error) {
+	resp, err := p.send(ctx, messages, tools, model, options, false)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	return parseResponse(body)
+}
+
+// send makes the Chat Completions call and returns the successful
+// response. A prompt too long for a Moonshot model with a fixed context
+// size is sent again to the next larger size, as moonshot-v1-auto would.
+func (p *Provider) send(ctx context.Context, messages []Message, tools []ToolDefinition, model string, options map[string]interface{}, stream bool) (*http.Response, error) {
+	for {
+		req, err := p.newChatRequest(ctx, messages, tools, model, options, stream)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := p.httpClient.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("failed to send request: %w", err)
+		}
+		if resp.StatusCode == http.StatusOK {
+			return resp, nil
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		apiErr := newAPIError(resp, body)
+
+		larger := moonshotLargerModel(normalizeModel(model, p.apiBase))
+		if larger == "" || !isMoonshotAPI(p.apiBase) || !apiErr.contextExceeded() {
+			return nil, apiErr
+		}
+		log.Printf("openai_compat: prompt exceeds the context of %s, retrying with %s", model, larger)
+		model = larger
+	}
+}
+
+// newChatRequest builds the Chat Completions request, with the body
+// adjusted for the API's vendor. A streamed request also asks for usage,
+// which the API sends in a last chunk.
+func (p *Provider) newChatRequest(ctx context.Context, messages []Message, tools []ToolDefinition, model string, options map[string]interface{}, stream bool) (*http.Request, error) {
 	if p.apiBase == "" {
 		return nil, fmt.Errorf("API base not configured")
 	}
 
 	model = normalizeModel(model, p.apiBase)
 
+	dashScope := strings.Contains(strings.ToLower(p.apiBase), "dashscope")
+	zhipu := isZhipuAPI(p.apiBase)
+	moonshot := isMoonshotAPI(p.apiBase)
+	baichuan := isBaichuanAPI(p.apiBase)
+
 	requestBody := map[string]interface{}{
 		"model":    model,
-		"messages": messages,
+		"messages": toWireMessages(messages, zhipu, moonshot),
 	}
 
-	if len(tools) > 0 {
-		requestBody["tools"] = tools
+	if zhipu && p.webSearch {
+		// GLM's web search is a tool of its own type next to the functions
+		allTools := make([]interface{}, 0, len(tools)+1)
+		for _, t := range tools {
+			allTools = append(allTools, t)
+		}
+		allTools = append(allTools, map[string]interface{}{
+			"type":       "web_search",
+			"web_search": map[string]interface{}{"enable": true, "search_result": true},
+		})
+		requestBody["tools"] = allTools
 		requestBody["tool_choice"] = "auto"
+	} else if len(tools) > 0 {
+		requestBody["tools"] = tools
+		// Baichuan rejects tool_choice; it always lets the model choose
+		if !baichuan {
+			requestBody["tool_choice"] = "auto"
+		}
+		// DashScope makes one tool call per reply unless asked for more
+		if dashScope {
+			requestBody["parallel_tool_calls"] = true
+		}
+	}
+	// Qwen3 models on DashScope think by default, which the API only
+	// allows in streaming calls.
+	effort, budget := protocoltypes.Reasoning(options)
+	if dashScope && strings.Contains(strings.ToLower(model), "qwen3") {
+		requestBody["enable_thinking"] = false
+		if budget > 0 && stream {
+			requestBody["enable_thinking"] = true
+			requestBody["thinking_budget"] = budget
+		}
+	}
+	// o-series and GPT-5 models always reason; "off" asks for the least
+	if effort != "" && isReasoningModel(model) {
+		if effort == "off" {
+			effort = "low"
+		}
+		requestBody["reasoning_effort"] = effort
 	}
 
 	if maxTokens, ok := asInt(options["max_tokens"]); ok {
@@ -83,42 +189,140 @@ func (p *Provider) Chat(ctx context.Context, messages []Message, tools []ToolDef
 		// Kimi k2 models only support temperature=1.
 		if strings.Contains(lowerModel, "kimi") && strings.Contains(lowerModel, "k2") {
 			requestBody["temperature"] = 1.0
+		} else if (zhipu || moonshot || baichuan) && temperature > 1 {
+			// GLM, Moonshot and Baichuan accept temperatures up to 1 only
+			requestBody["temperature"] = 1.0
 		} else {
 			requestBody["temperature"] = temperature
 		}
 	}
+	// GLM takes top_p below 1 only; 1 is the default anyway
+	if topP, ok := asFloat(options["top_p"]); ok && !(zhipu && topP >= 1) {
+		requestBody["top_p"] = topP
+	}
+
+	// OpenAI caches prompt prefixes on its own; the key routes calls that
+	// share one, such as an agent's system prompt and tools, to the same
+	// cache. Other APIs may reject the field.
+	if key, ok := options["prompt_cache_key"].(string); ok && key != "" && isOpenAIAPI(p.apiBase) {
+		requestBody["prompt_cache_key"] = key
+	}
+
+	if stream {
+		requestBody["stream"] = true
+		requestBody["stream_options"] = map[string]interface{}{"include_usage": true}
+	}
 
 	jsonData, err := json.Marshal(requestBody)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	req, err := http.NewRequestWithContext(ctx, "POST", p.apiBase+"/chat/completions", bytes.NewReader(jsonData))
+	endpoint := p.apiBase + "/chat/completions"
+	if p.chatURL != nil {
+		endpoint = p.chatURL(model)
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewReader(jsonData))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	req.Header.Set("Content-Type", "application/json")
-	if p.apiKey != "" {
+	if p.authorize != nil {
+		if err := p.authorize(req); err != nil {
+			return nil, err
+		}
+	} else if p.apiKey != "" {
 		req.Header.Set("Authorization", "Bearer "+p.apiKey)
 	}
+	return req, nil
+}
 
-	resp, err := p.httpClient.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to send request: %w", err)
-	}
-	defer resp.Body.Close()
+// wireMessage is a chat message in the Chat Completions format, in which
+// an assistant turn's tool calls are function calls with JSON string
+// arguments. Content is a string, or a list of parts for a message with
+// images.
+type wireMessage struct {
+	Role       string         `json:"role"`
+	Content    interface{}    `json:"content"`
+	ToolCalls  []wireToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string         `json:"tool_call_id,omitempty"`
+	// Name is the function a tool result answers, which Moonshot needs
+	Name string `json:"name,omitempty"`
+}
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
-	}
+type wireToolCall struct {
+	ID       string       `json:"id"`
+	Type     string       `json:"type"`
+	Function FunctionCall `json:"function"`
+}
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("API request failed:\n  Status: %d\n  Body:   %s", resp.StatusCode, string(body))
+// toWireMessages converts messages to the Chat Completions format. The
+// leading system messages are sent as one, which every API accepts, with
+// the stable part first so it stays a cacheable prefix. Tool calls are
+// sent as native function calls; those recorded with only a name and
+// decoded arguments get their function call filled in from them. Images
+// are sent as data URLs, except to Zhipu, which takes bare base64. With
+// toolNames, a tool result is sent with the name of the function called.
+func toWireMessages(messages []Message, bareBase64, toolNames bool) []wireMessage {
+	var system []string
+	for len(messages) > 0 && messages[0].Role == "system" && len(messages[0].Images) == 0 {
+		system = append(system, messages[0].Content)
+		messages = messages[1:]
+	}
+	out := make([]wireMessage, 0, len(messages)+1)
+	if len(system) > 0 {
+		out = append(out, wireMessage{Role: "system", Content: strings.Join(system, "\n\n")})
+	}
+	calledNames := map[string]string{} // tool call ID: function name
+	for _, msg := range messages {
+		out = append(out, wireMessage{Role: msg.Role, Content: msg.Content, ToolCallID: msg.ToolCallID})
+		i := len(out) - 1
+		if toolNames && msg.Role == "tool" {
+			out[i].Name = calledNames[msg.ToolCallID]
+		}
+		if len(msg.Images) > 0 {
+			out[i].Content = imageParts(msg.Content, msg.Images, bareBase64)
+		}
+		for _, tc := range msg.ToolCalls {
+			call := wireToolCall{ID: tc.ID, Type: "function"}
+			if tc.Function != nil {
+				call.Function = *tc.Function
+			}
+			if call.Function.Name == "" {
+				call.Function.Name = tc.Name
+			}
+			if call.Function.Arguments == "" {
+				args := tc.Arguments
+				if args == nil {
+					args = map[string]interface{}{}
+				}
+				data, _ := json.Marshal(args)
+				call.Function.Arguments = string(data)
+			}
+			out[i].ToolCalls = append(out[i].ToolCalls, call)
+			calledNames[call.ID] = call.Function.Name
+		}
 	}
+	return out
+}
 
-	return parseResponse(body)
+func imageParts(text string, images []ImageContent, bareBase64 bool) []map[string]interface{} {
+	parts := make([]map[string]interface{}, 0, len(images)+1)
+	for _, img := range images {
+		url := img.DataURL()
+		if bareBase64 {
+			url = img.Data
+		}
+		parts = append(parts, map[string]interface{}{
+			"type":      "image_url",
+			"image_url": map[string]interface{}{"url": url},
+		})
+	}
+	if text != "" {
+		parts = append(parts, map[string]interface{}{"type": "text", "text": text})
+	}
+	return parts
 }
 
 func parseResponse(body []byte) (*LLMResponse, error) {
@@ -137,7 +341,9 @@ func parseResponse(body []byte) (*LLMResponse, error) {
 			} `json:"message"`
 			FinishReason string `json:"finish_reason"`
 		} `json:"choices"`
-		Usage *UsageInfo `json:"usage"`
+		Usage *wireUsage `json:"usage"`
+		// WebSearch lists the pages GLM's web search used
+		WebSearch []webSearchPage `json:"web_search"`
 	}
 
 	if err := json.Unmarshal(body, &apiResponse); err != nil {
@@ -155,7 +361,7 @@ func parseResponse(body []byte) (*LLMResponse, error) {
 	toolCalls := make([]ToolCall, 0, len(choice.Message.ToolCalls))
 	for _, tc := range choice.Message.ToolCalls {
 		arguments := make(map[string]interface{})
-		name := ""
+		name, argsErr := "", ""
 
 		if tc.Function != nil {
 			name = tc.Function.Name
@@ -163,25 +369,123 @@ func parseResponse(body []byte) (*LLMResponse, error) {
 				if err := json.Unmarshal([]byte(tc.Function.Arguments), &arguments); err != nil {
 					log.Printf("openai_compat: failed to decode tool call arguments for %q: %v", name, err)
 					arguments["raw"] = tc.Function.Arguments
+					argsErr = err.Error()
 				}
 			}
 		}
 
 		toolCalls = append(toolCalls, ToolCall{
-			ID:        tc.ID,
-			Name:      name,
-			Arguments: arguments,
+			ID:             tc.ID,
+			Name:           name,
+			Arguments:      arguments,
+			ArgumentsError: argsErr,
 		})
 	}
 
+	content := choice.Message.Content
+	if content != "" {
+		content += webSearchSources(apiResponse.WebSearch)
+	}
+
 	return &LLMResponse{
-		Content:      choice.Message.Content,
+		Content:      content,
 		ToolCalls:    toolCalls,
 		FinishReason: choice.FinishReason,
-		Usage:        apiResponse.Usage,
+		Usage:        apiResponse.Usage.toUsage(),
 	}, nil
 }
 
+// webSearchPage is a page GLM's web search used for a reply.
+type webSearchPage struct {
+	Title string `json:"title"`
+	Link  string `json:"link"`
+}
+
+// webSearchSources formats pages as a list of sources to append to the
+// reply, or returns "" when there are none.
+func webSearchSources(pages []webSearchPage) string {
+	var sources strings.Builder
+	for _, page := range pages {
+		if page.Link == "" {
+			continue
+		}
+		title := page.Title
+		if title == "" {
+			title = page.Link
+		}
+		fmt.Fprintf(&sources, "\n- [%s](%s)", title, page.Link)
+	}
+	if sources.Len() == 0 {
+		return ""
+	}
+	return "\n\nSources:" + sources.String()
+}
+
+// wireUsage is the usage of a call. Cached prompt tokens are reported in
+// prompt_tokens_details by OpenAI and DashScope, as
+// prompt_cache_hit_tokens by DeepSeek, and as cached_tokens by Moonshot.
+type wireUsage struct {
+	PromptTokens        int `json:"prompt_tokens"`
+	CompletionTokens    int `json:"completion_tokens"`
+	TotalTokens         int `json:"total_tokens"`
+	PromptTokensDetails *struct {
+		CachedTokens int `json:"cached_tokens"`
+	} `json:"prompt_tokens_details"`
+	PromptCacheHitTokens int `json:"prompt_cache_hit_tokens"`
+	CachedTokens         int `json:"cached_tokens"`
+}
+
+func (u *wireUsage) toUsage() *UsageInfo {
+	if u == nil {
+		return nil
+	}
+	usage := &UsageInfo{
+		PromptTokens:     u.PromptTokens,
+		CompletionTokens: u.CompletionTokens,
+		TotalTokens:      u.TotalTokens,
+		CachedTokens:     max(u.PromptCacheHitTokens, u.CachedTokens),
+	}
+	if u.PromptTokensDetails != nil && u.PromptTokensDetails.CachedTokens > usage.CachedTokens {
+		usage.CachedTokens = u.PromptTokensDetails.CachedTokens
+	}
+	return usage
+}
+
+// isOpenAIAPI reports whether apiBase is OpenAI's own API, which accepts
+// a prompt_cache_key.
+func isOpenAIAPI(apiBase string) bool {
+	return strings.Contains(strings.ToLower(apiBase), "api.openai.com")
+}
+
+// isZhipuAPI reports whether apiBase is Zhipu's API, on bigmodel.cn or z.ai.
+func isZhipuAPI(apiBase string) bool {
+	base := strings.ToLower(apiBase)
+	return strings.Contains(base, "bigmodel.cn") || strings.Contains(base, "api.z.ai")
+}
+
+// isMoonshotAPI reports whether apiBase is Moonshot's Kimi API, on
+// moonshot.cn or moonshot.ai.
+func isMoonshotAPI(apiBase string) bool {
+	base := strings.ToLower(apiBase)
+	return strings.Contains(base, "moonshot.cn") || strings.Contains(base, "moonshot.ai")
+}
+
+func isBaichuanAPI(apiBase string) bool {
+	return strings.Contains(strings.ToLower(apiBase), "baichuan-ai.com")
+}
+
+// moonshotLargerModel returns the moonshot-v1 model with the next larger
+// context than model, or "" when there is none.
+func moonshotLargerModel(model string) string {
+	m := strings.ToLower(model)
+	for _, sizes := range [][2]string{{"-8k", "-32k"}, {"-32k", "-128k"}} {
+		if strings.HasPrefix(m, "moonshot-v1"+sizes[0]) {
+			return "moonshot-v1" + sizes[1] + m[len("moonshot-v1"+sizes[0]):]
+		}
+	}
+	return ""
+}
+
 func normalizeModel(model, apiBase string) string {
 	idx := strings.Index(model, "/")
 	if idx == -1 {
@@ -194,7 +498,7 @@ func normalizeModel(model, apiBase string) string {
 
 	prefix := strings.ToLower(model[:idx])
 	switch prefix {
-	case "moonshot", "nvidia", "groq", "ollama", "deepseek", "google", "openrouter", "zhipu", "siliconflow", "silicon-flow":
+	case "moonshot", "kimi", "baichuan", "nvidia", "groq", "ollama", "llamacpp", "deepseek", "dashscope", "azure", "google", "openrouter", "zhipu", "siliconflow", "silicon-flow":
 		return model[idx+1:]
 	default:
 		return model
@@ -230,3 +534,18 @@ func asFloat(v interface{}) (float64, bool) {
 		return 0, false
 	}
 }
+
+// isReasoningModel reports whether model is an OpenAI model that takes
+// reasoning_effort.
+func isReasoningModel(model string) bool {
+	name := strings.ToLower(model)
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name = name[i+1:]
+	}
+	for _, prefix := range []string{"o1", "o3", "o4", "gpt-5"} {
+		if strings.HasPrefix(name, prefix) && name != "o1-mini" && !strings.HasPrefix(name, "gpt-5-chat") {
+			return true
+		}
+	}
+	return false
+}
@@ -5,7 +5,9 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestProviderChat_UsesMaxCompletionTokensForGLM(t *testing.T) {
@@ -278,3 +280,408 @@ func TestNormalizeModel_UsesAPIBase(t *testing.T) {
 		t.Fatalf("normalizeModel(siliconflow) = %q, want %q", got, "Pro/zai-org/GLM-4.7")
 	}
 }
+
+func TestProviderChat_SendsNativeToolCalls(t *testing.T) {
+	var requestBody struct {
+		Messages []map[string]interface{} `json:"messages"`
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&requestBody)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices":[{"message":{"content":"","tool_calls":[
+			{"id":"call_3","type":"function","function":{"name":"knows_search","arguments":"{\"query\":\"PERT\"}"}},
+			{"id":"call_4","type":"function","function":{"name":"evidence_answer","arguments":"{\"question\":\"PERT dose\"}"}}
+		]},"finish_reason":"tool_calls"}]}`))
+	}))
+	defer server.Close()
+
+	messages := []Message{
+		{Role: "user", Content: "Search both"},
+		{Role: "assistant", ToolCalls: []ToolCall{
+			{ID: "call_1", Type: "function", Function: &FunctionCall{Name: "kb_search", Arguments: `{"query":"PERT"}`}, Name: "kb_search"},
+			{ID: "call_2", Name: "search_documents", Arguments: map[string]interface{}{"query": "PERT"}},
+		}},
+		{Role: "tool", Content: "a", ToolCallID: "call_1"},
+		{Role: "tool", Content: "b", ToolCallID: "call_2"},
+	}
+	out, err := NewProvider("key", server.URL, "").Chat(t.Context(), messages, nil, "gpt-4o", nil)
+	if err != nil {
+		t.Fatalf("Chat() error = %v", err)
+	}
+
+	sent, _ := json.Marshal(requestBody.Messages[1]["tool_calls"])
+	want := `[{"function":{"arguments":"{\"query\":\"PERT\"}","name":"kb_search"},"id":"call_1","type":"function"},` +
+		`{"function":{"arguments":"{\"query\":\"PERT\"}","name":"search_documents"},"id":"call_2","type":"function"}]`
+	if string(sent) != want {
+		t.Errorf("tool_calls sent = %s\nwant %s", sent, want)
+	}
+	if requestBody.Messages[3]["tool_call_id"] != "call_2" {
+		t.Errorf("tool result = %v", requestBody.Messages[3])
+	}
+	if len(out.ToolCalls) != 2 || out.ToolCalls[0].Name != "knows_search" || out.ToolCalls[1].Arguments["question"] != "PERT dose" {
+		t.Errorf("tool calls = %+v", out.ToolCalls)
+	}
+}
+
+func TestProviderChat_ParsesCachedTokens(t *testing.T) {
+	tests := []struct {
+		name  string
+		usage string
+		want  UsageInfo
+	}{
+		{
+			name:  "deepseek cache hits",
+			usage: `{"prompt_tokens":100,"completion_tokens":20,"total_tokens":120,"prompt_cache_hit_tokens":64,"prompt_cache_miss_tokens":36}`,
+			want:  UsageInfo{PromptTokens: 100, CompletionTokens: 20, TotalTokens: 120, CachedTokens: 64},
+		},
+		{
+			name:  "dashscope prompt token details",
+			usage: `{"prompt_tokens":100,"completion_tokens":20,"total_tokens":120,"prompt_tokens_details":{"cached_tokens":80}}`,
+			want:  UsageInfo{PromptTokens: 100, CompletionTokens: 20, TotalTokens: 120, CachedTokens: 80},
+		},
+		{
+			name:  "moonshot cached tokens",
+			usage: `{"prompt_tokens":100,"completion_tokens":20,"total_tokens":120,"cached_tokens":90}`,
+			want:  UsageInfo{PromptTokens: 100, CompletionTokens: 20, TotalTokens: 120, CachedTokens: 90},
+		},
+		{
+			name:  "no cache",
+			usage: `{"prompt_tokens":100,"completion_tokens":20,"total_tokens":120}`,
+			want:  UsageInfo{PromptTokens: 100, CompletionTokens: 20, TotalTokens: 120},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := parseResponse([]byte(`{"choices":[{"message":{"content":"ok"},"finish_reason":"stop"}],"usage":` + tt.usage + `}`))
+			if err != nil {
+				t.Fatalf("parseResponse() error = %v", err)
+			}
+			if out.Usage == nil || *out.Usage != tt.want {
+				t.Errorf("Usage = %+v, want %+v", out.Usage, tt.want)
+			}
+		})
+	}
+}
+
+func TestProviderChat_DashScopeOptions(t *testing.T) {
+	var requestBody map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&requestBody)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices":[{"message":{"content":"ok"},"finish_reason":"stop"}]}`))
+	}))
+	defer server.Close()
+
+	tools := []ToolDefinition{{Type: "function", Function: ToolFunctionDefinition{Name: "kb_search"}}}
+	p := NewProvider("key", server.URL+"/dashscope/compatible-mode/v1", "")
+	if _, err := p.Chat(t.Context(), []Message{{Role: "user", Content: "hi"}}, tools, "dashscope/qwen3-32b", nil); err != nil {
+		t.Fatalf("Chat() error = %v", err)
+	}
+	if requestBody["model"] != "qwen3-32b" {
+		t.Errorf("model = %v, want qwen3-32b", requestBody["model"])
+	}
+	if requestBody["parallel_tool_calls"] != true {
+		t.Errorf("parallel_tool_calls = %v, want true", requestBody["parallel_tool_calls"])
+	}
+	if requestBody["enable_thinking"] != false {
+		t.Errorf("enable_thinking = %v, want false", requestBody["enable_thinking"])
+	}
+
+	requestBody = nil
+	p = NewProvider("key", server.URL, "")
+	if _, err := p.Chat(t.Context(), []Message{{Role: "user", Content: "hi"}}, tools, "gpt-4o", nil); err != nil {
+		t.Fatalf("Chat() error = %v", err)
+	}
+	if _, ok := requestBody["parallel_tool_calls"]; ok {
+		t.Errorf("parallel_tool_calls sent to a non-DashScope API")
+	}
+}
+
+func TestProviderChat_MoonshotAndBaichuanOptions(t *testing.T) {
+	var requestBody map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&requestBody)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices":[{"message":{"content":"ok"},"finish_reason":"stop"}]}`))
+	}))
+	defer server.Close()
+
+	tools := []ToolDefinition{{Type: "function", Function: ToolFunctionDefinition{Name: "kb_search"}}}
+	messages := []Message{
+		{Role: "user", Content: "What is CA19-9?"},
+		{Role: "assistant", ToolCalls: []ToolCall{{ID: "kb_search:0", Name: "kb_search", Arguments: map[string]interface{}{"query": "CA19-9"}}}},
+		{Role: "tool", ToolCallID: "kb_search:0", Content: "CA19-9 is a tumour marker."},
+	}
+	options := map[string]interface{}{"temperature": 1.3}
+
+	tests := []struct {
+		name         string
+		apiBase      string
+		model        string
+		wantModel    string
+		wantToolName interface{}
+		wantChoice   interface{}
+	}{
+		{"moonshot", server.URL + "/api.moonshot.cn/v1", "moonshot/moonshot-v1-32k", "moonshot-v1-32k", "kb_search", "auto"},
+		{"baichuan", server.URL + "/api.baichuan-ai.com/v1", "baichuan/Baichuan4-Turbo", "Baichuan4-Turbo", nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requestBody = nil
+			p := NewProvider("key", tt.apiBase, "")
+			if _, err := p.Chat(t.Context(), messages, tools, tt.model, options); err != nil {
+				t.Fatalf("Chat() error = %v", err)
+			}
+			if requestBody["model"] != tt.wantModel {
+				t.Errorf("model = %v, want %v", requestBody["model"], tt.wantModel)
+			}
+			if requestBody["temperature"] != 1.0 {
+				t.Errorf("temperature = %v, want 1.0", requestBody["temperature"])
+			}
+			if requestBody["tool_choice"] != tt.wantChoice {
+				t.Errorf("tool_choice = %v, want %v", requestBody["tool_choice"], tt.wantChoice)
+			}
+			sent := requestBody["messages"].([]interface{})
+			if name := sent[2].(map[string]interface{})["name"]; name != tt.wantToolName {
+				t.Errorf("tool result name = %v, want %v", name, tt.wantToolName)
+			}
+		})
+	}
+}
+
+func TestProviderChat_MoonshotContextOverflowMovesToLargerModel(t *testing.T) {
+	var models []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		model, _ := body["model"].(string)
+		models = append(models, model)
+		if model != "moonshot-v1-128k" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":{"message":"Invalid request: Your request exceeded model token limit: 8192","type":"invalid_request_error"}}`))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices":[{"message":{"content":"ok"},"finish_reason":"stop"}]}`))
+	}))
+	defer server.Close()
+
+	p := NewProvider("key", server.URL+"/api.moonshot.cn/v1", "")
+	out, err := p.Chat(t.Context(), []Message{{Role: "user", Content: "long guideline"}}, nil, "moonshot-v1-8k", nil)
+	if err != nil {
+		t.Fatalf("Chat() error = %v", err)
+	}
+	if out.Content != "ok" {
+		t.Errorf("Content = %q, want ok", out.Content)
+	}
+	if want := []string{"moonshot-v1-8k", "moonshot-v1-32k", "moonshot-v1-128k"}; strings.Join(models, ",") != strings.Join(want, ",") {
+		t.Errorf("models = %v, want %v", models, want)
+	}
+
+	// Other APIs get the error back
+	models = nil
+	p = NewProvider("key", server.URL, "")
+	if _, err := p.Chat(t.Context(), []Message{{Role: "user", Content: "long guideline"}}, nil, "moonshot-v1-8k", nil); err == nil {
+		t.Error("Chat() succeeded on a non-Moonshot API")
+	}
+	if len(models) != 1 {
+		t.Errorf("sent %d requests, want 1", len(models))
+	}
+}
+
+func TestNewChatRequest_Reasoning(t *testing.T) {
+	tests := []struct {
+		name    string
+		apiBase string
+		model   string
+		options map[string]interface{}
+		stream  bool
+		want    map[string]interface{}
+		notWant []string
+	}{
+		{"o-series", "https://api.openai.com/v1", "o3-mini", map[string]interface{}{"reasoning_effort": "high"}, false,
+			map[string]interface{}{"reasoning_effort": "high"}, nil},
+		{"off is the least", "https://openrouter.ai/api/v1", "openai/gpt-5-mini", map[string]interface{}{"reasoning_effort": "off"}, false,
+			map[string]interface{}{"reasoning_effort": "low"}, nil},
+		{"model without reasoning", "https://api.openai.com/v1", "gpt-4o", map[string]interface{}{"reasoning_effort": "high"}, false,
+			nil, []string{"reasoning_effort"}},
+		{"qwen streaming", "https://dashscope.aliyuncs.com/compatible-mode/v1", "qwen3-235b-a22b", map[string]interface{}{"reasoning_effort": "medium"}, true,
+			map[string]interface{}{"enable_thinking": true, "thinking_budget": float64(8192)}, []string{"reasoning_effort"}},
+		{"qwen budget", "https://dashscope.aliyuncs.com/compatible-mode/v1", "qwen3-235b-a22b", map[string]interface{}{"reasoning_effort": "low", "thinking_budget": 4000}, true,
+			map[string]interface{}{"enable_thinking": true, "thinking_budget": float64(4000)}, nil},
+		{"qwen without streaming", "https://dashscope.aliyuncs.com/compatible-mode/v1", "qwen3-235b-a22b", map[string]interface{}{"reasoning_effort": "high"}, false,
+			map[string]interface{}{"enable_thinking": false}, []string{"thinking_budget"}},
+		{"qwen off", "https://dashscope.aliyuncs.com/compatible-mode/v1", "qwen3-235b-a22b", map[string]interface{}{"reasoning_effort": "off"}, true,
+			map[string]interface{}{"enable_thinking": false}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewProvider("key", tt.apiBase, "")
+			req, err := p.newChatRequest(t.Context(), []Message{{Role: "user", Content: "hi"}}, nil, tt.model, tt.options, tt.stream)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var body map[string]interface{}
+			json.NewDecoder(req.Body).Decode(&body)
+			for k, v := range tt.want {
+				if body[k] != v {
+					t.Errorf("%s = %v, want %v", k, body[k], v)
+				}
+			}
+			for _, k := range tt.notWant {
+				if _, ok := body[k]; ok {
+					t.Errorf("%s sent: %v", k, body[k])
+				}
+			}
+		})
+	}
+}
+
+func TestProviderChat_ZhipuWebSearch(t *testing.T) {
+	var requestBody map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestBody = nil
+		json.NewDecoder(r.Body).Decode(&requestBody)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices":[{"message":{"content":"NCCN updated its guideline [ref_1]."},"finish_reason":"stop"}],
+			"web_search":[{"title":"NCCN Pancreatic","link":"https://www.nccn.org/pancreatic"},{"title":"no link"}]}`))
+	}))
+	defer server.Close()
+
+	tools := []ToolDefinition{{Type: "function", Function: ToolFunctionDefinition{Name: "kb_search"}}}
+	p := NewProvider("key", server.URL+"/open.bigmodel.cn/api/paas/v4", "")
+	p.SetWebSearch(true)
+	out, err := p.Chat(t.Context(), []Message{{Role: "user", Content: "news?"}}, tools, "glm-4.7", map[string]interface{}{"temperature": 1.5})
+	if err != nil {
+		t.Fatalf("Chat() error = %v", err)
+	}
+
+	sent, _ := requestBody["tools"].([]interface{})
+	if len(sent) != 2 {
+		t.Fatalf("tools sent = %v, want the function and web_search", requestBody["tools"])
+	}
+	if last, _ := sent[1].(map[string]interface{}); last["type"] != "web_search" {
+		t.Errorf("last tool = %v, want web_search", sent[1])
+	}
+	if requestBody["temperature"] != 1.0 {
+		t.Errorf("temperature = %v, want 1", requestBody["temperature"])
+	}
+	want := "NCCN updated its guideline [ref_1].\n\nSources:\n- [NCCN Pancreatic](https://www.nccn.org/pancreatic)"
+	if out.Content != want {
+		t.Errorf("Content = %q, want %q", out.Content, want)
+	}
+
+	// Without web search, GLM gets the function tools only
+	p.SetWebSearch(false)
+	if _, err := p.Chat(t.Context(), []Message{{Role: "user", Content: "hi"}}, tools, "glm-4.7", nil); err != nil {
+		t.Fatalf("Chat() error = %v", err)
+	}
+	if sent, _ := requestBody["tools"].([]interface{}); len(sent) != 1 {
+		t.Errorf("tools sent = %v, want the function only", requestBody["tools"])
+	}
+}
+
+func TestProviderChat_SendsImages(t *testing.T) {
+	image := ImageContent{MimeType: "image/png", Data: "iVBORw0KGgo="}
+	tests := []struct {
+		name    string
+		path    string
+		wantURL string
+	}{
+		{"openai", "/v1", "data:image/png;base64,iVBORw0KGgo="},
+		{"zhipu", "/open.bigmodel.cn/api/paas/v4", "iVBORw0KGgo="},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requestBody struct {
+				Messages []struct {
+					Content []map[string]interface{} `json:"content"`
+				} `json:"messages"`
+			}
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				json.NewDecoder(r.Body).Decode(&requestBody)
+				json.NewEncoder(w).Encode(map[string]interface{}{
+					"choices": []map[string]interface{}{{"message": map[string]interface{}{"content": "ok"}, "finish_reason": "stop"}},
+				})
+			}))
+			defer server.Close()
+
+			p := NewProvider("key", server.URL+tt.path, "")
+			_, err := p.Chat(t.Context(), []Message{{Role: "user", Content: "What is my ALT?", Images: []ImageContent{image}}}, nil, "vision-model", nil)
+			if err != nil {
+				t.Fatalf("Chat() error = %v", err)
+			}
+			if len(requestBody.Messages) != 1 || len(requestBody.Messages[0].Content) != 2 {
+				t.Fatalf("messages = %+v", requestBody.Messages)
+			}
+			parts := requestBody.Messages[0].Content
+			url := parts[0]["image_url"].(map[string]interface{})["url"]
+			if parts[0]["type"] != "image_url" || url != tt.wantURL || parts[1]["text"] != "What is my ALT?" {
+				t.Errorf("content = %+v", parts)
+			}
+		})
+	}
+}
+
+func TestProviderChat_PromptCaching(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    string
+		wantKey interface{}
+	}{
+		{"openai", "/api.openai.com/v1", "picoclaw-main"},
+		{"other", "/api.deepseek.com/v1", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requestBody map[string]interface{}
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				json.NewDecoder(r.Body).Decode(&requestBody)
+				json.NewEncoder(w).Encode(map[string]interface{}{
+					"choices": []map[string]interface{}{{"message": map[string]interface{}{"content": "ok"}, "finish_reason": "stop"}},
+				})
+			}))
+			defer server.Close()
+
+			p := NewProvider("key", server.URL+tt.path, "")
+			_, err := p.Chat(t.Context(), []Message{
+				{Role: "system", Content: "You are picoclaw."},
+				{Role: "system", Content: "## Current Time\n2026-10-18 09:30 (Sunday)"},
+				{Role: "user", Content: "Hi"},
+			}, nil, "gpt-4o", map[string]interface{}{"prompt_cache_key": "picoclaw-main"})
+			if err != nil {
+				t.Fatalf("Chat() error = %v", err)
+			}
+			if requestBody["prompt_cache_key"] != tt.wantKey {
+				t.Errorf("prompt_cache_key = %v, want %v", requestBody["prompt_cache_key"], tt.wantKey)
+			}
+			messages, _ := requestBody["messages"].([]interface{})
+			if len(messages) != 2 {
+				t.Fatalf("messages = %v", messages)
+			}
+			system := messages[0].(map[string]interface{})
+			if system["role"] != "system" || system["content"] != "You are picoclaw.\n\n## Current Time\n2026-10-18 09:30 (Sunday)" {
+				t.Errorf("system message = %v", system)
+			}
+		})
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		name   string
+		header http.Header
+		want   time.Duration
+	}{
+		{"seconds", http.Header{"Retry-After": {"7"}}, 7 * time.Second},
+		{"milliseconds win", http.Header{"Retry-After": {"7"}, "Retry-After-Ms": {"1500"}}, 1500 * time.Millisecond},
+		{"date in the past", http.Header{"Retry-After": {"Wed, 21 Oct 2015 07:28:00 GMT"}}, 0},
+		{"garbage", http.Header{"Retry-After": {"soon"}}, 0},
+		{"missing", http.Header{}, 0},
+	}
+	for _, tt := range tests {
+		if got := RetryAfter(tt.header); got != tt.want {
+			t.Errorf("%s: RetryAfter = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
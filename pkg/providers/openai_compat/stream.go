@@ -0,0 +1,160 @@
+package openai_compat
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+)
+
+// ChatStream is Chat with the reply streamed: onChunk receives text and
+// tool call deltas as the API sends them, then the finish reason and
+// usage. The returned response is the whole reply, as Chat returns it.
+func (p *Provider) ChatStream(ctx context.Context, messages []Message, tools []ToolDefinition, model string, options map[string]interface{}, onChunk func(StreamChunk)) (*LLMResponse, error) {
+	resp, err := p.send(ctx, messages, tools, model, options, true)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return readStream(resp.Body, onChunk)
+}
+
+// streamEvent is one server-sent event of a streamed reply.
+type streamEvent struct {
+	Choices []struct {
+		Delta struct {
+			Content   string `json:"content"`
+			ToolCalls []struct {
+				Index    int    `json:"index"`
+				ID       string `json:"id"`
+				Function struct {
+					Name      string `json:"name"`
+					Arguments string `json:"arguments"`
+				} `json:"function"`
+			} `json:"tool_calls"`
+		} `json:"delta"`
+		FinishReason string `json:"finish_reason"`
+	} `json:"choices"`
+	Usage     *wireUsage      `json:"usage"`
+	WebSearch []webSearchPage `json:"web_search"`
+	Error     *struct {
+		Message string      `json:"message"`
+		Code    interface{} `json:"code"`
+	} `json:"error"`
+}
+
+// readStream reads server-sent events until [DONE] or the end of the body,
+// passing each delta to onChunk and collecting the reply.
+func readStream(body io.Reader, onChunk func(StreamChunk)) (*LLMResponse, error) {
+	emit := func(chunk StreamChunk) {
+		if onChunk != nil {
+			onChunk(chunk)
+		}
+	}
+
+	var (
+		content   strings.Builder
+		calls     []*ToolCall
+		args      []string
+		finish    string
+		usage     *UsageInfo
+		webSearch []webSearchPage
+	)
+
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if !bytes.HasPrefix(line, []byte("data:")) {
+			continue
+		}
+		data := bytes.TrimSpace(line[len("data:"):])
+		if string(data) == "[DONE]" {
+			break
+		}
+
+		var event streamEvent
+		if err := json.Unmarshal(data, &event); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal stream event: %w", err)
+		}
+		if event.Error != nil {
+			return nil, fmt.Errorf("API stream error: %s (code %v)", event.Error.Message, event.Error.Code)
+		}
+		if event.Usage != nil {
+			usage = event.Usage.toUsage()
+		}
+		if len(event.WebSearch) > 0 {
+			webSearch = event.WebSearch
+		}
+		if len(event.Choices) == 0 {
+			continue
+		}
+
+		choice := event.Choices[0]
+		if text := choice.Delta.Content; text != "" {
+			content.WriteString(text)
+			emit(StreamChunk{Delta: text})
+		}
+		for _, tc := range choice.Delta.ToolCalls {
+			for len(calls) <= tc.Index {
+				calls = append(calls, &ToolCall{})
+				args = append(args, "")
+			}
+			call := calls[tc.Index]
+			if tc.ID != "" {
+				call.ID = tc.ID
+			}
+			if tc.Function.Name != "" {
+				call.Name = tc.Function.Name
+			}
+			args[tc.Index] += tc.Function.Arguments
+			emit(StreamChunk{ToolCallDelta: &ToolCallDelta{
+				Index:     tc.Index,
+				ID:        tc.ID,
+				Name:      tc.Function.Name,
+				Arguments: tc.Function.Arguments,
+			}})
+		}
+		if choice.FinishReason != "" {
+			finish = choice.FinishReason
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read stream: %w", err)
+	}
+
+	if content.Len() > 0 {
+		if sources := webSearchSources(webSearch); sources != "" {
+			content.WriteString(sources)
+			emit(StreamChunk{Delta: sources})
+		}
+	}
+	if finish == "" {
+		finish = "stop"
+	}
+	emit(StreamChunk{FinishReason: finish, Usage: usage})
+
+	toolCalls := make([]ToolCall, 0, len(calls))
+	for i, call := range calls {
+		call.Arguments = map[string]interface{}{}
+		if raw := args[i]; raw != "" {
+			if err := json.Unmarshal([]byte(raw), &call.Arguments); err != nil {
+				log.Printf("openai_compat: failed to decode tool call arguments for %q: %v", call.Name, err)
+				call.Arguments["raw"] = raw
+				call.ArgumentsError = err.Error()
+			}
+		}
+		toolCalls = append(toolCalls, *call)
+	}
+
+	return &LLMResponse{
+		Content:      content.String(),
+		ToolCalls:    toolCalls,
+		FinishReason: finish,
+		Usage:        usage,
+	}, nil
+}
@@ -0,0 +1,98 @@
+package openai_compat
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestProviderChatStream(t *testing.T) {
+	var requestBody map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&requestBody)
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte(`: keep-alive
+
+data: {"choices":[{"delta":{"role":"assistant","content":"Checking "}}]}
+
+data: {"choices":[{"delta":{"content":"the guideline."}}]}
+
+data: {"choices":[{"delta":{"tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"kb_search","arguments":""}}]}}]}
+
+data: {"choices":[{"delta":{"tool_calls":[{"index":0,"function":{"arguments":"{\"query\":"}}]}}]}
+
+data: {"choices":[{"delta":{"tool_calls":[{"index":0,"function":{"arguments":"\"dose\"}"}}]}}]}
+
+data: {"choices":[{"delta":{},"finish_reason":"tool_calls"}]}
+
+data: {"choices":[],"usage":{"prompt_tokens":50,"completion_tokens":12,"total_tokens":62,"prompt_tokens_details":{"cached_tokens":32}}}
+
+data: [DONE]
+
+`))
+	}))
+	defer server.Close()
+
+	p := NewProvider("key", server.URL, "")
+	var chunks []StreamChunk
+	resp, err := p.ChatStream(context.Background(), []Message{{Role: "user", Content: "Dose?"}}, nil, "gpt-4o", nil,
+		func(chunk StreamChunk) { chunks = append(chunks, chunk) })
+	if err != nil {
+		t.Fatalf("ChatStream() error = %v", err)
+	}
+
+	if requestBody["stream"] != true || requestBody["stream_options"] == nil {
+		t.Errorf("request = %v, want stream with usage", requestBody)
+	}
+	if resp.Content != "Checking the guideline." || resp.FinishReason != "tool_calls" {
+		t.Errorf("resp = %+v", resp)
+	}
+	if len(resp.ToolCalls) != 1 || resp.ToolCalls[0].ID != "call_1" || resp.ToolCalls[0].Name != "kb_search" ||
+		!reflect.DeepEqual(resp.ToolCalls[0].Arguments, map[string]interface{}{"query": "dose"}) {
+		t.Errorf("tool calls = %+v", resp.ToolCalls)
+	}
+	if resp.Usage == nil || resp.Usage.TotalTokens != 62 || resp.Usage.CachedTokens != 32 {
+		t.Errorf("usage = %+v", resp.Usage)
+	}
+
+	if len(chunks) != 6 {
+		t.Fatalf("got %d chunks, want 6: %+v", len(chunks), chunks)
+	}
+	if chunks[0].Delta != "Checking " || chunks[1].Delta != "the guideline." {
+		t.Errorf("text chunks = %+v %+v", chunks[0], chunks[1])
+	}
+	if d := chunks[2].ToolCallDelta; d == nil || d.Name != "kb_search" || d.ID != "call_1" {
+		t.Errorf("first tool delta = %+v", d)
+	}
+	if d := chunks[4].ToolCallDelta; d == nil || d.Index != 0 || d.Arguments != `"dose"}` {
+		t.Errorf("last tool delta = %+v", d)
+	}
+	if last := chunks[5]; last.FinishReason != "tool_calls" || last.Usage == nil {
+		t.Errorf("last chunk = %+v", last)
+	}
+}
+
+func TestProviderChatStream_Errors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("fail") == "status" {
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte(`{"error":{"message":"rate limit exceeded"}}`))
+			return
+		}
+		w.Write([]byte("data: {\"error\":{\"message\":\"overloaded\",\"code\":529}}\n\n"))
+	}))
+	defer server.Close()
+
+	p := NewProvider("key", server.URL, "")
+	p.chatURL = func(string) string { return server.URL + "/chat/completions?fail=status" }
+	if _, err := p.ChatStream(context.Background(), nil, nil, "m", nil, nil); err == nil {
+		t.Error("ChatStream() with status 429 succeeded")
+	}
+	p.chatURL = nil
+	if _, err := p.ChatStream(context.Background(), nil, nil, "m", nil, nil); err == nil {
+		t.Error("ChatStream() with an error event succeeded")
+	}
+}
@@ -6,6 +6,9 @@ type ToolCall struct {
 	Function  *FunctionCall          `json:"function,omitempty"`
 	Name      string                 `json:"name,omitempty"`
 	Arguments map[string]interface{} `json:"arguments,omitempty"`
+	// ArgumentsError is why the arguments the model sent could not be
+	// decoded; Arguments then holds them as "raw".
+	ArgumentsError string `json:"-"`
 }
 
 type FunctionCall struct {
@@ -18,12 +21,49 @@ type LLMResponse struct {
 	ToolCalls    []ToolCall `json:"tool_calls,omitempty"`
 	FinishReason string     `json:"finish_reason"`
 	Usage        *UsageInfo `json:"usage,omitempty"`
+	// Thinking is the reasoning of a Claude reply made with extended
+	// thinking, which must go back with its tool calls.
+	Thinking []ThinkingBlock `json:"thinking,omitempty"`
+}
+
+// ThinkingBlock is a block of a model's reasoning, signed by the provider
+// so it can be sent back unaltered. Redacted blocks carry only Data.
+type ThinkingBlock struct {
+	Thinking  string `json:"thinking,omitempty"`
+	Signature string `json:"signature,omitempty"`
+	Data      string `json:"data,omitempty"`
+}
+
+// Thinking budgets of the reasoning efforts, in tokens.
+var thinkingBudgets = map[string]int{"low": 2048, "medium": 8192, "high": 24576}
+
+// Reasoning returns the reasoning effort asked for in options, "" when
+// none was, and the tokens the model may spend thinking at it:
+// thinking_budget when set, else the effort's budget. An effort of "off"
+// has no budget.
+func Reasoning(options map[string]interface{}) (effort string, budget int) {
+	effort, _ = options["reasoning_effort"].(string)
+	if effort == "" || effort == "off" {
+		return effort, 0
+	}
+	if b, ok := options["thinking_budget"].(int); ok && b > 0 {
+		return effort, b
+	}
+	return effort, thinkingBudgets[effort]
 }
 
 type UsageInfo struct {
 	PromptTokens     int `json:"prompt_tokens"`
 	CompletionTokens int `json:"completion_tokens"`
 	TotalTokens      int `json:"total_tokens"`
+	// CachedTokens are the prompt tokens read from the provider's prompt
+	// cache, which most providers bill at a lower price. They are
+	// included in PromptTokens.
+	CachedTokens int `json:"cached_tokens,omitempty"`
+	// CacheWriteTokens are the prompt tokens written to the cache, which
+	// Anthropic bills above the input price. They are included in
+	// PromptTokens.
+	CacheWriteTokens int `json:"cache_write_tokens,omitempty"`
 }
 
 type Message struct {
@@ -31,6 +71,24 @@ type Message struct {
 	Content    string     `json:"content"`
 	ToolCalls  []ToolCall `json:"tool_calls,omitempty"`
 	ToolCallID string     `json:"tool_call_id,omitempty"`
+	// Images are sent with a user message to models that can see them.
+	// Providers without image input send only the text.
+	Images []ImageContent `json:"images,omitempty"`
+	// Thinking is the reasoning that came with an assistant message's
+	// tool calls.
+	Thinking []ThinkingBlock `json:"thinking,omitempty"`
+}
+
+// ImageContent is an image ready to send to a model: JPEG, PNG, GIF or
+// WebP, base64-encoded.
+type ImageContent struct {
+	MimeType string `json:"mime_type"`
+	Data     string `json:"data"`
+}
+
+// DataURL returns the image as a data: URL.
+func (img ImageContent) DataURL() string {
+	return "data:" + img.MimeType + ";base64," + img.Data
 }
 
 type ToolDefinition struct {
@@ -43,3 +101,23 @@ type ToolFunctionDefinition struct {
 	Description string                 `json:"description"`
 	Parameters  map[string]interface{} `json:"parameters"`
 }
+
+// StreamChunk is one piece of a reply delivered while the model generates
+// it. A chunk carries new text, part of a tool call, or, in the last
+// chunk, the finish reason and usage.
+type StreamChunk struct {
+	Delta         string         `json:"delta,omitempty"`
+	ToolCallDelta *ToolCallDelta `json:"tool_call_delta,omitempty"`
+	FinishReason  string         `json:"finish_reason,omitempty"`
+	Usage         *UsageInfo     `json:"usage,omitempty"`
+}
+
+// ToolCallDelta is part of a tool call. Index identifies the call within
+// the reply; its ID and Name come with the first delta, and Arguments are
+// fragments of the JSON arguments to append in order.
+type ToolCallDelta struct {
+	Index     int    `json:"index"`
+	ID        string `json:"id,omitempty"`
+	Name      string `json:"name,omitempty"`
+	Arguments string `json:"arguments,omitempty"`
+}
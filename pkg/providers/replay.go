@@ -0,0 +1,132 @@
+package providers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// ErrReplayExhausted is returned by a ReplayProvider that has served all
+// of its captured calls.
+var ErrReplayExhausted = errors.New("no captured provider calls left to replay")
+
+// ReplayProvider answers calls with the responses of captured ones instead
+// of calling a model, so that a run can be repeated without a provider,
+// cost or randomness. Each captured call is served once: the first not yet
+// served for the same conversation, or, when the conversation has drifted
+// from the recording, the next one in recorded order.
+type ReplayProvider struct {
+	mu       sync.Mutex
+	captures []Capture
+	served   []bool
+	redactor *captureRedactor
+}
+
+// LoadCaptures reads the calls captured to path.
+func LoadCaptures(path string) ([]Capture, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var captures []Capture
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var c Capture
+		if err := json.Unmarshal(scanner.Bytes(), &c); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		captures = append(captures, c)
+	}
+	return captures, scanner.Err()
+}
+
+// NewReplayProvider serves the calls captured to path.
+func NewReplayProvider(path string) (*ReplayProvider, error) {
+	captures, err := LoadCaptures(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(captures) == 0 {
+		return nil, fmt.Errorf("%s holds no captured calls", path)
+	}
+	return &ReplayProvider{
+		captures: captures,
+		served:   make([]bool, len(captures)),
+		redactor: newCaptureRedactor(nil),
+	}, nil
+}
+
+func (p *ReplayProvider) Chat(ctx context.Context, messages []Message, tools []ToolDefinition, model string, options map[string]interface{}) (*LLMResponse, error) {
+	c, err := p.next(model, messages)
+	if err != nil {
+		return nil, err
+	}
+	if c.Error != "" {
+		return nil, errors.New(c.Error)
+	}
+	if c.Response == nil {
+		return &LLMResponse{}, nil
+	}
+	resp := *c.Response
+	resp.ToolCalls = append([]ToolCall(nil), c.Response.ToolCalls...)
+	return &resp, nil
+}
+
+func (p *ReplayProvider) GetDefaultModel() string {
+	return p.captures[0].Model
+}
+
+// Remaining returns how many captured calls have not been served.
+func (p *ReplayProvider) Remaining() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	n := 0
+	for _, served := range p.served {
+		if !served {
+			n++
+		}
+	}
+	return n
+}
+
+func (p *ReplayProvider) next(model string, messages []Message) (Capture, error) {
+	key := captureKey(model, p.redactor.messages(messages))
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	first := -1
+	for i, c := range p.captures {
+		if p.served[i] {
+			continue
+		}
+		if c.Key == key {
+			p.served[i] = true
+			return c, nil
+		}
+		if first == -1 {
+			first = i
+		}
+	}
+	if first == -1 {
+		return Capture{}, ErrReplayExhausted
+	}
+	logger.WarnCF("providers", "Replaying a captured call for a different conversation", map[string]interface{}{
+		"model":          model,
+		"captured_model": p.captures[first].Model,
+		"captured_at":    p.captures[first].Time,
+	})
+	p.served[first] = true
+	return p.captures[first], nil
+}
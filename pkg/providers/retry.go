@@ -0,0 +1,418 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/openai/openai-go/v3"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/providers/openai_compat"
+)
+
+const (
+	// minBackoff is the first wait after a rate limit without Retry-After;
+	// it doubles with every further rate limit and halves with every
+	// success.
+	minBackoff = time.Second
+	// defaultMaxWait bounds a single wait when no limit is configured.
+	defaultMaxWait = 20 * time.Second
+)
+
+// RetryProvider retries the calls of the provider it wraps that fail with
+// a rate limit or a server error, waiting as long as the API asks with
+// Retry-After, or else backing off. Every RetryProvider for one provider
+// shares its limiter, which caps that provider's calls in flight and,
+// after a rate limit, holds back its other calls as well, so a busy hour
+// does not keep hitting the limit. A call still failing after its retries
+// returns the error, for the fallback chain to try the next model. Tool
+// calls whose arguments are not valid JSON are repaired (see
+// repairToolCalls).
+type RetryProvider struct {
+	delegate   LLMProvider
+	limiter    *providerLimiter
+	maxRetries int
+	maxWait    time.Duration
+	maxRepairs int
+}
+
+// NewRetryProvider wraps delegate, the provider called name, with the
+// retries and concurrency cap of cfg.
+func NewRetryProvider(delegate LLMProvider, name string, cfg config.ProviderRetryConfig) *RetryProvider {
+	maxConcurrent, ok := cfg.MaxConcurrent[name]
+	if !ok {
+		maxConcurrent = cfg.MaxConcurrent["*"]
+	}
+	maxWait := time.Duration(cfg.MaxWaitSeconds) * time.Second
+	if maxWait <= 0 {
+		maxWait = defaultMaxWait
+	}
+	return &RetryProvider{
+		delegate:   delegate,
+		limiter:    limiterFor(name, maxConcurrent),
+		maxRetries: cfg.MaxRetries,
+		maxWait:    maxWait,
+		maxRepairs: cfg.ToolCallRetries,
+	}
+}
+
+// Unwrap returns the wrapped provider.
+func (p *RetryProvider) Unwrap() LLMProvider {
+	return p.delegate
+}
+
+func (p *RetryProvider) Chat(ctx context.Context, messages []Message, tools []ToolDefinition, model string, options map[string]interface{}) (*LLMResponse, error) {
+	resp, err := p.do(ctx, func(ctx context.Context) (*LLMResponse, bool, error) {
+		resp, err := p.delegate.Chat(ctx, messages, tools, model, options)
+		return resp, false, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return p.repairToolCalls(ctx, messages, tools, model, options, resp), nil
+}
+
+// ChatStream streams the reply of the wrapped provider. A call that fails
+// after passing on part of its reply is not retried, since the chunks
+// already passed on cannot be taken back.
+func (p *RetryProvider) ChatStream(ctx context.Context, messages []Message, tools []ToolDefinition, model string, options map[string]interface{}, onChunk StreamFunc) (*LLMResponse, error) {
+	resp, err := p.do(ctx, func(ctx context.Context) (*LLMResponse, bool, error) {
+		streamed := false
+		resp, err := ChatStream(ctx, p.delegate, messages, tools, model, options, func(chunk StreamChunk) {
+			streamed = true
+			if onChunk != nil {
+				onChunk(chunk)
+			}
+		})
+		return resp, streamed, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return p.repairToolCalls(ctx, messages, tools, model, options, resp), nil
+}
+
+func (p *RetryProvider) GetDefaultModel() string {
+	return p.delegate.GetDefaultModel()
+}
+
+func (p *RetryProvider) do(ctx context.Context, call func(context.Context) (*LLMResponse, bool, error)) (*LLMResponse, error) {
+	l := p.limiter
+	for attempt := 0; ; attempt++ {
+		if err := l.acquire(ctx, p.maxWait); err != nil {
+			return nil, err
+		}
+		resp, streamed, err := call(ctx)
+		l.release()
+		if err == nil {
+			l.succeeded()
+			return resp, nil
+		}
+		if ctx.Err() != nil {
+			return nil, err
+		}
+
+		delay, retriable := l.failed(err, attempt, p.maxWait)
+		if !retriable {
+			return nil, err
+		}
+		if streamed || attempt >= p.maxRetries || delay > p.maxWait {
+			l.gaveUp()
+			logger.WarnCF("providers", "Giving up on provider call", map[string]interface{}{
+				"provider": l.name,
+				"attempts": attempt + 1,
+				"wait":     delay.String(),
+				"error":    err.Error(),
+			})
+			return nil, err
+		}
+
+		logger.InfoCF("providers", "Retrying provider call", map[string]interface{}{
+			"provider": l.name,
+			"attempt":  attempt + 1,
+			"wait":     delay.String(),
+			"error":    err.Error(),
+		})
+		l.retried()
+		if err := sleepContext(ctx, delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// providerLimiter throttles the calls to one provider.
+type providerLimiter struct {
+	name  string
+	slots chan struct{} // nil when calls are not capped
+
+	mu sync.Mutex
+	// resumeAt holds back calls after a rate limit until the wait the
+	// API asked for has passed
+	resumeAt time.Time
+	// backoff grows with consecutive rate limits and shrinks with
+	// successes, so a provider near its limit is called more slowly
+	backoff time.Duration
+	stats   retryStats
+}
+
+type retryStats struct {
+	calls        uint64
+	retries      uint64
+	rateLimited  uint64
+	serverErrors uint64
+	gaveUp       uint64
+	inFlight     int
+	waited       time.Duration
+}
+
+var (
+	limitersMu sync.Mutex
+	limiters   = map[string]*providerLimiter{}
+)
+
+// limiterFor returns the limiter shared by the calls to the provider
+// called name. The cap is set by the first provider created for it.
+func limiterFor(name string, maxConcurrent int) *providerLimiter {
+	limitersMu.Lock()
+	defer limitersMu.Unlock()
+	if l, ok := limiters[name]; ok {
+		return l
+	}
+	l := &providerLimiter{name: name}
+	if maxConcurrent > 0 {
+		l.slots = make(chan struct{}, maxConcurrent)
+	}
+	limiters[name] = l
+	return l
+}
+
+// acquire waits for a free slot and for a rate limit to pass, but no
+// longer than maxWait for the rate limit.
+func (l *providerLimiter) acquire(ctx context.Context, maxWait time.Duration) error {
+	start := time.Now()
+	if l.slots != nil {
+		select {
+		case l.slots <- struct{}{}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	l.mu.Lock()
+	wait := min(time.Until(l.resumeAt), maxWait)
+	l.mu.Unlock()
+	if wait > 0 {
+		if err := sleepContext(ctx, wait); err != nil {
+			if l.slots != nil {
+				<-l.slots
+			}
+			return err
+		}
+	}
+
+	l.mu.Lock()
+	l.stats.calls++
+	l.stats.inFlight++
+	l.stats.waited += time.Since(start)
+	l.mu.Unlock()
+	return nil
+}
+
+func (l *providerLimiter) release() {
+	l.mu.Lock()
+	l.stats.inFlight--
+	l.mu.Unlock()
+	if l.slots != nil {
+		<-l.slots
+	}
+}
+
+func (l *providerLimiter) succeeded() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.backoff /= 2
+	if l.backoff < minBackoff {
+		l.backoff = 0
+	}
+}
+
+// failed records a failed call and decides whether it may be retried and
+// after how long. Rate limits also hold back the provider's other calls.
+func (l *providerLimiter) failed(err error, attempt int, maxWait time.Duration) (time.Duration, bool) {
+	status, retryAfter := httpErrorDetails(err)
+	reason := FailoverReason("")
+	if fe := ClassifyError(err, l.name, ""); fe != nil {
+		reason = fe.Reason
+		if status == 0 {
+			status = fe.Status
+		}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	switch {
+	case status == 429 || (status == 0 && reason == FailoverRateLimit):
+		// An exhausted quota or balance does not come back in seconds
+		if isQuotaExhausted(err) {
+			return 0, false
+		}
+		l.stats.rateLimited++
+		l.backoff = min(max(2*l.backoff, minBackoff), maxWait)
+		delay := retryAfter
+		if delay == 0 {
+			delay = l.backoff
+		}
+		if resume := time.Now().Add(min(delay, maxWait)); resume.After(l.resumeAt) {
+			l.resumeAt = resume
+		}
+		return delay, true
+	case status >= 500 || reason == FailoverOverloaded:
+		l.stats.serverErrors++
+		if retryAfter > 0 {
+			return retryAfter, true
+		}
+		// 1s, 2s, 4s... with jitter, so calls that failed together do
+		// not all come back at once
+		delay := minBackoff << min(attempt, 5)
+		return delay + time.Duration(rand.Int63n(int64(delay/2))), true
+	}
+	return 0, false
+}
+
+func (l *providerLimiter) retried() {
+	l.mu.Lock()
+	l.stats.retries++
+	l.mu.Unlock()
+}
+
+func (l *providerLimiter) gaveUp() {
+	l.mu.Lock()
+	l.stats.gaveUp++
+	l.mu.Unlock()
+}
+
+// httpErrorDetails reads the status code and Retry-After of the errors
+// the providers return for unsuccessful API responses.
+func httpErrorDetails(err error) (int, time.Duration) {
+	var apiErr *openai_compat.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode, apiErr.RetryAfter
+	}
+	var claudeErr *anthropic.Error
+	if errors.As(err, &claudeErr) {
+		if claudeErr.Response != nil {
+			return claudeErr.StatusCode, openai_compat.RetryAfter(claudeErr.Response.Header)
+		}
+		return claudeErr.StatusCode, 0
+	}
+	var openaiErr *openai.Error
+	if errors.As(err, &openaiErr) {
+		if openaiErr.Response != nil {
+			return openaiErr.StatusCode, openai_compat.RetryAfter(openaiErr.Response.Header)
+		}
+		return openaiErr.StatusCode, 0
+	}
+	return 0, 0
+}
+
+func isQuotaExhausted(err error) bool {
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "insufficient_quota") || strings.Contains(msg, "exceeded your current quota")
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// IsBusyError reports whether err, as returned by a provider or the
+// fallback chain, means the providers were rate limited or overloaded
+// rather than that the request was wrong: the user can simply try again
+// later.
+func IsBusyError(err error) bool {
+	var exhausted *FallbackExhaustedError
+	if errors.As(err, &exhausted) {
+		busy := false
+		for _, a := range exhausted.Attempts {
+			switch {
+			case a.Skipped:
+			case a.Reason == FailoverRateLimit || a.Reason == FailoverOverloaded || a.Reason == FailoverTimeout:
+				busy = true
+			default:
+				return false
+			}
+		}
+		return busy
+	}
+	fe := ClassifyError(err, "", "")
+	if fe == nil || isQuotaExhausted(err) {
+		return false
+	}
+	return fe.Reason == FailoverRateLimit || fe.Reason == FailoverOverloaded ||
+		(fe.Reason == FailoverTimeout && fe.Status >= 500)
+}
+
+// WriteRetryMetrics writes the retry and throttling counters of every
+// provider called since start in the Prometheus text format.
+func WriteRetryMetrics(w io.Writer) error {
+	limitersMu.Lock()
+	names := make([]string, 0, len(limiters))
+	for name := range limiters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	stats := make([]retryStats, len(names))
+	backoff := make([]time.Duration, len(names))
+	for i, name := range names {
+		l := limiters[name]
+		l.mu.Lock()
+		stats[i], backoff[i] = l.stats, l.backoff
+		l.mu.Unlock()
+	}
+	limitersMu.Unlock()
+
+	metrics := []struct {
+		name, help, kind string
+		value            func(i int) float64
+	}{
+		{"picoclaw_provider_calls_total", "Calls made to LLM providers, retries included.", "counter",
+			func(i int) float64 { return float64(stats[i].calls) }},
+		{"picoclaw_provider_retries_total", "Provider calls retried after a rate limit or server error.", "counter",
+			func(i int) float64 { return float64(stats[i].retries) }},
+		{"picoclaw_provider_rate_limited_total", "Provider calls rejected by a rate limit.", "counter",
+			func(i int) float64 { return float64(stats[i].rateLimited) }},
+		{"picoclaw_provider_server_errors_total", "Provider calls failed by a server error or overload.", "counter",
+			func(i int) float64 { return float64(stats[i].serverErrors) }},
+		{"picoclaw_provider_gave_up_total", "Provider calls that failed after their retries.", "counter",
+			func(i int) float64 { return float64(stats[i].gaveUp) }},
+		{"picoclaw_provider_wait_seconds_total", "Time calls waited for a free slot or for a rate limit to pass.", "counter",
+			func(i int) float64 { return stats[i].waited.Seconds() }},
+		{"picoclaw_provider_in_flight", "Provider calls in progress.", "gauge",
+			func(i int) float64 { return float64(stats[i].inFlight) }},
+		{"picoclaw_provider_backoff_seconds", "Current backoff after rate limits.", "gauge",
+			func(i int) float64 { return backoff[i].Seconds() }},
+	}
+	var b strings.Builder
+	for _, m := range metrics {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.kind)
+		for i, name := range names {
+			fmt.Fprintf(&b, "%s{provider=%q} %g\n", m.name, name, m.value(i))
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
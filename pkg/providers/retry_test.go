@@ -0,0 +1,170 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestRetryProvider_RetriesRateLimitsAndServerErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		provider   string
+		status     int
+		header     string
+		value      string
+		body       string
+		wantCalls  int
+		wantErr    bool
+		wantMetric string
+	}{
+		{"rate limit honours Retry-After", "test-429", 429, "Retry-After-Ms", "50", "slow down", 2, false,
+			`picoclaw_provider_rate_limited_total{provider="test-429"} 1`},
+		{"overloaded", "test-503", 503, "Retry-After-Ms", "10", "overloaded", 2, false,
+			`picoclaw_provider_server_errors_total{provider="test-503"} 1`},
+		{"wait too long", "test-long", 429, "Retry-After", "120", "slow down", 1, true,
+			`picoclaw_provider_gave_up_total{provider="test-long"} 1`},
+		{"bad request", "test-400", 400, "", "", "invalid tools", 1, true,
+			`picoclaw_provider_retries_total{provider="test-400"} 0`},
+		{"quota exhausted", "test-quota", 429, "", "", "insufficient_quota", 1, true,
+			`picoclaw_provider_rate_limited_total{provider="test-quota"} 0`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if atomic.AddInt32(&calls, 1) == 1 {
+					if tt.header != "" {
+						w.Header().Set(tt.header, tt.value)
+					}
+					http.Error(w, `{"error":{"message":"`+tt.body+`"}}`, tt.status)
+					return
+				}
+				w.Write([]byte(`{"choices":[{"message":{"content":"ok"},"finish_reason":"stop"}]}`))
+			}))
+			defer server.Close()
+
+			p := NewRetryProvider(NewHTTPProvider("key", server.URL, ""), tt.provider,
+				config.ProviderRetryConfig{MaxRetries: 2, MaxWaitSeconds: 5})
+			start := time.Now()
+			resp, err := p.Chat(context.Background(), []Message{{Role: "user", Content: "hi"}}, nil, "m", nil)
+			if (err != nil) != tt.wantErr || int(calls) != tt.wantCalls {
+				t.Fatalf("err = %v after %d calls", err, calls)
+			}
+			if !tt.wantErr && (resp.Content != "ok" || time.Since(start) < 10*time.Millisecond) {
+				t.Errorf("resp = %+v after %v", resp, time.Since(start))
+			}
+
+			var metrics strings.Builder
+			WriteRetryMetrics(&metrics)
+			if !strings.Contains(metrics.String(), tt.wantMetric) {
+				t.Errorf("metrics missing %s:\n%s", tt.wantMetric, metrics.String())
+			}
+		})
+	}
+}
+
+// concurrencyProvider records how many of its calls run at once.
+type concurrencyProvider struct {
+	mu      sync.Mutex
+	current int
+	peak    int
+}
+
+func (p *concurrencyProvider) Chat(ctx context.Context, messages []Message, tools []ToolDefinition, model string, opts map[string]interface{}) (*LLMResponse, error) {
+	p.mu.Lock()
+	p.current++
+	p.peak = max(p.peak, p.current)
+	p.mu.Unlock()
+	time.Sleep(20 * time.Millisecond)
+	p.mu.Lock()
+	p.current--
+	p.mu.Unlock()
+	return &LLMResponse{Content: "ok"}, nil
+}
+
+func (p *concurrencyProvider) GetDefaultModel() string { return "m" }
+
+func TestRetryProvider_CapsConcurrency(t *testing.T) {
+	inner := &concurrencyProvider{}
+	cfg := config.ProviderRetryConfig{MaxConcurrent: map[string]int{"test-capped": 2}}
+	// Providers created separately for one provider share its cap
+	providers := []*RetryProvider{
+		NewRetryProvider(inner, "test-capped", cfg),
+		NewRetryProvider(inner, "test-capped", cfg),
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func(p *RetryProvider) {
+			defer wg.Done()
+			p.Chat(context.Background(), nil, nil, "m", nil)
+		}(providers[i%2])
+	}
+	wg.Wait()
+	if inner.peak != 2 {
+		t.Errorf("peak concurrency = %d, want 2", inner.peak)
+	}
+}
+
+// partialStreamProvider fails after streaming part of its reply.
+type partialStreamProvider struct{ calls int }
+
+func (p *partialStreamProvider) Chat(ctx context.Context, messages []Message, tools []ToolDefinition, model string, opts map[string]interface{}) (*LLMResponse, error) {
+	return p.ChatStream(ctx, messages, tools, model, opts, nil)
+}
+
+func (p *partialStreamProvider) ChatStream(ctx context.Context, messages []Message, tools []ToolDefinition, model string, opts map[string]interface{}, onChunk StreamFunc) (*LLMResponse, error) {
+	p.calls++
+	if onChunk != nil {
+		onChunk(StreamChunk{Delta: "Your CA"})
+	}
+	return nil, errors.New("API stream error: status 503: overloaded")
+}
+
+func (p *partialStreamProvider) GetDefaultModel() string { return "m" }
+
+func TestRetryProvider_DoesNotRetryPartialStream(t *testing.T) {
+	inner := &partialStreamProvider{}
+	p := NewRetryProvider(inner, "test-stream", config.ProviderRetryConfig{MaxRetries: 2})
+	var chunks []StreamChunk
+	_, err := p.ChatStream(context.Background(), nil, nil, "m", nil, func(c StreamChunk) { chunks = append(chunks, c) })
+	if err == nil || inner.calls != 1 || len(chunks) != 1 {
+		t.Errorf("err = %v, calls = %d, chunks = %d", err, inner.calls, len(chunks))
+	}
+}
+
+func TestIsBusyError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"rate limit", errors.New("API request failed:\n  Status: 429\n  Body:   rate limit exceeded"), true},
+		{"overloaded", errors.New(`{"type":"overloaded_error"}`), true},
+		{"quota", errors.New("status 429: You exceeded your current quota"), false},
+		{"bad request", errors.New("status 400: invalid tools"), false},
+		{"all candidates busy", &FallbackExhaustedError{Attempts: []FallbackAttempt{
+			{Provider: "openai", Reason: FailoverRateLimit},
+			{Provider: "deepseek", Skipped: true},
+		}}, true},
+		{"one candidate misconfigured", &FallbackExhaustedError{Attempts: []FallbackAttempt{
+			{Provider: "openai", Reason: FailoverRateLimit},
+			{Provider: "deepseek", Reason: FailoverAuth},
+		}}, false},
+	}
+	for _, tt := range tests {
+		if got := IsBusyError(tt.err); got != tt.want {
+			t.Errorf("%s: IsBusyError = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+)
+
+// ChatStream asks provider for a reply and passes it to onChunk as it is
+// generated. Providers that cannot stream, such as the CLI providers,
+// answer through Chat and their reply is passed on whole, in the same
+// order of chunks, so callers handle every provider alike.
+func ChatStream(ctx context.Context, provider LLMProvider, messages []Message, tools []ToolDefinition, model string, options map[string]interface{}, onChunk StreamFunc) (*LLMResponse, error) {
+	if sp, ok := provider.(StreamingProvider); ok {
+		return sp.ChatStream(ctx, messages, tools, model, options, onChunk)
+	}
+	resp, err := provider.Chat(ctx, messages, tools, model, options)
+	if err != nil {
+		return nil, err
+	}
+	emitResponse(resp, onChunk)
+	return resp, nil
+}
+
+// emitResponse passes a complete reply to onChunk as one text chunk, one
+// chunk per tool call and the closing chunk.
+func emitResponse(resp *LLMResponse, onChunk StreamFunc) {
+	if resp == nil || onChunk == nil {
+		return
+	}
+	if resp.Content != "" {
+		onChunk(StreamChunk{Delta: resp.Content})
+	}
+	for i, tc := range resp.ToolCalls {
+		delta := &ToolCallDelta{Index: i, ID: tc.ID, Name: tc.Name}
+		if tc.Function != nil {
+			if delta.Name == "" {
+				delta.Name = tc.Function.Name
+			}
+			delta.Arguments = tc.Function.Arguments
+		}
+		if delta.Arguments == "" && tc.Arguments != nil {
+			if data, err := json.Marshal(tc.Arguments); err == nil {
+				delta.Arguments = string(data)
+			}
+		}
+		onChunk(StreamChunk{ToolCallDelta: delta})
+	}
+	onChunk(StreamChunk{FinishReason: resp.FinishReason, Usage: resp.Usage})
+}
@@ -0,0 +1,43 @@
+package providers
+
+import (
+	"context"
+	"testing"
+)
+
+func TestChatStream_NonStreamingProvider(t *testing.T) {
+	delegate := &textToolDelegate{reply: "CA19-9 is a tumour marker."}
+	var chunks []StreamChunk
+	resp, err := ChatStream(context.Background(), delegate, []Message{{Role: "user", Content: "CA19-9?"}}, nil, "m", nil,
+		func(chunk StreamChunk) { chunks = append(chunks, chunk) })
+	if err != nil {
+		t.Fatalf("ChatStream() error = %v", err)
+	}
+	if resp.Content != delegate.reply {
+		t.Errorf("content = %q", resp.Content)
+	}
+	if len(chunks) != 2 || chunks[0].Delta != delegate.reply || chunks[1].FinishReason != "stop" {
+		t.Errorf("chunks = %+v", chunks)
+	}
+}
+
+func TestChatStream_TextToolCall(t *testing.T) {
+	p := NewTextToolProvider(&textToolDelegate{reply: "Action: kb_search\nAction Input: {\"query\": \"dose\"}"})
+	tools := []ToolDefinition{{Type: "function", Function: ToolFunctionDefinition{Name: "kb_search"}}}
+
+	var chunks []StreamChunk
+	_, err := ChatStream(context.Background(), p, []Message{{Role: "user", Content: "Dose?"}}, tools, "m", nil,
+		func(chunk StreamChunk) { chunks = append(chunks, chunk) })
+	if err != nil {
+		t.Fatalf("ChatStream() error = %v", err)
+	}
+	if len(chunks) != 2 {
+		t.Fatalf("chunks = %+v, want a tool call and the finish", chunks)
+	}
+	if d := chunks[0].ToolCallDelta; d == nil || d.Name != "kb_search" || d.Arguments != `{"query":"dose"}` || d.ID == "" {
+		t.Errorf("tool call delta = %+v", d)
+	}
+	if chunks[1].FinishReason != "tool_calls" {
+		t.Errorf("finish = %+v", chunks[1])
+	}
+}
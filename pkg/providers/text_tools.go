@@ -0,0 +1,193 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync/atomic"
+)
+
+// TextToolProvider lets models without native function calling use tools.
+// It describes the tools in the system prompt, asks the model to call them
+// with a ReAct-style text protocol (Action / Action Input, answered with an
+// Observation) and turns the replies back into tool calls, so the agent loop
+// works the same as with a native provider.
+type TextToolProvider struct {
+	delegate LLMProvider
+	calls    atomic.Uint64
+}
+
+// NewTextToolProvider wraps delegate, which is sent no tool definitions.
+func NewTextToolProvider(delegate LLMProvider) *TextToolProvider {
+	return &TextToolProvider{delegate: delegate}
+}
+
+func (p *TextToolProvider) Chat(ctx context.Context, messages []Message, tools []ToolDefinition, model string, options map[string]interface{}) (*LLMResponse, error) {
+	resp, err := p.delegate.Chat(ctx, toTextToolMessages(messages, tools), nil, model, options)
+	if err != nil || len(tools) == 0 {
+		return resp, err
+	}
+
+	content, call := parseTextToolReply(resp.Content)
+	resp.Content = content
+	if call != nil {
+		call.ID = fmt.Sprintf("call_text_%d", p.calls.Add(1))
+		resp.ToolCalls = []ToolCall{*call}
+		resp.FinishReason = "tool_calls"
+	}
+	return resp, nil
+}
+
+// ChatStream streams replies without tools as they come. With tools, the
+// reply has to be complete before its Action lines can be read, so it is
+// passed on whole.
+func (p *TextToolProvider) ChatStream(ctx context.Context, messages []Message, tools []ToolDefinition, model string, options map[string]interface{}, onChunk StreamFunc) (*LLMResponse, error) {
+	if len(tools) == 0 {
+		return ChatStream(ctx, p.delegate, toTextToolMessages(messages, nil), nil, model, options, onChunk)
+	}
+	resp, err := p.Chat(ctx, messages, tools, model, options)
+	if err != nil {
+		return nil, err
+	}
+	emitResponse(resp, onChunk)
+	return resp, nil
+}
+
+func (p *TextToolProvider) GetDefaultModel() string {
+	return p.delegate.GetDefaultModel()
+}
+
+// toTextToolMessages rewrites a conversation for a model that only reads
+// text: the tool list and protocol go into the system prompt, earlier tool
+// calls become Action lines and tool results become Observation messages.
+func toTextToolMessages(messages []Message, tools []ToolDefinition) []Message {
+	out := make([]Message, 0, len(messages)+1)
+	if len(tools) > 0 && (len(messages) == 0 || messages[0].Role != "system") {
+		out = append(out, Message{Role: "system"})
+	}
+
+	for _, msg := range messages {
+		switch {
+		case msg.Role == "tool" || msg.ToolCallID != "":
+			observation := "Observation: " + msg.Content
+			// Results of several calls in one reply go in one message
+			if n := len(out); n > 0 && out[n-1].Role == "user" && strings.HasPrefix(out[n-1].Content, "Observation: ") {
+				out[n-1].Content += "\n\n" + observation
+				continue
+			}
+			out = append(out, Message{Role: "user", Content: observation})
+		case msg.Role == "assistant" && len(msg.ToolCalls) > 0:
+			var b strings.Builder
+			if text := strings.TrimSpace(msg.Content); text != "" {
+				b.WriteString("Thought: " + text + "\n")
+			}
+			for _, tc := range msg.ToolCalls {
+				name, args := tc.Name, "{}"
+				if tc.Arguments != nil {
+					if data, err := json.Marshal(tc.Arguments); err == nil {
+						args = string(data)
+					}
+				}
+				if tc.Function != nil {
+					if name == "" {
+						name = tc.Function.Name
+					}
+					if tc.Arguments == nil && tc.Function.Arguments != "" {
+						args = tc.Function.Arguments
+					}
+				}
+				fmt.Fprintf(&b, "Action: %s\nAction Input: %s\n", name, args)
+			}
+			out = append(out, Message{Role: "assistant", Content: strings.TrimSpace(b.String())})
+		default:
+			out = append(out, Message{Role: msg.Role, Content: msg.Content, Images: msg.Images})
+		}
+	}
+
+	if len(tools) > 0 {
+		system := &out[0]
+		system.Content = strings.TrimSpace(system.Content + "\n\n" + textToolPrompt(tools))
+	}
+	return out
+}
+
+func textToolPrompt(tools []ToolDefinition) string {
+	var b strings.Builder
+	b.WriteString("## Tools\n\nYou can use these tools:\n\n")
+	for _, t := range tools {
+		fmt.Fprintf(&b, "- %s: %s\n", t.Function.Name, t.Function.Description)
+		if len(t.Function.Parameters) > 0 {
+			if schema, err := json.Marshal(t.Function.Parameters); err == nil {
+				fmt.Fprintf(&b, "  Input schema: %s\n", schema)
+			}
+		}
+	}
+	b.WriteString(`
+To use a tool, reply with exactly these lines and nothing after them:
+
+Thought: <why you need the tool>
+Action: <tool name>
+Action Input: <the arguments as one JSON object>
+
+Use one tool per reply. The result comes back as "Observation: <result>".
+When you can answer without another tool, reply with:
+
+Final Answer: <your answer to the user>`)
+	return b.String()
+}
+
+var (
+	actionLine      = regexp.MustCompile(`(?m)^[ \t*]*Action[ \t*]*:[ \t*]*(.*)$`)
+	actionInputLine = regexp.MustCompile(`(?m)^[ \t*]*Action Input[ \t*]*:`)
+	finalAnswerLine = regexp.MustCompile(`(?m)^[ \t*]*Final Answer[ \t*]*:`)
+	thoughtPrefix   = regexp.MustCompile(`^[ \t*]*Thought[ \t*]*:`)
+)
+
+// parseTextToolReply splits a reply into the text for the user and the tool
+// call it makes, if any. Only the first Action is used; anything the model
+// wrote after its input, such as an invented Observation, is dropped.
+func parseTextToolReply(reply string) (string, *ToolCall) {
+	final := finalAnswerLine.FindStringIndex(reply)
+	action := actionLine.FindStringSubmatchIndex(reply)
+	if action == nil || (final != nil && final[0] < action[0]) {
+		if final != nil {
+			return strings.TrimSpace(reply[final[1]:]), nil
+		}
+		return strings.TrimSpace(reply), nil
+	}
+
+	name := strings.Trim(strings.TrimSpace(reply[action[2]:action[3]]), "`\"'")
+	if name == "" {
+		return strings.TrimSpace(reply), nil
+	}
+
+	args, argsErr := map[string]interface{}{}, ""
+	rest := reply[action[1]:]
+	if input := actionInputLine.FindStringIndex(rest); input != nil {
+		raw := rest[input[1]:]
+		if start := strings.Index(raw, "{"); start != -1 {
+			// Decode only the first JSON value, so braces inside strings
+			// and text after the object do not matter
+			dec := json.NewDecoder(strings.NewReader(raw[start:]))
+			if err := dec.Decode(&args); err != nil {
+				args = map[string]interface{}{"raw": strings.TrimSpace(raw)}
+				argsErr = err.Error()
+			}
+		}
+	}
+
+	thought := thoughtPrefix.ReplaceAllString(strings.TrimSpace(reply[:action[0]]), "")
+	argsJSON, _ := json.Marshal(args)
+	return strings.TrimSpace(thought), &ToolCall{
+		Type:           "function",
+		Name:           name,
+		Arguments:      args,
+		ArgumentsError: argsErr,
+		Function: &FunctionCall{
+			Name:      name,
+			Arguments: string(argsJSON),
+		},
+	}
+}
@@ -0,0 +1,158 @@
+package providers
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseTextToolReply(t *testing.T) {
+	tests := []struct {
+		name        string
+		reply       string
+		wantContent string
+		wantTool    string
+		wantArgs    map[string]interface{}
+	}{
+		{
+			name:        "action with input",
+			reply:       "Thought: I need the guideline.\nAction: kb_search\nAction Input: {\"query\": \"FOLFIRINOX dose {adjusted}\"}",
+			wantContent: "I need the guideline.",
+			wantTool:    "kb_search",
+			wantArgs:    map[string]interface{}{"query": "FOLFIRINOX dose {adjusted}"},
+		},
+		{
+			name:     "fenced input and invented observation",
+			reply:    "Action: `web_search`\nAction Input:\n```json\n{\"query\": \"CA19-9\", \"count\": 3}\n```\nObservation: made up",
+			wantTool: "web_search",
+			wantArgs: map[string]interface{}{"query": "CA19-9", "count": float64(3)},
+		},
+		{
+			name:     "no input",
+			reply:    "Action: list_reminders",
+			wantTool: "list_reminders",
+			wantArgs: map[string]interface{}{},
+		},
+		{
+			name:     "invalid input is kept raw",
+			reply:    "Action: kb_search\nAction Input: {query: CA19-9}",
+			wantTool: "kb_search",
+			wantArgs: map[string]interface{}{"raw": "{query: CA19-9}"},
+		},
+		{
+			name:        "final answer",
+			reply:       "Thought: I know this.\nFinal Answer: CA19-9 is a tumour marker.",
+			wantContent: "CA19-9 is a tumour marker.",
+		},
+		{
+			name:        "final answer before a mentioned action",
+			reply:       "Final Answer: Ask your care team.\nAction: none",
+			wantContent: "Ask your care team.\nAction: none",
+		},
+		{
+			name:        "plain reply",
+			reply:       "  Hello, how can I help?  ",
+			wantContent: "Hello, how can I help?",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content, call := parseTextToolReply(tt.reply)
+			if content != tt.wantContent {
+				t.Errorf("content = %q, want %q", content, tt.wantContent)
+			}
+			if tt.wantTool == "" {
+				if call != nil {
+					t.Fatalf("call = %+v, want none", call)
+				}
+				return
+			}
+			if call == nil {
+				t.Fatal("call = nil, want one")
+			}
+			if call.Name != tt.wantTool || call.Function.Name != tt.wantTool {
+				t.Errorf("tool = %q, want %q", call.Name, tt.wantTool)
+			}
+			if !reflect.DeepEqual(call.Arguments, tt.wantArgs) {
+				t.Errorf("args = %#v, want %#v", call.Arguments, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestToTextToolMessages(t *testing.T) {
+	tools := []ToolDefinition{{
+		Type: "function",
+		Function: ToolFunctionDefinition{
+			Name:        "kb_search",
+			Description: "Search the knowledge base",
+			Parameters:  map[string]interface{}{"type": "object"},
+		},
+	}}
+	messages := []Message{
+		{Role: "system", Content: "You are a helper."},
+		{Role: "user", Content: "Dose?"},
+		{Role: "assistant", Content: "Checking.", ToolCalls: []ToolCall{
+			{ID: "a", Name: "kb_search", Arguments: map[string]interface{}{"query": "dose"}},
+			{ID: "b", Function: &FunctionCall{Name: "kb_search", Arguments: `{"query":"schedule"}`}},
+		}},
+		{Role: "tool", ToolCallID: "a", Content: "85 mg/m2"},
+		{Role: "tool", ToolCallID: "b", Content: "every 2 weeks"},
+	}
+
+	got := toTextToolMessages(messages, tools)
+	if len(got) != 4 {
+		t.Fatalf("got %d messages, want 4: %+v", len(got), got)
+	}
+	if !strings.HasPrefix(got[0].Content, "You are a helper.") ||
+		!strings.Contains(got[0].Content, "- kb_search: Search the knowledge base") ||
+		!strings.Contains(got[0].Content, "Action Input:") {
+		t.Errorf("system prompt = %q", got[0].Content)
+	}
+	wantAssistant := "Thought: Checking.\nAction: kb_search\nAction Input: {\"query\":\"dose\"}\nAction: kb_search\nAction Input: {\"query\":\"schedule\"}"
+	if got[2].Role != "assistant" || got[2].Content != wantAssistant || len(got[2].ToolCalls) != 0 {
+		t.Errorf("assistant = %+v, want content %q", got[2], wantAssistant)
+	}
+	if got[3].Role != "user" || got[3].Content != "Observation: 85 mg/m2\n\nObservation: every 2 weeks" {
+		t.Errorf("observations = %+v", got[3])
+	}
+}
+
+type textToolDelegate struct {
+	reply string
+	got   []Message
+	tools []ToolDefinition
+}
+
+func (d *textToolDelegate) Chat(ctx context.Context, messages []Message, tools []ToolDefinition, model string, options map[string]interface{}) (*LLMResponse, error) {
+	d.got, d.tools = messages, tools
+	return &LLMResponse{Content: d.reply, FinishReason: "stop"}, nil
+}
+
+func (d *textToolDelegate) GetDefaultModel() string { return "local" }
+
+func TestTextToolProvider_Chat(t *testing.T) {
+	delegate := &textToolDelegate{reply: "Action: kb_search\nAction Input: {\"query\": \"dose\"}"}
+	p := NewTextToolProvider(delegate)
+	tools := []ToolDefinition{{Type: "function", Function: ToolFunctionDefinition{Name: "kb_search"}}}
+
+	resp, err := p.Chat(context.Background(), []Message{{Role: "user", Content: "Dose?"}}, tools, "m", nil)
+	if err != nil {
+		t.Fatalf("Chat() error = %v", err)
+	}
+	if delegate.tools != nil {
+		t.Errorf("delegate got tools %v, want none", delegate.tools)
+	}
+	if delegate.got[0].Role != "system" {
+		t.Errorf("first message role = %q, want an added system prompt", delegate.got[0].Role)
+	}
+	if resp.FinishReason != "tool_calls" || len(resp.ToolCalls) != 1 || resp.ToolCalls[0].ID == "" {
+		t.Fatalf("resp = %+v, want one tool call with an ID", resp)
+	}
+
+	second, _ := p.Chat(context.Background(), []Message{{Role: "user", Content: "Dose?"}}, tools, "m", nil)
+	if second.ToolCalls[0].ID == resp.ToolCalls[0].ID {
+		t.Errorf("tool call IDs repeat: %q", resp.ToolCalls[0].ID)
+	}
+}
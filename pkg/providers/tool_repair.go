@@ -0,0 +1,260 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// repairToolCalls fixes the tool calls of resp whose arguments are not
+// valid JSON, so one bad emission does not cost the turn. Arguments are
+// first parsed leniently; calls still broken after that are asked for
+// again, with the parse error, up to p.maxRepairs times. A reply still
+// broken after that is returned as it is, and the tool reports the bad
+// arguments to the model.
+func (p *RetryProvider) repairToolCalls(ctx context.Context, messages []Message, tools []ToolDefinition, model string,
+	options map[string]interface{}, resp *LLMResponse) *LLMResponse {
+	if resp == nil || !repairLocally(resp.ToolCalls) {
+		return resp
+	}
+
+	for attempt := 1; attempt <= p.maxRepairs; attempt++ {
+		retry := append(append([]Message(nil), messages...), Message{Role: "user", Content: repairRequest(resp.ToolCalls)})
+		logger.WarnCF("providers", "Asking again for malformed tool call arguments", map[string]interface{}{
+			"provider": p.limiter.name,
+			"model":    model,
+			"attempt":  attempt,
+		})
+		again, err := p.do(ctx, func(ctx context.Context) (*LLMResponse, bool, error) {
+			resp, err := p.delegate.Chat(ctx, retry, tools, model, options)
+			return resp, false, err
+		})
+		if err != nil {
+			logger.WarnCF("providers", "Failed to ask again for tool call arguments", map[string]interface{}{
+				"provider": p.limiter.name,
+				"error":    err.Error(),
+			})
+			return resp
+		}
+		addUsage(resp, again.Usage)
+		if len(again.ToolCalls) > 0 && !repairLocally(again.ToolCalls) {
+			// Content already streamed stays; the calls are replaced
+			resp.ToolCalls = again.ToolCalls
+			return resp
+		}
+	}
+	return resp
+}
+
+// repairLocally parses the broken arguments of calls leniently, and
+// reports whether any are still broken.
+func repairLocally(calls []ToolCall) bool {
+	broken := false
+	for i := range calls {
+		tc := &calls[i]
+		if tc.ArgumentsError == "" {
+			continue
+		}
+		raw, _ := tc.Arguments["raw"].(string)
+		args, err := parseLenientJSON(raw)
+		if err != nil {
+			broken = true
+			continue
+		}
+		logger.InfoCF("providers", "Repaired malformed tool call arguments", map[string]interface{}{
+			"tool":  toolCallName(tc),
+			"error": tc.ArgumentsError,
+		})
+		tc.Arguments = args
+		tc.ArgumentsError = ""
+		if tc.Function != nil {
+			data, _ := json.Marshal(args)
+			tc.Function.Arguments = string(data)
+		}
+	}
+	return broken
+}
+
+// repairRequest tells the model which of its tool calls had arguments
+// that could not be parsed, and why.
+func repairRequest(calls []ToolCall) string {
+	var b strings.Builder
+	b.WriteString("Your last reply called tools with arguments that are not valid JSON:\n")
+	for _, tc := range calls {
+		if tc.ArgumentsError == "" {
+			continue
+		}
+		raw, _ := tc.Arguments["raw"].(string)
+		fmt.Fprintf(&b, "\n- %s: %s\n  %s\n", toolCallName(&tc), tc.ArgumentsError, raw)
+	}
+	b.WriteString("\nMake the same tool calls again, with each call's arguments as one valid JSON object.")
+	return b.String()
+}
+
+func toolCallName(tc *ToolCall) string {
+	if tc.Name == "" && tc.Function != nil {
+		return tc.Function.Name
+	}
+	return tc.Name
+}
+
+func addUsage(resp *LLMResponse, u *UsageInfo) {
+	if u == nil {
+		return
+	}
+	if resp.Usage == nil {
+		resp.Usage = &UsageInfo{}
+	}
+	resp.Usage.PromptTokens += u.PromptTokens
+	resp.Usage.CompletionTokens += u.CompletionTokens
+	resp.Usage.TotalTokens += u.TotalTokens
+	resp.Usage.CachedTokens += u.CachedTokens
+	resp.Usage.CacheWriteTokens += u.CacheWriteTokens
+}
+
+var errNotObject = errors.New("arguments are not a JSON object")
+
+// parseLenientJSON parses a JSON object as models tend to get it wrong:
+// wrapped in a code fence or in a string, followed by text, with trailing
+// commas, single quotes, unquoted keys, Python's True, False and None, raw
+// newlines in strings, or cut off before its closing braces.
+func parseLenientJSON(raw string) (map[string]interface{}, error) {
+	s := strings.TrimSpace(raw)
+	s = strings.TrimPrefix(s, "```json")
+	s = strings.TrimPrefix(s, "```")
+	s = strings.TrimSpace(strings.TrimSuffix(s, "```"))
+
+	// Arguments encoded twice, as a JSON string holding the object
+	var inner string
+	if json.Unmarshal([]byte(s), &inner) == nil {
+		s = strings.TrimSpace(inner)
+	}
+
+	start := strings.Index(s, "{")
+	if start == -1 {
+		return nil, errNotObject
+	}
+	var args map[string]interface{}
+	dec := json.NewDecoder(strings.NewReader(normalizeJSON(s[start:])))
+	if err := dec.Decode(&args); err != nil {
+		return nil, err
+	}
+	if args == nil {
+		return nil, errNotObject
+	}
+	return args, nil
+}
+
+// normalizeJSON rewrites the JSON-like object s as JSON, up to the end of
+// its first object.
+func normalizeJSON(s string) string {
+	var out strings.Builder
+	var open []byte // closing brackets still expected
+	runes := []rune(s)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case r == '"' || r == '\'':
+			i = copyString(&out, runes, i)
+		case r == '{' || r == '[':
+			out.WriteRune(r)
+			if r == '{' {
+				open = append(open, '}')
+			} else {
+				open = append(open, ']')
+			}
+		case r == '}' || r == ']':
+			if len(open) > 0 {
+				out.WriteByte(open[len(open)-1])
+				open = open[:len(open)-1]
+			}
+			if len(open) == 0 {
+				return out.String()
+			}
+		case r == ',':
+			if next := nextNonSpace(runes, i+1); next != '}' && next != ']' && next != 0 {
+				out.WriteRune(r)
+			}
+		case r == '_' || r == '$' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z'):
+			j := i
+			for j < len(runes) && (runes[j] == '_' || runes[j] == '$' || runes[j] == '-' ||
+				(runes[j] >= 'a' && runes[j] <= 'z') || (runes[j] >= 'A' && runes[j] <= 'Z') || (runes[j] >= '0' && runes[j] <= '9')) {
+				j++
+			}
+			word := string(runes[i:j])
+			switch {
+			case nextNonSpace(runes, j) == ':':
+				out.WriteString(`"` + word + `"`)
+			case word == "True" || word == "true":
+				out.WriteString("true")
+			case word == "False" || word == "false":
+				out.WriteString("false")
+			case word == "None" || word == "null":
+				out.WriteString("null")
+			default:
+				out.WriteString(word)
+			}
+			i = j - 1
+		default:
+			out.WriteRune(r)
+		}
+	}
+	// Cut off: close what is still open
+	for len(open) > 0 {
+		out.WriteByte(open[len(open)-1])
+		open = open[:len(open)-1]
+	}
+	return out.String()
+}
+
+// copyString writes the string starting at runes[start] as a JSON string
+// and returns the index of its closing quote. A string cut off is closed.
+func copyString(out *strings.Builder, runes []rune, start int) int {
+	quote := runes[start]
+	out.WriteByte('"')
+	for i := start + 1; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case r == '\\' && i+1 < len(runes):
+			if runes[i+1] == '\'' {
+				out.WriteRune('\'')
+			} else {
+				out.WriteRune(r)
+				out.WriteRune(runes[i+1])
+			}
+			i++
+		case r == quote:
+			out.WriteByte('"')
+			return i
+		case r == '"':
+			out.WriteString(`\"`)
+		case r == '\n':
+			out.WriteString(`\n`)
+		case r == '\r':
+			out.WriteString(`\r`)
+		case r == '\t':
+			out.WriteString(`\t`)
+		default:
+			out.WriteRune(r)
+		}
+	}
+	out.WriteByte('"')
+	return len(runes)
+}
+
+// nextNonSpace returns the first rune from runes[i] on that is not white
+// space, or 0 at the end.
+func nextNonSpace(runes []rune, i int) rune {
+	for ; i < len(runes); i++ {
+		switch runes[i] {
+		case ' ', '\t', '\n', '\r':
+			continue
+		}
+		return runes[i]
+	}
+	return 0
+}
@@ -0,0 +1,117 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestParseLenientJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+		want string
+	}{
+		{"valid", `{"query":"CA19-9"}`, `{"query":"CA19-9"}`},
+		{"code fence", "```json\n{\"query\": \"CA19-9\"}\n```", `{"query":"CA19-9"}`},
+		{"text around", `Arguments: {"query":"CA19-9"} as requested`, `{"query":"CA19-9"}`},
+		{"trailing commas", `{"ids":[1,2,],"n":3,}`, `{"ids":[1,2],"n":3}`},
+		{"single quotes", `{'query': 'it\'s "fine"'}`, `{"query":"it's \"fine\""}`},
+		{"unquoted keys", `{query: "胰腺癌", top_k: 5}`, `{"query":"胰腺癌","top_k":5}`},
+		{"python literals", `{"recent": True, "limit": None, "all": False}`, `{"all":false,"limit":null,"recent":true}`},
+		{"raw newline", "{\"text\":\"line one\nline two\"}", `{"text":"line one\nline two"}`},
+		{"cut off", `{"query":"gemcitabine","filters":{"year":2024`, `{"filters":{"year":2024},"query":"gemcitabine"}`},
+		{"cut off in string", `{"query":"gemcita`, `{"query":"gemcita"}`},
+		{"encoded twice", `"{\"query\":\"x\"}"`, `{"query":"x"}`},
+		{"braces in strings", `{"q":"a } b",}`, `{"q":"a } b"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseLenientJSON(tt.raw)
+			if err != nil {
+				t.Fatalf("parseLenientJSON(%q): %v", tt.raw, err)
+			}
+			var want map[string]interface{}
+			json.Unmarshal([]byte(tt.want), &want)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("parseLenientJSON(%q) = %v, want %v", tt.raw, got, want)
+			}
+		})
+	}
+
+	for _, raw := range []string{"", "query=x", `["a","b"]`, `{"a":}`} {
+		if got, err := parseLenientJSON(raw); err == nil {
+			t.Errorf("parseLenientJSON(%q) = %v, want an error", raw, got)
+		}
+	}
+}
+
+func TestRetryProvider_RepairsToolCalls(t *testing.T) {
+	reply := func(args string) string {
+		data, _ := json.Marshal(args)
+		return `{"choices":[{"message":{"content":"","tool_calls":[{"id":"c1","type":"function",` +
+			`"function":{"name":"knows_search","arguments":` + string(data) + `}}]},"finish_reason":"tool_calls"}],` +
+			`"usage":{"prompt_tokens":100,"completion_tokens":10,"total_tokens":110}}`
+	}
+	tests := []struct {
+		name      string
+		replies   []string
+		retries   int
+		wantCalls int
+		wantArgs  map[string]interface{}
+	}{
+		{"repaired locally", []string{`{query: 'CA19-9',}`}, 1, 1,
+			map[string]interface{}{"query": "CA19-9"}},
+		{"asked again", []string{`query=CA19-9`, `{"query":"CA19-9"}`}, 1, 2,
+			map[string]interface{}{"query": "CA19-9"}},
+		{"still broken", []string{`query=CA19-9`, `query=CA19-9`}, 1, 2,
+			map[string]interface{}{"raw": "query=CA19-9"}},
+		{"repair turned off", []string{`query=CA19-9`}, 0, 1,
+			map[string]interface{}{"raw": "query=CA19-9"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls int32
+			var retryPrompt string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := int(atomic.AddInt32(&calls, 1))
+				if n == 2 {
+					body, _ := io.ReadAll(r.Body)
+					retryPrompt = string(body)
+				}
+				w.Write([]byte(reply(tt.replies[min(n, len(tt.replies))-1])))
+			}))
+			defer server.Close()
+
+			p := NewRetryProvider(NewHTTPProvider("key", server.URL, ""), "test-repair-"+tt.name,
+				config.ProviderRetryConfig{ToolCallRetries: tt.retries})
+			resp, err := p.Chat(context.Background(), []Message{{Role: "user", Content: "CA19-9 是什么"}}, nil, "m", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if int(calls) != tt.wantCalls {
+				t.Errorf("calls = %d, want %d", calls, tt.wantCalls)
+			}
+			if len(resp.ToolCalls) != 1 || !reflect.DeepEqual(resp.ToolCalls[0].Arguments, tt.wantArgs) {
+				t.Fatalf("tool calls = %+v", resp.ToolCalls)
+			}
+			if broken := resp.ToolCalls[0].ArgumentsError != ""; broken != (tt.wantArgs["raw"] != nil) {
+				t.Errorf("ArgumentsError = %q", resp.ToolCalls[0].ArgumentsError)
+			}
+			if resp.Usage.PromptTokens != 100*tt.wantCalls {
+				t.Errorf("prompt tokens = %d, want the calls added up", resp.Usage.PromptTokens)
+			}
+			if tt.wantCalls > 1 && (!strings.Contains(retryPrompt, "not valid JSON") || !strings.Contains(retryPrompt, "knows_search")) {
+				t.Errorf("repair request = %s", retryPrompt)
+			}
+		})
+	}
+}
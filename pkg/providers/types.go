@@ -14,12 +14,28 @@ type UsageInfo = protocoltypes.UsageInfo
 type Message = protocoltypes.Message
 type ToolDefinition = protocoltypes.ToolDefinition
 type ToolFunctionDefinition = protocoltypes.ToolFunctionDefinition
+type StreamChunk = protocoltypes.StreamChunk
+type ToolCallDelta = protocoltypes.ToolCallDelta
+type ImageContent = protocoltypes.ImageContent
+type ThinkingBlock = protocoltypes.ThinkingBlock
 
 type LLMProvider interface {
 	Chat(ctx context.Context, messages []Message, tools []ToolDefinition, model string, options map[string]interface{}) (*LLMResponse, error)
 	GetDefaultModel() string
 }
 
+// StreamFunc receives the chunks of a streamed reply, in order.
+type StreamFunc func(StreamChunk)
+
+// StreamingProvider is a provider that can deliver a reply while the model
+// generates it. ChatStream passes each chunk to onChunk, which may be nil,
+// and returns the whole reply as Chat would. Use ChatStream (the function)
+// to stream from any provider.
+type StreamingProvider interface {
+	LLMProvider
+	ChatStream(ctx context.Context, messages []Message, tools []ToolDefinition, model string, options map[string]interface{}, onChunk StreamFunc) (*LLMResponse, error)
+}
+
 // FailoverReason classifies why an LLM request failed for fallback decisions.
 type FailoverReason string
 
@@ -31,6 +47,10 @@ const (
 	FailoverFormat     FailoverReason = "format"
 	FailoverOverloaded FailoverReason = "overloaded"
 	FailoverUnknown    FailoverReason = "unknown"
+	// FailoverContentFilter is a request the provider's content filter
+	// refused. Another provider may answer it, but the refusing one is
+	// not put in cooldown, since other requests are unaffected.
+	FailoverContentFilter FailoverReason = "content_filter"
 )
 
 // FailoverError wraps an LLM provider error with classification metadata.
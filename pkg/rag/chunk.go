@@ -0,0 +1,163 @@
+package rag
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Section is a piece of source text, usually a page, that chunks must not
+// cross so each chunk can cite one page.
+type Section struct {
+	Page int
+	Text string
+}
+
+// piece is a paragraph, or a sentence of a paragraph too long for a chunk.
+type piece struct {
+	text      string
+	paragraph bool // starts a paragraph
+}
+
+// ChunkSections splits sections into chunks of at most size characters,
+// breaking between paragraphs, then sentences, where it can. Each chunk
+// after the first in a section repeats about overlap characters from the
+// end of the previous one, so a passage cut at a boundary is still found.
+func ChunkSections(sections []Section, size, overlap int) []Chunk {
+	if size <= 0 {
+		size = 1200
+	}
+	if overlap < 0 || overlap >= size {
+		overlap = 0
+	}
+	var chunks []Chunk
+	for _, sec := range sections {
+		var cur strings.Builder
+		curLen := 0
+		emit := func() {
+			if text := strings.TrimSpace(cur.String()); text != "" {
+				chunks = append(chunks, Chunk{Index: len(chunks), Page: sec.Page, Text: text})
+			}
+			cur.Reset()
+			curLen = 0
+		}
+		for _, p := range splitPieces(sec.Text, size-overlap) {
+			n := utf8.RuneCountInString(p.text)
+			if curLen > 0 && curLen+n+1 > size {
+				prev := cur.String()
+				emit()
+				if tail := overlapTail(prev, overlap); tail != "" {
+					cur.WriteString(tail)
+					curLen = utf8.RuneCountInString(tail)
+				}
+			}
+			if curLen > 0 {
+				if p.paragraph {
+					cur.WriteString("\n\n")
+					curLen += 2
+				} else {
+					cur.WriteByte(' ')
+					curLen++
+				}
+			}
+			cur.WriteString(p.text)
+			curLen += n
+		}
+		emit()
+	}
+	return chunks
+}
+
+// splitPieces splits text into paragraphs, and paragraphs longer than max
+// into sentences, cutting any sentence that is still too long.
+func splitPieces(text string, max int) []piece {
+	var out []piece
+	for _, para := range strings.Split(text, "\n\n") {
+		para = strings.TrimSpace(para)
+		if para == "" {
+			continue
+		}
+		if utf8.RuneCountInString(para) <= max {
+			out = append(out, piece{text: para, paragraph: true})
+			continue
+		}
+		first := true
+		for _, sentence := range splitSentences(para) {
+			for _, part := range cutRunes(sentence, max) {
+				out = append(out, piece{text: part, paragraph: first})
+				first = false
+			}
+		}
+	}
+	return out
+}
+
+// splitSentences splits after sentence-ending punctuation, Western or
+// Chinese, and at line breaks.
+func splitSentences(text string) []string {
+	var out []string
+	start := 0
+	runes := []rune(text)
+	for i, r := range runes {
+		end := false
+		switch r {
+		case '。', '！', '？', '；', '\n':
+			end = true
+		case '.', '!', '?':
+			end = i+1 == len(runes) || unicode.IsSpace(runes[i+1])
+		}
+		if end {
+			if s := strings.TrimSpace(string(runes[start : i+1])); s != "" {
+				out = append(out, s)
+			}
+			start = i + 1
+		}
+	}
+	if s := strings.TrimSpace(string(runes[start:])); s != "" {
+		out = append(out, s)
+	}
+	return out
+}
+
+func cutRunes(s string, max int) []string {
+	runes := []rune(s)
+	if len(runes) <= max {
+		return []string{s}
+	}
+	var out []string
+	for len(runes) > max {
+		cut := max
+		// Prefer to cut at a space in the second half.
+		for i := max; i > max/2; i-- {
+			if unicode.IsSpace(runes[i]) {
+				cut = i
+				break
+			}
+		}
+		out = append(out, strings.TrimSpace(string(runes[:cut])))
+		runes = runes[cut:]
+	}
+	if s := strings.TrimSpace(string(runes)); s != "" {
+		out = append(out, s)
+	}
+	return out
+}
+
+// overlapTail returns about the last n characters of s, starting at a word
+// boundary when there is one.
+func overlapTail(s string, n int) string {
+	runes := []rune(s)
+	if n <= 0 || len(runes) == 0 {
+		return ""
+	}
+	if len(runes) <= n {
+		return strings.TrimSpace(s)
+	}
+	tail := runes[len(runes)-n:]
+	for i, r := range tail {
+		if unicode.IsSpace(r) && i < len(tail)/2 {
+			return strings.TrimSpace(string(tail[i:]))
+		}
+	}
+	return strings.TrimSpace(string(tail))
+}
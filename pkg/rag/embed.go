@@ -0,0 +1,307 @@
+package rag
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// Embedder turns texts into vectors for semantic search.
+type Embedder interface {
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+}
+
+// OpenAIEmbedder calls an OpenAI-compatible /embeddings endpoint, as
+// served by OpenAI, SiliconFlow, Zhipu, Ollama and vLLM. Texts are sent in
+// batches as large as the provider allows, several batches at a time, and
+// rate limits and server errors are retried.
+type OpenAIEmbedder struct {
+	apiBase     string
+	apiKey      string
+	model       string
+	dimensions  int
+	batchSize   int
+	batchChars  int
+	concurrency int
+	httpClient  *http.Client
+}
+
+// EmbedderOptions configures an OpenAIEmbedder.
+type EmbedderOptions struct {
+	APIBase string
+	APIKey  string
+	Model   string
+	// Dimensions asks models that support it for shorter vectors; zero
+	// keeps the model's own size.
+	Dimensions int
+	// BatchSize is how many texts are sent in one request; zero, or more
+	// than the provider takes, sends as many as it takes.
+	BatchSize int
+	// Concurrency is how many requests are in flight at once (default 4).
+	Concurrency int
+	Timeout     time.Duration
+}
+
+// embeddingLimit is the most texts, and characters in all, that one
+// request to an embedding API may carry.
+type embeddingLimit struct {
+	texts int
+	chars int
+}
+
+// embeddingLimits are the limits of the APIs known to cap requests, by
+// host. Characters stand in for tokens, at no more than one token each.
+var embeddingLimits = map[string]embeddingLimit{
+	"api.openai.com":         {texts: 2048, chars: 250000},
+	"dashscope.aliyuncs.com": {texts: 10, chars: 60000},
+	"open.bigmodel.cn":       {texts: 64, chars: 60000},
+	"api.siliconflow.cn":     {texts: 32, chars: 60000},
+}
+
+// defaultEmbeddingLimit is used for other hosts, such as a local server.
+var defaultEmbeddingLimit = embeddingLimit{texts: 32, chars: 60000}
+
+const (
+	defaultEmbedConcurrency = 4
+	// embedRetries is how many times a batch that hit a rate limit or a
+	// server error is sent again.
+	embedRetries = 3
+	maxEmbedWait = 30 * time.Second
+)
+
+// NewEmbedder returns the embedder configured by emb, with its
+// embeddings cached in cachePath unless the cache is off or cannot be
+// opened.
+func NewEmbedder(emb config.EmbeddingConfig, cachePath string) Embedder {
+	embedder := NewOpenAIEmbedder(EmbedderOptions{
+		APIBase:     emb.APIBase,
+		APIKey:      emb.APIKey,
+		Model:       emb.Model,
+		Dimensions:  emb.Dimensions,
+		BatchSize:   emb.BatchSize,
+		Concurrency: emb.Concurrency,
+		Timeout:     time.Duration(emb.TimeoutSeconds) * time.Second,
+	})
+	if emb.CacheEntries <= 0 || cachePath == "" {
+		return embedder
+	}
+	cache, err := OpenEmbeddingCache(cachePath, emb.CacheEntries)
+	if err != nil {
+		logger.WarnCF("rag", "Embedding cache disabled", map[string]interface{}{
+			"path":  cachePath,
+			"error": err.Error(),
+		})
+		return embedder
+	}
+	return NewCachedEmbedder(embedder, cache, emb.Model, emb.Dimensions)
+}
+
+func NewOpenAIEmbedder(opts EmbedderOptions) *OpenAIEmbedder {
+	apiBase := strings.TrimRight(opts.APIBase, "/")
+	limit := defaultEmbeddingLimit
+	if u, err := url.Parse(apiBase); err == nil {
+		if l, ok := embeddingLimits[u.Hostname()]; ok {
+			limit = l
+		}
+	}
+	if opts.BatchSize <= 0 || opts.BatchSize > limit.texts {
+		opts.BatchSize = limit.texts
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = defaultEmbedConcurrency
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 30 * time.Second
+	}
+	return &OpenAIEmbedder{
+		apiBase:     apiBase,
+		apiKey:      opts.APIKey,
+		model:       opts.Model,
+		dimensions:  opts.Dimensions,
+		batchSize:   opts.BatchSize,
+		batchChars:  limit.chars,
+		concurrency: opts.Concurrency,
+		httpClient:  &http.Client{Timeout: opts.Timeout},
+	}
+}
+
+func (e *OpenAIEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	if len(texts) == 0 {
+		return [][]float32{}, nil
+	}
+	batches := e.batches(texts)
+	if len(batches) == 1 {
+		return e.embedWithRetry(ctx, texts)
+	}
+
+	out := make([][]float32, len(texts))
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+	slots := make(chan struct{}, e.concurrency)
+	for _, b := range batches {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func(b [2]int) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			vectors, err := e.embedWithRetry(ctx, texts[b[0]:b[1]])
+			if err != nil {
+				errOnce.Do(func() {
+					firstErr = err
+					cancel()
+				})
+				return
+			}
+			copy(out[b[0]:b[1]], vectors)
+		}(b)
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// batches splits texts into the [start, end) ranges sent in one request
+// each, within the batch size and the provider's character limit.
+func (e *OpenAIEmbedder) batches(texts []string) [][2]int {
+	var out [][2]int
+	start, chars := 0, 0
+	for i, text := range texts {
+		n := utf8.RuneCountInString(text)
+		if i > start && (i-start >= e.batchSize || chars+n > e.batchChars) {
+			out = append(out, [2]int{start, i})
+			start, chars = i, 0
+		}
+		chars += n
+	}
+	return append(out, [2]int{start, len(texts)})
+}
+
+// embedWithRetry embeds one batch, waiting out rate limits and server
+// errors as long as Retry-After asks, or 1, 2 then 4 seconds.
+func (e *OpenAIEmbedder) embedWithRetry(ctx context.Context, texts []string) ([][]float32, error) {
+	for attempt := 0; ; attempt++ {
+		vectors, err := e.embedBatch(ctx, texts)
+		var apiErr *embeddingAPIError
+		if err == nil || attempt == embedRetries || !errors.As(err, &apiErr) || !apiErr.retryable() {
+			return vectors, err
+		}
+		wait := apiErr.retryAfter
+		if wait < 0 {
+			wait = time.Second << attempt
+		}
+		if wait > maxEmbedWait {
+			return nil, err
+		}
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// embeddingAPIError is an error status from the embedding API.
+type embeddingAPIError struct {
+	status     int
+	message    string
+	retryAfter time.Duration // -1 when the API did not say
+}
+
+func (e *embeddingAPIError) Error() string {
+	return fmt.Sprintf("embedding API returned %d: %s", e.status, e.message)
+}
+
+func (e *embeddingAPIError) retryable() bool {
+	return e.status == http.StatusTooManyRequests || e.status >= 500
+}
+
+func (e *OpenAIEmbedder) embedBatch(ctx context.Context, texts []string) ([][]float32, error) {
+	body := map[string]interface{}{"model": e.model, "input": texts}
+	if e.dimensions > 0 {
+		body["dimensions"] = e.dimensions
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.apiBase+"/embeddings", bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if e.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+e.apiKey)
+	}
+
+	resp, err := e.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("embedding request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, 64<<20))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read embedding response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		msg := strings.TrimSpace(string(raw))
+		if len(msg) > 300 {
+			msg = msg[:300]
+		}
+		apiErr := &embeddingAPIError{status: resp.StatusCode, message: msg, retryAfter: -1}
+		if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+			apiErr.retryAfter = time.Duration(secs) * time.Second
+		}
+		return nil, apiErr
+	}
+
+	var parsed struct {
+		Data []struct {
+			Index     int       `json:"index"`
+			Embedding []float32 `json:"embedding"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(raw, &parsed); err != nil {
+		return nil, fmt.Errorf("invalid embedding response: %w", err)
+	}
+	if len(parsed.Data) != len(texts) {
+		return nil, fmt.Errorf("embedding API returned %d vectors for %d texts", len(parsed.Data), len(texts))
+	}
+	vectors := make([][]float32, len(texts))
+	for _, d := range parsed.Data {
+		if d.Index < 0 || d.Index >= len(texts) || len(d.Embedding) == 0 {
+			return nil, fmt.Errorf("embedding API returned an invalid vector at index %d", d.Index)
+		}
+		vectors[d.Index] = d.Embedding
+	}
+	return vectors, nil
+}
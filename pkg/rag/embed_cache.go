@@ -0,0 +1,245 @@
+package rag
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+)
+
+// EmbeddingCache keeps embeddings by a hash of the model and the text, so
+// text embedded once, such as a guideline ingested again after an edit or
+// a question asked again, is not sent to the API again. Entries are
+// appended to a JSON lines file and the oldest are dropped past
+// maxEntries.
+type EmbeddingCache struct {
+	path       string
+	maxEntries int
+
+	mu      sync.Mutex
+	vectors map[string][]float32
+	order   []string // keys, oldest first
+	lines   int      // lines in the file, dropped entries included
+}
+
+type cacheLine struct {
+	Key    string `json:"k"`
+	Vector string `json:"v"` // little-endian float32s, base64-encoded
+}
+
+var (
+	embeddingCachesMu sync.Mutex
+	embeddingCaches   = map[string]*EmbeddingCache{}
+)
+
+// OpenEmbeddingCache opens the cache at path, shared by every embedder
+// using it.
+func OpenEmbeddingCache(path string, maxEntries int) (*EmbeddingCache, error) {
+	embeddingCachesMu.Lock()
+	defer embeddingCachesMu.Unlock()
+	if c, ok := embeddingCaches[path]; ok {
+		return c, nil
+	}
+	c := &EmbeddingCache{path: path, maxEntries: maxEntries, vectors: map[string][]float32{}}
+	if err := c.load(); err != nil {
+		return nil, err
+	}
+	embeddingCaches[path] = c
+	return c, nil
+}
+
+func (c *EmbeddingCache) load() error {
+	f, err := os.Open(c.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		c.lines++
+		var line cacheLine
+		if json.Unmarshal(scanner.Bytes(), &line) != nil {
+			continue // a line cut off by a crash
+		}
+		buf, err := base64.StdEncoding.DecodeString(line.Vector)
+		if err != nil || len(buf) == 0 || len(buf)%4 != 0 {
+			continue
+		}
+		c.add(line.Key, decodeVector(buf))
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if c.lines > len(c.vectors)+c.maxEntries/2 {
+		return c.compact()
+	}
+	return nil
+}
+
+// Len returns the number of cached embeddings.
+func (c *EmbeddingCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.vectors)
+}
+
+func (c *EmbeddingCache) get(key string) ([]float32, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	v, ok := c.vectors[key]
+	return append([]float32(nil), v...), ok
+}
+
+// put adds entries and appends them to the file.
+func (c *EmbeddingCache) put(keys []string, vectors [][]float32) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var buf []byte
+	for i, key := range keys {
+		if _, ok := c.vectors[key]; ok {
+			continue
+		}
+		c.add(key, vectors[i])
+		data, _ := json.Marshal(cacheLine{Key: key, Vector: base64.StdEncoding.EncodeToString(encodeVector(vectors[i]))})
+		buf = append(append(buf, data...), '\n')
+		c.lines++
+	}
+	if len(buf) == 0 {
+		return nil
+	}
+	if c.lines > len(c.vectors)+c.maxEntries/2 {
+		return c.compact()
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(c.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(buf); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// add keeps vector under key, dropping the oldest entry when full.
+func (c *EmbeddingCache) add(key string, vector []float32) {
+	if _, ok := c.vectors[key]; !ok {
+		c.order = append(c.order, key)
+	}
+	c.vectors[key] = vector
+	for len(c.order) > c.maxEntries {
+		delete(c.vectors, c.order[0])
+		c.order = c.order[1:]
+	}
+}
+
+// compact rewrites the file with the entries kept.
+func (c *EmbeddingCache) compact() error {
+	if err := os.MkdirAll(filepath.Dir(c.path), 0700); err != nil {
+		return err
+	}
+	tmp := c.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	for _, key := range c.order {
+		data, _ := json.Marshal(cacheLine{Key: key, Vector: base64.StdEncoding.EncodeToString(encodeVector(c.vectors[key]))})
+		w.Write(append(data, '\n'))
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	c.lines = len(c.order)
+	return os.Rename(tmp, c.path)
+}
+
+// encodeVector packs v as little-endian float32s.
+func encodeVector(v []float32) []byte {
+	buf := make([]byte, 4*len(v))
+	for i, x := range v {
+		binary.LittleEndian.PutUint32(buf[4*i:], math.Float32bits(x))
+	}
+	return buf
+}
+
+func decodeVector(buf []byte) []float32 {
+	v := make([]float32, len(buf)/4)
+	for i := range v {
+		v[i] = math.Float32frombits(binary.LittleEndian.Uint32(buf[4*i:]))
+	}
+	return v
+}
+
+// CachedEmbedder embeds through next only the texts its cache does not
+// hold. Texts repeated within one call are embedded once.
+type CachedEmbedder struct {
+	next  Embedder
+	cache *EmbeddingCache
+	// scope keeps the vectors of different models and sizes apart.
+	scope string
+}
+
+// NewCachedEmbedder caches the embeddings of next, made by model at the
+// given dimensions, in cache.
+func NewCachedEmbedder(next Embedder, cache *EmbeddingCache, model string, dimensions int) *CachedEmbedder {
+	return &CachedEmbedder{next: next, cache: cache, scope: model + "\x00" + strconv.Itoa(dimensions)}
+}
+
+func (e *CachedEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	out := make([][]float32, len(texts))
+	keys := make([]string, len(texts))
+	missing := map[string][]int{} // key of a text to embed: where it goes
+	var missKeys []string
+	var missTexts []string
+	for i, text := range texts {
+		sum := sha256.Sum256([]byte(e.scope + "\x00" + text))
+		keys[i] = hex.EncodeToString(sum[:16])
+		if v, ok := e.cache.get(keys[i]); ok {
+			out[i] = v
+			continue
+		}
+		if _, ok := missing[keys[i]]; !ok {
+			missKeys = append(missKeys, keys[i])
+			missTexts = append(missTexts, text)
+		}
+		missing[keys[i]] = append(missing[keys[i]], i)
+	}
+	if len(missTexts) == 0 {
+		return out, nil
+	}
+
+	vectors, err := e.next.Embed(ctx, missTexts)
+	if err != nil {
+		return nil, err
+	}
+	for j, key := range missKeys {
+		for _, i := range missing[key] {
+			out[i] = vectors[j]
+		}
+	}
+	// A cache that cannot be written only costs the next call
+	e.cache.put(missKeys, vectors)
+	return out, nil
+}
@@ -0,0 +1,81 @@
+package rag
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCachedEmbedder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "embeddings.jsonl")
+	inner := &keywordEmbedder{keywords: []string{"ca19-9", "gemcitabine"}}
+	cache, err := OpenEmbeddingCache(path, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := NewCachedEmbedder(inner, cache, "bge-m3", 0)
+	ctx := context.Background()
+
+	first, err := e.Embed(ctx, []string{"CA19-9 rising", "gemcitabine dose", "CA19-9 rising"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inner.calls != 1 || cache.Len() != 2 {
+		t.Fatalf("calls = %d, cached = %d; want one call for two distinct texts", inner.calls, cache.Len())
+	}
+	if !reflect.DeepEqual(first[0], first[2]) {
+		t.Errorf("repeated text embedded differently: %v, %v", first[0], first[2])
+	}
+
+	// Only the new text is embedded
+	again, err := e.Embed(ctx, []string{"gemcitabine dose", "CA19-9 and gemcitabine"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inner.calls != 2 || !reflect.DeepEqual(again[0], first[1]) {
+		t.Errorf("calls = %d, vector = %v", inner.calls, again[0])
+	}
+
+	// Another model does not share the vectors
+	other := NewCachedEmbedder(inner, cache, "embedding-3", 0)
+	other.Embed(ctx, []string{"gemcitabine dose"})
+	if inner.calls != 3 {
+		t.Errorf("calls = %d, want the other model's text embedded", inner.calls)
+	}
+
+	// The file is read back, as by a restart
+	reloaded := &EmbeddingCache{path: path, maxEntries: 100, vectors: map[string][]float32{}}
+	if err := reloaded.load(); err != nil {
+		t.Fatal(err)
+	}
+	if reloaded.Len() != 4 {
+		t.Errorf("reloaded %d embeddings, want 4", reloaded.Len())
+	}
+	fresh := &keywordEmbedder{keywords: inner.keywords}
+	got, _ := NewCachedEmbedder(fresh, reloaded, "bge-m3", 0).Embed(ctx, []string{"CA19-9 rising"})
+	if fresh.calls != 0 || !reflect.DeepEqual(got[0], first[0]) {
+		t.Errorf("calls = %d, vector = %v after reload", fresh.calls, got)
+	}
+}
+
+func TestEmbeddingCache_DropsOldest(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "embeddings.jsonl")
+	cache := &EmbeddingCache{path: path, maxEntries: 2, vectors: map[string][]float32{}}
+	for _, key := range []string{"a", "b", "c", "d"} {
+		if err := cache.put([]string{key}, [][]float32{{1}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, ok := cache.get("b"); ok || cache.Len() != 2 {
+		t.Errorf("kept %d entries, b kept: %v", cache.Len(), ok)
+	}
+
+	reloaded := &EmbeddingCache{path: path, maxEntries: 2, vectors: map[string][]float32{}}
+	if err := reloaded.load(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := reloaded.get("d"); !ok || reloaded.Len() != 2 || reloaded.lines > 3 {
+		t.Errorf("reloaded %d entries from %d lines", reloaded.Len(), reloaded.lines)
+	}
+}
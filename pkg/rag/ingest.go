@@ -0,0 +1,275 @@
+package rag
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/sipeed/picoclaw/pkg/pdftext"
+)
+
+// SourceObject is a file in a document source.
+type SourceObject struct {
+	// Location identifies the file, such as its path or s3:// URL, and is
+	// kept as the document's Source.
+	Location string
+	// Version changes whenever the file does, such as its modification
+	// time or ETag.
+	Version string
+	Size    int64
+}
+
+// DocumentSource is a directory or bucket prefix of curated documents.
+type DocumentSource interface {
+	// Root is the location every object's Location starts with.
+	Root() string
+	// List returns the Markdown, text and PDF files of the source.
+	List(ctx context.Context) ([]SourceObject, error)
+	Read(ctx context.Context, obj SourceObject) ([]byte, error)
+}
+
+// ingestExtensions are the file types read from document sources.
+var ingestExtensions = map[string]bool{
+	".md":       true,
+	".markdown": true,
+	".txt":      true,
+	".pdf":      true,
+}
+
+// Ingestable reports whether a file with this name is read from document
+// sources.
+func Ingestable(name string) bool {
+	return ingestExtensions[strings.ToLower(filepath.Ext(name))]
+}
+
+// IngestOptions configures an Ingester.
+type IngestOptions struct {
+	ChunkChars   int
+	ChunkOverlap int
+	// MaxFileBytes skips larger files; 0 means no limit.
+	MaxFileBytes int64
+}
+
+// IngestStats counts what a sync changed.
+type IngestStats struct {
+	Added     int
+	Removed   int
+	Unchanged int
+	// Failed maps the files that could not be indexed to the reason.
+	Failed map[string]string
+}
+
+// Ingester keeps a store in step with document sources: new and changed
+// files are indexed as shared documents, and the documents of deleted
+// files are removed.
+type Ingester struct {
+	store   *Store
+	sources []DocumentSource
+	opts    IngestOptions
+}
+
+func NewIngester(store *Store, sources []DocumentSource, opts IngestOptions) *Ingester {
+	return &Ingester{store: store, sources: sources, opts: opts}
+}
+
+// Sync indexes every source once. A source that cannot be listed is left
+// as it was, so an unreachable bucket does not empty the index; its error
+// is returned after the other sources are synced.
+func (in *Ingester) Sync(ctx context.Context) (IngestStats, error) {
+	stats := IngestStats{Failed: make(map[string]string)}
+	var errs []error
+	for _, src := range in.sources {
+		if err := in.syncSource(ctx, src, &stats); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", src.Root(), err))
+		}
+	}
+	return stats, errors.Join(errs...)
+}
+
+func (in *Ingester) syncSource(ctx context.Context, src DocumentSource, stats *IngestStats) error {
+	objects, err := src.List(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Documents indexed from this source, by location.
+	indexed := make(map[string][]string)
+	for _, doc := range in.store.List("") {
+		if doc.Shared && strings.HasPrefix(doc.Source, src.Root()) {
+			indexed[doc.Source] = append(indexed[doc.Source], doc.ID)
+		}
+	}
+
+	for _, obj := range objects {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		id := sourceDocumentID(obj)
+		current := indexed[obj.Location]
+		delete(indexed, obj.Location)
+		if _, ok := in.store.Get(id); ok {
+			stats.Unchanged++
+			in.removeOthers(current, id, stats)
+			continue
+		}
+		if err := in.add(ctx, src, obj, id); err != nil {
+			stats.Failed[obj.Location] = err.Error()
+			// Keep serving the previous version until the new one reads.
+			continue
+		}
+		stats.Added++
+		in.removeOthers(current, id, stats)
+	}
+
+	// What is left belongs to files that are gone.
+	for _, ids := range indexed {
+		in.removeOthers(ids, "", stats)
+	}
+	return nil
+}
+
+// removeOthers deletes the documents in ids other than keep.
+func (in *Ingester) removeOthers(ids []string, keep string, stats *IngestStats) {
+	for _, id := range ids {
+		if id == keep {
+			continue
+		}
+		if err := in.store.Delete(id); err != nil {
+			stats.Failed[id] = err.Error()
+			continue
+		}
+		stats.Removed++
+	}
+}
+
+func (in *Ingester) add(ctx context.Context, src DocumentSource, obj SourceObject, id string) error {
+	if in.opts.MaxFileBytes > 0 && obj.Size > in.opts.MaxFileBytes {
+		return fmt.Errorf("file is larger than %d MB", in.opts.MaxFileBytes>>20)
+	}
+	data, err := src.Read(ctx, obj)
+	if err != nil {
+		return err
+	}
+	sections, title, err := fileSections(data, obj.Location)
+	if err != nil {
+		return err
+	}
+	chunks := ChunkSections(sections, in.opts.ChunkChars, in.opts.ChunkOverlap)
+	if len(chunks) == 0 {
+		return fmt.Errorf("the file has no text")
+	}
+	return in.store.Add(&Document{
+		ID:      id,
+		Title:   title,
+		Source:  obj.Location,
+		Shared:  true,
+		Pages:   len(sections),
+		Chunks:  chunks,
+		AddedAt: time.Now(),
+	})
+}
+
+// sourceDocumentID derives a document's ID from the file's location and
+// version, so unchanged files are recognized without reading them.
+func sourceDocumentID(obj SourceObject) string {
+	return DocumentID([]byte(obj.Location+"\x00"+obj.Version), "", true)
+}
+
+// fileSections extracts the text of a source file: PDFs page by page, and
+// Markdown and text whole. The title is the PDF's title or the first
+// Markdown heading, falling back to the file name.
+func fileSections(data []byte, location string) ([]Section, string, error) {
+	name := location
+	if i := strings.LastIndexAny(name, `/\`); i >= 0 {
+		name = name[i+1:]
+	}
+	title := strings.TrimSuffix(name, filepath.Ext(name))
+
+	if strings.EqualFold(filepath.Ext(name), ".pdf") {
+		extracted, err := pdftext.Extract(data)
+		if err != nil {
+			return nil, "", err
+		}
+		sections := make([]Section, 0, len(extracted.Pages))
+		for _, p := range extracted.Pages {
+			sections = append(sections, Section{Page: p.Number, Text: p.Text})
+		}
+		if extracted.Title != "" {
+			title = extracted.Title
+		}
+		return sections, title, nil
+	}
+
+	if !utf8.Valid(data) {
+		return nil, "", fmt.Errorf("the file is not UTF-8 text")
+	}
+	text := string(data)
+	for _, line := range strings.Split(text, "\n") {
+		if heading, ok := strings.CutPrefix(strings.TrimSpace(line), "# "); ok && strings.TrimSpace(heading) != "" {
+			title = strings.TrimSpace(heading)
+			break
+		}
+	}
+	return []Section{{Text: text}}, title, nil
+}
+
+// DirSource is a local directory of documents, read recursively. Hidden
+// files and directories are skipped.
+type DirSource struct {
+	dir string
+}
+
+// NewDirSource returns the source for dir, which is made absolute.
+func NewDirSource(dir string) (*DirSource, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	return &DirSource{dir: abs}, nil
+}
+
+func (s *DirSource) Root() string {
+	return s.dir + string(filepath.Separator)
+}
+
+func (s *DirSource) List(ctx context.Context) ([]SourceObject, error) {
+	if _, err := os.Stat(s.dir); err != nil {
+		return nil, err
+	}
+	var objects []SourceObject
+	err := filepath.WalkDir(s.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path != s.dir && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() || !Ingestable(d.Name()) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		objects = append(objects, SourceObject{
+			Location: path,
+			Version:  fmt.Sprintf("%d-%d", info.ModTime().UnixNano(), info.Size()),
+			Size:     info.Size(),
+		})
+		return nil
+	})
+	return objects, err
+}
+
+func (s *DirSource) Read(ctx context.Context, obj SourceObject) ([]byte, error) {
+	return os.ReadFile(obj.Location)
+}
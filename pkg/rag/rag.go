@@ -0,0 +1,152 @@
+// Package rag keeps a local index of documents ingested by the agent, such
+// as guidelines, consent forms and discharge summaries, split into chunks
+// that can be retrieved by keyword search.
+package rag
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Document is an ingested document and its chunks.
+type Document struct {
+	ID     string `json:"id"`
+	Title  string `json:"title"`
+	Source string `json:"source"`
+	// Owner is the user who ingested the document. Unless Shared is set,
+	// only they can search it.
+	Owner   string    `json:"owner,omitempty"`
+	Shared  bool      `json:"shared,omitempty"`
+	Pages   int       `json:"pages"`
+	Chunks  []Chunk   `json:"chunks"`
+	AddedAt time.Time `json:"added_at"`
+}
+
+// VisibleTo reports whether user may search the document.
+func (d *Document) VisibleTo(user string) bool {
+	return d.Shared || d.Owner == "" || d.Owner == user
+}
+
+// Chunk is a retrievable piece of a document.
+type Chunk struct {
+	Index int    `json:"index"`
+	Page  int    `json:"page"`
+	Text  string `json:"text"`
+}
+
+// DocumentID derives a stable ID from a document's content, so ingesting
+// the same file twice finds the existing entry. Private documents include
+// the owner, so two users' copies are kept apart.
+func DocumentID(content []byte, owner string, shared bool) string {
+	h := sha256.New()
+	if !shared {
+		h.Write([]byte(owner))
+		h.Write([]byte{0})
+	}
+	h.Write(content)
+	return "doc-" + hex.EncodeToString(h.Sum(nil))[:12]
+}
+
+// Store holds the documents of one workspace, one JSON file per document.
+type Store struct {
+	dir  string
+	mu   sync.RWMutex
+	docs map[string]*indexedDocument
+}
+
+// Open loads the documents stored in dir, creating it if needed.
+func Open(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create document store: %w", err)
+	}
+	s := &Store{dir: dir, docs: make(map[string]*indexedDocument)}
+	files, err := filepath.Glob(filepath.Join(dir, "doc-*.json"))
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", file, err)
+		}
+		var doc Document
+		if err := json.Unmarshal(data, &doc); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", file, err)
+		}
+		s.docs[doc.ID] = newIndexedDocument(&doc)
+	}
+	return s, nil
+}
+
+// Add stores a document, replacing any with the same ID.
+func (s *Store) Add(doc *Document) error {
+	if !strings.HasPrefix(doc.ID, "doc-") || strings.ContainsAny(doc.ID, `/\.`) {
+		return fmt.Errorf("invalid document ID %q", doc.ID)
+	}
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	path := filepath.Join(s.dir, doc.ID+".json")
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write document: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write document: %w", err)
+	}
+	s.docs[doc.ID] = newIndexedDocument(doc)
+	return nil
+}
+
+// Get returns the document with the given ID.
+func (s *Store) Get(id string) (*Document, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	d, ok := s.docs[id]
+	if !ok {
+		return nil, false
+	}
+	return d.Document, true
+}
+
+// List returns the documents visible to user, newest first.
+func (s *Store) List(user string) []*Document {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var out []*Document
+	for _, d := range s.docs {
+		if d.VisibleTo(user) {
+			out = append(out, d.Document)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].AddedAt.After(out[j].AddedAt) })
+	return out
+}
+
+// Delete removes the document with the given ID. Deleting a missing
+// document is not an error.
+func (s *Store) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.docs[id]; !ok {
+		return nil
+	}
+	if err := os.Remove(filepath.Join(s.dir, id+".json")); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete document: %w", err)
+	}
+	delete(s.docs, id)
+	return nil
+}
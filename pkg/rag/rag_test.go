@@ -0,0 +1,131 @@
+package rag
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"CA 19-9 > 37 U/mL", []string{"ca", "19", "9", "37", "u", "ml"}},
+		{"胰腺癌化疗", []string{"胰腺", "腺癌", "癌化", "化疗"}},
+		{"PERT剂量: 25,000", []string{"pert", "剂量", "25", "000"}},
+		{"癌", []string{"癌"}},
+	}
+	for _, tt := range tests {
+		if got := tokenize(tt.text); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("tokenize(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestChunkSections(t *testing.T) {
+	long := strings.Repeat("Pancreatic enzyme dosing depends on fat intake. ", 10)
+	chunks := ChunkSections([]Section{
+		{Page: 1, Text: "Short first paragraph.\n\nSecond paragraph."},
+		{Page: 2, Text: long},
+	}, 120, 30)
+
+	if chunks[0].Page != 1 || chunks[0].Text != "Short first paragraph.\n\nSecond paragraph." {
+		t.Errorf("first chunk = %+v", chunks[0])
+	}
+	if len(chunks) < 4 {
+		t.Fatalf("got %d chunks, want the long page split", len(chunks))
+	}
+	for i, c := range chunks {
+		if c.Index != i {
+			t.Errorf("chunk %d has index %d", i, c.Index)
+		}
+		if n := utf8.RuneCountInString(c.Text); n > 121 {
+			t.Errorf("chunk %d is %d characters", i, n)
+		}
+		if i > 1 {
+			if c.Page != 2 {
+				t.Errorf("chunk %d page = %d, want 2", i, c.Page)
+			}
+			// Overlap: each chunk starts with the end of the previous one.
+			prev := chunks[i-1].Text
+			if !strings.Contains(prev, strings.SplitN(c.Text, ".", 2)[0]) {
+				t.Errorf("chunk %d does not overlap the previous one: %q / %q", i, prev, c.Text)
+			}
+		}
+	}
+
+	cjk := strings.Repeat("胰酶应随餐服用。", 30)
+	for _, c := range ChunkSections([]Section{{Page: 1, Text: cjk}}, 50, 10) {
+		if n := utf8.RuneCountInString(c.Text); n > 51 {
+			t.Errorf("CJK chunk is %d characters", n)
+		}
+	}
+}
+
+func TestStore(t *testing.T) {
+	dir := t.TempDir()
+	store, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Open() error: %v", err)
+	}
+
+	guideline := &Document{
+		ID:     DocumentID([]byte("guideline"), "alice", true),
+		Title:  "NCCN Pancreatic Adenocarcinoma",
+		Shared: true,
+		Owner:  "alice",
+		Chunks: []Chunk{
+			{Index: 0, Page: 3, Text: "FOLFIRINOX is preferred first-line therapy for patients with good performance status."},
+			{Index: 1, Page: 4, Text: "Gemcitabine with nab-paclitaxel is an alternative first-line regimen."},
+			{Index: 2, Page: 9, Text: "Pancreatic enzyme replacement therapy improves weight and quality of life."},
+		},
+		AddedAt: time.Now(),
+	}
+	discharge := &Document{
+		ID:      DocumentID([]byte("discharge"), "alice", false),
+		Title:   "Discharge summary",
+		Owner:   "alice",
+		Chunks:  []Chunk{{Index: 0, Page: 1, Text: "Discharged on creon 25000 units with meals. 出院带药：胰酶肠溶胶囊。"}},
+		AddedAt: time.Now(),
+	}
+	for _, d := range []*Document{guideline, discharge} {
+		if err := store.Add(d); err != nil {
+			t.Fatalf("Add() error: %v", err)
+		}
+	}
+	if err := store.Add(&Document{ID: "../escape"}); err == nil {
+		t.Error("Add() accepted an invalid ID")
+	}
+
+	// Reopen to check persistence.
+	store, err = Open(dir)
+	if err != nil {
+		t.Fatalf("reopen error: %v", err)
+	}
+
+	hits := store.Search("first-line FOLFIRINOX", SearchOptions{User: "bob"})
+	if len(hits) == 0 || hits[0].DocID != guideline.ID || hits[0].Page != 3 {
+		t.Fatalf("unexpected hits: %+v", hits)
+	}
+	if hits := store.Search("creon", SearchOptions{User: "bob"}); len(hits) != 0 {
+		t.Errorf("private document visible to another user: %+v", hits)
+	}
+	if hits := store.Search("胰酶", SearchOptions{User: "alice"}); len(hits) != 1 || hits[0].DocID != discharge.ID {
+		t.Errorf("CJK search: %+v", hits)
+	}
+	if hits := store.Search("therapy", SearchOptions{User: "alice", DocIDs: []string{discharge.ID}}); len(hits) != 0 {
+		t.Errorf("DocIDs filter ignored: %+v", hits)
+	}
+	if hits := store.Search("therapy", SearchOptions{User: "alice", Limit: 1}); len(hits) != 1 {
+		t.Errorf("Limit ignored: %+v", hits)
+	}
+	if docs := store.List("bob"); len(docs) != 1 || docs[0].ID != guideline.ID {
+		t.Errorf("List(bob) = %+v", docs)
+	}
+	if DocumentID([]byte("x"), "alice", false) == DocumentID([]byte("x"), "bob", false) {
+		t.Error("private document IDs do not depend on the owner")
+	}
+}
@@ -0,0 +1,224 @@
+package rag
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// emptyPayloadHash is the SHA-256 of an empty request body.
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// S3Options configures access to S3-compatible storage.
+type S3Options struct {
+	// Endpoint defaults to AWS S3 in Region. Buckets are addressed by
+	// path, which MinIO, OSS and COS also accept.
+	Endpoint        string
+	Region          string
+	AccessKeyID     string
+	SecretAccessKey string
+	Timeout         time.Duration
+}
+
+// S3Source is the documents under a bucket prefix. Requests are signed
+// with AWS Signature Version 4 when keys are given.
+type S3Source struct {
+	bucket string
+	prefix string
+	opts   S3Options
+	client *http.Client
+}
+
+// NewS3Source returns the source for an s3://bucket/prefix URL.
+func NewS3Source(rawURL string, opts S3Options) (*S3Source, error) {
+	rest, ok := strings.CutPrefix(rawURL, "s3://")
+	if !ok {
+		return nil, fmt.Errorf("not an s3:// URL: %q", rawURL)
+	}
+	bucket, prefix, _ := strings.Cut(rest, "/")
+	if bucket == "" {
+		return nil, fmt.Errorf("s3 URL has no bucket: %q", rawURL)
+	}
+	if opts.Region == "" {
+		opts.Region = "us-east-1"
+	}
+	if opts.Endpoint == "" {
+		opts.Endpoint = "https://s3." + opts.Region + ".amazonaws.com"
+	}
+	opts.Endpoint = strings.TrimRight(opts.Endpoint, "/")
+	if opts.Timeout <= 0 {
+		opts.Timeout = 60 * time.Second
+	}
+	return &S3Source{bucket: bucket, prefix: prefix, opts: opts, client: &http.Client{Timeout: opts.Timeout}}, nil
+}
+
+func (s *S3Source) Root() string {
+	return "s3://" + s.bucket + "/" + s.prefix
+}
+
+type listBucketResult struct {
+	Contents []struct {
+		Key  string `xml:"Key"`
+		ETag string `xml:"ETag"`
+		Size int64  `xml:"Size"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+func (s *S3Source) List(ctx context.Context) ([]SourceObject, error) {
+	var objects []SourceObject
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {s.prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		body, err := s.get(ctx, "", query)
+		if err != nil {
+			return nil, err
+		}
+		var page listBucketResult
+		if err := xml.Unmarshal(body, &page); err != nil {
+			return nil, fmt.Errorf("invalid bucket listing: %w", err)
+		}
+		for _, c := range page.Contents {
+			if strings.HasSuffix(c.Key, "/") || !Ingestable(c.Key) {
+				continue
+			}
+			objects = append(objects, SourceObject{
+				Location: "s3://" + s.bucket + "/" + c.Key,
+				Version:  strings.Trim(c.ETag, `"`),
+				Size:     c.Size,
+			})
+		}
+		if !page.IsTruncated || page.NextContinuationToken == "" {
+			return objects, nil
+		}
+		token = page.NextContinuationToken
+	}
+}
+
+func (s *S3Source) Read(ctx context.Context, obj SourceObject) ([]byte, error) {
+	key := strings.TrimPrefix(obj.Location, "s3://"+s.bucket+"/")
+	return s.get(ctx, key, nil)
+}
+
+// get fetches an object, or lists the bucket when key is empty.
+func (s *S3Source) get(ctx context.Context, key string, query url.Values) ([]byte, error) {
+	endpoint, err := url.Parse(s.opts.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid s3 endpoint: %w", err)
+	}
+	path := endpoint.Path + "/" + s.bucket
+	if key != "" {
+		path += "/" + key
+	}
+	u := *endpoint
+	u.Path = path
+	u.RawPath = s3Escape(path, false)
+	u.RawQuery = canonicalQuery(query)
+
+	req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if s.opts.AccessKeyID != "" {
+		s.sign(req, u.RawPath, time.Now().UTC())
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("s3 request failed: HTTP %d", resp.StatusCode)
+	}
+	return body, nil
+}
+
+// sign adds an AWS Signature Version 4 Authorization header to req.
+func (s *S3Source) sign(req *http.Request, canonicalURI string, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", emptyPayloadHash)
+
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		canonicalURI,
+		req.URL.RawQuery,
+		"host:" + req.URL.Host,
+		"x-amz-content-sha256:" + emptyPayloadHash,
+		"x-amz-date:" + amzDate,
+		"",
+		signedHeaders,
+		emptyPayloadHash,
+	}, "\n")
+	scope := date + "/" + s.opts.Region + "/s3/aws4_request"
+	hash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(hash[:])
+
+	key := hmacSHA256([]byte("AWS4"+s.opts.SecretAccessKey), date)
+	key = hmacSHA256(key, s.opts.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.opts.AccessKeyID, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// canonicalQuery encodes query sorted by name, as signing requires.
+func canonicalQuery(query url.Values) string {
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var parts []string
+	for _, name := range names {
+		for _, value := range query[name] {
+			parts = append(parts, s3Escape(name, true)+"="+s3Escape(value, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// s3Escape percent-encodes everything but unreserved characters, and
+// slashes unless encodeSlash is set.
+func s3Escape(s string, encodeSlash bool) string {
+	var sb strings.Builder
+	for _, b := range []byte(s) {
+		switch {
+		case 'A' <= b && b <= 'Z', 'a' <= b && b <= 'z', '0' <= b && b <= '9',
+			b == '-', b == '_', b == '.', b == '~':
+			sb.WriteByte(b)
+		case b == '/' && !encodeSlash:
+			sb.WriteByte(b)
+		default:
+			fmt.Fprintf(&sb, "%%%02X", b)
+		}
+	}
+	return sb.String()
+}
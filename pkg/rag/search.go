@@ -0,0 +1,196 @@
+package rag
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// BM25 parameters.
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// Hit is a chunk that matched a search.
+type Hit struct {
+	DocID string
+	Title string
+	Chunk
+	Score float64
+}
+
+// SearchOptions narrows a search.
+type SearchOptions struct {
+	// DocIDs limits the search to these documents; empty searches all.
+	DocIDs []string
+	// User is the caller; documents private to other users are skipped.
+	User  string
+	Limit int
+}
+
+type indexedChunk struct {
+	terms  map[string]int
+	length int
+}
+
+// indexedDocument is a document with its chunks' term counts.
+type indexedDocument struct {
+	*Document
+	chunks []indexedChunk
+}
+
+func newIndexedDocument(doc *Document) *indexedDocument {
+	d := &indexedDocument{Document: doc, chunks: make([]indexedChunk, len(doc.Chunks))}
+	for i, c := range doc.Chunks {
+		tokens := tokenize(c.Text)
+		terms := make(map[string]int, len(tokens))
+		for _, t := range tokens {
+			terms[t]++
+		}
+		d.chunks[i] = indexedChunk{terms: terms, length: len(tokens)}
+	}
+	return d
+}
+
+// Search ranks the chunks of the visible documents against query with
+// BM25 and returns the best matches.
+func (s *Store) Search(query string, opts SearchOptions) []Hit {
+	queryTerms := uniqueTerms(tokenize(query))
+	if len(queryTerms) == 0 {
+		return nil
+	}
+	limit := opts.Limit
+	if limit <= 0 {
+		limit = 5
+	}
+	wanted := make(map[string]bool, len(opts.DocIDs))
+	for _, id := range opts.DocIDs {
+		wanted[id] = true
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	type candidate struct {
+		doc   *indexedDocument
+		chunk int
+	}
+	var candidates []candidate
+	docFreq := make(map[string]int, len(queryTerms))
+	totalLength := 0
+	for _, d := range s.docs {
+		if (len(wanted) > 0 && !wanted[d.ID]) || !d.VisibleTo(opts.User) {
+			continue
+		}
+		for i, c := range d.chunks {
+			candidates = append(candidates, candidate{d, i})
+			totalLength += c.length
+			for _, t := range queryTerms {
+				if c.terms[t] > 0 {
+					docFreq[t]++
+				}
+			}
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	n := float64(len(candidates))
+	avgLength := float64(totalLength) / n
+	var hits []Hit
+	for _, cand := range candidates {
+		c := cand.doc.chunks[cand.chunk]
+		score := 0.0
+		for _, t := range queryTerms {
+			tf := float64(c.terms[t])
+			if tf == 0 {
+				continue
+			}
+			df := float64(docFreq[t])
+			idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+			norm := 1 - bm25B
+			if avgLength > 0 {
+				norm += bm25B * float64(c.length) / avgLength
+			}
+			score += idf * tf * (bm25K1 + 1) / (tf + bm25K1*norm)
+		}
+		if score > 0 {
+			hits = append(hits, Hit{
+				DocID: cand.doc.ID,
+				Title: cand.doc.Title,
+				Chunk: cand.doc.Chunks[cand.chunk],
+				Score: score,
+			})
+		}
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		if hits[i].DocID != hits[j].DocID {
+			return hits[i].DocID < hits[j].DocID
+		}
+		return hits[i].Index < hits[j].Index
+	})
+	if len(hits) > limit {
+		hits = hits[:limit]
+	}
+	return hits
+}
+
+// tokenize splits text into lower-cased words and numbers. Chinese has no
+// spaces between words, so runs of Han characters become overlapping
+// two-character terms, with a lone character kept as it is.
+func tokenize(text string) []string {
+	var tokens []string
+	var word []rune
+	var han []rune
+	flushWord := func() {
+		if len(word) > 0 {
+			tokens = append(tokens, string(word))
+			word = word[:0]
+		}
+	}
+	flushHan := func() {
+		switch {
+		case len(han) == 1:
+			tokens = append(tokens, string(han))
+		case len(han) > 1:
+			for i := 0; i+1 < len(han); i++ {
+				tokens = append(tokens, string(han[i:i+2]))
+			}
+		}
+		han = han[:0]
+	}
+	for _, r := range strings.ToLower(text) {
+		switch {
+		case unicode.Is(unicode.Han, r):
+			flushWord()
+			han = append(han, r)
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			flushHan()
+			word = append(word, r)
+		default:
+			flushWord()
+			flushHan()
+		}
+	}
+	flushWord()
+	flushHan()
+	return tokens
+}
+
+func uniqueTerms(tokens []string) []string {
+	seen := make(map[string]bool, len(tokens))
+	var out []string
+	for _, t := range tokens {
+		if !seen[t] {
+			seen[t] = true
+			out = append(out, t)
+		}
+	}
+	return out
+}
@@ -0,0 +1,180 @@
+package rag
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+// Record is a chunk of a knowledge base document with its embedding.
+type Record struct {
+	DocID  string
+	Title  string
+	Source string
+	Owner  string
+	Shared bool
+	Chunk
+	Vector []float32
+}
+
+// VisibleTo reports whether user may search the record.
+func (r *Record) VisibleTo(user string) bool {
+	return r.Shared || r.Owner == "" || r.Owner == user
+}
+
+// VectorHit is a record that matched a search, without its vector. Score is
+// the cosine similarity to the query.
+type VectorHit struct {
+	Record
+	Score float64
+}
+
+// VectorQuery is a nearest-neighbor search. Records private to users other
+// than User are skipped.
+type VectorQuery struct {
+	Vector []float32
+	User   string
+	DocIDs []string
+	Limit  int
+}
+
+// VectorStore keeps embedded chunks and finds those nearest to a query.
+type VectorStore interface {
+	// Upsert stores records, replacing every stored record of the
+	// documents they belong to.
+	Upsert(ctx context.Context, records []Record) error
+	// Delete removes a document's records.
+	Delete(ctx context.Context, docID string) error
+	// HasDocument reports whether a document has stored records.
+	HasDocument(ctx context.Context, docID string) (bool, error)
+	Search(ctx context.Context, q VectorQuery) ([]VectorHit, error)
+	Close() error
+}
+
+// KnowledgeBase is a semantic index of curated documents, such as hospital
+// FAQs, local guides and guidelines: chunks are embedded when added and
+// found by meaning rather than by shared keywords.
+type KnowledgeBase struct {
+	embedder Embedder
+	store    VectorStore
+}
+
+func NewKnowledgeBase(embedder Embedder, store VectorStore) *KnowledgeBase {
+	return &KnowledgeBase{embedder: embedder, store: store}
+}
+
+// OpenKnowledgeBase returns the knowledge base configured by cfg. The
+// SQLite store keeps its database in dir; embeddings are cached in
+// cachePath.
+func OpenKnowledgeBase(cfg config.KnowledgeBaseConfig, dir, cachePath string) (*KnowledgeBase, error) {
+	if cfg.Embedding.APIBase == "" || cfg.Embedding.Model == "" {
+		return nil, fmt.Errorf("knowledge base: embedding api_base and model are required")
+	}
+	embedder := NewEmbedder(cfg.Embedding, cachePath)
+
+	var store VectorStore
+	var err error
+	switch strings.ToLower(cfg.Store) {
+	case "", "sqlite":
+		store, err = OpenSQLiteVectors(filepath.Join(dir, "kb.db"))
+	case "qdrant":
+		store, err = NewQdrantStore(cfg.Qdrant.URL, cfg.Qdrant.APIKey, cfg.Qdrant.Collection, time.Duration(cfg.Qdrant.TimeoutSeconds)*time.Second)
+	case "pgvector":
+		store, err = OpenPGVectorStore(cfg.PGVector.DSN, cfg.PGVector.Table)
+	default:
+		err = fmt.Errorf("knowledge base: unknown store %q", cfg.Store)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return NewKnowledgeBase(embedder, store), nil
+}
+
+// Add embeds the chunks of doc and stores them, replacing an earlier copy.
+func (kb *KnowledgeBase) Add(ctx context.Context, doc *Document) error {
+	if len(doc.Chunks) == 0 {
+		return fmt.Errorf("document %s has no text", doc.ID)
+	}
+	texts := make([]string, len(doc.Chunks))
+	for i, c := range doc.Chunks {
+		// The title gives chunks cut from the middle of a document context.
+		texts[i] = doc.Title + "\n" + c.Text
+	}
+	vectors, err := kb.embedder.Embed(ctx, texts)
+	if err != nil {
+		return err
+	}
+	records := make([]Record, len(doc.Chunks))
+	for i, c := range doc.Chunks {
+		records[i] = Record{
+			DocID:  doc.ID,
+			Title:  doc.Title,
+			Source: doc.Source,
+			Owner:  doc.Owner,
+			Shared: doc.Shared,
+			Chunk:  c,
+			Vector: vectors[i],
+		}
+	}
+	return kb.store.Upsert(ctx, records)
+}
+
+// Has reports whether the document with the given ID has been added.
+func (kb *KnowledgeBase) Has(ctx context.Context, docID string) (bool, error) {
+	return kb.store.HasDocument(ctx, docID)
+}
+
+// Delete removes a document.
+func (kb *KnowledgeBase) Delete(ctx context.Context, docID string) error {
+	return kb.store.Delete(ctx, docID)
+}
+
+// Search returns the chunks nearest in meaning to query.
+func (kb *KnowledgeBase) Search(ctx context.Context, query string, opts SearchOptions) ([]VectorHit, error) {
+	vectors, err := kb.embedder.Embed(ctx, []string{query})
+	if err != nil {
+		return nil, err
+	}
+	limit := opts.Limit
+	if limit <= 0 {
+		limit = 5
+	}
+	return kb.store.Search(ctx, VectorQuery{Vector: vectors[0], User: opts.User, DocIDs: opts.DocIDs, Limit: limit})
+}
+
+func (kb *KnowledgeBase) Close() error {
+	return kb.store.Close()
+}
+
+// normalize scales v to unit length, so cosine similarity is a dot product.
+func normalize(v []float32) []float32 {
+	var sum float64
+	for _, x := range v {
+		sum += float64(x) * float64(x)
+	}
+	out := make([]float32, len(v))
+	if sum == 0 {
+		return out
+	}
+	norm := math.Sqrt(sum)
+	for i, x := range v {
+		out[i] = float32(float64(x) / norm)
+	}
+	return out
+}
+
+func dot(a, b []float32) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var sum float64
+	for i := range a {
+		sum += float64(a[i]) * float64(b[i])
+	}
+	return sum
+}
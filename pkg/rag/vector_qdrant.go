@@ -0,0 +1,243 @@
+package rag
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// QdrantStore keeps vectors in a Qdrant collection, through its REST API.
+// The collection is created with cosine distance when the first document
+// is added, sized to its vectors.
+type QdrantStore struct {
+	baseURL    string
+	apiKey     string
+	collection string
+	httpClient *http.Client
+
+	mu    sync.Mutex
+	ready bool
+}
+
+func NewQdrantStore(baseURL, apiKey, collection string, timeout time.Duration) (*QdrantStore, error) {
+	if baseURL == "" {
+		return nil, fmt.Errorf("knowledge base: qdrant url is required")
+	}
+	if collection == "" {
+		collection = "picoclaw_kb"
+	}
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	return &QdrantStore{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		apiKey:     apiKey,
+		collection: collection,
+		httpClient: &http.Client{Timeout: timeout},
+	}, nil
+}
+
+type qdrantPayload struct {
+	DocID  string `json:"doc_id"`
+	Chunk  int    `json:"chunk"`
+	Page   int    `json:"page,omitempty"`
+	Title  string `json:"title"`
+	Source string `json:"source,omitempty"`
+	Owner  string `json:"owner"`
+	Shared bool   `json:"shared"`
+	Text   string `json:"text"`
+}
+
+// errQdrantNotFound is returned for a 404, which means the collection has
+// not been created yet.
+var errQdrantNotFound = fmt.Errorf("qdrant collection not found")
+
+func (s *QdrantStore) call(ctx context.Context, method, path string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, s.baseURL+"/collections/"+url.PathEscape(s.collection)+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.apiKey != "" {
+		req.Header.Set("api-key", s.apiKey)
+	}
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("qdrant request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, 16<<20))
+	if err != nil {
+		return fmt.Errorf("failed to read qdrant response: %w", err)
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return errQdrantNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		msg := strings.TrimSpace(string(raw))
+		if len(msg) > 300 {
+			msg = msg[:300]
+		}
+		return fmt.Errorf("qdrant returned %d: %s", resp.StatusCode, msg)
+	}
+	if out == nil {
+		return nil
+	}
+	var envelope struct {
+		Result json.RawMessage `json:"result"`
+	}
+	if err := json.Unmarshal(raw, &envelope); err != nil {
+		return fmt.Errorf("invalid qdrant response: %w", err)
+	}
+	return json.Unmarshal(envelope.Result, out)
+}
+
+// ensureCollection creates the collection for vectors of size dims unless
+// it exists.
+func (s *QdrantStore) ensureCollection(ctx context.Context, dims int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ready {
+		return nil
+	}
+	err := s.call(ctx, http.MethodGet, "", nil, nil)
+	if err == errQdrantNotFound {
+		err = s.call(ctx, http.MethodPut, "", map[string]interface{}{
+			"vectors": map[string]interface{}{"size": dims, "distance": "Cosine"},
+		}, nil)
+		if err == nil {
+			err = s.call(ctx, http.MethodPut, "/index", map[string]interface{}{
+				"field_name": "doc_id", "field_schema": "keyword",
+			}, nil)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	s.ready = true
+	return nil
+}
+
+func (s *QdrantStore) Upsert(ctx context.Context, records []Record) error {
+	if len(records) == 0 {
+		return nil
+	}
+	if err := s.ensureCollection(ctx, len(records[0].Vector)); err != nil {
+		return err
+	}
+	deleted := make(map[string]bool)
+	points := make([]map[string]interface{}, len(records))
+	for i, r := range records {
+		if !deleted[r.DocID] {
+			if err := s.Delete(ctx, r.DocID); err != nil {
+				return err
+			}
+			deleted[r.DocID] = true
+		}
+		points[i] = map[string]interface{}{
+			"id":     qdrantPointID(r.DocID, r.Index),
+			"vector": r.Vector,
+			"payload": qdrantPayload{
+				DocID: r.DocID, Chunk: r.Index, Page: r.Page, Title: r.Title, Source: r.Source,
+				Owner: r.Owner, Shared: r.Shared, Text: r.Text,
+			},
+		}
+	}
+	return s.call(ctx, http.MethodPut, "/points?wait=true", map[string]interface{}{"points": points}, nil)
+}
+
+func (s *QdrantStore) Delete(ctx context.Context, docID string) error {
+	err := s.call(ctx, http.MethodPost, "/points/delete?wait=true", map[string]interface{}{
+		"filter": map[string]interface{}{"must": []interface{}{qdrantMatch("doc_id", docID)}},
+	}, nil)
+	if err == errQdrantNotFound {
+		return nil
+	}
+	return err
+}
+
+func (s *QdrantStore) HasDocument(ctx context.Context, docID string) (bool, error) {
+	var count struct {
+		Count int `json:"count"`
+	}
+	err := s.call(ctx, http.MethodPost, "/points/count", map[string]interface{}{
+		"filter": map[string]interface{}{"must": []interface{}{qdrantMatch("doc_id", docID)}},
+		"exact":  true,
+	}, &count)
+	if err == errQdrantNotFound {
+		return false, nil
+	}
+	return count.Count > 0, err
+}
+
+func (s *QdrantStore) Search(ctx context.Context, q VectorQuery) ([]VectorHit, error) {
+	must := []interface{}{map[string]interface{}{"should": []interface{}{
+		qdrantMatch("shared", true),
+		qdrantMatch("owner", ""),
+		qdrantMatch("owner", q.User),
+	}}}
+	if len(q.DocIDs) > 0 {
+		must = append(must, map[string]interface{}{"key": "doc_id", "match": map[string]interface{}{"any": q.DocIDs}})
+	}
+	var points []struct {
+		Score   float64       `json:"score"`
+		Payload qdrantPayload `json:"payload"`
+	}
+	err := s.call(ctx, http.MethodPost, "/points/search", map[string]interface{}{
+		"vector":       q.Vector,
+		"limit":        q.Limit,
+		"with_payload": true,
+		"filter":       map[string]interface{}{"must": must},
+	}, &points)
+	if err == errQdrantNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	hits := make([]VectorHit, len(points))
+	for i, p := range points {
+		hits[i] = VectorHit{
+			Record: Record{
+				DocID: p.Payload.DocID, Title: p.Payload.Title, Source: p.Payload.Source,
+				Owner: p.Payload.Owner, Shared: p.Payload.Shared,
+				Chunk: Chunk{Index: p.Payload.Chunk, Page: p.Payload.Page, Text: p.Payload.Text},
+			},
+			Score: p.Score,
+		}
+	}
+	return hits, nil
+}
+
+func (s *QdrantStore) Close() error {
+	return nil
+}
+
+func qdrantMatch(key string, value interface{}) map[string]interface{} {
+	return map[string]interface{}{"key": key, "match": map[string]interface{}{"value": value}}
+}
+
+// qdrantPointID derives a stable UUID for a chunk; Qdrant point IDs must be
+// UUIDs or integers.
+func qdrantPointID(docID string, chunk int) string {
+	sum := sha1.Sum([]byte(fmt.Sprintf("%s#%d", docID, chunk)))
+	sum[6] = sum[6]&0x0f | 0x50
+	sum[8] = sum[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", sum[0:4], sum[4:6], sum[6:8], sum[8:10], sum[10:16])
+}
@@ -0,0 +1,143 @@
+//go:build (linux && (386 || amd64 || arm || arm64 || loong64 || ppc64le || riscv64 || s390x)) || (darwin && (amd64 || arm64)) || (freebsd && (386 || amd64 || arm || arm64)) || (windows && (386 || amd64 || arm64)) || (netbsd && amd64) || (openbsd && (amd64 || arm64))
+
+package rag
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	_ "modernc.org/sqlite"
+)
+
+const sqliteVectorSchema = `
+CREATE TABLE IF NOT EXISTS kb_chunks (
+	doc_id TEXT NOT NULL,
+	chunk  INTEGER NOT NULL,
+	page   INTEGER NOT NULL DEFAULT 0,
+	title  TEXT NOT NULL,
+	source TEXT NOT NULL DEFAULT '',
+	owner  TEXT NOT NULL DEFAULT '',
+	shared INTEGER NOT NULL DEFAULT 0,
+	text   TEXT NOT NULL,
+	vector BLOB NOT NULL,
+	PRIMARY KEY (doc_id, chunk)
+);
+CREATE INDEX IF NOT EXISTS kb_chunks_by_owner ON kb_chunks (owner);
+`
+
+// SQLiteVectorStore keeps vectors in a local SQLite database, as unit-length
+// little-endian float32 blobs, and searches them exactly by scanning the
+// chunks the user may see. That needs no server and stays fast for the tens
+// of thousands of chunks a curated knowledge base holds.
+type SQLiteVectorStore struct {
+	db *sql.DB
+}
+
+// OpenSQLiteVectors opens or creates the database at path.
+func OpenSQLiteVectors(path string) (*SQLiteVectorStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(sqliteVectorSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create knowledge base in %s: %w", path, err)
+	}
+	return &SQLiteVectorStore{db: db}, nil
+}
+
+func (s *SQLiteVectorStore) Upsert(ctx context.Context, records []Record) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	deleted := make(map[string]bool)
+	for _, r := range records {
+		if !deleted[r.DocID] {
+			if _, err := tx.ExecContext(ctx, `DELETE FROM kb_chunks WHERE doc_id = ?`, r.DocID); err != nil {
+				return err
+			}
+			deleted[r.DocID] = true
+		}
+		if _, err := tx.ExecContext(ctx, `INSERT INTO kb_chunks (doc_id, chunk, page, title, source, owner, shared, text, vector)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			r.DocID, r.Index, r.Page, r.Title, r.Source, r.Owner, r.Shared, r.Text, encodeVector(normalize(r.Vector))); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *SQLiteVectorStore) Delete(ctx context.Context, docID string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM kb_chunks WHERE doc_id = ?`, docID)
+	return err
+}
+
+func (s *SQLiteVectorStore) HasDocument(ctx context.Context, docID string) (bool, error) {
+	var n int
+	err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM kb_chunks WHERE doc_id = ?`, docID).Scan(&n)
+	return n > 0, err
+}
+
+func (s *SQLiteVectorStore) Search(ctx context.Context, q VectorQuery) ([]VectorHit, error) {
+	query := `SELECT doc_id, chunk, page, title, source, owner, shared, text, vector FROM kb_chunks
+		WHERE (shared = 1 OR owner = '' OR owner = ?)`
+	args := []interface{}{q.User}
+	if len(q.DocIDs) > 0 {
+		query += ` AND doc_id IN (?` + strings.Repeat(`, ?`, len(q.DocIDs)-1) + `)`
+		for _, id := range q.DocIDs {
+			args = append(args, id)
+		}
+	}
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	target := normalize(q.Vector)
+	var hits []VectorHit
+	for rows.Next() {
+		var h VectorHit
+		var blob []byte
+		if err := rows.Scan(&h.DocID, &h.Index, &h.Page, &h.Title, &h.Source, &h.Owner, &h.Shared, &h.Text, &blob); err != nil {
+			return nil, err
+		}
+		h.Score = dot(target, decodeVector(blob))
+		hits = append(hits, h)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	sortVectorHits(hits)
+	if q.Limit > 0 && len(hits) > q.Limit {
+		hits = hits[:q.Limit]
+	}
+	return hits, nil
+}
+
+func (s *SQLiteVectorStore) Close() error {
+	return s.db.Close()
+}
+
+func sortVectorHits(hits []VectorHit) {
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		if hits[i].DocID != hits[j].DocID {
+			return hits[i].DocID < hits[j].DocID
+		}
+		return hits[i].Index < hits[j].Index
+	})
+}
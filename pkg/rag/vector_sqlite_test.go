@@ -0,0 +1,68 @@
+//go:build (linux && (386 || amd64 || arm || arm64 || loong64 || ppc64le || riscv64 || s390x)) || (darwin && (amd64 || arm64)) || (freebsd && (386 || amd64 || arm || arm64)) || (windows && (386 || amd64 || arm64)) || (netbsd && amd64) || (openbsd && (amd64 || arm64))
+
+package rag
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+func TestKnowledgeBase_SQLite(t *testing.T) {
+	store, err := OpenSQLiteVectors(filepath.Join(t.TempDir(), "kb", "kb.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	embedder := &keywordEmbedder{keywords: []string{"停车", "挂号", "化疗"}}
+	kb := NewKnowledgeBase(embedder, store)
+	defer kb.Close()
+	ctx := context.Background()
+
+	faq := &Document{ID: "doc-faq", Title: "医院常见问题", Shared: true, Chunks: []Chunk{
+		{Index: 0, Text: "停车：地下停车场B2，停车每小时5元。"},
+		{Index: 1, Text: "挂号：可在公众号预约挂号。"},
+	}}
+	private := &Document{ID: "doc-mine", Title: "我的化疗安排", Owner: "42", Chunks: []Chunk{
+		{Index: 0, Page: 2, Text: "化疗第三周期：周一上午。"},
+	}}
+	for _, doc := range []*Document{faq, private} {
+		if err := kb.Add(ctx, doc); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	hits, err := kb.Search(ctx, "哪里停车？", SearchOptions{User: "7", Limit: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hits) != 2 || hits[0].DocID != "doc-faq" || hits[0].Index != 0 || hits[0].Score <= hits[1].Score {
+		t.Fatalf("hits = %+v", hits)
+	}
+
+	hits, _ = kb.Search(ctx, "化疗什么时候", SearchOptions{User: "42", Limit: 1})
+	if len(hits) != 1 || hits[0].DocID != "doc-mine" || hits[0].Page != 2 || hits[0].Score < 0.9 {
+		t.Errorf("owner's hits = %+v", hits)
+	}
+	hits, _ = kb.Search(ctx, "化疗", SearchOptions{User: "42", DocIDs: []string{"doc-faq"}})
+	for _, h := range hits {
+		if h.DocID != "doc-faq" {
+			t.Errorf("doc_ids not applied: %+v", h)
+		}
+	}
+
+	// Adding a document again replaces its chunks.
+	faq.Chunks = faq.Chunks[:1]
+	kb.Add(ctx, faq)
+	hits, _ = kb.Search(ctx, "挂号", SearchOptions{User: "7"})
+	if len(hits) != 1 {
+		t.Errorf("after replace: %+v", hits)
+	}
+
+	if ok, _ := kb.Has(ctx, "doc-mine"); !ok {
+		t.Error("Has(doc-mine) = false")
+	}
+	kb.Delete(ctx, "doc-mine")
+	if ok, _ := kb.Has(ctx, "doc-mine"); ok {
+		t.Error("doc-mine still stored after Delete")
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !((linux && (386 || amd64 || arm || arm64 || loong64 || ppc64le || riscv64 || s390x)) || (darwin && (amd64 || arm64)) || (freebsd && (386 || amd64 || arm || arm64)) || (windows && (386 || amd64 || arm64)) || (netbsd && amd64) || (openbsd && (amd64 || arm64)))
+
+package rag
+
+import "fmt"
+
+// OpenSQLiteVectors fails on platforms the SQLite driver does not support;
+// use the qdrant or pgvector store there.
+func OpenSQLiteVectors(path string) (VectorStore, error) {
+	return nil, fmt.Errorf("the sqlite knowledge base store is not supported on this platform; use qdrant or pgvector")
+}
@@ -0,0 +1,233 @@
+package rag
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// keywordEmbedder embeds a text as the counts of a few keywords, so tests
+// can predict which chunk is nearest.
+type keywordEmbedder struct {
+	keywords []string
+	calls    int
+}
+
+func (e *keywordEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	e.calls++
+	out := make([][]float32, len(texts))
+	for i, text := range texts {
+		v := make([]float32, len(e.keywords)+1)
+		v[len(e.keywords)] = 0.1
+		for j, k := range e.keywords {
+			v[j] = float32(strings.Count(strings.ToLower(text), k))
+		}
+		out[i] = v
+	}
+	return out, nil
+}
+
+func TestOpenAIEmbedder(t *testing.T) {
+	var mu sync.Mutex
+	var requests []map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/embeddings" || r.Header.Get("Authorization") != "Bearer sk-test" {
+			t.Errorf("request %s with %q", r.URL.Path, r.Header.Get("Authorization"))
+		}
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		mu.Lock()
+		requests = append(requests, body)
+		mu.Unlock()
+		input := body["input"].([]interface{})
+		data := make([]map[string]interface{}, len(input))
+		// Answer out of order; vectors are matched by index.
+		for i := range input {
+			j := len(input) - 1 - i
+			data[i] = map[string]interface{}{"index": j, "embedding": []float32{float32(len(input[j].(string))), 1}}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": data})
+	}))
+	defer server.Close()
+
+	e := NewOpenAIEmbedder(EmbedderOptions{APIBase: server.URL + "/v1/", APIKey: "sk-test", Model: "BAAI/bge-m3", Dimensions: 512, BatchSize: 2})
+	vectors, err := e.Embed(context.Background(), []string{"a", "bb", "ccc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]float32{{1, 1}, {2, 1}, {3, 1}}
+	if !reflect.DeepEqual(vectors, want) {
+		t.Errorf("vectors = %v, want %v", vectors, want)
+	}
+	if len(requests) != 2 || requests[0]["model"] != "BAAI/bge-m3" || requests[0]["dimensions"] != float64(512) {
+		t.Errorf("requests = %v", requests)
+	}
+}
+
+func TestOpenAIEmbedder_Batches(t *testing.T) {
+	tests := []struct {
+		name    string
+		apiBase string
+		batch   int
+		lengths []int
+		want    [][2]int
+	}{
+		{"provider limit", "https://dashscope.aliyuncs.com/compatible-mode/v1", 0, make([]int, 25), [][2]int{{0, 10}, {10, 20}, {20, 25}}},
+		{"batch size over the limit", "https://dashscope.aliyuncs.com/compatible-mode/v1", 64, make([]int, 12), [][2]int{{0, 10}, {10, 12}}},
+		{"batch size", "https://api.openai.com/v1", 3, make([]int, 5), [][2]int{{0, 3}, {3, 5}}},
+		{"characters", "https://api.siliconflow.cn/v1", 0, []int{30000, 20000, 20000, 70000, 10}, [][2]int{{0, 2}, {2, 3}, {3, 4}, {4, 5}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			texts := make([]string, len(tt.lengths))
+			for i, n := range tt.lengths {
+				texts[i] = strings.Repeat("癌", n)
+			}
+			e := NewOpenAIEmbedder(EmbedderOptions{APIBase: tt.apiBase, Model: "m", BatchSize: tt.batch})
+			if got := e.batches(texts); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("batches = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOpenAIEmbedder_ConcurrentBatchesAndRetries(t *testing.T) {
+	var requests, inFlight, maxInFlight int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&requests, 1)
+		if n == 1 {
+			w.Header().Set("Retry-After", "0")
+			http.Error(w, "rate limited", http.StatusTooManyRequests)
+			return
+		}
+		cur := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			old := atomic.LoadInt32(&maxInFlight)
+			if cur <= old || atomic.CompareAndSwapInt32(&maxInFlight, old, cur) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		var body struct {
+			Input []string `json:"input"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		data := make([]map[string]interface{}, len(body.Input))
+		for i, text := range body.Input {
+			var n float32
+			fmt.Sscanf(text, "chunk %g", &n)
+			data[i] = map[string]interface{}{"index": i, "embedding": []float32{n}}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": data})
+	}))
+	defer server.Close()
+
+	texts := make([]string, 100)
+	for i := range texts {
+		texts[i] = fmt.Sprintf("chunk %d", i)
+	}
+	e := NewOpenAIEmbedder(EmbedderOptions{APIBase: server.URL, Model: "m", BatchSize: 10, Concurrency: 3})
+	vectors, err := e.Embed(context.Background(), texts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, v := range vectors {
+		if len(v) != 1 || v[0] != float32(i) {
+			t.Fatalf("vector %d = %v", i, v)
+		}
+	}
+	if requests != 11 {
+		t.Errorf("requests = %d, want 10 batches and one retry", requests)
+	}
+	if maxInFlight < 2 || maxInFlight > 3 {
+		t.Errorf("%d requests in flight, want 2 or 3", maxInFlight)
+	}
+}
+
+func TestQdrantStore(t *testing.T) {
+	var calls []string
+	var search map[string]interface{}
+	created := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, r.Method+" "+r.URL.Path)
+		if r.Header.Get("api-key") != "qk" {
+			t.Errorf("api-key = %q", r.Header.Get("api-key"))
+		}
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		switch r.Method + " " + r.URL.Path {
+		case "GET /collections/kb":
+			if !created {
+				http.NotFound(w, r)
+				return
+			}
+		case "PUT /collections/kb":
+			created = true
+			if size := body["vectors"].(map[string]interface{})["size"]; size != float64(3) {
+				t.Errorf("collection size = %v", size)
+			}
+		case "POST /collections/kb/points/search":
+			search = body
+			w.Write([]byte(`{"result":[{"id":"x","score":0.91,"payload":{"doc_id":"doc-1","chunk":2,"page":4,"title":"FAQ","owner":"42","shared":false,"text":"停车在B2"}}]}`))
+			return
+		}
+		w.Write([]byte(`{"result":{}}`))
+	}))
+	defer server.Close()
+
+	store, err := NewQdrantStore(server.URL, "qk", "kb", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if err := store.Upsert(ctx, []Record{{DocID: "doc-1", Chunk: Chunk{Index: 0, Text: "a"}, Vector: []float32{1, 0, 0}}}); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"GET /collections/kb",
+		"PUT /collections/kb",
+		"PUT /collections/kb/index",
+		"POST /collections/kb/points/delete",
+		"PUT /collections/kb/points",
+	}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("calls = %v", calls)
+	}
+
+	hits, err := store.Search(ctx, VectorQuery{Vector: []float32{1, 0, 0}, User: "42", DocIDs: []string{"doc-1"}, Limit: 3})
+	if err != nil || len(hits) != 1 {
+		t.Fatalf("Search = %v, %v", hits, err)
+	}
+	if h := hits[0]; h.DocID != "doc-1" || h.Index != 2 || h.Page != 4 || h.Text != "停车在B2" || h.Score != 0.91 {
+		t.Errorf("hit = %+v", h)
+	}
+	filter, _ := json.Marshal(search["filter"])
+	if !strings.Contains(string(filter), `{"key":"owner","match":{"value":"42"}}`) || !strings.Contains(string(filter), `"any":["doc-1"]`) {
+		t.Errorf("filter = %s", filter)
+	}
+}
+
+func TestQdrantPointID(t *testing.T) {
+	id := qdrantPointID("doc-abc", 3)
+	if len(id) != 36 || id[14] != '5' || id != qdrantPointID("doc-abc", 3) || id == qdrantPointID("doc-abc", 4) {
+		t.Errorf("qdrantPointID = %s", id)
+	}
+}
+
+func TestPGVector(t *testing.T) {
+	if got := pgVector([]float32{0.5, -1, 0.25}); got != "[0.5,-1,0.25]" {
+		t.Errorf("pgVector = %s", got)
+	}
+	if _, err := OpenPGVectorStore("postgres://localhost/kb", "kb; DROP TABLE x"); err == nil {
+		t.Error("accepted an invalid table name")
+	}
+}
@@ -14,6 +14,9 @@ type RouteInput struct {
 	ParentPeer *RoutePeer
 	GuildID    string
 	TeamID     string
+	// SenderID is who sent the message; in groups it picks the sender's
+	// own session when channels.groups.per_user_sessions is on.
+	SenderID string
 }
 
 // ResolvedRoute is the result of agent routing.
@@ -50,6 +53,11 @@ func (r *RouteResolver) ResolveRoute(input RouteInput) ResolvedRoute {
 	}
 	identityLinks := r.cfg.Session.IdentityLinks
 
+	var groupSender string
+	if r.cfg.Channels.Groups.PerUserSessions {
+		groupSender = input.SenderID
+	}
+
 	bindings := r.filterBindings(channel, accountID)
 
 	choose := func(agentID string, matchedBy string) ResolvedRoute {
@@ -61,6 +69,7 @@ func (r *RouteResolver) ResolveRoute(input RouteInput) ResolvedRoute {
 			Peer:          peer,
 			DMScope:       dmScope,
 			IdentityLinks: identityLinks,
+			GroupSender:   groupSender,
 		}))
 		mainSessionKey := strings.ToLower(BuildAgentMainSessionKey(resolvedAgentID))
 		return ResolvedRoute{
@@ -39,6 +39,24 @@ func TestResolveRoute_DefaultAgent_NoBindings(t *testing.T) {
 	}
 }
 
+func TestResolveRoute_PerUserGroupSessions(t *testing.T) {
+	input := RouteInput{
+		Channel:  "telegram",
+		Peer:     &RoutePeer{Kind: "group", ID: "-100123"},
+		SenderID: "42",
+	}
+
+	cfg := testConfig(nil, nil)
+	if got := NewRouteResolver(cfg).ResolveRoute(input).SessionKey; got != "agent:main:telegram:group:-100123" {
+		t.Errorf("shared group session = %q", got)
+	}
+
+	cfg.Channels.Groups.PerUserSessions = true
+	if got := NewRouteResolver(cfg).ResolveRoute(input).SessionKey; got != "agent:main:telegram:group:-100123:user:42" {
+		t.Errorf("per-user group session = %q", got)
+	}
+}
+
 func TestResolveRoute_PeerBinding(t *testing.T) {
 	agents := []config.AgentConfig{
 		{ID: "sales", Default: true},
@@ -29,6 +29,9 @@ type SessionKeyParams struct {
 	Peer          *RoutePeer
 	DMScope       DMScope
 	IdentityLinks map[string][]string
+	// GroupSender, when set, gives the sender of a group or channel
+	// message a session of their own inside that group.
+	GroupSender string
 }
 
 // ParsedSessionKey is the result of parsing an agent-scoped session key.
@@ -96,6 +99,9 @@ func BuildAgentPeerSessionKey(params SessionKeyParams) string {
 	if peerID == "" {
 		peerID = "unknown"
 	}
+	if sender := strings.ToLower(strings.TrimSpace(params.GroupSender)); sender != "" {
+		return fmt.Sprintf("agent:%s:%s:%s:%s:user:%s", agentID, channel, peerKind, peerID, sender)
+	}
 	return fmt.Sprintf("agent:%s:%s:%s:%s", agentID, channel, peerKind, peerID)
 }
 
@@ -84,6 +84,32 @@ func TestBuildAgentPeerSessionKey_GroupPeer(t *testing.T) {
 	}
 }
 
+func TestBuildAgentPeerSessionKey_GroupSender(t *testing.T) {
+	got := BuildAgentPeerSessionKey(SessionKeyParams{
+		AgentID:     "main",
+		Channel:     "telegram",
+		Peer:        &RoutePeer{Kind: "group", ID: "chat456"},
+		DMScope:     DMScopePerPeer,
+		GroupSender: "User789",
+	})
+	want := "agent:main:telegram:group:chat456:user:user789"
+	if got != want {
+		t.Errorf("GroupSender = %q, want %q", got, want)
+	}
+
+	// Direct messages are keyed by their DM scope alone
+	got = BuildAgentPeerSessionKey(SessionKeyParams{
+		AgentID:     "main",
+		Channel:     "telegram",
+		Peer:        &RoutePeer{Kind: "direct", ID: "user789"},
+		DMScope:     DMScopePerPeer,
+		GroupSender: "user789",
+	})
+	if want := "agent:main:direct:user789"; got != want {
+		t.Errorf("direct with GroupSender = %q, want %q", got, want)
+	}
+}
+
 func TestBuildAgentPeerSessionKey_NilPeer(t *testing.T) {
 	got := BuildAgentPeerSessionKey(SessionKeyParams{
 		AgentID: "main",
@@ -0,0 +1,291 @@
+package scaffold
+
+import "text/template"
+
+var toolTemplate = template.Must(template.New("tool").Parse(`package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	default{{.Export}}RequestTimeout = 30 * time.Second
+	default{{.Export}}CacheTTL       = 15 * time.Minute
+)
+
+type {{.Export}}ToolOptions struct {
+	APIKey         string
+	APIBaseURL     string
+	RequestTimeout time.Duration
+}
+
+type {{.Local}}Client struct {
+	baseURL    string
+	apiKey     string
+	httpClient *http.Client
+}
+
+type {{.Local}}Tool struct {
+	name        string
+	description string
+	parameters  map[string]interface{}
+	handler     func(ctx context.Context, args map[string]interface{}) (interface{}, error)
+}
+
+type {{.Local}}ToolFactory struct {
+	client *{{.Local}}Client
+}
+
+// New{{.Export}}Tools builds the {{.Title}} tools.
+func New{{.Export}}Tools(opts {{.Export}}ToolOptions) ([]Tool, error) {
+	apiKey := strings.TrimSpace(opts.APIKey)
+	if apiKey == "" {
+		return nil, fmt.Errorf("{{.Name}} api_key is required")
+	}
+
+	apiBaseURL := strings.TrimSpace(opts.APIBaseURL)
+	if apiBaseURL == "" {
+		return nil, fmt.Errorf("{{.Name}} api_base_url is required")
+	}
+
+	timeout := opts.RequestTimeout
+	if timeout <= 0 {
+		timeout = default{{.Export}}RequestTimeout
+	}
+
+	factory := {{.Local}}ToolFactory{
+		client: &{{.Local}}Client{
+			baseURL:    strings.TrimRight(apiBaseURL, "/"),
+			apiKey:     apiKey,
+			httpClient: &http.Client{Timeout: timeout},
+		},
+	}
+
+	return []Tool{
+		factory.searchTool(),
+	}, nil
+}
+
+func (t *{{.Local}}Tool) Name() string {
+	return t.name
+}
+
+func (t *{{.Local}}Tool) Description() string {
+	return t.description
+}
+
+func (t *{{.Local}}Tool) Parameters() map[string]interface{} {
+	return t.parameters
+}
+
+// CacheTTL lets the registry reuse results for identical calls. Return 0
+// for tools with side effects.
+func (t *{{.Local}}Tool) CacheTTL() time.Duration {
+	return default{{.Export}}CacheTTL
+}
+
+func (t *{{.Local}}Tool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	result, err := t.handler(ctx, args)
+	if err != nil {
+		return ErrorResult(err.Error()).WithError(err)
+	}
+
+	payload, err := json.Marshal(result)
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("failed to serialize {{.Name}} response: %v", err)).WithError(err)
+	}
+
+	return NewToolResult(string(payload))
+}
+
+// TODO: replace this example with the operations the integration exposes.
+type {{.Local}}SearchArgs struct {
+	Query string ` + "`" + `json:"query" arg:"required"` + "`" + `
+	Limit *int64 ` + "`" + `json:"limit" arg:"min=1"` + "`" + `
+}
+
+func (f {{.Local}}ToolFactory) searchTool() Tool {
+	return &{{.Local}}Tool{
+		name:        "{{.Name}}_search",
+		description: "Search {{.Title}} and return matching results.",
+		parameters: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"query": map[string]interface{}{
+					"type":        "string",
+					"description": "Search query.",
+				},
+				"limit": map[string]interface{}{
+					"type":        "integer",
+					"description": "Optional maximum number of results.",
+				},
+			},
+			"required": []string{"query"},
+		},
+		handler: func(ctx context.Context, args map[string]interface{}) (interface{}, error) {
+			a, err := BindArgs[{{.Local}}SearchArgs](args)
+			if err != nil {
+				return nil, err
+			}
+			return f.client.search(ctx, a.Query, a.Limit)
+		},
+	}
+}
+
+func (c *{{.Local}}Client) search(ctx context.Context, query string, limit *int64) (interface{}, error) {
+	payload := map[string]interface{}{
+		"query": query,
+	}
+	if limit != nil {
+		payload["limit"] = *limit
+	}
+	return c.postJSON(ctx, "/search", payload)
+}
+
+func (c *{{.Local}}Client) postJSON(ctx context.Context, path string, payload interface{}) (interface{}, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode request for %s: %w", path, err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+path, bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request for %s: %w", path, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+c.apiKey)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request to %s failed: %w", path, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response from %s: %w", path, err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("request to %s failed with status %d: %s", path, resp.StatusCode, truncateForError(string(body), 500))
+	}
+	if len(bytes.TrimSpace(body)) == 0 {
+		return map[string]interface{}{}, nil
+	}
+
+	var raw interface{}
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return nil, fmt.Errorf("failed to decode response from %s: %w", path, err)
+	}
+	return raw, nil
+}
+`))
+
+var toolTestTemplate = template.Must(template.New("tool_test").Parse(`package tools
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNew{{.Export}}Tools_RequiresConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		opts {{.Export}}ToolOptions
+	}{
+		{name: "missing api key", opts: {{.Export}}ToolOptions{APIBaseURL: "http://localhost"}},
+		{name: "missing base url", opts: {{.Export}}ToolOptions{APIKey: "key"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := New{{.Export}}Tools(tt.opts); err == nil {
+				t.Fatal("expected error for incomplete config")
+			}
+		})
+	}
+}
+
+func Test{{.Export}}Search(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/search" {
+			t.Errorf("unexpected path: %s", r.URL.Path)
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer test-key" {
+			t.Errorf("unexpected Authorization: %s", got)
+		}
+
+		var payload map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Errorf("decode request failed: %v", err)
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"query":   payload["query"],
+			"results": []string{"first"},
+		})
+	}))
+	defer server.Close()
+
+	tools, err := New{{.Export}}Tools({{.Export}}ToolOptions{APIKey: "test-key", APIBaseURL: server.URL})
+	if err != nil {
+		t.Fatalf("New{{.Export}}Tools() error = %v", err)
+	}
+	tool := findToolByName(tools, "{{.Name}}_search")
+	if tool == nil {
+		t.Fatal("{{.Name}}_search tool not found")
+	}
+
+	tests := []struct {
+		name    string
+		args    map[string]interface{}
+		wantErr bool
+		want    string
+	}{
+		{name: "query", args: map[string]interface{}{"query": "hello"}, want: ` + "`" + `"query":"hello"` + "`" + `},
+		{name: "query with limit", args: map[string]interface{}{"query": "hello", "limit": float64(3)}, want: ` + "`" + `"results":["first"]` + "`" + `},
+		{name: "missing query", args: map[string]interface{}{}, wantErr: true, want: "query is required"},
+		{name: "bad limit", args: map[string]interface{}{"query": "hello", "limit": "three"}, wantErr: true, want: "limit"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := tool.Execute(context.Background(), tt.args)
+			if result.IsError != tt.wantErr {
+				t.Fatalf("IsError = %v, want %v (%s)", result.IsError, tt.wantErr, result.ForLLM)
+			}
+			if !strings.Contains(result.ForLLM, tt.want) {
+				t.Errorf("ForLLM = %q, want substring %q", result.ForLLM, tt.want)
+			}
+		})
+	}
+}
+`))
+
+var registrationTemplate = template.Must(template.New("registration").Parse(`// {{.Title}} tools (generated). Until the options below are filled in
+// from config, startup logs an error and the tools stay unregistered.
+{{.Local}}Opts := tools.{{.Export}}ToolOptions{
+	APIKey:     "", // TODO: read from config
+	APIBaseURL: "", // TODO: read from config
+}
+if {{.Local}}Tools, err := tools.New{{.Export}}Tools({{.Local}}Opts); err != nil {
+	logger.ErrorCF("agent", "{{.Title}} tools not registered: fill in their options in registerSharedTools",
+		map[string]interface{}{
+			"agent_id": agentID,
+			"error":    err.Error(),
+		})
+} else {
+	for _, tool := range {{.Local}}Tools {
+		agent.Tools.Register(tool)
+	}
+}
+`))
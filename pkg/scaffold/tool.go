@@ -0,0 +1,170 @@
+// Package scaffold generates starter code for new picoclaw integrations.
+package scaffold
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+// RegistrationMarker marks the spot in pkg/agent/loop.go where generated
+// tool registrations are inserted.
+const RegistrationMarker = "// picoclaw gen tool: registrations are inserted above this line"
+
+var toolNamePattern = regexp.MustCompile(`^[a-z][a-z0-9]*(_[a-z0-9]+)*$`)
+
+type ToolOptions struct {
+	// Name is the snake_case integration name, e.g. "pubmed".
+	Name string
+	// Root is the repository root; defaults to the current directory.
+	Root string
+	// Force overwrites existing files.
+	Force bool
+	// NoWire skips inserting the registration into the agent loop.
+	NoWire bool
+}
+
+type ToolResult struct {
+	Files []string
+	Wired string
+}
+
+type toolTemplateData struct {
+	Name   string // snake_case, e.g. "pubmed_search"
+	Export string // PubmedSearch
+	Local  string // pubmedSearch
+	Title  string // "pubmed search"
+}
+
+// GenerateTool writes a tool skeleton and its tests into pkg/tools and
+// registers it in registerSharedTools.
+func GenerateTool(opts ToolOptions) (*ToolResult, error) {
+	name := strings.ToLower(strings.TrimSpace(opts.Name))
+	name = strings.ReplaceAll(name, "-", "_")
+	if !toolNamePattern.MatchString(name) {
+		return nil, fmt.Errorf("invalid tool name %q: use lowercase letters, digits and underscores, starting with a letter", opts.Name)
+	}
+
+	root := opts.Root
+	if root == "" {
+		root = "."
+	}
+	toolsDir := filepath.Join(root, "pkg", "tools")
+	if info, err := os.Stat(toolsDir); err != nil || !info.IsDir() {
+		return nil, fmt.Errorf("%s not found; run from the picoclaw repository root", toolsDir)
+	}
+
+	data := newToolTemplateData(name)
+	files := []struct {
+		path string
+		tmpl *template.Template
+	}{
+		{filepath.Join(toolsDir, name+".go"), toolTemplate},
+		{filepath.Join(toolsDir, name+"_test.go"), toolTestTemplate},
+	}
+
+	if !opts.Force {
+		for _, f := range files {
+			if _, err := os.Stat(f.path); err == nil {
+				return nil, fmt.Errorf("%s already exists (use --force to overwrite)", f.path)
+			}
+		}
+	}
+
+	result := &ToolResult{}
+	for _, f := range files {
+		src, err := render(f.tmpl, data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to render %s: %w", f.path, err)
+		}
+		if err := os.WriteFile(f.path, src, 0644); err != nil {
+			return nil, fmt.Errorf("failed to write %s: %w", f.path, err)
+		}
+		result.Files = append(result.Files, f.path)
+	}
+
+	if opts.NoWire {
+		return result, nil
+	}
+
+	loopPath := filepath.Join(root, "pkg", "agent", "loop.go")
+	wired, err := wireTool(loopPath, data)
+	if err != nil {
+		return result, err
+	}
+	if wired {
+		result.Wired = loopPath
+	}
+	return result, nil
+}
+
+func newToolTemplateData(name string) toolTemplateData {
+	parts := strings.Split(name, "_")
+	var export strings.Builder
+	for _, p := range parts {
+		export.WriteString(strings.ToUpper(p[:1]) + p[1:])
+	}
+	return toolTemplateData{
+		Name:   name,
+		Export: export.String(),
+		Local:  parts[0] + export.String()[len(parts[0]):],
+		Title:  strings.Join(parts, " "),
+	}
+}
+
+func render(tmpl *template.Template, data toolTemplateData) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+	return format.Source(buf.Bytes())
+}
+
+// wireTool inserts the registration snippet above RegistrationMarker.
+// It reports false without error when the tool is already registered.
+func wireTool(loopPath string, data toolTemplateData) (bool, error) {
+	content, err := os.ReadFile(loopPath)
+	if err != nil {
+		return false, fmt.Errorf("failed to read %s: %w", loopPath, err)
+	}
+
+	src := string(content)
+	if strings.Contains(src, "tools.New"+data.Export+"Tools(") {
+		return false, nil
+	}
+
+	idx := strings.Index(src, RegistrationMarker)
+	if idx < 0 {
+		return false, fmt.Errorf("registration marker not found in %s; register New%sTools manually", loopPath, data.Export)
+	}
+	lineStart := strings.LastIndex(src[:idx], "\n") + 1
+	indent := src[lineStart:idx]
+
+	var snippet bytes.Buffer
+	if err := registrationTemplate.Execute(&snippet, data); err != nil {
+		return false, err
+	}
+	var indented strings.Builder
+	for _, line := range strings.Split(strings.TrimRight(snippet.String(), "\n"), "\n") {
+		if line != "" {
+			indented.WriteString(indent)
+		}
+		indented.WriteString(line + "\n")
+	}
+	indented.WriteString("\n")
+
+	out := src[:lineStart] + indented.String() + src[lineStart:]
+	formatted, err := format.Source([]byte(out))
+	if err != nil {
+		return false, fmt.Errorf("failed to format %s after wiring: %w", loopPath, err)
+	}
+	if err := os.WriteFile(loopPath, formatted, 0644); err != nil {
+		return false, fmt.Errorf("failed to write %s: %w", loopPath, err)
+	}
+	return true, nil
+}
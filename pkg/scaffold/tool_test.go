@@ -0,0 +1,141 @@
+package scaffold
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const fakeLoop = `package agent
+
+func registerSharedTools() {
+	for _, agentID := range ids {
+		// picoclaw gen tool: registrations are inserted above this line
+
+		// Message tool
+	}
+}
+`
+
+func newFakeRepo(t *testing.T) string {
+	t.Helper()
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "pkg", "tools"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(root, "pkg", "agent"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "pkg", "agent", "loop.go"), []byte(fakeLoop), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return root
+}
+
+func TestGenerateTool(t *testing.T) {
+	root := newFakeRepo(t)
+
+	result, err := GenerateTool(ToolOptions{Name: "pubmed-search", Root: root})
+	if err != nil {
+		t.Fatalf("GenerateTool() error = %v", err)
+	}
+	if len(result.Files) != 2 {
+		t.Fatalf("expected 2 files, got %v", result.Files)
+	}
+
+	src, err := os.ReadFile(filepath.Join(root, "pkg", "tools", "pubmed_search.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"func NewPubmedSearchTools(opts PubmedSearchToolOptions) ([]Tool, error)",
+		"type pubmedSearchTool struct",
+		`name:        "pubmed_search_search"`,
+	} {
+		if !strings.Contains(string(src), want) {
+			t.Errorf("generated tool missing %q", want)
+		}
+	}
+
+	loop, err := os.ReadFile(filepath.Join(root, "pkg", "agent", "loop.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	call := strings.Index(string(loop), "tools.NewPubmedSearchTools(")
+	marker := strings.Index(string(loop), RegistrationMarker)
+	if call < 0 || call > marker {
+		t.Fatalf("registration not inserted above marker:\n%s", loop)
+	}
+	if !strings.Contains(string(loop), "logger.ErrorCF") {
+		t.Errorf("registration does not report missing options as an error:\n%s", loop)
+	}
+}
+
+func TestGenerateTool_RefusesOverwriteAndWiresOnce(t *testing.T) {
+	root := newFakeRepo(t)
+
+	if _, err := GenerateTool(ToolOptions{Name: "weather", Root: root}); err != nil {
+		t.Fatalf("first GenerateTool() error = %v", err)
+	}
+	if _, err := GenerateTool(ToolOptions{Name: "weather", Root: root}); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Fatalf("expected already exists error, got %v", err)
+	}
+
+	result, err := GenerateTool(ToolOptions{Name: "weather", Root: root, Force: true})
+	if err != nil {
+		t.Fatalf("forced GenerateTool() error = %v", err)
+	}
+	if result.Wired != "" {
+		t.Errorf("expected no re-wiring, got %q", result.Wired)
+	}
+
+	loop, _ := os.ReadFile(filepath.Join(root, "pkg", "agent", "loop.go"))
+	if n := strings.Count(string(loop), "tools.NewWeatherTools("); n != 1 {
+		t.Errorf("expected one registration, got %d", n)
+	}
+}
+
+func TestGenerateTool_Validation(t *testing.T) {
+	root := newFakeRepo(t)
+
+	tests := []struct {
+		name string
+		opts ToolOptions
+		want string
+	}{
+		{name: "empty", opts: ToolOptions{Root: root}, want: "invalid tool name"},
+		{name: "leading digit", opts: ToolOptions{Name: "1api", Root: root}, want: "invalid tool name"},
+		{name: "punctuation", opts: ToolOptions{Name: "my.api", Root: root}, want: "invalid tool name"},
+		{name: "not a repo", opts: ToolOptions{Name: "api", Root: t.TempDir()}, want: "run from the picoclaw repository root"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := GenerateTool(tt.opts)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestGenerateTool_NoWireAndMissingMarker(t *testing.T) {
+	root := newFakeRepo(t)
+	loopPath := filepath.Join(root, "pkg", "agent", "loop.go")
+	if err := os.WriteFile(loopPath, []byte("package agent\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := GenerateTool(ToolOptions{Name: "alpha", Root: root, NoWire: true}); err != nil {
+		t.Fatalf("GenerateTool(NoWire) error = %v", err)
+	}
+
+	result, err := GenerateTool(ToolOptions{Name: "beta", Root: root})
+	if err == nil || !strings.Contains(err.Error(), "register NewBetaTools manually") {
+		t.Fatalf("expected missing marker error, got %v", err)
+	}
+	if result == nil || len(result.Files) != 2 {
+		t.Fatalf("files should still be reported when wiring fails: %+v", result)
+	}
+}
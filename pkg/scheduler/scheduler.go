@@ -0,0 +1,198 @@
+// Package scheduler sends proactive messages: tasks that run as agent turns
+// on a schedule, such as weekly check-ins or digests of new guidelines,
+// and deliver the answer to the user's chat.
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/cron"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+const (
+	// NothingToSend is the answer with which a task's turn decides there is
+	// nothing worth sending this time, e.g. a digest with no news.
+	NothingToSend = "NOTHING_TO_SEND"
+
+	// configPrefix marks the IDs of tasks defined in config, which Sync
+	// owns and the schedule_task tool may not remove.
+	configPrefix = "config:"
+
+	defaultTimeout = 5 * time.Minute
+)
+
+// TurnRunner runs a scheduled task as an agent turn in the chat's session
+// and returns the answer without sending it.
+type TurnRunner interface {
+	ProcessScheduled(ctx context.Context, prompt, channel, chatID string) (string, error)
+}
+
+// Scheduler keeps scheduled tasks in a cron store of its own and runs them
+// through a TurnRunner.
+type Scheduler struct {
+	cron    *cron.CronService
+	runner  TurnRunner
+	bus     *bus.MessageBus
+	timeout time.Duration
+}
+
+// New creates a scheduler whose tasks are stored at storePath. A timeout
+// of 0 uses the default of 5 minutes per turn.
+func New(storePath string, runner TurnRunner, msgBus *bus.MessageBus, timeout time.Duration) *Scheduler {
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	s := &Scheduler{
+		cron:    cron.NewCronService(storePath, nil),
+		runner:  runner,
+		bus:     msgBus,
+		timeout: timeout,
+	}
+	s.cron.SetOnJob(s.run)
+	return s
+}
+
+// Start runs due tasks until Stop is called.
+func (s *Scheduler) Start() error {
+	return s.cron.Start()
+}
+
+func (s *Scheduler) Stop() {
+	s.cron.Stop()
+}
+
+// Sync makes the stored config tasks match tasks: one job per task and
+// target, replacing changed ones and removing those no longer listed.
+// Tasks added with Add are left alone.
+func (s *Scheduler) Sync(tasks []config.ScheduledTaskConfig) error {
+	want := make(map[string]bool)
+	for _, task := range tasks {
+		name := task.Name
+		if name == "" {
+			name = task.ID
+		}
+		for _, target := range task.Targets {
+			channel, chatID, ok := strings.Cut(target, ":")
+			if !ok {
+				return fmt.Errorf("task %s: target %q is not \"channel:chat_id\"", task.ID, target)
+			}
+			id := configPrefix + task.ID + "@" + target
+			want[id] = true
+			if _, err := s.cron.PutJob(cron.CronJob{
+				ID:       id,
+				Name:     name,
+				Enabled:  !task.Disabled,
+				Schedule: cron.CronSchedule{Kind: "cron", Expr: task.Cron, TZ: task.Timezone},
+				Payload:  cron.CronPayload{Kind: "agent_turn", Message: task.Prompt, Channel: channel, To: chatID},
+			}); err != nil {
+				return fmt.Errorf("task %s: %w", task.ID, err)
+			}
+		}
+	}
+	for _, job := range s.cron.ListJobs(true) {
+		if strings.HasPrefix(job.ID, configPrefix) && !want[job.ID] {
+			s.cron.RemoveJob(job.ID)
+		}
+	}
+	return nil
+}
+
+// Add schedules a task for one chat. One-time tasks are removed once run.
+func (s *Scheduler) Add(name, prompt string, schedule cron.CronSchedule, channel, chatID string) (*cron.CronJob, error) {
+	job, err := s.cron.AddJob(name, schedule, prompt, false, channel, chatID)
+	if err != nil {
+		return nil, err
+	}
+	if job.State.NextRunAtMS == nil {
+		s.cron.RemoveJob(job.ID)
+		return nil, fmt.Errorf("the schedule never runs")
+	}
+	return job, nil
+}
+
+// List returns the tasks scheduled for a chat, including those from
+// config.
+func (s *Scheduler) List(channel, chatID string) []cron.CronJob {
+	var jobs []cron.CronJob
+	for _, job := range s.cron.ListJobs(true) {
+		if job.Payload.Channel == channel && job.Payload.To == chatID {
+			jobs = append(jobs, job)
+		}
+	}
+	return jobs
+}
+
+// Remove removes a task added for the chat. Tasks from config can only be
+// removed from the config.
+func (s *Scheduler) Remove(id, channel, chatID string) error {
+	for _, job := range s.List(channel, chatID) {
+		if job.ID != id {
+			continue
+		}
+		if IsConfigTask(job.ID) {
+			return fmt.Errorf("task %s is set in the config and cannot be removed here", id)
+		}
+		s.cron.RemoveJob(id)
+		return nil
+	}
+	return fmt.Errorf("task %s not found in this chat", id)
+}
+
+// IsConfigTask reports whether the task with this ID is defined in config.
+func IsConfigTask(id string) bool {
+	return strings.HasPrefix(id, configPrefix)
+}
+
+// run runs a due task and sends the answer to its chat.
+func (s *Scheduler) run(job *cron.CronJob) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	channel, chatID := job.Payload.Channel, job.Payload.To
+	answer, err := s.runner.ProcessScheduled(ctx, taskPrompt(job.Payload.Message), channel, chatID)
+	if err != nil {
+		logger.WarnCF("scheduler", "Scheduled task failed",
+			map[string]interface{}{
+				"task":    job.ID,
+				"channel": channel,
+				"chat_id": chatID,
+				"error":   err.Error(),
+			})
+		return "", err
+	}
+	answer = strings.TrimSpace(answer)
+	if answer == "" || strings.HasPrefix(answer, NothingToSend) {
+		logger.InfoCF("scheduler", "Scheduled task had nothing to send",
+			map[string]interface{}{"task": job.ID, "channel": channel, "chat_id": chatID})
+		return "skipped", nil
+	}
+
+	s.bus.PublishOutbound(bus.OutboundMessage{
+		Channel: channel,
+		ChatID:  chatID,
+		Content: answer,
+	})
+	logger.InfoCF("scheduler", "Scheduled message sent",
+		map[string]interface{}{
+			"task":    job.ID,
+			"channel": channel,
+			"chat_id": chatID,
+			"preview": utils.Truncate(answer, 60),
+		})
+	return "sent", nil
+}
+
+// taskPrompt tells the agent that the turn is a scheduled task rather than
+// a message from the user.
+func taskPrompt(prompt string) string {
+	return "[Scheduled task] " + prompt + "\n\n" +
+		"This turn was started by a schedule, not by the user. Write the message to send to the user now. " +
+		"If there is nothing worth sending this time, reply with only " + NothingToSend + "."
+}
@@ -0,0 +1,104 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/cron"
+)
+
+type fakeRunner struct {
+	answer string
+	err    error
+	prompt string
+	chat   string
+}
+
+func (r *fakeRunner) ProcessScheduled(ctx context.Context, prompt, channel, chatID string) (string, error) {
+	r.prompt = prompt
+	r.chat = channel + ":" + chatID
+	return r.answer, r.err
+}
+
+func TestSync(t *testing.T) {
+	s := New(filepath.Join(t.TempDir(), "tasks.json"), &fakeRunner{}, bus.NewMessageBus(), 0)
+	at := time.Now().Add(time.Hour).UnixMilli()
+	if _, err := s.Add("follow up", "Ask about the scan", cron.CronSchedule{Kind: "at", AtMS: &at}, "telegram", "1"); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+
+	tasks := []config.ScheduledTaskConfig{
+		{ID: "checkin", Name: "Weekly check-in", Cron: "0 19 * * 0", Prompt: "Ask how the week went", Targets: []string{"telegram:1", "qq:2"}},
+		{ID: "digest", Cron: "0 9 1 * *", Prompt: "Search for new guidelines", Targets: []string{"telegram:1"}, Disabled: true},
+	}
+	if err := s.Sync(tasks); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	if got := len(s.List("telegram", "1")); got != 3 {
+		t.Fatalf("telegram:1 has %d tasks, want 3", got)
+	}
+
+	// Dropping a task from config removes it; added tasks stay.
+	if err := s.Sync(tasks[:1]); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	jobs := s.List("telegram", "1")
+	if len(jobs) != 2 || jobs[1].ID != "config:checkin@telegram:1" || jobs[1].Name != "Weekly check-in" {
+		t.Fatalf("tasks after sync = %+v", jobs)
+	}
+	if err := s.Remove(jobs[1].ID, "telegram", "1"); err == nil {
+		t.Error("removed a config task")
+	}
+	if err := s.Remove(jobs[0].ID, "qq", "2"); err == nil {
+		t.Error("removed another chat's task")
+	}
+	if err := s.Remove(jobs[0].ID, "telegram", "1"); err != nil {
+		t.Errorf("Remove: %v", err)
+	}
+
+	if err := s.Sync([]config.ScheduledTaskConfig{{ID: "bad", Cron: "0 9 * * *", Targets: []string{"telegram"}}}); err == nil {
+		t.Error("Sync accepted a target without a chat ID")
+	}
+}
+
+func TestRun(t *testing.T) {
+	runner := &fakeRunner{}
+	msgBus := bus.NewMessageBus()
+	s := New(filepath.Join(t.TempDir(), "tasks.json"), runner, msgBus, time.Second)
+	job := &cron.CronJob{ID: "t1", Payload: cron.CronPayload{Message: "Ask how the week went", Channel: "telegram", To: "1"}}
+
+	tests := []struct {
+		name   string
+		answer string
+		err    error
+		status string
+		sent   bool
+	}{
+		{"answer is sent", "Hi! How was your week?", nil, "sent", true},
+		{"nothing to send", NothingToSend + "\n\nThis is not medical advice.", nil, "skipped", false},
+		{"failed turn", "", errors.New("provider down"), "", false},
+	}
+	for _, tt := range tests {
+		runner.answer, runner.err = tt.answer, tt.err
+		status, err := s.run(job)
+		if status != tt.status || (err != nil) != (tt.err != nil) {
+			t.Errorf("%s: run() = %q, %v", tt.name, status, err)
+		}
+		if !strings.HasPrefix(runner.prompt, "[Scheduled task] Ask how the week went") || runner.chat != "telegram:1" {
+			t.Errorf("%s: turn ran with %q for %s", tt.name, runner.prompt, runner.chat)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		msg, ok := msgBus.SubscribeOutbound(ctx)
+		cancel()
+		if ok != tt.sent || (ok && (msg.Content != tt.answer || msg.ChatID != "1")) {
+			t.Errorf("%s: sent %v %+v", tt.name, ok, msg)
+		}
+	}
+}
@@ -0,0 +1,254 @@
+// Package semcache caches answers by the meaning of their questions, so a
+// question asked again in other words gets the same answer without another
+// model call.
+package semcache
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/sipeed/picoclaw/pkg/rag"
+)
+
+// Entry is a cached answer with the embedding of its question.
+type Entry struct {
+	ID       string    `json:"id"`
+	AgentID  string    `json:"agent_id"`
+	Persona  string    `json:"persona,omitempty"`
+	Question string    `json:"question"`
+	Chinese  bool      `json:"chinese,omitempty"`
+	Answer   string    `json:"answer"`
+	Vector   []float32 `json:"vector,omitempty"`
+	Created  time.Time `json:"created"`
+	LastHit  time.Time `json:"last_hit,omitempty"`
+	Hits     int       `json:"hits,omitempty"`
+}
+
+// Options configures a Cache. A zero TTL keeps answers until they are
+// evicted; zero MaxEntries keeps any number.
+type Options struct {
+	Threshold  float64
+	TTL        time.Duration
+	MaxEntries int
+}
+
+// Cache keeps answers in memory and in a JSON file, rewritten on change.
+// Answers only match questions for the same agent and persona in the same
+// language, since multilingual embeddings place a question near its
+// translation, and a persona changes the tone of the answer.
+type Cache struct {
+	embedder rag.Embedder
+	path     string
+	opts     Options
+	mu       sync.Mutex
+	entries  []*Entry
+	now      func() time.Time
+}
+
+// Open loads the cache kept at path, creating its directory if needed.
+func Open(path string, embedder rag.Embedder, opts Options) (*Cache, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create answer cache directory: %w", err)
+	}
+	c := &Cache{embedder: embedder, path: path, opts: opts, now: time.Now}
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read answer cache: %w", err)
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &c.entries); err != nil {
+			return nil, fmt.Errorf("invalid answer cache %s: %w", path, err)
+		}
+	}
+	for _, e := range c.entries {
+		e.Vector = normalize(e.Vector)
+	}
+	return c, nil
+}
+
+// Embed returns the normalized embedding of a question.
+func (c *Cache) Embed(ctx context.Context, question string) ([]float32, error) {
+	vectors, err := c.embedder.Embed(ctx, []string{question})
+	if err != nil {
+		return nil, err
+	}
+	if len(vectors) != 1 {
+		return nil, fmt.Errorf("embedder returned %d vectors for 1 text", len(vectors))
+	}
+	return normalize(vectors[0]), nil
+}
+
+// Lookup returns a copy of the unexpired answer whose question is most
+// similar to the given one, with its similarity, if that reaches the
+// threshold. A hit is counted on the entry.
+func (c *Cache) Lookup(agentID, persona, question string, vector []float32) (*Entry, float64, bool) {
+	chinese := hasHan(question)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var best *Entry
+	bestScore := 0.0
+	for _, e := range c.entries {
+		if e.AgentID != agentID || e.Persona != persona || e.Chinese != chinese || c.expired(e) {
+			continue
+		}
+		if score := dot(vector, e.Vector); score > bestScore {
+			best, bestScore = e, score
+		}
+	}
+	if best == nil || bestScore < c.opts.Threshold {
+		return nil, bestScore, false
+	}
+	best.Hits++
+	best.LastHit = c.now()
+	c.saveLocked()
+	hit := *best
+	return &hit, bestScore, true
+}
+
+// Put caches an answer, replacing the answer to a question similar enough
+// to have been served for it, and evicts expired and least recently used
+// answers beyond MaxEntries.
+func (c *Cache) Put(agentID, persona, question string, vector []float32, answer string) error {
+	entry := &Entry{
+		ID:       newID(),
+		AgentID:  agentID,
+		Persona:  persona,
+		Question: question,
+		Chinese:  hasHan(question),
+		Answer:   answer,
+		Vector:   vector,
+		Created:  c.now(),
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	kept := c.entries[:0]
+	for _, e := range c.entries {
+		replaced := e.AgentID == agentID && e.Persona == persona && e.Chinese == entry.Chinese && dot(vector, e.Vector) >= c.opts.Threshold
+		if !replaced && !c.expired(e) {
+			kept = append(kept, e)
+		}
+	}
+	c.entries = append(kept, entry)
+	if c.opts.MaxEntries > 0 && len(c.entries) > c.opts.MaxEntries {
+		sort.SliceStable(c.entries, func(i, j int) bool {
+			return lastUsed(c.entries[i]).After(lastUsed(c.entries[j]))
+		})
+		c.entries = c.entries[:c.opts.MaxEntries]
+	}
+	return c.saveLocked()
+}
+
+// Remove deletes an answer, reporting whether it was cached.
+func (c *Cache) Remove(id string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, e := range c.entries {
+		if e.ID == id {
+			c.entries = append(c.entries[:i:i], c.entries[i+1:]...)
+			c.saveLocked()
+			return true
+		}
+	}
+	return false
+}
+
+// List returns the cached answers, newest first, without their vectors.
+func (c *Cache) List() []Entry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	out := make([]Entry, 0, len(c.entries))
+	for i := len(c.entries) - 1; i >= 0; i-- {
+		e := *c.entries[i]
+		e.Vector = nil
+		out = append(out, e)
+	}
+	return out
+}
+
+// Len returns the number of cached answers, including expired ones not
+// yet evicted.
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
+
+func (c *Cache) expired(e *Entry) bool {
+	return c.opts.TTL > 0 && c.now().Sub(e.Created) > c.opts.TTL
+}
+
+func (c *Cache) saveLocked() error {
+	data, err := json.Marshal(c.entries)
+	if err != nil {
+		return err
+	}
+	tmp := c.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write answer cache: %w", err)
+	}
+	return os.Rename(tmp, c.path)
+}
+
+func lastUsed(e *Entry) time.Time {
+	if e.LastHit.After(e.Created) {
+		return e.LastHit
+	}
+	return e.Created
+}
+
+func newID() string {
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("ans-%d", time.Now().UnixNano())
+	}
+	return "ans-" + hex.EncodeToString(b)
+}
+
+func hasHan(s string) bool {
+	for _, r := range s {
+		if unicode.Is(unicode.Han, r) {
+			return true
+		}
+	}
+	return false
+}
+
+// normalize scales v to unit length, so cosine similarity is a dot product.
+func normalize(v []float32) []float32 {
+	var sum float64
+	for _, x := range v {
+		sum += float64(x) * float64(x)
+	}
+	out := make([]float32, len(v))
+	if sum == 0 {
+		return out
+	}
+	norm := math.Sqrt(sum)
+	for i, x := range v {
+		out[i] = float32(float64(x) / norm)
+	}
+	return out
+}
+
+func dot(a, b []float32) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var sum float64
+	for i := range a {
+		sum += float64(a[i]) * float64(b[i])
+	}
+	return sum
+}
@@ -0,0 +1,103 @@
+package semcache
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// axisEmbedder embeds each known text as a fixed vector.
+type axisEmbedder map[string][]float32
+
+func (e axisEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	out := make([][]float32, len(texts))
+	for i, t := range texts {
+		out[i] = e[t]
+	}
+	return out, nil
+}
+
+func TestCache(t *testing.T) {
+	embedder := axisEmbedder{
+		"survival rate?":     {1, 0, 0},
+		"how long to live?":  {0.95, 0.3, 0},
+		"diet after surgery": {0, 1, 0},
+		"生存率？":               {1, 0, 0},
+	}
+	path := filepath.Join(t.TempDir(), "cache", "answers.json")
+	c, err := Open(path, embedder, Options{Threshold: 0.9, TTL: time.Hour, MaxEntries: 2})
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	now := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+	c.now = func() time.Time { return now }
+	embed := func(q string) []float32 {
+		v, err := c.Embed(context.Background(), q)
+		if err != nil {
+			t.Fatalf("Embed: %v", err)
+		}
+		return v
+	}
+
+	if err := c.Put("main", "", "survival rate?", embed("survival rate?"), "answer A"); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	hit, score, ok := c.Lookup("main", "", "how long to live?", embed("how long to live?"))
+	if !ok || hit.Answer != "answer A" || score < 0.9 {
+		t.Fatalf("near duplicate: %+v %.3f %v", hit, score, ok)
+	}
+	if _, _, ok := c.Lookup("main", "", "diet after surgery", embed("diet after surgery")); ok {
+		t.Fatal("unrelated question hit")
+	}
+	if _, _, ok := c.Lookup("other", "", "survival rate?", embed("survival rate?")); ok {
+		t.Fatal("other agent hit")
+	}
+	if _, _, ok := c.Lookup("main", "clinician", "survival rate?", embed("survival rate?")); ok {
+		t.Fatal("other persona hit")
+	}
+	if _, _, ok := c.Lookup("main", "", "生存率？", embed("生存率？")); ok {
+		t.Fatal("other language hit")
+	}
+
+	// A similar question replaces the answer rather than adding one.
+	c.Put("main", "", "how long to live?", embed("how long to live?"), "answer B")
+	if c.Len() != 1 {
+		t.Fatalf("Len after replace = %d", c.Len())
+	}
+
+	// Reopening loads the answers and their hit counts.
+	c.Lookup("main", "", "survival rate?", embed("survival rate?"))
+	reopened, err := Open(path, embedder, Options{Threshold: 0.9, TTL: time.Hour, MaxEntries: 2})
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	reopened.now = c.now
+	hit, _, ok = reopened.Lookup("main", "", "survival rate?", embed("survival rate?"))
+	if !ok || hit.Answer != "answer B" || hit.Hits != 2 {
+		t.Fatalf("after reopen: %+v %v", hit, ok)
+	}
+
+	// The least recently used answer is evicted beyond MaxEntries.
+	now = now.Add(time.Minute)
+	reopened.Put("main", "", "diet after surgery", embed("diet after surgery"), "answer C")
+	now = now.Add(time.Minute)
+	reopened.Lookup("main", "", "diet after surgery", embed("diet after surgery"))
+	reopened.Put("main", "", "生存率？", embed("生存率？"), "答案")
+	if _, _, ok := reopened.Lookup("main", "", "survival rate?", embed("survival rate?")); ok || reopened.Len() != 2 {
+		t.Fatalf("LRU answer not evicted, %d answers", reopened.Len())
+	}
+
+	// Expired answers are not served, and removed answers are gone.
+	now = now.Add(2 * time.Hour)
+	if _, _, ok := reopened.Lookup("main", "", "生存率？", embed("生存率？")); ok {
+		t.Fatal("expired answer served")
+	}
+	list := reopened.List()
+	if len(list) != 2 || list[0].Answer != "答案" || list[0].Vector != nil {
+		t.Fatalf("List = %+v", list)
+	}
+	if !reopened.Remove(list[0].ID) || reopened.Remove(list[0].ID) || reopened.Len() != 1 {
+		t.Fatal("Remove")
+	}
+}
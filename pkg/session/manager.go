@@ -1,10 +1,9 @@
 package session
 
 import (
-	"encoding/json"
+	"fmt"
 	"os"
-	"path/filepath"
-	"strings"
+	"sort"
 	"sync"
 	"time"
 
@@ -12,33 +11,93 @@ import (
 )
 
 type Session struct {
-	Key      string              `json:"key"`
-	Messages []providers.Message `json:"messages"`
-	Summary  string              `json:"summary,omitempty"`
-	Created  time.Time           `json:"created"`
-	Updated  time.Time           `json:"updated"`
+	Key        string              `json:"key"`
+	Channel    string              `json:"channel,omitempty"`
+	UserID     string              `json:"user_id,omitempty"`
+	Messages   []providers.Message `json:"messages"`
+	Summary    string              `json:"summary,omitempty"`
+	ForkedFrom string              `json:"forked_from,omitempty"`
+	ForkTurn   int                 `json:"fork_turn,omitempty"`
+	// Scenario is the what-if premise of a fork, such as "the patient is
+	// ECOG 2", applied to every turn in it.
+	Scenario string `json:"scenario,omitempty"`
+	// AnswerStyle is how the user asked answers to be written: CLINICAL,
+	// RESEARCH or POPULAR_SCIENCE, or empty to let the agent choose.
+	AnswerStyle string `json:"answer_style,omitempty"`
+	// Medications are the medication reminders set up in this session.
+	Medications []MedicationReminder `json:"medications,omitempty"`
+	// Intake is the intake in progress, if the agent is still collecting
+	// the details a question needs.
+	Intake *IntakeState `json:"intake,omitempty"`
+	// Scratchpad is the session's working memory: facts worked out during
+	// the conversation, such as patient parameters or chosen trial IDs,
+	// shown to the agent every turn.
+	Scratchpad map[string]string `json:"scratchpad,omitempty"`
+	Created    time.Time         `json:"created"`
+	Updated    time.Time         `json:"updated"`
+}
+
+// IntakeState is an intake in progress: the question that started it, the
+// fields collected so far and how many times the user has been asked.
+type IntakeState struct {
+	Flow     string            `json:"flow"`
+	Question string            `json:"question"`
+	Fields   map[string]string `json:"fields,omitempty"`
+	Rounds   int               `json:"rounds"`
+	Started  time.Time         `json:"started"`
+}
+
+// MedicationReminder is a medication schedule. Reminders are delivered by
+// scheduler jobs, one per time of day, listed in JobIDs.
+type MedicationReminder struct {
+	ID           string    `json:"id"`
+	Medication   string    `json:"medication"`
+	Dose         string    `json:"dose,omitempty"`
+	Instructions string    `json:"instructions,omitempty"`
+	Times        []string  `json:"times"`
+	Days         []string  `json:"days,omitempty"`
+	Timezone     string    `json:"timezone,omitempty"`
+	JobIDs       []string  `json:"job_ids"`
+	Created      time.Time `json:"created"`
 }
 
 type SessionManager struct {
 	sessions map[string]*Session
 	mu       sync.RWMutex
-	storage  string
+	store    Store
 }
 
+// NewSessionManager returns a session manager that keeps each session as
+// a JSON file in the storage directory, or only in memory when storage is
+// empty.
 func NewSessionManager(storage string) *SessionManager {
-	sm := &SessionManager{
-		sessions: make(map[string]*Session),
-		storage:  storage,
-	}
-
+	sm := &SessionManager{sessions: make(map[string]*Session)}
 	if storage != "" {
 		os.MkdirAll(storage, 0755)
-		sm.loadSessions()
+		sm.store = NewFileStore(storage)
+		sm.load()
 	}
-
 	return sm
 }
 
+// NewSessionManagerWithStore returns a session manager that restores its
+// sessions from store and saves them there.
+func NewSessionManagerWithStore(store Store) (*SessionManager, error) {
+	sm := &SessionManager{sessions: make(map[string]*Session), store: store}
+	if err := sm.load(); err != nil {
+		return nil, err
+	}
+	return sm, nil
+}
+
+func (sm *SessionManager) load() error {
+	sessions, err := sm.store.Load()
+	for _, s := range sessions {
+		sm.sessions[s.Key] = s
+	}
+	return err
+}
+
 func (sm *SessionManager) GetOrCreate(key string) *Session {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
@@ -59,6 +118,14 @@ func (sm *SessionManager) GetOrCreate(key string) *Session {
 	return session
 }
 
+// Exists reports whether a session with key is known.
+func (sm *SessionManager) Exists(key string) bool {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	_, ok := sm.sessions[key]
+	return ok
+}
+
 func (sm *SessionManager) AddMessage(sessionKey, role, content string) {
 	sm.AddFullMessage(sessionKey, providers.Message{
 		Role:    role,
@@ -150,26 +217,13 @@ func (sm *SessionManager) TruncateHistory(key string, keepLast int) {
 // volume separator on Windows, so filepath.Base would misinterpret the key.
 // We replace it with '_'. The original key is preserved inside the JSON file,
 // so loadSessions still maps back to the right in-memory key.
-func sanitizeFilename(key string) string {
-	return strings.ReplaceAll(key, ":", "_")
-}
-
+// Save writes the session with key to the store, if there is one.
 func (sm *SessionManager) Save(key string) error {
-	if sm.storage == "" {
+	if sm.store == nil {
 		return nil
 	}
 
-	filename := sanitizeFilename(key)
-
-	// filepath.IsLocal rejects empty names, "..", absolute paths, and
-	// OS-reserved device names (NUL, COM1 … on Windows).
-	// The extra checks reject "." and any directory separators so that
-	// the session file is always written directly inside sm.storage.
-	if filename == "." || !filepath.IsLocal(filename) || strings.ContainsAny(filename, `/\`) {
-		return os.ErrInvalid
-	}
-
-	// Snapshot under read lock, then perform slow file I/O after unlock.
+	// Snapshot under read lock, then let the store do slow I/O after unlock.
 	sm.mu.RLock()
 	stored, ok := sm.sessions[key]
 	if !ok {
@@ -178,10 +232,19 @@ func (sm *SessionManager) Save(key string) error {
 	}
 
 	snapshot := Session{
-		Key:     stored.Key,
-		Summary: stored.Summary,
-		Created: stored.Created,
-		Updated: stored.Updated,
+		Key:         stored.Key,
+		Channel:     stored.Channel,
+		UserID:      stored.UserID,
+		Summary:     stored.Summary,
+		ForkedFrom:  stored.ForkedFrom,
+		ForkTurn:    stored.ForkTurn,
+		Scenario:    stored.Scenario,
+		AnswerStyle: stored.AnswerStyle,
+		Medications: append([]MedicationReminder(nil), stored.Medications...),
+		Intake:      stored.Intake,
+		Scratchpad:  copyScratchpad(stored.Scratchpad),
+		Created:     stored.Created,
+		Updated:     stored.Updated,
 	}
 	if len(stored.Messages) > 0 {
 		snapshot.Messages = make([]providers.Message, len(stored.Messages))
@@ -191,92 +254,361 @@ func (sm *SessionManager) Save(key string) error {
 	}
 	sm.mu.RUnlock()
 
-	data, err := json.MarshalIndent(snapshot, "", "  ")
-	if err != nil {
-		return err
+	return sm.store.Save(&snapshot)
+}
+
+// SetOrigin records the channel and user a session belongs to, so stores
+// can look sessions up by who they are with.
+func (sm *SessionManager) SetOrigin(key, channel, userID string) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	if session, ok := sm.sessions[key]; ok && channel != "" && userID != "" {
+		session.Channel, session.UserID = channel, userID
+	}
+}
+
+// SetHistory updates the messages of a session.
+func (sm *SessionManager) SetHistory(key string, history []providers.Message) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	session, ok := sm.sessions[key]
+	if ok {
+		// Create a deep copy to strictly isolate internal state
+		// from the caller's slice.
+		msgs := make([]providers.Message, len(history))
+		copy(msgs, history)
+		session.Messages = msgs
+		session.Updated = time.Now()
 	}
+}
+
+// Compact replaces the oldest n messages of a session with summary, which
+// becomes the session's summary. It does nothing if the session has fewer
+// than n messages, as after a concurrent reset.
+func (sm *SessionManager) Compact(key string, n int, summary string) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
 
-	sessionPath := filepath.Join(sm.storage, filename+".json")
-	tmpFile, err := os.CreateTemp(sm.storage, "session-*.tmp")
-	if err != nil {
-		return err
+	session, ok := sm.sessions[key]
+	if !ok || n <= 0 || n > len(session.Messages) {
+		return
 	}
+	msgs := make([]providers.Message, len(session.Messages)-n)
+	copy(msgs, session.Messages[n:])
+	session.Messages = msgs
+	session.Summary = summary
+	session.Updated = time.Now()
+}
+
+// AddMedicationReminder adds a medication reminder to a session, creating
+// the session if needed.
+func (sm *SessionManager) AddMedicationReminder(key string, reminder MedicationReminder) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
 
-	tmpPath := tmpFile.Name()
-	cleanup := true
-	defer func() {
-		if cleanup {
-			_ = os.Remove(tmpPath)
+	session, ok := sm.sessions[key]
+	if !ok {
+		session = &Session{
+			Key:      key,
+			Messages: []providers.Message{},
+			Created:  time.Now(),
 		}
-	}()
+		sm.sessions[key] = session
+	}
+	session.Medications = append(session.Medications, reminder)
+	session.Updated = time.Now()
+}
+
+// MedicationReminders returns the medication reminders of a session.
+func (sm *SessionManager) MedicationReminders(key string) []MedicationReminder {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	session, ok := sm.sessions[key]
+	if !ok {
+		return nil
+	}
+	return append([]MedicationReminder(nil), session.Medications...)
+}
+
+// RemoveMedicationReminder removes a medication reminder from a session
+// and returns it.
+func (sm *SessionManager) RemoveMedicationReminder(key, id string) (MedicationReminder, bool) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
 
-	if _, err := tmpFile.Write(data); err != nil {
-		_ = tmpFile.Close()
-		return err
+	session, ok := sm.sessions[key]
+	if !ok {
+		return MedicationReminder{}, false
 	}
-	if err := tmpFile.Chmod(0644); err != nil {
-		_ = tmpFile.Close()
-		return err
+	for i, r := range session.Medications {
+		if r.ID == id {
+			session.Medications = append(session.Medications[:i:i], session.Medications[i+1:]...)
+			session.Updated = time.Now()
+			return r, true
+		}
 	}
-	if err := tmpFile.Sync(); err != nil {
-		_ = tmpFile.Close()
-		return err
+	return MedicationReminder{}, false
+}
+
+// Intake returns a copy of the intake in progress in a session, or nil.
+func (sm *SessionManager) Intake(key string) *IntakeState {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	session, ok := sm.sessions[key]
+	if !ok || session.Intake == nil {
+		return nil
 	}
-	if err := tmpFile.Close(); err != nil {
-		return err
+	state := *session.Intake
+	state.Fields = make(map[string]string, len(session.Intake.Fields))
+	for k, v := range session.Intake.Fields {
+		state.Fields[k] = v
 	}
+	return &state
+}
+
+// SetIntake stores the intake in progress in a session, creating the
+// session if needed; nil ends the intake.
+func (sm *SessionManager) SetIntake(key string, state *IntakeState) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
 
-	if err := os.Rename(tmpPath, sessionPath); err != nil {
-		return err
+	session, ok := sm.sessions[key]
+	if !ok {
+		if state == nil {
+			return
+		}
+		session = &Session{
+			Key:      key,
+			Messages: []providers.Message{},
+			Created:  time.Now(),
+		}
+		sm.sessions[key] = session
 	}
-	cleanup = false
-	return nil
+	if state != nil {
+		copied := *state
+		state = &copied
+	}
+	session.Intake = state
+	session.Updated = time.Now()
 }
 
-func (sm *SessionManager) loadSessions() error {
-	files, err := os.ReadDir(sm.storage)
-	if err != nil {
-		return err
+// Scenario returns the what-if premise of a session, if it has one.
+func (sm *SessionManager) Scenario(key string) string {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	if session, ok := sm.sessions[key]; ok {
+		return session.Scenario
 	}
+	return ""
+}
 
-	for _, file := range files {
-		if file.IsDir() {
-			continue
-		}
+// SetScenario sets the what-if premise of an existing session.
+func (sm *SessionManager) SetScenario(key, scenario string) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
 
-		if filepath.Ext(file.Name()) != ".json" {
-			continue
-		}
+	if session, ok := sm.sessions[key]; ok {
+		session.Scenario = scenario
+		session.Updated = time.Now()
+	}
+}
 
-		sessionPath := filepath.Join(sm.storage, file.Name())
-		data, err := os.ReadFile(sessionPath)
-		if err != nil {
-			continue
+// AnswerStyle returns the answer style chosen in a session, if any.
+func (sm *SessionManager) AnswerStyle(key string) string {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	if session, ok := sm.sessions[key]; ok {
+		return session.AnswerStyle
+	}
+	return ""
+}
+
+// SetAnswerStyle sets the answer style of an existing session; an empty
+// style lets the agent choose again.
+func (sm *SessionManager) SetAnswerStyle(key, style string) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	if session, ok := sm.sessions[key]; ok {
+		session.AnswerStyle = style
+		session.Updated = time.Now()
+	}
+}
+
+// Scratchpad returns a copy of the scratchpad of a session.
+func (sm *SessionManager) Scratchpad(key string) map[string]string {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	if session, ok := sm.sessions[key]; ok {
+		return copyScratchpad(session.Scratchpad)
+	}
+	return nil
+}
+
+// UpdateScratchpad sets the entries in set and removes those named in
+// remove from the scratchpad of a session, creating the session if needed.
+// An empty value also removes its entry.
+func (sm *SessionManager) UpdateScratchpad(key string, set map[string]string, remove []string) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	session, ok := sm.sessions[key]
+	if !ok {
+		session = &Session{
+			Key:      key,
+			Messages: []providers.Message{},
+			Created:  time.Now(),
+		}
+		sm.sessions[key] = session
+	}
+	if session.Scratchpad == nil {
+		session.Scratchpad = make(map[string]string)
+	}
+	for name, value := range set {
+		if value == "" {
+			delete(session.Scratchpad, name)
+		} else {
+			session.Scratchpad[name] = value
 		}
+	}
+	for _, name := range remove {
+		delete(session.Scratchpad, name)
+	}
+	if len(session.Scratchpad) == 0 {
+		session.Scratchpad = nil
+	}
+	session.Updated = time.Now()
+}
+
+func copyScratchpad(entries map[string]string) map[string]string {
+	if len(entries) == 0 {
+		return nil
+	}
+	out := make(map[string]string, len(entries))
+	for k, v := range entries {
+		out[k] = v
+	}
+	return out
+}
+
+// ForkInfo describes a fork of a session.
+type ForkInfo struct {
+	Key      string    `json:"session_key"`
+	Turn     int       `json:"turn"`
+	Scenario string    `json:"scenario,omitempty"`
+	Turns    int       `json:"turns"`
+	Created  time.Time `json:"created"`
+	Updated  time.Time `json:"updated"`
+}
+
+// Forks returns the forks made directly from a session, oldest first.
+func (sm *SessionManager) Forks(key string) []ForkInfo {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
 
-		var session Session
-		if err := json.Unmarshal(data, &session); err != nil {
+	var forks []ForkInfo
+	for _, session := range sm.sessions {
+		if session.ForkedFrom != key {
 			continue
 		}
+		turns := 0
+		for _, msg := range session.Messages {
+			if msg.Role == "user" {
+				turns++
+			}
+		}
+		forks = append(forks, ForkInfo{
+			Key:      session.Key,
+			Turn:     session.ForkTurn,
+			Scenario: session.Scenario,
+			Turns:    turns,
+			Created:  session.Created,
+			Updated:  session.Updated,
+		})
+	}
+	sort.Slice(forks, func(i, j int) bool {
+		if !forks[i].Created.Equal(forks[j].Created) {
+			return forks[i].Created.Before(forks[j].Created)
+		}
+		return forks[i].Key < forks[j].Key
+	})
+	return forks
+}
+
+// UserTurns returns the user messages of a session in order. Turn N in
+// Fork refers to UserTurns(key)[N-1].
+func (sm *SessionManager) UserTurns(key string) []string {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
 
-		sm.sessions[session.Key] = &session
+	session, ok := sm.sessions[key]
+	if !ok {
+		return nil
 	}
 
-	return nil
+	var turns []string
+	for _, msg := range session.Messages {
+		if msg.Role == "user" {
+			turns = append(turns, msg.Content)
+		}
+	}
+	return turns
 }
 
-// SetHistory updates the messages of a session.
-func (sm *SessionManager) SetHistory(key string, history []providers.Message) {
+// Fork creates a new session dstKey seeded with srcKey's summary and its
+// history through the first turns user turns, including the replies and
+// tool calls that followed them. The source session is left untouched.
+func (sm *SessionManager) Fork(srcKey, dstKey string, turns int) (*Session, error) {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 
-	session, ok := sm.sessions[key]
-	if ok {
-		// Create a deep copy to strictly isolate internal state
-		// from the caller's slice.
-		msgs := make([]providers.Message, len(history))
-		copy(msgs, history)
-		session.Messages = msgs
-		session.Updated = time.Now()
+	src, ok := sm.sessions[srcKey]
+	if !ok {
+		return nil, fmt.Errorf("session %q not found", srcKey)
+	}
+	if _, exists := sm.sessions[dstKey]; exists {
+		return nil, fmt.Errorf("session %q already exists", dstKey)
+	}
+
+	cut, seen := len(src.Messages), 0
+	for i, msg := range src.Messages {
+		if msg.Role != "user" {
+			continue
+		}
+		if seen == turns {
+			cut = i
+			break
+		}
+		seen++
+	}
+	if turns < 0 || turns > seen {
+		return nil, fmt.Errorf("turn must be between 0 and %d, got %d", seen, turns)
+	}
+
+	msgs := make([]providers.Message, cut)
+	copy(msgs, src.Messages[:cut])
+	now := time.Now()
+	fork := &Session{
+		Key:         dstKey,
+		Messages:    msgs,
+		Summary:     src.Summary,
+		Channel:     src.Channel,
+		UserID:      src.UserID,
+		ForkedFrom:  srcKey,
+		ForkTurn:    turns,
+		Scenario:    src.Scenario,
+		AnswerStyle: src.AnswerStyle,
+		Scratchpad:  copyScratchpad(src.Scratchpad),
+		Created:     now,
+		Updated:     now,
 	}
+	sm.sessions[dstKey] = fork
+	return fork, nil
 }
@@ -72,3 +72,136 @@ func TestSave_RejectsPathTraversal(t *testing.T) {
 		}
 	}
 }
+
+func TestFork(t *testing.T) {
+	sm := NewSessionManager(t.TempDir())
+	src := "agent:main:telegram:direct:1"
+	sm.AddMessage(src, "user", "q1")
+	sm.AddMessage(src, "assistant", "a1")
+	sm.AddMessage(src, "user", "q2")
+	sm.AddMessage(src, "assistant", "a2")
+	sm.AddMessage(src, "user", "q3")
+	sm.AddMessage(src, "assistant", "a3")
+	sm.SetSummary(src, "earlier context")
+
+	tests := []struct {
+		name    string
+		turns   int
+		wantLen int
+		wantErr bool
+	}{
+		{name: "after first turn", turns: 1, wantLen: 2},
+		{name: "after all turns", turns: 3, wantLen: 6},
+		{name: "empty fork", turns: 0, wantLen: 0},
+		{name: "too many turns", turns: 4, wantErr: true},
+		{name: "negative", turns: -1, wantErr: true},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dst := src + ":fork:" + string(rune('a'+i))
+			fork, err := sm.Fork(src, dst, tt.turns)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Fork() error = %v", err)
+			}
+			if len(fork.Messages) != tt.wantLen || fork.ForkedFrom != src || fork.ForkTurn != tt.turns {
+				t.Errorf("unexpected fork: %d messages, from %q, turn %d", len(fork.Messages), fork.ForkedFrom, fork.ForkTurn)
+			}
+			if sm.GetSummary(dst) != "earlier context" {
+				t.Error("expected summary to be copied")
+			}
+		})
+	}
+
+	// The fork is independent of the source.
+	sm.AddMessage(src+":fork:a", "user", "alternative q2")
+	if got := sm.UserTurns(src); len(got) != 3 || got[1] != "q2" {
+		t.Errorf("source modified by fork: %v", got)
+	}
+	if got := sm.UserTurns(src + ":fork:a"); len(got) != 2 || got[1] != "alternative q2" {
+		t.Errorf("unexpected fork turns: %v", got)
+	}
+
+	if _, err := sm.Fork(src, src+":fork:a", 1); err == nil {
+		t.Error("expected error for existing destination")
+	}
+	if _, err := sm.Fork("missing", "x", 0); err == nil {
+		t.Error("expected error for missing source")
+	}
+}
+
+func TestMedicationReminders_Persist(t *testing.T) {
+	dir := t.TempDir()
+	sm := NewSessionManager(dir)
+	key := "telegram:42"
+	sm.AddMedicationReminder(key, MedicationReminder{ID: "med-1", Medication: "Creon", Times: []string{"08:00"}, JobIDs: []string{"j1"}})
+	sm.AddMedicationReminder(key, MedicationReminder{ID: "med-2", Medication: "Metformin", Times: []string{"20:00"}, JobIDs: []string{"j2"}})
+	if err := sm.Save(key); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	reloaded := NewSessionManager(dir)
+	got := reloaded.MedicationReminders(key)
+	if len(got) != 2 || got[0].Medication != "Creon" || got[1].JobIDs[0] != "j2" {
+		t.Fatalf("reloaded reminders = %+v", got)
+	}
+
+	removed, ok := reloaded.RemoveMedicationReminder(key, "med-1")
+	if !ok || removed.Medication != "Creon" {
+		t.Fatalf("RemoveMedicationReminder = %+v, %v", removed, ok)
+	}
+	if _, ok := reloaded.RemoveMedicationReminder(key, "med-1"); ok {
+		t.Error("removed the same reminder twice")
+	}
+	if got := reloaded.MedicationReminders(key); len(got) != 1 || got[0].ID != "med-2" {
+		t.Errorf("after remove = %+v", got)
+	}
+}
+
+func TestCompact(t *testing.T) {
+	sm := NewSessionManager(t.TempDir())
+	key := "agent:main:telegram:direct:1"
+	sm.AddMessage(key, "user", "q1")
+	sm.AddMessage(key, "assistant", "a1")
+	sm.AddMessage(key, "user", "q2")
+
+	sm.Compact(key, 5, "too far")
+	if len(sm.GetHistory(key)) != 3 || sm.GetSummary(key) != "" {
+		t.Fatalf("compacting past the end changed the session")
+	}
+	sm.Compact(key, 2, "q1 answered")
+	history := sm.GetHistory(key)
+	if len(history) != 1 || history[0].Content != "q2" || sm.GetSummary(key) != "q1 answered" {
+		t.Errorf("history = %+v, summary = %q", history, sm.GetSummary(key))
+	}
+}
+
+func TestScratchpad(t *testing.T) {
+	sm := NewSessionManager("")
+	sm.UpdateScratchpad("s1", map[string]string{"ecog": "1", "stage": "III"}, nil)
+	sm.AddMessage("s1", "user", "hello")
+
+	fork, err := sm.Fork("s1", "s1:fork", 1)
+	if err != nil {
+		t.Fatalf("Fork: %v", err)
+	}
+	if fork.Scratchpad["ecog"] != "1" {
+		t.Fatalf("fork scratchpad = %v", fork.Scratchpad)
+	}
+
+	// Forks have their own copy.
+	sm.UpdateScratchpad("s1:fork", map[string]string{"ecog": "2"}, []string{"stage"})
+	if got := sm.Scratchpad("s1"); got["ecog"] != "1" || got["stage"] != "III" {
+		t.Errorf("source scratchpad = %v", got)
+	}
+	sm.UpdateScratchpad("s1:fork", map[string]string{"ecog": ""}, nil)
+	if got := sm.Scratchpad("s1:fork"); got != nil {
+		t.Errorf("emptied scratchpad = %v", got)
+	}
+}
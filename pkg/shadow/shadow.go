@@ -0,0 +1,317 @@
+// Package shadow runs candidate replacements for a model or tool alongside
+// the current one on a sample of traffic. Shadow results are compared with
+// the live result and written to a log; they are never shown to the model
+// or the user.
+package shadow
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+const (
+	KindTool  = "tool"
+	KindModel = "model"
+
+	defaultTimeout = 60 * time.Second
+	maxResultChars = 4000
+	// maxWords bounds the work spent comparing very long results.
+	maxWords = 2000
+)
+
+// Record is one comparison between a live call and its shadow.
+type Record struct {
+	Time          time.Time `json:"time"`
+	Kind          string    `json:"kind"`
+	Primary       string    `json:"primary"`
+	Shadow        string    `json:"shadow"`
+	AgentID       string    `json:"agent_id,omitempty"`
+	SessionKey    string    `json:"session_key,omitempty"`
+	TurnID        string    `json:"turn_id,omitempty"`
+	Input         string    `json:"input,omitempty"`
+	PrimaryResult string    `json:"primary_result"`
+	ShadowResult  string    `json:"shadow_result"`
+	PrimaryError  string    `json:"primary_error,omitempty"`
+	ShadowError   string    `json:"shadow_error,omitempty"`
+	PrimaryMs     int64     `json:"primary_ms"`
+	ShadowMs      int64     `json:"shadow_ms"`
+	// Match is true when both calls succeeded, or both failed, with results
+	// that are identical apart from whitespace.
+	Match bool `json:"match"`
+	// Similarity is the word-set overlap of the two results, from 0 to 1.
+	Similarity float64 `json:"similarity"`
+}
+
+// Options configures a Runner.
+type Options struct {
+	// SampleRate is the fraction of calls shadowed, from 0 to 1.
+	SampleRate float64
+	// Timeout bounds each shadow call; defaults to 60 seconds.
+	Timeout time.Duration
+	// Model is the shadow model, if any.
+	Model string
+	// Tools maps live tool names to their shadow tools.
+	Tools map[string]string
+}
+
+// Runner samples calls, runs their shadows in the background and logs the
+// comparisons.
+type Runner struct {
+	opts   Options
+	sample func() float64
+	wg     sync.WaitGroup
+	mu     sync.Mutex
+	file   *os.File
+}
+
+// NewRunner opens (creating if needed) the shadow log at path.
+func NewRunner(path string, opts Options) (*Runner, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create shadow log directory: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open shadow log: %w", err)
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = defaultTimeout
+	}
+	return &Runner{opts: opts, sample: rand.Float64, file: f}, nil
+}
+
+// Model returns the shadow model, or "" if models are not shadowed.
+func (r *Runner) Model() string {
+	return r.opts.Model
+}
+
+// Tools returns the live-to-shadow tool mapping.
+func (r *Runner) Tools() map[string]string {
+	return r.opts.Tools
+}
+
+// Sample reports whether the next call should be shadowed.
+func (r *Runner) Sample() bool {
+	return r.opts.SampleRate > 0 && r.sample() < r.opts.SampleRate
+}
+
+// Compare runs shadow in the background and logs its result against the
+// live result already in rec. The shadow gets its own deadline and is not
+// cancelled when ctx is, so it does not hold up or depend on the turn.
+func (r *Runner) Compare(ctx context.Context, rec Record, shadow func(ctx context.Context) (string, error)) {
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), r.opts.Timeout)
+		defer cancel()
+
+		start := time.Now()
+		result, err := shadow(ctx)
+		rec.ShadowMs = time.Since(start).Milliseconds()
+		if err != nil {
+			rec.ShadowError = err.Error()
+		}
+		rec.Match = (rec.PrimaryError == "") == (rec.ShadowError == "") && normalize(rec.PrimaryResult) == normalize(result)
+		rec.Similarity = Similarity(rec.PrimaryResult, result)
+		rec.ShadowResult = truncate(result)
+		rec.PrimaryResult = truncate(rec.PrimaryResult)
+		if rec.Time.IsZero() {
+			rec.Time = time.Now().UTC()
+		}
+
+		if err := r.append(rec); err != nil {
+			logger.WarnCF("shadow", "Failed to write shadow record",
+				map[string]interface{}{
+					"primary": rec.Primary,
+					"error":   err.Error(),
+				})
+			return
+		}
+		logger.DebugCF("shadow", "Shadow call compared",
+			map[string]interface{}{
+				"kind":       rec.Kind,
+				"primary":    rec.Primary,
+				"shadow":     rec.Shadow,
+				"match":      rec.Match,
+				"similarity": rec.Similarity,
+			})
+	}()
+}
+
+func (r *Runner) append(rec Record) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil {
+		return fmt.Errorf("shadow log is closed")
+	}
+	_, err = r.file.Write(append(data, '\n'))
+	return err
+}
+
+// Close waits for running shadow calls and closes the log.
+func (r *Runner) Close() error {
+	r.wg.Wait()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil {
+		return nil
+	}
+	err := r.file.Close()
+	r.file = nil
+	return err
+}
+
+// Similarity is the Jaccard overlap of the words in a and b: 1 when they
+// use the same words, 0 when they share none. Two empty texts are similar.
+func Similarity(a, b string) float64 {
+	wa, wb := words(a), words(b)
+	if len(wa) == 0 && len(wb) == 0 {
+		return 1
+	}
+	shared := 0
+	for w := range wa {
+		if _, ok := wb[w]; ok {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(wa)+len(wb)-shared)
+}
+
+// words splits text into a set of lower-case words, treating each Han
+// character as a word so Chinese text compares sensibly.
+func words(text string) map[string]struct{} {
+	set := make(map[string]struct{})
+	var current strings.Builder
+	flush := func() {
+		if current.Len() > 0 {
+			set[current.String()] = struct{}{}
+			current.Reset()
+		}
+	}
+	for _, r := range strings.ToLower(text) {
+		if len(set) >= maxWords {
+			break
+		}
+		switch {
+		case r >= 0x4e00 && r <= 0x9fff:
+			flush()
+			set[string(r)] = struct{}{}
+		case r == '_' || r == '-' || r == '.' || (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r > 0x7f:
+			current.WriteRune(r)
+		default:
+			flush()
+		}
+	}
+	flush()
+	return set
+}
+
+func normalize(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+func truncate(s string) string {
+	if len(s) <= maxResultChars {
+		return s
+	}
+	return fmt.Sprintf("%s... (%d chars)", s[:maxResultChars], len(s))
+}
+
+// Summary aggregates the comparisons for one live/shadow pair.
+type Summary struct {
+	Kind           string  `json:"kind"`
+	Primary        string  `json:"primary"`
+	Shadow         string  `json:"shadow"`
+	Samples        int     `json:"samples"`
+	Matches        int     `json:"matches"`
+	MeanSimilarity float64 `json:"mean_similarity"`
+	PrimaryErrors  int     `json:"primary_errors"`
+	ShadowErrors   int     `json:"shadow_errors"`
+	MeanPrimaryMs  int64   `json:"mean_primary_ms"`
+	MeanShadowMs   int64   `json:"mean_shadow_ms"`
+}
+
+// Summarize reads the shadow log at path and aggregates it per pair,
+// sorted by kind and live name. A missing log yields no summaries.
+func Summarize(path string) ([]Summary, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	type totals struct {
+		Summary
+		similarity          float64
+		primaryMs, shadowMs int64
+	}
+	byPair := make(map[string]*totals)
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+		var rec Record
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		key := rec.Kind + "\x00" + rec.Primary + "\x00" + rec.Shadow
+		t, ok := byPair[key]
+		if !ok {
+			t = &totals{Summary: Summary{Kind: rec.Kind, Primary: rec.Primary, Shadow: rec.Shadow}}
+			byPair[key] = t
+		}
+		t.Samples++
+		if rec.Match {
+			t.Matches++
+		}
+		if rec.PrimaryError != "" {
+			t.PrimaryErrors++
+		}
+		if rec.ShadowError != "" {
+			t.ShadowErrors++
+		}
+		t.similarity += rec.Similarity
+		t.primaryMs += rec.PrimaryMs
+		t.shadowMs += rec.ShadowMs
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	out := make([]Summary, 0, len(byPair))
+	for _, t := range byPair {
+		s := t.Summary
+		s.MeanSimilarity = t.similarity / float64(s.Samples)
+		s.MeanPrimaryMs = t.primaryMs / int64(s.Samples)
+		s.MeanShadowMs = t.shadowMs / int64(s.Samples)
+		out = append(out, s)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Kind != out[j].Kind {
+			return out[i].Kind < out[j].Kind
+		}
+		return out[i].Primary < out[j].Primary
+	})
+	return out, nil
+}
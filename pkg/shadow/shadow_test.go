@@ -0,0 +1,87 @@
+package shadow
+
+import (
+	"context"
+	"errors"
+	"math"
+	"path/filepath"
+	"testing"
+)
+
+func TestRunner_CompareAndSummarize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "shadow.jsonl")
+	r, err := NewRunner(path, Options{SampleRate: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel() // shadows must not depend on the turn's context
+	r.Compare(ctx, Record{Kind: KindTool, Primary: "knows_ai_search", Shadow: "knows_ai_search_v2", PrimaryResult: "CA19-9  35 U/mL", PrimaryMs: 100},
+		func(ctx context.Context) (string, error) {
+			if ctx.Err() != nil {
+				return "", ctx.Err()
+			}
+			return "CA19-9 35 U/mL", nil
+		})
+	r.Compare(ctx, Record{Kind: KindTool, Primary: "knows_ai_search", Shadow: "knows_ai_search_v2", PrimaryResult: "CEA 5 ng/mL", PrimaryMs: 300},
+		func(ctx context.Context) (string, error) {
+			return "", errors.New("timeout")
+		})
+	r.Compare(ctx, Record{Kind: KindModel, Primary: "glm-4.7", Shadow: "deepseek-chat", PrimaryResult: "hello"},
+		func(ctx context.Context) (string, error) {
+			return "hello there", nil
+		})
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	summaries, err := Summarize(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(summaries) != 2 {
+		t.Fatalf("got %d summaries, want 2: %+v", len(summaries), summaries)
+	}
+	model, tool := summaries[0], summaries[1]
+	if model.Kind != KindModel || model.Samples != 1 || model.Matches != 0 || model.MeanSimilarity != 0.5 {
+		t.Errorf("unexpected model summary %+v", model)
+	}
+	if tool.Samples != 2 || tool.Matches != 1 || tool.ShadowErrors != 1 || tool.MeanPrimaryMs != 200 {
+		t.Errorf("unexpected tool summary %+v", tool)
+	}
+}
+
+func TestRunner_Sample(t *testing.T) {
+	r := &Runner{opts: Options{SampleRate: 0.25}, sample: func() float64 { return 0.3 }}
+	if r.Sample() {
+		t.Error("0.3 should not be sampled at rate 0.25")
+	}
+	r.sample = func() float64 { return 0.2 }
+	if !r.Sample() {
+		t.Error("0.2 should be sampled at rate 0.25")
+	}
+	r.opts.SampleRate = 0
+	r.sample = func() float64 { return 0 }
+	if r.Sample() {
+		t.Error("rate 0 should never sample")
+	}
+}
+
+func TestSimilarity(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want float64
+	}{
+		{"", "", 1},
+		{"Gemcitabine plus nab-paclitaxel", "gemcitabine PLUS nab-paclitaxel", 1},
+		{"FOLFIRINOX first line", "gemcitabine second line", 0.2},
+		{"胰腺癌", "胰腺炎", 0.5},
+		{"abc", "", 0},
+	}
+	for _, tt := range tests {
+		if got := Similarity(tt.a, tt.b); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("Similarity(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
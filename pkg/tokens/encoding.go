@@ -0,0 +1,187 @@
+package tokens
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/pkoukk/tiktoken-go"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// encodingURL is where OpenAI publishes its tiktoken encodings.
+const encodingURL = "https://openaipublic.blob.core.windows.net/encodings/"
+
+// maxEncodingSize bounds a downloaded encoding; o200k_base is 3.6 MB.
+const maxEncodingSize = 16 << 20
+
+// CacheDir holds downloaded encodings.
+var CacheDir = defaultCacheDir()
+
+func defaultCacheDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(os.TempDir(), "picoclaw-tiktoken")
+	}
+	return filepath.Join(home, ".picoclaw", "cache", "tiktoken")
+}
+
+func init() {
+	// Encodings are only ever read from the cache; Download fetches them
+	tiktoken.SetBpeLoader(cacheLoader{})
+}
+
+// encoding is a tiktoken encoding, loaded from the cache on first use.
+type encoding struct {
+	tried sync.Once
+	enc   atomic.Pointer[tiktoken.Tiktoken]
+}
+
+var encodings sync.Map // encoding name -> *encoding
+
+// loadedEncoding returns the named encoding if it is in the cache, and
+// nil otherwise or when name is empty.
+func loadedEncoding(name string) *tiktoken.Tiktoken {
+	if name == "" {
+		return nil
+	}
+	v, _ := encodings.LoadOrStore(name, &encoding{})
+	e := v.(*encoding)
+	e.tried.Do(func() {
+		if _, err := os.Stat(cachePath(name)); err != nil {
+			return
+		}
+		e.load(name)
+	})
+	return e.enc.Load()
+}
+
+func (e *encoding) load(name string) error {
+	enc, err := tiktoken.GetEncoding(name)
+	if err != nil {
+		logger.WarnCF("tokens", "Failed to load tokenizer encoding", map[string]interface{}{
+			"encoding": name,
+			"error":    err.Error(),
+		})
+		return err
+	}
+	e.enc.Store(enc)
+	return nil
+}
+
+func cachePath(name string) string {
+	return filepath.Join(CacheDir, name+".tiktoken")
+}
+
+// Download fetches the tiktoken encodings that models need and are not yet
+// cached, so their tokens are counted exactly from then on. Until an
+// encoding is available, and when it cannot be downloaded, those models
+// are counted approximately.
+func Download(ctx context.Context, models ...string) {
+	seen := map[string]bool{}
+	for _, model := range models {
+		name := ForModel(model).family.encoding
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		if loadedEncoding(name) != nil {
+			continue
+		}
+		if err := fetch(ctx, name); err != nil {
+			logger.WarnCF("tokens", "Failed to download tokenizer encoding; counting tokens approximately", map[string]interface{}{
+				"encoding": name,
+				"error":    err.Error(),
+			})
+			continue
+		}
+		v, _ := encodings.Load(name)
+		if v.(*encoding).load(name) == nil {
+			logger.InfoCF("tokens", "Downloaded tokenizer encoding", map[string]interface{}{"encoding": name})
+		}
+	}
+}
+
+func fetch(ctx context.Context, name string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, encodingURL+name+".tiktoken", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxEncodingSize))
+	if err != nil {
+		return err
+	}
+	if _, err := parseEncoding(data); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(CacheDir, 0755); err != nil {
+		return err
+	}
+	tmp := cachePath(name) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, cachePath(name))
+}
+
+// cacheLoader reads encodings from CacheDir for tiktoken.
+type cacheLoader struct{}
+
+func (cacheLoader) LoadTiktokenBpe(url string) (map[string]int, error) {
+	data, err := os.ReadFile(filepath.Join(CacheDir, filepath.Base(url)))
+	if err != nil {
+		return nil, err
+	}
+	return parseEncoding(data)
+}
+
+// parseEncoding reads the tiktoken format: one base64 token and its rank
+// per line.
+func parseEncoding(data []byte) (map[string]int, error) {
+	ranks := make(map[string]int, 200000)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		token, rank, ok := bytes.Cut(line, []byte(" "))
+		if !ok {
+			return nil, fmt.Errorf("malformed encoding line %q", line)
+		}
+		decoded, err := base64.StdEncoding.DecodeString(string(token))
+		if err != nil {
+			return nil, fmt.Errorf("malformed encoding token: %w", err)
+		}
+		n, err := strconv.Atoi(string(rank))
+		if err != nil {
+			return nil, fmt.Errorf("malformed encoding rank: %w", err)
+		}
+		ranks[string(decoded)] = n
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(ranks) == 0 {
+		return nil, fmt.Errorf("empty encoding")
+	}
+	return ranks, nil
+}
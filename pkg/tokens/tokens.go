@@ -0,0 +1,154 @@
+// Package tokens counts the tokens of prompts and replies the way the
+// model's own tokenizer would, for context compaction and cost tracking.
+//
+// OpenAI models are counted exactly with their tiktoken encoding once it
+// has been downloaded (see Download). Other models, and OpenAI models
+// until then, are counted from the average tokens per character of their
+// tokenizer family, with CJK text counted apart from other text: one
+// Chinese character is about 0.6 tokens for Qwen or DeepSeek but more than
+// one for Claude, and 4 letters of English make about one token for all.
+package tokens
+
+import (
+	"encoding/json"
+	"math"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+const (
+	// messageOverhead is what the chat format adds to each message: the
+	// role and the delimiters around it.
+	messageOverhead = 4
+	// imageTokens is about what a vision model charges for an image scaled
+	// to the 1568 pixels images are sent at.
+	imageTokens = 1200
+)
+
+// family is the tokenizer of models whose names start with one of prefixes.
+type family struct {
+	prefixes []string
+	encoding string  // tiktoken encoding, if the family has one
+	cjk      float64 // tokens per CJK character
+	other    float64 // tokens per other character
+}
+
+var families = []family{
+	{[]string{"gpt-4o", "chatgpt-4o", "gpt-4.1", "gpt-4.5", "gpt-5", "gpt-oss", "o1", "o3", "o4"}, "o200k_base", 0.8, 0.25},
+	{[]string{"gpt-4", "gpt-3.5", "text-embedding"}, "cl100k_base", 1.1, 0.25},
+	{[]string{"claude"}, "", 1.2, 0.3},
+	{[]string{"qwen", "qwq", "qvq", "deepseek", "glm", "chatglm", "kimi", "moonshot", "yi-", "baichuan",
+		"minimax", "abab", "ernie", "hunyuan", "doubao", "step-"}, "", 0.65, 0.3},
+	{[]string{"gemini", "gemma"}, "", 0.8, 0.25},
+}
+
+// defaultFamily covers Llama and models not listed above.
+var defaultFamily = family{cjk: 1.0, other: 0.3}
+
+// Counter counts tokens for one model.
+type Counter struct {
+	family family
+}
+
+// ForModel returns the counter for model, which may carry a provider
+// prefix such as "openrouter/openai/gpt-4o".
+func ForModel(model string) *Counter {
+	name := strings.ToLower(model)
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name = name[i+1:]
+	}
+	for _, f := range families {
+		for _, prefix := range f.prefixes {
+			if strings.HasPrefix(name, prefix) {
+				return &Counter{family: f}
+			}
+		}
+	}
+	return &Counter{family: defaultFamily}
+}
+
+// Count returns the number of tokens in text.
+func (c *Counter) Count(text string) int {
+	if text == "" {
+		return 0
+	}
+	if enc := loadedEncoding(c.family.encoding); enc != nil {
+		return len(enc.EncodeOrdinary(text))
+	}
+	cjk, other := 0, 0
+	for _, r := range text {
+		if isCJK(r) {
+			cjk++
+		} else {
+			other++
+		}
+	}
+	n := float64(cjk)*c.family.cjk + float64(other)*c.family.other
+	// Less a rounding error, so 100 characters at 0.3 are 30 tokens, not 31
+	return int(math.Ceil(n - 1e-9))
+}
+
+// Exact reports whether the counter counts with the model's own tokenizer
+// rather than an approximation.
+func (c *Counter) Exact() bool {
+	return loadedEncoding(c.family.encoding) != nil
+}
+
+// Truncate cuts text to at most maxTokens tokens, ending it with "..."
+// when it is cut.
+func (c *Counter) Truncate(text string, maxTokens int) string {
+	if c.Count(text) <= maxTokens {
+		return text
+	}
+	runes := []rune(text)
+	budget := maxTokens - c.Count("...")
+	lo, hi := 0, len(runes)
+	for lo < hi {
+		mid := (lo + hi + 1) / 2
+		if c.Count(string(runes[:mid])) <= budget {
+			lo = mid
+		} else {
+			hi = mid - 1
+		}
+	}
+	return string(runes[:lo]) + "..."
+}
+
+// Messages returns the number of tokens messages take in a prompt,
+// including their tool calls and images.
+func (c *Counter) Messages(messages []providers.Message) int {
+	total := 0
+	for _, m := range messages {
+		total += messageOverhead + c.Count(m.Content) + len(m.Images)*imageTokens
+		for _, tc := range m.ToolCalls {
+			total += c.Count(tc.Name)
+			if tc.Function != nil {
+				total += c.Count(tc.Function.Name) + c.Count(tc.Function.Arguments)
+			} else if len(tc.Arguments) > 0 {
+				args, _ := json.Marshal(tc.Arguments)
+				total += c.Count(string(args))
+			}
+		}
+	}
+	return total
+}
+
+// isCJK reports whether r is Chinese, Japanese or Korean script or
+// full-width punctuation, which tokenizers split far more finely than
+// Latin text.
+func isCJK(r rune) bool {
+	switch {
+	case r >= 0x2E80 && r <= 0x9FFF: // radicals, punctuation, kana, CJK ideographs
+		return true
+	case r >= 0xAC00 && r <= 0xD7AF: // Hangul
+		return true
+	case r >= 0xF900 && r <= 0xFAFF: // compatibility ideographs
+		return true
+	case r >= 0xFF00 && r <= 0xFFEF: // full-width forms
+		return true
+	case r >= 0x20000 && r <= 0x3FFFF: // rare ideographs
+		return true
+	}
+	return false
+}
@@ -0,0 +1,137 @@
+package tokens
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+func TestMain(m *testing.M) {
+	// Counts must not depend on encodings cached on the machine
+	dir, err := os.MkdirTemp("", "tiktoken")
+	if err != nil {
+		panic(err)
+	}
+	CacheDir = dir
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+func TestForModel(t *testing.T) {
+	tests := []struct {
+		model    string
+		encoding string
+		cjk      float64
+	}{
+		{"gpt-4o-mini", "o200k_base", 0.8},
+		{"openrouter/openai/gpt-4o", "o200k_base", 0.8},
+		{"o3-mini", "o200k_base", 0.8},
+		{"gpt-4-turbo", "cl100k_base", 1.1},
+		{"claude-sonnet-4-5", "", 1.2},
+		{"Qwen-Plus", "", 0.65},
+		{"deepseek/deepseek-chat", "", 0.65},
+		{"glm-4-flash", "", 0.65},
+		{"gemini-2.5-pro", "", 0.8},
+		{"llama-3.1-8b", "", 1.0},
+		{"", "", 1.0},
+	}
+	for _, tt := range tests {
+		f := ForModel(tt.model).family
+		if f.encoding != tt.encoding || f.cjk != tt.cjk {
+			t.Errorf("ForModel(%q) = %q at %.2f per CJK character, want %q at %.2f", tt.model, f.encoding, f.cjk, tt.encoding, tt.cjk)
+		}
+	}
+}
+
+func TestCountApproximate(t *testing.T) {
+	chinese := strings.Repeat("胰腺癌术后化疗", 10) // 70 characters
+	english := strings.Repeat("abcd", 25)    // 100 characters
+	tests := []struct {
+		model string
+		text  string
+		want  int
+	}{
+		{"qwen-max", chinese, 46},
+		{"claude-sonnet-4-5", chinese, 84},
+		{"llama3", chinese, 70},
+		{"qwen-max", english, 30},
+		{"gpt-4o", english, 25},
+		{"qwen-max", "CA19-9：37", 4},
+		{"qwen-max", "", 0},
+	}
+	for _, tt := range tests {
+		if got := ForModel(tt.model).Count(tt.text); got != tt.want {
+			t.Errorf("%s: Count(%q) = %d, want %d", tt.model, tt.text, got, tt.want)
+		}
+	}
+	if ForModel("gpt-4o").Exact() {
+		t.Error("gpt-4o counted exactly without a cached encoding")
+	}
+}
+
+func TestMessages(t *testing.T) {
+	c := ForModel("qwen-max")
+	messages := []providers.Message{
+		{Role: "user", Content: "化验单", Images: []providers.ImageContent{{MimeType: "image/png"}}},
+		{Role: "assistant", ToolCalls: []providers.ToolCall{{
+			Function: &providers.FunctionCall{Name: "knows_search", Arguments: `{"q":"x"}`},
+		}}},
+		{Role: "tool", Content: "abcd"},
+	}
+	// 4+2+1200, 4+4+3, 4+2
+	if got, want := c.Messages(messages), 1223; got != want {
+		t.Errorf("Messages = %d, want %d", got, want)
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	c := ForModel("qwen-max")
+	text := strings.Repeat("胰腺癌", 100)
+	got := c.Truncate(text, 50)
+	if !strings.HasSuffix(got, "...") || c.Count(got) > 50 || c.Count(got) < 48 {
+		t.Errorf("Truncate to 50 tokens = %d tokens: %q", c.Count(got), got)
+	}
+	if got := c.Truncate("short", 50); got != "short" {
+		t.Errorf("Truncate(short) = %q", got)
+	}
+}
+
+func TestCountExact(t *testing.T) {
+	// A toy cl100k_base: every byte is a token, and so is "hello".
+	var enc strings.Builder
+	for b := 0; b < 256; b++ {
+		fmt.Fprintf(&enc, "%s %d\n", base64.StdEncoding.EncodeToString([]byte{byte(b)}), b)
+	}
+	for i, token := range []string{"he", "ll", "hell", "hello"} {
+		fmt.Fprintf(&enc, "%s %d\n", base64.StdEncoding.EncodeToString([]byte(token)), 256+i)
+	}
+	if _, err := parseEncoding([]byte(enc.String())); err != nil {
+		t.Fatalf("parseEncoding: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(CacheDir, "cl100k_base.tiktoken"), []byte(enc.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c := ForModel("gpt-4-turbo")
+	if !c.Exact() {
+		t.Fatal("cached encoding not loaded")
+	}
+	// "hello" and " " and "x"
+	if got := c.Count("hello x"); got != 3 {
+		t.Errorf("Count = %d, want 3", got)
+	}
+}
+
+func TestParseEncodingRejectsGarbage(t *testing.T) {
+	for _, data := range []string{"", "<html>not found</html>", "aGVsbG8= one\n"} {
+		if _, err := parseEncoding([]byte(data)); err == nil {
+			t.Errorf("parseEncoding(%q) succeeded", data)
+		}
+	}
+}
@@ -0,0 +1,428 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	adverseEventSeverities = []string{"mild", "moderate", "severe", "life_threatening", "fatal"}
+	adverseEventActions    = []string{"none", "dose_reduced", "drug_interrupted", "drug_withdrawn", "treatment_given", "unknown"}
+	adverseEventOutcomes   = []string{"recovered", "recovering", "not_recovered", "recovered_with_sequelae", "fatal", "unknown"}
+	adverseEventFormats    = []string{"json", "csv", "cioms"}
+)
+
+// adverseEventQuestions are asked, in order, for required fields that are
+// still missing from a draft.
+var adverseEventQuestions = []struct {
+	field    string
+	question string
+}{
+	{"drug", "Which medicine do you think caused it? Include the dose if you know it."},
+	{"reaction", "What happened? Describe the symptoms in your own words."},
+	{"onset_date", "When did it start? A date is best, e.g. 2026-03-14."},
+	{"severity", "How bad was it: mild, moderate, severe, life-threatening, or fatal?"},
+	{"action_taken", "What was done about the medicine: nothing, dose reduced, paused, stopped, or another treatment given?"},
+}
+
+// AdverseEvent is a structured suspected adverse drug reaction report.
+type AdverseEvent struct {
+	ID          string    `json:"id,omitempty"`
+	Drug        string    `json:"drug"`
+	Dose        string    `json:"dose,omitempty"`
+	Indication  string    `json:"indication,omitempty"`
+	Reaction    string    `json:"reaction"`
+	OnsetDate   string    `json:"onset_date"`
+	Severity    string    `json:"severity"`
+	ActionTaken string    `json:"action_taken"`
+	Outcome     string    `json:"outcome,omitempty"`
+	Notes       string    `json:"notes,omitempty"`
+	Channel     string    `json:"channel,omitempty"`
+	ChatID      string    `json:"chat_id,omitempty"`
+	ReportedAt  time.Time `json:"reported_at,omitempty"`
+}
+
+func (e *AdverseEvent) missing() []string {
+	values := map[string]string{
+		"drug":         e.Drug,
+		"reaction":     e.Reaction,
+		"onset_date":   e.OnsetDate,
+		"severity":     e.Severity,
+		"action_taken": e.ActionTaken,
+	}
+	var missing []string
+	for _, q := range adverseEventQuestions {
+		if values[q.field] == "" {
+			missing = append(missing, q.field)
+		}
+	}
+	return missing
+}
+
+// AdverseEventTool guides the model through collecting an adverse event
+// report one field at a time, then stores and exports it. Drafts are kept
+// per chat until submitted.
+type AdverseEventTool struct {
+	dir     string
+	drafts  map[string]*AdverseEvent
+	channel string
+	chatID  string
+	mu      sync.Mutex
+}
+
+// NewAdverseEventTool stores submitted reports under
+// <workspace>/adverse_events.
+func NewAdverseEventTool(workspace string) *AdverseEventTool {
+	return &AdverseEventTool{
+		dir:    filepath.Join(workspace, "adverse_events"),
+		drafts: make(map[string]*AdverseEvent),
+	}
+}
+
+func (t *AdverseEventTool) Name() string {
+	return "adverse_event_report"
+}
+
+func (t *AdverseEventTool) Description() string {
+	return "Record a suspected side effect (adverse event) of a medicine as a structured report. " +
+		"Use action 'record' with whatever fields the user has mentioned; the result lists missing fields and the next question to ask. " +
+		"Ask one question at a time, confirm the summary with the user, then use 'submit'. " +
+		"Use 'export' to produce a copy for the treating hospital or a pharmacovigilance partner."
+}
+
+func (t *AdverseEventTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"action": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"record", "show", "submit", "discard", "list", "export"},
+				"description": "record: add fields to this chat's draft; show: view the draft; submit: store the completed draft; discard: drop the draft; list: submitted reports for this chat; export: render a submitted report",
+			},
+			"drug": map[string]interface{}{
+				"type":        "string",
+				"description": "Suspected medicine (brand or generic name)",
+			},
+			"dose": map[string]interface{}{
+				"type":        "string",
+				"description": "Dose and schedule, e.g. '1000 mg/m2 weekly'",
+			},
+			"indication": map[string]interface{}{
+				"type":        "string",
+				"description": "What the medicine is taken for",
+			},
+			"reaction": map[string]interface{}{
+				"type":        "string",
+				"description": "What happened, in the patient's words",
+			},
+			"onset_date": map[string]interface{}{
+				"type":        "string",
+				"description": "When the reaction started, as YYYY-MM-DD",
+			},
+			"severity": map[string]interface{}{
+				"type": "string",
+				"enum": adverseEventSeverities,
+			},
+			"action_taken": map[string]interface{}{
+				"type":        "string",
+				"enum":        adverseEventActions,
+				"description": "What was done with the suspected medicine",
+			},
+			"outcome": map[string]interface{}{
+				"type": "string",
+				"enum": adverseEventOutcomes,
+			},
+			"notes": map[string]interface{}{
+				"type":        "string",
+				"description": "Anything else relevant, such as other medicines or tests",
+			},
+			"report_id": map[string]interface{}{
+				"type":        "string",
+				"description": "Submitted report ID (for export)",
+			},
+			"format": map[string]interface{}{
+				"type":        "string",
+				"enum":        adverseEventFormats,
+				"description": "Export format: json (structured), csv (one row), cioms (readable form modelled on CIOMS I). Default: cioms",
+			},
+		},
+		"required": []string{"action"},
+	}
+}
+
+func (t *AdverseEventTool) SetContext(channel, chatID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.channel = channel
+	t.chatID = chatID
+}
+
+func (t *AdverseEventTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	action, _ := args["action"].(string)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.channel == "" || t.chatID == "" {
+		return ErrorResult("no chat context; adverse event reports must be made from a conversation")
+	}
+	key := t.channel + ":" + t.chatID
+
+	switch action {
+	case "record":
+		return t.record(key, args)
+	case "show":
+		draft, ok := t.drafts[key]
+		if !ok {
+			return ErrorResult("no adverse event draft in this chat; use action 'record' to start one")
+		}
+		return draftResult(draft)
+	case "submit":
+		return t.submit(key)
+	case "discard":
+		if _, ok := t.drafts[key]; !ok {
+			return ErrorResult("no adverse event draft in this chat")
+		}
+		delete(t.drafts, key)
+		return SilentResult("Adverse event draft discarded")
+	case "list":
+		return t.list()
+	case "export":
+		return t.export(args)
+	default:
+		return ErrorResult(fmt.Sprintf("unknown action: %s", action))
+	}
+}
+
+func (t *AdverseEventTool) record(key string, args map[string]interface{}) *ToolResult {
+	draft, ok := t.drafts[key]
+	if !ok {
+		draft = &AdverseEvent{Channel: t.channel, ChatID: t.chatID}
+	}
+	updated := *draft
+
+	fields := []struct {
+		name   string
+		target *string
+		enum   []string
+	}{
+		{"drug", &updated.Drug, nil},
+		{"dose", &updated.Dose, nil},
+		{"indication", &updated.Indication, nil},
+		{"reaction", &updated.Reaction, nil},
+		{"onset_date", &updated.OnsetDate, nil},
+		{"severity", &updated.Severity, adverseEventSeverities},
+		{"action_taken", &updated.ActionTaken, adverseEventActions},
+		{"outcome", &updated.Outcome, adverseEventOutcomes},
+		{"notes", &updated.Notes, nil},
+	}
+	for _, f := range fields {
+		value, _ := args[f.name].(string)
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		if f.enum != nil {
+			value = strings.ReplaceAll(strings.ToLower(value), "-", "_")
+			if !containsString(f.enum, value) {
+				return ErrorResult(fmt.Sprintf("%s must be one of %s, got %q", f.name, strings.Join(f.enum, ", "), value))
+			}
+		}
+		if f.name == "onset_date" {
+			if _, err := time.Parse("2006-01-02", value); err != nil {
+				return ErrorResult(fmt.Sprintf("onset_date must be YYYY-MM-DD, got %q; ask the user for the date", value))
+			}
+		}
+		*f.target = value
+	}
+
+	t.drafts[key] = &updated
+	return draftResult(&updated)
+}
+
+func draftResult(draft *AdverseEvent) *ToolResult {
+	missing := draft.missing()
+	view := map[string]interface{}{
+		"draft":   draft,
+		"missing": missing,
+	}
+	if len(missing) > 0 {
+		for _, q := range adverseEventQuestions {
+			if q.field == missing[0] {
+				view["next_question"] = q.question
+				break
+			}
+		}
+	} else {
+		view["next_step"] = "All required fields are filled. Read the summary back to the user and submit once they confirm."
+	}
+	payload, _ := json.MarshalIndent(view, "", "  ")
+	return SilentResult(string(payload))
+}
+
+func (t *AdverseEventTool) submit(key string) *ToolResult {
+	draft, ok := t.drafts[key]
+	if !ok {
+		return ErrorResult("no adverse event draft in this chat; use action 'record' to start one")
+	}
+	if missing := draft.missing(); len(missing) > 0 {
+		return ErrorResult(fmt.Sprintf("cannot submit yet; missing: %s", strings.Join(missing, ", ")))
+	}
+
+	report := *draft
+	report.ReportedAt = time.Now().UTC()
+	report.ID = fmt.Sprintf("AE-%s-%s", report.ReportedAt.Format("20060102"), randomHex(3))
+
+	if err := os.MkdirAll(t.dir, 0700); err != nil {
+		return ErrorResult(fmt.Sprintf("failed to store report: %v", err)).WithError(err)
+	}
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("failed to serialize report: %v", err)).WithError(err)
+	}
+	if err := os.WriteFile(filepath.Join(t.dir, report.ID+".json"), data, 0600); err != nil {
+		return ErrorResult(fmt.Sprintf("failed to store report: %v", err)).WithError(err)
+	}
+
+	delete(t.drafts, key)
+	return SilentResult(fmt.Sprintf("Adverse event report %s stored. Remind the user to also tell their care team, and to seek urgent care for severe symptoms.", report.ID))
+}
+
+// load returns the submitted reports for the current chat, oldest first.
+func (t *AdverseEventTool) load() ([]AdverseEvent, error) {
+	return loadAdverseEvents(t.dir, t.channel, t.chatID)
+}
+
+// loadAdverseEvents reads the reports in dir submitted from channel/chatID,
+// oldest first.
+func loadAdverseEvents(dir, channel, chatID string) ([]AdverseEvent, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var reports []AdverseEvent
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			continue
+		}
+		var report AdverseEvent
+		if err := json.Unmarshal(data, &report); err != nil {
+			continue
+		}
+		if report.Channel == channel && report.ChatID == chatID {
+			reports = append(reports, report)
+		}
+	}
+	sort.Slice(reports, func(i, j int) bool { return reports[i].ReportedAt.Before(reports[j].ReportedAt) })
+	return reports, nil
+}
+
+func (t *AdverseEventTool) list() *ToolResult {
+	reports, err := t.load()
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("failed to read reports: %v", err)).WithError(err)
+	}
+	if len(reports) == 0 {
+		return SilentResult("No adverse event reports in this chat")
+	}
+	var sb strings.Builder
+	sb.WriteString("Adverse event reports:\n")
+	for _, r := range reports {
+		fmt.Fprintf(&sb, "- %s: %s, %s (%s, onset %s)\n", r.ID, r.Drug, r.Reaction, r.Severity, r.OnsetDate)
+	}
+	return SilentResult(sb.String())
+}
+
+func (t *AdverseEventTool) export(args map[string]interface{}) *ToolResult {
+	id, _ := args["report_id"].(string)
+	if id == "" {
+		return ErrorResult("report_id is required for export")
+	}
+	format, _ := args["format"].(string)
+	if format == "" {
+		format = "cioms"
+	}
+
+	reports, err := t.load()
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("failed to read reports: %v", err)).WithError(err)
+	}
+	for _, r := range reports {
+		if r.ID != id {
+			continue
+		}
+		content, err := FormatAdverseEvent(r, format)
+		if err != nil {
+			return ErrorResult(err.Error())
+		}
+		return &ToolResult{ForLLM: content, ForUser: content}
+	}
+	return ErrorResult(fmt.Sprintf("report %s not found in this chat", id))
+}
+
+// FormatAdverseEvent renders a report as json, csv, or cioms, a plain-text
+// layout following the sections of the CIOMS I form.
+func FormatAdverseEvent(r AdverseEvent, format string) (string, error) {
+	switch format {
+	case "json":
+		data, err := json.MarshalIndent(r, "", "  ")
+		return string(data), err
+	case "csv":
+		var buf bytes.Buffer
+		w := csv.NewWriter(&buf)
+		w.Write([]string{"id", "reported_at", "drug", "dose", "indication", "reaction", "onset_date", "severity", "action_taken", "outcome", "notes"})
+		w.Write([]string{r.ID, r.ReportedAt.Format(time.RFC3339), r.Drug, r.Dose, r.Indication, r.Reaction, r.OnsetDate, r.Severity, r.ActionTaken, r.Outcome, r.Notes})
+		w.Flush()
+		return buf.String(), w.Error()
+	case "cioms":
+		orUnknown := func(s string) string {
+			if s == "" {
+				return "unknown"
+			}
+			return s
+		}
+		var sb strings.Builder
+		fmt.Fprintf(&sb, "SUSPECT ADVERSE REACTION REPORT (%s)\n", r.ID)
+		fmt.Fprintf(&sb, "Received: %s (patient-reported via chat)\n\n", r.ReportedAt.Format("2006-01-02"))
+		sb.WriteString("I. REACTION INFORMATION\n")
+		fmt.Fprintf(&sb, "  Reaction onset: %s\n", r.OnsetDate)
+		fmt.Fprintf(&sb, "  Description: %s\n", r.Reaction)
+		fmt.Fprintf(&sb, "  Severity: %s\n", strings.ReplaceAll(r.Severity, "_", "-"))
+		fmt.Fprintf(&sb, "  Outcome: %s\n\n", strings.ReplaceAll(orUnknown(r.Outcome), "_", " "))
+		sb.WriteString("II. SUSPECT DRUG INFORMATION\n")
+		fmt.Fprintf(&sb, "  Suspect drug: %s\n", r.Drug)
+		fmt.Fprintf(&sb, "  Daily dose: %s\n", orUnknown(r.Dose))
+		fmt.Fprintf(&sb, "  Indication: %s\n", orUnknown(r.Indication))
+		fmt.Fprintf(&sb, "  Action taken: %s\n\n", strings.ReplaceAll(r.ActionTaken, "_", " "))
+		sb.WriteString("III. RELEVANT HISTORY AND NOTES\n")
+		fmt.Fprintf(&sb, "  %s\n", orUnknown(r.Notes))
+		return sb.String(), nil
+	default:
+		return "", fmt.Errorf("format must be one of %s, got %q", strings.Join(adverseEventFormats, ", "), format)
+	}
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,141 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestAdverseEventTool_GuidedReport(t *testing.T) {
+	workspace := t.TempDir()
+	tool := NewAdverseEventTool(workspace)
+	tool.SetContext("telegram", "patient")
+	ctx := context.Background()
+
+	result := tool.Execute(ctx, map[string]interface{}{
+		"action":   "record",
+		"drug":     "gemcitabine",
+		"reaction": "rash on both arms and fever",
+	})
+	var draft struct {
+		Missing      []string `json:"missing"`
+		NextQuestion string   `json:"next_question"`
+	}
+	if err := json.Unmarshal([]byte(result.ForLLM), &draft); err != nil {
+		t.Fatalf("unexpected record result %q: %v", result.ForLLM, err)
+	}
+	if strings.Join(draft.Missing, ",") != "onset_date,severity,action_taken" || !strings.Contains(draft.NextQuestion, "When did it start") {
+		t.Errorf("unexpected guidance: %+v", draft)
+	}
+
+	if result := tool.Execute(ctx, map[string]interface{}{"action": "submit"}); !result.IsError {
+		t.Fatal("expected submit to fail while fields are missing")
+	}
+
+	result = tool.Execute(ctx, map[string]interface{}{
+		"action":       "record",
+		"onset_date":   "2026-03-14",
+		"severity":     "Moderate",
+		"action_taken": "drug-interrupted",
+	})
+	if !strings.Contains(result.ForLLM, "next_step") {
+		t.Errorf("expected completed draft, got %q", result.ForLLM)
+	}
+
+	result = tool.Execute(ctx, map[string]interface{}{"action": "submit"})
+	if result.IsError {
+		t.Fatalf("submit failed: %s", result.ForLLM)
+	}
+	id := regexp.MustCompile(`AE-\d{8}-[0-9a-f]+`).FindString(result.ForLLM)
+	if id == "" {
+		t.Fatalf("no report id in %q", result.ForLLM)
+	}
+	info, err := os.Stat(filepath.Join(workspace, "adverse_events", id+".json"))
+	if err != nil {
+		t.Fatalf("report not stored: %v", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("report permission %04o, want 0600", perm)
+	}
+
+	if result := tool.Execute(ctx, map[string]interface{}{"action": "show"}); !result.IsError {
+		t.Error("expected draft to be cleared after submit")
+	}
+	if result := tool.Execute(ctx, map[string]interface{}{"action": "list"}); !strings.Contains(result.ForLLM, id) {
+		t.Errorf("list missing %s: %q", id, result.ForLLM)
+	}
+
+	tool.SetContext("telegram", "someone-else")
+	if result := tool.Execute(ctx, map[string]interface{}{"action": "export", "report_id": id}); !result.IsError {
+		t.Error("reports should not be exportable from another chat")
+	}
+}
+
+func TestAdverseEventTool_RecordValidation(t *testing.T) {
+	tests := []struct {
+		name string
+		args map[string]interface{}
+	}{
+		{name: "bad severity", args: map[string]interface{}{"severity": "terrible"}},
+		{name: "bad action", args: map[string]interface{}{"action_taken": "ignored"}},
+		{name: "bad date", args: map[string]interface{}{"onset_date": "last tuesday"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tool := NewAdverseEventTool(t.TempDir())
+			tool.SetContext("telegram", "patient")
+			tt.args["action"] = "record"
+			if result := tool.Execute(context.Background(), tt.args); !result.IsError {
+				t.Errorf("expected validation error, got %q", result.ForLLM)
+			}
+		})
+	}
+
+	tool := NewAdverseEventTool(t.TempDir())
+	if result := tool.Execute(context.Background(), map[string]interface{}{"action": "record"}); !result.IsError {
+		t.Error("expected error without chat context")
+	}
+}
+
+func TestFormatAdverseEvent(t *testing.T) {
+	report := AdverseEvent{
+		ID:          "AE-20260314-abc123",
+		Drug:        "gemcitabine",
+		Reaction:    "rash, fever",
+		OnsetDate:   "2026-03-14",
+		Severity:    "life_threatening",
+		ActionTaken: "drug_withdrawn",
+	}
+
+	tests := []struct {
+		format string
+		want   []string
+	}{
+		{format: "json", want: []string{`"drug": "gemcitabine"`}},
+		{format: "csv", want: []string{"id,reported_at,drug", `"rash, fever"`}},
+		{format: "cioms", want: []string{"SUSPECT ADVERSE REACTION REPORT (AE-20260314-abc123)", "Severity: life-threatening", "Action taken: drug withdrawn", "Daily dose: unknown"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			got, err := FormatAdverseEvent(report, tt.format)
+			if err != nil {
+				t.Fatalf("FormatAdverseEvent() error = %v", err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(got, want) {
+					t.Errorf("output missing %q:\n%s", want, got)
+				}
+			}
+		})
+	}
+
+	if _, err := FormatAdverseEvent(report, "e2b"); err == nil {
+		t.Error("expected error for unsupported format")
+	}
+}
@@ -0,0 +1,270 @@
+package tools
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+const defaultApprovalTimeout = 5 * time.Minute
+
+var (
+	// ErrApprovalTimeout is returned when nobody answers an approval request in time.
+	ErrApprovalTimeout = errors.New("approval request timed out")
+	// ErrApprovalNotFound is returned when resolving an unknown or expired request.
+	ErrApprovalNotFound = errors.New("approval request not found")
+)
+
+// ApprovalRequiredTool is an optional interface for tools that decide per
+// call whether execution needs human confirmation, e.g. a message tool that
+// only needs approval when sending to a chat other than the current one.
+// ctx is the call's ToolContext, so the decision can depend on where the
+// call comes from.
+type ApprovalRequiredTool interface {
+	Tool
+	RequiresApproval(ctx context.Context, args map[string]interface{}) bool
+}
+
+// ApprovalRequest describes one tool call waiting for confirmation.
+type ApprovalRequest struct {
+	ID        string                 `json:"id"`
+	Tool      string                 `json:"tool"`
+	Args      map[string]interface{} `json:"args"`
+	Channel   string                 `json:"channel"`
+	ChatID    string                 `json:"chat_id"`
+	SenderID  string                 `json:"sender_id,omitempty"` // whose message led to the call
+	CreatedAt time.Time              `json:"created_at"`
+}
+
+// ApprovalNotifier delivers a pending request to whoever can approve it.
+// Returning an error denies the request immediately.
+type ApprovalNotifier func(req ApprovalRequest) error
+
+// ApprovalPrompter answers a request synchronously, e.g. by asking on a terminal.
+// When set, it is used instead of the notifier.
+type ApprovalPrompter func(ctx context.Context, req ApprovalRequest) (bool, error)
+
+// ApprovalOperator reports whether senderID may answer any request in the
+// chats it can see, not just its own.
+type ApprovalOperator func(senderID string) bool
+
+type pendingApproval struct {
+	req      ApprovalRequest
+	decision chan bool
+}
+
+// ApprovalManager gates tool execution on human confirmation.
+// Execution blocks in Request until Resolve is called, the timeout
+// elapses, or the context is canceled; anything but an explicit
+// approval denies the call.
+type ApprovalManager struct {
+	mu       sync.Mutex
+	timeout  time.Duration
+	required map[string]struct{}
+	pending  map[string]*pendingApproval
+	notifier ApprovalNotifier
+	prompter ApprovalPrompter
+	operator ApprovalOperator
+}
+
+// NewApprovalManager creates a manager that always requires approval for the
+// named tools. Tools implementing ApprovalRequiredTool are consulted as well.
+func NewApprovalManager(timeout time.Duration, requiredTools []string) *ApprovalManager {
+	if timeout <= 0 {
+		timeout = defaultApprovalTimeout
+	}
+	required := make(map[string]struct{}, len(requiredTools))
+	for _, name := range requiredTools {
+		if name = strings.TrimSpace(name); name != "" {
+			required[name] = struct{}{}
+		}
+	}
+	return &ApprovalManager{
+		timeout:  timeout,
+		required: required,
+		pending:  make(map[string]*pendingApproval),
+	}
+}
+
+// SetNotifier sets how pending requests are announced.
+func (m *ApprovalManager) SetNotifier(notifier ApprovalNotifier) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.notifier = notifier
+}
+
+// SetPrompter sets a synchronous approver that replaces the notifier flow.
+func (m *ApprovalManager) SetPrompter(prompter ApprovalPrompter) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.prompter = prompter
+}
+
+// SetOperator sets who, besides the sender of a request, may answer it.
+func (m *ApprovalManager) SetOperator(operator ApprovalOperator) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.operator = operator
+}
+
+// Requires reports whether calling tool with args, in the call context
+// ctx, needs approval.
+func (m *ApprovalManager) Requires(ctx context.Context, tool Tool, args map[string]interface{}) bool {
+	if _, ok := m.required[tool.Name()]; ok {
+		return true
+	}
+	if gated, ok := tool.(ApprovalRequiredTool); ok {
+		return gated.RequiresApproval(ctx, args)
+	}
+	return false
+}
+
+// Request blocks until the call is approved or denied.
+func (m *ApprovalManager) Request(ctx context.Context, req ApprovalRequest) (bool, error) {
+	req.ID = newApprovalID()
+	req.CreatedAt = time.Now()
+
+	m.mu.Lock()
+	prompter := m.prompter
+	notifier := m.notifier
+	m.mu.Unlock()
+
+	if prompter != nil {
+		return prompter(ctx, req)
+	}
+	if notifier == nil {
+		return false, fmt.Errorf("no approver configured")
+	}
+
+	pending := &pendingApproval{req: req, decision: make(chan bool, 1)}
+	m.mu.Lock()
+	m.pending[req.ID] = pending
+	m.mu.Unlock()
+	defer func() {
+		m.mu.Lock()
+		delete(m.pending, req.ID)
+		m.mu.Unlock()
+	}()
+
+	if err := notifier(req); err != nil {
+		return false, err
+	}
+
+	timer := time.NewTimer(m.timeout)
+	defer timer.Stop()
+
+	select {
+	case approved := <-pending.decision:
+		return approved, nil
+	case <-timer.C:
+		return false, ErrApprovalTimeout
+	case <-ctx.Done():
+		return false, ctx.Err()
+	}
+}
+
+// Resolve answers a pending request. It is the operator-side entry point
+// and does not check where the answer came from.
+func (m *ApprovalManager) Resolve(id string, approved bool) error {
+	m.mu.Lock()
+	pending, ok := m.pending[id]
+	if ok {
+		delete(m.pending, id)
+	}
+	m.mu.Unlock()
+
+	if !ok {
+		return ErrApprovalNotFound
+	}
+	pending.decision <- approved
+	return nil
+}
+
+// Pending returns the requests currently waiting, oldest first.
+func (m *ApprovalManager) Pending() []ApprovalRequest {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	out := make([]ApprovalRequest, 0, len(m.pending))
+	for _, p := range m.pending {
+		out = append(out, p.req)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.Before(out[j].CreatedAt) })
+	return out
+}
+
+// HandleCommand resolves "/approve <id>" and "/deny <id>" sent from a chat.
+// Only the chat that triggered a request may answer it from a channel, and
+// in it only the request's sender or an operator, so another member of a
+// group cannot approve a call made for someone else.
+func (m *ApprovalManager) HandleCommand(channel, chatID, senderID, content string) (string, bool) {
+	parts := strings.Fields(strings.TrimSpace(content))
+	if len(parts) == 0 {
+		return "", false
+	}
+
+	var approved bool
+	switch parts[0] {
+	case "/approve":
+		approved = true
+	case "/deny":
+		approved = false
+	default:
+		return "", false
+	}
+	if len(parts) < 2 {
+		return fmt.Sprintf("Usage: %s <id>", parts[0]), true
+	}
+	id := parts[1]
+
+	m.mu.Lock()
+	pending, ok := m.pending[id]
+	operator := m.operator
+	m.mu.Unlock()
+	if !ok || pending.req.Channel != channel || pending.req.ChatID != chatID {
+		return fmt.Sprintf("No pending approval with id %s", id), true
+	}
+	if !sameSender(pending.req.SenderID, senderID) && (operator == nil || !operator(senderID)) {
+		return fmt.Sprintf("Only the person who asked, or an operator, can answer approval %s", id), true
+	}
+
+	if err := m.Resolve(id, approved); err != nil {
+		return fmt.Sprintf("No pending approval with id %s", id), true
+	}
+	if approved {
+		return fmt.Sprintf("Approved %s (%s)", pending.req.Tool, id), true
+	}
+	return fmt.Sprintf("Denied %s (%s)", pending.req.Tool, id), true
+}
+
+// sameSender compares sender IDs by the part before "|", since channels
+// such as Telegram append a username that can change.
+func sameSender(a, b string) bool {
+	a, _, _ = strings.Cut(a, "|")
+	b, _, _ = strings.Cut(b, "|")
+	return a != "" && a == b
+}
+
+// FormatApprovalPrompt renders the message shown to the approver.
+func FormatApprovalPrompt(req ApprovalRequest) string {
+	argsJSON, _ := json.Marshal(req.Args)
+	return fmt.Sprintf("Approval required: the assistant wants to run %s with %s\n\nReply /approve %s or /deny %s",
+		req.Tool, utils.Truncate(string(argsJSON), 500), req.ID, req.ID)
+}
+
+func newApprovalID() string {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%08x", time.Now().UnixNano()&0xffffffff)
+	}
+	return hex.EncodeToString(b)
+}
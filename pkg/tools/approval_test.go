@@ -0,0 +1,156 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestApprovalManager_Requires(t *testing.T) {
+	m := NewApprovalManager(time.Minute, []string{"exec"})
+
+	ctx := NewToolContext(context.Background(), "telegram", "123")
+	if !m.Requires(ctx, &stubTool{name: "exec"}, nil) {
+		t.Error("expected exec to require approval")
+	}
+	if m.Requires(ctx, &stubTool{name: "read_file"}, nil) {
+		t.Error("expected read_file not to require approval")
+	}
+
+	msg := NewMessageTool()
+	if m.Requires(ctx, msg, map[string]interface{}{"content": "hi"}) {
+		t.Error("expected reply to current chat not to require approval")
+	}
+	if m.Requires(ctx, msg, map[string]interface{}{"content": "hi", "channel": "telegram", "chat_id": "123"}) {
+		t.Error("expected naming the current chat not to require approval")
+	}
+	if !m.Requires(ctx, msg, map[string]interface{}{"content": "hi", "chat_id": "456"}) {
+		t.Error("expected message to another chat to require approval")
+	}
+	// Another session answering chat 456 at the same time does not make
+	// the message to 456 this session's own chat
+	other := NewToolContext(context.Background(), "telegram", "456")
+	if m.Requires(other, msg, map[string]interface{}{"content": "hi", "chat_id": "456"}) || !m.Requires(ctx, msg, map[string]interface{}{"content": "hi", "chat_id": "456"}) {
+		t.Error("approval depended on another session's chat")
+	}
+}
+
+func TestApprovalManager_ApproveViaCommand(t *testing.T) {
+	m := NewApprovalManager(time.Minute, []string{"exec"})
+
+	prompts := make(chan ApprovalRequest, 1)
+	m.SetNotifier(func(req ApprovalRequest) error {
+		prompts <- req
+		return nil
+	})
+
+	done := make(chan bool, 1)
+	go func() {
+		approved, err := m.Request(context.Background(), ApprovalRequest{Tool: "exec", Channel: "telegram", ChatID: "-100", SenderID: "1001|alice"})
+		if err != nil {
+			t.Errorf("Request() error = %v", err)
+		}
+		done <- approved
+	}()
+
+	req := <-prompts
+	if !strings.Contains(FormatApprovalPrompt(req), "/approve "+req.ID) {
+		t.Errorf("prompt does not mention approve command: %q", FormatApprovalPrompt(req))
+	}
+
+	// Answers from another chat are ignored.
+	if reply, handled := m.HandleCommand("telegram", "999", "1001|alice", "/approve "+req.ID); !handled || !strings.Contains(reply, "No pending") {
+		t.Errorf("unexpected reply from foreign chat: %q", reply)
+	}
+	// So are answers from other members of the group.
+	if reply, handled := m.HandleCommand("telegram", "-100", "1002|bob", "/approve "+req.ID); !handled || !strings.Contains(reply, "Only the person who asked") {
+		t.Errorf("unexpected reply from another member: %q", reply)
+	}
+
+	if reply, handled := m.HandleCommand("telegram", "-100", "1001|alice_new", "/approve "+req.ID); !handled || !strings.Contains(reply, "Approved") {
+		t.Errorf("unexpected approve reply: %q", reply)
+	}
+	if !<-done {
+		t.Error("expected request to be approved")
+	}
+	if len(m.Pending()) != 0 {
+		t.Error("expected no pending requests after resolution")
+	}
+}
+
+func TestApprovalManager_OperatorAnswers(t *testing.T) {
+	m := NewApprovalManager(time.Minute, []string{"exec"})
+	m.SetOperator(func(senderID string) bool { return senderID == "9000" })
+	prompts := make(chan ApprovalRequest, 1)
+	m.SetNotifier(func(req ApprovalRequest) error {
+		prompts <- req
+		return nil
+	})
+
+	done := make(chan bool, 1)
+	go func() {
+		approved, _ := m.Request(context.Background(), ApprovalRequest{Tool: "exec", Channel: "telegram", ChatID: "-100", SenderID: "1001"})
+		done <- approved
+	}()
+
+	req := <-prompts
+	if reply, _ := m.HandleCommand("telegram", "-100", "9000", "/deny "+req.ID); !strings.Contains(reply, "Denied") {
+		t.Errorf("unexpected operator reply: %q", reply)
+	}
+	if <-done {
+		t.Error("expected request to be denied")
+	}
+}
+
+func TestApprovalManager_Timeout(t *testing.T) {
+	m := NewApprovalManager(20*time.Millisecond, nil)
+	m.SetNotifier(func(req ApprovalRequest) error { return nil })
+
+	approved, err := m.Request(context.Background(), ApprovalRequest{Tool: "exec"})
+	if approved || !errors.Is(err, ErrApprovalTimeout) {
+		t.Errorf("expected timeout denial, got approved=%v err=%v", approved, err)
+	}
+}
+
+func TestToolRegistry_DeniedToolIsNotExecuted(t *testing.T) {
+	r := NewToolRegistry()
+	tool := &stubTool{name: "exec", result: NewToolResult("ran")}
+	r.Register(tool)
+
+	m := NewApprovalManager(time.Minute, []string{"exec"})
+	m.SetPrompter(func(ctx context.Context, req ApprovalRequest) (bool, error) {
+		return false, nil
+	})
+	r.SetApprovalManager(m)
+
+	result := r.ExecuteWithContext(context.Background(), "exec", nil, "cli", "direct", nil)
+	if !result.IsError || !strings.Contains(result.ForLLM, "denied") {
+		t.Errorf("expected denial error, got %+v", result)
+	}
+	if tool.calls != 0 {
+		t.Errorf("expected denied tool not to run, ran %d times", tool.calls)
+	}
+}
+
+// stubTool is a minimal Tool returning a fixed result.
+type stubTool struct {
+	name   string
+	result *ToolResult
+	calls  int
+}
+
+func (t *stubTool) Name() string        { return t.name }
+func (t *stubTool) Description() string { return "stub tool " + t.name }
+func (t *stubTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{"type": "object"}
+}
+
+func (t *stubTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	t.calls++
+	if t.result == nil {
+		return NewToolResult("ok")
+	}
+	return t.result
+}
@@ -0,0 +1,335 @@
+package tools
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// BindArgs fills a struct of type T from tool call arguments. Fields are
+// matched by their json tag, or their name when untagged, and an `arg` tag
+// adds rules:
+//
+//	required         the argument must be present; strings must not be blank
+//	enum=A|B|C       the value (or each element of a slice) must be one of
+//	                 these, matched case-insensitively and stored as written
+//	min=N, max=N     numeric range, or element count for slices
+//	default=V        value used when the argument is missing or a blank string
+//
+// Values are coerced the way models tend to send them: strings are trimmed,
+// numbers and booleans are also accepted as strings, integers must be whole,
+// and blank entries are dropped from string slices. Pointer fields stay nil
+// when the argument is missing. Slices of structs and nested structs are
+// bound recursively.
+//
+// Every problem found is reported in one *ArgsError, which matches
+// ErrInvalidArgs.
+func BindArgs[T any](args map[string]interface{}) (T, error) {
+	var out T
+	v := reflect.ValueOf(&out).Elem()
+	if v.Kind() != reflect.Struct {
+		panic(fmt.Sprintf("tools.BindArgs: %T is not a struct", out))
+	}
+	b := &binder{}
+	b.bindStruct(v, args, "")
+	if len(b.errs) > 0 {
+		return out, &ArgsError{Fields: b.errs}
+	}
+	return out, nil
+}
+
+// FieldError is a problem with one argument. Field is its path, such as
+// "requests[1].answer_type".
+type FieldError struct {
+	Field   string
+	Message string
+}
+
+func (e FieldError) Error() string {
+	return e.Field + " " + e.Message
+}
+
+// ArgsError lists the arguments BindArgs rejected.
+type ArgsError struct {
+	Fields []FieldError
+}
+
+func (e *ArgsError) Error() string {
+	msgs := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		msgs[i] = f.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+func (e *ArgsError) Unwrap() error {
+	return ErrInvalidArgs
+}
+
+type argRules struct {
+	required bool
+	enum     []string
+	min, max *float64
+	def      *string
+}
+
+func parseArgRules(tag string) argRules {
+	var r argRules
+	for _, part := range strings.Split(tag, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "required":
+			r.required = true
+		case "enum":
+			r.enum = strings.Split(value, "|")
+		case "min", "max":
+			n, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				panic(fmt.Sprintf("tools.BindArgs: bad %s in arg tag %q", key, tag))
+			}
+			if key == "min" {
+				r.min = &n
+			} else {
+				r.max = &n
+			}
+		case "default":
+			r.def = &value
+		}
+	}
+	return r
+}
+
+type binder struct {
+	errs []FieldError
+}
+
+func (b *binder) fail(field, format string, args ...interface{}) {
+	b.errs = append(b.errs, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+func (b *binder) bindStruct(v reflect.Value, args map[string]interface{}, prefix string) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(sf.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = sf.Name
+		}
+		rules := parseArgRules(sf.Tag.Get("arg"))
+		path := prefix + name
+
+		raw, ok := args[name]
+		if !ok || raw == nil {
+			switch {
+			case rules.def != nil:
+				raw = *rules.def
+			case rules.required:
+				b.fail(path, "is required")
+				continue
+			default:
+				continue
+			}
+		}
+		b.bindValue(v.Field(i), raw, path, rules)
+	}
+}
+
+func (b *binder) bindValue(v reflect.Value, raw interface{}, path string, rules argRules) {
+	switch v.Kind() {
+	case reflect.Pointer:
+		elem := reflect.New(v.Type().Elem())
+		before := len(b.errs)
+		b.bindValue(elem.Elem(), raw, path, rules)
+		if len(b.errs) == before {
+			v.Set(elem)
+		}
+
+	case reflect.String:
+		s, ok := raw.(string)
+		if !ok {
+			b.fail(path, "must be a string")
+			return
+		}
+		s = strings.TrimSpace(s)
+		if s == "" && rules.def != nil {
+			s = *rules.def
+		}
+		if s == "" {
+			if rules.required {
+				b.fail(path, "must be a non-empty string")
+			}
+			return
+		}
+		if len(rules.enum) > 0 {
+			var matched bool
+			if s, matched = matchEnum(s, rules.enum); !matched {
+				b.fail(path, "must be one of %s", strings.Join(rules.enum, ", "))
+				return
+			}
+		}
+		v.SetString(s)
+
+	case reflect.Bool:
+		switch x := raw.(type) {
+		case bool:
+			v.SetBool(x)
+		case string:
+			parsed, err := strconv.ParseBool(strings.TrimSpace(x))
+			if err != nil {
+				b.fail(path, "must be a boolean")
+				return
+			}
+			v.SetBool(parsed)
+		default:
+			b.fail(path, "must be a boolean")
+		}
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, ok := toNumber(raw)
+		if !ok || n != math.Trunc(n) || v.OverflowInt(int64(n)) {
+			b.fail(path, "must be an integer")
+			return
+		}
+		if b.checkRange(path, n, rules) {
+			v.SetInt(int64(n))
+		}
+
+	case reflect.Float32, reflect.Float64:
+		n, ok := toNumber(raw)
+		if !ok {
+			b.fail(path, "must be a number")
+			return
+		}
+		if b.checkRange(path, n, rules) {
+			v.SetFloat(n)
+		}
+
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Interface {
+			items, ok := raw.([]interface{})
+			if !ok {
+				b.fail(path, "must be an array")
+				return
+			}
+			v.Set(reflect.ValueOf(items))
+			return
+		}
+		b.bindSlice(v, raw, path, rules)
+
+	case reflect.Struct:
+		m, ok := raw.(map[string]interface{})
+		if !ok {
+			b.fail(path, "must be an object")
+			return
+		}
+		b.bindStruct(v, m, path+".")
+
+	case reflect.Map, reflect.Interface:
+		rv := reflect.ValueOf(raw)
+		if !rv.Type().AssignableTo(v.Type()) {
+			b.fail(path, "has the wrong type")
+			return
+		}
+		v.Set(rv)
+
+	default:
+		panic(fmt.Sprintf("tools.BindArgs: unsupported field type %s for %s", v.Type(), path))
+	}
+}
+
+func (b *binder) bindSlice(v reflect.Value, raw interface{}, path string, rules argRules) {
+	var items []interface{}
+	switch x := raw.(type) {
+	case []interface{}:
+		items = x
+	case []string:
+		for _, s := range x {
+			items = append(items, s)
+		}
+	default:
+		b.fail(path, "must be an array")
+		return
+	}
+
+	elemRules := argRules{enum: rules.enum}
+	isString := v.Type().Elem().Kind() == reflect.String
+	out := reflect.MakeSlice(v.Type(), 0, len(items))
+	before := len(b.errs)
+	for i, item := range items {
+		if isString {
+			if s, ok := item.(string); ok && strings.TrimSpace(s) == "" {
+				continue
+			}
+		}
+		elem := reflect.New(v.Type().Elem()).Elem()
+		b.bindValue(elem, item, fmt.Sprintf("%s[%d]", path, i), elemRules)
+		out = reflect.Append(out, elem)
+	}
+	if len(b.errs) > before {
+		return
+	}
+
+	n := out.Len()
+	switch {
+	case rules.required && n == 0:
+		b.fail(path, "must not be empty")
+	case rules.min != nil && float64(n) < *rules.min:
+		b.fail(path, "must have at least %v items", *rules.min)
+	case rules.max != nil && float64(n) > *rules.max:
+		b.fail(path, "must have at most %v items", *rules.max)
+	default:
+		v.Set(out)
+	}
+}
+
+func (b *binder) checkRange(path string, n float64, rules argRules) bool {
+	switch {
+	case rules.min != nil && rules.max != nil && (n < *rules.min || n > *rules.max):
+		b.fail(path, "must be between %v and %v", *rules.min, *rules.max)
+	case rules.min != nil && n < *rules.min:
+		b.fail(path, "must be at least %v", *rules.min)
+	case rules.max != nil && n > *rules.max:
+		b.fail(path, "must be at most %v", *rules.max)
+	default:
+		return true
+	}
+	return false
+}
+
+func toNumber(raw interface{}) (float64, bool) {
+	switch x := raw.(type) {
+	case float64:
+		return x, true
+	case float32:
+		return float64(x), true
+	case int:
+		return float64(x), true
+	case int64:
+		return float64(x), true
+	case json.Number:
+		n, err := x.Float64()
+		return n, err == nil
+	case string:
+		n, err := strconv.ParseFloat(strings.TrimSpace(x), 64)
+		return n, err == nil
+	}
+	return 0, false
+}
+
+func matchEnum(s string, enum []string) (string, bool) {
+	for _, allowed := range enum {
+		if strings.EqualFold(s, allowed) {
+			return allowed, true
+		}
+	}
+	return s, false
+}
@@ -0,0 +1,140 @@
+package tools
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type testLabRequest struct {
+	Test  string  `json:"test" arg:"required,enum=CA19-9|CEA"`
+	Value float64 `json:"value" arg:"min=0"`
+}
+
+type testBindArgs struct {
+	Patient  string                 `json:"patient" arg:"required"`
+	Scope    []string               `json:"scope" arg:"enum=PAPER|GUIDE"`
+	Days     int                    `json:"days" arg:"default=7,min=1,max=30"`
+	Fasting  *bool                  `json:"fasting"`
+	Limit    *int64                 `json:"limit"`
+	Requests []testLabRequest       `json:"requests"`
+	Extra    map[string]interface{} `json:"extra"`
+	Ignored  string                 `json:"-"`
+}
+
+func TestBindArgs(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    map[string]interface{}
+		want    testBindArgs
+		wantErr string
+	}{
+		{
+			name: "defaults and coercion",
+			args: map[string]interface{}{
+				"patient": "  Li Wei ",
+				"scope":   []interface{}{"paper", " ", "GUIDE"},
+				"fasting": "true",
+				"limit":   json.Number("5"),
+			},
+			want: testBindArgs{
+				Patient: "Li Wei",
+				Scope:   []string{"PAPER", "GUIDE"},
+				Days:    7,
+				Fasting: boolPtr(true),
+				Limit:   int64Ptr(5),
+			},
+		},
+		{
+			name: "nested structs and maps",
+			args: map[string]interface{}{
+				"patient":  "p1",
+				"days":     "14",
+				"requests": []interface{}{map[string]interface{}{"test": "ca19-9", "value": float64(35)}},
+				"extra":    map[string]interface{}{"note": "x"},
+			},
+			want: testBindArgs{
+				Patient:  "p1",
+				Days:     14,
+				Requests: []testLabRequest{{Test: "CA19-9", Value: 35}},
+				Extra:    map[string]interface{}{"note": "x"},
+			},
+		},
+		{
+			name:    "missing required",
+			args:    map[string]interface{}{},
+			wantErr: "patient is required",
+		},
+		{
+			name:    "blank required string",
+			args:    map[string]interface{}{"patient": "  "},
+			wantErr: "patient must be a non-empty string",
+		},
+		{
+			name:    "range",
+			args:    map[string]interface{}{"patient": "p1", "days": float64(45)},
+			wantErr: "days must be between 1 and 30",
+		},
+		{
+			name:    "fractional integer",
+			args:    map[string]interface{}{"patient": "p1", "limit": 2.5},
+			wantErr: "limit must be an integer",
+		},
+		{
+			name:    "enum element",
+			args:    map[string]interface{}{"patient": "p1", "scope": []interface{}{"PAPER", "BLOG"}},
+			wantErr: "scope[1] must be one of PAPER, GUIDE",
+		},
+		{
+			name: "field errors are collected",
+			args: map[string]interface{}{
+				"fasting":  "maybe",
+				"requests": []interface{}{map[string]interface{}{"value": float64(-1)}, "CEA"},
+			},
+			wantErr: "patient is required; fasting must be a boolean; requests[0].test is required; " +
+				"requests[0].value must be at least 0; requests[1] must be an object",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := BindArgs[testBindArgs](tt.args)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				if !errors.Is(err, ErrInvalidArgs) {
+					t.Error("binding errors should match ErrInvalidArgs")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("BindArgs: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBindArgs_FieldErrors(t *testing.T) {
+	_, err := BindArgs[testBindArgs](map[string]interface{}{"days": float64(0)})
+	var argsErr *ArgsError
+	if !errors.As(err, &argsErr) || len(argsErr.Fields) != 2 {
+		t.Fatalf("expected two field errors, got %v", err)
+	}
+	if f := argsErr.Fields[1]; f.Field != "days" || !strings.Contains(f.Message, "between") {
+		t.Errorf("unexpected field error %+v", f)
+	}
+}
+
+func boolPtr(v bool) *bool {
+	return &v
+}
+
+func int64Ptr(v int64) *int64 {
+	return &v
+}
@@ -69,6 +69,24 @@ type AsyncTool interface {
 	SetCallback(cb AsyncCallback)
 }
 
+// ConcurrentTool is an optional interface for tools that may run at the
+// same time as other calls from one model reply: they keep no per-call
+// state on the tool and change nothing another call could read. Read-only
+// CacheableTool tools are treated as concurrent as well.
+type ConcurrentTool interface {
+	Tool
+	Concurrent() bool
+}
+
+// IsConcurrent reports whether tool may run alongside other calls.
+func IsConcurrent(tool Tool) bool {
+	if ct, ok := tool.(ConcurrentTool); ok {
+		return ct.Concurrent()
+	}
+	_, cacheable := tool.(CacheableTool)
+	return cacheable
+}
+
 func ToolToSchema(tool Tool) map[string]interface{} {
 	return map[string]interface{}{
 		"type": "function",
@@ -0,0 +1,226 @@
+package tools
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+const (
+	defaultToolCacheTTL     = 15 * time.Minute
+	defaultToolCacheEntries = 500
+)
+
+// CacheableTool is an optional interface for read-only tools whose results
+// can be reused for identical arguments. CacheTTL is the default lifetime
+// of a cached result; zero disables caching.
+type CacheableTool interface {
+	Tool
+	CacheTTL() time.Duration
+}
+
+// ttlCache is a bounded map whose entries expire after a TTL. When full,
+// the oldest inserted entry is evicted.
+type ttlCache struct {
+	mu         sync.Mutex
+	entries    map[string]ttlCacheEntry
+	order      []string
+	ttl        time.Duration
+	maxEntries int
+}
+
+type ttlCacheEntry struct {
+	value     interface{}
+	expiresAt time.Time
+}
+
+func newTTLCache(ttl time.Duration, maxEntries int) *ttlCache {
+	return &ttlCache{
+		entries:    make(map[string]ttlCacheEntry),
+		order:      make([]string, 0, maxEntries),
+		ttl:        ttl,
+		maxEntries: maxEntries,
+	}
+}
+
+func (c *ttlCache) Get(key string) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	if time.Now().After(entry.expiresAt) {
+		c.deleteLocked(key)
+		return nil, false
+	}
+
+	return entry.value, true
+}
+
+func (c *ttlCache) Set(key string, value interface{}) {
+	c.SetWithTTL(key, value, c.ttl)
+}
+
+func (c *ttlCache) SetWithTTL(key string, value interface{}, ttl time.Duration) {
+	if c.maxEntries <= 0 || ttl <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, exists := c.entries[key]; !exists {
+		for len(c.entries) >= c.maxEntries && len(c.order) > 0 {
+			oldest := c.order[0]
+			c.order = c.order[1:]
+			delete(c.entries, oldest)
+		}
+		c.order = append(c.order, key)
+	}
+
+	c.entries[key] = ttlCacheEntry{
+		value:     value,
+		expiresAt: time.Now().Add(ttl),
+	}
+}
+
+func (c *ttlCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
+
+func (c *ttlCache) deleteLocked(key string) {
+	delete(c.entries, key)
+	for i, existing := range c.order {
+		if existing == key {
+			c.order = append(c.order[:i], c.order[i+1:]...)
+			break
+		}
+	}
+}
+
+type CacheOptions struct {
+	// MaxEntries bounds the number of cached results across all tools.
+	MaxEntries int
+	// TTLs overrides the lifetime per tool name. A zero or negative value
+	// disables caching for that tool. Overrides only apply to tools that
+	// implement CacheableTool: other tools may return per-user results,
+	// which the cache key does not separate.
+	TTLs map[string]time.Duration
+}
+
+// CacheMiddleware reuses successful results of CacheableTool calls, keyed
+// by tool name and normalized arguments.
+type CacheMiddleware struct {
+	cache *ttlCache
+	ttls  map[string]time.Duration
+}
+
+func NewCacheMiddleware(opts CacheOptions) *CacheMiddleware {
+	maxEntries := opts.MaxEntries
+	if maxEntries <= 0 {
+		maxEntries = defaultToolCacheEntries
+	}
+	ttls := make(map[string]time.Duration, len(opts.TTLs))
+	for name, ttl := range opts.TTLs {
+		ttls[name] = ttl
+	}
+	return &CacheMiddleware{
+		cache: newTTLCache(defaultToolCacheTTL, maxEntries),
+		ttls:  ttls,
+	}
+}
+
+// TTL returns how long results of tool are cached, or 0 if they are not.
+func (m *CacheMiddleware) TTL(tool Tool) time.Duration {
+	cacheable, ok := tool.(CacheableTool)
+	if !ok {
+		return 0
+	}
+	if ttl, ok := m.ttls[tool.Name()]; ok {
+		return ttl
+	}
+	return cacheable.CacheTTL()
+}
+
+// Execute returns a cached result for tool and args when one is fresh,
+// otherwise runs next and caches its result. Errors and async results
+// are never cached.
+func (m *CacheMiddleware) Execute(ctx context.Context, tool Tool, args map[string]interface{}, next func(context.Context, map[string]interface{}) *ToolResult) *ToolResult {
+	ttl := m.TTL(tool)
+	if ttl <= 0 {
+		return next(ctx, args)
+	}
+
+	key, ok := toolCacheKey(tool.Name(), args)
+	if !ok {
+		return next(ctx, args)
+	}
+
+	if cached, ok := m.cache.Get(key); ok {
+		logger.DebugCF("tool", "Tool result served from cache",
+			map[string]interface{}{
+				"tool": tool.Name(),
+			})
+		result := *cached.(*ToolResult)
+		return &result
+	}
+
+	result := next(ctx, args)
+	if result != nil && !result.IsError && !result.Async {
+		stored := *result
+		m.cache.SetWithTTL(key, &stored, ttl)
+	}
+	return result
+}
+
+// Len returns the number of cached results.
+func (m *CacheMiddleware) Len() int {
+	return m.cache.Len()
+}
+
+// toolCacheKey hashes the tool name with its arguments. Map keys are sorted
+// by encoding/json, strings are trimmed, and nil values are dropped so
+// equivalent calls share a key.
+func toolCacheKey(name string, args map[string]interface{}) (string, bool) {
+	data, err := json.Marshal(normalizeCacheArg(args))
+	if err != nil {
+		return "", false
+	}
+	sum := sha256.Sum256(append([]byte(name+"\x00"), data...))
+	return hex.EncodeToString(sum[:]), true
+}
+
+func normalizeCacheArg(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(val))
+		for k, item := range val {
+			if item == nil {
+				continue
+			}
+			out[k] = normalizeCacheArg(item)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(val))
+		for i, item := range val {
+			out[i] = normalizeCacheArg(item)
+		}
+		return out
+	case string:
+		return strings.TrimSpace(val)
+	default:
+		return val
+	}
+}
@@ -0,0 +1,120 @@
+package tools
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+type cacheableStubTool struct {
+	stubTool
+	ttl time.Duration
+}
+
+func (t *cacheableStubTool) CacheTTL() time.Duration { return t.ttl }
+
+func TestCacheMiddleware_ReusesEquivalentCalls(t *testing.T) {
+	tool := &cacheableStubTool{stubTool: stubTool{name: "web_search"}, ttl: time.Minute}
+	r := NewToolRegistry()
+	r.Register(tool)
+	r.SetCacheMiddleware(NewCacheMiddleware(CacheOptions{}))
+
+	ctx := context.Background()
+	r.Execute(ctx, "web_search", map[string]interface{}{"query": "golang", "count": float64(5)})
+	r.Execute(ctx, "web_search", map[string]interface{}{"count": float64(5), "query": "  golang ", "extra": nil})
+	if tool.calls != 1 {
+		t.Fatalf("expected 1 call for equivalent args, got %d", tool.calls)
+	}
+
+	r.Execute(ctx, "web_search", map[string]interface{}{"query": "rust", "count": float64(5)})
+	if tool.calls != 2 {
+		t.Fatalf("expected different args to miss the cache, got %d calls", tool.calls)
+	}
+}
+
+func TestCacheMiddleware_SkipsErrorsAndUncacheableTools(t *testing.T) {
+	m := NewCacheMiddleware(CacheOptions{})
+	ctx := context.Background()
+	args := map[string]interface{}{"path": "a.txt"}
+
+	plain := &stubTool{name: "read_file"}
+	m.Execute(ctx, plain, args, plain.Execute)
+	m.Execute(ctx, plain, args, plain.Execute)
+	if plain.calls != 2 {
+		t.Errorf("tool without CacheTTL should not be cached, got %d calls", plain.calls)
+	}
+
+	failing := &cacheableStubTool{stubTool: stubTool{name: "web_fetch", result: ErrorResult("boom")}, ttl: time.Minute}
+	m.Execute(ctx, failing, args, failing.Execute)
+	m.Execute(ctx, failing, args, failing.Execute)
+	if failing.calls != 2 {
+		t.Errorf("error results should not be cached, got %d calls", failing.calls)
+	}
+	if m.Len() != 0 {
+		t.Errorf("expected empty cache, got %d entries", m.Len())
+	}
+}
+
+func TestCacheMiddleware_PerToolTTLOverride(t *testing.T) {
+	m := NewCacheMiddleware(CacheOptions{TTLs: map[string]time.Duration{
+		"web_search": 0,
+		"read_file":  time.Minute,
+	}})
+
+	tests := []struct {
+		name      string
+		tool      Tool
+		wantCalls int
+	}{
+		{name: "override disables cacheable tool", tool: &cacheableStubTool{stubTool: stubTool{name: "web_search"}, ttl: time.Minute}, wantCalls: 2},
+		{name: "override ignored for plain tool", tool: &stubTool{name: "read_file"}, wantCalls: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			next := func(ctx context.Context, args map[string]interface{}) *ToolResult {
+				calls++
+				return NewToolResult("ok")
+			}
+			m.Execute(context.Background(), tt.tool, nil, next)
+			m.Execute(context.Background(), tt.tool, nil, next)
+			if calls != tt.wantCalls {
+				t.Errorf("calls = %d, want %d", calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestCacheMiddleware_ReturnsCopies(t *testing.T) {
+	tool := &cacheableStubTool{stubTool: stubTool{name: "web_search", result: NewToolResult("original")}, ttl: time.Minute}
+	m := NewCacheMiddleware(CacheOptions{})
+	ctx := context.Background()
+
+	first := m.Execute(ctx, tool, nil, tool.Execute)
+	first.ForLLM = "mutated"
+
+	second := m.Execute(ctx, tool, nil, tool.Execute)
+	if second.ForLLM != "original" {
+		t.Errorf("cached result was mutated by caller: %q", second.ForLLM)
+	}
+}
+
+func TestTTLCache_ExpiryAndEviction(t *testing.T) {
+	c := newTTLCache(time.Minute, 2)
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Set("c", 3)
+	if _, ok := c.Get("a"); ok {
+		t.Error("expected oldest entry to be evicted")
+	}
+	if v, ok := c.Get("c"); !ok || v != 3 {
+		t.Errorf("Get(c) = %v, %v", v, ok)
+	}
+
+	c.SetWithTTL("short", "x", time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	if _, ok := c.Get("short"); ok {
+		t.Error("expected expired entry to be dropped")
+	}
+}
@@ -0,0 +1,78 @@
+package tools
+
+import (
+	"context"
+	"time"
+)
+
+// CallMetadata identifies who a tool call was made for.
+type CallMetadata struct {
+	AgentID    string
+	SessionKey string
+	UserID     string
+	// TurnID groups the calls made while answering one message.
+	TurnID string
+	// Language is the user's language tag, such as "zh-CN", when the
+	// channel reports one.
+	Language string
+	// Permissions are the tool roles the user holds, by name. A user
+	// holding none may use every tool.
+	Permissions map[string]ToolRolePolicy
+	// Scope limits the turn to the tools of the specialist handling it;
+	// nil allows every tool.
+	Scope *ToolRolePolicy
+}
+
+// Allows reports whether the user's roles permit the named tool: with no
+// roles every tool is allowed, otherwise at least one role must allow it.
+func (m CallMetadata) Allows(tool string) bool {
+	if len(m.Permissions) == 0 {
+		return true
+	}
+	for _, policy := range m.Permissions {
+		if policy.Allows(tool) {
+			return true
+		}
+	}
+	return false
+}
+
+// InScope reports whether the named tool is within the turn's scope.
+func (m CallMetadata) InScope(tool string) bool {
+	return m.Scope == nil || m.Scope.Allows(tool)
+}
+
+type callMetadataKey struct{}
+
+// WithCallMetadata attaches call metadata to ctx for recorders.
+func WithCallMetadata(ctx context.Context, meta CallMetadata) context.Context {
+	return context.WithValue(ctx, callMetadataKey{}, meta)
+}
+
+// CallMetadataFromContext returns the metadata set by WithCallMetadata, if any.
+func CallMetadataFromContext(ctx context.Context) CallMetadata {
+	meta, _ := ctx.Value(callMetadataKey{}).(CallMetadata)
+	return meta
+}
+
+// ToolCallRecord describes one finished tool call, including calls that
+// failed, were denied approval, or named an unknown tool.
+type ToolCallRecord struct {
+	Tool     string
+	Args     map[string]interface{}
+	Channel  string
+	ChatID   string
+	Meta     CallMetadata
+	Start    time.Time
+	Duration time.Duration
+	IsError  bool
+	Error    string
+	// Result is the text the model saw.
+	Result string
+}
+
+// CallRecorder receives a record of every tool call made through a
+// ToolRegistry. Implementations must be safe for concurrent use.
+type CallRecorder interface {
+	RecordToolCall(record ToolCallRecord)
+}
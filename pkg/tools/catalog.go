@@ -0,0 +1,114 @@
+package tools
+
+import (
+	"context"
+	"path"
+	"sort"
+	"strings"
+)
+
+// LocalizedTool is an optional interface for tools that provide
+// descriptions in other languages, keyed by locale (e.g. "zh").
+type LocalizedTool interface {
+	Tool
+	LocalizedDescriptions() map[string]string
+}
+
+// ToolRolePolicy limits which tools a role may use. Patterns are tool names
+// or path.Match globs. Deny wins over allow; an empty Allow allows every tool.
+type ToolRolePolicy struct {
+	Allow []string
+	Deny  []string
+}
+
+// Allows reports whether the policy permits the named tool.
+func (p ToolRolePolicy) Allows(name string) bool {
+	if matchesAny(p.Deny, name) {
+		return false
+	}
+	return len(p.Allow) == 0 || matchesAny(p.Allow, name)
+}
+
+func matchesAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// CatalogEntry describes one registered tool for frontends and admins.
+type CatalogEntry struct {
+	Name             string                 `json:"name"`
+	Description      string                 `json:"description"`
+	Descriptions     map[string]string      `json:"descriptions,omitempty"`
+	Parameters       map[string]interface{} `json:"parameters"`
+	Roles            []string               `json:"roles,omitempty"`
+	RequiresApproval bool                   `json:"requires_approval"`
+	CacheTTLSeconds  int                    `json:"cache_ttl_seconds,omitempty"`
+}
+
+// Catalog lists the registered tools sorted by name. Description is
+// localized when the tool has a description for locale ("zh-CN" falls back
+// to "zh"). Roles lists which of the given roles may use each tool.
+func (r *ToolRegistry) Catalog(locale string, roles map[string]ToolRolePolicy) []CatalogEntry {
+	r.mu.RLock()
+	all := make([]Tool, 0, len(r.tools))
+	for _, tool := range r.tools {
+		all = append(all, tool)
+	}
+	approvals := r.approvals
+	cache := r.cache
+	r.mu.RUnlock()
+
+	roleNames := make([]string, 0, len(roles))
+	for role := range roles {
+		roleNames = append(roleNames, role)
+	}
+	sort.Strings(roleNames)
+
+	entries := make([]CatalogEntry, 0, len(all))
+	for _, tool := range all {
+		entry := CatalogEntry{
+			Name:        tool.Name(),
+			Description: tool.Description(),
+			Parameters:  tool.Parameters(),
+		}
+		if localized, ok := tool.(LocalizedTool); ok {
+			entry.Descriptions = localized.LocalizedDescriptions()
+			if desc := localizedDescription(entry.Descriptions, locale); desc != "" {
+				entry.Description = desc
+			}
+		}
+		for _, role := range roleNames {
+			if roles[role].Allows(entry.Name) {
+				entry.Roles = append(entry.Roles, role)
+			}
+		}
+		if approvals != nil {
+			entry.RequiresApproval = approvals.Requires(context.Background(), tool, nil)
+		}
+		if cache != nil {
+			entry.CacheTTLSeconds = int(cache.TTL(tool).Seconds())
+		}
+		entries = append(entries, entry)
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+	return entries
+}
+
+func localizedDescription(descriptions map[string]string, locale string) string {
+	locale = strings.ToLower(strings.TrimSpace(locale))
+	if locale == "" {
+		return ""
+	}
+	if desc, ok := descriptions[locale]; ok {
+		return desc
+	}
+	if base, _, found := strings.Cut(locale, "-"); found {
+		return descriptions[base]
+	}
+	return ""
+}
@@ -0,0 +1,54 @@
+package tools
+
+import "testing"
+
+type localizedStubTool struct {
+	stubTool
+}
+
+func (t *localizedStubTool) LocalizedDescriptions() map[string]string {
+	return map[string]string{"zh": "存根工具"}
+}
+
+func TestToolRolePolicy_Allows(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy ToolRolePolicy
+		tool   string
+		want   bool
+	}{
+		{name: "empty allows all", policy: ToolRolePolicy{}, tool: "exec", want: true},
+		{name: "glob allow", policy: ToolRolePolicy{Allow: []string{"knows_*"}}, tool: "knows_answer", want: true},
+		{name: "not in allow", policy: ToolRolePolicy{Allow: []string{"knows_*"}}, tool: "exec", want: false},
+		{name: "deny wins", policy: ToolRolePolicy{Allow: []string{"knows_*"}, Deny: []string{"knows_list_*"}}, tool: "knows_list_question", want: false},
+		{name: "deny only", policy: ToolRolePolicy{Deny: []string{"exec"}}, tool: "read_file", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.Allows(tt.tool); got != tt.want {
+				t.Errorf("Allows(%q) = %v, want %v", tt.tool, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestToolRegistry_CatalogLocalizesAndSorts(t *testing.T) {
+	r := NewToolRegistry()
+	r.Register(&stubTool{name: "zeta"})
+	r.Register(&localizedStubTool{stubTool{name: "alpha"}})
+
+	entries := r.Catalog("zh-CN", map[string]ToolRolePolicy{"guest": {Allow: []string{"alpha"}}})
+	if len(entries) != 2 || entries[0].Name != "alpha" || entries[1].Name != "zeta" {
+		t.Fatalf("unexpected order: %+v", entries)
+	}
+	if entries[0].Description != "存根工具" {
+		t.Errorf("expected zh description, got %q", entries[0].Description)
+	}
+	if entries[1].Description != "stub tool zeta" {
+		t.Errorf("expected default description, got %q", entries[1].Description)
+	}
+	if len(entries[0].Roles) != 1 || len(entries[1].Roles) != 0 {
+		t.Errorf("unexpected roles: %v / %v", entries[0].Roles, entries[1].Roles)
+	}
+}
@@ -0,0 +1,425 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	maxChartSeries = 6
+	maxChartPoints = 500
+)
+
+// MakeChartTool renders line and bar charts to PNG files in the workspace
+// and sends them to the user as images. Values come from the call itself,
+// a spreadsheet in the workspace, or the caller's symptom diary.
+type MakeChartTool struct {
+	workspace string
+	restrict  bool
+	policy    *PathPolicy
+	diary     *diaryStore
+	now       func() time.Time
+}
+
+func NewMakeChartTool(workspace string, restrict bool) *MakeChartTool {
+	return &MakeChartTool{
+		workspace: workspace,
+		restrict:  restrict,
+		diary:     &diaryStore{dir: filepath.Join(workspace, "diary"), now: time.Now},
+		now:       time.Now,
+	}
+}
+
+// SetPathPolicy applies p's limits; nil removes them.
+func (t *MakeChartTool) SetPathPolicy(p *PathPolicy) {
+	t.policy = p
+}
+
+func (t *MakeChartTool) Name() string {
+	return "make_chart"
+}
+
+func (t *MakeChartTool) Description() string {
+	return "Draw a line or bar chart as a PNG image and send it to the user, e.g. CA19-9 over time or weekly pain scores. " +
+		"source=data plots the series given in the call; source=spreadsheet plots columns of a CSV or .xlsx file in the workspace; " +
+		"source=diary plots the user's diary (pain, weight, or a symptom's severity). " +
+		"Text in the image is limited to English letters and digits; a Chinese title is sent as the image caption."
+}
+
+func (t *MakeChartTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"type": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"line", "bar"},
+				"description": "Chart type (default line)",
+			},
+			"source": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"data", "spreadsheet", "diary"},
+				"description": "Where the values come from (default data)",
+			},
+			"title": map[string]interface{}{
+				"type":        "string",
+				"description": "Chart title",
+			},
+			"y_label": map[string]interface{}{
+				"type":        "string",
+				"description": "Unit or label for the values, e.g. U/mL",
+			},
+			"series": map[string]interface{}{
+				"type":        "array",
+				"description": "For source=data: the series to plot",
+				"items": map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"name": map[string]interface{}{"type": "string"},
+						"points": map[string]interface{}{
+							"type": "array",
+							"items": map[string]interface{}{
+								"type": "object",
+								"properties": map[string]interface{}{
+									"x": map[string]interface{}{"type": "string", "description": "Date (YYYY-MM-DD) or category"},
+									"y": map[string]interface{}{"type": "number"},
+								},
+								"required": []string{"x", "y"},
+							},
+						},
+					},
+					"required": []string{"points"},
+				},
+			},
+			"path": map[string]interface{}{
+				"type":        "string",
+				"description": "For source=spreadsheet: path to the .csv, .tsv or .xlsx file",
+			},
+			"sheet": map[string]interface{}{
+				"type":        "string",
+				"description": "For source=spreadsheet: worksheet name (default: the first sheet)",
+			},
+			"x_column": map[string]interface{}{
+				"type":        "string",
+				"description": "For source=spreadsheet: the column of dates or categories (default: the first column)",
+			},
+			"y_columns": map[string]interface{}{
+				"type":        "array",
+				"items":       map[string]interface{}{"type": "string"},
+				"description": "For source=spreadsheet: the numeric columns to plot, one series each",
+			},
+			"filter": map[string]interface{}{
+				"type":        "string",
+				"description": "For source=spreadsheet: only plot rows where this expression is true, as in spreadsheet_analyze",
+			},
+			"metrics": map[string]interface{}{
+				"type":        "array",
+				"items":       map[string]interface{}{"type": "string"},
+				"description": "For source=diary: pain, weight, or symptom names (default pain)",
+			},
+			"from": map[string]interface{}{
+				"type":        "string",
+				"description": "For source=diary: first day, YYYY-MM-DD (default: 30 days ago)",
+			},
+			"to": map[string]interface{}{
+				"type":        "string",
+				"description": "For source=diary: last day, YYYY-MM-DD (default: today)",
+			},
+			"reference_lines": map[string]interface{}{
+				"type":        "array",
+				"description": "Horizontal lines such as the upper limit of normal, e.g. CA19-9 37",
+				"items": map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"label": map[string]interface{}{"type": "string"},
+						"value": map[string]interface{}{"type": "number"},
+					},
+					"required": []string{"value"},
+				},
+			},
+		},
+	}
+}
+
+type chartArgs struct {
+	Type   string `json:"type" arg:"default=line,enum=line|bar"`
+	Source string `json:"source" arg:"default=data,enum=data|spreadsheet|diary"`
+	Title  string `json:"title"`
+	YLabel string `json:"y_label"`
+	Series []struct {
+		Name   string `json:"name"`
+		Points []struct {
+			X interface{} `json:"x"`
+			Y float64     `json:"y"`
+		} `json:"points"`
+	} `json:"series"`
+	Path     string   `json:"path"`
+	Sheet    string   `json:"sheet"`
+	XColumn  string   `json:"x_column"`
+	YColumns []string `json:"y_columns"`
+	Filter   string   `json:"filter"`
+	Metrics  []string `json:"metrics"`
+	From     string   `json:"from"`
+	To       string   `json:"to"`
+	RefLines []struct {
+		Label string  `json:"label"`
+		Value float64 `json:"value"`
+	} `json:"reference_lines"`
+}
+
+const defaultChartDiaryDays = 30
+
+func (t *MakeChartTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	a, err := BindArgs[chartArgs](args)
+	if err != nil {
+		return ErrorResult(err.Error()).WithError(err)
+	}
+
+	var series []chartSeries
+	switch a.Source {
+	case "spreadsheet":
+		series, err = t.spreadsheetSeries(ctx, a)
+	case "diary":
+		series, err = t.diarySeries(ctx, a)
+	default:
+		for i, s := range a.Series {
+			cs := chartSeries{Name: s.Name}
+			if cs.Name == "" {
+				cs.Name = fmt.Sprintf("Series %d", i+1)
+			}
+			for _, p := range s.Points {
+				x := fmt.Sprint(p.X)
+				if p.X == nil {
+					x = ""
+				}
+				cs.Points = append(cs.Points, chartPoint{X: strings.TrimSpace(x), Y: p.Y})
+			}
+			series = append(series, cs)
+		}
+	}
+	if err != nil {
+		return ErrorResult(err.Error()).WithError(ClassifyError(ErrInvalidArgs, err))
+	}
+
+	total := 0
+	var kept []chartSeries
+	for _, s := range series {
+		if len(s.Points) > 0 {
+			kept = append(kept, s)
+			total += len(s.Points)
+		}
+	}
+	switch {
+	case len(kept) == 0:
+		return ErrorResult("no values to plot").WithError(ErrInvalidArgs)
+	case len(kept) > maxChartSeries:
+		return ErrorResult(fmt.Sprintf("at most %d series fit in one chart; got %d", maxChartSeries, len(kept))).WithError(ErrInvalidArgs)
+	case total > maxChartPoints:
+		return ErrorResult(fmt.Sprintf("at most %d points fit in one chart; got %d", maxChartPoints, total)).WithError(ErrInvalidArgs)
+	}
+
+	spec := chartSpec{Kind: a.Type, Title: strings.TrimSpace(a.Title), YLabel: strings.TrimSpace(a.YLabel), Series: kept}
+	for _, r := range a.RefLines {
+		spec.RefLines = append(spec.RefLines, chartRefLine{Label: strings.TrimSpace(r.Label), Y: r.Value})
+	}
+	img := renderChart(spec)
+
+	dir := filepath.Join(t.workspace, "charts")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return ErrorResult(fmt.Sprintf("failed to save chart: %v", err)).WithError(err)
+	}
+	name := fmt.Sprintf("chart-%s.png", t.now().Format("20060102-150405.000"))
+	path := filepath.Join(dir, name)
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("failed to save chart: %v", err)).WithError(err)
+	}
+	if err := png.Encode(f, img); err != nil {
+		f.Close()
+		return ErrorResult(fmt.Sprintf("failed to save chart: %v", err)).WithError(err)
+	}
+	if err := f.Close(); err != nil {
+		return ErrorResult(fmt.Sprintf("failed to save chart: %v", err)).WithError(err)
+	}
+
+	image := ContentBlock{Type: ContentImage, Path: path, Name: name, MimeType: "image/png", Caption: chartCaption(spec)}
+	summary := map[string]interface{}{
+		"file":   filepath.Join("charts", name),
+		"type":   spec.Kind,
+		"points": total,
+	}
+	var names []string
+	for _, s := range kept {
+		names = append(names, s.Name)
+	}
+	summary["series"] = names
+	payload, _ := json.Marshal(summary)
+	result := RichUserResult(image)
+	result.ForLLM = "Chart sent to the user: " + string(payload)
+	return result
+}
+
+// chartCaption is the title plus, when the image could not spell out the
+// series names, which color is which.
+func chartCaption(spec chartSpec) string {
+	caption := spec.Title
+	if len(spec.Series) < 2 {
+		return caption
+	}
+	var legend []string
+	drawable := true
+	for i, s := range spec.Series {
+		drawable = drawable && chartDrawable(s.Name)
+		legend = append(legend, chartPalette[i%len(chartPalette)].name+": "+s.Name)
+	}
+	if drawable {
+		return caption
+	}
+	if caption != "" {
+		caption += " — "
+	}
+	return caption + strings.Join(legend, ", ")
+}
+
+// spreadsheetSeries plots y_columns against x_column of a spreadsheet.
+func (t *MakeChartTool) spreadsheetSeries(ctx context.Context, a chartArgs) ([]chartSeries, error) {
+	if a.Path == "" {
+		return nil, fmt.Errorf("source=spreadsheet needs path")
+	}
+	if len(a.YColumns) == 0 {
+		return nil, fmt.Errorf("source=spreadsheet needs y_columns")
+	}
+	path, err := t.policy.resolve(ctx, a.Path, t.workspace, t.restrict, true)
+	if err != nil {
+		return nil, err
+	}
+	if info, err := os.Stat(path); err == nil {
+		if err := t.policy.checkSize(info.Size()); err != nil {
+			return nil, err
+		}
+	}
+	table, err := loadSpreadsheet(path, a.Sheet)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read %s: %w", a.Path, err)
+	}
+	columns := strings.Join(table.headers, ", ")
+	xCol := 0
+	if a.XColumn != "" {
+		if xCol = table.column(strings.Trim(a.XColumn, "`")); xCol < 0 {
+			return nil, fmt.Errorf("unknown column %q (columns: %s)", a.XColumn, columns)
+		}
+	}
+	rows := table.rows
+	if a.Filter != "" {
+		filter, err := parseExpr(a.Filter, table.hasColumn)
+		if err != nil {
+			return nil, fmt.Errorf("%v (columns: %s)", err, columns)
+		}
+		rows = nil
+		for _, row := range table.rows {
+			v, err := filter.eval(table.rowFunc(row))
+			if err != nil {
+				return nil, err
+			}
+			if v.truthy() {
+				rows = append(rows, row)
+			}
+		}
+	}
+
+	var series []chartSeries
+	for _, name := range a.YColumns {
+		col := table.column(strings.Trim(name, "`"))
+		if col < 0 {
+			return nil, fmt.Errorf("unknown column %q (columns: %s)", name, columns)
+		}
+		s := chartSeries{Name: table.headers[col]}
+		for _, row := range rows {
+			x := strings.TrimSpace(row[xCol])
+			if y, ok := parseCellNumber(row[col]); ok && x != "" {
+				s.Points = append(s.Points, chartPoint{X: x, Y: y})
+			}
+		}
+		series = append(series, s)
+	}
+	return series, nil
+}
+
+// diarySeries plots the caller's diary metrics, one point per day logged.
+func (t *MakeChartTool) diarySeries(ctx context.Context, a chartArgs) ([]chartSeries, error) {
+	path, err := t.diary.path(ctx)
+	if err != nil {
+		return nil, err
+	}
+	now := t.now()
+	to, from := now, now.AddDate(0, 0, -(defaultChartDiaryDays-1))
+	if a.To != "" {
+		if to, err = time.ParseInLocation("2006-01-02", a.To, now.Location()); err != nil {
+			return nil, fmt.Errorf("to %q must be YYYY-MM-DD", a.To)
+		}
+		from = to.AddDate(0, 0, -(defaultChartDiaryDays - 1))
+	}
+	if a.From != "" {
+		if from, err = time.ParseInLocation("2006-01-02", a.From, now.Location()); err != nil {
+			return nil, fmt.Errorf("from %q must be YYYY-MM-DD", a.From)
+		}
+	}
+	if from.After(to) {
+		return nil, fmt.Errorf("from must not be after to")
+	}
+	entries, err := t.diary.load(path, from.Format("2006-01-02"), to.Format("2006-01-02"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read diary: %w", err)
+	}
+
+	metrics := a.Metrics
+	if len(metrics) == 0 {
+		metrics = []string{"pain"}
+	}
+	var series []chartSeries
+	for _, m := range metrics {
+		metric := strings.TrimSpace(m)
+		s := chartSeries{Name: metric}
+		// A day logged twice keeps its last value.
+		last := make(map[string]int)
+		add := func(date string, v float64) {
+			if i, ok := last[date]; ok {
+				s.Points[i].Y = v
+				return
+			}
+			last[date] = len(s.Points)
+			s.Points = append(s.Points, chartPoint{X: date, Y: v})
+		}
+		for _, e := range entries {
+			switch strings.ToLower(metric) {
+			case "pain", "pain_score":
+				if e.PainScore != nil {
+					add(e.Date, float64(*e.PainScore))
+				}
+			case "weight", "weight_kg":
+				if e.WeightKg > 0 {
+					add(e.Date, e.WeightKg)
+				}
+			default:
+				for _, sym := range e.Symptoms {
+					if strings.EqualFold(sym.Name, metric) {
+						add(e.Date, float64(sym.Severity))
+					}
+				}
+			}
+		}
+		switch strings.ToLower(metric) {
+		case "pain", "pain_score":
+			s.Name = "Pain"
+		case "weight", "weight_kg":
+			s.Name = "Weight (kg)"
+		}
+		series = append(series, s)
+	}
+	return series, nil
+}
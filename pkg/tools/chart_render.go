@@ -0,0 +1,437 @@
+package tools
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	chartWidth   = 900
+	chartHeight  = 540
+	chartScale   = 2 // pixels per font dot
+	chartMarginL = 90
+	chartMarginR = 30
+	chartMarginT = 60
+	chartMarginB = 90
+)
+
+// chartSeries is one named line or set of bars.
+type chartSeries struct {
+	Name   string
+	Points []chartPoint
+}
+
+// chartPoint is a value at an x label, which is a date for time series.
+type chartPoint struct {
+	X string
+	Y float64
+}
+
+// chartRefLine is a horizontal line such as a reference range limit.
+type chartRefLine struct {
+	Label string
+	Y     float64
+}
+
+// chartSpec describes a chart to render.
+type chartSpec struct {
+	Kind     string // line or bar
+	Title    string
+	YLabel   string
+	Series   []chartSeries
+	RefLines []chartRefLine
+}
+
+// chartColor is a series color and the name used for it in captions.
+type chartColor struct {
+	name string
+	c    color.RGBA
+}
+
+var chartPalette = []chartColor{
+	{"blue", color.RGBA{31, 119, 180, 255}},
+	{"orange", color.RGBA{255, 127, 14, 255}},
+	{"green", color.RGBA{44, 160, 44, 255}},
+	{"red", color.RGBA{214, 39, 40, 255}},
+	{"purple", color.RGBA{148, 103, 189, 255}},
+	{"brown", color.RGBA{140, 86, 75, 255}},
+}
+
+var (
+	chartInk  = color.RGBA{40, 40, 40, 255}
+	chartGrid = color.RGBA{225, 225, 225, 255}
+	chartRef  = color.RGBA{200, 60, 60, 255}
+)
+
+// chartFont is a 5x7 bitmap font, one byte per column with the top row in
+// the lowest bit. Lowercase letters are drawn as capitals; text with other
+// characters, such as Chinese, is left out of the image and belongs in the
+// caption.
+var chartFont = map[rune][5]byte{
+	' ': {0x00, 0x00, 0x00, 0x00, 0x00}, '.': {0x00, 0x60, 0x60, 0x00, 0x00},
+	'-': {0x08, 0x08, 0x08, 0x08, 0x08}, ':': {0x00, 0x36, 0x36, 0x00, 0x00},
+	'/': {0x20, 0x10, 0x08, 0x04, 0x02}, '%': {0x23, 0x13, 0x08, 0x64, 0x62},
+	'(': {0x00, 0x1C, 0x22, 0x41, 0x00}, ')': {0x00, 0x41, 0x22, 0x1C, 0x00},
+	'+': {0x08, 0x08, 0x3E, 0x08, 0x08}, ',': {0x00, 0x50, 0x30, 0x00, 0x00},
+	'_': {0x40, 0x40, 0x40, 0x40, 0x40}, '<': {0x08, 0x14, 0x22, 0x41, 0x00},
+	'>': {0x00, 0x41, 0x22, 0x14, 0x08}, '=': {0x14, 0x14, 0x14, 0x14, 0x14},
+	'^': {0x04, 0x02, 0x01, 0x02, 0x04}, '?': {0x02, 0x01, 0x51, 0x09, 0x06},
+	'0': {0x3E, 0x51, 0x49, 0x45, 0x3E}, '1': {0x00, 0x42, 0x7F, 0x40, 0x00},
+	'2': {0x42, 0x61, 0x51, 0x49, 0x46}, '3': {0x21, 0x41, 0x45, 0x4B, 0x31},
+	'4': {0x18, 0x14, 0x12, 0x7F, 0x10}, '5': {0x27, 0x45, 0x45, 0x45, 0x39},
+	'6': {0x3C, 0x4A, 0x49, 0x49, 0x30}, '7': {0x01, 0x71, 0x09, 0x05, 0x03},
+	'8': {0x36, 0x49, 0x49, 0x49, 0x36}, '9': {0x06, 0x49, 0x49, 0x29, 0x1E},
+	'A': {0x7E, 0x11, 0x11, 0x11, 0x7E}, 'B': {0x7F, 0x49, 0x49, 0x49, 0x36},
+	'C': {0x3E, 0x41, 0x41, 0x41, 0x22}, 'D': {0x7F, 0x41, 0x41, 0x22, 0x1C},
+	'E': {0x7F, 0x49, 0x49, 0x49, 0x41}, 'F': {0x7F, 0x09, 0x09, 0x09, 0x01},
+	'G': {0x3E, 0x41, 0x49, 0x49, 0x7A}, 'H': {0x7F, 0x08, 0x08, 0x08, 0x7F},
+	'I': {0x00, 0x41, 0x7F, 0x41, 0x00}, 'J': {0x20, 0x40, 0x41, 0x3F, 0x01},
+	'K': {0x7F, 0x08, 0x14, 0x22, 0x41}, 'L': {0x7F, 0x40, 0x40, 0x40, 0x40},
+	'M': {0x7F, 0x02, 0x0C, 0x02, 0x7F}, 'N': {0x7F, 0x04, 0x08, 0x10, 0x7F},
+	'O': {0x3E, 0x41, 0x41, 0x41, 0x3E}, 'P': {0x7F, 0x09, 0x09, 0x09, 0x06},
+	'Q': {0x3E, 0x41, 0x51, 0x21, 0x5E}, 'R': {0x7F, 0x09, 0x19, 0x29, 0x46},
+	'S': {0x46, 0x49, 0x49, 0x49, 0x31}, 'T': {0x01, 0x01, 0x7F, 0x01, 0x01},
+	'U': {0x3F, 0x40, 0x40, 0x40, 0x3F}, 'V': {0x1F, 0x20, 0x40, 0x20, 0x1F},
+	'W': {0x3F, 0x40, 0x38, 0x40, 0x3F}, 'X': {0x63, 0x14, 0x08, 0x14, 0x63},
+	'Y': {0x07, 0x08, 0x70, 0x08, 0x07}, 'Z': {0x61, 0x51, 0x49, 0x45, 0x43},
+}
+
+// chartDrawable reports whether the font can draw every character of s.
+func chartDrawable(s string) bool {
+	for _, r := range strings.ToUpper(s) {
+		if _, ok := chartFont[r]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func chartTextWidth(s string) int {
+	return len([]rune(s)) * 6 * chartScale
+}
+
+// drawChartText draws s with its top-left corner at x, y, if it can.
+func drawChartText(img *image.RGBA, x, y int, s string, c color.Color) {
+	if !chartDrawable(s) {
+		return
+	}
+	for _, r := range strings.ToUpper(s) {
+		glyph := chartFont[r]
+		for col := 0; col < 5; col++ {
+			for row := 0; row < 7; row++ {
+				if glyph[col]>>row&1 == 1 {
+					fillRect(img, x+col*chartScale, y+row*chartScale, chartScale, chartScale, c)
+				}
+			}
+		}
+		x += 6 * chartScale
+	}
+}
+
+func fillRect(img *image.RGBA, x, y, w, h int, c color.Color) {
+	draw.Draw(img, image.Rect(x, y, x+w, y+h), &image.Uniform{c}, image.Point{}, draw.Src)
+}
+
+// drawChartLine draws a line of the given width between two points.
+func drawChartLine(img *image.RGBA, x0, y0, x1, y1, width int, c color.Color) {
+	dx, dy := abs(x1-x0), -abs(y1-y0)
+	sx, sy := 1, 1
+	if x0 > x1 {
+		sx = -1
+	}
+	if y0 > y1 {
+		sy = -1
+	}
+	e := dx + dy
+	for {
+		fillRect(img, x0-width/2, y0-width/2, width, width, c)
+		if x0 == x1 && y0 == y1 {
+			return
+		}
+		if e2 := 2 * e; e2 >= dy {
+			e += dy
+			x0 += sx
+		} else {
+			e += dx
+			y0 += sy
+		}
+	}
+}
+
+// drawDashedLine draws a horizontal dashed line.
+func drawDashedLine(img *image.RGBA, x0, x1, y int, c color.Color) {
+	for x := x0; x < x1; x += 12 {
+		fillRect(img, x, y-1, min(7, x1-x), 2, c)
+	}
+}
+
+func fillCircle(img *image.RGBA, cx, cy, r int, c color.Color) {
+	for y := -r; y <= r; y++ {
+		for x := -r; x <= r; x++ {
+			if x*x+y*y <= r*r {
+				img.Set(cx+x, cy+y, c)
+			}
+		}
+	}
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// chartTicks returns a rounded axis range covering lo..hi and the step
+// between about n ticks.
+func chartTicks(lo, hi float64, n int) (float64, float64, float64) {
+	if hi == lo {
+		pad := math.Abs(lo) * 0.1
+		if pad == 0 {
+			pad = 1
+		}
+		lo, hi = lo-pad, hi+pad
+	}
+	step := niceNumber((hi - lo) / float64(n-1))
+	return roundToStep(math.Floor(lo/step)*step, step), roundToStep(math.Ceil(hi/step)*step, step), step
+}
+
+// roundToStep drops the floating-point noise of multiplying by a decimal
+// step, so that 17 x 0.2 is 3.4.
+func roundToStep(v, step float64) float64 {
+	p := 1.0
+	if step < 1 {
+		p = math.Pow(10, math.Ceil(-math.Log10(step)))
+	}
+	return math.Round(v*p) / p
+}
+
+// niceNumber rounds v to 1, 2 or 5 times a power of ten.
+func niceNumber(v float64) float64 {
+	exp := math.Floor(math.Log10(v))
+	f := v / math.Pow(10, exp)
+	switch {
+	case f <= 1:
+		f = 1
+	case f <= 2:
+		f = 2
+	case f <= 5:
+		f = 5
+	default:
+		f = 10
+	}
+	return f * math.Pow(10, exp)
+}
+
+func formatTick(v, step float64) string {
+	decimals := 0
+	if step < 1 {
+		decimals = int(math.Ceil(-math.Log10(step)))
+	}
+	s := strconv.FormatFloat(v, 'f', decimals, 64)
+	if s == "-0" {
+		s = "0"
+	}
+	return s
+}
+
+// chartDates returns the points' x labels as dates when every one is a date.
+func chartDates(spec chartSpec) (map[string]time.Time, bool) {
+	dates := make(map[string]time.Time)
+	for _, s := range spec.Series {
+		for _, p := range s.Points {
+			d, ok := parseCellDate(p.X)
+			if !ok {
+				return nil, false
+			}
+			dates[p.X] = d
+		}
+	}
+	return dates, len(dates) > 0
+}
+
+// renderChart draws spec as an image.
+func renderChart(spec chartSpec) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, chartWidth, chartHeight))
+	draw.Draw(img, img.Bounds(), &image.Uniform{color.White}, image.Point{}, draw.Src)
+	left, right := chartMarginL, chartWidth-chartMarginR
+	top, bottom := chartMarginT, chartHeight-chartMarginB
+
+	if chartDrawable(spec.Title) {
+		drawChartText(img, (chartWidth-chartTextWidth(spec.Title))/2, 18, spec.Title, chartInk)
+	}
+	if chartDrawable(spec.YLabel) {
+		drawChartText(img, 10, top-28, spec.YLabel, chartInk)
+	}
+
+	// Y axis over every value and reference line; bars start at zero.
+	lo, hi := math.Inf(1), math.Inf(-1)
+	for _, s := range spec.Series {
+		for _, p := range s.Points {
+			lo, hi = math.Min(lo, p.Y), math.Max(hi, p.Y)
+		}
+	}
+	for _, r := range spec.RefLines {
+		lo, hi = math.Min(lo, r.Y), math.Max(hi, r.Y)
+	}
+	if spec.Kind == "bar" {
+		lo, hi = math.Min(lo, 0), math.Max(hi, 0)
+	}
+	yMin, yMax, step := chartTicks(lo, hi, 6)
+	yPos := func(v float64) int {
+		return bottom - int(math.Round((v-yMin)/(yMax-yMin)*float64(bottom-top)))
+	}
+	for i := 0; yMin+float64(i)*step <= yMax+step/2; i++ {
+		v := roundToStep(yMin+float64(i)*step, step)
+		y := yPos(v)
+		drawChartLine(img, left, y, right, y, 1, chartGrid)
+		label := formatTick(v, step)
+		drawChartText(img, left-10-chartTextWidth(label), y-7, label, chartInk)
+	}
+
+	// X positions: proportional to time for dates, else evenly spaced.
+	var categories []string
+	seen := make(map[string]bool)
+	for _, s := range spec.Series {
+		for _, p := range s.Points {
+			if !seen[p.X] {
+				seen[p.X] = true
+				categories = append(categories, p.X)
+			}
+		}
+	}
+	dates, timeAxis := chartDates(spec)
+	timeAxis = timeAxis && spec.Kind == "line"
+	plotW := right - left
+	slot := float64(plotW) / float64(max(len(categories), 1))
+	xPos := func(x string) int {
+		if timeAxis {
+			first, last := dates[categories[0]], dates[categories[0]]
+			for _, d := range dates {
+				if d.Before(first) {
+					first = d
+				}
+				if d.After(last) {
+					last = d
+				}
+			}
+			if !last.After(first) {
+				return left + plotW/2
+			}
+			pad := 20
+			return left + pad + int(float64(plotW-2*pad)*dates[x].Sub(first).Hours()/last.Sub(first).Hours())
+		}
+		return left + int(slot*(float64(indexOf(categories, x))+0.5))
+	}
+	if timeAxis {
+		// Sort the labels by date so the axis reads left to right.
+		for i := 1; i < len(categories); i++ {
+			for j := i; j > 0 && dates[categories[j]].Before(dates[categories[j-1]]); j-- {
+				categories[j], categories[j-1] = categories[j-1], categories[j]
+			}
+		}
+	}
+
+	// X labels, thinned so they do not overlap.
+	labels := make([]string, len(categories))
+	sameYear := timeAxis
+	for _, c := range categories {
+		if timeAxis && dates[c].Year() != dates[categories[0]].Year() {
+			sameYear = false
+		}
+	}
+	widest := 0
+	for i, c := range categories {
+		labels[i] = c
+		if timeAxis {
+			labels[i] = dates[c].Format("2006-01-02")
+			if sameYear {
+				labels[i] = dates[c].Format("01-02")
+			}
+		}
+		widest = max(widest, chartTextWidth(labels[i]))
+	}
+	every := 1
+	for every < len(labels) && float64(widest+16) > float64(plotW)/float64(len(labels))*float64(every) {
+		every++
+	}
+	lastX := -1 << 30
+	for i, c := range categories {
+		x := xPos(c)
+		if i%every != 0 || x-widest/2 < lastX {
+			continue
+		}
+		drawChartLine(img, x, bottom, x, bottom+5, 1, chartInk)
+		drawChartText(img, x-chartTextWidth(labels[i])/2, bottom+12, labels[i], chartInk)
+		lastX = x + widest/2 + 8
+	}
+	if sameYear && len(categories) > 0 {
+		year := dates[categories[0]].Format("2006")
+		drawChartText(img, right-chartTextWidth(year), bottom+36, year, chartInk)
+	}
+
+	// Reference lines, labelled at the right end.
+	for _, r := range spec.RefLines {
+		y := yPos(r.Y)
+		drawDashedLine(img, left, right, y, chartRef)
+		if r.Label != "" {
+			drawChartText(img, right-chartTextWidth(r.Label), y-18, r.Label, chartRef)
+		}
+	}
+
+	// Data.
+	for si, s := range spec.Series {
+		c := chartPalette[si%len(chartPalette)].c
+		if spec.Kind == "bar" {
+			groupW := slot * 0.8
+			barW := groupW / float64(len(spec.Series))
+			zero := yPos(math.Max(yMin, 0))
+			for _, p := range s.Points {
+				x := xPos(p.X) - int(groupW/2) + int(barW*float64(si))
+				y := yPos(p.Y)
+				fillRect(img, x+1, min(y, zero), max(int(barW)-2, 1), abs(zero-y), c)
+			}
+			continue
+		}
+		points := append([]chartPoint(nil), s.Points...)
+		if timeAxis {
+			for i := 1; i < len(points); i++ {
+				for j := i; j > 0 && dates[points[j].X].Before(dates[points[j-1].X]); j-- {
+					points[j], points[j-1] = points[j-1], points[j]
+				}
+			}
+		}
+		for i, p := range points {
+			x, y := xPos(p.X), yPos(p.Y)
+			if i > 0 {
+				drawChartLine(img, xPos(points[i-1].X), yPos(points[i-1].Y), x, y, 3, c)
+			}
+			fillCircle(img, x, y, 5, c)
+		}
+	}
+
+	// Axes.
+	drawChartLine(img, left, top, left, bottom, 2, chartInk)
+	drawChartLine(img, left, bottom, right, bottom, 2, chartInk)
+
+	// Legend along the bottom, for several series.
+	if len(spec.Series) > 1 {
+		x := left
+		for si, s := range spec.Series {
+			c := chartPalette[si%len(chartPalette)].c
+			fillRect(img, x, chartHeight-26, 14, 14, c)
+			name := s.Name
+			if !chartDrawable(name) {
+				name = ""
+			}
+			drawChartText(img, x+20, chartHeight-26, name, chartInk)
+			x += 20 + chartTextWidth(name) + 24
+		}
+	}
+	return img
+}
@@ -0,0 +1,163 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func chartTestTool(t *testing.T) (*MakeChartTool, string) {
+	t.Helper()
+	workspace := t.TempDir()
+	tool := NewMakeChartTool(workspace, true)
+	now := time.Date(2026, 4, 10, 9, 0, 0, 0, time.UTC)
+	tool.now = func() time.Time { return now }
+	tool.diary.now = tool.now
+	return tool, workspace
+}
+
+// chartImage returns the image a result sends and how many of its pixels
+// have the color c.
+func chartImage(t *testing.T, result *ToolResult, c [3]uint8) (ContentBlock, int) {
+	t.Helper()
+	if result.IsError {
+		t.Fatalf("make_chart: %s", result.ForLLM)
+	}
+	if len(result.Content) != 1 || result.Content[0].Type != ContentImage || !result.ContentForUser {
+		t.Fatalf("content = %+v", result.Content)
+	}
+	block := result.Content[0]
+	f, err := os.Open(block.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	img, err := png.Decode(f)
+	if err != nil {
+		t.Fatalf("invalid PNG: %v", err)
+	}
+	if b := img.Bounds(); b.Dx() != chartWidth || b.Dy() != chartHeight {
+		t.Fatalf("size = %v", b)
+	}
+	n := 0
+	for y := 0; y < chartHeight; y++ {
+		for x := 0; x < chartWidth; x++ {
+			r, g, b, _ := img.At(x, y).RGBA()
+			if uint8(r>>8) == c[0] && uint8(g>>8) == c[1] && uint8(b>>8) == c[2] {
+				n++
+			}
+		}
+	}
+	return block, n
+}
+
+func TestMakeChart_Data(t *testing.T) {
+	tool, workspace := chartTestTool(t)
+	result := tool.Execute(context.Background(), map[string]interface{}{
+		"title":   "CA19-9 趋势",
+		"y_label": "U/mL",
+		"series": []interface{}{map[string]interface{}{
+			"name": "CA19-9",
+			"points": []interface{}{
+				map[string]interface{}{"x": "2026-01-05", "y": 1250.6},
+				map[string]interface{}{"x": "2026-02-02", "y": 820},
+				map[string]interface{}{"x": "2026-03-02", "y": 410.5},
+			},
+		}},
+		"reference_lines": []interface{}{map[string]interface{}{"label": "ULN", "value": 37}},
+	})
+	block, blue := chartImage(t, result, [3]uint8{31, 119, 180})
+	if blue < 200 {
+		t.Errorf("only %d pixels of the series color", blue)
+	}
+	if block.MimeType != "image/png" || block.Caption != "CA19-9 趋势" || filepath.Dir(block.Path) != filepath.Join(workspace, "charts") {
+		t.Errorf("image = %+v", block)
+	}
+	if !strings.Contains(result.ForLLM, `"points":3`) {
+		t.Errorf("ForLLM = %s", result.ForLLM)
+	}
+}
+
+func TestMakeChart_SpreadsheetBars(t *testing.T) {
+	tool, workspace := chartTestTool(t)
+	os.WriteFile(filepath.Join(workspace, "labs.csv"), []byte(labCSV), 0644)
+	result := tool.Execute(context.Background(), map[string]interface{}{
+		"type":      "bar",
+		"source":    "spreadsheet",
+		"path":      "labs.csv",
+		"y_columns": []interface{}{"CEA", "`CA19-9`"},
+		"filter":    "CEA < 3.2",
+	})
+	block, orange := chartImage(t, result, [3]uint8{255, 127, 14})
+	if orange < 1000 {
+		t.Errorf("only %d pixels of the second series' bars", orange)
+	}
+	if block.Caption != "" || !strings.Contains(result.ForLLM, `"points":6`) {
+		t.Errorf("caption %q, ForLLM %s", block.Caption, result.ForLLM)
+	}
+}
+
+func TestMakeChart_Diary(t *testing.T) {
+	tool, _ := chartTestTool(t)
+	ctx := asUser("telegram:42")
+	path, _ := tool.diary.path(ctx)
+	for i, pain := range []int{6, 4, 3} {
+		pain := pain
+		tool.diary.append(path, DiaryEntry{
+			Date:      time.Date(2026, 4, 1+i*3, 0, 0, 0, 0, time.UTC).Format("2006-01-02"),
+			PainScore: &pain,
+			Symptoms:  []DiarySymptom{{Name: "恶心", Severity: 5 - i}},
+		})
+	}
+	result := tool.Execute(ctx, map[string]interface{}{"source": "diary", "metrics": []interface{}{"pain", "恶心"}})
+	block, _ := chartImage(t, result, [3]uint8{31, 119, 180})
+	if block.Caption != "blue: Pain, orange: 恶心" || !strings.Contains(result.ForLLM, `"points":6`) {
+		t.Errorf("caption %q, ForLLM %s", block.Caption, result.ForLLM)
+	}
+}
+
+func TestMakeChart_Errors(t *testing.T) {
+	tool, workspace := chartTestTool(t)
+	os.WriteFile(filepath.Join(workspace, "labs.csv"), []byte(labCSV), 0644)
+	tests := []struct {
+		name string
+		args map[string]interface{}
+		text string
+	}{
+		{"no data", map[string]interface{}{}, "no values to plot"},
+		{"unknown column", map[string]interface{}{"source": "spreadsheet", "path": "labs.csv", "y_columns": []interface{}{"CA125"}}, "unknown column \"CA125\""},
+		{"outside workspace", map[string]interface{}{"source": "spreadsheet", "path": "../labs.csv", "y_columns": []interface{}{"CEA"}}, "access denied"},
+		{"bad type", map[string]interface{}{"type": "pie"}, "type"},
+		{"bad date", map[string]interface{}{"source": "diary", "from": "April"}, "must be YYYY-MM-DD"},
+	}
+	for _, tt := range tests {
+		ctx := asUser("telegram:42")
+		result := tool.Execute(ctx, tt.args)
+		if !result.IsError || !errors.Is(result.Err, ErrInvalidArgs) || !strings.Contains(result.ForLLM, tt.text) {
+			t.Errorf("%s: %+v", tt.name, result)
+		}
+	}
+}
+
+func TestChartTicks(t *testing.T) {
+	tests := []struct {
+		lo, hi         float64
+		min, max, step float64
+	}{
+		{410.5, 1250.6, 400, 1400, 200},
+		{0, 10, 0, 10, 2},
+		{37, 37, 32, 42, 2},
+		{2.7, 3.4, 2.6, 3.4, 0.2},
+	}
+	for _, tt := range tests {
+		min, max, step := chartTicks(tt.lo, tt.hi, 6)
+		if min != tt.min || max != tt.max || step != tt.step {
+			t.Errorf("chartTicks(%v, %v) = %v, %v, %v", tt.lo, tt.hi, min, max, step)
+		}
+	}
+}
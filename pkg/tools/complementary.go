@@ -0,0 +1,281 @@
+package tools
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// builtinTherapiesJSON is the curated dataset shipped with picoclaw.
+//
+//go:embed data/complementary_therapies.json
+var builtinTherapiesJSON []byte
+
+// TherapyEntry is one traditional or complementary therapy in the dataset.
+type TherapyEntry struct {
+	Name         string               `json:"name"`
+	NameZH       string               `json:"name_zh,omitempty"`
+	Aliases      []string             `json:"aliases,omitempty"`
+	Category     string               `json:"category,omitempty"` // herb, supplement, food, TCM formula or practice
+	Summary      string               `json:"summary"`
+	Interactions []TherapyInteraction `json:"interactions"`
+	Safety       []string             `json:"safety,omitempty"`
+	Evidence     string               `json:"evidence,omitempty"`
+}
+
+// TherapyInteraction is a known interaction with drugs or drug classes.
+type TherapyInteraction struct {
+	Drugs     []string `json:"drugs"`
+	Severity  string   `json:"severity"` // avoid, caution or monitor
+	Effect    string   `json:"effect"`
+	Mechanism string   `json:"mechanism,omitempty"`
+}
+
+// ComplementaryTherapyTool answers questions about herbs, supplements and
+// TCM preparations from a curated dataset, so interaction and safety
+// advice is never improvised.
+type ComplementaryTherapyTool struct {
+	builtin     []TherapyEntry
+	datasetPath string
+
+	mu      sync.Mutex
+	entries []TherapyEntry
+	loaded  time.Time // modification time of the loaded dataset
+}
+
+// NewComplementaryTherapyTool returns the tool over the built-in dataset
+// and, when datasetPath is set, the entries of that JSON file, which
+// replace built-in entries of the same name.
+func NewComplementaryTherapyTool(datasetPath string) (*ComplementaryTherapyTool, error) {
+	var builtin []TherapyEntry
+	if err := json.Unmarshal(builtinTherapiesJSON, &builtin); err != nil {
+		return nil, fmt.Errorf("invalid built-in therapy dataset: %w", err)
+	}
+	return &ComplementaryTherapyTool{builtin: builtin, datasetPath: datasetPath}, nil
+}
+
+func (t *ComplementaryTherapyTool) Name() string {
+	return "complementary_therapy"
+}
+
+func (t *ComplementaryTherapyTool) Description() string {
+	return "Look up a traditional Chinese medicine, herb, supplement or complementary therapy (e.g. 灵芝, ginseng, turmeric, 华蟾素, acupuncture) in a curated safety dataset: " +
+		"known interactions with chemotherapy and other drugs, safety cautions and the state of the evidence. " +
+		"Pass the user's current medications to check them. Only state interactions this tool returns; if a therapy is not in the dataset, say so instead of guessing."
+}
+
+func (t *ComplementaryTherapyTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"therapy": map[string]interface{}{
+				"type":        "string",
+				"description": "Name in Chinese or English, e.g. 灵芝孢子粉 or St John's wort",
+			},
+			"medications": map[string]interface{}{
+				"type":        "array",
+				"items":       map[string]interface{}{"type": "string"},
+				"description": "The user's current medications, generic names preferred, e.g. gemcitabine, nab-paclitaxel, warfarin",
+			},
+		},
+		"required": []string{"therapy"},
+	}
+}
+
+type complementaryTherapyArgs struct {
+	Therapy     string   `json:"therapy" arg:"required"`
+	Medications []string `json:"medications"`
+}
+
+func (t *ComplementaryTherapyTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	a, err := BindArgs[complementaryTherapyArgs](args)
+	if err != nil {
+		return ErrorResult(err.Error()).WithError(err)
+	}
+	entries, err := t.dataset()
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("therapy dataset unavailable: %v", err)).WithError(err)
+	}
+
+	matches := matchTherapies(entries, a.Therapy)
+	if len(matches) == 0 {
+		names := make([]string, len(entries))
+		for i, e := range entries {
+			names[i] = e.Name
+		}
+		sort.Strings(names)
+		return ErrorResult(fmt.Sprintf("%q is not in the curated dataset, so its safety and interactions are unknown here. "+
+			"Do not guess; tell the user to show the product to their oncologist or pharmacist before taking it. Covered: %s",
+			a.Therapy, strings.Join(names, ", "))).
+			WithError(ClassifyError(ErrNotFound, fmt.Errorf("no therapy entry for %q", a.Therapy)))
+	}
+
+	results := make([]map[string]interface{}, len(matches))
+	for i, e := range matches {
+		results[i] = describeTherapy(e, a.Medications)
+	}
+	payload, _ := json.Marshal(map[string]interface{}{
+		"query":   a.Therapy,
+		"results": results,
+		"note": "From a curated dataset; the absence of a listed interaction is not proof of safety. " +
+			"Patients should tell their oncologist about every herb and supplement they take.",
+	})
+	return NewToolResult(string(payload))
+}
+
+// dataset returns the built-in entries merged with the dataset file,
+// reloading the file when it has changed.
+func (t *ComplementaryTherapyTool) dataset() ([]TherapyEntry, error) {
+	if t.datasetPath == "" {
+		return t.builtin, nil
+	}
+	info, err := os.Stat(t.datasetPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return t.builtin, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.entries != nil && info.ModTime().Equal(t.loaded) {
+		return t.entries, nil
+	}
+	data, err := os.ReadFile(t.datasetPath)
+	if err != nil {
+		return nil, err
+	}
+	var custom []TherapyEntry
+	if err := json.Unmarshal(data, &custom); err != nil {
+		return nil, fmt.Errorf("invalid dataset %s: %w", t.datasetPath, err)
+	}
+	merged := append([]TherapyEntry(nil), t.builtin...)
+	for _, c := range custom {
+		replaced := false
+		for i := range merged {
+			if strings.EqualFold(merged[i].Name, c.Name) {
+				merged[i], replaced = c, true
+				break
+			}
+		}
+		if !replaced && c.Name != "" {
+			merged = append(merged, c)
+		}
+	}
+	t.entries, t.loaded = merged, info.ModTime()
+	return merged, nil
+}
+
+// matchTherapies returns the entries named therapy exactly, or else those
+// whose names contain it or are contained in it, so "灵芝孢子粉胶囊" finds
+// 灵芝孢子粉.
+func matchTherapies(entries []TherapyEntry, therapy string) []TherapyEntry {
+	query := normalizeDrugName(therapy)
+	if query == "" {
+		return nil
+	}
+	var exact, partial []TherapyEntry
+	for _, e := range entries {
+		best := 0
+		for _, name := range append([]string{e.Name, e.NameZH}, e.Aliases...) {
+			name = normalizeDrugName(name)
+			switch {
+			case name == "":
+			case name == query:
+				best = 2
+			case best == 0 && len([]rune(name)) >= 2 && (strings.Contains(name, query) || strings.Contains(query, name)):
+				best = 1
+			}
+		}
+		switch best {
+		case 2:
+			exact = append(exact, e)
+		case 1:
+			partial = append(partial, e)
+		}
+	}
+	if len(exact) > 0 {
+		return exact
+	}
+	return partial
+}
+
+// describeTherapy returns an entry with the interactions that concern the
+// user's medications listed first.
+func describeTherapy(e TherapyEntry, medications []string) map[string]interface{} {
+	out := map[string]interface{}{
+		"name":    e.Name,
+		"summary": e.Summary,
+	}
+	if e.NameZH != "" {
+		out["name_zh"] = e.NameZH
+	}
+	if e.Category != "" {
+		out["category"] = e.Category
+	}
+	if len(e.Safety) > 0 {
+		out["safety"] = e.Safety
+	}
+	if e.Evidence != "" {
+		out["evidence"] = e.Evidence
+	}
+	if len(medications) == 0 {
+		out["interactions"] = e.Interactions
+		return out
+	}
+
+	var relevant, other []TherapyInteraction
+	var unchecked []string
+	matched := make(map[string]bool)
+	for _, in := range e.Interactions {
+		hit := false
+		for _, med := range medications {
+			if interactionConcerns(in, med) {
+				hit, matched[med] = true, true
+			}
+		}
+		if hit {
+			relevant = append(relevant, in)
+		} else {
+			other = append(other, in)
+		}
+	}
+	for _, med := range medications {
+		if !matched[med] {
+			unchecked = append(unchecked, med)
+		}
+	}
+	out["interactions_with_your_medications"] = relevant
+	if relevant == nil {
+		out["interactions_with_your_medications"] = []TherapyInteraction{}
+	}
+	if len(other) > 0 {
+		out["other_interactions"] = other
+	}
+	if len(unchecked) > 0 {
+		out["no_interaction_data"] = unchecked
+	}
+	return out
+}
+
+// interactionConcerns reports whether an interaction lists medication.
+func interactionConcerns(in TherapyInteraction, medication string) bool {
+	med := normalizeDrugName(medication)
+	if med == "" {
+		return false
+	}
+	for _, drug := range in.Drugs {
+		d := normalizeDrugName(drug)
+		if d == med || strings.Contains(med, d) && len(d) >= 4 {
+			return true
+		}
+	}
+	return false
+}
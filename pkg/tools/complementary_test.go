@@ -0,0 +1,106 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBuiltinTherapyDataset(t *testing.T) {
+	tool, err := NewComplementaryTherapyTool("")
+	if err != nil {
+		t.Fatalf("NewComplementaryTherapyTool() error: %v", err)
+	}
+	severities := []string{"avoid", "caution", "monitor"}
+	seen := make(map[string]bool)
+	for _, e := range tool.builtin {
+		if e.Name == "" || e.Summary == "" || e.Evidence == "" {
+			t.Errorf("entry %q lacks a name, summary or evidence", e.Name)
+		}
+		for _, name := range append([]string{e.Name, e.NameZH}, e.Aliases...) {
+			key := normalizeDrugName(name)
+			if seen[key] {
+				t.Errorf("name %q appears in more than one entry", name)
+			}
+			seen[key] = true
+		}
+		for _, in := range e.Interactions {
+			if len(in.Drugs) == 0 || in.Effect == "" || indexOf(severities, in.Severity) < 0 {
+				t.Errorf("%s: incomplete interaction %+v", e.Name, in)
+			}
+		}
+	}
+}
+
+func TestMatchTherapies(t *testing.T) {
+	tool, _ := NewComplementaryTherapyTool("")
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"灵芝孢子粉", "Reishi mushroom"},
+		{"破壁灵芝孢子粉胶囊", "Reishi mushroom"},
+		{"St John's wort", "St John's wort"},
+		{"curcumin", "Turmeric"},
+		{"华蟾素片", "Cinobufacini"},
+		{"关木通", "Aristolochic acid herbs"},
+		{"unicorn horn", ""},
+	}
+	for _, tt := range tests {
+		matches := matchTherapies(tool.builtin, tt.query)
+		got := ""
+		if len(matches) > 0 {
+			got = matches[0].Name
+		}
+		if got != tt.want {
+			t.Errorf("matchTherapies(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestComplementaryTherapyTool(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "therapies.json")
+	os.WriteFile(path, []byte(`[{"name":"Sea buckthorn","name_zh":"沙棘","summary":"Berry oil.","interactions":[],"evidence":"None."}]`), 0644)
+	tool, err := NewComplementaryTherapyTool(path)
+	if err != nil {
+		t.Fatalf("NewComplementaryTherapyTool() error: %v", err)
+	}
+
+	result := tool.Execute(context.Background(), map[string]interface{}{
+		"therapy":     "贯叶连翘",
+		"medications": []interface{}{"Liposomal irinotecan", "creon"},
+	})
+	if result.IsError {
+		t.Fatalf("complementary_therapy: %s", result.ForLLM)
+	}
+	var out struct {
+		Results []struct {
+			Name     string               `json:"name"`
+			Relevant []TherapyInteraction `json:"interactions_with_your_medications"`
+			Other    []TherapyInteraction `json:"other_interactions"`
+			NoData   []string             `json:"no_interaction_data"`
+		} `json:"results"`
+	}
+	if err := json.Unmarshal([]byte(result.ForLLM), &out); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	r := out.Results[0]
+	if r.Name != "St John's wort" || len(r.Relevant) != 1 || r.Relevant[0].Severity != "avoid" || len(r.Other) != 3 {
+		t.Errorf("result = %s", result.ForLLM)
+	}
+	if len(r.NoData) != 1 || r.NoData[0] != "creon" {
+		t.Errorf("no_interaction_data = %v", r.NoData)
+	}
+
+	if result := tool.Execute(context.Background(), map[string]interface{}{"therapy": "沙棘"}); result.IsError {
+		t.Errorf("entry from the dataset file: %s", result.ForLLM)
+	}
+	result = tool.Execute(context.Background(), map[string]interface{}{"therapy": "冬虫夏草"})
+	if !result.IsError || !errors.Is(result.Err, ErrNotFound) || !strings.Contains(result.ForLLM, "Do not guess") {
+		t.Errorf("unknown therapy: %+v", result)
+	}
+}
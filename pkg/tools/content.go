@@ -0,0 +1,285 @@
+package tools
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// ContentBlockType identifies the kind of a ContentBlock.
+type ContentBlockType string
+
+const (
+	ContentText  ContentBlockType = "text"
+	ContentJSON  ContentBlockType = "json"
+	ContentImage ContentBlockType = "image"
+	ContentFile  ContentBlockType = "file"
+	ContentTable ContentBlockType = "table"
+)
+
+// ContentBlock is one structured piece of a tool result.
+// Only the fields relevant to Type are set.
+type ContentBlock struct {
+	Type ContentBlockType `json:"type"`
+
+	// Text holds the body of a text block.
+	Text string `json:"text,omitempty"`
+
+	// Data holds the value of a JSON block.
+	Data interface{} `json:"data,omitempty"`
+
+	// URL and Path reference an image or file; MimeType and Name describe it.
+	URL      string `json:"url,omitempty"`
+	Path     string `json:"path,omitempty"`
+	MimeType string `json:"mime_type,omitempty"`
+	Name     string `json:"name,omitempty"`
+
+	// Caption is shown alongside images, files, and tables.
+	Caption string `json:"caption,omitempty"`
+
+	// Headers and Rows hold the cells of a table block.
+	Headers []string   `json:"headers,omitempty"`
+	Rows    [][]string `json:"rows,omitempty"`
+}
+
+// TextBlock creates a text content block.
+func TextBlock(text string) ContentBlock {
+	return ContentBlock{Type: ContentText, Text: text}
+}
+
+// JSONBlock creates a JSON content block.
+func JSONBlock(data interface{}) ContentBlock {
+	return ContentBlock{Type: ContentJSON, Data: data}
+}
+
+// ImageBlock creates an image reference block.
+func ImageBlock(url, caption string) ContentBlock {
+	return ContentBlock{Type: ContentImage, URL: url, Caption: caption}
+}
+
+// FileBlock creates a file reference block. Either url or path may be empty.
+func FileBlock(name, url, path string) ContentBlock {
+	return ContentBlock{Type: ContentFile, Name: name, URL: url, Path: path}
+}
+
+// TableBlock creates a table block.
+func TableBlock(caption string, headers []string, rows [][]string) ContentBlock {
+	return ContentBlock{Type: ContentTable, Caption: caption, Headers: headers, Rows: rows}
+}
+
+// ContentRenderer flattens content blocks into text for one destination.
+type ContentRenderer func(blocks []ContentBlock) string
+
+// RenderTargetLLM is the pseudo-channel used when rendering for the model.
+const RenderTargetLLM = "llm"
+
+var (
+	contentRenderersMu sync.RWMutex
+	contentRenderers   = map[string]ContentRenderer{
+		RenderTargetLLM: RenderMarkdown,
+		"telegram":      RenderMonospace,
+		"discord":       RenderMonospace,
+		"slack":         RenderMonospace,
+		"whatsapp":      RenderPlain,
+		"line":          RenderPlain,
+		"qq":            RenderPlain,
+		"onebot":        RenderPlain,
+		"maixcam":       RenderPlain,
+	}
+)
+
+// RegisterContentRenderer sets the renderer used for a channel.
+func RegisterContentRenderer(channel string, renderer ContentRenderer) {
+	contentRenderersMu.Lock()
+	defer contentRenderersMu.Unlock()
+	contentRenderers[channel] = renderer
+}
+
+// RenderContent renders blocks for the given channel.
+// Channels without a registered renderer get Markdown.
+func RenderContent(channel string, blocks []ContentBlock) string {
+	contentRenderersMu.RLock()
+	renderer, ok := contentRenderers[channel]
+	contentRenderersMu.RUnlock()
+	if !ok {
+		renderer = RenderMarkdown
+	}
+	return renderer(blocks)
+}
+
+// RenderMarkdown renders blocks as GitHub-flavored Markdown.
+func RenderMarkdown(blocks []ContentBlock) string {
+	return renderBlocks(blocks, func(b ContentBlock) string {
+		switch b.Type {
+		case ContentJSON:
+			return "```json\n" + marshalBlockData(b.Data) + "\n```"
+		case ContentImage:
+			return fmt.Sprintf("![%s](%s)", b.Caption, blockRef(b))
+		case ContentFile:
+			return fmt.Sprintf("[%s](%s)", blockName(b), blockRef(b))
+		case ContentTable:
+			return withCaption(b.Caption, markdownTable(b.Headers, b.Rows))
+		default:
+			return b.Text
+		}
+	})
+}
+
+// RenderMonospace renders blocks for chat apps that support code fences
+// but not Markdown tables; tables become aligned text inside a fence.
+func RenderMonospace(blocks []ContentBlock) string {
+	return renderBlocks(blocks, func(b ContentBlock) string {
+		switch b.Type {
+		case ContentJSON:
+			return "```\n" + marshalBlockData(b.Data) + "\n```"
+		case ContentTable:
+			return withCaption(b.Caption, "```\n"+alignedTable(b.Headers, b.Rows)+"\n```")
+		default:
+			return renderPlainBlock(b)
+		}
+	})
+}
+
+// RenderPlain renders blocks as plain text with no markup.
+func RenderPlain(blocks []ContentBlock) string {
+	return renderBlocks(blocks, renderPlainBlock)
+}
+
+func renderPlainBlock(b ContentBlock) string {
+	switch b.Type {
+	case ContentJSON:
+		return marshalBlockData(b.Data)
+	case ContentImage:
+		if b.Caption != "" {
+			return b.Caption + ": " + blockRef(b)
+		}
+		return blockRef(b)
+	case ContentFile:
+		return blockName(b) + ": " + blockRef(b)
+	case ContentTable:
+		return withCaption(b.Caption, alignedTable(b.Headers, b.Rows))
+	default:
+		return b.Text
+	}
+}
+
+func renderBlocks(blocks []ContentBlock, render func(ContentBlock) string) string {
+	parts := make([]string, 0, len(blocks))
+	for _, b := range blocks {
+		if s := render(b); s != "" {
+			parts = append(parts, s)
+		}
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+func marshalBlockData(data interface{}) string {
+	out, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Sprintf("%v", data)
+	}
+	return string(out)
+}
+
+func blockRef(b ContentBlock) string {
+	if b.URL != "" {
+		return b.URL
+	}
+	return b.Path
+}
+
+func blockName(b ContentBlock) string {
+	if b.Name != "" {
+		return b.Name
+	}
+	return blockRef(b)
+}
+
+func withCaption(caption, body string) string {
+	if caption == "" {
+		return body
+	}
+	return caption + "\n" + body
+}
+
+func markdownTable(headers []string, rows [][]string) string {
+	cols := tableWidth(headers, rows)
+	if cols == 0 {
+		return ""
+	}
+
+	var sb strings.Builder
+	writeRow := func(cells []string) {
+		sb.WriteString("|")
+		for i := 0; i < cols; i++ {
+			cell := ""
+			if i < len(cells) {
+				cell = strings.ReplaceAll(cells[i], "|", "\\|")
+			}
+			sb.WriteString(" " + strings.ReplaceAll(cell, "\n", " ") + " |")
+		}
+		sb.WriteString("\n")
+	}
+
+	writeRow(headers)
+	sb.WriteString("|" + strings.Repeat(" --- |", cols) + "\n")
+	for _, row := range rows {
+		writeRow(row)
+	}
+	return strings.TrimRight(sb.String(), "\n")
+}
+
+func alignedTable(headers []string, rows [][]string) string {
+	cols := tableWidth(headers, rows)
+	if cols == 0 {
+		return ""
+	}
+
+	all := make([][]string, 0, len(rows)+1)
+	if len(headers) > 0 {
+		all = append(all, headers)
+	}
+	all = append(all, rows...)
+
+	widths := make([]int, cols)
+	for _, row := range all {
+		for i := 0; i < len(row) && i < cols; i++ {
+			if w := utf8.RuneCountInString(row[i]); w > widths[i] {
+				widths[i] = w
+			}
+		}
+	}
+
+	lines := make([]string, 0, len(all)+1)
+	for r, row := range all {
+		cells := make([]string, cols)
+		for i := 0; i < cols; i++ {
+			cell := ""
+			if i < len(row) {
+				cell = strings.ReplaceAll(row[i], "\n", " ")
+			}
+			cells[i] = cell + strings.Repeat(" ", widths[i]-utf8.RuneCountInString(cell))
+		}
+		lines = append(lines, strings.TrimRight(strings.Join(cells, "  "), " "))
+		if r == 0 && len(headers) > 0 {
+			seps := make([]string, cols)
+			for i, w := range widths {
+				seps[i] = strings.Repeat("-", w)
+			}
+			lines = append(lines, strings.Join(seps, "  "))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func tableWidth(headers []string, rows [][]string) int {
+	cols := len(headers)
+	for _, row := range rows {
+		if len(row) > cols {
+			cols = len(row)
+		}
+	}
+	return cols
+}
@@ -0,0 +1,53 @@
+package tools
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderMarkdown(t *testing.T) {
+	out := RenderMarkdown([]ContentBlock{
+		TextBlock("Found 1 trial"),
+		JSONBlock(map[string]interface{}{"id": "t1"}),
+		ImageBlock("https://example.com/fig1.png", "Figure 1"),
+		TableBlock("Outcomes", []string{"Arm", "OS"}, [][]string{{"A|B", "11.1"}}),
+	})
+
+	for _, want := range []string{
+		"Found 1 trial",
+		"```json\n{\"id\":\"t1\"}\n```",
+		"![Figure 1](https://example.com/fig1.png)",
+		"Outcomes\n| Arm | OS |\n| --- | --- |\n| A\\|B | 11.1 |",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("markdown output missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestRenderMonospace_AlignsTables(t *testing.T) {
+	out := RenderMonospace([]ContentBlock{
+		TableBlock("", []string{"Arm", "Median OS"}, [][]string{{"FOLFIRINOX", "11.1"}}),
+	})
+
+	want := "```\nArm         Median OS\n----------  ---------\nFOLFIRINOX  11.1\n```"
+	if out != want {
+		t.Errorf("unexpected monospace table:\n%s\nwant:\n%s", out, want)
+	}
+}
+
+func TestRenderContent_ChannelSelection(t *testing.T) {
+	blocks := []ContentBlock{ImageBlock("https://example.com/a.png", "Chart")}
+
+	if got := RenderContent("whatsapp", blocks); got != "Chart: https://example.com/a.png" {
+		t.Errorf("whatsapp render = %q", got)
+	}
+	if got := RenderContent("unknown-channel", blocks); got != "![Chart](https://example.com/a.png)" {
+		t.Errorf("default render = %q", got)
+	}
+
+	RegisterContentRenderer("test-channel", func(blocks []ContentBlock) string { return "custom" })
+	if got := RenderContent("test-channel", blocks); got != "custom" {
+		t.Errorf("custom render = %q", got)
+	}
+}
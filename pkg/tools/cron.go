@@ -3,12 +3,14 @@ package tools
 import (
 	"context"
 	"fmt"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/sipeed/picoclaw/pkg/bus"
 	"github.com/sipeed/picoclaw/pkg/config"
 	"github.com/sipeed/picoclaw/pkg/cron"
+	"github.com/sipeed/picoclaw/pkg/logger"
 	"github.com/sipeed/picoclaw/pkg/utils"
 )
 
@@ -23,9 +25,13 @@ type CronTool struct {
 	executor    JobExecutor
 	msgBus      *bus.MessageBus
 	execTool    *ExecTool
-	channel     string
-	chatID      string
-	mu          sync.RWMutex
+	// escalateAfter and caregivers control caregiver notifications for
+	// reminders that go unacknowledged.
+	escalateAfter int
+	caregivers    []config.CaregiverLink
+	channel       string
+	chatID        string
+	mu            sync.RWMutex
 }
 
 // NewCronTool creates a new CronTool
@@ -33,12 +39,17 @@ type CronTool struct {
 func NewCronTool(cronService *cron.CronService, executor JobExecutor, msgBus *bus.MessageBus, workspace string, restrict bool, execTimeout time.Duration, config *config.Config) *CronTool {
 	execTool := NewExecToolWithConfig(workspace, restrict, config)
 	execTool.SetTimeout(execTimeout)
-	return &CronTool{
+	t := &CronTool{
 		cronService: cronService,
 		executor:    executor,
 		msgBus:      msgBus,
 		execTool:    execTool,
 	}
+	if config != nil {
+		t.escalateAfter = config.Tools.Cron.EscalateAfterMisses
+		t.caregivers = config.Tools.Cron.Caregivers
+	}
+	return t
 }
 
 // Name returns the tool name
@@ -48,7 +59,7 @@ func (t *CronTool) Name() string {
 
 // Description returns the tool description
 func (t *CronTool) Description() string {
-	return "Schedule reminders, tasks, or system commands. IMPORTANT: When user asks to be reminded or scheduled, you MUST call this tool. Use 'at_seconds' for one-time reminders (e.g., 'remind me in 10 minutes' → at_seconds=600). Use 'every_seconds' ONLY for recurring tasks (e.g., 'every 2 hours' → every_seconds=7200). Use 'cron_expr' for complex recurring schedules. Use 'command' to execute shell commands directly."
+	return "Schedule reminders, tasks, or system commands. IMPORTANT: When user asks to be reminded or scheduled, you MUST call this tool. Use 'at_seconds' for one-time reminders (e.g., 'remind me in 10 minutes' → at_seconds=600). Use 'every_seconds' ONLY for recurring tasks (e.g., 'every 2 hours' → every_seconds=7200). Use 'cron_expr' for complex recurring schedules. Use 'command' to execute shell commands directly. Set 'requires_ack' for reminders the user must confirm, such as medication; when the user says they did it, call action 'ack'."
 }
 
 // Parameters returns the tool parameters schema
@@ -58,7 +69,7 @@ func (t *CronTool) Parameters() map[string]interface{} {
 		"properties": map[string]interface{}{
 			"action": map[string]interface{}{
 				"type":        "string",
-				"enum":        []string{"add", "list", "remove", "enable", "disable"},
+				"enum":        []string{"add", "list", "remove", "enable", "disable", "ack"},
 				"description": "Action to perform. Use 'add' when user wants to schedule a reminder or task.",
 			},
 			"message": map[string]interface{}{
@@ -83,7 +94,11 @@ func (t *CronTool) Parameters() map[string]interface{} {
 			},
 			"job_id": map[string]interface{}{
 				"type":        "string",
-				"description": "Job ID (for remove/enable/disable)",
+				"description": "Job ID (for remove/enable/disable/ack). For ack, defaults to the latest reminder awaiting acknowledgment in this chat.",
+			},
+			"requires_ack": map[string]interface{}{
+				"type":        "boolean",
+				"description": "If true, the user is asked to confirm the reminder (e.g. medication taken). Repeatedly unconfirmed reminders may notify a linked caregiver. Default: false",
 			},
 			"deliver": map[string]interface{}{
 				"type":        "boolean",
@@ -120,6 +135,8 @@ func (t *CronTool) Execute(ctx context.Context, args map[string]interface{}) *To
 		return t.enableJob(args, true)
 	case "disable":
 		return t.enableJob(args, false)
+	case "ack":
+		return t.ackJob(args)
 	default:
 		return ErrorResult(fmt.Sprintf("unknown action: %s", action))
 	}
@@ -199,8 +216,14 @@ func (t *CronTool) addJob(args map[string]interface{}) *ToolResult {
 		return ErrorResult(fmt.Sprintf("Error adding job: %v", err))
 	}
 
-	if command != "" {
+	requiresAck, _ := args["requires_ack"].(bool)
+	if command != "" || (requiresAck && deliver) {
 		job.Payload.Command = command
+		if command == "" {
+			job.Payload.RequiresAck = true
+			// Keep one-time reminders until they are acknowledged or missed.
+			job.DeleteAfterRun = false
+		}
 		// Need to save the updated payload
 		t.cronService.UpdateJob(job)
 	}
@@ -227,6 +250,14 @@ func (t *CronTool) listJobs() *ToolResult {
 		} else {
 			scheduleInfo = "unknown"
 		}
+		if j.Payload.RequiresAck {
+			if j.State.AckDueAtMS != nil {
+				scheduleInfo += ", awaiting acknowledgment"
+			}
+			if j.State.MissedAcks > 0 {
+				scheduleInfo += fmt.Sprintf(", %d missed in a row", j.State.MissedAcks)
+			}
+		}
 		result += fmt.Sprintf("- %s (id: %s, %s)\n", j.Name, j.ID, scheduleInfo)
 	}
 
@@ -263,6 +294,95 @@ func (t *CronTool) enableJob(args map[string]interface{}, enable bool) *ToolResu
 	return SilentResult(fmt.Sprintf("Cron job '%s' %s", job.Name, status))
 }
 
+func (t *CronTool) ackJob(args map[string]interface{}) *ToolResult {
+	t.mu.RLock()
+	channel := t.channel
+	chatID := t.chatID
+	t.mu.RUnlock()
+
+	jobID, _ := args["job_id"].(string)
+	job, err := t.cronService.Acknowledge(channel, chatID, jobID)
+	if err != nil {
+		return ErrorResult(err.Error())
+	}
+	return SilentResult(fmt.Sprintf("Reminder '%s' acknowledged", job.Name))
+}
+
+// HandleAckCommand handles "/taken [job_id]" replies to reminders. It
+// returns the reply and whether content was an acknowledgment command.
+func (t *CronTool) HandleAckCommand(channel, chatID, content string) (string, bool) {
+	parts := strings.Fields(strings.TrimSpace(content))
+	if len(parts) == 0 || parts[0] != "/taken" {
+		return "", false
+	}
+	jobID := ""
+	if len(parts) > 1 {
+		jobID = parts[1]
+	}
+	job, err := t.cronService.Acknowledge(channel, chatID, jobID)
+	if err != nil {
+		return fmt.Sprintf("Nothing to confirm: %v", err), true
+	}
+	return fmt.Sprintf("Thanks, noted: %s", job.Name), true
+}
+
+// HandleMissedAck notifies linked caregivers when a reminder has gone
+// unacknowledged EscalateAfterMisses times in a row, and again after each
+// further run of that many misses. Caregivers are only told if the patient
+// consented, and see the reminder text only with ShareDetails. It returns
+// the number of caregivers notified.
+func (t *CronTool) HandleMissedAck(job *cron.CronJob) int {
+	misses := job.State.MissedAcks
+	logger.InfoCF("cron", "Reminder not acknowledged",
+		map[string]interface{}{
+			"job_id": job.ID,
+			"misses": misses,
+		})
+	if t.escalateAfter <= 0 || misses < t.escalateAfter || misses%t.escalateAfter != 0 {
+		return 0
+	}
+
+	patient := job.Payload.Channel + ":" + job.Payload.To
+	notified := 0
+	for _, link := range t.caregivers {
+		if link.Patient != patient {
+			continue
+		}
+		if !link.Consent.MissedReminders {
+			logger.InfoCF("cron", "Caregiver not notified: no consent",
+				map[string]interface{}{
+					"job_id":    job.ID,
+					"caregiver": link.Caregiver,
+				})
+			continue
+		}
+		channel, chatID, ok := strings.Cut(link.Caregiver, ":")
+		if !ok {
+			continue
+		}
+
+		what := "a scheduled reminder"
+		if link.Consent.ShareDetails {
+			what = fmt.Sprintf("the reminder %q", job.Payload.Message)
+		}
+		t.msgBus.PublishOutbound(bus.OutboundMessage{
+			Channel: channel,
+			ChatID:  chatID,
+			Content: fmt.Sprintf("Caregiver notice: %s has not been confirmed %d times in a row. You may want to check in.", what, misses),
+		})
+		notified++
+	}
+	if notified > 0 {
+		logger.InfoCF("cron", "Caregivers notified about missed reminders",
+			map[string]interface{}{
+				"job_id":   job.ID,
+				"misses":   misses,
+				"notified": notified,
+			})
+	}
+	return notified
+}
+
 // ExecuteJob executes a cron job through the agent
 func (t *CronTool) ExecuteJob(ctx context.Context, job *cron.CronJob) string {
 	// Get channel/chatID from job payload
@@ -301,10 +421,14 @@ func (t *CronTool) ExecuteJob(ctx context.Context, job *cron.CronJob) string {
 
 	// If deliver=true, send message directly without agent processing
 	if job.Payload.Deliver {
+		content := job.Payload.Message
+		if job.Payload.RequiresAck {
+			content += "\n\nReply /taken once done."
+		}
 		t.msgBus.PublishOutbound(bus.OutboundMessage{
 			Channel: channel,
 			ChatID:  chatID,
-			Content: job.Payload.Message,
+			Content: content,
 		})
 		return "ok"
 	}
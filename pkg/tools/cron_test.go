@@ -0,0 +1,114 @@
+package tools
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/cron"
+)
+
+func newReminderTestTool(t *testing.T, links []config.CaregiverLink) (*CronTool, *bus.MessageBus) {
+	t.Helper()
+	cfg := config.DefaultConfig()
+	cfg.Tools.Cron.EscalateAfterMisses = 2
+	cfg.Tools.Cron.Caregivers = links
+	msgBus := bus.NewMessageBus()
+	service := cron.NewCronService(filepath.Join(t.TempDir(), "jobs.json"), nil)
+	tool := NewCronTool(service, nil, msgBus, t.TempDir(), true, 0, cfg)
+	tool.SetContext("telegram", "patient")
+	return tool, msgBus
+}
+
+func TestCronTool_AckReminder(t *testing.T) {
+	tool, _ := newReminderTestTool(t, nil)
+	ctx := context.Background()
+
+	result := tool.Execute(ctx, map[string]interface{}{
+		"action":        "add",
+		"message":       "Take creon with lunch",
+		"every_seconds": float64(86400),
+		"requires_ack":  true,
+	})
+	if result.IsError {
+		t.Fatalf("add failed: %s", result.ForLLM)
+	}
+	job := tool.cronService.ListJobs(false)[0]
+	if !job.Payload.RequiresAck {
+		t.Fatal("expected reminder to require acknowledgment")
+	}
+
+	if reply, handled := tool.HandleAckCommand("telegram", "patient", "/taken"); !handled || !strings.Contains(reply, "Nothing to confirm") {
+		t.Errorf("expected nothing to confirm before delivery, got %q", reply)
+	}
+
+	due := time.Now().UnixMilli() + 60000
+	job.State.AckDueAtMS = &due
+	if err := tool.cronService.UpdateJob(&job); err != nil {
+		t.Fatal(err)
+	}
+
+	if result := tool.Execute(ctx, map[string]interface{}{"action": "list"}); !strings.Contains(result.ForLLM, "awaiting acknowledgment") {
+		t.Errorf("expected list to show pending ack, got %q", result.ForLLM)
+	}
+	if reply, handled := tool.HandleAckCommand("telegram", "patient", "/taken"); !handled || !strings.Contains(reply, "Thanks") {
+		t.Errorf("unexpected ack reply %q", reply)
+	}
+	if _, handled := tool.HandleAckCommand("telegram", "patient", "taken"); handled {
+		t.Error("plain text should not be handled as a command")
+	}
+}
+
+func TestCronTool_HandleMissedAck(t *testing.T) {
+	tests := []struct {
+		name         string
+		misses       int
+		consent      config.CaregiverConsent
+		wantNotified int
+		wantDetails  bool
+	}{
+		{name: "below threshold", misses: 1, consent: config.CaregiverConsent{MissedReminders: true}},
+		{name: "at threshold", misses: 2, consent: config.CaregiverConsent{MissedReminders: true}, wantNotified: 1},
+		{name: "between repeats", misses: 3, consent: config.CaregiverConsent{MissedReminders: true}},
+		{name: "with details", misses: 4, consent: config.CaregiverConsent{MissedReminders: true, ShareDetails: true}, wantNotified: 1, wantDetails: true},
+		{name: "no consent", misses: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tool, msgBus := newReminderTestTool(t, []config.CaregiverLink{
+				{Patient: "telegram:patient", Caregiver: "telegram:daughter", Consent: tt.consent},
+				{Patient: "telegram:someone-else", Caregiver: "telegram:other", Consent: config.CaregiverConsent{MissedReminders: true}},
+			})
+			job := &cron.CronJob{
+				ID:      "job1",
+				Payload: cron.CronPayload{Message: "Take creon with lunch", Channel: "telegram", To: "patient", RequiresAck: true},
+				State:   cron.CronJobState{MissedAcks: tt.misses},
+			}
+
+			if got := tool.HandleMissedAck(job); got != tt.wantNotified {
+				t.Fatalf("HandleMissedAck() = %d, want %d", got, tt.wantNotified)
+			}
+			if tt.wantNotified == 0 {
+				return
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			msg, ok := msgBus.SubscribeOutbound(ctx)
+			if !ok {
+				t.Fatal("expected caregiver notification")
+			}
+			if msg.ChatID != "daughter" {
+				t.Errorf("notification sent to %q", msg.ChatID)
+			}
+			if got := strings.Contains(msg.Content, "creon"); got != tt.wantDetails {
+				t.Errorf("details shared = %v, want %v: %q", got, tt.wantDetails, msg.Content)
+			}
+		})
+	}
+}
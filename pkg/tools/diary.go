@@ -0,0 +1,512 @@
+package tools
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultDiaryDays = 14
+
+// sparkBars draw a value from low to high in one character.
+var sparkBars = []rune("▁▂▃▄▅▆▇█")
+
+// DiaryEntry is one diary log: anything the user reported for a day.
+type DiaryEntry struct {
+	Date         string           `json:"date"` // 2006-01-02
+	Symptoms     []DiarySymptom   `json:"symptoms,omitempty"`
+	PainScore    *int             `json:"pain_score,omitempty"` // 0-10
+	PainLocation string           `json:"pain_location,omitempty"`
+	WeightKg     float64          `json:"weight_kg,omitempty"`
+	Medications  []DiaryDoseTaken `json:"medications,omitempty"`
+	Notes        string           `json:"notes,omitempty"`
+	RecordedAt   time.Time        `json:"recorded_at"`
+}
+
+// DiarySymptom is a symptom and its severity from 0 (none) to 10 (worst).
+type DiarySymptom struct {
+	Name     string `json:"name"`
+	Severity int    `json:"severity"`
+}
+
+// DiaryDoseTaken records whether a medication was taken as prescribed.
+type DiaryDoseTaken struct {
+	Name  string `json:"name"`
+	Taken bool   `json:"taken"`
+	Note  string `json:"note,omitempty"`
+}
+
+// diaryStore keeps each user's diary as a JSON-lines file under dir, so
+// the care team can read or import it.
+type diaryStore struct {
+	dir string
+	mu  sync.Mutex
+	now func() time.Time
+}
+
+// NewDiaryTools returns diary_log and diary_summary, which keep a per-user
+// diary of symptoms, pain, weight and medication adherence under
+// <workspace>/diary.
+func NewDiaryTools(workspace string) []Tool {
+	s := &diaryStore{dir: filepath.Join(workspace, "diary"), now: time.Now}
+	return []Tool{&DiaryLogTool{s}, &DiarySummaryTool{s}}
+}
+
+// path returns the diary file of the user making the call.
+func (s *diaryStore) path(ctx context.Context) (string, error) {
+	user := documentUser(ctx)
+	if user == "" {
+		user = CallMetadataFromContext(ctx).SessionKey
+	}
+	if user == "" {
+		return "", fmt.Errorf("the diary needs to know which user is writing; no sender is attached to this call")
+	}
+	name := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' {
+			return r
+		}
+		return '_'
+	}, user)
+	return filepath.Join(s.dir, name+".jsonl"), nil
+}
+
+func (s *diaryStore) append(path string, entry DiaryEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return err
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// load returns the entries dated from..to inclusive, oldest first.
+func (s *diaryStore) load(path, from, to string) ([]DiaryEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []DiaryEntry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+	for scanner.Scan() {
+		var e DiaryEntry
+		if json.Unmarshal(scanner.Bytes(), &e) != nil {
+			continue
+		}
+		if e.Date >= from && e.Date <= to {
+			entries = append(entries, e)
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Date < entries[j].Date })
+	return entries, scanner.Err()
+}
+
+// DiaryLogTool records a diary entry.
+type DiaryLogTool struct {
+	s *diaryStore
+}
+
+func (t *DiaryLogTool) Name() string {
+	return "diary_log"
+}
+
+func (t *DiaryLogTool) Description() string {
+	return "Record the user's symptoms, pain score, weight and whether they took their medications in their personal diary, for one day. " +
+		"Log what the user reports in the conversation, such as 'pain 6/10 in the upper belly today, skipped creon at lunch'. " +
+		"Severities and pain use 0 (none) to 10 (worst imaginable). The care team can review the diary and diary_summary shows trends."
+}
+
+func (t *DiaryLogTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"date": map[string]interface{}{
+				"type":        "string",
+				"description": "Day the entry is about, YYYY-MM-DD; today when omitted",
+			},
+			"symptoms": map[string]interface{}{
+				"type": "array",
+				"items": map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"name":     map[string]interface{}{"type": "string", "description": "e.g. nausea, fatigue, diarrhea"},
+						"severity": map[string]interface{}{"type": "integer", "minimum": 0, "maximum": 10},
+					},
+					"required": []string{"name", "severity"},
+				},
+			},
+			"pain_score": map[string]interface{}{
+				"type":        "integer",
+				"description": "Worst pain of the day, 0-10",
+				"minimum":     0,
+				"maximum":     10,
+			},
+			"pain_location": map[string]interface{}{
+				"type":        "string",
+				"description": "Where the pain is, e.g. upper abdomen radiating to the back",
+			},
+			"weight_kg": map[string]interface{}{
+				"type":        "number",
+				"description": "Body weight in kilograms; convert from jin (斤) or pounds first",
+			},
+			"medications": map[string]interface{}{
+				"type": "array",
+				"items": map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"name":  map[string]interface{}{"type": "string"},
+						"taken": map[string]interface{}{"type": "boolean", "description": "Whether it was taken as prescribed"},
+						"note":  map[string]interface{}{"type": "string", "description": "e.g. why a dose was missed"},
+					},
+					"required": []string{"name", "taken"},
+				},
+			},
+			"notes": map[string]interface{}{
+				"type":        "string",
+				"description": "Anything else worth noting, such as appetite or sleep",
+			},
+		},
+	}
+}
+
+type diaryLogArgs struct {
+	Date     string `json:"date"`
+	Symptoms []struct {
+		Name     string `json:"name" arg:"required"`
+		Severity int    `json:"severity" arg:"min=0,max=10"`
+	} `json:"symptoms"`
+	PainScore    *int    `json:"pain_score" arg:"min=0,max=10"`
+	PainLocation string  `json:"pain_location"`
+	WeightKg     float64 `json:"weight_kg" arg:"min=0,max=400"`
+	Medications  []struct {
+		Name  string `json:"name" arg:"required"`
+		Taken bool   `json:"taken"`
+		Note  string `json:"note"`
+	} `json:"medications"`
+	Notes string `json:"notes"`
+}
+
+func (t *DiaryLogTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	a, err := BindArgs[diaryLogArgs](args)
+	if err != nil {
+		return ErrorResult(err.Error()).WithError(err)
+	}
+	path, err := t.s.path(ctx)
+	if err != nil {
+		return ErrorResult(err.Error()).WithError(ClassifyError(ErrPermissionDenied, err))
+	}
+
+	now := t.s.now()
+	entry := DiaryEntry{
+		Date:         now.Format("2006-01-02"),
+		PainScore:    a.PainScore,
+		PainLocation: a.PainLocation,
+		WeightKg:     a.WeightKg,
+		Notes:        a.Notes,
+		RecordedAt:   now.UTC(),
+	}
+	if a.Date != "" {
+		day, err := time.ParseInLocation("2006-01-02", a.Date, now.Location())
+		if err != nil {
+			return ErrorResult(fmt.Sprintf("date %q must be YYYY-MM-DD", a.Date)).WithError(ErrInvalidArgs)
+		}
+		if day.After(now) {
+			return ErrorResult(fmt.Sprintf("date %s is in the future", a.Date)).WithError(ErrInvalidArgs)
+		}
+		entry.Date = a.Date
+	}
+	for _, s := range a.Symptoms {
+		entry.Symptoms = append(entry.Symptoms, DiarySymptom{Name: strings.ToLower(s.Name), Severity: s.Severity})
+	}
+	for _, m := range a.Medications {
+		entry.Medications = append(entry.Medications, DiaryDoseTaken{Name: m.Name, Taken: m.Taken, Note: m.Note})
+	}
+	if len(entry.Symptoms) == 0 && entry.PainScore == nil && entry.WeightKg == 0 && len(entry.Medications) == 0 && entry.Notes == "" {
+		return ErrorResult("nothing to log; give at least one of symptoms, pain_score, weight_kg, medications or notes").WithError(ErrInvalidArgs)
+	}
+
+	if err := t.s.append(path, entry); err != nil {
+		return ErrorResult(fmt.Sprintf("failed to save diary entry: %v", err)).WithError(err)
+	}
+	return SilentResult(fmt.Sprintf("Diary entry saved for %s.", entry.Date))
+}
+
+// DiarySummaryTool summarizes the diary over a date range.
+type DiarySummaryTool struct {
+	s *diaryStore
+}
+
+func (t *DiarySummaryTool) Name() string {
+	return "diary_summary"
+}
+
+func (t *DiarySummaryTool) Description() string {
+	return "Summarize the user's diary over a date range: pain and symptom trends charted day by day, weight change and medication adherence. " +
+		"Use it when the user asks how they have been doing, or to prepare for an appointment. Defaults to the last 14 days."
+}
+
+func (t *DiarySummaryTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"from": map[string]interface{}{
+				"type":        "string",
+				"description": "First day, YYYY-MM-DD",
+			},
+			"to": map[string]interface{}{
+				"type":        "string",
+				"description": "Last day, YYYY-MM-DD; today when omitted",
+			},
+		},
+	}
+}
+
+type diarySummaryArgs struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+func (t *DiarySummaryTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	a, err := BindArgs[diarySummaryArgs](args)
+	if err != nil {
+		return ErrorResult(err.Error()).WithError(err)
+	}
+	path, err := t.s.path(ctx)
+	if err != nil {
+		return ErrorResult(err.Error()).WithError(ClassifyError(ErrPermissionDenied, err))
+	}
+
+	now := t.s.now()
+	to, from := now, now.AddDate(0, 0, -(defaultDiaryDays-1))
+	if a.To != "" {
+		if to, err = time.ParseInLocation("2006-01-02", a.To, now.Location()); err != nil {
+			return ErrorResult(fmt.Sprintf("to %q must be YYYY-MM-DD", a.To)).WithError(ErrInvalidArgs)
+		}
+		from = to.AddDate(0, 0, -(defaultDiaryDays - 1))
+	}
+	if a.From != "" {
+		if from, err = time.ParseInLocation("2006-01-02", a.From, now.Location()); err != nil {
+			return ErrorResult(fmt.Sprintf("from %q must be YYYY-MM-DD", a.From)).WithError(ErrInvalidArgs)
+		}
+	}
+	if from.After(to) {
+		return ErrorResult("from must not be after to").WithError(ErrInvalidArgs)
+	}
+	if to.Sub(from) > 366*24*time.Hour {
+		return ErrorResult("summarize at most one year at a time").WithError(ErrInvalidArgs)
+	}
+
+	entries, err := t.s.load(path, from.Format("2006-01-02"), to.Format("2006-01-02"))
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("failed to read diary: %v", err)).WithError(err)
+	}
+	summary := summarizeDiary(entries, from, to)
+	payload, _ := json.Marshal(summary)
+	return NewToolResult(string(payload))
+}
+
+// summarizeDiary computes the trends of entries over the days from..to.
+// Charts have one character per day, with a dot for days without data.
+func summarizeDiary(entries []DiaryEntry, from, to time.Time) map[string]interface{} {
+	var days []string
+	for d := from; !d.After(to); d = d.AddDate(0, 0, 1) {
+		days = append(days, d.Format("2006-01-02"))
+	}
+	out := map[string]interface{}{
+		"from":         days[0],
+		"to":           days[len(days)-1],
+		"days_logged":  0,
+		"chart_legend": "one character per day from 'from' to 'to'; ▁ lowest to █ highest, · no entry",
+	}
+	if len(entries) == 0 {
+		out["note"] = "No diary entries in this period."
+		return out
+	}
+
+	logged := make(map[string]bool)
+	pain := make(map[string]float64)
+	weight := make(map[string]float64)
+	symptoms := make(map[string]map[string]float64)
+	type adherence struct{ taken, total int }
+	doses := make(map[string]*adherence)
+	var notes []string
+	for _, e := range entries {
+		logged[e.Date] = true
+		if e.PainScore != nil && float64(*e.PainScore) >= pain[e.Date] {
+			pain[e.Date] = float64(*e.PainScore)
+		}
+		if e.WeightKg > 0 {
+			weight[e.Date] = e.WeightKg // the day's last weighing
+		}
+		for _, s := range e.Symptoms {
+			if symptoms[s.Name] == nil {
+				symptoms[s.Name] = make(map[string]float64)
+			}
+			if v, ok := symptoms[s.Name][e.Date]; !ok || float64(s.Severity) > v {
+				symptoms[s.Name][e.Date] = float64(s.Severity)
+			}
+		}
+		for _, m := range e.Medications {
+			key := strings.ToLower(m.Name)
+			if doses[key] == nil {
+				doses[key] = &adherence{}
+			}
+			doses[key].total++
+			if m.Taken {
+				doses[key].taken++
+			}
+		}
+		if e.Notes != "" {
+			notes = append(notes, e.Date+": "+e.Notes)
+		}
+	}
+	out["days_logged"] = len(logged)
+
+	if len(pain) > 0 {
+		p := seriesStats(days, pain)
+		p["chart"] = sparkline(days, pain, 0, 10)
+		out["pain"] = p
+	}
+	if len(weight) > 0 {
+		w := seriesStats(days, weight)
+		lo, hi := w["min"].(float64), w["max"].(float64)
+		w["chart"] = sparkline(days, weight, lo, hi)
+		w["change_kg"] = round1(w["last"].(float64) - w["first"].(float64))
+		if first := w["first"].(float64); first > 0 {
+			w["change_percent"] = round1((w["last"].(float64) - first) / first * 100)
+		}
+		out["weight_kg"] = w
+	}
+	if len(symptoms) > 0 {
+		names := make([]string, 0, len(symptoms))
+		for name := range symptoms {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		list := make([]map[string]interface{}, len(names))
+		for i, name := range names {
+			s := seriesStats(days, symptoms[name])
+			s["name"] = name
+			s["days_reported"] = len(symptoms[name])
+			s["chart"] = sparkline(days, symptoms[name], 0, 10)
+			list[i] = s
+		}
+		out["symptoms"] = list
+	}
+	if len(doses) > 0 {
+		names := make([]string, 0, len(doses))
+		for name := range doses {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		list := make([]map[string]interface{}, len(names))
+		for i, name := range names {
+			d := doses[name]
+			list[i] = map[string]interface{}{
+				"name":            name,
+				"taken":           d.taken,
+				"logged":          d.total,
+				"adherence_pct":   math.Round(float64(d.taken) / float64(d.total) * 100),
+				"missed_reported": d.total - d.taken,
+			}
+		}
+		out["medications"] = list
+	}
+	if len(notes) > 0 {
+		out["notes"] = notes
+	}
+	return out
+}
+
+// seriesStats returns the first, last, minimum, maximum and mean of a
+// series and the direction from its first half to its second.
+func seriesStats(days []string, values map[string]float64) map[string]interface{} {
+	var ordered []float64
+	for _, d := range days {
+		if v, ok := values[d]; ok {
+			ordered = append(ordered, v)
+		}
+	}
+	lo, hi, sum := ordered[0], ordered[0], 0.0
+	for _, v := range ordered {
+		lo, hi, sum = math.Min(lo, v), math.Max(hi, v), sum+v
+	}
+	out := map[string]interface{}{
+		"first": ordered[0],
+		"last":  ordered[len(ordered)-1],
+		"min":   lo,
+		"max":   hi,
+		"mean":  round1(sum / float64(len(ordered))),
+	}
+	if len(ordered) >= 2 {
+		half := len(ordered) / 2
+		diff := mean(ordered[len(ordered)-half:]) - mean(ordered[:half])
+		threshold := 0.05 * math.Max(hi, 1)
+		switch {
+		case diff >= threshold:
+			out["trend"] = "rising"
+		case diff <= -threshold:
+			out["trend"] = "falling"
+		default:
+			out["trend"] = "stable"
+		}
+	}
+	return out
+}
+
+// sparkline draws values on a lo..hi scale, one character per day.
+func sparkline(days []string, values map[string]float64, lo, hi float64) string {
+	var b strings.Builder
+	for _, d := range days {
+		v, ok := values[d]
+		switch {
+		case !ok:
+			b.WriteRune('·')
+		case hi <= lo:
+			b.WriteRune(sparkBars[len(sparkBars)/2])
+		default:
+			i := int(math.Round((v - lo) / (hi - lo) * float64(len(sparkBars)-1)))
+			b.WriteRune(sparkBars[max(0, min(len(sparkBars)-1, i))])
+		}
+	}
+	return b.String()
+}
+
+func mean(values []float64) float64 {
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
+
+func round1(v float64) float64 {
+	return math.Round(v*10) / 10
+}
@@ -0,0 +1,114 @@
+package tools
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func diaryTestTools(t *testing.T, now time.Time) (*DiaryLogTool, *DiarySummaryTool, string) {
+	t.Helper()
+	workspace := t.TempDir()
+	list := NewDiaryTools(workspace)
+	log, summary := list[0].(*DiaryLogTool), list[1].(*DiarySummaryTool)
+	log.s.now = func() time.Time { return now }
+	return log, summary, workspace
+}
+
+func TestDiary_LogAndSummary(t *testing.T) {
+	now := time.Date(2026, 5, 10, 20, 0, 0, 0, time.UTC)
+	log, summary, workspace := diaryTestTools(t, now)
+	alice := asUser("111|alice")
+
+	entries := []map[string]interface{}{
+		{"date": "2026-05-04", "pain_score": 2, "weight_kg": 60.0,
+			"medications": []interface{}{map[string]interface{}{"name": "Creon", "taken": true}}},
+		{"date": "2026-05-06", "pain_score": 4, "symptoms": []interface{}{map[string]interface{}{"name": "Nausea", "severity": 3}},
+			"medications": []interface{}{map[string]interface{}{"name": "creon", "taken": false, "note": "forgot at lunch"}}},
+		{"date": "2026-05-08", "pain_score": 6, "weight_kg": 58.5},
+		{"pain_score": 7, "symptoms": []interface{}{map[string]interface{}{"name": "nausea", "severity": 5}}, "notes": "poor appetite"},
+	}
+	for _, args := range entries {
+		if result := log.Execute(alice, args); result.IsError {
+			t.Fatalf("diary_log(%v): %s", args, result.ForLLM)
+		}
+	}
+	if result := log.Execute(asUser("222"), map[string]interface{}{"pain_score": 1}); result.IsError {
+		t.Fatalf("diary_log for another user: %s", result.ForLLM)
+	}
+	if _, err := os.Stat(filepath.Join(workspace, "diary", "111.jsonl")); err != nil {
+		t.Fatalf("diary file: %v", err)
+	}
+
+	result := summary.Execute(alice, map[string]interface{}{"from": "2026-05-04"})
+	if result.IsError {
+		t.Fatalf("diary_summary: %s", result.ForLLM)
+	}
+	var out struct {
+		DaysLogged int `json:"days_logged"`
+		Pain       struct {
+			Max   float64 `json:"max"`
+			Trend string  `json:"trend"`
+			Chart string  `json:"chart"`
+		} `json:"pain"`
+		Weight struct {
+			ChangeKg float64 `json:"change_kg"`
+			Trend    string  `json:"trend"`
+		} `json:"weight_kg"`
+		Symptoms []struct {
+			Name         string  `json:"name"`
+			Max          float64 `json:"max"`
+			DaysReported int     `json:"days_reported"`
+		} `json:"symptoms"`
+		Medications []struct {
+			Name         string  `json:"name"`
+			AdherencePct float64 `json:"adherence_pct"`
+		} `json:"medications"`
+		Notes []string `json:"notes"`
+	}
+	if err := json.Unmarshal([]byte(result.ForLLM), &out); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if out.DaysLogged != 4 || out.Pain.Max != 7 || out.Pain.Trend != "rising" || out.Pain.Chart != "▂·▄·▅·▆" {
+		t.Errorf("pain = %+v (days %d)", out.Pain, out.DaysLogged)
+	}
+	if out.Weight.ChangeKg != -1.5 || out.Weight.Trend != "stable" {
+		t.Errorf("weight = %+v", out.Weight)
+	}
+	if len(out.Symptoms) != 1 || out.Symptoms[0].Name != "nausea" || out.Symptoms[0].Max != 5 || out.Symptoms[0].DaysReported != 2 {
+		t.Errorf("symptoms = %+v", out.Symptoms)
+	}
+	if len(out.Medications) != 1 || out.Medications[0].AdherencePct != 50 {
+		t.Errorf("medications = %+v", out.Medications)
+	}
+	if len(out.Notes) != 1 || out.Notes[0] != "2026-05-10: poor appetite" {
+		t.Errorf("notes = %v", out.Notes)
+	}
+}
+
+func TestDiary_InvalidInput(t *testing.T) {
+	now := time.Date(2026, 5, 10, 20, 0, 0, 0, time.UTC)
+	log, summary, _ := diaryTestTools(t, now)
+	alice := asUser("111")
+
+	tests := []struct {
+		name string
+		tool Tool
+		args map[string]interface{}
+	}{
+		{"empty entry", log, map[string]interface{}{"date": "2026-05-09"}},
+		{"pain out of range", log, map[string]interface{}{"pain_score": 11}},
+		{"future date", log, map[string]interface{}{"date": "2026-05-11", "pain_score": 3}},
+		{"bad date", log, map[string]interface{}{"date": "10/05/2026", "pain_score": 3}},
+		{"reversed range", summary, map[string]interface{}{"from": "2026-05-10", "to": "2026-05-01"}},
+	}
+	for _, tt := range tests {
+		result := tt.tool.Execute(alice, tt.args)
+		if !result.IsError || !errors.Is(result.Err, ErrInvalidArgs) {
+			t.Errorf("%s: %+v", tt.name, result)
+		}
+	}
+}
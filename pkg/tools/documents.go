@@ -0,0 +1,355 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/pdftext"
+	"github.com/sipeed/picoclaw/pkg/rag"
+)
+
+const (
+	defaultDocumentChunkChars   = 1200
+	defaultDocumentChunkOverlap = 200
+	defaultDocumentMaxPDFBytes  = 30 << 20
+	documentPreviewChars        = 300
+)
+
+// DocumentToolOptions configures the document index tools.
+type DocumentToolOptions struct {
+	// Dir is where the index is stored. Store, when set, is used instead
+	// so the index can be shared with other tools.
+	Dir          string
+	Store        *rag.Store
+	Workspace    string
+	Restrict     bool
+	PathPolicy   *PathPolicy // limits on the files ingest_pdf reads
+	ChunkChars   int
+	ChunkOverlap int
+	MaxPDFBytes  int64
+	Timeout      time.Duration
+}
+
+// NewDocumentTools opens the document index in opts.Dir and returns the
+// ingest_pdf and search_documents tools.
+func NewDocumentTools(opts DocumentToolOptions) ([]Tool, error) {
+	store := opts.Store
+	if store == nil {
+		if opts.Dir == "" {
+			return nil, fmt.Errorf("document index directory is required")
+		}
+		var err error
+		if store, err = rag.Open(opts.Dir); err != nil {
+			return nil, err
+		}
+	}
+	if opts.ChunkChars <= 0 {
+		opts.ChunkChars = defaultDocumentChunkChars
+	}
+	if opts.ChunkOverlap < 0 || opts.ChunkOverlap >= opts.ChunkChars {
+		opts.ChunkOverlap = defaultDocumentChunkOverlap
+	}
+	if opts.MaxPDFBytes <= 0 {
+		opts.MaxPDFBytes = defaultDocumentMaxPDFBytes
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 60 * time.Second
+	}
+	return []Tool{
+		&IngestPDFTool{store: store, opts: opts, client: &http.Client{Timeout: opts.Timeout}},
+		&SearchDocumentsTool{store: store},
+	}, nil
+}
+
+// documentUser returns the sender ID of the current call, without the
+// display name some channels append.
+func documentUser(ctx context.Context) string {
+	id, _, _ := strings.Cut(CallMetadataFromContext(ctx).UserID, "|")
+	return id
+}
+
+// IngestPDFTool downloads or reads a PDF, extracts its text and adds it to
+// the document index.
+type IngestPDFTool struct {
+	store  *rag.Store
+	opts   DocumentToolOptions
+	client *http.Client
+}
+
+func (t *IngestPDFTool) Name() string {
+	return "ingest_pdf"
+}
+
+func (t *IngestPDFTool) Description() string {
+	return "Add a PDF, such as a clinical guideline, consent form or discharge summary, to the document index so its contents can be searched. " +
+		"Give a URL or a path in the workspace. Returns a doc_id to pass to search_documents. " +
+		"Ingesting the same file again returns the existing doc_id. " +
+		"Documents are private to the user who adds them unless shared is true; only share documents that hold no personal information."
+}
+
+func (t *IngestPDFTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"url": map[string]interface{}{
+				"type":        "string",
+				"description": "http(s) URL of the PDF",
+			},
+			"path": map[string]interface{}{
+				"type":        "string",
+				"description": "Path to the PDF in the workspace, when no URL is given",
+			},
+			"title": map[string]interface{}{
+				"type":        "string",
+				"description": "Title for the document; defaults to the title in the PDF or the file name",
+			},
+			"shared": map[string]interface{}{
+				"type":        "boolean",
+				"description": "Make the document searchable by all users, for public material such as guidelines",
+			},
+		},
+	}
+}
+
+type ingestPDFArgs struct {
+	URL    string `json:"url"`
+	Path   string `json:"path"`
+	Title  string `json:"title"`
+	Shared bool   `json:"shared"`
+}
+
+func (t *IngestPDFTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	a, err := BindArgs[ingestPDFArgs](args)
+	if err != nil {
+		return ErrorResult(err.Error()).WithError(err)
+	}
+	if (a.URL == "") == (a.Path == "") {
+		return ErrorResult("give either url or path").WithError(ErrInvalidArgs)
+	}
+
+	var data []byte
+	var source, fileName string
+	if a.URL != "" {
+		var failed *ToolResult
+		if data, failed = t.download(ctx, a.URL); failed != nil {
+			return failed
+		}
+		source = a.URL
+		if u, err := url.Parse(a.URL); err == nil {
+			fileName = path.Base(u.Path)
+		}
+	} else {
+		p, err := t.opts.PathPolicy.resolve(ctx, a.Path, t.opts.Workspace, t.opts.Restrict, true)
+		if err != nil {
+			return ErrorResult(err.Error()).WithError(ClassifyError(ErrInvalidArgs, err))
+		}
+		info, err := os.Stat(p)
+		if err != nil {
+			return ErrorResult(fmt.Sprintf("file not found: %s", a.Path)).WithError(ClassifyError(ErrInvalidArgs, err))
+		}
+		if err := t.opts.PathPolicy.checkSize(info.Size()); err != nil {
+			return ErrorResult(err.Error()).WithError(ClassifyError(ErrInvalidArgs, err))
+		}
+		if info.Size() > t.opts.MaxPDFBytes {
+			return ErrorResult(fmt.Sprintf("PDF is larger than %d MB", t.opts.MaxPDFBytes>>20)).WithError(ErrInvalidArgs)
+		}
+		if data, err = os.ReadFile(p); err != nil {
+			return ErrorResult(fmt.Sprintf("failed to read file: %v", err))
+		}
+		source = a.Path
+		fileName = filepath.Base(p)
+	}
+
+	user := documentUser(ctx)
+	id := rag.DocumentID(data, user, a.Shared)
+	if doc, ok := t.store.Get(id); ok {
+		return t.result(doc, true)
+	}
+
+	extracted, err := pdftext.Extract(data)
+	switch {
+	case errors.Is(err, pdftext.ErrNotPDF):
+		return ErrorResult("the file is not a PDF").WithError(ClassifyError(ErrInvalidArgs, err))
+	case errors.Is(err, pdftext.ErrEncrypted):
+		return ErrorResult("the PDF is password-protected; ask the user for an unprotected copy").
+			WithError(ClassifyError(ErrInvalidArgs, err))
+	case err != nil:
+		return ErrorResult(fmt.Sprintf("failed to read PDF: %v", err)).WithError(ClassifyError(ErrInvalidArgs, err))
+	}
+
+	sections := make([]rag.Section, 0, len(extracted.Pages))
+	for _, p := range extracted.Pages {
+		sections = append(sections, rag.Section{Page: p.Number, Text: p.Text})
+	}
+	chunks := rag.ChunkSections(sections, t.opts.ChunkChars, t.opts.ChunkOverlap)
+	if len(chunks) == 0 {
+		return ErrorResult("the PDF has no text layer; it is probably a scan. Save the pages as images and read them with ocr_image if it is available").
+			WithError(ClassifyError(ErrNotFound, fmt.Errorf("no text in PDF")))
+	}
+
+	title := strings.TrimSpace(a.Title)
+	if title == "" {
+		title = extracted.Title
+	}
+	if title == "" {
+		title = strings.TrimSuffix(fileName, filepath.Ext(fileName))
+	}
+	doc := &rag.Document{
+		ID:      id,
+		Title:   title,
+		Source:  source,
+		Owner:   user,
+		Shared:  a.Shared,
+		Pages:   len(extracted.Pages),
+		Chunks:  chunks,
+		AddedAt: time.Now(),
+	}
+	if err := t.store.Add(doc); err != nil {
+		return ErrorResult(fmt.Sprintf("failed to store document: %v", err))
+	}
+	return t.result(doc, false)
+}
+
+func (t *IngestPDFTool) download(ctx context.Context, rawURL string) ([]byte, *ToolResult) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, ErrorResult("url must be an http(s) URL").WithError(ErrInvalidArgs)
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", rawURL, nil)
+	if err != nil {
+		return nil, ErrorResult(fmt.Sprintf("failed to create request: %v", err))
+	}
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Accept", "application/pdf")
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, ErrorResult(fmt.Sprintf("request failed: %v", err)).WithError(requestError(ctx, err))
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		err := fmt.Errorf("download failed: HTTP %d", resp.StatusCode)
+		return nil, ErrorResult(err.Error()).WithError(ClassifyError(StatusErrorKind(resp.StatusCode), err))
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, t.opts.MaxPDFBytes+1))
+	if err != nil {
+		return nil, ErrorResult(fmt.Sprintf("failed to read response: %v", err)).WithError(requestError(ctx, err))
+	}
+	if int64(len(data)) > t.opts.MaxPDFBytes {
+		return nil, ErrorResult(fmt.Sprintf("PDF is larger than %d MB", t.opts.MaxPDFBytes>>20)).WithError(ErrInvalidArgs)
+	}
+	head := data
+	if len(head) > 1024 {
+		head = head[:1024]
+	}
+	if !bytes.Contains(head, []byte("%PDF-")) {
+		return nil, ErrorResult(fmt.Sprintf("the URL returned %s, not a PDF; find a direct link to the file",
+			resp.Header.Get("Content-Type"))).WithError(ErrInvalidArgs)
+	}
+	return data, nil
+}
+
+func (t *IngestPDFTool) result(doc *rag.Document, existing bool) *ToolResult {
+	preview := []rune(doc.Chunks[0].Text)
+	if len(preview) > documentPreviewChars {
+		preview = append(preview[:documentPreviewChars], '…')
+	}
+	payload, _ := json.Marshal(map[string]interface{}{
+		"doc_id":           doc.ID,
+		"title":            doc.Title,
+		"pages":            doc.Pages,
+		"chunks":           len(doc.Chunks),
+		"already_ingested": existing,
+		"preview":          string(preview),
+	})
+	return NewToolResult(string(payload))
+}
+
+// SearchDocumentsTool retrieves passages from the document index.
+type SearchDocumentsTool struct {
+	store *rag.Store
+}
+
+func (t *SearchDocumentsTool) Name() string {
+	return "search_documents"
+}
+
+func (t *SearchDocumentsTool) Concurrent() bool {
+	return true
+}
+
+func (t *SearchDocumentsTool) Description() string {
+	return "Search the PDFs added with ingest_pdf and return the best-matching passages with their document and page. " +
+		"Search with the words the document is likely to use, in its language; pass doc_ids to search particular documents. " +
+		"Cite the title and page of any passage you rely on."
+}
+
+func (t *SearchDocumentsTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"query": map[string]interface{}{
+				"type":        "string",
+				"description": "Keywords to search for",
+			},
+			"doc_ids": map[string]interface{}{
+				"type":        "array",
+				"items":       map[string]interface{}{"type": "string"},
+				"description": "Limit the search to these documents",
+			},
+			"top_k": map[string]interface{}{
+				"type":        "integer",
+				"description": "Number of passages to return (1-20, default 5)",
+			},
+		},
+		"required": []string{"query"},
+	}
+}
+
+type searchDocumentsArgs struct {
+	Query  string   `json:"query" arg:"required"`
+	DocIDs []string `json:"doc_ids"`
+	TopK   int      `json:"top_k" arg:"min=1,max=20,default=5"`
+}
+
+func (t *SearchDocumentsTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	a, err := BindArgs[searchDocumentsArgs](args)
+	if err != nil {
+		return ErrorResult(err.Error()).WithError(err)
+	}
+	user := documentUser(ctx)
+	for _, id := range a.DocIDs {
+		if doc, ok := t.store.Get(id); !ok || !doc.VisibleTo(user) {
+			return ErrorResult(fmt.Sprintf("unknown document %q", id)).
+				WithError(ClassifyError(ErrNotFound, fmt.Errorf("document %s not found", id)))
+		}
+	}
+
+	hits := t.store.Search(a.Query, rag.SearchOptions{DocIDs: a.DocIDs, User: user, Limit: a.TopK})
+	if len(hits) == 0 {
+		return ErrorResult("no matching passages; try other keywords").
+			WithError(ClassifyError(ErrNotFound, fmt.Errorf("no matches for %q", a.Query)))
+	}
+	results := make([]map[string]interface{}, 0, len(hits))
+	for _, h := range hits {
+		results = append(results, map[string]interface{}{
+			"doc_id": h.DocID,
+			"title":  h.Title,
+			"page":   h.Page,
+			"chunk":  h.Index,
+			"text":   h.Text,
+		})
+	}
+	payload, _ := json.Marshal(map[string]interface{}{"results": results})
+	return NewToolResult(string(payload))
+}
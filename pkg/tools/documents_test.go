@@ -0,0 +1,147 @@
+package tools
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// minimalPDF returns a one-page PDF showing each line of text.
+func minimalPDF(lines ...string) []byte {
+	var content strings.Builder
+	for i, l := range lines {
+		fmt.Fprintf(&content, "BT /F1 11 Tf 72 %d Td (%s) Tj ET\n", 720-i*14, l)
+	}
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 /MediaBox [0 0 612 792] >>",
+		"<< /Type /Page /Parent 2 0 R /Contents 4 0 R /Resources << /Font << /F1 5 0 R >> >> >>",
+		fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", content.Len(), content.String()),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>",
+	}
+	var out bytes.Buffer
+	out.WriteString("%PDF-1.4\n")
+	for i, o := range objects {
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", i+1, o)
+	}
+	out.WriteString("trailer\n<< /Root 1 0 R >>\n%%EOF\n")
+	return out.Bytes()
+}
+
+func documentTestTools(t *testing.T, workspace string) (*IngestPDFTool, *SearchDocumentsTool) {
+	t.Helper()
+	list, err := NewDocumentTools(DocumentToolOptions{
+		Dir:          filepath.Join(workspace, "rag"),
+		Workspace:    workspace,
+		Restrict:     true,
+		ChunkChars:   300,
+		ChunkOverlap: 50,
+		MaxPDFBytes:  1 << 20,
+	})
+	if err != nil {
+		t.Fatalf("NewDocumentTools() error: %v", err)
+	}
+	return list[0].(*IngestPDFTool), list[1].(*SearchDocumentsTool)
+}
+
+func TestIngestPDFAndSearch(t *testing.T) {
+	guideline := minimalPDF("Pancreatic enzyme replacement therapy", "Start with 40000 lipase units per main meal.")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/pert-guideline.pdf":
+			w.Header().Set("Content-Type", "application/pdf")
+			w.Write(guideline)
+		case "/page.html":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte("<html>download here</html>"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	workspace := t.TempDir()
+	os.WriteFile(filepath.Join(workspace, "discharge.pdf"), minimalPDF("Discharge summary", "Continue creon with meals."), 0644)
+	ingest, search := documentTestTools(t, workspace)
+
+	result := ingest.Execute(asUser("111|alice"), map[string]interface{}{"url": server.URL + "/pert-guideline.pdf", "shared": true})
+	if result.IsError {
+		t.Fatalf("ingest url: %s", result.ForLLM)
+	}
+	var out struct {
+		DocID    string `json:"doc_id"`
+		Title    string `json:"title"`
+		Pages    int    `json:"pages"`
+		Existing bool   `json:"already_ingested"`
+	}
+	json.Unmarshal([]byte(result.ForLLM), &out)
+	if !strings.HasPrefix(out.DocID, "doc-") || out.Title != "pert-guideline" || out.Pages != 1 || out.Existing {
+		t.Fatalf("unexpected result: %s", result.ForLLM)
+	}
+	sharedID := out.DocID
+
+	again := ingest.Execute(asUser("222"), map[string]interface{}{"url": server.URL + "/pert-guideline.pdf", "shared": true})
+	json.Unmarshal([]byte(again.ForLLM), &out)
+	if out.DocID != sharedID || !out.Existing {
+		t.Errorf("re-ingest: %s", again.ForLLM)
+	}
+
+	result = ingest.Execute(asUser("111"), map[string]interface{}{"path": "discharge.pdf", "title": "My discharge"})
+	if result.IsError {
+		t.Fatalf("ingest path: %s", result.ForLLM)
+	}
+	json.Unmarshal([]byte(result.ForLLM), &out)
+	privateID := out.DocID
+
+	result = search.Execute(asUser("222"), map[string]interface{}{"query": "lipase units per meal"})
+	if result.IsError || !strings.Contains(result.ForLLM, sharedID) || !strings.Contains(result.ForLLM, `"page":1`) {
+		t.Errorf("search shared: %s", result.ForLLM)
+	}
+	if result := search.Execute(asUser("222"), map[string]interface{}{"query": "creon"}); !errors.Is(result.Err, ErrNotFound) {
+		t.Errorf("private document found by another user: %s", result.ForLLM)
+	}
+	if result := search.Execute(asUser("222"), map[string]interface{}{"query": "creon", "doc_ids": []interface{}{privateID}}); !errors.Is(result.Err, ErrNotFound) {
+		t.Errorf("private doc_id accepted for another user: %s", result.ForLLM)
+	}
+	result = search.Execute(asUser("111|alice"), map[string]interface{}{"query": "creon"})
+	if result.IsError || !strings.Contains(result.ForLLM, "My discharge") {
+		t.Errorf("search own document: %s", result.ForLLM)
+	}
+
+	failures := []struct {
+		name string
+		args map[string]interface{}
+		want error
+	}{
+		{"neither url nor path", map[string]interface{}{}, ErrInvalidArgs},
+		{"html page", map[string]interface{}{"url": server.URL + "/page.html"}, ErrInvalidArgs},
+		{"missing url", map[string]interface{}{"url": server.URL + "/missing.pdf"}, ErrNotFound},
+		{"outside workspace", map[string]interface{}{"path": "/etc/passwd"}, ErrInvalidArgs},
+		{"ftp url", map[string]interface{}{"url": "ftp://example.com/a.pdf"}, ErrInvalidArgs},
+	}
+	for _, tt := range failures {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := ingest.Execute(asUser("111"), tt.args); !errors.Is(result.Err, tt.want) {
+				t.Errorf("Err = %v, want %v (%s)", result.Err, tt.want, result.ForLLM)
+			}
+		})
+	}
+}
+
+func TestIngestPDF_NoTextLayer(t *testing.T) {
+	workspace := t.TempDir()
+	os.WriteFile(filepath.Join(workspace, "scan.pdf"), minimalPDF(), 0644)
+	ingest, _ := documentTestTools(t, workspace)
+
+	result := ingest.Execute(asUser("111"), map[string]interface{}{"path": "scan.pdf"})
+	if !errors.Is(result.Err, ErrNotFound) || !strings.Contains(result.ForLLM, "ocr_image") {
+		t.Errorf("unexpected result: %v %s", result.Err, result.ForLLM)
+	}
+}
@@ -0,0 +1,373 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultRxNormBaseURL  = "https://rxnav.nlm.nih.gov/REST"
+	defaultOpenFDABaseURL = "https://api.fda.gov"
+	drugInteractionTTL    = 24 * time.Hour
+	maxInteractionDrugs   = 20
+	// maxInteractionEvidence bounds the label sentences quoted per pair.
+	maxInteractionEvidence = 2
+	maxEvidenceChars       = 400
+)
+
+// Interaction severities, most severe first.
+var drugInteractionSeverities = []string{"contraindicated", "major", "moderate", "minor"}
+
+// severityCues maps label wording to a severity. The first severity with a
+// matching cue wins.
+var severityCues = map[string][]string{
+	"contraindicated": {"contraindicated", "do not coadminister", "do not co-administer", "must not be", "should not be used"},
+	"major":           {"avoid", "fatal", "life-threatening", "serious", "not recommended", "torsades"},
+	"moderate":        {"monitor", "adjust", "reduce the dose", "dose reduction", "caution", "increase", "decrease"},
+}
+
+var sentenceEnd = regexp.MustCompile(`[.;]\s+|\n+`)
+
+// DrugInteractionOptions configures the drug_interactions tool.
+type DrugInteractionOptions struct {
+	RxNormBaseURL  string
+	OpenFDABaseURL string
+	OpenFDAAPIKey  string
+	Timeout        time.Duration
+}
+
+// DrugInteractionTool checks a medication list for interactions. Names are
+// normalized to their active ingredients with RxNorm, and each pair is
+// looked up in the drug interaction sections of the FDA labels on openFDA.
+// Severity is graded from the label's wording.
+type DrugInteractionTool struct {
+	rxnormURL  string
+	openFDAURL string
+	apiKey     string
+	client     *http.Client
+}
+
+func NewDrugInteractionTool(opts DrugInteractionOptions) *DrugInteractionTool {
+	if opts.RxNormBaseURL == "" {
+		opts.RxNormBaseURL = defaultRxNormBaseURL
+	}
+	if opts.OpenFDABaseURL == "" {
+		opts.OpenFDABaseURL = defaultOpenFDABaseURL
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 20 * time.Second
+	}
+	return &DrugInteractionTool{
+		rxnormURL:  strings.TrimRight(opts.RxNormBaseURL, "/"),
+		openFDAURL: strings.TrimRight(opts.OpenFDABaseURL, "/"),
+		apiKey:     opts.OpenFDAAPIKey,
+		client:     &http.Client{Timeout: opts.Timeout},
+	}
+}
+
+func (t *DrugInteractionTool) Name() string {
+	return "drug_interactions"
+}
+
+func (t *DrugInteractionTool) Description() string {
+	return "Check a list of medications for known interactions between them, using FDA drug labels. " +
+		"Returns each interacting pair with a severity (contraindicated, major, moderate, minor) and the label text it is based on. " +
+		"Pass generic or brand names in English. An empty result does not prove the combination is safe; " +
+		"always tell the user to confirm with their pharmacist or oncologist."
+}
+
+func (t *DrugInteractionTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"medications": map[string]interface{}{
+				"type":        "array",
+				"items":       map[string]interface{}{"type": "string"},
+				"description": "Medication names, e.g. [\"gemcitabine\", \"warfarin\", \"omeprazole\"]",
+				"minItems":    2,
+				"maxItems":    maxInteractionDrugs,
+			},
+		},
+		"required": []string{"medications"},
+	}
+}
+
+func (t *DrugInteractionTool) CacheTTL() time.Duration {
+	return drugInteractionTTL
+}
+
+type drugInteractionArgs struct {
+	Medications []string `json:"medications" arg:"required,min=2,max=20"`
+}
+
+// checkedDrug is one medication from the list, resolved to its ingredients.
+type checkedDrug struct {
+	Input       string   `json:"input"`
+	Ingredients []string `json:"ingredients"`
+	RxCUI       string   `json:"rxcui,omitempty"`
+	LabelFound  bool     `json:"label_found"`
+
+	interactions string // interaction, contraindication and warning text of the labels
+}
+
+// DrugInteraction is one interacting pair.
+type DrugInteraction struct {
+	Drugs    [2]string `json:"drugs"`
+	Severity string    `json:"severity"`
+	Evidence []string  `json:"evidence"`
+	Source   string    `json:"source"`
+}
+
+func (t *DrugInteractionTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	a, err := BindArgs[drugInteractionArgs](args)
+	if err != nil {
+		return ErrorResult(err.Error()).WithError(err)
+	}
+
+	drugs := make([]*checkedDrug, len(a.Medications))
+	errs := make([]error, len(a.Medications))
+	var wg sync.WaitGroup
+	for i, name := range a.Medications {
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+			drugs[i], errs[i] = t.resolve(ctx, name)
+		}(i, name)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return ErrorResult(fmt.Sprintf("drug lookup failed: %v", err)).WithError(err)
+		}
+	}
+
+	var interactions []DrugInteraction
+	for i := 0; i < len(drugs); i++ {
+		for j := i + 1; j < len(drugs); j++ {
+			if found, ok := pairInteraction(drugs[i], drugs[j]); ok {
+				interactions = append(interactions, found)
+			}
+		}
+	}
+	sort.SliceStable(interactions, func(i, j int) bool {
+		return severityRank(interactions[i].Severity) < severityRank(interactions[j].Severity)
+	})
+
+	var unchecked []string
+	for _, d := range drugs {
+		if !d.LabelFound {
+			unchecked = append(unchecked, d.Input)
+		}
+	}
+	payload, _ := json.Marshal(map[string]interface{}{
+		"medications":  drugs,
+		"interactions": interactions,
+		"no_label":     unchecked,
+		"note": "Severity is graded from the wording of the FDA labels. Class warnings (e.g. \"strong CYP3A4 inhibitors\") " +
+			"are only found when a label names the other drug. Medications in no_label could not be checked.",
+	})
+	return NewToolResult(string(payload))
+}
+
+// resolve maps a medication name to its active ingredients with RxNorm and
+// fetches the interaction section of its FDA label. A name RxNorm does not
+// know is looked up as written.
+func (t *DrugInteractionTool) resolve(ctx context.Context, name string) (*checkedDrug, error) {
+	d := &checkedDrug{Input: name}
+	rxcui, ingredients, err := t.rxnormIngredients(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	d.RxCUI = rxcui
+	d.Ingredients = ingredients
+	if len(d.Ingredients) == 0 {
+		d.Ingredients = []string{strings.ToLower(strings.TrimSpace(name))}
+	}
+
+	var sections []string
+	for _, ingredient := range d.Ingredients {
+		text, found, err := t.labelInteractions(ctx, ingredient)
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			d.LabelFound = true
+			sections = append(sections, text)
+		}
+	}
+	d.interactions = strings.Join(sections, "\n")
+	return d, nil
+}
+
+func (t *DrugInteractionTool) rxnormIngredients(ctx context.Context, name string) (string, []string, error) {
+	var ids struct {
+		IDGroup struct {
+			RxNormID []string `json:"rxnormId"`
+		} `json:"idGroup"`
+	}
+	q := url.Values{"name": {name}, "search": {"2"}}
+	if _, err := t.getJSON(ctx, t.rxnormURL+"/rxcui.json?"+q.Encode(), &ids); err != nil {
+		return "", nil, err
+	}
+	if len(ids.IDGroup.RxNormID) == 0 {
+		return "", nil, nil
+	}
+	rxcui := ids.IDGroup.RxNormID[0]
+
+	var related struct {
+		RelatedGroup struct {
+			ConceptGroup []struct {
+				TTY               string `json:"tty"`
+				ConceptProperties []struct {
+					Name string `json:"name"`
+				} `json:"conceptProperties"`
+			} `json:"conceptGroup"`
+		} `json:"relatedGroup"`
+	}
+	if _, err := t.getJSON(ctx, t.rxnormURL+"/rxcui/"+url.PathEscape(rxcui)+"/related.json?tty=IN", &related); err != nil {
+		return "", nil, err
+	}
+	var ingredients []string
+	for _, group := range related.RelatedGroup.ConceptGroup {
+		for _, concept := range group.ConceptProperties {
+			ingredients = append(ingredients, strings.ToLower(concept.Name))
+		}
+	}
+	return rxcui, ingredients, nil
+}
+
+// labelInteractions returns the drug interaction section of the FDA label
+// for an ingredient. found is false when openFDA has no such label.
+func (t *DrugInteractionTool) labelInteractions(ctx context.Context, ingredient string) (string, bool, error) {
+	var labels struct {
+		Results []struct {
+			DrugInteractions []string `json:"drug_interactions"`
+			Warnings         []string `json:"warnings_and_cautions"`
+			Contraindicated  []string `json:"contraindications"`
+		} `json:"results"`
+	}
+	q := url.Values{
+		"search": {fmt.Sprintf("openfda.generic_name:%q", ingredient)},
+		"limit":  {"1"},
+	}
+	if t.apiKey != "" {
+		q.Set("api_key", t.apiKey)
+	}
+	found, err := t.getJSON(ctx, t.openFDAURL+"/drug/label.json?"+q.Encode(), &labels)
+	if err != nil || !found || len(labels.Results) == 0 {
+		return "", false, err
+	}
+	label := labels.Results[0]
+	parts := append(append(label.DrugInteractions, label.Contraindicated...), label.Warnings...)
+	return strings.Join(parts, "\n"), true, nil
+}
+
+// getJSON decodes the response from rawURL into out. found is false for a
+// 404, which both services use for "no match".
+func (t *DrugInteractionTool) getJSON(ctx context.Context, rawURL string, out interface{}) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return false, requestError(ctx, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return false, ClassifyError(StatusErrorKind(resp.StatusCode),
+			fmt.Errorf("%s returned %d: %s", req.URL.Host, resp.StatusCode, strings.TrimSpace(string(body))))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return false, fmt.Errorf("invalid response from %s: %w", req.URL.Host, err)
+	}
+	return true, nil
+}
+
+// pairInteraction looks for each drug's ingredients in the other's label.
+func pairInteraction(a, b *checkedDrug) (DrugInteraction, bool) {
+	found := DrugInteraction{Drugs: [2]string{a.Input, b.Input}}
+	for _, dir := range []struct{ label, other *checkedDrug }{{a, b}, {b, a}} {
+		for _, sentence := range mentioning(dir.label.interactions, dir.other.Ingredients) {
+			if len(found.Evidence) >= maxInteractionEvidence {
+				break
+			}
+			if found.Source == "" {
+				found.Source = "FDA label for " + dir.label.Input
+			}
+			found.Evidence = append(found.Evidence, truncateEvidence(sentence))
+			if s := gradeSeverity(sentence); found.Severity == "" || severityRank(s) < severityRank(found.Severity) {
+				found.Severity = s
+			}
+		}
+	}
+	return found, len(found.Evidence) > 0
+}
+
+// mentioning returns the sentences of text naming any of the ingredients
+// as a whole word.
+func mentioning(text string, ingredients []string) []string {
+	if text == "" {
+		return nil
+	}
+	var patterns []*regexp.Regexp
+	for _, ingredient := range ingredients {
+		if len(ingredient) < 3 {
+			continue
+		}
+		patterns = append(patterns, regexp.MustCompile(`(?i)\b`+regexp.QuoteMeta(ingredient)+`\b`))
+	}
+	var out []string
+	for _, sentence := range sentenceEnd.Split(text, -1) {
+		for _, p := range patterns {
+			if p.MatchString(sentence) {
+				out = append(out, strings.TrimSpace(sentence))
+				break
+			}
+		}
+	}
+	return out
+}
+
+func gradeSeverity(sentence string) string {
+	sentence = strings.ToLower(sentence)
+	for _, severity := range drugInteractionSeverities[:3] {
+		for _, cue := range severityCues[severity] {
+			if strings.Contains(sentence, cue) {
+				return severity
+			}
+		}
+	}
+	return "minor"
+}
+
+func severityRank(severity string) int {
+	for i, s := range drugInteractionSeverities {
+		if s == severity {
+			return i
+		}
+	}
+	return len(drugInteractionSeverities)
+}
+
+func truncateEvidence(sentence string) string {
+	runes := []rune(sentence)
+	if len(runes) <= maxEvidenceChars {
+		return sentence
+	}
+	return string(runes[:maxEvidenceChars]) + "…"
+}
@@ -0,0 +1,133 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newInteractionServer serves RxNorm and openFDA lookups for a brand name
+// (Coumadin → warfarin), two generics and one unknown drug.
+func newInteractionServer(t *testing.T, status int) *httptest.Server {
+	t.Helper()
+	labels := map[string]string{
+		"warfarin":    "Coadministration with gemcitabine may increase INR; monitor INR closely. Other drugs: none known.",
+		"gemcitabine": "No formal interaction studies have been performed.",
+		"omeprazole":  "Avoid concomitant use with clopidogrel. Omeprazole may prolong the elimination of warfarin.",
+	}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if status != http.StatusOK {
+			w.WriteHeader(status)
+			return
+		}
+		switch {
+		case r.URL.Path == "/rxnorm/rxcui.json":
+			if r.URL.Query().Get("name") == "Coumadin" {
+				json.NewEncoder(w).Encode(map[string]interface{}{"idGroup": map[string]interface{}{"rxnormId": []string{"202421"}}})
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"idGroup": map[string]interface{}{}})
+		case r.URL.Path == "/rxnorm/rxcui/202421/related.json":
+			json.NewEncoder(w).Encode(map[string]interface{}{"relatedGroup": map[string]interface{}{
+				"conceptGroup": []interface{}{map[string]interface{}{
+					"tty":               "IN",
+					"conceptProperties": []interface{}{map[string]interface{}{"name": "Warfarin"}},
+				}},
+			}})
+		case r.URL.Path == "/fda/drug/label.json":
+			search := r.URL.Query().Get("search")
+			for name, text := range labels {
+				if search == `openfda.generic_name:"`+name+`"` {
+					json.NewEncoder(w).Encode(map[string]interface{}{"results": []interface{}{
+						map[string]interface{}{"drug_interactions": []string{text}},
+					}})
+					return
+				}
+			}
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			t.Errorf("unexpected request %s", r.URL)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func TestDrugInteractionTool_FindsPairs(t *testing.T) {
+	server := newInteractionServer(t, http.StatusOK)
+	defer server.Close()
+	tool := NewDrugInteractionTool(DrugInteractionOptions{
+		RxNormBaseURL:  server.URL + "/rxnorm",
+		OpenFDABaseURL: server.URL + "/fda/",
+	})
+
+	result := tool.Execute(context.Background(), map[string]interface{}{
+		"medications": []interface{}{"Coumadin", "gemcitabine", "omeprazole", "herbal tea"},
+	})
+	if result.IsError {
+		t.Fatalf("Execute: %s", result.ForLLM)
+	}
+	var out struct {
+		Medications  []checkedDrug     `json:"medications"`
+		Interactions []DrugInteraction `json:"interactions"`
+		NoLabel      []string          `json:"no_label"`
+	}
+	if err := json.Unmarshal([]byte(result.ForLLM), &out); err != nil {
+		t.Fatalf("bad JSON %q: %v", result.ForLLM, err)
+	}
+
+	if got := out.Medications[0]; got.RxCUI != "202421" || got.Ingredients[0] != "warfarin" || !got.LabelFound {
+		t.Errorf("Coumadin resolved to %+v", got)
+	}
+	if len(out.NoLabel) != 1 || out.NoLabel[0] != "herbal tea" {
+		t.Errorf("no_label = %v", out.NoLabel)
+	}
+	if len(out.Interactions) != 2 {
+		t.Fatalf("interactions = %+v", out.Interactions)
+	}
+	// Both pairs are graded from the label wording and keep its case.
+	first, second := out.Interactions[0], out.Interactions[1]
+	if first.Drugs != [2]string{"Coumadin", "gemcitabine"} || first.Severity != "moderate" ||
+		first.Source != "FDA label for Coumadin" || !strings.HasPrefix(first.Evidence[0], "Coadministration with gemcitabine") {
+		t.Errorf("first interaction = %+v", first)
+	}
+	if second.Drugs != [2]string{"Coumadin", "omeprazole"} || second.Severity != "minor" || second.Source != "FDA label for omeprazole" {
+		t.Errorf("second interaction = %+v", second)
+	}
+}
+
+func TestDrugInteractionTool_Errors(t *testing.T) {
+	tool := NewDrugInteractionTool(DrugInteractionOptions{})
+	result := tool.Execute(context.Background(), map[string]interface{}{"medications": []interface{}{"warfarin"}})
+	if !result.IsError || !errors.Is(result.Err, ErrInvalidArgs) {
+		t.Errorf("one medication: %+v", result)
+	}
+
+	server := newInteractionServer(t, http.StatusTooManyRequests)
+	defer server.Close()
+	tool = NewDrugInteractionTool(DrugInteractionOptions{RxNormBaseURL: server.URL, OpenFDABaseURL: server.URL})
+	result = tool.Execute(context.Background(), map[string]interface{}{"medications": []interface{}{"warfarin", "aspirin"}})
+	if !result.IsError || !errors.Is(result.Err, ErrRetryable) {
+		t.Errorf("rate limited: %+v", result)
+	}
+}
+
+func TestGradeSeverity(t *testing.T) {
+	tests := []struct {
+		sentence string
+		want     string
+	}{
+		{"Use with ketoconazole is contraindicated", "contraindicated"},
+		{"Avoid concomitant use with strong inhibitors", "major"},
+		{"Monitor INR when starting", "moderate"},
+		{"Omeprazole may prolong the elimination of warfarin", "minor"},
+	}
+	for _, tt := range tests {
+		if got := gradeSeverity(tt.sentence); got != tt.want {
+			t.Errorf("gradeSeverity(%q) = %q, want %q", tt.sentence, got, tt.want)
+		}
+	}
+}
@@ -12,6 +12,7 @@ import (
 type EditFileTool struct {
 	allowedDir string
 	restrict   bool
+	policy     *PathPolicy
 }
 
 // NewEditFileTool creates a new EditFileTool with optional directory restriction.
@@ -26,6 +27,11 @@ func (t *EditFileTool) Name() string {
 	return "edit_file"
 }
 
+// SetPathPolicy applies p's limits; nil removes them.
+func (t *EditFileTool) SetPathPolicy(p *PathPolicy) {
+	t.policy = p
+}
+
 func (t *EditFileTool) Description() string {
 	return "Edit a file by replacing old_text with new_text. The old_text must exist exactly in the file."
 }
@@ -67,7 +73,7 @@ func (t *EditFileTool) Execute(ctx context.Context, args map[string]interface{})
 		return ErrorResult("new_text is required")
 	}
 
-	resolvedPath, err := validatePath(path, t.allowedDir, t.restrict)
+	resolvedPath, err := t.policy.resolve(ctx, path, t.allowedDir, t.restrict, true)
 	if err != nil {
 		return ErrorResult(err.Error())
 	}
@@ -93,6 +99,9 @@ func (t *EditFileTool) Execute(ctx context.Context, args map[string]interface{})
 	}
 
 	newContent := strings.Replace(contentStr, oldText, newText, 1)
+	if err := t.policy.checkSize(int64(len(newContent))); err != nil {
+		return ErrorResult(err.Error())
+	}
 
 	if err := os.WriteFile(resolvedPath, []byte(newContent), 0644); err != nil {
 		return ErrorResult(fmt.Sprintf("failed to write file: %v", err))
@@ -104,6 +113,7 @@ func (t *EditFileTool) Execute(ctx context.Context, args map[string]interface{})
 type AppendFileTool struct {
 	workspace string
 	restrict  bool
+	policy    *PathPolicy
 }
 
 func NewAppendFileTool(workspace string, restrict bool) *AppendFileTool {
@@ -114,6 +124,11 @@ func (t *AppendFileTool) Name() string {
 	return "append_file"
 }
 
+// SetPathPolicy applies p's limits; nil removes them.
+func (t *AppendFileTool) SetPathPolicy(p *PathPolicy) {
+	t.policy = p
+}
+
 func (t *AppendFileTool) Description() string {
 	return "Append content to the end of a file"
 }
@@ -146,10 +161,17 @@ func (t *AppendFileTool) Execute(ctx context.Context, args map[string]interface{
 		return ErrorResult("content is required")
 	}
 
-	resolvedPath, err := validatePath(path, t.workspace, t.restrict)
+	resolvedPath, err := t.policy.resolve(ctx, path, t.workspace, t.restrict, true)
 	if err != nil {
 		return ErrorResult(err.Error())
 	}
+	var size int64
+	if info, err := os.Stat(resolvedPath); err == nil {
+		size = info.Size()
+	}
+	if err := t.policy.checkSize(size + int64(len(content))); err != nil {
+		return ErrorResult(err.Error())
+	}
 
 	f, err := os.OpenFile(resolvedPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 	if err != nil {
@@ -0,0 +1,76 @@
+package tools
+
+import (
+	"errors"
+	"net/http"
+)
+
+// Error categories a tool attaches with ToolResult.WithError so the agent
+// loop can react: retry the call, ask the model to fix its arguments, or
+// tell the user. Wrap an error with ClassifyError to keep its message.
+var (
+	// ErrRetryable marks temporary failures such as timeouts, rate limits
+	// and upstream 5xx responses. The call may succeed if repeated.
+	ErrRetryable = errors.New("temporary failure")
+	// ErrInvalidArgs marks arguments the tool rejected.
+	ErrInvalidArgs = errors.New("invalid arguments")
+	// ErrPermissionDenied marks calls that are not allowed, including
+	// denied approvals and rejected credentials.
+	ErrPermissionDenied = errors.New("permission denied")
+	// ErrNotFound marks lookups of something that does not exist.
+	ErrNotFound = errors.New("not found")
+)
+
+var errorKinds = []error{ErrRetryable, ErrInvalidArgs, ErrPermissionDenied, ErrNotFound}
+
+// ClassifyError returns err marked with kind, so that errors.Is(err, kind)
+// holds while the message and the rest of the chain are unchanged. A nil
+// err yields kind itself.
+func ClassifyError(kind, err error) error {
+	if err == nil {
+		return kind
+	}
+	if errors.Is(err, kind) {
+		return err
+	}
+	return &classifiedError{kind: kind, err: err}
+}
+
+// ErrorKind returns the category err belongs to, or nil if it has none.
+func ErrorKind(err error) error {
+	for _, kind := range errorKinds {
+		if errors.Is(err, kind) {
+			return kind
+		}
+	}
+	return nil
+}
+
+// StatusErrorKind maps an HTTP status code to an error category, or nil for
+// codes without one.
+func StatusErrorKind(status int) error {
+	switch {
+	case status == http.StatusTooManyRequests, status == http.StatusRequestTimeout, status >= 500:
+		return ErrRetryable
+	case status == http.StatusUnauthorized, status == http.StatusForbidden:
+		return ErrPermissionDenied
+	case status == http.StatusNotFound, status == http.StatusGone:
+		return ErrNotFound
+	case status == http.StatusBadRequest, status == http.StatusUnprocessableEntity:
+		return ErrInvalidArgs
+	}
+	return nil
+}
+
+type classifiedError struct {
+	kind error
+	err  error
+}
+
+func (e *classifiedError) Error() string {
+	return e.err.Error()
+}
+
+func (e *classifiedError) Unwrap() []error {
+	return []error{e.kind, e.err}
+}
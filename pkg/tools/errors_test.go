@@ -0,0 +1,52 @@
+package tools
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestClassifyError(t *testing.T) {
+	cause := fmt.Errorf("upstream: %w", errors.New("connection reset"))
+	err := ClassifyError(ErrRetryable, cause)
+	if err.Error() != cause.Error() {
+		t.Errorf("message = %q, want %q", err.Error(), cause.Error())
+	}
+	if !errors.Is(err, ErrRetryable) || !errors.Is(err, cause) {
+		t.Error("classified error lost its kind or cause")
+	}
+	if ErrorKind(err) != ErrRetryable {
+		t.Errorf("ErrorKind = %v", ErrorKind(err))
+	}
+	if ClassifyError(ErrRetryable, err) != err {
+		t.Error("classifying twice should return the same error")
+	}
+	if ClassifyError(ErrNotFound, nil) != ErrNotFound {
+		t.Error("nil error should classify as the kind itself")
+	}
+	if ErrorKind(cause) != nil || ErrorKind(nil) != nil {
+		t.Error("unclassified errors should have no kind")
+	}
+}
+
+func TestStatusErrorKind(t *testing.T) {
+	tests := []struct {
+		status int
+		want   error
+	}{
+		{http.StatusTooManyRequests, ErrRetryable},
+		{http.StatusBadGateway, ErrRetryable},
+		{http.StatusUnauthorized, ErrPermissionDenied},
+		{http.StatusForbidden, ErrPermissionDenied},
+		{http.StatusNotFound, ErrNotFound},
+		{http.StatusBadRequest, ErrInvalidArgs},
+		{http.StatusConflict, nil},
+		{http.StatusOK, nil},
+	}
+	for _, tt := range tests {
+		if got := StatusErrorKind(tt.status); got != tt.want {
+			t.Errorf("StatusErrorKind(%d) = %v, want %v", tt.status, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,476 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	defaultEvidenceResults = 10
+	maxEvidenceResults     = 30
+)
+
+// ErrAnswerUnsupported is returned by providers that only retrieve
+// evidence and cannot generate answers.
+var ErrAnswerUnsupported = errors.New("evidence provider does not generate answers")
+
+// EvidenceProvider is a source of clinical evidence, such as the KnowS API,
+// PubMed or the local guideline index. IDs are the provider's own; the
+// registry prefixes them with the provider name.
+type EvidenceProvider interface {
+	Name() string
+	Search(ctx context.Context, query EvidenceQuery) ([]Evidence, error)
+	GetDetail(ctx context.Context, id string) (*EvidenceDetail, error)
+	Answer(ctx context.Context, question string) (*EvidenceAnswer, error)
+}
+
+// EvidenceQuery is a search for evidence.
+type EvidenceQuery struct {
+	Question string
+	Limit    int
+}
+
+// Evidence is one search result.
+type Evidence struct {
+	ID      string  `json:"id"`
+	Source  string  `json:"source"`
+	Type    string  `json:"type,omitempty"` // e.g. paper, guideline, meeting abstract, review
+	Title   string  `json:"title"`
+	Snippet string  `json:"snippet,omitempty"`
+	Journal string  `json:"journal,omitempty"`
+	Year    int     `json:"year,omitempty"`
+	DOI     string  `json:"doi,omitempty"`
+	PMID    string  `json:"pmid,omitempty"`
+	URL     string  `json:"url,omitempty"`
+	Score   float64 `json:"-"`
+}
+
+// EvidenceDetail is the full content of one evidence item.
+type EvidenceDetail struct {
+	Evidence
+	Content string      `json:"content,omitempty"`
+	Data    interface{} `json:"data,omitempty"` // provider-specific structured detail
+}
+
+// EvidenceAnswer is a provider-generated answer with the evidence it cites.
+type EvidenceAnswer struct {
+	Source    string     `json:"source"`
+	Answer    string     `json:"answer"`
+	Citations []Evidence `json:"citations,omitempty"`
+}
+
+// EvidenceRegistry holds the configured evidence providers and merges
+// their results.
+type EvidenceRegistry struct {
+	mu        sync.RWMutex
+	providers []EvidenceProvider
+}
+
+func NewEvidenceRegistry() *EvidenceRegistry {
+	return &EvidenceRegistry{}
+}
+
+// Register adds a provider, replacing one with the same name.
+func (r *EvidenceRegistry) Register(p EvidenceProvider) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, existing := range r.providers {
+		if existing.Name() == p.Name() {
+			r.providers[i] = p
+			return
+		}
+	}
+	r.providers = append(r.providers, p)
+}
+
+// Names returns the provider names in registration order.
+func (r *EvidenceRegistry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, len(r.providers))
+	for i, p := range r.providers {
+		names[i] = p.Name()
+	}
+	return names
+}
+
+// selected returns the providers named in sources, or all of them.
+func (r *EvidenceRegistry) selected(sources []string) ([]EvidenceProvider, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if len(sources) == 0 {
+		return append([]EvidenceProvider(nil), r.providers...), nil
+	}
+	var out []EvidenceProvider
+	for _, name := range sources {
+		p := r.lookup(name)
+		if p == nil {
+			return nil, ClassifyError(ErrInvalidArgs, fmt.Errorf("unknown evidence source %q; available: %s", name, strings.Join(r.namesLocked(), ", ")))
+		}
+		out = append(out, p)
+	}
+	return out, nil
+}
+
+func (r *EvidenceRegistry) lookup(name string) EvidenceProvider {
+	for _, p := range r.providers {
+		if strings.EqualFold(p.Name(), name) {
+			return p
+		}
+	}
+	return nil
+}
+
+func (r *EvidenceRegistry) namesLocked() []string {
+	names := make([]string, len(r.providers))
+	for i, p := range r.providers {
+		names[i] = p.Name()
+	}
+	return names
+}
+
+// Search queries the providers concurrently and merges their results,
+// taking each provider's next best result in turn, since scores from
+// different providers are not comparable. Duplicates found by several
+// providers (same DOI, PMID or title) are kept once, under the first
+// provider. Failed providers are reported in errs; the search fails only
+// when every provider does.
+func (r *EvidenceRegistry) Search(ctx context.Context, query EvidenceQuery, sources []string) ([]Evidence, map[string]string, error) {
+	providers, err := r.selected(sources)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(providers) == 0 {
+		return nil, nil, ClassifyError(ErrNotFound, fmt.Errorf("no evidence sources are configured"))
+	}
+	if query.Limit <= 0 {
+		query.Limit = defaultEvidenceResults
+	}
+
+	lists := make([][]Evidence, len(providers))
+	errs := make([]error, len(providers))
+	var wg sync.WaitGroup
+	for i, p := range providers {
+		wg.Add(1)
+		go func(i int, p EvidenceProvider) {
+			defer wg.Done()
+			lists[i], errs[i] = p.Search(ctx, query)
+		}(i, p)
+	}
+	wg.Wait()
+
+	failures := make(map[string]string)
+	var firstErr error
+	for i, err := range errs {
+		if err != nil {
+			failures[providers[i].Name()] = err.Error()
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	if len(failures) == len(providers) {
+		return nil, failures, firstErr
+	}
+
+	var merged []Evidence
+	seen := make(map[string]bool)
+	for rank := 0; len(merged) < query.Limit; rank++ {
+		more := false
+		for i, p := range providers {
+			if rank >= len(lists[i]) {
+				continue
+			}
+			more = true
+			ev := lists[i][rank]
+			ev.Source = p.Name()
+			ev.ID = p.Name() + ":" + ev.ID
+			if key := evidenceKey(ev); key != "" && seen[key] {
+				continue
+			} else if key != "" {
+				seen[key] = true
+			}
+			merged = append(merged, ev)
+			if len(merged) == query.Limit {
+				break
+			}
+		}
+		if !more {
+			break
+		}
+	}
+	return merged, failures, nil
+}
+
+// evidenceKey identifies a publication across providers.
+func evidenceKey(ev Evidence) string {
+	switch {
+	case ev.DOI != "":
+		return "doi:" + strings.ToLower(ev.DOI)
+	case ev.PMID != "":
+		return "pmid:" + ev.PMID
+	case ev.Title != "":
+		return "title:" + strings.Join(strings.FieldsFunc(strings.ToLower(ev.Title), func(r rune) bool {
+			return !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r > 0x2E80)
+		}), " ")
+	}
+	return ""
+}
+
+// Detail fetches an item by the prefixed ID Search returned.
+func (r *EvidenceRegistry) Detail(ctx context.Context, id string) (*EvidenceDetail, error) {
+	source, localID, ok := strings.Cut(id, ":")
+	if !ok || localID == "" {
+		return nil, ClassifyError(ErrInvalidArgs, fmt.Errorf("evidence id %q must be source:id as returned by evidence_search", id))
+	}
+	providers, err := r.selected([]string{source})
+	if err != nil {
+		return nil, err
+	}
+	detail, err := providers[0].GetDetail(ctx, localID)
+	if err != nil {
+		return nil, err
+	}
+	detail.Source = providers[0].Name()
+	detail.ID = providers[0].Name() + ":" + localID
+	return detail, nil
+}
+
+// Answer asks every selected provider that generates answers.
+func (r *EvidenceRegistry) Answer(ctx context.Context, question string, sources []string) ([]EvidenceAnswer, map[string]string, error) {
+	providers, err := r.selected(sources)
+	if err != nil {
+		return nil, nil, err
+	}
+	answers := make([]*EvidenceAnswer, len(providers))
+	errs := make([]error, len(providers))
+	var wg sync.WaitGroup
+	for i, p := range providers {
+		wg.Add(1)
+		go func(i int, p EvidenceProvider) {
+			defer wg.Done()
+			answers[i], errs[i] = p.Answer(ctx, question)
+		}(i, p)
+	}
+	wg.Wait()
+
+	var out []EvidenceAnswer
+	failures := make(map[string]string)
+	var firstErr error
+	for i, p := range providers {
+		switch {
+		case errors.Is(errs[i], ErrAnswerUnsupported):
+		case errs[i] != nil:
+			failures[p.Name()] = errs[i].Error()
+			if firstErr == nil {
+				firstErr = errs[i]
+			}
+		case answers[i] != nil:
+			a := *answers[i]
+			a.Source = p.Name()
+			for j := range a.Citations {
+				a.Citations[j].Source = p.Name()
+				a.Citations[j].ID = p.Name() + ":" + a.Citations[j].ID
+			}
+			out = append(out, a)
+		}
+	}
+	if len(out) == 0 {
+		if firstErr != nil {
+			return nil, failures, firstErr
+		}
+		return nil, failures, ClassifyError(ErrNotFound, fmt.Errorf("none of the evidence sources generates answers; use evidence_search and answer from the results"))
+	}
+	return out, failures, nil
+}
+
+// NewEvidenceTools returns evidence_search, evidence_detail and
+// evidence_answer over the providers in registry.
+func NewEvidenceTools(registry *EvidenceRegistry) []Tool {
+	return []Tool{
+		&EvidenceSearchTool{registry: registry},
+		&EvidenceDetailTool{registry: registry},
+		&EvidenceAnswerTool{registry: registry},
+	}
+}
+
+func evidenceSourcesParam(registry *EvidenceRegistry) map[string]interface{} {
+	names := registry.Names()
+	sort.Strings(names)
+	return map[string]interface{}{
+		"type":        "array",
+		"items":       map[string]interface{}{"type": "string", "enum": names},
+		"description": "Sources to use; all when omitted",
+	}
+}
+
+// EvidenceSearchTool searches every evidence provider at once.
+type EvidenceSearchTool struct {
+	registry *EvidenceRegistry
+}
+
+func (t *EvidenceSearchTool) Name() string {
+	return "evidence_search"
+}
+
+func (t *EvidenceSearchTool) Concurrent() bool {
+	return true
+}
+
+func (t *EvidenceSearchTool) Description() string {
+	return fmt.Sprintf("Search clinical evidence across all configured sources (%s) at once. "+
+		"Results are merged and labeled with their source; ids have the form source:id for evidence_detail. "+
+		"Cite the source and title of the evidence you use.", strings.Join(t.registry.Names(), ", "))
+}
+
+func (t *EvidenceSearchTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"query": map[string]interface{}{
+				"type":        "string",
+				"description": "The clinical question or keywords",
+			},
+			"sources": evidenceSourcesParam(t.registry),
+			"limit": map[string]interface{}{
+				"type":        "integer",
+				"description": "Maximum number of results (1-30, default 10)",
+				"minimum":     1,
+				"maximum":     maxEvidenceResults,
+			},
+		},
+		"required": []string{"query"},
+	}
+}
+
+type evidenceSearchArgs struct {
+	Query   string   `json:"query" arg:"required"`
+	Sources []string `json:"sources"`
+	Limit   int      `json:"limit" arg:"min=1,max=30,default=10"`
+}
+
+func (t *EvidenceSearchTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	a, err := BindArgs[evidenceSearchArgs](args)
+	if err != nil {
+		return ErrorResult(err.Error()).WithError(err)
+	}
+	results, failures, err := t.registry.Search(ctx, EvidenceQuery{Question: a.Query, Limit: a.Limit}, a.Sources)
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("evidence search failed: %v", err)).WithError(err)
+	}
+	out := map[string]interface{}{"results": results}
+	if results == nil {
+		out["results"] = []Evidence{}
+	}
+	if len(failures) > 0 {
+		out["failed_sources"] = failures
+	}
+	payload, _ := json.Marshal(out)
+	return NewToolResult(string(payload))
+}
+
+// EvidenceDetailTool fetches one item found by evidence_search.
+type EvidenceDetailTool struct {
+	registry *EvidenceRegistry
+}
+
+func (t *EvidenceDetailTool) Name() string {
+	return "evidence_detail"
+}
+
+func (t *EvidenceDetailTool) Concurrent() bool {
+	return true
+}
+
+func (t *EvidenceDetailTool) Description() string {
+	return "Get the full content of one evidence item (abstract, guideline passage or structured details) by the source:id returned by evidence_search."
+}
+
+func (t *EvidenceDetailTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"id": map[string]interface{}{
+				"type":        "string",
+				"description": "The id from evidence_search, e.g. pubmed:38127382",
+			},
+		},
+		"required": []string{"id"},
+	}
+}
+
+type evidenceDetailArgs struct {
+	ID string `json:"id" arg:"required"`
+}
+
+func (t *EvidenceDetailTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	a, err := BindArgs[evidenceDetailArgs](args)
+	if err != nil {
+		return ErrorResult(err.Error()).WithError(err)
+	}
+	detail, err := t.registry.Detail(ctx, a.ID)
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("evidence lookup failed: %v", err)).WithError(err)
+	}
+	payload, _ := json.Marshal(detail)
+	return NewToolResult(string(payload))
+}
+
+// EvidenceAnswerTool asks the providers that generate answers.
+type EvidenceAnswerTool struct {
+	registry *EvidenceRegistry
+}
+
+func (t *EvidenceAnswerTool) Name() string {
+	return "evidence_answer"
+}
+
+func (t *EvidenceAnswerTool) Concurrent() bool {
+	return true
+}
+
+func (t *EvidenceAnswerTool) Description() string {
+	return "Get evidence-based answers to a clinical question from the sources that generate answers, each labeled with its source and citations. " +
+		"Sources that only retrieve evidence are skipped; use evidence_search for them."
+}
+
+func (t *EvidenceAnswerTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"question": map[string]interface{}{
+				"type":        "string",
+				"description": "The clinical question",
+			},
+			"sources": evidenceSourcesParam(t.registry),
+		},
+		"required": []string{"question"},
+	}
+}
+
+type evidenceAnswerArgs struct {
+	Question string   `json:"question" arg:"required"`
+	Sources  []string `json:"sources"`
+}
+
+func (t *EvidenceAnswerTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	a, err := BindArgs[evidenceAnswerArgs](args)
+	if err != nil {
+		return ErrorResult(err.Error()).WithError(err)
+	}
+	answers, failures, err := t.registry.Answer(ctx, a.Question, a.Sources)
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("evidence answer failed: %v", err)).WithError(err)
+	}
+	out := map[string]interface{}{"answers": answers}
+	if len(failures) > 0 {
+		out["failed_sources"] = failures
+	}
+	payload, _ := json.Marshal(out)
+	return NewToolResult(string(payload))
+}
@@ -0,0 +1,74 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/rag"
+)
+
+// GuidelineEvidenceProvider searches the local document index built by
+// ingest_pdf, so guidelines a deployment has ingested are searched next
+// to the online sources. Users see shared documents and their own.
+type GuidelineEvidenceProvider struct {
+	store *rag.Store
+}
+
+func NewGuidelineEvidenceProvider(store *rag.Store) *GuidelineEvidenceProvider {
+	return &GuidelineEvidenceProvider{store: store}
+}
+
+func (p *GuidelineEvidenceProvider) Name() string {
+	return "guidelines"
+}
+
+func (p *GuidelineEvidenceProvider) Search(ctx context.Context, query EvidenceQuery) ([]Evidence, error) {
+	hits := p.store.Search(query.Question, rag.SearchOptions{User: documentUser(ctx), Limit: query.Limit})
+	out := make([]Evidence, len(hits))
+	for i, h := range hits {
+		out[i] = Evidence{
+			ID:      fmt.Sprintf("%s#%d", h.DocID, h.Index),
+			Type:    "guideline",
+			Title:   fmt.Sprintf("%s, page %d", h.Title, h.Page),
+			Snippet: truncateEvidence(h.Text),
+			Score:   h.Score,
+		}
+	}
+	return out, nil
+}
+
+// GetDetail returns a chunk with the chunks either side of it, so a
+// passage cut at a chunk boundary can be read in full.
+func (p *GuidelineEvidenceProvider) GetDetail(ctx context.Context, id string) (*EvidenceDetail, error) {
+	docID, index, ok := strings.Cut(id, "#")
+	n, err := strconv.Atoi(index)
+	if !ok || err != nil {
+		return nil, ClassifyError(ErrInvalidArgs, fmt.Errorf("%q is not a document passage id like doc-1a2b3c4d5e6f#3", id))
+	}
+	doc, found := p.store.Get(docID)
+	if !found || !doc.VisibleTo(documentUser(ctx)) || n < 0 || n >= len(doc.Chunks) {
+		return nil, ClassifyError(ErrNotFound, fmt.Errorf("passage %s not found", id))
+	}
+	var parts []string
+	for i := max(0, n-1); i <= min(len(doc.Chunks)-1, n+1); i++ {
+		parts = append(parts, doc.Chunks[i].Text)
+	}
+	detail := &EvidenceDetail{
+		Evidence: Evidence{
+			ID:    id,
+			Type:  "guideline",
+			Title: fmt.Sprintf("%s, page %d", doc.Title, doc.Chunks[n].Page),
+		},
+		Content: strings.Join(parts, "\n"),
+	}
+	if strings.HasPrefix(doc.Source, "http") {
+		detail.URL = doc.Source
+	}
+	return detail, nil
+}
+
+func (p *GuidelineEvidenceProvider) Answer(ctx context.Context, question string) (*EvidenceAnswer, error) {
+	return nil, ErrAnswerUnsupported
+}
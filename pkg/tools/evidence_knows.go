@@ -0,0 +1,146 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// knowsEvidenceTypes maps KnowS data scopes to evidence types.
+var knowsEvidenceTypes = map[string]string{
+	"PAPER":    "paper",
+	"PAPER_CN": "paper",
+	"GUIDE":    "guideline",
+	"MEETING":  "meeting abstract",
+}
+
+// KnowsEvidenceProvider serves the KnowS API as an evidence provider.
+type KnowsEvidenceProvider struct {
+	client       *knowsClient
+	defaultScope []string
+}
+
+// NewKnowsEvidenceProvider builds a provider from the same options as the
+// knows_* tools.
+func NewKnowsEvidenceProvider(opts KnowsToolOptions) (*KnowsEvidenceProvider, error) {
+	client, scope, err := newKnowsClient(opts)
+	if err != nil {
+		return nil, err
+	}
+	return &KnowsEvidenceProvider{client: client, defaultScope: scope}, nil
+}
+
+func (p *KnowsEvidenceProvider) Name() string {
+	return "knows"
+}
+
+func (p *KnowsEvidenceProvider) Search(ctx context.Context, query EvidenceQuery) ([]Evidence, error) {
+	raw, err := p.client.aiSearch(ctx, query.Question, p.defaultScope)
+	if err != nil {
+		return nil, err
+	}
+	var out []Evidence
+	for _, ev := range extractKnowsEvidences(raw) {
+		if e, ok := knowsEvidence(ev); ok {
+			out = append(out, e)
+		}
+		if query.Limit > 0 && len(out) == query.Limit {
+			break
+		}
+	}
+	return out, nil
+}
+
+func (p *KnowsEvidenceProvider) GetDetail(ctx context.Context, id string) (*EvidenceDetail, error) {
+	raw, err := p.client.evidenceSummary(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	detail := &EvidenceDetail{Evidence: Evidence{ID: id}, Data: raw}
+	if m, ok := raw.(map[string]interface{}); ok {
+		if e, ok := knowsEvidence(m); ok {
+			detail.Evidence = e
+			detail.ID = id
+		}
+		detail.Content = knowsField(m, "summary", "content", "abstract", "text")
+	}
+	return detail, nil
+}
+
+// Answer runs an ai_search for the question and a clinical answer on the
+// question_id it returns.
+func (p *KnowsEvidenceProvider) Answer(ctx context.Context, question string) (*EvidenceAnswer, error) {
+	raw, err := p.client.aiSearch(ctx, question, p.defaultScope)
+	if err != nil {
+		return nil, err
+	}
+	m, _ := raw.(map[string]interface{})
+	questionID := knowsField(m, "question_id")
+	if questionID == "" {
+		return nil, fmt.Errorf("knows search returned no question_id")
+	}
+	answerRaw, err := p.client.answer(ctx, questionID, "CLINICAL")
+	if err != nil {
+		return nil, err
+	}
+	answer := &EvidenceAnswer{}
+	switch v := answerRaw.(type) {
+	case string:
+		answer.Answer = v
+	case map[string]interface{}:
+		answer.Answer = knowsField(v, "answer", "content", "text", "data")
+	}
+	for _, ev := range extractKnowsEvidences(raw) {
+		if e, ok := knowsEvidence(ev); ok {
+			answer.Citations = append(answer.Citations, e)
+		}
+	}
+	return answer, nil
+}
+
+// knowsEvidence maps a KnowS evidence object to an Evidence.
+func knowsEvidence(m map[string]interface{}) (Evidence, bool) {
+	id := knowsEvidenceID(m)
+	if id == "" {
+		return Evidence{}, false
+	}
+	e := Evidence{
+		ID:      id,
+		Title:   knowsField(m, "title", "title_cn", "title_en", "name"),
+		Snippet: knowsField(m, "abstract", "summary", "content", "snippet"),
+		Journal: knowsField(m, "journal", "source", "publisher"),
+		DOI:     knowsField(m, "doi"),
+		PMID:    knowsField(m, "pmid"),
+		URL:     knowsField(m, "url", "link"),
+	}
+	if scope := strings.ToUpper(knowsField(m, "type", "data_scope", "evidence_type")); scope != "" {
+		if t, ok := knowsEvidenceTypes[scope]; ok {
+			e.Type = t
+		} else {
+			e.Type = strings.ToLower(scope)
+		}
+	}
+	if year := knowsField(m, "year", "publish_year", "pub_year", "publish_date", "pub_date"); len(year) >= 4 {
+		e.Year, _ = strconv.Atoi(year[:4])
+	}
+	if len([]rune(e.Snippet)) > 500 {
+		e.Snippet = string([]rune(e.Snippet)[:500]) + "…"
+	}
+	return e, true
+}
+
+// knowsField returns the first of keys that holds a string or number.
+func knowsField(m map[string]interface{}, keys ...string) string {
+	for _, key := range keys {
+		switch v := m[key].(type) {
+		case string:
+			if s := strings.TrimSpace(v); s != "" {
+				return s
+			}
+		case float64:
+			return strconv.FormatFloat(v, 'f', -1, 64)
+		}
+	}
+	return ""
+}
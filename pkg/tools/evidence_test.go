@@ -0,0 +1,248 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/rag"
+)
+
+type fakeEvidenceProvider struct {
+	name    string
+	results []Evidence
+	err     error
+	answer  *EvidenceAnswer
+}
+
+func (p *fakeEvidenceProvider) Name() string { return p.name }
+
+func (p *fakeEvidenceProvider) Search(ctx context.Context, query EvidenceQuery) ([]Evidence, error) {
+	return p.results, p.err
+}
+
+func (p *fakeEvidenceProvider) GetDetail(ctx context.Context, id string) (*EvidenceDetail, error) {
+	for _, e := range p.results {
+		if e.ID == id {
+			return &EvidenceDetail{Evidence: e, Content: "full text of " + id}, nil
+		}
+	}
+	return nil, ClassifyError(ErrNotFound, errors.New("no such item"))
+}
+
+func (p *fakeEvidenceProvider) Answer(ctx context.Context, question string) (*EvidenceAnswer, error) {
+	if p.answer == nil {
+		return nil, ErrAnswerUnsupported
+	}
+	return p.answer, p.err
+}
+
+func evidenceIDs(list []Evidence) []string {
+	ids := make([]string, len(list))
+	for i, e := range list {
+		ids[i] = e.ID
+	}
+	return ids
+}
+
+func TestEvidenceRegistry_SearchMergesAndLabels(t *testing.T) {
+	registry := NewEvidenceRegistry()
+	registry.Register(&fakeEvidenceProvider{name: "knows", results: []Evidence{
+		{ID: "k1", Title: "NAPOLI-3 trial", DOI: "10.1016/S0140-6736(23)01366-1"},
+		{ID: "k2", Title: "Olaparib maintenance"},
+	}})
+	registry.Register(&fakeEvidenceProvider{name: "pubmed", results: []Evidence{
+		{ID: "37708904", Title: "NALIRIFOX versus nab-paclitaxel", DOI: "10.1016/s0140-6736(23)01366-1"},
+		{ID: "31157963", Title: "POLO trial"},
+		{ID: "30000000", Title: "Olaparib  maintenance."},
+	}})
+	registry.Register(&fakeEvidenceProvider{name: "guidelines", err: errors.New("index offline")})
+
+	results, failures, err := registry.Search(context.Background(), EvidenceQuery{Question: "metastatic pancreatic cancer"}, nil)
+	if err != nil {
+		t.Fatalf("Search() error: %v", err)
+	}
+	want := []string{"knows:k1", "knows:k2", "pubmed:31157963"}
+	if got := evidenceIDs(results); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("ids = %v, want %v", got, want)
+	}
+	if results[2].Source != "pubmed" {
+		t.Errorf("source = %q, want pubmed", results[2].Source)
+	}
+	if failures["guidelines"] != "index offline" {
+		t.Errorf("failures = %v", failures)
+	}
+
+	results, _, err = registry.Search(context.Background(), EvidenceQuery{Question: "x", Limit: 2}, []string{"pubmed"})
+	if err != nil || len(results) != 2 || results[0].ID != "pubmed:37708904" {
+		t.Errorf("pubmed only = %v, %v", evidenceIDs(results), err)
+	}
+
+	if _, _, err := registry.Search(context.Background(), EvidenceQuery{Question: "x"}, []string{"cochrane"}); !errors.Is(err, ErrInvalidArgs) {
+		t.Errorf("unknown source error = %v, want ErrInvalidArgs", err)
+	}
+	if _, _, err := registry.Search(context.Background(), EvidenceQuery{Question: "x"}, []string{"guidelines"}); err == nil {
+		t.Error("expected an error when every provider fails")
+	}
+}
+
+func TestEvidenceRegistry_DetailAndAnswer(t *testing.T) {
+	registry := NewEvidenceRegistry()
+	registry.Register(&fakeEvidenceProvider{name: "pubmed", results: []Evidence{{ID: "31157963", Title: "POLO trial"}}})
+	registry.Register(&fakeEvidenceProvider{name: "knows", answer: &EvidenceAnswer{
+		Answer:    "Olaparib maintenance prolongs progression-free survival in germline BRCA carriers.",
+		Citations: []Evidence{{ID: "k9", Title: "POLO trial"}},
+	}})
+
+	detail, err := registry.Detail(context.Background(), "pubmed:31157963")
+	if err != nil {
+		t.Fatalf("Detail() error: %v", err)
+	}
+	if detail.ID != "pubmed:31157963" || detail.Source != "pubmed" || detail.Content != "full text of 31157963" {
+		t.Errorf("detail = %+v", detail)
+	}
+	for _, id := range []string{"31157963", "pubmed:"} {
+		if _, err := registry.Detail(context.Background(), id); !errors.Is(err, ErrInvalidArgs) {
+			t.Errorf("Detail(%q) error = %v, want ErrInvalidArgs", id, err)
+		}
+	}
+
+	answers, failures, err := registry.Answer(context.Background(), "Is olaparib useful?", nil)
+	if err != nil {
+		t.Fatalf("Answer() error: %v", err)
+	}
+	if len(answers) != 1 || answers[0].Source != "knows" || answers[0].Citations[0].ID != "knows:k9" || len(failures) != 0 {
+		t.Errorf("answers = %+v, failures = %v", answers, failures)
+	}
+	if _, _, err := registry.Answer(context.Background(), "Is olaparib useful?", []string{"pubmed"}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("retrieval-only answer error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestEvidenceSearchTool(t *testing.T) {
+	registry := NewEvidenceRegistry()
+	registry.Register(&fakeEvidenceProvider{name: "pubmed", results: []Evidence{{ID: "1", Title: "A"}, {ID: "2", Title: "B"}}})
+	registry.Register(&fakeEvidenceProvider{name: "knows", err: errors.New("quota exceeded")})
+	search := NewEvidenceTools(registry)[0]
+
+	result := search.Execute(context.Background(), map[string]interface{}{"query": "PERT dosing", "limit": 1})
+	if result.IsError {
+		t.Fatalf("evidence_search: %s", result.ForLLM)
+	}
+	var out struct {
+		Results       []Evidence        `json:"results"`
+		FailedSources map[string]string `json:"failed_sources"`
+	}
+	if err := json.Unmarshal([]byte(result.ForLLM), &out); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if len(out.Results) != 1 || out.Results[0].ID != "pubmed:1" || out.FailedSources["knows"] != "quota exceeded" {
+		t.Errorf("result = %s", result.ForLLM)
+	}
+
+	result = search.Execute(context.Background(), map[string]interface{}{})
+	if !result.IsError || !errors.Is(result.Err, ErrInvalidArgs) {
+		t.Errorf("missing query: %+v", result)
+	}
+}
+
+func TestPubMedProvider(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("api_key") != "key" {
+			t.Errorf("missing api_key in %s", r.URL.RawQuery)
+		}
+		switch r.URL.Path {
+		case "/esearch.fcgi":
+			w.Write([]byte(`{"esearchresult":{"idlist":["31157963","99"]}}`))
+		case "/esummary.fcgi":
+			w.Write([]byte(`{"result":{"uids":["31157963"],"31157963":{
+				"title":"Maintenance Olaparib for Germline BRCA-Mutated Metastatic Pancreatic Cancer.",
+				"pubdate":"2019 Jul 25","source":"N Engl J Med","fulljournalname":"The New England journal of medicine",
+				"pubtype":["Journal Article","Randomized Controlled Trial"],
+				"articleids":[{"idtype":"pubmed","value":"31157963"},{"idtype":"doi","value":"10.1056/NEJMoa1903387"}]}}}`))
+		case "/efetch.fcgi":
+			w.Write([]byte("1. N Engl J Med. 2019;381(4):317-327.\n\nBACKGROUND: Patients with a germline BRCA1 or BRCA2 mutation...\n"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	provider := NewPubMedProvider(PubMedOptions{BaseURL: server.URL, APIKey: "key"})
+
+	results, err := provider.Search(context.Background(), EvidenceQuery{Question: "olaparib pancreatic", Limit: 5})
+	if err != nil {
+		t.Fatalf("Search() error: %v", err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("results = %+v, want the one PMID with a summary", results)
+	}
+	got := results[0]
+	if got.PMID != "31157963" || got.Year != 2019 || got.Type != "randomized trial" ||
+		got.DOI != "10.1056/NEJMoa1903387" || got.Journal != "The New England journal of medicine" {
+		t.Errorf("result = %+v", got)
+	}
+
+	detail, err := provider.GetDetail(context.Background(), "31157963")
+	if err != nil {
+		t.Fatalf("GetDetail() error: %v", err)
+	}
+	if !strings.Contains(detail.Content, "BACKGROUND") || detail.Title == "" {
+		t.Errorf("detail = %+v", detail)
+	}
+	if _, err := provider.GetDetail(context.Background(), "99"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("unknown PMID error = %v, want ErrNotFound", err)
+	}
+	if _, err := provider.GetDetail(context.Background(), "abc"); !errors.Is(err, ErrInvalidArgs) {
+		t.Errorf("bad PMID error = %v, want ErrInvalidArgs", err)
+	}
+	if _, err := provider.Answer(context.Background(), "q"); !errors.Is(err, ErrAnswerUnsupported) {
+		t.Errorf("Answer() error = %v, want ErrAnswerUnsupported", err)
+	}
+}
+
+func TestGuidelineEvidenceProvider(t *testing.T) {
+	store, err := rag.Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("rag.Open() error: %v", err)
+	}
+	chunks := []rag.Chunk{
+		{Index: 0, Page: 1, Text: "Pancreatic enzyme replacement therapy improves nutrition."},
+		{Index: 1, Page: 1, Text: "Start with 40000 lipase units per main meal."},
+		{Index: 2, Page: 2, Text: "Add 20000 units with snacks."},
+	}
+	store.Add(&rag.Document{ID: "doc-shared", Title: "PERT guideline", Source: "pert.pdf", Shared: true, Pages: 2, Chunks: chunks})
+	store.Add(&rag.Document{ID: "doc-private", Title: "Discharge", Owner: "111", Pages: 1,
+		Chunks: []rag.Chunk{{Index: 0, Page: 1, Text: "Continue lipase units with meals."}}})
+	provider := NewGuidelineEvidenceProvider(store)
+
+	results, err := provider.Search(asUser("222"), EvidenceQuery{Question: "lipase units meal", Limit: 5})
+	if err != nil {
+		t.Fatalf("Search() error: %v", err)
+	}
+	for _, r := range results {
+		if strings.HasPrefix(r.ID, "doc-private") {
+			t.Errorf("another user's document was returned: %+v", r)
+		}
+	}
+	if len(results) == 0 || results[0].ID != "doc-shared#1" || results[0].Type != "guideline" {
+		t.Errorf("results = %+v", results)
+	}
+
+	detail, err := provider.GetDetail(asUser("222"), "doc-shared#1")
+	if err != nil {
+		t.Fatalf("GetDetail() error: %v", err)
+	}
+	if !strings.Contains(detail.Content, "improves nutrition") || !strings.Contains(detail.Content, "snacks") || detail.URL != "" {
+		t.Errorf("detail = %+v", detail)
+	}
+	if _, err := provider.GetDetail(asUser("222"), "doc-private#0"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("private passage error = %v, want ErrNotFound", err)
+	}
+	if _, err := provider.GetDetail(asUser("222"), "doc-shared"); !errors.Is(err, ErrInvalidArgs) {
+		t.Errorf("malformed id error = %v, want ErrInvalidArgs", err)
+	}
+}
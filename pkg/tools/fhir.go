@@ -0,0 +1,271 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	defaultFHIRObservations = 20
+	maxFHIRObservations     = 100
+)
+
+var (
+	// fhirIDPattern is the FHIR id datatype; anything else could reach
+	// another path on the server.
+	fhirIDPattern = regexp.MustCompile(`^[A-Za-z0-9\-.]{1,64}$`)
+	// fhirCodePattern matches codes searched by token rather than text: a
+	// LOINC code such as 2857-1, or system|code.
+	fhirCodePattern = regexp.MustCompile(`^(\d+-\d|[^\s|]*\|[^\s|]+)$`)
+)
+
+// FHIROptions configures the FHIR tools.
+type FHIROptions struct {
+	BaseURL string
+	Auth    FHIRAuthOptions
+	// Patients links chat users, by sender ID, to their Patient resource
+	// ID. A linked user can only read their own record.
+	Patients map[string]string
+	// Clinicians are the sender IDs that may read any patient by ID.
+	Clinicians []string
+	Timeout    time.Duration
+}
+
+// fhirClient reads resources from a FHIR R4 server for the FHIR tools and
+// decides which patient a call may read.
+type fhirClient struct {
+	baseURL    string
+	auth       *fhirTokenSource
+	httpClient *http.Client
+	patients   map[string]string
+	clinicians map[string]bool
+}
+
+// NewFHIRTools returns fhir_get_patient, fhir_search_observations and
+// fhir_get_medications. The tools only read.
+func NewFHIRTools(opts FHIROptions) ([]Tool, error) {
+	baseURL := strings.TrimRight(strings.TrimSpace(opts.BaseURL), "/")
+	if baseURL == "" {
+		return nil, fmt.Errorf("fhir base_url is required")
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 20 * time.Second
+	}
+	httpClient := &http.Client{Timeout: opts.Timeout}
+	auth, err := newFHIRTokenSource(opts.Auth, baseURL, httpClient)
+	if err != nil {
+		return nil, err
+	}
+	for user, id := range opts.Patients {
+		if !fhirIDPattern.MatchString(id) {
+			return nil, fmt.Errorf("fhir patient id %q for %s is not a valid FHIR id", id, user)
+		}
+	}
+	client := &fhirClient{
+		baseURL:    baseURL,
+		auth:       auth,
+		httpClient: httpClient,
+		patients:   opts.Patients,
+		clinicians: make(map[string]bool, len(opts.Clinicians)),
+	}
+	for _, user := range opts.Clinicians {
+		client.clinicians[user] = true
+	}
+	return []Tool{
+		&FHIRPatientTool{client: client},
+		&FHIRObservationsTool{client: client},
+		&FHIRMedicationsTool{client: client},
+	}, nil
+}
+
+// patientFor returns the patient a call may read. Clinicians may name any
+// patient; other users only get the patient linked to them.
+func (c *fhirClient) patientFor(ctx context.Context, requested string) (string, *ToolResult) {
+	user := CallMetadataFromContext(ctx).UserID
+	id, _, _ := strings.Cut(user, "|")
+	linked := c.patients[user]
+	if linked == "" {
+		linked = c.patients[id]
+	}
+
+	if user != "" && (c.clinicians[user] || c.clinicians[id]) {
+		if requested == "" {
+			requested = linked
+		}
+		if requested == "" {
+			err := ClassifyError(ErrInvalidArgs, errors.New("patient_id is required"))
+			return "", ErrorResult(err.Error()).WithError(err)
+		}
+		if !fhirIDPattern.MatchString(requested) {
+			err := ClassifyError(ErrInvalidArgs, fmt.Errorf("patient_id %q is not a valid FHIR id", requested))
+			return "", ErrorResult(err.Error()).WithError(err)
+		}
+		return requested, nil
+	}
+
+	if linked == "" {
+		err := ClassifyError(ErrPermissionDenied, errors.New("no patient record is linked to this user"))
+		result := ErrorResult(err.Error()).WithError(err)
+		result.ForUser = "Your account is not linked to a hospital record, so I can't look it up. Ask your care team to link it."
+		return "", result
+	}
+	if requested != "" && requested != linked {
+		err := ClassifyError(ErrPermissionDenied, errors.New("users may only read their own patient record"))
+		return "", ErrorResult(err.Error()).WithError(err)
+	}
+	return linked, nil
+}
+
+// get fetches path from the server into out. The access token is renewed
+// once if the server rejects it.
+func (c *fhirClient) get(ctx context.Context, path string, query url.Values, out interface{}) error {
+	rawURL := c.baseURL + "/" + path
+	if len(query) > 0 {
+		rawURL += "?" + query.Encode()
+	}
+	for attempt := 0; ; attempt++ {
+		token, err := c.auth.Token(ctx)
+		if err != nil {
+			return err
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Accept", "application/fhir+json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			return requestError(ctx, err)
+		}
+		if resp.StatusCode == http.StatusUnauthorized && attempt == 0 && c.auth.opts.Type != FHIRAuthBearer && c.auth.opts.Type != FHIRAuthNone {
+			resp.Body.Close()
+			c.auth.Invalidate()
+			continue
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+			return ClassifyError(StatusErrorKind(resp.StatusCode),
+				fmt.Errorf("fhir server returned %d for %s: %s", resp.StatusCode, strings.SplitN(path, "?", 2)[0], strings.TrimSpace(string(body))))
+		}
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return fmt.Errorf("invalid fhir response: %w", err)
+		}
+		return nil
+	}
+}
+
+// search runs a search and returns the matching resources and the included
+// ones, keyed by type/id.
+func (c *fhirClient) search(ctx context.Context, resourceType string, query url.Values) (matches []json.RawMessage, included map[string]json.RawMessage, more bool, err error) {
+	var bundle struct {
+		Link []struct {
+			Relation string `json:"relation"`
+		} `json:"link"`
+		Entry []struct {
+			Resource json.RawMessage `json:"resource"`
+			Search   struct {
+				Mode string `json:"mode"`
+			} `json:"search"`
+		} `json:"entry"`
+	}
+	if err := c.get(ctx, resourceType, query, &bundle); err != nil {
+		return nil, nil, false, err
+	}
+	included = make(map[string]json.RawMessage)
+	for _, entry := range bundle.Entry {
+		if entry.Search.Mode == "include" {
+			var ref struct {
+				ResourceType string `json:"resourceType"`
+				ID           string `json:"id"`
+			}
+			if json.Unmarshal(entry.Resource, &ref) == nil {
+				included[ref.ResourceType+"/"+ref.ID] = entry.Resource
+			}
+			continue
+		}
+		matches = append(matches, entry.Resource)
+	}
+	for _, link := range bundle.Link {
+		if link.Relation == "next" {
+			more = true
+		}
+	}
+	return matches, included, more, nil
+}
+
+// FHIR R4 datatypes, reduced to the fields the tools report.
+
+type fhirCoding struct {
+	System  string `json:"system"`
+	Code    string `json:"code"`
+	Display string `json:"display"`
+}
+
+type fhirCodeableConcept struct {
+	Coding []fhirCoding `json:"coding"`
+	Text   string       `json:"text"`
+}
+
+// String is the concept's text, or its first coding's display or code.
+func (c *fhirCodeableConcept) String() string {
+	if c == nil {
+		return ""
+	}
+	if c.Text != "" {
+		return c.Text
+	}
+	for _, coding := range c.Coding {
+		if coding.Display != "" {
+			return coding.Display
+		}
+	}
+	for _, coding := range c.Coding {
+		if coding.Code != "" {
+			return coding.Code
+		}
+	}
+	return ""
+}
+
+type fhirQuantity struct {
+	Value      *float64 `json:"value"`
+	Comparator string   `json:"comparator"`
+	Unit       string   `json:"unit"`
+	Code       string   `json:"code"`
+}
+
+func (q *fhirQuantity) unit() string {
+	if q.Unit != "" {
+		return q.Unit
+	}
+	return q.Code
+}
+
+type fhirReference struct {
+	Reference string `json:"reference"`
+	Display   string `json:"display"`
+}
+
+func (r fhirReference) String() string {
+	if r.Display != "" {
+		return r.Display
+	}
+	return r.Reference
+}
+
+// fhirErrorResult turns a failed request into a tool result.
+func fhirErrorResult(err error) *ToolResult {
+	return ErrorResult(err.Error()).WithError(err)
+}
@@ -0,0 +1,241 @@
+package tools
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FHIR auth types.
+const (
+	FHIRAuthNone              = "none"
+	FHIRAuthBearer            = "bearer"
+	FHIRAuthClientCredentials = "client_credentials"
+	// FHIRAuthSMARTBackend is SMART Backend Services: client credentials
+	// with a JWT signed by the client's private key (RS384).
+	FHIRAuthSMARTBackend = "smart_backend"
+)
+
+// FHIRAuthOptions configures how the FHIR tools authenticate. TokenURL may
+// be left empty for the OAuth types, in which case it is read from the
+// server's .well-known/smart-configuration.
+type FHIRAuthOptions struct {
+	Type           string
+	Token          string
+	TokenURL       string
+	ClientID       string
+	ClientSecret   string
+	Scope          string
+	PrivateKeyPath string
+	KeyID          string
+}
+
+// fhirTokenSource supplies the bearer token for FHIR requests, fetching
+// and caching OAuth access tokens as needed.
+type fhirTokenSource struct {
+	opts    FHIRAuthOptions
+	baseURL string
+	key     *rsa.PrivateKey
+	client  *http.Client
+
+	mu        sync.Mutex
+	token     string
+	expiresAt time.Time
+}
+
+func newFHIRTokenSource(opts FHIRAuthOptions, baseURL string, client *http.Client) (*fhirTokenSource, error) {
+	if opts.Type == "" {
+		opts.Type = FHIRAuthNone
+	}
+	s := &fhirTokenSource{opts: opts, baseURL: baseURL, client: client}
+	switch opts.Type {
+	case FHIRAuthNone:
+	case FHIRAuthBearer:
+		if opts.Token == "" {
+			return nil, fmt.Errorf("fhir auth token is required for bearer auth")
+		}
+	case FHIRAuthClientCredentials:
+		if opts.ClientID == "" || opts.ClientSecret == "" {
+			return nil, fmt.Errorf("fhir auth client_id and client_secret are required for client_credentials auth")
+		}
+	case FHIRAuthSMARTBackend:
+		if opts.ClientID == "" || opts.PrivateKeyPath == "" {
+			return nil, fmt.Errorf("fhir auth client_id and private_key_path are required for smart_backend auth")
+		}
+		key, err := loadRSAPrivateKey(opts.PrivateKeyPath)
+		if err != nil {
+			return nil, err
+		}
+		s.key = key
+	default:
+		return nil, fmt.Errorf("unknown fhir auth type %q", opts.Type)
+	}
+	return s, nil
+}
+
+// Token returns the bearer token to send, or "" when no auth is configured.
+func (s *fhirTokenSource) Token(ctx context.Context) (string, error) {
+	switch s.opts.Type {
+	case FHIRAuthNone:
+		return "", nil
+	case FHIRAuthBearer:
+		return s.opts.Token, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.token != "" && time.Now().Before(s.expiresAt) {
+		return s.token, nil
+	}
+	if s.opts.TokenURL == "" {
+		tokenURL, err := s.discoverTokenURL(ctx)
+		if err != nil {
+			return "", err
+		}
+		s.opts.TokenURL = tokenURL
+	}
+
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if s.opts.Scope != "" {
+		form.Set("scope", s.opts.Scope)
+	}
+	if s.key != nil {
+		assertion, err := s.clientAssertion()
+		if err != nil {
+			return "", err
+		}
+		form.Set("client_assertion_type", "urn:ietf:params:oauth:client-assertion-type:jwt-bearer")
+		form.Set("client_assertion", assertion)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.opts.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if s.key == nil {
+		req.SetBasicAuth(url.QueryEscape(s.opts.ClientID), url.QueryEscape(s.opts.ClientSecret))
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", requestError(ctx, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		kind := StatusErrorKind(resp.StatusCode)
+		if resp.StatusCode == http.StatusBadRequest {
+			// invalid_client and invalid_scope are configuration problems,
+			// not something the model can fix.
+			kind = ErrPermissionDenied
+		}
+		return "", ClassifyError(kind, fmt.Errorf("fhir token request returned %d: %s", resp.StatusCode, strings.TrimSpace(string(body))))
+	}
+	var decoded struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&decoded); err != nil || decoded.AccessToken == "" {
+		return "", fmt.Errorf("invalid fhir token response")
+	}
+	if decoded.ExpiresIn <= 0 {
+		decoded.ExpiresIn = 300
+	}
+	s.token = decoded.AccessToken
+	// Renew a little early so a token never expires mid-request.
+	s.expiresAt = time.Now().Add(time.Duration(decoded.ExpiresIn) * time.Second * 9 / 10)
+	return s.token, nil
+}
+
+// Invalidate drops a cached access token the server rejected.
+func (s *fhirTokenSource) Invalidate() {
+	s.mu.Lock()
+	s.token = ""
+	s.mu.Unlock()
+}
+
+func (s *fhirTokenSource) discoverTokenURL(ctx context.Context) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.baseURL+"/.well-known/smart-configuration", nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", requestError(ctx, err)
+	}
+	defer resp.Body.Close()
+	var decoded struct {
+		TokenEndpoint string `json:"token_endpoint"`
+	}
+	if resp.StatusCode != http.StatusOK || json.NewDecoder(resp.Body).Decode(&decoded) != nil || decoded.TokenEndpoint == "" {
+		return "", fmt.Errorf("fhir token_url is not set and the server has no smart-configuration")
+	}
+	return decoded.TokenEndpoint, nil
+}
+
+// clientAssertion signs the JWT that authenticates a SMART backend client.
+func (s *fhirTokenSource) clientAssertion() (string, error) {
+	jti := make([]byte, 16)
+	if _, err := rand.Read(jti); err != nil {
+		return "", err
+	}
+	header := map[string]string{"alg": "RS384", "typ": "JWT"}
+	if s.opts.KeyID != "" {
+		header["kid"] = s.opts.KeyID
+	}
+	claims := map[string]interface{}{
+		"iss": s.opts.ClientID,
+		"sub": s.opts.ClientID,
+		"aud": s.opts.TokenURL,
+		"exp": time.Now().Add(5 * time.Minute).Unix(),
+		"jti": hex.EncodeToString(jti),
+	}
+	headerJSON, _ := json.Marshal(header)
+	claimsJSON, _ := json.Marshal(claims)
+	signingInput := base64.RawURLEncoding.EncodeToString(headerJSON) + "." + base64.RawURLEncoding.EncodeToString(claimsJSON)
+	digest := sha512.Sum384([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, s.key, crypto.SHA384, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign client assertion: %w", err)
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+func loadRSAPrivateKey(path string) (*rsa.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fhir private key: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("fhir private key %s is not PEM", path)
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse fhir private key: %w", err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("fhir private key must be an RSA key")
+	}
+	return key, nil
+}
@@ -0,0 +1,257 @@
+package tools
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// fhirTestServer serves one patient, p1, with an observation and a
+// medication request that references an included Medication.
+func fhirTestServer(t *testing.T, requireToken string) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requireToken != "" && r.Header.Get("Authorization") != "Bearer "+requireToken {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch {
+		case r.URL.Path == "/Patient/p1":
+			w.Write([]byte(`{"resourceType": "Patient", "id": "p1", "gender": "female", "birthDate": "1961-04-02",
+				"name": [{"use": "nickname", "text": "Lin"}, {"use": "official", "family": "Wang", "given": ["Lin"]}],
+				"identifier": [{"type": {"text": "MRN"}, "value": "00123"}]}`))
+		case r.URL.Path == "/Observation":
+			q := r.URL.Query()
+			if q.Get("patient") != "p1" || q.Get("_sort") != "-date" || q.Get("_count") != "20" {
+				t.Errorf("unexpected observation query: %s", r.URL.RawQuery)
+			}
+			if q.Get("code") != "24108-3" && q.Get("code:text") != "CA 19-9" {
+				t.Errorf("unexpected code filter: %s", r.URL.RawQuery)
+			}
+			w.Write([]byte(`{"resourceType": "Bundle", "link": [{"relation": "next", "url": "x"}], "entry": [{"resource": {
+				"resourceType": "Observation", "id": "o1", "status": "final",
+				"code": {"coding": [{"system": "http://loinc.org", "code": "24108-3", "display": "CA 19-9"}]},
+				"effectiveDateTime": "2024-05-01",
+				"valueQuantity": {"value": 125.3, "unit": "U/mL"},
+				"interpretation": [{"coding": [{"code": "H", "display": "High"}]}],
+				"referenceRange": [{"high": {"value": 37}}]}}]}`))
+		case r.URL.Path == "/MedicationRequest":
+			if r.URL.Query().Get("status") != "active" {
+				t.Errorf("unexpected medication query: %s", r.URL.RawQuery)
+			}
+			w.Write([]byte(`{"resourceType": "Bundle", "entry": [
+				{"resource": {"resourceType": "MedicationRequest", "id": "m1", "status": "active", "intent": "order",
+					"authoredOn": "2024-04-20", "medicationReference": {"reference": "Medication/med1"},
+					"dosageInstruction": [{"text": "25,000 units with each meal"}], "requester": {"display": "Dr Chen"}},
+				 "search": {"mode": "match"}},
+				{"resource": {"resourceType": "Medication", "id": "med1", "code": {"text": "Pancrelipase"}},
+				 "search": {"mode": "include"}}]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func fhirTestTools(t *testing.T, opts FHIROptions) map[string]Tool {
+	t.Helper()
+	list, err := NewFHIRTools(opts)
+	if err != nil {
+		t.Fatalf("NewFHIRTools() error: %v", err)
+	}
+	byName := make(map[string]Tool)
+	for _, tool := range list {
+		byName[tool.Name()] = tool
+	}
+	return byName
+}
+
+func asUser(user string) context.Context {
+	return WithCallMetadata(context.Background(), CallMetadata{UserID: user})
+}
+
+func TestFHIRTools_PatientScope(t *testing.T) {
+	server := fhirTestServer(t, "")
+	defer server.Close()
+	tools := fhirTestTools(t, FHIROptions{
+		BaseURL:    server.URL,
+		Patients:   map[string]string{"111": "p1", "222": "p2"},
+		Clinicians: []string{"999"},
+	})
+
+	tests := []struct {
+		name     string
+		user     string
+		args     map[string]interface{}
+		wantKind error
+	}{
+		{name: "own record", user: "111|alice", args: map[string]interface{}{}},
+		{name: "own record by id", user: "111", args: map[string]interface{}{"patient_id": "p1"}},
+		{name: "another patient", user: "222", args: map[string]interface{}{"patient_id": "p1"}, wantKind: ErrPermissionDenied},
+		{name: "unlinked user", user: "333", args: map[string]interface{}{}, wantKind: ErrPermissionDenied},
+		{name: "clinician", user: "999", args: map[string]interface{}{"patient_id": "p1"}},
+		{name: "clinician without id", user: "999", args: map[string]interface{}{}, wantKind: ErrInvalidArgs},
+		{name: "clinician bad id", user: "999", args: map[string]interface{}{"patient_id": "../Practitioner/1"}, wantKind: ErrInvalidArgs},
+		{name: "missing patient", user: "999", args: map[string]interface{}{"patient_id": "p404"}, wantKind: ErrNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := tools["fhir_get_patient"].Execute(asUser(tt.user), tt.args)
+			if tt.wantKind != nil {
+				if !errors.Is(result.Err, tt.wantKind) {
+					t.Fatalf("Err = %v, want %v", result.Err, tt.wantKind)
+				}
+				return
+			}
+			if result.IsError {
+				t.Fatalf("unexpected error: %s", result.ForLLM)
+			}
+			var out map[string]interface{}
+			json.Unmarshal([]byte(result.ForLLM), &out)
+			if out["name"] != "Lin Wang" || out["birth_date"] != "1961-04-02" {
+				t.Errorf("unexpected patient: %s", result.ForLLM)
+			}
+		})
+	}
+}
+
+func TestFHIRSearchObservations(t *testing.T) {
+	server := fhirTestServer(t, "")
+	defer server.Close()
+	tool := fhirTestTools(t, FHIROptions{BaseURL: server.URL, Patients: map[string]string{"111": "p1"}})["fhir_search_observations"]
+
+	for _, code := range []string{"24108-3", "CA 19-9"} {
+		result := tool.Execute(asUser("111"), map[string]interface{}{"code": code})
+		if result.IsError {
+			t.Fatalf("code %q: unexpected error: %s", code, result.ForLLM)
+		}
+		var out struct {
+			Observations []map[string]interface{} `json:"observations"`
+			More         bool                     `json:"more"`
+		}
+		if err := json.Unmarshal([]byte(result.ForLLM), &out); err != nil {
+			t.Fatalf("invalid result: %v", err)
+		}
+		if len(out.Observations) != 1 || !out.More {
+			t.Fatalf("unexpected result: %s", result.ForLLM)
+		}
+		o := out.Observations[0]
+		if o["code"] != "24108-3" || o["value"] != 125.3 || o["unit"] != "U/mL" ||
+			o["reference_range"] != "<=37" || o["interpretation"] != "High" || o["date"] != "2024-05-01" {
+			t.Errorf("unexpected observation: %v", o)
+		}
+	}
+
+	if result := tool.Execute(asUser("111"), map[string]interface{}{"since": "May 2024"}); !errors.Is(result.Err, ErrInvalidArgs) {
+		t.Errorf("bad since: Err = %v, want ErrInvalidArgs", result.Err)
+	}
+}
+
+func TestFHIRGetMedications(t *testing.T) {
+	server := fhirTestServer(t, "")
+	defer server.Close()
+	tool := fhirTestTools(t, FHIROptions{BaseURL: server.URL, Patients: map[string]string{"111": "p1"}})["fhir_get_medications"]
+
+	result := tool.Execute(asUser("111"), map[string]interface{}{})
+	if result.IsError {
+		t.Fatalf("unexpected error: %s", result.ForLLM)
+	}
+	for _, want := range []string{`"drug":"Pancrelipase"`, `"dosage":"25,000 units with each meal"`, `"prescriber":"Dr Chen"`} {
+		if !strings.Contains(result.ForLLM, want) {
+			t.Errorf("result missing %s: %s", want, result.ForLLM)
+		}
+	}
+}
+
+func TestFHIRTools_SMARTBackendAuth(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	keyPath := filepath.Join(t.TempDir(), "key.pem")
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	if err := os.WriteFile(keyPath, keyPEM, 0600); err != nil {
+		t.Fatalf("write key: %v", err)
+	}
+
+	var tokenRequests int32
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&tokenRequests, 1)
+		r.ParseForm()
+		if r.Form.Get("grant_type") != "client_credentials" || r.Form.Get("scope") != "system/Patient.read" {
+			t.Errorf("unexpected token request: %v", r.Form)
+		}
+		parts := strings.Split(r.Form.Get("client_assertion"), ".")
+		if len(parts) != 3 {
+			t.Fatalf("client_assertion is not a JWT: %q", r.Form.Get("client_assertion"))
+		}
+		digest := sha512.Sum384([]byte(parts[0] + "." + parts[1]))
+		signature, _ := base64.RawURLEncoding.DecodeString(parts[2])
+		if err := rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA384, digest[:], signature); err != nil {
+			t.Errorf("bad assertion signature: %v", err)
+		}
+		claimsJSON, _ := base64.RawURLEncoding.DecodeString(parts[1])
+		var claims map[string]interface{}
+		json.Unmarshal(claimsJSON, &claims)
+		if claims["iss"] != "picoclaw" || claims["sub"] != "picoclaw" || claims["aud"] != "http://"+r.Host+"/token" {
+			t.Errorf("unexpected claims: %v", claims)
+		}
+		w.Write([]byte(`{"access_token": "tok", "token_type": "bearer", "expires_in": 300}`))
+	}))
+	defer tokenServer.Close()
+	server := fhirTestServer(t, "tok")
+	defer server.Close()
+
+	tool := fhirTestTools(t, FHIROptions{
+		BaseURL: server.URL,
+		Auth: FHIRAuthOptions{
+			Type:           FHIRAuthSMARTBackend,
+			TokenURL:       tokenServer.URL + "/token",
+			ClientID:       "picoclaw",
+			Scope:          "system/Patient.read",
+			PrivateKeyPath: keyPath,
+		},
+		Patients: map[string]string{"111": "p1"},
+	})["fhir_get_patient"]
+
+	for i := 0; i < 2; i++ {
+		if result := tool.Execute(asUser("111"), map[string]interface{}{}); result.IsError {
+			t.Fatalf("unexpected error: %s", result.ForLLM)
+		}
+	}
+	if n := atomic.LoadInt32(&tokenRequests); n != 1 {
+		t.Errorf("token requested %d times, want 1", n)
+	}
+}
+
+func TestNewFHIRTools_InvalidConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		opts FHIROptions
+	}{
+		{name: "no base url", opts: FHIROptions{}},
+		{name: "bearer without token", opts: FHIROptions{BaseURL: "http://x", Auth: FHIRAuthOptions{Type: FHIRAuthBearer}}},
+		{name: "missing key file", opts: FHIROptions{BaseURL: "http://x", Auth: FHIRAuthOptions{Type: FHIRAuthSMARTBackend, ClientID: "c", PrivateKeyPath: "/nonexistent.pem"}}},
+		{name: "bad patient id", opts: FHIROptions{BaseURL: "http://x", Patients: map[string]string{"1": "a/b"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewFHIRTools(tt.opts); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
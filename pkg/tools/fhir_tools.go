@@ -0,0 +1,495 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var fhirPatientIDParam = map[string]interface{}{
+	"type":        "string",
+	"description": "FHIR Patient ID. Leave empty for the user's own record; only clinicians may name another patient",
+}
+
+// FHIRPatientTool reads a patient's demographics.
+type FHIRPatientTool struct {
+	client *fhirClient
+}
+
+func (t *FHIRPatientTool) Name() string {
+	return "fhir_get_patient"
+}
+
+func (t *FHIRPatientTool) Description() string {
+	return "Read the patient's demographics from the hospital record (FHIR): name, sex, date of birth and record numbers. " +
+		"Use it to confirm whose record you are reading before quoting results from it."
+}
+
+func (t *FHIRPatientTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"patient_id": fhirPatientIDParam,
+		},
+	}
+}
+
+type fhirPatientArgs struct {
+	PatientID string `json:"patient_id"`
+}
+
+type fhirPatient struct {
+	ID   string `json:"id"`
+	Name []struct {
+		Use    string   `json:"use"`
+		Text   string   `json:"text"`
+		Family string   `json:"family"`
+		Given  []string `json:"given"`
+	} `json:"name"`
+	Gender           string `json:"gender"`
+	BirthDate        string `json:"birthDate"`
+	DeceasedBoolean  *bool  `json:"deceasedBoolean"`
+	DeceasedDateTime string `json:"deceasedDateTime"`
+	Identifier       []struct {
+		Type   fhirCodeableConcept `json:"type"`
+		System string              `json:"system"`
+		Value  string              `json:"value"`
+	} `json:"identifier"`
+	GeneralPractitioner  []fhirReference `json:"generalPractitioner"`
+	ManagingOrganization fhirReference   `json:"managingOrganization"`
+}
+
+func (t *FHIRPatientTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	a, err := BindArgs[fhirPatientArgs](args)
+	if err != nil {
+		return ErrorResult(err.Error()).WithError(err)
+	}
+	patientID, denied := t.client.patientFor(ctx, a.PatientID)
+	if denied != nil {
+		return denied
+	}
+
+	var p fhirPatient
+	if err := t.client.get(ctx, "Patient/"+patientID, nil, &p); err != nil {
+		return fhirErrorResult(err)
+	}
+
+	out := map[string]interface{}{
+		"id":         p.ID,
+		"gender":     p.Gender,
+		"birth_date": p.BirthDate,
+	}
+	for _, n := range p.Name {
+		name := n.Text
+		if name == "" {
+			name = strings.TrimSpace(strings.Join(n.Given, " ") + " " + n.Family)
+		}
+		if name != "" && (out["name"] == nil || n.Use == "official") {
+			out["name"] = name
+		}
+	}
+	if p.DeceasedDateTime != "" {
+		out["deceased"] = p.DeceasedDateTime
+	} else if p.DeceasedBoolean != nil && *p.DeceasedBoolean {
+		out["deceased"] = true
+	}
+	var identifiers []map[string]string
+	for _, id := range p.Identifier {
+		kind := id.Type.String()
+		if kind == "" {
+			kind = id.System
+		}
+		identifiers = append(identifiers, map[string]string{"type": kind, "value": id.Value})
+	}
+	if len(identifiers) > 0 {
+		out["identifiers"] = identifiers
+	}
+	if len(p.GeneralPractitioner) > 0 {
+		out["general_practitioner"] = p.GeneralPractitioner[0].String()
+	}
+	if org := p.ManagingOrganization.String(); org != "" {
+		out["managing_organization"] = org
+	}
+	payload, _ := json.Marshal(out)
+	return NewToolResult(string(payload))
+}
+
+// FHIRObservationsTool searches a patient's observations, such as lab
+// results and vital signs, newest first.
+type FHIRObservationsTool struct {
+	client *fhirClient
+}
+
+func (t *FHIRObservationsTool) Name() string {
+	return "fhir_search_observations"
+}
+
+func (t *FHIRObservationsTool) Description() string {
+	return "Search the patient's lab results and vital signs in the hospital record (FHIR), newest first. " +
+		"Filter by test (a LOINC code such as 2857-1, or a name such as \"CA 19-9\"), category and start date. " +
+		"Each result has its date, value, unit, reference range and the lab's interpretation. " +
+		"Prefer these recorded values to what the user remembers, and give the date of any value you quote."
+}
+
+func (t *FHIRObservationsTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"patient_id": fhirPatientIDParam,
+			"code": map[string]interface{}{
+				"type":        "string",
+				"description": "LOINC code, system|code, or test name",
+			},
+			"category": map[string]interface{}{
+				"type":        "string",
+				"description": "Observation category",
+				"enum":        []string{"laboratory", "vital-signs", "imaging", "exam", "social-history", "survey"},
+			},
+			"since": map[string]interface{}{
+				"type":        "string",
+				"description": "Only results on or after this date (YYYY-MM-DD)",
+			},
+			"count": map[string]interface{}{
+				"type":        "integer",
+				"description": fmt.Sprintf("Maximum results (default %d, max %d)", defaultFHIRObservations, maxFHIRObservations),
+				"minimum":     1,
+				"maximum":     maxFHIRObservations,
+			},
+		},
+	}
+}
+
+type fhirObservationsArgs struct {
+	PatientID string `json:"patient_id"`
+	Code      string `json:"code"`
+	Category  string `json:"category" arg:"enum=laboratory|vital-signs|imaging|exam|social-history|survey"`
+	Since     string `json:"since"`
+	Count     int    `json:"count" arg:"min=1,max=100,default=20"`
+}
+
+type fhirObservation struct {
+	ID                string              `json:"id"`
+	Status            string              `json:"status"`
+	Code              fhirCodeableConcept `json:"code"`
+	EffectiveDateTime string              `json:"effectiveDateTime"`
+	EffectivePeriod   *struct {
+		Start string `json:"start"`
+	} `json:"effectivePeriod"`
+	Issued               string                `json:"issued"`
+	ValueQuantity        *fhirQuantity         `json:"valueQuantity"`
+	ValueString          string                `json:"valueString"`
+	ValueCodeableConcept *fhirCodeableConcept  `json:"valueCodeableConcept"`
+	ValueBoolean         *bool                 `json:"valueBoolean"`
+	ValueInteger         *int                  `json:"valueInteger"`
+	Interpretation       []fhirCodeableConcept `json:"interpretation"`
+	ReferenceRange       []struct {
+		Low  *fhirQuantity `json:"low"`
+		High *fhirQuantity `json:"high"`
+		Text string        `json:"text"`
+	} `json:"referenceRange"`
+	Component []struct {
+		Code          fhirCodeableConcept `json:"code"`
+		ValueQuantity *fhirQuantity       `json:"valueQuantity"`
+		ValueString   string              `json:"valueString"`
+	} `json:"component"`
+}
+
+func (t *FHIRObservationsTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	a, err := BindArgs[fhirObservationsArgs](args)
+	if err != nil {
+		return ErrorResult(err.Error()).WithError(err)
+	}
+	if a.Since != "" {
+		if _, err := time.Parse("2006-01-02", a.Since); err != nil {
+			err := ClassifyError(ErrInvalidArgs, fmt.Errorf("since must be a date like 2024-03-01, got %q", a.Since))
+			return ErrorResult(err.Error()).WithError(err)
+		}
+	}
+	patientID, denied := t.client.patientFor(ctx, a.PatientID)
+	if denied != nil {
+		return denied
+	}
+
+	query := url.Values{
+		"patient": {patientID},
+		"_sort":   {"-date"},
+		"_count":  {strconv.Itoa(a.Count)},
+	}
+	if code := strings.TrimSpace(a.Code); code != "" {
+		if fhirCodePattern.MatchString(code) {
+			query.Set("code", code)
+		} else {
+			query.Set("code:text", code)
+		}
+	}
+	if a.Category != "" {
+		query.Set("category", a.Category)
+	}
+	if a.Since != "" {
+		query.Set("date", "ge"+a.Since)
+	}
+	matches, _, more, err := t.client.search(ctx, "Observation", query)
+	if err != nil {
+		return fhirErrorResult(err)
+	}
+
+	observations := make([]map[string]interface{}, 0, len(matches))
+	for _, raw := range matches {
+		var o fhirObservation
+		if err := json.Unmarshal(raw, &o); err != nil {
+			continue
+		}
+		observations = append(observations, observationSummary(&o))
+		if len(observations) >= a.Count {
+			break
+		}
+	}
+	if len(observations) == 0 {
+		return ErrorResult("no matching observations in the patient's record").
+			WithError(ClassifyError(ErrNotFound, fmt.Errorf("no observations found")))
+	}
+	payload, _ := json.Marshal(map[string]interface{}{
+		"patient_id":   patientID,
+		"observations": observations,
+		"more":         more,
+	})
+	return NewToolResult(string(payload))
+}
+
+func observationSummary(o *fhirObservation) map[string]interface{} {
+	out := map[string]interface{}{
+		"id":     o.ID,
+		"name":   o.Code.String(),
+		"status": o.Status,
+	}
+	for _, coding := range o.Code.Coding {
+		if coding.Code != "" {
+			out["code"] = coding.Code
+			if coding.System == "http://loinc.org" {
+				break
+			}
+		}
+	}
+	switch {
+	case o.EffectiveDateTime != "":
+		out["date"] = o.EffectiveDateTime
+	case o.EffectivePeriod != nil && o.EffectivePeriod.Start != "":
+		out["date"] = o.EffectivePeriod.Start
+	case o.Issued != "":
+		out["date"] = o.Issued
+	}
+	setObservationValue(out, o.ValueQuantity, o.ValueString)
+	switch {
+	case o.ValueCodeableConcept != nil:
+		out["value"] = o.ValueCodeableConcept.String()
+	case o.ValueBoolean != nil:
+		out["value"] = *o.ValueBoolean
+	case o.ValueInteger != nil:
+		out["value"] = *o.ValueInteger
+	}
+	var interpretations []string
+	for i := range o.Interpretation {
+		if s := o.Interpretation[i].String(); s != "" {
+			interpretations = append(interpretations, s)
+		}
+	}
+	if len(interpretations) > 0 {
+		out["interpretation"] = strings.Join(interpretations, ", ")
+	}
+	if len(o.ReferenceRange) > 0 {
+		if r := referenceRangeText(o.ReferenceRange[0].Low, o.ReferenceRange[0].High, o.ReferenceRange[0].Text); r != "" {
+			out["reference_range"] = r
+		}
+	}
+	var components []map[string]interface{}
+	for i := range o.Component {
+		c := map[string]interface{}{"name": o.Component[i].Code.String()}
+		setObservationValue(c, o.Component[i].ValueQuantity, o.Component[i].ValueString)
+		components = append(components, c)
+	}
+	if len(components) > 0 {
+		out["components"] = components
+	}
+	return out
+}
+
+func setObservationValue(out map[string]interface{}, q *fhirQuantity, s string) {
+	switch {
+	case q != nil && q.Value != nil:
+		if q.Comparator != "" {
+			out["value"] = q.Comparator + strconv.FormatFloat(*q.Value, 'f', -1, 64)
+		} else {
+			out["value"] = *q.Value
+		}
+		if unit := q.unit(); unit != "" {
+			out["unit"] = unit
+		}
+	case s != "":
+		out["value"] = s
+	}
+}
+
+func referenceRangeText(low, high *fhirQuantity, text string) string {
+	if text != "" {
+		return text
+	}
+	format := func(q *fhirQuantity) string {
+		if q == nil || q.Value == nil {
+			return ""
+		}
+		return strconv.FormatFloat(*q.Value, 'f', -1, 64)
+	}
+	switch lo, hi := format(low), format(high); {
+	case lo != "" && hi != "":
+		return lo + "-" + hi
+	case hi != "":
+		return "<=" + hi
+	case lo != "":
+		return ">=" + lo
+	}
+	return ""
+}
+
+// FHIRMedicationsTool lists a patient's medication orders.
+type FHIRMedicationsTool struct {
+	client *fhirClient
+}
+
+func (t *FHIRMedicationsTool) Name() string {
+	return "fhir_get_medications"
+}
+
+func (t *FHIRMedicationsTool) Description() string {
+	return "List the patient's prescribed medications from the hospital record (FHIR MedicationRequest): drug, dose instructions, status, date and prescriber. " +
+		"By default only active prescriptions are listed. Use it to check interactions or side effects against what was actually prescribed."
+}
+
+func (t *FHIRMedicationsTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"patient_id": fhirPatientIDParam,
+			"status": map[string]interface{}{
+				"type":        "string",
+				"description": "active (default) or all, including stopped and completed prescriptions",
+				"enum":        []string{"active", "all"},
+			},
+		},
+	}
+}
+
+type fhirMedicationsArgs struct {
+	PatientID string `json:"patient_id"`
+	Status    string `json:"status" arg:"enum=active|all,default=active"`
+}
+
+type fhirMedicationRequest struct {
+	ID                        string               `json:"id"`
+	Status                    string               `json:"status"`
+	Intent                    string               `json:"intent"`
+	AuthoredOn                string               `json:"authoredOn"`
+	MedicationCodeableConcept *fhirCodeableConcept `json:"medicationCodeableConcept"`
+	MedicationReference       *fhirReference       `json:"medicationReference"`
+	DosageInstruction         []struct {
+		Text string `json:"text"`
+	} `json:"dosageInstruction"`
+	Requester  fhirReference         `json:"requester"`
+	ReasonCode []fhirCodeableConcept `json:"reasonCode"`
+}
+
+func (t *FHIRMedicationsTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	a, err := BindArgs[fhirMedicationsArgs](args)
+	if err != nil {
+		return ErrorResult(err.Error()).WithError(err)
+	}
+	patientID, denied := t.client.patientFor(ctx, a.PatientID)
+	if denied != nil {
+		return denied
+	}
+
+	query := url.Values{
+		"patient":  {patientID},
+		"_include": {"MedicationRequest:medication"},
+		"_count":   {"100"},
+	}
+	if a.Status != "all" {
+		query.Set("status", "active")
+	}
+	matches, included, more, err := t.client.search(ctx, "MedicationRequest", query)
+	if err != nil {
+		return fhirErrorResult(err)
+	}
+
+	medications := make([]map[string]interface{}, 0, len(matches))
+	for _, raw := range matches {
+		var m fhirMedicationRequest
+		if err := json.Unmarshal(raw, &m); err != nil {
+			continue
+		}
+		out := map[string]interface{}{
+			"id":         m.ID,
+			"status":     m.Status,
+			"intent":     m.Intent,
+			"drug":       medicationName(&m, included),
+			"prescribed": m.AuthoredOn,
+		}
+		var dosage []string
+		for _, d := range m.DosageInstruction {
+			if d.Text != "" {
+				dosage = append(dosage, d.Text)
+			}
+		}
+		if len(dosage) > 0 {
+			out["dosage"] = strings.Join(dosage, "; ")
+		}
+		if prescriber := m.Requester.String(); prescriber != "" {
+			out["prescriber"] = prescriber
+		}
+		var reasons []string
+		for i := range m.ReasonCode {
+			if s := m.ReasonCode[i].String(); s != "" {
+				reasons = append(reasons, s)
+			}
+		}
+		if len(reasons) > 0 {
+			out["reason"] = strings.Join(reasons, ", ")
+		}
+		medications = append(medications, out)
+	}
+	if len(medications) == 0 {
+		return ErrorResult("no matching prescriptions in the patient's record").
+			WithError(ClassifyError(ErrNotFound, fmt.Errorf("no medication requests found")))
+	}
+	payload, _ := json.Marshal(map[string]interface{}{
+		"patient_id":  patientID,
+		"medications": medications,
+		"more":        more,
+	})
+	return NewToolResult(string(payload))
+}
+
+// medicationName is the drug a request names, looking up referenced
+// Medication resources among the included ones.
+func medicationName(m *fhirMedicationRequest, included map[string]json.RawMessage) string {
+	if name := m.MedicationCodeableConcept.String(); name != "" {
+		return name
+	}
+	if m.MedicationReference == nil {
+		return ""
+	}
+	if raw, ok := included[m.MedicationReference.Reference]; ok {
+		var medication struct {
+			Code fhirCodeableConcept `json:"code"`
+		}
+		if json.Unmarshal(raw, &medication) == nil {
+			if name := medication.Code.String(); name != "" {
+				return name
+			}
+		}
+	}
+	return m.MedicationReference.String()
+}
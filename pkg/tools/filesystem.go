@@ -80,6 +80,7 @@ func isWithinWorkspace(candidate, workspace string) bool {
 type ReadFileTool struct {
 	workspace string
 	restrict  bool
+	policy    *PathPolicy
 }
 
 func NewReadFileTool(workspace string, restrict bool) *ReadFileTool {
@@ -90,6 +91,11 @@ func (t *ReadFileTool) Name() string {
 	return "read_file"
 }
 
+// SetPathPolicy applies p's limits; nil removes them.
+func (t *ReadFileTool) SetPathPolicy(p *PathPolicy) {
+	t.policy = p
+}
+
 func (t *ReadFileTool) Description() string {
 	return "Read the contents of a file"
 }
@@ -113,10 +119,15 @@ func (t *ReadFileTool) Execute(ctx context.Context, args map[string]interface{})
 		return ErrorResult("path is required")
 	}
 
-	resolvedPath, err := validatePath(path, t.workspace, t.restrict)
+	resolvedPath, err := t.policy.resolve(ctx, path, t.workspace, t.restrict, true)
 	if err != nil {
 		return ErrorResult(err.Error())
 	}
+	if info, err := os.Stat(resolvedPath); err == nil {
+		if err := t.policy.checkSize(info.Size()); err != nil {
+			return ErrorResult(err.Error())
+		}
+	}
 
 	content, err := os.ReadFile(resolvedPath)
 	if err != nil {
@@ -129,6 +140,7 @@ func (t *ReadFileTool) Execute(ctx context.Context, args map[string]interface{})
 type WriteFileTool struct {
 	workspace string
 	restrict  bool
+	policy    *PathPolicy
 }
 
 func NewWriteFileTool(workspace string, restrict bool) *WriteFileTool {
@@ -139,6 +151,11 @@ func (t *WriteFileTool) Name() string {
 	return "write_file"
 }
 
+// SetPathPolicy applies p's limits; nil removes them.
+func (t *WriteFileTool) SetPathPolicy(p *PathPolicy) {
+	t.policy = p
+}
+
 func (t *WriteFileTool) Description() string {
 	return "Write content to a file"
 }
@@ -171,10 +188,13 @@ func (t *WriteFileTool) Execute(ctx context.Context, args map[string]interface{}
 		return ErrorResult("content is required")
 	}
 
-	resolvedPath, err := validatePath(path, t.workspace, t.restrict)
+	resolvedPath, err := t.policy.resolve(ctx, path, t.workspace, t.restrict, true)
 	if err != nil {
 		return ErrorResult(err.Error())
 	}
+	if err := t.policy.checkSize(int64(len(content))); err != nil {
+		return ErrorResult(err.Error())
+	}
 
 	dir := filepath.Dir(resolvedPath)
 	if err := os.MkdirAll(dir, 0755); err != nil {
@@ -191,6 +211,7 @@ func (t *WriteFileTool) Execute(ctx context.Context, args map[string]interface{}
 type ListDirTool struct {
 	workspace string
 	restrict  bool
+	policy    *PathPolicy
 }
 
 func NewListDirTool(workspace string, restrict bool) *ListDirTool {
@@ -201,6 +222,11 @@ func (t *ListDirTool) Name() string {
 	return "list_dir"
 }
 
+// SetPathPolicy applies p's limits; nil removes them.
+func (t *ListDirTool) SetPathPolicy(p *PathPolicy) {
+	t.policy = p
+}
+
 func (t *ListDirTool) Description() string {
 	return "List files and directories in a path"
 }
@@ -224,7 +250,7 @@ func (t *ListDirTool) Execute(ctx context.Context, args map[string]interface{})
 		path = "."
 	}
 
-	resolvedPath, err := validatePath(path, t.workspace, t.restrict)
+	resolvedPath, err := t.policy.resolve(ctx, path, t.workspace, t.restrict, false)
 	if err != nil {
 		return ErrorResult(err.Error())
 	}
@@ -0,0 +1,325 @@
+package tools
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// BackgroundTool is an optional interface for tools whose calls can outlast
+// a single turn. When RunsInBackground reports true for a call and the
+// registry has a JobManager, the call runs as a job and the model gets a
+// job ID to poll with job_status and job_result.
+type BackgroundTool interface {
+	Tool
+	RunsInBackground(args map[string]interface{}) bool
+}
+
+type JobStatus string
+
+const (
+	JobRunning   JobStatus = "running"
+	JobSucceeded JobStatus = "succeeded"
+	JobFailed    JobStatus = "failed"
+)
+
+const (
+	defaultJobRetention = time.Hour
+	defaultJobTimeout   = 30 * time.Minute
+)
+
+// Job is one background tool call.
+type Job struct {
+	ID         string
+	Tool       string
+	Status     JobStatus
+	SessionKey string
+	Started    time.Time
+	Finished   time.Time
+	result     *ToolResult
+}
+
+type JobOptions struct {
+	// Timeout bounds each job; defaults to 30 minutes.
+	Timeout time.Duration
+	// Retention is how long finished jobs are kept; defaults to 1 hour.
+	Retention time.Duration
+}
+
+// JobManager runs tool calls in the background and keeps their results
+// until they are fetched or expire.
+type JobManager struct {
+	mu        sync.Mutex
+	jobs      map[string]*Job
+	timeout   time.Duration
+	retention time.Duration
+}
+
+func NewJobManager(opts JobOptions) *JobManager {
+	if opts.Timeout <= 0 {
+		opts.Timeout = defaultJobTimeout
+	}
+	if opts.Retention <= 0 {
+		opts.Retention = defaultJobRetention
+	}
+	return &JobManager{
+		jobs:      make(map[string]*Job),
+		timeout:   opts.Timeout,
+		retention: opts.Retention,
+	}
+}
+
+// Start runs fn in the background and returns the new job. fn gets a
+// context that outlives the caller's turn but keeps its values, such as
+// call metadata.
+func (m *JobManager) Start(ctx context.Context, tool string, fn func(context.Context) *ToolResult) *Job {
+	job := &Job{
+		ID:         newJobID(),
+		Tool:       tool,
+		Status:     JobRunning,
+		SessionKey: CallMetadataFromContext(ctx).SessionKey,
+		Started:    time.Now(),
+	}
+
+	m.mu.Lock()
+	m.pruneLocked(job.Started)
+	m.jobs[job.ID] = job
+	m.mu.Unlock()
+
+	jobCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), m.timeout)
+	go func() {
+		defer cancel()
+		result := fn(jobCtx)
+		if result == nil {
+			result = ErrorResult("job returned no result")
+		}
+
+		m.mu.Lock()
+		job.result = result
+		job.Finished = time.Now()
+		job.Status = JobSucceeded
+		if result.IsError {
+			job.Status = JobFailed
+		}
+		status := job.Status
+		m.mu.Unlock()
+
+		logger.InfoCF("tool", "Background job finished",
+			map[string]interface{}{
+				"job_id":      job.ID,
+				"tool":        tool,
+				"status":      string(status),
+				"duration_ms": job.Finished.Sub(job.Started).Milliseconds(),
+			})
+	}()
+
+	logger.InfoCF("tool", "Background job started",
+		map[string]interface{}{
+			"job_id": job.ID,
+			"tool":   tool,
+		})
+	return job
+}
+
+// Get returns a snapshot of the job with id.
+func (m *JobManager) Get(id string) (Job, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	job, ok := m.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	return *job, true
+}
+
+// List returns snapshots of the jobs started from sessionKey, newest first.
+// An empty sessionKey lists every job.
+func (m *JobManager) List(sessionKey string) []Job {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.pruneLocked(time.Now())
+
+	jobs := make([]Job, 0, len(m.jobs))
+	for _, job := range m.jobs {
+		if sessionKey == "" || job.SessionKey == sessionKey {
+			jobs = append(jobs, *job)
+		}
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].Started.After(jobs[j].Started) })
+	return jobs
+}
+
+// Wait blocks until the job finishes or ctx is done. It is mainly useful
+// in tests.
+func (m *JobManager) Wait(ctx context.Context, id string) (Job, error) {
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		job, ok := m.Get(id)
+		if !ok {
+			return Job{}, fmt.Errorf("job %s not found", id)
+		}
+		if job.Status != JobRunning {
+			return job, nil
+		}
+		select {
+		case <-ctx.Done():
+			return job, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func (m *JobManager) pruneLocked(now time.Time) {
+	for id, job := range m.jobs {
+		if job.Status != JobRunning && now.Sub(job.Finished) > m.retention {
+			delete(m.jobs, id)
+		}
+	}
+}
+
+func newJobID() string {
+	return "job-" + randomHex(6)
+}
+
+// randomHex returns n random bytes hex-encoded, falling back to the clock
+// if the system source fails.
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%d", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
+// jobStartedResult is what the model sees when a call moves to the background.
+func jobStartedResult(job *Job) *ToolResult {
+	payload, _ := json.Marshal(map[string]interface{}{
+		"job_id": job.ID,
+		"status": job.Status,
+		"note":   "Running in the background. Check progress with job_status and fetch the output with job_result.",
+	})
+	return NewToolResult(string(payload))
+}
+
+// JobStatusTool reports the state of background jobs.
+type JobStatusTool struct {
+	jobs *JobManager
+}
+
+func NewJobStatusTool(jobs *JobManager) *JobStatusTool {
+	return &JobStatusTool{jobs: jobs}
+}
+
+func (t *JobStatusTool) Name() string {
+	return "job_status"
+}
+
+func (t *JobStatusTool) Description() string {
+	return "Check background jobs started by long-running tools. Pass job_id for one job, or omit it to list this conversation's jobs."
+}
+
+func (t *JobStatusTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"job_id": map[string]interface{}{
+				"type":        "string",
+				"description": "Job ID returned when the job started",
+			},
+		},
+	}
+}
+
+func (t *JobStatusTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	if id, _ := args["job_id"].(string); id != "" {
+		job, ok := t.jobs.Get(id)
+		if !ok {
+			return ErrorResult(fmt.Sprintf("job %s not found (finished jobs are kept for a limited time)", id))
+		}
+		return jobJSON(jobView(job))
+	}
+
+	jobs := t.jobs.List(CallMetadataFromContext(ctx).SessionKey)
+	views := make([]map[string]interface{}, 0, len(jobs))
+	for _, job := range jobs {
+		views = append(views, jobView(job))
+	}
+	return jobJSON(map[string]interface{}{"jobs": views})
+}
+
+// JobResultTool returns the output of a finished background job.
+type JobResultTool struct {
+	jobs *JobManager
+}
+
+func NewJobResultTool(jobs *JobManager) *JobResultTool {
+	return &JobResultTool{jobs: jobs}
+}
+
+func (t *JobResultTool) Name() string {
+	return "job_result"
+}
+
+func (t *JobResultTool) Description() string {
+	return "Fetch the output of a finished background job. If the job is still running, reports its status instead."
+}
+
+func (t *JobResultTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"job_id": map[string]interface{}{
+				"type":        "string",
+				"description": "Job ID returned when the job started",
+			},
+		},
+		"required": []string{"job_id"},
+	}
+}
+
+func (t *JobResultTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	id, _ := args["job_id"].(string)
+	if id == "" {
+		return ErrorResult("job_id is required")
+	}
+	job, ok := t.jobs.Get(id)
+	if !ok {
+		return ErrorResult(fmt.Sprintf("job %s not found (finished jobs are kept for a limited time)", id))
+	}
+	if job.Status == JobRunning {
+		return jobJSON(jobView(job))
+	}
+	result := *job.result
+	return &result
+}
+
+func jobView(job Job) map[string]interface{} {
+	view := map[string]interface{}{
+		"job_id":  job.ID,
+		"tool":    job.Tool,
+		"status":  job.Status,
+		"started": job.Started.Format(time.RFC3339),
+	}
+	if job.Status == JobRunning {
+		view["elapsed_seconds"] = int(time.Since(job.Started).Seconds())
+	} else {
+		view["duration_seconds"] = int(job.Finished.Sub(job.Started).Seconds())
+	}
+	return view
+}
+
+func jobJSON(v interface{}) *ToolResult {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("failed to serialize job status: %v", err)).WithError(err)
+	}
+	return NewToolResult(string(payload))
+}
@@ -0,0 +1,128 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+// slowBatchTool runs in the background when given more than one item and
+// blocks until release is closed.
+type slowBatchTool struct {
+	release chan struct{}
+	result  *ToolResult
+}
+
+func (t *slowBatchTool) Name() string        { return "slow_batch" }
+func (t *slowBatchTool) Description() string { return "slow batch tool" }
+func (t *slowBatchTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{"type": "object"}
+}
+
+func (t *slowBatchTool) RunsInBackground(args map[string]interface{}) bool {
+	items, _ := args["items"].([]interface{})
+	return len(items) > 1
+}
+
+func (t *slowBatchTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	select {
+	case <-t.release:
+	case <-ctx.Done():
+		return ErrorResult("cancelled")
+	}
+	return t.result
+}
+
+func startedJobID(t *testing.T, result *ToolResult) string {
+	t.Helper()
+	var started struct {
+		JobID  string `json:"job_id"`
+		Status string `json:"status"`
+	}
+	if err := json.Unmarshal([]byte(result.ForLLM), &started); err != nil {
+		t.Fatalf("expected job started JSON, got %q: %v", result.ForLLM, err)
+	}
+	if started.JobID == "" || started.Status != "running" {
+		t.Fatalf("unexpected job start: %+v", started)
+	}
+	return started.JobID
+}
+
+func TestJobManager_BackgroundCallLifecycle(t *testing.T) {
+	jobs := NewJobManager(JobOptions{})
+	tool := &slowBatchTool{release: make(chan struct{}), result: NewToolResult("all answers")}
+	r := NewToolRegistry()
+	r.Register(tool)
+	r.Register(NewJobStatusTool(jobs))
+	r.Register(NewJobResultTool(jobs))
+	r.SetJobManager(jobs)
+
+	ctx, cancel := context.WithCancel(WithCallMetadata(context.Background(), CallMetadata{SessionKey: "s1"}))
+	id := startedJobID(t, r.Execute(ctx, "slow_batch", map[string]interface{}{"items": []interface{}{"a", "b"}}))
+	// The job keeps running after the turn that started it ends.
+	cancel()
+
+	status := r.Execute(context.Background(), "job_status", map[string]interface{}{"job_id": id})
+	if !strings.Contains(status.ForLLM, `"status":"running"`) {
+		t.Errorf("expected running status, got %q", status.ForLLM)
+	}
+	if pending := r.Execute(context.Background(), "job_result", map[string]interface{}{"job_id": id}); !strings.Contains(pending.ForLLM, "running") {
+		t.Errorf("expected job_result to report running, got %q", pending.ForLLM)
+	}
+
+	list := r.Execute(WithCallMetadata(context.Background(), CallMetadata{SessionKey: "s1"}), "job_status", map[string]interface{}{})
+	if !strings.Contains(list.ForLLM, id) {
+		t.Errorf("expected session listing to include %s, got %q", id, list.ForLLM)
+	}
+	other := r.Execute(WithCallMetadata(context.Background(), CallMetadata{SessionKey: "s2"}), "job_status", map[string]interface{}{})
+	if strings.Contains(other.ForLLM, id) {
+		t.Errorf("other sessions should not list %s", id)
+	}
+
+	close(tool.release)
+	waitCtx, waitCancel := context.WithTimeout(context.Background(), time.Second)
+	defer waitCancel()
+	if job, err := jobs.Wait(waitCtx, id); err != nil || job.Status != JobSucceeded {
+		t.Fatalf("Wait() = %+v, %v", job, err)
+	}
+
+	if result := r.Execute(context.Background(), "job_result", map[string]interface{}{"job_id": id}); result.ForLLM != "all answers" {
+		t.Errorf("job_result = %q", result.ForLLM)
+	}
+}
+
+func TestJobManager_SmallCallsRunInline(t *testing.T) {
+	tool := &slowBatchTool{release: make(chan struct{}), result: NewToolResult("one answer")}
+	close(tool.release)
+	r := NewToolRegistry()
+	r.Register(tool)
+	r.SetJobManager(NewJobManager(JobOptions{}))
+
+	result := r.Execute(context.Background(), "slow_batch", map[string]interface{}{"items": []interface{}{"a"}})
+	if result.ForLLM != "one answer" {
+		t.Errorf("expected inline result, got %q", result.ForLLM)
+	}
+}
+
+func TestJobManager_FailedAndUnknownJobs(t *testing.T) {
+	jobs := NewJobManager(JobOptions{})
+	job := jobs.Start(context.Background(), "slow_batch", func(ctx context.Context) *ToolResult {
+		return ErrorResult("upstream failed")
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if done, err := jobs.Wait(ctx, job.ID); err != nil || done.Status != JobFailed {
+		t.Fatalf("Wait() = %+v, %v", done, err)
+	}
+
+	resultTool := NewJobResultTool(jobs)
+	if result := resultTool.Execute(context.Background(), map[string]interface{}{"job_id": job.ID}); !result.IsError {
+		t.Error("expected failed job to return its error result")
+	}
+	if result := resultTool.Execute(context.Background(), map[string]interface{}{"job_id": "job-missing"}); !result.IsError {
+		t.Error("expected error for unknown job")
+	}
+}
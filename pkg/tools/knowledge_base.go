@@ -0,0 +1,345 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/sipeed/picoclaw/pkg/pdftext"
+	"github.com/sipeed/picoclaw/pkg/rag"
+)
+
+// KnowledgeBaseToolOptions configures the knowledge base tools.
+type KnowledgeBaseToolOptions struct {
+	Workspace    string
+	Restrict     bool
+	PathPolicy   *PathPolicy // limits on the files kb_ingest reads
+	ChunkChars   int
+	ChunkOverlap int
+	MaxFileBytes int64
+	Timeout      time.Duration
+}
+
+// NewKnowledgeBaseTools returns the kb_ingest and kb_search tools for kb.
+func NewKnowledgeBaseTools(kb *rag.KnowledgeBase, opts KnowledgeBaseToolOptions) []Tool {
+	if opts.ChunkChars <= 0 {
+		opts.ChunkChars = 800
+	}
+	if opts.ChunkOverlap < 0 || opts.ChunkOverlap >= opts.ChunkChars {
+		opts.ChunkOverlap = 120
+	}
+	if opts.MaxFileBytes <= 0 {
+		opts.MaxFileBytes = 20 << 20
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 60 * time.Second
+	}
+	return []Tool{
+		&KBIngestTool{kb: kb, opts: opts, client: &http.Client{Timeout: opts.Timeout}},
+		&KBSearchTool{kb: kb},
+	}
+}
+
+// KBIngestTool adds a document to the knowledge base.
+type KBIngestTool struct {
+	kb     *rag.KnowledgeBase
+	opts   KnowledgeBaseToolOptions
+	client *http.Client
+}
+
+func (t *KBIngestTool) Name() string {
+	return "kb_ingest"
+}
+
+func (t *KBIngestTool) Description() string {
+	return "Add a curated document, such as a hospital FAQ, a local guide to services or a guideline, to the knowledge base searched by kb_search. " +
+		"Give a URL, a path in the workspace (PDF, Markdown, text or HTML) or the text itself. " +
+		"Returns a doc_id; adding the same content again returns the existing doc_id. " +
+		"Documents are private to the user who adds them unless shared is true; only share documents that hold no personal information."
+}
+
+func (t *KBIngestTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"url": map[string]interface{}{
+				"type":        "string",
+				"description": "http(s) URL of the document",
+			},
+			"path": map[string]interface{}{
+				"type":        "string",
+				"description": "Path to the document in the workspace",
+			},
+			"text": map[string]interface{}{
+				"type":        "string",
+				"description": "The document text, when there is no file",
+			},
+			"title": map[string]interface{}{
+				"type":        "string",
+				"description": "Title for the document; required with text, otherwise taken from the file",
+			},
+			"shared": map[string]interface{}{
+				"type":        "boolean",
+				"description": "Make the document searchable by all users, for public material",
+			},
+		},
+	}
+}
+
+type kbIngestArgs struct {
+	URL    string `json:"url"`
+	Path   string `json:"path"`
+	Text   string `json:"text"`
+	Title  string `json:"title"`
+	Shared bool   `json:"shared"`
+}
+
+func (t *KBIngestTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	a, err := BindArgs[kbIngestArgs](args)
+	if err != nil {
+		return ErrorResult(err.Error()).WithError(err)
+	}
+	given := 0
+	for _, s := range []string{a.URL, a.Path, a.Text} {
+		if s != "" {
+			given++
+		}
+	}
+	if given != 1 {
+		return ErrorResult("give exactly one of url, path or text").WithError(ErrInvalidArgs)
+	}
+
+	var data []byte
+	var source, fileName, contentType string
+	switch {
+	case a.Text != "":
+		if strings.TrimSpace(a.Title) == "" {
+			return ErrorResult("title is required with text").WithError(ErrInvalidArgs)
+		}
+		data, source, contentType = []byte(a.Text), "text", "text/plain"
+	case a.URL != "":
+		var failed *ToolResult
+		if data, contentType, failed = t.download(ctx, a.URL); failed != nil {
+			return failed
+		}
+		source = a.URL
+		if u, err := url.Parse(a.URL); err == nil {
+			fileName = path.Base(u.Path)
+		}
+	default:
+		p, err := t.opts.PathPolicy.resolve(ctx, a.Path, t.opts.Workspace, t.opts.Restrict, true)
+		if err != nil {
+			return ErrorResult(err.Error()).WithError(ClassifyError(ErrInvalidArgs, err))
+		}
+		info, err := os.Stat(p)
+		if err != nil || info.IsDir() {
+			return ErrorResult(fmt.Sprintf("file not found: %s", a.Path)).WithError(ClassifyError(ErrInvalidArgs, err))
+		}
+		if err := t.opts.PathPolicy.checkSize(info.Size()); err != nil {
+			return ErrorResult(err.Error()).WithError(ClassifyError(ErrInvalidArgs, err))
+		}
+		if info.Size() > t.opts.MaxFileBytes {
+			return ErrorResult(fmt.Sprintf("file is larger than %d MB", t.opts.MaxFileBytes>>20)).WithError(ErrInvalidArgs)
+		}
+		if data, err = os.ReadFile(p); err != nil {
+			return ErrorResult(fmt.Sprintf("failed to read file: %v", err))
+		}
+		source = a.Path
+		fileName = filepath.Base(p)
+		contentType = mime.TypeByExtension(strings.ToLower(filepath.Ext(p)))
+	}
+
+	user := documentUser(ctx)
+	id := rag.DocumentID(data, user, a.Shared)
+	if exists, err := t.kb.Has(ctx, id); err != nil {
+		return ErrorResult(fmt.Sprintf("knowledge base unavailable: %v", err)).WithError(ClassifyError(ErrRetryable, err))
+	} else if exists {
+		payload, _ := json.Marshal(map[string]interface{}{"doc_id": id, "already_ingested": true})
+		return NewToolResult(string(payload))
+	}
+
+	sections, title, failed := kbSections(data, contentType, fileName)
+	if failed != nil {
+		return failed
+	}
+	if a.Title != "" {
+		title = strings.TrimSpace(a.Title)
+	}
+	if title == "" {
+		title = strings.TrimSuffix(fileName, filepath.Ext(fileName))
+	}
+	chunks := rag.ChunkSections(sections, t.opts.ChunkChars, t.opts.ChunkOverlap)
+	if len(chunks) == 0 {
+		return ErrorResult("the document has no text").WithError(ClassifyError(ErrInvalidArgs, fmt.Errorf("no text in %s", source)))
+	}
+
+	doc := &rag.Document{
+		ID:      id,
+		Title:   title,
+		Source:  source,
+		Owner:   user,
+		Shared:  a.Shared,
+		Pages:   len(sections),
+		Chunks:  chunks,
+		AddedAt: time.Now(),
+	}
+	if err := t.kb.Add(ctx, doc); err != nil {
+		return ErrorResult(fmt.Sprintf("failed to add document: %v", err)).WithError(ClassifyError(ErrRetryable, err))
+	}
+	payload, _ := json.Marshal(map[string]interface{}{
+		"doc_id": doc.ID,
+		"title":  doc.Title,
+		"chunks": len(doc.Chunks),
+		"shared": doc.Shared,
+	})
+	return NewToolResult(string(payload))
+}
+
+// kbSections extracts the text of a document by its type: PDFs page by
+// page, HTML without markup, and anything else as UTF-8 text.
+func kbSections(data []byte, contentType, fileName string) ([]rag.Section, string, *ToolResult) {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	ext := strings.ToLower(filepath.Ext(fileName))
+	switch {
+	case mediaType == "application/pdf" || ext == ".pdf" || strings.HasPrefix(string(data), "%PDF-"):
+		extracted, err := pdftext.Extract(data)
+		switch {
+		case errors.Is(err, pdftext.ErrEncrypted):
+			return nil, "", ErrorResult("the PDF is password-protected; ask for an unprotected copy").
+				WithError(ClassifyError(ErrInvalidArgs, err))
+		case err != nil:
+			return nil, "", ErrorResult(fmt.Sprintf("failed to read PDF: %v", err)).WithError(ClassifyError(ErrInvalidArgs, err))
+		}
+		sections := make([]rag.Section, 0, len(extracted.Pages))
+		for _, p := range extracted.Pages {
+			sections = append(sections, rag.Section{Page: p.Number, Text: p.Text})
+		}
+		return sections, extracted.Title, nil
+	case !utf8.Valid(data):
+		return nil, "", ErrorResult("unsupported file type; use PDF, Markdown, text or HTML").WithError(ErrInvalidArgs)
+	case mediaType == "text/html" || ext == ".html" || ext == ".htm":
+		return []rag.Section{{Text: htmlToText(string(data))}}, "", nil
+	}
+	return []rag.Section{{Text: string(data)}}, "", nil
+}
+
+func (t *KBIngestTool) download(ctx context.Context, rawURL string) ([]byte, string, *ToolResult) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, "", ErrorResult("url must be an http(s) URL").WithError(ErrInvalidArgs)
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", rawURL, nil)
+	if err != nil {
+		return nil, "", ErrorResult(fmt.Sprintf("failed to create request: %v", err))
+	}
+	req.Header.Set("User-Agent", userAgent)
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, "", ErrorResult(fmt.Sprintf("request failed: %v", err)).WithError(requestError(ctx, err))
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		err := fmt.Errorf("download failed: HTTP %d", resp.StatusCode)
+		return nil, "", ErrorResult(err.Error()).WithError(ClassifyError(StatusErrorKind(resp.StatusCode), err))
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, t.opts.MaxFileBytes+1))
+	if err != nil {
+		return nil, "", ErrorResult(fmt.Sprintf("failed to read response: %v", err)).WithError(requestError(ctx, err))
+	}
+	if int64(len(data)) > t.opts.MaxFileBytes {
+		return nil, "", ErrorResult(fmt.Sprintf("document is larger than %d MB", t.opts.MaxFileBytes>>20)).WithError(ErrInvalidArgs)
+	}
+	return data, resp.Header.Get("Content-Type"), nil
+}
+
+// KBSearchTool finds the knowledge base passages closest in meaning to a
+// question.
+type KBSearchTool struct {
+	kb *rag.KnowledgeBase
+}
+
+func (t *KBSearchTool) Name() string {
+	return "kb_search"
+}
+
+func (t *KBSearchTool) Concurrent() bool {
+	return true
+}
+
+func (t *KBSearchTool) Description() string {
+	return "Search the curated knowledge base (hospital FAQs, local guides, ingested guidelines) by meaning and return the closest passages with their source. " +
+		"Ask in plain words; the passages need not share them. " +
+		"Use it for local and practical questions, alongside KnowS for medical evidence, and cite the title of any passage you rely on."
+}
+
+func (t *KBSearchTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"query": map[string]interface{}{
+				"type":        "string",
+				"description": "The question or topic to search for",
+			},
+			"doc_ids": map[string]interface{}{
+				"type":        "array",
+				"items":       map[string]interface{}{"type": "string"},
+				"description": "Limit the search to these documents",
+			},
+			"top_k": map[string]interface{}{
+				"type":        "integer",
+				"description": "Number of passages to return (1-20, default 5)",
+			},
+		},
+		"required": []string{"query"},
+	}
+}
+
+type kbSearchArgs struct {
+	Query  string   `json:"query" arg:"required"`
+	DocIDs []string `json:"doc_ids"`
+	TopK   int      `json:"top_k" arg:"min=1,max=20,default=5"`
+}
+
+func (t *KBSearchTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	a, err := BindArgs[kbSearchArgs](args)
+	if err != nil {
+		return ErrorResult(err.Error()).WithError(err)
+	}
+	hits, err := t.kb.Search(ctx, a.Query, rag.SearchOptions{DocIDs: a.DocIDs, User: documentUser(ctx), Limit: a.TopK})
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("knowledge base search failed: %v", err)).WithError(ClassifyError(ErrRetryable, err))
+	}
+	if len(hits) == 0 {
+		return ErrorResult("the knowledge base has no documents to search").
+			WithError(ClassifyError(ErrNotFound, fmt.Errorf("no matches for %q", a.Query)))
+	}
+	results := make([]map[string]interface{}, 0, len(hits))
+	for _, h := range hits {
+		r := map[string]interface{}{
+			"doc_id": h.DocID,
+			"title":  h.Title,
+			"source": h.Source,
+			"chunk":  h.Index,
+			"score":  math.Round(h.Score*1000) / 1000,
+			"text":   h.Text,
+		}
+		if h.Page > 0 {
+			r["page"] = h.Page
+		}
+		results = append(results, r)
+	}
+	payload, _ := json.Marshal(map[string]interface{}{"results": results})
+	return NewToolResult(string(payload))
+}
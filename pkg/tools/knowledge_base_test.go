@@ -0,0 +1,109 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/rag"
+)
+
+// kbTestTools returns the knowledge base tools backed by a SQLite store and
+// an embeddings server that counts a few keywords.
+func kbTestTools(t *testing.T) (*KBIngestTool, *KBSearchTool, string) {
+	t.Helper()
+	keywords := []string{"停车", "挂号", "营养"}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Input []string `json:"input"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		data := make([]map[string]interface{}, len(body.Input))
+		for i, text := range body.Input {
+			v := []float32{0.1}
+			for _, k := range keywords {
+				v = append(v, float32(strings.Count(text, k)))
+			}
+			data[i] = map[string]interface{}{"index": i, "embedding": v}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": data})
+	}))
+	t.Cleanup(server.Close)
+
+	workspace := t.TempDir()
+	store, err := rag.OpenSQLiteVectors(filepath.Join(workspace, "kb", "kb.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	kb := rag.NewKnowledgeBase(rag.NewOpenAIEmbedder(rag.EmbedderOptions{APIBase: server.URL, Model: "test"}), store)
+	t.Cleanup(func() { kb.Close() })
+	tools := NewKnowledgeBaseTools(kb, KnowledgeBaseToolOptions{Workspace: workspace, Restrict: true})
+	return tools[0].(*KBIngestTool), tools[1].(*KBSearchTool), workspace
+}
+
+func TestKnowledgeBaseTools(t *testing.T) {
+	ingest, search, workspace := kbTestTools(t)
+	os.WriteFile(filepath.Join(workspace, "faq.md"), []byte("# 医院常见问题\n\n停车：地下停车场B2。\n\n挂号：公众号预约。"), 0644)
+	os.WriteFile(filepath.Join(workspace, "guide.html"), []byte("<html><style>p{}</style><body><p>术后营养：少量多餐。</p></body></html>"), 0644)
+
+	result := ingest.Execute(asUser("1"), map[string]interface{}{"path": "faq.md", "shared": true})
+	if result.IsError || !strings.Contains(result.ForLLM, `"title":"faq"`) || !strings.Contains(result.ForLLM, `"shared":true`) {
+		t.Fatalf("ingest faq: %s", result.ForLLM)
+	}
+	result = ingest.Execute(asUser("1"), map[string]interface{}{"path": "guide.html", "title": "术后饮食指南"})
+	if result.IsError {
+		t.Fatalf("ingest guide: %s", result.ForLLM)
+	}
+	result = ingest.Execute(asUser("1"), map[string]interface{}{"path": "faq.md", "shared": true})
+	if !strings.Contains(result.ForLLM, `"already_ingested":true`) {
+		t.Errorf("second ingest: %s", result.ForLLM)
+	}
+
+	result = search.Execute(asUser("2"), map[string]interface{}{"query": "车停哪里？停车场", "top_k": 1})
+	if result.IsError || !strings.Contains(result.ForLLM, "地下停车场B2") {
+		t.Errorf("search: %s", result.ForLLM)
+	}
+	// The guide is private to user 1.
+	result = search.Execute(asUser("2"), map[string]interface{}{"query": "营养"})
+	if strings.Contains(result.ForLLM, "少量多餐") {
+		t.Errorf("private document visible to another user: %s", result.ForLLM)
+	}
+	result = search.Execute(asUser("1"), map[string]interface{}{"query": "营养", "top_k": 1})
+	if !strings.Contains(result.ForLLM, "少量多餐") || strings.Contains(result.ForLLM, "<p>") {
+		t.Errorf("owner search: %s", result.ForLLM)
+	}
+}
+
+func TestKBIngest_Errors(t *testing.T) {
+	ingest, search, workspace := kbTestTools(t)
+	os.WriteFile(filepath.Join(workspace, "photo.jpg"), []byte{0xff, 0xd8, 0xff, 0xe0, 0x80}, 0644)
+	tests := []struct {
+		name string
+		args map[string]interface{}
+		text string
+	}{
+		{"nothing", map[string]interface{}{}, "exactly one of"},
+		{"two sources", map[string]interface{}{"path": "a.md", "text": "x"}, "exactly one of"},
+		{"text without title", map[string]interface{}{"text": "停车"}, "title is required"},
+		{"outside workspace", map[string]interface{}{"path": "../faq.md"}, "access denied"},
+		{"binary", map[string]interface{}{"path": "photo.jpg"}, "unsupported file type"},
+		{"bad url", map[string]interface{}{"url": "ftp://example.com/a.pdf"}, "http(s)"},
+	}
+	for _, tt := range tests {
+		result := ingest.Execute(context.Background(), tt.args)
+		if !result.IsError || !errors.Is(result.Err, ErrInvalidArgs) || !strings.Contains(result.ForLLM, tt.text) {
+			t.Errorf("%s: %+v", tt.name, result)
+		}
+	}
+
+	result := search.Execute(context.Background(), map[string]interface{}{"query": "停车"})
+	if !result.IsError || !errors.Is(result.Err, ErrNotFound) {
+		t.Errorf("empty knowledge base: %+v", result)
+	}
+}
@@ -9,9 +9,9 @@ import (
 	"io"
 	"net"
 	"net/http"
-	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -23,13 +23,25 @@ var (
 		"MEETING":  {},
 	}
 
-	knowsAllowedAnswerTypes = map[string]struct{}{
-		"CLINICAL":        {},
-		"RESEARCH":        {},
-		"POPULAR_SCIENCE": {},
-	}
-
 	knowsAllDataScopes = []string{"PAPER", "PAPER_CN", "GUIDE", "MEETING"}
+
+	// knowsDescriptionsZH are shown to Chinese-locale frontends.
+	knowsDescriptionsZH = map[string]string{
+		"knows_ai_search":                  "检索临床证据，返回 question_id 和证据列表；生成回答前应先调用。",
+		"knows_answer":                     "基于 knows_ai_search 返回的 question_id 生成场景化回答。",
+		"knows_batch_answer":               "并发为多个 question_id 批量生成回答。",
+		"knows_evidence_summary":           "获取单条证据的 AI 摘要。",
+		"knows_evidence_highlight":         "获取证据原文高亮片段，用于引用和溯源。",
+		"knows_get_paper_en":               "获取英文论文的结构化详情。",
+		"knows_get_paper_cn":               "获取中文论文的结构化详情。",
+		"knows_get_guide":                  "获取临床指南的详细内容。",
+		"knows_get_meeting":                "获取医学会议摘要的详细内容。",
+		"knows_auto_tagging":               "从文本或证据中自动提取标签和结构化要素。",
+		"knows_list_question":              "列出历史提问记录。",
+		"knows_list_interpretation":        "列出历史解读记录。",
+		"knows_batch_get_evidence_details": "批量获取 PAPER、PAPER_CN、GUIDE 或 MEETING 证据详情。",
+		"knows_explore_related":            "从一条证据出发，提取关键词并多轮检索相关证据。",
+	}
 )
 
 const (
@@ -38,7 +50,6 @@ const (
 	defaultKnowsRetryBackoff   = 500 * time.Millisecond
 	defaultKnowsBatchLimit     = 5
 	defaultKnowsCacheTTL       = time.Hour
-	defaultKnowsCacheEntries   = 500
 )
 
 type KnowsToolOptions struct {
@@ -49,8 +60,11 @@ type KnowsToolOptions struct {
 	MaxRetries       int
 	RetryBackoff     time.Duration
 	BatchConcurrency int
-	CacheTTL         time.Duration
-	CacheMaxEntries  int
+	// CacheTTL is how long the CacheMiddleware keeps lookup results.
+	CacheTTL time.Duration
+	// VerifiedQuotes tells the model that only text from
+	// knows_evidence_highlight may be quoted verbatim.
+	VerifiedQuotes bool
 }
 
 type knowsClient struct {
@@ -59,20 +73,6 @@ type knowsClient struct {
 	httpClient   *http.Client
 	maxRetries   int
 	retryBackoff time.Duration
-	cache        *knowsDetailCache
-}
-
-type knowsDetailCache struct {
-	mu         sync.Mutex
-	entries    map[string]knowsCacheEntry
-	order      []string
-	ttl        time.Duration
-	maxEntries int
-}
-
-type knowsCacheEntry struct {
-	value     interface{}
-	expiresAt time.Time
 }
 
 type knowsTool struct {
@@ -80,32 +80,123 @@ type knowsTool struct {
 	description string
 	parameters  map[string]interface{}
 	handler     func(ctx context.Context, args map[string]interface{}) (interface{}, error)
+	cacheTTL    time.Duration
+	// batchArg names the array argument of batch tools; calls with more
+	// than knowsBackgroundBatchSize items run as background jobs.
+	batchArg string
+}
+
+const knowsBackgroundBatchSize = 3
+
+type knowsSearchArgs struct {
+	Question  string   `json:"question" arg:"required"`
+	DataScope []string `json:"data_scope" arg:"enum=PAPER|PAPER_CN|GUIDE|MEETING"`
 }
 
 type knowsBatchAnswerRequest struct {
-	QuestionID string
-	AnswerType string
+	QuestionID string `json:"question_id" arg:"required"`
+	AnswerType string `json:"answer_type" arg:"required,enum=CLINICAL|RESEARCH|POPULAR_SCIENCE"`
+}
+
+type knowsBatchAnswerArgs struct {
+	Requests []knowsBatchAnswerRequest `json:"requests" arg:"required"`
 }
 
 type knowsBatchEvidenceRequest struct {
-	EvidenceID string
-	Type       string
+	EvidenceID string `json:"evidence_id" arg:"required"`
+	Type       string `json:"type" arg:"required,enum=PAPER|PAPER_CN|GUIDE|MEETING"`
+}
+
+type knowsBatchEvidenceArgs struct {
+	Evidences          []knowsBatchEvidenceRequest `json:"evidences" arg:"required"`
+	TranslateToChinese *bool                       `json:"translate_to_chinese"`
+}
+
+// knowsEvidenceArgs are the arguments of the single-evidence lookups.
+type knowsEvidenceArgs struct {
+	EvidenceID         string `json:"evidence_id" arg:"required"`
+	TranslateToChinese *bool  `json:"translate_to_chinese"`
+}
+
+type knowsAutoTaggingArgs struct {
+	Content     string `json:"content"`
+	EvidenceID  string `json:"evidence_id"`
+	TaggingType string `json:"tagging_type" arg:"required"`
+}
+
+type knowsListArgs struct {
+	FromTime *int64 `json:"from_time"`
+	ToTime   *int64 `json:"to_time"`
+	Page     *int64 `json:"page"`
+	PageSize *int64 `json:"page_size"`
 }
 
 func NewKnowsTools(opts KnowsToolOptions) ([]Tool, error) {
+	client, defaultScope, err := newKnowsClient(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	batchConcurrency := opts.BatchConcurrency
+	if batchConcurrency <= 0 {
+		batchConcurrency = defaultKnowsBatchLimit
+	}
+
+	factory := knowsToolFactory{
+		client:           client,
+		defaultDataScope: defaultScope,
+		batchConcurrency: batchConcurrency,
+		verifiedQuotes:   opts.VerifiedQuotes,
+	}
+
+	all := []Tool{
+		factory.aiSearchTool(),
+		factory.answerTool(),
+		factory.batchAnswerTool(),
+		factory.evidenceSummaryTool(),
+		factory.evidenceHighlightTool(),
+		factory.getPaperENTool(),
+		factory.getPaperCNTool(),
+		factory.getGuideTool(),
+		factory.getMeetingTool(),
+		factory.autoTaggingTool(),
+		factory.listQuestionTool(),
+		factory.listInterpretationTool(),
+		factory.batchGetEvidenceDetailsTool(),
+		factory.exploreRelatedTool(),
+	}
+
+	cacheTTL := opts.CacheTTL
+	if cacheTTL <= 0 {
+		cacheTTL = defaultKnowsCacheTTL
+	}
+
+	// Listings change as new questions arrive, so only lookups are cached.
+	for _, tool := range all {
+		if kt, ok := tool.(*knowsTool); ok && !strings.HasPrefix(kt.name, "knows_list_") {
+			kt.cacheTTL = cacheTTL
+		}
+	}
+
+	return all, nil
+}
+
+// newKnowsClient validates opts and builds the API client, returning it
+// with the default data scope.
+func newKnowsClient(opts KnowsToolOptions) (*knowsClient, []string, error) {
 	apiKey := strings.TrimSpace(opts.APIKey)
 	if apiKey == "" {
-		return nil, fmt.Errorf("knows api_key is required")
+		return nil, nil, fmt.Errorf("knows api_key is required")
 	}
 
 	apiBaseURL := strings.TrimSpace(opts.APIBaseURL)
 	if apiBaseURL == "" {
-		return nil, fmt.Errorf("knows api_base_url is required")
+		return nil, nil, fmt.Errorf("knows api_base_url is required")
 	}
 
 	defaultScope, err := normalizeDataScopes(opts.DefaultDataScope)
 	if err != nil {
-		return nil, fmt.Errorf("invalid knows default_data_scope: %w", err)
+		return nil, nil, fmt.Errorf("invalid knows default_data_scope: %w", err)
 	}
 	if len(defaultScope) == 0 {
 		defaultScope = append([]string(nil), knowsAllDataScopes...)
@@ -126,21 +217,6 @@ func NewKnowsTools(opts KnowsToolOptions) ([]Tool, error) {
 		retryBackoff = defaultKnowsRetryBackoff
 	}
 
-	batchConcurrency := opts.BatchConcurrency
-	if batchConcurrency <= 0 {
-		batchConcurrency = defaultKnowsBatchLimit
-	}
-
-	cacheTTL := opts.CacheTTL
-	if cacheTTL <= 0 {
-		cacheTTL = defaultKnowsCacheTTL
-	}
-
-	cacheEntries := opts.CacheMaxEntries
-	if cacheEntries <= 0 {
-		cacheEntries = defaultKnowsCacheEntries
-	}
-
 	client := &knowsClient{
 		baseURL: strings.TrimRight(apiBaseURL, "/"),
 		apiKey:  apiKey,
@@ -149,121 +225,173 @@ func NewKnowsTools(opts KnowsToolOptions) ([]Tool, error) {
 		},
 		maxRetries:   maxRetries,
 		retryBackoff: retryBackoff,
-		cache:        newKnowsDetailCache(cacheTTL, cacheEntries),
 	}
 
-	factory := knowsToolFactory{
-		client:           client,
-		defaultDataScope: defaultScope,
-		batchConcurrency: batchConcurrency,
+	return client, defaultScope, nil
+}
+
+func (t *knowsTool) Name() string {
+	return t.name
+}
+
+func (t *knowsTool) Description() string {
+	return t.description
+}
+
+func (t *knowsTool) Parameters() map[string]interface{} {
+	return t.parameters
+}
+
+func (t *knowsTool) LocalizedDescriptions() map[string]string {
+	if desc, ok := knowsDescriptionsZH[t.name]; ok {
+		return map[string]string{"zh": desc}
 	}
+	return nil
+}
 
-	return []Tool{
-		factory.aiSearchTool(),
-		factory.answerTool(),
-		factory.batchAnswerTool(),
-		factory.evidenceSummaryTool(),
-		factory.evidenceHighlightTool(),
-		factory.getPaperENTool(),
-		factory.getPaperCNTool(),
-		factory.getGuideTool(),
-		factory.getMeetingTool(),
-		factory.autoTaggingTool(),
-		factory.listQuestionTool(),
-		factory.listInterpretationTool(),
-		factory.batchGetEvidenceDetailsTool(),
-	}, nil
+func (t *knowsTool) CacheTTL() time.Duration {
+	return t.cacheTTL
 }
 
-func newKnowsDetailCache(ttl time.Duration, maxEntries int) *knowsDetailCache {
-	return &knowsDetailCache{
-		entries:    make(map[string]knowsCacheEntry),
-		order:      make([]string, 0, maxEntries),
-		ttl:        ttl,
-		maxEntries: maxEntries,
+func (t *knowsTool) RunsInBackground(args map[string]interface{}) bool {
+	if t.batchArg == "" {
+		return false
 	}
+	items, _ := args[t.batchArg].([]interface{})
+	return len(items) > knowsBackgroundBatchSize
 }
 
-func (c *knowsDetailCache) Get(key string) (interface{}, bool) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
+func (t *knowsTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	result, err := t.handler(ctx, args)
+	if err != nil {
+		return ErrorResult(err.Error()).WithError(err)
+	}
 
-	entry, ok := c.entries[key]
-	if !ok {
-		return nil, false
+	if blocks, ok := knowsContentBlocks(result); ok {
+		return RichResult(blocks...)
 	}
 
-	if time.Now().After(entry.expiresAt) {
-		c.deleteLocked(key)
-		return nil, false
+	payload, err := json.Marshal(result)
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("failed to serialize knows response: %v", err)).WithError(err)
 	}
 
-	return entry.value, true
+	return NewToolResult(string(payload))
 }
 
-func (c *knowsDetailCache) Set(key string, value interface{}) {
-	if c.maxEntries <= 0 {
-		return
+// knowsContentBlocks splits figures and tables out of an evidence detail
+// response so they render as images and tables instead of nested JSON.
+// It reports false when the response has neither.
+func knowsContentBlocks(result interface{}) ([]ContentBlock, bool) {
+	obj, ok := result.(map[string]interface{})
+	if !ok {
+		return nil, false
 	}
 
-	c.mu.Lock()
-	defer c.mu.Unlock()
+	rest := make(map[string]interface{}, len(obj))
+	for key, value := range obj {
+		rest[key] = value
+	}
 
-	if _, exists := c.entries[key]; !exists {
-		for len(c.entries) >= c.maxEntries && len(c.order) > 0 {
-			oldest := c.order[0]
-			c.order = c.order[1:]
-			delete(c.entries, oldest)
+	// Fixed key order, so the same response always renders the same way
+	var media []ContentBlock
+	for _, key := range []string{"figures", "images", "tables"} {
+		items, isList := obj[key].([]interface{})
+		if !isList {
+			continue
+		}
+		delete(rest, key)
+		if key == "tables" {
+			media = append(media, knowsTableBlocks(items)...)
+		} else {
+			media = append(media, knowsFigureBlocks(items)...)
 		}
-		c.order = append(c.order, key)
 	}
-
-	c.entries[key] = knowsCacheEntry{
-		value:     value,
-		expiresAt: time.Now().Add(c.ttl),
+	if len(media) == 0 {
+		return nil, false
 	}
+
+	return append([]ContentBlock{JSONBlock(rest)}, media...), true
 }
 
-func (c *knowsDetailCache) deleteLocked(key string) {
-	delete(c.entries, key)
-	for i, existing := range c.order {
-		if existing == key {
-			c.order = append(c.order[:i], c.order[i+1:]...)
-			break
+func knowsFigureBlocks(items []interface{}) []ContentBlock {
+	blocks := make([]ContentBlock, 0, len(items))
+	for _, item := range items {
+		switch v := item.(type) {
+		case string:
+			if v != "" {
+				blocks = append(blocks, ImageBlock(v, ""))
+			}
+		case map[string]interface{}:
+			url, _ := v["url"].(string)
+			caption, _ := v["caption"].(string)
+			if caption == "" {
+				caption, _ = v["title"].(string)
+			}
+			if url != "" {
+				blocks = append(blocks, ImageBlock(url, caption))
+			}
 		}
 	}
+	return blocks
 }
 
-func (t *knowsTool) Name() string {
-	return t.name
-}
+func knowsTableBlocks(items []interface{}) []ContentBlock {
+	blocks := make([]ContentBlock, 0, len(items))
+	for _, item := range items {
+		table, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
 
-func (t *knowsTool) Description() string {
-	return t.description
-}
+		caption, _ := table["caption"].(string)
+		if caption == "" {
+			caption, _ = table["title"].(string)
+		}
 
-func (t *knowsTool) Parameters() map[string]interface{} {
-	return t.parameters
-}
+		headersRaw, _ := table["headers"].([]interface{})
+		if headersRaw == nil {
+			headersRaw, _ = table["columns"].([]interface{})
+		}
+		rowsRaw, _ := table["rows"].([]interface{})
+		if rowsRaw == nil {
+			rowsRaw, _ = table["data"].([]interface{})
+		}
 
-func (t *knowsTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
-	result, err := t.handler(ctx, args)
-	if err != nil {
-		return ErrorResult(err.Error()).WithError(err)
+		headers := knowsCells(headersRaw)
+		rows := make([][]string, 0, len(rowsRaw))
+		for _, row := range rowsRaw {
+			if cells, ok := row.([]interface{}); ok {
+				rows = append(rows, knowsCells(cells))
+			}
+		}
+		if len(headers) == 0 && len(rows) == 0 {
+			continue
+		}
+		blocks = append(blocks, TableBlock(caption, headers, rows))
 	}
+	return blocks
+}
 
-	payload, err := json.Marshal(result)
-	if err != nil {
-		return ErrorResult(fmt.Sprintf("failed to serialize knows response: %v", err)).WithError(err)
+func knowsCells(values []interface{}) []string {
+	cells := make([]string, len(values))
+	for i, v := range values {
+		switch cell := v.(type) {
+		case nil:
+		case string:
+			cells[i] = cell
+		default:
+			cells[i] = fmt.Sprint(cell)
+		}
 	}
-
-	return NewToolResult(string(payload))
+	return cells
 }
 
 type knowsToolFactory struct {
 	client           *knowsClient
 	defaultDataScope []string
 	batchConcurrency int
+	verifiedQuotes   bool
 }
 
 func (f knowsToolFactory) aiSearchTool() Tool {
@@ -289,16 +417,12 @@ func (f knowsToolFactory) aiSearchTool() Tool {
 			"required": []string{"question"},
 		},
 		handler: func(ctx context.Context, args map[string]interface{}) (interface{}, error) {
-			question, err := getRequiredString(args, "question")
-			if err != nil {
-				return nil, err
-			}
-
-			scope, err := getOptionalStringArray(args, "data_scope")
+			a, err := BindArgs[knowsSearchArgs](args)
 			if err != nil {
 				return nil, err
 			}
 
+			scope := a.DataScope
 			if len(scope) == 0 {
 				scope = append([]string(nil), f.defaultDataScope...)
 			}
@@ -308,7 +432,7 @@ func (f knowsToolFactory) aiSearchTool() Tool {
 				return nil, err
 			}
 
-			return f.client.aiSearch(ctx, question, normalizedScope)
+			return f.client.aiSearch(ctx, a.Question, normalizedScope)
 		},
 	}
 }
@@ -333,22 +457,11 @@ func (f knowsToolFactory) answerTool() Tool {
 			"required": []string{"question_id", "answer_type"},
 		},
 		handler: func(ctx context.Context, args map[string]interface{}) (interface{}, error) {
-			questionID, err := getRequiredString(args, "question_id")
-			if err != nil {
-				return nil, err
-			}
-
-			answerType, err := getRequiredString(args, "answer_type")
-			if err != nil {
-				return nil, err
-			}
-
-			answerType, err = normalizeAnswerType(answerType)
+			a, err := BindArgs[knowsBatchAnswerRequest](args)
 			if err != nil {
 				return nil, err
 			}
-
-			return f.client.answer(ctx, questionID, answerType)
+			return f.client.answer(ctx, a.QuestionID, a.AnswerType)
 		},
 	}
 }
@@ -356,6 +469,7 @@ func (f knowsToolFactory) answerTool() Tool {
 func (f knowsToolFactory) batchAnswerTool() Tool {
 	return &knowsTool{
 		name:        "knows_batch_answer",
+		batchArg:    "requests",
 		description: "Batch generate answers for multiple question_id values concurrently.",
 		parameters: map[string]interface{}{
 			"type": "object",
@@ -380,10 +494,11 @@ func (f knowsToolFactory) batchAnswerTool() Tool {
 			"required": []string{"requests"},
 		},
 		handler: func(ctx context.Context, args map[string]interface{}) (interface{}, error) {
-			requests, err := parseBatchAnswerRequests(args)
+			a, err := BindArgs[knowsBatchAnswerArgs](args)
 			if err != nil {
 				return nil, err
 			}
+			requests := a.Requests
 
 			type batchResult struct {
 				index int
@@ -394,6 +509,7 @@ func (f knowsToolFactory) batchAnswerTool() Tool {
 			results := make([]map[string]interface{}, len(requests))
 			ch := make(chan batchResult, len(requests))
 			var wg sync.WaitGroup
+			var done atomic.Int32
 
 			for i, req := range requests {
 				i, req := i, req
@@ -416,6 +532,8 @@ func (f knowsToolFactory) batchAnswerTool() Tool {
 						item["data"] = data
 					}
 					ch <- batchResult{index: i, data: item}
+					n := int(done.Add(1))
+					ReportProgress(ctx, Progress{Done: n, Total: len(requests), Message: fmt.Sprintf("已生成 %d/%d 个回答…", n, len(requests))})
 				}()
 			}
 
@@ -445,19 +563,24 @@ func (f knowsToolFactory) evidenceSummaryTool() Tool {
 			"required": []string{"evidence_id"},
 		},
 		handler: func(ctx context.Context, args map[string]interface{}) (interface{}, error) {
-			evidenceID, err := getRequiredString(args, "evidence_id")
+			a, err := BindArgs[knowsEvidenceArgs](args)
 			if err != nil {
 				return nil, err
 			}
-			return f.client.evidenceSummary(ctx, evidenceID)
+			return f.client.evidenceSummary(ctx, a.EvidenceID)
 		},
 	}
 }
 
 func (f knowsToolFactory) evidenceHighlightTool() Tool {
+	description := "Get highlighted original evidence snippets for citation and traceability."
+	if f.verifiedQuotes {
+		description += " Direct quotes in answers must be copied verbatim from this output; " +
+			"any other quotation is replaced with a paraphrase and citation."
+	}
 	return &knowsTool{
 		name:        "knows_evidence_highlight",
-		description: "Get highlighted original evidence snippets for citation and traceability.",
+		description: description,
 		parameters: map[string]interface{}{
 			"type": "object",
 			"properties": map[string]interface{}{
@@ -468,11 +591,11 @@ func (f knowsToolFactory) evidenceHighlightTool() Tool {
 			"required": []string{"evidence_id"},
 		},
 		handler: func(ctx context.Context, args map[string]interface{}) (interface{}, error) {
-			evidenceID, err := getRequiredString(args, "evidence_id")
+			a, err := BindArgs[knowsEvidenceArgs](args)
 			if err != nil {
 				return nil, err
 			}
-			return f.client.evidenceHighlight(ctx, evidenceID)
+			return f.client.evidenceHighlight(ctx, a.EvidenceID)
 		},
 	}
 }
@@ -495,15 +618,11 @@ func (f knowsToolFactory) getPaperENTool() Tool {
 			"required": []string{"evidence_id"},
 		},
 		handler: func(ctx context.Context, args map[string]interface{}) (interface{}, error) {
-			evidenceID, err := getRequiredString(args, "evidence_id")
+			a, err := BindArgs[knowsEvidenceArgs](args)
 			if err != nil {
 				return nil, err
 			}
-			translate, err := getOptionalBoolPointer(args, "translate_to_chinese")
-			if err != nil {
-				return nil, err
-			}
-			return f.client.getPaperEN(ctx, evidenceID, translate)
+			return f.client.getPaperEN(ctx, a.EvidenceID, a.TranslateToChinese)
 		},
 	}
 }
@@ -522,11 +641,11 @@ func (f knowsToolFactory) getPaperCNTool() Tool {
 			"required": []string{"evidence_id"},
 		},
 		handler: func(ctx context.Context, args map[string]interface{}) (interface{}, error) {
-			evidenceID, err := getRequiredString(args, "evidence_id")
+			a, err := BindArgs[knowsEvidenceArgs](args)
 			if err != nil {
 				return nil, err
 			}
-			return f.client.getPaperCN(ctx, evidenceID)
+			return f.client.getPaperCN(ctx, a.EvidenceID)
 		},
 	}
 }
@@ -548,15 +667,11 @@ func (f knowsToolFactory) getGuideTool() Tool {
 			"required": []string{"evidence_id"},
 		},
 		handler: func(ctx context.Context, args map[string]interface{}) (interface{}, error) {
-			evidenceID, err := getRequiredString(args, "evidence_id")
-			if err != nil {
-				return nil, err
-			}
-			translate, err := getOptionalBoolPointer(args, "translate_to_chinese")
+			a, err := BindArgs[knowsEvidenceArgs](args)
 			if err != nil {
 				return nil, err
 			}
-			return f.client.getGuide(ctx, evidenceID, translate)
+			return f.client.getGuide(ctx, a.EvidenceID, a.TranslateToChinese)
 		},
 	}
 }
@@ -578,15 +693,11 @@ func (f knowsToolFactory) getMeetingTool() Tool {
 			"required": []string{"evidence_id"},
 		},
 		handler: func(ctx context.Context, args map[string]interface{}) (interface{}, error) {
-			evidenceID, err := getRequiredString(args, "evidence_id")
+			a, err := BindArgs[knowsEvidenceArgs](args)
 			if err != nil {
 				return nil, err
 			}
-			translate, err := getOptionalBoolPointer(args, "translate_to_chinese")
-			if err != nil {
-				return nil, err
-			}
-			return f.client.getMeeting(ctx, evidenceID, translate)
+			return f.client.getMeeting(ctx, a.EvidenceID, a.TranslateToChinese)
 		},
 	}
 }
@@ -611,21 +722,11 @@ func (f knowsToolFactory) autoTaggingTool() Tool {
 			"required": []string{"tagging_type"},
 		},
 		handler: func(ctx context.Context, args map[string]interface{}) (interface{}, error) {
-			taggingType, err := getRequiredString(args, "tagging_type")
-			if err != nil {
-				return nil, err
-			}
-
-			content, err := getOptionalString(args, "content")
-			if err != nil {
-				return nil, err
-			}
-			evidenceID, err := getOptionalString(args, "evidence_id")
+			a, err := BindArgs[knowsAutoTaggingArgs](args)
 			if err != nil {
 				return nil, err
 			}
-
-			return f.client.autoTagging(ctx, content, evidenceID, taggingType)
+			return f.client.autoTagging(ctx, a.Content, a.EvidenceID, a.TaggingType)
 		},
 	}
 }
@@ -652,24 +753,11 @@ func (f knowsToolFactory) listQuestionTool() Tool {
 			},
 		},
 		handler: func(ctx context.Context, args map[string]interface{}) (interface{}, error) {
-			fromTime, err := getOptionalInt64(args, "from_time")
-			if err != nil {
-				return nil, err
-			}
-			toTime, err := getOptionalInt64(args, "to_time")
+			a, err := BindArgs[knowsListArgs](args)
 			if err != nil {
 				return nil, err
 			}
-			page, err := getOptionalInt64(args, "page")
-			if err != nil {
-				return nil, err
-			}
-			pageSize, err := getOptionalInt64(args, "page_size")
-			if err != nil {
-				return nil, err
-			}
-
-			return f.client.listQuestion(ctx, fromTime, toTime, page, pageSize)
+			return f.client.listQuestion(ctx, a.FromTime, a.ToTime, a.Page, a.PageSize)
 		},
 	}
 }
@@ -696,24 +784,11 @@ func (f knowsToolFactory) listInterpretationTool() Tool {
 			},
 		},
 		handler: func(ctx context.Context, args map[string]interface{}) (interface{}, error) {
-			fromTime, err := getOptionalInt64(args, "from_time")
+			a, err := BindArgs[knowsListArgs](args)
 			if err != nil {
 				return nil, err
 			}
-			toTime, err := getOptionalInt64(args, "to_time")
-			if err != nil {
-				return nil, err
-			}
-			page, err := getOptionalInt64(args, "page")
-			if err != nil {
-				return nil, err
-			}
-			pageSize, err := getOptionalInt64(args, "page_size")
-			if err != nil {
-				return nil, err
-			}
-
-			return f.client.listInterpretation(ctx, fromTime, toTime, page, pageSize)
+			return f.client.listInterpretation(ctx, a.FromTime, a.ToTime, a.Page, a.PageSize)
 		},
 	}
 }
@@ -721,6 +796,7 @@ func (f knowsToolFactory) listInterpretationTool() Tool {
 func (f knowsToolFactory) batchGetEvidenceDetailsTool() Tool {
 	return &knowsTool{
 		name:        "knows_batch_get_evidence_details",
+		batchArg:    "evidences",
 		description: "Batch get evidence details for PAPER, PAPER_CN, GUIDE, or MEETING.",
 		parameters: map[string]interface{}{
 			"type": "object",
@@ -748,14 +824,11 @@ func (f knowsToolFactory) batchGetEvidenceDetailsTool() Tool {
 			"required": []string{"evidences"},
 		},
 		handler: func(ctx context.Context, args map[string]interface{}) (interface{}, error) {
-			evidences, err := parseBatchEvidenceRequests(args)
-			if err != nil {
-				return nil, err
-			}
-			translate, err := getOptionalBoolPointer(args, "translate_to_chinese")
+			a, err := BindArgs[knowsBatchEvidenceArgs](args)
 			if err != nil {
 				return nil, err
 			}
+			evidences, translate := a.Evidences, a.TranslateToChinese
 
 			type batchResult struct {
 				index int
@@ -766,6 +839,7 @@ func (f knowsToolFactory) batchGetEvidenceDetailsTool() Tool {
 			results := make([]map[string]interface{}, len(evidences))
 			ch := make(chan batchResult, len(evidences))
 			var wg sync.WaitGroup
+			var done atomic.Int32
 
 			for i, item := range evidences {
 				i, item := i, item
@@ -790,6 +864,8 @@ func (f knowsToolFactory) batchGetEvidenceDetailsTool() Tool {
 					}
 
 					ch <- batchResult{index: i, data: row}
+					n := int(done.Add(1))
+					ReportProgress(ctx, Progress{Done: n, Total: len(evidences), Message: fmt.Sprintf("已检索 %d/%d 篇文献…", n, len(evidences))})
 				}()
 			}
 
@@ -832,15 +908,6 @@ func (c *knowsClient) evidenceHighlight(ctx context.Context, evidenceID string)
 }
 
 func (c *knowsClient) getPaperEN(ctx context.Context, evidenceID string, translate *bool) (interface{}, error) {
-	translateKey := false
-	if translate != nil {
-		translateKey = *translate
-	}
-	cacheKey := fmt.Sprintf("PAPER:%s:%t", evidenceID, translateKey)
-	if cached, ok := c.cache.Get(cacheKey); ok {
-		return cached, nil
-	}
-
 	payload := map[string]interface{}{
 		"evidence_id": evidenceID,
 	}
@@ -848,40 +915,16 @@ func (c *knowsClient) getPaperEN(ctx context.Context, evidenceID string, transla
 		payload["translate_to_chinese"] = *translate
 	}
 
-	data, err := c.postJSON(ctx, "/knows/evidence/get_paper_en", payload)
-	if err != nil {
-		return nil, err
-	}
-	c.cache.Set(cacheKey, data)
-	return data, nil
+	return c.postJSON(ctx, "/knows/evidence/get_paper_en", payload)
 }
 
 func (c *knowsClient) getPaperCN(ctx context.Context, evidenceID string) (interface{}, error) {
-	cacheKey := fmt.Sprintf("PAPER_CN:%s:false", evidenceID)
-	if cached, ok := c.cache.Get(cacheKey); ok {
-		return cached, nil
-	}
-
-	data, err := c.postJSON(ctx, "/knows/evidence/get_paper_cn", map[string]interface{}{
+	return c.postJSON(ctx, "/knows/evidence/get_paper_cn", map[string]interface{}{
 		"evidence_id": evidenceID,
 	})
-	if err != nil {
-		return nil, err
-	}
-	c.cache.Set(cacheKey, data)
-	return data, nil
 }
 
 func (c *knowsClient) getGuide(ctx context.Context, evidenceID string, translate *bool) (interface{}, error) {
-	translateKey := false
-	if translate != nil {
-		translateKey = *translate
-	}
-	cacheKey := fmt.Sprintf("GUIDE:%s:%t", evidenceID, translateKey)
-	if cached, ok := c.cache.Get(cacheKey); ok {
-		return cached, nil
-	}
-
 	payload := map[string]interface{}{
 		"evidence_id": evidenceID,
 	}
@@ -889,24 +932,10 @@ func (c *knowsClient) getGuide(ctx context.Context, evidenceID string, translate
 		payload["translate_to_chinese"] = *translate
 	}
 
-	data, err := c.postJSON(ctx, "/knows/evidence/get_guide", payload)
-	if err != nil {
-		return nil, err
-	}
-	c.cache.Set(cacheKey, data)
-	return data, nil
+	return c.postJSON(ctx, "/knows/evidence/get_guide", payload)
 }
 
 func (c *knowsClient) getMeeting(ctx context.Context, evidenceID string, translate *bool) (interface{}, error) {
-	translateKey := false
-	if translate != nil {
-		translateKey = *translate
-	}
-	cacheKey := fmt.Sprintf("MEETING:%s:%t", evidenceID, translateKey)
-	if cached, ok := c.cache.Get(cacheKey); ok {
-		return cached, nil
-	}
-
 	payload := map[string]interface{}{
 		"evidence_id": evidenceID,
 	}
@@ -914,12 +943,7 @@ func (c *knowsClient) getMeeting(ctx context.Context, evidenceID string, transla
 		payload["translate_to_chinese"] = *translate
 	}
 
-	data, err := c.postJSON(ctx, "/knows/evidence/get_meeting", payload)
-	if err != nil {
-		return nil, err
-	}
-	c.cache.Set(cacheKey, data)
-	return data, nil
+	return c.postJSON(ctx, "/knows/evidence/get_meeting", payload)
 }
 
 func (c *knowsClient) autoTagging(ctx context.Context, content, evidenceID, taggingType string) (interface{}, error) {
@@ -981,7 +1005,7 @@ func (c *knowsClient) fetchEvidenceDetail(ctx context.Context, evidenceID, evide
 	case "MEETING":
 		return c.getMeeting(ctx, evidenceID, translate)
 	default:
-		return nil, fmt.Errorf("unsupported evidence type %q; allowed: PAPER, PAPER_CN, GUIDE, MEETING", evidenceType)
+		return nil, invalidArgs("unsupported evidence type %q; allowed: PAPER, PAPER_CN, GUIDE, MEETING", evidenceType)
 	}
 }
 
@@ -1015,6 +1039,9 @@ func (c *knowsClient) postJSON(ctx context.Context, path string, payload interfa
 				}
 				continue
 			}
+			if ctx.Err() == nil {
+				lastErr = ClassifyError(ErrRetryable, lastErr)
+			}
 			return nil, lastErr
 		}
 
@@ -1028,6 +1055,9 @@ func (c *knowsClient) postJSON(ctx context.Context, path string, payload interfa
 				}
 				continue
 			}
+			if ctx.Err() == nil {
+				lastErr = ClassifyError(ErrRetryable, lastErr)
+			}
 			return nil, lastErr
 		}
 
@@ -1039,6 +1069,9 @@ func (c *knowsClient) postJSON(ctx context.Context, path string, payload interfa
 				}
 				continue
 			}
+			if kind := StatusErrorKind(resp.StatusCode); kind != nil {
+				lastErr = ClassifyError(kind, lastErr)
+			}
 			return nil, lastErr
 		}
 
@@ -1100,206 +1133,9 @@ func waitRetry(ctx context.Context, baseDelay time.Duration, attempt int) error
 	}
 }
 
-func parseBatchAnswerRequests(args map[string]interface{}) ([]knowsBatchAnswerRequest, error) {
-	raw, err := getRequiredArray(args, "requests")
-	if err != nil {
-		return nil, err
-	}
-
-	out := make([]knowsBatchAnswerRequest, 0, len(raw))
-	for i, item := range raw {
-		m, ok := item.(map[string]interface{})
-		if !ok {
-			return nil, fmt.Errorf("requests[%d] must be an object", i)
-		}
-
-		questionID, err := getRequiredString(m, "question_id")
-		if err != nil {
-			return nil, fmt.Errorf("requests[%d]: %w", i, err)
-		}
-		answerType, err := getRequiredString(m, "answer_type")
-		if err != nil {
-			return nil, fmt.Errorf("requests[%d]: %w", i, err)
-		}
-		answerType, err = normalizeAnswerType(answerType)
-		if err != nil {
-			return nil, fmt.Errorf("requests[%d]: %w", i, err)
-		}
-
-		out = append(out, knowsBatchAnswerRequest{
-			QuestionID: questionID,
-			AnswerType: answerType,
-		})
-	}
-
-	if len(out) == 0 {
-		return nil, fmt.Errorf("requests must not be empty")
-	}
-	return out, nil
-}
-
-func parseBatchEvidenceRequests(args map[string]interface{}) ([]knowsBatchEvidenceRequest, error) {
-	raw, err := getRequiredArray(args, "evidences")
-	if err != nil {
-		return nil, err
-	}
-
-	out := make([]knowsBatchEvidenceRequest, 0, len(raw))
-	for i, item := range raw {
-		m, ok := item.(map[string]interface{})
-		if !ok {
-			return nil, fmt.Errorf("evidences[%d] must be an object", i)
-		}
-
-		evidenceID, err := getRequiredString(m, "evidence_id")
-		if err != nil {
-			return nil, fmt.Errorf("evidences[%d]: %w", i, err)
-		}
-		evidenceType, err := getRequiredString(m, "type")
-		if err != nil {
-			return nil, fmt.Errorf("evidences[%d]: %w", i, err)
-		}
-		evidenceType, err = normalizeDataScope(evidenceType)
-		if err != nil {
-			return nil, fmt.Errorf("evidences[%d]: %w", i, err)
-		}
-
-		out = append(out, knowsBatchEvidenceRequest{
-			EvidenceID: evidenceID,
-			Type:       evidenceType,
-		})
-	}
-
-	if len(out) == 0 {
-		return nil, fmt.Errorf("evidences must not be empty")
-	}
-	return out, nil
-}
-
-func getRequiredString(args map[string]interface{}, key string) (string, error) {
-	raw, ok := args[key]
-	if !ok {
-		return "", fmt.Errorf("%s is required", key)
-	}
-	str, ok := raw.(string)
-	if !ok || strings.TrimSpace(str) == "" {
-		return "", fmt.Errorf("%s must be a non-empty string", key)
-	}
-	return strings.TrimSpace(str), nil
-}
-
-func getOptionalString(args map[string]interface{}, key string) (string, error) {
-	raw, ok := args[key]
-	if !ok || raw == nil {
-		return "", nil
-	}
-	str, ok := raw.(string)
-	if !ok {
-		return "", fmt.Errorf("%s must be a string", key)
-	}
-	return strings.TrimSpace(str), nil
-}
-
-func getOptionalBoolPointer(args map[string]interface{}, key string) (*bool, error) {
-	raw, ok := args[key]
-	if !ok || raw == nil {
-		return nil, nil
-	}
-
-	switch v := raw.(type) {
-	case bool:
-		value := v
-		return &value, nil
-	case string:
-		parsed, err := strconv.ParseBool(strings.TrimSpace(v))
-		if err != nil {
-			return nil, fmt.Errorf("%s must be a boolean", key)
-		}
-		return &parsed, nil
-	default:
-		return nil, fmt.Errorf("%s must be a boolean", key)
-	}
-}
-
-func getOptionalInt64(args map[string]interface{}, key string) (*int64, error) {
-	raw, ok := args[key]
-	if !ok || raw == nil {
-		return nil, nil
-	}
-
-	switch v := raw.(type) {
-	case float64:
-		value := int64(v)
-		return &value, nil
-	case int:
-		value := int64(v)
-		return &value, nil
-	case int64:
-		value := v
-		return &value, nil
-	case json.Number:
-		n, err := v.Int64()
-		if err != nil {
-			return nil, fmt.Errorf("%s must be an integer", key)
-		}
-		return &n, nil
-	case string:
-		n, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
-		if err != nil {
-			return nil, fmt.Errorf("%s must be an integer", key)
-		}
-		return &n, nil
-	default:
-		return nil, fmt.Errorf("%s must be an integer", key)
-	}
-}
-
-func getRequiredArray(args map[string]interface{}, key string) ([]interface{}, error) {
-	raw, ok := args[key]
-	if !ok {
-		return nil, fmt.Errorf("%s is required", key)
-	}
-	arr, ok := raw.([]interface{})
-	if !ok {
-		return nil, fmt.Errorf("%s must be an array", key)
-	}
-	return arr, nil
-}
-
-func getOptionalStringArray(args map[string]interface{}, key string) ([]string, error) {
-	raw, ok := args[key]
-	if !ok || raw == nil {
-		return nil, nil
-	}
-
-	switch v := raw.(type) {
-	case []string:
-		out := make([]string, 0, len(v))
-		for _, item := range v {
-			text := strings.TrimSpace(item)
-			if text == "" {
-				continue
-			}
-			out = append(out, text)
-		}
-		return out, nil
-	case []interface{}:
-		out := make([]string, 0, len(v))
-		for i, item := range v {
-			text, ok := item.(string)
-			if !ok {
-				return nil, fmt.Errorf("%s[%d] must be a string", key, i)
-			}
-			text = strings.TrimSpace(text)
-			if text == "" {
-				continue
-			}
-			out = append(out, text)
-		}
-		return out, nil
-	default:
-		return nil, fmt.Errorf("%s must be an array of strings", key)
-	}
+// invalidArgs reports an argument the model got wrong.
+func invalidArgs(format string, args ...interface{}) error {
+	return ClassifyError(ErrInvalidArgs, fmt.Errorf(format, args...))
 }
 
 func normalizeDataScopes(scopes []string) ([]string, error) {
@@ -1326,21 +1162,10 @@ func normalizeDataScopes(scopes []string) ([]string, error) {
 func normalizeDataScope(scope string) (string, error) {
 	normalized := strings.ToUpper(strings.TrimSpace(scope))
 	if normalized == "" {
-		return "", fmt.Errorf("data scope must be non-empty")
+		return "", invalidArgs("data scope must be non-empty")
 	}
 	if _, ok := knowsAllowedDataScopes[normalized]; !ok {
-		return "", fmt.Errorf("unsupported data scope %q; allowed: PAPER, PAPER_CN, GUIDE, MEETING", scope)
-	}
-	return normalized, nil
-}
-
-func normalizeAnswerType(answerType string) (string, error) {
-	normalized := strings.ToUpper(strings.TrimSpace(answerType))
-	if normalized == "" {
-		return "", fmt.Errorf("answer_type must be non-empty")
-	}
-	if _, ok := knowsAllowedAnswerTypes[normalized]; !ok {
-		return "", fmt.Errorf("unsupported answer_type %q; allowed: CLINICAL, RESEARCH, POPULAR_SCIENCE", answerType)
+		return "", invalidArgs("unsupported data scope %q; allowed: PAPER, PAPER_CN, GUIDE, MEETING", scope)
 	}
 	return normalized, nil
 }
@@ -0,0 +1,291 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// knowsExploreNode is one evidence item waiting to be expanded.
+type knowsExploreNode struct {
+	EvidenceID string
+	Depth      int
+}
+
+type knowsExploreOptions struct {
+	EvidenceID  string   `json:"evidence_id" arg:"required"`
+	TaggingType string   `json:"tagging_type" arg:"default=KEYWORD"`
+	DataScope   []string `json:"data_scope" arg:"enum=PAPER|PAPER_CN|GUIDE|MEETING"`
+	MaxDepth    int      `json:"max_depth" arg:"default=2,min=1,max=3"`
+	MaxBreadth  int      `json:"max_breadth" arg:"default=3,min=1,max=5"`
+	MaxResults  int      `json:"max_results" arg:"default=20,min=1,max=50"`
+}
+
+func (f knowsToolFactory) exploreRelatedTool() Tool {
+	return &knowsTool{
+		name: "knows_explore_related",
+		description: "Starting from one evidence item, extract its key terms via auto tagging and run follow-up searches " +
+			"to surface related evidence the original query missed. Bounded by depth and breadth budgets.",
+		parameters: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"evidence_id": map[string]interface{}{
+					"type":        "string",
+					"description": "Seed evidence_id to explore from.",
+				},
+				"tagging_type": map[string]interface{}{
+					"type":        "string",
+					"description": "Tagging type passed to auto tagging. Defaults to KEYWORD.",
+				},
+				"data_scope": map[string]interface{}{
+					"type":        "array",
+					"description": "Optional evidence types for follow-up searches. Allowed: PAPER, PAPER_CN, GUIDE, MEETING.",
+					"items": map[string]interface{}{
+						"type": "string",
+						"enum": knowsAllDataScopes,
+					},
+				},
+				"max_depth": map[string]interface{}{
+					"type":        "integer",
+					"description": "Number of hops to follow from the seed (1-3, default 2).",
+				},
+				"max_breadth": map[string]interface{}{
+					"type":        "integer",
+					"description": "Number of terms searched per evidence item (1-5, default 3).",
+				},
+				"max_results": map[string]interface{}{
+					"type":        "integer",
+					"description": "Maximum related evidence items returned (1-50, default 20).",
+				},
+			},
+			"required": []string{"evidence_id"},
+		},
+		handler: func(ctx context.Context, args map[string]interface{}) (interface{}, error) {
+			opts, err := f.parseExploreOptions(args)
+			if err != nil {
+				return nil, err
+			}
+			return f.client.exploreRelated(ctx, opts)
+		},
+	}
+}
+
+func (f knowsToolFactory) parseExploreOptions(args map[string]interface{}) (knowsExploreOptions, error) {
+	opts, err := BindArgs[knowsExploreOptions](args)
+	if err != nil {
+		return opts, err
+	}
+	scope := opts.DataScope
+	if len(scope) == 0 {
+		scope = append([]string(nil), f.defaultDataScope...)
+	}
+	opts.DataScope, err = normalizeDataScopes(scope)
+	return opts, err
+}
+
+// exploreRelated walks outward from a seed evidence item breadth-first.
+// Each hop tags the current item, searches with its unseen terms, and
+// queues any evidence not seen before for the next hop.
+func (c *knowsClient) exploreRelated(ctx context.Context, opts knowsExploreOptions) (interface{}, error) {
+	seenEvidence := map[string]struct{}{opts.EvidenceID: {}}
+	seenTerms := make(map[string]struct{})
+	searched := make([]map[string]interface{}, 0)
+	related := make([]map[string]interface{}, 0)
+	truncated := false
+
+	frontier := []knowsExploreNode{{EvidenceID: opts.EvidenceID}}
+	for len(frontier) > 0 && !truncated {
+		node := frontier[0]
+		frontier = frontier[1:]
+		if node.Depth >= opts.MaxDepth {
+			continue
+		}
+
+		tags, err := c.autoTagging(ctx, "", node.EvidenceID, opts.TaggingType)
+		if err != nil {
+			if node.EvidenceID == opts.EvidenceID {
+				return nil, fmt.Errorf("failed to tag seed evidence: %w", err)
+			}
+			continue
+		}
+
+		terms := make([]string, 0, opts.MaxBreadth)
+		for _, term := range extractKnowsTerms(tags) {
+			key := strings.ToLower(term)
+			if _, ok := seenTerms[key]; ok {
+				continue
+			}
+			seenTerms[key] = struct{}{}
+			terms = append(terms, term)
+			if len(terms) >= opts.MaxBreadth {
+				break
+			}
+		}
+
+		for _, term := range terms {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+
+			data, err := c.aiSearch(ctx, term, opts.DataScope)
+			entry := map[string]interface{}{
+				"term":        term,
+				"from":        node.EvidenceID,
+				"depth":       node.Depth + 1,
+				"new_results": 0,
+			}
+			if err != nil {
+				entry["error"] = err.Error()
+				searched = append(searched, entry)
+				continue
+			}
+
+			added := 0
+			for _, ev := range extractKnowsEvidences(data) {
+				id := knowsEvidenceID(ev)
+				if id == "" {
+					continue
+				}
+				if _, ok := seenEvidence[id]; ok {
+					continue
+				}
+				if len(related) >= opts.MaxResults {
+					truncated = true
+					break
+				}
+				seenEvidence[id] = struct{}{}
+
+				item := map[string]interface{}{
+					"evidence_id": id,
+					"depth":       node.Depth + 1,
+					"via_term":    term,
+					"parent_id":   node.EvidenceID,
+				}
+				for _, key := range []string{"type", "title", "title_cn", "source", "year"} {
+					if v, ok := ev[key]; ok && v != nil {
+						item[key] = v
+					}
+				}
+				related = append(related, item)
+				frontier = append(frontier, knowsExploreNode{EvidenceID: id, Depth: node.Depth + 1})
+				added++
+			}
+			entry["new_results"] = added
+			searched = append(searched, entry)
+
+			if truncated {
+				break
+			}
+		}
+	}
+
+	return map[string]interface{}{
+		"seed_evidence_id": opts.EvidenceID,
+		"searches":         searched,
+		"related":          related,
+		"truncated":        truncated,
+	}, nil
+}
+
+// extractKnowsTerms pulls tag strings out of an auto tagging response.
+// The response shape varies by tagging type, so any string found under a
+// tag-like key (or as name/tag/value of an element object) is accepted.
+func extractKnowsTerms(raw interface{}) []string {
+	var out []string
+	seen := make(map[string]struct{})
+	add := func(s string) {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			return
+		}
+		key := strings.ToLower(s)
+		if _, ok := seen[key]; ok {
+			return
+		}
+		seen[key] = struct{}{}
+		out = append(out, s)
+	}
+
+	var walk func(v interface{}, tagged bool)
+	walk = func(v interface{}, tagged bool) {
+		switch val := v.(type) {
+		case string:
+			if tagged {
+				add(val)
+			}
+		case []interface{}:
+			for _, item := range val {
+				walk(item, tagged)
+			}
+		case map[string]interface{}:
+			if tagged {
+				for _, key := range []string{"name", "tag", "value", "text", "term"} {
+					if s, ok := val[key].(string); ok {
+						add(s)
+						return
+					}
+				}
+			}
+			// Keys in order, so the same result always yields the same terms
+			keys := make([]string, 0, len(val))
+			for key := range val {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				walk(val[key], tagged || isKnowsTagKey(key))
+			}
+		}
+	}
+	walk(raw, false)
+	return out
+}
+
+func isKnowsTagKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, marker := range []string{"tag", "keyword", "term", "element", "entit", "mesh"} {
+		if strings.Contains(key, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// extractKnowsEvidences returns the evidence objects from an ai_search response.
+func extractKnowsEvidences(raw interface{}) []map[string]interface{} {
+	var list []interface{}
+	switch val := raw.(type) {
+	case []interface{}:
+		list = val
+	case map[string]interface{}:
+		for _, key := range []string{"evidences", "evidence_list", "evidence", "items", "list"} {
+			if arr, ok := val[key].([]interface{}); ok {
+				list = arr
+				break
+			}
+		}
+	}
+
+	out := make([]map[string]interface{}, 0, len(list))
+	for _, item := range list {
+		if m, ok := item.(map[string]interface{}); ok {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+func knowsEvidenceID(ev map[string]interface{}) string {
+	for _, key := range []string{"evidence_id", "id"} {
+		switch v := ev[key].(type) {
+		case string:
+			if s := strings.TrimSpace(v); s != "" {
+				return s
+			}
+		case float64:
+			return fmt.Sprintf("%.0f", v)
+		}
+	}
+	return ""
+}
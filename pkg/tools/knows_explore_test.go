@@ -0,0 +1,148 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestKnowsExploreRelated_FollowsTagsWithinBudget(t *testing.T) {
+	t.Parallel()
+
+	var mu sync.Mutex
+	var queries []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]interface{}
+		_ = json.NewDecoder(r.Body).Decode(&payload)
+
+		switch r.URL.Path {
+		case "/knows/auto_tagging":
+			id, _ := payload["evidence_id"].(string)
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"data": map[string]interface{}{
+					"tags": []interface{}{
+						map[string]interface{}{"name": "tag-" + id},
+						"shared",
+					},
+				},
+			})
+		case "/knows/ai_search":
+			query, _ := payload["query"].(string)
+			mu.Lock()
+			queries = append(queries, query)
+			mu.Unlock()
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"data": map[string]interface{}{
+					"question_id": "q",
+					"evidences": []interface{}{
+						map[string]interface{}{"id": "seed", "type": "PAPER"},
+						map[string]interface{}{"id": "from-" + query, "type": "GUIDE", "title": "T"},
+					},
+				},
+			})
+		default:
+			t.Errorf("unexpected path: %s", r.URL.Path)
+		}
+	}))
+	defer server.Close()
+
+	tools, err := NewKnowsTools(KnowsToolOptions{
+		APIKey:         "test-key",
+		APIBaseURL:     server.URL,
+		RequestTimeout: 10 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("NewKnowsTools() error = %v", err)
+	}
+
+	tool := findToolByName(tools, "knows_explore_related")
+	if tool == nil {
+		t.Fatal("knows_explore_related tool not found")
+	}
+
+	result := tool.Execute(context.Background(), map[string]interface{}{
+		"evidence_id": "seed",
+		"max_depth":   2,
+		"max_breadth": 2,
+	})
+	if result.IsError {
+		t.Fatalf("tool execution failed: %s", result.ForLLM)
+	}
+
+	var out struct {
+		Related []map[string]interface{} `json:"related"`
+	}
+	if err := json.Unmarshal([]byte(result.ForLLM), &out); err != nil {
+		t.Fatalf("decode result failed: %v", err)
+	}
+
+	// Hop 1 searches "tag-seed" and "shared"; hop 2 only searches the
+	// unseen tag of each new item since "shared" was already used.
+	want := map[string]int{
+		"from-tag-seed":          1,
+		"from-shared":            1,
+		"from-tag-from-tag-seed": 2,
+		"from-tag-from-shared":   2,
+	}
+	if len(out.Related) != len(want) {
+		t.Fatalf("expected %d related items, got %d: %s", len(want), len(out.Related), result.ForLLM)
+	}
+	for _, item := range out.Related {
+		id, _ := item["evidence_id"].(string)
+		depth, ok := want[id]
+		if !ok {
+			t.Fatalf("unexpected related evidence %q", id)
+		}
+		if got := int(item["depth"].(float64)); got != depth {
+			t.Errorf("evidence %q depth = %d, want %d", id, got, depth)
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(queries) != 4 {
+		t.Errorf("expected 4 follow-up searches, got %v", queries)
+	}
+}
+
+func TestKnowsExploreRelated_RejectsOutOfRangeBudget(t *testing.T) {
+	tools, err := NewKnowsTools(KnowsToolOptions{
+		APIKey:     "test-key",
+		APIBaseURL: "http://127.0.0.1:0",
+	})
+	if err != nil {
+		t.Fatalf("NewKnowsTools() error = %v", err)
+	}
+
+	tool := findToolByName(tools, "knows_explore_related")
+	result := tool.Execute(context.Background(), map[string]interface{}{
+		"evidence_id": "seed",
+		"max_depth":   9,
+	})
+	if !result.IsError {
+		t.Fatal("expected error for max_depth out of range")
+	}
+}
+
+func TestExtractKnowsTerms(t *testing.T) {
+	raw := map[string]interface{}{
+		"summary":  "ignored",
+		"keywords": []interface{}{"KRAS", "kras", " "},
+		"elements": []interface{}{
+			map[string]interface{}{"name": "FOLFIRINOX", "score": 0.9},
+		},
+	}
+
+	// Keys are walked in order: elements before keywords
+	for i := 0; i < 20; i++ {
+		if terms := extractKnowsTerms(raw); !reflect.DeepEqual(terms, []string{"FOLFIRINOX", "KRAS"}) {
+			t.Fatalf("unexpected terms: %v", terms)
+		}
+	}
+}
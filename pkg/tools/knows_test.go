@@ -179,6 +179,60 @@ func TestKnowsBatchGetEvidenceDetails(t *testing.T) {
 	}
 }
 
+func TestKnowsGetGuide_RendersFiguresAndTables(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": map[string]interface{}{
+				"title": "NCCN Pancreatic",
+				"figures": []interface{}{
+					map[string]interface{}{"url": "https://example.com/f1.png", "caption": "Algorithm"},
+				},
+				"tables": []interface{}{
+					map[string]interface{}{
+						"title":   "Regimens",
+						"headers": []interface{}{"Regimen", "Line"},
+						"rows":    []interface{}{[]interface{}{"FOLFIRINOX", 1}},
+					},
+				},
+			},
+		})
+	}))
+	defer server.Close()
+
+	tools, err := NewKnowsTools(KnowsToolOptions{
+		APIKey:         "test-key",
+		APIBaseURL:     server.URL,
+		RequestTimeout: 10 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("NewKnowsTools() error = %v", err)
+	}
+
+	result := findToolByName(tools, "knows_get_guide").Execute(context.Background(), map[string]interface{}{
+		"evidence_id": "guide-1",
+	})
+	if result.IsError {
+		t.Fatalf("tool execution failed: %s", result.ForLLM)
+	}
+	if len(result.Content) != 3 {
+		t.Fatalf("expected 3 content blocks, got %d", len(result.Content))
+	}
+	for _, want := range []string{
+		`"title":"NCCN Pancreatic"`,
+		"![Algorithm](https://example.com/f1.png)",
+		"| FOLFIRINOX | 1 |",
+	} {
+		if !strings.Contains(result.ForLLM, want) {
+			t.Errorf("ForLLM missing %q:\n%s", want, result.ForLLM)
+		}
+	}
+	if strings.Index(result.ForLLM, "![Algorithm]") > strings.Index(result.ForLLM, "| FOLFIRINOX |") {
+		t.Errorf("table rendered before figure:\n%s", result.ForLLM)
+	}
+}
+
 func findToolByName(all []Tool, name string) Tool {
 	for _, tool := range all {
 		if tool.Name() == name {
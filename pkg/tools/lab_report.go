@@ -0,0 +1,342 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// labAnalyte describes a test the parser recognizes by name.
+type labAnalyte struct {
+	name    string   // canonical name
+	panel   string   // cbc, liver, kidney, tumor_marker or metabolic
+	aliases []string // lower-case names as they appear on reports
+	about   string   // what it measures, in plain language
+	high    string   // what a high value usually means
+	low     string   // what a low value usually means
+}
+
+var labAnalytes = []labAnalyte{
+	{"WBC", "cbc", []string{"wbc", "white blood cell", "白细胞"}, "white blood cells, which fight infection",
+		"can mean infection, inflammation or steroid treatment", "raises the risk of infection; common after chemotherapy"},
+	{"NEUT#", "cbc", []string{"neut#", "anc", "absolute neutrophil", "neutrophils", "中性粒细胞绝对值", "中性粒细胞数"}, "neutrophils, the white cells that fight bacterial infection",
+		"usually means infection or inflammation", "raises the risk of serious infection; a fever now needs urgent attention"},
+	{"LYMPH#", "cbc", []string{"lymph#", "lymphocytes", "淋巴细胞绝对值", "淋巴细胞数"}, "lymphocytes, white cells of the immune system",
+		"often follows a viral infection", "can follow chemotherapy, steroids or infection"},
+	{"RBC", "cbc", []string{"rbc", "red blood cell", "红细胞计数", "红细胞"}, "red blood cells, which carry oxygen",
+		"can mean dehydration", "is a sign of anaemia"},
+	{"HGB", "cbc", []string{"hgb", "hb", "haemoglobin", "hemoglobin", "血红蛋白"}, "haemoglobin, the oxygen-carrying protein in red cells",
+		"can mean dehydration", "is anaemia, which causes tiredness and breathlessness"},
+	{"PLT", "cbc", []string{"plt", "platelets", "platelet", "血小板计数", "血小板"}, "platelets, which help blood clot",
+		"can follow inflammation or bleeding", "raises the risk of bruising and bleeding; common after chemotherapy"},
+	{"ALT", "liver", []string{"alt", "sgpt", "alanine aminotransferase", "丙氨酸氨基转移酶", "谷丙转氨酶"}, "a liver enzyme",
+		"means liver cells are irritated, e.g. by medicines, chemotherapy, fatty liver or a blocked bile duct", ""},
+	{"AST", "liver", []string{"ast", "sgot", "aspartate aminotransferase", "天门冬氨酸氨基转移酶", "天冬氨酸氨基转移酶", "谷草转氨酶"}, "an enzyme from the liver and muscles",
+		"means liver or muscle cells are irritated", ""},
+	{"ALP", "liver", []string{"alp", "alkaline phosphatase", "碱性磷酸酶"}, "an enzyme from the bile ducts and bones",
+		"can mean a blocked bile duct or bone involvement", ""},
+	{"GGT", "liver", []string{"ggt", "γ-gt", "gamma-gt", "gamma-glutamyl transferase", "γ-谷氨酰转移酶", "谷氨酰转肽酶", "谷氨酰转移酶"}, "a bile duct enzyme",
+		"often means the bile flow is blocked or the liver is irritated, e.g. by alcohol or medicines", ""},
+	{"TBIL", "liver", []string{"tbil", "total bilirubin", "总胆红素"}, "bilirubin, a yellow pigment cleared by the liver",
+		"causes jaundice; with pancreatic cancer it can mean a blocked bile duct or stent", ""},
+	{"DBIL", "liver", []string{"dbil", "direct bilirubin", "直接胆红素", "结合胆红素"}, "bilirubin already processed by the liver",
+		"points to a blocked bile flow", ""},
+	{"ALB", "liver", []string{"alb", "albumin", "白蛋白"}, "albumin, the main blood protein",
+		"usually reflects dehydration", "often reflects poor nutrition or inflammation"},
+	{"CREA", "kidney", []string{"crea", "cr", "creatinine", "肌酐"}, "creatinine, a waste product cleared by the kidneys",
+		"means the kidneys are clearing less well; some medicine doses may need adjusting", "usually reflects low muscle mass"},
+	{"UREA", "kidney", []string{"bun", "urea", "尿素氮", "尿素"}, "urea, a waste product cleared by the kidneys",
+		"can mean dehydration or reduced kidney function", "can reflect a low protein diet"},
+	{"GLU", "metabolic", []string{"glu", "glucose", "blood glucose", "葡萄糖", "血糖"}, "blood sugar",
+		"can mean diabetes, which pancreatic disease and steroids can cause", "can cause shakiness and confusion"},
+	{"CA19-9", "tumor_marker", []string{"ca19-9", "ca 19-9", "ca199", "ca19_9", "糖类抗原19-9", "糖类抗原199"}, "a tumour marker used to follow pancreatic and bile duct cancers",
+		"can come from the cancer, but also from a blocked bile duct or inflammation; the trend over time matters more than one value", ""},
+	{"CEA", "tumor_marker", []string{"cea", "carcinoembryonic antigen", "癌胚抗原"}, "a tumour marker used to follow bowel, pancreatic and other cancers",
+		"can come from the cancer, smoking or inflammation; the trend matters more than one value", ""},
+	{"CA125", "tumor_marker", []string{"ca125", "ca 125", "ca-125", "糖类抗原125"}, "a tumour marker",
+		"can come from cancer but also from fluid in the abdomen or inflammation", ""},
+	{"CA72-4", "tumor_marker", []string{"ca72-4", "ca 72-4", "ca724", "糖类抗原72-4", "糖类抗原724"}, "a tumour marker used for stomach and pancreatic cancers",
+		"should be read together with other markers and scans", ""},
+	{"CA242", "tumor_marker", []string{"ca242", "ca 242", "糖类抗原242"}, "a tumour marker used for pancreatic and bowel cancers",
+		"should be read together with other markers and scans", ""},
+	{"AFP", "tumor_marker", []string{"afp", "alpha-fetoprotein", "甲胎蛋白"}, "a tumour marker used mainly for liver cancer",
+		"should be read together with scans", ""},
+}
+
+var (
+	labFullWidth = strings.NewReplacer("（", "(", "）", ")", "－", "-", "～", "~", "：", ":", "　", " ", "＜", "<", "＞", ">", "．", ".", "，", ",")
+	labLineIndex = regexp.MustCompile(`^\s*\d{1,3}[.、)]?\s+`)
+	labValue     = regexp.MustCompile(`^([<>≤≥]?)(\d+(?:\.\d+)?)([↑↓*]+|[HL])?$`)
+	labRange     = regexp.MustCompile(`(\d+(?:\.\d+)?)\s*(?:-|–|—|~|至)\s*(\d+(?:\.\d+)?)`)
+	labBound     = regexp.MustCompile(`([<>≤≥])\s*(\d+(?:\.\d+)?)`)
+	labFlags     = map[string]string{
+		"↑": "high", "h": "high", "hh": "high", "高": "high", "偏高": "high", "*": "",
+		"↓": "low", "l": "low", "ll": "low", "低": "low", "偏低": "low",
+	}
+	labUnit = regexp.MustCompile(`^(%|[a-zA-Zμµ×*^0-9/.]*[a-zA-Zμµ%][a-zA-Zμµ×*^0-9/.%]*)$`)
+)
+
+// LabResult is one analyte parsed from a lab report.
+type LabResult struct {
+	Analyte   string   `json:"analyte"`
+	Label     string   `json:"label"`
+	Panel     string   `json:"panel,omitempty"`
+	Value     float64  `json:"value"`
+	ValueText string   `json:"value_text"`
+	Unit      string   `json:"unit,omitempty"`
+	RefRange  string   `json:"reference_range,omitempty"`
+	Low       *float64 `json:"reference_low,omitempty"`
+	High      *float64 `json:"reference_high,omitempty"`
+	// Flag is high, low or normal, or empty when the report gives no range
+	// or flag.
+	Flag string `json:"flag,omitempty"`
+	// TimesUpperLimit is Value over High for high results, e.g. 3.2 for an
+	// ALT at 3.2× the upper limit.
+	TimesUpperLimit float64 `json:"times_upper_limit,omitempty"`
+
+	analyte *labAnalyte
+}
+
+// LabReportTool extracts structured results from pasted lab report text.
+type LabReportTool struct{}
+
+func NewLabReportTool() *LabReportTool {
+	return &LabReportTool{}
+}
+
+func (t *LabReportTool) Name() string {
+	return "lab_report_parse"
+}
+
+func (t *LabReportTool) Description() string {
+	return "Parse lab report text the user pasted or sent as a photo transcript (blood count, liver and kidney panels, tumour markers such as CA19-9 and CEA; Chinese or English). " +
+		"Returns each analyte with value, unit, reference range and a high/low flag, plus a plain-language summary of the out-of-range results. " +
+		"Pass the report text unchanged. Explain the results in the user's language, and do not diagnose."
+}
+
+func (t *LabReportTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"text": map[string]interface{}{
+				"type":        "string",
+				"description": "The lab report text, one result per line",
+			},
+		},
+		"required": []string{"text"},
+	}
+}
+
+type labReportArgs struct {
+	Text string `json:"text" arg:"required"`
+}
+
+func (t *LabReportTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	a, err := BindArgs[labReportArgs](args)
+	if err != nil {
+		return ErrorResult(err.Error()).WithError(err)
+	}
+	results := ParseLabReport(a.Text)
+	if len(results) == 0 {
+		return ErrorResult("no lab results found; expected lines like \"CA19-9  125.3  U/mL  0-37\"").
+			WithError(ClassifyError(ErrNotFound, fmt.Errorf("no lab results found")))
+	}
+	payload, _ := json.Marshal(map[string]interface{}{
+		"results": results,
+		"summary": labSummary(results),
+	})
+	return NewToolResult(string(payload))
+}
+
+// ParseLabReport extracts one result per line of text: a name, then a
+// value, then the unit, flag and reference range in any order. Lines naming
+// a known analyte need only a value; other lines also need a reference
+// range, so dates and prose are not mistaken for results.
+func ParseLabReport(text string) []LabResult {
+	var results []LabResult
+	for _, line := range strings.Split(labFullWidth.Replace(text), "\n") {
+		if r, ok := parseLabLine(line); ok {
+			results = append(results, r)
+		}
+	}
+	return results
+}
+
+func parseLabLine(line string) (LabResult, bool) {
+	line = strings.TrimSpace(labLineIndex.ReplaceAllString(line, ""))
+	if line == "" {
+		return LabResult{}, false
+	}
+
+	// The label runs up to the first value. Names with a space and a
+	// number in them, like "CA 125", are taken whole first.
+	labelEnd := 0
+	lower := strings.ToLower(line)
+	for i := range labAnalytes {
+		for _, alias := range labAnalytes[i].aliases {
+			if strings.Contains(alias, " ") && strings.HasPrefix(lower, alias) && len(alias) > labelEnd {
+				labelEnd = len(alias)
+			}
+		}
+	}
+	fields := strings.Fields(strings.ReplaceAll(line[labelEnd:], ":", " "))
+	valueAt := -1
+	var m []string
+	for i, f := range fields {
+		if m = labValue.FindStringSubmatch(f); m != nil {
+			valueAt = i
+			break
+		}
+	}
+	if valueAt < 0 {
+		return LabResult{}, false
+	}
+	label := strings.TrimSpace(line[:labelEnd] + " " + strings.Join(fields[:valueAt], " "))
+	if label == "" {
+		return LabResult{}, false
+	}
+	analyte := lookupAnalyte(label)
+
+	r := LabResult{Label: label, ValueText: m[1] + m[2], analyte: analyte}
+	r.Value, _ = strconv.ParseFloat(m[2], 64)
+	reportFlag := labFlags[strings.ToLower(m[3])]
+
+	rest := strings.Join(fields[valueAt+1:], " ")
+	if rm := labRange.FindStringSubmatchIndex(rest); rm != nil {
+		low, _ := strconv.ParseFloat(rest[rm[2]:rm[3]], 64)
+		high, _ := strconv.ParseFloat(rest[rm[4]:rm[5]], 64)
+		r.Low, r.High = &low, &high
+		r.RefRange = rest[rm[0]:rm[1]]
+		rest = rest[:rm[0]] + " " + rest[rm[1]:]
+	} else if bm := labBound.FindStringSubmatchIndex(rest); bm != nil {
+		bound, _ := strconv.ParseFloat(rest[bm[4]:bm[5]], 64)
+		if op := rest[bm[2]:bm[3]]; op == "<" || op == "≤" {
+			r.High = &bound
+		} else {
+			r.Low = &bound
+		}
+		r.RefRange = rest[bm[0]:bm[1]]
+		rest = rest[:bm[0]] + " " + rest[bm[1]:]
+	}
+	if analyte == nil && r.RefRange == "" {
+		return LabResult{}, false
+	}
+
+	for _, f := range strings.Fields(strings.NewReplacer("(", " ", ")", " ", "[", " ", "]", " ").Replace(rest)) {
+		if flag, ok := labFlags[strings.ToLower(f)]; ok {
+			if flag != "" {
+				reportFlag = flag
+			}
+		} else if r.Unit == "" && labUnit.MatchString(f) {
+			r.Unit = f
+		}
+	}
+
+	if analyte != nil {
+		r.Analyte, r.Panel = analyte.name, analyte.panel
+	} else {
+		r.Analyte = label
+	}
+	r.Flag = reportFlag
+	switch {
+	case r.High != nil && r.Value > *r.High:
+		r.Flag = "high"
+	case r.Low != nil && r.Value < *r.Low:
+		r.Flag = "low"
+	case r.Low != nil || r.High != nil:
+		r.Flag = "normal"
+	}
+	if r.Flag == "high" && r.High != nil && *r.High > 0 {
+		r.TimesUpperLimit = math.Round(r.Value / *r.High * 10) / 10
+	}
+	return r, true
+}
+
+var (
+	labParenthetical = regexp.MustCompile(`\(([^()]*)\)`)
+	labNameSuffix    = regexp.MustCompile(`(计数|测定|定量|含量|浓度)$`)
+)
+
+// lookupAnalyte finds the analyte a label names. The label, the label
+// without its parenthetical and the parenthetical itself are each compared
+// with the known names, so "白细胞计数(WBC)" and "ALT(谷丙转氨酶)" are
+// recognized but "平均红细胞血红蛋白含量(MCH)" is not taken for haemoglobin.
+func lookupAnalyte(label string) *labAnalyte {
+	label = strings.ToLower(strings.Trim(label, " *"))
+	candidates := []string{label, strings.TrimSpace(labParenthetical.ReplaceAllString(label, ""))}
+	for _, m := range labParenthetical.FindAllStringSubmatch(label, -1) {
+		candidates = append(candidates, strings.TrimSpace(m[1]))
+	}
+	for _, c := range candidates {
+		if trimmed := labNameSuffix.ReplaceAllString(c, ""); trimmed != c {
+			candidates = append(candidates, trimmed)
+		}
+	}
+	for _, c := range candidates {
+		for i := range labAnalytes {
+			for _, alias := range labAnalytes[i].aliases {
+				if c == alias {
+					return &labAnalytes[i]
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// labSummary describes the out-of-range results in plain language.
+func labSummary(results []LabResult) string {
+	var sb strings.Builder
+	var normal, unflagged []string
+	abnormal := 0
+	for _, r := range results {
+		switch r.Flag {
+		case "normal":
+			normal = append(normal, r.Analyte)
+			continue
+		case "":
+			unflagged = append(unflagged, r.Analyte)
+			continue
+		}
+		abnormal++
+		fmt.Fprintf(&sb, "- %s %s", r.Analyte, r.ValueText)
+		if r.Unit != "" {
+			sb.WriteString(" " + r.Unit)
+		}
+		fmt.Fprintf(&sb, " is %s", r.Flag)
+		if r.RefRange != "" {
+			fmt.Fprintf(&sb, " (reference %s", r.RefRange)
+			if r.TimesUpperLimit >= 1.5 {
+				fmt.Fprintf(&sb, ", %.1f× the upper limit", r.TimesUpperLimit)
+			}
+			sb.WriteString(")")
+		}
+		if a := r.analyte; a != nil {
+			meaning := a.high
+			if r.Flag == "low" {
+				meaning = a.low
+			}
+			fmt.Fprintf(&sb, ". It measures %s", a.about)
+			if meaning != "" {
+				fmt.Fprintf(&sb, "; a %s value %s", r.Flag, meaning)
+			}
+		}
+		sb.WriteString(".\n")
+	}
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "%d results found, %d outside the reference range.\n", len(results), abnormal)
+	out.WriteString(sb.String())
+	if len(normal) > 0 {
+		fmt.Fprintf(&out, "Within range: %s.\n", strings.Join(normal, ", "))
+	}
+	if len(unflagged) > 0 {
+		fmt.Fprintf(&out, "No reference range given for: %s. Use the range printed by the lab before judging these.\n", strings.Join(unflagged, ", "))
+	}
+	out.WriteString("Single results should be read together with earlier results and the treating team's advice.")
+	return out.String()
+}
@@ -0,0 +1,90 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParseLabReport(t *testing.T) {
+	report := `检验报告单  采样时间：2026-03-01 08:00
+序号 项目名称 结果 提示 单位 参考范围
+1 白细胞计数(WBC) 2.8 ↓ 10^9/L 3.5-9.5
+2 平均红细胞血红蛋白含量(MCH) 30.1 pg 27-34
+3 血小板计数(PLT)   96 L  10^9/L   125～350
+4 丙氨酸氨基转移酶(ALT)　128.0 U/L 7-40 ↑
+5 糖类抗原19-9(CA19-9) 1250.6↑ U/mL 0-37
+CEA: 3.1 ng/mL (<5.0)
+CA 125 12 U/mL 0-35
+AFP 2.1
+Hemoglobin <50 g/L 115-150
+Ferritin 250 ng/mL
+Patient age 63`
+
+	results := ParseLabReport(report)
+	type want struct {
+		analyte, value, unit, refRange, flag string
+		times                                float64
+	}
+	wants := []want{
+		{"WBC", "2.8", "10^9/L", "3.5-9.5", "low", 0},
+		{"平均红细胞血红蛋白含量(MCH)", "30.1", "pg", "27-34", "normal", 0},
+		{"PLT", "96", "10^9/L", "125~350", "low", 0},
+		{"ALT", "128.0", "U/L", "7-40", "high", 3.2},
+		{"CA19-9", "1250.6", "U/mL", "0-37", "high", 33.8},
+		{"CEA", "3.1", "ng/mL", "<5.0", "normal", 0},
+		{"CA125", "12", "U/mL", "0-35", "normal", 0},
+		{"AFP", "2.1", "", "", "", 0},
+		{"HGB", "<50", "g/L", "115-150", "low", 0},
+	}
+	if len(results) != len(wants) {
+		for _, r := range results {
+			t.Logf("%+v", r)
+		}
+		t.Fatalf("got %d results, want %d", len(results), len(wants))
+	}
+	for i, w := range wants {
+		r := results[i]
+		if r.Analyte != w.analyte || r.ValueText != w.value || r.Unit != w.unit || r.RefRange != w.refRange ||
+			r.Flag != w.flag || r.TimesUpperLimit != w.times {
+			t.Errorf("result %d = %+v, want %+v", i, r, w)
+		}
+	}
+	if results[1].analyte != nil {
+		t.Errorf("MCH was taken for %s", results[1].analyte.name)
+	}
+}
+
+func TestLabReportTool_Execute(t *testing.T) {
+	tool := NewLabReportTool()
+	result := tool.Execute(context.Background(), map[string]interface{}{
+		"text": "CA19-9 125 U/mL 0-37\nALT 20 U/L 7-40\nCEA 4.2",
+	})
+	if result.IsError {
+		t.Fatalf("Execute: %s", result.ForLLM)
+	}
+	var out struct {
+		Results []LabResult `json:"results"`
+		Summary string      `json:"summary"`
+	}
+	if err := json.Unmarshal([]byte(result.ForLLM), &out); err != nil {
+		t.Fatalf("bad JSON: %v", err)
+	}
+	for _, s := range []string{
+		"3 results found, 1 outside the reference range.",
+		"- CA19-9 125 U/mL is high (reference 0-37, 3.4× the upper limit). It measures a tumour marker",
+		"Within range: ALT.",
+		"No reference range given for: CEA.",
+	} {
+		if !strings.Contains(out.Summary, s) {
+			t.Errorf("summary missing %q:\n%s", s, out.Summary)
+		}
+	}
+
+	result = tool.Execute(context.Background(), map[string]interface{}{"text": "feeling tired today"})
+	if !result.IsError || !errors.Is(result.Err, ErrNotFound) {
+		t.Errorf("prose: %+v", result)
+	}
+}
@@ -0,0 +1,141 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"path"
+	"sort"
+	"time"
+)
+
+// ErrQueueTimeout is returned by ConcurrencyLimiter.Acquire when no slot
+// frees up within the queue timeout.
+var ErrQueueTimeout = errors.New("timed out waiting for a free tool slot")
+
+type LimiterOptions struct {
+	// MaxConcurrent caps tool calls running at once; 0 means unlimited.
+	MaxConcurrent int
+	// PerTool caps calls per tool name or glob pattern such as "knows_*".
+	// All tools matching one pattern share its limit.
+	PerTool map[string]int
+	// QueueTimeout bounds how long a call waits for a slot; 0 waits until
+	// the call's context is done.
+	QueueTimeout time.Duration
+}
+
+type toolSlots struct {
+	pattern string
+	sem     chan struct{}
+}
+
+// ConcurrencyLimiter caps concurrent tool executions globally and per tool,
+// so a burst of calls from one session cannot starve the others. Waiting
+// calls are served in the order the runtime wakes them, which is roughly
+// first come, first served.
+type ConcurrencyLimiter struct {
+	global  chan struct{}
+	exact   map[string]*toolSlots
+	globs   []*toolSlots
+	timeout time.Duration
+}
+
+func NewConcurrencyLimiter(opts LimiterOptions) *ConcurrencyLimiter {
+	l := &ConcurrencyLimiter{
+		exact:   make(map[string]*toolSlots),
+		timeout: opts.QueueTimeout,
+	}
+	if opts.MaxConcurrent > 0 {
+		l.global = make(chan struct{}, opts.MaxConcurrent)
+	}
+
+	patterns := make([]string, 0, len(opts.PerTool))
+	for pattern := range opts.PerTool {
+		patterns = append(patterns, pattern)
+	}
+	sort.Strings(patterns)
+	for _, pattern := range patterns {
+		limit := opts.PerTool[pattern]
+		if limit <= 0 {
+			continue
+		}
+		slots := &toolSlots{pattern: pattern, sem: make(chan struct{}, limit)}
+		if isGlob(pattern) {
+			l.globs = append(l.globs, slots)
+		} else {
+			l.exact[pattern] = slots
+		}
+	}
+	return l
+}
+
+func isGlob(pattern string) bool {
+	for _, c := range pattern {
+		switch c {
+		case '*', '?', '[', '\\':
+			return true
+		}
+	}
+	return false
+}
+
+// slotsFor returns the per-tool limit that applies to name. An exact name
+// wins over patterns; among patterns the first in sorted order wins.
+func (l *ConcurrencyLimiter) slotsFor(name string) *toolSlots {
+	if slots, ok := l.exact[name]; ok {
+		return slots
+	}
+	for _, slots := range l.globs {
+		if ok, _ := path.Match(slots.pattern, name); ok {
+			return slots
+		}
+	}
+	return nil
+}
+
+// Acquire waits for a slot to run tool name and returns a function that
+// releases it. The per-tool slot is taken before the global one, so calls
+// queued behind a busy tool do not hold global slots other tools could use.
+func (l *ConcurrencyLimiter) Acquire(ctx context.Context, name string) (func(), error) {
+	if l.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, l.timeout)
+		defer cancel()
+	}
+
+	var held []chan struct{}
+	release := func() {
+		for i := len(held) - 1; i >= 0; i-- {
+			<-held[i]
+		}
+	}
+
+	for _, sem := range []chan struct{}{l.toolSem(name), l.global} {
+		if sem == nil {
+			continue
+		}
+		select {
+		case sem <- struct{}{}:
+			held = append(held, sem)
+		case <-ctx.Done():
+			release()
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return nil, ErrQueueTimeout
+			}
+			return nil, ctx.Err()
+		}
+	}
+	return release, nil
+}
+
+func (l *ConcurrencyLimiter) toolSem(name string) chan struct{} {
+	if slots := l.slotsFor(name); slots != nil {
+		return slots.sem
+	}
+	return nil
+}
+
+// InFlight returns the number of tool calls currently holding a global slot.
+// It is always 0 when there is no global limit.
+func (l *ConcurrencyLimiter) InFlight() int {
+	return len(l.global)
+}
@@ -0,0 +1,148 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// blockingTool tracks how many of its calls run at once and holds each
+// call until release is closed.
+type blockingTool struct {
+	name    string
+	release chan struct{}
+	running *int32
+	peak    *int32
+}
+
+func (t *blockingTool) Name() string        { return t.name }
+func (t *blockingTool) Description() string { return "blocks until released" }
+func (t *blockingTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{"type": "object"}
+}
+
+func (t *blockingTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	n := atomic.AddInt32(t.running, 1)
+	for {
+		peak := atomic.LoadInt32(t.peak)
+		if n <= peak || atomic.CompareAndSwapInt32(t.peak, peak, n) {
+			break
+		}
+	}
+	<-t.release
+	atomic.AddInt32(t.running, -1)
+	return NewToolResult("done")
+}
+
+func TestConcurrencyLimiter_CapsPerPatternAcrossTools(t *testing.T) {
+	var running, peak int32
+	release := make(chan struct{})
+	r := NewToolRegistry()
+	for _, name := range []string{"knows_answer", "knows_ai_search"} {
+		r.Register(&blockingTool{name: name, release: release, running: &running, peak: &peak})
+	}
+	r.SetConcurrencyLimiter(NewConcurrencyLimiter(LimiterOptions{
+		MaxConcurrent: 10,
+		PerTool:       map[string]int{"knows_*": 2},
+	}))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		name := "knows_answer"
+		if i%2 == 0 {
+			name = "knows_ai_search"
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if result := r.Execute(context.Background(), name, nil); result.IsError {
+				t.Errorf("unexpected error: %s", result.ForLLM)
+			}
+		}()
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if peak != 2 {
+		t.Errorf("expected at most 2 concurrent knows calls, peak was %d", peak)
+	}
+}
+
+func TestConcurrencyLimiter_QueueTimeout(t *testing.T) {
+	l := NewConcurrencyLimiter(LimiterOptions{MaxConcurrent: 1, QueueTimeout: 20 * time.Millisecond})
+
+	release, err := l.Acquire(context.Background(), "exec")
+	if err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+	if l.InFlight() != 1 {
+		t.Errorf("InFlight() = %d, want 1", l.InFlight())
+	}
+
+	if _, err := l.Acquire(context.Background(), "read_file"); !errors.Is(err, ErrQueueTimeout) {
+		t.Fatalf("expected ErrQueueTimeout, got %v", err)
+	}
+
+	release()
+	release2, err := l.Acquire(context.Background(), "read_file")
+	if err != nil {
+		t.Fatalf("expected slot after release, got %v", err)
+	}
+	release2()
+	if l.InFlight() != 0 {
+		t.Errorf("InFlight() = %d after release, want 0", l.InFlight())
+	}
+}
+
+func TestConcurrencyLimiter_BusyToolDoesNotHoldGlobalSlots(t *testing.T) {
+	l := NewConcurrencyLimiter(LimiterOptions{
+		MaxConcurrent: 2,
+		PerTool:       map[string]int{"knows_*": 1, "knows_answer": 1},
+	})
+
+	hold, err := l.Acquire(context.Background(), "knows_answer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer hold()
+
+	// A second knows_answer queues on its own limit without taking the
+	// remaining global slot, and the exact name wins over the pattern so
+	// knows_ai_search is limited separately.
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := l.Acquire(ctx, "knows_answer"); err == nil {
+		t.Fatal("expected knows_answer to wait for its own slot")
+	}
+	other, err := l.Acquire(context.Background(), "knows_ai_search")
+	if err != nil {
+		t.Fatalf("expected a free global slot for another tool, got %v", err)
+	}
+	other()
+}
+
+func TestRegistry_LimiterTimeoutIsToolError(t *testing.T) {
+	var running, peak int32
+	release := make(chan struct{})
+	defer close(release)
+	r := NewToolRegistry()
+	r.Register(&blockingTool{name: "exec", release: release, running: &running, peak: &peak})
+	r.SetConcurrencyLimiter(NewConcurrencyLimiter(LimiterOptions{
+		PerTool:      map[string]int{"exec": 1},
+		QueueTimeout: 20 * time.Millisecond,
+	}))
+
+	go r.Execute(context.Background(), "exec", nil)
+	time.Sleep(10 * time.Millisecond)
+
+	result := r.Execute(context.Background(), "exec", nil)
+	if !result.IsError || !strings.Contains(result.ForLLM, "too many tool calls") {
+		t.Fatalf("expected queue timeout error, got %+v", result)
+	}
+}
@@ -0,0 +1,332 @@
+// Package mcp connects to Model Context Protocol servers and exposes their
+// tools as picoclaw tools.
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// ProtocolVersion is the MCP revision this client speaks.
+const ProtocolVersion = "2024-11-05"
+
+const defaultTimeout = 60 * time.Second
+
+// ServerConfig describes one MCP server. Exactly one of Command (stdio) or
+// URL (HTTP+SSE) is set.
+type ServerConfig struct {
+	Name    string
+	Command string
+	Args    []string
+	Env     map[string]string
+	URL     string
+	Headers map[string]string
+	// Timeout bounds connecting and each call; defaults to 60 seconds.
+	Timeout time.Duration
+}
+
+// transport moves JSON-RPC messages to and from a server.
+type transport interface {
+	// send writes one message.
+	send(ctx context.Context, msg []byte) error
+	// messages yields incoming messages and is closed when the
+	// connection ends.
+	messages() <-chan []byte
+	close() error
+}
+
+type rpcError struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+func (e *rpcError) Error() string {
+	return fmt.Sprintf("mcp error %d: %s", e.Code, e.Message)
+}
+
+type rpcMessage struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+// ToolInfo is a tool as listed by a server.
+type ToolInfo struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description,omitempty"`
+	InputSchema map[string]interface{} `json:"inputSchema,omitempty"`
+}
+
+// Content is one item of a tool call result.
+type Content struct {
+	Type     string    `json:"type"`
+	Text     string    `json:"text,omitempty"`
+	Data     string    `json:"data,omitempty"`
+	MimeType string    `json:"mimeType,omitempty"`
+	Resource *Resource `json:"resource,omitempty"`
+}
+
+// Resource is an embedded resource in a tool call result.
+type Resource struct {
+	URI      string `json:"uri"`
+	MimeType string `json:"mimeType,omitempty"`
+	Text     string `json:"text,omitempty"`
+	Blob     string `json:"blob,omitempty"`
+}
+
+// CallResult is the result of tools/call.
+type CallResult struct {
+	Content []Content `json:"content"`
+	IsError bool      `json:"isError,omitempty"`
+}
+
+// Client is a connection to one MCP server.
+type Client struct {
+	name      string
+	timeout   time.Duration
+	transport transport
+	nextID    atomic.Int64
+	mu        sync.Mutex
+	pending   map[string]chan *rpcMessage
+	done      chan struct{}
+}
+
+// Connect starts or dials the server and performs the initialize handshake.
+func Connect(ctx context.Context, cfg ServerConfig) (*Client, error) {
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+
+	var (
+		t   transport
+		err error
+	)
+	switch {
+	case cfg.Command != "" && cfg.URL != "":
+		return nil, fmt.Errorf("mcp server %q: set either command or url, not both", cfg.Name)
+	case cfg.Command != "":
+		t, err = newStdioTransport(cfg)
+	case cfg.URL != "":
+		t, err = newSSETransport(ctx, cfg, timeout)
+	default:
+		return nil, fmt.Errorf("mcp server %q: command or url is required", cfg.Name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("mcp server %q: %w", cfg.Name, err)
+	}
+
+	c := newClient(cfg.Name, t, timeout)
+	if err := c.initialize(ctx); err != nil {
+		c.Close()
+		return nil, fmt.Errorf("mcp server %q: initialize: %w", cfg.Name, err)
+	}
+	return c, nil
+}
+
+func newClient(name string, t transport, timeout time.Duration) *Client {
+	c := &Client{
+		name:      name,
+		timeout:   timeout,
+		transport: t,
+		pending:   make(map[string]chan *rpcMessage),
+		done:      make(chan struct{}),
+	}
+	go c.readLoop()
+	return c
+}
+
+// Name returns the configured server name.
+func (c *Client) Name() string {
+	return c.name
+}
+
+func (c *Client) initialize(ctx context.Context) error {
+	params := map[string]interface{}{
+		"protocolVersion": ProtocolVersion,
+		"capabilities":    map[string]interface{}{},
+		"clientInfo": map[string]interface{}{
+			"name":    "picoclaw",
+			"version": "1",
+		},
+	}
+	var result struct {
+		ProtocolVersion string `json:"protocolVersion"`
+		ServerInfo      struct {
+			Name    string `json:"name"`
+			Version string `json:"version"`
+		} `json:"serverInfo"`
+	}
+	if err := c.call(ctx, "initialize", params, &result); err != nil {
+		return err
+	}
+	logger.InfoCF("mcp", "Connected to MCP server",
+		map[string]interface{}{
+			"server":   c.name,
+			"remote":   result.ServerInfo.Name,
+			"version":  result.ServerInfo.Version,
+			"protocol": result.ProtocolVersion,
+		})
+	return c.notify(ctx, "notifications/initialized", nil)
+}
+
+// ListTools returns every tool the server offers, following pagination.
+func (c *Client) ListTools(ctx context.Context) ([]ToolInfo, error) {
+	var all []ToolInfo
+	cursor := ""
+	for {
+		params := map[string]interface{}{}
+		if cursor != "" {
+			params["cursor"] = cursor
+		}
+		var page struct {
+			Tools      []ToolInfo `json:"tools"`
+			NextCursor string     `json:"nextCursor"`
+		}
+		if err := c.call(ctx, "tools/list", params, &page); err != nil {
+			return nil, err
+		}
+		all = append(all, page.Tools...)
+		if page.NextCursor == "" || page.NextCursor == cursor {
+			return all, nil
+		}
+		cursor = page.NextCursor
+	}
+}
+
+// CallTool invokes a tool on the server.
+func (c *Client) CallTool(ctx context.Context, name string, args map[string]interface{}) (*CallResult, error) {
+	if args == nil {
+		args = map[string]interface{}{}
+	}
+	var result CallResult
+	if err := c.call(ctx, "tools/call", map[string]interface{}{
+		"name":      name,
+		"arguments": args,
+	}, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Close ends the connection and stops the server process, if any.
+func (c *Client) Close() error {
+	return c.transport.close()
+}
+
+func (c *Client) call(ctx context.Context, method string, params interface{}, result interface{}) error {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	id := strconv.FormatInt(c.nextID.Add(1), 10)
+	reply := make(chan *rpcMessage, 1)
+	c.mu.Lock()
+	c.pending[id] = reply
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+	}()
+
+	msg, err := encode(json.RawMessage(id), method, params)
+	if err != nil {
+		return err
+	}
+	if err := c.transport.send(ctx, msg); err != nil {
+		return err
+	}
+
+	select {
+	case resp := <-reply:
+		if resp.Error != nil {
+			return resp.Error
+		}
+		if result == nil || len(resp.Result) == 0 {
+			return nil
+		}
+		return json.Unmarshal(resp.Result, result)
+	case <-c.done:
+		return fmt.Errorf("connection to %s closed", c.name)
+	case <-ctx.Done():
+		return fmt.Errorf("%s: %w", method, ctx.Err())
+	}
+}
+
+func (c *Client) notify(ctx context.Context, method string, params interface{}) error {
+	msg, err := encode(nil, method, params)
+	if err != nil {
+		return err
+	}
+	return c.transport.send(ctx, msg)
+}
+
+func encode(id json.RawMessage, method string, params interface{}) ([]byte, error) {
+	msg := rpcMessage{JSONRPC: "2.0", ID: id, Method: method}
+	if params != nil {
+		raw, err := json.Marshal(params)
+		if err != nil {
+			return nil, err
+		}
+		msg.Params = raw
+	}
+	return json.Marshal(msg)
+}
+
+// readLoop routes responses to waiting calls and answers the few requests
+// servers send to clients.
+func (c *Client) readLoop() {
+	defer close(c.done)
+	for data := range c.transport.messages() {
+		var msg rpcMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			logger.DebugCF("mcp", "Ignoring malformed message",
+				map[string]interface{}{
+					"server": c.name,
+					"error":  err.Error(),
+				})
+			continue
+		}
+
+		switch {
+		case msg.Method != "" && len(msg.ID) > 0:
+			c.answer(msg)
+		case msg.Method != "":
+			// Notifications (progress, logging, list changes) are ignored.
+		default:
+			c.mu.Lock()
+			reply, ok := c.pending[string(msg.ID)]
+			c.mu.Unlock()
+			if ok {
+				reply <- &msg
+			}
+		}
+	}
+}
+
+func (c *Client) answer(req rpcMessage) {
+	resp := rpcMessage{JSONRPC: "2.0", ID: req.ID}
+	if req.Method == "ping" {
+		resp.Result = json.RawMessage("{}")
+	} else {
+		resp.Error = &rpcError{Code: -32601, Message: "method not found: " + req.Method}
+	}
+	data, err := json.Marshal(resp)
+	if err != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+	_ = c.transport.send(ctx, data)
+}
@@ -0,0 +1,247 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+// TestMain lets the test binary act as a stdio MCP server when re-executed
+// with MCP_TEST_SERVER=1, or as picoclaw's own server with
+// MCP_TEST_PICOCLAW_SERVER=1.
+func TestMain(m *testing.M) {
+	if os.Getenv("MCP_TEST_PICOCLAW_SERVER") == "1" {
+		testServer().ServeStdio(context.Background(), os.Stdin, os.Stdout)
+		os.Exit(0)
+	}
+	if os.Getenv("MCP_TEST_SERVER") == "1" {
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			if reply := fakeServerReply(scanner.Bytes()); reply != nil {
+				os.Stdout.Write(append(reply, '\n'))
+			}
+		}
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// fakeServerReply answers one request with two pages of tools: "echo",
+// which returns its text argument, and "fail", which reports a tool error.
+func fakeServerReply(data []byte) []byte {
+	var req rpcMessage
+	if err := json.Unmarshal(data, &req); err != nil || len(req.ID) == 0 {
+		return nil
+	}
+
+	var result interface{}
+	switch req.Method {
+	case "initialize":
+		result = map[string]interface{}{
+			"protocolVersion": ProtocolVersion,
+			"capabilities":    map[string]interface{}{"tools": map[string]interface{}{}},
+			"serverInfo":      map[string]interface{}{"name": "fake", "version": "0.1"},
+		}
+	case "tools/list":
+		var params struct {
+			Cursor string `json:"cursor"`
+		}
+		json.Unmarshal(req.Params, &params)
+		if params.Cursor == "" {
+			result = map[string]interface{}{
+				"tools": []map[string]interface{}{{
+					"name":        "echo",
+					"description": "Echo text back",
+					"inputSchema": map[string]interface{}{
+						"type":       "object",
+						"properties": map[string]interface{}{"text": map[string]interface{}{"type": "string"}},
+					},
+				}},
+				"nextCursor": "page2",
+			}
+		} else {
+			result = map[string]interface{}{
+				"tools": []map[string]interface{}{{"name": "fail"}},
+			}
+		}
+	case "tools/call":
+		var params struct {
+			Name      string                 `json:"name"`
+			Arguments map[string]interface{} `json:"arguments"`
+		}
+		json.Unmarshal(req.Params, &params)
+		if params.Name == "fail" {
+			result = map[string]interface{}{
+				"content": []map[string]interface{}{{"type": "text", "text": "record not found"}},
+				"isError": true,
+			}
+		} else {
+			result = map[string]interface{}{
+				"content": []map[string]interface{}{{"type": "text", "text": fmt.Sprint(params.Arguments["text"])}},
+			}
+		}
+	default:
+		reply, _ := json.Marshal(rpcMessage{JSONRPC: "2.0", ID: req.ID, Error: &rpcError{Code: -32601, Message: "method not found"}})
+		return reply
+	}
+
+	raw, _ := json.Marshal(result)
+	reply, _ := json.Marshal(rpcMessage{JSONRPC: "2.0", ID: req.ID, Result: raw})
+	return reply
+}
+
+func checkFakeServerTools(t *testing.T, loaded []tools.Tool) {
+	t.Helper()
+	if len(loaded) != 2 {
+		t.Fatalf("expected 2 tools across both pages, got %d", len(loaded))
+	}
+
+	registry := tools.NewToolRegistry()
+	for _, tool := range loaded {
+		registry.Register(tool)
+	}
+
+	echo, ok := registry.Get("fake_echo")
+	if !ok {
+		t.Fatalf("expected fake_echo, got %v", registry.List())
+	}
+	if !strings.Contains(echo.Description(), "Echo text back") {
+		t.Errorf("unexpected description %q", echo.Description())
+	}
+	if props, _ := echo.Parameters()["properties"].(map[string]interface{}); props["text"] == nil {
+		t.Errorf("input schema not carried over: %v", echo.Parameters())
+	}
+
+	ctx := context.Background()
+	if result := registry.Execute(ctx, "fake_echo", map[string]interface{}{"text": "hello"}); result.IsError || result.ForLLM != "hello" {
+		t.Errorf("fake_echo = %+v", result)
+	}
+	if result := registry.Execute(ctx, "fake_fail", nil); !result.IsError || !strings.Contains(result.ForLLM, "record not found") {
+		t.Errorf("fake_fail = %+v", result)
+	}
+	if params := registry.ToProviderDefs(); len(params) != 2 {
+		t.Errorf("expected provider definitions for both tools, got %d", len(params))
+	}
+}
+
+func TestManager_Stdio(t *testing.T) {
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := NewManager()
+	defer m.Close()
+
+	loaded := m.Connect(context.Background(), []ServerConfig{{
+		Name:    "fake",
+		Command: exe,
+		Args:    []string{"-test.run=^$"},
+		Env:     map[string]string{"MCP_TEST_SERVER": "1"},
+		Timeout: 5 * time.Second,
+	}})
+	checkFakeServerTools(t, loaded)
+}
+
+// sseServer serves the HTTP+SSE transport backed by fakeServerReply.
+func sseServer(t *testing.T) *httptest.Server {
+	var (
+		mu      sync.Mutex
+		streams = map[string]chan []byte{}
+	)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/sse", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		out := make(chan []byte, 8)
+		mu.Lock()
+		streams["s1"] = out
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, ": keep-alive\n\nevent: endpoint\ndata: /messages?session=s1\n\n")
+		w.(http.Flusher).Flush()
+		for {
+			select {
+			case msg := <-out:
+				fmt.Fprintf(w, "event: message\ndata: %s\n\n", msg)
+				w.(http.Flusher).Flush()
+			case <-r.Context().Done():
+				return
+			}
+		}
+	})
+	mux.HandleFunc("/messages", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		out := streams[r.URL.Query().Get("session")]
+		mu.Unlock()
+		if out == nil {
+			http.Error(w, "unknown session", http.StatusNotFound)
+			return
+		}
+		if reply := fakeServerReply(body); reply != nil {
+			out <- reply
+		}
+		w.WriteHeader(http.StatusAccepted)
+	})
+	return httptest.NewServer(mux)
+}
+
+func TestManager_SSE(t *testing.T) {
+	srv := sseServer(t)
+	defer srv.Close()
+
+	m := NewManager()
+	defer m.Close()
+	loaded := m.Connect(context.Background(), []ServerConfig{{
+		Name:    "fake",
+		URL:     srv.URL + "/sse",
+		Headers: map[string]string{"Authorization": "Bearer secret"},
+		Timeout: 5 * time.Second,
+	}})
+	checkFakeServerTools(t, loaded)
+}
+
+func TestManager_SkipsBrokenServers(t *testing.T) {
+	srv := sseServer(t)
+	defer srv.Close()
+
+	m := NewManager()
+	defer m.Close()
+	loaded := m.Connect(context.Background(), []ServerConfig{
+		{Name: "missing", Command: "/nonexistent/mcp-server"},
+		{Name: "unauthorized", URL: srv.URL + "/sse", Timeout: time.Second},
+		{Name: "both", Command: "x", URL: "http://localhost"},
+	})
+	if len(loaded) != 0 {
+		t.Errorf("expected no tools from broken servers, got %d", len(loaded))
+	}
+}
+
+func TestToolName(t *testing.T) {
+	tests := []struct {
+		server, tool, want string
+	}{
+		{"fs", "read_file", "fs_read_file"},
+		{"ehr.prod", "get patient", "ehr_prod_get_patient"},
+		{"s", strings.Repeat("x", 80), "s_" + strings.Repeat("x", 62)},
+	}
+	for _, tt := range tests {
+		if got := ToolName(tt.server, tt.tool); got != tt.want {
+			t.Errorf("ToolName(%q, %q) = %q, want %q", tt.server, tt.tool, got, tt.want)
+		}
+	}
+}
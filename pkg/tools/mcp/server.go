@@ -0,0 +1,337 @@
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+// ServerChannel is the channel name tool calls from MCP hosts run under.
+const ServerChannel = "mcp"
+
+// JSON-RPC error codes used by the server.
+const (
+	codeParseError     = -32700
+	codeMethodNotFound = -32601
+	codeInvalidParams  = -32602
+)
+
+// Server offers the tools of a picoclaw registry to MCP hosts over stdio or
+// HTTP+SSE. Only tools the policy allows are listed and callable; tools
+// that need approval are never offered, since an MCP host cannot answer
+// the approval prompt.
+type Server struct {
+	registry *tools.ToolRegistry
+	policy   tools.ToolRolePolicy
+	version  string
+
+	mu       sync.Mutex
+	sessions map[string]*sseSession
+}
+
+// sseSession is one open event stream.
+type sseSession struct {
+	outgoing chan []byte
+	done     chan struct{}
+}
+
+// NewServer creates a server for registry. version is reported to hosts in
+// the initialize handshake.
+func NewServer(registry *tools.ToolRegistry, policy tools.ToolRolePolicy, version string) *Server {
+	return &Server{
+		registry: registry,
+		policy:   policy,
+		version:  version,
+		sessions: make(map[string]*sseSession),
+	}
+}
+
+// Tools returns the tools offered to hosts.
+func (s *Server) Tools() []ToolInfo {
+	infos := []ToolInfo{}
+	for _, entry := range s.registry.Catalog("", nil) {
+		if entry.RequiresApproval || !s.policy.Allows(entry.Name) {
+			continue
+		}
+		infos = append(infos, ToolInfo{
+			Name:        entry.Name,
+			Description: entry.Description,
+			InputSchema: entry.Parameters,
+		})
+	}
+	return infos
+}
+
+func (s *Server) offers(name string) bool {
+	for _, info := range s.Tools() {
+		if info.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// ServeStdio reads newline-delimited requests from in and writes responses
+// to out until in ends or ctx is cancelled. Requests are handled
+// concurrently so a slow tool does not block pings or other calls.
+func (s *Server) ServeStdio(ctx context.Context, in io.Reader, out io.Writer) error {
+	var (
+		writeMu sync.Mutex
+		wg      sync.WaitGroup
+	)
+	write := func(resp []byte) {
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		out.Write(append(resp, '\n'))
+	}
+
+	lines := make(chan []byte)
+	scanErr := make(chan error, 1)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(in)
+		scanner.Buffer(make([]byte, 0, 64*1024), maxMessageSize)
+		for scanner.Scan() {
+			line := bytes.TrimSpace(scanner.Bytes())
+			if len(line) > 0 {
+				lines <- append([]byte(nil), line...)
+			}
+		}
+		scanErr <- scanner.Err()
+	}()
+
+	defer wg.Wait()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case line, ok := <-lines:
+			if !ok {
+				return <-scanErr
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if resp := s.handle(ctx, "stdio", line); resp != nil {
+					write(resp)
+				}
+			}()
+		}
+	}
+}
+
+// Handler serves the HTTP+SSE transport: hosts open an event stream with
+// GET <prefix>/sse and POST requests to the endpoint it announces. When
+// token is set, both require "Authorization: Bearer <token>".
+func (s *Server) Handler(token string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/sse", s.serveSSE)
+	mux.HandleFunc("/message", s.serveMessage)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token != "" {
+			got, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				http.Error(w, "invalid or missing bearer token", http.StatusUnauthorized)
+				return
+			}
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) serveSSE(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	id := newSessionID()
+	session := &sseSession{outgoing: make(chan []byte, 16), done: make(chan struct{})}
+	s.mu.Lock()
+	s.sessions[id] = session
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.sessions, id)
+		s.mu.Unlock()
+		close(session.done)
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	fmt.Fprintf(w, "event: endpoint\ndata: message?session_id=%s\n\n", id)
+	flusher.Flush()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case msg := <-session.outgoing:
+			fmt.Fprintf(w, "event: message\ndata: %s\n\n", msg)
+			flusher.Flush()
+		}
+	}
+}
+
+func (s *Server) serveMessage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id := r.URL.Query().Get("session_id")
+	s.mu.Lock()
+	session, ok := s.sessions[id]
+	s.mu.Unlock()
+	if !ok {
+		http.Error(w, "unknown session", http.StatusNotFound)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxMessageSize))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+
+	// The response travels over the event stream, which outlives this request.
+	ctx := context.WithoutCancel(r.Context())
+	go func() {
+		resp := s.handle(ctx, id, body)
+		if resp == nil {
+			return
+		}
+		select {
+		case session.outgoing <- resp:
+		case <-session.done:
+		}
+	}()
+}
+
+// handle answers one JSON-RPC message. It returns nil for notifications.
+func (s *Server) handle(ctx context.Context, session string, data []byte) []byte {
+	var req rpcMessage
+	if err := json.Unmarshal(data, &req); err != nil {
+		return encodeResponse(json.RawMessage("null"), nil, &rpcError{Code: codeParseError, Message: err.Error()})
+	}
+	if len(req.ID) == 0 {
+		return nil
+	}
+
+	var (
+		result interface{}
+		rpcErr *rpcError
+	)
+	switch req.Method {
+	case "initialize":
+		result = map[string]interface{}{
+			"protocolVersion": ProtocolVersion,
+			"capabilities": map[string]interface{}{
+				"tools": map[string]interface{}{},
+			},
+			"serverInfo": map[string]interface{}{
+				"name":    "picoclaw",
+				"version": s.version,
+			},
+		}
+	case "ping":
+		result = map[string]interface{}{}
+	case "tools/list":
+		result = map[string]interface{}{"tools": s.Tools()}
+	case "tools/call":
+		result, rpcErr = s.callTool(ctx, session, req.Params)
+	default:
+		rpcErr = &rpcError{Code: codeMethodNotFound, Message: "method not found: " + req.Method}
+	}
+	return encodeResponse(req.ID, result, rpcErr)
+}
+
+func (s *Server) callTool(ctx context.Context, session string, raw json.RawMessage) (*CallResult, *rpcError) {
+	var params struct {
+		Name      string                 `json:"name"`
+		Arguments map[string]interface{} `json:"arguments"`
+	}
+	if err := json.Unmarshal(raw, &params); err != nil {
+		return nil, &rpcError{Code: codeInvalidParams, Message: err.Error()}
+	}
+	if !s.offers(params.Name) {
+		return nil, &rpcError{Code: codeInvalidParams, Message: "unknown tool: " + params.Name}
+	}
+	if params.Arguments == nil {
+		params.Arguments = map[string]interface{}{}
+	}
+
+	logger.InfoCF("mcp", "Tool call from MCP host",
+		map[string]interface{}{
+			"tool":    params.Name,
+			"session": session,
+		})
+	ctx = tools.WithCallMetadata(ctx, tools.CallMetadata{SessionKey: ServerChannel + ":" + session})
+	result := s.registry.ExecuteWithContext(ctx, params.Name, params.Arguments, ServerChannel, session, nil)
+	return callResult(result), nil
+}
+
+// callResult converts a tool result into MCP content.
+func callResult(result *tools.ToolResult) *CallResult {
+	out := &CallResult{IsError: result.IsError}
+	for _, block := range result.Content {
+		if block.Type == tools.ContentImage && strings.HasPrefix(block.URL, "data:") {
+			meta, data, _ := strings.Cut(strings.TrimPrefix(block.URL, "data:"), ",")
+			mimeType, _, _ := strings.Cut(meta, ";")
+			out.Content = append(out.Content, Content{Type: "image", Data: data, MimeType: mimeType})
+			continue
+		}
+		out.Content = append(out.Content, Content{
+			Type: "text",
+			Text: tools.RenderContent(tools.RenderTargetLLM, []tools.ContentBlock{block}),
+		})
+	}
+	if len(out.Content) == 0 {
+		text := result.ForLLM
+		if text == "" && result.Err != nil {
+			text = result.Err.Error()
+		}
+		out.Content = []Content{{Type: "text", Text: text}}
+	}
+	return out
+}
+
+func encodeResponse(id json.RawMessage, result interface{}, rpcErr *rpcError) []byte {
+	msg := rpcMessage{JSONRPC: "2.0", ID: id, Error: rpcErr}
+	if rpcErr == nil {
+		raw, err := json.Marshal(result)
+		if err != nil {
+			msg.Error = &rpcError{Code: -32603, Message: err.Error()}
+		} else {
+			msg.Result = raw
+		}
+	}
+	data, _ := json.Marshal(msg)
+	return data
+}
+
+func newSessionID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,143 @@
+package mcp
+
+import (
+	"context"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+type echoTool struct {
+	name string
+}
+
+func (t *echoTool) Name() string        { return t.name }
+func (t *echoTool) Description() string { return "Echo the text argument" }
+func (t *echoTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"text": map[string]interface{}{"type": "string"},
+		},
+	}
+}
+
+func (t *echoTool) Execute(ctx context.Context, args map[string]interface{}) *tools.ToolResult {
+	text, _ := args["text"].(string)
+	if text == "" {
+		return tools.ErrorResult("text is required")
+	}
+	return tools.NewToolResult(t.name + ": " + text)
+}
+
+// testServer offers knows_echo; exec is not allowed and knows_secret needs
+// approval, so neither is exported.
+func testServer() *Server {
+	registry := tools.NewToolRegistry()
+	for _, name := range []string{"knows_echo", "knows_secret", "exec"} {
+		registry.Register(&echoTool{name: name})
+	}
+	registry.SetApprovalManager(tools.NewApprovalManager(time.Second, []string{"knows_secret"}))
+	return NewServer(registry, tools.ToolRolePolicy{Allow: []string{"knows_*"}}, "test")
+}
+
+func checkExportedTools(t *testing.T, client *Client) {
+	t.Helper()
+	ctx := context.Background()
+
+	infos, err := client.ListTools(ctx)
+	if err != nil {
+		t.Fatalf("ListTools: %v", err)
+	}
+	var names []string
+	for _, info := range infos {
+		names = append(names, info.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"knows_echo"}) {
+		t.Fatalf("exported tools = %v, want [knows_echo]", names)
+	}
+
+	result, err := client.CallTool(ctx, "knows_echo", map[string]interface{}{"text": "CA19-9"})
+	if err != nil {
+		t.Fatalf("CallTool: %v", err)
+	}
+	if result.IsError || len(result.Content) != 1 || result.Content[0].Text != "knows_echo: CA19-9" {
+		t.Errorf("unexpected result: %+v", result)
+	}
+
+	result, err = client.CallTool(ctx, "knows_echo", nil)
+	if err != nil || !result.IsError {
+		t.Errorf("expected tool error result, got %+v, %v", result, err)
+	}
+
+	for _, name := range []string{"exec", "knows_secret"} {
+		if _, err := client.CallTool(ctx, name, nil); err == nil || !strings.Contains(err.Error(), "unknown tool") {
+			t.Errorf("expected %s to be refused, got %v", name, err)
+		}
+	}
+}
+
+func TestServer_Stdio(t *testing.T) {
+	client, err := Connect(context.Background(), ServerConfig{
+		Name:    "picoclaw",
+		Command: os.Args[0],
+		Env:     map[string]string{"MCP_TEST_PICOCLAW_SERVER": "1"},
+		Timeout: 10 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	defer client.Close()
+	checkExportedTools(t, client)
+}
+
+func TestServer_SSE(t *testing.T) {
+	ts := httptest.NewServer(testServer().Handler("secret"))
+	defer ts.Close()
+
+	ctx := context.Background()
+	if _, err := Connect(ctx, ServerConfig{Name: "picoclaw", URL: ts.URL + "/sse", Timeout: 2 * time.Second}); err == nil {
+		t.Fatal("expected connection without token to fail")
+	}
+
+	client, err := Connect(ctx, ServerConfig{
+		Name:    "picoclaw",
+		URL:     ts.URL + "/sse",
+		Headers: map[string]string{"Authorization": "Bearer secret"},
+		Timeout: 5 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	defer client.Close()
+	checkExportedTools(t, client)
+}
+
+func TestServer_HandleErrors(t *testing.T) {
+	s := testServer()
+	tests := []struct {
+		name    string
+		request string
+		want    string
+	}{
+		{"parse error", `{not json`, `"code":-32700`},
+		{"unknown method", `{"jsonrpc":"2.0","id":1,"method":"resources/list"}`, `"code":-32601`},
+		{"ping", `{"jsonrpc":"2.0","id":"a","method":"ping"}`, `"result":{}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(s.handle(context.Background(), "test", []byte(tt.request))); !strings.Contains(got, tt.want) {
+				t.Errorf("handle(%s) = %s, want %s", tt.request, got, tt.want)
+			}
+		})
+	}
+
+	if got := s.handle(context.Background(), "test", []byte(`{"jsonrpc":"2.0","method":"notifications/initialized"}`)); got != nil {
+		t.Errorf("expected no reply to a notification, got %s", got)
+	}
+}
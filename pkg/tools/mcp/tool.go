@@ -0,0 +1,209 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+// maxToolNameLen is the longest function name most LLM APIs accept.
+const maxToolNameLen = 64
+
+var invalidNameChars = regexp.MustCompile(`[^a-zA-Z0-9_-]+`)
+
+// ToolName returns the registry name for a server's tool: the server name
+// and tool name joined by "_", with unsupported characters replaced.
+func ToolName(server, tool string) string {
+	name := invalidNameChars.ReplaceAllString(server+"_"+tool, "_")
+	if len(name) > maxToolNameLen {
+		name = name[:maxToolNameLen]
+	}
+	return name
+}
+
+// Tool exposes one MCP server tool as a picoclaw tool.
+type Tool struct {
+	client      *Client
+	name        string
+	remoteName  string
+	description string
+	schema      map[string]interface{}
+}
+
+// NewTool wraps info from client.
+func NewTool(client *Client, info ToolInfo) *Tool {
+	schema := info.InputSchema
+	if schema == nil {
+		schema = map[string]interface{}{}
+	}
+	if _, ok := schema["type"]; !ok {
+		schema["type"] = "object"
+	}
+	if _, ok := schema["properties"]; !ok {
+		schema["properties"] = map[string]interface{}{}
+	}
+
+	description := info.Description
+	if description == "" {
+		description = info.Name
+	}
+	return &Tool{
+		client:      client,
+		name:        ToolName(client.Name(), info.Name),
+		remoteName:  info.Name,
+		description: fmt.Sprintf("[MCP %s] %s", client.Name(), description),
+		schema:      schema,
+	}
+}
+
+func (t *Tool) Name() string {
+	return t.name
+}
+
+func (t *Tool) Description() string {
+	return t.description
+}
+
+func (t *Tool) Parameters() map[string]interface{} {
+	return t.schema
+}
+
+func (t *Tool) Execute(ctx context.Context, args map[string]interface{}) *tools.ToolResult {
+	result, err := t.client.CallTool(ctx, t.remoteName, args)
+	if err != nil {
+		return tools.ErrorResult(fmt.Sprintf("%s failed: %v", t.name, err)).WithError(classify(ctx, err))
+	}
+
+	blocks := contentBlocks(result.Content)
+	if result.IsError {
+		return tools.ErrorResult(tools.RenderContent(tools.RenderTargetLLM, blocks))
+	}
+	if len(blocks) == 1 && blocks[0].Type == tools.ContentText {
+		return tools.NewToolResult(blocks[0].Text)
+	}
+	return tools.RichResult(blocks...)
+}
+
+func contentBlocks(content []Content) []tools.ContentBlock {
+	blocks := make([]tools.ContentBlock, 0, len(content))
+	for _, c := range content {
+		switch c.Type {
+		case "text":
+			blocks = append(blocks, tools.TextBlock(c.Text))
+		case "image":
+			block := tools.ImageBlock("data:"+c.MimeType+";base64,"+c.Data, "")
+			block.MimeType = c.MimeType
+			blocks = append(blocks, block)
+		case "resource":
+			if c.Resource == nil {
+				continue
+			}
+			if c.Resource.Text != "" {
+				blocks = append(blocks, tools.TextBlock(c.Resource.Text))
+			} else {
+				block := tools.FileBlock(c.Resource.URI, c.Resource.URI, "")
+				block.MimeType = c.Resource.MimeType
+				blocks = append(blocks, block)
+			}
+		default:
+			blocks = append(blocks, tools.TextBlock(fmt.Sprintf("[unsupported %s content]", c.Type)))
+		}
+	}
+	if len(blocks) == 0 {
+		blocks = append(blocks, tools.TextBlock("(no output)"))
+	}
+	return blocks
+}
+
+// Manager owns the connections to configured MCP servers.
+type Manager struct {
+	mu      sync.Mutex
+	clients []*Client
+}
+
+func NewManager() *Manager {
+	return &Manager{}
+}
+
+// Connect connects to each server and returns the tools they offer.
+// Servers that fail are logged and skipped so one broken server does not
+// keep the others from loading.
+func (m *Manager) Connect(ctx context.Context, servers []ServerConfig) []tools.Tool {
+	var all []tools.Tool
+	for _, cfg := range servers {
+		client, err := Connect(ctx, cfg)
+		if err != nil {
+			logger.WarnCF("mcp", "MCP server unavailable",
+				map[string]interface{}{
+					"server": cfg.Name,
+					"error":  err.Error(),
+				})
+			continue
+		}
+
+		infos, err := client.ListTools(ctx)
+		if err != nil {
+			logger.WarnCF("mcp", "Failed to list MCP tools",
+				map[string]interface{}{
+					"server": cfg.Name,
+					"error":  err.Error(),
+				})
+			client.Close()
+			continue
+		}
+
+		m.mu.Lock()
+		m.clients = append(m.clients, client)
+		m.mu.Unlock()
+
+		names := make([]string, 0, len(infos))
+		for _, info := range infos {
+			tool := NewTool(client, info)
+			all = append(all, tool)
+			names = append(names, tool.Name())
+		}
+		logger.InfoCF("mcp", "Loaded MCP tools",
+			map[string]interface{}{
+				"server": cfg.Name,
+				"tools":  strings.Join(names, ", "),
+			})
+	}
+	return all
+}
+
+// Close disconnects from every server.
+func (m *Manager) Close() {
+	m.mu.Lock()
+	clients := m.clients
+	m.clients = nil
+	m.mu.Unlock()
+	for _, c := range clients {
+		c.Close()
+	}
+}
+
+// classify marks a failed call for the agent loop. Rejected parameters are
+// the model's to fix; timeouts and dropped connections may clear up on a
+// repeated call.
+func classify(ctx context.Context, err error) error {
+	var rpcErr *rpcError
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &rpcErr):
+		if rpcErr.Code == codeInvalidParams {
+			return tools.ClassifyError(tools.ErrInvalidArgs, err)
+		}
+		return err
+	case ctx.Err() != nil, errors.As(err, &syntaxErr), errors.As(err, &typeErr):
+		return err
+	}
+	return tools.ClassifyError(tools.ErrRetryable, err)
+}
@@ -0,0 +1,245 @@
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+const maxMessageSize = 16 * 1024 * 1024
+
+// stdioTransport runs the server as a child process and exchanges
+// newline-delimited JSON over its stdin and stdout.
+type stdioTransport struct {
+	cmd      *exec.Cmd
+	stdin    io.WriteCloser
+	incoming chan []byte
+	writeMu  sync.Mutex
+	once     sync.Once
+}
+
+func newStdioTransport(cfg ServerConfig) (*stdioTransport, error) {
+	cmd := exec.Command(cfg.Command, cfg.Args...)
+	cmd.Env = os.Environ()
+	for k, v := range cfg.Env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start %s: %w", cfg.Command, err)
+	}
+
+	t := &stdioTransport{
+		cmd:      cmd,
+		stdin:    stdin,
+		incoming: make(chan []byte, 16),
+	}
+
+	go func() {
+		defer close(t.incoming)
+		scanner := bufio.NewScanner(stdout)
+		scanner.Buffer(make([]byte, 0, 64*1024), maxMessageSize)
+		for scanner.Scan() {
+			line := bytes.TrimSpace(scanner.Bytes())
+			if len(line) == 0 {
+				continue
+			}
+			t.incoming <- append([]byte(nil), line...)
+		}
+	}()
+
+	go func() {
+		scanner := bufio.NewScanner(stderr)
+		for scanner.Scan() {
+			logger.DebugCF("mcp", "Server stderr",
+				map[string]interface{}{
+					"server": cfg.Name,
+					"line":   scanner.Text(),
+				})
+		}
+	}()
+
+	return t, nil
+}
+
+func (t *stdioTransport) send(ctx context.Context, msg []byte) error {
+	t.writeMu.Lock()
+	defer t.writeMu.Unlock()
+	_, err := t.stdin.Write(append(msg, '\n'))
+	return err
+}
+
+func (t *stdioTransport) messages() <-chan []byte {
+	return t.incoming
+}
+
+func (t *stdioTransport) close() error {
+	t.once.Do(func() {
+		t.stdin.Close()
+		done := make(chan struct{})
+		go func() {
+			t.cmd.Wait()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(2 * time.Second):
+			t.cmd.Process.Kill()
+			<-done
+		}
+	})
+	return nil
+}
+
+// sseTransport speaks the HTTP+SSE transport: server messages arrive as
+// "message" events on a long-lived GET stream, and client messages are
+// POSTed to the endpoint announced by the first "endpoint" event.
+type sseTransport struct {
+	client   *http.Client
+	headers  map[string]string
+	endpoint string
+	body     io.ReadCloser
+	incoming chan []byte
+	once     sync.Once
+}
+
+func newSSETransport(ctx context.Context, cfg ServerConfig, timeout time.Duration) (*sseTransport, error) {
+	base, err := url.Parse(cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid url: %w", err)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, cfg.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	for k, v := range cfg.Headers {
+		req.Header.Set(k, v)
+	}
+
+	// The stream outlives ctx, so it uses its own client without a timeout.
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("sse stream returned %s", resp.Status)
+	}
+
+	t := &sseTransport{
+		client:   &http.Client{Timeout: timeout},
+		headers:  cfg.Headers,
+		body:     resp.Body,
+		incoming: make(chan []byte, 16),
+	}
+
+	endpoint := make(chan string, 1)
+	go func() {
+		defer close(t.incoming)
+		readSSE(resp.Body, func(event, data string) {
+			switch event {
+			case "endpoint":
+				if ref, err := base.Parse(strings.TrimSpace(data)); err == nil {
+					select {
+					case endpoint <- ref.String():
+					default:
+					}
+				}
+			case "", "message":
+				t.incoming <- []byte(data)
+			}
+		})
+	}()
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	select {
+	case t.endpoint = <-endpoint:
+		return t, nil
+	case <-ctx.Done():
+		t.close()
+		return nil, fmt.Errorf("no endpoint event from %s", cfg.URL)
+	}
+}
+
+// readSSE calls fn for each event in r until it ends.
+func readSSE(r io.Reader, fn func(event, data string)) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxMessageSize)
+	var event string
+	var data []string
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if len(data) > 0 {
+				fn(event, strings.Join(data, "\n"))
+			}
+			event, data = "", nil
+		case strings.HasPrefix(line, ":"):
+			// comment / keep-alive
+		case strings.HasPrefix(line, "event:"):
+			event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			data = append(data, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+}
+
+func (t *sseTransport) send(ctx context.Context, msg []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.endpoint, bytes.NewReader(msg))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range t.headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("post to %s returned %s", t.endpoint, resp.Status)
+	}
+	return nil
+}
+
+func (t *sseTransport) messages() <-chan []byte {
+	return t.incoming
+}
+
+func (t *sseTransport) close() error {
+	var err error
+	t.once.Do(func() {
+		err = t.body.Close()
+	})
+	return err
+}
@@ -0,0 +1,392 @@
+package tools
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/cron"
+	"github.com/sipeed/picoclaw/pkg/session"
+)
+
+var medicationTimePattern = regexp.MustCompile(`^([01]?[0-9]|2[0-3]):([0-5][0-9])$`)
+
+// medicationWeekdays are the day names, indexed by cron day of week.
+var medicationWeekdays = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// MedicationStore keeps medication reminders with the session they were
+// set up in.
+type MedicationStore interface {
+	AddMedicationReminder(key string, reminder session.MedicationReminder)
+	MedicationReminders(key string) []session.MedicationReminder
+	RemoveMedicationReminder(key, id string) (session.MedicationReminder, bool)
+	Save(key string) error
+}
+
+// medicationReminders is shared by the medication reminder tools.
+type medicationReminders struct {
+	scheduler *cron.CronService
+	store     MedicationStore
+	timezone  string
+}
+
+// NewMedicationReminderTools returns the tools that create, list and
+// delete medication reminders. Reminders are stored in the session and
+// delivered by scheduler to the chat they were created in, at the given
+// times in the user's time zone (timezone when the user gives none).
+func NewMedicationReminderTools(scheduler *cron.CronService, store MedicationStore, timezone string) []Tool {
+	m := &medicationReminders{scheduler: scheduler, store: store, timezone: timezone}
+	return []Tool{
+		&MedicationReminderCreateTool{m},
+		&MedicationReminderListTool{m},
+		&MedicationReminderDeleteTool{m},
+	}
+}
+
+// describe summarizes a reminder with the state of its scheduler jobs.
+func (m *medicationReminders) describe(r session.MedicationReminder) map[string]interface{} {
+	jobs := make(map[string]cron.CronJob)
+	for _, job := range m.scheduler.ListJobs(true) {
+		jobs[job.ID] = job
+	}
+	loc := time.Local
+	if r.Timezone != "" {
+		if l, err := time.LoadLocation(r.Timezone); err == nil {
+			loc = l
+		}
+	}
+
+	out := map[string]interface{}{
+		"id":         r.ID,
+		"medication": r.Medication,
+		"times":      r.Times,
+	}
+	if r.Dose != "" {
+		out["dose"] = r.Dose
+	}
+	if r.Instructions != "" {
+		out["instructions"] = r.Instructions
+	}
+	if len(r.Days) > 0 {
+		out["days"] = r.Days
+	} else {
+		out["days"] = "daily"
+	}
+	if r.Timezone != "" {
+		out["timezone"] = r.Timezone
+	}
+
+	var next *int64
+	active, missed, awaiting := 0, 0, false
+	for _, id := range r.JobIDs {
+		job, ok := jobs[id]
+		if !ok || !job.Enabled {
+			continue
+		}
+		active++
+		if n := job.State.NextRunAtMS; n != nil && (next == nil || *n < *next) {
+			next = n
+		}
+		if job.State.MissedAcks > missed {
+			missed = job.State.MissedAcks
+		}
+		if job.State.AckDueAtMS != nil {
+			awaiting = true
+		}
+	}
+	switch {
+	case active == 0:
+		out["status"] = "stopped"
+	case active < len(r.JobIDs):
+		out["status"] = "partly stopped"
+	default:
+		out["status"] = "active"
+	}
+	if next != nil {
+		out["next_reminder"] = time.UnixMilli(*next).In(loc).Format("2006-01-02 15:04 MST")
+	}
+	if awaiting {
+		out["awaiting_confirmation"] = true
+	}
+	if missed > 0 {
+		out["missed_in_a_row"] = missed
+	}
+	return out
+}
+
+func newMedicationReminderID() string {
+	b := make([]byte, 4)
+	rand.Read(b)
+	return "med-" + hex.EncodeToString(b)
+}
+
+// MedicationReminderCreateTool schedules reminders to take a medication.
+type MedicationReminderCreateTool struct {
+	m *medicationReminders
+}
+
+func (t *MedicationReminderCreateTool) Name() string {
+	return "medication_reminder_create"
+}
+
+func (t *MedicationReminderCreateTool) Description() string {
+	return "Set up reminders to take a medication at fixed times of day, such as pancreatic enzymes with each meal or a chemotherapy tablet twice daily. " +
+		"Reminders arrive in this chat at the user's local time and ask the user to confirm the dose with /taken. " +
+		"Confirm the medication, dose and times with the user before creating the schedule, and never change a prescribed schedule on your own."
+}
+
+func (t *MedicationReminderCreateTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"medication": map[string]interface{}{
+				"type":        "string",
+				"description": "Medication name, as the user knows it",
+			},
+			"dose": map[string]interface{}{
+				"type":        "string",
+				"description": "Dose per time, e.g. \"25,000 units\" or \"1 tablet\"",
+			},
+			"instructions": map[string]interface{}{
+				"type":        "string",
+				"description": "How to take it, e.g. \"with the first bite of the meal\"",
+			},
+			"times": map[string]interface{}{
+				"type":        "array",
+				"items":       map[string]interface{}{"type": "string"},
+				"description": "Times of day in 24-hour HH:MM, e.g. [\"08:00\", \"12:30\", \"18:30\"]",
+			},
+			"days": map[string]interface{}{
+				"type":        "array",
+				"items":       map[string]interface{}{"type": "string", "enum": []string{"mon", "tue", "wed", "thu", "fri", "sat", "sun"}},
+				"description": "Days of the week; leave empty for every day",
+			},
+			"timezone": map[string]interface{}{
+				"type":        "string",
+				"description": "The user's IANA time zone, e.g. \"Asia/Shanghai\"; leave empty for the default",
+			},
+		},
+		"required": []string{"medication", "times"},
+	}
+}
+
+type medicationReminderCreateArgs struct {
+	Medication   string   `json:"medication" arg:"required"`
+	Dose         string   `json:"dose"`
+	Instructions string   `json:"instructions"`
+	Times        []string `json:"times" arg:"required,min=1,max=8"`
+	Days         []string `json:"days" arg:"max=7"`
+	Timezone     string   `json:"timezone"`
+}
+
+func (t *MedicationReminderCreateTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	a, err := BindArgs[medicationReminderCreateArgs](args)
+	if err != nil {
+		return ErrorResult(err.Error()).WithError(err)
+	}
+	tc := ToolContextFrom(ctx)
+	if tc.Channel == "" || tc.ChatID == "" || tc.SessionKey == "" {
+		return ErrorResult("medication reminders can only be set up in a chat").WithError(ErrInvalidArgs)
+	}
+
+	timezone := strings.TrimSpace(a.Timezone)
+	if timezone == "" {
+		timezone = t.m.timezone
+	}
+	if timezone != "" {
+		if _, err := time.LoadLocation(timezone); err != nil {
+			return ErrorResult(fmt.Sprintf("unknown time zone %q; use an IANA name such as Asia/Shanghai", timezone)).
+				WithError(ClassifyError(ErrInvalidArgs, err))
+		}
+	}
+
+	times := make([]string, 0, len(a.Times))
+	seen := make(map[string]bool)
+	for _, raw := range a.Times {
+		m := medicationTimePattern.FindStringSubmatch(strings.TrimSpace(raw))
+		if m == nil {
+			return ErrorResult(fmt.Sprintf("invalid time %q; use 24-hour HH:MM", raw)).WithError(ErrInvalidArgs)
+		}
+		hour, _ := strconv.Atoi(m[1])
+		hm := fmt.Sprintf("%02d:%s", hour, m[2])
+		if !seen[hm] {
+			seen[hm] = true
+			times = append(times, hm)
+		}
+	}
+	sort.Strings(times)
+
+	dow := "*"
+	var days []string
+	if len(a.Days) > 0 {
+		selected := make([]bool, len(medicationWeekdays))
+		for _, d := range a.Days {
+			d = strings.ToLower(strings.TrimSpace(d))
+			n := indexOf(medicationWeekdays, d)
+			if n < 0 {
+				return ErrorResult(fmt.Sprintf("invalid day %q; use mon, tue, wed, thu, fri, sat or sun", d)).WithError(ErrInvalidArgs)
+			}
+			selected[n] = true
+		}
+		var nums []string
+		for n, ok := range selected {
+			if ok {
+				nums = append(nums, strconv.Itoa(n))
+				days = append(days, medicationWeekdays[n])
+			}
+		}
+		if len(nums) < len(medicationWeekdays) {
+			dow = strings.Join(nums, ",")
+		} else {
+			days = nil
+		}
+	}
+
+	message := "Medication reminder: time to take " + a.Medication
+	if a.Dose != "" {
+		message += " (" + a.Dose + ")"
+	}
+	message += "."
+	if a.Instructions != "" {
+		message += " " + a.Instructions
+	}
+
+	reminder := session.MedicationReminder{
+		ID:           newMedicationReminderID(),
+		Medication:   a.Medication,
+		Dose:         a.Dose,
+		Instructions: a.Instructions,
+		Times:        times,
+		Days:         days,
+		Timezone:     timezone,
+		Created:      time.Now(),
+	}
+	for _, hm := range times {
+		hour, minute, _ := strings.Cut(hm, ":")
+		schedule := cron.CronSchedule{
+			Kind: "cron",
+			Expr: fmt.Sprintf("%s %s * * %s", strings.TrimPrefix(minute, "0"), strings.TrimPrefix(hour, "0"), dow),
+			TZ:   timezone,
+		}
+		job, err := t.m.scheduler.AddJob(fmt.Sprintf("%s %s", a.Medication, hm), schedule, message, true, tc.Channel, tc.ChatID)
+		if err == nil {
+			job.Payload.RequiresAck = true
+			err = t.m.scheduler.UpdateJob(job)
+		}
+		if err != nil {
+			if job != nil {
+				t.m.scheduler.RemoveJob(job.ID)
+			}
+			for _, id := range reminder.JobIDs {
+				t.m.scheduler.RemoveJob(id)
+			}
+			return ErrorResult(fmt.Sprintf("failed to schedule reminder: %v", err))
+		}
+		reminder.JobIDs = append(reminder.JobIDs, job.ID)
+	}
+
+	t.m.store.AddMedicationReminder(tc.SessionKey, reminder)
+	if err := t.m.store.Save(tc.SessionKey); err != nil {
+		return ErrorResult(fmt.Sprintf("reminder scheduled but not saved: %v", err))
+	}
+	payload, _ := json.Marshal(t.m.describe(reminder))
+	return NewToolResult(string(payload))
+}
+
+func indexOf(list []string, s string) int {
+	for i, item := range list {
+		if item == s {
+			return i
+		}
+	}
+	return -1
+}
+
+// MedicationReminderListTool lists the medication reminders of the chat.
+type MedicationReminderListTool struct {
+	m *medicationReminders
+}
+
+func (t *MedicationReminderListTool) Name() string {
+	return "medication_reminder_list"
+}
+
+func (t *MedicationReminderListTool) Description() string {
+	return "List the medication reminders set up in this chat, with their times, the next reminder and how many doses in a row went unconfirmed."
+}
+
+func (t *MedicationReminderListTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type":       "object",
+		"properties": map[string]interface{}{},
+	}
+}
+
+func (t *MedicationReminderListTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	key := ToolContextFrom(ctx).SessionKey
+	reminders := t.m.store.MedicationReminders(key)
+	list := make([]map[string]interface{}, 0, len(reminders))
+	for _, r := range reminders {
+		list = append(list, t.m.describe(r))
+	}
+	payload, _ := json.Marshal(map[string]interface{}{"reminders": list})
+	return NewToolResult(string(payload))
+}
+
+// MedicationReminderDeleteTool stops and removes a medication reminder.
+type MedicationReminderDeleteTool struct {
+	m *medicationReminders
+}
+
+func (t *MedicationReminderDeleteTool) Name() string {
+	return "medication_reminder_delete"
+}
+
+func (t *MedicationReminderDeleteTool) Description() string {
+	return "Stop and remove a medication reminder in this chat, by the id from medication_reminder_list. " +
+		"Only do this when the user asks, for example because the medication was stopped or the schedule changed."
+}
+
+func (t *MedicationReminderDeleteTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"id": map[string]interface{}{
+				"type":        "string",
+				"description": "Reminder id, e.g. med-1a2b3c4d",
+			},
+		},
+		"required": []string{"id"},
+	}
+}
+
+type medicationReminderDeleteArgs struct {
+	ID string `json:"id" arg:"required"`
+}
+
+func (t *MedicationReminderDeleteTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	a, err := BindArgs[medicationReminderDeleteArgs](args)
+	if err != nil {
+		return ErrorResult(err.Error()).WithError(err)
+	}
+	key := ToolContextFrom(ctx).SessionKey
+	reminder, ok := t.m.store.RemoveMedicationReminder(key, a.ID)
+	if !ok {
+		return ErrorResult(fmt.Sprintf("no medication reminder %q in this chat", a.ID)).
+			WithError(ClassifyError(ErrNotFound, fmt.Errorf("reminder %s not found", a.ID)))
+	}
+	for _, id := range reminder.JobIDs {
+		t.m.scheduler.RemoveJob(id)
+	}
+	if err := t.m.store.Save(key); err != nil {
+		return ErrorResult(fmt.Sprintf("reminder stopped but not saved: %v", err))
+	}
+	return NewToolResult(fmt.Sprintf("Stopped reminders for %s at %s.", reminder.Medication, strings.Join(reminder.Times, ", ")))
+}
@@ -0,0 +1,127 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/cron"
+	"github.com/sipeed/picoclaw/pkg/session"
+)
+
+func medicationTestTools(t *testing.T, dir string) (map[string]Tool, *cron.CronService, *session.SessionManager) {
+	t.Helper()
+	scheduler := cron.NewCronService(filepath.Join(dir, "cron", "jobs.json"), nil)
+	sessions := session.NewSessionManager(filepath.Join(dir, "sessions"))
+	byName := make(map[string]Tool)
+	for _, tool := range NewMedicationReminderTools(scheduler, sessions, "Asia/Shanghai") {
+		byName[tool.Name()] = tool
+	}
+	return byName, scheduler, sessions
+}
+
+func inChat(sessionKey string) context.Context {
+	ctx := WithCallMetadata(context.Background(), CallMetadata{SessionKey: sessionKey, UserID: "42"})
+	return NewToolContext(ctx, "telegram", "42")
+}
+
+func TestMedicationReminders(t *testing.T) {
+	dir := t.TempDir()
+	tools, scheduler, sessions := medicationTestTools(t, dir)
+	ctx := inChat("telegram:42")
+
+	result := tools["medication_reminder_create"].Execute(ctx, map[string]interface{}{
+		"medication":   "Creon",
+		"dose":         "25,000 units",
+		"instructions": "With the first bite of each meal.",
+		"times":        []interface{}{"18:30", "7:30", "12:00", "07:30"},
+		"days":         []interface{}{"fri", "mon"},
+	})
+	if result.IsError {
+		t.Fatalf("create: %s", result.ForLLM)
+	}
+	var created map[string]interface{}
+	json.Unmarshal([]byte(result.ForLLM), &created)
+	id, _ := created["id"].(string)
+	if !strings.HasPrefix(id, "med-") || created["status"] != "active" || created["timezone"] != "Asia/Shanghai" ||
+		created["next_reminder"] == nil || !strings.HasSuffix(created["next_reminder"].(string), "CST") {
+		t.Fatalf("unexpected result: %s", result.ForLLM)
+	}
+
+	jobs := scheduler.ListJobs(false)
+	if len(jobs) != 3 {
+		t.Fatalf("scheduled %d jobs, want 3", len(jobs))
+	}
+	exprs := map[string]bool{}
+	for _, job := range jobs {
+		exprs[job.Schedule.Expr] = true
+		if job.Schedule.TZ != "Asia/Shanghai" || !job.Payload.RequiresAck || !job.Payload.Deliver ||
+			job.Payload.Channel != "telegram" || job.Payload.To != "42" {
+			t.Errorf("unexpected job: %+v", job)
+		}
+		if job.Payload.Message != "Medication reminder: time to take Creon (25,000 units). With the first bite of each meal." {
+			t.Errorf("message = %q", job.Payload.Message)
+		}
+	}
+	for _, want := range []string{"30 7 * * 1,5", "0 12 * * 1,5", "30 18 * * 1,5"} {
+		if !exprs[want] {
+			t.Errorf("missing schedule %q in %v", want, exprs)
+		}
+	}
+
+	// The reminder is saved in the session store.
+	reloaded := session.NewSessionManager(filepath.Join(dir, "sessions"))
+	if got := reloaded.MedicationReminders("telegram:42"); len(got) != 1 || strings.Join(got[0].Times, ",") != "07:30,12:00,18:30" ||
+		strings.Join(got[0].Days, ",") != "mon,fri" {
+		t.Fatalf("stored reminders = %+v", got)
+	}
+
+	result = tools["medication_reminder_list"].Execute(ctx, map[string]interface{}{})
+	if !strings.Contains(result.ForLLM, id) || !strings.Contains(result.ForLLM, `"dose":"25,000 units"`) {
+		t.Errorf("list: %s", result.ForLLM)
+	}
+	if result := tools["medication_reminder_list"].Execute(inChat("telegram:7"), map[string]interface{}{}); strings.Contains(result.ForLLM, id) {
+		t.Errorf("reminder listed in another chat: %s", result.ForLLM)
+	}
+
+	if result := tools["medication_reminder_delete"].Execute(inChat("telegram:7"), map[string]interface{}{"id": id}); !errors.Is(result.Err, ErrNotFound) {
+		t.Errorf("delete from another chat: %v", result.Err)
+	}
+	if result := tools["medication_reminder_delete"].Execute(ctx, map[string]interface{}{"id": id}); result.IsError {
+		t.Fatalf("delete: %s", result.ForLLM)
+	}
+	if n := len(scheduler.ListJobs(true)); n != 0 {
+		t.Errorf("%d jobs left after delete", n)
+	}
+	if got := sessions.MedicationReminders("telegram:42"); len(got) != 0 {
+		t.Errorf("reminders left after delete: %+v", got)
+	}
+}
+
+func TestMedicationReminderCreate_InvalidArgs(t *testing.T) {
+	tools, scheduler, _ := medicationTestTools(t, t.TempDir())
+	tests := []struct {
+		name string
+		ctx  context.Context
+		args map[string]interface{}
+	}{
+		{"bad time", inChat("telegram:42"), map[string]interface{}{"medication": "Creon", "times": []interface{}{"8am"}}},
+		{"bad day", inChat("telegram:42"), map[string]interface{}{"medication": "Creon", "times": []interface{}{"08:00"}, "days": []interface{}{"weekday"}}},
+		{"bad time zone", inChat("telegram:42"), map[string]interface{}{"medication": "Creon", "times": []interface{}{"08:00"}, "timezone": "Beijing"}},
+		{"no times", inChat("telegram:42"), map[string]interface{}{"medication": "Creon", "times": []interface{}{}}},
+		{"no chat", context.Background(), map[string]interface{}{"medication": "Creon", "times": []interface{}{"08:00"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := tools["medication_reminder_create"].Execute(tt.ctx, tt.args); !errors.Is(result.Err, ErrInvalidArgs) {
+				t.Errorf("Err = %v, want ErrInvalidArgs (%s)", result.Err, result.ForLLM)
+			}
+		})
+	}
+	if n := len(scheduler.ListJobs(true)); n != 0 {
+		t.Errorf("%d jobs scheduled by invalid calls", n)
+	}
+}
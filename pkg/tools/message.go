@@ -3,15 +3,37 @@ package tools
 import (
 	"context"
 	"fmt"
+	"sync/atomic"
 )
 
 type SendCallback func(channel, chatID, content string) error
 
+// MessageTool sends messages to chats. It is shared by every session, so
+// the chat being answered comes from the call's ToolContext, and whether
+// a message was sent is kept in the round's context (see WithMessageRound).
 type MessageTool struct {
-	sendCallback   SendCallback
-	defaultChannel string
-	defaultChatID  string
-	sentInRound    bool // Tracks whether a message was sent in the current processing round
+	sendCallback SendCallback
+}
+
+type messageRoundKey struct{}
+
+// messageRound records whether the message tool sent anything while one
+// message was being answered.
+type messageRound struct {
+	sent atomic.Bool
+}
+
+// WithMessageRound returns a context for answering one message, in which
+// the message tool's sends are recorded for MessageSentInRound.
+func WithMessageRound(ctx context.Context) context.Context {
+	return context.WithValue(ctx, messageRoundKey{}, &messageRound{})
+}
+
+// MessageSentInRound reports whether the message tool sent a message in
+// the round started by WithMessageRound that ctx belongs to.
+func MessageSentInRound(ctx context.Context) bool {
+	round, ok := ctx.Value(messageRoundKey{}).(*messageRound)
+	return ok && round.sent.Load()
 }
 
 func NewMessageTool() *MessageTool {
@@ -47,15 +69,13 @@ func (t *MessageTool) Parameters() map[string]interface{} {
 	}
 }
 
-func (t *MessageTool) SetContext(channel, chatID string) {
-	t.defaultChannel = channel
-	t.defaultChatID = chatID
-	t.sentInRound = false // Reset send tracking for new processing round
-}
-
-// HasSentInRound returns true if the message tool sent a message during the current round.
-func (t *MessageTool) HasSentInRound() bool {
-	return t.sentInRound
+// RequiresApproval reports whether the message targets a chat other than
+// the one being answered; replies to the current chat never need approval.
+func (t *MessageTool) RequiresApproval(ctx context.Context, args map[string]interface{}) bool {
+	channel, _ := args["channel"].(string)
+	chatID, _ := args["chat_id"].(string)
+	tc := ToolContextFrom(ctx)
+	return (channel != "" && channel != tc.Channel) || (chatID != "" && chatID != tc.ChatID)
 }
 
 func (t *MessageTool) SetSendCallback(callback SendCallback) {
@@ -71,11 +91,12 @@ func (t *MessageTool) Execute(ctx context.Context, args map[string]interface{})
 	channel, _ := args["channel"].(string)
 	chatID, _ := args["chat_id"].(string)
 
+	tc := ToolContextFrom(ctx)
 	if channel == "" {
-		channel = t.defaultChannel
+		channel = tc.Channel
 	}
 	if chatID == "" {
-		chatID = t.defaultChatID
+		chatID = tc.ChatID
 	}
 
 	if channel == "" || chatID == "" {
@@ -94,7 +115,9 @@ func (t *MessageTool) Execute(ctx context.Context, args map[string]interface{})
 		}
 	}
 
-	t.sentInRound = true
+	if round, ok := ctx.Value(messageRoundKey{}).(*messageRound); ok {
+		round.sent.Store(true)
+	}
 	// Silent: user already received the message directly
 	return &ToolResult{
 		ForLLM: fmt.Sprintf("Message sent to %s:%s", channel, chatID),
@@ -8,7 +8,6 @@ import (
 
 func TestMessageTool_Execute_Success(t *testing.T) {
 	tool := NewMessageTool()
-	tool.SetContext("test-channel", "test-chat-id")
 
 	var sentChannel, sentChatID, sentContent string
 	tool.SetSendCallback(func(channel, chatID, content string) error {
@@ -18,7 +17,7 @@ func TestMessageTool_Execute_Success(t *testing.T) {
 		return nil
 	})
 
-	ctx := context.Background()
+	ctx := NewToolContext(context.Background(), "test-channel", "test-chat-id")
 	args := map[string]interface{}{
 		"content": "Hello, world!",
 	}
@@ -60,7 +59,6 @@ func TestMessageTool_Execute_Success(t *testing.T) {
 
 func TestMessageTool_Execute_WithCustomChannel(t *testing.T) {
 	tool := NewMessageTool()
-	tool.SetContext("default-channel", "default-chat-id")
 
 	var sentChannel, sentChatID string
 	tool.SetSendCallback(func(channel, chatID, content string) error {
@@ -69,7 +67,7 @@ func TestMessageTool_Execute_WithCustomChannel(t *testing.T) {
 		return nil
 	})
 
-	ctx := context.Background()
+	ctx := NewToolContext(context.Background(), "default-channel", "default-chat-id")
 	args := map[string]interface{}{
 		"content": "Test message",
 		"channel": "custom-channel",
@@ -96,14 +94,13 @@ func TestMessageTool_Execute_WithCustomChannel(t *testing.T) {
 
 func TestMessageTool_Execute_SendFailure(t *testing.T) {
 	tool := NewMessageTool()
-	tool.SetContext("test-channel", "test-chat-id")
 
 	sendErr := errors.New("network error")
 	tool.SetSendCallback(func(channel, chatID, content string) error {
 		return sendErr
 	})
 
-	ctx := context.Background()
+	ctx := NewToolContext(context.Background(), "test-channel", "test-chat-id")
 	args := map[string]interface{}{
 		"content": "Test message",
 	}
@@ -133,9 +130,8 @@ func TestMessageTool_Execute_SendFailure(t *testing.T) {
 
 func TestMessageTool_Execute_MissingContent(t *testing.T) {
 	tool := NewMessageTool()
-	tool.SetContext("test-channel", "test-chat-id")
 
-	ctx := context.Background()
+	ctx := NewToolContext(context.Background(), "test-channel", "test-chat-id")
 	args := map[string]interface{}{} // content missing
 
 	result := tool.Execute(ctx, args)
@@ -151,7 +147,7 @@ func TestMessageTool_Execute_MissingContent(t *testing.T) {
 
 func TestMessageTool_Execute_NoTargetChannel(t *testing.T) {
 	tool := NewMessageTool()
-	// No SetContext called, so defaultChannel and defaultChatID are empty
+	// Not called through a registry, so there is no chat being answered
 
 	tool.SetSendCallback(func(channel, chatID, content string) error {
 		return nil
@@ -175,10 +171,9 @@ func TestMessageTool_Execute_NoTargetChannel(t *testing.T) {
 
 func TestMessageTool_Execute_NotConfigured(t *testing.T) {
 	tool := NewMessageTool()
-	tool.SetContext("test-channel", "test-chat-id")
 	// No SetSendCallback called
 
-	ctx := context.Background()
+	ctx := NewToolContext(context.Background(), "test-channel", "test-chat-id")
 	args := map[string]interface{}{
 		"content": "Test message",
 	}
@@ -257,3 +252,23 @@ func TestMessageTool_Parameters(t *testing.T) {
 		t.Error("Expected chat_id type to be 'string'")
 	}
 }
+
+func TestMessageTool_RoundsKeptApart(t *testing.T) {
+	tool := NewMessageTool()
+	var sent []string
+	tool.SetSendCallback(func(channel, chatID, content string) error {
+		sent = append(sent, channel+":"+chatID)
+		return nil
+	})
+
+	first := WithMessageRound(context.Background())
+	second := WithMessageRound(context.Background())
+	tool.Execute(NewToolContext(first, "telegram", "1001"), map[string]interface{}{"content": "Your CT report is ready."})
+
+	if !MessageSentInRound(first) || MessageSentInRound(second) {
+		t.Errorf("sent in first = %v, second = %v, want only the first", MessageSentInRound(first), MessageSentInRound(second))
+	}
+	if len(sent) != 1 || sent[0] != "telegram:1001" {
+		t.Errorf("sent = %q", sent)
+	}
+}
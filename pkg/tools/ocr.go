@@ -0,0 +1,83 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/ocr"
+)
+
+// OCRImageTool reads the text in an image file in the workspace.
+type OCRImageTool struct {
+	recognizer ocr.Recognizer
+	workspace  string
+	restrict   bool
+	policy     *PathPolicy
+}
+
+func NewOCRImageTool(recognizer ocr.Recognizer, workspace string, restrict bool) *OCRImageTool {
+	return &OCRImageTool{recognizer: recognizer, workspace: workspace, restrict: restrict}
+}
+
+// SetPathPolicy applies p's limits; nil removes them.
+func (t *OCRImageTool) SetPathPolicy(p *PathPolicy) {
+	t.policy = p
+}
+
+func (t *OCRImageTool) Name() string {
+	return "ocr_image"
+}
+
+func (t *OCRImageTool) Description() string {
+	return "Read the text in a photo or scan in the workspace, such as a lab report, prescription or discharge letter. " +
+		"Returns the text one line per row, with table cells joined on the line. " +
+		"Photos sent in chat are already read; use this for saved images. " +
+		"Pass lab report text to lab_report_parse and other clinical text to knows_auto_tagging. OCR can misread digits, so check doubtful values with the user."
+}
+
+func (t *OCRImageTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"path": map[string]interface{}{
+				"type":        "string",
+				"description": "Path to the image file (JPEG, PNG, BMP or WebP)",
+			},
+		},
+		"required": []string{"path"},
+	}
+}
+
+type ocrImageArgs struct {
+	Path string `json:"path" arg:"required"`
+}
+
+func (t *OCRImageTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	a, err := BindArgs[ocrImageArgs](args)
+	if err != nil {
+		return ErrorResult(err.Error()).WithError(err)
+	}
+	path, err := t.policy.resolve(ctx, a.Path, t.workspace, t.restrict, true)
+	if err != nil {
+		return ErrorResult(err.Error()).WithError(ClassifyError(ErrInvalidArgs, err))
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("image not found: %s", a.Path)).WithError(ClassifyError(ErrInvalidArgs, err))
+	}
+	if err := t.policy.checkSize(info.Size()); err != nil {
+		return ErrorResult(err.Error()).WithError(ClassifyError(ErrInvalidArgs, err))
+	}
+
+	text, err := t.recognizer.Recognize(ctx, path)
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("text recognition failed: %v", err)).WithError(ClassifyError(ErrRetryable, err))
+	}
+	if strings.TrimSpace(text) == "" {
+		return ErrorResult("no text found in the image").
+			WithError(ClassifyError(ErrNotFound, fmt.Errorf("no text found")))
+	}
+	return NewToolResult(text)
+}
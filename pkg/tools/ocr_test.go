@@ -0,0 +1,54 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type stubRecognizer struct {
+	text string
+	err  error
+}
+
+func (r *stubRecognizer) Recognize(ctx context.Context, imagePath string) (string, error) {
+	return r.text, r.err
+}
+
+func TestOCRImageTool(t *testing.T) {
+	workspace := t.TempDir()
+	if err := os.WriteFile(filepath.Join(workspace, "report.png"), []byte("png"), 0600); err != nil {
+		t.Fatalf("write image: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		recognizer *stubRecognizer
+		path       string
+		wantKind   error
+		wantText   string
+	}{
+		{name: "recognized", recognizer: &stubRecognizer{text: "CA19-9  125.3  U/mL  0-37"}, path: "report.png", wantText: "CA19-9  125.3  U/mL  0-37"},
+		{name: "missing file", recognizer: &stubRecognizer{text: "x"}, path: "missing.png", wantKind: ErrInvalidArgs},
+		{name: "outside workspace", recognizer: &stubRecognizer{text: "x"}, path: "../secret.png", wantKind: ErrInvalidArgs},
+		{name: "backend down", recognizer: &stubRecognizer{err: errors.New("connection refused")}, path: "report.png", wantKind: ErrRetryable},
+		{name: "no text", recognizer: &stubRecognizer{text: "  "}, path: "report.png", wantKind: ErrNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tool := NewOCRImageTool(tt.recognizer, workspace, true)
+			result := tool.Execute(context.Background(), map[string]interface{}{"path": tt.path})
+			if tt.wantKind != nil {
+				if !errors.Is(result.Err, tt.wantKind) {
+					t.Fatalf("Err = %v, want %v", result.Err, tt.wantKind)
+				}
+				return
+			}
+			if result.IsError || result.ForLLM != tt.wantText {
+				t.Errorf("result = %+v, want text %q", result, tt.wantText)
+			}
+		})
+	}
+}
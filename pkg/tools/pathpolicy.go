@@ -0,0 +1,117 @@
+package tools
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+// PathPolicy adds limits to the file tools on top of restrict_to_workspace:
+// a separate root directory per session, a maximum file size, and the file
+// extensions that may be touched.
+type PathPolicy struct {
+	// SessionRoots jails each session in its own directory under
+	// <workspace>/files, so one chat cannot see another's files.
+	SessionRoots bool
+	// MaxFileBytes is the largest file that may be read or written; 0 means
+	// no limit.
+	MaxFileBytes int64
+	// AllowedExtensions are lower-case extensions including the dot, such
+	// as ".pdf". Empty allows any.
+	AllowedExtensions []string
+}
+
+// NewPathPolicy builds the policy described by cfg, or returns nil if cfg
+// sets no limits.
+func NewPathPolicy(cfg config.FileToolsConfig) *PathPolicy {
+	if !cfg.SessionWorkspaces && cfg.MaxFileKB <= 0 && len(cfg.AllowedExtensions) == 0 {
+		return nil
+	}
+	p := &PathPolicy{
+		SessionRoots: cfg.SessionWorkspaces,
+		MaxFileBytes: int64(cfg.MaxFileKB) * 1024,
+	}
+	for _, ext := range cfg.AllowedExtensions {
+		ext = strings.ToLower(strings.TrimSpace(ext))
+		if ext != "" && !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		p.AllowedExtensions = append(p.AllowedExtensions, ext)
+	}
+	return p
+}
+
+var unsafeNameChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// SessionDirName turns a session key into a directory name that is safe
+// whatever the key holds. The hash keeps keys that differ only in
+// punctuation apart.
+func SessionDirName(sessionKey string) string {
+	if sessionKey == "" {
+		sessionKey = "default"
+	}
+	sum := sha256.Sum256([]byte(sessionKey))
+	name := strings.Trim(unsafeNameChars.ReplaceAllString(sessionKey, "_"), "._")
+	if len(name) > 64 {
+		name = name[:64]
+	}
+	return name + "-" + hex.EncodeToString(sum[:4])
+}
+
+// SessionRoot returns the directory the session's files are kept in, or ""
+// when p does not give sessions roots of their own.
+func (p *PathPolicy) SessionRoot(workspace, sessionKey string) string {
+	if p == nil || !p.SessionRoots || workspace == "" {
+		return ""
+	}
+	return filepath.Join(workspace, "files", SessionDirName(sessionKey))
+}
+
+// resolve validates path like validatePath, within the session's root when
+// SessionRoots is set. file is false for directories, which have no
+// extension to check.
+func (p *PathPolicy) resolve(ctx context.Context, path, workspace string, restrict, file bool) (string, error) {
+	if p == nil {
+		return validatePath(path, workspace, restrict)
+	}
+	if root := p.SessionRoot(workspace, CallMetadataFromContext(ctx).SessionKey); root != "" {
+		workspace = root
+		if err := os.MkdirAll(workspace, 0755); err != nil {
+			return "", fmt.Errorf("failed to create session workspace: %w", err)
+		}
+		restrict = true
+	}
+	resolved, err := validatePath(path, workspace, restrict)
+	if err != nil {
+		return "", err
+	}
+	if file && len(p.AllowedExtensions) > 0 {
+		ext := strings.ToLower(filepath.Ext(resolved))
+		allowed := false
+		for _, a := range p.AllowedExtensions {
+			if ext == a {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return "", fmt.Errorf("access denied: %q files are not allowed (allowed: %s)", ext, strings.Join(p.AllowedExtensions, ", "))
+		}
+	}
+	return resolved, nil
+}
+
+// checkSize reports an error if a file of size bytes is over the limit.
+func (p *PathPolicy) checkSize(size int64) error {
+	if p == nil || p.MaxFileBytes <= 0 || size <= p.MaxFileBytes {
+		return nil
+	}
+	return fmt.Errorf("file too large: %d bytes, the limit is %d bytes", size, p.MaxFileBytes)
+}
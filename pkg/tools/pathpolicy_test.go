@@ -0,0 +1,146 @@
+package tools
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func sessionContext(key string) context.Context {
+	return WithCallMetadata(context.Background(), CallMetadata{SessionKey: key})
+}
+
+func TestPathPolicy_SessionRoots(t *testing.T) {
+	workspace := t.TempDir()
+	policy := NewPathPolicy(config.FileToolsConfig{SessionWorkspaces: true})
+	write := NewWriteFileTool(workspace, false)
+	write.SetPathPolicy(policy)
+	read := NewReadFileTool(workspace, false)
+	read.SetPathPolicy(policy)
+	list := NewListDirTool(workspace, false)
+	list.SetPathPolicy(policy)
+
+	alice := sessionContext("agent:main:telegram:dm:1001")
+	bob := sessionContext("agent:main:telegram:dm:1002")
+	if r := write.Execute(alice, map[string]interface{}{"path": "labs/ca19-9.txt", "content": "35 U/mL"}); r.IsError {
+		t.Fatalf("write failed: %s", r.ForLLM)
+	}
+
+	if r := read.Execute(alice, map[string]interface{}{"path": "labs/ca19-9.txt"}); r.IsError || r.ForLLM != "35 U/mL" {
+		t.Errorf("owner read = %+v", r)
+	}
+	if r := read.Execute(bob, map[string]interface{}{"path": "labs/ca19-9.txt"}); !r.IsError {
+		t.Errorf("another session read the file: %s", r.ForLLM)
+	}
+	if r := list.Execute(bob, map[string]interface{}{"path": "."}); r.IsError || r.ForLLM != "" {
+		t.Errorf("another session's listing = %+v", r)
+	}
+	// Session roots imply restriction, even without restrict_to_workspace.
+	for _, path := range []string{"../..", filepath.Join(workspace, "config.json")} {
+		if r := read.Execute(alice, map[string]interface{}{"path": path}); !r.IsError || !strings.Contains(r.ForLLM, "access denied") {
+			t.Errorf("read %s = %+v", path, r)
+		}
+	}
+}
+
+func TestPathPolicy_OtherReadingTools(t *testing.T) {
+	workspace := t.TempDir()
+	policy := NewPathPolicy(config.FileToolsConfig{SessionWorkspaces: true})
+	write := NewWriteFileTool(workspace, false)
+	write.SetPathPolicy(policy)
+	spreadsheet := NewSpreadsheetTool(workspace, false)
+	spreadsheet.SetPathPolicy(policy)
+	exec := NewExecTool(workspace, false)
+	exec.SetPathPolicy(policy)
+
+	alice := sessionContext("agent:main:telegram:dm:1001")
+	bob := sessionContext("agent:main:telegram:dm:1002")
+	if r := write.Execute(alice, map[string]interface{}{"path": "labs.csv", "content": "date,ca19_9\n2026-03-01,35\n"}); r.IsError {
+		t.Fatalf("write failed: %s", r.ForLLM)
+	}
+
+	if r := spreadsheet.Execute(alice, map[string]interface{}{"path": "labs.csv"}); r.IsError {
+		t.Errorf("owner spreadsheet = %s", r.ForLLM)
+	}
+	if r := spreadsheet.Execute(bob, map[string]interface{}{"path": "labs.csv"}); !r.IsError {
+		t.Errorf("another session read the spreadsheet: %s", r.ForLLM)
+	}
+
+	// Commands run in the session's root and cannot leave it
+	if r := exec.Execute(alice, map[string]interface{}{"command": "ls"}); r.IsError || !strings.Contains(r.ForLLM, "labs.csv") {
+		t.Errorf("owner ls = %+v", r)
+	}
+	if r := exec.Execute(bob, map[string]interface{}{"command": "ls"}); r.IsError || strings.Contains(r.ForLLM, "labs.csv") {
+		t.Errorf("another session's ls = %+v", r)
+	}
+	if r := exec.Execute(bob, map[string]interface{}{"command": "ls", "working_dir": workspace}); !r.IsError {
+		t.Errorf("working_dir outside the session root = %+v", r)
+	}
+	if r := exec.Execute(bob, map[string]interface{}{"command": "cat " + filepath.Join(workspace, "files", "x")}); !r.IsError {
+		t.Errorf("path outside the session root = %+v", r)
+	}
+}
+
+func TestPathPolicy_SymlinkEscape(t *testing.T) {
+	workspace := t.TempDir()
+	outside := t.TempDir()
+	os.WriteFile(filepath.Join(outside, "secret.txt"), []byte("secret"), 0644)
+
+	policy := NewPathPolicy(config.FileToolsConfig{SessionWorkspaces: true})
+	read := NewReadFileTool(workspace, false)
+	read.SetPathPolicy(policy)
+	ctx := sessionContext("cli:default")
+	root := filepath.Join(workspace, "files", SessionDirName("cli:default"))
+	os.MkdirAll(root, 0755)
+	os.Symlink(filepath.Join(outside, "secret.txt"), filepath.Join(root, "link.txt"))
+
+	if r := read.Execute(ctx, map[string]interface{}{"path": "link.txt"}); !r.IsError || !strings.Contains(r.ForLLM, "symlink") {
+		t.Errorf("symlink escape = %+v", r)
+	}
+}
+
+func TestPathPolicy_SizeAndExtensions(t *testing.T) {
+	workspace := t.TempDir()
+	policy := NewPathPolicy(config.FileToolsConfig{MaxFileKB: 1, AllowedExtensions: []string{"txt", ".MD"}})
+	write := NewWriteFileTool(workspace, true)
+	write.SetPathPolicy(policy)
+	appendTool := NewAppendFileTool(workspace, true)
+	appendTool.SetPathPolicy(policy)
+	read := NewReadFileTool(workspace, true)
+	read.SetPathPolicy(policy)
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+		tool Tool
+		args map[string]interface{}
+		want string
+	}{
+		{"allowed", write, map[string]interface{}{"path": "notes.md", "content": "ok"}, ""},
+		{"extension", write, map[string]interface{}{"path": "run.sh", "content": "ok"}, `".sh" files are not allowed`},
+		{"write too large", write, map[string]interface{}{"path": "big.txt", "content": strings.Repeat("x", 1025)}, "file too large"},
+		{"append over limit", appendTool, map[string]interface{}{"path": "notes.md", "content": strings.Repeat("x", 1023)}, "file too large"},
+		{"append within limit", appendTool, map[string]interface{}{"path": "notes.md", "content": "!"}, ""},
+	}
+	for _, tt := range tests {
+		r := tt.tool.Execute(ctx, tt.args)
+		if tt.want == "" && r.IsError || tt.want != "" && !strings.Contains(r.ForLLM, tt.want) {
+			t.Errorf("%s: got %+v, want %q", tt.name, r, tt.want)
+		}
+	}
+
+	os.WriteFile(filepath.Join(workspace, "report.txt"), []byte(strings.Repeat("x", 2048)), 0644)
+	if r := read.Execute(ctx, map[string]interface{}{"path": "report.txt"}); !r.IsError || !strings.Contains(r.ForLLM, "file too large") {
+		t.Errorf("reading a large file = %+v", r)
+	}
+}
+
+func TestNewPathPolicy_NoLimits(t *testing.T) {
+	if p := NewPathPolicy(config.FileToolsConfig{}); p != nil {
+		t.Errorf("expected no policy, got %+v", p)
+	}
+}
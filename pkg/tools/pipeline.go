@@ -0,0 +1,258 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+// PipelineTool runs a fixed sequence of other tools as one tool call, so a
+// well-known workflow such as search → answer → evidence details costs the
+// model one round trip instead of several.
+//
+// Step arguments are text/template strings rendered against the pipeline's
+// arguments (.args) and the results of earlier steps (.steps.<id>.text for
+// the text the model would have seen, .steps.<id>.json for the same text
+// decoded as JSON). A rendered value that is a JSON array or object is
+// decoded, so steps can pass structured arguments on. Steps run through
+// the registry, so approvals, quotas, caching and the audit log apply to
+// each of them.
+type PipelineTool struct {
+	name        string
+	description string
+	parameters  map[string]interface{}
+	steps       []pipelineStep
+	output      *template.Template
+	registry    *ToolRegistry
+}
+
+type pipelineStep struct {
+	id   string
+	tool string
+	args interface{} // args with every string replaced by its template
+}
+
+var pipelineFuncs = template.FuncMap{
+	// json renders a value as JSON.
+	"json": func(v interface{}) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+	// take returns the first n items of a list.
+	"take": func(n int, list []interface{}) []interface{} {
+		if n < len(list) {
+			return list[:n]
+		}
+		return list
+	},
+	// pluck returns the given field of each object in a list.
+	"pluck": func(field string, list []interface{}) []interface{} {
+		out := make([]interface{}, 0, len(list))
+		for _, item := range list {
+			if obj, ok := item.(map[string]interface{}); ok {
+				out = append(out, obj[field])
+			}
+		}
+		return out
+	},
+	// join joins the items of a list with sep.
+	"join": func(sep string, list []interface{}) string {
+		parts := make([]string, len(list))
+		for i, item := range list {
+			parts[i] = fmt.Sprint(item)
+		}
+		return strings.Join(parts, sep)
+	},
+}
+
+// NewPipelineTool builds the pipeline described by cfg, running its steps
+// through registry.
+func NewPipelineTool(name string, cfg config.PipelineConfig, registry *ToolRegistry) (*PipelineTool, error) {
+	t := &PipelineTool{
+		name:        name,
+		description: cfg.Description,
+		parameters:  cfg.Parameters,
+		registry:    registry,
+	}
+	if t.parameters == nil {
+		t.parameters = map[string]interface{}{"type": "object", "properties": map[string]interface{}{}}
+	}
+	for i, step := range cfg.Steps {
+		args, err := parsePipelineArgs(fmt.Sprintf("%s.steps[%d]", name, i), step.Args)
+		if err != nil {
+			return nil, err
+		}
+		t.steps = append(t.steps, pipelineStep{id: step.ID, tool: step.Tool, args: args})
+	}
+	if cfg.Output != "" {
+		tmpl, err := template.New(name + ".output").Funcs(pipelineFuncs).Option("missingkey=zero").Parse(cfg.Output)
+		if err != nil {
+			return nil, err
+		}
+		t.output = tmpl
+	}
+	return t, nil
+}
+
+// parsePipelineArgs replaces every string in v with its parsed template.
+func parsePipelineArgs(name string, v interface{}) (interface{}, error) {
+	switch x := v.(type) {
+	case string:
+		return template.New(name).Funcs(pipelineFuncs).Option("missingkey=zero").Parse(x)
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(x))
+		for key, value := range x {
+			parsed, err := parsePipelineArgs(name+"."+key, value)
+			if err != nil {
+				return nil, err
+			}
+			out[key] = parsed
+		}
+		return out, nil
+	case []interface{}:
+		out := make([]interface{}, len(x))
+		for i, value := range x {
+			parsed, err := parsePipelineArgs(fmt.Sprintf("%s[%d]", name, i), value)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = parsed
+		}
+		return out, nil
+	}
+	return v, nil
+}
+
+// renderPipelineArgs renders the templates in v against data.
+func renderPipelineArgs(v interface{}, data map[string]interface{}) (interface{}, error) {
+	switch x := v.(type) {
+	case *template.Template:
+		var buf bytes.Buffer
+		if err := x.Execute(&buf, data); err != nil {
+			return nil, err
+		}
+		text := strings.TrimSpace(buf.String())
+		if strings.HasPrefix(text, "[") || strings.HasPrefix(text, "{") {
+			var decoded interface{}
+			if json.Unmarshal([]byte(text), &decoded) == nil {
+				return decoded, nil
+			}
+		}
+		return buf.String(), nil
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(x))
+		for key, value := range x {
+			rendered, err := renderPipelineArgs(value, data)
+			if err != nil {
+				return nil, err
+			}
+			out[key] = rendered
+		}
+		return out, nil
+	case []interface{}:
+		out := make([]interface{}, len(x))
+		for i, value := range x {
+			rendered, err := renderPipelineArgs(value, data)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = rendered
+		}
+		return out, nil
+	}
+	return v, nil
+}
+
+func (t *PipelineTool) Name() string {
+	return t.name
+}
+
+func (t *PipelineTool) Description() string {
+	return t.description
+}
+
+func (t *PipelineTool) Parameters() map[string]interface{} {
+	return t.parameters
+}
+
+// Tools returns the names of the tools the pipeline calls, in order.
+func (t *PipelineTool) Tools() []string {
+	names := make([]string, len(t.steps))
+	for i, step := range t.steps {
+		names[i] = step.tool
+	}
+	return names
+}
+
+func (t *PipelineTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	tc := ToolContextFrom(ctx)
+
+	// Declared parameters the model left out render as empty strings
+	// rather than "<no value>".
+	input := make(map[string]interface{}, len(args))
+	if props, ok := t.parameters["properties"].(map[string]interface{}); ok {
+		for name := range props {
+			input[name] = ""
+		}
+	}
+	for name, value := range args {
+		input[name] = value
+	}
+	steps := make(map[string]interface{}, len(t.steps))
+	data := map[string]interface{}{"args": input, "steps": steps}
+
+	var last *ToolResult
+	for i, step := range t.steps {
+		rendered, err := renderPipelineArgs(step.args, data)
+		if err != nil {
+			return ErrorResult(fmt.Sprintf("%s step %d (%s): %v", t.name, i+1, step.tool, err))
+		}
+		stepArgs, _ := rendered.(map[string]interface{})
+
+		last = t.registry.ExecuteWithContext(inForeground(tc), step.tool, stepArgs, tc.Channel, tc.ChatID, nil)
+		if last.IsError {
+			failed := ErrorResult(fmt.Sprintf("%s step %d (%s) failed: %s", t.name, i+1, step.tool, last.ForLLM))
+			failed.Err = last.Err
+			return failed
+		}
+		if last.Async {
+			return ErrorResult(fmt.Sprintf("%s step %d (%s) started background work, which pipelines cannot wait for", t.name, i+1, step.tool))
+		}
+
+		result := map[string]interface{}{"text": last.ForLLM}
+		var decoded interface{}
+		if json.Unmarshal([]byte(last.ForLLM), &decoded) == nil {
+			result["json"] = decoded
+		}
+		if step.id != "" {
+			steps[step.id] = result
+		}
+	}
+
+	if t.output == nil {
+		return last
+	}
+	var buf bytes.Buffer
+	if err := t.output.Execute(&buf, data); err != nil {
+		return ErrorResult(fmt.Sprintf("%s output: %v", t.name, err))
+	}
+	return NewToolResult(buf.String())
+}
+
+type foregroundKey struct{}
+
+// inForeground marks calls that must not become background jobs, because
+// the caller needs their result.
+func inForeground(ctx context.Context) context.Context {
+	return context.WithValue(ctx, foregroundKey{}, true)
+}
+
+func mustRunInForeground(ctx context.Context) bool {
+	foreground, _ := ctx.Value(foregroundKey{}).(bool)
+	return foreground
+}
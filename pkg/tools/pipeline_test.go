@@ -0,0 +1,128 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+// argsRecordingTool returns a fixed result and remembers its arguments.
+type argsRecordingTool struct {
+	stubTool
+	args []map[string]interface{}
+}
+
+func (t *argsRecordingTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	t.args = append(t.args, args)
+	return t.stubTool.Execute(ctx, args)
+}
+
+func TestPipelineTool_ChainsSteps(t *testing.T) {
+	registry := NewToolRegistry()
+	search := &argsRecordingTool{stubTool: stubTool{name: "search",
+		result: NewToolResult(`{"question_id":"q1","evidences":[{"id":"e1"},{"id":"e2"},{"id":"e3"}]}`)}}
+	details := &argsRecordingTool{stubTool: stubTool{name: "details",
+		result: NewToolResult(`[{"title":"A"},{"title":"B"}]`)}}
+	registry.Register(search)
+	registry.Register(details)
+
+	pipeline, err := NewPipelineTool("research", config.PipelineConfig{
+		Description: "search then fetch details",
+		Parameters: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"question": map[string]interface{}{"type": "string"},
+				"filter":   map[string]interface{}{"type": "string"},
+			},
+		},
+		Steps: []config.PipelineStepConfig{
+			{ID: "search", Tool: "search", Args: map[string]interface{}{
+				"question": "{{.args.question}}",
+				"filter":   "[{{.args.filter}}]",
+			}},
+			{ID: "details", Tool: "details", Args: map[string]interface{}{
+				"question_id": "{{.steps.search.json.question_id}}",
+				"ids":         "{{take 2 .steps.search.json.evidences | pluck \"id\" | json}}",
+			}},
+		},
+		Output: "{{range .steps.details.json}}- {{.title}}\n{{end}}",
+	}, registry)
+	if err != nil {
+		t.Fatalf("NewPipelineTool: %v", err)
+	}
+	if got := strings.Join(pipeline.Tools(), ","); got != "search,details" {
+		t.Errorf("Tools() = %q", got)
+	}
+	registry.Register(pipeline)
+
+	result := registry.ExecuteWithContext(context.Background(), "research",
+		map[string]interface{}{"question": "KRAS G12C"}, "cli", "direct", nil)
+	if result.IsError {
+		t.Fatalf("pipeline failed: %s", result.ForLLM)
+	}
+	if result.ForLLM != "- A\n- B\n" {
+		t.Errorf("output = %q", result.ForLLM)
+	}
+
+	if len(search.args) != 1 || search.args[0]["question"] != "KRAS G12C" {
+		t.Fatalf("search args = %v", search.args)
+	}
+	// The missing filter renders as "", leaving an empty JSON list.
+	if filter, ok := search.args[0]["filter"].([]interface{}); !ok || len(filter) != 0 {
+		t.Errorf("filter = %#v, want an empty list", search.args[0]["filter"])
+	}
+	if len(details.args) != 1 || details.args[0]["question_id"] != "q1" {
+		t.Fatalf("details args = %v", details.args)
+	}
+	ids, _ := details.args[0]["ids"].([]interface{})
+	if len(ids) != 2 || ids[0] != "e1" || ids[1] != "e2" {
+		t.Errorf("ids = %#v", details.args[0]["ids"])
+	}
+}
+
+func TestPipelineTool_StopsAtFailedStep(t *testing.T) {
+	registry := NewToolRegistry()
+	failed := ErrorResult("upstream unavailable")
+	failed.Err = ClassifyError(ErrRetryable, errors.New("503"))
+	failing := &stubTool{name: "search", result: failed}
+	next := &stubTool{name: "details"}
+	registry.Register(failing)
+	registry.Register(next)
+
+	pipeline, err := NewPipelineTool("research", config.PipelineConfig{
+		Description: "search then fetch details",
+		Steps: []config.PipelineStepConfig{
+			{ID: "search", Tool: "search"},
+			{Tool: "details"},
+		},
+	}, registry)
+	if err != nil {
+		t.Fatalf("NewPipelineTool: %v", err)
+	}
+
+	result := pipeline.Execute(context.Background(), nil)
+	if !result.IsError || !strings.Contains(result.ForLLM, "step 1 (search) failed: upstream unavailable") {
+		t.Fatalf("result = %+v", result)
+	}
+	if !errors.Is(result.Err, ErrRetryable) {
+		t.Errorf("Err = %v, want the step's error", result.Err)
+	}
+	if next.calls != 0 {
+		t.Errorf("the step after the failure ran %d times", next.calls)
+	}
+}
+
+func TestNewPipelineTool_BadTemplate(t *testing.T) {
+	_, err := NewPipelineTool("broken", config.PipelineConfig{
+		Description: "broken",
+		Steps: []config.PipelineStepConfig{
+			{Tool: "search", Args: map[string]interface{}{"q": "{{.args.q"}},
+		},
+	}, NewToolRegistry())
+	if err == nil {
+		t.Fatal("expected a template parse error")
+	}
+}
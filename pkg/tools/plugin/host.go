@@ -0,0 +1,347 @@
+// Package plugin runs external executables as picoclaw tools.
+//
+// A plugin is any program that reads JSON-RPC 2.0 requests from stdin and
+// writes responses to stdout, one JSON object per line. It must implement
+// two methods:
+//
+//	describe -> {"tools": [{"name": ..., "description": ..., "parameters": {JSON schema}}]}
+//	execute  {"tool": name, "arguments": {...}}
+//	         -> {"content": "text for the model", "for_user": "...", "is_error": false}
+//
+// Anything the plugin writes to stderr is logged. A plugin that exits or
+// stops responding is restarted on the next call.
+package plugin
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+const (
+	defaultTimeout = 60 * time.Second
+	maxMessageSize = 16 * 1024 * 1024
+)
+
+// ErrClosed is returned by calls on a closed host.
+var ErrClosed = errors.New("plugin host closed")
+
+// Config describes one plugin executable.
+type Config struct {
+	Name    string
+	Command string
+	Args    []string
+	Env     map[string]string
+	// Dir is the working directory; defaults to the current one.
+	Dir string
+	// Timeout bounds startup and each call; defaults to 60 seconds.
+	Timeout time.Duration
+}
+
+// ToolSpec is a tool as described by a plugin.
+type ToolSpec struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description"`
+	Parameters  map[string]interface{} `json:"parameters"`
+}
+
+// Result is the reply to an execute call.
+type Result struct {
+	Content string `json:"content"`
+	ForUser string `json:"for_user,omitempty"`
+	IsError bool   `json:"is_error,omitempty"`
+}
+
+// codeInvalidParams is the JSON-RPC code for rejected parameters.
+const codeInvalidParams = -32602
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *rpcError) Error() string {
+	return fmt.Sprintf("plugin error %d: %s", e.Code, e.Message)
+}
+
+type rpcMessage struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  interface{}     `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+// Host owns one plugin process and restarts it when it dies.
+type Host struct {
+	cfg     Config
+	timeout time.Duration
+
+	mu     sync.Mutex
+	proc   *process
+	closed bool
+}
+
+// Start launches the plugin and asks it to describe its tools.
+func Start(ctx context.Context, cfg Config) (*Host, []ToolSpec, error) {
+	if cfg.Command == "" {
+		return nil, nil, fmt.Errorf("plugin %q: command is required", cfg.Name)
+	}
+	h := &Host{cfg: cfg, timeout: cfg.Timeout}
+	if h.timeout <= 0 {
+		h.timeout = defaultTimeout
+	}
+
+	var described struct {
+		Tools []ToolSpec `json:"tools"`
+	}
+	if err := h.call(ctx, "describe", nil, &described); err != nil {
+		h.Close()
+		return nil, nil, fmt.Errorf("plugin %q: describe: %w", cfg.Name, err)
+	}
+	return h, described.Tools, nil
+}
+
+// Name returns the configured plugin name.
+func (h *Host) Name() string {
+	return h.cfg.Name
+}
+
+// Execute runs one of the plugin's tools.
+func (h *Host) Execute(ctx context.Context, tool string, args map[string]interface{}) (*Result, error) {
+	if args == nil {
+		args = map[string]interface{}{}
+	}
+	var result Result
+	if err := h.call(ctx, "execute", map[string]interface{}{
+		"tool":      tool,
+		"arguments": args,
+	}, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Close stops the plugin process.
+func (h *Host) Close() {
+	h.mu.Lock()
+	proc := h.proc
+	h.proc = nil
+	h.closed = true
+	h.mu.Unlock()
+	if proc != nil {
+		proc.stop()
+	}
+}
+
+// running returns the live process, starting a new one if needed.
+func (h *Host) running() (*process, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return nil, ErrClosed
+	}
+	if h.proc != nil && !h.proc.exited() {
+		return h.proc, nil
+	}
+	if h.proc != nil {
+		logger.WarnCF("plugin", "Plugin exited, restarting",
+			map[string]interface{}{"plugin": h.cfg.Name})
+		h.proc.stop()
+	}
+	proc, err := startProcess(h.cfg)
+	if err != nil {
+		return nil, err
+	}
+	h.proc = proc
+	return proc, nil
+}
+
+func (h *Host) call(ctx context.Context, method string, params, result interface{}) error {
+	proc, err := h.running()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+	err = proc.call(ctx, method, params, result)
+	if errors.Is(err, context.DeadlineExceeded) {
+		// A plugin that misses its deadline may be wedged; replace it.
+		logger.WarnCF("plugin", "Plugin call timed out, stopping process",
+			map[string]interface{}{
+				"plugin": h.cfg.Name,
+				"method": method,
+			})
+		h.mu.Lock()
+		if h.proc == proc {
+			h.proc = nil
+		}
+		h.mu.Unlock()
+		proc.stop()
+	}
+	return err
+}
+
+// process is one running plugin executable.
+type process struct {
+	name    string
+	cmd     *exec.Cmd
+	stdin   io.WriteCloser
+	writeMu sync.Mutex
+	nextID  atomic.Int64
+	mu      sync.Mutex
+	pending map[string]chan rpcMessage
+	done    chan struct{}
+	once    sync.Once
+}
+
+func startProcess(cfg Config) (*process, error) {
+	cmd := exec.Command(cfg.Command, cfg.Args...)
+	cmd.Dir = cfg.Dir
+	cmd.Env = os.Environ()
+	for k, v := range cfg.Env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start %s: %w", cfg.Command, err)
+	}
+
+	p := &process{
+		name:    cfg.Name,
+		cmd:     cmd,
+		stdin:   stdin,
+		pending: make(map[string]chan rpcMessage),
+		done:    make(chan struct{}),
+	}
+	go p.readLoop(stdout)
+	go func() {
+		scanner := bufio.NewScanner(stderr)
+		for scanner.Scan() {
+			logger.DebugCF("plugin", "Plugin stderr",
+				map[string]interface{}{
+					"plugin": cfg.Name,
+					"line":   scanner.Text(),
+				})
+		}
+	}()
+	return p, nil
+}
+
+func (p *process) readLoop(stdout io.Reader) {
+	defer close(p.done)
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxMessageSize)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var msg rpcMessage
+		if err := json.Unmarshal(line, &msg); err != nil || len(msg.ID) == 0 {
+			logger.DebugCF("plugin", "Ignoring plugin output",
+				map[string]interface{}{
+					"plugin": p.name,
+					"line":   string(line),
+				})
+			continue
+		}
+		p.mu.Lock()
+		reply, ok := p.pending[string(msg.ID)]
+		p.mu.Unlock()
+		if ok {
+			reply <- msg
+		}
+	}
+}
+
+func (p *process) exited() bool {
+	select {
+	case <-p.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (p *process) call(ctx context.Context, method string, params, result interface{}) error {
+	id := strconv.FormatInt(p.nextID.Add(1), 10)
+	reply := make(chan rpcMessage, 1)
+	p.mu.Lock()
+	p.pending[id] = reply
+	p.mu.Unlock()
+	defer func() {
+		p.mu.Lock()
+		delete(p.pending, id)
+		p.mu.Unlock()
+	}()
+
+	data, err := json.Marshal(rpcMessage{JSONRPC: "2.0", ID: json.RawMessage(id), Method: method, Params: params})
+	if err != nil {
+		return err
+	}
+	p.writeMu.Lock()
+	_, err = p.stdin.Write(append(data, '\n'))
+	p.writeMu.Unlock()
+	if err != nil {
+		return fmt.Errorf("write to plugin %s: %w", p.name, err)
+	}
+
+	select {
+	case msg := <-reply:
+		if msg.Error != nil {
+			return msg.Error
+		}
+		if result == nil || len(msg.Result) == 0 {
+			return nil
+		}
+		return json.Unmarshal(msg.Result, result)
+	case <-p.done:
+		return fmt.Errorf("plugin %s exited", p.name)
+	case <-ctx.Done():
+		return fmt.Errorf("%s: %w", method, ctx.Err())
+	}
+}
+
+func (p *process) stop() {
+	p.once.Do(func() {
+		p.stdin.Close()
+		exited := make(chan struct{})
+		go func() {
+			p.cmd.Wait()
+			close(exited)
+		}()
+		select {
+		case <-exited:
+		case <-time.After(2 * time.Second):
+			p.cmd.Process.Kill()
+			<-exited
+		}
+	})
+}
@@ -0,0 +1,167 @@
+package plugin
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	if os.Getenv("PLUGIN_TEST_PLUGIN") == "1" {
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			if reply := fakePluginReply(scanner.Bytes()); reply != nil {
+				os.Stdout.Write(append(reply, '\n'))
+			}
+		}
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// fakePluginReply answers one request. The plugin offers "echo", "fail",
+// "pid", which reports the process ID, "hang", which never replies, and
+// "crash", which exits.
+func fakePluginReply(data []byte) []byte {
+	var req struct {
+		ID     json.RawMessage `json:"id"`
+		Method string          `json:"method"`
+		Params struct {
+			Tool      string                 `json:"tool"`
+			Arguments map[string]interface{} `json:"arguments"`
+		} `json:"params"`
+	}
+	if err := json.Unmarshal(data, &req); err != nil {
+		return nil
+	}
+
+	var result interface{}
+	switch req.Method {
+	case "describe":
+		var specs []map[string]interface{}
+		for _, name := range []string{"echo", "fail", "pid", "hang", "crash"} {
+			specs = append(specs, map[string]interface{}{"name": name, "description": "Test tool " + name})
+		}
+		result = map[string]interface{}{"tools": specs}
+	case "execute":
+		switch req.Params.Tool {
+		case "echo":
+			text, _ := req.Params.Arguments["text"].(string)
+			result = map[string]interface{}{"content": "echo: " + text, "for_user": text}
+		case "fail":
+			result = map[string]interface{}{"content": "lab value missing", "is_error": true}
+		case "pid":
+			result = map[string]interface{}{"content": strconv.Itoa(os.Getpid())}
+		case "hang":
+			return nil
+		case "crash":
+			os.Exit(1)
+		default:
+			reply, _ := json.Marshal(map[string]interface{}{
+				"jsonrpc": "2.0",
+				"id":      req.ID,
+				"error":   map[string]interface{}{"code": -32602, "message": "unknown tool"},
+			})
+			return reply
+		}
+	}
+	reply, _ := json.Marshal(map[string]interface{}{"jsonrpc": "2.0", "id": req.ID, "result": result})
+	return reply
+}
+
+func startTestPlugin(t *testing.T, timeout time.Duration) (*Manager, map[string]*Tool) {
+	t.Helper()
+	m := NewManager()
+	t.Cleanup(m.Close)
+	loaded := m.Load(context.Background(), []Config{{
+		Name:    "test",
+		Command: os.Args[0],
+		Env:     map[string]string{"PLUGIN_TEST_PLUGIN": "1"},
+		Timeout: timeout,
+	}})
+	byName := make(map[string]*Tool)
+	for _, tool := range loaded {
+		byName[tool.Name()] = tool.(*Tool)
+	}
+	if len(byName) != 5 {
+		t.Fatalf("loaded %d tools, want 5", len(byName))
+	}
+	return m, byName
+}
+
+func TestTool_Execute(t *testing.T) {
+	_, tools := startTestPlugin(t, 5*time.Second)
+	ctx := context.Background()
+
+	echo := tools["echo"]
+	if echo.Description() != "Test tool echo" || echo.Parameters()["type"] != "object" {
+		t.Errorf("unexpected spec: %q %v", echo.Description(), echo.Parameters())
+	}
+	result := echo.Execute(ctx, map[string]interface{}{"text": "CA19-9"})
+	if result.IsError || result.ForLLM != "echo: CA19-9" || result.ForUser != "CA19-9" {
+		t.Errorf("echo result = %+v", result)
+	}
+
+	result = tools["fail"].Execute(ctx, nil)
+	if !result.IsError || result.ForLLM != "lab value missing" {
+		t.Errorf("fail result = %+v", result)
+	}
+}
+
+func TestTool_RestartsAfterTimeoutAndCrash(t *testing.T) {
+	_, tools := startTestPlugin(t, 500*time.Millisecond)
+	ctx := context.Background()
+
+	pid := func() string {
+		t.Helper()
+		result := tools["pid"].Execute(ctx, nil)
+		if result.IsError {
+			t.Fatalf("pid failed: %s", result.ForLLM)
+		}
+		return result.ForLLM
+	}
+	first := pid()
+
+	result := tools["hang"].Execute(ctx, nil)
+	if !result.IsError || !strings.Contains(result.ForLLM, "deadline exceeded") {
+		t.Fatalf("expected timeout, got %+v", result)
+	}
+	second := pid()
+	if second == first {
+		t.Error("expected a new process after a timeout")
+	}
+
+	if result := tools["crash"].Execute(ctx, nil); !result.IsError {
+		t.Fatalf("expected crash to fail, got %+v", result)
+	}
+	if third := pid(); third == second {
+		t.Error("expected a new process after a crash")
+	}
+}
+
+func TestManager_SkipsBrokenPlugins(t *testing.T) {
+	m := NewManager()
+	defer m.Close()
+	loaded := m.Load(context.Background(), []Config{
+		{Name: "missing", Command: "/nonexistent/picoclaw-plugin"},
+		{Name: "test", Command: os.Args[0], Env: map[string]string{"PLUGIN_TEST_PLUGIN": "1"}},
+		{Name: "again", Command: os.Args[0], Env: map[string]string{"PLUGIN_TEST_PLUGIN": "1"}},
+	})
+	if len(loaded) != 5 {
+		t.Errorf("loaded %d tools, want 5 with duplicates from the second copy skipped", len(loaded))
+	}
+}
+
+func TestHost_Closed(t *testing.T) {
+	m, tools := startTestPlugin(t, 5*time.Second)
+	m.Close()
+	if result := tools["echo"].Execute(context.Background(), nil); !result.IsError || !errors.Is(result.Err, ErrClosed) {
+		t.Errorf("expected ErrClosed, got %+v", result)
+	}
+}
@@ -0,0 +1,146 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+// Tool exposes one plugin tool as a picoclaw tool.
+type Tool struct {
+	host *Host
+	spec ToolSpec
+}
+
+// NewTool wraps spec, served by host.
+func NewTool(host *Host, spec ToolSpec) *Tool {
+	if spec.Parameters == nil {
+		spec.Parameters = map[string]interface{}{}
+	}
+	if _, ok := spec.Parameters["type"]; !ok {
+		spec.Parameters["type"] = "object"
+	}
+	if _, ok := spec.Parameters["properties"]; !ok {
+		spec.Parameters["properties"] = map[string]interface{}{}
+	}
+	if spec.Description == "" {
+		spec.Description = spec.Name
+	}
+	return &Tool{host: host, spec: spec}
+}
+
+func (t *Tool) Name() string {
+	return t.spec.Name
+}
+
+func (t *Tool) Description() string {
+	return t.spec.Description
+}
+
+func (t *Tool) Parameters() map[string]interface{} {
+	return t.spec.Parameters
+}
+
+func (t *Tool) Execute(ctx context.Context, args map[string]interface{}) *tools.ToolResult {
+	result, err := t.host.Execute(ctx, t.spec.Name, args)
+	if err != nil {
+		return tools.ErrorResult(fmt.Sprintf("%s failed: %v", t.spec.Name, err)).WithError(classify(ctx, err))
+	}
+	if result.IsError {
+		return tools.ErrorResult(result.Content)
+	}
+	return &tools.ToolResult{
+		ForLLM:  result.Content,
+		ForUser: result.ForUser,
+	}
+}
+
+// classify marks a failed call for the agent loop. Rejected parameters are
+// the model's to fix; timeouts and dropped connections may clear up on a
+// repeated call.
+func classify(ctx context.Context, err error) error {
+	var rpcErr *rpcError
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &rpcErr):
+		if rpcErr.Code == codeInvalidParams {
+			return tools.ClassifyError(tools.ErrInvalidArgs, err)
+		}
+		return err
+	case ctx.Err() != nil, errors.As(err, &syntaxErr), errors.As(err, &typeErr), errors.Is(err, ErrClosed):
+		return err
+	}
+	return tools.ClassifyError(tools.ErrRetryable, err)
+}
+
+// Manager owns the configured plugin processes.
+type Manager struct {
+	mu    sync.Mutex
+	hosts []*Host
+}
+
+func NewManager() *Manager {
+	return &Manager{}
+}
+
+// Load starts each plugin and returns the tools they describe. Plugins that
+// fail to start are logged and skipped, as are unnamed tools and tools
+// whose name an earlier plugin already claimed.
+func (m *Manager) Load(ctx context.Context, configs []Config) []tools.Tool {
+	var all []tools.Tool
+	seen := make(map[string]bool)
+	for _, cfg := range configs {
+		host, specs, err := Start(ctx, cfg)
+		if err != nil {
+			logger.WarnCF("plugin", "Plugin unavailable",
+				map[string]interface{}{
+					"plugin": cfg.Name,
+					"error":  err.Error(),
+				})
+			continue
+		}
+
+		m.mu.Lock()
+		m.hosts = append(m.hosts, host)
+		m.mu.Unlock()
+
+		names := make([]string, 0, len(specs))
+		for _, spec := range specs {
+			if spec.Name == "" || seen[spec.Name] {
+				logger.WarnCF("plugin", "Skipping plugin tool with a missing or duplicate name",
+					map[string]interface{}{
+						"plugin": cfg.Name,
+						"tool":   spec.Name,
+					})
+				continue
+			}
+			seen[spec.Name] = true
+			all = append(all, NewTool(host, spec))
+			names = append(names, spec.Name)
+		}
+		logger.InfoCF("plugin", "Loaded plugin tools",
+			map[string]interface{}{
+				"plugin": cfg.Name,
+				"tools":  strings.Join(names, ", "),
+			})
+	}
+	return all
+}
+
+// Close stops every plugin.
+func (m *Manager) Close() {
+	m.mu.Lock()
+	hosts := m.hosts
+	m.hosts = nil
+	m.mu.Unlock()
+	for _, h := range hosts {
+		h.Close()
+	}
+}
@@ -0,0 +1,137 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/profile"
+)
+
+var profileFields = []string{"diagnosis", "stage", "regimen", "allergies", "language"}
+
+// ProfileUpdateTool changes the user's long-term profile, which is shown
+// to the agent in every session. Every call needs approval, which is asked
+// of the user in their own chat, so nothing is recorded about them that
+// they have not confirmed.
+type ProfileUpdateTool struct {
+	store *profile.Store
+}
+
+func NewProfileUpdateTool(store *profile.Store) *ProfileUpdateTool {
+	return &ProfileUpdateTool{store: store}
+}
+
+func (t *ProfileUpdateTool) Name() string {
+	return "profile_update"
+}
+
+func (t *ProfileUpdateTool) Description() string {
+	return "Save facts about the user's own situation to their long-term profile, which you see in every later session: " +
+		"diagnosis, stage, current treatment regimen, allergies and preferred language. " +
+		"Only record what the user has said about themselves, in their words; never infer or guess. " +
+		"Say what you will save before calling it: the user is asked to confirm each change. " +
+		"Fields you do not pass are kept; list fields in clear to remove them."
+}
+
+func (t *ProfileUpdateTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"diagnosis": map[string]interface{}{
+				"type":        "string",
+				"description": "Diagnosis, e.g. 胰腺导管腺癌 (pancreatic ductal adenocarcinoma)",
+			},
+			"stage": map[string]interface{}{
+				"type":        "string",
+				"description": "Stage or extent, e.g. III期, locally advanced",
+			},
+			"regimen": map[string]interface{}{
+				"type":        "string",
+				"description": "Current treatment, e.g. mFOLFIRINOX cycle 4",
+			},
+			"allergies": map[string]interface{}{
+				"type":        "array",
+				"items":       map[string]interface{}{"type": "string"},
+				"description": "Drug and food allergies; replaces the saved list",
+			},
+			"language": map[string]interface{}{
+				"type":        "string",
+				"description": "Language the user wants replies in, e.g. 简体中文 or English",
+			},
+			"clear": map[string]interface{}{
+				"type":        "array",
+				"items":       map[string]interface{}{"type": "string", "enum": profileFields},
+				"description": "Fields to remove from the profile",
+			},
+		},
+	}
+}
+
+// RequiresApproval reports that every change needs the user's confirmation.
+func (t *ProfileUpdateTool) RequiresApproval(ctx context.Context, args map[string]interface{}) bool {
+	return true
+}
+
+type profileUpdateArgs struct {
+	Diagnosis string   `json:"diagnosis"`
+	Stage     string   `json:"stage"`
+	Regimen   string   `json:"regimen"`
+	Allergies []string `json:"allergies"`
+	Language  string   `json:"language"`
+	Clear     []string `json:"clear"`
+}
+
+func (t *ProfileUpdateTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	a, err := BindArgs[profileUpdateArgs](args)
+	if err != nil {
+		return ErrorResult(err.Error()).WithError(err)
+	}
+	clear := make(map[string]bool, len(a.Clear))
+	for _, field := range a.Clear {
+		field = strings.ToLower(strings.TrimSpace(field))
+		if !containsString(profileFields, field) {
+			return ErrorResult(fmt.Sprintf("unknown field %q in clear; use %s", field, strings.Join(profileFields, ", "))).
+				WithError(ErrInvalidArgs)
+		}
+		clear[field] = true
+	}
+	var allergies []string
+	for _, item := range a.Allergies {
+		if item = strings.TrimSpace(item); item != "" {
+			allergies = append(allergies, item)
+		}
+	}
+	_, setAllergies := args["allergies"]
+	if strings.TrimSpace(a.Diagnosis+a.Stage+a.Regimen+a.Language) == "" && !setAllergies && len(clear) == 0 {
+		return ErrorResult("nothing to update").WithError(ErrInvalidArgs)
+	}
+	user := documentUser(ctx)
+	if user == "" {
+		return ErrorResult("no user is attached to this call, so there is no profile to update").WithError(ErrInvalidArgs)
+	}
+
+	p, err := t.store.Update(user, func(p *profile.Profile) {
+		set := func(field *string, name, value string) {
+			if clear[name] {
+				*field = ""
+			}
+			if value = strings.TrimSpace(value); value != "" {
+				*field = value
+			}
+		}
+		set(&p.Diagnosis, "diagnosis", a.Diagnosis)
+		set(&p.Stage, "stage", a.Stage)
+		set(&p.Regimen, "regimen", a.Regimen)
+		set(&p.Language, "language", a.Language)
+		if clear["allergies"] || setAllergies {
+			p.Allergies = allergies
+		}
+	})
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("failed to save profile: %v", err))
+	}
+	payload, _ := json.Marshal(map[string]interface{}{"saved": true, "profile": p})
+	return NewToolResult(string(payload))
+}
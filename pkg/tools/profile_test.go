@@ -0,0 +1,65 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/profile"
+)
+
+func TestProfileUpdateTool(t *testing.T) {
+	store := profile.NewStore(t.TempDir())
+	tool := NewProfileUpdateTool(store)
+	ctx := asUser("42|Li Wei")
+	if !tool.RequiresApproval(context.Background(), nil) {
+		t.Error("profile_update must require approval")
+	}
+
+	result := tool.Execute(ctx, map[string]interface{}{
+		"diagnosis": "胰腺导管腺癌",
+		"regimen":   "mFOLFIRINOX 第4周期",
+		"allergies": []interface{}{"青霉素", " "},
+	})
+	if result.IsError {
+		t.Fatalf("update: %s", result.ForLLM)
+	}
+	result = tool.Execute(ctx, map[string]interface{}{"stage": "III期", "clear": []interface{}{"regimen"}})
+	if result.IsError || !strings.Contains(result.ForLLM, `"stage":"III期"`) {
+		t.Fatalf("second update: %s", result.ForLLM)
+	}
+
+	p, _ := store.Get("42")
+	want := &profile.Profile{Diagnosis: "胰腺导管腺癌", Stage: "III期", Allergies: []string{"青霉素"}, Updated: p.Updated}
+	if !reflect.DeepEqual(p, want) {
+		t.Errorf("profile = %+v", p)
+	}
+
+	// An empty list removes every allergy.
+	tool.Execute(ctx, map[string]interface{}{"allergies": []interface{}{}})
+	if p, _ := store.Get("42"); len(p.Allergies) != 0 {
+		t.Errorf("allergies = %q", p.Allergies)
+	}
+}
+
+func TestProfileUpdateTool_Errors(t *testing.T) {
+	tool := NewProfileUpdateTool(profile.NewStore(t.TempDir()))
+	tests := []struct {
+		name string
+		ctx  context.Context
+		args map[string]interface{}
+		text string
+	}{
+		{"nothing", asUser("42"), map[string]interface{}{}, "nothing to update"},
+		{"unknown field", asUser("42"), map[string]interface{}{"clear": []interface{}{"weight"}}, "unknown field"},
+		{"no user", context.Background(), map[string]interface{}{"stage": "IV"}, "no user"},
+	}
+	for _, tt := range tests {
+		result := tool.Execute(tt.ctx, tt.args)
+		if !result.IsError || !errors.Is(result.Err, ErrInvalidArgs) || !strings.Contains(result.ForLLM, tt.text) {
+			t.Errorf("%s: %+v", tt.name, result)
+		}
+	}
+}
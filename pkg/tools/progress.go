@@ -0,0 +1,42 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+)
+
+// Progress is a status update from a long-running tool call, such as
+// "已检索 3/8 篇文献…".
+type Progress struct {
+	Done  int
+	Total int
+	// Message is shown to the user; without one a plain count is shown.
+	Message string
+}
+
+func (p Progress) String() string {
+	if p.Message != "" {
+		return p.Message
+	}
+	return fmt.Sprintf("Working… %d/%d", p.Done, p.Total)
+}
+
+// ProgressFunc receives progress updates. It must be safe for concurrent
+// use and return quickly.
+type ProgressFunc func(Progress)
+
+type progressKey struct{}
+
+// WithProgress attaches a progress receiver to ctx.
+func WithProgress(ctx context.Context, fn ProgressFunc) context.Context {
+	return context.WithValue(ctx, progressKey{}, fn)
+}
+
+// ReportProgress passes p to the receiver attached to ctx, if any. Tools
+// may call it as often as they like; the receiver decides what reaches the
+// user.
+func ReportProgress(ctx context.Context, p Progress) {
+	if fn, ok := ctx.Value(progressKey{}).(ProgressFunc); ok && fn != nil {
+		fn(p)
+	}
+}
@@ -0,0 +1,220 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultEUtilsBaseURL = "https://eutils.ncbi.nlm.nih.gov/entrez/eutils"
+
+// pubMedTypes maps PubMed publication types to evidence types, strongest
+// design first.
+var pubMedTypes = []struct{ pubType, evidenceType string }{
+	{"Practice Guideline", "guideline"},
+	{"Guideline", "guideline"},
+	{"Meta-Analysis", "meta-analysis"},
+	{"Systematic Review", "systematic review"},
+	{"Randomized Controlled Trial", "randomized trial"},
+	{"Clinical Trial", "clinical trial"},
+	{"Observational Study", "observational study"},
+	{"Review", "review"},
+	{"Case Reports", "case report"},
+}
+
+// PubMedOptions configures the PubMed evidence provider.
+type PubMedOptions struct {
+	BaseURL string // E-utilities base URL
+	APIKey  string
+	Timeout time.Duration
+}
+
+// PubMedProvider searches PubMed through NCBI E-utilities. It retrieves
+// citations and abstracts but does not generate answers.
+type PubMedProvider struct {
+	baseURL string
+	apiKey  string
+	client  *http.Client
+}
+
+func NewPubMedProvider(opts PubMedOptions) *PubMedProvider {
+	if opts.BaseURL == "" {
+		opts.BaseURL = defaultEUtilsBaseURL
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 20 * time.Second
+	}
+	return &PubMedProvider{
+		baseURL: strings.TrimRight(opts.BaseURL, "/"),
+		apiKey:  opts.APIKey,
+		client:  &http.Client{Timeout: opts.Timeout},
+	}
+}
+
+func (p *PubMedProvider) Name() string {
+	return "pubmed"
+}
+
+func (p *PubMedProvider) Search(ctx context.Context, query EvidenceQuery) ([]Evidence, error) {
+	return p.search(ctx, query.Question, query.Limit)
+}
+
+// search runs a PubMed search term, which may use field tags such as
+// [pt], and returns the citations found, best match first.
+func (p *PubMedProvider) search(ctx context.Context, term string, limit int) ([]Evidence, error) {
+	if limit <= 0 {
+		limit = defaultEvidenceResults
+	}
+	q := p.query()
+	q.Set("term", term)
+	q.Set("retmax", strconv.Itoa(limit))
+	q.Set("sort", "relevance")
+	var search struct {
+		Result struct {
+			IDList []string `json:"idlist"`
+		} `json:"esearchresult"`
+	}
+	if err := p.get(ctx, "/esearch.fcgi", q, &search); err != nil {
+		return nil, err
+	}
+	if len(search.Result.IDList) == 0 {
+		return nil, nil
+	}
+	return p.summaries(ctx, search.Result.IDList)
+}
+
+// summaries fetches the citations of PMIDs, in the order given.
+func (p *PubMedProvider) summaries(ctx context.Context, pmids []string) ([]Evidence, error) {
+	q := p.query()
+	q.Set("id", strings.Join(pmids, ","))
+	var summary struct {
+		Result map[string]json.RawMessage `json:"result"`
+	}
+	if err := p.get(ctx, "/esummary.fcgi", q, &summary); err != nil {
+		return nil, err
+	}
+	out := make([]Evidence, 0, len(pmids))
+	for _, pmid := range pmids {
+		var doc struct {
+			Title      string   `json:"title"`
+			PubDate    string   `json:"pubdate"`
+			Journal    string   `json:"fulljournalname"`
+			Source     string   `json:"source"`
+			PubTypes   []string `json:"pubtype"`
+			ArticleIDs []struct {
+				IDType string `json:"idtype"`
+				Value  string `json:"value"`
+			} `json:"articleids"`
+		}
+		raw, ok := summary.Result[pmid]
+		if !ok || json.Unmarshal(raw, &doc) != nil || doc.Title == "" {
+			continue
+		}
+		e := Evidence{
+			ID:      pmid,
+			PMID:    pmid,
+			Title:   strings.TrimSpace(doc.Title),
+			Journal: doc.Journal,
+			Type:    pubMedType(doc.PubTypes),
+			URL:     "https://pubmed.ncbi.nlm.nih.gov/" + pmid + "/",
+		}
+		if e.Journal == "" {
+			e.Journal = doc.Source
+		}
+		if len(doc.PubDate) >= 4 {
+			e.Year, _ = strconv.Atoi(doc.PubDate[:4])
+		}
+		for _, id := range doc.ArticleIDs {
+			if id.IDType == "doi" {
+				e.DOI = id.Value
+			}
+		}
+		out = append(out, e)
+	}
+	return out, nil
+}
+
+func pubMedType(pubTypes []string) string {
+	for _, t := range pubMedTypes {
+		for _, pt := range pubTypes {
+			if strings.EqualFold(pt, t.pubType) {
+				return t.evidenceType
+			}
+		}
+	}
+	return "paper"
+}
+
+// GetDetail returns the citation and plain-text abstract of a PMID.
+func (p *PubMedProvider) GetDetail(ctx context.Context, id string) (*EvidenceDetail, error) {
+	if _, err := strconv.Atoi(id); err != nil {
+		return nil, ClassifyError(ErrInvalidArgs, fmt.Errorf("%q is not a PMID", id))
+	}
+	found, err := p.summaries(ctx, []string{id})
+	if err != nil {
+		return nil, err
+	}
+	if len(found) == 0 {
+		return nil, ClassifyError(ErrNotFound, fmt.Errorf("PMID %s not found", id))
+	}
+	q := p.query()
+	q.Set("id", id)
+	q.Set("rettype", "abstract")
+	q.Set("retmode", "text")
+	abstract, err := p.getText(ctx, "/efetch.fcgi", q)
+	if err != nil {
+		return nil, err
+	}
+	return &EvidenceDetail{Evidence: found[0], Content: strings.TrimSpace(abstract)}, nil
+}
+
+func (p *PubMedProvider) Answer(ctx context.Context, question string) (*EvidenceAnswer, error) {
+	return nil, ErrAnswerUnsupported
+}
+
+func (p *PubMedProvider) query() url.Values {
+	q := url.Values{"db": {"pubmed"}, "retmode": {"json"}}
+	if p.apiKey != "" {
+		q.Set("api_key", p.apiKey)
+	}
+	return q
+}
+
+func (p *PubMedProvider) get(ctx context.Context, path string, q url.Values, out interface{}) error {
+	body, err := p.getText(ctx, path, q)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal([]byte(body), out); err != nil {
+		return fmt.Errorf("invalid response from PubMed: %w", err)
+	}
+	return nil
+}
+
+func (p *PubMedProvider) getText(ctx context.Context, path string, q url.Values) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.baseURL+path+"?"+q.Encode(), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("User-Agent", userAgent)
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", requestError(ctx, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 4<<20))
+	if err != nil {
+		return "", requestError(ctx, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", ClassifyError(StatusErrorKind(resp.StatusCode),
+			fmt.Errorf("%s returned %d: %s", req.URL.Host, resp.StatusCode, truncateForError(strings.TrimSpace(string(body)), 300)))
+	}
+	return string(body), nil
+}
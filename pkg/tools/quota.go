@@ -0,0 +1,226 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// ErrQuotaExceeded is matched by the errors of calls refused by a
+// QuotaManager.
+var ErrQuotaExceeded = errors.New("tool quota exceeded")
+
+// QuotaOptions configures a QuotaManager. Limits are keyed by tool name or
+// glob pattern such as "knows_*"; all tools matching one pattern share its
+// count. An exact name wins over patterns, and among patterns the first in
+// sorted order wins.
+type QuotaOptions struct {
+	// PerSession caps calls per session.
+	PerSession map[string]int
+	// PerUserDaily caps calls per user per calendar day, local time.
+	PerUserDaily map[string]int
+	// ExemptUsers are user IDs without quotas, such as operators.
+	ExemptUsers []string
+	// Path is where daily counts are kept across restarts; "" keeps them
+	// in memory only. Session counts are always in memory.
+	Path string
+}
+
+// QuotaError describes a refused call.
+type QuotaError struct {
+	Tool    string
+	Pattern string
+	Limit   int
+	Daily   bool
+}
+
+func (e *QuotaError) Error() string {
+	scope := "per session"
+	if e.Daily {
+		scope = "per user per day"
+	}
+	return fmt.Sprintf("%s quota of %d calls %s used up", e.Pattern, e.Limit, scope)
+}
+
+func (e *QuotaError) Unwrap() error {
+	return ErrQuotaExceeded
+}
+
+// QuotaManager counts tool calls per session and per user per day and
+// refuses calls over the configured quotas, bounding the cost open groups
+// can run up on paid APIs.
+type QuotaManager struct {
+	opts    QuotaOptions
+	session []quotaLimit
+	daily   []quotaLimit
+	exempt  map[string]bool
+	now     func() time.Time
+
+	mu       sync.Mutex
+	sessions map[string]int // session + pattern -> calls
+	day      string
+	users    map[string]int // user + pattern -> calls today
+}
+
+type quotaLimit struct {
+	pattern string
+	limit   int
+}
+
+// quotaFile is the on-disk form of the daily counts.
+type quotaFile struct {
+	Day    string         `json:"day"`
+	Counts map[string]int `json:"counts"`
+}
+
+func NewQuotaManager(opts QuotaOptions) *QuotaManager {
+	q := &QuotaManager{
+		opts:     opts,
+		session:  sortLimits(opts.PerSession),
+		daily:    sortLimits(opts.PerUserDaily),
+		exempt:   make(map[string]bool),
+		now:      time.Now,
+		sessions: make(map[string]int),
+		users:    make(map[string]int),
+	}
+	for _, user := range opts.ExemptUsers {
+		q.exempt[user] = true
+	}
+	if opts.Path != "" {
+		if data, err := os.ReadFile(opts.Path); err == nil {
+			var f quotaFile
+			if err := json.Unmarshal(data, &f); err == nil && f.Counts != nil {
+				q.day, q.users = f.Day, f.Counts
+			}
+		}
+	}
+	return q
+}
+
+// sortLimits orders exact names before patterns, each sorted by name.
+func sortLimits(limits map[string]int) []quotaLimit {
+	out := make([]quotaLimit, 0, len(limits))
+	for pattern, limit := range limits {
+		if limit > 0 {
+			out = append(out, quotaLimit{pattern: pattern, limit: limit})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		gi, gj := isGlob(out[i].pattern), isGlob(out[j].pattern)
+		if gi != gj {
+			return !gi
+		}
+		return out[i].pattern < out[j].pattern
+	})
+	return out
+}
+
+func matchLimit(limits []quotaLimit, name string) (quotaLimit, bool) {
+	for _, l := range limits {
+		if l.pattern == name {
+			return l, true
+		}
+		if ok, _ := path.Match(l.pattern, name); ok && isGlob(l.pattern) {
+			return l, true
+		}
+	}
+	return quotaLimit{}, false
+}
+
+// Take counts one call of tool for the session and user in ctx's call
+// metadata, or returns a *QuotaError without counting it if either quota
+// is used up. Calls without a session or user are not limited by that
+// quota.
+func (q *QuotaManager) Take(ctx context.Context, tool string) *QuotaError {
+	meta := CallMetadataFromContext(ctx)
+	if q.isExempt(meta.UserID) {
+		return nil
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var sessionKey, userKey string
+	if l, ok := matchLimit(q.session, tool); ok && meta.SessionKey != "" {
+		sessionKey = meta.SessionKey + "\x00" + l.pattern
+		if q.sessions[sessionKey] >= l.limit {
+			return &QuotaError{Tool: tool, Pattern: l.pattern, Limit: l.limit}
+		}
+	}
+	if l, ok := matchLimit(q.daily, tool); ok && meta.UserID != "" {
+		if today := q.now().Format("2006-01-02"); q.day != today {
+			q.day = today
+			q.users = make(map[string]int)
+		}
+		userKey = meta.UserID + "\x00" + l.pattern
+		if q.users[userKey] >= l.limit {
+			return &QuotaError{Tool: tool, Pattern: l.pattern, Limit: l.limit, Daily: true}
+		}
+	}
+
+	if sessionKey != "" {
+		q.sessions[sessionKey]++
+	}
+	if userKey != "" {
+		q.users[userKey]++
+		q.save()
+	}
+	return nil
+}
+
+// isExempt matches user IDs in full or by their ID part, so "123456"
+// exempts the Telegram sender "123456|alice".
+func (q *QuotaManager) isExempt(userID string) bool {
+	if userID == "" {
+		return false
+	}
+	id, _, _ := strings.Cut(userID, "|")
+	return q.exempt[userID] || q.exempt[id]
+}
+
+func (q *QuotaManager) save() {
+	if q.opts.Path == "" {
+		return
+	}
+	data, err := json.Marshal(quotaFile{Day: q.day, Counts: q.users})
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(q.opts.Path), 0755)
+	}
+	if err == nil {
+		tmp := q.opts.Path + ".tmp"
+		if err = os.WriteFile(tmp, data, 0600); err == nil {
+			err = os.Rename(tmp, q.opts.Path)
+		}
+	}
+	if err != nil {
+		logger.WarnCF("tool", "Failed to save tool quotas",
+			map[string]interface{}{
+				"path":  q.opts.Path,
+				"error": err.Error(),
+			})
+	}
+}
+
+// quotaExceededResult tells the model not to retry and the user why.
+func quotaExceededResult(err *QuotaError) *ToolResult {
+	user := fmt.Sprintf("%s has reached its limit of %d uses in this conversation.", err.Tool, err.Limit)
+	if err.Daily {
+		user = fmt.Sprintf("%s has reached its limit of %d uses today. Please try again tomorrow.", err.Tool, err.Limit)
+	}
+	return &ToolResult{
+		ForLLM:  fmt.Sprintf("%s was not run: %v", err.Tool, err),
+		ForUser: user,
+		IsError: true,
+		Err:     ClassifyError(ErrPermissionDenied, err),
+	}
+}
@@ -0,0 +1,128 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func quotaContext(session, user string) context.Context {
+	return WithCallMetadata(context.Background(), CallMetadata{SessionKey: session, UserID: user})
+}
+
+func TestQuotaManager_PerSessionAndDaily(t *testing.T) {
+	q := NewQuotaManager(QuotaOptions{
+		PerSession:   map[string]int{"knows_*": 3},
+		PerUserDaily: map[string]int{"knows_ai_answer": 2, "knows_*": 10},
+	})
+
+	first := quotaContext("s1", "u1")
+	for i := 0; i < 2; i++ {
+		if err := q.Take(first, "knows_ai_answer"); err != nil {
+			t.Fatalf("call %d: %v", i, err)
+		}
+	}
+	err := q.Take(first, "knows_ai_answer")
+	if err == nil || !err.Daily || err.Limit != 2 {
+		t.Fatalf("expected the daily answer quota, got %v", err)
+	}
+	// The refused call was not counted against the session.
+	if err := q.Take(first, "knows_ai_search"); err != nil {
+		t.Fatalf("search: %v", err)
+	}
+	if err := q.Take(first, "knows_ai_search"); err == nil || err.Daily || err.Pattern != "knows_*" {
+		t.Fatalf("expected the session quota shared by knows_*, got %v", err)
+	}
+
+	// A new session for the same user still has the daily answer quota used up.
+	if err := q.Take(quotaContext("s2", "u1"), "knows_ai_answer"); err == nil {
+		t.Error("daily quota should follow the user across sessions")
+	}
+	if err := q.Take(quotaContext("s3", "u2"), "knows_ai_answer"); err != nil {
+		t.Errorf("another user: %v", err)
+	}
+	// Unlisted tools and calls without metadata are not limited.
+	if err := q.Take(first, "read_file"); err != nil {
+		t.Errorf("unlisted tool: %v", err)
+	}
+	if err := q.Take(context.Background(), "knows_ai_answer"); err != nil {
+		t.Errorf("internal call: %v", err)
+	}
+}
+
+func TestQuotaManager_ResetsDailyAndPersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "tool_quotas.json")
+	day := time.Date(2026, 10, 17, 23, 0, 0, 0, time.Local)
+	opts := QuotaOptions{PerUserDaily: map[string]int{"knows_ai_answer": 1}, Path: path}
+
+	q := NewQuotaManager(opts)
+	q.now = func() time.Time { return day }
+	ctx := quotaContext("s1", "123456|alice")
+	if err := q.Take(ctx, "knows_ai_answer"); err != nil {
+		t.Fatal(err)
+	}
+
+	restarted := NewQuotaManager(opts)
+	restarted.now = func() time.Time { return day }
+	if err := restarted.Take(ctx, "knows_ai_answer"); err == nil {
+		t.Fatal("daily count should survive a restart")
+	}
+	restarted.now = func() time.Time { return day.Add(2 * time.Hour) }
+	if err := restarted.Take(ctx, "knows_ai_answer"); err != nil {
+		t.Errorf("quota should reset the next day: %v", err)
+	}
+}
+
+func TestQuotaManager_ExemptUsers(t *testing.T) {
+	q := NewQuotaManager(QuotaOptions{
+		PerSession:  map[string]int{"*": 1},
+		ExemptUsers: []string{"123456"},
+	})
+	ctx := quotaContext("s1", "123456|alice")
+	for i := 0; i < 3; i++ {
+		if err := q.Take(ctx, "web_search"); err != nil {
+			t.Fatalf("exempt user refused: %v", err)
+		}
+	}
+}
+
+func TestToolRegistry_QuotaExceeded(t *testing.T) {
+	r := NewToolRegistry()
+	tool := &stubTool{name: "knows_ai_answer"}
+	r.Register(tool)
+	r.SetQuotaManager(NewQuotaManager(QuotaOptions{PerUserDaily: map[string]int{"knows_ai_answer": 1}}))
+	ctx := quotaContext("s1", "u1")
+
+	if result := r.Execute(ctx, "knows_ai_answer", nil); result.IsError {
+		t.Fatalf("first call failed: %s", result.ForLLM)
+	}
+	result := r.Execute(ctx, "knows_ai_answer", nil)
+	if !result.IsError || !errors.Is(result.Err, ErrQuotaExceeded) || !errors.Is(result.Err, ErrPermissionDenied) {
+		t.Fatalf("expected a quota error, got %+v", result)
+	}
+	if !strings.Contains(result.ForUser, "limit of 1 uses today") || tool.calls != 1 {
+		t.Errorf("ForUser = %q, calls = %d", result.ForUser, tool.calls)
+	}
+}
+
+func TestToolRegistry_CachedCallsAreFree(t *testing.T) {
+	tool := &cacheableStubTool{stubTool: stubTool{name: "knows_ai_search"}, ttl: time.Minute}
+	r := NewToolRegistry()
+	r.Register(tool)
+	r.SetCacheMiddleware(NewCacheMiddleware(CacheOptions{}))
+	r.SetQuotaManager(NewQuotaManager(QuotaOptions{PerSession: map[string]int{"knows_ai_search": 1}}))
+	ctx := quotaContext("s1", "u1")
+	args := map[string]interface{}{"query": "CA19-9"}
+
+	for i := 0; i < 3; i++ {
+		if result := r.Execute(ctx, "knows_ai_search", args); result.IsError {
+			t.Fatalf("call %d: %s", i, result.ForLLM)
+		}
+	}
+	if result := r.Execute(ctx, "knows_ai_search", map[string]interface{}{"query": "CEA"}); !result.IsError {
+		t.Error("a new query should be refused once the quota is used")
+	}
+}
@@ -0,0 +1,269 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+const defaultReferralTimeout = 20 * time.Second
+
+// referralFuncs are the functions available to referral body templates.
+var referralFuncs = template.FuncMap{
+	// json renders a value as JSON.
+	"json": func(v interface{}) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+}
+
+// ReferralTool sends a structured referral or appointment request to a
+// partner clinic's HTTP endpoint. Every call needs human approval, so the
+// operator sees the request before it leaves picoclaw.
+//
+// The request body is a text/template over .request (the tool arguments),
+// .user, .session and .now; without a template the request is sent as JSON.
+type ReferralTool struct {
+	destinations map[string]*referralDestination
+	names        []string
+	now          func() time.Time
+}
+
+type referralDestination struct {
+	cfg    config.ReferralDestinationConfig
+	body   *template.Template
+	client *http.Client
+}
+
+// NewReferralTool returns the tool for the configured destinations.
+func NewReferralTool(destinations map[string]config.ReferralDestinationConfig) (*ReferralTool, error) {
+	if len(destinations) == 0 {
+		return nil, fmt.Errorf("no referral destinations configured")
+	}
+	t := &ReferralTool{destinations: make(map[string]*referralDestination), now: time.Now}
+	for name, cfg := range destinations {
+		d := &referralDestination{cfg: cfg, client: &http.Client{Timeout: defaultReferralTimeout}}
+		if cfg.TimeoutSeconds > 0 {
+			d.client.Timeout = time.Duration(cfg.TimeoutSeconds) * time.Second
+		}
+		if cfg.Body != "" {
+			tmpl, err := template.New(name).Funcs(referralFuncs).Option("missingkey=zero").Parse(cfg.Body)
+			if err != nil {
+				return nil, fmt.Errorf("referral destination %s: invalid body template: %w", name, err)
+			}
+			d.body = tmpl
+		}
+		t.destinations[name] = d
+		t.names = append(t.names, name)
+	}
+	sort.Strings(t.names)
+	return t, nil
+}
+
+func (t *ReferralTool) Name() string {
+	return "referral_request"
+}
+
+func (t *ReferralTool) Description() string {
+	var b strings.Builder
+	b.WriteString("Send a referral or appointment request to a partner clinic. A person must approve it before it is sent. ")
+	b.WriteString("Only use it when the user asks for a referral or appointment and has agreed to share the details. Destinations:")
+	for _, name := range t.names {
+		b.WriteString("\n- ")
+		b.WriteString(name)
+		if desc := t.destinations[name].cfg.Description; desc != "" {
+			b.WriteString(": ")
+			b.WriteString(desc)
+		}
+	}
+	return b.String()
+}
+
+func (t *ReferralTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"destination": map[string]interface{}{
+				"type":        "string",
+				"enum":        t.names,
+				"description": "Clinic to send the request to",
+			},
+			"type": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"referral", "appointment"},
+				"description": "A referral for assessment or treatment, or an appointment booking",
+			},
+			"patient_name": map[string]interface{}{
+				"type":        "string",
+				"description": "Patient's name as the user gave it",
+			},
+			"contact": map[string]interface{}{
+				"type":        "string",
+				"description": "Phone number or other way for the clinic to reach the patient",
+			},
+			"reason": map[string]interface{}{
+				"type":        "string",
+				"description": "Why the patient needs to be seen, e.g. diagnosis, current treatment and the question for the clinic",
+			},
+			"urgency": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"routine", "soon", "urgent"},
+				"description": "How soon the patient needs to be seen (default routine); emergencies belong in an emergency department, not here",
+			},
+			"preferred_dates": map[string]interface{}{
+				"type":        "array",
+				"items":       map[string]interface{}{"type": "string"},
+				"description": "Dates or times that suit the patient, e.g. 2026-06-03 morning",
+			},
+			"notes": map[string]interface{}{
+				"type":        "string",
+				"description": "Anything else the clinic should know, e.g. recent scans or mobility needs",
+			},
+		},
+		"required": []string{"destination", "type", "patient_name", "contact", "reason"},
+	}
+}
+
+// RequiresApproval reports that every referral needs approval.
+func (t *ReferralTool) RequiresApproval(ctx context.Context, args map[string]interface{}) bool {
+	return true
+}
+
+type referralArgs struct {
+	Destination    string   `json:"destination" arg:"required"`
+	Type           string   `json:"type" arg:"required,enum=referral|appointment"`
+	PatientName    string   `json:"patient_name" arg:"required"`
+	Contact        string   `json:"contact" arg:"required"`
+	Reason         string   `json:"reason" arg:"required"`
+	Urgency        string   `json:"urgency" arg:"default=routine,enum=routine|soon|urgent"`
+	PreferredDates []string `json:"preferred_dates"`
+	Notes          string   `json:"notes"`
+}
+
+func (t *ReferralTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	a, err := BindArgs[referralArgs](args)
+	if err != nil {
+		return ErrorResult(err.Error()).WithError(err)
+	}
+	dest, ok := t.destinations[a.Destination]
+	if !ok {
+		return ErrorResult(fmt.Sprintf("unknown destination %q; use one of: %s", a.Destination, strings.Join(t.names, ", "))).
+			WithError(ErrInvalidArgs)
+	}
+
+	request := map[string]interface{}{
+		"destination":     a.Destination,
+		"type":            a.Type,
+		"patient_name":    a.PatientName,
+		"contact":         a.Contact,
+		"reason":          a.Reason,
+		"urgency":         a.Urgency,
+		"preferred_dates": a.PreferredDates,
+		"notes":           a.Notes,
+	}
+	if a.PreferredDates == nil {
+		request["preferred_dates"] = []string{}
+	}
+	body, err := dest.render(request, documentUser(ctx), CallMetadataFromContext(ctx).SessionKey, t.now())
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("referral to %s not sent: %v", a.Destination, err)).WithError(err)
+	}
+
+	status, reply, err := dest.send(ctx, body)
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("referral to %s not sent: %v", a.Destination, err)).WithError(err)
+	}
+	logger.InfoCF("tool", "Referral request sent",
+		map[string]interface{}{
+			"destination": a.Destination,
+			"type":        a.Type,
+			"status":      status,
+		})
+
+	out := map[string]interface{}{
+		"status":      "sent",
+		"destination": a.Destination,
+		"type":        a.Type,
+		"http_status": status,
+		"note":        "The clinic has received the request; it is not yet a confirmed appointment. Tell the user the clinic will contact them.",
+	}
+	if reply != nil {
+		out["response"] = reply
+	}
+	payload, _ := json.Marshal(out)
+	return NewToolResult(string(payload))
+}
+
+// render builds the request body from the destination's template, or as
+// JSON when there is none.
+func (d *referralDestination) render(request map[string]interface{}, user, session string, now time.Time) ([]byte, error) {
+	if d.body == nil {
+		return json.Marshal(request)
+	}
+	var buf bytes.Buffer
+	err := d.body.Execute(&buf, map[string]interface{}{
+		"request": request,
+		"user":    user,
+		"session": session,
+		"now":     now.Format(time.RFC3339),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("body template: %w", err)
+	}
+	if d.contentType() == "application/json" && !json.Valid(buf.Bytes()) {
+		return nil, fmt.Errorf("body template did not produce valid JSON")
+	}
+	return buf.Bytes(), nil
+}
+
+func (d *referralDestination) contentType() string {
+	if d.cfg.ContentType != "" {
+		return d.cfg.ContentType
+	}
+	return "application/json"
+}
+
+// send delivers body and returns the response status and body, decoded
+// when it is JSON.
+func (d *referralDestination) send(ctx context.Context, body []byte) (int, interface{}, error) {
+	method := strings.ToUpper(d.cfg.Method)
+	if method == "" {
+		method = http.MethodPost
+	}
+	req, err := http.NewRequestWithContext(ctx, method, d.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, nil, err
+	}
+	for k, v := range d.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("Content-Type", d.contentType())
+	req.Header.Set("User-Agent", userAgent)
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, nil, requestError(ctx, err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, nil, ClassifyError(StatusErrorKind(resp.StatusCode),
+			fmt.Errorf("%s returned %d: %s", req.URL.Host, resp.StatusCode, truncateForError(string(data), 300)))
+	}
+	var reply interface{}
+	if err := json.Unmarshal(data, &reply); err != nil {
+		if text := strings.TrimSpace(string(data)); text != "" {
+			reply = truncateForError(text, 500)
+		}
+	}
+	return resp.StatusCode, reply, nil
+}
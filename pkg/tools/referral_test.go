@@ -0,0 +1,118 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func referralArgsFor(destination string) map[string]interface{} {
+	return map[string]interface{}{
+		"destination":     destination,
+		"type":            "appointment",
+		"patient_name":    "张伟",
+		"contact":         "13800000000",
+		"reason":          "Second opinion on borderline resectable pancreatic cancer",
+		"preferred_dates": []interface{}{"2026-06-03 morning"},
+	}
+}
+
+func TestReferralTool_SendsTemplatedRequest(t *testing.T) {
+	var got struct {
+		header http.Header
+		body   string
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		got.header, got.body = r.Header, string(data)
+		w.Write([]byte(`{"reference":"R-1024"}`))
+	}))
+	defer server.Close()
+
+	tool, err := NewReferralTool(map[string]config.ReferralDestinationConfig{
+		"ruijin": {
+			URL:     server.URL,
+			Headers: map[string]string{"Authorization": "Bearer secret"},
+			Body: `{"kind": {{json .request.type}}, "patient": {"name": {{json .request.patient_name}}, "phone": {{json .request.contact}}},` +
+				` "priority": {{json .request.urgency}}, "dates": {{json .request.preferred_dates}}, "sender": {{json .user}}, "sent_at": {{json .now}}}`,
+		},
+		"plain": {URL: server.URL},
+	})
+	if err != nil {
+		t.Fatalf("NewReferralTool() error: %v", err)
+	}
+	tool.now = func() time.Time { return time.Date(2026, 5, 10, 9, 0, 0, 0, time.UTC) }
+	if !tool.RequiresApproval(context.Background(), nil) {
+		t.Error("referrals must always require approval")
+	}
+
+	result := tool.Execute(asUser("111|alice"), referralArgsFor("ruijin"))
+	if result.IsError {
+		t.Fatalf("referral_request: %s", result.ForLLM)
+	}
+	want := `{"kind": "appointment", "patient": {"name": "张伟", "phone": "13800000000"}, "priority": "routine", "dates": ["2026-06-03 morning"], "sender": "111", "sent_at": "2026-05-10T09:00:00Z"}`
+	if got.body != want {
+		t.Errorf("body = %s\nwant %s", got.body, want)
+	}
+	if got.header.Get("Authorization") != "Bearer secret" || got.header.Get("Content-Type") != "application/json" {
+		t.Errorf("headers = %v", got.header)
+	}
+	if !strings.Contains(result.ForLLM, "R-1024") {
+		t.Errorf("result lacks the clinic's reply: %s", result.ForLLM)
+	}
+
+	if result := tool.Execute(context.Background(), referralArgsFor("plain")); result.IsError {
+		t.Fatalf("referral_request without template: %s", result.ForLLM)
+	}
+	var plain map[string]interface{}
+	if err := json.Unmarshal([]byte(got.body), &plain); err != nil || plain["reason"] == nil || plain["destination"] != "plain" {
+		t.Errorf("default body = %s", got.body)
+	}
+}
+
+func TestReferralTool_Errors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "bad token", http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	tool, err := NewReferralTool(map[string]config.ReferralDestinationConfig{
+		"rejects": {URL: server.URL},
+		"broken":  {URL: server.URL, Body: `{"name": {{.request.patient_name}}}`},
+	})
+	if err != nil {
+		t.Fatalf("NewReferralTool() error: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		args map[string]interface{}
+		kind error
+		text string
+	}{
+		{"unknown destination", referralArgsFor("elsewhere"), ErrInvalidArgs, "use one of: broken, rejects"},
+		{"clinic rejects", referralArgsFor("rejects"), ErrPermissionDenied, "returned 401"},
+		{"template makes invalid JSON", referralArgsFor("broken"), nil, "valid JSON"},
+	}
+	for _, tt := range tests {
+		result := tool.Execute(context.Background(), tt.args)
+		if !result.IsError || !strings.Contains(result.ForLLM, tt.text) {
+			t.Errorf("%s: %+v", tt.name, result)
+		}
+		if tt.kind != nil && !errors.Is(result.Err, tt.kind) {
+			t.Errorf("%s: error %v, want %v", tt.name, result.Err, tt.kind)
+		}
+	}
+
+	if _, err := NewReferralTool(map[string]config.ReferralDestinationConfig{"x": {URL: server.URL, Body: "{{"}}); err == nil {
+		t.Error("invalid template accepted")
+	}
+}
@@ -3,6 +3,7 @@ package tools
 import (
 	"context"
 	"fmt"
+	"sort"
 	"sync"
 	"time"
 
@@ -11,10 +12,21 @@ import (
 )
 
 type ToolRegistry struct {
-	tools map[string]Tool
-	mu    sync.RWMutex
+	tools     map[string]Tool
+	approvals *ApprovalManager
+	cache     *CacheMiddleware
+	limiter   *ConcurrencyLimiter
+	quotas    *QuotaManager
+	jobs      *JobManager
+	recorders []CallRecorder
+	shadow    ShadowFunc
+	mu        sync.RWMutex
 }
 
+// ShadowFunc is called after every tool call run in the foreground, with
+// the call's result and how long it took. It must return quickly.
+type ShadowFunc func(ctx context.Context, tool string, args map[string]interface{}, result *ToolResult, duration time.Duration)
+
 func NewToolRegistry() *ToolRegistry {
 	return &ToolRegistry{
 		tools: make(map[string]Tool),
@@ -27,6 +39,76 @@ func (r *ToolRegistry) Register(tool Tool) {
 	r.tools[tool.Name()] = tool
 }
 
+// Unregister removes a tool and returns it.
+func (r *ToolRegistry) Unregister(name string) (Tool, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	tool, ok := r.tools[name]
+	delete(r.tools, name)
+	return tool, ok
+}
+
+// SetApprovalManager enables human approval gates for tools that require them.
+func (r *ToolRegistry) SetApprovalManager(m *ApprovalManager) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.approvals = m
+}
+
+// SetCacheMiddleware enables result caching for read-only tools.
+func (r *ToolRegistry) SetCacheMiddleware(m *CacheMiddleware) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cache = m
+}
+
+// SetConcurrencyLimiter queues tool calls that exceed the limiter's caps.
+func (r *ToolRegistry) SetConcurrencyLimiter(l *ConcurrencyLimiter) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.limiter = l
+}
+
+// SetJobManager lets BackgroundTool calls run as jobs polled with
+// job_status and job_result.
+func (r *ToolRegistry) SetJobManager(m *JobManager) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.jobs = m
+}
+
+// SetCallRecorder records every tool call made through the registry,
+// replacing any recorders added before.
+func (r *ToolRegistry) SetCallRecorder(rec CallRecorder) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.recorders = []CallRecorder{rec}
+}
+
+// AddCallRecorder records every tool call with rec as well as the
+// recorders already set.
+func (r *ToolRegistry) AddCallRecorder(rec CallRecorder) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.recorders = append(r.recorders, rec)
+}
+
+// SetShadow passes every foreground tool call to fn, for comparison with a
+// shadow tool.
+func (r *ToolRegistry) SetShadow(fn ShadowFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.shadow = fn
+}
+
+// SetQuotaManager limits how often tools may be called per session and
+// per user per day.
+func (r *ToolRegistry) SetQuotaManager(q *QuotaManager) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.quotas = q
+}
+
 func (r *ToolRegistry) Get(name string) (Tool, bool) {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
@@ -42,6 +124,38 @@ func (r *ToolRegistry) Execute(ctx context.Context, name string, args map[string
 // If the tool implements AsyncTool and a non-nil callback is provided,
 // the callback will be set on the tool before execution.
 func (r *ToolRegistry) ExecuteWithContext(ctx context.Context, name string, args map[string]interface{}, channel, chatID string, asyncCallback AsyncCallback) *ToolResult {
+	r.mu.RLock()
+	recorders := r.recorders
+	r.mu.RUnlock()
+
+	start := time.Now()
+	result := r.execute(NewToolContext(ctx, channel, chatID), name, args, channel, chatID, asyncCallback)
+	if len(recorders) > 0 {
+		record := ToolCallRecord{
+			Tool:     name,
+			Args:     args,
+			Channel:  channel,
+			ChatID:   chatID,
+			Meta:     CallMetadataFromContext(ctx),
+			Start:    start,
+			Duration: time.Since(start),
+			IsError:  result.IsError,
+			Result:   result.ForLLM,
+		}
+		if result.IsError {
+			record.Error = result.ForLLM
+			if record.Error == "" && result.Err != nil {
+				record.Error = result.Err.Error()
+			}
+		}
+		for _, recorder := range recorders {
+			recorder.RecordToolCall(record)
+		}
+	}
+	return result
+}
+
+func (r *ToolRegistry) execute(ctx *ToolContext, name string, args map[string]interface{}, channel, chatID string, asyncCallback AsyncCallback) *ToolResult {
 	logger.InfoCF("tool", "Tool execution started",
 		map[string]interface{}{
 			"tool": name,
@@ -54,7 +168,24 @@ func (r *ToolRegistry) ExecuteWithContext(ctx context.Context, name string, args
 			map[string]interface{}{
 				"tool": name,
 			})
-		return ErrorResult(fmt.Sprintf("tool %q not found", name)).WithError(fmt.Errorf("tool not found"))
+		return ErrorResult(fmt.Sprintf("tool %q not found", name)).WithError(ClassifyError(ErrNotFound, fmt.Errorf("tool not found")))
+	}
+
+	if !ctx.Allows(name) {
+		logger.WarnCF("tool", "Tool call not run: not permitted for the user's roles",
+			map[string]interface{}{
+				"tool":    name,
+				"user_id": ctx.UserID,
+			})
+		return ErrorResult(fmt.Sprintf("%s was not run: not permitted for this user", name)).WithError(ErrPermissionDenied)
+	}
+	if !ctx.InScope(name) {
+		logger.WarnCF("tool", "Tool call not run: outside the scope of this turn",
+			map[string]interface{}{
+				"tool":        name,
+				"session_key": ctx.SessionKey,
+			})
+		return ErrorResult(fmt.Sprintf("%s was not run: it is not available for this kind of question", name)).WithError(ErrPermissionDenied)
 	}
 
 	// If tool implements ContextualTool, set context
@@ -71,9 +202,94 @@ func (r *ToolRegistry) ExecuteWithContext(ctx context.Context, name string, args
 			})
 	}
 
+	r.mu.RLock()
+	approvals := r.approvals
+	cache := r.cache
+	limiter := r.limiter
+	quotas := r.quotas
+	jobs := r.jobs
+	shadow := r.shadow
+	r.mu.RUnlock()
+	if approvals != nil && approvals.Requires(ctx, tool, args) {
+		approved, err := approvals.Request(ctx, ApprovalRequest{
+			Tool:     name,
+			Args:     args,
+			Channel:  channel,
+			ChatID:   chatID,
+			SenderID: ctx.UserID,
+		})
+		logger.InfoCF("tool", "Tool approval decided",
+			map[string]interface{}{
+				"tool":     name,
+				"approved": approved,
+			})
+		if err != nil {
+			return ErrorResult(fmt.Sprintf("%s was not run: approval failed: %v", name, err)).WithError(ClassifyError(ErrPermissionDenied, err))
+		}
+		if !approved {
+			return ErrorResult(fmt.Sprintf("%s was not run: the operator denied approval", name)).WithError(ErrPermissionDenied)
+		}
+	}
+
+	execute := tool.Execute
+	if streaming, ok := tool.(StreamingTool); ok {
+		execute = func(ctx context.Context, args map[string]interface{}) *ToolResult {
+			return streaming.ExecuteStream(ctx, args, streamFromContext(ctx))
+		}
+	}
+	run := execute
+	if limiter != nil {
+		// Cached results are served without waiting for a slot.
+		run = func(ctx context.Context, args map[string]interface{}) *ToolResult {
+			release, err := limiter.Acquire(ctx, name)
+			if err != nil {
+				logger.WarnCF("tool", "Tool call not run: no free slot",
+					map[string]interface{}{
+						"tool":  name,
+						"error": err.Error(),
+					})
+				return ErrorResult(fmt.Sprintf("%s was not run: too many tool calls in progress (%v), try again shortly", name, err)).WithError(ClassifyError(ErrRetryable, err))
+			}
+			defer release()
+			return execute(ctx, args)
+		}
+	}
+
+	if quotas != nil {
+		// Counted here so cached results are free.
+		limited := run
+		run = func(ctx context.Context, args map[string]interface{}) *ToolResult {
+			if err := quotas.Take(ctx, name); err != nil {
+				logger.WarnCF("tool", "Tool call not run: quota exceeded",
+					map[string]interface{}{
+						"tool":  name,
+						"error": err.Error(),
+					})
+				return quotaExceededResult(err)
+			}
+			return limited(ctx, args)
+		}
+	}
+
+	invoke := func(ctx context.Context) *ToolResult {
+		if cache != nil {
+			return cache.Execute(ctx, tool, args, run)
+		}
+		return run(ctx, args)
+	}
+
+	if jobs != nil && !mustRunInForeground(ctx) {
+		if bg, ok := tool.(BackgroundTool); ok && bg.RunsInBackground(args) {
+			return jobStartedResult(jobs.Start(ctx, name, invoke))
+		}
+	}
+
 	start := time.Now()
-	result := tool.Execute(ctx, args)
+	result := invoke(ctx)
 	duration := time.Since(start)
+	if shadow != nil && !result.Async {
+		shadow(ctx, name, args, result, duration)
+	}
 
 	// Log based on result type
 	if result.IsError {
@@ -106,12 +322,28 @@ func (r *ToolRegistry) GetDefinitions() []map[string]interface{} {
 	defer r.mu.RUnlock()
 
 	definitions := make([]map[string]interface{}, 0, len(r.tools))
-	for _, tool := range r.tools {
+	for _, tool := range r.sortedLocked() {
 		definitions = append(definitions, ToolToSchema(tool))
 	}
 	return definitions
 }
 
+// sortedLocked returns the tools ordered by name. Definitions and summaries
+// are listed in this order so that the tools part of the prompt is the same
+// on every call, and stays in the providers' prompt caches.
+func (r *ToolRegistry) sortedLocked() []Tool {
+	names := make([]string, 0, len(r.tools))
+	for name := range r.tools {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	sorted := make([]Tool, len(names))
+	for i, name := range names {
+		sorted[i] = r.tools[name]
+	}
+	return sorted
+}
+
 // ToProviderDefs converts tool definitions to provider-compatible format.
 // This is the format expected by LLM provider APIs.
 func (r *ToolRegistry) ToProviderDefs() []providers.ToolDefinition {
@@ -119,7 +351,7 @@ func (r *ToolRegistry) ToProviderDefs() []providers.ToolDefinition {
 	defer r.mu.RUnlock()
 
 	definitions := make([]providers.ToolDefinition, 0, len(r.tools))
-	for _, tool := range r.tools {
+	for _, tool := range r.sortedLocked() {
 		schema := ToolToSchema(tool)
 
 		// Safely extract nested values with type checks
@@ -156,6 +388,18 @@ func (r *ToolRegistry) List() []string {
 	return names
 }
 
+// HasBackgroundTools reports whether any registered tool implements BackgroundTool.
+func (r *ToolRegistry) HasBackgroundTools() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, tool := range r.tools {
+		if _, ok := tool.(BackgroundTool); ok {
+			return true
+		}
+	}
+	return false
+}
+
 // Count returns the number of registered tools.
 func (r *ToolRegistry) Count() int {
 	r.mu.RLock()
@@ -170,7 +414,7 @@ func (r *ToolRegistry) GetSummaries() []string {
 	defer r.mu.RUnlock()
 
 	summaries := make([]string, 0, len(r.tools))
-	for _, tool := range r.tools {
+	for _, tool := range r.sortedLocked() {
 		summaries = append(summaries, fmt.Sprintf("- `%s` - %s", tool.Name(), tool.Description()))
 	}
 	return summaries
@@ -0,0 +1,28 @@
+package tools
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestToolRegistry_StableOrder(t *testing.T) {
+	r := NewToolRegistry()
+	for _, name := range []string{"web_search", "read_file", "knows_ai_search", "exec", "message", "cron"} {
+		r.Register(&stubTool{name: name})
+	}
+	want := []string{"cron", "exec", "knows_ai_search", "message", "read_file", "web_search"}
+
+	for i := 0; i < 20; i++ {
+		var names []string
+		for _, def := range r.ToProviderDefs() {
+			names = append(names, def.Function.Name)
+		}
+		if !reflect.DeepEqual(names, want) {
+			t.Fatalf("ToProviderDefs order = %v, want %v", names, want)
+		}
+		summaries := r.GetSummaries()
+		if summaries[0] != "- `cron` - stub tool cron" || summaries[5] != "- `web_search` - stub tool web_search" {
+			t.Fatalf("GetSummaries order = %v", summaries)
+		}
+	}
+}
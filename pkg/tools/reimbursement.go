@@ -0,0 +1,297 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ReimbursementEntry is one drug in the reimbursement dataset. The dataset
+// file is a JSON array of entries; the API returns {"results": [...]}.
+type ReimbursementEntry struct {
+	Name         string   `json:"name"`
+	NameZH       string   `json:"name_zh,omitempty"`
+	Aliases      []string `json:"aliases,omitempty"` // brand names and other spellings
+	Listed       bool     `json:"listed"`
+	Category     string   `json:"category,omitempty"` // A (甲类) or B (乙类)
+	Negotiated   bool     `json:"negotiated,omitempty"`
+	Restrictions string   `json:"restrictions,omitempty"`
+	DosageForms  []string `json:"dosage_forms,omitempty"`
+	PriceMin     float64  `json:"price_min,omitempty"`
+	PriceMax     float64  `json:"price_max,omitempty"`
+	PriceUnit    string   `json:"price_unit,omitempty"` // e.g. "per 100 mg vial"
+	ListVersion  string   `json:"list_version,omitempty"`
+	ValidUntil   string   `json:"valid_until,omitempty"`
+	Notes        string   `json:"notes,omitempty"`
+}
+
+// ReimbursementOptions configures the drug_reimbursement tool. At least one
+// of DatasetPath and APIURL must be set; the dataset is searched first.
+type ReimbursementOptions struct {
+	DatasetPath string
+	APIURL      string
+	APIKey      string
+	Timeout     time.Duration
+}
+
+// ReimbursementTool reports whether a drug is on China's National
+// Reimbursement Drug List (NRDL), its category and typical self-pay price.
+type ReimbursementTool struct {
+	opts   ReimbursementOptions
+	client *http.Client
+
+	mu      sync.Mutex
+	entries []ReimbursementEntry
+	loaded  time.Time // modification time of the loaded dataset
+}
+
+func NewReimbursementTool(opts ReimbursementOptions) *ReimbursementTool {
+	if opts.Timeout <= 0 {
+		opts.Timeout = 15 * time.Second
+	}
+	return &ReimbursementTool{opts: opts, client: &http.Client{Timeout: opts.Timeout}}
+}
+
+func (t *ReimbursementTool) Name() string {
+	return "drug_reimbursement"
+}
+
+func (t *ReimbursementTool) Description() string {
+	return "Check whether a drug is covered by China's national medical insurance (国家医保目录, NRDL): whether it is listed, " +
+		"its category (甲类/乙类), whether it is a negotiated drug, coverage restrictions such as approved indications, and the typical self-pay price range. " +
+		"Accepts Chinese, generic or brand names. Actual out-of-pocket costs depend on the city's insurance scheme and hospital; tell the user to confirm with the hospital's insurance office."
+}
+
+func (t *ReimbursementTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"drug": map[string]interface{}{
+				"type":        "string",
+				"description": "Drug name in Chinese or English, generic or brand, e.g. 白蛋白紫杉醇 or olaparib",
+			},
+		},
+		"required": []string{"drug"},
+	}
+}
+
+type reimbursementArgs struct {
+	Drug string `json:"drug" arg:"required"`
+}
+
+func (t *ReimbursementTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	a, err := BindArgs[reimbursementArgs](args)
+	if err != nil {
+		return ErrorResult(err.Error()).WithError(err)
+	}
+
+	var matches []ReimbursementEntry
+	source := ""
+	if t.opts.DatasetPath != "" {
+		entries, err := t.dataset()
+		switch {
+		case errors.Is(err, os.ErrNotExist) && t.opts.APIURL != "":
+			// The API alone answers until a dataset is installed
+		case err != nil:
+			return ErrorResult(fmt.Sprintf("reimbursement dataset unavailable: %v", err)).WithError(err)
+		default:
+			matches = matchReimbursement(entries, a.Drug)
+			source = "dataset"
+		}
+	}
+	if len(matches) == 0 && t.opts.APIURL != "" {
+		if matches, err = t.lookupAPI(ctx, a.Drug); err != nil {
+			return ErrorResult(fmt.Sprintf("reimbursement lookup failed: %v", err)).WithError(err)
+		}
+		source = "api"
+	}
+	if len(matches) == 0 {
+		return ErrorResult(fmt.Sprintf("%q is not in the reimbursement data; it may be unlisted (fully self-paid) or named differently; try the generic or Chinese name", a.Drug)).
+			WithError(ClassifyError(ErrNotFound, fmt.Errorf("no reimbursement entry for %q", a.Drug)))
+	}
+
+	results := make([]map[string]interface{}, len(matches))
+	for i, e := range matches {
+		results[i] = describeReimbursement(e)
+	}
+	payload, _ := json.Marshal(map[string]interface{}{
+		"query":   a.Drug,
+		"results": results,
+		"source":  source,
+		"note": "Category B (乙类) drugs have a self-paid share set by each region before insurance applies; negotiated drugs are covered only for the listed indications. " +
+			"Prices are typical ranges, not quotes.",
+	})
+	return NewToolResult(string(payload))
+}
+
+// dataset returns the entries of the dataset file, reloading it when the
+// file has changed so a new annual list takes effect without a restart.
+func (t *ReimbursementTool) dataset() ([]ReimbursementEntry, error) {
+	info, err := os.Stat(t.opts.DatasetPath)
+	if err != nil {
+		return nil, err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.entries != nil && info.ModTime().Equal(t.loaded) {
+		return t.entries, nil
+	}
+	data, err := os.ReadFile(t.opts.DatasetPath)
+	if err != nil {
+		return nil, err
+	}
+	var entries []ReimbursementEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("invalid dataset %s: %w", t.opts.DatasetPath, err)
+	}
+	t.entries, t.loaded = entries, info.ModTime()
+	return entries, nil
+}
+
+func (t *ReimbursementTool) lookupAPI(ctx context.Context, drug string) ([]ReimbursementEntry, error) {
+	u, err := url.Parse(t.opts.APIURL)
+	if err != nil {
+		return nil, err
+	}
+	q := u.Query()
+	q.Set("name", drug)
+	u.RawQuery = q.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", userAgent)
+	if t.opts.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+t.opts.APIKey)
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, requestError(ctx, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, ClassifyError(StatusErrorKind(resp.StatusCode),
+			fmt.Errorf("%s returned %d: %s", req.URL.Host, resp.StatusCode, strings.TrimSpace(string(body))))
+	}
+	var out struct {
+		Results []ReimbursementEntry `json:"results"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("invalid response from %s: %w", req.URL.Host, err)
+	}
+	return out.Results, nil
+}
+
+// matchReimbursement returns the entries named drug exactly, or else those
+// whose names contain it.
+func matchReimbursement(entries []ReimbursementEntry, drug string) []ReimbursementEntry {
+	query := normalizeDrugName(drug)
+	if query == "" {
+		return nil
+	}
+	var exact, partial []ReimbursementEntry
+	for _, e := range entries {
+		names := append([]string{e.Name, e.NameZH}, e.Aliases...)
+		best := 0
+		for _, name := range names {
+			name = normalizeDrugName(name)
+			switch {
+			case name == "":
+			case name == query:
+				best = 2
+			case best == 0 && (strings.Contains(name, query) || strings.Contains(query, name)):
+				best = 1
+			}
+		}
+		switch best {
+		case 2:
+			exact = append(exact, e)
+		case 1:
+			partial = append(partial, e)
+		}
+	}
+	if len(exact) > 0 {
+		return exact
+	}
+	return partial
+}
+
+// normalizeDrugName lower-cases a name and drops spaces, hyphens and the
+// trademark signs found in brand names.
+func normalizeDrugName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '-', '_', '®', '™', '（', '）', '(', ')', '　':
+			return -1
+		}
+		return r
+	}, strings.ToLower(strings.TrimSpace(name)))
+}
+
+// describeReimbursement explains an entry's coverage in plain words.
+func describeReimbursement(e ReimbursementEntry) map[string]interface{} {
+	out := map[string]interface{}{
+		"name":   e.Name,
+		"listed": e.Listed,
+	}
+	if e.NameZH != "" {
+		out["name_zh"] = e.NameZH
+	}
+	if len(e.Aliases) > 0 {
+		out["aliases"] = e.Aliases
+	}
+	switch {
+	case !e.Listed:
+		out["coverage"] = "Not on the national reimbursement list: fully self-paid unless a local supplementary or commercial insurance plan covers it."
+	case strings.EqualFold(e.Category, "A") || e.Category == "甲" || e.Category == "甲类":
+		out["category"] = "A (甲类)"
+		out["coverage"] = "Category A: covered at the region's standard reimbursement rate with no extra self-paid share."
+	case strings.EqualFold(e.Category, "B") || e.Category == "乙" || e.Category == "乙类":
+		out["category"] = "B (乙类)"
+		out["coverage"] = "Category B: the patient first pays a self-paid share set by the region (often 5-30%), then insurance covers the rest at the standard rate."
+	default:
+		out["category"] = e.Category
+	}
+	if e.Negotiated {
+		out["negotiated"] = true
+	}
+	if e.Restrictions != "" {
+		out["restrictions"] = e.Restrictions
+	}
+	if len(e.DosageForms) > 0 {
+		out["dosage_forms"] = e.DosageForms
+	}
+	if e.PriceMax > 0 {
+		price := fmt.Sprintf("¥%g-%g", e.PriceMin, e.PriceMax)
+		if e.PriceMin == 0 || e.PriceMin == e.PriceMax {
+			price = fmt.Sprintf("¥%g", e.PriceMax)
+		}
+		if e.PriceUnit != "" {
+			price += " " + e.PriceUnit
+		}
+		out["self_pay_price"] = price
+	}
+	if e.ListVersion != "" {
+		out["list_version"] = e.ListVersion
+	}
+	if e.ValidUntil != "" {
+		out["valid_until"] = e.ValidUntil
+	}
+	if e.Notes != "" {
+		out["notes"] = e.Notes
+	}
+	return out
+}
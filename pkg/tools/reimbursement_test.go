@@ -0,0 +1,103 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const reimbursementDataset = `[
+	{"name": "nab-paclitaxel", "name_zh": "注射用紫杉醇（白蛋白结合型）", "aliases": ["Abraxane", "白蛋白紫杉醇", "克艾力"],
+	 "listed": true, "category": "B", "restrictions": "限转移性乳腺癌、胰腺癌", "price_min": 600, "price_max": 1400, "price_unit": "per 100 mg vial",
+	 "list_version": "2024"},
+	{"name": "gemcitabine", "name_zh": "吉西他滨", "listed": true, "category": "甲"},
+	{"name": "olaparib", "name_zh": "奥拉帕利", "aliases": ["Lynparza", "利普卓"], "listed": true, "category": "B", "negotiated": true,
+	 "restrictions": "限胰腺癌以外的适应症"},
+	{"name": "olaparib oral suspension", "listed": false}
+]`
+
+func TestReimbursement_Dataset(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nrdl.json")
+	os.WriteFile(path, []byte(reimbursementDataset), 0644)
+	tool := NewReimbursementTool(ReimbursementOptions{DatasetPath: path})
+
+	tests := []struct {
+		drug string
+		want []string
+	}{
+		{"白蛋白紫杉醇", []string{`"category":"B (乙类)"`, `"self_pay_price":"¥600-1400 per 100 mg vial"`, "胰腺癌"}},
+		{"ABRAXANE®", []string{`"name":"nab-paclitaxel"`}},
+		{"Gemcitabine", []string{`"category":"A (甲类)"`, "Category A"}},
+		{"olaparib", []string{`"negotiated":true`}},
+		{"olaparib oral", []string{`"listed":false`, "fully self-paid"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.drug, func(t *testing.T) {
+			result := tool.Execute(context.Background(), map[string]interface{}{"drug": tt.drug})
+			if result.IsError {
+				t.Fatalf("Execute: %s", result.ForLLM)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(result.ForLLM, want) {
+					t.Errorf("missing %s in %s", want, result.ForLLM)
+				}
+			}
+		})
+	}
+
+	// An exact match hides entries that only contain the name
+	result := tool.Execute(context.Background(), map[string]interface{}{"drug": "olaparib"})
+	if strings.Contains(result.ForLLM, "oral suspension") {
+		t.Errorf("partial match returned with an exact one: %s", result.ForLLM)
+	}
+
+	// The dataset is reloaded when the file changes
+	os.WriteFile(path, []byte(`[{"name": "gemcitabine", "listed": true, "category": "B"}]`), 0644)
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(path, later, later)
+	result = tool.Execute(context.Background(), map[string]interface{}{"drug": "gemcitabine"})
+	if !strings.Contains(result.ForLLM, `"category":"B (乙类)"`) {
+		t.Errorf("dataset not reloaded: %s", result.ForLLM)
+	}
+	if result := tool.Execute(context.Background(), map[string]interface{}{"drug": "sotorasib"}); !errors.Is(result.Err, ErrNotFound) {
+		t.Errorf("Err = %v, want ErrNotFound", result.Err)
+	}
+}
+
+func TestReimbursement_API(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nrdl.json")
+	os.WriteFile(path, []byte(reimbursementDataset), 0644)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Query().Get("name") == "替吉奥" {
+			w.Write([]byte(`{"results": [{"name": "tegafur, gimeracil and oteracil", "name_zh": "替吉奥", "listed": true, "category": "B"}]}`))
+			return
+		}
+		w.Write([]byte(`{"results": []}`))
+	}))
+	defer server.Close()
+
+	tool := NewReimbursementTool(ReimbursementOptions{DatasetPath: path, APIURL: server.URL + "/nrdl?lang=zh", APIKey: "key"})
+	result := tool.Execute(context.Background(), map[string]interface{}{"drug": "替吉奥"})
+	if result.IsError || !strings.Contains(result.ForLLM, `"source":"api"`) || !strings.Contains(result.ForLLM, "tegafur") {
+		t.Errorf("API lookup: %s", result.ForLLM)
+	}
+	result = tool.Execute(context.Background(), map[string]interface{}{"drug": "吉西他滨"})
+	if result.IsError || !strings.Contains(result.ForLLM, `"source":"dataset"`) {
+		t.Errorf("dataset lookup: %s", result.ForLLM)
+	}
+
+	tool = NewReimbursementTool(ReimbursementOptions{APIURL: server.URL})
+	if result := tool.Execute(context.Background(), map[string]interface{}{"drug": "替吉奥"}); !errors.Is(result.Err, ErrPermissionDenied) {
+		t.Errorf("Err = %v, want ErrPermissionDenied", result.Err)
+	}
+}
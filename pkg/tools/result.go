@@ -27,6 +27,15 @@ type ToolResult struct {
 	// When true, the tool will complete later and notify via callback.
 	Async bool `json:"async"`
 
+	// Content carries structured blocks (text, JSON, images, files, tables)
+	// alongside the flat ForLLM string. ForLLM holds the LLM rendering;
+	// channels render the blocks in their own format for the user.
+	Content []ContentBlock `json:"content,omitempty"`
+
+	// ContentForUser sends Content to the user when ForUser is empty.
+	// Silent=true overrides this field.
+	ContentForUser bool `json:"content_for_user,omitempty"`
+
 	// Err is the underlying error (not JSON serialized).
 	// Used for internal error handling and logging.
 	Err error `json:"-"`
@@ -120,6 +129,60 @@ func UserResult(content string) *ToolResult {
 	}
 }
 
+// RichResult creates a ToolResult from structured content blocks.
+// ForLLM is set to the Markdown rendering of the blocks; nothing is
+// sent to the user.
+//
+// Example:
+//
+//	result := RichResult(TextBlock("2 trials found"), TableBlock("", headers, rows))
+func RichResult(blocks ...ContentBlock) *ToolResult {
+	return &ToolResult{
+		ForLLM:  RenderContent(RenderTargetLLM, blocks),
+		Content: blocks,
+	}
+}
+
+// RichUserResult is like RichResult but also shows the blocks to the user,
+// rendered for the user's channel.
+func RichUserResult(blocks ...ContentBlock) *ToolResult {
+	result := RichResult(blocks...)
+	result.ContentForUser = true
+	return result
+}
+
+// UserContent returns the text to send to the user on the given channel,
+// or "" if nothing should be sent.
+func (tr *ToolResult) UserContent(channel string) string {
+	if tr.Silent {
+		return ""
+	}
+	if tr.ForUser != "" {
+		return tr.ForUser
+	}
+	if tr.ContentForUser && len(tr.Content) > 0 {
+		return RenderContent(channel, tr.Content)
+	}
+	return ""
+}
+
+// UserMessage is like UserContent but returns file and image blocks
+// separately, so they can be delivered as attachments after the text.
+func (tr *ToolResult) UserMessage(channel string) (string, []ContentBlock) {
+	if tr.Silent || tr.ForUser != "" || !tr.ContentForUser {
+		return tr.UserContent(channel), nil
+	}
+	var text, files []ContentBlock
+	for _, b := range tr.Content {
+		if b.Type == ContentFile || b.Type == ContentImage {
+			files = append(files, b)
+		} else {
+			text = append(text, b)
+		}
+	}
+	return RenderContent(channel, text), files
+}
+
 // MarshalJSON implements custom JSON serialization.
 // The Err field is excluded from JSON output via the json:"-" tag.
 func (tr *ToolResult) MarshalJSON() ([]byte, error) {
@@ -3,6 +3,7 @@ package tools
 import (
 	"encoding/json"
 	"errors"
+	"strings"
 	"testing"
 )
 
@@ -227,3 +228,49 @@ func TestToolResultJSONStructure(t *testing.T) {
 		t.Errorf("Expected silent false, got %v", parsed["silent"])
 	}
 }
+
+func TestRichResult(t *testing.T) {
+	result := RichResult(TextBlock("hello"), TableBlock("", []string{"a"}, [][]string{{"1"}}))
+
+	if !strings.Contains(result.ForLLM, "| a |") {
+		t.Errorf("Expected ForLLM to contain markdown table, got %q", result.ForLLM)
+	}
+	if len(result.Content) != 2 {
+		t.Errorf("Expected 2 content blocks, got %d", len(result.Content))
+	}
+	if got := result.UserContent("telegram"); got != "" {
+		t.Errorf("Expected no user content for RichResult, got %q", got)
+	}
+}
+
+func TestRichUserResult_UserContent(t *testing.T) {
+	result := RichUserResult(TableBlock("", []string{"a"}, [][]string{{"1"}}))
+
+	if got := result.UserContent("telegram"); !strings.HasPrefix(got, "```") {
+		t.Errorf("Expected fenced table for telegram, got %q", got)
+	}
+
+	result.ForUser = "override"
+	if got := result.UserContent("telegram"); got != "override" {
+		t.Errorf("Expected ForUser to take precedence, got %q", got)
+	}
+
+	result.Silent = true
+	if got := result.UserContent("telegram"); got != "" {
+		t.Errorf("Expected silent result to send nothing, got %q", got)
+	}
+}
+
+func TestRichUserResult_UserMessage(t *testing.T) {
+	result := RichUserResult(TextBlock("Summary ready"), FileBlock("visit.md", "", "/tmp/visit.md"))
+
+	text, files := result.UserMessage("telegram")
+	if text != "Summary ready" || len(files) != 1 || files[0].Path != "/tmp/visit.md" {
+		t.Errorf("UserMessage() = %q, %+v", text, files)
+	}
+
+	result.ForUser = "override"
+	if text, files := result.UserMessage("telegram"); text != "override" || files != nil {
+		t.Errorf("Expected ForUser without attachments, got %q, %+v", text, files)
+	}
+}
@@ -0,0 +1,196 @@
+package tools
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Sandbox confines the commands run by ExecTool. Commands run in a jail
+// directory with a minimal environment, under CPU and memory limits, and
+// without network access unless AllowNetwork is set. Only the programs
+// named in AllowedCommands, if any, may be started, and never those in
+// DeniedCommands.
+//
+// The jail is enforced by checking the working directory and the paths in
+// the command, not by hiding the rest of the filesystem; deployments that
+// need that should also run PicoClaw in a container.
+type Sandbox struct {
+	Dir             string
+	AllowedCommands []string
+	DeniedCommands  []string
+	CPUSeconds      int
+	MemoryMB        int
+	AllowNetwork    bool
+}
+
+var (
+	// commandSeparators split a command line into the simple commands it
+	// runs: pipelines, lists and subshells.
+	commandSeparators = regexp.MustCompile(`\|\||&&|[;|&\n()]`)
+	envAssignment     = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*=`)
+)
+
+// checkCommand returns why command may not run, or "" if it may.
+func (s *Sandbox) checkCommand(command string) string {
+	if strings.Contains(command, "$(") || strings.Contains(command, "`") {
+		return "Command blocked by sandbox (command substitution is not allowed)"
+	}
+	names, err := commandNames(command)
+	if err != nil {
+		return fmt.Sprintf("Command blocked by sandbox (%v)", err)
+	}
+	for _, name := range names {
+		for _, denied := range s.DeniedCommands {
+			if name == denied {
+				return fmt.Sprintf("Command blocked by sandbox (%s is not allowed)", name)
+			}
+		}
+		if len(s.AllowedCommands) == 0 {
+			continue
+		}
+		allowed := false
+		for _, a := range s.AllowedCommands {
+			if name == a {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return fmt.Sprintf("Command blocked by sandbox (%s is not in the allowed commands: %s)", name, strings.Join(s.AllowedCommands, ", "))
+		}
+	}
+	return ""
+}
+
+// commandNames returns the program started by each simple command in
+// command, without its directory. It fails when a program is named by a
+// variable, glob or brace expansion, as the shell only works out the name
+// as it runs.
+func commandNames(command string) ([]string, error) {
+	var names []string
+	for _, segment := range commandSeparators.Split(command, -1) {
+		for _, word := range shellWords(segment) {
+			if envAssignment.MatchString(word) {
+				continue
+			}
+			if strings.ContainsAny(word, "$*?[{") {
+				return nil, fmt.Errorf("%s does not name a program plainly", word)
+			}
+			names = append(names, filepath.Base(unquote(word)))
+			break
+		}
+	}
+	return names, nil
+}
+
+// shellWords splits segment at the spaces outside quotes.
+func shellWords(segment string) []string {
+	var words []string
+	var word strings.Builder
+	var quote rune
+	escaped := false
+	for _, r := range segment {
+		switch {
+		case escaped:
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"':
+			quote = r
+		case r == ' ' || r == '\t':
+			if word.Len() > 0 {
+				words = append(words, word.String())
+				word.Reset()
+			}
+			continue
+		}
+		word.WriteRune(r)
+	}
+	if word.Len() > 0 {
+		words = append(words, word.String())
+	}
+	return words
+}
+
+// unquote removes the shell's quotes and backslash escapes from word, so
+// that r""m, \rm and c'u'rl are all matched as the program they start.
+func unquote(word string) string {
+	var b strings.Builder
+	var quote rune
+	escaped := false
+	for _, r := range word {
+		switch {
+		case escaped:
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped = true
+			continue
+		case quote != 0 && r == quote:
+			quote = 0
+			continue
+		case quote == 0 && (r == '\'' || r == '"'):
+			quote = r
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// resolveDir returns the directory to run in: requested, relative to the
+// jail unless absolute, which must lie inside the jail once symlinks are
+// resolved.
+func (s *Sandbox) resolveDir(requested string) (string, error) {
+	jail, err := filepath.EvalSymlinks(s.Dir)
+	if err != nil {
+		return "", fmt.Errorf("sandbox directory unavailable: %w", err)
+	}
+	if requested == "" {
+		return jail, nil
+	}
+	if !filepath.IsAbs(requested) {
+		requested = filepath.Join(jail, requested)
+	}
+	dir, err := filepath.EvalSymlinks(requested)
+	if err != nil {
+		return "", fmt.Errorf("working directory unavailable: %w", err)
+	}
+	rel, err := filepath.Rel(jail, dir)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("working directory %s is outside the sandbox", requested)
+	}
+	return dir, nil
+}
+
+// command builds the sandboxed command running script in dir.
+func (s *Sandbox) command(cmd *exec.Cmd, script, dir string) (*exec.Cmd, error) {
+	var limits strings.Builder
+	if s.CPUSeconds > 0 {
+		fmt.Fprintf(&limits, "ulimit -t %d || exit 126\n", s.CPUSeconds)
+	}
+	if s.MemoryMB > 0 {
+		fmt.Fprintf(&limits, "ulimit -v %d || exit 126\n", s.MemoryMB*1024)
+	}
+	cmd.Args = []string{"sh", "-c", limits.String() + script}
+	cmd.Dir = dir
+	cmd.Env = []string{
+		"PATH=" + os.Getenv("PATH"),
+		"HOME=" + dir,
+		"TMPDIR=" + dir,
+		"LANG=C.UTF-8",
+	}
+	if !s.AllowNetwork {
+		if err := isolateNetwork(cmd); err != nil {
+			return nil, err
+		}
+	}
+	return cmd, nil
+}
@@ -0,0 +1,24 @@
+package tools
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestIsolateNetwork(t *testing.T) {
+	cmd := exec.Command("cat", "/proc/net/dev")
+	if err := isolateNetwork(cmd); err != nil {
+		t.Fatal(err)
+	}
+	out, err := cmd.Output()
+	if err != nil {
+		t.Skipf("user namespaces unavailable: %v", err)
+	}
+	for _, line := range strings.Split(string(out), "\n")[2:] {
+		name, _, _ := strings.Cut(strings.TrimSpace(line), ":")
+		if name != "" && name != "lo" {
+			t.Errorf("interface %s visible in the isolated network", name)
+		}
+	}
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+
+package tools
+
+import (
+	"fmt"
+	"os/exec"
+)
+
+func isolateNetwork(cmd *exec.Cmd) error {
+	return fmt.Errorf("network isolation is only supported on Linux; set tools.exec.sandbox.allow_network to run without it")
+}
@@ -0,0 +1,103 @@
+package tools
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestCommandNames(t *testing.T) {
+	tests := []struct {
+		command string
+		want    []string
+	}{
+		{"wc -l data.csv", []string{"wc"}},
+		{"LC_ALL=C sort data.csv | uniq -c && /usr/bin/head -n 3 out.txt", []string{"sort", "uniq", "head"}},
+		{"(cd sub; python3 x.py) || echo failed", []string{"cd", "python3", "echo"}},
+		{"sleep 1 & curl example.com", []string{"sleep", "curl"}},
+		{`r""m x; \rm y; c'u'rl example.com`, []string{"rm", "rm", "curl"}},
+		{`LABEL='a b' sort data.csv`, []string{"sort"}},
+		{`grep "a b" data.csv`, []string{"grep"}},
+	}
+	for _, tt := range tests {
+		if got, err := commandNames(tt.command); err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("commandNames(%q) = %v, %v, want %v", tt.command, got, err, tt.want)
+		}
+	}
+}
+
+func TestSandbox_CheckCommand(t *testing.T) {
+	s := &Sandbox{AllowedCommands: []string{"wc", "sort", "head"}, DeniedCommands: []string{"head"}}
+	tests := []struct {
+		command string
+		blocked string
+	}{
+		{"sort data.csv | wc -l", ""},
+		{"sort data.csv | python3 -c 'print(1)'", "python3 is not in the allowed commands"},
+		{"head -n 1 data.csv", "head is not allowed"},
+		{"wc -l $(which sort)", "command substitution"},
+		{`h""ead -n 1 data.csv`, "head is not allowed"},
+		{`\head -n 1 data.csv`, "head is not allowed"},
+		{"X=head; $X -n 1 data.csv", "does not name a program plainly"},
+		{"/usr/bin/h?ad -n 1 data.csv", "does not name a program plainly"},
+		{"{head,-n1} data.csv", "does not name a program plainly"},
+	}
+	for _, tt := range tests {
+		got := s.checkCommand(tt.command)
+		if tt.blocked == "" && got != "" || !strings.Contains(got, tt.blocked) {
+			t.Errorf("checkCommand(%q) = %q, want %q", tt.command, got, tt.blocked)
+		}
+	}
+}
+
+func TestSandbox_ResolveDir(t *testing.T) {
+	jail := t.TempDir()
+	outside := t.TempDir()
+	os.Mkdir(filepath.Join(jail, "data"), 0755)
+	os.Symlink(outside, filepath.Join(jail, "escape"))
+	s := &Sandbox{Dir: jail}
+
+	if dir, err := s.resolveDir("data"); err != nil || filepath.Base(dir) != "data" {
+		t.Errorf("resolveDir(data) = %q, %v", dir, err)
+	}
+	for _, dir := range []string{"..", outside, "escape"} {
+		if _, err := s.resolveDir(dir); err == nil || !strings.Contains(err.Error(), "outside the sandbox") {
+			t.Errorf("resolveDir(%q) should be outside the sandbox, got %v", dir, err)
+		}
+	}
+}
+
+func TestShellTool_Sandbox(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the sandbox runs commands with sh")
+	}
+	t.Setenv("PICOCLAW_TOOLS_KNOWS_API_KEY", "secret")
+	jail := t.TempDir()
+	tool := NewExecTool(jail, false)
+	tool.SetSandbox(&Sandbox{Dir: jail, CPUSeconds: 5, MemoryMB: 256, AllowNetwork: true})
+
+	result := tool.Execute(context.Background(), map[string]interface{}{
+		"command": "pwd; echo key=$PICOCLAW_TOOLS_KNOWS_API_KEY; ulimit -t; ulimit -v",
+	})
+	if result.IsError {
+		t.Fatalf("Expected success, got: %s", result.ForLLM)
+	}
+	resolved, _ := filepath.EvalSymlinks(jail)
+	for _, want := range []string{resolved + "\n", "key=\n", "5\n", "262144\n"} {
+		if !strings.Contains(result.ForLLM, want) {
+			t.Errorf("Expected %q in output, got: %s", want, result.ForLLM)
+		}
+	}
+
+	result = tool.Execute(context.Background(), map[string]interface{}{
+		"command":     "ls",
+		"working_dir": t.TempDir(),
+	})
+	if !result.IsError || !strings.Contains(result.ForLLM, "outside the sandbox") {
+		t.Errorf("Expected working_dir outside the jail to be refused, got: %s", result.ForLLM)
+	}
+}
@@ -0,0 +1,171 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/adhocore/gronx"
+
+	"github.com/sipeed/picoclaw/pkg/cron"
+	"github.com/sipeed/picoclaw/pkg/scheduler"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+// ScheduleTaskTool lets the agent schedule tasks that run as agent turns
+// later and message the user with the result.
+type ScheduleTaskTool struct {
+	scheduler *scheduler.Scheduler
+}
+
+func NewScheduleTaskTool(s *scheduler.Scheduler) *ScheduleTaskTool {
+	return &ScheduleTaskTool{scheduler: s}
+}
+
+func (t *ScheduleTaskTool) Name() string {
+	return "schedule_task"
+}
+
+func (t *ScheduleTaskTool) Description() string {
+	return "Schedule a task that you will carry out later, then message this chat with the result: for example a weekly check-in " +
+		"on how the user is feeling, or a monthly search for new guidelines on their treatment. At the scheduled time you get the " +
+		"prompt with this conversation's history and your tools. Write the prompt as an instruction to yourself. " +
+		"For fixed-text reminders use the cron tool instead."
+}
+
+func (t *ScheduleTaskTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"action": map[string]interface{}{
+				"type": "string",
+				"enum": []string{"add", "list", "remove"},
+			},
+			"prompt": map[string]interface{}{
+				"type":        "string",
+				"description": "For add: what to do at the scheduled time, e.g. 'Ask how the user's appetite and energy were this week and log it in the diary'",
+			},
+			"name": map[string]interface{}{
+				"type":        "string",
+				"description": "For add: short name shown in lists; defaults to the start of the prompt",
+			},
+			"cron_expr": map[string]interface{}{
+				"type":        "string",
+				"description": "For add: recurring schedule as a cron expression, e.g. '0 19 * * 0' for Sundays at 7pm",
+			},
+			"timezone": map[string]interface{}{
+				"type":        "string",
+				"description": "For add: IANA time zone of cron_expr, e.g. Asia/Shanghai; server time when omitted",
+			},
+			"at_seconds": map[string]interface{}{
+				"type":        "integer",
+				"description": "For add: run once, this many seconds from now, instead of cron_expr",
+			},
+			"task_id": map[string]interface{}{
+				"type":        "string",
+				"description": "For remove: the task's id from list",
+			},
+		},
+		"required": []string{"action"},
+	}
+}
+
+type scheduleTaskArgs struct {
+	Action    string `json:"action" arg:"required,enum=add|list|remove"`
+	Prompt    string `json:"prompt"`
+	Name      string `json:"name"`
+	CronExpr  string `json:"cron_expr"`
+	Timezone  string `json:"timezone"`
+	AtSeconds int64  `json:"at_seconds" arg:"min=0"`
+	TaskID    string `json:"task_id"`
+}
+
+func (t *ScheduleTaskTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	a, err := BindArgs[scheduleTaskArgs](args)
+	if err != nil {
+		return ErrorResult(err.Error()).WithError(err)
+	}
+	tc := ToolContextFrom(ctx)
+	if tc.Channel == "" || tc.ChatID == "" {
+		return ErrorResult("schedule_task needs an active conversation to send results to").WithError(ErrInvalidArgs)
+	}
+
+	switch a.Action {
+	case "add":
+		return t.add(a, tc.Channel, tc.ChatID)
+	case "remove":
+		if a.TaskID == "" {
+			return ErrorResult("task_id is required for remove").WithError(ErrInvalidArgs)
+		}
+		if err := t.scheduler.Remove(a.TaskID, tc.Channel, tc.ChatID); err != nil {
+			return ErrorResult(err.Error()).WithError(ClassifyError(ErrNotFound, err))
+		}
+		return SilentResult(fmt.Sprintf("Scheduled task %s removed", a.TaskID))
+	default:
+		return t.list(tc.Channel, tc.ChatID)
+	}
+}
+
+func (t *ScheduleTaskTool) add(a scheduleTaskArgs, channel, chatID string) *ToolResult {
+	if a.Prompt == "" {
+		return ErrorResult("prompt is required for add").WithError(ErrInvalidArgs)
+	}
+	var schedule cron.CronSchedule
+	switch {
+	case a.AtSeconds > 0:
+		at := time.Now().Add(time.Duration(a.AtSeconds) * time.Second).UnixMilli()
+		schedule = cron.CronSchedule{Kind: "at", AtMS: &at}
+	case a.CronExpr != "":
+		if !gronx.IsValid(a.CronExpr) {
+			return ErrorResult(fmt.Sprintf("invalid cron expression %q", a.CronExpr)).WithError(ErrInvalidArgs)
+		}
+		if a.Timezone != "" {
+			if _, err := time.LoadLocation(a.Timezone); err != nil {
+				return ErrorResult(fmt.Sprintf("unknown time zone %q", a.Timezone)).WithError(ErrInvalidArgs)
+			}
+		}
+		schedule = cron.CronSchedule{Kind: "cron", Expr: a.CronExpr, TZ: a.Timezone}
+	default:
+		return ErrorResult("one of cron_expr or at_seconds is required for add").WithError(ErrInvalidArgs)
+	}
+
+	name := a.Name
+	if name == "" {
+		name = utils.Truncate(a.Prompt, 30)
+	}
+	job, err := t.scheduler.Add(name, a.Prompt, schedule, channel, chatID)
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("could not schedule the task: %v", err)).WithError(ClassifyError(ErrInvalidArgs, err))
+	}
+	return SilentResult(fmt.Sprintf("Task scheduled: %s (id: %s, next run %s)",
+		job.Name, job.ID, time.UnixMilli(*job.State.NextRunAtMS).Format(time.RFC3339)))
+}
+
+func (t *ScheduleTaskTool) list(channel, chatID string) *ToolResult {
+	jobs := t.scheduler.List(channel, chatID)
+	if len(jobs) == 0 {
+		return SilentResult("No tasks scheduled for this chat")
+	}
+	var sb strings.Builder
+	sb.WriteString("Scheduled tasks:\n")
+	for _, job := range jobs {
+		when := "one-time"
+		if job.Schedule.Kind == "cron" {
+			when = job.Schedule.Expr
+			if job.Schedule.TZ != "" {
+				when += " " + job.Schedule.TZ
+			}
+		}
+		if !job.Enabled {
+			when += ", disabled"
+		} else if job.State.NextRunAtMS != nil {
+			when += ", next " + time.UnixMilli(*job.State.NextRunAtMS).Format(time.RFC3339)
+		}
+		if scheduler.IsConfigTask(job.ID) {
+			when += ", set by the operator"
+		}
+		fmt.Fprintf(&sb, "- %s (id: %s, %s): %s\n", job.Name, job.ID, when, utils.Truncate(job.Payload.Message, 80))
+	}
+	return SilentResult(sb.String())
+}
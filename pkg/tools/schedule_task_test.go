@@ -0,0 +1,66 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/scheduler"
+)
+
+func TestScheduleTaskTool(t *testing.T) {
+	s := scheduler.New(filepath.Join(t.TempDir(), "tasks.json"), nil, bus.NewMessageBus(), 0)
+	tool := NewScheduleTaskTool(s)
+	ctx := NewToolContext(context.Background(), "telegram", "42")
+
+	result := tool.Execute(ctx, map[string]interface{}{
+		"action":    "add",
+		"prompt":    "Ask how the user's appetite was this week",
+		"cron_expr": "0 19 * * 0",
+		"timezone":  "Asia/Shanghai",
+	})
+	if result.IsError || !strings.Contains(result.ForLLM, "Task scheduled: Ask how the user's appetite") {
+		t.Fatalf("add: %+v", result)
+	}
+
+	invalid := []map[string]interface{}{
+		{"action": "add", "prompt": "x"},
+		{"action": "add", "prompt": "x", "cron_expr": "every sunday"},
+		{"action": "add", "prompt": "x", "cron_expr": "0 19 * * 0", "timezone": "Mars/Olympus"},
+		{"action": "add", "cron_expr": "0 19 * * 0"},
+		{"action": "pause"},
+	}
+	for _, args := range invalid {
+		if result := tool.Execute(ctx, args); !errors.Is(result.Err, ErrInvalidArgs) {
+			t.Errorf("%v: %+v, want invalid args", args, result)
+		}
+	}
+
+	jobs := s.List("telegram", "42")
+	if len(jobs) != 1 || jobs[0].Schedule.TZ != "Asia/Shanghai" {
+		t.Fatalf("scheduled %+v", jobs)
+	}
+	list := tool.Execute(ctx, map[string]interface{}{"action": "list"})
+	if !strings.Contains(list.ForLLM, jobs[0].ID) || !strings.Contains(list.ForLLM, "0 19 * * 0 Asia/Shanghai") {
+		t.Errorf("list: %s", list.ForLLM)
+	}
+
+	// Other chats neither see nor remove the task.
+	other := NewToolContext(context.Background(), "telegram", "7")
+	if list := tool.Execute(other, map[string]interface{}{"action": "list"}); list.ForLLM != "No tasks scheduled for this chat" {
+		t.Errorf("other chat's list: %s", list.ForLLM)
+	}
+	if result := tool.Execute(other, map[string]interface{}{"action": "remove", "task_id": jobs[0].ID}); !errors.Is(result.Err, ErrNotFound) {
+		t.Errorf("other chat's remove: %+v", result)
+	}
+	if result := tool.Execute(ctx, map[string]interface{}{"action": "remove", "task_id": jobs[0].ID}); result.IsError {
+		t.Errorf("remove: %+v", result)
+	}
+
+	if result := tool.Execute(context.Background(), map[string]interface{}{"action": "list"}); !result.IsError {
+		t.Error("ran without a conversation")
+	}
+}
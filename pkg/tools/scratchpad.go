@@ -0,0 +1,192 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+const scratchpadMaxKeyChars = 64
+
+// ScratchpadStore keeps each session's scratchpad.
+type ScratchpadStore interface {
+	Scratchpad(key string) map[string]string
+	UpdateScratchpad(key string, set map[string]string, remove []string)
+	Save(key string) error
+}
+
+// ScratchpadOptions limits the scratchpad of each session.
+type ScratchpadOptions struct {
+	MaxEntries    int
+	MaxValueChars int
+}
+
+// NewScratchpadTools returns the tools that write and read the working
+// memory of the current conversation.
+func NewScratchpadTools(store ScratchpadStore, opts ScratchpadOptions) []Tool {
+	if opts.MaxEntries <= 0 {
+		opts.MaxEntries = 30
+	}
+	if opts.MaxValueChars <= 0 {
+		opts.MaxValueChars = 300
+	}
+	return []Tool{
+		&ScratchpadWriteTool{store: store, opts: opts},
+		&ScratchpadReadTool{store: store},
+	}
+}
+
+// ScratchpadWriteTool sets and removes notes in the conversation's
+// scratchpad.
+type ScratchpadWriteTool struct {
+	store ScratchpadStore
+	opts  ScratchpadOptions
+}
+
+func (t *ScratchpadWriteTool) Name() string {
+	return "scratchpad_write"
+}
+
+func (t *ScratchpadWriteTool) Description() string {
+	return "Keep short notes in this conversation's scratchpad, which you see at the start of every later turn, even after older messages are summarized. " +
+		"Use it for facts worked out along the way that later answers depend on, such as the patient's parameters (stage, ECOG, CA19-9), " +
+		"the regimen under discussion or the trial IDs the user chose. " +
+		"Each note is a short key and value; writing a key again replaces it. Remove notes that no longer hold. " +
+		"Notes last for this conversation only; facts about the user for later conversations belong in their profile."
+}
+
+func (t *ScratchpadWriteTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"set": map[string]interface{}{
+				"type":                 "object",
+				"additionalProperties": map[string]interface{}{"type": "string"},
+				"description":          "Notes to add or replace, e.g. {\"ecog\": \"1\", \"chosen_trials\": \"NCT04229004, NCT03504423\"}",
+			},
+			"remove": map[string]interface{}{
+				"type":        "array",
+				"items":       map[string]interface{}{"type": "string"},
+				"description": "Keys of notes to remove",
+			},
+		},
+	}
+}
+
+type scratchpadWriteArgs struct {
+	Set    map[string]interface{} `json:"set"`
+	Remove []string               `json:"remove" arg:"max=100"`
+}
+
+func (t *ScratchpadWriteTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	a, err := BindArgs[scratchpadWriteArgs](args)
+	if err != nil {
+		return ErrorResult(err.Error()).WithError(err)
+	}
+	if len(a.Set) == 0 && len(a.Remove) == 0 {
+		return ErrorResult("give notes to set or keys to remove").WithError(ErrInvalidArgs)
+	}
+	key := ToolContextFrom(ctx).SessionKey
+	if key == "" {
+		return ErrorResult("the scratchpad is only available in a conversation").WithError(ErrInvalidArgs)
+	}
+
+	set := make(map[string]string, len(a.Set))
+	for name, raw := range a.Set {
+		name = strings.TrimSpace(name)
+		if name == "" || utf8.RuneCountInString(name) > scratchpadMaxKeyChars {
+			return ErrorResult(fmt.Sprintf("keys must be 1 to %d characters", scratchpadMaxKeyChars)).WithError(ErrInvalidArgs)
+		}
+		var value string
+		switch v := raw.(type) {
+		case string:
+			value = strings.TrimSpace(v)
+		case nil:
+		default:
+			data, _ := json.Marshal(v)
+			value = string(data)
+		}
+		if n := utf8.RuneCountInString(value); n > t.opts.MaxValueChars {
+			return ErrorResult(fmt.Sprintf("the note %q is %d characters; keep notes under %d", name, n, t.opts.MaxValueChars)).
+				WithError(ErrInvalidArgs)
+		}
+		set[name] = value
+	}
+	remove := make([]string, len(a.Remove))
+	for i, name := range a.Remove {
+		remove[i] = strings.TrimSpace(name)
+	}
+
+	// Count the entries the update would leave before making it
+	entries := t.store.Scratchpad(key)
+	if entries == nil {
+		entries = make(map[string]string)
+	}
+	for _, name := range remove {
+		delete(entries, name)
+	}
+	for name, value := range set {
+		if value == "" {
+			delete(entries, name)
+		} else {
+			entries[name] = value
+		}
+	}
+	if len(entries) > t.opts.MaxEntries {
+		return ErrorResult(fmt.Sprintf("the scratchpad holds at most %d notes; remove notes that no longer hold first", t.opts.MaxEntries)).
+			WithError(ErrInvalidArgs)
+	}
+
+	t.store.UpdateScratchpad(key, set, remove)
+	if err := t.store.Save(key); err != nil {
+		return ErrorResult(fmt.Sprintf("scratchpad updated but not saved: %v", err))
+	}
+	return SilentResult(fmt.Sprintf("Scratchpad updated; it holds %d notes.", len(entries)))
+}
+
+// ScratchpadReadTool returns the notes in the conversation's scratchpad.
+type ScratchpadReadTool struct {
+	store ScratchpadStore
+}
+
+func (t *ScratchpadReadTool) Name() string {
+	return "scratchpad_read"
+}
+
+func (t *ScratchpadReadTool) Description() string {
+	return "Read the notes in this conversation's scratchpad. They are also shown at the start of every turn, so call this only to check a note after changing it."
+}
+
+func (t *ScratchpadReadTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type":       "object",
+		"properties": map[string]interface{}{},
+	}
+}
+
+func (t *ScratchpadReadTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	entries := t.store.Scratchpad(ToolContextFrom(ctx).SessionKey)
+	if entries == nil {
+		entries = map[string]string{}
+	}
+	payload, _ := json.Marshal(map[string]interface{}{"notes": entries})
+	return NewToolResult(string(payload))
+}
+
+// ScratchpadLines formats a scratchpad as "key: value" lines, sorted by
+// key, for the system prompt and for users.
+func ScratchpadLines(entries map[string]string) []string {
+	names := make([]string, 0, len(entries))
+	for name := range entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	lines := make([]string, len(names))
+	for i, name := range names {
+		lines[i] = name + ": " + entries[name]
+	}
+	return lines
+}
@@ -0,0 +1,70 @@
+package tools
+
+import (
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/session"
+)
+
+func TestScratchpadTools(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "sessions")
+	sessions := session.NewSessionManager(dir)
+	byName := make(map[string]Tool)
+	for _, tool := range NewScratchpadTools(sessions, ScratchpadOptions{MaxEntries: 3, MaxValueChars: 20}) {
+		byName[tool.Name()] = tool
+	}
+	write, read := byName["scratchpad_write"], byName["scratchpad_read"]
+	ctx := inChat("telegram:42")
+
+	result := write.Execute(ctx, map[string]interface{}{
+		"set": map[string]interface{}{"ecog": 1, " stage ": "III", "ca19_9": "1200 U/mL"},
+	})
+	if result.IsError || !result.Silent {
+		t.Fatalf("write = %+v", result)
+	}
+
+	tests := []struct {
+		name string
+		args map[string]interface{}
+	}{
+		{"nothing to do", map[string]interface{}{}},
+		{"too many notes", map[string]interface{}{"set": map[string]interface{}{"regimen": "mFOLFIRINOX"}}},
+		{"value too long", map[string]interface{}{"set": map[string]interface{}{"stage": strings.Repeat("x", 21)}}},
+		{"blank key", map[string]interface{}{"set": map[string]interface{}{" ": "x"}}},
+	}
+	for _, tt := range tests {
+		if result := write.Execute(ctx, tt.args); !result.IsError || !errors.Is(result.Err, ErrInvalidArgs) {
+			t.Errorf("%s: result = %+v", tt.name, result)
+		}
+	}
+
+	// Replacing and removing in one call stays within the limit.
+	result = write.Execute(ctx, map[string]interface{}{
+		"set":    map[string]interface{}{"regimen": "mFOLFIRINOX", "stage": ""},
+		"remove": []interface{}{"ca19_9"},
+	})
+	if result.IsError {
+		t.Fatalf("replace = %+v", result)
+	}
+
+	var got struct {
+		Notes map[string]string `json:"notes"`
+	}
+	json.Unmarshal([]byte(read.Execute(ctx, nil).ForLLM), &got)
+	if len(got.Notes) != 2 || got.Notes["ecog"] != "1" || got.Notes["regimen"] != "mFOLFIRINOX" {
+		t.Fatalf("notes = %v", got.Notes)
+	}
+	if other := read.Execute(inChat("telegram:7"), nil).ForLLM; other != `{"notes":{}}` {
+		t.Errorf("another chat sees %s", other)
+	}
+
+	// Notes are saved with the session.
+	reloaded := session.NewSessionManager(dir)
+	if lines := ScratchpadLines(reloaded.Scratchpad("telegram:42")); strings.Join(lines, "; ") != "ecog: 1; regimen: mFOLFIRINOX" {
+		t.Errorf("reloaded = %q", lines)
+	}
+}
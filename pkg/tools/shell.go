@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -21,6 +22,8 @@ type ExecTool struct {
 	denyPatterns        []*regexp.Regexp
 	allowPatterns       []*regexp.Regexp
 	restrictToWorkspace bool
+	sandbox             *Sandbox
+	policy              *PathPolicy
 }
 
 var defaultDenyPatterns = []*regexp.Regexp{
@@ -101,13 +104,28 @@ func NewExecToolWithConfig(workingDir string, restrict bool, config *config.Conf
 		denyPatterns = append(denyPatterns, defaultDenyPatterns...)
 	}
 
-	return &ExecTool{
+	t := &ExecTool{
 		workingDir:          workingDir,
 		timeout:             60 * time.Second,
 		denyPatterns:        denyPatterns,
 		allowPatterns:       nil,
 		restrictToWorkspace: restrict,
 	}
+	if config != nil && config.Tools.Exec.Sandbox.Enabled {
+		sb := config.Tools.Exec.Sandbox
+		t.SetSandbox(&Sandbox{
+			Dir:             workingDir,
+			AllowedCommands: sb.AllowedCommands,
+			DeniedCommands:  sb.DeniedCommands,
+			CPUSeconds:      sb.CPUSeconds,
+			MemoryMB:        sb.MemoryMB,
+			AllowNetwork:    sb.AllowNetwork,
+		})
+		if sb.TimeoutSeconds > 0 {
+			t.timeout = time.Duration(sb.TimeoutSeconds) * time.Second
+		}
+	}
+	return t
 }
 
 func (t *ExecTool) Name() string {
@@ -136,16 +154,43 @@ func (t *ExecTool) Parameters() map[string]interface{} {
 }
 
 func (t *ExecTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	return t.ExecuteStream(ctx, args, func(string) {})
+}
+
+// ExecuteStream runs the command, passing its output to emit as it is
+// written.
+func (t *ExecTool) ExecuteStream(ctx context.Context, args map[string]interface{}, emit StreamFunc) *ToolResult {
 	command, ok := args["command"].(string)
 	if !ok {
 		return ErrorResult("command is required")
 	}
 
 	cwd := t.workingDir
-	if wd, ok := args["working_dir"].(string); ok && wd != "" {
+	wd, _ := args["working_dir"].(string)
+	restrict := t.restrictToWorkspace
+	if t.policy != nil {
+		// Commands run within the session's root when the policy has one
+		if wd == "" {
+			wd = "."
+		}
+		dir, err := t.policy.resolve(ctx, wd, t.workingDir, restrict, false)
+		if err != nil {
+			return ErrorResult(err.Error())
+		}
+		cwd, wd = dir, dir
+		restrict = restrict || t.policy.SessionRoots
+	} else if wd != "" {
 		cwd = wd
 	}
 
+	if t.sandbox != nil {
+		dir, err := t.sandbox.resolveDir(wd)
+		if err != nil {
+			return ErrorResult(err.Error())
+		}
+		cwd = dir
+	}
+
 	if cwd == "" {
 		wd, err := os.Getwd()
 		if err == nil {
@@ -153,9 +198,14 @@ func (t *ExecTool) Execute(ctx context.Context, args map[string]interface{}) *To
 		}
 	}
 
-	if guardError := t.guardCommand(command, cwd); guardError != "" {
+	if guardError := t.guardCommand(command, cwd, restrict); guardError != "" {
 		return ErrorResult(guardError)
 	}
+	if t.sandbox != nil {
+		if sandboxError := t.sandbox.checkCommand(command); sandboxError != "" {
+			return ErrorResult(sandboxError)
+		}
+	}
 
 	// timeout == 0 means no timeout
 	var cmdCtx context.Context
@@ -176,10 +226,18 @@ func (t *ExecTool) Execute(ctx context.Context, args map[string]interface{}) *To
 	if cwd != "" {
 		cmd.Dir = cwd
 	}
+	if t.sandbox != nil {
+		var err error
+		if cmd, err = t.sandbox.command(cmd, command, cwd); err != nil {
+			return ErrorResult(err.Error())
+		}
+		// Background processes left behind must not keep the call open.
+		cmd.WaitDelay = time.Second
+	}
 
 	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
+	cmd.Stdout = io.MultiWriter(&stdout, streamWriter{emit})
+	cmd.Stderr = io.MultiWriter(&stderr, streamWriter{emit})
 
 	err := cmd.Run()
 	output := stdout.String()
@@ -223,7 +281,7 @@ func (t *ExecTool) Execute(ctx context.Context, args map[string]interface{}) *To
 	}
 }
 
-func (t *ExecTool) guardCommand(command, cwd string) string {
+func (t *ExecTool) guardCommand(command, cwd string, restrict bool) string {
 	cmd := strings.TrimSpace(command)
 	lower := strings.ToLower(cmd)
 
@@ -246,7 +304,7 @@ func (t *ExecTool) guardCommand(command, cwd string) string {
 		}
 	}
 
-	if t.restrictToWorkspace {
+	if restrict || t.sandbox != nil {
 		if strings.Contains(cmd, "..\\") || strings.Contains(cmd, "../") {
 			return "Command blocked by safety guard (path traversal detected)"
 		}
@@ -287,6 +345,18 @@ func (t *ExecTool) SetRestrictToWorkspace(restrict bool) {
 	t.restrictToWorkspace = restrict
 }
 
+// SetPathPolicy runs commands in the session's root when p has session
+// roots, and checks working_dir against p; nil removes it.
+func (t *ExecTool) SetPathPolicy(p *PathPolicy) {
+	t.policy = p
+}
+
+// SetSandbox confines commands to s, or lifts the confinement when s is
+// nil. Sandboxed commands always get workspace path checks.
+func (t *ExecTool) SetSandbox(s *Sandbox) {
+	t.sandbox = s
+}
+
 func (t *ExecTool) SetAllowPatterns(patterns []string) error {
 	t.allowPatterns = make([]*regexp.Regexp, 0, len(patterns))
 	for _, p := range patterns {
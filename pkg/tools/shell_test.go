@@ -5,6 +5,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -208,3 +209,36 @@ func TestShellTool_RestrictToWorkspace(t *testing.T) {
 		t.Errorf("Expected 'blocked' message for path traversal, got ForLLM: %s, ForUser: %s", result.ForLLM, result.ForUser)
 	}
 }
+
+// TestShellTool_StreamsThroughRegistry verifies output reaches the stream
+// receiver attached to the context
+func TestShellTool_StreamsThroughRegistry(t *testing.T) {
+	registry := NewToolRegistry()
+	registry.Register(NewExecTool("", false))
+
+	var mu sync.Mutex
+	var streamed strings.Builder
+	ctx := WithStream(context.Background(), func(chunk string) {
+		mu.Lock()
+		defer mu.Unlock()
+		streamed.WriteString(chunk)
+	})
+
+	result := registry.Execute(ctx, "exec", map[string]interface{}{
+		"command": "echo step1; echo oops >&2; echo step2",
+	})
+	if result.IsError {
+		t.Fatalf("Expected success, got: %s", result.ForLLM)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, want := range []string{"step1", "oops", "step2"} {
+		if !strings.Contains(streamed.String(), want) {
+			t.Errorf("Expected %q in streamed output, got: %q", want, streamed.String())
+		}
+	}
+	if !strings.Contains(result.ForLLM, "step2") {
+		t.Errorf("Expected the final result to hold the full output, got: %s", result.ForLLM)
+	}
+}
@@ -0,0 +1,669 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	maxSpreadsheetBytes = 20 << 20
+	maxSpreadsheetRows  = 100000
+	// spreadsheetTypeShare is the share of a column's values that must read
+	// as numbers (or dates) for the column to count as numeric (or dates).
+	spreadsheetTypeShare = 0.8
+	maxTrendPoints       = 100
+)
+
+var cellDateLayouts = []string{
+	"2006-01-02", "2006/01/02", "2006.01.02", "2006-1-2", "2006/1/2", "2006.1.2", "2006年1月2日",
+	"2006-01-02 15:04", "2006-01-02 15:04:05", "2006/1/2 15:04", "2006/1/2 15:04:05", time.RFC3339,
+}
+
+// parseCellDate reads a cell written as a date.
+func parseCellDate(s string) (time.Time, bool) {
+	s = strings.TrimSpace(s)
+	for _, layout := range cellDateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// parseCellNumber reads a cell written as a number, allowing thousands
+// separators and a trailing percent sign.
+func parseCellNumber(s string) (float64, bool) {
+	s = strings.TrimSpace(s)
+	s = strings.TrimSuffix(s, "%")
+	if strings.Contains(s, ",") {
+		parts := strings.Split(s, ",")
+		for _, p := range parts[1:] {
+			if len(p) < 3 || p[3:] != "" && p[3] != '.' {
+				return 0, false
+			}
+		}
+		s = strings.Join(parts, "")
+	}
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(n) || math.IsInf(n, 0) {
+		return 0, false
+	}
+	return n, true
+}
+
+// sheetTable is a spreadsheet with a header row.
+type sheetTable struct {
+	headers []string
+	rows    [][]string
+	sheets  []string // sheet names, for workbooks
+}
+
+// column returns the index of the named column, ignoring case and
+// surrounding space, or -1.
+func (t *sheetTable) column(name string) int {
+	name = strings.TrimSpace(name)
+	for i, h := range t.headers {
+		if strings.EqualFold(h, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (t *sheetTable) hasColumn(name string) bool {
+	return t.column(name) >= 0
+}
+
+// rowFunc returns the column lookup expressions evaluate against.
+func (t *sheetTable) rowFunc(row []string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		i := t.column(name)
+		if i < 0 {
+			return "", false
+		}
+		return row[i], true
+	}
+}
+
+// loadSpreadsheet reads a CSV, TSV or XLSX file into a table. The first
+// non-empty row is the header.
+func loadSpreadsheet(path, sheet string) (*sheetTable, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() > maxSpreadsheetBytes {
+		return nil, fmt.Errorf("file is %d MB; the limit is %d MB", info.Size()>>20, maxSpreadsheetBytes>>20)
+	}
+
+	var records [][]string
+	var sheets []string
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".xlsx", ".xlsm":
+		records, sheets, err = readXLSX(path, sheet)
+	case ".xls":
+		return nil, fmt.Errorf("old .xls workbooks are not supported; save the file as .xlsx or CSV")
+	default:
+		records, err = readDelimited(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	table := &sheetTable{sheets: sheets}
+	for _, rec := range records {
+		empty := true
+		for _, cell := range rec {
+			if strings.TrimSpace(cell) != "" {
+				empty = false
+				break
+			}
+		}
+		if empty {
+			continue
+		}
+		if table.headers == nil {
+			table.headers = spreadsheetHeaders(rec)
+			continue
+		}
+		if len(table.rows) == maxSpreadsheetRows {
+			return nil, fmt.Errorf("more than %d rows", maxSpreadsheetRows)
+		}
+		row := make([]string, len(table.headers))
+		for i := range row {
+			if i < len(rec) {
+				row[i] = strings.TrimSpace(rec[i])
+			}
+		}
+		table.rows = append(table.rows, row)
+	}
+	if table.headers == nil {
+		return nil, fmt.Errorf("the sheet is empty")
+	}
+	return table, nil
+}
+
+// spreadsheetHeaders names unnamed columns column_N and makes duplicate
+// names unique.
+func spreadsheetHeaders(rec []string) []string {
+	headers := make([]string, len(rec))
+	seen := make(map[string]int)
+	for i, h := range rec {
+		h = strings.TrimSpace(h)
+		if h == "" {
+			h = fmt.Sprintf("column_%d", i+1)
+		}
+		key := strings.ToLower(h)
+		seen[key]++
+		if n := seen[key]; n > 1 {
+			h = fmt.Sprintf("%s_%d", h, n)
+		}
+		headers[i] = h
+	}
+	return headers
+}
+
+// readDelimited reads a CSV or TSV file, guessing the delimiter from the
+// first line.
+func readDelimited(path string) ([][]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	first, _, _ := bytes.Cut(data, []byte("\n"))
+	delimiter := ','
+	for _, d := range []rune{'\t', ';'} {
+		if bytes.Count(first, []byte(string(d))) > bytes.Count(first, []byte(string(delimiter))) {
+			delimiter = d
+		}
+	}
+	r := csv.NewReader(bytes.NewReader(data))
+	r.Comma = delimiter
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = true
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("not a valid CSV file: %w", err)
+	}
+	return records, nil
+}
+
+// SpreadsheetTool analyzes CSV and Excel files in the workspace, so that
+// statistics and trends come from computation rather than the model
+// reading numbers.
+type SpreadsheetTool struct {
+	workspace string
+	restrict  bool
+	policy    *PathPolicy
+}
+
+func NewSpreadsheetTool(workspace string, restrict bool) *SpreadsheetTool {
+	return &SpreadsheetTool{workspace: workspace, restrict: restrict}
+}
+
+// SetPathPolicy applies p's limits; nil removes them.
+func (t *SpreadsheetTool) SetPathPolicy(p *PathPolicy) {
+	t.policy = p
+}
+
+func (t *SpreadsheetTool) Name() string {
+	return "spreadsheet_analyze"
+}
+
+func (t *SpreadsheetTool) Description() string {
+	return "Analyze a CSV or Excel (.xlsx) file in the workspace, such as a caregiver's lab value log. " +
+		"action=summary lists the columns with their types and statistics; action=query returns rows matching a filter, with optional computed columns; " +
+		"action=trend computes how a numeric column changes over a date column. " +
+		"Expressions use column names (`backticks` for names with spaces or symbols, e.g. `CA19-9`), quoted strings, numbers, + - * /, = != < <= > >=, contains, and, or, not. " +
+		"Always use this tool for numbers in a spreadsheet instead of calculating them yourself."
+}
+
+func (t *SpreadsheetTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"path": map[string]interface{}{
+				"type":        "string",
+				"description": "Path to the .csv, .tsv or .xlsx file",
+			},
+			"sheet": map[string]interface{}{
+				"type":        "string",
+				"description": "Worksheet name for .xlsx files (default: the first sheet)",
+			},
+			"action": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"summary", "query", "trend"},
+				"description": "What to compute (default summary)",
+			},
+			"filter": map[string]interface{}{
+				"type":        "string",
+				"description": "Only use rows where this expression is true, e.g. `CA19-9` > 37 and date >= '2026-01-01'",
+			},
+			"columns": map[string]interface{}{
+				"type":        "array",
+				"items":       map[string]interface{}{"type": "string"},
+				"description": "For query: columns to return, or computed columns written as \"expression as name\", e.g. \"`CA19-9` / 37 as times_upper_limit\"",
+			},
+			"sort_by": map[string]interface{}{
+				"type":        "string",
+				"description": "For query: column or computed column name to sort by",
+			},
+			"descending": map[string]interface{}{
+				"type":        "boolean",
+				"description": "For query: sort largest or latest first",
+			},
+			"limit": map[string]interface{}{
+				"type":        "integer",
+				"description": "For query: maximum rows to return (1-200, default 20)",
+			},
+			"column": map[string]interface{}{
+				"type":        "string",
+				"description": "For trend: the numeric column",
+			},
+			"date_column": map[string]interface{}{
+				"type":        "string",
+				"description": "For trend: the date column (default: the first column of dates)",
+			},
+		},
+		"required": []string{"path"},
+	}
+}
+
+type spreadsheetArgs struct {
+	Path       string   `json:"path" arg:"required"`
+	Sheet      string   `json:"sheet"`
+	Action     string   `json:"action" arg:"default=summary,enum=summary|query|trend"`
+	Filter     string   `json:"filter"`
+	Columns    []string `json:"columns"`
+	SortBy     string   `json:"sort_by"`
+	Descending bool     `json:"descending"`
+	Limit      int      `json:"limit" arg:"default=20,min=1,max=200"`
+	Column     string   `json:"column"`
+	DateColumn string   `json:"date_column"`
+}
+
+func (t *SpreadsheetTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	a, err := BindArgs[spreadsheetArgs](args)
+	if err != nil {
+		return ErrorResult(err.Error()).WithError(err)
+	}
+	path, err := t.policy.resolve(ctx, a.Path, t.workspace, t.restrict, true)
+	if err != nil {
+		return ErrorResult(err.Error()).WithError(ClassifyError(ErrInvalidArgs, err))
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("file not found: %s", a.Path)).WithError(ClassifyError(ErrNotFound, err))
+	}
+	if err := t.policy.checkSize(info.Size()); err != nil {
+		return ErrorResult(err.Error()).WithError(ClassifyError(ErrInvalidArgs, err))
+	}
+	table, err := loadSpreadsheet(path, a.Sheet)
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("cannot read %s: %v", a.Path, err)).WithError(ClassifyError(ErrInvalidArgs, err))
+	}
+
+	rows := table.rows
+	if a.Filter != "" {
+		filter, err := parseExpr(a.Filter, table.hasColumn)
+		if err != nil {
+			return spreadsheetExprError(err, table)
+		}
+		rows = nil
+		for _, row := range table.rows {
+			v, err := filter.eval(table.rowFunc(row))
+			if err != nil {
+				return spreadsheetExprError(err, table)
+			}
+			if v.truthy() {
+				rows = append(rows, row)
+			}
+		}
+	}
+
+	var out map[string]interface{}
+	switch a.Action {
+	case "query":
+		out, err = querySpreadsheet(table, rows, a)
+	case "trend":
+		out, err = spreadsheetTrend(table, rows, a.Column, a.DateColumn)
+	default:
+		out = summarizeSpreadsheet(table, rows)
+	}
+	if err != nil {
+		return spreadsheetExprError(err, table)
+	}
+	out["file"] = a.Path
+	if len(table.sheets) > 1 {
+		out["sheets"] = table.sheets
+	}
+	if a.Filter != "" {
+		out["filter"] = a.Filter
+		out["rows_matched"] = len(rows)
+	}
+	out["rows_total"] = len(table.rows)
+	payload, _ := json.Marshal(out)
+	return NewToolResult(string(payload))
+}
+
+func spreadsheetExprError(err error, table *sheetTable) *ToolResult {
+	return ErrorResult(fmt.Sprintf("%v (columns: %s)", err, strings.Join(table.headers, ", "))).
+		WithError(ClassifyError(ErrInvalidArgs, err))
+}
+
+// summarizeSpreadsheet describes each column and previews the first rows.
+func summarizeSpreadsheet(table *sheetTable, rows [][]string) map[string]interface{} {
+	columns := make([]map[string]interface{}, len(table.headers))
+	for i, name := range table.headers {
+		columns[i] = describeColumn(name, rows, i)
+	}
+	preview := rows
+	if len(preview) > 5 {
+		preview = preview[:5]
+	}
+	return map[string]interface{}{
+		"columns": columns,
+		"preview": map[string]interface{}{"headers": table.headers, "rows": preview},
+	}
+}
+
+// describeColumn infers a column's type and summarizes its values.
+func describeColumn(name string, rows [][]string, col int) map[string]interface{} {
+	var values []string
+	var numbers []float64
+	var dates []time.Time
+	for _, row := range rows {
+		v := row[col]
+		if v == "" {
+			continue
+		}
+		values = append(values, v)
+		if n, ok := parseCellNumber(v); ok {
+			numbers = append(numbers, n)
+		} else if d, ok := parseCellDate(v); ok {
+			dates = append(dates, d)
+		}
+	}
+	out := map[string]interface{}{"name": name, "non_empty": len(values)}
+	share := func(n int) float64 { return float64(n) / float64(max(len(values), 1)) }
+
+	switch {
+	case len(values) == 0:
+		out["type"] = "empty"
+	case share(len(numbers)) >= spreadsheetTypeShare:
+		out["type"] = "number"
+		sorted := append([]float64(nil), numbers...)
+		sort.Float64s(sorted)
+		out["min"] = roundStat(sorted[0])
+		out["max"] = roundStat(sorted[len(sorted)-1])
+		out["mean"] = roundStat(mean(sorted))
+		out["median"] = roundStat(median(sorted))
+		if skipped := len(values) - len(numbers); skipped > 0 {
+			out["non_numeric"] = skipped
+		}
+	case share(len(dates)) >= spreadsheetTypeShare:
+		out["type"] = "date"
+		sort.Slice(dates, func(i, j int) bool { return dates[i].Before(dates[j]) })
+		out["first"] = dates[0].Format("2006-01-02")
+		out["last"] = dates[len(dates)-1].Format("2006-01-02")
+	default:
+		out["type"] = "text"
+		counts := make(map[string]int)
+		for _, v := range values {
+			counts[v]++
+		}
+		distinct := make([]string, 0, len(counts))
+		for v := range counts {
+			distinct = append(distinct, v)
+		}
+		sort.Slice(distinct, func(i, j int) bool {
+			if counts[distinct[i]] != counts[distinct[j]] {
+				return counts[distinct[i]] > counts[distinct[j]]
+			}
+			return distinct[i] < distinct[j]
+		})
+		out["distinct"] = len(distinct)
+		top := make([]map[string]interface{}, 0, 5)
+		for _, v := range distinct[:min(len(distinct), 5)] {
+			top = append(top, map[string]interface{}{"value": v, "count": counts[v]})
+		}
+		out["top_values"] = top
+	}
+	return out
+}
+
+func median(sorted []float64) float64 {
+	n := len(sorted)
+	if n%2 == 1 {
+		return sorted[n/2]
+	}
+	return (sorted[n/2-1] + sorted[n/2]) / 2
+}
+
+// spreadsheetColumn is a returned column: a table column or an expression.
+type spreadsheetColumn struct {
+	name string
+	expr exprNode
+}
+
+// querySpreadsheet returns the selected and computed columns of rows,
+// sorted and limited.
+func querySpreadsheet(table *sheetTable, rows [][]string, a spreadsheetArgs) (map[string]interface{}, error) {
+	var columns []spreadsheetColumn
+	if len(a.Columns) == 0 {
+		for _, h := range table.headers {
+			columns = append(columns, spreadsheetColumn{h, exprColumn{h}})
+		}
+	}
+	for _, spec := range a.Columns {
+		src, name := spec, strings.TrimSpace(spec)
+		if i := strings.LastIndex(strings.ToLower(spec), " as "); i >= 0 {
+			src, name = spec[:i], strings.Trim(strings.TrimSpace(spec[i+4:]), "`")
+		} else if table.hasColumn(name) {
+			columns = append(columns, spreadsheetColumn{table.headers[table.column(name)], exprColumn{name}})
+			continue
+		}
+		expr, err := parseExpr(src, table.hasColumn)
+		if err != nil {
+			return nil, err
+		}
+		columns = append(columns, spreadsheetColumn{name, expr})
+	}
+
+	sortCol := -1
+	if a.SortBy != "" {
+		for i, c := range columns {
+			if strings.EqualFold(c.name, strings.Trim(a.SortBy, "`")) {
+				sortCol = i
+			}
+		}
+		if sortCol < 0 {
+			if !table.hasColumn(strings.Trim(a.SortBy, "`")) {
+				return nil, fmt.Errorf("unknown sort column %q", a.SortBy)
+			}
+			columns = append(columns, spreadsheetColumn{table.headers[table.column(strings.Trim(a.SortBy, "`"))], exprColumn{strings.Trim(a.SortBy, "`")}})
+			sortCol = len(columns) - 1
+		}
+	}
+
+	values := make([][]cellValue, len(rows))
+	for r, row := range rows {
+		values[r] = make([]cellValue, len(columns))
+		for c, col := range columns {
+			v, err := col.expr.eval(table.rowFunc(row))
+			if err != nil {
+				return nil, err
+			}
+			values[r][c] = v
+		}
+	}
+	if sortCol >= 0 {
+		sort.SliceStable(values, func(i, j int) bool {
+			l, r := values[i][sortCol], values[j][sortCol]
+			switch {
+			case l.kind == 0 || r.kind == 0:
+				return l.kind != 0 // empty cells last
+			case a.Descending:
+				return compareValues(l, r) > 0
+			}
+			return compareValues(l, r) < 0
+		})
+	}
+
+	names := make([]string, len(columns))
+	for i, c := range columns {
+		names[i] = c.name
+	}
+	limited := values[:min(len(values), a.Limit)]
+	out := make([][]interface{}, len(limited))
+	for r, row := range limited {
+		out[r] = make([]interface{}, len(row))
+		for c, v := range row {
+			switch v.kind {
+			case 'n':
+				if v.str != "" {
+					out[r][c] = v.num
+				} else {
+					out[r][c] = roundStat(v.num)
+				}
+			case 'b':
+				out[r][c] = v.num != 0
+			case 's':
+				out[r][c] = v.str
+			}
+		}
+	}
+	result := map[string]interface{}{"columns": names, "rows": out}
+	if len(values) > len(limited) {
+		result["truncated"] = fmt.Sprintf("showing %d of %d rows", len(limited), len(values))
+	}
+	return result, nil
+}
+
+// spreadsheetTrend describes how a numeric column changes over time.
+func spreadsheetTrend(table *sheetTable, rows [][]string, column, dateColumn string) (map[string]interface{}, error) {
+	valueCol := table.column(strings.Trim(column, "`"))
+	if column == "" || valueCol < 0 {
+		return nil, fmt.Errorf("trend needs column, one of the table's columns; got %q", column)
+	}
+	dateCol := -1
+	if dateColumn != "" {
+		if dateCol = table.column(strings.Trim(dateColumn, "`")); dateCol < 0 {
+			return nil, fmt.Errorf("unknown date column %q", dateColumn)
+		}
+	} else {
+		for i, name := range table.headers {
+			if describeColumn(name, rows, i)["type"] == "date" {
+				dateCol = i
+				break
+			}
+		}
+		if dateCol < 0 {
+			return nil, fmt.Errorf("no column of dates found; pass date_column")
+		}
+	}
+
+	type point struct {
+		date  time.Time
+		value float64
+	}
+	var points []point
+	skipped := 0
+	for _, row := range rows {
+		d, okDate := parseCellDate(row[dateCol])
+		v, okValue := parseCellNumber(row[valueCol])
+		if !okDate || !okValue {
+			if row[valueCol] != "" || row[dateCol] != "" {
+				skipped++
+			}
+			continue
+		}
+		points = append(points, point{d, v})
+	}
+	if len(points) == 0 {
+		return nil, fmt.Errorf("no rows have both a date in %s and a number in %s", table.headers[dateCol], table.headers[valueCol])
+	}
+	sort.SliceStable(points, func(i, j int) bool { return points[i].date.Before(points[j].date) })
+
+	day := func(p point) string { return p.date.Format("2006-01-02") }
+	first, last := points[0], points[len(points)-1]
+	lo, hi := first, first
+	for _, p := range points {
+		if p.value < lo.value {
+			lo = p
+		}
+		if p.value > hi.value {
+			hi = p
+		}
+	}
+	out := map[string]interface{}{
+		"column":      table.headers[valueCol],
+		"date_column": table.headers[dateCol],
+		"points":      len(points),
+		"first":       map[string]interface{}{"date": day(first), "value": first.value},
+		"last":        map[string]interface{}{"date": day(last), "value": last.value},
+		"min":         map[string]interface{}{"date": day(lo), "value": lo.value},
+		"max":         map[string]interface{}{"date": day(hi), "value": hi.value},
+		"change":      roundStat(last.value - first.value),
+	}
+	if first.value != 0 {
+		out["change_pct"] = roundStat((last.value - first.value) / math.Abs(first.value) * 100)
+	}
+	if len(points) >= 2 {
+		prev := points[len(points)-2]
+		out["previous"] = map[string]interface{}{"date": day(prev), "value": prev.value}
+	}
+
+	// Least-squares slope over days since the first point.
+	var xs, ys []float64
+	for _, p := range points {
+		xs = append(xs, p.date.Sub(first.date).Hours()/24)
+		ys = append(ys, p.value)
+	}
+	mx, my := mean(xs), mean(ys)
+	var sxy, sxx float64
+	for i := range xs {
+		sxy += (xs[i] - mx) * (ys[i] - my)
+		sxx += (xs[i] - mx) * (xs[i] - mx)
+	}
+	if len(points) >= 3 && sxx > 0 {
+		slope := sxy / sxx
+		out["slope_per_30_days"] = roundStat(slope * 30)
+		// A fitted change under 5% of the typical value counts as stable.
+		fitted := slope * (xs[len(xs)-1] - xs[0])
+		switch {
+		case math.Abs(fitted) < 0.05*math.Abs(my):
+			out["direction"] = "stable"
+		case fitted > 0:
+			out["direction"] = "rising"
+		default:
+			out["direction"] = "falling"
+		}
+	}
+	if skipped > 0 {
+		out["rows_skipped"] = skipped
+	}
+
+	series := points
+	if len(series) > maxTrendPoints {
+		series = series[len(series)-maxTrendPoints:]
+		out["series_note"] = fmt.Sprintf("series shows the last %d points", maxTrendPoints)
+	}
+	values := make([][]interface{}, len(series))
+	for i, p := range series {
+		values[i] = []interface{}{day(p), p.value}
+	}
+	out["series"] = values
+	return out, nil
+}
@@ -0,0 +1,407 @@
+package tools
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Spreadsheet expressions are small formulas over one row, used to filter
+// rows ("CA199 > 37 and date >= '2026-01-01'") and to compute columns
+// ("ratio = CA199 / CEA"). Columns are bare names or `backticked` when
+// they contain spaces or symbols; strings are single or double quoted.
+//
+// Operators, loosest first: or, and, not, comparisons (= != < <= > >=
+// contains), + -, * /, unary minus. Numbers compare as numbers, dates as
+// dates and anything else as case-insensitive text. Arithmetic or an
+// ordered comparison with an empty cell is empty, and empty is false.
+
+type exprNode interface {
+	eval(row func(column string) (string, bool)) (cellValue, error)
+}
+
+// cellValue is an expression value: a number, text, boolean or empty.
+type cellValue struct {
+	kind byte // 'n' number, 's' text, 'b' boolean, 0 empty
+	num  float64
+	str  string
+}
+
+func (v cellValue) truthy() bool {
+	switch v.kind {
+	case 'b', 'n':
+		return v.num != 0
+	case 's':
+		return v.str != ""
+	}
+	return false
+}
+
+func (v cellValue) String() string {
+	switch v.kind {
+	case 'n':
+		return strconv.FormatFloat(v.num, 'f', -1, 64)
+	case 'b':
+		return strconv.FormatBool(v.num != 0)
+	}
+	return v.str
+}
+
+func boolValue(b bool) cellValue {
+	if b {
+		return cellValue{kind: 'b', num: 1}
+	}
+	return cellValue{kind: 'b'}
+}
+
+// textValue turns a cell into a number when it reads as one.
+func textValue(s string) cellValue {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return cellValue{}
+	}
+	if n, ok := parseCellNumber(s); ok {
+		return cellValue{kind: 'n', num: n, str: s}
+	}
+	return cellValue{kind: 's', str: s}
+}
+
+type exprLiteral struct{ v cellValue }
+
+func (e exprLiteral) eval(func(string) (string, bool)) (cellValue, error) { return e.v, nil }
+
+type exprColumn struct{ name string }
+
+func (e exprColumn) eval(row func(string) (string, bool)) (cellValue, error) {
+	s, ok := row(e.name)
+	if !ok {
+		return cellValue{}, fmt.Errorf("unknown column %q", e.name)
+	}
+	return textValue(s), nil
+}
+
+type exprUnary struct {
+	op string
+	x  exprNode
+}
+
+func (e exprUnary) eval(row func(string) (string, bool)) (cellValue, error) {
+	v, err := e.x.eval(row)
+	if err != nil {
+		return v, err
+	}
+	if e.op == "not" {
+		return boolValue(!v.truthy()), nil
+	}
+	if v.kind != 'n' {
+		return cellValue{}, nil
+	}
+	return cellValue{kind: 'n', num: -v.num}, nil
+}
+
+type exprBinary struct {
+	op   string
+	l, r exprNode
+}
+
+func (e exprBinary) eval(row func(string) (string, bool)) (cellValue, error) {
+	l, err := e.l.eval(row)
+	if err != nil {
+		return l, err
+	}
+	switch e.op {
+	case "and":
+		if !l.truthy() {
+			return boolValue(false), nil
+		}
+		r, err := e.r.eval(row)
+		return boolValue(r.truthy()), err
+	case "or":
+		if l.truthy() {
+			return boolValue(true), nil
+		}
+		r, err := e.r.eval(row)
+		return boolValue(r.truthy()), err
+	}
+	r, err := e.r.eval(row)
+	if err != nil {
+		return r, err
+	}
+
+	switch e.op {
+	case "+", "-", "*", "/":
+		if l.kind != 'n' || r.kind != 'n' {
+			return cellValue{}, nil
+		}
+		var n float64
+		switch e.op {
+		case "+":
+			n = l.num + r.num
+		case "-":
+			n = l.num - r.num
+		case "*":
+			n = l.num * r.num
+		case "/":
+			if r.num == 0 {
+				return cellValue{}, nil
+			}
+			n = l.num / r.num
+		}
+		return cellValue{kind: 'n', num: n}, nil
+	case "contains":
+		return boolValue(l.kind != 0 && strings.Contains(strings.ToLower(l.String()), strings.ToLower(r.String()))), nil
+	}
+
+	if l.kind == 0 || r.kind == 0 {
+		// Only equality is meaningful with an empty cell.
+		switch e.op {
+		case "=":
+			return boolValue(l.kind == r.kind), nil
+		case "!=":
+			return boolValue(l.kind != r.kind), nil
+		}
+		return boolValue(false), nil
+	}
+	cmp := compareValues(l, r)
+	switch e.op {
+	case "=":
+		return boolValue(cmp == 0), nil
+	case "!=":
+		return boolValue(cmp != 0), nil
+	case "<":
+		return boolValue(cmp < 0), nil
+	case "<=":
+		return boolValue(cmp <= 0), nil
+	case ">":
+		return boolValue(cmp > 0), nil
+	case ">=":
+		return boolValue(cmp >= 0), nil
+	}
+	return cellValue{}, fmt.Errorf("unknown operator %q", e.op)
+}
+
+// compareValues orders two non-empty values as numbers, dates or text.
+func compareValues(l, r cellValue) int {
+	if l.kind == 'n' && r.kind == 'n' {
+		switch {
+		case l.num < r.num:
+			return -1
+		case l.num > r.num:
+			return 1
+		}
+		return 0
+	}
+	if lt, ok := parseCellDate(l.String()); ok {
+		if rt, ok := parseCellDate(r.String()); ok {
+			return lt.Compare(rt)
+		}
+	}
+	return strings.Compare(strings.ToLower(l.String()), strings.ToLower(r.String()))
+}
+
+type exprToken struct {
+	kind byte // 'n' number, 's' string, 'i' identifier, 'o' operator, 0 end
+	text string
+}
+
+func tokenizeExpr(src string) ([]exprToken, error) {
+	var tokens []exprToken
+	runes := []rune(src)
+	for i := 0; i < len(runes); {
+		c := runes[i]
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '\'' || c == '"' || c == '`':
+			j := i + 1
+			for j < len(runes) && runes[j] != c {
+				j++
+			}
+			if j == len(runes) {
+				return nil, fmt.Errorf("unterminated %c", c)
+			}
+			kind := byte('s')
+			if c == '`' {
+				kind = 'i'
+			}
+			tokens = append(tokens, exprToken{kind, string(runes[i+1 : j])})
+			i = j + 1
+		case unicode.IsDigit(c) || c == '.' && i+1 < len(runes) && unicode.IsDigit(runes[i+1]):
+			j := i
+			for j < len(runes) && (unicode.IsDigit(runes[j]) || runes[j] == '.') {
+				j++
+			}
+			tokens = append(tokens, exprToken{'n', string(runes[i:j])})
+			i = j
+		case unicode.IsLetter(c) || c == '_':
+			j := i
+			for j < len(runes) && (unicode.IsLetter(runes[j]) || unicode.IsDigit(runes[j]) || runes[j] == '_') {
+				j++
+			}
+			word := string(runes[i:j])
+			switch strings.ToLower(word) {
+			case "and", "or", "not", "contains":
+				tokens = append(tokens, exprToken{'o', strings.ToLower(word)})
+			default:
+				tokens = append(tokens, exprToken{'i', word})
+			}
+			i = j
+		default:
+			op := string(c)
+			if i+1 < len(runes) {
+				switch two := string(runes[i : i+2]); two {
+				case "<=", ">=", "!=", "<>", "==", "&&", "||":
+					op = two
+				}
+			}
+			i += len(op)
+			switch op {
+			case "==":
+				op = "="
+			case "<>":
+				op = "!="
+			case "&&":
+				op = "and"
+			case "||":
+				op = "or"
+			case "!":
+				op = "not"
+			case "+", "-", "*", "/", "(", ")", "=", "<", ">", "<=", ">=", "!=":
+			default:
+				return nil, fmt.Errorf("unexpected %q", op)
+			}
+			tokens = append(tokens, exprToken{'o', op})
+		}
+	}
+	return tokens, nil
+}
+
+// exprParser is a precedence-climbing parser over the tokens.
+type exprParser struct {
+	tokens []exprToken
+	pos    int
+}
+
+func (p *exprParser) peek() exprToken {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return exprToken{}
+}
+
+func (p *exprParser) next() exprToken {
+	t := p.peek()
+	p.pos++
+	return t
+}
+
+// exprLevels are the binary operators by precedence, loosest first.
+var exprLevels = [][]string{
+	{"or"},
+	{"and"},
+	nil, // not
+	{"=", "!=", "<", "<=", ">", ">=", "contains"},
+	{"+", "-"},
+	{"*", "/"},
+}
+
+func (p *exprParser) parse(level int) (exprNode, error) {
+	if level == len(exprLevels) {
+		return p.primary()
+	}
+	if exprLevels[level] == nil {
+		if t := p.peek(); t.kind == 'o' && t.text == "not" {
+			p.next()
+			x, err := p.parse(level)
+			return exprUnary{"not", x}, err
+		}
+		return p.parse(level + 1)
+	}
+	left, err := p.parse(level + 1)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		if t.kind != 'o' || indexOf(exprLevels[level], t.text) < 0 {
+			return left, nil
+		}
+		p.next()
+		right, err := p.parse(level + 1)
+		if err != nil {
+			return nil, err
+		}
+		left = exprBinary{t.text, left, right}
+	}
+}
+
+func (p *exprParser) primary() (exprNode, error) {
+	t := p.next()
+	switch t.kind {
+	case 'n':
+		n, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q", t.text)
+		}
+		return exprLiteral{cellValue{kind: 'n', num: n}}, nil
+	case 's':
+		return exprLiteral{textValue(t.text)}, nil
+	case 'i':
+		switch strings.ToLower(t.text) {
+		case "true":
+			return exprLiteral{boolValue(true)}, nil
+		case "false":
+			return exprLiteral{boolValue(false)}, nil
+		}
+		return exprColumn{t.text}, nil
+	case 'o':
+		switch t.text {
+		case "(":
+			x, err := p.parse(0)
+			if err != nil {
+				return nil, err
+			}
+			if p.next().text != ")" {
+				return nil, fmt.Errorf("missing )")
+			}
+			return x, nil
+		case "-":
+			x, err := p.primary()
+			return exprUnary{"-", x}, err
+		}
+		return nil, fmt.Errorf("unexpected %q", t.text)
+	}
+	return nil, fmt.Errorf("unexpected end of expression")
+}
+
+// parseExpr compiles src and checks that every column it names exists.
+func parseExpr(src string, hasColumn func(string) bool) (exprNode, error) {
+	tokens, err := tokenizeExpr(src)
+	if err != nil {
+		return nil, fmt.Errorf("invalid expression %q: %w", src, err)
+	}
+	p := &exprParser{tokens: tokens}
+	node, err := p.parse(0)
+	if err == nil && p.pos < len(tokens) {
+		err = fmt.Errorf("unexpected %q", tokens[p.pos].text)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid expression %q: %w", src, err)
+	}
+	for _, t := range tokens {
+		if t.kind == 'i' && !hasColumn(t.text) && !strings.EqualFold(t.text, "true") && !strings.EqualFold(t.text, "false") {
+			return nil, fmt.Errorf("invalid expression %q: unknown column %q", src, t.text)
+		}
+	}
+	return node, nil
+}
+
+// roundStat rounds a computed statistic for display.
+func roundStat(v float64) float64 {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return 0
+	}
+	return math.Round(v*1000) / 1000
+}
@@ -0,0 +1,193 @@
+package tools
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const labCSV = "\xef\xbb\xbf日期,CA19-9,CEA,备注\n" +
+	"2026-01-05,1250.6,3.1,化疗前\n" +
+	"2026-02-02,820,2.9,\n" +
+	"\n" +
+	"2026-03-02,410.5,2.7,第3周期\n" +
+	"2026-04-06,\"1,020\",3.4,复查CT\n"
+
+func spreadsheetTestTool(t *testing.T) (*SpreadsheetTool, string) {
+	t.Helper()
+	workspace := t.TempDir()
+	if err := os.WriteFile(filepath.Join(workspace, "labs.csv"), []byte(labCSV), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return NewSpreadsheetTool(workspace, true), workspace
+}
+
+func runSpreadsheet(t *testing.T, tool *SpreadsheetTool, args map[string]interface{}, out interface{}) {
+	t.Helper()
+	result := tool.Execute(context.Background(), args)
+	if result.IsError {
+		t.Fatalf("spreadsheet_analyze(%v): %s", args, result.ForLLM)
+	}
+	if err := json.Unmarshal([]byte(result.ForLLM), out); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, result.ForLLM)
+	}
+}
+
+func TestSpreadsheet_Summary(t *testing.T) {
+	tool, _ := spreadsheetTestTool(t)
+	var out struct {
+		RowsTotal int                      `json:"rows_total"`
+		Columns   []map[string]interface{} `json:"columns"`
+	}
+	runSpreadsheet(t, tool, map[string]interface{}{"path": "labs.csv"}, &out)
+	if out.RowsTotal != 4 || len(out.Columns) != 4 {
+		t.Fatalf("summary = %+v", out)
+	}
+	date, ca199, note := out.Columns[0], out.Columns[1], out.Columns[3]
+	if date["type"] != "date" || date["first"] != "2026-01-05" || date["last"] != "2026-04-06" {
+		t.Errorf("date column = %v", date)
+	}
+	if ca199["type"] != "number" || ca199["max"] != 1250.6 || ca199["median"] != 920.0 {
+		t.Errorf("CA19-9 column = %v", ca199)
+	}
+	if note["type"] != "text" || note["non_empty"] != 3.0 {
+		t.Errorf("note column = %v", note)
+	}
+}
+
+func TestSpreadsheet_Query(t *testing.T) {
+	tool, _ := spreadsheetTestTool(t)
+	var out struct {
+		RowsMatched int             `json:"rows_matched"`
+		Columns     []string        `json:"columns"`
+		Rows        [][]interface{} `json:"rows"`
+	}
+	runSpreadsheet(t, tool, map[string]interface{}{
+		"path":       "labs.csv",
+		"action":     "query",
+		"filter":     "`CA19-9` > 37 * 20 and 日期 >= '2026-02-01'",
+		"columns":    []interface{}{"日期", "`CA19-9` / 37 as times_uln"},
+		"sort_by":    "times_uln",
+		"descending": true,
+	}, &out)
+	if out.RowsMatched != 2 || len(out.Rows) != 2 {
+		t.Fatalf("query = %+v", out)
+	}
+	if out.Columns[1] != "times_uln" || out.Rows[0][0] != "2026-04-06" || out.Rows[0][1] != 27.568 {
+		t.Errorf("rows = %v", out.Rows)
+	}
+}
+
+func TestSpreadsheet_Trend(t *testing.T) {
+	tool, _ := spreadsheetTestTool(t)
+	var out struct {
+		Points    int                    `json:"points"`
+		Change    float64                `json:"change"`
+		ChangePct float64                `json:"change_pct"`
+		Min       map[string]interface{} `json:"min"`
+		Direction string                 `json:"direction"`
+		Series    [][]interface{}        `json:"series"`
+	}
+	runSpreadsheet(t, tool, map[string]interface{}{"path": "labs.csv", "action": "trend", "column": "ca19-9"}, &out)
+	if out.Points != 4 || out.Change != -230.6 || out.ChangePct != -18.439 {
+		t.Errorf("trend = %+v", out)
+	}
+	if out.Min["date"] != "2026-03-02" || out.Direction != "falling" || len(out.Series) != 4 {
+		t.Errorf("trend = %+v", out)
+	}
+}
+
+func TestSpreadsheet_Errors(t *testing.T) {
+	tool, workspace := spreadsheetTestTool(t)
+	os.WriteFile(filepath.Join(workspace, "old.xls"), []byte("x"), 0644)
+	tests := []struct {
+		name string
+		args map[string]interface{}
+		text string
+	}{
+		{"unknown column", map[string]interface{}{"path": "labs.csv", "filter": "CA199 > 37"}, "unknown column \"CA199\""},
+		{"bad expression", map[string]interface{}{"path": "labs.csv", "filter": "CEA >"}, "invalid expression"},
+		{"trend without column", map[string]interface{}{"path": "labs.csv", "action": "trend"}, "trend needs column"},
+		{"xls", map[string]interface{}{"path": "old.xls"}, "save the file as .xlsx"},
+		{"outside workspace", map[string]interface{}{"path": "../labs.csv"}, "access denied"},
+	}
+	for _, tt := range tests {
+		result := tool.Execute(context.Background(), tt.args)
+		if !result.IsError || !errors.Is(result.Err, ErrInvalidArgs) || !strings.Contains(result.ForLLM, tt.text) {
+			t.Errorf("%s: %+v", tt.name, result)
+		}
+	}
+}
+
+func TestExprEvaluation(t *testing.T) {
+	row := map[string]string{"a": "4", "b": "", "name": "Creon 25000", "date": "2026/3/1"}
+	lookup := func(c string) (string, bool) { v, ok := row[c]; return v, ok }
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"a * 2 + 1", "9"},
+		{"-(a - 6) / 4", "0.5"},
+		{"a / 0", ""},
+		{"b > 1", "false"},
+		{"b = ''", "true"},
+		{"not (a > 3) or name contains 'creon'", "true"},
+		{"a >= 4 && date < '2026-03-02'", "true"},
+		{"a <> 4", "false"},
+	}
+	for _, tt := range tests {
+		node, err := parseExpr(tt.expr, func(c string) bool { _, ok := row[c]; return ok })
+		if err != nil {
+			t.Errorf("parseExpr(%q): %v", tt.expr, err)
+			continue
+		}
+		v, err := node.eval(lookup)
+		if err != nil || v.String() != tt.want {
+			t.Errorf("%s = %q, %v; want %q", tt.expr, v.String(), err, tt.want)
+		}
+	}
+}
+
+func TestReadXLSX(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "labs.xlsx")
+	f, _ := os.Create(path)
+	zw := zip.NewWriter(f)
+	parts := map[string]string{
+		"xl/workbook.xml": `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+			`<sheets><sheet name="Notes" sheetId="1" r:id="rId2"/><sheet name="Labs" sheetId="2" r:id="rId1"/></sheets></workbook>`,
+		"xl/_rels/workbook.xml.rels": `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Target="worksheets/sheet1.xml"/><Relationship Id="rId2" Target="worksheets/sheet2.xml"/></Relationships>`,
+		"xl/sharedStrings.xml": `<sst><si><t>Date</t></si><si><r><t>CA</t></r><r><t>19-9</t></r></si></sst>`,
+		"xl/styles.xml":        `<styleSheet><numFmts><numFmt numFmtId="164" formatCode="yyyy/m/d"/></numFmts><cellXfs><xf numFmtId="0"/><xf numFmtId="164"/></cellXfs></styleSheet>`,
+		"xl/worksheets/sheet1.xml": `<worksheet><sheetData>` +
+			`<row r="1"><c r="A1" t="s"><v>0</v></c><c r="B1" t="s"><v>1</v></c></row>` +
+			`<row r="2"><c r="A2" s="1"><v>46027</v></c><c r="C2" t="inlineStr"><is><t>skipped B</t></is></c></row>` +
+			`</sheetData></worksheet>`,
+		"xl/worksheets/sheet2.xml": `<worksheet><sheetData><row r="1"><c r="A1" t="inlineStr"><is><t>note</t></is></c></row></sheetData></worksheet>`,
+	}
+	for name, content := range parts {
+		w, _ := zw.Create(name)
+		w.Write([]byte(content))
+	}
+	zw.Close()
+	f.Close()
+
+	rows, sheets, err := readXLSX(path, "labs")
+	if err != nil {
+		t.Fatalf("readXLSX() error: %v", err)
+	}
+	if strings.Join(sheets, ",") != "Notes,Labs" {
+		t.Errorf("sheets = %v", sheets)
+	}
+	if len(rows) != 2 || strings.Join(rows[0], "|") != "Date|CA19-9" || strings.Join(rows[1], "|") != "2026-01-05||skipped B" {
+		t.Errorf("rows = %q", rows)
+	}
+	if _, _, err := readXLSX(path, "Imaging"); err == nil || !strings.Contains(err.Error(), "sheets: Notes, Labs") {
+		t.Errorf("missing sheet: %v", err)
+	}
+}
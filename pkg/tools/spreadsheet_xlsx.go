@@ -0,0 +1,291 @@
+package tools
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// readXLSX returns the cells of one worksheet of an Excel workbook, by
+// name or the first when sheet is empty, along with the names of all
+// sheets. Only cell values are read: formulas yield their cached results,
+// and cells formatted as dates are returned as YYYY-MM-DD.
+func readXLSX(filename, sheet string) ([][]string, []string, error) {
+	zr, err := zip.OpenReader(filename)
+	if err != nil {
+		return nil, nil, fmt.Errorf("not a valid .xlsx file: %w", err)
+	}
+	defer zr.Close()
+	files := make(map[string]*zip.File, len(zr.File))
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+
+	var workbook struct {
+		Sheets []struct {
+			Name string `xml:"name,attr"`
+			RID  string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	if err := decodeZipXML(files, "xl/workbook.xml", &workbook); err != nil {
+		return nil, nil, err
+	}
+	var rels struct {
+		Rels []struct {
+			ID     string `xml:"Id,attr"`
+			Target string `xml:"Target,attr"`
+		} `xml:"Relationship"`
+	}
+	if err := decodeZipXML(files, "xl/_rels/workbook.xml.rels", &rels); err != nil {
+		return nil, nil, err
+	}
+	if len(workbook.Sheets) == 0 {
+		return nil, nil, fmt.Errorf("workbook has no sheets")
+	}
+
+	names := make([]string, len(workbook.Sheets))
+	target := ""
+	for i, s := range workbook.Sheets {
+		names[i] = s.Name
+		if target != "" || sheet != "" && !strings.EqualFold(s.Name, sheet) {
+			continue
+		}
+		for _, r := range rels.Rels {
+			if r.ID == s.RID {
+				target = r.Target
+			}
+		}
+		if target == "" {
+			return nil, names, fmt.Errorf("sheet %q has no worksheet part", s.Name)
+		}
+	}
+	if target == "" {
+		return nil, names, fmt.Errorf("no sheet named %q; sheets: %s", sheet, strings.Join(names, ", "))
+	}
+	if strings.HasPrefix(target, "/") {
+		target = strings.TrimPrefix(target, "/")
+	} else {
+		target = path.Join("xl", target)
+	}
+
+	shared, err := readSharedStrings(files)
+	if err != nil {
+		return nil, names, err
+	}
+	dateStyles, err := readDateStyles(files)
+	if err != nil {
+		return nil, names, err
+	}
+
+	var ws struct {
+		Rows []struct {
+			Cells []struct {
+				Ref    string `xml:"r,attr"`
+				Type   string `xml:"t,attr"`
+				Style  int    `xml:"s,attr"`
+				Value  string `xml:"v"`
+				Inline struct {
+					Text string `xml:",innerxml"`
+				} `xml:"is"`
+			} `xml:"c"`
+		} `xml:"sheetData>row"`
+	}
+	if err := decodeZipXML(files, target, &ws); err != nil {
+		return nil, names, err
+	}
+
+	rows := make([][]string, 0, len(ws.Rows))
+	for _, r := range ws.Rows {
+		var row []string
+		for _, c := range r.Cells {
+			col := len(row)
+			if c.Ref != "" {
+				if ref := xlsxColumnIndex(c.Ref); ref >= len(row) {
+					col = ref
+				}
+			}
+			var value string
+			switch c.Type {
+			case "s":
+				if n, err := strconv.Atoi(c.Value); err == nil && n >= 0 && n < len(shared) {
+					value = shared[n]
+				}
+			case "inlineStr":
+				value = xmlText(c.Inline.Text)
+			case "b":
+				value = map[string]string{"1": "TRUE", "0": "FALSE"}[c.Value]
+			case "str", "e":
+				value = c.Value
+			default:
+				value = c.Value
+				if dateStyles[c.Style] {
+					if serial, err := strconv.ParseFloat(c.Value, 64); err == nil {
+						value = excelSerialDate(serial)
+					}
+				}
+			}
+			for len(row) < col {
+				row = append(row, "")
+			}
+			row = append(row, value)
+		}
+		rows = append(rows, row)
+	}
+	return rows, names, nil
+}
+
+func decodeZipXML(files map[string]*zip.File, name string, out interface{}) error {
+	f, ok := files[name]
+	if !ok {
+		return fmt.Errorf("not a valid .xlsx file: missing %s", name)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	if err := xml.NewDecoder(io.LimitReader(rc, maxSpreadsheetBytes*4)).Decode(out); err != nil {
+		return fmt.Errorf("not a valid .xlsx file: %s: %w", name, err)
+	}
+	return nil
+}
+
+func readSharedStrings(files map[string]*zip.File) ([]string, error) {
+	if _, ok := files["xl/sharedStrings.xml"]; !ok {
+		return nil, nil
+	}
+	var sst struct {
+		Items []struct {
+			Text string `xml:",innerxml"`
+		} `xml:"si"`
+	}
+	if err := decodeZipXML(files, "xl/sharedStrings.xml", &sst); err != nil {
+		return nil, err
+	}
+	out := make([]string, len(sst.Items))
+	for i, si := range sst.Items {
+		out[i] = xmlText(si.Text)
+	}
+	return out, nil
+}
+
+// xmlText joins the <t> elements of a rich text fragment, skipping
+// phonetic runs.
+func xmlText(fragment string) string {
+	var b strings.Builder
+	d := xml.NewDecoder(strings.NewReader(fragment))
+	inText, inPhonetic := false, false
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			break
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "t":
+				inText = true
+			case "rPh":
+				inPhonetic = true
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "t":
+				inText = false
+			case "rPh":
+				inPhonetic = false
+			}
+		case xml.CharData:
+			if inText && !inPhonetic {
+				b.Write(t)
+			}
+		}
+	}
+	return b.String()
+}
+
+// readDateStyles reports which cell styles format numbers as dates.
+func readDateStyles(files map[string]*zip.File) (map[int]bool, error) {
+	if _, ok := files["xl/styles.xml"]; !ok {
+		return nil, nil
+	}
+	var styles struct {
+		NumFmts []struct {
+			ID   int    `xml:"numFmtId,attr"`
+			Code string `xml:"formatCode,attr"`
+		} `xml:"numFmts>numFmt"`
+		CellXfs []struct {
+			NumFmtID int `xml:"numFmtId,attr"`
+		} `xml:"cellXfs>xf"`
+	}
+	if err := decodeZipXML(files, "xl/styles.xml", &styles); err != nil {
+		return nil, err
+	}
+	dateFormats := make(map[int]bool)
+	for id := 14; id <= 22; id++ {
+		dateFormats[id] = true
+	}
+	for _, id := range []int{27, 30, 36, 45, 46, 47, 50, 57} {
+		dateFormats[id] = true
+	}
+	for _, f := range styles.NumFmts {
+		dateFormats[f.ID] = isDateFormatCode(f.Code)
+	}
+	out := make(map[int]bool)
+	for i, xf := range styles.CellXfs {
+		if dateFormats[xf.NumFmtID] {
+			out[i] = true
+		}
+	}
+	return out, nil
+}
+
+// isDateFormatCode reports whether a custom number format shows a date,
+// ignoring quoted text and bracketed colors or locales.
+func isDateFormatCode(code string) bool {
+	inQuote, inBracket := false, false
+	for _, c := range strings.ToLower(code) {
+		switch {
+		case c == '"':
+			inQuote = !inQuote
+		case inQuote:
+		case c == '[':
+			inBracket = true
+		case c == ']':
+			inBracket = false
+		case inBracket:
+		case c == 'y' || c == 'd':
+			return true
+		}
+	}
+	return false
+}
+
+// excelSerialDate converts an Excel day number (1900 date system) to a
+// date, with the time of day when there is one.
+func excelSerialDate(serial float64) string {
+	base := time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+	t := base.Add(time.Duration(serial * 24 * float64(time.Hour)).Round(time.Second))
+	if t.Hour() == 0 && t.Minute() == 0 && t.Second() == 0 {
+		return t.Format("2006-01-02")
+	}
+	return t.Format("2006-01-02 15:04")
+}
+
+// xlsxColumnIndex returns the zero-based column of a cell reference
+// such as "AB12".
+func xlsxColumnIndex(ref string) int {
+	col := 0
+	for _, c := range ref {
+		if c < 'A' || c > 'Z' {
+			break
+		}
+		col = col*26 + int(c-'A'+1)
+	}
+	return col - 1
+}
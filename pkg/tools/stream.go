@@ -0,0 +1,46 @@
+package tools
+
+import "context"
+
+// StreamFunc receives a streaming tool's output as it is produced. It must
+// be safe for concurrent use and return quickly.
+type StreamFunc func(chunk string)
+
+// StreamingTool is an optional interface for tools that produce output
+// incrementally, such as shell commands. The registry calls ExecuteStream
+// instead of Execute, passing the receiver attached to the call's context
+// with WithStream, or one that discards chunks.
+//
+// The returned result is still what the model sees; emitted chunks only
+// keep the user informed while the call runs. Cached and background calls
+// are not streamed.
+type StreamingTool interface {
+	Tool
+	ExecuteStream(ctx context.Context, args map[string]interface{}, emit StreamFunc) *ToolResult
+}
+
+type streamKey struct{}
+
+// WithStream attaches a receiver for streamed tool output to ctx.
+func WithStream(ctx context.Context, fn StreamFunc) context.Context {
+	return context.WithValue(ctx, streamKey{}, fn)
+}
+
+// streamFromContext returns the receiver attached to ctx, or one that
+// discards chunks.
+func streamFromContext(ctx context.Context) StreamFunc {
+	if fn, ok := ctx.Value(streamKey{}).(StreamFunc); ok && fn != nil {
+		return fn
+	}
+	return func(string) {}
+}
+
+// streamWriter is an io.Writer passing everything written to emit.
+type streamWriter struct {
+	emit StreamFunc
+}
+
+func (w streamWriter) Write(p []byte) (int, error) {
+	w.emit(string(p))
+	return len(p), nil
+}
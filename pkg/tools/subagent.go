@@ -257,7 +257,7 @@ func (t *SubagentTool) SetContext(channel, chatID string) {
 func (t *SubagentTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
 	task, ok := args["task"].(string)
 	if !ok {
-		return ErrorResult("task is required").WithError(fmt.Errorf("task parameter is required"))
+		return ErrorResult("task is required").WithError(ClassifyError(ErrInvalidArgs, fmt.Errorf("task parameter is required")))
 	}
 
 	label, _ := args["label"].(string)
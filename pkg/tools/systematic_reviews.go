@@ -0,0 +1,129 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// systematicReviewFilter limits a PubMed search to systematic reviews and
+// meta-analyses. The systematic[sb] subset also covers reviews indexed
+// before the "Systematic Review" publication type existed.
+const systematicReviewFilter = `(systematic[sb] OR "Meta-Analysis"[pt])`
+
+// cochraneJournal is the Cochrane Database of Systematic Reviews.
+const cochraneJournal = `"Cochrane Database Syst Rev"[ta]`
+
+// SystematicReviewTool searches PubMed for systematic reviews and
+// meta-analyses only, so top-of-pyramid evidence is not buried among
+// primary studies.
+type SystematicReviewTool struct {
+	pubmed *PubMedProvider
+}
+
+func NewSystematicReviewTool(pubmed *PubMedProvider) *SystematicReviewTool {
+	return &SystematicReviewTool{pubmed: pubmed}
+}
+
+func (t *SystematicReviewTool) Name() string {
+	return "systematic_review_search"
+}
+
+func (t *SystematicReviewTool) Concurrent() bool {
+	return true
+}
+
+func (t *SystematicReviewTool) Description() string {
+	return "Search for systematic reviews and meta-analyses only (PubMed, including Cochrane reviews), the strongest level of evidence. " +
+		"Use it before primary studies when a clinical question asks whether a treatment works or how options compare. " +
+		"Set cochrane_only for Cochrane reviews. Write the query in English."
+}
+
+func (t *SystematicReviewTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"query": map[string]interface{}{
+				"type":        "string",
+				"description": "Clinical question or keywords in English, e.g. pancreatic enzyme replacement therapy pancreatic cancer",
+			},
+			"cochrane_only": map[string]interface{}{
+				"type":        "boolean",
+				"description": "Only return Cochrane reviews",
+			},
+			"since_year": map[string]interface{}{
+				"type":        "integer",
+				"description": "Only return reviews published in or after this year",
+			},
+			"limit": map[string]interface{}{
+				"type":        "integer",
+				"description": "Maximum number of reviews (1-20, default 5)",
+				"minimum":     1,
+				"maximum":     20,
+			},
+		},
+		"required": []string{"query"},
+	}
+}
+
+type systematicReviewArgs struct {
+	Query        string `json:"query" arg:"required"`
+	CochraneOnly bool   `json:"cochrane_only"`
+	SinceYear    int    `json:"since_year" arg:"min=1900,max=2100"`
+	Limit        int    `json:"limit" arg:"min=1,max=20,default=5"`
+}
+
+func (t *SystematicReviewTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	a, err := BindArgs[systematicReviewArgs](args)
+	if err != nil {
+		return ErrorResult(err.Error()).WithError(err)
+	}
+
+	reviews, err := t.pubmed.search(ctx, systematicReviewTerm(a.Query, a.CochraneOnly, a.SinceYear), a.Limit)
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("systematic review search failed: %v", err)).WithError(err)
+	}
+	results := make([]map[string]interface{}, len(reviews))
+	for i, r := range reviews {
+		results[i] = map[string]interface{}{
+			"pmid":  r.PMID,
+			"title": r.Title,
+			"type":  r.Type,
+			"url":   r.URL,
+		}
+		if r.Journal != "" {
+			results[i]["journal"] = r.Journal
+		}
+		if r.Year > 0 {
+			results[i]["year"] = r.Year
+		}
+		if r.DOI != "" {
+			results[i]["doi"] = r.DOI
+		}
+		if strings.Contains(strings.ToLower(r.Journal), "cochrane") {
+			results[i]["cochrane"] = true
+		}
+	}
+	out := map[string]interface{}{
+		"query":   a.Query,
+		"results": results,
+	}
+	if len(results) == 0 {
+		out["note"] = "No systematic review or meta-analysis matched; try broader keywords, or search primary studies with evidence_search."
+	}
+	payload, _ := json.Marshal(out)
+	return NewToolResult(string(payload))
+}
+
+// systematicReviewTerm builds the PubMed search term for a query.
+func systematicReviewTerm(query string, cochraneOnly bool, sinceYear int) string {
+	term := "(" + strings.TrimSpace(query) + ") AND " + systematicReviewFilter
+	if cochraneOnly {
+		term += " AND " + cochraneJournal
+	}
+	if sinceYear > 0 {
+		term += fmt.Sprintf(` AND ("%d"[dp] : "3000"[dp])`, sinceYear)
+	}
+	return term
+}
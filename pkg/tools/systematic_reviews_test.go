@@ -0,0 +1,74 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSystematicReviewTerm(t *testing.T) {
+	tests := []struct {
+		query     string
+		cochrane  bool
+		sinceYear int
+		want      string
+	}{
+		{"PERT pancreatic cancer", false, 0,
+			`(PERT pancreatic cancer) AND (systematic[sb] OR "Meta-Analysis"[pt])`},
+		{" celiac plexus block ", true, 2015,
+			`(celiac plexus block) AND (systematic[sb] OR "Meta-Analysis"[pt]) AND "Cochrane Database Syst Rev"[ta] AND ("2015"[dp] : "3000"[dp])`},
+	}
+	for _, tt := range tests {
+		if got := systematicReviewTerm(tt.query, tt.cochrane, tt.sinceYear); got != tt.want {
+			t.Errorf("systematicReviewTerm(%q) = %s, want %s", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestSystematicReviewTool(t *testing.T) {
+	var terms []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/esearch.fcgi":
+			terms = append(terms, r.URL.Query().Get("term"))
+			if r.URL.Query().Get("retmax") != "5" {
+				t.Errorf("retmax = %s, want the default 5", r.URL.Query().Get("retmax"))
+			}
+			w.Write([]byte(`{"esearchresult":{"idlist":["29624680"]}}`))
+		case "/esummary.fcgi":
+			w.Write([]byte(`{"result":{"29624680":{
+				"title":"Celiac plexus block for pancreatic cancer pain in adults.",
+				"pubdate":"2011 Mar 16","source":"Cochrane Database Syst Rev",
+				"fulljournalname":"The Cochrane database of systematic reviews",
+				"pubtype":["Journal Article","Systematic Review"],
+				"articleids":[{"idtype":"doi","value":"10.1002/14651858.CD007519.pub2"}]}}}`))
+		}
+	}))
+	defer server.Close()
+	tool := NewSystematicReviewTool(NewPubMedProvider(PubMedOptions{BaseURL: server.URL}))
+
+	result := tool.Execute(context.Background(), map[string]interface{}{"query": "celiac plexus block", "cochrane_only": true})
+	if result.IsError {
+		t.Fatalf("systematic_review_search: %s", result.ForLLM)
+	}
+	var out struct {
+		Results []map[string]interface{} `json:"results"`
+	}
+	if err := json.Unmarshal([]byte(result.ForLLM), &out); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if len(out.Results) != 1 || out.Results[0]["type"] != "systematic review" || out.Results[0]["cochrane"] != true {
+		t.Errorf("result = %s", result.ForLLM)
+	}
+	if len(terms) != 1 || terms[0] != systematicReviewTerm("celiac plexus block", true, 0) {
+		t.Errorf("terms = %v", terms)
+	}
+
+	result = tool.Execute(context.Background(), map[string]interface{}{"query": "x", "since_year": 15})
+	if !result.IsError || !errors.Is(result.Err, ErrInvalidArgs) {
+		t.Errorf("since_year 15: %+v", result)
+	}
+}
@@ -0,0 +1,57 @@
+package tools
+
+import "context"
+
+// ToolContext is the context a ToolRegistry passes to Execute. Besides
+// cancellation it carries who and where the call is for, so tools need not
+// take these as arguments or keep them in fields shared by every session.
+//
+// Tools get it with ToolContextFrom, which also works on contexts derived
+// from it and on contexts that never went through a registry.
+type ToolContext struct {
+	context.Context
+	CallMetadata
+	// Channel and ChatID identify the conversation being answered.
+	Channel string
+	ChatID  string
+}
+
+type toolContextKey struct{}
+
+// NewToolContext wraps ctx with its call metadata and the conversation the
+// call is for.
+func NewToolContext(ctx context.Context, channel, chatID string) *ToolContext {
+	return &ToolContext{
+		Context:      ctx,
+		CallMetadata: CallMetadataFromContext(ctx),
+		Channel:      channel,
+		ChatID:       chatID,
+	}
+}
+
+// Value makes the ToolContext and its metadata reachable from derived
+// contexts.
+func (c *ToolContext) Value(key any) any {
+	switch key.(type) {
+	case toolContextKey:
+		return c
+	case callMetadataKey:
+		return c.CallMetadata
+	}
+	return c.Context.Value(key)
+}
+
+// ToolContextFrom returns the ToolContext ctx is or derives from, bound to
+// ctx so its deadline and cancellation apply. Outside a registry call it
+// returns one holding only ctx's call metadata.
+func ToolContextFrom(ctx context.Context) *ToolContext {
+	if tc, ok := ctx.(*ToolContext); ok {
+		return tc
+	}
+	if tc, ok := ctx.Value(toolContextKey{}).(*ToolContext); ok {
+		bound := *tc
+		bound.Context = ctx
+		return &bound
+	}
+	return NewToolContext(ctx, "", "")
+}
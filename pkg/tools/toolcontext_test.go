@@ -0,0 +1,91 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// contextRecordingTool keeps the ToolContext of its last call.
+type contextRecordingTool struct {
+	stubTool
+	got *ToolContext
+}
+
+func (t *contextRecordingTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	derived, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+	t.got = ToolContextFrom(derived)
+	return t.stubTool.Execute(ctx, args)
+}
+
+func TestToolRegistry_PassesToolContext(t *testing.T) {
+	tool := &contextRecordingTool{stubTool: stubTool{name: "knows_ai_search"}}
+	r := NewToolRegistry()
+	r.Register(tool)
+
+	ctx := WithCallMetadata(context.Background(), CallMetadata{SessionKey: "s1", UserID: "u1", Language: "zh-CN"})
+	r.ExecuteWithContext(ctx, "knows_ai_search", nil, "telegram", "42", nil)
+
+	tc := tool.got
+	if tc == nil || tc.Channel != "telegram" || tc.ChatID != "42" || tc.SessionKey != "s1" || tc.UserID != "u1" || tc.Language != "zh-CN" {
+		t.Fatalf("unexpected tool context %+v", tc)
+	}
+	if _, ok := tc.Deadline(); !ok {
+		t.Error("ToolContextFrom should keep the derived context's deadline")
+	}
+	if meta := CallMetadataFromContext(tc); meta.SessionKey != "s1" {
+		t.Errorf("call metadata not reachable through the tool context: %+v", meta)
+	}
+}
+
+func TestToolContextFrom_OutsideRegistry(t *testing.T) {
+	ctx := WithCallMetadata(context.Background(), CallMetadata{SessionKey: "s1"})
+	tc := ToolContextFrom(ctx)
+	if tc.SessionKey != "s1" || tc.Channel != "" {
+		t.Errorf("unexpected tool context %+v", tc)
+	}
+}
+
+func TestToolRegistry_EnforcesPermissions(t *testing.T) {
+	tool := &stubTool{name: "exec"}
+	r := NewToolRegistry()
+	r.Register(tool)
+	r.Register(&stubTool{name: "knows_ai_search"})
+
+	ctx := WithCallMetadata(context.Background(), CallMetadata{
+		UserID: "u1",
+		Permissions: map[string]ToolRolePolicy{
+			"patient": {Allow: []string{"knows_*"}},
+		},
+	})
+	result := r.ExecuteWithContext(ctx, "exec", nil, "telegram", "42", nil)
+	if !result.IsError || !errors.Is(result.Err, ErrPermissionDenied) || tool.calls != 0 {
+		t.Errorf("expected exec to be refused, got %+v (calls %d)", result, tool.calls)
+	}
+	if result := r.ExecuteWithContext(ctx, "knows_ai_search", nil, "telegram", "42", nil); result.IsError {
+		t.Errorf("knows_ai_search refused: %s", result.ForLLM)
+	}
+}
+
+func TestCallMetadata_Allows(t *testing.T) {
+	meta := CallMetadata{Permissions: map[string]ToolRolePolicy{
+		"patient":   {Allow: []string{"knows_*"}, Deny: []string{"knows_ai_answer"}},
+		"caregiver": {Allow: []string{"knows_ai_answer", "cron"}},
+	}}
+	tests := map[string]bool{
+		"knows_ai_search": true,
+		"knows_ai_answer": true, // denied to patients, allowed to caregivers
+		"cron":            true,
+		"exec":            false,
+	}
+	for tool, want := range tests {
+		if got := meta.Allows(tool); got != want {
+			t.Errorf("Allows(%q) = %v, want %v", tool, got, want)
+		}
+	}
+	if !(CallMetadata{}).Allows("exec") {
+		t.Error("a user without roles should be allowed every tool")
+	}
+}
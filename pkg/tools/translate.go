@@ -0,0 +1,399 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+const (
+	maxTranslateChars = 8000
+	translateAttempts = 2
+)
+
+// GlossaryEntry is one term pair of the translation glossary. Aliases are
+// other source spellings, such as brand names, that translate to the same
+// pair. The glossary file is a JSON array of entries.
+type GlossaryEntry struct {
+	EN      string   `json:"en"`
+	ZH      string   `json:"zh"`
+	Aliases []string `json:"aliases,omitempty"`
+}
+
+// defaultGlossary holds the terms patients meet most in pancreatic cancer
+// care. Entries in the deployment's glossary file replace these by EN.
+var defaultGlossary = []GlossaryEntry{
+	{EN: "gemcitabine", ZH: "吉西他滨"},
+	{EN: "nab-paclitaxel", ZH: "白蛋白紫杉醇", Aliases: []string{"Abraxane", "albumin-bound paclitaxel"}},
+	{EN: "liposomal irinotecan", ZH: "伊立替康脂质体", Aliases: []string{"Onivyde", "nal-IRI"}},
+	{EN: "irinotecan", ZH: "伊立替康"},
+	{EN: "oxaliplatin", ZH: "奥沙利铂"},
+	{EN: "fluorouracil", ZH: "氟尿嘧啶", Aliases: []string{"5-FU"}},
+	{EN: "leucovorin", ZH: "亚叶酸钙"},
+	{EN: "capecitabine", ZH: "卡培他滨"},
+	{EN: "S-1", ZH: "替吉奥"},
+	{EN: "olaparib", ZH: "奥拉帕利"},
+	{EN: "erlotinib", ZH: "厄洛替尼"},
+	{EN: "nimotuzumab", ZH: "尼妥珠单抗"},
+	{EN: "pembrolizumab", ZH: "帕博利珠单抗"},
+	{EN: "pancreatic enzyme replacement therapy", ZH: "胰酶替代治疗", Aliases: []string{"PERT"}},
+	{EN: "pancreatic ductal adenocarcinoma", ZH: "胰腺导管腺癌", Aliases: []string{"PDAC"}},
+	{EN: "pancreaticoduodenectomy", ZH: "胰十二指肠切除术", Aliases: []string{"Whipple procedure"}},
+	{EN: "distal pancreatectomy", ZH: "胰体尾切除术"},
+	{EN: "celiac plexus neurolysis", ZH: "腹腔神经丛阻滞"},
+	{EN: "biliary stent", ZH: "胆道支架"},
+	{EN: "neoadjuvant therapy", ZH: "新辅助治疗"},
+	{EN: "adjuvant therapy", ZH: "辅助治疗"},
+	{EN: "borderline resectable", ZH: "交界可切除"},
+	{EN: "locally advanced", ZH: "局部进展期"},
+	{EN: "overall survival", ZH: "总生存期"},
+	{EN: "progression-free survival", ZH: "无进展生存期"},
+	{EN: "hazard ratio", ZH: "风险比"},
+	{EN: "confidence interval", ZH: "置信区间"},
+	{EN: "randomized controlled trial", ZH: "随机对照试验"},
+	{EN: "germline", ZH: "胚系"},
+	{EN: "microsatellite instability-high", ZH: "高度微卫星不稳定", Aliases: []string{"MSI-H"}},
+}
+
+// quantityPattern matches a number and the unit that follows it, e.g.
+// "1,000 mg/m²" or "95%".
+var quantityPattern = regexp.MustCompile(`(\d+(?:[.,]\d+)*)\s*(%|‰|mg/m²|mg/m2|mg/kg|mg/dl|mg/dL|mmol/L|µmol/L|umol/L|U/mL|U/ml|IU|mg|mcg|µg|ug|kg|g|mL|ml|L|cm|mm|°C|℃)?`)
+
+// TranslateOptions configures the medical_translate tool.
+type TranslateOptions struct {
+	Model string
+	// GlossaryPath is a JSON glossary that extends and overrides the
+	// built-in one. It is reloaded when it changes.
+	GlossaryPath string
+}
+
+// TranslateTool translates medical text between Chinese and English with
+// the agent's LLM, holding it to a glossary and to the source's numbers.
+type TranslateTool struct {
+	provider providers.LLMProvider
+	opts     TranslateOptions
+
+	mu       sync.Mutex
+	glossary []GlossaryEntry
+	loaded   time.Time // modification time of the loaded glossary file
+}
+
+func NewTranslateTool(provider providers.LLMProvider, opts TranslateOptions) *TranslateTool {
+	return &TranslateTool{provider: provider, opts: opts}
+}
+
+func (t *TranslateTool) Name() string {
+	return "medical_translate"
+}
+
+func (t *TranslateTool) Description() string {
+	return "Translate medical text such as an English abstract or guideline excerpt into Chinese for a patient, or Chinese into English. " +
+		"Drug and procedure names follow a maintained medical glossary and every number and unit is kept exactly; check the warnings field before relying on the result."
+}
+
+func (t *TranslateTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"text": map[string]interface{}{
+				"type":        "string",
+				"description": "The text to translate, up to 8000 characters",
+			},
+			"target": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"zh", "en"},
+				"description": "Target language: zh (Simplified Chinese) or en",
+			},
+			"plain_language": map[string]interface{}{
+				"type":        "boolean",
+				"description": "Use plain words a patient understands instead of clinical register",
+			},
+		},
+		"required": []string{"text", "target"},
+	}
+}
+
+type translateArgs struct {
+	Text          string `json:"text" arg:"required"`
+	Target        string `json:"target" arg:"required,enum=zh|en"`
+	PlainLanguage bool   `json:"plain_language"`
+}
+
+// glossaryMatch is a glossary term found in the source text.
+type glossaryMatch struct {
+	Source string `json:"source"`
+	Target string `json:"target"`
+}
+
+func (t *TranslateTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	a, err := BindArgs[translateArgs](args)
+	if err != nil {
+		return ErrorResult(err.Error()).WithError(err)
+	}
+	if n := len([]rune(a.Text)); n > maxTranslateChars {
+		return ErrorResult(fmt.Sprintf("text is %d characters; translate at most %d at a time", n, maxTranslateChars)).WithError(ErrInvalidArgs)
+	}
+	glossary, err := t.loadGlossary()
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("translation glossary unavailable: %v", err)).WithError(err)
+	}
+
+	terms := matchGlossary(glossary, a.Text, a.Target)
+	messages := []providers.Message{
+		{Role: "system", Content: translatePrompt(a.Target, a.PlainLanguage, terms)},
+		{Role: "user", Content: a.Text},
+	}
+	var translation string
+	var problems []string
+	for attempt := 0; attempt < translateAttempts; attempt++ {
+		response, err := t.provider.Chat(ctx, messages, nil, t.model(), map[string]interface{}{
+			"max_tokens":  4096,
+			"temperature": 0.1,
+		})
+		if err != nil {
+			return ErrorResult(fmt.Sprintf("translation failed: %v", err)).WithError(ClassifyError(ErrRetryable, err))
+		}
+		translation = strings.TrimSpace(response.Content)
+		problems = checkTranslation(a.Text, translation, terms)
+		if len(problems) == 0 {
+			break
+		}
+		messages = append(messages,
+			providers.Message{Role: "assistant", Content: translation},
+			providers.Message{Role: "user", Content: "Fix these problems and reply with the corrected translation only:\n- " + strings.Join(problems, "\n- ")},
+		)
+	}
+
+	out := map[string]interface{}{
+		"translation": translation,
+		"target":      a.Target,
+	}
+	if len(terms) > 0 {
+		out["glossary_terms"] = terms
+	}
+	if len(problems) > 0 {
+		out["warnings"] = problems
+	}
+	payload, _ := json.Marshal(out)
+	return NewToolResult(string(payload))
+}
+
+func (t *TranslateTool) model() string {
+	if t.opts.Model != "" {
+		return t.opts.Model
+	}
+	return t.provider.GetDefaultModel()
+}
+
+// loadGlossary returns the built-in glossary merged with the glossary
+// file, reloading the file when it has changed.
+func (t *TranslateTool) loadGlossary() ([]GlossaryEntry, error) {
+	if t.opts.GlossaryPath == "" {
+		return defaultGlossary, nil
+	}
+	info, err := os.Stat(t.opts.GlossaryPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return defaultGlossary, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.glossary != nil && info.ModTime().Equal(t.loaded) {
+		return t.glossary, nil
+	}
+	data, err := os.ReadFile(t.opts.GlossaryPath)
+	if err != nil {
+		return nil, err
+	}
+	var custom []GlossaryEntry
+	if err := json.Unmarshal(data, &custom); err != nil {
+		return nil, fmt.Errorf("invalid glossary %s: %w", t.opts.GlossaryPath, err)
+	}
+	t.glossary, t.loaded = mergeGlossary(defaultGlossary, custom), info.ModTime()
+	return t.glossary, nil
+}
+
+// mergeGlossary returns base with custom entries replacing those with the
+// same English term and the rest appended.
+func mergeGlossary(base, custom []GlossaryEntry) []GlossaryEntry {
+	out := append([]GlossaryEntry(nil), base...)
+	for _, c := range custom {
+		if c.EN == "" || c.ZH == "" {
+			continue
+		}
+		replaced := false
+		for i := range out {
+			if strings.EqualFold(out[i].EN, c.EN) {
+				out[i], replaced = c, true
+				break
+			}
+		}
+		if !replaced {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// matchGlossary returns the glossary terms in text with their translation
+// into target. Longer terms win, so "liposomal irinotecan" is not also
+// matched as "irinotecan".
+func matchGlossary(glossary []GlossaryEntry, text, target string) []glossaryMatch {
+	type candidate struct {
+		term  string
+		entry GlossaryEntry
+	}
+	var candidates []candidate
+	for _, e := range glossary {
+		sources := e.Aliases
+		if target == "zh" {
+			sources = append([]string{e.EN}, sources...)
+		} else {
+			sources = append([]string{e.ZH}, sources...)
+		}
+		for _, s := range sources {
+			if s != "" {
+				candidates = append(candidates, candidate{s, e})
+			}
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return len([]rune(candidates[i].term)) > len([]rune(candidates[j].term))
+	})
+
+	lower := []rune(strings.ToLower(text))
+	used := make([]bool, len(lower))
+	var out []glossaryMatch
+	seen := make(map[string]bool)
+	for _, c := range candidates {
+		term := []rune(strings.ToLower(c.term))
+		for i := 0; i+len(term) <= len(lower); i++ {
+			if string(lower[i:i+len(term)]) != string(term) || !termBoundary(lower, i, i+len(term)) || overlaps(used, i, i+len(term)) {
+				continue
+			}
+			for j := i; j < i+len(term); j++ {
+				used[j] = true
+			}
+			translated := c.entry.ZH
+			if target == "en" {
+				translated = c.entry.EN
+			}
+			if !seen[c.term] {
+				seen[c.term] = true
+				out = append(out, glossaryMatch{Source: c.term, Target: translated})
+			}
+		}
+	}
+	return out
+}
+
+// termBoundary reports whether text[start:end] is not part of a longer
+// Latin word or number. Chinese terms have no word boundaries.
+func termBoundary(text []rune, start, end int) bool {
+	isWord := func(r rune) bool {
+		return r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r))
+	}
+	if start > 0 && isWord(text[start-1]) && isWord(text[start]) {
+		return false
+	}
+	if end < len(text) && isWord(text[end]) && isWord(text[end-1]) {
+		return false
+	}
+	return true
+}
+
+func overlaps(used []bool, start, end int) bool {
+	for i := start; i < end; i++ {
+		if used[i] {
+			return true
+		}
+	}
+	return false
+}
+
+func translatePrompt(target string, plain bool, terms []glossaryMatch) string {
+	var b strings.Builder
+	if target == "zh" {
+		b.WriteString("Translate the user's medical text into Simplified Chinese.")
+	} else {
+		b.WriteString("Translate the user's medical text into English.")
+	}
+	if plain {
+		b.WriteString(" Write for a patient without medical training: use plain words, but do not leave out or soften any finding.")
+	}
+	b.WriteString("\nRules:\n" +
+		"- Keep every number, unit, percentage, range and statistic exactly as written, e.g. \"1,000 mg/m²\" stays \"1,000 mg/m²\". Do not convert or round.\n" +
+		"- Keep trial names, gene names and abbreviations such as CA19-9, BRCA2 or FOLFIRINOX unchanged.\n" +
+		"- Do not add explanations or notes. Reply with the translation only.")
+	if len(terms) > 0 {
+		b.WriteString("\n- Translate these terms exactly as given:")
+		for _, term := range terms {
+			fmt.Fprintf(&b, "\n  %s → %s", term.Source, term.Target)
+		}
+	}
+	return b.String()
+}
+
+// checkTranslation lists the glossary terms missing from a translation and
+// the quantities of the source it does not reproduce.
+func checkTranslation(source, translation string, terms []glossaryMatch) []string {
+	var problems []string
+	lower := strings.ToLower(translation)
+	for _, term := range terms {
+		if !strings.Contains(lower, strings.ToLower(term.Target)) {
+			problems = append(problems, fmt.Sprintf("%q must be translated as %q", term.Source, term.Target))
+		}
+	}
+	have := make(map[string]int)
+	for _, q := range quantities(translation) {
+		have[normalizeQuantity(q)]++
+	}
+	for _, q := range quantities(source) {
+		key := normalizeQuantity(q)
+		if have[key] > 0 {
+			have[key]--
+			continue
+		}
+		problems = append(problems, fmt.Sprintf("%q from the source is missing or changed", q))
+	}
+	return problems
+}
+
+// quantities returns the numbers in text with their units. A unit that
+// runs into a word, like the g of "12 genes", is not a unit.
+func quantities(text string) []string {
+	var out []string
+	for _, m := range quantityPattern.FindAllStringSubmatchIndex(text, -1) {
+		end := m[1]
+		if m[4] < 0 {
+			end = m[3]
+		} else if last := text[m[5]-1]; end < len(text) && isASCIILetter(last) && isASCIILetter(text[end]) {
+			end = m[3]
+		}
+		out = append(out, text[m[0]:end])
+	}
+	return out
+}
+
+func isASCIILetter(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// normalizeQuantity drops the spacing that legitimately differs between
+// languages, e.g. "40 mg" and "40mg".
+func normalizeQuantity(q string) string {
+	q = strings.ReplaceAll(strings.Join(strings.Fields(q), ""), "m2", "m²")
+	return strings.ReplaceAll(strings.ToLower(q), "℃", "°c")
+}
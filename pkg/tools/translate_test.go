@@ -0,0 +1,105 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+// scriptedProvider replies with each response in turn and records the
+// messages it was sent.
+type scriptedProvider struct {
+	responses []string
+	calls     [][]providers.Message
+}
+
+func (p *scriptedProvider) Chat(ctx context.Context, messages []providers.Message, tools []providers.ToolDefinition, model string, options map[string]interface{}) (*providers.LLMResponse, error) {
+	p.calls = append(p.calls, messages)
+	reply := p.responses[min(len(p.calls), len(p.responses))-1]
+	return &providers.LLMResponse{Content: reply}, nil
+}
+
+func (p *scriptedProvider) GetDefaultModel() string {
+	return "test-model"
+}
+
+func TestMatchGlossary(t *testing.T) {
+	glossary := mergeGlossary(defaultGlossary, []GlossaryEntry{
+		{EN: "gemcitabine", ZH: "健择", Aliases: []string{"Gemzar"}},
+		{EN: "CA19-9", ZH: "糖类抗原19-9"},
+	})
+	tests := []struct {
+		text, target string
+		want         []string
+	}{
+		{"Liposomal irinotecan after gemcitabine", "zh", []string{"liposomal irinotecan→伊立替康脂质体", "gemcitabine→健择"}},
+		{"Abraxane plus Gemzar; CA19-9 fell", "zh", []string{"Abraxane→白蛋白紫杉醇", "Gemzar→健择", "CA19-9→糖类抗原19-9"}},
+		{"Germline testing, not germlines", "zh", []string{"germline→胚系"}},
+		{"术后口服替吉奥，总生存期延长", "en", []string{"总生存期→overall survival", "替吉奥→S-1"}},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, m := range matchGlossary(glossary, tt.text, tt.target) {
+			got = append(got, m.Source+"→"+m.Target)
+		}
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("matchGlossary(%q) = %v, want %v", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestCheckTranslation(t *testing.T) {
+	terms := []glossaryMatch{{Source: "nab-paclitaxel", Target: "白蛋白紫杉醇"}}
+	source := "Nab-paclitaxel 125 mg/m2 on days 1, 8 and 15; median OS 8.5 months (HR 0.72, 95% CI 0.62-0.83) in 12 genes."
+	good := "白蛋白紫杉醇 125mg/m² 于第1、8和15天给药；中位总生存期8.5个月（HR 0.72，95%CI 0.62-0.83），涉及12个基因。"
+	if problems := checkTranslation(source, good, terms); len(problems) > 0 {
+		t.Errorf("faithful translation flagged: %v", problems)
+	}
+	bad := "紫杉醇 125 mg/m² 于第1、8和15天给药；中位总生存期约8个月（HR 0.72，95%CI 0.62-0.83），涉及12个基因。"
+	problems := checkTranslation(source, bad, terms)
+	if len(problems) != 2 || !strings.Contains(problems[0], "白蛋白紫杉醇") || !strings.Contains(problems[1], "8.5") {
+		t.Errorf("problems = %v", problems)
+	}
+}
+
+func TestTranslateTool_RetriesOnce(t *testing.T) {
+	dir := t.TempDir()
+	glossaryPath := filepath.Join(dir, "glossary.json")
+	os.WriteFile(glossaryPath, []byte(`[{"en":"gemcitabine","zh":"健择"}]`), 0644)
+	provider := &scriptedProvider{responses: []string{
+		"吉西他滨每周1000 mg/m²。",
+		"健择每周1000 mg/m²。",
+	}}
+	tool := NewTranslateTool(provider, TranslateOptions{GlossaryPath: glossaryPath})
+
+	result := tool.Execute(context.Background(), map[string]interface{}{"text": "Gemcitabine 1000 mg/m2 weekly.", "target": "zh"})
+	if result.IsError {
+		t.Fatalf("medical_translate: %s", result.ForLLM)
+	}
+	var out struct {
+		Translation string   `json:"translation"`
+		Warnings    []string `json:"warnings"`
+	}
+	if err := json.Unmarshal([]byte(result.ForLLM), &out); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if out.Translation != "健择每周1000 mg/m²。" || len(out.Warnings) != 0 {
+		t.Errorf("result = %s", result.ForLLM)
+	}
+	if len(provider.calls) != 2 || !strings.Contains(provider.calls[0][0].Content, "gemcitabine → 健择") {
+		t.Errorf("calls = %v", provider.calls)
+	}
+
+	provider = &scriptedProvider{responses: []string{"吉西他滨每周给药。"}}
+	tool = NewTranslateTool(provider, TranslateOptions{})
+	result = tool.Execute(context.Background(), map[string]interface{}{"text": "Gemcitabine 1000 mg/m2 weekly.", "target": "zh"})
+	json.Unmarshal([]byte(result.ForLLM), &out)
+	if len(provider.calls) != translateAttempts || len(out.Warnings) != 1 || !strings.Contains(out.Warnings[0], "1000 mg/m2") {
+		t.Errorf("unfixed translation: calls=%d result=%s", len(provider.calls), result.ForLLM)
+	}
+}
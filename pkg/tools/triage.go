@@ -0,0 +1,281 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// RedFlag is an urgent warning sign recognized in a message.
+type RedFlag struct {
+	ID       string `json:"id"`
+	Category string `json:"category"` // gi_bleeding, biliary_obstruction or febrile_neutropenia
+	Sign     string `json:"sign"`
+	Action   string `json:"action"`
+
+	signZH   string
+	actionZH string
+}
+
+// redFlagRule fires when the text mentions a term from every group.
+type redFlagRule struct {
+	flag   RedFlag
+	groups [][]string // lower-case terms
+}
+
+// feverTerm is added to the text when it reports a temperature of 38 °C or
+// more, so rules can treat a reading like "38.5℃" as a fever.
+const feverTerm = "fever"
+
+var (
+	feverTerms = []string{feverTerm, "febrile", "high temperature", "发烧", "发热", "高烧", "高热"}
+	chemoTerms = []string{"chemo", "chemotherapy", "gemcitabine", "abraxane", "nab-paclitaxel", "paclitaxel", "folfirinox",
+		"oxaliplatin", "irinotecan", "capecitabine", "s-1", "化疗", "吉西他滨", "白蛋白紫杉醇", "紫杉醇", "奥沙利铂", "伊立替康",
+		"卡培他滨", "替吉奥"}
+	jaundiceTerms = []string{"jaundice", "jaundiced", "yellow skin", "yellow eyes", "skin is yellow", "skin looks yellow",
+		"eyes are yellow", "eyes look yellow", "skin turned yellow", "eyes turned yellow", "whites of my eyes are yellow",
+		"黄疸", "皮肤发黄", "皮肤黄", "眼睛发黄", "眼睛黄", "巩膜黄", "巩膜发黄", "身上发黄"}
+)
+
+var redFlagRules = []redFlagRule{
+	{RedFlag{ID: "hematemesis", Category: "gi_bleeding",
+		Sign: "vomiting blood", Action: "possible bleeding in the stomach or gullet",
+		signZH: "呕血", actionZH: "可能是上消化道出血"},
+		[][]string{{"vomiting blood", "vomited blood", "vomit blood", "throwing up blood", "threw up blood", "blood in my vomit",
+			"blood in vomit", "coffee ground", "coffee-ground", "hematemesis", "haematemesis", "呕血", "吐血", "咖啡渣", "咖啡色呕吐物"}}},
+	{RedFlag{ID: "melena", Category: "gi_bleeding",
+		Sign: "black, tarry stools", Action: "possible bleeding in the stomach or bowel",
+		signZH: "黑便或柏油样便", actionZH: "可能是消化道出血"},
+		[][]string{{"black stool", "black poop", "black tarry", "black, tarry", "tarry stool", "tar-like stool", "melena", "melaena",
+			"黑便", "柏油样便", "柏油便", "大便发黑", "大便是黑色", "大便黑"}}},
+	{RedFlag{ID: "hematochezia", Category: "gi_bleeding",
+		Sign: "blood in the stool", Action: "possible bleeding in the bowel",
+		signZH: "便血", actionZH: "可能是下消化道出血"},
+		[][]string{{"blood in my stool", "blood in stool", "blood in the stool", "bloody stool", "bloody poop", "rectal bleeding",
+			"bleeding from the rectum", "便血", "大便带血", "大便有血", "拉血"}}},
+	{RedFlag{ID: "cholangitis", Category: "biliary_obstruction",
+		Sign: "fever with jaundice or a bile duct stent or drain", Action: "possible infection of a blocked bile duct (cholangitis)",
+		signZH: "发热伴黄疸或胆道支架/引流管", actionZH: "可能是胆道梗阻合并感染（胆管炎）"},
+		[][]string{feverTerms, append(append([]string{}, jaundiceTerms...),
+			"stent", "biliary drain", "ptcd", "ptbd", "支架", "引流管")}},
+	{RedFlag{ID: "jaundice", Category: "biliary_obstruction",
+		Sign: "yellowing of the skin or eyes", Action: "possible blocked bile duct or stent",
+		signZH: "皮肤或眼睛发黄", actionZH: "可能是胆道梗阻或支架堵塞"},
+		[][]string{jaundiceTerms}},
+	{RedFlag{ID: "dark_urine_pale_stool", Category: "biliary_obstruction",
+		Sign: "dark urine with pale stools", Action: "possible blocked bile duct or stent",
+		signZH: "尿色深伴大便颜色变浅", actionZH: "可能是胆道梗阻或支架堵塞"},
+		[][]string{
+			{"dark urine", "tea-colored urine", "tea-coloured urine", "cola-colored urine", "brown urine", "浓茶色尿", "浓茶色",
+				"尿色深", "尿色加深", "小便颜色深", "酱油色尿"},
+			{"pale stool", "pale poop", "clay-colored stool", "clay-coloured stool", "clay colored stool", "white stool",
+				"light-colored stool", "grey stool", "gray stool", "陶土色", "白陶土", "大便发白", "大便颜色变浅", "大便变白"}}},
+	{RedFlag{ID: "febrile_neutropenia", Category: "febrile_neutropenia",
+		Sign: "fever or chills while on chemotherapy or with low white cells", Action: "possible febrile neutropenia, a serious infection risk",
+		signZH: "化疗期间或白细胞低时发热或寒战", actionZH: "可能是粒细胞缺乏伴发热，感染风险很高"},
+		[][]string{append(append([]string{}, feverTerms...), "chills", "rigors", "shaking chills", "shivering", "寒战", "打寒颤", "发冷"),
+			append(append([]string{}, chemoTerms...), "neutropenia", "neutropenic", "low neutrophil", "low white", "low wbc",
+				"low anc", "白细胞低", "白细胞减少", "粒细胞低", "粒细胞减少", "中性粒细胞低", "中性粒细胞减少", "粒缺")}},
+}
+
+var (
+	// temperaturePattern matches readings such as "38.5°C", "39 ℃", "38度"
+	// and "101.3F".
+	temperaturePattern = regexp.MustCompile(`(\d{2,3}(?:\.\d)?)\s*(°\s*[cf]|℃|℉|度|摄氏度|c\b|f\b)`)
+	negationWords      = []string{"no", "not", "without", "denies", "denied", "never", "free of", "don't have", "doesn't have", "didn't have"}
+	negationBreaks     = map[string]bool{"and": true, "but": true, "now": true, "then": true, "though": true, "although": true, "however": true}
+	negationPrefixesZH = []string{"没有", "没", "无", "不", "未", "否认"}
+)
+
+// CheckRedFlags returns the red-flag symptoms text mentions: signs of
+// gastrointestinal bleeding, biliary obstruction and febrile neutropenia.
+// Terms directly after a negation ("no fever", "没有发烧") do not count.
+// The rules are deliberately broad; a false alarm costs far less than a
+// missed bleed or sepsis.
+func CheckRedFlags(text string) []RedFlag {
+	text = strings.ToLower(text)
+	if hasFeverReading(text) {
+		text += "\n" + feverTerm
+	}
+	var flags []RedFlag
+	seen := make(map[string]bool)
+	for _, rule := range redFlagRules {
+		if seen[rule.flag.Category] && rule.flag.Category == "biliary_obstruction" {
+			// One biliary flag is enough; the rules run most specific first
+			continue
+		}
+		matched := true
+		for _, group := range rule.groups {
+			if !mentionsAny(text, group) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			flags = append(flags, rule.flag)
+			seen[rule.flag.Category] = true
+		}
+	}
+	return flags
+}
+
+// hasFeverReading reports whether text gives a body temperature of at
+// least 38 °C (100.4 °F).
+func hasFeverReading(text string) bool {
+	for _, m := range temperaturePattern.FindAllStringSubmatch(text, -1) {
+		value, err := strconv.ParseFloat(m[1], 64)
+		if err != nil {
+			continue
+		}
+		if strings.ContainsAny(m[2], "f℉") {
+			if value >= 100.4 && value < 110 {
+				return true
+			}
+		} else if value >= 38 && value < 45 {
+			return true
+		}
+	}
+	return false
+}
+
+// mentionsAny reports whether text contains one of terms outside a
+// negation. English terms must start at a word boundary.
+func mentionsAny(text string, terms []string) bool {
+	for _, term := range terms {
+		for from := 0; ; {
+			i := strings.Index(text[from:], term)
+			if i < 0 {
+				break
+			}
+			i += from
+			from = i + len(term)
+			if isASCIIWord(term) && i > 0 && isWordByte(text[i-1]) {
+				continue
+			}
+			if !negated(text[:i]) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// negated reports whether the text just before a term negates it.
+func negated(before string) bool {
+	for _, prefix := range negationPrefixesZH {
+		if strings.HasSuffix(before, prefix) {
+			return true
+		}
+	}
+	words := strings.FieldsFunc(before, func(r rune) bool {
+		return !unicode.IsLetter(r) && r != '\''
+	})
+	// "no fever", "no black stool", "no fever or chills"; a clause boundary
+	// ends the negation ("no appetite and a fever")
+	for n := 1; n <= 3 && n <= len(words); n++ {
+		word := words[len(words)-n]
+		if negationBreaks[word] || strings.ContainsAny(before[strings.LastIndex(before, word):], ".,;!?\n") {
+			break
+		}
+		tail := strings.Join(words[len(words)-n:], " ")
+		for _, neg := range negationWords {
+			if tail == neg || strings.HasPrefix(tail, neg+" ") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func isASCIIWord(s string) bool {
+	return s != "" && s[0] < unicode.MaxASCII && isWordByte(s[0])
+}
+
+func isWordByte(b byte) bool {
+	return b >= 'a' && b <= 'z' || b >= '0' && b <= '9'
+}
+
+// RedFlagEscalation is the urgent-care message shown before any answer to
+// a message with red flags, in Chinese when chinese is set.
+func RedFlagEscalation(flags []RedFlag, chinese bool) string {
+	var b strings.Builder
+	if chinese {
+		b.WriteString("⚠️ 紧急提醒：您描述的情况可能需要立即就医。\n")
+		for _, f := range flags {
+			b.WriteString("- " + f.signZH + "：" + f.actionZH + "\n")
+		}
+		b.WriteString("请立即前往最近的急诊，或拨打 120 / 联系您的主治医生团队。不要等待症状自行好转，也不要因为下面的回答而延误就医。")
+		return b.String()
+	}
+	b.WriteString("⚠️ Urgent: what you describe may need medical care right away.\n")
+	for _, f := range flags {
+		b.WriteString("- " + capitalize(f.Sign) + ": " + f.Action + "\n")
+	}
+	b.WriteString("Please go to the nearest emergency department now, or call emergency services or your cancer care team's urgent line. " +
+		"Do not wait to see if it gets better, and do not let the answer below delay getting care.")
+	return b.String()
+}
+
+func capitalize(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
+
+// TriageTool checks a description of symptoms against the red-flag rules.
+type TriageTool struct{}
+
+func NewTriageTool() *TriageTool {
+	return &TriageTool{}
+}
+
+func (t *TriageTool) Name() string {
+	return "symptom_triage"
+}
+
+func (t *TriageTool) Description() string {
+	return "Check symptoms against red-flag rules for people with pancreatic cancer: signs of gastrointestinal bleeding (vomiting blood, black stools), " +
+		"biliary obstruction (jaundice, dark urine with pale stools, fever with a stent) and febrile neutropenia (fever during chemotherapy). " +
+		"Returns the red flags found and whether urgent care is needed. Rule-based; it cannot rule anything out, so never reassure the user based on an empty result."
+}
+
+func (t *TriageTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"symptoms": map[string]interface{}{
+				"type":        "string",
+				"description": "The symptoms in the user's words, including temperature readings and current treatment such as chemotherapy or a stent",
+			},
+		},
+		"required": []string{"symptoms"},
+	}
+}
+
+type triageArgs struct {
+	Symptoms string `json:"symptoms" arg:"required"`
+}
+
+func (t *TriageTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	a, err := BindArgs[triageArgs](args)
+	if err != nil {
+		return ErrorResult(err.Error()).WithError(err)
+	}
+	flags := CheckRedFlags(a.Symptoms)
+	result := map[string]interface{}{
+		"urgent":    len(flags) > 0,
+		"red_flags": flags,
+	}
+	if len(flags) > 0 {
+		result["advice"] = RedFlagEscalation(flags, false)
+	} else {
+		result["red_flags"] = []RedFlag{}
+		result["advice"] = "No red-flag rule matched. This does not rule out a serious problem; symptoms that are severe, new or getting worse still need the care team."
+	}
+	payload, _ := json.Marshal(result)
+	return NewToolResult(string(payload))
+}
@@ -0,0 +1,68 @@
+package tools
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestCheckRedFlags(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"I threw up blood this morning", []string{"hematemesis"}},
+		{"My stools have been black and tarry since yesterday, 黑便", []string{"melena"}},
+		{"Dad's eyes look yellow and his urine is dark", []string{"jaundice"}},
+		{"Dark urine for two days and pale stools", []string{"dark_urine_pale_stool"}},
+		{"He has a stent and now a fever with chills", []string{"cholangitis"}},
+		{"Day 8 after gemcitabine, temperature 38.4°C", []string{"febrile_neutropenia"}},
+		{"化疗后第七天，发烧39度，寒战", []string{"febrile_neutropenia"}},
+		{"Running 101.2F during chemo", []string{"febrile_neutropenia"}},
+		{"皮肤发黄，发热，有胆道支架", []string{"cholangitis"}},
+		{"vomiting blood and black stool after chemo, 38.5℃", []string{"hematemesis", "melena", "febrile_neutropenia"}},
+
+		{"No fever, no black stools, just tired after chemo", nil},
+		{"没有发烧，也没有黑便，化疗后有点乏力", nil},
+		{"Temperature 37.2°C on chemo, no fever or chills", nil},
+		{"Mild nausea and a poor appetite", nil},
+		{"I had a fever last week but no chemo yet", nil},
+		{"No appetite and a fever since starting FOLFIRINOX", []string{"febrile_neutropenia"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			var got []string
+			for _, f := range CheckRedFlags(tt.text) {
+				got = append(got, f.ID)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("CheckRedFlags() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedFlagEscalation(t *testing.T) {
+	flags := CheckRedFlags("vomiting blood")
+	if msg := RedFlagEscalation(flags, false); !strings.HasPrefix(msg, "⚠️ Urgent") || !strings.Contains(msg, "Vomiting blood") {
+		t.Errorf("English escalation = %q", msg)
+	}
+	if msg := RedFlagEscalation(flags, true); !strings.Contains(msg, "呕血") || !strings.Contains(msg, "120") {
+		t.Errorf("Chinese escalation = %q", msg)
+	}
+}
+
+func TestTriageTool(t *testing.T) {
+	tool := NewTriageTool()
+	result := tool.Execute(context.Background(), map[string]interface{}{"symptoms": "black stool"})
+	if result.IsError || !strings.Contains(result.ForLLM, `"urgent":true`) || !strings.Contains(result.ForLLM, `"melena"`) {
+		t.Errorf("red flag: %s", result.ForLLM)
+	}
+	result = tool.Execute(context.Background(), map[string]interface{}{"symptoms": "tired"})
+	if result.IsError || !strings.Contains(result.ForLLM, `"urgent":false`) || !strings.Contains(result.ForLLM, `"red_flags":[]`) {
+		t.Errorf("no red flag: %s", result.ForLLM)
+	}
+	if result := tool.Execute(context.Background(), map[string]interface{}{}); !result.IsError {
+		t.Errorf("missing symptoms accepted: %s", result.ForLLM)
+	}
+}
@@ -0,0 +1,148 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/sipeed/picoclaw/pkg/voice"
+)
+
+var (
+	speechLink     = regexp.MustCompile(`!?\[([^\]]*)\]\([^)]*\)`)
+	speechURL      = regexp.MustCompile(`https?://\S+`)
+	speechCitation = regexp.MustCompile(`\[\d+(?:\s*[,，-]\s*\d+)*\]`)
+	speechMarkup   = regexp.MustCompile("(?m)^[ \\t]{0,3}(?:#{1,6}\\s+|>\\s?|[-*+•]\\s+)|\\*\\*|__|`+|~~")
+	speechRule     = regexp.MustCompile(`(?m)^[ \t]*(?:(?:\|?[ \t]*:?-{3,}:?[ \t]*)+\|?|[-*_]{3,})[ \t]*(?:\n|$)`)
+	speechBlank    = regexp.MustCompile(`\n{3,}`)
+)
+
+// TextToSpeechTool reads text aloud into an audio file and sends it to the
+// user as a voice message, for users who find long written answers hard to
+// read.
+type TextToSpeechTool struct {
+	synth     voice.Synthesizer
+	workspace string
+	maxChars  int
+	now       func() time.Time
+}
+
+func NewTextToSpeechTool(synth voice.Synthesizer, workspace string, maxChars int) *TextToSpeechTool {
+	if maxChars <= 0 {
+		maxChars = 3000
+	}
+	return &TextToSpeechTool{synth: synth, workspace: workspace, maxChars: maxChars, now: time.Now}
+}
+
+func (t *TextToSpeechTool) Name() string {
+	return "text_to_speech"
+}
+
+func (t *TextToSpeechTool) Description() string {
+	return "Read text aloud and send it to the user as a voice message. " +
+		"Use it when the user asks for a voice reply or says reading is hard for them, such as an elderly patient or family member: " +
+		"pass your final answer as text, written to be heard (short sentences, no tables or links), then reply briefly. " +
+		"Markdown, links and citation numbers are not read out."
+}
+
+func (t *TextToSpeechTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"text": map[string]interface{}{
+				"type":        "string",
+				"description": fmt.Sprintf("The text to read aloud, at most %d characters", t.maxChars),
+			},
+			"voice": map[string]interface{}{
+				"type":        "string",
+				"description": "Voice name to use instead of the configured one, e.g. zh-CN-YunxiNeural",
+			},
+			"rate": map[string]interface{}{
+				"type":        "string",
+				"description": "Speaking rate relative to normal, e.g. -25% for slower speech",
+			},
+		},
+		"required": []string{"text"},
+	}
+}
+
+type textToSpeechArgs struct {
+	Text  string `json:"text" arg:"required"`
+	Voice string `json:"voice"`
+	Rate  string `json:"rate"`
+}
+
+var speechRate = regexp.MustCompile(`^[+-]?\d{1,3}%$`)
+
+func (t *TextToSpeechTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	a, err := BindArgs[textToSpeechArgs](args)
+	if err != nil {
+		return ErrorResult(err.Error()).WithError(err)
+	}
+	if a.Rate != "" && !speechRate.MatchString(a.Rate) {
+		return ErrorResult(fmt.Sprintf("rate %q must be a percentage such as -25%%", a.Rate)).WithError(ErrInvalidArgs)
+	}
+	text := speechText(a.Text)
+	if text == "" {
+		return ErrorResult("nothing to read aloud").WithError(ErrInvalidArgs)
+	}
+	if n := utf8.RuneCountInString(text); n > t.maxChars {
+		return ErrorResult(fmt.Sprintf("text is %d characters; the limit is %d. Shorten it or send it in parts", n, t.maxChars)).
+			WithError(ErrInvalidArgs)
+	}
+
+	speech, err := t.synth.Synthesize(ctx, text, voice.SpeechOptions{Voice: a.Voice, Rate: a.Rate})
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("speech synthesis failed: %v", err)).WithError(ClassifyError(ErrRetryable, err))
+	}
+
+	dir := filepath.Join(t.workspace, "audio")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return ErrorResult(fmt.Sprintf("failed to save audio: %v", err)).WithError(err)
+	}
+	name := fmt.Sprintf("speech-%s.%s", t.now().Format("20060102-150405.000"), speech.Format)
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, speech.Audio, 0600); err != nil {
+		return ErrorResult(fmt.Sprintf("failed to save audio: %v", err)).WithError(err)
+	}
+
+	file := FileBlock(name, "", path)
+	file.MimeType = speech.MimeType()
+	result := RichUserResult(file)
+	result.ForLLM = fmt.Sprintf("Voice message sent to the user (%d characters read, saved as audio/%s). Do not repeat the full text; reply briefly.",
+		utf8.RuneCountInString(text), name)
+	return result
+}
+
+// speechText turns a Markdown answer into text to be read aloud: link
+// text without its URL, no citation numbers, table rows as phrases and no
+// formatting marks.
+func speechText(markdown string) string {
+	s := strings.ReplaceAll(markdown, "\r\n", "\n")
+	s = speechRule.ReplaceAllString(s, "")
+	s = speechLink.ReplaceAllString(s, "$1")
+	s = speechURL.ReplaceAllString(s, "")
+	s = speechCitation.ReplaceAllString(s, "")
+	s = speechMarkup.ReplaceAllString(s, "")
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "|") || strings.HasSuffix(line, "|") {
+			var cells []string
+			for _, cell := range strings.Split(strings.Trim(line, "|"), "|") {
+				if cell = strings.TrimSpace(cell); cell != "" {
+					cells = append(cells, cell)
+				}
+			}
+			line = strings.Join(cells, ", ")
+		}
+		lines[i] = line
+	}
+	s = speechBlank.ReplaceAllString(strings.Join(lines, "\n"), "\n\n")
+	return strings.TrimSpace(s)
+}
@@ -0,0 +1,85 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/voice"
+)
+
+type fakeSynthesizer struct {
+	text string
+	opts voice.SpeechOptions
+	err  error
+}
+
+func (s *fakeSynthesizer) Synthesize(ctx context.Context, text string, opts voice.SpeechOptions) (*voice.Speech, error) {
+	s.text, s.opts = text, opts
+	if s.err != nil {
+		return nil, s.err
+	}
+	return &voice.Speech{Audio: []byte("ID3"), Format: "mp3"}, nil
+}
+
+func TestTextToSpeech(t *testing.T) {
+	synth := &fakeSynthesizer{}
+	tool := NewTextToSpeechTool(synth, t.TempDir(), 0)
+	result := tool.Execute(context.Background(), map[string]interface{}{
+		"text": "## 化疗期间发热\n\n**体温≥38°C** 请立即就医 [1]。详见[指南](https://example.org/g)。",
+		"rate": "-25%",
+	})
+	if result.IsError {
+		t.Fatal(result.ForLLM)
+	}
+	if synth.text != "化疗期间发热\n\n体温≥38°C 请立即就医 。详见指南。" || synth.opts.Rate != "-25%" {
+		t.Errorf("synthesized %q with %+v", synth.text, synth.opts)
+	}
+	if len(result.Content) != 1 || !result.ContentForUser || result.Content[0].MimeType != "audio/mpeg" {
+		t.Fatalf("content = %+v", result.Content)
+	}
+	if data, err := os.ReadFile(result.Content[0].Path); err != nil || string(data) != "ID3" {
+		t.Errorf("audio file: %q, %v", data, err)
+	}
+}
+
+func TestTextToSpeech_Errors(t *testing.T) {
+	tool := NewTextToSpeechTool(&fakeSynthesizer{}, t.TempDir(), 10)
+	failing := NewTextToSpeechTool(&fakeSynthesizer{err: errors.New("edge-tts failed")}, t.TempDir(), 0)
+	tests := []struct {
+		name string
+		tool *TextToSpeechTool
+		args map[string]interface{}
+		kind error
+		text string
+	}{
+		{"too long", tool, map[string]interface{}{"text": strings.Repeat("长", 11)}, ErrInvalidArgs, "the limit is 10"},
+		{"only markup", tool, map[string]interface{}{"text": "---\n[1]"}, ErrInvalidArgs, "nothing to read aloud"},
+		{"bad rate", tool, map[string]interface{}{"text": "hi", "rate": "slow"}, ErrInvalidArgs, "must be a percentage"},
+		{"backend failure", failing, map[string]interface{}{"text": "hi"}, ErrRetryable, "edge-tts failed"},
+	}
+	for _, tt := range tests {
+		result := tt.tool.Execute(context.Background(), tt.args)
+		if !result.IsError || !errors.Is(result.Err, tt.kind) || !strings.Contains(result.ForLLM, tt.text) {
+			t.Errorf("%s: %+v", tt.name, result)
+		}
+	}
+}
+
+func TestSpeechText(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"- 恶心\n- 乏力", "恶心\n乏力"},
+		{"| 指标 | 结果 |\n|---|---|\n| CA19-9 | 120 |", "指标, 结果\nCA19-9, 120"},
+		{"See https://example.org/x and `code` [2, 3].", "See  and code ."},
+		{"> quoted\n\n\n\nnext", "quoted\n\nnext"},
+	}
+	for _, tt := range tests {
+		if got := speechText(tt.in); got != tt.want {
+			t.Errorf("speechText(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
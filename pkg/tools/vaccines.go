@@ -0,0 +1,292 @@
+package tools
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// builtinVaccineJSON is the vaccination guidance shipped with picoclaw.
+//
+//go:embed data/vaccine_schedules.json
+var builtinVaccineJSON []byte
+
+// VaccineGuidance is the guideline data behind vaccine_schedule.
+type VaccineGuidance struct {
+	Source   string `json:"source"`
+	Reviewed string `json:"reviewed,omitempty"`
+	// CycleWindow is when, within a chemotherapy cycle, non-live vaccines
+	// are best given: this many days after a dose and before the next.
+	CycleWindow struct {
+		DaysAfterDose      int `json:"days_after_dose"`
+		DaysBeforeNextDose int `json:"days_before_next_dose"`
+	} `json:"cycle_window"`
+	GeneralNotes   []string          `json:"general_notes,omitempty"`
+	HouseholdNotes []string          `json:"household_notes,omitempty"`
+	Vaccines       []VaccineSchedule `json:"vaccines"`
+}
+
+// VaccineSchedule is the recommendation for one vaccine.
+type VaccineSchedule struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	NameZH    string `json:"name_zh,omitempty"`
+	Live      bool   `json:"live"`
+	AppliesTo string `json:"applies_to"` // "all" or "asplenia"
+	Doses     string `json:"doses"`
+	// BeforeChemoDays is how long before chemotherapy starts the vaccine
+	// should be given.
+	BeforeChemoDays int `json:"before_chemo_days"`
+	// DuringChemo is "between_cycles" or "avoid".
+	DuringChemo string `json:"during_chemo"`
+	// AfterChemoMonths is how long after chemotherapy ends a vaccine
+	// avoided during it may be given.
+	AfterChemoMonths int      `json:"after_chemo_months,omitempty"`
+	Notes            []string `json:"notes,omitempty"`
+}
+
+// VaccineScheduleTool recommends vaccinations for patients on or around
+// chemotherapy, with dates worked out from their treatment schedule.
+type VaccineScheduleTool struct {
+	builtin  *VaccineGuidance
+	dataPath string
+	now      func() time.Time
+
+	mu       sync.Mutex
+	guidance *VaccineGuidance
+	loaded   time.Time // modification time of the loaded data file
+}
+
+// NewVaccineScheduleTool returns the tool over the built-in guidance or,
+// when dataPath names an existing file, the guidance in that file.
+func NewVaccineScheduleTool(dataPath string) (*VaccineScheduleTool, error) {
+	var builtin VaccineGuidance
+	if err := json.Unmarshal(builtinVaccineJSON, &builtin); err != nil {
+		return nil, fmt.Errorf("invalid built-in vaccine guidance: %w", err)
+	}
+	return &VaccineScheduleTool{builtin: &builtin, dataPath: dataPath, now: time.Now}, nil
+}
+
+func (t *VaccineScheduleTool) Name() string {
+	return "vaccine_schedule"
+}
+
+func (t *VaccineScheduleTool) Description() string {
+	return "Recommended vaccinations (flu, pneumococcal, COVID-19, shingles, and more after splenectomy) for a patient before, during or after chemotherapy, " +
+		"with the best dates relative to their chemotherapy cycles and which live vaccines to avoid. " +
+		"Give the treatment dates the user mentions so the timing can be worked out."
+}
+
+func (t *VaccineScheduleTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"treatment_status": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"not_started", "on_chemotherapy", "finished"},
+				"description": "Where the patient is in chemotherapy",
+			},
+			"chemo_start_date": map[string]interface{}{
+				"type":        "string",
+				"description": "Planned first chemotherapy day, YYYY-MM-DD, when not started",
+			},
+			"last_dose_date": map[string]interface{}{
+				"type":        "string",
+				"description": "Most recent chemotherapy day, YYYY-MM-DD, when on chemotherapy",
+			},
+			"next_dose_date": map[string]interface{}{
+				"type":        "string",
+				"description": "Next chemotherapy day, YYYY-MM-DD, when on chemotherapy",
+			},
+			"cycle_length_days": map[string]interface{}{
+				"type":        "integer",
+				"description": "Days between treatment days when the next date is unknown, e.g. 14 for FOLFIRINOX, 7 for weekly gemcitabine",
+			},
+			"chemo_end_date": map[string]interface{}{
+				"type":        "string",
+				"description": "Last chemotherapy day, YYYY-MM-DD, when finished",
+			},
+			"splenectomy": map[string]interface{}{
+				"type":        "boolean",
+				"description": "Whether the spleen was removed or is planned to be, e.g. in a distal pancreatectomy",
+			},
+		},
+		"required": []string{"treatment_status"},
+	}
+}
+
+type vaccineScheduleArgs struct {
+	TreatmentStatus string `json:"treatment_status" arg:"required,enum=not_started|on_chemotherapy|finished"`
+	ChemoStartDate  string `json:"chemo_start_date"`
+	LastDoseDate    string `json:"last_dose_date"`
+	NextDoseDate    string `json:"next_dose_date"`
+	CycleLengthDays int    `json:"cycle_length_days" arg:"min=1,max=90"`
+	ChemoEndDate    string `json:"chemo_end_date"`
+	Splenectomy     bool   `json:"splenectomy"`
+}
+
+// vaccineDates are the treatment dates given, zero when not.
+type vaccineDates struct {
+	today, start, last, next, end time.Time
+}
+
+func (t *VaccineScheduleTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	a, err := BindArgs[vaccineScheduleArgs](args)
+	if err != nil {
+		return ErrorResult(err.Error()).WithError(err)
+	}
+	guidance, err := t.load()
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("vaccine guidance unavailable: %v", err)).WithError(err)
+	}
+
+	now := t.now()
+	dates := vaccineDates{today: time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)}
+	for _, d := range []struct {
+		name, value string
+		into        *time.Time
+	}{
+		{"chemo_start_date", a.ChemoStartDate, &dates.start},
+		{"last_dose_date", a.LastDoseDate, &dates.last},
+		{"next_dose_date", a.NextDoseDate, &dates.next},
+		{"chemo_end_date", a.ChemoEndDate, &dates.end},
+	} {
+		if d.value == "" {
+			continue
+		}
+		if *d.into, err = time.Parse("2006-01-02", d.value); err != nil {
+			return ErrorResult(fmt.Sprintf("%s %q must be YYYY-MM-DD", d.name, d.value)).WithError(ErrInvalidArgs)
+		}
+	}
+	if dates.next.IsZero() && !dates.last.IsZero() && a.CycleLengthDays > 0 {
+		dates.next = dates.last.AddDate(0, 0, a.CycleLengthDays)
+	}
+
+	var recommendations []map[string]interface{}
+	for _, v := range guidance.Vaccines {
+		if v.AppliesTo == "asplenia" && !a.Splenectomy {
+			continue
+		}
+		rec := map[string]interface{}{
+			"id":     v.ID,
+			"name":   v.Name,
+			"live":   v.Live,
+			"doses":  v.Doses,
+			"timing": vaccineTiming(v, a.TreatmentStatus, dates, guidance),
+		}
+		if v.NameZH != "" {
+			rec["name_zh"] = v.NameZH
+		}
+		if v.AppliesTo == "asplenia" {
+			rec["reason"] = "no spleen: higher risk of severe infection with encapsulated bacteria"
+		}
+		if len(v.Notes) > 0 {
+			rec["notes"] = v.Notes
+		}
+		recommendations = append(recommendations, rec)
+	}
+
+	out := map[string]interface{}{
+		"treatment_status": a.TreatmentStatus,
+		"vaccines":         recommendations,
+		"general_notes":    guidance.GeneralNotes,
+		"household_notes":  guidance.HouseholdNotes,
+		"source":           guidance.Source,
+	}
+	if guidance.Reviewed != "" {
+		out["reviewed"] = guidance.Reviewed
+	}
+	payload, _ := json.Marshal(out)
+	return NewToolResult(string(payload))
+}
+
+// vaccineTiming explains when to give v, with dates where the treatment
+// schedule allows.
+func vaccineTiming(v VaccineSchedule, status string, d vaccineDates, g *VaccineGuidance) string {
+	const day = "2006-01-02"
+	switch status {
+	case "not_started":
+		if d.start.IsZero() {
+			return fmt.Sprintf("Give at least %d days before chemotherapy starts.", v.BeforeChemoDays)
+		}
+		latest := d.start.AddDate(0, 0, -v.BeforeChemoDays)
+		if !latest.Before(d.today) {
+			return fmt.Sprintf("Give by %s, %d days before chemotherapy starts on %s.", latest.Format(day), v.BeforeChemoDays, d.start.Format(day))
+		}
+		if v.DuringChemo == "avoid" {
+			return fmt.Sprintf("Too late to give before chemotherapy on %s; do not give until at least %d months after chemotherapy ends.",
+				d.start.Format(day), v.AfterChemoMonths)
+		}
+		return fmt.Sprintf("Chemotherapy starts on %s, too soon for the ideal %d-day gap; give it now rather than wait, or between cycles.",
+			d.start.Format(day), v.BeforeChemoDays)
+
+	case "on_chemotherapy":
+		if v.DuringChemo == "avoid" {
+			return fmt.Sprintf("Do not give during chemotherapy, nor for %d months after it ends.", v.AfterChemoMonths)
+		}
+		if d.last.IsZero() || d.next.IsZero() {
+			return "Give between cycles, away from treatment days and the expected low point in white cells; give the treatment dates for a suggested window."
+		}
+		from := d.last.AddDate(0, 0, g.CycleWindow.DaysAfterDose)
+		to := d.next.AddDate(0, 0, -g.CycleWindow.DaysBeforeNextDose)
+		if from.Before(d.today) {
+			from = d.today
+		}
+		if from.After(to) {
+			return fmt.Sprintf("This cycle leaves no good window; aim for %d days after a treatment day and at least %d days before the next, and ask the oncology team.",
+				g.CycleWindow.DaysAfterDose, g.CycleWindow.DaysBeforeNextDose)
+		}
+		return fmt.Sprintf("Best between %s and %s, between treatment days.", from.Format(day), to.Format(day))
+
+	default: // finished
+		if v.DuringChemo != "avoid" {
+			return "Can be given now if not already done."
+		}
+		if d.end.IsZero() {
+			return fmt.Sprintf("Not until at least %d months after chemotherapy ends, and only if the oncologist agrees.", v.AfterChemoMonths)
+		}
+		earliest := d.end.AddDate(0, v.AfterChemoMonths, 0)
+		if earliest.After(d.today) {
+			return fmt.Sprintf("Not before %s (%d months after chemotherapy ended), and only if the oncologist agrees.", earliest.Format(day), v.AfterChemoMonths)
+		}
+		return "May be given if needed and the oncologist agrees."
+	}
+}
+
+// load returns the guidance in the data file, reloading it when it has
+// changed, or the built-in guidance when there is no file.
+func (t *VaccineScheduleTool) load() (*VaccineGuidance, error) {
+	if t.dataPath == "" {
+		return t.builtin, nil
+	}
+	info, err := os.Stat(t.dataPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return t.builtin, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.guidance != nil && info.ModTime().Equal(t.loaded) {
+		return t.guidance, nil
+	}
+	data, err := os.ReadFile(t.dataPath)
+	if err != nil {
+		return nil, err
+	}
+	var g VaccineGuidance
+	if err := json.Unmarshal(data, &g); err != nil {
+		return nil, fmt.Errorf("invalid vaccine guidance %s: %w", t.dataPath, err)
+	}
+	if len(g.Vaccines) == 0 {
+		return nil, fmt.Errorf("vaccine guidance %s lists no vaccines", t.dataPath)
+	}
+	t.guidance, t.loaded = &g, info.ModTime()
+	return t.guidance, nil
+}
@@ -0,0 +1,121 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBuiltinVaccineGuidance(t *testing.T) {
+	tool, err := NewVaccineScheduleTool("")
+	if err != nil {
+		t.Fatalf("NewVaccineScheduleTool() error: %v", err)
+	}
+	g := tool.builtin
+	if g.Source == "" || g.CycleWindow.DaysAfterDose == 0 {
+		t.Errorf("guidance lacks a source or cycle window: %+v", g)
+	}
+	for _, v := range g.Vaccines {
+		if v.ID == "" || v.Name == "" || v.Doses == "" || v.BeforeChemoDays <= 0 {
+			t.Errorf("incomplete vaccine %+v", v)
+		}
+		if v.AppliesTo != "all" && v.AppliesTo != "asplenia" {
+			t.Errorf("%s: applies_to %q", v.ID, v.AppliesTo)
+		}
+		if v.DuringChemo != "between_cycles" && v.DuringChemo != "avoid" {
+			t.Errorf("%s: during_chemo %q", v.ID, v.DuringChemo)
+		}
+		if v.Live && (v.DuringChemo != "avoid" || v.AfterChemoMonths == 0) {
+			t.Errorf("%s: live vaccines must be avoided during chemotherapy", v.ID)
+		}
+	}
+}
+
+func TestVaccineScheduleTool(t *testing.T) {
+	tool, _ := NewVaccineScheduleTool("")
+	tool.now = func() time.Time { return time.Date(2026, 5, 10, 9, 0, 0, 0, time.UTC) }
+
+	tests := []struct {
+		name    string
+		args    map[string]interface{}
+		vaccine string
+		timing  string
+	}{
+		{"before chemo", map[string]interface{}{"treatment_status": "not_started", "chemo_start_date": "2026-06-01"},
+			"influenza", "Give by 2026-05-18"},
+		{"live too late", map[string]interface{}{"treatment_status": "not_started", "chemo_start_date": "2026-06-01"},
+			"live_vaccines", "Too late"},
+		{"start too soon", map[string]interface{}{"treatment_status": "not_started", "chemo_start_date": "2026-05-15"},
+			"influenza", "give it now"},
+		{"between cycles", map[string]interface{}{"treatment_status": "on_chemotherapy", "last_dose_date": "2026-05-05", "cycle_length_days": 14},
+			"covid19", "Best between 2026-05-12 and 2026-05-16"},
+		{"window under way", map[string]interface{}{"treatment_status": "on_chemotherapy", "last_dose_date": "2026-05-01", "next_dose_date": "2026-05-15"},
+			"influenza", "Best between 2026-05-10 and 2026-05-12"},
+		{"weekly cycle", map[string]interface{}{"treatment_status": "on_chemotherapy", "last_dose_date": "2026-05-08", "cycle_length_days": 7},
+			"influenza", "no good window"},
+		{"no dates", map[string]interface{}{"treatment_status": "on_chemotherapy"},
+			"pneumococcal", "Give between cycles"},
+		{"live during chemo", map[string]interface{}{"treatment_status": "on_chemotherapy"},
+			"live_vaccines", "Do not give"},
+		{"live after chemo", map[string]interface{}{"treatment_status": "finished", "chemo_end_date": "2026-04-01"},
+			"live_vaccines", "Not before 2026-07-01"},
+		{"asplenia", map[string]interface{}{"treatment_status": "finished", "splenectomy": true},
+			"meningococcal_acwy", "Can be given now"},
+	}
+	for _, tt := range tests {
+		result := tool.Execute(context.Background(), tt.args)
+		if result.IsError {
+			t.Fatalf("%s: %s", tt.name, result.ForLLM)
+		}
+		var out struct {
+			Vaccines []struct {
+				ID     string `json:"id"`
+				Timing string `json:"timing"`
+			} `json:"vaccines"`
+		}
+		if err := json.Unmarshal([]byte(result.ForLLM), &out); err != nil {
+			t.Fatalf("%s: invalid JSON: %v", tt.name, err)
+		}
+		found := false
+		for _, v := range out.Vaccines {
+			if v.ID == tt.vaccine {
+				found = true
+				if !strings.Contains(v.Timing, tt.timing) {
+					t.Errorf("%s: %s timing = %q, want it to contain %q", tt.name, v.ID, v.Timing, tt.timing)
+				}
+			}
+			if v.ID == "meningococcal_acwy" && tt.args["splenectomy"] != true {
+				t.Errorf("%s: asplenia vaccine listed without splenectomy", tt.name)
+			}
+		}
+		if !found {
+			t.Errorf("%s: %s not listed", tt.name, tt.vaccine)
+		}
+	}
+
+	result := tool.Execute(context.Background(), map[string]interface{}{"treatment_status": "finished", "chemo_end_date": "01/04/2026"})
+	if !result.IsError || !errors.Is(result.Err, ErrInvalidArgs) {
+		t.Errorf("bad date: %+v", result)
+	}
+}
+
+func TestVaccineScheduleTool_CustomGuidance(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vaccines.json")
+	tool, _ := NewVaccineScheduleTool(path)
+
+	result := tool.Execute(context.Background(), map[string]interface{}{"treatment_status": "finished"})
+	if result.IsError || !strings.Contains(result.ForLLM, "pneumococcal") {
+		t.Fatalf("without a file the built-in guidance is used: %s", result.ForLLM)
+	}
+
+	os.WriteFile(path, []byte(`{"source":"Local protocol","vaccines":[{"id":"hepb","name":"Hepatitis B","applies_to":"all","doses":"3 doses","before_chemo_days":14,"during_chemo":"between_cycles"}]}`), 0644)
+	result = tool.Execute(context.Background(), map[string]interface{}{"treatment_status": "finished"})
+	if result.IsError || !strings.Contains(result.ForLLM, "Hepatitis B") || strings.Contains(result.ForLLM, "pneumococcal") {
+		t.Errorf("custom guidance: %s", result.ForLLM)
+	}
+}
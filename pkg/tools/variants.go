@@ -0,0 +1,471 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	defaultClinVarBaseURL = defaultEUtilsBaseURL
+	defaultOncoKBBaseURL  = "https://www.oncokb.org/api/v1"
+	variantLookupTTL      = 24 * time.Hour
+	maxClinVarRecords     = 5
+	// defaultOncoTreeCode is pancreatic adenocarcinoma.
+	defaultOncoTreeCode = "PAAD"
+)
+
+var (
+	rsIDPattern          = regexp.MustCompile(`^rs\d+$`)
+	geneSymbolPattern    = regexp.MustCompile(`^[A-Z0-9-]{2,15}$`)
+	proteinChangePattern = regexp.MustCompile(`^p\.\(?([A-Za-z]{1,3}\d+[A-Za-z*]+\d*)\)?$`)
+)
+
+// clinVarStars maps a ClinVar review status to its star rating.
+var clinVarStars = map[string]int{
+	"practice guideline":                                   4,
+	"reviewed by expert panel":                             3,
+	"criteria provided, multiple submitters, no conflicts": 2,
+	"criteria provided, conflicting classifications":       1,
+	"criteria provided, conflicting interpretations":       1,
+	"criteria provided, single submitter":                  1,
+}
+
+// variantTherapy is therapy relevance the tool reports without OncoKB, for
+// variants with established meaning in pancreatic cancer.
+type variantTherapy struct {
+	genes      []string
+	alteration string // protein change such as "G12C"; "" means any pathogenic variant
+	relevance  string
+}
+
+var variantTherapies = []variantTherapy{
+	{[]string{"BRCA1", "BRCA2", "PALB2"}, "",
+		"Pathogenic germline BRCA1/2 variants make olaparib maintenance an option for metastatic pancreatic cancer that has not progressed on first-line platinum chemotherapy (POLO trial); " +
+			"BRCA1/2 and PALB2 variants also predict benefit from platinum-based chemotherapy such as FOLFIRINOX. PALB2 is not an approved PARP inhibitor indication but is studied in trials."},
+	{[]string{"MLH1", "MSH2", "MSH6", "PMS2", "EPCAM"}, "",
+		"Mismatch repair gene variants can cause mismatch repair deficiency (dMMR/MSI-H); if the tumour is dMMR/MSI-H, immune checkpoint inhibitors such as pembrolizumab are an option."},
+	{[]string{"KRAS"}, "G12C",
+		"KRAS G12C inhibitors (sotorasib, adagrasib) have shown activity in previously treated pancreatic cancer."},
+	{[]string{"ATM", "CHEK2", "BRIP1", "RAD51C", "RAD51D"}, "",
+		"Other homologous recombination genes may suggest platinum sensitivity, but PARP inhibitors are not established for them in pancreatic cancer; trials may be available."},
+}
+
+// hereditaryGenes are genes whose germline pathogenic variants raise
+// cancer risk in relatives, so genetic counselling is advised.
+var hereditaryGenes = map[string]bool{
+	"BRCA1": true, "BRCA2": true, "PALB2": true, "ATM": true, "CDKN2A": true, "TP53": true, "STK11": true,
+	"MLH1": true, "MSH2": true, "MSH6": true, "PMS2": true, "EPCAM": true, "CHEK2": true,
+}
+
+// VariantLookupOptions configures the variant_lookup tool.
+type VariantLookupOptions struct {
+	ClinVarBaseURL string
+	NCBIAPIKey     string
+	OncoKBBaseURL  string
+	OncoKBToken    string // OncoKB is queried only with a token
+	Timeout        time.Duration
+}
+
+// VariantLookupTool annotates a genetic variant with its ClinVar
+// classification and, when an OncoKB token is configured, its OncoKB
+// oncogenicity and treatment levels.
+type VariantLookupTool struct {
+	clinVarURL  string
+	ncbiKey     string
+	oncoKBURL   string
+	oncoKBToken string
+	client      *http.Client
+}
+
+func NewVariantLookupTool(opts VariantLookupOptions) *VariantLookupTool {
+	if opts.ClinVarBaseURL == "" {
+		opts.ClinVarBaseURL = defaultClinVarBaseURL
+	}
+	if opts.OncoKBBaseURL == "" {
+		opts.OncoKBBaseURL = defaultOncoKBBaseURL
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 20 * time.Second
+	}
+	return &VariantLookupTool{
+		clinVarURL:  strings.TrimRight(opts.ClinVarBaseURL, "/"),
+		ncbiKey:     opts.NCBIAPIKey,
+		oncoKBURL:   strings.TrimRight(opts.OncoKBBaseURL, "/"),
+		oncoKBToken: opts.OncoKBToken,
+		client:      &http.Client{Timeout: opts.Timeout},
+	}
+}
+
+func (t *VariantLookupTool) Name() string {
+	return "variant_lookup"
+}
+
+func (t *VariantLookupTool) Description() string {
+	return "Look up a genetic variant from a genetic test or NGS report in ClinVar (and OncoKB when configured). " +
+		"Give a gene with an HGVS change (e.g. BRCA2 c.5946delT or KRAS p.G12D) or an rsID. " +
+		"Returns the pathogenicity classification with its review status, linked conditions, and therapy relevance such as PARP inhibitors for BRCA1/2 or PALB2. " +
+		"Explain that the ordering doctor or a genetic counsellor must interpret the result for the patient."
+}
+
+func (t *VariantLookupTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"gene": map[string]interface{}{
+				"type":        "string",
+				"description": "HGNC gene symbol, e.g. BRCA2",
+			},
+			"variant": map[string]interface{}{
+				"type":        "string",
+				"description": "HGVS change as written on the report, e.g. c.5946delT or p.Ser1982fs",
+			},
+			"rsid": map[string]interface{}{
+				"type":        "string",
+				"description": "dbSNP ID, e.g. rs80359550; use instead of gene and variant",
+			},
+			"tumor_type": map[string]interface{}{
+				"type":        "string",
+				"description": "OncoTree code for therapy levels (default PAAD, pancreatic adenocarcinoma)",
+			},
+		},
+	}
+}
+
+func (t *VariantLookupTool) CacheTTL() time.Duration {
+	return variantLookupTTL
+}
+
+type variantLookupArgs struct {
+	Gene      string `json:"gene"`
+	Variant   string `json:"variant"`
+	RSID      string `json:"rsid"`
+	TumorType string `json:"tumor_type"`
+}
+
+// ClinVarRecord is one ClinVar variation matching the query.
+type ClinVarRecord struct {
+	Accession      string   `json:"accession"`
+	Title          string   `json:"title"`
+	Genes          []string `json:"genes,omitempty"`
+	ProteinChange  string   `json:"protein_change,omitempty"`
+	Classification string   `json:"classification"`
+	ReviewStatus   string   `json:"review_status,omitempty"`
+	Stars          int      `json:"stars"`
+	Conditions     []string `json:"conditions,omitempty"`
+	LastEvaluated  string   `json:"last_evaluated,omitempty"`
+	URL            string   `json:"url"`
+}
+
+// OncoKBAnnotation is the OncoKB view of a protein change.
+type OncoKBAnnotation struct {
+	Oncogenic      string   `json:"oncogenic"`
+	MutationEffect string   `json:"mutation_effect,omitempty"`
+	HighestLevel   string   `json:"highest_sensitive_level,omitempty"`
+	Treatments     []string `json:"treatments,omitempty"`
+}
+
+func (t *VariantLookupTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	a, err := BindArgs[variantLookupArgs](args)
+	if err != nil {
+		return ErrorResult(err.Error()).WithError(err)
+	}
+	a.Gene = strings.ToUpper(strings.TrimSpace(a.Gene))
+	a.Variant = strings.TrimSpace(a.Variant)
+	a.RSID = strings.ToLower(strings.TrimSpace(a.RSID))
+	switch {
+	case a.RSID != "" && !rsIDPattern.MatchString(a.RSID):
+		return ErrorResult(fmt.Sprintf("rsid %q is not a dbSNP ID like rs80359550", a.RSID)).WithError(ErrInvalidArgs)
+	case a.RSID == "" && (a.Gene == "" || a.Variant == ""):
+		return ErrorResult("give gene and variant, or rsid").WithError(ErrInvalidArgs)
+	case a.Gene != "" && !geneSymbolPattern.MatchString(a.Gene):
+		return ErrorResult(fmt.Sprintf("gene %q is not a gene symbol like BRCA2", a.Gene)).WithError(ErrInvalidArgs)
+	}
+	if a.TumorType == "" {
+		a.TumorType = defaultOncoTreeCode
+	}
+
+	records, err := t.clinVar(ctx, a)
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("ClinVar lookup failed: %v", err)).WithError(err)
+	}
+
+	var oncoKB *OncoKBAnnotation
+	alteration := proteinAlteration(a.Variant, records)
+	if t.oncoKBToken != "" && a.Gene != "" && alteration != "" {
+		oncoKB, err = t.oncoKB(ctx, a.Gene, alteration, a.TumorType)
+		if err != nil {
+			return ErrorResult(fmt.Sprintf("OncoKB lookup failed: %v", err)).WithError(err)
+		}
+	}
+	if len(records) == 0 && oncoKB == nil {
+		return ErrorResult("no ClinVar record matches this variant; check the spelling on the report, or try the rsID or protein change").
+			WithError(ClassifyError(ErrNotFound, fmt.Errorf("no ClinVar record for %s %s%s", a.Gene, a.Variant, a.RSID)))
+	}
+
+	gene := a.Gene
+	if gene == "" && len(records) > 0 && len(records[0].Genes) > 0 {
+		gene = records[0].Genes[0]
+	}
+	result := map[string]interface{}{
+		"gene":      gene,
+		"clinvar":   records,
+		"relevance": variantRelevance(gene, alteration, records),
+		"note": "ClinVar classifications describe germline variants; somatic (tumour-only) findings need the report's own interpretation. " +
+			"More review stars mean a more reliable classification.",
+	}
+	if oncoKB != nil {
+		result["oncokb"] = oncoKB
+	}
+	payload, _ := json.Marshal(result)
+	return NewToolResult(string(payload))
+}
+
+// clinVar searches ClinVar with E-utilities and summarizes the best
+// matches.
+func (t *VariantLookupTool) clinVar(ctx context.Context, a variantLookupArgs) ([]ClinVarRecord, error) {
+	term := a.RSID
+	if term == "" {
+		term = fmt.Sprintf("%s[gene] AND %q", a.Gene, a.Variant)
+	}
+	q := t.eutilsQuery()
+	q.Set("term", term)
+	q.Set("retmax", fmt.Sprint(maxClinVarRecords))
+	var search struct {
+		Result struct {
+			IDList []string `json:"idlist"`
+		} `json:"esearchresult"`
+	}
+	if err := t.getJSON(ctx, t.clinVarURL+"/esearch.fcgi?"+q.Encode(), nil, &search); err != nil {
+		return nil, err
+	}
+	ids := search.Result.IDList
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	q = t.eutilsQuery()
+	q.Set("id", strings.Join(ids, ","))
+	var summary struct {
+		Result map[string]json.RawMessage `json:"result"`
+	}
+	if err := t.getJSON(ctx, t.clinVarURL+"/esummary.fcgi?"+q.Encode(), nil, &summary); err != nil {
+		return nil, err
+	}
+	records := make([]ClinVarRecord, 0, len(ids))
+	for _, id := range ids {
+		raw, ok := summary.Result[id]
+		if !ok {
+			continue
+		}
+		if r, ok := parseClinVarSummary(id, raw); ok {
+			records = append(records, r)
+		}
+	}
+	return records, nil
+}
+
+func (t *VariantLookupTool) eutilsQuery() url.Values {
+	q := url.Values{"db": {"clinvar"}, "retmode": {"json"}}
+	if t.ncbiKey != "" {
+		q.Set("api_key", t.ncbiKey)
+	}
+	return q
+}
+
+// clinVarClassification is the classification block of an esummary
+// record; older records call it clinical_significance.
+type clinVarClassification struct {
+	Description    string `json:"description"`
+	ReviewStatus   string `json:"review_status"`
+	LastEvaluated  string `json:"last_evaluated"`
+	LastEvaluation string `json:"last_evaluation"`
+	TraitSet       []struct {
+		TraitName string `json:"trait_name"`
+	} `json:"trait_set"`
+}
+
+func parseClinVarSummary(id string, raw json.RawMessage) (ClinVarRecord, bool) {
+	var doc struct {
+		Accession     string                 `json:"accession"`
+		Title         string                 `json:"title"`
+		ProteinChange string                 `json:"protein_change"`
+		Germline      *clinVarClassification `json:"germline_classification"`
+		Significance  *clinVarClassification `json:"clinical_significance"`
+		Genes         []struct {
+			Symbol string `json:"symbol"`
+		} `json:"genes"`
+		TraitSet []struct {
+			TraitName string `json:"trait_name"`
+		} `json:"trait_set"`
+	}
+	if err := json.Unmarshal(raw, &doc); err != nil || doc.Title == "" {
+		return ClinVarRecord{}, false
+	}
+	r := ClinVarRecord{
+		Accession:     doc.Accession,
+		Title:         doc.Title,
+		ProteinChange: doc.ProteinChange,
+		URL:           "https://www.ncbi.nlm.nih.gov/clinvar/variation/" + id + "/",
+	}
+	for _, g := range doc.Genes {
+		r.Genes = append(r.Genes, g.Symbol)
+	}
+	c := doc.Germline
+	if c == nil || c.Description == "" {
+		c = doc.Significance
+	}
+	if c != nil {
+		r.Classification = c.Description
+		r.ReviewStatus = c.ReviewStatus
+		r.Stars = clinVarStars[strings.ToLower(c.ReviewStatus)]
+		r.LastEvaluated = strings.TrimSuffix(c.LastEvaluated+c.LastEvaluation, " 00:00")
+		for _, trait := range c.TraitSet {
+			r.Conditions = appendUnique(r.Conditions, trait.TraitName)
+		}
+	}
+	for _, trait := range doc.TraitSet {
+		r.Conditions = appendUnique(r.Conditions, trait.TraitName)
+	}
+	if r.Classification == "" {
+		r.Classification = "not provided"
+	}
+	return r, true
+}
+
+func appendUnique(list []string, s string) []string {
+	if s == "" {
+		return list
+	}
+	for _, existing := range list {
+		if existing == s {
+			return list
+		}
+	}
+	return append(list, s)
+}
+
+// proteinAlteration returns the protein change in OncoKB form ("G12C"),
+// from the query or else the first ClinVar record.
+func proteinAlteration(variant string, records []ClinVarRecord) string {
+	if m := proteinChangePattern.FindStringSubmatch(variant); m != nil {
+		return threeToOneLetter(m[1])
+	}
+	for _, r := range records {
+		if r.ProteinChange != "" {
+			return strings.Split(r.ProteinChange, ",")[0]
+		}
+	}
+	return ""
+}
+
+var aminoAcids = strings.NewReplacer(
+	"Ala", "A", "Arg", "R", "Asn", "N", "Asp", "D", "Cys", "C", "Gln", "Q", "Glu", "E", "Gly", "G",
+	"His", "H", "Ile", "I", "Leu", "L", "Lys", "K", "Met", "M", "Phe", "F", "Pro", "P", "Ser", "S",
+	"Thr", "T", "Trp", "W", "Tyr", "Y", "Val", "V", "Ter", "*",
+)
+
+// threeToOneLetter converts "Gly12Cys" to "G12C"; one-letter changes are
+// returned as they are.
+func threeToOneLetter(change string) string {
+	return aminoAcids.Replace(change)
+}
+
+// oncoKB annotates a protein change for a tumour type.
+func (t *VariantLookupTool) oncoKB(ctx context.Context, gene, alteration, tumorType string) (*OncoKBAnnotation, error) {
+	q := url.Values{"hugoSymbol": {gene}, "alteration": {alteration}, "tumorType": {tumorType}}
+	var resp struct {
+		Oncogenic      string `json:"oncogenic"`
+		MutationEffect struct {
+			KnownEffect string `json:"knownEffect"`
+		} `json:"mutationEffect"`
+		HighestSensitiveLevel string `json:"highestSensitiveLevel"`
+		Treatments            []struct {
+			Drugs []struct {
+				DrugName string `json:"drugName"`
+			} `json:"drugs"`
+			Level                     string `json:"level"`
+			LevelAssociatedCancerType struct {
+				Name string `json:"name"`
+			} `json:"levelAssociatedCancerType"`
+		} `json:"treatments"`
+	}
+	header := http.Header{"Authorization": {"Bearer " + t.oncoKBToken}}
+	if err := t.getJSON(ctx, t.oncoKBURL+"/annotate/mutations/byProteinChange?"+q.Encode(), header, &resp); err != nil {
+		return nil, err
+	}
+	a := &OncoKBAnnotation{
+		Oncogenic:      resp.Oncogenic,
+		MutationEffect: resp.MutationEffect.KnownEffect,
+		HighestLevel:   resp.HighestSensitiveLevel,
+	}
+	for _, tr := range resp.Treatments {
+		var drugs []string
+		for _, d := range tr.Drugs {
+			drugs = append(drugs, d.DrugName)
+		}
+		a.Treatments = append(a.Treatments, fmt.Sprintf("%s (%s, %s)",
+			strings.Join(drugs, " + "), strings.TrimPrefix(tr.Level, "LEVEL_"), tr.LevelAssociatedCancerType.Name))
+	}
+	return a, nil
+}
+
+func (t *VariantLookupTool) getJSON(ctx context.Context, rawURL string, header http.Header, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", userAgent)
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return requestError(ctx, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return ClassifyError(StatusErrorKind(resp.StatusCode),
+			fmt.Errorf("%s returned %d: %s", req.URL.Host, resp.StatusCode, strings.TrimSpace(string(body))))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("invalid response from %s: %w", req.URL.Host, err)
+	}
+	return nil
+}
+
+// variantRelevance lists what a variant may mean for treatment and family,
+// from the built-in table. Only pathogenic variants count, except for
+// named hotspot changes such as KRAS G12C.
+func variantRelevance(gene, alteration string, records []ClinVarRecord) []string {
+	pathogenic := false
+	for _, r := range records {
+		c := strings.ToLower(r.Classification)
+		if strings.Contains(c, "pathogenic") && !strings.Contains(c, "conflicting") {
+			pathogenic = true
+			break
+		}
+	}
+	relevance := []string{}
+	for _, therapy := range variantTherapies {
+		if indexOf(therapy.genes, gene) < 0 {
+			continue
+		}
+		if therapy.alteration != "" && strings.EqualFold(therapy.alteration, alteration) ||
+			therapy.alteration == "" && pathogenic {
+			relevance = append(relevance, therapy.relevance)
+		}
+	}
+	if pathogenic && hereditaryGenes[gene] {
+		relevance = append(relevance, "If this variant is germline (inherited), blood relatives may carry it too; genetic counselling and cascade testing are recommended.")
+	}
+	return relevance
+}
@@ -0,0 +1,137 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const clinVarBRCA2Summary = `{"result":{"uids":["51579"],"51579":{
+	"accession":"VCV000051579","title":"NM_000059.4(BRCA2):c.5946del (p.Ser1982fs)","protein_change":"S1982fs",
+	"genes":[{"symbol":"BRCA2"}],
+	"germline_classification":{"description":"Pathogenic","review_status":"reviewed by expert panel",
+		"last_evaluated":"2016/10/03 00:00","trait_set":[{"trait_name":"Hereditary breast ovarian cancer syndrome"}]}}}}`
+
+func variantTestServer(t *testing.T) (*httptest.Server, *[]string) {
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.Path+"?"+r.URL.RawQuery)
+		switch r.URL.Path {
+		case "/esearch.fcgi":
+			switch term := r.URL.Query().Get("term"); term {
+			case `BRCA2[gene] AND "c.5946delT"`, "rs80359550":
+				w.Write([]byte(`{"esearchresult":{"idlist":["51579"]}}`))
+			default:
+				w.Write([]byte(`{"esearchresult":{"idlist":[]}}`))
+			}
+		case "/esummary.fcgi":
+			w.Write([]byte(clinVarBRCA2Summary))
+		case "/annotate/mutations/byProteinChange":
+			if r.Header.Get("Authorization") != "Bearer secret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			if r.URL.Query().Get("alteration") != "G12C" || r.URL.Query().Get("tumorType") != "PAAD" {
+				t.Errorf("unexpected OncoKB query %s", r.URL.RawQuery)
+			}
+			w.Write([]byte(`{"oncogenic":"Oncogenic","mutationEffect":{"knownEffect":"Gain-of-function"},
+				"highestSensitiveLevel":"LEVEL_3A","treatments":[{"drugs":[{"drugName":"Adagrasib"}],"level":"LEVEL_3A",
+				"levelAssociatedCancerType":{"name":"Pancreatic Adenocarcinoma"}}]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func TestVariantLookup_ClinVar(t *testing.T) {
+	server, _ := variantTestServer(t)
+	tool := NewVariantLookupTool(VariantLookupOptions{ClinVarBaseURL: server.URL})
+
+	for _, args := range []map[string]interface{}{
+		{"gene": "brca2", "variant": "c.5946delT"},
+		{"rsid": "RS80359550"},
+	} {
+		result := tool.Execute(context.Background(), args)
+		if result.IsError {
+			t.Fatalf("Execute(%v): %s", args, result.ForLLM)
+		}
+		var out struct {
+			Gene      string          `json:"gene"`
+			ClinVar   []ClinVarRecord `json:"clinvar"`
+			Relevance []string        `json:"relevance"`
+		}
+		json.Unmarshal([]byte(result.ForLLM), &out)
+		if out.Gene != "BRCA2" || len(out.ClinVar) != 1 {
+			t.Fatalf("unexpected result: %s", result.ForLLM)
+		}
+		r := out.ClinVar[0]
+		if r.Classification != "Pathogenic" || r.Stars != 3 || r.LastEvaluated != "2016/10/03" ||
+			r.Conditions[0] != "Hereditary breast ovarian cancer syndrome" || !strings.HasSuffix(r.URL, "/variation/51579/") {
+			t.Errorf("unexpected record: %+v", r)
+		}
+		if len(out.Relevance) != 2 || !strings.Contains(out.Relevance[0], "olaparib") || !strings.Contains(out.Relevance[1], "genetic counselling") {
+			t.Errorf("unexpected relevance: %v", out.Relevance)
+		}
+	}
+}
+
+func TestVariantLookup_OncoKB(t *testing.T) {
+	server, requests := variantTestServer(t)
+	tool := NewVariantLookupTool(VariantLookupOptions{ClinVarBaseURL: server.URL, OncoKBBaseURL: server.URL, OncoKBToken: "secret"})
+
+	result := tool.Execute(context.Background(), map[string]interface{}{"gene": "KRAS", "variant": "p.Gly12Cys"})
+	if result.IsError {
+		t.Fatalf("Execute: %s", result.ForLLM)
+	}
+	if !strings.Contains(result.ForLLM, `"Adagrasib (3A, Pancreatic Adenocarcinoma)"`) || !strings.Contains(result.ForLLM, "sotorasib") {
+		t.Errorf("unexpected result: %s", result.ForLLM)
+	}
+
+	// Without a token OncoKB is not called, so an unknown variant is not found
+	*requests = nil
+	tool = NewVariantLookupTool(VariantLookupOptions{ClinVarBaseURL: server.URL, OncoKBBaseURL: server.URL})
+	result = tool.Execute(context.Background(), map[string]interface{}{"gene": "KRAS", "variant": "p.G12C"})
+	if !errors.Is(result.Err, ErrNotFound) {
+		t.Errorf("Err = %v, want ErrNotFound", result.Err)
+	}
+	for _, r := range *requests {
+		if strings.HasPrefix(r, "/annotate") {
+			t.Errorf("OncoKB called without a token: %s", r)
+		}
+	}
+}
+
+func TestVariantLookup_InvalidArgs(t *testing.T) {
+	tool := NewVariantLookupTool(VariantLookupOptions{ClinVarBaseURL: "http://127.0.0.1:0"})
+	for _, args := range []map[string]interface{}{
+		{},
+		{"gene": "BRCA2"},
+		{"rsid": "80359550"},
+		{"gene": "BRCA 2; DROP", "variant": "c.1A>G"},
+	} {
+		if result := tool.Execute(context.Background(), args); !errors.Is(result.Err, ErrInvalidArgs) {
+			t.Errorf("Execute(%v) Err = %v, want ErrInvalidArgs", args, result.Err)
+		}
+	}
+}
+
+func TestProteinAlteration(t *testing.T) {
+	tests := map[string]string{
+		"p.G12D":              "G12D",
+		"p.Gly12Asp":          "G12D",
+		"p.(Arg1443Ter)":      "R1443*",
+		"p.Ser1982ArgfsTer22": "S1982Rfs*22",
+		"c.5946delT":          "",
+	}
+	for in, want := range tests {
+		if got := proteinAlteration(in, nil); got != want {
+			t.Errorf("proteinAlteration(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
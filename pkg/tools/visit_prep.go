@@ -0,0 +1,368 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultVisitPrepDays  = 7
+	maxVisitPrepQuestions = 10
+)
+
+// VisitPrepTool compiles a one-page "bring to your appointment" summary
+// from the symptoms, labs and open issues the model has gathered, plus the
+// chat's recent questions and adverse event reports. The summary is saved
+// under <workspace>/visit_prep and sent to the user.
+type VisitPrepTool struct {
+	workspace string
+	userTurns func(sessionKey string) []string
+	now       func() time.Time
+	channel   string
+	chatID    string
+	mu        sync.Mutex
+}
+
+// NewVisitPrepTool creates the tool. userTurns returns a session's user
+// messages in order and may be nil.
+func NewVisitPrepTool(workspace string, userTurns func(sessionKey string) []string) *VisitPrepTool {
+	return &VisitPrepTool{
+		workspace: workspace,
+		userTurns: userTurns,
+		now:       time.Now,
+	}
+}
+
+func (t *VisitPrepTool) Name() string {
+	return "visit_prep"
+}
+
+func (t *VisitPrepTool) Description() string {
+	return "Create a one-page summary for the user's next clinic visit. " +
+		"Pass the symptoms, lab results and unresolved issues from the recent conversation and memory; " +
+		"recent questions and adverse event reports are added automatically. The summary is saved and sent to the user."
+}
+
+func (t *VisitPrepTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"appointment": map[string]interface{}{
+				"type":        "string",
+				"description": "Appointment date and clinic, e.g. '2026-03-20, oncology'",
+			},
+			"days": map[string]interface{}{
+				"type":        "integer",
+				"description": "How many days back to cover. Default: 7",
+			},
+			"symptoms": map[string]interface{}{
+				"type":        "array",
+				"description": "Symptom diary entries",
+				"items": map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"date":        map[string]interface{}{"type": "string", "description": "YYYY-MM-DD"},
+						"description": map[string]interface{}{"type": "string"},
+						"severity":    map[string]interface{}{"type": "string", "description": "e.g. mild, moderate, severe, or 0-10"},
+					},
+					"required": []string{"description"},
+				},
+			},
+			"labs": map[string]interface{}{
+				"type":        "array",
+				"description": "Lab results; repeat a test on different dates to show its trend",
+				"items": map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"date":  map[string]interface{}{"type": "string", "description": "YYYY-MM-DD"},
+						"test":  map[string]interface{}{"type": "string", "description": "e.g. CA19-9, ALT, hemoglobin"},
+						"value": map[string]interface{}{"type": "number"},
+						"unit":  map[string]interface{}{"type": "string"},
+					},
+					"required": []string{"test", "value"},
+				},
+			},
+			"unresolved": map[string]interface{}{
+				"type":        "array",
+				"description": "Open issues or concerns to raise with the care team",
+				"items":       map[string]interface{}{"type": "string"},
+			},
+			"questions": map[string]interface{}{
+				"type":        "array",
+				"description": "Questions the user wants to ask the doctor",
+				"items":       map[string]interface{}{"type": "string"},
+			},
+		},
+	}
+}
+
+func (t *VisitPrepTool) SetContext(channel, chatID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.channel = channel
+	t.chatID = chatID
+}
+
+type visitSymptom struct {
+	date, description, severity string
+}
+
+type visitLab struct {
+	date, test, unit string
+	value            float64
+}
+
+func (t *VisitPrepTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	t.mu.Lock()
+	channel, chatID := t.channel, t.chatID
+	t.mu.Unlock()
+
+	days := defaultVisitPrepDays
+	if d, ok := args["days"].(float64); ok && d > 0 {
+		days = int(d)
+	}
+	now := t.now()
+	since := now.AddDate(0, 0, -days)
+
+	var symptoms []visitSymptom
+	for _, item := range objectItems(args["symptoms"]) {
+		s := visitSymptom{
+			date:        stringField(item, "date"),
+			description: stringField(item, "description"),
+			severity:    stringField(item, "severity"),
+		}
+		if s.description != "" {
+			symptoms = append(symptoms, s)
+		}
+	}
+	sort.SliceStable(symptoms, func(i, j int) bool { return symptoms[i].date < symptoms[j].date })
+
+	var labs []visitLab
+	for _, item := range objectItems(args["labs"]) {
+		value, ok := item["value"].(float64)
+		test := stringField(item, "test")
+		if !ok || test == "" {
+			continue
+		}
+		labs = append(labs, visitLab{date: stringField(item, "date"), test: test, unit: stringField(item, "unit"), value: value})
+	}
+
+	questions := stringItems(args["questions"])
+	if t.userTurns != nil {
+		if key := CallMetadataFromContext(ctx).SessionKey; key != "" {
+			questions = append(questions, recentQuestions(t.userTurns(key), maxVisitPrepQuestions)...)
+		}
+	}
+
+	var events []AdverseEvent
+	if channel != "" && chatID != "" {
+		all, _ := loadAdverseEvents(filepath.Join(t.workspace, "adverse_events"), channel, chatID)
+		for _, e := range all {
+			if !e.ReportedAt.Before(since) {
+				events = append(events, e)
+			}
+		}
+	}
+
+	appointment, _ := args["appointment"].(string)
+	summary := renderVisitPrep(visitPrep{
+		appointment: strings.TrimSpace(appointment),
+		from:        since,
+		to:          now,
+		symptoms:    symptoms,
+		labs:        labs,
+		events:      events,
+		unresolved:  stringItems(args["unresolved"]),
+		questions:   questions,
+	})
+
+	dir := filepath.Join(t.workspace, "visit_prep")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return ErrorResult(fmt.Sprintf("failed to save visit summary: %v", err)).WithError(err)
+	}
+	name := fmt.Sprintf("visit-prep-%s.md", now.Format("20060102-150405"))
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(summary), 0600); err != nil {
+		return ErrorResult(fmt.Sprintf("failed to save visit summary: %v", err)).WithError(err)
+	}
+
+	file := FileBlock(name, "", path)
+	file.MimeType = "text/markdown"
+	file.Caption = "Bring this to your appointment"
+	return RichUserResult(TextBlock(summary), file)
+}
+
+type visitPrep struct {
+	appointment string
+	from, to    time.Time
+	symptoms    []visitSymptom
+	labs        []visitLab
+	events      []AdverseEvent
+	unresolved  []string
+	questions   []string
+}
+
+func renderVisitPrep(v visitPrep) string {
+	var sb strings.Builder
+	sb.WriteString("# Clinic Visit Summary\n\n")
+	if v.appointment != "" {
+		fmt.Fprintf(&sb, "Appointment: %s\n", v.appointment)
+	}
+	fmt.Fprintf(&sb, "Covers: %s to %s\n", v.from.Format("2006-01-02"), v.to.Format("2006-01-02"))
+
+	sb.WriteString("\n## Symptoms\n")
+	if len(v.symptoms) == 0 {
+		sb.WriteString("- None recorded\n")
+	}
+	for _, s := range v.symptoms {
+		line := s.description
+		if s.severity != "" {
+			line += " (" + s.severity + ")"
+		}
+		if s.date != "" {
+			line = s.date + ": " + line
+		}
+		sb.WriteString("- " + line + "\n")
+	}
+
+	sb.WriteString("\n## Lab Trends\n")
+	if len(v.labs) == 0 {
+		sb.WriteString("- None recorded\n")
+	}
+	for _, line := range labTrends(v.labs) {
+		sb.WriteString("- " + line + "\n")
+	}
+
+	if len(v.events) > 0 {
+		sb.WriteString("\n## Suspected Side Effects Reported\n")
+		for _, e := range v.events {
+			fmt.Fprintf(&sb, "- %s: %s after %s (%s, %s; ref %s)\n",
+				e.OnsetDate, e.Reaction, e.Drug, strings.ReplaceAll(e.Severity, "_", "-"),
+				strings.ReplaceAll(e.ActionTaken, "_", " "), e.ID)
+		}
+	}
+
+	sb.WriteString("\n## Unresolved Issues\n")
+	if len(v.unresolved) == 0 {
+		sb.WriteString("- None noted\n")
+	}
+	for _, u := range v.unresolved {
+		sb.WriteString("- " + u + "\n")
+	}
+
+	sb.WriteString("\n## Questions for the Doctor\n")
+	if len(v.questions) == 0 {
+		sb.WriteString("- None noted\n")
+	}
+	for i, q := range v.questions {
+		fmt.Fprintf(&sb, "%d. %s\n", i+1, q)
+	}
+
+	sb.WriteString("\n_Prepared from the patient's own notes and conversations; not a medical record._\n")
+	return sb.String()
+}
+
+// labTrends groups results by test in first-seen order and describes each
+// series from its earliest to its latest value.
+func labTrends(labs []visitLab) []string {
+	var order []string
+	series := make(map[string][]visitLab)
+	for _, l := range labs {
+		if _, ok := series[l.test]; !ok {
+			order = append(order, l.test)
+		}
+		series[l.test] = append(series[l.test], l)
+	}
+
+	lines := make([]string, 0, len(order))
+	for _, test := range order {
+		results := series[test]
+		sort.SliceStable(results, func(i, j int) bool { return results[i].date < results[j].date })
+
+		points := make([]string, 0, len(results))
+		for _, r := range results {
+			point := formatLabValue(r.value, r.unit)
+			if r.date != "" {
+				point += " (" + r.date + ")"
+			}
+			points = append(points, point)
+		}
+		line := test + ": " + strings.Join(points, " → ")
+
+		if len(results) > 1 {
+			first, last := results[0].value, results[len(results)-1].value
+			switch {
+			case last > first:
+				line += " ↑"
+			case last < first:
+				line += " ↓"
+			default:
+				line += " ="
+			}
+			if first != 0 {
+				line += fmt.Sprintf(" %+.0f%%", (last-first)/first*100)
+			}
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func formatLabValue(value float64, unit string) string {
+	s := strconv.FormatFloat(value, 'f', -1, 64)
+	if unit != "" {
+		s += " " + unit
+	}
+	return s
+}
+
+// recentQuestions returns up to max of the latest user messages that ask
+// something, oldest first.
+func recentQuestions(turns []string, max int) []string {
+	var questions []string
+	for i := len(turns) - 1; i >= 0 && len(questions) < max; i-- {
+		q := strings.TrimSpace(turns[i])
+		if strings.HasPrefix(q, "/") || !(strings.Contains(q, "?") || strings.Contains(q, "？")) {
+			continue
+		}
+		questions = append(questions, q)
+	}
+	for i, j := 0, len(questions)-1; i < j; i, j = i+1, j-1 {
+		questions[i], questions[j] = questions[j], questions[i]
+	}
+	return questions
+}
+
+func objectItems(v interface{}) []map[string]interface{} {
+	list, _ := v.([]interface{})
+	items := make([]map[string]interface{}, 0, len(list))
+	for _, item := range list {
+		if obj, ok := item.(map[string]interface{}); ok {
+			items = append(items, obj)
+		}
+	}
+	return items
+}
+
+func stringItems(v interface{}) []string {
+	list, _ := v.([]interface{})
+	items := make([]string, 0, len(list))
+	for _, item := range list {
+		if s, ok := item.(string); ok && strings.TrimSpace(s) != "" {
+			items = append(items, strings.TrimSpace(s))
+		}
+	}
+	return items
+}
+
+func stringField(obj map[string]interface{}, key string) string {
+	s, _ := obj[key].(string)
+	return strings.TrimSpace(s)
+}
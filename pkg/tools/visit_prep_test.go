@@ -0,0 +1,142 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLabTrends(t *testing.T) {
+	tests := []struct {
+		name string
+		labs []visitLab
+		want []string
+	}{
+		{
+			name: "single result",
+			labs: []visitLab{{date: "2026-03-01", test: "ALT", value: 40, unit: "U/L"}},
+			want: []string{"ALT: 40 U/L (2026-03-01)"},
+		},
+		{
+			name: "rising series sorted by date",
+			labs: []visitLab{
+				{date: "2026-03-10", test: "CA19-9", value: 150, unit: "U/mL"},
+				{date: "2026-03-01", test: "CA19-9", value: 100, unit: "U/mL"},
+			},
+			want: []string{"CA19-9: 100 U/mL (2026-03-01) → 150 U/mL (2026-03-10) ↑ +50%"},
+		},
+		{
+			name: "falling and flat series keep first-seen order",
+			labs: []visitLab{
+				{date: "2026-03-01", test: "Hb", value: 12.5},
+				{date: "2026-03-01", test: "PLT", value: 200},
+				{date: "2026-03-08", test: "Hb", value: 10},
+				{date: "2026-03-08", test: "PLT", value: 200},
+			},
+			want: []string{
+				"Hb: 12.5 (2026-03-01) → 10 (2026-03-08) ↓ -20%",
+				"PLT: 200 (2026-03-01) → 200 (2026-03-08) = +0%",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := labTrends(tt.labs); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("labTrends() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRecentQuestions(t *testing.T) {
+	turns := []string{"hello", "Is nausea normal?", "/fork", "thanks", "能吃辣吗？", "What about fever?"}
+	got := recentQuestions(turns, 2)
+	want := []string{"能吃辣吗？", "What about fever?"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("recentQuestions() = %q, want %q", got, want)
+	}
+}
+
+func TestVisitPrepTool_WritesSummary(t *testing.T) {
+	workspace := t.TempDir()
+	now := time.Date(2026, 3, 15, 9, 0, 0, 0, time.UTC)
+
+	dir := filepath.Join(workspace, "adverse_events")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range []AdverseEvent{
+		{ID: "AE-20260312-aaa", Channel: "telegram", ChatID: "patient", Drug: "gemcitabine", Reaction: "rash",
+			OnsetDate: "2026-03-11", Severity: "moderate", ActionTaken: "dose_reduced", ReportedAt: now.AddDate(0, 0, -3)},
+		{ID: "AE-20260201-bbb", Channel: "telegram", ChatID: "patient", Drug: "gemcitabine", Reaction: "old rash",
+			ReportedAt: now.AddDate(0, -1, 0)},
+		{ID: "AE-20260313-ccc", Channel: "telegram", ChatID: "someone-else", Drug: "gemcitabine", Reaction: "other chat",
+			ReportedAt: now.AddDate(0, 0, -2)},
+	} {
+		data, _ := json.Marshal(e)
+		if err := os.WriteFile(filepath.Join(dir, e.ID+".json"), data, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tool := NewVisitPrepTool(workspace, func(key string) []string {
+		if key != "telegram:patient" {
+			t.Errorf("unexpected session key %q", key)
+		}
+		return []string{"Why is my CA19-9 rising?", "ok"}
+	})
+	tool.now = func() time.Time { return now }
+	tool.SetContext("telegram", "patient")
+
+	ctx := WithCallMetadata(context.Background(), CallMetadata{SessionKey: "telegram:patient"})
+	result := tool.Execute(ctx, map[string]interface{}{
+		"appointment": "2026-03-16, oncology",
+		"symptoms": []interface{}{
+			map[string]interface{}{"date": "2026-03-12", "description": "nausea after meals", "severity": "mild"},
+		},
+		"labs": []interface{}{
+			map[string]interface{}{"date": "2026-03-01", "test": "CA19-9", "value": 100.0, "unit": "U/mL"},
+			map[string]interface{}{"date": "2026-03-14", "test": "CA19-9", "value": 120.0, "unit": "U/mL"},
+		},
+		"unresolved": []interface{}{"Poor sleep since last cycle"},
+		"questions":  []interface{}{"Should the next dose be delayed?"},
+	})
+	if result.IsError {
+		t.Fatalf("visit_prep failed: %s", result.ForLLM)
+	}
+
+	path := filepath.Join(workspace, "visit_prep", "visit-prep-20260315-090000.md")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("summary not saved: %v", err)
+	}
+	summary := string(data)
+	for _, want := range []string{
+		"Appointment: 2026-03-16, oncology",
+		"Covers: 2026-03-08 to 2026-03-15",
+		"2026-03-12: nausea after meals (mild)",
+		"CA19-9: 100 U/mL (2026-03-01) → 120 U/mL (2026-03-14) ↑ +20%",
+		"rash after gemcitabine (moderate, dose reduced; ref AE-20260312-aaa)",
+		"- Poor sleep since last cycle",
+		"1. Should the next dose be delayed?",
+		"2. Why is my CA19-9 rising?",
+	} {
+		if !strings.Contains(summary, want) {
+			t.Errorf("summary missing %q:\n%s", want, summary)
+		}
+	}
+	for _, unwanted := range []string{"old rash", "other chat"} {
+		if strings.Contains(summary, unwanted) {
+			t.Errorf("summary should not contain %q", unwanted)
+		}
+	}
+
+	if !result.ContentForUser || len(result.Content) != 2 || result.Content[1].Path != path {
+		t.Errorf("expected summary text and file attachment for the user, got %+v", result.Content)
+	}
+}
@@ -13,7 +13,8 @@ import (
 )
 
 const (
-	userAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36"
+	userAgent   = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36"
+	webCacheTTL = 15 * time.Minute
 )
 
 type SearchProvider interface {
@@ -21,77 +22,58 @@ type SearchProvider interface {
 }
 
 type BraveSearchProvider struct {
-	apiKey string
+	apiKey  string
+	baseURL string
 }
 
-func (p *BraveSearchProvider) Search(ctx context.Context, query string, count int) (string, error) {
-	searchURL := fmt.Sprintf("https://api.search.brave.com/res/v1/web/search?q=%s&count=%d",
-		url.QueryEscape(query), count)
+func (p *BraveSearchProvider) Results(ctx context.Context, query string, count int) ([]SearchResult, error) {
+	baseURL := p.baseURL
+	if baseURL == "" {
+		baseURL = "https://api.search.brave.com/res/v1/web/search"
+	}
+	searchURL := fmt.Sprintf("%s?q=%s&count=%d", baseURL, url.QueryEscape(query), count)
 
 	req, err := http.NewRequestWithContext(ctx, "GET", searchURL, nil)
 	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
+		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	req.Header.Set("Accept", "application/json")
 	req.Header.Set("X-Subscription-Token", p.apiKey)
 
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", fmt.Errorf("request failed: %w", err)
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return "", fmt.Errorf("failed to read response: %w", err)
-	}
-
 	var searchResp struct {
 		Web struct {
 			Results []struct {
-				Title       string `json:"title"`
-				URL         string `json:"url"`
-				Description string `json:"description"`
+				Title         string   `json:"title"`
+				URL           string   `json:"url"`
+				Description   string   `json:"description"`
+				ExtraSnippets []string `json:"extra_snippets"`
 			} `json:"results"`
 		} `json:"web"`
 	}
-
-	if err := json.Unmarshal(body, &searchResp); err != nil {
-		// Log error body for debugging
-		fmt.Printf("Brave API Error Body: %s\n", string(body))
-		return "", fmt.Errorf("failed to parse response: %w", err)
+	if err := getSearchJSON(ctx, req, 10*time.Second, &searchResp); err != nil {
+		return nil, err
 	}
 
-	results := searchResp.Web.Results
-	if len(results) == 0 {
-		return fmt.Sprintf("No results for: %s", query), nil
-	}
-
-	var lines []string
-	lines = append(lines, fmt.Sprintf("Results for: %s", query))
-	for i, item := range results {
-		if i >= count {
-			break
-		}
-		lines = append(lines, fmt.Sprintf("%d. %s\n   %s", i+1, item.Title, item.URL))
-		if item.Description != "" {
-			lines = append(lines, fmt.Sprintf("   %s", item.Description))
+	results := make([]SearchResult, 0, len(searchResp.Web.Results))
+	for _, item := range searchResp.Web.Results {
+		snippet := item.Description
+		if snippet == "" && len(item.ExtraSnippets) > 0 {
+			snippet = item.ExtraSnippets[0]
 		}
+		results = append(results, SearchResult{Title: item.Title, URL: item.URL, Snippet: snippet})
 	}
-
-	return strings.Join(lines, "\n"), nil
+	return results, nil
 }
 
 type DuckDuckGoSearchProvider struct{}
 
-func (p *DuckDuckGoSearchProvider) Search(ctx context.Context, query string, count int) (string, error) {
+func (p *DuckDuckGoSearchProvider) Results(ctx context.Context, query string, count int) ([]SearchResult, error) {
 	searchURL := fmt.Sprintf("https://html.duckduckgo.com/html/?q=%s", url.QueryEscape(query))
 
 	req, err := http.NewRequestWithContext(ctx, "GET", searchURL, nil)
 	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
+		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	req.Header.Set("User-Agent", userAgent)
@@ -99,76 +81,52 @@ func (p *DuckDuckGoSearchProvider) Search(ctx context.Context, query string, cou
 	client := &http.Client{Timeout: 10 * time.Second}
 	resp, err := client.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("request failed: %w", err)
+		return nil, requestError(ctx, err)
 	}
 	defer resp.Body.Close()
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return "", fmt.Errorf("failed to read response: %w", err)
+		return nil, fmt.Errorf("failed to read response: %w", err)
 	}
 
-	return p.extractResults(string(body), count, query)
+	return p.extractResults(string(body), count), nil
 }
 
-func (p *DuckDuckGoSearchProvider) extractResults(html string, count int, query string) (string, error) {
-	// Simple regex based extraction for DDG HTML
-	// Strategy: Find all result containers or key anchors directly
-
-	// Try finding the result links directly first, as they are the most critical
-	// Pattern: <a class="result__a" href="...">Title</a>
-	// The previous regex was a bit strict. Let's make it more flexible for attributes order/content
-	reLink := regexp.MustCompile(`<a[^>]*class="[^"]*result__a[^"]*"[^>]*href="([^"]+)"[^>]*>([\s\S]*?)</a>`)
-	matches := reLink.FindAllStringSubmatch(html, count+5)
-
-	if len(matches) == 0 {
-		return fmt.Sprintf("No results found or extraction failed. Query: %s", query), nil
-	}
-
-	var lines []string
-	lines = append(lines, fmt.Sprintf("Results for: %s (via DuckDuckGo)", query))
-
-	// Pre-compile snippet regex to run inside the loop
-	// We'll search for snippets relative to the link position or just globally if needed
-	// But simple global search for snippets might mismatch order.
-	// Since we only have the raw HTML string, let's just extract snippets globally and assume order matches (risky but simple for regex)
-	// Or better: Let's assume the snippet follows the link in the HTML
-
-	// A better regex approach: iterate through text and find matches in order
-	// But for now, let's grab all snippets too
-	reSnippet := regexp.MustCompile(`<a class="result__snippet[^"]*".*?>([\s\S]*?)</a>`)
-	snippetMatches := reSnippet.FindAllStringSubmatch(html, count+5)
-
-	maxItems := min(len(matches), count)
+var (
+	// Result links look like <a class="result__a" href="...">Title</a>, with
+	// attributes in any order.
+	ddgLinkPattern = regexp.MustCompile(`<a[^>]*class="[^"]*result__a[^"]*"[^>]*href="([^"]+)"[^>]*>([\s\S]*?)</a>`)
+	// Each result's snippet follows its link.
+	ddgSnippetPattern = regexp.MustCompile(`<a class="result__snippet[^"]*".*?>([\s\S]*?)</a>`)
+)
 
-	for i := 0; i < maxItems; i++ {
-		urlStr := matches[i][1]
-		title := stripTags(matches[i][2])
-		title = strings.TrimSpace(title)
+func (p *DuckDuckGoSearchProvider) extractResults(html string, count int) []SearchResult {
+	matches := ddgLinkPattern.FindAllStringSubmatch(html, count+5)
+	// Snippets are matched separately and assumed to be in link order.
+	snippetMatches := ddgSnippetPattern.FindAllStringSubmatch(html, count+5)
 
-		// URL decoding if needed
+	results := make([]SearchResult, 0, len(matches))
+	for i, m := range matches {
+		urlStr := m[1]
+		// Links go through a redirect that carries the target in uddg=.
 		if strings.Contains(urlStr, "uddg=") {
 			if u, err := url.QueryUnescape(urlStr); err == nil {
-				idx := strings.Index(u, "uddg=")
-				if idx != -1 {
+				if idx := strings.Index(u, "uddg="); idx != -1 {
 					urlStr = u[idx+5:]
+					if amp := strings.Index(urlStr, "&rut="); amp != -1 {
+						urlStr = urlStr[:amp]
+					}
 				}
 			}
 		}
-
-		lines = append(lines, fmt.Sprintf("%d. %s\n   %s", i+1, title, urlStr))
-
-		// Attempt to attach snippet if available and index aligns
+		r := SearchResult{Title: m[2], URL: urlStr}
 		if i < len(snippetMatches) {
-			snippet := stripTags(snippetMatches[i][1])
-			snippet = strings.TrimSpace(snippet)
-			if snippet != "" {
-				lines = append(lines, fmt.Sprintf("   %s", snippet))
-			}
+			r.Snippet = snippetMatches[i][1]
 		}
+		results = append(results, r)
 	}
-
-	return strings.Join(lines, "\n"), nil
+	return results
 }
 
 func stripTags(content string) string {
@@ -209,7 +167,7 @@ func (p *PerplexitySearchProvider) Search(ctx context.Context, query string, cou
 	client := &http.Client{Timeout: 30 * time.Second}
 	resp, err := client.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("request failed: %w", err)
+		return "", requestError(ctx, err)
 	}
 	defer resp.Body.Close()
 
@@ -219,7 +177,11 @@ func (p *PerplexitySearchProvider) Search(ctx context.Context, query string, cou
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("Perplexity API error: %s", string(body))
+		err := fmt.Errorf("Perplexity API error: %s", string(body))
+		if kind := StatusErrorKind(resp.StatusCode); kind != nil {
+			err = ClassifyError(kind, err)
+		}
+		return "", err
 	}
 
 	var searchResp struct {
@@ -247,9 +209,19 @@ type WebSearchTool struct {
 }
 
 type WebSearchToolOptions struct {
+	// Backend names the one backend to use. When empty, the first enabled
+	// backend wins, in the order Perplexity, Brave, Bing, SearXNG, DuckDuckGo.
+	Backend              string
 	BraveAPIKey          string
 	BraveMaxResults      int
 	BraveEnabled         bool
+	BingAPIKey           string
+	BingMarket           string
+	BingMaxResults       int
+	BingEnabled          bool
+	SearXNGBaseURL       string
+	SearXNGMaxResults    int
+	SearXNGEnabled       bool
 	DuckDuckGoMaxResults int
 	DuckDuckGoEnabled    bool
 	PerplexityAPIKey     string
@@ -257,34 +229,42 @@ type WebSearchToolOptions struct {
 	PerplexityEnabled    bool
 }
 
+// webSearchBackend is a configured search backend.
+type webSearchBackend struct {
+	name       string
+	usable     bool // enabled and configured
+	provider   SearchProvider
+	maxResults int
+}
+
 func NewWebSearchTool(opts WebSearchToolOptions) *WebSearchTool {
-	var provider SearchProvider
-	maxResults := 5
-
-	// Priority: Perplexity > Brave > DuckDuckGo
-	if opts.PerplexityEnabled && opts.PerplexityAPIKey != "" {
-		provider = &PerplexitySearchProvider{apiKey: opts.PerplexityAPIKey}
-		if opts.PerplexityMaxResults > 0 {
-			maxResults = opts.PerplexityMaxResults
+	backends := []webSearchBackend{
+		{"perplexity", opts.PerplexityEnabled && opts.PerplexityAPIKey != "",
+			&PerplexitySearchProvider{apiKey: opts.PerplexityAPIKey}, opts.PerplexityMaxResults},
+		{"brave", opts.BraveEnabled && opts.BraveAPIKey != "",
+			&resultsSearch{name: "Brave", results: &BraveSearchProvider{apiKey: opts.BraveAPIKey}}, opts.BraveMaxResults},
+		{"bing", opts.BingEnabled && opts.BingAPIKey != "",
+			&resultsSearch{name: "Bing", results: &BingSearchProvider{apiKey: opts.BingAPIKey, market: opts.BingMarket}}, opts.BingMaxResults},
+		{"searxng", opts.SearXNGEnabled && opts.SearXNGBaseURL != "",
+			&resultsSearch{name: "SearXNG", results: &SearXNGSearchProvider{baseURL: opts.SearXNGBaseURL}}, opts.SearXNGMaxResults},
+		{"duckduckgo", opts.DuckDuckGoEnabled,
+			&resultsSearch{name: "DuckDuckGo", results: &DuckDuckGoSearchProvider{}}, opts.DuckDuckGoMaxResults},
+	}
+
+	for _, b := range backends {
+		if !b.usable || opts.Backend != "" && opts.Backend != b.name {
+			continue
 		}
-	} else if opts.BraveEnabled && opts.BraveAPIKey != "" {
-		provider = &BraveSearchProvider{apiKey: opts.BraveAPIKey}
-		if opts.BraveMaxResults > 0 {
-			maxResults = opts.BraveMaxResults
+		maxResults := 5
+		if b.maxResults > 0 {
+			maxResults = b.maxResults
 		}
-	} else if opts.DuckDuckGoEnabled {
-		provider = &DuckDuckGoSearchProvider{}
-		if opts.DuckDuckGoMaxResults > 0 {
-			maxResults = opts.DuckDuckGoMaxResults
+		return &WebSearchTool{
+			provider:   b.provider,
+			maxResults: maxResults,
 		}
-	} else {
-		return nil
-	}
-
-	return &WebSearchTool{
-		provider:   provider,
-		maxResults: maxResults,
 	}
+	return nil
 }
 
 func (t *WebSearchTool) Name() string {
@@ -292,7 +272,8 @@ func (t *WebSearchTool) Name() string {
 }
 
 func (t *WebSearchTool) Description() string {
-	return "Search the web for current information. Returns titles, URLs, and snippets from search results."
+	return "Search the web for current information, e.g. insurance rules, hospital news or travel logistics. Returns titles, URLs, and snippets from search results. " +
+		"For medical evidence, prefer a dedicated evidence tool when one is available."
 }
 
 func (t *WebSearchTool) Parameters() map[string]interface{} {
@@ -314,10 +295,15 @@ func (t *WebSearchTool) Parameters() map[string]interface{} {
 	}
 }
 
+// CacheTTL lets repeated identical searches reuse the previous result.
+func (t *WebSearchTool) CacheTTL() time.Duration {
+	return webCacheTTL
+}
+
 func (t *WebSearchTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
 	query, ok := args["query"].(string)
 	if !ok {
-		return ErrorResult("query is required")
+		return ErrorResult("query is required").WithError(ErrInvalidArgs)
 	}
 
 	count := t.maxResults
@@ -329,7 +315,7 @@ func (t *WebSearchTool) Execute(ctx context.Context, args map[string]interface{}
 
 	result, err := t.provider.Search(ctx, query, count)
 	if err != nil {
-		return ErrorResult(fmt.Sprintf("search failed: %v", err))
+		return ErrorResult(fmt.Sprintf("search failed: %v", err)).WithError(err)
 	}
 
 	return &ToolResult{
@@ -377,23 +363,27 @@ func (t *WebFetchTool) Parameters() map[string]interface{} {
 	}
 }
 
+func (t *WebFetchTool) CacheTTL() time.Duration {
+	return webCacheTTL
+}
+
 func (t *WebFetchTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
 	urlStr, ok := args["url"].(string)
 	if !ok {
-		return ErrorResult("url is required")
+		return ErrorResult("url is required").WithError(ErrInvalidArgs)
 	}
 
 	parsedURL, err := url.Parse(urlStr)
 	if err != nil {
-		return ErrorResult(fmt.Sprintf("invalid URL: %v", err))
+		return ErrorResult(fmt.Sprintf("invalid URL: %v", err)).WithError(ClassifyError(ErrInvalidArgs, err))
 	}
 
 	if parsedURL.Scheme != "http" && parsedURL.Scheme != "https" {
-		return ErrorResult("only http/https URLs are allowed")
+		return ErrorResult("only http/https URLs are allowed").WithError(ErrInvalidArgs)
 	}
 
 	if parsedURL.Host == "" {
-		return ErrorResult("missing domain in URL")
+		return ErrorResult("missing domain in URL").WithError(ErrInvalidArgs)
 	}
 
 	maxChars := t.maxChars
@@ -428,7 +418,7 @@ func (t *WebFetchTool) Execute(ctx context.Context, args map[string]interface{})
 
 	resp, err := client.Do(req)
 	if err != nil {
-		return ErrorResult(fmt.Sprintf("request failed: %v", err))
+		return ErrorResult(fmt.Sprintf("request failed: %v", err)).WithError(requestError(ctx, err))
 	}
 	defer resp.Body.Close()
 
@@ -483,6 +473,12 @@ func (t *WebFetchTool) Execute(ctx context.Context, args map[string]interface{})
 }
 
 func (t *WebFetchTool) extractText(htmlContent string) string {
+	return htmlToText(htmlContent)
+}
+
+// htmlToText strips scripts, styles and tags from an HTML page and returns
+// its non-empty lines.
+func htmlToText(htmlContent string) string {
 	re := regexp.MustCompile(`<script[\s\S]*?</script>`)
 	result := re.ReplaceAllLiteralString(htmlContent, "")
 	re = regexp.MustCompile(`<style[\s\S]*?</style>`)
@@ -508,3 +504,13 @@ func (t *WebFetchTool) extractText(htmlContent string) string {
 
 	return strings.Join(cleanLines, "\n")
 }
+
+// requestError wraps a failed HTTP round trip. Network failures are worth
+// retrying unless the caller gave up.
+func requestError(ctx context.Context, err error) error {
+	err = fmt.Errorf("request failed: %w", err)
+	if ctx.Err() != nil {
+		return err
+	}
+	return ClassifyError(ErrRetryable, err)
+}
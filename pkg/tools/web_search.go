@@ -0,0 +1,248 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	defaultBingBaseURL = "https://api.bing.microsoft.com/v7.0/search"
+	// maxSnippetChars bounds the snippet shown per result.
+	maxSnippetChars = 300
+	// searchOverfetch is how many extra results are asked for, so that
+	// enough remain after duplicates are dropped.
+	searchOverfetch = 5
+)
+
+// SearchResult is one hit from a search backend.
+type SearchResult struct {
+	Title   string
+	URL     string
+	Snippet string
+}
+
+// ResultsProvider is a search backend that returns individual results.
+// web_search drops duplicates and cleans up snippets before showing them.
+type ResultsProvider interface {
+	Results(ctx context.Context, query string, count int) ([]SearchResult, error)
+}
+
+// resultsSearch turns a ResultsProvider into a SearchProvider.
+type resultsSearch struct {
+	name    string
+	results ResultsProvider
+}
+
+func (s *resultsSearch) Search(ctx context.Context, query string, count int) (string, error) {
+	results, err := s.results.Results(ctx, query, min(count+searchOverfetch, 20))
+	if err != nil {
+		return "", err
+	}
+	results = dedupSearchResults(results)
+	if len(results) == 0 {
+		return fmt.Sprintf("No results for: %s", query), nil
+	}
+	if len(results) > count {
+		results = results[:count]
+	}
+
+	lines := []string{fmt.Sprintf("Results for: %s (via %s)", query, s.name)}
+	for i, r := range results {
+		lines = append(lines, fmt.Sprintf("%d. %s\n   %s", i+1, r.Title, r.URL))
+		if r.Snippet != "" {
+			lines = append(lines, "   "+r.Snippet)
+		}
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// dedupSearchResults cleans up titles and snippets and drops results that
+// point at a page already listed, keeping the longer snippet.
+func dedupSearchResults(results []SearchResult) []SearchResult {
+	out := make([]SearchResult, 0, len(results))
+	seen := make(map[string]int)
+	for _, r := range results {
+		r.Title = cleanSearchText(r.Title)
+		r.Snippet = extractSnippet(r.Snippet)
+		r.URL = strings.TrimSpace(r.URL)
+		if r.URL == "" {
+			continue
+		}
+		if r.Title == "" {
+			r.Title = r.URL
+		}
+		key := canonicalResultURL(r.URL)
+		if i, ok := seen[key]; ok {
+			if len(r.Snippet) > len(out[i].Snippet) {
+				out[i].Snippet = r.Snippet
+			}
+			continue
+		}
+		seen[key] = len(out)
+		out = append(out, r)
+	}
+	return out
+}
+
+// canonicalResultURL reduces a URL to the page it identifies, so that
+// http/https, www., trailing slashes, fragments and tracking parameters
+// do not make the same page look different.
+func canonicalResultURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return strings.ToLower(raw)
+	}
+	host := strings.TrimPrefix(strings.ToLower(u.Host), "www.")
+	query := u.Query()
+	for key := range query {
+		if strings.HasPrefix(key, "utm_") || key == "spm" || key == "from" || key == "fbclid" || key == "gclid" {
+			query.Del(key)
+		}
+	}
+	canonical := host + strings.TrimSuffix(u.EscapedPath(), "/")
+	if encoded := query.Encode(); encoded != "" {
+		canonical += "?" + encoded
+	}
+	return canonical
+}
+
+var searchSpace = regexp.MustCompile(`\s+`)
+
+// cleanSearchText strips markup and entities from backend text.
+func cleanSearchText(s string) string {
+	s = html.UnescapeString(stripTags(s))
+	return strings.TrimSpace(searchSpace.ReplaceAllString(s, " "))
+}
+
+// extractSnippet cleans a snippet and shortens it to maxSnippetChars,
+// ending at a sentence or word boundary where possible.
+func extractSnippet(s string) string {
+	s = cleanSearchText(s)
+	if utf8.RuneCountInString(s) <= maxSnippetChars {
+		return s
+	}
+	cut := string([]rune(s)[:maxSnippetChars])
+	if i := strings.LastIndexAny(cut, ".。!！?？"); i > len(cut)/2 {
+		_, size := utf8.DecodeRuneInString(cut[i:])
+		return cut[:i+size]
+	}
+	if i := strings.LastIndex(cut, " "); i > len(cut)/2 {
+		cut = cut[:i]
+	}
+	return cut + "…"
+}
+
+// getSearchJSON sends req and decodes a JSON response into out.
+func getSearchJSON(ctx context.Context, req *http.Request, timeout time.Duration, out interface{}) error {
+	if req.Header.Get("User-Agent") == "" {
+		req.Header.Set("User-Agent", userAgent)
+	}
+	client := &http.Client{Timeout: timeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return requestError(ctx, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		err := fmt.Errorf("%s returned %d: %s", req.URL.Host, resp.StatusCode, truncateForError(string(body), 300))
+		if kind := StatusErrorKind(resp.StatusCode); kind != nil {
+			err = ClassifyError(kind, err)
+		}
+		return err
+	}
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("failed to parse response from %s: %w", req.URL.Host, err)
+	}
+	return nil
+}
+
+// BingSearchProvider searches with the Bing Web Search API.
+type BingSearchProvider struct {
+	apiKey  string
+	market  string // e.g. zh-CN; Bing picks one when empty
+	baseURL string
+}
+
+func (p *BingSearchProvider) Results(ctx context.Context, query string, count int) ([]SearchResult, error) {
+	baseURL := p.baseURL
+	if baseURL == "" {
+		baseURL = defaultBingBaseURL
+	}
+	params := url.Values{"q": {query}, "count": {fmt.Sprint(count)}, "textFormat": {"Raw"}}
+	if p.market != "" {
+		params.Set("mkt", p.market)
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", baseURL+"?"+params.Encode(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Ocp-Apim-Subscription-Key", p.apiKey)
+
+	var searchResp struct {
+		WebPages struct {
+			Value []struct {
+				Name    string `json:"name"`
+				URL     string `json:"url"`
+				Snippet string `json:"snippet"`
+			} `json:"value"`
+		} `json:"webPages"`
+	}
+	if err := getSearchJSON(ctx, req, 10*time.Second, &searchResp); err != nil {
+		return nil, err
+	}
+	results := make([]SearchResult, 0, len(searchResp.WebPages.Value))
+	for _, item := range searchResp.WebPages.Value {
+		results = append(results, SearchResult{Title: item.Name, URL: item.URL, Snippet: item.Snippet})
+	}
+	return results, nil
+}
+
+// SearXNGSearchProvider searches a SearXNG instance, which must have the
+// JSON output format enabled.
+type SearXNGSearchProvider struct {
+	baseURL string
+}
+
+func (p *SearXNGSearchProvider) Results(ctx context.Context, query string, count int) ([]SearchResult, error) {
+	params := url.Values{"q": {query}, "format": {"json"}}
+	searchURL := strings.TrimSuffix(p.baseURL, "/") + "/search?" + params.Encode()
+	req, err := http.NewRequestWithContext(ctx, "GET", searchURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	var searchResp struct {
+		Results []struct {
+			Title   string `json:"title"`
+			URL     string `json:"url"`
+			Content string `json:"content"`
+		} `json:"results"`
+	}
+	if err := getSearchJSON(ctx, req, 15*time.Second, &searchResp); err != nil {
+		return nil, err
+	}
+	results := make([]SearchResult, 0, len(searchResp.Results))
+	for _, item := range searchResp.Results {
+		if len(results) >= count {
+			break
+		}
+		results = append(results, SearchResult{Title: item.Title, URL: item.URL, Snippet: item.Content})
+	}
+	return results, nil
+}
@@ -0,0 +1,117 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDedupSearchResults(t *testing.T) {
+	results := dedupSearchResults([]SearchResult{
+		{Title: "<b>CSCO</b> guideline &amp; updates", URL: "https://www.example.org/guide/?utm_source=x", Snippet: "Short."},
+		{Title: "CSCO guideline", URL: "http://example.org/guide#top", Snippet: "A longer   snippet\nabout the <em>guideline</em>."},
+		{Title: "Another page", URL: "https://example.org/guide?page=2"},
+		{Title: "No URL", URL: ""},
+	})
+	if len(results) != 2 {
+		t.Fatalf("got %d results: %+v", len(results), results)
+	}
+	if results[0].Title != "CSCO guideline & updates" || results[0].Snippet != "A longer snippet about the guideline." {
+		t.Errorf("first result = %+v", results[0])
+	}
+	if results[1].URL != "https://example.org/guide?page=2" {
+		t.Errorf("second result = %+v", results[1])
+	}
+}
+
+func TestExtractSnippet(t *testing.T) {
+	long := strings.Repeat("word ", 100)
+	tests := []struct {
+		name string
+		in   string
+		want func(string) bool
+	}{
+		{"short kept", "Fits.", func(s string) bool { return s == "Fits." }},
+		{"cut at word", long, func(s string) bool { return strings.HasSuffix(s, "word…") && len([]rune(s)) <= maxSnippetChars+1 }},
+		{"cut at sentence", strings.Repeat("医保报销比例提高。", 40), func(s string) bool { return strings.HasSuffix(s, "。") }},
+	}
+	for _, tt := range tests {
+		if got := extractSnippet(tt.in); !tt.want(got) {
+			t.Errorf("%s: extractSnippet() = %q", tt.name, got)
+		}
+	}
+}
+
+func TestWebSearch_Backends(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/search" && r.URL.Query().Get("format") == "json":
+			w.Write([]byte(`{"results": [
+				{"title": "Shanghai insurance", "url": "https://a.example/1", "content": "Outpatient chemo is covered."},
+				{"title": "Shanghai insurance (mirror)", "url": "https://www.a.example/1/", "content": "Copy."},
+				{"title": "Hospital news", "url": "https://b.example/news", "content": "New clinic opens."}]}`))
+		case r.URL.Path == "/bing":
+			if r.Header.Get("Ocp-Apim-Subscription-Key") != "bing-key" || r.URL.Query().Get("mkt") != "zh-CN" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Write([]byte(`{"webPages": {"value": [{"name": "Bing hit", "url": "https://c.example", "snippet": "From Bing."}]}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	searxng := &resultsSearch{name: "SearXNG", results: &SearXNGSearchProvider{baseURL: server.URL + "/"}}
+	out, err := searxng.Search(context.Background(), "insurance", 5)
+	if err != nil {
+		t.Fatalf("SearXNG search: %v", err)
+	}
+	if !strings.Contains(out, "(via SearXNG)") || strings.Contains(out, "mirror") || !strings.Contains(out, "2. Hospital news") {
+		t.Errorf("SearXNG output:\n%s", out)
+	}
+
+	bing := &resultsSearch{name: "Bing", results: &BingSearchProvider{apiKey: "bing-key", market: "zh-CN", baseURL: server.URL + "/bing"}}
+	if out, err := bing.Search(context.Background(), "news", 3); err != nil || !strings.Contains(out, "From Bing.") {
+		t.Errorf("Bing search = %q, %v", out, err)
+	}
+	bing.results.(*BingSearchProvider).apiKey = "wrong"
+	if _, err := bing.Search(context.Background(), "news", 3); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("Bing with a bad key: %v", err)
+	}
+}
+
+func TestNewWebSearchTool_SelectsBackend(t *testing.T) {
+	opts := WebSearchToolOptions{
+		BraveEnabled: true, BraveAPIKey: "k",
+		SearXNGEnabled: true, SearXNGBaseURL: "http://searx.local", SearXNGMaxResults: 8,
+		DuckDuckGoEnabled: true,
+	}
+	tests := []struct {
+		backend string
+		want    string
+	}{
+		{"", "Brave"},
+		{"searxng", "SearXNG"},
+		{"duckduckgo", "DuckDuckGo"},
+		{"bing", ""},
+	}
+	for _, tt := range tests {
+		opts.Backend = tt.backend
+		tool := NewWebSearchTool(opts)
+		got := ""
+		if tool != nil {
+			got = tool.provider.(*resultsSearch).name
+		}
+		if got != tt.want {
+			t.Errorf("backend %q: got %q, want %q", tt.backend, got, tt.want)
+		}
+	}
+	opts.Backend = "searxng"
+	if tool := NewWebSearchTool(opts); tool.maxResults != 8 {
+		t.Errorf("maxResults = %d, want 8", tool.maxResults)
+	}
+}
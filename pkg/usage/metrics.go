@@ -0,0 +1,51 @@
+package usage
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// WriteMetrics writes the usage totals since the log was started in the
+// Prometheus text format, labelled by provider and model. Users are left
+// out so the metrics can be scraped without exposing who uses the agent.
+func (t *Tracker) WriteMetrics(w io.Writer) error {
+	rows, err := t.Summary(Query{GroupBy: []string{"provider", "model"}})
+	if err != nil {
+		return err
+	}
+	metrics := []struct {
+		name, help, kind string
+		value            func(Row) float64
+	}{
+		{"picoclaw_llm_turns_total", "Agent turns that called an LLM.", "counter",
+			func(r Row) float64 { return float64(r.Turns) }},
+		{"picoclaw_llm_calls_total", "LLM calls.", "counter",
+			func(r Row) float64 { return float64(r.LLMCalls) }},
+		{"picoclaw_llm_degraded_calls_total", "LLM calls made with the budget fallback model.", "counter",
+			func(r Row) float64 { return float64(r.DegradedCalls) }},
+		{"picoclaw_llm_prompt_tokens_total", "Prompt tokens sent to LLMs.", "counter",
+			func(r Row) float64 { return float64(r.PromptTokens) }},
+		{"picoclaw_llm_completion_tokens_total", "Completion tokens returned by LLMs.", "counter",
+			func(r Row) float64 { return float64(r.CompletionTokens) }},
+		{"picoclaw_llm_cached_tokens_total", "Prompt tokens read from the provider's prompt cache.", "counter",
+			func(r Row) float64 { return float64(r.CachedTokens) }},
+		{"picoclaw_llm_cache_write_tokens_total", "Prompt tokens written to the provider's prompt cache.", "counter",
+			func(r Row) float64 { return float64(r.CacheWriteTokens) }},
+		{"picoclaw_llm_tool_calls_total", "Tool calls requested by LLMs.", "counter",
+			func(r Row) float64 { return float64(r.ToolCalls) }},
+		{"picoclaw_llm_cost_usd_total", "Cost of LLM calls in USD, from the pricing table.", "counter",
+			func(r Row) float64 { return r.Cost }},
+		{"picoclaw_llm_cache_savings_usd_total", "What prompt caching saved on LLM calls in USD, from the pricing table.", "counter",
+			func(r Row) float64 { return r.Saved }},
+	}
+	var b strings.Builder
+	for _, m := range metrics {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.kind)
+		for _, r := range rows {
+			fmt.Fprintf(&b, "%s{provider=%q,model=%q} %g\n", m.name, r.Provider, r.Model, m.value(r))
+		}
+	}
+	_, err = io.WriteString(w, b.String())
+	return err
+}
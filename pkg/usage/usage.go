@@ -0,0 +1,323 @@
+// Package usage tracks the tokens, tool calls and cost of LLM calls, so
+// deployments can see what each user and provider costs and cap it.
+package usage
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+const dayFormat = "2006-01-02"
+
+// Entry is the usage of one LLM call. Iteration 1 is the first call of a
+// turn, so turns are counted by their first calls.
+type Entry struct {
+	Time             time.Time `json:"time"`
+	TurnID           string    `json:"turn_id,omitempty"`
+	Iteration        int       `json:"iteration"`
+	AgentID          string    `json:"agent_id,omitempty"`
+	SessionKey       string    `json:"session_key,omitempty"`
+	UserID           string    `json:"user_id,omitempty"`
+	Channel          string    `json:"channel,omitempty"`
+	Provider         string    `json:"provider"`
+	Model            string    `json:"model"`
+	PromptTokens     int       `json:"prompt_tokens"`
+	CompletionTokens int       `json:"completion_tokens"`
+	CachedTokens     int       `json:"cached_tokens,omitempty"`      // part of PromptTokens
+	CacheWriteTokens int       `json:"cache_write_tokens,omitempty"` // part of PromptTokens
+	ToolCalls        int       `json:"tool_calls,omitempty"`
+	Cost             float64   `json:"cost"`
+	// Saved is what prompt caching took off the cost: the cached tokens'
+	// discount less the premium on tokens written to the cache.
+	Saved float64 `json:"saved,omitempty"`
+	// Degraded marks calls made with the budget's fallback model.
+	Degraded bool `json:"degraded,omitempty"`
+	// Estimated marks calls whose provider reported no usage, so their
+	// tokens were counted locally.
+	Estimated bool `json:"estimated,omitempty"`
+}
+
+// Totals adds up entries.
+type Totals struct {
+	Turns            int     `json:"turns"`
+	LLMCalls         int     `json:"llm_calls"`
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	CachedTokens     int     `json:"cached_tokens,omitempty"`
+	CacheWriteTokens int     `json:"cache_write_tokens,omitempty"`
+	ToolCalls        int     `json:"tool_calls"`
+	Cost             float64 `json:"cost"`
+	Saved            float64 `json:"saved,omitempty"`
+	DegradedCalls    int     `json:"degraded_calls,omitempty"`
+}
+
+// Tokens returns prompt and completion tokens together.
+func (t Totals) Tokens() int {
+	return t.PromptTokens + t.CompletionTokens
+}
+
+func (t *Totals) add(e Entry) {
+	if e.Iteration <= 1 {
+		t.Turns++
+	}
+	t.LLMCalls++
+	t.PromptTokens += e.PromptTokens
+	t.CompletionTokens += e.CompletionTokens
+	t.CachedTokens += e.CachedTokens
+	t.CacheWriteTokens += e.CacheWriteTokens
+	t.ToolCalls += e.ToolCalls
+	t.Cost += e.Cost
+	t.Saved += e.Saved
+	if e.Degraded {
+		t.DegradedCalls++
+	}
+}
+
+// key is the unit usage is aggregated by.
+type key struct {
+	Day      string
+	UserID   string
+	Provider string
+	Model    string
+}
+
+// Row is one group of a Summary. Fields not grouped by are empty.
+type Row struct {
+	Day      string `json:"day,omitempty"`
+	UserID   string `json:"user_id,omitempty"`
+	Provider string `json:"provider,omitempty"`
+	Model    string `json:"model,omitempty"`
+	Totals
+}
+
+// Tracker appends entries as JSON lines and keeps their totals in memory,
+// rebuilt from the file on start.
+type Tracker struct {
+	path    string
+	pricing map[string]config.ModelPrice
+	mu      sync.Mutex
+	file    *os.File
+	totals  map[key]*Totals
+	now     func() time.Time
+}
+
+// NewTracker opens (creating if needed) the usage log at path and loads
+// the totals of the entries already in it.
+func NewTracker(path string, pricing map[string]config.ModelPrice) (*Tracker, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create usage directory: %w", err)
+	}
+	t := &Tracker{
+		path:    path,
+		pricing: pricing,
+		totals:  make(map[key]*Totals),
+		now:     time.Now,
+	}
+	if err := t.load(); err != nil {
+		return nil, fmt.Errorf("failed to read usage log: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open usage log: %w", err)
+	}
+	t.file = f
+	return t, nil
+}
+
+func (t *Tracker) load() error {
+	f, err := os.Open(t.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+	for scanner.Scan() {
+		var e Entry
+		if json.Unmarshal(scanner.Bytes(), &e) == nil {
+			t.addUnsafe(e)
+		}
+	}
+	return scanner.Err()
+}
+
+// Price returns the price of a model: the pricing entry for
+// "provider/model", else for the model alone, else for "*".
+func (t *Tracker) Price(provider, model string) (config.ModelPrice, bool) {
+	for _, k := range []string{provider + "/" + model, model, "*"} {
+		if p, ok := t.pricing[k]; ok {
+			return p, true
+		}
+	}
+	return config.ModelPrice{}, false
+}
+
+// Cost returns the price of a call; calls to unpriced models cost 0.
+func (t *Tracker) Cost(provider, model string, promptTokens, completionTokens int) float64 {
+	p, _ := t.Price(provider, model)
+	return (float64(promptTokens)*p.InputPerMillion + float64(completionTokens)*p.OutputPerMillion) / 1e6
+}
+
+// Record prices e, adds it to the totals and writes it. Write failures are
+// logged, not returned, so tracking never breaks a turn.
+func (t *Tracker) Record(e Entry) Entry {
+	if e.Time.IsZero() {
+		e.Time = t.now()
+	}
+	e.Cost = t.Cost(e.Provider, e.Model, e.PromptTokens, e.CompletionTokens)
+	p, _ := t.Price(e.Provider, e.Model)
+	e.Saved = 0
+	if p.CachedInputPerMillion > 0 && e.CachedTokens > 0 {
+		e.Saved += float64(e.CachedTokens) * (p.InputPerMillion - p.CachedInputPerMillion) / 1e6
+	}
+	if p.CacheWritePerMillion > 0 && e.CacheWriteTokens > 0 {
+		e.Saved -= float64(e.CacheWriteTokens) * (p.CacheWritePerMillion - p.InputPerMillion) / 1e6
+	}
+	e.Cost -= e.Saved
+	data, err := json.Marshal(e)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.addUnsafe(e)
+	if err == nil && t.file != nil {
+		_, err = t.file.Write(append(data, '\n'))
+	}
+	if err != nil {
+		logger.ErrorCF("usage", "Failed to write usage entry",
+			map[string]interface{}{
+				"turn_id": e.TurnID,
+				"error":   err.Error(),
+			})
+	}
+	return e
+}
+
+func (t *Tracker) addUnsafe(e Entry) {
+	k := key{Day: e.Time.Local().Format(dayFormat), UserID: e.UserID, Provider: e.Provider, Model: e.Model}
+	totals, ok := t.totals[k]
+	if !ok {
+		totals = &Totals{}
+		t.totals[k] = totals
+	}
+	totals.add(e)
+}
+
+// Today returns the user's totals for the current day.
+func (t *Tracker) Today(userID string) Totals {
+	day := t.now().Format(dayFormat)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var sum Totals
+	for k, totals := range t.totals {
+		if k.Day == day && k.UserID == userID {
+			sum.Add(*totals)
+		}
+	}
+	return sum
+}
+
+// Add adds o to t.
+func (t *Totals) Add(o Totals) {
+	t.Turns += o.Turns
+	t.LLMCalls += o.LLMCalls
+	t.PromptTokens += o.PromptTokens
+	t.CompletionTokens += o.CompletionTokens
+	t.CachedTokens += o.CachedTokens
+	t.CacheWriteTokens += o.CacheWriteTokens
+	t.ToolCalls += o.ToolCalls
+	t.Cost += o.Cost
+	t.Saved += o.Saved
+	t.DegradedCalls += o.DegradedCalls
+}
+
+// Query selects usage for a Summary. Days are inclusive, as YYYY-MM-DD;
+// empty bounds and an empty UserID match everything.
+type Query struct {
+	From    string
+	To      string
+	UserID  string
+	GroupBy []string // any of "day", "user", "provider", "model"
+}
+
+// Summary returns the totals matching q, one row per group, ordered by
+// day then cost.
+func (t *Tracker) Summary(q Query) ([]Row, error) {
+	group := make(map[string]bool, len(q.GroupBy))
+	for _, g := range q.GroupBy {
+		switch g {
+		case "day", "user", "provider", "model":
+			group[g] = true
+		default:
+			return nil, fmt.Errorf("cannot group by %q; use day, user, provider or model", g)
+		}
+	}
+
+	t.mu.Lock()
+	rows := make(map[key]*Row)
+	for k, totals := range t.totals {
+		if (q.From != "" && k.Day < q.From) || (q.To != "" && k.Day > q.To) || (q.UserID != "" && k.UserID != q.UserID) {
+			continue
+		}
+		var g key
+		if group["day"] {
+			g.Day = k.Day
+		}
+		if group["user"] {
+			g.UserID = k.UserID
+		}
+		if group["provider"] {
+			g.Provider = k.Provider
+		}
+		if group["model"] {
+			g.Model = k.Model
+		}
+		row, ok := rows[g]
+		if !ok {
+			row = &Row{Day: g.Day, UserID: g.UserID, Provider: g.Provider, Model: g.Model}
+			rows[g] = row
+		}
+		row.Add(*totals)
+	}
+	t.mu.Unlock()
+
+	out := make([]Row, 0, len(rows))
+	for _, row := range rows {
+		out = append(out, *row)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Day != out[j].Day {
+			return out[i].Day < out[j].Day
+		}
+		if out[i].Cost != out[j].Cost {
+			return out[i].Cost > out[j].Cost
+		}
+		return strings.Join([]string{out[i].UserID, out[i].Provider, out[i].Model}, "/") <
+			strings.Join([]string{out[j].UserID, out[j].Provider, out[j].Model}, "/")
+	})
+	return out, nil
+}
+
+// Close closes the underlying file.
+func (t *Tracker) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.file == nil {
+		return nil
+	}
+	err := t.file.Close()
+	t.file = nil
+	return err
+}
@@ -0,0 +1,172 @@
+package usage
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func newTestTracker(t *testing.T, path string) *Tracker {
+	t.Helper()
+	tracker, err := NewTracker(path, map[string]config.ModelPrice{
+		"openai/gpt-4o": {InputPerMillion: 2.5, OutputPerMillion: 10},
+		"gpt-4o-mini":   {InputPerMillion: 0.15, OutputPerMillion: 0.6},
+	})
+	if err != nil {
+		t.Fatalf("NewTracker: %v", err)
+	}
+	return tracker
+}
+
+func TestCost(t *testing.T) {
+	tracker := newTestTracker(t, filepath.Join(t.TempDir(), "usage.jsonl"))
+	defer tracker.Close()
+
+	tests := []struct {
+		provider, model string
+		want            float64
+	}{
+		{"openai", "gpt-4o", 2.5 + 10},
+		{"openrouter", "gpt-4o-mini", 0.15 + 0.6},
+		{"openrouter", "gpt-4o", 0},
+		{"ollama", "qwen2.5", 0},
+	}
+	for _, tt := range tests {
+		got := tracker.Cost(tt.provider, tt.model, 1_000_000, 1_000_000)
+		if got != tt.want {
+			t.Errorf("Cost(%s, %s) = %g, want %g", tt.provider, tt.model, got, tt.want)
+		}
+	}
+}
+
+func TestRecord_CachedTokens(t *testing.T) {
+	tracker, err := NewTracker(filepath.Join(t.TempDir(), "usage.jsonl"), map[string]config.ModelPrice{
+		"deepseek-chat": {InputPerMillion: 0.56, OutputPerMillion: 1.68, CachedInputPerMillion: 0.07},
+	})
+	if err != nil {
+		t.Fatalf("NewTracker: %v", err)
+	}
+	defer tracker.Close()
+
+	e := tracker.Record(Entry{UserID: "u1", Provider: "deepseek", Model: "deepseek-chat",
+		PromptTokens: 1_000_000, CachedTokens: 800_000, CompletionTokens: 1_000_000})
+	want := 200_000*0.56/1e6 + 800_000*0.07/1e6 + 1.68
+	if diff := e.Cost - want; diff > 1e-9 || diff < -1e-9 {
+		t.Errorf("recorded cost = %g, want %g", e.Cost, want)
+	}
+	if got := tracker.Today("u1").CachedTokens; got != 800_000 {
+		t.Errorf("Today().CachedTokens = %d, want 800000", got)
+	}
+	if want := 800_000 * (0.56 - 0.07) / 1e6; e.Saved-want > 1e-9 || want-e.Saved > 1e-9 {
+		t.Errorf("saved = %g, want %g", e.Saved, want)
+	}
+}
+
+func TestRecord_CacheWrites(t *testing.T) {
+	tracker, err := NewTracker(filepath.Join(t.TempDir(), "usage.jsonl"), map[string]config.ModelPrice{
+		"claude-sonnet-4-5": {InputPerMillion: 3, OutputPerMillion: 15, CachedInputPerMillion: 0.3, CacheWritePerMillion: 3.75},
+	})
+	if err != nil {
+		t.Fatalf("NewTracker: %v", err)
+	}
+	defer tracker.Close()
+
+	// The first call writes the tool schemas and system prompt to the
+	// cache, and costs more than it would without caching
+	first := tracker.Record(Entry{UserID: "u1", Provider: "anthropic", Model: "claude-sonnet-4-5",
+		PromptTokens: 10_000, CacheWriteTokens: 8_000})
+	if want := (2_000*3 + 8_000*3.75) / 1e6; first.Cost-want > 1e-9 || want-first.Cost > 1e-9 || first.Saved >= 0 {
+		t.Errorf("first call cost %g, saved %g; want cost %g", first.Cost, first.Saved, want)
+	}
+	// The next reads them back at a tenth of the price
+	second := tracker.Record(Entry{UserID: "u1", Provider: "anthropic", Model: "claude-sonnet-4-5",
+		PromptTokens: 10_500, CachedTokens: 8_000})
+	if want := (2_500*3 + 8_000*0.3) / 1e6; second.Cost-want > 1e-9 || want-second.Cost > 1e-9 {
+		t.Errorf("second call cost %g, want %g", second.Cost, want)
+	}
+
+	today := tracker.Today("u1")
+	if want := (8_000*2.7 - 8_000*0.75) / 1e6; today.Saved-want > 1e-9 || want-today.Saved > 1e-9 || today.CacheWriteTokens != 8_000 {
+		t.Errorf("today = %+v, want saved %g", today, want)
+	}
+}
+
+func TestTracker(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "usage", "usage.jsonl")
+	tracker := newTestTracker(t, path)
+	now := time.Date(2026, 3, 2, 15, 0, 0, 0, time.Local)
+	tracker.now = func() time.Time { return now }
+
+	yesterday := now.AddDate(0, 0, -1)
+	tracker.Record(Entry{Time: yesterday, TurnID: "t0", Iteration: 1, UserID: "u1", Provider: "openai", Model: "gpt-4o",
+		PromptTokens: 1000, CompletionTokens: 100})
+	tracker.Record(Entry{TurnID: "t1", Iteration: 1, UserID: "u1", Provider: "openai", Model: "gpt-4o",
+		PromptTokens: 2000, CompletionTokens: 50, ToolCalls: 2})
+	tracker.Record(Entry{TurnID: "t1", Iteration: 2, UserID: "u1", Provider: "openai", Model: "gpt-4o",
+		PromptTokens: 3000, CompletionTokens: 200})
+	e := tracker.Record(Entry{TurnID: "t2", Iteration: 1, UserID: "u2", Provider: "openrouter", Model: "gpt-4o-mini",
+		PromptTokens: 1000, CompletionTokens: 1000, Degraded: true})
+	if e.Cost != (1000*0.15+1000*0.6)/1e6 {
+		t.Errorf("recorded cost = %g", e.Cost)
+	}
+	tracker.Close()
+
+	// Totals survive a restart.
+	tracker = newTestTracker(t, path)
+	defer tracker.Close()
+	tracker.now = func() time.Time { return now }
+
+	today := tracker.Today("u1")
+	want := Totals{Turns: 1, LLMCalls: 2, PromptTokens: 5000, CompletionTokens: 250, ToolCalls: 2,
+		Cost: (5000*2.5 + 250*10) / 1e6}
+	if today != want {
+		t.Errorf("Today(u1) = %+v, want %+v", today, want)
+	}
+
+	rows, err := tracker.Summary(Query{From: now.Format(dayFormat), GroupBy: []string{"provider"}})
+	if err != nil {
+		t.Fatalf("Summary: %v", err)
+	}
+	if len(rows) != 2 || rows[0].Provider != "openai" || rows[0].LLMCalls != 2 ||
+		rows[1].Provider != "openrouter" || rows[1].DegradedCalls != 1 || rows[1].Day != "" {
+		t.Errorf("rows by provider = %+v", rows)
+	}
+
+	rows, _ = tracker.Summary(Query{UserID: "u1", GroupBy: []string{"day"}})
+	if len(rows) != 2 || rows[0].Day != yesterday.Format(dayFormat) || rows[0].Turns != 1 || rows[1].Turns != 1 {
+		t.Errorf("rows by day = %+v", rows)
+	}
+
+	if _, err := tracker.Summary(Query{GroupBy: []string{"session"}}); err == nil {
+		t.Error("grouping by session was accepted")
+	}
+}
+
+func TestWriteMetrics(t *testing.T) {
+	tracker := newTestTracker(t, filepath.Join(t.TempDir(), "usage.jsonl"))
+	defer tracker.Close()
+	tracker.Record(Entry{Iteration: 1, UserID: "patient-42", Provider: "openai", Model: "gpt-4o",
+		PromptTokens: 1200, CompletionTokens: 300, ToolCalls: 1})
+
+	var b strings.Builder
+	if err := tracker.WriteMetrics(&b); err != nil {
+		t.Fatalf("WriteMetrics: %v", err)
+	}
+	out := b.String()
+	for _, line := range []string{
+		"# TYPE picoclaw_llm_prompt_tokens_total counter",
+		`picoclaw_llm_prompt_tokens_total{provider="openai",model="gpt-4o"} 1200`,
+		`picoclaw_llm_tool_calls_total{provider="openai",model="gpt-4o"} 1`,
+		`picoclaw_llm_cost_usd_total{provider="openai",model="gpt-4o"} 0.006`,
+	} {
+		if !strings.Contains(out, line) {
+			t.Errorf("metrics missing %q:\n%s", line, out)
+		}
+	}
+	if strings.Contains(out, "patient-42") {
+		t.Error("metrics expose user IDs")
+	}
+}
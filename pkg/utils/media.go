@@ -1,8 +1,12 @@
 package utils
 
 import (
+	"errors"
+	"fmt"
 	"io"
+	"mime"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
@@ -32,6 +36,19 @@ func IsAudioFile(filename, contentType string) bool {
 	return false
 }
 
+// IsImageFile checks if a file is an image based on its filename extension and content type.
+func IsImageFile(filename, contentType string) bool {
+	imageExtensions := []string{".jpg", ".jpeg", ".png", ".webp", ".bmp", ".gif", ".heic"}
+
+	for _, ext := range imageExtensions {
+		if strings.HasSuffix(strings.ToLower(filename), ext) {
+			return true
+		}
+	}
+
+	return strings.HasPrefix(strings.ToLower(contentType), "image/")
+}
+
 // SanitizeFilename removes potentially dangerous characters from a filename
 // and returns a safe version for local filesystem storage.
 func SanitizeFilename(filename string) string {
@@ -64,7 +81,7 @@ func DownloadFile(url, filename string, opts DownloadOptions) string {
 		opts.LoggerPrefix = "utils"
 	}
 
-	mediaDir := filepath.Join(os.TempDir(), "picoclaw_media")
+	mediaDir := mediaDir()
 	if err := os.MkdirAll(mediaDir, 0700); err != nil {
 		logger.ErrorCF(opts.LoggerPrefix, "Failed to create media directory", map[string]interface{}{
 			"error": err.Error(),
@@ -140,3 +157,186 @@ func DownloadFileSimple(url, filename string) string {
 		LoggerPrefix: "media",
 	})
 }
+
+func mediaDir() string {
+	return filepath.Join(os.TempDir(), "picoclaw_media")
+}
+
+// keptPrefix marks the copies made by KeepMedia.
+const keptPrefix = "kept_"
+
+// MediaLimits are the attachments a channel accepts. MaxBytes of 0 allows
+// any size; AllowedTypes are MIME types, or "image/*"-style prefixes, and
+// none allows any type.
+type MediaLimits struct {
+	MaxBytes     int64
+	AllowedTypes []string
+}
+
+// allows reports whether a file of the given type is accepted.
+func (l MediaLimits) allows(mimeType string) bool {
+	if len(l.AllowedTypes) == 0 {
+		return true
+	}
+	for _, allowed := range l.AllowedTypes {
+		allowed = strings.ToLower(strings.TrimSpace(allowed))
+		if prefix, ok := strings.CutSuffix(allowed, "*"); ok && strings.HasPrefix(mimeType, prefix) {
+			return true
+		}
+		if mimeType == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// DetectMediaType returns the MIME type of a file from its content, using
+// its extension when the content does not tell.
+func DetectMediaType(path string) string {
+	byExt := mime.TypeByExtension(strings.ToLower(filepath.Ext(path)))
+	if i := strings.Index(byExt, ";"); i >= 0 {
+		byExt = byExt[:i]
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return byExt
+	}
+	defer f.Close()
+	head := make([]byte, 512)
+	n, _ := io.ReadFull(f, head)
+	sniffed := http.DetectContentType(head[:n])
+	if i := strings.Index(sniffed, ";"); i >= 0 {
+		sniffed = sniffed[:i]
+	}
+	switch {
+	case sniffed == "application/ogg":
+		return "audio/ogg"
+	case sniffed == "video/mp4" && strings.HasPrefix(byExt, "audio/"):
+		// M4A voice notes share MP4's signature
+		return byExt
+	case (sniffed == "application/octet-stream" || sniffed == "text/plain") && byExt != "":
+		return byExt
+	}
+	return sniffed
+}
+
+// KeepMedia copies the attachments in media that limits accept, and
+// returns media with each path replaced by its copy. Attachments given as
+// http(s) URLs are downloaded. Channels delete their downloads once a
+// message is handed over, before the agent gets to read them; the copies
+// are removed with RemoveKeptMedia when the message is done, unless the
+// agent has moved them. Rejected lists the attachments that were not
+// accepted, and why, for telling the user.
+func KeepMedia(media []string, limits MediaLimits) (kept []string, rejected []string) {
+	if err := os.MkdirAll(mediaDir(), 0700); err != nil {
+		return media, nil
+	}
+	for _, source := range media {
+		path, err := keepMediaFile(source, limits.MaxBytes)
+		if errors.Is(err, errMediaTooLarge) {
+			rejected = append(rejected, fmt.Sprintf("%s (larger than %s)", mediaName(source), formatBytes(limits.MaxBytes)))
+			continue
+		}
+		if err != nil {
+			logger.WarnCF("media", "Failed to keep attachment for the agent", map[string]interface{}{
+				"source": source,
+				"error":  err.Error(),
+			})
+			rejected = append(rejected, fmt.Sprintf("%s (could not be read)", mediaName(source)))
+			continue
+		}
+		if mimeType := DetectMediaType(path); !limits.allows(mimeType) {
+			os.Remove(path)
+			rejected = append(rejected, fmt.Sprintf("%s (%s files are not accepted)", mediaName(source), mimeType))
+			continue
+		}
+		kept = append(kept, path)
+	}
+	return kept, rejected
+}
+
+var errMediaTooLarge = errors.New("attachment too large")
+
+// keepMediaFile copies or downloads source into the media directory,
+// failing with errMediaTooLarge when it is larger than maxBytes.
+func keepMediaFile(source string, maxBytes int64) (string, error) {
+	var body io.Reader
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		client := &http.Client{Timeout: 60 * time.Second}
+		resp, err := client.Get(source)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return "", fmt.Errorf("download returned status %d", resp.StatusCode)
+		}
+		if maxBytes > 0 && resp.ContentLength > maxBytes {
+			return "", errMediaTooLarge
+		}
+		body = resp.Body
+	} else {
+		f, err := os.Open(source)
+		if err != nil {
+			return "", err
+		}
+		defer f.Close()
+		body = f
+	}
+	if maxBytes > 0 {
+		body = io.LimitReader(body, maxBytes+1)
+	}
+
+	dst := filepath.Join(mediaDir(), keptPrefix+uuid.New().String()[:8]+"_"+SanitizeFilename(mediaName(source)))
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return "", err
+	}
+	n, err := io.Copy(out, body)
+	out.Close()
+	if err == nil && maxBytes > 0 && n > maxBytes {
+		err = errMediaTooLarge
+	}
+	if err != nil {
+		os.Remove(dst)
+		return "", err
+	}
+	return dst, nil
+}
+
+// mediaName is the file name of a path or URL.
+func mediaName(source string) string {
+	if u, err := url.Parse(source); err == nil && u.Scheme != "" && u.Host != "" {
+		source = u.Path
+	}
+	name := filepath.Base(source)
+	if name == "." || name == "/" {
+		return "attachment"
+	}
+	return name
+}
+
+// formatBytes writes a size limit for people, as "20 MB".
+func formatBytes(n int64) string {
+	if n <= 0 {
+		return "the size limit"
+	}
+	if n >= 1<<20 {
+		return fmt.Sprintf("%d MB", n>>20)
+	}
+	return fmt.Sprintf("%d KB", n>>10)
+}
+
+// IsKeptMedia reports whether path is a copy made by KeepMedia.
+func IsKeptMedia(path string) bool {
+	return filepath.Dir(path) == mediaDir() && strings.HasPrefix(filepath.Base(path), keptPrefix)
+}
+
+// RemoveKeptMedia deletes the copies KeepMedia made among media.
+func RemoveKeptMedia(media []string) {
+	for _, path := range media {
+		if IsKeptMedia(path) {
+			os.Remove(path)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package utils
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeTestPNG(t *testing.T, dir, name string) string {
+	t.Helper()
+	var buf bytes.Buffer
+	png.Encode(&buf, image.NewGray(image.Rect(0, 0, 20, 10)))
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, buf.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestDetectMediaType(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string][]byte{
+		"report.pdf":  []byte("%PDF-1.7\n1 0 obj\n"),
+		"voice.ogg":   append([]byte("OggS\x00\x02"), make([]byte, 40)...),
+		"photo.jpg":   writePNGBytes(),
+		"notes.txt":   []byte("CA19-9 37 U/mL"),
+		"setup.bin":   {0x4d, 0x5a, 0x90, 0x00, 0x03},
+		"scan.noext":  []byte("%PDF-1.4\n"),
+		"disguised.j": []byte("%PDF-1.4\n"),
+	}
+	want := map[string]string{
+		"report.pdf":  "application/pdf",
+		"voice.ogg":   "audio/ogg",
+		"photo.jpg":   "image/png",
+		"notes.txt":   "text/plain",
+		"setup.bin":   "application/octet-stream",
+		"scan.noext":  "application/pdf",
+		"disguised.j": "application/pdf",
+	}
+	for name, data := range files {
+		path := filepath.Join(dir, name)
+		os.WriteFile(path, data, 0600)
+		if got := DetectMediaType(path); got != want[name] {
+			t.Errorf("DetectMediaType(%s) = %q, want %q", name, got, want[name])
+		}
+	}
+}
+
+func writePNGBytes() []byte {
+	var buf bytes.Buffer
+	png.Encode(&buf, image.NewGray(image.Rect(0, 0, 4, 4)))
+	return buf.Bytes()
+}
+
+func TestKeepMedia(t *testing.T) {
+	dir := t.TempDir()
+	photo := writeTestPNG(t, dir, "ct.png")
+	zip := filepath.Join(dir, "records.zip")
+	os.WriteFile(zip, []byte("PK\x03\x04"+strings.Repeat("x", 100)), 0600)
+	big := filepath.Join(dir, "scan.pdf")
+	os.WriteFile(big, append([]byte("%PDF-1.7\n"), make([]byte, 4096)...), 0600)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(writePNGBytes())
+	}))
+	defer server.Close()
+
+	limits := MediaLimits{MaxBytes: 2048, AllowedTypes: []string{"image/*", "application/pdf"}}
+	kept, rejected := KeepMedia([]string{photo, zip, big, server.URL + "/files/wound.png"}, limits)
+	defer RemoveKeptMedia(kept)
+
+	if len(kept) != 2 {
+		t.Fatalf("kept = %v", kept)
+	}
+	for _, path := range kept {
+		if filepath.Dir(path) != mediaDir() || DetectMediaType(path) != "image/png" {
+			t.Errorf("kept %s as %s", path, DetectMediaType(path))
+		}
+	}
+	if !strings.HasSuffix(kept[1], "_wound.png") {
+		t.Errorf("downloaded copy = %s", kept[1])
+	}
+	wantRejected := []string{
+		"records.zip (application/zip files are not accepted)",
+		"scan.pdf (larger than 2 KB)",
+	}
+	if strings.Join(rejected, "|") != strings.Join(wantRejected, "|") {
+		t.Errorf("rejected = %q", rejected)
+	}
+	if _, err := os.Stat(photo); err != nil {
+		t.Errorf("the channel's own file was touched: %v", err)
+	}
+}
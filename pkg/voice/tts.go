@@ -0,0 +1,298 @@
+package voice
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// Synthesizer turns text into speech.
+type Synthesizer interface {
+	Synthesize(ctx context.Context, text string, opts SpeechOptions) (*Speech, error)
+}
+
+// SpeechOptions override the configured voice and speaking rate. Rate is
+// relative to normal speed, such as "-20%".
+type SpeechOptions struct {
+	Voice string
+	Rate  string
+}
+
+// Speech is synthesized audio. Format is its file extension.
+type Speech struct {
+	Audio  []byte
+	Format string
+}
+
+// MimeType returns the media type of the audio.
+func (s *Speech) MimeType() string {
+	switch s.Format {
+	case "mp3":
+		return "audio/mpeg"
+	case "ogg", "opus":
+		return "audio/ogg"
+	case "m4a":
+		return "audio/mp4"
+	case "webm":
+		return "audio/webm"
+	}
+	return "audio/" + s.Format
+}
+
+// NewSynthesizer returns the synthesizer for cfg.Backend.
+func NewSynthesizer(cfg config.TTSConfig) (Synthesizer, error) {
+	timeout := time.Duration(cfg.TimeoutSeconds) * time.Second
+	if timeout <= 0 {
+		timeout = 60 * time.Second
+	}
+	defaults := SpeechOptions{Voice: cfg.Voice, Rate: cfg.Rate}
+	switch strings.ToLower(cfg.Backend) {
+	case "", "edge":
+		command := cfg.EdgeCommand
+		if command == "" {
+			command = "edge-tts"
+		}
+		return &EdgeSynthesizer{command: command, defaults: defaults, timeout: timeout}, nil
+	case "azure":
+		if cfg.AzureKey == "" || (cfg.AzureRegion == "" && cfg.AzureEndpoint == "") {
+			return nil, fmt.Errorf("tts: azure_key and azure_region are required")
+		}
+		return NewAzureSynthesizer(cfg.AzureRegion, cfg.AzureEndpoint, cfg.AzureKey, cfg.AzureFormat, defaults, timeout), nil
+	case "local":
+		if len(cfg.LocalCommand) == 0 {
+			return nil, fmt.Errorf("tts: local_command is not set")
+		}
+		format := cfg.LocalFormat
+		if format == "" {
+			format = "wav"
+		}
+		return &CommandSynthesizer{argv: cfg.LocalCommand, format: format, defaults: defaults, timeout: timeout}, nil
+	}
+	return nil, fmt.Errorf("tts: unknown backend %q", cfg.Backend)
+}
+
+func (o SpeechOptions) or(defaults SpeechOptions) SpeechOptions {
+	if o.Voice == "" {
+		o.Voice = defaults.Voice
+	}
+	if o.Rate == "" {
+		o.Rate = defaults.Rate
+	}
+	return o
+}
+
+// EdgeSynthesizer runs the edge-tts command, which uses the free Microsoft
+// Edge read-aloud voices and writes MP3.
+type EdgeSynthesizer struct {
+	command  string
+	defaults SpeechOptions
+	timeout  time.Duration
+}
+
+func (s *EdgeSynthesizer) Synthesize(ctx context.Context, text string, opts SpeechOptions) (*Speech, error) {
+	opts = opts.or(s.defaults)
+	dir, err := os.MkdirTemp("", "picoclaw-tts-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	input, output := filepath.Join(dir, "text.txt"), filepath.Join(dir, "speech.mp3")
+	if err := os.WriteFile(input, []byte(text), 0600); err != nil {
+		return nil, err
+	}
+
+	args := []string{"--file", input, "--write-media", output}
+	if opts.Voice != "" {
+		args = append(args, "--voice", opts.Voice)
+	}
+	if opts.Rate != "" {
+		// A negative rate must be joined to its flag, or it reads as a flag.
+		args = append(args, "--rate="+opts.Rate)
+	}
+	if err := runSpeechCommand(ctx, s.timeout, s.command, args, nil, nil); err != nil {
+		return nil, err
+	}
+	audio, err := os.ReadFile(output)
+	if err != nil {
+		return nil, fmt.Errorf("edge-tts wrote no audio: %w", err)
+	}
+	return &Speech{Audio: audio, Format: "mp3"}, nil
+}
+
+// CommandSynthesizer runs a local TTS program, such as piper, with the text
+// on standard input. In argv, {voice} and {rate} are replaced by the speech
+// options and {output} by a file for the audio; without {output}, the audio
+// is read from standard output.
+type CommandSynthesizer struct {
+	argv     []string
+	format   string
+	defaults SpeechOptions
+	timeout  time.Duration
+}
+
+func (s *CommandSynthesizer) Synthesize(ctx context.Context, text string, opts SpeechOptions) (*Speech, error) {
+	opts = opts.or(s.defaults)
+	dir, err := os.MkdirTemp("", "picoclaw-tts-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	output := filepath.Join(dir, "speech."+s.format)
+
+	toFile := false
+	args := make([]string, len(s.argv)-1)
+	for i, arg := range s.argv[1:] {
+		toFile = toFile || strings.Contains(arg, "{output}")
+		args[i] = strings.NewReplacer("{voice}", opts.Voice, "{rate}", opts.Rate, "{output}", output).Replace(arg)
+	}
+	var stdout bytes.Buffer
+	if err := runSpeechCommand(ctx, s.timeout, s.argv[0], args, strings.NewReader(text), &stdout); err != nil {
+		return nil, err
+	}
+	audio := stdout.Bytes()
+	if toFile {
+		if audio, err = os.ReadFile(output); err != nil {
+			return nil, fmt.Errorf("%s wrote no audio: %w", filepath.Base(s.argv[0]), err)
+		}
+	}
+	if len(audio) == 0 {
+		return nil, fmt.Errorf("%s produced no audio", filepath.Base(s.argv[0]))
+	}
+	return &Speech{Audio: audio, Format: s.format}, nil
+}
+
+func runSpeechCommand(ctx context.Context, timeout time.Duration, name string, args []string, stdin io.Reader, stdout io.Writer) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stdin = stdin
+	cmd.Stdout = stdout
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		logger.WarnCF("voice", "Speech command failed", map[string]interface{}{
+			"command": name,
+			"error":   err.Error(),
+			"stderr":  strings.TrimSpace(stderr.String()),
+		})
+		if ctx.Err() == context.DeadlineExceeded {
+			return fmt.Errorf("%s timed out after %s", filepath.Base(name), timeout)
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			if len(msg) > 300 {
+				msg = msg[len(msg)-300:]
+			}
+			return fmt.Errorf("%s failed: %w: %s", filepath.Base(name), err, msg)
+		}
+		return fmt.Errorf("%s failed: %w", filepath.Base(name), err)
+	}
+	return nil
+}
+
+const azureDefaultFormat = "audio-24khz-48kbitrate-mono-mp3"
+
+// AzureSynthesizer calls the Azure AI Speech text-to-speech REST API.
+type AzureSynthesizer struct {
+	endpoint   string
+	key        string
+	format     string
+	defaults   SpeechOptions
+	httpClient *http.Client
+}
+
+// NewAzureSynthesizer returns a synthesizer for the Speech resource in
+// region. A non-empty endpoint replaces the regional URL.
+func NewAzureSynthesizer(region, endpoint, key, format string, defaults SpeechOptions, timeout time.Duration) *AzureSynthesizer {
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://%s.tts.speech.microsoft.com/cognitiveservices/v1", region)
+	}
+	if format == "" {
+		format = azureDefaultFormat
+	}
+	return &AzureSynthesizer{
+		endpoint:   endpoint,
+		key:        key,
+		format:     format,
+		defaults:   defaults,
+		httpClient: &http.Client{Timeout: timeout},
+	}
+}
+
+func (s *AzureSynthesizer) Synthesize(ctx context.Context, text string, opts SpeechOptions) (*Speech, error) {
+	opts = opts.or(s.defaults)
+	if opts.Voice == "" {
+		return nil, fmt.Errorf("azure speech needs a voice, such as zh-CN-XiaoxiaoNeural")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.endpoint, strings.NewReader(azureSSML(text, opts)))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Ocp-Apim-Subscription-Key", s.key)
+	req.Header.Set("Content-Type", "application/ssml+xml")
+	req.Header.Set("X-Microsoft-OutputFormat", s.format)
+	req.Header.Set("User-Agent", "picoclaw")
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("azure speech request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	audio, err := io.ReadAll(io.LimitReader(resp.Body, 50<<20))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read azure speech response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		msg := strings.TrimSpace(string(audio))
+		if len(msg) > 300 {
+			msg = msg[:300]
+		}
+		return nil, fmt.Errorf("azure speech returned %d: %s", resp.StatusCode, msg)
+	}
+	return &Speech{Audio: audio, Format: azureFormatExtension(s.format)}, nil
+}
+
+// azureSSML wraps text in SSML for the voice, with the language taken from
+// the voice name ("zh-CN-XiaoxiaoNeural" speaks zh-CN).
+func azureSSML(text string, opts SpeechOptions) string {
+	lang := "zh-CN"
+	if parts := strings.SplitN(opts.Voice, "-", 3); len(parts) == 3 {
+		lang = parts[0] + "-" + parts[1]
+	}
+	var escaped bytes.Buffer
+	xml.EscapeText(&escaped, []byte(text))
+	body := escaped.String()
+	if opts.Rate != "" {
+		var rate bytes.Buffer
+		xml.EscapeText(&rate, []byte(opts.Rate))
+		body = fmt.Sprintf("<prosody rate='%s'>%s</prosody>", rate.String(), body)
+	}
+	var voice bytes.Buffer
+	xml.EscapeText(&voice, []byte(opts.Voice))
+	return fmt.Sprintf("<speak version='1.0' xmlns='http://www.w3.org/2001/10/synthesis' xml:lang='%s'><voice name='%s'>%s</voice></speak>",
+		lang, voice.String(), body)
+}
+
+func azureFormatExtension(format string) string {
+	switch f := strings.ToLower(format); {
+	case strings.Contains(f, "mp3"):
+		return "mp3"
+	case strings.Contains(f, "ogg"):
+		return "ogg"
+	case strings.Contains(f, "webm"):
+		return "webm"
+	case strings.HasPrefix(f, "riff"):
+		return "wav"
+	}
+	return "pcm"
+}
@@ -0,0 +1,92 @@
+package voice
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestAzureSynthesizer(t *testing.T) {
+	var ssml, format, key string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		ssml, format, key = string(body), r.Header.Get("X-Microsoft-OutputFormat"), r.Header.Get("Ocp-Apim-Subscription-Key")
+		w.Write([]byte("ID3audio"))
+	}))
+	defer server.Close()
+
+	synth, err := NewSynthesizer(config.TTSConfig{Backend: "azure", AzureEndpoint: server.URL, AzureKey: "k1", Voice: "zh-CN-XiaoxiaoNeural", Rate: "-10%"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	speech, err := synth.Synthesize(context.Background(), "CA19-9 < 37 & 正常", SpeechOptions{Rate: "-25%"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(speech.Audio) != "ID3audio" || speech.Format != "mp3" || speech.MimeType() != "audio/mpeg" {
+		t.Errorf("speech = %q %s", speech.Audio, speech.Format)
+	}
+	want := "<speak version='1.0' xmlns='http://www.w3.org/2001/10/synthesis' xml:lang='zh-CN'><voice name='zh-CN-XiaoxiaoNeural'>" +
+		"<prosody rate='-25%'>CA19-9 &lt; 37 &amp; 正常</prosody></voice></speak>"
+	if ssml != want || format != azureDefaultFormat || key != "k1" {
+		t.Errorf("request: ssml %s, format %q, key %q", ssml, format, key)
+	}
+}
+
+func TestAzureSynthesizer_Error(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "bad voice", http.StatusBadRequest)
+	}))
+	defer server.Close()
+	synth := NewAzureSynthesizer("", server.URL, "k1", "", SpeechOptions{Voice: "en-US-JennyNeural"}, time.Second)
+	if _, err := synth.Synthesize(context.Background(), "hello", SpeechOptions{}); err == nil || !strings.Contains(err.Error(), "400: bad voice") {
+		t.Errorf("error = %v", err)
+	}
+}
+
+func TestCommandSynthesizer(t *testing.T) {
+	tests := []struct {
+		name string
+		argv []string
+		want string
+	}{
+		{"output file", []string{"sh", "-c", `{ echo "$1"; cat; } > "$0"`, "{output}", "{voice}"}, "v1\nhello"},
+		{"stdout", []string{"sh", "-c", `printf '%s:' "$0"; cat`, "{rate}"}, "-10%:hello"},
+	}
+	for _, tt := range tests {
+		synth, err := NewSynthesizer(config.TTSConfig{Backend: "local", LocalCommand: tt.argv, Voice: "v1", Rate: "-10%"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		speech, err := synth.Synthesize(context.Background(), "hello", SpeechOptions{})
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if string(speech.Audio) != tt.want || speech.Format != "wav" {
+			t.Errorf("%s: audio %q, format %s", tt.name, speech.Audio, speech.Format)
+		}
+	}
+
+	synth, _ := NewSynthesizer(config.TTSConfig{Backend: "local", LocalCommand: []string{"sh", "-c", "echo no model >&2; exit 3"}})
+	if _, err := synth.Synthesize(context.Background(), "hello", SpeechOptions{}); err == nil || !strings.Contains(err.Error(), "no model") {
+		t.Errorf("error = %v", err)
+	}
+}
+
+func TestNewSynthesizer_Errors(t *testing.T) {
+	for _, cfg := range []config.TTSConfig{
+		{Backend: "azure", AzureKey: "k"},
+		{Backend: "local"},
+		{Backend: "espeak"},
+	} {
+		if _, err := NewSynthesizer(cfg); err == nil {
+			t.Errorf("NewSynthesizer(%+v) = nil error", cfg)
+		}
+	}
+}